@@ -6,13 +6,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/nishisan-dev/n-backup/internal/agent"
 	"github.com/nishisan-dev/n-backup/internal/config"
 	"github.com/nishisan-dev/n-backup/internal/logging"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
 )
 
 func main() {
@@ -22,23 +29,101 @@ func main() {
 		return
 	}
 
+	// Subcomando "status" — lê o histórico local de execuções
+	if len(os.Args) >= 2 && os.Args[1] == "status" {
+		runStatus(os.Args[2:])
+		return
+	}
+
+	// Subcomando "enroll" — obtém o certificado de client via token de uso único
+	if len(os.Args) >= 2 && os.Args[1] == "enroll" {
+		runEnroll(os.Args[2:])
+		return
+	}
+
+	// Subcomando "fsck" — verifica e repara os arquivos de estado locais
+	if len(os.Args) >= 2 && os.Args[1] == "fsck" {
+		runFsck(os.Args[2:])
+		return
+	}
+
+	// Subcomando "migrate-config" — migra o agent.yaml para o config_version atual
+	if len(os.Args) >= 2 && os.Args[1] == "migrate-config" {
+		runMigrateConfig(os.Args[2:])
+		return
+	}
+
+	// Subcomando "explain-path" — mostra se um caminho entra no backup e qual regra decidiu
+	if len(os.Args) >= 2 && os.Args[1] == "explain-path" {
+		runExplainPath(os.Args[2:])
+		return
+	}
+
+	// Subcomando "restore" — restaura um arquivo de um backup sem baixar o archive
+	if len(os.Args) >= 2 && os.Args[1] == "restore" {
+		runRestore(os.Args[2:])
+		return
+	}
+
+	// Subcomando "bench" — mede o throughput até o server com dados sintéticos
+	if len(os.Args) >= 2 && os.Args[1] == "bench" {
+		runBench(os.Args[2:])
+		return
+	}
+
+	// Subcomandos "trigger", "cancel" e "reload" — falam com o daemon via admin socket
+	if len(os.Args) >= 2 {
+		switch os.Args[1] {
+		case agent.AdminCmdTrigger, agent.AdminCmdCancel, agent.AdminCmdReload:
+			runAdminCommand(os.Args[1], os.Args[2:])
+			return
+		}
+	}
+
 	configPath := flag.String("config", "/etc/nbackup/agent.yaml", "path to agent config file")
 	once := flag.Bool("once", false, "run backup once and exit (no daemon)")
 	showProgress := flag.Bool("progress", false, "show progress bar (only with --once)")
+	force := flag.Bool("force", false, "ignore min_interval between successful runs (only with --once)")
+	outputFlag := flag.String("output", agent.OutputText, "result format with --once: text or json (logs go to stderr)")
 	flag.Parse()
 
+	output, err := agent.ParseOutput(*outputFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --output: %v\n", err)
+		os.Exit(2)
+	}
+
 	cfg, err := config.LoadAgentConfig(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 		os.Exit(1)
 	}
 
-	logger, logCloser := logging.NewLogger(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.File)
+	if err := logging.SetRedaction(cfg.Logging.Redact.Patterns, cfg.Logging.Redact.Replacement); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	logging.SetSampling(cfg.Logging.Sampling.SampleRules())
+	logging.SetRotation(cfg.Logging.Rotation.LogRotation())
+	// Com --output json, stdout fica só com o resultado
+	console := os.Stdout
+	if *once && output == agent.OutputJSON {
+		console = os.Stderr
+	}
+	logger, logCloser := logging.NewTargetLogger(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.File, console, cfg.Logging.LogTarget())
 	defer logCloser.Close()
 
+	cfg.WarnMigrations(logger)
+
 	if *once {
 		// Execução única — roda todos os backups sequencialmente
-		if err := agent.RunAllBackups(context.Background(), cfg, *showProgress, logger); err != nil {
+		results, err := agent.RunAllBackups(context.Background(), cfg, *showProgress, *force, logger)
+		if output == agent.OutputJSON {
+			if werr := agent.WriteOnceJSON(os.Stdout, results, err); werr != nil {
+				fmt.Fprintf(os.Stderr, "Error writing results: %v\n", werr)
+			}
+		}
+		if err != nil {
 			logger.Error("backup failed", "error", err)
 			os.Exit(1)
 		}
@@ -47,19 +132,483 @@ func main() {
 
 	// Daemon mode
 	if err := agent.RunDaemon(*configPath, cfg, logger); err != nil {
+		// Exit 3: shutdown abortou backups em andamento (daemon.shutdown)
+		if errors.Is(err, agent.ErrShutdownAborted) {
+			logger.Warn("daemon stopped", "error", err)
+			os.Exit(3)
+		}
 		logger.Error("daemon error", "error", err)
 		os.Exit(1)
 	}
 }
 
+// runFsck verifica os arquivos de estado do agent em daemon.state_dir. Com
+// --repair, reescreve cada arquivo com os registros válidos, preservando o
+// original em {arquivo}.corrupt. Sai com código 1 se algum arquivo continuar
+// corrompido.
+func runFsck(args []string) {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/agent.yaml", "path to agent config file")
+	repair := fs.Bool("repair", false, "rewrite damaged files keeping only valid records (stop the daemon first)")
+	outputFlag := fs.String("output", agent.OutputText, "output format: text or json")
+	fs.Parse(args)
+
+	output, err := agent.ParseOutput(*outputFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --output: %v\n", err)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadAgentConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	results := agent.FsckStateFiles(cfg, *repair)
+	var unresolved int
+	if output == agent.OutputJSON {
+		unresolved, err = statefile.WriteResultsJSON(os.Stdout, results)
+	} else {
+		unresolved, err = statefile.WriteResults(os.Stdout, results)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+		os.Exit(1)
+	}
+	if unresolved > 0 {
+		if !*repair {
+			fmt.Fprintf(os.Stderr, "%d damaged file(s); run with --repair (daemon stopped) to fix\n", unresolved)
+		}
+		os.Exit(1)
+	}
+}
+
+// runMigrateConfig mostra as migrações de schema pendentes do agent.yaml; com
+// --write, grava o arquivo migrado (o original fica em {arquivo}.bak).
+func runMigrateConfig(args []string) {
+	fs := flag.NewFlagSet("migrate-config", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/agent.yaml", "path to agent config file")
+	write := fs.Bool("write", false, "rewrite the config file (original kept as <file>.bak)")
+	outputFlag := fs.String("output", agent.OutputText, "output format: text or json")
+	fs.Parse(args)
+
+	output, err := agent.ParseOutput(*outputFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --output: %v\n", err)
+		os.Exit(2)
+	}
+
+	notes, err := config.MigrateAgentConfigFile(*configPath, *write)
+	if output == agent.OutputJSON {
+		if werr := agent.WriteMigrateJSON(os.Stdout, *configPath, notes, *write, err); werr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing results: %v\n", werr)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(notes) == 0 {
+		fmt.Printf("%s: already at config_version %d\n", *configPath, config.CurrentConfigVersion)
+		return
+	}
+	for _, n := range notes {
+		fmt.Println(n)
+	}
+	if *write {
+		fmt.Printf("%s: migrated (original saved as %s.bak)\n", *configPath, *configPath)
+	} else {
+		fmt.Println("dry run: rerun with --write to apply")
+	}
+}
+
+// runExplainPath avalia um caminho contra os include/exclude de cada backup
+// entry que o contém. Sai com código 1 se nenhum source contém o caminho.
+func runExplainPath(args []string) {
+	fs := flag.NewFlagSet("explain-path", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/agent.yaml", "path to agent config file")
+	backup := fs.String("backup", "", "only evaluate this backup entry")
+	outputFlag := fs.String("output", agent.OutputText, "output format: text or json")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: nbackup-agent explain-path [--config path] [--backup name] [--output json] <path>")
+		os.Exit(2)
+	}
+	output, err := agent.ParseOutput(*outputFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --output: %v\n", err)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadAgentConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	path, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving path: %v\n", err)
+		os.Exit(1)
+	}
+	explanations := agent.ExplainPath(cfg, *backup, path)
+	if output == agent.OutputJSON {
+		if err := agent.WriteExplanationsJSON(os.Stdout, path, explanations); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+			os.Exit(1)
+		}
+		if len(explanations) == 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(explanations) == 0 {
+		fmt.Fprintf(os.Stderr, "%s is not under any backup source\n", path)
+		os.Exit(1)
+	}
+	if err := agent.WriteExplanations(os.Stdout, path, explanations); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runBench envia dados sintéticos por N streams paralelos a um storage
+// discard do server e mostra as taxas do produtor e de cada stream, os RTTs e
+// o gargalo diagnosticado. Nada é gravado no server.
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/agent.yaml", "path to agent config file (TLS, agent name, resume)")
+	server := fs.String("server", "", "server address (default: server.address from the config)")
+	storage := fs.String("storage", "bench", "server storage of type discard")
+	streams := fs.Int("streams", 4, "parallel streams (1-255)")
+	sizeFlag := fs.String("size", "1gb", "synthetic data to send (e.g. 10gb)")
+	chunkFlag := fs.String("chunk-size", "", "chunk size (default: resume.chunk_size from the config)")
+	interval := fs.Duration("interval", time.Second, "interval between rate samples")
+	outputFlag := fs.String("output", agent.OutputText, "output format: text or json")
+	fs.Parse(args)
+
+	output, err := agent.ParseOutput(*outputFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --output: %v\n", err)
+		os.Exit(2)
+	}
+	size, err := config.ParseByteSize(*sizeFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --size: %v\n", err)
+		os.Exit(2)
+	}
+	var chunkSize int64
+	if *chunkFlag != "" {
+		if chunkSize, err = config.ParseByteSize(*chunkFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --chunk-size: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	cfg, err := config.LoadAgentConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if *server != "" {
+		cfg.Server.Address = *server
+	}
+
+	// Logs no stderr: stdout fica com as amostras e o resultado
+	logger, logCloser := logging.NewLoggerTo(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.File, os.Stderr)
+	defer logCloser.Close()
+
+	opts := agent.BenchOptions{
+		Storage:   *storage,
+		Streams:   *streams,
+		Size:      size,
+		ChunkSize: chunkSize,
+		Interval:  *interval,
+	}
+	if output == agent.OutputText {
+		agent.WriteBenchSampleHeader(os.Stdout)
+		opts.OnSample = func(s agent.BenchSample) { agent.WriteBenchSample(os.Stdout, s) }
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	res, err := agent.RunBench(ctx, cfg, opts, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := agent.WriteBenchResult(os.Stdout, res, output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runRestore restaura um arquivo de um backup: o server envia apenas a
+// entrada pedida (requer backups com manifest: true).
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/agent.yaml", "path to agent config file")
+	backup := fs.String("backup", "", "backup entry name (optional with a single entry)")
+	file := fs.String("file", "", "path of the file in the backup (e.g. /etc/nginx/nginx.conf)")
+	archive := fs.String("archive", "", "archive to restore from (default: latest indexed backup)")
+	to := fs.String("to", ".", "directory to restore into (the original path is recreated under it)")
+	outputFlag := fs.String("output", agent.OutputText, "output format: text or json")
+	fs.Parse(args)
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "usage: nbackup-agent restore [--config path] [--backup name] --file <path> [--archive name] [--to dir] [--output json]")
+		os.Exit(2)
+	}
+	output, err := agent.ParseOutput(*outputFlag)
+	if err != nil {
+		// --output era o diretório de destino antes de --to
+		fmt.Fprintf(os.Stderr, "Error: --output: %v (the target directory is set with --to)\n", err)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadAgentConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	var entry *config.BackupEntry
+	for i := range cfg.Backups {
+		if cfg.Backups[i].Name == *backup || (*backup == "" && len(cfg.Backups) == 1) {
+			entry = &cfg.Backups[i]
+		}
+	}
+	if entry == nil {
+		fmt.Fprintln(os.Stderr, "Error: --backup must name one of the configured backup entries")
+		os.Exit(2)
+	}
+
+	// Com --output json, stdout fica só com o resultado
+	console := os.Stdout
+	if output == agent.OutputJSON {
+		console = os.Stderr
+	}
+	logger, logCloser := logging.NewLoggerTo(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.File, console)
+	defer logCloser.Close()
+
+	res, err := agent.RestoreFile(context.Background(), cfg, *entry, *archive, *file, *to, logger)
+	if output == agent.OutputJSON {
+		if werr := agent.WriteRestoreJSON(os.Stdout, res, err); werr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing results: %v\n", werr)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s restored from %s (%d bytes)\n", res.Path, res.Archive, res.Size)
+}
+
+func runStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/agent.yaml", "path to agent config file")
+	asJSON := fs.Bool("json", false, "print status as JSON (same as --output json)")
+	outputFlag := fs.String("output", agent.OutputText, "output format: text or json")
+	fs.Parse(args)
+
+	output, err := agent.ParseOutput(*outputFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --output: %v\n", err)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadAgentConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Daemon em execução: status ao vivo (inclui execuções em andamento).
+	// Caso contrário, lê o arquivo de estado local.
+	var entries []agent.EntryStatus
+	if path, ok := adminSocketPath(cfg); ok {
+		if resp, callErr := agent.AdminCall(path, agent.AdminRequest{Command: agent.AdminCmdStatus}); callErr == nil {
+			entries = resp.Status
+		}
+	}
+	if entries == nil {
+		state, err := agent.LoadScheduleState(cfg.Daemon.StateDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		entries = agent.BuildStatus(cfg, state, time.Now())
+	}
+
+	if *asJSON || output == agent.OutputJSON {
+		err = agent.WriteStatusJSON(os.Stdout, entries)
+	} else {
+		err = agent.WriteStatusTable(os.Stdout, entries)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing status: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runEnroll obtém o certificado de client do server (PKI embutida).
+func runEnroll(args []string) {
+	fs := flag.NewFlagSet("enroll", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/agent.yaml", "path to agent config file")
+	token := fs.String("token", "", "one-time enrollment token (nbackup-server pki token)")
+	address := fs.String("address", "", "enrollment endpoint host:port (default: server.address host, port 9849)")
+	fingerprint := fs.String("ca-fingerprint", "", "CA fingerprint (sha256:...), required when tls.ca_cert does not exist yet")
+	force := fs.Bool("force", false, "replace existing client certificate and key")
+	outputFlag := fs.String("output", agent.OutputText, "output format: text or json")
+	fs.Parse(args)
+
+	if *token == "" {
+		fmt.Fprintln(os.Stderr, "Usage: nbackup-agent enroll --token <token> [--ca-fingerprint sha256:...] [--address host:port] [--config path] [--output json]")
+		os.Exit(2)
+	}
+	output, err := agent.ParseOutput(*outputFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --output: %v\n", err)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadAgentConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if err := logging.SetRedaction(cfg.Logging.Redact.Patterns, cfg.Logging.Redact.Replacement); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	console := os.Stdout
+	if output == agent.OutputJSON {
+		console = os.Stderr
+	}
+	logger, logCloser := logging.NewLoggerTo(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.File, console)
+	defer logCloser.Close()
+
+	opts := agent.EnrollOptions{
+		Token:         *token,
+		Address:       *address,
+		CAFingerprint: *fingerprint,
+		Force:         *force,
+	}
+	err = agent.Enroll(context.Background(), cfg, opts, logger)
+	if output == agent.OutputJSON {
+		if werr := agent.WriteEnrollJSON(os.Stdout, cfg, err); werr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing results: %v\n", werr)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Enrollment failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Enrolled as %s: certificate written to %s\n", cfg.Agent.Name, cfg.TLS.ClientCert)
+}
+
+// runAdminCommand envia trigger/cancel/reload ao daemon via admin socket.
+// O nome do backup pode vir antes ou depois das flags.
+func runAdminCommand(command string, args []string) {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/agent.yaml", "path to agent config file")
+	outputFlag := fs.String("output", agent.OutputText, "output format: text or json")
+	var force *bool
+	if command == agent.AdminCmdTrigger {
+		force = fs.Bool("force", false, "ignore min_interval between successful runs")
+	}
+
+	var backup string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		backup, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if backup == "" {
+		backup = fs.Arg(0)
+	}
+	if command != agent.AdminCmdReload && backup == "" {
+		fmt.Fprintf(os.Stderr, "Usage: nbackup-agent %s <backup> [--config path] [--output json]\n", command)
+		os.Exit(2)
+	}
+	output, err := agent.ParseOutput(*outputFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --output: %v\n", err)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadAgentConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	path, ok := adminSocketPath(cfg)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Error: daemon.admin_socket is disabled in the config")
+		os.Exit(1)
+	}
+
+	req := agent.AdminRequest{Command: command, Backup: backup}
+	if force != nil {
+		req.Force = *force
+	}
+	resp, err := agent.AdminCall(path, req)
+	if output == agent.OutputJSON {
+		if werr := agent.WriteAdminJSON(os.Stdout, resp, err); werr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing results: %v\n", werr)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(resp.Message)
+}
+
+// adminSocketPath retorna o path do admin socket do daemon (ok=false se desabilitado).
+func adminSocketPath(cfg *config.AgentConfig) (string, bool) {
+	sock := cfg.Daemon.AdminSocket
+	if sock.Enabled == nil || !*sock.Enabled {
+		return "", false
+	}
+	return sock.Path, true
+}
+
 func runHealthCheck(address string) {
 	// Health check requer config para TLS
 	configPath := "/etc/nbackup/agent.yaml"
+	var storage string
+	output := agent.OutputText
 	if len(os.Args) >= 4 {
-		// Permite: nbackup-agent health <addr> --config <path>
+		// Permite: nbackup-agent health <addr> [--config <path>] [--storage <name>] [--output json]
 		for i, arg := range os.Args {
-			if arg == "--config" && i+1 < len(os.Args) {
+			if i+1 >= len(os.Args) {
+				break
+			}
+			switch arg {
+			case "--config":
 				configPath = os.Args[i+1]
+			case "--storage":
+				storage = os.Args[i+1]
+			case "--output":
+				var err error
+				if output, err = agent.ParseOutput(os.Args[i+1]); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: --output: %v\n", err)
+					os.Exit(2)
+				}
 			}
 		}
 	}
@@ -70,9 +619,25 @@ func runHealthCheck(address string) {
 		os.Exit(1)
 	}
 
-	logger, _ := logging.NewLogger(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.File)
+	if err := logging.SetRedaction(cfg.Logging.Redact.Patterns, cfg.Logging.Redact.Replacement); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
 
-	if err := agent.RunHealthCheck(address, cfg, logger); err != nil {
+	if output == agent.OutputJSON {
+		logger, _ := logging.NewLoggerTo(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.File, os.Stderr)
+		rep, err := agent.CheckHealth(address, cfg, storage, logger)
+		if werr := agent.WriteHealthJSON(os.Stdout, rep); werr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing health report: %v\n", werr)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	logger, _ := logging.NewLogger(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.File)
+	if err := agent.RunHealthCheck(address, cfg, storage, logger); err != nil {
 		fmt.Fprintf(os.Stderr, "Health check failed: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,154 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server"
+)
+
+// runSessions despacha `nbackup-server sessions list|cancel`.
+func runSessions(args []string) {
+	if len(args) == 0 {
+		sessionsUsage()
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "list":
+		runAdminQuery("sessions list", server.AdminCmdSessions, args[1:])
+	case "cancel":
+		runSessionsCancel(args[1:])
+	default:
+		sessionsUsage()
+		os.Exit(2)
+	}
+}
+
+func sessionsUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: nbackup-server sessions <command> [flags]\n\n")
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	fmt.Fprintf(os.Stderr, "  list           list active backup sessions\n")
+	fmt.Fprintf(os.Stderr, "  cancel <id>    cancel a session still receiving data\n")
+}
+
+// runStorage despacha `nbackup-server storage usage`.
+func runStorage(args []string) {
+	if len(args) == 0 || args[0] != "usage" {
+		fmt.Fprintf(os.Stderr, "Usage: nbackup-server storage usage [--json] [--config path]\n")
+		os.Exit(2)
+	}
+	runAdminQuery("storage usage", server.AdminCmdStorage, args[1:])
+}
+
+// runAdminQuery consulta o server em execução via admin socket e imprime o
+// resultado como tabela (ou JSON, com --json).
+func runAdminQuery(name, command string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/server.yaml", "path to server config file")
+	asJSON := fs.Bool("json", false, "print result as JSON")
+	fs.Parse(args)
+
+	resp := adminCall(*configPath, server.AdminRequest{Command: command})
+
+	var err error
+	switch command {
+	case server.AdminCmdSessions:
+		if *asJSON {
+			err = server.WriteAdminJSON(os.Stdout, resp.Sessions)
+		} else {
+			err = server.WriteSessionsTable(os.Stdout, resp.Sessions)
+		}
+	case server.AdminCmdAgents:
+		if *asJSON {
+			err = server.WriteAdminJSON(os.Stdout, resp.Agents)
+		} else {
+			err = server.WriteAgentsTable(os.Stdout, resp.Agents)
+		}
+	case server.AdminCmdStorage:
+		if *asJSON {
+			err = server.WriteAdminJSON(os.Stdout, resp.Storage)
+		} else {
+			err = server.WriteStorageTable(os.Stdout, resp.Storage)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runSessionsCancel cancela uma sessão via admin socket.
+// O id da sessão pode vir antes ou depois das flags.
+func runSessionsCancel(args []string) {
+	fs := flag.NewFlagSet("sessions cancel", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/server.yaml", "path to server config file")
+	reason := fs.String("reason", "cancelled", "abort reason sent to the agent: cancelled, maintenance or server_busy")
+
+	var id string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		id, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if id == "" {
+		id = fs.Arg(0)
+	}
+	if id == "" {
+		fmt.Fprintf(os.Stderr, "Usage: nbackup-server sessions cancel <session-id> [--reason cancelled|maintenance|server_busy] [--config path]\n")
+		os.Exit(2)
+	}
+
+	resp := adminCall(*configPath, server.AdminRequest{Command: server.AdminCmdCancel, Session: id, Reason: *reason})
+	fmt.Println(resp.Message)
+}
+
+// runSnapshot dispara um snapshot_group via admin socket.
+// O nome do grupo pode vir antes ou depois das flags.
+func runSnapshot(args []string) {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/server.yaml", "path to server config file")
+
+	var group string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		group, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if group == "" {
+		group = fs.Arg(0)
+	}
+	if group == "" {
+		fmt.Fprintf(os.Stderr, "Usage: nbackup-server snapshot <group> [--config path]\n")
+		os.Exit(2)
+	}
+
+	resp := adminCall(*configPath, server.AdminRequest{Command: server.AdminCmdSnapshot, Group: group})
+	fmt.Println(resp.Message)
+}
+
+// adminCall carrega a config, localiza o admin socket e envia req ao server.
+// Encerra o processo em caso de erro.
+func adminCall(configPath string, req server.AdminRequest) *server.AdminResponse {
+	cfg, err := config.LoadServerConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	sock := cfg.Server.AdminSocket
+	if sock.Enabled == nil || !*sock.Enabled {
+		fmt.Fprintln(os.Stderr, "Error: server.admin_socket is disabled in the config")
+		os.Exit(1)
+	}
+
+	resp, err := server.AdminCall(sock.Path, req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return resp
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server"
+)
+
+// checkExitUnknown é o código de saída do check quando a verificação não pôde
+// rodar (config inválida, storage inexistente, base_dir ilegível).
+const checkExitUnknown = 3
+
+// runCheck implementa `nbackup-server check [--storage <nome>]`: confere a
+// consistência dos backups de um storage (ou de todos). Sai com 0 sem
+// divergências, 1 com warnings, 2 com erros e 3 se não pôde verificar.
+func runCheck(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/server.yaml", "path to server config file")
+	storage := fs.String("storage", "", "storage to check (default: all storages)")
+	deep := fs.Bool("deep", false, "also decompress every archive and read every dedup chunk (reads all data)")
+	asJSON := fs.Bool("json", false, "print the reports as JSON")
+	fs.Parse(args)
+
+	cfg, err := config.LoadServerConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(checkExitUnknown)
+	}
+	names := []string{*storage}
+	if *storage == "" {
+		names = names[:0]
+		for name := range cfg.Storages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	} else if _, ok := cfg.GetStorage(*storage); !ok {
+		fmt.Fprintf(os.Stderr, "Error: storage %q not found\n", *storage)
+		os.Exit(checkExitUnknown)
+	}
+
+	exit := 0
+	reports := make([]*server.CheckReport, 0, len(names))
+	for _, name := range names {
+		rep, err := server.CheckStorage(cfg.Storages[name], name, *deep)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error checking %s: %v\n", name, err)
+			exit = checkExitUnknown
+			continue
+		}
+		reports = append(reports, rep)
+		exit = max(exit, rep.ExitCode())
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(reports)
+	} else {
+		for _, rep := range reports {
+			fmt.Printf("%s (%s): %d backups, %d errors, %d warnings\n", rep.Storage, rep.BaseDir, rep.Backups, rep.Errors, rep.Warnings)
+			for _, f := range rep.Findings {
+				fmt.Printf("  %-7s %-10s %s: %s\n", f.Severity, f.Check, f.Path, f.Message)
+			}
+		}
+	}
+	os.Exit(exit)
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nishisan-dev/n-backup/internal/dedup"
+)
+
+// runDedup implementa `nbackup-server dedup cat <manifest>`: reconstrói o
+// archive de um backup de storage dedup e o escreve em stdout, para uso com
+// tar (ex: `nbackup-server dedup cat X.tar.gz.dedup | tar xzf - -C /restore`).
+func runDedup(args []string) {
+	if len(args) != 2 || args[0] != "cat" {
+		fmt.Fprintf(os.Stderr, "Usage: nbackup-server dedup cat <manifest.dedup>\n")
+		os.Exit(2)
+	}
+	manifest := args[1]
+	if !dedup.IsManifest(manifest) {
+		fmt.Fprintf(os.Stderr, "Error: %s is not a dedup manifest\n", manifest)
+		os.Exit(2)
+	}
+
+	baseDir, err := dedupBaseDir(manifest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	store, err := dedup.Open(baseDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening dedup pool: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := bufio.NewWriterSize(os.Stdout, 1<<20)
+	if err := store.WriteArchive(manifest, out); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing archive: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// dedupBaseDir localiza o base_dir do storage subindo a partir do manifest
+// até o diretório que contém o pool (.dedup).
+func dedupBaseDir(manifest string) (string, error) {
+	abs, err := filepath.Abs(manifest)
+	if err != nil {
+		return "", err
+	}
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		if fi, err := os.Stat(filepath.Join(dir, dedup.PoolDirName)); err == nil && fi.IsDir() {
+			return dir, nil
+		}
+		if dir == filepath.Dir(dir) {
+			return "", fmt.Errorf("no %s pool found above %s", dedup.PoolDirName, manifest)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server"
+)
+
+// runExport implementa `nbackup-server export --storage <nome> --to <dir>`:
+// copia os backups commitados (opcionalmente a partir de --since) para uma
+// mídia offline, com o manifest usado pelo import. Sai com código 1 se algum
+// backup falhar.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/server.yaml", "path to server config file")
+	storage := fs.String("storage", "", "storage to export (required)")
+	to := fs.String("to", "", "destination directory, e.g. a mounted removable drive (required)")
+	sinceFlag := fs.String("since", "", "only backups committed at or after this date (YYYY-MM-DD or RFC3339, UTC)")
+	fs.Parse(args)
+
+	if *storage == "" || *to == "" {
+		fmt.Fprintf(os.Stderr, "Usage: nbackup-server export --storage <name> --to <dir> [--since <date>]\n")
+		os.Exit(2)
+	}
+	var since time.Time
+	if *sinceFlag != "" {
+		var err error
+		if since, err = parseSince(*sinceFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --since: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	si := loadStorage(*configPath, *storage)
+
+	results, err := server.ExportBackups(si, *storage, since, *to)
+	failed := printTransferResults(results)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error exporting %s: %v\n", *storage, err)
+		os.Exit(1)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d backup(s) failed\n", failed)
+		os.Exit(1)
+	}
+}
+
+// runImport implementa `nbackup-server import --storage <nome> --from <dir>`:
+// copia para o storage os backups de uma mídia gerada pelo export,
+// conferindo o SHA-256 de cada arquivo. Sai com código 1 se algum backup
+// falhar.
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/server.yaml", "path to server config file")
+	storage := fs.String("storage", "", "destination storage (required)")
+	from := fs.String("from", "", "directory written by nbackup-server export (required)")
+	fs.Parse(args)
+
+	if *storage == "" || *from == "" {
+		fmt.Fprintf(os.Stderr, "Usage: nbackup-server import --storage <name> --from <dir>\n")
+		os.Exit(2)
+	}
+	si := loadStorage(*configPath, *storage)
+
+	results, err := server.ImportBackups(si, *from)
+	failed := printTransferResults(results)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error importing into %s: %v\n", *storage, err)
+		os.Exit(1)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d backup(s) failed\n", failed)
+		os.Exit(1)
+	}
+}
+
+// loadStorage carrega a config e retorna o storage name, ou encerra.
+func loadStorage(configPath, name string) config.StorageInfo {
+	cfg, err := config.LoadServerConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	si, ok := cfg.GetStorage(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: storage %q not found\n", name)
+		os.Exit(1)
+	}
+	return si
+}
+
+// parseSince aceita uma data (YYYY-MM-DD) ou um instante RFC3339.
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// printTransferResults imprime uma linha por backup e retorna as falhas.
+func printTransferResults(results []server.TransferResult) int {
+	var copied, skipped, failed int
+	for _, r := range results {
+		name := r.Entry.Agent + "/" + r.Entry.Backup + "/" + r.Entry.File
+		switch r.Status {
+		case server.TransferCopied:
+			copied++
+			fmt.Printf("copied   %s (%d bytes)\n", name, r.Entry.Archive.Size)
+		case server.TransferSkipped:
+			skipped++
+			fmt.Printf("skipped  %s (already present)\n", name)
+		default:
+			failed++
+			fmt.Printf("FAILED   %s: %v\n", name, r.Err)
+		}
+	}
+	fmt.Printf("%d copied, %d skipped, %d failed\n", copied, skipped, failed)
+	return failed
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// runFsck verifica os arquivos de estado do server (históricos da WebUI e
+// tokens de enrollment). Com --repair, reescreve cada arquivo com os registros
+// válidos, preservando o original em {arquivo}.corrupt. Sai com código 1 se
+// algum arquivo continuar corrompido.
+func runFsck(args []string) {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/server.yaml", "path to server config file")
+	repair := fs.Bool("repair", false, "rewrite damaged files keeping only valid records (stop the server first)")
+	fs.Parse(args)
+
+	cfg, err := config.LoadServerConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	results := server.FsckStateFiles(cfg, *repair)
+	if len(results) == 0 {
+		fmt.Println("no state files configured (web_ui and enrollment disabled)")
+		return
+	}
+	unresolved, err := statefile.WriteResults(os.Stdout, results)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+		os.Exit(1)
+	}
+	if unresolved > 0 {
+		if !*repair {
+			fmt.Fprintf(os.Stderr, "%d damaged file(s); run with --repair (server stopped) to fix\n", unresolved)
+		}
+		os.Exit(1)
+	}
+}
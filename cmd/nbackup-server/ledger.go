@@ -0,0 +1,60 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nishisan-dev/n-backup/internal/server"
+)
+
+// runLedger implementa `nbackup-server ledger verify --storage <nome>`: confere
+// a assinatura e o encadeamento do ledger de um storage imutável e os backups
+// no disco contra ele. Sai com código 1 se encontrar divergências.
+func runLedger(args []string) {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintf(os.Stderr, "Usage: nbackup-server ledger verify --storage <name> [--hashes] [--json]\n")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("ledger verify", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/server.yaml", "path to server config file")
+	storage := fs.String("storage", "", "immutable storage to verify (required)")
+	hashes := fs.Bool("hashes", false, "also recompute the SHA-256 of every backup (reads all data)")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args[1:])
+
+	if *storage == "" {
+		fmt.Fprintf(os.Stderr, "Error: --storage is required\n")
+		os.Exit(2)
+	}
+	si := loadStorage(*configPath, *storage)
+
+	rep, err := server.VerifyLedger(si, *hashes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying ledger of %s: %v\n", *storage, err)
+		os.Exit(1)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(rep)
+	} else {
+		fmt.Printf("%s: %d records, %d live backups\n", rep.Path, rep.Entries, rep.Live)
+		for _, p := range rep.Problems {
+			fmt.Printf("  %s\n", p)
+		}
+		if rep.OK() {
+			fmt.Println("OK")
+		}
+	}
+	if !rep.OK() {
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(rep.Problems))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/server/loadgen"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// runLoadgen serve a WebUI e a API de observabilidade com dados sintéticos.
+//
+// Uso:
+//
+//	nbackup-server loadgen [--listen 127.0.0.1:9848] [--agents 12] [--sessions 4]
+func runLoadgen(args []string) {
+	fs := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:9848", "address of the synthetic web UI / API")
+	allow := fs.String("allow", "127.0.0.1/32,::1/128", "comma-separated IPs/CIDRs allowed to access the web UI")
+	agents := fs.Int("agents", 12, "number of fake agents")
+	sessions := fs.Int("sessions", 4, "number of concurrent fake sessions")
+	storages := fs.String("storages", "default,archive", "comma-separated fake storage names")
+	tick := fs.Duration("tick", time.Second, "simulation step interval")
+	speed := fs.Float64("speed", 1, "throughput multiplier (higher = sessions finish faster)")
+	seed := fs.Int64("seed", 0, "random seed for a reproducible simulation (0 = random)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: nbackup-server loadgen [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Serves the observability web UI and API backed by a synthetic load\n")
+		fmt.Fprintf(os.Stderr, "generator (fake agents, sessions, stream stats and events).\n")
+		fmt.Fprintf(os.Stderr, "For frontend and API development only: no backups are received.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var cidrs []*net.IPNet
+	for _, origin := range strings.Split(*allow, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if !strings.Contains(origin, "/") {
+			if strings.Contains(origin, ":") {
+				origin += "/128"
+			} else {
+				origin += "/32"
+			}
+		}
+		_, cidr, err := net.ParseCIDR(origin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --allow entry %q: %v\n", origin, err)
+			os.Exit(2)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+
+	var storageNames []string
+	for _, name := range strings.Split(*storages, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			storageNames = append(storageNames, name)
+		}
+	}
+
+	gen := loadgen.New(loadgen.Options{
+		Agents:   *agents,
+		Sessions: *sessions,
+		Storages: storageNames,
+		Seed:     *seed,
+		Tick:     *tick,
+		Speed:    *speed,
+	})
+	gen.SetListen(*listen)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go gen.Run(ctx)
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           observability.NewRouter(gen, gen.CurrentConfig(), observability.NewACL(cidrs), gen.Events()),
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("Synthetic web UI at http://%s (%d agents, %d concurrent sessions) — Ctrl+C to stop.\n", *listen, *agents, *sessions)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
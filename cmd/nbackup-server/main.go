@@ -26,6 +26,88 @@ func main() {
 		return
 	}
 
+	// Subcomando "pki" — CA embutida e tokens de enrollment de agents
+	if len(os.Args) >= 2 && os.Args[1] == "pki" {
+		runPKI(os.Args[2:])
+		return
+	}
+
+	// Subcomando "webui" — hash de senha dos usuários da WebUI
+	if len(os.Args) >= 2 && os.Args[1] == "webui" {
+		runWebUI(os.Args[2:])
+		return
+	}
+
+	// Subcomando "fsck" — verifica e repara os arquivos de estado
+	if len(os.Args) >= 2 && os.Args[1] == "fsck" {
+		runFsck(os.Args[2:])
+		return
+	}
+
+	// Subcomando "migrate-config" — migra o server.yaml para o config_version atual
+	if len(os.Args) >= 2 && os.Args[1] == "migrate-config" {
+		runMigrateConfig(os.Args[2:])
+		return
+	}
+
+	// Subcomando "dedup" — reconstrói archives de storages dedup
+	if len(os.Args) >= 2 && os.Args[1] == "dedup" {
+		runDedup(os.Args[2:])
+		return
+	}
+
+	// Subcomandos "export" e "import" — cópia de backups para mídia offline e de volta
+	if len(os.Args) >= 2 && os.Args[1] == "export" {
+		runExport(os.Args[2:])
+		return
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "import" {
+		runImport(os.Args[2:])
+		return
+	}
+
+	// Subcomando "check" — consistência dos backups de um storage (cron)
+	if len(os.Args) >= 2 && os.Args[1] == "check" {
+		runCheck(os.Args[2:])
+		return
+	}
+
+	// Subcomando "report" — ingestão por agent/storage (accounting)
+	if len(os.Args) >= 2 && os.Args[1] == "report" {
+		runReport(os.Args[2:])
+		return
+	}
+
+	// Subcomando "ledger" — verifica o ledger de storages imutáveis
+	if len(os.Args) >= 2 && os.Args[1] == "ledger" {
+		runLedger(os.Args[2:])
+		return
+	}
+
+	// Subcomandos "sessions", "agents", "storage" e "snapshot" — falam com o server via admin socket
+	if len(os.Args) >= 2 {
+		switch os.Args[1] {
+		case "sessions":
+			runSessions(os.Args[2:])
+			return
+		case "agents":
+			runAdminQuery("agents", server.AdminCmdAgents, os.Args[2:])
+			return
+		case "storage":
+			runStorage(os.Args[2:])
+			return
+		case "snapshot":
+			runSnapshot(os.Args[2:])
+			return
+		}
+	}
+
+	// Subcomando "loadgen" — WebUI com carga sintética (desenvolvimento)
+	if len(os.Args) >= 2 && os.Args[1] == "loadgen" {
+		runLoadgen(os.Args[2:])
+		return
+	}
+
 	configPath := flag.String("config", "/etc/nbackup/server.yaml", "path to server config file")
 	flag.Parse()
 
@@ -35,25 +117,55 @@ func main() {
 		os.Exit(1)
 	}
 
-	logger, logCloser := logging.NewLogger(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.File)
+	if err := logging.SetRedaction(cfg.Logging.Redact.Patterns, cfg.Logging.Redact.Replacement); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	logging.SetSampling(cfg.Logging.Sampling.SampleRules())
+	logging.SetRotation(cfg.Logging.Rotation.LogRotation())
+	logger, logCloser := logging.NewTargetLogger(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.File, os.Stdout, cfg.Logging.LogTarget())
 	defer logCloser.Close()
 
 	cfg.WarnDeprecated(logger)
+	cfg.WarnMigrations(logger)
 
 	// Context com cancelamento via signal
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	// SIGHUP recarrega a config sem interromper sessões ativas (systemctl reload)
+	reloadCh := make(chan *config.ServerConfig, 1)
 
 	go func() {
-		sig := <-sigCh
-		logger.Info("received signal, shutting down", "signal", sig)
-		cancel()
+		for sig := range sigCh {
+			if sig == syscall.SIGHUP {
+				logger.Info("received SIGHUP, reloading config", "path", *configPath)
+				newCfg, err := config.LoadServerConfig(*configPath)
+				if err != nil {
+					logger.Error("reload failed, keeping current config", "error", err)
+					continue
+				}
+				logging.SetLevel(newCfg.Logging.Level)
+				if err := logging.SetRedaction(newCfg.Logging.Redact.Patterns, newCfg.Logging.Redact.Replacement); err != nil {
+					logger.Warn("keeping previous redact patterns", "error", err)
+				}
+				logging.SetSampling(newCfg.Logging.Sampling.SampleRules())
+				logging.SetRotation(newCfg.Logging.Rotation.LogRotation())
+				newCfg.WarnDeprecated(logger)
+				newCfg.WarnMigrations(logger)
+				reloadCh <- newCfg
+				continue
+			}
+			logger.Info("received signal, shutting down", "signal", sig)
+			cancel()
+			return
+		}
 	}()
 
-	if err := server.Run(ctx, cfg, logger); err != nil {
+	if err := server.RunWithReload(ctx, cfg, logger, reloadCh); err != nil {
 		logger.Error("server error", "error", err)
 		os.Exit(1)
 	}
@@ -120,3 +232,30 @@ func runSyncStorage(args []string) {
 	fmt.Printf("SIGUSR1 sent to PID %d — storage sync triggered.\n", pid)
 	fmt.Println("Check daemon logs for sync progress and results.")
 }
+
+// runMigrateConfig mostra as migrações de schema pendentes do server.yaml; com
+// --write, grava o arquivo migrado (o original fica em {arquivo}.bak).
+func runMigrateConfig(args []string) {
+	fs := flag.NewFlagSet("migrate-config", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/server.yaml", "path to server config file")
+	write := fs.Bool("write", false, "rewrite the config file (original kept as <file>.bak)")
+	fs.Parse(args)
+
+	notes, err := config.MigrateServerConfigFile(*configPath, *write)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(notes) == 0 {
+		fmt.Printf("%s: already at config_version %d\n", *configPath, config.CurrentConfigVersion)
+		return
+	}
+	for _, n := range notes {
+		fmt.Println(n)
+	}
+	if *write {
+		fmt.Printf("%s: migrated (original saved as %s.bak)\n", *configPath, *configPath)
+	} else {
+		fmt.Println("dry run: rerun with --write to apply")
+	}
+}
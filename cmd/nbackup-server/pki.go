@@ -0,0 +1,252 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+)
+
+// runPKI despacha os subcomandos de `nbackup-server pki`.
+func runPKI(args []string) {
+	if len(args) == 0 {
+		pkiUsage()
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "init":
+		runPKIInit(args[1:])
+	case "token":
+		runPKIToken(args[1:])
+	case "revoke":
+		runPKIRevoke(args[1:])
+	default:
+		pkiUsage()
+		os.Exit(2)
+	}
+}
+
+func pkiUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: nbackup-server pki <command> [flags]\n\n")
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	fmt.Fprintf(os.Stderr, "  init    create the CA and the server certificate\n")
+	fmt.Fprintf(os.Stderr, "  token   issue a one-time enrollment token for an agent\n")
+	fmt.Fprintf(os.Stderr, "  revoke  add certificates to the CRL (tls.crl_file)\n")
+}
+
+// runPKIInit cria a CA e o certificado do server em --dir.
+func runPKIInit(args []string) {
+	fs := flag.NewFlagSet("pki init", flag.ExitOnError)
+	dir := fs.String("dir", "/etc/nbackup", "output directory for ca.pem, ca-key.pem, server.pem and server-key.pem")
+	caCN := fs.String("ca-cn", "NBackup CA", "common name of the CA")
+	serverNames := fs.String("server-name", "", "comma-separated DNS names/IPs of the server (SANs), required")
+	caValidity := fs.Duration("ca-validity", pki.DefaultCAValidity, "CA certificate validity")
+	certValidity := fs.Duration("cert-validity", pki.DefaultCertValidity, "server certificate validity")
+	force := fs.Bool("force", false, "overwrite existing files")
+	fs.Parse(args)
+
+	var names []string
+	for _, n := range strings.Split(*serverNames, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: --server-name is required (e.g. --server-name backup.example.com,10.0.0.5)")
+		os.Exit(2)
+	}
+
+	paths := map[string]string{
+		"ca":         filepath.Join(*dir, "ca.pem"),
+		"ca-key":     filepath.Join(*dir, "ca-key.pem"),
+		"server":     filepath.Join(*dir, "server.pem"),
+		"server-key": filepath.Join(*dir, "server-key.pem"),
+	}
+	if !*force {
+		for _, p := range paths {
+			if _, err := os.Stat(p); err == nil {
+				fmt.Fprintf(os.Stderr, "Error: %s already exists (use --force to overwrite)\n", p)
+				os.Exit(1)
+			}
+		}
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", *dir, err)
+		os.Exit(1)
+	}
+
+	caPEM, caKeyPEM, err := pki.GenerateCA(*caCN, *caValidity)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	mustWrite(paths["ca"], caPEM, 0644)
+	mustWrite(paths["ca-key"], caKeyPEM, 0600)
+
+	ca, err := pki.LoadCA(paths["ca"], paths["ca-key"])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	serverPEM, serverKeyPEM, err := ca.IssueServerCert(names, *certValidity)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	mustWrite(paths["server"], serverPEM, 0644)
+	mustWrite(paths["server-key"], serverKeyPEM, 0600)
+
+	fmt.Printf("CA:             %s\n", paths["ca"])
+	fmt.Printf("CA key:         %s (keep it private)\n", paths["ca-key"])
+	fmt.Printf("Server cert:    %s (%s)\n", paths["server"], strings.Join(names, ", "))
+	fmt.Printf("Server key:     %s\n", paths["server-key"])
+	fmt.Printf("CA fingerprint: %s\n", pki.Fingerprint(ca.Cert))
+}
+
+// runPKIToken emite um token de enrollment de uso único para um agent.
+func runPKIToken(args []string) {
+	fs := flag.NewFlagSet("pki token", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/server.yaml", "path to server config file")
+	agentName := fs.String("agent", "", "agent name (becomes the certificate CN), required")
+	ttl := fs.Duration("ttl", pki.DefaultEnrollTokenTTL, "token validity")
+	fs.Parse(args)
+
+	if *agentName == "" {
+		fmt.Fprintln(os.Stderr, "Usage: nbackup-server pki token --agent <name> [--ttl 24h] [--config path]")
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadServerConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.Enrollment.Enabled {
+		fmt.Fprintln(os.Stderr, "Warning: enrollment.enabled is false — the token is only usable after enabling it")
+	}
+	caCert, err := pki.LoadCertificate(cfg.TLS.CACert)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	token, err := pki.CreateEnrollToken(cfg.Enrollment.TokensFile, *agentName, *ttl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Token:      %s\n", token)
+	fmt.Printf("Agent:      %s\n", *agentName)
+	fmt.Printf("Expires in: %s\n", *ttl)
+	fp := pki.Fingerprint(caCert)
+	fmt.Printf("CA:         %s\n\n", fp)
+	fmt.Printf("On the agent (agent.name: %s):\n", *agentName)
+	fmt.Printf("  nbackup-agent enroll --token %s --ca-fingerprint %s", token, fp)
+	if _, port, err := net.SplitHostPort(cfg.Enrollment.Listen); err == nil && port != pki.DefaultEnrollPort {
+		fmt.Printf(" --address <server>:%s", port)
+	}
+	fmt.Println()
+}
+
+// runPKIRevoke acrescenta certificados à CRL de tls.crl_file (ou apenas a
+// reemite, renovando o nextUpdate, quando nenhum certificado é informado).
+// O server recarrega a CRL automaticamente.
+func runPKIRevoke(args []string) {
+	fs := flag.NewFlagSet("pki revoke", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/server.yaml", "path to server config file")
+	caKey := fs.String("ca-key", "", "CA private key (default: enrollment.ca_key)")
+	validity := fs.Duration("crl-validity", pki.DefaultCRLValidity, "time until the CRL next update")
+	var certPaths, serialArgs stringList
+	fs.Var(&certPaths, "cert", "certificate file to revoke (repeatable)")
+	fs.Var(&serialArgs, "serial", "serial number (hex) to revoke (repeatable)")
+	fs.Parse(args)
+
+	cfg, err := config.LoadServerConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.TLS.CRLFile == "" {
+		fmt.Fprintln(os.Stderr, "Error: tls.crl_file is not set in the server config")
+		os.Exit(1)
+	}
+	keyPath := *caKey
+	if keyPath == "" {
+		keyPath = cfg.Enrollment.CAKey
+	}
+	if keyPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: --ca-key is required (enrollment.ca_key is not set)")
+		os.Exit(2)
+	}
+	ca, err := pki.LoadCA(cfg.TLS.CACert, keyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var serials []*big.Int
+	for _, p := range certPaths {
+		cert, err := pki.LoadCertificate(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		serials = append(serials, cert.SerialNumber)
+		fmt.Printf("Revoking %s (CN=%s, serial %s)\n", p, cert.Subject.CommonName, cert.SerialNumber.Text(16))
+	}
+	for _, s := range serialArgs {
+		serial, ok := new(big.Int).SetString(strings.TrimPrefix(strings.ReplaceAll(s, ":", ""), "0x"), 16)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: invalid serial %q (expected hex)\n", s)
+			os.Exit(2)
+		}
+		serials = append(serials, serial)
+		fmt.Printf("Revoking serial %s\n", serial.Text(16))
+	}
+
+	previous, err := os.ReadFile(cfg.TLS.CRLFile)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", cfg.TLS.CRLFile, err)
+		os.Exit(1)
+	}
+	crlPEM, err := ca.CreateCRL(previous, serials, *validity)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	tmp := cfg.TLS.CRLFile + ".tmp"
+	mustWrite(tmp, crlPEM, 0644)
+	if err := os.Rename(tmp, cfg.TLS.CRLFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", cfg.TLS.CRLFile, err)
+		os.Exit(1)
+	}
+	fmt.Printf("CRL written to %s (next update in %s)\n", cfg.TLS.CRLFile, *validity)
+}
+
+// stringList implementa flag.Value para flags repetíveis.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func mustWrite(path string, data []byte, mode os.FileMode) {
+	if err := os.WriteFile(path, data, mode); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting permissions on %s: %v\n", path, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// runReport implementa `nbackup-server report`: ingestão acumulada por agent e
+// storage (accounting.file) no período, com a tendência diária, os maiores
+// agents e as taxas de sucesso. Lê o arquivo direto, com ou sem o daemon.
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/nbackup/server.yaml", "path to server config file")
+	days := fs.Int("days", 30, "period in days, ending today (UTC)")
+	untilFlag := fs.String("until", "", "last day of the period (YYYY-MM-DD, default: today)")
+	agent := fs.String("agent", "", "only this agent")
+	storage := fs.String("storage", "", "only this storage")
+	top := fs.Int("top", 10, "agents and storages listed (0 = all)")
+	daily := fs.Bool("daily", false, "also print one line per day")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	if *days < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --days must be >= 1\n")
+		os.Exit(2)
+	}
+	f := observability.AccountingFilter{Days: *days, Agent: *agent, Storage: *storage, Top: *top}
+	if *untilFlag != "" {
+		var err error
+		if f.Until, err = time.Parse("2006-01-02", *untilFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --until: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	cfg, err := config.LoadServerConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.Accounting.Enabled {
+		fmt.Fprintf(os.Stderr, "Error: accounting is not enabled in %s\n", *configPath)
+		os.Exit(1)
+	}
+	entries, err := observability.ReadAccounting(cfg.Accounting.File)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	rep := observability.BuildAccountingReport(entries, f)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(rep)
+		return
+	}
+	printReport(rep, *daily)
+}
+
+// printReport imprime o relatório em texto.
+func printReport(rep observability.AccountingReport, daily bool) {
+	fmt.Printf("Ingest %s to %s (%d days)", rep.Since, rep.Until, rep.Days)
+	if rep.Agent != "" {
+		fmt.Printf(", agent %s", rep.Agent)
+	}
+	if rep.Storage != "" {
+		fmt.Printf(", storage %s", rep.Storage)
+	}
+	t := rep.Totals
+	fmt.Printf("\n%s in %d sessions (%d ok, %d failed, %.1f%% success), %s/day\n",
+		formatBytes(t.Bytes), t.Sessions, t.OK, t.Failed, t.SuccessRate, formatBytes(t.Bytes/int64(rep.Days)))
+
+	if daily {
+		fmt.Printf("\n%-10s  %10s  %8s  %7s  %s\n", "DAY", "BYTES", "SESSIONS", "SUCCESS", "")
+		var peak int64
+		for _, d := range rep.Daily {
+			peak = max(peak, d.Bytes)
+		}
+		for _, d := range rep.Daily {
+			bar := ""
+			if peak > 0 {
+				bar = strings.Repeat("#", int(d.Bytes*30/peak))
+			}
+			fmt.Printf("%-10s  %10s  %8d  %7s  %s\n", d.Day, formatBytes(d.Bytes), d.Sessions, successRate(d.AccountingTotals), bar)
+		}
+	}
+
+	for _, sec := range []struct {
+		title  string
+		groups []observability.AccountingGroup
+	}{{"AGENT", rep.Agents}, {"STORAGE", rep.Storages}} {
+		fmt.Printf("\n%-24s  %10s  %6s  %8s  %7s  %7s\n", sec.title, "BYTES", "SHARE", "SESSIONS", "SUCCESS", "GROWTH")
+		for _, g := range sec.groups {
+			growth := "-"
+			if g.Growth != nil {
+				growth = fmt.Sprintf("%+.0f%%", *g.Growth)
+			}
+			fmt.Printf("%-24s  %10s  %5.1f%%  %8d  %7s  %7s\n", g.Name, formatBytes(g.Bytes), g.Share, g.Sessions, successRate(g.AccountingTotals), growth)
+		}
+	}
+}
+
+func successRate(t observability.AccountingTotals) string {
+	if t.OK+t.Failed == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", t.SuccessRate)
+}
+
+// formatBytes formata bytes em unidades binárias (ex: "12.3 MB").
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// runWebUI despacha os subcomandos de `nbackup-server webui`.
+func runWebUI(args []string) {
+	if len(args) == 0 || args[0] != "passwd" {
+		fmt.Fprintf(os.Stderr, "Usage: nbackup-server webui <command> [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  passwd  hash a password for a web_ui.users entry\n")
+		os.Exit(2)
+	}
+	runWebUIPasswd(args[1:])
+}
+
+// runWebUIPasswd lê a senha (sem eco quando stdin é um terminal) e imprime a
+// entrada de web_ui.users com o password_hash.
+func runWebUIPasswd(args []string) {
+	fs := flag.NewFlagSet("webui passwd", flag.ExitOnError)
+	user := fs.String("user", "", "user name, required")
+	role := fs.String("role", config.WebUIRoleViewer, "user role: viewer or operator")
+	fs.Parse(args)
+
+	if *user == "" || (*role != config.WebUIRoleViewer && *role != config.WebUIRoleOperator) {
+		fmt.Fprintln(os.Stderr, "Usage: nbackup-server webui passwd --user <name> [--role viewer|operator] < password")
+		os.Exit(2)
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
+		os.Exit(1)
+	}
+	if len(password) < 8 {
+		fmt.Fprintln(os.Stderr, "Error: password must have at least 8 characters")
+		os.Exit(1)
+	}
+	hash, err := observability.HashPassword(password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("# add to web_ui.users in server.yaml")
+	fmt.Printf("- name: %s\n  password_hash: %s\n  role: %s\n", *user, hash, *role)
+}
+
+// readPassword lê a primeira linha de stdin. Em um terminal, pede a senha
+// duas vezes e desliga o eco via stty.
+func readPassword() (string, error) {
+	in := bufio.NewReader(os.Stdin)
+	fi, err := os.Stdin.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	stty := func(arg string) {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}
+	stty("-echo")
+	defer stty("echo")
+
+	prompt := func(label string) (string, error) {
+		fmt.Fprint(os.Stderr, label)
+		line, err := in.ReadString('\n')
+		fmt.Fprintln(os.Stderr)
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	password, err := prompt("Password: ")
+	if err != nil {
+		return "", err
+	}
+	confirm, err := prompt("Confirm password: ")
+	if err != nil {
+		return "", err
+	}
+	if password != confirm {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return password, nil
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// nbackup-soak executa um soak test de sessões paralelas: um server em
+// processo recebe ciclos contínuos de N agents simulados, com quedas de
+// conexão injetadas, e cada backup commitado é conferido pelo SHA-256.
+//
+// Uso:
+//
+//	nbackup-soak [--duration 8h] [--agents 4] [--streams 1-8] [--chunk-sizes 256kb,1mb,4mb]
+//	             [--size 8mb-128mb] [--assembler-mode lazy] [--drop-probability 0.001] [--output json]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/logging"
+	"github.com/nishisan-dev/n-backup/internal/soak"
+)
+
+func main() {
+	fs := flag.NewFlagSet("nbackup-soak", flag.ExitOnError)
+	duration := fs.Duration("duration", time.Hour, "total run time; no cycle starts after it")
+	cycles := fs.Int("cycles", 0, "cycles per agent (0 = until --duration)")
+	agents := fs.Int("agents", 4, "simulated agents, each with its own certificate")
+	streams := fs.String("streams", "1-8", "parallel streams per session, drawn from the range")
+	chunkSizes := fs.String("chunk-sizes", "256kb,1mb,4mb", "comma-separated chunk sizes, one drawn per session")
+	size := fs.String("size", "8mb-128mb", "synthetic data per session, drawn from the range")
+	assemblerMode := fs.String("assembler-mode", "lazy", "assembler_mode of the soak storage: eager or lazy")
+	drop := fs.Float64("drop-probability", 0.001, "chaos: probability of dropping a stream per chunk")
+	sackDelay := fs.Float64("sack-delay-probability", 0.001, "chaos: probability of delaying a ChunkSACK (up to 2s)")
+	rotate := fs.Float64("rotate-probability", 0.01, "chaos: probability of a forced flow rotation per stream every 15s")
+	dir := fs.String("dir", "", "work directory kept after the run, with server.log (default: temporary, removed)")
+	seed := fs.Int64("seed", 0, "random seed for a reproducible run (0 = random)")
+	outputFlag := fs.String("output", "text", "output format: text or json")
+	logLevel := fs.String("log-level", "warn", "agent log level (stderr); the server logs to {dir}/server.log")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: nbackup-soak [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Runs an in-process server and simulated agents sending parallel sessions in\n")
+		fmt.Fprintf(os.Stderr, "a loop, with injected connection faults, and verifies the SHA-256 of every\n")
+		fmt.Fprintf(os.Stderr, "committed backup. Exits 1 on any failed cycle, mismatch or leftover staging.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+
+	if *outputFlag != "text" && *outputFlag != "json" {
+		usageError("--output must be text or json, got %q", *outputFlag)
+	}
+	opts := soak.Options{
+		Agents:               *agents,
+		Duration:             *duration,
+		Cycles:               *cycles,
+		AssemblerMode:        *assemblerMode,
+		DropProbability:      *drop,
+		SACKDelayProbability: *sackDelay,
+		RotateProbability:    *rotate,
+		Dir:                  *dir,
+		Seed:                 *seed,
+	}
+	if *assemblerMode != "eager" && *assemblerMode != "lazy" {
+		usageError("--assembler-mode must be eager or lazy, got %q", *assemblerMode)
+	}
+	lo, hi, err := parseIntRange(*streams)
+	if err != nil {
+		usageError("--streams: %v", err)
+	}
+	opts.MinStreams, opts.MaxStreams = int(lo), int(hi)
+	if opts.MinSize, opts.MaxSize, err = parseSizeRange(*size); err != nil {
+		usageError("--size: %v", err)
+	}
+	for _, s := range strings.Split(*chunkSizes, ",") {
+		c, err := config.ParseByteSize(strings.TrimSpace(s))
+		if err != nil {
+			usageError("--chunk-sizes: %v", err)
+		}
+		opts.ChunkSizes = append(opts.ChunkSizes, c)
+	}
+
+	logger, logCloser := logging.NewLoggerTo(*logLevel, "text", "", os.Stderr)
+	defer logCloser.Close()
+	if *outputFlag == "text" {
+		opts.OnCycle = func(c soak.Cycle) { soak.WriteCycle(os.Stdout, c) }
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	sum, err := soak.Run(ctx, opts, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := soak.WriteSummary(os.Stdout, sum, *outputFlag == "json"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing summary: %v\n", err)
+		os.Exit(1)
+	}
+	if !sum.OK {
+		os.Exit(1)
+	}
+}
+
+func usageError(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(2)
+}
+
+// parseIntRange aceita "N" ou "N-M".
+func parseIntRange(s string) (int64, int64, error) {
+	return parseRange(s, func(v string) (int64, error) { return strconv.ParseInt(v, 10, 64) })
+}
+
+// parseSizeRange aceita "8mb" ou "8mb-128mb".
+func parseSizeRange(s string) (int64, int64, error) {
+	return parseRange(s, config.ParseByteSize)
+}
+
+func parseRange(s string, parse func(string) (int64, error)) (int64, int64, error) {
+	lo, hi, found := strings.Cut(s, "-")
+	min, err := parse(strings.TrimSpace(lo))
+	if err != nil {
+		return 0, 0, err
+	}
+	if !found {
+		return min, min, nil
+	}
+	max, err := parse(strings.TrimSpace(hi))
+	if err != nil {
+		return 0, 0, err
+	}
+	return min, max, nil
+}
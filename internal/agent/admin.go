@@ -0,0 +1,194 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// adminIOTimeout limita a duração de uma requisição no socket de administração.
+const adminIOTimeout = 10 * time.Second
+
+// Comandos aceitos pelo socket de administração.
+const (
+	AdminCmdStatus  = "status"
+	AdminCmdTrigger = "trigger"
+	AdminCmdCancel  = "cancel"
+	AdminCmdReload  = "reload"
+)
+
+// AdminRequest é uma requisição JSON (uma por conexão) ao socket de administração.
+type AdminRequest struct {
+	Command string `json:"command"`
+	Backup  string `json:"backup,omitempty"`
+	Force   bool   `json:"force,omitempty"`
+}
+
+// AdminResponse é a resposta JSON do daemon.
+type AdminResponse struct {
+	OK      bool          `json:"ok"`
+	Error   string        `json:"error,omitempty"`
+	Message string        `json:"message,omitempty"`
+	Status  []EntryStatus `json:"status,omitempty"`
+}
+
+// AdminBackend implementa as operações expostas pelo socket de administração.
+type AdminBackend interface {
+	Status() []EntryStatus
+	Trigger(name string, force bool) error
+	Cancel(name string) error
+	Reload() error
+}
+
+// AdminServer atende o socket unix local de administração do daemon.
+type AdminServer struct {
+	path    string
+	backend AdminBackend
+	logger  *slog.Logger
+	ln      net.Listener
+	wg      sync.WaitGroup
+}
+
+// NewAdminServer cria um AdminServer para o socket em path.
+func NewAdminServer(path string, backend AdminBackend, logger *slog.Logger) *AdminServer {
+	return &AdminServer{
+		path:    path,
+		backend: backend,
+		logger:  logger.With("component", "admin_socket"),
+	}
+}
+
+// Start cria o socket e começa a aceitar conexões.
+// Um socket residual de um daemon morto é removido; se outro daemon
+// estiver respondendo no mesmo path, retorna erro.
+func (a *AdminServer) Start() error {
+	if err := os.MkdirAll(filepath.Dir(a.path), 0750); err != nil {
+		return fmt.Errorf("creating admin socket dir: %w", err)
+	}
+	if _, err := os.Stat(a.path); err == nil {
+		if conn, dialErr := net.DialTimeout("unix", a.path, time.Second); dialErr == nil {
+			conn.Close()
+			return fmt.Errorf("admin socket %s already in use by another daemon", a.path)
+		}
+		os.Remove(a.path)
+	}
+
+	ln, err := net.Listen("unix", a.path)
+	if err != nil {
+		return fmt.Errorf("listening on admin socket: %w", err)
+	}
+	if err := os.Chmod(a.path, 0660); err != nil {
+		ln.Close()
+		return fmt.Errorf("setting admin socket permissions: %w", err)
+	}
+	a.ln = ln
+
+	a.wg.Add(1)
+	go a.acceptLoop()
+
+	a.logger.Info("admin socket listening", "path", a.path)
+	return nil
+}
+
+// Stop fecha o socket e aguarda as requisições em andamento.
+func (a *AdminServer) Stop() {
+	if a.ln == nil {
+		return
+	}
+	a.ln.Close()
+	a.wg.Wait()
+	os.Remove(a.path)
+	a.logger.Info("admin socket stopped")
+}
+
+func (a *AdminServer) acceptLoop() {
+	defer a.wg.Done()
+	for {
+		conn, err := a.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			a.logger.Warn("admin socket accept failed", "error", err)
+			continue
+		}
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.handle(conn)
+		}()
+	}
+}
+
+func (a *AdminServer) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(adminIOTimeout))
+
+	var req AdminRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		json.NewEncoder(conn).Encode(AdminResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	resp := a.dispatch(req)
+	a.logger.Info("admin command", "command", req.Command, "backup", req.Backup, "ok", resp.OK, "error", resp.Error)
+	json.NewEncoder(conn).Encode(resp)
+}
+
+func (a *AdminServer) dispatch(req AdminRequest) AdminResponse {
+	var err error
+	var msg string
+
+	switch req.Command {
+	case AdminCmdStatus:
+		return AdminResponse{OK: true, Status: a.backend.Status()}
+	case AdminCmdTrigger:
+		err = a.backend.Trigger(req.Backup, req.Force)
+		msg = fmt.Sprintf("backup %q triggered", req.Backup)
+	case AdminCmdCancel:
+		err = a.backend.Cancel(req.Backup)
+		msg = fmt.Sprintf("backup %q cancellation requested", req.Backup)
+	case AdminCmdReload:
+		err = a.backend.Reload()
+		msg = "config reload requested"
+	default:
+		err = fmt.Errorf("unknown command %q", req.Command)
+	}
+
+	if err != nil {
+		return AdminResponse{Error: err.Error()}
+	}
+	return AdminResponse{OK: true, Message: msg}
+}
+
+// AdminCall envia uma requisição ao socket de administração de um daemon em execução.
+func AdminCall(path string, req AdminRequest) (*AdminResponse, error) {
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to agent daemon at %s: %w", path, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(adminIOTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("sending admin request: %w", err)
+	}
+	var resp AdminResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("reading admin response: %w", err)
+	}
+	if !resp.OK {
+		return &resp, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
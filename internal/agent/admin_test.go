@@ -0,0 +1,212 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+type fakeAdminBackend struct {
+	triggered string
+	force     bool
+	cancelled string
+	reloaded  bool
+}
+
+func (f *fakeAdminBackend) Status() []EntryStatus {
+	return []EntryStatus{{Name: "app", Running: &RunningStatus{BytesSent: 42}}}
+}
+
+func (f *fakeAdminBackend) Trigger(name string, force bool) error {
+	if name != "app" {
+		return fmt.Errorf("unknown backup %q", name)
+	}
+	f.triggered, f.force = name, force
+	return nil
+}
+
+func (f *fakeAdminBackend) Cancel(name string) error {
+	f.cancelled = name
+	return nil
+}
+
+func (f *fakeAdminBackend) Reload() error {
+	f.reloaded = true
+	return nil
+}
+
+func startTestAdminServer(t *testing.T, backend AdminBackend) string {
+	t.Helper()
+	// Paths de socket unix são limitados a ~108 bytes; evita TempDir longos
+	dir, err := os.MkdirTemp("", "nbadm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "run", "agent.sock")
+
+	srv := NewAdminServer(path, backend, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(srv.Stop)
+	return path
+}
+
+func TestAdminServer_Commands(t *testing.T) {
+	backend := &fakeAdminBackend{}
+	path := startTestAdminServer(t, backend)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("socket not created: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0660 {
+		t.Errorf("expected socket mode 0660, got %o", perm)
+	}
+
+	resp, err := AdminCall(path, AdminRequest{Command: AdminCmdStatus})
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if len(resp.Status) != 1 || resp.Status[0].Running == nil || resp.Status[0].Running.BytesSent != 42 {
+		t.Fatalf("unexpected status response: %+v", resp.Status)
+	}
+
+	if _, err := AdminCall(path, AdminRequest{Command: AdminCmdTrigger, Backup: "app", Force: true}); err != nil {
+		t.Fatalf("trigger: %v", err)
+	}
+	if backend.triggered != "app" || !backend.force {
+		t.Errorf("trigger not forwarded: %+v", backend)
+	}
+
+	if _, err := AdminCall(path, AdminRequest{Command: AdminCmdCancel, Backup: "app"}); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if backend.cancelled != "app" {
+		t.Errorf("cancel not forwarded: %+v", backend)
+	}
+
+	if _, err := AdminCall(path, AdminRequest{Command: AdminCmdReload}); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !backend.reloaded {
+		t.Error("reload not forwarded")
+	}
+}
+
+func TestAdminServer_Errors(t *testing.T) {
+	path := startTestAdminServer(t, &fakeAdminBackend{})
+
+	if _, err := AdminCall(path, AdminRequest{Command: AdminCmdTrigger, Backup: "nope"}); err == nil {
+		t.Error("expected error for unknown backup")
+	}
+	if _, err := AdminCall(path, AdminRequest{Command: "explode"}); err == nil {
+		t.Error("expected error for unknown command")
+	}
+}
+
+func TestAdminServer_StaleSocketAndLiveDaemon(t *testing.T) {
+	dir, err := os.MkdirTemp("", "nbadm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.sock")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Socket residual (ninguém escutando) é substituído
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	first := NewAdminServer(path, &fakeAdminBackend{}, logger)
+	if err := first.Start(); err != nil {
+		t.Fatalf("expected stale socket to be replaced, got %v", err)
+	}
+	defer first.Stop()
+
+	// Segundo daemon no mesmo path é recusado
+	second := NewAdminServer(path, &fakeAdminBackend{}, logger)
+	if err := second.Start(); err == nil {
+		second.Stop()
+		t.Fatal("expected error when socket is in use by a live daemon")
+	}
+}
+
+func TestScheduler_TriggerCancelAndLiveStatus(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	entry := config.BackupEntry{Name: "app", Storage: "default", Schedule: "0 2 * * *", MinInterval: time.Hour}
+	dir := t.TempDir()
+
+	// Sucesso recente: min_interval suprimiria uma execução sem force
+	state, _ := LoadScheduleState(dir)
+	if err := state.Record("app", JobRun{Status: "completed", Start: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	runFn := func(ctx context.Context, cfg *config.AgentConfig, e config.BackupEntry, l *slog.Logger, job *BackupJob) error {
+		w := job.liveWriter(io.Discard)
+		w.Write(make([]byte, 1024))
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	sched, err := NewScheduler(newTestSchedulerConfig(dir, entry), logger, runFn, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+
+	if err := sched.Trigger("missing", false); err == nil {
+		t.Error("expected error for unknown backup")
+	}
+	if err := sched.Cancel("app"); err == nil {
+		t.Error("expected error cancelling idle backup")
+	}
+	if err := sched.Trigger("app", true); err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("forced trigger did not run")
+	}
+
+	if err := sched.Trigger("app", true); err == nil {
+		t.Error("expected error triggering a running backup")
+	}
+	st := sched.LiveStatus()
+	if len(st) != 1 || st[0].Running == nil || st[0].Running.BytesSent != 1024 {
+		t.Fatalf("expected live running status with 1024 bytes, got %+v", st)
+	}
+
+	if err := sched.Cancel("app"); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	sched.bgWg.Wait()
+
+	last, _ := sched.state.Get("app")
+	if last.LastStatus != "cancelled" {
+		t.Fatalf("expected cancelled status persisted, got %q", last.LastStatus)
+	}
+	if st := sched.LiveStatus(); st[0].Running != nil {
+		t.Error("expected no running status after cancel")
+	}
+}
@@ -6,16 +6,26 @@ package agent
 
 import (
 	"archive/tar"
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/klauspost/compress/zstd"
 
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
 	"github.com/nishisan-dev/n-backup/internal/protocol"
 )
 
@@ -101,13 +111,156 @@ func TestScanner_ContextCancellation(t *testing.T) {
 	}
 }
 
+func TestScanner_FollowSymlinks(t *testing.T) {
+	dir := createTestTree(t)
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "target.txt"), []byte("target"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{
+		"link-file": filepath.Join(outside, "target.txt"),
+		"link-dir":  outside,
+		"broken":    filepath.Join(outside, "missing"),
+		"loop":      dir, // ciclo: aponta para o próprio source
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func(follow bool) map[string]os.FileMode {
+		scanner := NewEntryScanner(config.BackupEntry{
+			Sources: []config.BackupSource{{Path: dir, FollowSymlinks: follow}},
+		})
+		modes := make(map[string]os.FileMode)
+		err := scanner.Scan(context.Background(), func(entry FileEntry) error {
+			rel, _ := filepath.Rel(dir, entry.Path)
+			modes[rel] = entry.Info.Mode()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		return modes
+	}
+
+	modes := scan(false)
+	for _, name := range []string{"link-file", "link-dir", "broken", "loop"} {
+		if modes[name]&os.ModeSymlink == 0 {
+			t.Errorf("without follow_symlinks %s should be a symlink, got %v", name, modes[name])
+		}
+	}
+	if _, ok := modes[filepath.Join("link-dir", "target.txt")]; ok {
+		t.Error("without follow_symlinks the linked directory should not be traversed")
+	}
+
+	modes = scan(true)
+	if !modes["link-file"].IsRegular() {
+		t.Errorf("link-file should be followed to a regular file, got %v", modes["link-file"])
+	}
+	if !modes["link-dir"].IsDir() || !modes[filepath.Join("link-dir", "target.txt")].IsRegular() {
+		t.Errorf("link-dir should be followed and traversed, got %v", modes)
+	}
+	if modes["broken"]&os.ModeSymlink == 0 {
+		t.Errorf("broken link should stay a symlink, got %v", modes["broken"])
+	}
+	if !modes["loop"].IsDir() {
+		t.Errorf("loop should be followed to a directory, got %v", modes["loop"])
+	}
+	if _, ok := modes[filepath.Join("loop", "file1.txt")]; ok {
+		t.Error("cyclic symlink should not be traversed")
+	}
+}
+
+func TestScanner_OneFilesystem(t *testing.T) {
+	dir := t.TempDir()
+	var dirSt, procSt syscall.Stat_t
+	if err := syscall.Stat(dir, &dirSt); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Stat("/proc", &procSt); err != nil || procSt.Dev == dirSt.Dev {
+		t.Skip("/proc is not a separate filesystem here")
+	}
+	// O symlink seguido leva a travessia para outro filesystem
+	if err := os.Symlink("/proc", filepath.Join(dir, "proc")); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := NewEntryScanner(config.BackupEntry{
+		Sources: []config.BackupSource{{Path: dir, FollowSymlinks: true, OneFilesystem: true}},
+	})
+	var files []string
+	err := scanner.Scan(context.Background(), func(entry FileEntry) error {
+		rel, _ := filepath.Rel(dir, entry.Path)
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(files) != 2 || files[1] != "proc" {
+		t.Errorf("expected only the source and the mount point, got %v", files)
+	}
+}
+
+func TestScanner_FileFilters(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for _, f := range []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"tiny.txt", 10, time.Hour},
+		{"recent.dat", 2048, time.Hour},
+		{"old.dat", 2048, 60 * 24 * time.Hour},
+		{"huge.cache", 64 << 10, time.Hour},
+	} {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, make([]byte, f.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-f.age)
+		os.Chtimes(path, mtime, mtime)
+	}
+
+	scan := func(src config.BackupSource) []string {
+		src.Path = dir
+		var files []string
+		err := NewEntryScanner(config.BackupEntry{Sources: []config.BackupSource{src}}).Scan(context.Background(), func(e FileEntry) error {
+			files = append(files, filepath.Base(e.Path))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		return files
+	}
+
+	// O diretório do source sempre entra; os filtros valem apenas para arquivos regulares
+	base := filepath.Base(dir)
+	for name, tc := range map[string]struct {
+		src  config.BackupSource
+		want string
+	}{
+		"size range":      {config.BackupSource{MinFileSizeRaw: 1024, MaxFileSizeRaw: 32 << 10}, "old.dat recent.dat"},
+		"modified_within": {config.BackupSource{ModifiedWithin: 7 * 24 * time.Hour}, "huge.cache recent.dat tiny.txt"},
+		"modified_before": {config.BackupSource{ModifiedBefore: 30 * 24 * time.Hour}, "old.dat"},
+		"combined":        {config.BackupSource{MaxFileSizeRaw: 32 << 10, ModifiedWithin: 24 * time.Hour, MinFileSizeRaw: 100}, "recent.dat"},
+	} {
+		if got := strings.Join(scan(tc.src), " "); got != base+" "+tc.want {
+			t.Errorf("%s: got %q, want %q", name, got, base+" "+tc.want)
+		}
+	}
+}
+
 func TestStream_ProducesValidTarGz(t *testing.T) {
 	dir := createTestTree(t)
 
 	scanner := NewScanner([]string{dir}, []string{"*.log", ".git/**"})
 
 	var buf bytes.Buffer
-	result, err := Stream(context.Background(), scanner, &buf, nil, nil, protocol.CompressionGzip, 0)
+	result, err := Stream(context.Background(), scanner, &buf, nil, nil, Compression{Mode: protocol.CompressionGzip}, 0, 0, nil)
 	if err != nil {
 		t.Fatalf("Stream: %v", err)
 	}
@@ -155,7 +308,7 @@ func TestStream_ChecksumConsistency(t *testing.T) {
 	scanner := NewScanner([]string{dir}, nil)
 
 	var buf bytes.Buffer
-	result, err := Stream(context.Background(), scanner, &buf, nil, nil, protocol.CompressionGzip, 0)
+	result, err := Stream(context.Background(), scanner, &buf, nil, nil, Compression{Mode: protocol.CompressionGzip}, 0, 0, nil)
 	if err != nil {
 		t.Fatalf("Stream: %v", err)
 	}
@@ -178,7 +331,7 @@ func TestStream_ProducesValidTarZst(t *testing.T) {
 	scanner := NewScanner([]string{dir}, []string{"*.log", ".git/**"})
 
 	var buf bytes.Buffer
-	result, err := Stream(context.Background(), scanner, &buf, nil, nil, protocol.CompressionZstd, 0)
+	result, err := Stream(context.Background(), scanner, &buf, nil, nil, Compression{Mode: protocol.CompressionZstd}, 0, 0, nil)
 	if err != nil {
 		t.Fatalf("Stream: %v", err)
 	}
@@ -249,3 +402,459 @@ func writeFile(t *testing.T, path, content string) {
 		t.Fatalf("writing file %s: %v", path, err)
 	}
 }
+
+func TestStream_NoEntriesProducesEmptyPayload(t *testing.T) {
+	scanner := NewScanner([]string{filepath.Join(t.TempDir(), "missing")}, nil)
+
+	var buf bytes.Buffer
+	result, err := Stream(context.Background(), scanner, &buf, nil, nil, Compression{Mode: protocol.CompressionGzip}, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if result.Entries != 0 || result.Size != 0 || buf.Len() != 0 {
+		t.Fatalf("expected empty payload, got entries=%d size=%d buf=%d", result.Entries, result.Size, buf.Len())
+	}
+	trailer := protocol.Trailer{Checksum: result.Checksum, Size: result.Size}
+	if !trailer.IsEmpty() {
+		t.Error("expected trailer of an empty stream to declare an empty backup")
+	}
+}
+
+// readTarGz lê todas as entradas de um tar.gz, retornando headers e conteúdos.
+func readTarGz(t *testing.T, data []byte) ([]*tar.Header, map[string][]byte) {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid gzip: %v", err)
+	}
+	defer gz.Close()
+
+	var headers []*tar.Header
+	contents := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading tar: %v", err)
+		}
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("reading %s: %v", hdr.Name, err)
+		}
+		headers = append(headers, hdr)
+		contents[hdr.Name] = body
+	}
+	return headers, contents
+}
+
+func TestStream_HardlinksStoredOnce(t *testing.T) {
+	dir := t.TempDir()
+	payload := bytes.Repeat([]byte("maildir message "), 4096)
+	first := filepath.Join(dir, "a.eml")
+	if err := os.WriteFile(first, payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(first, filepath.Join(dir, "b.eml")); err != nil {
+		t.Skipf("hardlinks not supported: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := Stream(context.Background(), NewScanner([]string{dir}, nil), &buf, nil, nil, Compression{Mode: protocol.CompressionGzip}, 0, 0, nil); err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	headers, contents := readTarGz(t, buf.Bytes())
+	firstRel := strings.TrimPrefix(first, "/")
+	var link *tar.Header
+	for _, h := range headers {
+		if filepath.Base(h.Name) == "b.eml" {
+			link = h
+		}
+	}
+	if link == nil || link.Typeflag != tar.TypeLink || link.Linkname != firstRel {
+		t.Fatalf("expected b.eml as hardlink to %s, got %+v", firstRel, link)
+	}
+	if !bytes.Equal(contents[firstRel], payload) {
+		t.Error("first occurrence must carry the file content")
+	}
+	if len(contents[link.Name]) != 0 {
+		t.Error("hardlink entry must not carry content")
+	}
+}
+
+func TestStream_FileManifest(t *testing.T) {
+	dir := t.TempDir()
+	payload := []byte("manifest payload")
+	writeFile(t, filepath.Join(dir, "a.txt"), string(payload))
+	os.Chmod(filepath.Join(dir, "a.txt"), 0640)
+	if err := os.Link(filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")); err != nil {
+		t.Skipf("hardlinks not supported: %v", err)
+	}
+	os.Symlink("a.txt", filepath.Join(dir, "link"))
+
+	mf, err := manifest.Create(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Remove()
+	res, err := Stream(context.Background(), NewScanner([]string{dir}, nil), io.Discard, nil, nil, Compression{Mode: protocol.CompressionGzip}, 0, 0, mf)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if mf.Entries() != res.Entries {
+		t.Errorf("manifest has %d entries, archive %d", mf.Entries(), res.Entries)
+	}
+
+	r, _, err := mf.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]manifest.Entry)
+	if err := manifest.Read(r, func(e manifest.Entry) error {
+		got[filepath.Base(e.Path)] = e
+		return nil
+	}); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	sum := sha256.Sum256(payload)
+	rel := strings.TrimPrefix(dir, "/")
+	if e := got["a.txt"]; e.Type != manifest.TypeFile || e.Size != int64(len(payload)) || e.Mode != "0640" || e.SHA256 != hex.EncodeToString(sum[:]) || e.MTime.IsZero() {
+		t.Errorf("unexpected file entry: %+v", e)
+	}
+	if e := got["b.txt"]; e.Type != manifest.TypeHardlink || e.Link != rel+"/a.txt" || e.SHA256 != "" {
+		t.Errorf("unexpected hardlink entry: %+v", e)
+	}
+	if e := got["link"]; e.Type != manifest.TypeSymlink || e.Link != "a.txt" {
+		t.Errorf("unexpected symlink entry: %+v", e)
+	}
+	if e := got[filepath.Base(dir)]; e.Type != manifest.TypeDir {
+		t.Errorf("unexpected dir entry: %+v", e)
+	}
+}
+
+func TestStream_ManifestCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		writeFile(t, filepath.Join(dir, name), strings.Repeat(name, 1000))
+	}
+	defer func(v int64) { checkpointInterval = v }(checkpointInterval)
+	checkpointInterval = 1 // um membro por entrada
+
+	for _, mode := range []byte{protocol.CompressionGzip, protocol.CompressionZstd} {
+		mf, err := manifest.Create(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		res, err := Stream(context.Background(), NewScanner([]string{dir}, nil), &buf, nil, nil, Compression{Mode: mode}, 0, 0, mf)
+		mf.Remove()
+		if err != nil {
+			t.Fatalf("Stream: %v", err)
+		}
+
+		// Continua um único tar válido
+		var zr io.Reader
+		if mode == protocol.CompressionZstd {
+			d, _ := zstd.NewReader(bytes.NewReader(buf.Bytes()))
+			defer d.Close()
+			zr = d
+		} else {
+			zr, _ = gzip.NewReader(bytes.NewReader(buf.Bytes()))
+		}
+		tr := tar.NewReader(zr)
+		var entries int64
+		for {
+			if _, err := tr.Next(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("mode %d: reading tar: %v", mode, err)
+			}
+			entries++
+		}
+		if entries != res.Entries {
+			t.Errorf("mode %d: expected %d entries, got %d", mode, res.Entries, entries)
+		}
+
+		if mode == protocol.CompressionGzip {
+			// Um membro gzip por entrada, mais o do fim do tar
+			br := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+			gz, _ := gzip.NewReader(br)
+			members := 0
+			for {
+				gz.Multistream(false)
+				io.Copy(io.Discard, gz)
+				members++
+				if err := gz.Reset(br); err == io.EOF {
+					break
+				}
+			}
+			if int64(members) != res.Entries+1 {
+				t.Errorf("expected %d gzip members, got %d", res.Entries+1, members)
+			}
+		}
+	}
+}
+
+func TestStream_SparseFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "disk.img")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = 64 << 20
+	data := bytes.Repeat([]byte{0xAB}, 128<<10)
+	if _, err := f.WriteAt(data, 16<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := fi.Sys().(*syscall.Stat_t); st.Blocks*512 >= size {
+		t.Skip("filesystem does not support sparse files")
+	}
+
+	mf, err := manifest.Create(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Remove()
+	var buf bytes.Buffer
+	if _, err := Stream(context.Background(), NewScanner([]string{path}, nil), &buf, nil, nil, Compression{Mode: protocol.CompressionGzip}, 0, 0, mf); err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	headers, contents := readTarGz(t, buf.Bytes())
+	rel := strings.TrimPrefix(path, "/")
+	if len(headers) != 1 || headers[0].Name != rel || headers[0].Size != size {
+		t.Fatalf("expected sparse entry %s with size %d, got %+v", rel, size, headers[0])
+	}
+	if headers[0].PAXRecords["GNU.sparse.major"] != "1" {
+		t.Errorf("expected GNU sparse 1.0 records, got %v", headers[0].PAXRecords)
+	}
+
+	want := make([]byte, size)
+	copy(want[16<<20:], data)
+	if !bytes.Equal(contents[rel], want) {
+		t.Error("restored sparse content differs from the original")
+	}
+
+	// O hash do manifest cobre o conteúdo lógico, buracos incluídos
+	r, _, _ := mf.Finish()
+	sum := sha256.Sum256(want)
+	manifest.Read(r, func(e manifest.Entry) error {
+		if e.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("sparse file manifest hash mismatch: %+v", e)
+		}
+		return nil
+	})
+}
+
+func TestSparseRegions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "holes")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt([]byte("head"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(32 << 20); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	regions := sparseRegions(f, fi)
+	if regions == nil {
+		t.Skip("filesystem does not support SEEK_DATA/SEEK_HOLE")
+	}
+	if regions[0].Offset != 0 || regions[0].Length == 0 {
+		t.Errorf("expected leading data region, got %+v", regions)
+	}
+	if last := regions[len(regions)-1]; last.Offset != 32<<20 || last.Length != 0 {
+		t.Errorf("expected trailing empty region at EOF, got %+v", last)
+	}
+
+	// Arquivo denso não é tratado como esparso
+	dense := filepath.Join(t.TempDir(), "dense")
+	writeFile(t, dense, "no holes here")
+	df, _ := os.Open(dense)
+	defer df.Close()
+	dfi, _ := df.Stat()
+	if r := sparseRegions(df, dfi); r != nil {
+		t.Errorf("expected nil regions for dense file, got %+v", r)
+	}
+}
+
+func TestStream_Xattrs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.html")
+	if err := os.WriteFile(path, []byte("<html></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := setXattr(path, "user.origin", []byte("web\x00root")); err != nil {
+		t.Skipf("user xattrs not supported: %v", err)
+	}
+
+	stream := func(xattrs bool) map[string]string {
+		var buf bytes.Buffer
+		scanner := NewScanner([]string{dir}, nil).WithXattrs(xattrs)
+		if _, err := Stream(context.Background(), scanner, &buf, nil, nil, Compression{Mode: protocol.CompressionGzip}, 0, 0, nil); err != nil {
+			t.Fatalf("Stream: %v", err)
+		}
+		headers, _ := readTarGz(t, buf.Bytes())
+		for _, h := range headers {
+			if filepath.Base(h.Name) == "index.html" {
+				return h.PAXRecords
+			}
+		}
+		t.Fatal("index.html not found in archive")
+		return nil
+	}
+
+	if got := stream(true)["SCHILY.xattr.user.origin"]; got != "web\x00root" {
+		t.Errorf("xattr record = %q, want %q", got, "web\x00root")
+	}
+	if _, ok := stream(false)["SCHILY.xattr.user.origin"]; ok {
+		t.Error("xattrs captured without WithXattrs")
+	}
+}
+
+func TestScanner_SplitPartitionsEntries(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 12; i++ {
+		os.Mkdir(filepath.Join(dir, fmt.Sprintf("dir%02d", i)), 0755)
+		writeFile(t, filepath.Join(dir, fmt.Sprintf("dir%02d", i), "file.txt"), "x")
+		writeFile(t, filepath.Join(dir, fmt.Sprintf("top%02d.txt", i)), "y")
+	}
+	scanner := NewEntryScanner(config.BackupEntry{
+		Sources:        []config.BackupSource{{Path: dir}},
+		ProducerShards: 3,
+		Assertions:     config.BackupAssertions{RequiredPaths: []string{filepath.Join(dir, "dir07", "file.txt")}},
+	})
+
+	var want []string
+	scanner.Scan(context.Background(), func(e FileEntry) error {
+		want = append(want, e.RelPath)
+		return nil
+	})
+
+	// Cada entrada sai em exatamente uma partição
+	parts := scanner.split()
+	seen := make(map[string]int)
+	for i, part := range parts {
+		n := 0
+		part.Scan(context.Background(), func(e FileEntry) error {
+			seen[e.RelPath]++
+			n++
+			return nil
+		})
+		if n == 0 {
+			t.Errorf("partition %d is empty", i)
+		}
+	}
+	if len(seen) != len(want) {
+		t.Errorf("expected %d entries across partitions, got %d", len(want), len(seen))
+	}
+	for _, p := range want {
+		if seen[p] != 1 {
+			t.Errorf("%s delivered %d times", p, seen[p])
+		}
+	}
+
+	scanner.mergeRequired(parts)
+	if missing := scanner.MissingRequired(); len(missing) != 0 {
+		t.Errorf("expected required path found by one partition, missing %v", missing)
+	}
+}
+
+func TestStream_ProducerShards(t *testing.T) {
+	dir := t.TempDir()
+	want := make(map[string][]byte)
+	for i := 0; i < 16; i++ {
+		os.Mkdir(filepath.Join(dir, fmt.Sprintf("dir%02d", i)), 0755)
+		for j := 0; j < 4; j++ {
+			rel := filepath.Join(fmt.Sprintf("dir%02d", i), fmt.Sprintf("file%d.txt", j))
+			data := bytes.Repeat([]byte(rel), 2000)
+			writeFile(t, filepath.Join(dir, rel), string(data))
+			want[rel] = data
+		}
+	}
+	// Maior que shardSegmentLimit depois de comprimido: segmento gravado direto
+	big := make([]byte, shardSegmentLimit+1024*1024)
+	rand.New(rand.NewSource(1)).Read(big)
+	writeFile(t, filepath.Join(dir, "dir03", "big.bin"), string(big))
+	want[filepath.Join("dir03", "big.bin")] = big
+
+	scanner := NewScanner([]string{dir}, nil)
+	var single int64
+	scanner.Scan(context.Background(), func(FileEntry) error { single++; return nil })
+	scanner.shards = 4
+
+	for _, mode := range []byte{protocol.CompressionGzip, protocol.CompressionZstd} {
+		mf, err := manifest.Create(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		res, err := Stream(context.Background(), scanner, &buf, nil, nil, Compression{Mode: mode}, 0, 0, mf)
+		if err != nil {
+			t.Fatalf("mode %d: Stream: %v", mode, err)
+		}
+		if res.Entries != single || mf.Entries() != single {
+			t.Errorf("mode %d: expected %d entries, got %d (manifest %d)", mode, single, res.Entries, mf.Entries())
+		}
+		mf.Remove()
+		if sum := sha256.Sum256(buf.Bytes()); sum != res.Checksum || uint64(buf.Len()) != res.Size {
+			t.Errorf("mode %d: checksum/size do not match the payload", mode)
+		}
+
+		// Os segmentos dos producers formam um único tar válido
+		var zr io.Reader
+		if mode == protocol.CompressionZstd {
+			d, _ := zstd.NewReader(bytes.NewReader(buf.Bytes()))
+			defer d.Close()
+			zr = d
+		} else {
+			zr, _ = gzip.NewReader(bytes.NewReader(buf.Bytes()))
+		}
+		tr := tar.NewReader(zr)
+		var entries int64
+		found := 0
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("mode %d: reading tar: %v", mode, err)
+			}
+			entries++
+			rel, _ := filepath.Rel(strings.TrimPrefix(dir, "/"), hdr.Name)
+			if data, ok := want[rel]; ok {
+				got, _ := io.ReadAll(tr)
+				if !bytes.Equal(got, data) {
+					t.Errorf("mode %d: content mismatch for %s", mode, rel)
+				}
+				found++
+			}
+		}
+		if entries != single || found != len(want) {
+			t.Errorf("mode %d: expected %d entries and %d files, got %d and %d", mode, single, len(want), entries, found)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// ErrAssertionFailed indica que o backup terminou o stream sem atender às
+// assertions do entry (min_bytes, min_objects, required_paths). O archive não
+// é commitado e o backup não é retentado: outra tentativa leria os mesmos
+// sources.
+var ErrAssertionFailed = errors.New("backup assertion failed")
+
+// checkAssertions verifica o resultado do stream contra as assertions do
+// entry. Todas as violações são listadas no erro.
+func checkAssertions(a config.BackupAssertions, res *StreamResult, scanner *Scanner) error {
+	var violations []string
+	if a.MinObjects > 0 && res.Entries < a.MinObjects {
+		violations = append(violations, fmt.Sprintf("%d objects, expected at least %d", res.Entries, a.MinObjects))
+	}
+	if a.MinBytesRaw > 0 && res.Bytes < a.MinBytesRaw {
+		violations = append(violations, fmt.Sprintf("%d bytes, expected at least %d (%s)", res.Bytes, a.MinBytesRaw, a.MinBytes))
+	}
+	if missing := scanner.MissingRequired(); len(missing) > 0 {
+		violations = append(violations, "required paths missing: "+strings.Join(missing, ", "))
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%w: %s", ErrAssertionFailed, strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// discardSession pede ao server, via control channel, que descarte a sessão
+// de um backup reprovado pelas assertions. Sem control channel a sessão
+// parcial expira pelo TTL.
+func discardSession(controlCh *ControlChannel, sessionID string, logger *slog.Logger) {
+	if controlCh == nil {
+		return
+	}
+	if err := controlCh.SendSessionCancel(sessionID); err != nil {
+		logger.Warn("server not notified of discarded session, it will expire by TTL", "error", err)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func TestCheckAssertions(t *testing.T) {
+	dir := createTestTree(t)
+
+	tests := []struct {
+		name       string
+		assertions config.BackupAssertions
+		violations []string
+	}{
+		{"none", config.BackupAssertions{}, nil},
+		{"satisfied", config.BackupAssertions{
+			MinBytesRaw:   1,
+			MinObjects:    4,
+			RequiredPaths: []string{filepath.Join(dir, "file1.txt"), filepath.Join(dir, "sub") + "/"},
+		}, nil},
+		{"too few objects", config.BackupAssertions{MinObjects: 1000}, []string{"expected at least 1000"}},
+		{"too few bytes", config.BackupAssertions{MinBytes: "1gb", MinBytesRaw: 1 << 30}, []string{"(1gb)"}},
+		{"missing and excluded paths", config.BackupAssertions{
+			RequiredPaths: []string{filepath.Join(dir, "nope.txt"), filepath.Join(dir, "access.log")},
+		}, []string{"nope.txt", "access.log"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := NewEntryScanner(config.BackupEntry{
+				Sources:    []config.BackupSource{{Path: dir}},
+				Exclude:    []string{"*.log"},
+				Assertions: tt.assertions,
+			})
+			res, err := Stream(context.Background(), scanner, io.Discard, nil, nil, Compression{Mode: protocol.CompressionGzip}, 0, 0, nil)
+			if err != nil {
+				t.Fatalf("Stream: %v", err)
+			}
+
+			err = checkAssertions(tt.assertions, res, scanner)
+			if len(tt.violations) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrAssertionFailed) {
+				t.Fatalf("expected ErrAssertionFailed, got %v", err)
+			}
+			for _, v := range tt.violations {
+				if !strings.Contains(err.Error(), v) {
+					t.Errorf("error %q does not mention %q", err, v)
+				}
+			}
+		})
+	}
+}
@@ -54,6 +54,10 @@ type AutoScaler struct {
 	probeWindows  int     // janelas decorridas no probe
 	probeCooldown int     // janelas restantes de cooldown
 
+	// Último ControlServerLoad da sessão e se o scale-up está retido por ele
+	serverLoad atomic.Pointer[serverLoadSample]
+	serverHeld bool
+
 	// Snapshot exportado (thread-safe)
 	snapshotMu   sync.RWMutex
 	LastSnapshot AutoScaleSnapshot
@@ -78,6 +82,22 @@ const (
 	adaptiveScaleDownThr = 0.5  // threshold de scale-down no modo adaptive
 )
 
+// Limiares de congestionamento do server (ControlServerLoad). Acima de
+// qualquer um deles o gargalo é o disco do server: mais streams só aumentariam
+// a fila, então o scale-up (e o probe, no modo adaptive) espera.
+const (
+	serverCongestedPendingBytes = 64 * 1024 * 1024      // bytes recebidos e não gravados
+	serverCongestedWriteLatency = 50 * time.Millisecond // gravação média de um chunk
+	serverCongestedQueueDepth   = 4                     // writes aguardando worker no storage
+	serverLoadMaxAge            = 90 * time.Second      // amostras mais antigas são ignoradas
+)
+
+// serverLoadSample é um ControlServerLoad com o instante de recebimento.
+type serverLoadSample struct {
+	load protocol.ControlServerLoad
+	at   time.Time
+}
+
 // AutoScalerConfig contém parâmetros do auto-scaler.
 type AutoScalerConfig struct {
 	Dispatcher     *Dispatcher
@@ -176,12 +196,7 @@ func (as *AutoScaler) evaluate() {
 	as.lastRates = rates
 
 	// Diagnóstico: identifica gargalo producer vs consumer
-	bottleneck := "balanced"
-	if rates.ProducerBlockedMs > rates.SenderIdleMs && rates.ProducerBlockedMs > 100 {
-		bottleneck = "network"
-	} else if rates.SenderIdleMs > rates.ProducerBlockedMs && rates.SenderIdleMs > 100 {
-		bottleneck = "producer"
-	}
+	bottleneck := diagnoseBottleneck(rates.ProducerBlockedMs, rates.SenderIdleMs)
 
 	as.logger.Debug("auto-scaler evaluation",
 		"enabled", as.enabled,
@@ -223,6 +238,10 @@ func (as *AutoScaler) evaluateEfficiency(efficiency float64, rates RateSample, a
 	case efficiency > 1.0:
 		// Produtor mais rápido que os drains — precisa de mais streams
 		as.scaleDownCount = 0
+		if as.holdScaleUp() {
+			as.scaleUpCount = 0
+			break
+		}
 		as.scaleUpCount++
 
 		if as.scaleUpCount >= as.hysteresis {
@@ -282,8 +301,8 @@ func (as *AutoScaler) evaluateAdaptive(efficiency float64, rates RateSample, act
 			as.scaleDownCount = 0
 		}
 
-		// Tenta iniciar probe se tem headroom
-		if active < as.dispatcher.maxStreams {
+		// Tenta iniciar probe se tem headroom e o server não é o gargalo
+		if active < as.dispatcher.StreamLimit() && !as.holdScaleUp() {
 			as.scaleUpCount++
 			if as.scaleUpCount >= as.hysteresis {
 				// Inicia probe: ativa +1 stream e mede
@@ -374,11 +393,75 @@ func (as *AutoScaler) evaluateAdaptive(efficiency float64, rates RateSample, act
 	}
 }
 
+// ObserveServerLoad registra o último ControlServerLoad da sessão.
+func (as *AutoScaler) ObserveServerLoad(load *protocol.ControlServerLoad) {
+	as.serverLoad.Store(&serverLoadSample{load: *load, at: time.Now()})
+}
+
+// serverCongested indica, com o motivo, se o último ControlServerLoad recente
+// aponta o server como gargalo.
+func (as *AutoScaler) serverCongested() (bool, string) {
+	s := as.serverLoad.Load()
+	if s == nil || time.Since(s.at) > serverLoadMaxAge {
+		return false, ""
+	}
+	switch {
+	case time.Duration(s.load.WriteLatency)*time.Microsecond >= serverCongestedWriteLatency:
+		return true, "server disk write latency"
+	case s.load.PendingBytes >= serverCongestedPendingBytes:
+		return true, "server pending bytes"
+	case s.load.QueueDepth >= serverCongestedQueueDepth:
+		return true, "server storage write queue"
+	}
+	return false, ""
+}
+
+// holdScaleUp indica se o scale-up deve esperar o server descongestionar.
+// Loga as transições para que o motivo apareça sem nível debug.
+func (as *AutoScaler) holdScaleUp() bool {
+	congested, reason := as.serverCongested()
+	if congested != as.serverHeld {
+		as.serverHeld = congested
+		if congested {
+			load := as.serverLoad.Load().load
+			as.logger.Info("auto-scaler: holding scale-up, server is the bottleneck",
+				"reason", reason,
+				"pendingBytes", load.PendingBytes,
+				"writeLatency", time.Duration(load.WriteLatency)*time.Microsecond,
+				"queueDepth", load.QueueDepth,
+				"activeStreams", as.dispatcher.ActiveStreams(),
+			)
+		} else {
+			as.logger.Info("auto-scaler: server congestion cleared, scale-up allowed")
+		}
+	}
+	return congested
+}
+
+// ApplyStreamLimit aplica o teto de streams recomendado pelo server
+// (ControlStreamLimit): o Dispatcher desativa os streams excedentes, o server
+// é avisado de cada um via ControlSlotPark e o scale-up passa a respeitar o teto.
+func (as *AutoScaler) ApplyStreamLimit(limit *protocol.ControlStreamLimit) {
+	parked := as.dispatcher.SetStreamLimit(int(limit.MaxStreams))
+	if as.controlChannel != nil && as.controlChannel.IsConnected() {
+		for _, idx := range parked {
+			as.controlChannel.SendSlotPark(uint8(idx))
+		}
+	}
+
+	as.logger.Info("auto-scaler: server stream limit applied",
+		"streamLimit", limit.MaxStreams,
+		"parked", parked,
+		"activeStreams", as.dispatcher.ActiveStreams(),
+		"maxStreams", as.dispatcher.maxStreams,
+	)
+}
+
 // scaleUp ativa +1 stream.
 func (as *AutoScaler) scaleUp(reason string) {
 	active := as.dispatcher.ActiveStreams()
-	if active >= as.dispatcher.maxStreams {
-		as.logger.Debug("auto-scaler: already at max streams", "max", as.dispatcher.maxStreams)
+	if limit := as.dispatcher.StreamLimit(); active >= limit {
+		as.logger.Debug("auto-scaler: already at max streams", "max", limit)
 		return
 	}
 
@@ -451,3 +534,18 @@ func (as *AutoScaler) updateSnapshot(efficiency float64, rates RateSample, activ
 	}
 	as.snapshotMu.Unlock()
 }
+
+// diagnoseBottleneck identifica o gargalo do pipeline a partir do tempo em
+// que o produtor ficou bloqueado (buffer cheio) e os senders ociosos (buffer
+// vazio): "network" quando o produtor espera pela rede, "producer" quando a
+// rede espera pelo produtor e "balanced" abaixo de 100ms de espera.
+func diagnoseBottleneck(producerBlockedMs, senderIdleMs int64) string {
+	switch {
+	case producerBlockedMs > senderIdleMs && producerBlockedMs > 100:
+		return "network"
+	case senderIdleMs > producerBlockedMs && senderIdleMs > 100:
+		return "producer"
+	default:
+		return "balanced"
+	}
+}
@@ -439,3 +439,103 @@ func TestAutoScaler_RunIdempotent(t *testing.T) {
 
 	<-done
 }
+
+// ---------------------------------------------------------------------------
+// Tests: server congestion (ControlServerLoad)
+// ---------------------------------------------------------------------------
+
+// TestAutoScaler_ServerCongestionHoldsScaleUp verifica que o scale-up não
+// avança enquanto o server reporta o disco como gargalo.
+func TestAutoScaler_ServerCongestionHoldsScaleUp(t *testing.T) {
+	d := newTestDispatcher(4)
+	activateStreamManually(d, 0, &mockConn{})
+	as := newTestAutoScaler(d, "efficiency", 2)
+	rates := RateSample{ProducerBps: 200, DrainBps: 100}
+
+	as.ObserveServerLoad(&protocol.ControlServerLoad{WriteLatency: 80000}) // 80ms por chunk
+	for i := 0; i < 3; i++ {
+		as.evaluateEfficiency(2.0, rates, d.ActiveStreams())
+	}
+	if as.scaleUpCount != 0 || d.ActiveStreams() != 1 {
+		t.Fatalf("expected scale-up held, got scaleUpCount=%d active=%d", as.scaleUpCount, d.ActiveStreams())
+	}
+	if snap := as.Snapshot(); snap.State != protocol.AutoScaleStateStable {
+		t.Errorf("expected state Stable while held, got %d", snap.State)
+	}
+
+	// Server descongestionado: a histerese volta a contar
+	as.ObserveServerLoad(&protocol.ControlServerLoad{WriteLatency: 2000, PendingBytes: 1024 * 1024})
+	as.evaluateEfficiency(2.0, rates, d.ActiveStreams())
+	if as.scaleUpCount != 1 {
+		t.Errorf("expected scaleUpCount=1 after congestion cleared, got %d", as.scaleUpCount)
+	}
+}
+
+// TestAutoScaler_ServerCongested verifica os limiares e o descarte de amostras antigas.
+func TestAutoScaler_ServerCongested(t *testing.T) {
+	as := newTestAutoScaler(newTestDispatcher(2), "adaptive", 1)
+
+	if congested, _ := as.serverCongested(); congested {
+		t.Fatal("expected not congested without samples")
+	}
+	for _, load := range []protocol.ControlServerLoad{
+		{WriteLatency: 50000},
+		{PendingBytes: serverCongestedPendingBytes},
+		{QueueDepth: serverCongestedQueueDepth},
+	} {
+		as.ObserveServerLoad(&load)
+		if congested, reason := as.serverCongested(); !congested || reason == "" {
+			t.Errorf("expected congested for %+v", load)
+		}
+	}
+
+	as.serverLoad.Store(&serverLoadSample{load: protocol.ControlServerLoad{QueueDepth: 10}, at: time.Now().Add(-2 * serverLoadMaxAge)})
+	if congested, _ := as.serverCongested(); congested {
+		t.Error("expected stale sample to be ignored")
+	}
+
+	// Modo adaptive: sem probe enquanto congestionado
+	as.ObserveServerLoad(&protocol.ControlServerLoad{QueueDepth: 10})
+	activateStreamManually(as.dispatcher, 0, &mockConn{})
+	as.evaluateAdaptive(1.0, RateSample{ProducerBps: 100, DrainBps: 100}, 1)
+	if as.probeState != probeIdle || as.scaleUpCount != 0 {
+		t.Errorf("expected no probe while server is congested, got state=%d scaleUpCount=%d", as.probeState, as.scaleUpCount)
+	}
+}
+
+// TestAutoScaler_ApplyStreamLimit verifica que o teto do server desativa os
+// streams excedentes (nunca o stream 0) e segura o scale-up até ser liberado.
+func TestAutoScaler_ApplyStreamLimit(t *testing.T) {
+	d := newTestDispatcher(4)
+	for i := 0; i < 4; i++ {
+		activateStreamManually(d, i, &mockConn{})
+	}
+	as := newTestAutoScaler(d, "efficiency", 1)
+
+	as.ApplyStreamLimit(&protocol.ControlStreamLimit{MaxStreams: 2})
+	if d.ActiveStreams() != 2 || d.StreamLimit() != 2 {
+		t.Fatalf("expected 2 active streams under limit 2, got active=%d limit=%d", d.ActiveStreams(), d.StreamLimit())
+	}
+	if !d.streams[0].active.Load() || !d.streams[1].active.Load() || d.streams[3].active.Load() {
+		t.Error("expected the highest-index streams to be parked")
+	}
+
+	as.scaleUp("test")
+	if d.ActiveStreams() != 2 {
+		t.Errorf("expected scale-up capped at limit, got %d active", d.ActiveStreams())
+	}
+	if err := d.ActivateStream(2); err == nil {
+		t.Error("expected ActivateStream to refuse streams above the limit")
+	}
+
+	as.ApplyStreamLimit(&protocol.ControlStreamLimit{MaxStreams: 1})
+	if d.ActiveStreams() != 1 || !d.streams[0].active.Load() {
+		t.Errorf("expected only stream 0 active under limit 1, got %d", d.ActiveStreams())
+	}
+
+	// Teto igual ao MaxStreams libera o scale-up
+	as.ApplyStreamLimit(&protocol.ControlStreamLimit{MaxStreams: 4})
+	if d.StreamLimit() != 4 || d.ActiveStreams() != 1 {
+		t.Errorf("expected limit lifted without reactivating streams, got limit=%d active=%d", d.StreamLimit(), d.ActiveStreams())
+	}
+}
@@ -7,6 +7,7 @@ package agent
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -16,7 +17,6 @@ import (
 	"time"
 
 	"github.com/nishisan-dev/n-backup/internal/config"
-	"github.com/nishisan-dev/n-backup/internal/pki"
 	"github.com/nishisan-dev/n-backup/internal/protocol"
 )
 
@@ -33,6 +33,25 @@ const singleStreamACKPollInterval = 1 * time.Second
 // MaxBackupDuration define o tempo máximo que um backup pode rodar antes de ser cancelado.
 const MaxBackupDuration = 24 * time.Hour
 
+// ErrBackupDeferred indica que o server adiou o backup no handshake (fora da
+// backup_window do storage ou storage abaixo de min_free_space/quota).
+// Não é retentado: a próxima execução agendada tentará novamente.
+var ErrBackupDeferred = errors.New("server deferred backup")
+
+// ErrAgentUnauthorized indica que o server recusou o agent (certificado revogado
+// ou CN fora de tls.allowed_agents). Não é retentado: exige ação do operador.
+var ErrAgentUnauthorized = errors.New("agent not authorized by server")
+
+// errResumeExhausted indica que o resume da sessão não foi possível nesta
+// execução (single-stream: offset fora do ring buffer ou tentativas esgotadas;
+// paralelo: streams mortos). A sessão continua no server e a próxima execução
+// a retoma (ver resume_state.go).
+var errResumeExhausted = errors.New("resume failed")
+
+// errResumeRejected indica que o server não conhece (ou não aceita mais) a
+// sessão enviada no RESUME.
+var errResumeRejected = errors.New("server rejected resume")
+
 // RunBackup executa uma sessão completa de backup com suporte a resume.
 //
 // Pipeline:
@@ -43,12 +62,18 @@ const MaxBackupDuration = 24 * time.Hour
 //
 // Se a conexão cair, o sender reconecta, envia RESUME,
 // e continua de onde parou (se o offset ainda estiver no buffer).
+//
+// Entries com local.path configurado não usam o server (ver runLocalBackup).
 func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, logger *slog.Logger, progress *ProgressReporter, job *BackupJob, controlCh *ControlChannel) error {
+	if entry.Local.Enabled() {
+		return runLocalBackup(ctx, cfg, entry, logger, progress, job)
+	}
+
 	logger = logger.With("backup", entry.Name, "storage", entry.Storage)
 	logger.Info("starting backup session", "server", cfg.Server.Address)
 
 	// Configura TLS
-	tlsCfg, err := pki.NewClientTLSConfig(cfg.TLS.CACert, cfg.TLS.ClientCert, cfg.TLS.ClientKey)
+	tlsCfg, err := loadClientTLS(cfg, logger)
 	if err != nil {
 		return fmt.Errorf("configuring TLS: %w", err)
 	}
@@ -60,16 +85,47 @@ func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.Backup
 	}
 	tlsCfg.ServerName = host
 
-	// Conecta ao server e faz handshake
-	conn, sessionID, compressionMode, handshakeRTT, err := initialConnect(ctx, cfg, entry, tlsCfg, logger)
+	// Sessão interrompida por um restart do agent: retoma do offset do server
+	// em vez de reenviar tudo
+	stateDir := cfg.Daemon.StateDir
+	conn, rec, start, resumed, err := resumeAfterRestart(ctx, cfg, entry, tlsCfg, logger, controlCh)
 	if err != nil {
 		return err
 	}
+	sessionID, compressionMode, version := rec.SessionID, rec.Compression, rec.Version
+	window := protocol.SACKWindow{Interval: rec.SACKInterval, MaxInFlight: rec.MaxInFlight}
+	var handshakeRTT time.Duration
+	if !resumed {
+		// Conecta ao server e faz handshake
+		var controlRTT time.Duration
+		if controlCh != nil {
+			controlRTT = controlCh.RTT()
+		}
+		var ack *protocol.ACK
+		conn, ack, handshakeRTT, err = initialConnect(ctx, cfg, entry, tlsCfg, controlRTT, logger)
+		if err != nil {
+			return err
+		}
+		sessionID, compressionMode, window, version = ack.SessionID, ack.CompressionMode, *ack.Window, ack.Version
+		rec = resumeRecord{
+			SessionID:    sessionID,
+			Server:       cfg.Server.Address,
+			Storage:      entry.Storage,
+			Compression:  compressionMode,
+			SACKInterval: window.Interval,
+			MaxInFlight:  window.MaxInFlight,
+			Version:      version,
+			Fingerprint:  entryFingerprint(entry),
+			StartedAt:    time.Now(),
+		}
+	}
 
 	logger = logger.With("session", sessionID)
+	job.setSessionID(sessionID)
+	comp := newCompression(entry.Compression, compressionMode, logger)
 
 	// Persiste RTT do handshake no job para stats reporter
-	if job != nil {
+	if job != nil && !resumed {
 		job.mu.Lock()
 		if job.LastResult == nil {
 			job.LastResult = &BackupJobResult{}
@@ -80,63 +136,170 @@ func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.Backup
 
 	// Rota paralela: envia ParallelInit e delega para RunParallelBackup
 	if entry.Parallels > 0 {
-		logger.Info("handshake successful, starting parallel pipeline", "maxStreams", entry.Parallels)
-
-		// Envia extensão ParallelInit na conexão primária
-		chunkSize := uint32(cfg.Resume.ChunkSizeRaw)
-		if err := protocol.WriteParallelInit(conn, uint8(entry.Parallels), chunkSize); err != nil {
-			conn.Close()
-			return fmt.Errorf("writing ParallelInit: %w", err)
+		chunkSizeMax := chunkSizeMaxFor(cfg, version)
+		if chunkSizeMax < cfg.Resume.ChunkSizeMaxRaw {
+			// Server anterior ao v8 não recebe o chunk_size_max: o chunk
+			// adaptativo não passa do chunk_size
+			logger.Warn("server does not negotiate chunk_size_max, capping adaptive chunks at chunk_size",
+				"version", version, "chunk_size", cfg.Resume.ChunkSize)
+			capped := *cfg
+			capped.Resume.ChunkSizeMaxRaw = chunkSizeMax
+			cfg = &capped
+		}
+		if !resumed {
+			logger.Info("handshake successful, starting parallel pipeline", "maxStreams", entry.Parallels, "compressionWorkers", comp.workers(), "producerShards", max(1, entry.ProducerShards))
+			chunkSize := uint32(cfg.Resume.ChunkSizeRaw)
+			if err := initParallelSession(conn, version, entry.Parallels, chunkSize, uint32(chunkSizeMax)); err != nil {
+				conn.Close()
+				return err
+			}
+			rec.Parallels = entry.Parallels
+			rec.ChunkSize = chunkSize
+			rec.ChunkSizeMax = uint32(chunkSizeMax)
+			rec.AckedSeq, rec.AckedBytes = 0, 0
+			if err := saveResumeRecord(stateDir, entry.Name, rec); err != nil {
+				logger.Warn("failed to persist resume state", "error", err)
+			}
 		}
 
-		// Aguarda o ACK do servidor confirmando que a sessão foi registrada,
-		// prevenindo a race condition onde o ParallelJoin chega antes do handshake.
-		initACK, err := protocol.ReadParallelInitACK(conn)
-		if err != nil {
-			conn.Close()
-			return fmt.Errorf("reading ParallelInit ACK: %w", err)
+		// Prefixo confirmado por ChunkSACK, para conferir o checkpoint do
+		// server num resume após restart (ver readParallelResume)
+		saveWatermark := func(seq uint32, bytes int64) {
+			rec.AckedSeq, rec.AckedBytes = seq, bytes
+			if err := saveResumeRecord(stateDir, entry.Name, rec); err != nil {
+				logger.Warn("failed to persist resume state", "error", err)
+			}
 		}
-		if initACK.Status != protocol.ParallelInitStatusOK {
-			conn.Close()
-			return fmt.Errorf("server rejected parallel init (status: %d)", initACK.Status)
+		err = runParallelBackup(ctx, cfg, entry, conn, sessionID, version, start, saveWatermark, comp, tlsCfg, logger, progress, job, controlCh)
+		if keepResumeRecord(ctx, err) {
+			logger.Info("backup interrupted, session kept for resume", "error", err)
+		} else if clearErr := clearResumeRecord(stateDir, entry.Name); clearErr != nil {
+			logger.Warn("failed to clear resume state", "error", clearErr)
+		}
+		return err
+	}
+
+	if !resumed {
+		if err := saveResumeRecord(stateDir, entry.Name, rec); err != nil {
+			logger.Warn("failed to persist resume state", "error", err)
 		}
+	}
+	err = runSingleBackup(ctx, cfg, entry, conn, sessionID, version, start.Offset, window, comp, tlsCfg, logger, progress, job, controlCh)
+	if keepResumeRecord(ctx, err) {
+		logger.Info("backup interrupted, session kept for resume", "error", err)
+	} else if clearErr := clearResumeRecord(stateDir, entry.Name); clearErr != nil {
+		logger.Warn("failed to clear resume state", "error", clearErr)
+	}
+	return err
+}
 
-		return runParallelBackup(ctx, cfg, entry, conn, sessionID, compressionMode, tlsCfg, logger, progress, job, controlCh)
+// keepResumeRecord informa se a sessão continua retomável depois que o
+// backup retornou err: interrupção (shutdown/cancel), resume esgotado ou,
+// no paralelo, streams mortos. As demais falhas recomeçam do zero na próxima
+// execução.
+func keepResumeRecord(ctx context.Context, err error) bool {
+	return err != nil && (ctx.Err() != nil || errors.Is(err, errResumeExhausted) || errors.Is(err, ErrAllStreamsDead))
+}
+
+// chunkSizeMaxFor retorna o maior chunk anunciado no ParallelInit: servers
+// anteriores ao handshake v8 não recebem o chunk_size_max e aceitam só até o
+// chunk_size.
+func chunkSizeMaxFor(cfg *config.AgentConfig, version byte) int64 {
+	if version < protocol.HandshakeVersionChunkRange {
+		return min(cfg.Resume.ChunkSizeMaxRaw, cfg.Resume.ChunkSizeRaw)
 	}
+	return cfg.Resume.ChunkSizeMaxRaw
+}
 
-	logger.Info("handshake successful, starting resumable pipeline")
+// reportProgress envia o progresso do backup ao server pelo canal de controle
+// (ControlProgress da sessão sessionID a cada keepalive): objetos enviados,
+// contados pelo callback onObject do Stream, e o total, calculado por um
+// PreScan em goroutine para não atrasar o início do envio. version é a versão
+// negociada no handshake (ver ControlChannel.SetProgressProvider). Sem canal
+// de controle, onObject é nil. stop remove o provider ao fim do backup.
+func reportProgress(ctx context.Context, controlCh *ControlChannel, entry config.BackupEntry, sessionID string, version byte, logger *slog.Logger) (onObject func(), stop func()) {
+	if controlCh == nil {
+		return nil, func() {}
+	}
 
-	// Envia byte discriminador 0x00 para sinalizar single-stream ao server
-	// (ParallelInit começa com MaxStreams >= 1, então 0x00 = single-stream)
-	conn.SetWriteDeadline(time.Now().Add(writeDeadline))
-	if _, err := conn.Write([]byte{0x00}); err != nil {
-		conn.Close()
-		return fmt.Errorf("writing single-stream marker: %w", err)
+	var totalObj, sentObj atomic.Uint32
+	var walkDone atomic.Int32
+
+	go func() {
+		preScanScanner := NewEntryScanner(entry)
+		stats, err := preScanScanner.PreScan(ctx)
+		if err != nil {
+			logger.Warn("pre-scan for progress failed", "error", err)
+			return
+		}
+		totalObj.Store(uint32(stats.TotalObjects))
+		walkDone.Store(1)
+		logger.Info("pre-scan for progress complete", "total_objects", stats.TotalObjects)
+	}()
+
+	controlCh.SetProgressProvider(sessionID, version, func() (uint32, uint32, bool) {
+		return totalObj.Load(), sentObj.Load(), walkDone.Load() != 0
+	})
+	return func() { sentObj.Add(1) }, func() { controlCh.SetProgressProvider(sessionID, version, nil) }
+}
+
+// runSingleBackup executa o pipeline single-stream sobre conn. startOffset > 0
+// indica uma sessão retomada após restart do agent: o stream é regenerado do
+// início, mas os primeiros startOffset bytes (já gravados pelo server) são
+// descartados e o envio começa nesse offset, sem o byte discriminador.
+// window é a janela de SACK concedida pelo server: o sender não mantém mais
+// de window.MaxInFlight bytes sem confirmação (0 = limitado pelo ring buffer).
+func runSingleBackup(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, conn net.Conn, sessionID string, version byte, startOffset int64, window protocol.SACKWindow, comp Compression, tlsCfg *tls.Config, logger *slog.Logger, progress *ProgressReporter, job *BackupJob, controlCh *ControlChannel) error {
+	if startOffset > 0 {
+		logger.Info("resuming session interrupted by agent restart", "server_offset", startOffset, "compressionWorkers", comp.workers())
+	} else {
+		logger.Info("handshake successful, starting resumable pipeline", "compressionWorkers", comp.workers(), "producerShards", max(1, entry.ProducerShards))
+
+		// Envia byte discriminador 0x00 para sinalizar single-stream ao server
+		// (ParallelInit começa com MaxStreams >= 1, então 0x00 = single-stream)
+		conn.SetWriteDeadline(time.Now().Add(writeDeadline))
+		if _, err := conn.Write([]byte{0x00}); err != nil {
+			conn.Close()
+			return fmt.Errorf("writing single-stream marker: %w", err)
+		}
 	}
 
 	// Ring buffer para backpressure e resume
-	rb := NewRingBuffer(cfg.Resume.BufferSizeRaw)
+	rb := NewRingBufferAt(cfg.Resume.BufferSizeRaw, startOffset)
 
 	// Pipeline: scanner → tar.gz → ring buffer (produtor)
-	sources := make([]string, len(entry.Sources))
-	for i, s := range entry.Sources {
-		sources[i] = s.Path
+	scanner := NewEntryScanner(entry)
+	mf, err := newEntryManifest(entry, "", job.MissingSources())
+	if err != nil {
+		conn.Close()
+		return err
 	}
-	scanner := NewScanner(sources, entry.Exclude)
+	defer mf.Remove()
 
 	var producerResult *StreamResult
 	var producerErr error
 	producerDone := make(chan struct{})
 
+	// Progresso pelo canal de controle: além da WebUI, mantém viva no server
+	// a conexão de dados enquanto o produtor demora a emitir bytes
+	onObject, stopProgress := reportProgress(ctx, controlCh, entry, sessionID, version, logger)
+	defer stopProgress()
+
+	var dest io.Writer = rb
+	if startOffset > 0 {
+		dest = &skipWriter{w: rb, skip: startOffset}
+	}
 	go func() {
 		defer close(producerDone)
-		producerResult, producerErr = Stream(ctx, scanner, rb, progress, nil, compressionMode, entry.BandwidthLimitRaw)
+		producerResult, producerErr = Stream(ctx, scanner, job.output(ctx, dest), progress, onObject, comp, entry.BandwidthLimitRaw, entry.MaxSizeRaw, mf)
 		rb.Close() // sinaliza EOF para o sender
 	}()
 
 	// Sender + ACK reader loop (com resume)
-	sendOffset := int64(0)
+	sendOffset := startOffset
 	var sendMu sync.Mutex
+	stopSender := context.CancelFunc(func() {})
+	defer func() { stopSender() }()
 
 	for attempt := 0; ; attempt++ {
 		// Per-attempt timeout: cada retry tem o timeout integral (MaxBackupDuration).
@@ -163,8 +326,8 @@ func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.Backup
 			currentOffset := sendOffset
 			sendMu.Unlock()
 
-			if currentOffset > 0 && !rb.Contains(currentOffset) {
-				return fmt.Errorf("resume failed: offset %d no longer in ring buffer (tail=%d), restart required", currentOffset, rb.Tail())
+			if currentOffset > startOffset && !rb.Contains(currentOffset) {
+				return fmt.Errorf("%w: offset %d no longer in ring buffer (tail=%d), restart required", errResumeExhausted, currentOffset, rb.Tail())
 			}
 
 			// Reconecta e resume
@@ -173,7 +336,7 @@ func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.Backup
 			if resumeErr != nil {
 				logger.Warn("resume connect failed", "error", resumeErr)
 				if attempt >= maxResumeAttempts {
-					return fmt.Errorf("max resume attempts reached: %w", resumeErr)
+					return fmt.Errorf("%w: max resume attempts reached: %w", errResumeExhausted, resumeErr)
 				}
 				continue
 			}
@@ -192,6 +355,10 @@ func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.Backup
 		// Sender: lê do ring buffer e escreve na conn
 		senderErr := make(chan error, 1)
 		senderDone := make(chan struct{})
+		// Encerra a espera por janela do sender da tentativa anterior
+		stopSender()
+		senderCtx, senderCancel := context.WithCancel(attemptCtx)
+		stopSender = senderCancel
 
 		go func() {
 			defer close(senderDone)
@@ -201,7 +368,21 @@ func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.Backup
 				offset := sendOffset
 				sendMu.Unlock()
 
-				n, err := rb.ReadAt(offset, buf)
+				chunk := buf
+				if window.MaxInFlight > 0 {
+					// Janela de SACK: espera o server confirmar antes de
+					// ultrapassar MaxInFlight bytes sem confirmação
+					allowed, err := rb.WaitInFlight(senderCtx, offset, int64(window.MaxInFlight))
+					if err != nil {
+						senderErr <- err
+						return
+					}
+					if allowed < int64(len(chunk)) {
+						chunk = buf[:allowed]
+					}
+				}
+
+				n, err := rb.ReadAt(offset, chunk)
 				if err != nil {
 					if err == ErrBufferClosed {
 						senderErr <- nil
@@ -211,7 +392,7 @@ func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.Backup
 					return
 				}
 
-				if _, err := conn.Write(buf[:n]); err != nil {
+				if _, err := conn.Write(chunk[:n]); err != nil {
 					senderErr <- fmt.Errorf("writing to conn: %w", err)
 					return
 				}
@@ -285,8 +466,20 @@ func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.Backup
 		<-producerDone
 		if producerErr != nil {
 			conn.Close()
+			handleMaxSizeAbort(producerErr, job, controlCh, sessionID, logger)
 			return fmt.Errorf("pipeline error: %w", producerErr)
 		}
+		if err := checkAssertions(entry.Assertions, producerResult, scanner); err != nil {
+			conn.Close()
+			discardSession(controlCh, sessionID, logger)
+			return err
+		}
+		if int64(producerResult.Size) < startOffset {
+			// Sources mudaram desde a interrupção: o server tem bytes que não existem mais
+			conn.Close()
+			discardSession(controlCh, sessionID, logger)
+			return fmt.Errorf("regenerated stream has %d bytes, less than the resumed offset %d: sources changed since the interruption", producerResult.Size, startOffset)
+		}
 
 		close(ackStop)
 		if err := <-ackDone; err != nil {
@@ -296,6 +489,10 @@ func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.Backup
 		}
 		conn.SetReadDeadline(time.Time{})
 
+		if producerResult.Entries == 0 {
+			logger.Warn("sources produced no entries, sending empty backup")
+		}
+
 		// Envia trailer (checksum + size)
 		logger.Info("data transfer complete",
 			"bytes", producerResult.Size,
@@ -304,6 +501,10 @@ func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.Backup
 
 		trailerStart := time.Now()
 		conn.SetWriteDeadline(time.Now().Add(writeDeadline))
+		if err := writeManifestFrame(conn, mf, producerResult); err != nil {
+			conn.Close()
+			return fmt.Errorf("writing file manifest: %w", err)
+		}
 		if err := protocol.WriteTrailer(conn, producerResult.Checksum, producerResult.Size); err != nil {
 			conn.Close()
 			return fmt.Errorf("writing trailer: %w", err)
@@ -326,6 +527,7 @@ func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.Backup
 			logger.Info("backup completed successfully",
 				"bytes", producerResult.Size,
 			)
+			job.setRunResult(producerResult)
 			return nil
 		case protocol.FinalStatusChecksumMismatch:
 			return fmt.Errorf("server reported checksum mismatch")
@@ -337,49 +539,123 @@ func RunBackup(ctx context.Context, cfg *config.AgentConfig, entry config.Backup
 	}
 }
 
-// initialConnect realiza a conexão inicial e handshake.
-// Retorna a conexão, sessionID e o RTT do handshake.
-func initialConnect(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, tlsCfg *tls.Config, logger *slog.Logger) (net.Conn, string, byte, time.Duration, error) {
-	conn, err := dialWithContext(ctx, cfg.Server.Address, tlsCfg)
+// initialConnect realiza a conexão inicial e o handshake, pedindo a janela
+// de SACK calculada a partir de rtt (RTT do control channel; 0 = usa o tempo
+// de conexão). Retorna a conexão, o ACK (sessionID, compressão, versão
+// negociada e a janela concedida) e o RTT do handshake.
+//
+// O handshake anuncia a maior versão deste build (MaxProtocolVersion) e o
+// server responde com a versão negociada, sem reconexão: um server mais
+// antigo fica na sua, e um v6 nem a informa. Se o server só aceita versões
+// mais novas (StatusVersionMismatch), retorna o *protocol.VersionMismatchError,
+// que indica o lado a atualizar.
+func initialConnect(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, tlsCfg *tls.Config, rtt time.Duration, logger *slog.Logger) (net.Conn, *protocol.ACK, time.Duration, error) {
+	return connectHandshake(ctx, cfg, entry, tlsCfg, rtt, protocol.MaxProtocolVersion, logger)
+}
+
+// connectHandshake conecta e faz o handshake anunciando version. A versão
+// negociada vem no ACK: em v7+ o agent pede a janela de SACK logo após o ACK
+// GO; um server v6 não a negocia e usa a janela default.
+func connectHandshake(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, tlsCfg *tls.Config, rtt time.Duration, version byte, logger *slog.Logger) (net.Conn, *protocol.ACK, time.Duration, error) {
+	dialStart := time.Now()
+	tlsConn, err := dialWithContext(ctx, cfg, cfg.Server.Address, tlsCfg)
+	if rtt <= 0 {
+		// TCP + TLS levam mais de um RTT: a estimativa só aumenta a janela
+		rtt = time.Since(dialStart)
+	}
 	if err != nil {
-		return nil, "", 0, 0, fmt.Errorf("connecting to server: %w", err)
+		return nil, nil, 0, fmt.Errorf("connecting to server: %w", err)
 	}
+	conn := traceConn(cfg, entry, tlsConn, "primary")
 
 	logger.Info("connected to server", "address", cfg.Server.Address)
 
+	window, bdp := sackWindowFor(cfg.Resume, entry.BandwidthLimitRaw, rtt)
+	if bdp > cfg.Resume.BufferSizeRaw {
+		logger.Warn("resume.buffer_size is smaller than the bandwidth-delay product, throughput will be limited",
+			"buffer_size", cfg.Resume.BufferSize, "bdp_bytes", bdp, "rtt", rtt)
+	}
+
 	// Handshake com medição de RTT
 	handshakeStart := time.Now()
 	// Envia handshake
-	agentVersion := Version
-	if err := protocol.WriteHandshake(conn, cfg.Agent.Name, entry.Storage, entry.Name, agentVersion); err != nil {
+	ack, err := writeHandshake(conn, version, cfg.Agent.Name, entry.Storage, entry.Name, Version)
+	handshakeRTT := time.Since(handshakeStart)
+	if err != nil {
 		conn.Close()
-		return nil, "", 0, 0, fmt.Errorf("writing handshake: %w", err)
+		return nil, nil, 0, err
 	}
 
-	ack, err := protocol.ReadACK(conn)
-	handshakeRTT := time.Since(handshakeStart)
-	if err != nil {
+	if ack.Status == protocol.StatusVersionMismatch && ack.Versions != nil {
+		conn.Close()
+		return nil, nil, 0, &protocol.VersionMismatchError{Agent: version, Server: *ack.Versions}
+	}
+	logger.Info("handshake ACK received", "handshake_rtt", handshakeRTT, "version", ack.Version)
+
+	if ack.Status == protocol.StatusOutsideWindow || ack.Status == protocol.StatusLowSpace {
+		conn.Close()
+		return nil, nil, 0, fmt.Errorf("%w: %s", ErrBackupDeferred, ack.Message)
+	}
+
+	if ack.Status == protocol.StatusUnauthorized {
 		conn.Close()
-		return nil, "", 0, 0, fmt.Errorf("reading handshake ACK: %w", err)
+		return nil, nil, 0, fmt.Errorf("%w: %s", ErrAgentUnauthorized, ack.Message)
 	}
 
-	logger.Info("handshake ACK received", "handshake_rtt", handshakeRTT)
+	if ack.Status == protocol.StatusReadOnly {
+		conn.Close()
+		return nil, nil, 0, fmt.Errorf("server rejected backup: storage is read-only: %s", ack.Message)
+	}
 
 	if ack.Status != protocol.StatusGo {
 		conn.Close()
-		return nil, "", 0, 0, fmt.Errorf("server rejected backup: status=%d message=%q", ack.Status, ack.Message)
+		return nil, nil, 0, fmt.Errorf("server rejected backup: status=%d message=%q", ack.Status, ack.Message)
+	}
+	traceIdentify(conn, ack.SessionID)
+
+	// Handshake v7+: pede a janela de SACK e aguarda a concedida. Em v6 o
+	// server usa o intervalo default
+	ack.Window = &protocol.SACKWindow{Interval: protocol.DefaultSACKInterval}
+	if ack.Version >= protocol.HandshakeVersionSACKWindow {
+		if err := protocol.WriteSACKWindow(conn, window); err != nil {
+			conn.Close()
+			return nil, nil, 0, err
+		}
+		if ack.Window, err = protocol.ReadSACKWindow(conn); err != nil {
+			conn.Close()
+			return nil, nil, 0, fmt.Errorf("reading sack window: %w", err)
+		}
 	}
+	logger.Info("sack window negotiated", "sack_interval", ack.Window.Interval, "max_inflight", ack.Window.MaxInFlight)
 
-	return conn, ack.SessionID, ack.CompressionMode, handshakeRTT, nil
+	return conn, ack, handshakeRTT, nil
+}
+
+// writeHandshake envia o handshake anunciando version e lê o ACK, que traz a
+// versão negociada (nunca acima da anunciada).
+func writeHandshake(conn net.Conn, version byte, agentName, storage, backup, clientVersion string) (*protocol.ACK, error) {
+	if err := protocol.WriteHandshakeVersion(conn, version, agentName, storage, backup, clientVersion); err != nil {
+		return nil, fmt.Errorf("writing handshake: %w", err)
+	}
+	ack, err := protocol.ReadACK(conn)
+	if err != nil {
+		return nil, fmt.Errorf("reading handshake ACK: %w", err)
+	}
+	if ack.Version > version {
+		return nil, fmt.Errorf("server negotiated protocol v%d above the announced v%d", ack.Version, version)
+	}
+	return ack, nil
 }
 
 // resumeConnect reconecta e envia RESUME para o server.
 // Retorna a conexão, o lastOffset do server e o RTT do resume.
 func resumeConnect(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, sessionID string, tlsCfg *tls.Config, logger *slog.Logger) (net.Conn, int64, error) {
-	conn, err := dialWithContext(ctx, cfg.Server.Address, tlsCfg)
+	tlsConn, err := dialWithContext(ctx, cfg, cfg.Server.Address, tlsCfg)
 	if err != nil {
 		return nil, 0, fmt.Errorf("reconnecting: %w", err)
 	}
+	conn := traceConn(cfg, entry, tlsConn, "resume")
+	traceIdentify(conn, sessionID)
 
 	// Envia RESUME com medição de RTT
 	resumeStart := time.Now()
@@ -399,16 +675,28 @@ func resumeConnect(ctx context.Context, cfg *config.AgentConfig, entry config.Ba
 
 	if rACK.Status != protocol.ResumeStatusOK {
 		conn.Close()
-		return nil, 0, fmt.Errorf("server rejected resume: status=%d", rACK.Status)
+		return nil, 0, fmt.Errorf("%w: status=%d", errResumeRejected, rACK.Status)
 	}
 
 	return conn, int64(rACK.LastOffset), nil
 }
 
 // dialWithContext conecta via TLS respeitando o contexto para cancelamento.
-func dialWithContext(ctx context.Context, address string, tlsCfg *tls.Config) (*tls.Conn, error) {
-	dialer := &net.Dialer{}
-	conn, err := dialer.DialContext(ctx, "tcp", address)
+// Com tls.auth psk, responde também ao desafio PSK do server. Com
+// server.transport: quic, a conexão é um stream QUIC.
+func dialWithContext(ctx context.Context, cfg *config.AgentConfig, address string, tlsCfg *tls.Config) (net.Conn, error) {
+	psk, err := loadClientPSK(cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Server.Transport {
+	case config.TransportQUIC:
+		return dialQUIC(ctx, address, cfg.Server.Prefer, tlsCfg, psk)
+	case config.TransportUnix:
+		return dialUnix(ctx, address)
+	}
+
+	conn, err := dialTCP(ctx, cfg.Server, address)
 	if err != nil {
 		return nil, err
 	}
@@ -428,14 +716,53 @@ func dialWithContext(ctx context.Context, address string, tlsCfg *tls.Config) (*
 	// Remove deadline após handshake (o stream não deve ter timeout fixo)
 	tlsConn.SetDeadline(time.Time{})
 
+	if err := psk.authenticate(tlsConn); err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+
 	return tlsConn, nil
 }
 
+// initParallelSession envia a extensão ParallelInit na conexão primária e
+// aguarda o ACK do servidor confirmando que a sessão foi registrada,
+// prevenindo a race condition onde o ParallelJoin chega antes do handshake.
+// A partir do handshake v8 anuncia também chunkSizeMax, o maior chunk que o
+// chunk adaptativo pode enviar; antes disso o server só aceita até chunkSize.
+func initParallelSession(conn net.Conn, version byte, parallels int, chunkSize, chunkSizeMax uint32) error {
+	var err error
+	if version >= protocol.HandshakeVersionChunkRange {
+		err = protocol.WriteParallelInitRange(conn, uint8(parallels), chunkSize, chunkSizeMax)
+	} else {
+		err = protocol.WriteParallelInit(conn, uint8(parallels), chunkSize)
+	}
+	if err != nil {
+		return fmt.Errorf("writing ParallelInit: %w", err)
+	}
+	initACK, err := protocol.ReadParallelInitACK(conn)
+	if err != nil {
+		return fmt.Errorf("reading ParallelInit ACK: %w", err)
+	}
+	if initACK.Status != protocol.ParallelInitStatusOK {
+		return fmt.Errorf("server rejected parallel init (status: %d)", initACK.Status)
+	}
+	return nil
+}
+
 // runParallelBackup executa o pipeline de backup com streams paralelos.
 // A conn primária é usada apenas como canal de controle (Trailer + FinalACK).
 // Todas as N streams de dados conectam ao server via ParallelJoin.
-func runParallelBackup(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, conn net.Conn, sessionID string, compressionMode byte, tlsCfg *tls.Config, logger *slog.Logger, progress *ProgressReporter, job *BackupJob, controlCh *ControlChannel) error {
+// start != zero indica uma sessão retomada após restart do agent: o stream é
+// regenerado do início, os primeiros start.Offset bytes (já montados pelo
+// server) são descartados e os chunks são numerados a partir de
+// start.NextSeq. saveWatermark recebe periodicamente o prefixo confirmado por
+// ChunkSACK (ver trackWatermark).
+func runParallelBackup(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, conn net.Conn, sessionID string, version byte, start resumePoint, saveWatermark func(seq uint32, bytes int64), comp Compression, tlsCfg *tls.Config, logger *slog.Logger, progress *ProgressReporter, job *BackupJob, controlCh *ControlChannel) error {
 	defer conn.Close()
+	if start != (resumePoint{}) {
+		logger.Info("resuming parallel session interrupted by agent restart", "server_offset", start.Offset,
+			"next_seq", start.NextSeq, "maxStreams", entry.Parallels, "compressionWorkers", comp.workers())
+	}
 
 	// Callback para atualizar o progress reporter e job metrics com streams ativos
 	var onStreamChange func(active, max int)
@@ -450,29 +777,19 @@ func runParallelBackup(ctx context.Context, cfg *config.AgentConfig, entry confi
 	}
 
 	// Cria dispatcher — conn primária é control-only (não usada para dados)
-	dispatcher := NewDispatcher(DispatcherConfig{
-		MaxStreams:     entry.Parallels,
-		BufferSize:     cfg.Resume.BufferSizeRaw,
-		ChunkSize:      int(cfg.Resume.ChunkSizeRaw),
-		SessionID:      sessionID,
-		ServerAddr:     cfg.Server.Address,
-		TLSConfig:      tlsCfg,
-		AgentName:      cfg.Agent.Name,
-		StorageName:    entry.Storage,
-		Logger:         logger,
-		PrimaryConn:    conn,
-		OnStreamChange: onStreamChange,
-		ChunksPerCycle: entry.PortRotation.EffectiveChunksPerCycle(),
-		SACKTimeoutFn: func() time.Duration {
-			rtt := controlCh.RTT()
-			timeout := rtt * 3
-			if timeout < sackTimeoutMin {
-				timeout = sackTimeoutMin
-			}
-			return timeout
-		},
-	})
+	dispatcher, err := newParallelDispatcher(cfg, entry, conn, sessionID, start.NextSeq, tlsCfg, logger, controlCh, onStreamChange)
+	if err != nil {
+		return err
+	}
 	defer dispatcher.Close()
+	defer dispatcher.closeMux()
+	defer trackWatermark(dispatcher, start, saveWatermark)()
+	if progress != nil {
+		progress.SetStreamStats(dispatcher.TransferStats)
+	}
+	// Cancelamento (ControlAbort, admin cancel, shutdown) para os senders na
+	// hora, em vez de esperar o drain de um buffer que o server não quer mais
+	defer context.AfterFunc(ctx, dispatcher.Abort)()
 
 	// Ativa todas as N streams via ParallelJoin (incluindo stream 0).
 	// Cada stream tem seu próprio sender com retry + ACK reader.
@@ -504,54 +821,35 @@ func runParallelBackup(ctx context.Context, cfg *config.AgentConfig, entry confi
 		Enabled:        &scalerEnabled,
 	})
 	go scaler.Run(scalerCtx)
+	if controlCh != nil {
+		controlCh.SetServerLoadHandler(sessionID, scaler.ObserveServerLoad)
+		defer controlCh.SetServerLoadHandler(sessionID, nil)
+		controlCh.SetStreamLimitHandler(sessionID, scaler.ApplyStreamLimit)
+		defer controlCh.SetStreamLimitHandler(sessionID, nil)
+	}
+
+	// Chunk adaptativo: só com faixa configurada em resume.chunk_size_min/max
+	if cfg.Resume.ChunkSizeMinRaw < cfg.Resume.ChunkSizeMaxRaw {
+		go newChunkTuner(dispatcher, logger).Run(scalerCtx)
+	}
 
 	// Pipeline: scanner → tar.gz → dispatcher (produtor)
-	sources := make([]string, len(entry.Sources))
-	for i, s := range entry.Sources {
-		sources[i] = s.Path
+	scanner := NewEntryScanner(entry)
+	mf, err := newEntryManifest(entry, "", job.MissingSources())
+	if err != nil {
+		return err
 	}
-	scanner := NewScanner(sources, entry.Exclude)
+	defer mf.Remove()
 
 	var producerResult *StreamResult
 	var producerErr error
 	producerDone := make(chan struct{})
 
-	// Contadores atômicos para progresso enviado ao server via ControlChannel.
-	// O PreScan roda em goroutine paralela para não bloquear o início dos streams.
-	var totalObj, sentObj atomic.Uint32
-	var walkDone atomic.Int32
-
-	// onObject callback: incrementa sentObj a cada objeto processado pelo Stream()
-	var onObject func()
+	onObject, stopProgress := reportProgress(ctx, controlCh, entry, sessionID, version, logger)
+	defer stopProgress()
 
 	if controlCh != nil {
-		onObject = func() {
-			sentObj.Add(1)
-		}
-
-		// PreScan em goroutine para calcular total de objetos sem bloquear o backup
-		go func() {
-			preScanSources := make([]string, len(entry.Sources))
-			for i, s := range entry.Sources {
-				preScanSources[i] = s.Path
-			}
-			preScanScanner := NewScanner(preScanSources, entry.Exclude)
-			stats, err := preScanScanner.PreScan(ctx)
-			if err != nil {
-				logger.Warn("pre-scan for progress failed", "error", err)
-				return
-			}
-			totalObj.Store(uint32(stats.TotalObjects))
-			walkDone.Store(1)
-			logger.Info("pre-scan for progress complete", "total_objects", stats.TotalObjects)
-		}()
-
-		controlCh.SetProgressProvider(func() (uint32, uint32, bool) {
-			return totalObj.Load(), sentObj.Load(), walkDone.Load() != 0
-		})
-		defer controlCh.SetProgressProvider(nil)
-
-		controlCh.SetAutoScaleStatsProvider(func() *protocol.ControlAutoScaleStats {
+		controlCh.SetAutoScaleStatsProvider(sessionID, version, func() *protocol.ControlAutoScaleStats {
 			snap := scaler.Snapshot()
 			probeActive := uint8(0)
 			if snap.ProbeActive {
@@ -567,13 +865,16 @@ func runParallelBackup(ctx context.Context, cfg *config.AgentConfig, entry confi
 				ProbeActive:   probeActive,
 			}
 		})
-		defer controlCh.SetAutoScaleStatsProvider(nil)
-
+		defer controlCh.SetAutoScaleStatsProvider(sessionID, version, nil)
 	}
 
+	var dest io.Writer = dispatcher
+	if start.Offset > 0 {
+		dest = &skipWriter{w: dispatcher, skip: start.Offset}
+	}
 	go func() {
 		defer close(producerDone)
-		producerResult, producerErr = Stream(ctx, scanner, dispatcher, progress, onObject, compressionMode, entry.BandwidthLimitRaw)
+		producerResult, producerErr = Stream(ctx, scanner, job.output(ctx, dest), progress, onObject, comp, entry.BandwidthLimitRaw, entry.MaxSizeRaw, mf)
 		dispatcher.Flush() // emite chunk parcial pendente no buffer de acumulação
 		dispatcher.Close() // sinaliza EOF para todos os senders
 	}()
@@ -604,17 +905,50 @@ func runParallelBackup(ctx context.Context, cfg *config.AgentConfig, entry confi
 
 	scalerCancel()
 
+	if errors.Is(producerErr, ErrMaxSizeExceeded) {
+		handleMaxSizeAbort(producerErr, job, controlCh, sessionID, logger)
+		return fmt.Errorf("parallel pipeline error: %w", producerErr)
+	}
 	if sendersErr != nil {
-		return fmt.Errorf("parallel sender error: %w", sendersErr)
+		// Streams mortos deixam a sessão no server, retomável do checkpoint
+		return fmt.Errorf("%w: parallel sender error: %w", errResumeExhausted, sendersErr)
 	}
 	if producerErr != nil {
 		return fmt.Errorf("parallel pipeline error: %w", producerErr)
 	}
+	if err := checkAssertions(entry.Assertions, producerResult, scanner); err != nil {
+		discardSession(controlCh, sessionID, logger)
+		return err
+	}
+
+	// Totais por stream de bytes enviados vs retransmitidos. Enviados antes do
+	// IngestionDone para que o server os registre no histórico da sessão.
+	transferStats := dispatcher.TransferStats()
+	job.setRunStreams(transferStats)
+	var sentTotal, retransmitTotal uint64
+	for _, s := range transferStats {
+		sentTotal += s.BytesSent
+		retransmitTotal += s.RetransmitBytes
+	}
+	if retransmitTotal > 0 {
+		logger.Info("parallel transfer retransmit overhead",
+			"bytes_sent", sentTotal,
+			"retransmit_bytes", retransmitTotal,
+			"overhead_pct", fmt.Sprintf("%.2f", float64(retransmitTotal)*100/float64(sentTotal)),
+		)
+	}
 
 	// Sinaliza ao server que toda a ingestão foi completada com sucesso.
 	// Neste ponto, todos os streams já drenaram o buffer até o último ACK.
 	// O server espera este frame antes de prosseguir com Finalize().
 	if controlCh != nil {
+		// Resumo é best-effort: falha aqui não compromete o backup.
+		if err := controlCh.SendSessionSummary(protocol.ControlSessionSummary{
+			SessionID: sessionID,
+			Streams:   transferStats,
+		}); err != nil {
+			logger.Warn("failed to send session transfer summary", "error", err)
+		}
 		if err := controlCh.SendIngestionDone(sessionID); err != nil {
 			logger.Error("failed to send ControlIngestionDone — server may timeout waiting", "error", err)
 			return fmt.Errorf("signaling ingestion done: %w", err)
@@ -622,9 +956,16 @@ func runParallelBackup(ctx context.Context, cfg *config.AgentConfig, entry confi
 		logger.Info("sent ControlIngestionDone to server", "session", sessionID)
 	}
 
+	if producerResult.Entries == 0 {
+		logger.Warn("sources produced no entries, sending empty backup")
+	}
+
 	// Envia Trailer direto pela conn primária (sem ChunkHeader framing).
 	// A conn primária nunca enviou dados, então não há conflito de framing.
 	trailerStart := time.Now()
+	if err := writeManifestFrame(conn, mf, producerResult); err != nil {
+		return fmt.Errorf("writing file manifest: %w", err)
+	}
 	if err := protocol.WriteTrailer(conn, producerResult.Checksum, producerResult.Size); err != nil {
 		return fmt.Errorf("writing trailer: %w", err)
 	}
@@ -644,6 +985,7 @@ func runParallelBackup(ctx context.Context, cfg *config.AgentConfig, entry confi
 			"bytes", producerResult.Size,
 			"streams", entry.Parallels,
 		)
+		job.setRunResult(producerResult)
 		return nil
 	case protocol.FinalStatusChecksumMismatch:
 		return fmt.Errorf("server reported checksum mismatch")
@@ -654,6 +996,46 @@ func runParallelBackup(ctx context.Context, cfg *config.AgentConfig, entry confi
 	}
 }
 
+// newParallelDispatcher cria o dispatcher dos streams de dados de uma sessão
+// paralela. A conn primária é control-only (não usada para dados).
+func newParallelDispatcher(cfg *config.AgentConfig, entry config.BackupEntry, conn net.Conn, sessionID string, startSeq uint32, tlsCfg *tls.Config, logger *slog.Logger, controlCh *ControlChannel, onStreamChange func(active, max int)) (*Dispatcher, error) {
+	psk, err := loadClientPSK(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDispatcher(DispatcherConfig{
+		MaxStreams:     entry.Parallels,
+		BufferSize:     cfg.Resume.BufferSizeRaw,
+		ChunkSize:      int(cfg.Resume.ChunkSizeRaw),
+		MinChunkSize:   int(cfg.Resume.ChunkSizeMinRaw),
+		MaxChunkSize:   int(cfg.Resume.ChunkSizeMaxRaw),
+		SessionID:      sessionID,
+		StartSeq:       startSeq,
+		ServerAddr:     cfg.Server.Address,
+		TLSConfig:      tlsCfg,
+		PSK:            psk,
+		AgentName:      cfg.Agent.Name,
+		StorageName:    entry.Storage,
+		Logger:         logger,
+		PrimaryConn:    conn,
+		Trace:          traceSessionConn(cfg, entry, sessionID),
+		OnStreamChange: onStreamChange,
+		ChunksPerCycle: entry.PortRotation.EffectiveChunksPerCycle(),
+		Multiplex:      entry.ParallelTransport == config.ParallelTransportMux,
+		QUIC:           cfg.Server.Transport == config.TransportQUIC,
+		Server:         cfg.Server,
+		SACKTimeoutFn: func() time.Duration {
+			rtt := controlCh.RTT()
+			timeout := rtt * 3
+			if timeout < sackTimeoutMin {
+				timeout = sackTimeoutMin
+			}
+			return timeout
+		},
+	}), nil
+}
+
 // teeWriter é um io.Writer que escreve em ambos os destinos.
 // Usado para escrever no ring buffer E no hash ao mesmo tempo.
 type teeWriter struct {
@@ -0,0 +1,411 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+const (
+	// benchBlockSize é o bloco pseudoaleatório repetido pelo produtor sintético.
+	benchBlockSize = 1 << 20
+	// benchControlTimeout é a espera pelo control channel, necessário para o
+	// ControlIngestionDone que encerra a sessão paralela.
+	benchControlTimeout = 15 * time.Second
+)
+
+// BenchOptions configura um benchmark de throughput (nbackup-agent bench).
+type BenchOptions struct {
+	Storage   string            // storage do server, obrigatoriamente do tipo discard
+	Streams   int               // streams paralelos (1-255)
+	Size      int64             // bytes sintéticos enviados
+	ChunkSize int64             // tamanho do chunk (0 = resume.chunk_size)
+	Interval  time.Duration     // intervalo entre amostras (default: 1s)
+	OnSample  func(BenchSample) // chamado a cada amostra (opcional)
+	// BackupName é o nome do backup da sessão (default: nbackup-bench, aceito
+	// só em storages discard). Com outro nome a sessão grava um backup comum
+	// (usado pelo nbackup-soak).
+	BackupName string
+	// Seed != 0 gera dados sem repetição a partir da semente, para que chunks
+	// montados fora de ordem mudem o checksum; 0 repete um bloco fixo.
+	Seed int64
+}
+
+// BenchSample são as taxas do pipeline em um intervalo do benchmark.
+type BenchSample struct {
+	ElapsedSeconds    float64 `json:"elapsed_seconds"`
+	ProducerMBs       float64 `json:"producer_mb_s"`
+	DrainMBs          float64 `json:"drain_mb_s"`
+	ProducerBlockedMs int64   `json:"producer_blocked_ms"`
+	SenderIdleMs      int64   `json:"sender_idle_ms"`
+	Bottleneck        string  `json:"bottleneck"`
+}
+
+// BenchStream são os totais de um stream de dados no benchmark.
+type BenchStream struct {
+	Index           int     `json:"index"`
+	Bytes           uint64  `json:"bytes"`
+	RetransmitBytes uint64  `json:"retransmit_bytes"`
+	DrainMBs        float64 `json:"drain_mb_s"`
+}
+
+// BenchResult é o resultado de um benchmark. Bottleneck usa o mesmo
+// diagnóstico do auto-scaler sobre o tempo total de espera do produtor
+// (buffer cheio) e dos senders (buffer vazio).
+type BenchResult struct {
+	Server            string        `json:"server"`
+	Storage           string        `json:"storage"`
+	SessionID         string        `json:"session_id"`
+	Checksum          string        `json:"checksum"` // SHA-256 dos dados enviados
+	Streams           int           `json:"streams"`
+	ActiveStreams     int           `json:"active_streams"`
+	ChunkSize         int64         `json:"chunk_size"`
+	Bytes             int64         `json:"bytes"`
+	DurationSeconds   float64       `json:"duration_seconds"`
+	ProducerMBs       float64       `json:"producer_mb_s"`
+	DrainMBs          float64       `json:"drain_mb_s"`
+	HandshakeRTTMs    float64       `json:"handshake_rtt_ms"`
+	ControlRTTMs      float64       `json:"control_rtt_ms"`
+	FinalACKRTTMs     float64       `json:"final_ack_rtt_ms"`
+	ProducerBlockedMs int64         `json:"producer_blocked_ms"`
+	SenderIdleMs      int64         `json:"sender_idle_ms"`
+	Bottleneck        string        `json:"bottleneck"`
+	PerStream         []BenchStream `json:"per_stream"`
+	Samples           []BenchSample `json:"samples"`
+}
+
+// RunBench envia opts.Size bytes sintéticos pelo protocolo completo
+// (handshake, ParallelInit, N streams via ParallelJoin, control channel,
+// Trailer e FinalACK) para um storage discard, que valida o checksum sem
+// gravar nada. Mede as taxas do produtor e dos streams sem o custo do scan,
+// do tar e da compressão: o produtor sintético é o teto do pipeline real.
+func RunBench(ctx context.Context, cfg *config.AgentConfig, opts BenchOptions, logger *slog.Logger) (*BenchResult, error) {
+	if opts.Storage == "" {
+		return nil, fmt.Errorf("bench storage is required")
+	}
+	if opts.Streams < 1 || opts.Streams > 255 {
+		return nil, fmt.Errorf("bench streams must be between 1 and 255, got %d", opts.Streams)
+	}
+	if opts.Size <= 0 {
+		return nil, fmt.Errorf("bench size must be positive, got %d", opts.Size)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+
+	// Chunk fixo: o chunk adaptativo mudaria o tamanho em medição
+	benchCfg := *cfg
+	if opts.ChunkSize > 0 {
+		if opts.ChunkSize < 64*1024 || opts.ChunkSize > 16*1024*1024 {
+			return nil, fmt.Errorf("bench chunk size must be between 64kb and 16mb, got %d", opts.ChunkSize)
+		}
+		benchCfg.Resume.ChunkSizeRaw = opts.ChunkSize
+	}
+	benchCfg.Resume.ChunkSizeMinRaw = benchCfg.Resume.ChunkSizeRaw
+	benchCfg.Resume.ChunkSizeMaxRaw = benchCfg.Resume.ChunkSizeRaw
+	cfg = &benchCfg
+
+	if opts.BackupName == "" {
+		opts.BackupName = protocol.BenchBackupName
+	}
+	entry := config.BackupEntry{Name: opts.BackupName, Storage: opts.Storage, Parallels: opts.Streams}
+	logger = logger.With("backup", entry.Name, "storage", entry.Storage)
+	logger.Info("starting benchmark", "server", cfg.Server.Address, "streams", opts.Streams, "bytes", opts.Size)
+
+	tlsCfg, err := loadClientTLS(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("configuring TLS: %w", err)
+	}
+	host, _, err := net.SplitHostPort(cfg.Server.Address)
+	if err != nil {
+		host = cfg.Server.Address
+	}
+	tlsCfg.ServerName = host
+
+	controlCh := NewControlChannel(cfg, logger)
+	controlCh.Start()
+	defer controlCh.Stop()
+	if err := waitControlConnected(ctx, controlCh, benchControlTimeout); err != nil {
+		return nil, err
+	}
+
+	conn, ack, handshakeRTT, err := initialConnect(ctx, cfg, entry, tlsCfg, controlCh.RTT(), logger)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	sessionID := ack.SessionID
+	logger = logger.With("session", sessionID)
+	if err := initParallelSession(conn, ack.Version, opts.Streams, uint32(cfg.Resume.ChunkSizeRaw), uint32(cfg.Resume.ChunkSizeRaw)); err != nil {
+		return nil, err
+	}
+
+	dispatcher, err := newParallelDispatcher(cfg, entry, conn, sessionID, 0, tlsCfg, logger, controlCh, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer dispatcher.Close()
+	defer dispatcher.closeMux()
+	defer context.AfterFunc(ctx, dispatcher.Abort)()
+
+	res := &BenchResult{
+		Server:         cfg.Server.Address,
+		Storage:        opts.Storage,
+		SessionID:      sessionID,
+		Streams:        opts.Streams,
+		ChunkSize:      cfg.Resume.ChunkSizeRaw,
+		Bytes:          opts.Size,
+		HandshakeRTTMs: durationMs(handshakeRTT),
+	}
+	for i := 0; i < opts.Streams; i++ {
+		if err := dispatcher.ActivateStream(i); err != nil {
+			logger.Warn("failed to activate benchmark stream", "stream", i, "error", err)
+			continue
+		}
+		res.ActiveStreams++
+	}
+	if res.ActiveStreams == 0 {
+		return nil, fmt.Errorf("no parallel streams could be activated")
+	}
+
+	// Sem auto-scaler: o benchmark mede exatamente opts.Streams streams, e
+	// SampleRates zera os contadores a cada leitura
+	start := time.Now()
+	dispatcher.SampleRates()
+
+	var (
+		checksum     [32]byte
+		producerErr  error
+		producerTime time.Duration
+	)
+	producerDone := make(chan struct{})
+	go func() {
+		defer close(producerDone)
+		checksum, producerErr = writeSynthetic(ctx, dispatcher, opts.Size, opts.Seed)
+		producerTime = time.Since(start)
+		dispatcher.Flush()
+		dispatcher.Close()
+	}()
+
+	sendersCtx, sendersCancel := context.WithTimeout(ctx, MaxBackupDuration)
+	defer sendersCancel()
+	sendersDone := make(chan error, 1)
+	go func() {
+		sendersDone <- dispatcher.WaitAllSenders(sendersCtx)
+	}()
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	var sendersErr error
+	for waiting := true; waiting; {
+		select {
+		case <-ticker.C:
+			res.addSample(dispatcher.SampleRates(), time.Since(start), opts.OnSample)
+		case sendersErr = <-sendersDone:
+			waiting = false
+		}
+	}
+	<-producerDone
+	duration := time.Since(start)
+	res.addSample(dispatcher.SampleRates(), duration, opts.OnSample)
+
+	if sendersErr != nil {
+		return nil, fmt.Errorf("parallel sender error: %w", sendersErr)
+	}
+	if producerErr != nil {
+		return nil, fmt.Errorf("benchmark producer error: %w", producerErr)
+	}
+
+	transferStats := dispatcher.TransferStats()
+	var sent uint64
+	for _, s := range transferStats {
+		sent += s.BytesSent
+		res.PerStream = append(res.PerStream, BenchStream{
+			Index:           int(s.StreamIndex),
+			Bytes:           s.BytesSent,
+			RetransmitBytes: s.RetransmitBytes,
+			DrainMBs:        mbPerSecond(float64(s.BytesSent), duration),
+		})
+	}
+	res.Checksum = hex.EncodeToString(checksum[:])
+	res.DurationSeconds = duration.Seconds()
+	res.ProducerMBs = mbPerSecond(float64(opts.Size), producerTime)
+	res.DrainMBs = mbPerSecond(float64(sent), duration)
+	res.Bottleneck = diagnoseBottleneck(res.ProducerBlockedMs, res.SenderIdleMs)
+
+	if err := controlCh.SendSessionSummary(protocol.ControlSessionSummary{
+		SessionID: sessionID,
+		Streams:   transferStats,
+	}); err != nil {
+		logger.Warn("failed to send session transfer summary", "error", err)
+	}
+	if err := controlCh.SendIngestionDone(sessionID); err != nil {
+		return nil, fmt.Errorf("signaling ingestion done: %w", err)
+	}
+
+	trailerStart := time.Now()
+	if err := protocol.WriteTrailer(conn, checksum, uint64(opts.Size)); err != nil {
+		return nil, fmt.Errorf("writing trailer: %w", err)
+	}
+	finalACK, err := protocol.ReadFinalACK(conn)
+	if err != nil {
+		return nil, fmt.Errorf("reading final ACK: %w", err)
+	}
+	res.FinalACKRTTMs = durationMs(time.Since(trailerStart))
+	res.ControlRTTMs = durationMs(controlCh.RTT())
+
+	switch finalACK.Status {
+	case protocol.FinalStatusOK:
+	case protocol.FinalStatusChecksumMismatch:
+		return nil, fmt.Errorf("server reported checksum mismatch")
+	case protocol.FinalStatusWriteError:
+		return nil, fmt.Errorf("server reported write error")
+	default:
+		return nil, fmt.Errorf("server returned unknown status: %d", finalACK.Status)
+	}
+
+	logger.Info("benchmark completed",
+		"bytes", opts.Size,
+		"duration", duration.Round(time.Millisecond),
+		"drain_mb_s", fmt.Sprintf("%.1f", res.DrainMBs),
+		"bottleneck", res.Bottleneck,
+	)
+	return res, nil
+}
+
+// addSample registra uma amostra de SampleRates e acumula as esperas.
+func (r *BenchResult) addSample(rates RateSample, elapsed time.Duration, onSample func(BenchSample)) {
+	s := BenchSample{
+		ElapsedSeconds:    elapsed.Seconds(),
+		ProducerMBs:       rates.ProducerBps / (1024 * 1024),
+		DrainMBs:          rates.DrainBps / (1024 * 1024),
+		ProducerBlockedMs: rates.ProducerBlockedMs,
+		SenderIdleMs:      rates.SenderIdleMs,
+		Bottleneck:        diagnoseBottleneck(rates.ProducerBlockedMs, rates.SenderIdleMs),
+	}
+	r.ProducerBlockedMs += s.ProducerBlockedMs
+	r.SenderIdleMs += s.SenderIdleMs
+	r.Samples = append(r.Samples, s)
+	if onSample != nil {
+		onSample(s)
+	}
+}
+
+// writeSynthetic escreve size bytes pseudoaleatórios em w e retorna o
+// SHA-256 do que foi escrito. Os dados são incompressíveis e, com seed 0, o
+// mesmo bloco se repete: o custo do produtor é só o hash, como no Stream
+// real. Com seed != 0 cada bloco é novo (e o produtor, mais lento).
+func writeSynthetic(ctx context.Context, w io.Writer, size, seed int64) ([32]byte, error) {
+	var sum [32]byte
+	block := make([]byte, benchBlockSize)
+	src := rand.New(rand.NewSource(1))
+	if seed != 0 {
+		src = rand.New(rand.NewSource(seed))
+	}
+	src.Read(block)
+
+	h := sha256.New()
+	for written := int64(0); written < size; {
+		if err := ctx.Err(); err != nil {
+			return sum, err
+		}
+		n := min(int64(len(block)), size-written)
+		if _, err := w.Write(block[:n]); err != nil {
+			return sum, err
+		}
+		h.Write(block[:n])
+		written += n
+		if seed != 0 {
+			src.Read(block)
+		}
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// waitControlConnected aguarda o control channel conectar por até timeout.
+func waitControlConnected(ctx context.Context, cc *ControlChannel, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	for !cc.IsConnected() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("control channel not connected after %s", timeout)
+		case <-tick.C:
+		}
+	}
+	return nil
+}
+
+func mbPerSecond(bytes float64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return bytes / (1024 * 1024) / d.Seconds()
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// benchHints orientam o ajuste a partir do gargalo diagnosticado.
+var benchHints = map[string]string{
+	"network":  "the producer waited for the network: more streams or a larger chunk size may help",
+	"producer": "the network waited for the producer: the real pipeline (scan, tar, compression) will set the pace",
+	"balanced": "producer and network kept pace with each other",
+}
+
+// WriteBenchSampleHeader escreve o cabeçalho das linhas de WriteBenchSample.
+func WriteBenchSampleHeader(w io.Writer) {
+	fmt.Fprintf(w, "%8s  %14s  %14s  %9s  %9s  %s\n", "ELAPSED", "PRODUCER", "DRAIN", "BLOCKED", "IDLE", "BOTTLENECK")
+}
+
+// WriteBenchSample escreve uma amostra do benchmark em uma linha de texto.
+func WriteBenchSample(w io.Writer, s BenchSample) {
+	fmt.Fprintf(w, "%7.1fs  %9.1f MB/s  %9.1f MB/s  %7dms  %7dms  %s\n",
+		s.ElapsedSeconds, s.ProducerMBs, s.DrainMBs, s.ProducerBlockedMs, s.SenderIdleMs, s.Bottleneck)
+}
+
+// WriteBenchResult escreve o resultado do benchmark em texto ou, com
+// output json, como um objeto JSON.
+func WriteBenchResult(w io.Writer, res *BenchResult, output string) error {
+	if output == OutputJSON {
+		return writeJSON(w, res)
+	}
+	fmt.Fprintf(w, "\n%s to %s (storage %s) in %.1fs\n",
+		formatBytes(res.Bytes), res.Server, res.Storage, res.DurationSeconds)
+	fmt.Fprintf(w, "  streams:    %d of %d active, chunk size %s\n",
+		res.ActiveStreams, res.Streams, formatBytes(res.ChunkSize))
+	fmt.Fprintf(w, "  producer:   %.1f MB/s\n", res.ProducerMBs)
+	fmt.Fprintf(w, "  drain:      %.1f MB/s\n", res.DrainMBs)
+	for _, s := range res.PerStream {
+		fmt.Fprintf(w, "    stream %-3d %.1f MB/s (%s", s.Index, s.DrainMBs, formatBytes(int64(s.Bytes)))
+		if s.RetransmitBytes > 0 {
+			fmt.Fprintf(w, ", %s retransmitted", formatBytes(int64(s.RetransmitBytes)))
+		}
+		fmt.Fprintln(w, ")")
+	}
+	fmt.Fprintf(w, "  rtt:        handshake %.1fms, control %.1fms, final ack %.1fms\n",
+		res.HandshakeRTTMs, res.ControlRTTMs, res.FinalACKRTTMs)
+	fmt.Fprintf(w, "  bottleneck: %s (producer blocked %.1fs, senders idle %.1fs)\n",
+		res.Bottleneck, float64(res.ProducerBlockedMs)/1000, float64(res.SenderIdleMs)/1000)
+	_, err := fmt.Fprintf(w, "              %s\n", benchHints[res.Bottleneck])
+	return err
+}
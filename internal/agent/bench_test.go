@@ -0,0 +1,94 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestWriteSynthetic(t *testing.T) {
+	var buf bytes.Buffer
+	const size = 2*benchBlockSize + 777
+	sum, err := writeSynthetic(context.Background(), &buf, size, 0)
+	if err != nil {
+		t.Fatalf("writeSynthetic: %v", err)
+	}
+	if buf.Len() != size {
+		t.Fatalf("expected %d bytes, got %d", size, buf.Len())
+	}
+	if sum != sha256.Sum256(buf.Bytes()) {
+		t.Error("checksum does not match written data")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := writeSynthetic(ctx, &buf, size, 0); err == nil {
+		t.Error("expected error with cancelled context")
+	}
+
+	// Com seed, os blocos não se repetem
+	buf.Reset()
+	seeded, err := writeSynthetic(context.Background(), &buf, size, 42)
+	if err != nil {
+		t.Fatalf("writeSynthetic with seed: %v", err)
+	}
+	data := buf.Bytes()
+	if seeded != sha256.Sum256(data) || seeded == sum {
+		t.Error("unexpected checksum with seed")
+	}
+	if bytes.Equal(data[:benchBlockSize], data[benchBlockSize:2*benchBlockSize]) {
+		t.Error("expected distinct blocks with seed")
+	}
+}
+
+func TestDiagnoseBottleneck(t *testing.T) {
+	for _, c := range []struct {
+		blocked, idle int64
+		want          string
+	}{
+		{900, 10, "network"},
+		{10, 900, "producer"},
+		{80, 50, "balanced"},
+		{500, 500, "balanced"},
+	} {
+		if got := diagnoseBottleneck(c.blocked, c.idle); got != c.want {
+			t.Errorf("diagnoseBottleneck(%d, %d) = %q, want %q", c.blocked, c.idle, got, c.want)
+		}
+	}
+}
+
+func TestWriteBenchResult(t *testing.T) {
+	res := &BenchResult{
+		Server: "backup:9847", Storage: "bench", Streams: 2, ActiveStreams: 2,
+		ChunkSize: 1 << 20, Bytes: 10 << 30, DurationSeconds: 20,
+		ProducerMBs: 900, DrainMBs: 512,
+		PerStream: []BenchStream{
+			{Index: 0, Bytes: 5 << 30, DrainMBs: 256},
+			{Index: 1, Bytes: 5 << 30, RetransmitBytes: 4 << 20, DrainMBs: 256},
+		},
+		ProducerBlockedMs: 15000, Bottleneck: "network",
+	}
+	var text bytes.Buffer
+	if err := WriteBenchResult(&text, res, OutputText); err != nil {
+		t.Fatalf("WriteBenchResult: %v", err)
+	}
+	for _, want := range []string{"10.0 GB to backup:9847", "2 of 2 active, chunk size 1.0 MB", "4.0 MB retransmitted", "bottleneck: network", "more streams"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text output missing %q:\n%s", want, text.String())
+		}
+	}
+
+	var js bytes.Buffer
+	if err := WriteBenchResult(&js, res, OutputJSON); err != nil {
+		t.Fatalf("WriteBenchResult json: %v", err)
+	}
+	if !strings.Contains(js.String(), `"bottleneck": "network"`) {
+		t.Errorf("unexpected json output:\n%s", js.String())
+	}
+}
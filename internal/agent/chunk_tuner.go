@@ -0,0 +1,161 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// chunkTuneInterval é a janela entre avaliações do tamanho de chunk.
+	chunkTuneInterval = 5 * time.Second
+
+	// chunkTuneMinSamples é o mínimo de round-trips amostrados na janela
+	// para que o chunkTuner decida algo.
+	chunkTuneMinSamples = 3
+
+	// chunkTuneMinTime é o tempo mínimo de transmissão de um chunk em um
+	// stream: abaixo disso (ou da latência do round-trip, se maior) o link é
+	// rápido o bastante para chunks maiores.
+	chunkTuneMinTime = 100 * time.Millisecond
+
+	// chunkTuneShrinkFactor define a banda de histerese: o chunk só diminui
+	// quando a transmissão passa de chunkTuneShrinkFactor × o alvo mínimo.
+	// Com fator 4, dobrar ou dividir por dois nunca inverte a decisão seguinte.
+	chunkTuneShrinkFactor = 4
+)
+
+// chunkTuner ajusta o tamanho dos chunks do Dispatcher em passos de potência
+// de dois entre resume.chunk_size_min e resume.chunk_size_max. A cada janela
+// compara o tempo de transmissão de um chunk por stream (chunk / throughput
+// por stream) com a latência medida entre o envio de um chunk e o seu
+// ChunkSACK: links rápidos deixam de pagar o round-trip por chunk pequeno, e
+// links lentos ou produtores lentos (arquivos pequenos) não esperam chunks
+// gigantes. O Length de cada ChunkHeader já informa o tamanho ao server.
+type chunkTuner struct {
+	d        *Dispatcher
+	interval time.Duration
+	logger   *slog.Logger
+
+	lastAcked int64
+	lastAt    time.Time
+}
+
+// newChunkTuner cria o chunkTuner para d.
+func newChunkTuner(d *Dispatcher, logger *slog.Logger) *chunkTuner {
+	return &chunkTuner{d: d, interval: chunkTuneInterval, logger: logger}
+}
+
+// Run avalia o tamanho de chunk a cada intervalo até ctx ser cancelado.
+func (t *chunkTuner) Run(ctx context.Context) {
+	t.lastAcked = t.d.ackedBytes.Load()
+	t.lastAt = time.Now()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	t.logger.Info("adaptive chunk size enabled",
+		"chunkSize", t.d.chunkSize.Load(),
+		"minChunkSize", t.d.minChunkSize,
+		"maxChunkSize", t.d.maxChunkSize,
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.evaluate()
+		}
+	}
+}
+
+// evaluate mede a janela corrente e aplica o novo tamanho, se houver.
+func (t *chunkTuner) evaluate() {
+	now := time.Now()
+	elapsed := now.Sub(t.lastAt).Seconds()
+	acked := t.d.ackedBytes.Load()
+	rate := float64(acked-t.lastAcked) / elapsed
+	t.lastAcked, t.lastAt = acked, now
+
+	rtt, samples := t.d.takeChunkRTT()
+	active := t.d.ActiveStreams()
+	if samples < chunkTuneMinSamples || rate <= 0 || active <= 0 {
+		return
+	}
+
+	size := int(t.d.chunkSize.Load())
+	perStream := rate / float64(active)
+	xfer := time.Duration(float64(size) / perStream * float64(time.Second))
+
+	next := nextChunkSize(size, t.d.minChunkSize, t.d.maxChunkSize, xfer, rtt)
+	if next == size {
+		return
+	}
+	t.d.chunkSize.Store(int64(next))
+	t.logger.Info("chunk size adjusted",
+		"from", size,
+		"to", next,
+		"chunkTransfer", xfer,
+		"chunkRTT", rtt,
+		"drainBps", int64(rate),
+		"activeStreams", active,
+	)
+}
+
+// nextChunkSize decide o próximo tamanho de chunk. xfer é o tempo de
+// transmissão de um chunk de size bytes em um stream e rtt o round-trip médio
+// de um chunk (envio até o ChunkSACK, incluindo a própria transmissão). O alvo
+// mínimo é o maior entre chunkTuneMinTime e a latência (rtt - xfer): abaixo
+// dele o chunk dobra, acima de chunkTuneShrinkFactor × o alvo cai pela metade.
+func nextChunkSize(size, minSize, maxSize int, xfer, rtt time.Duration) int {
+	target := max(chunkTuneMinTime, rtt-xfer)
+	switch {
+	case xfer < target && size < maxSize:
+		return min(size*2, maxSize)
+	case xfer > chunkTuneShrinkFactor*target && size > minSize:
+		return max(size/2, minSize)
+	}
+	return size
+}
+
+// startRTTProbe inicia uma amostra de round-trip no chunk recém-enviado, se o
+// ajuste adaptativo está ativo e o stream não tem outra amostra em andamento.
+func (d *Dispatcher) startRTTProbe(stream *ParallelStream, sentAt time.Time) {
+	if d.minChunkSize == d.maxChunkSize || stream.rttProbeAt.Load() != 0 {
+		return
+	}
+	stream.sendMu.Lock()
+	end := stream.wireOffset
+	stream.sendMu.Unlock()
+	stream.rttProbeEnd.Store(end)
+	stream.rttProbeAt.Store(sentAt.UnixNano())
+}
+
+// finishRTTProbe fecha a amostra do stream quando o ChunkSACK cobre o fim do
+// chunk amostrado.
+func (d *Dispatcher) finishRTTProbe(stream *ParallelStream, wireOffset int64) {
+	at := stream.rttProbeAt.Load()
+	if at == 0 || wireOffset < stream.rttProbeEnd.Load() {
+		return
+	}
+	if stream.rttProbeAt.CompareAndSwap(at, 0) {
+		d.chunkRTTSum.Add(time.Now().UnixNano() - at)
+		d.chunkRTTCount.Add(1)
+	}
+}
+
+// takeChunkRTT retorna o round-trip médio das amostras desde a última
+// chamada e a quantidade de amostras, zerando os acumuladores.
+func (d *Dispatcher) takeChunkRTT() (time.Duration, int64) {
+	sum := d.chunkRTTSum.Swap(0)
+	count := d.chunkRTTCount.Swap(0)
+	if count == 0 {
+		return 0, 0
+	}
+	return time.Duration(sum / count), count
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func TestNextChunkSize(t *testing.T) {
+	const (
+		kb = 1024
+		mb = 1024 * kb
+	)
+	tests := []struct {
+		name      string
+		size      int
+		xfer, rtt time.Duration
+		want      int
+	}{
+		{"fast link grows", 1 * mb, 10 * time.Millisecond, 15 * time.Millisecond, 2 * mb},
+		{"grow capped at max", 6 * mb, 10 * time.Millisecond, 15 * time.Millisecond, 8 * mb},
+		{"at max stays", 8 * mb, 10 * time.Millisecond, 15 * time.Millisecond, 8 * mb},
+		{"high latency grows", 1 * mb, 150 * time.Millisecond, 450 * time.Millisecond, 2 * mb},
+		{"within band stays", 1 * mb, 200 * time.Millisecond, 220 * time.Millisecond, 1 * mb},
+		{"slow link shrinks", 1 * mb, 2 * time.Second, 2050 * time.Millisecond, 512 * kb},
+		{"shrink capped at min", 384 * kb, 2 * time.Second, 2050 * time.Millisecond, 256 * kb},
+		{"at min stays", 256 * kb, 2 * time.Second, 2050 * time.Millisecond, 256 * kb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextChunkSize(tt.size, 256*kb, 8*mb, tt.xfer, tt.rtt); got != tt.want {
+				t.Errorf("nextChunkSize(%d, %v, %v) = %d, want %d", tt.size, tt.xfer, tt.rtt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_WriteFollowsChunkSizeChange(t *testing.T) {
+	d := NewDispatcher(DispatcherConfig{
+		MaxStreams:   1,
+		BufferSize:   1024 * 1024,
+		ChunkSize:    1024,
+		MinChunkSize: 256,
+		MaxChunkSize: 4096,
+		SessionID:    "test-tune",
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	activateStreamManually(d, 0, &mockConn{})
+
+	// 600 bytes pendentes; reduzir para 512 emite os 600 de uma vez na próxima escrita
+	if _, err := d.Write(make([]byte, 600)); err != nil {
+		t.Fatal(err)
+	}
+	d.chunkSize.Store(512)
+	if _, err := d.Write(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	// Depois do crescimento, os 100 pendentes + 3996 formam um único chunk
+	d.chunkSize.Store(4096)
+	if _, err := d.Write(make([]byte, 3996)); err != nil {
+		t.Fatal(err)
+	}
+	want := []uint32{600, 4096}
+
+	rb := d.streams[0].rb
+	var offset int64
+	for i, length := range want {
+		hdr := make([]byte, protocol.ChunkHeaderSize)
+		if _, err := rb.ReadAt(offset, hdr); err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+		got := uint32(hdr[4])<<24 | uint32(hdr[5])<<16 | uint32(hdr[6])<<8 | uint32(hdr[7])
+		if got != length {
+			t.Errorf("chunk %d: expected length %d, got %d", i, length, got)
+		}
+		offset += int64(protocol.ChunkHeaderSize) + int64(got)
+	}
+	if offset != rb.Head() {
+		t.Errorf("expected %d bytes in ring buffer, got %d", offset, rb.Head())
+	}
+}
+
+func TestDispatcher_ChunkRTTProbe(t *testing.T) {
+	d := NewDispatcher(DispatcherConfig{
+		MaxStreams:   1,
+		BufferSize:   1024 * 1024,
+		ChunkSize:    1024,
+		MaxChunkSize: 4096,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	stream := d.streams[0]
+	stream.wireOffset = 1037
+
+	d.startRTTProbe(stream, time.Now().Add(-50*time.Millisecond))
+	// Uma segunda amostra não substitui a que está em andamento
+	d.startRTTProbe(stream, time.Now())
+
+	d.finishRTTProbe(stream, 500) // SACK ainda não cobre o chunk
+	if _, n := d.takeChunkRTT(); n != 0 {
+		t.Fatalf("expected no samples before the chunk is acknowledged, got %d", n)
+	}
+	d.finishRTTProbe(stream, 1037)
+	rtt, n := d.takeChunkRTT()
+	if n != 1 || rtt < 50*time.Millisecond {
+		t.Errorf("expected one sample >= 50ms, got %d samples of %v", n, rtt)
+	}
+	if stream.rttProbeAt.Load() != 0 {
+		t.Error("probe should be cleared after the sample")
+	}
+}
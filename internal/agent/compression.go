@@ -0,0 +1,253 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// rawMinSize é o menor arquivo gravado sem compressão: abaixo disso, abrir e
+// fechar um membro custa mais que comprimir o arquivo junto com os vizinhos.
+const rawMinSize = 128 * 1024
+
+// compressedExtensions são as extensões de formatos já comprimidos, gravadas
+// sem compressão com compression.skip_compressed (default).
+var compressedExtensions = []string{
+	// imagem
+	".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic", ".heif", ".avif",
+	// vídeo e áudio
+	".mp4", ".m4v", ".mkv", ".mov", ".avi", ".webm", ".mp3", ".m4a", ".aac", ".ogg", ".opus", ".flac",
+	// compactadores e pacotes
+	".gz", ".tgz", ".bz2", ".xz", ".txz", ".zst", ".lz4", ".br", ".zip", ".7z", ".rar",
+	".jar", ".war", ".apk", ".deb", ".rpm", ".whl",
+	// documentos OOXML/ODF (zip)
+	".docx", ".xlsx", ".pptx", ".odt", ".ods", ".odp",
+}
+
+// Compression descreve como o Stream comprime o tar: algoritmo negociado,
+// nível e quais arquivos vão sem compressão.
+type Compression struct {
+	Mode    byte            // protocol.Compression*
+	Level   int             // nível do algoritmo; 0 = default
+	Workers int             // goroutines de compressão; 0 = GOMAXPROCS
+	raw     map[string]bool // extensões (minúsculas, com ponto) gravadas sem compressão
+	none    bool            // compression.algorithm none: todas as entradas sem compressão
+}
+
+// newCompression monta a compressão de entry para o modo negociado. O level
+// de compression só vale se compression.algorithm for o modo negociado; caso
+// contrário o storage mudou de algoritmo e o default é usado, com aviso.
+func newCompression(cc config.CompressionConfig, mode byte, logger *slog.Logger) Compression {
+	c := Compression{Mode: mode, Workers: cc.Workers, none: cc.Algorithm == config.CompressionNone}
+	if cc.Algorithm != "" && !c.none {
+		if negotiated := compressionModeName(mode); cc.Algorithm != negotiated {
+			if logger != nil {
+				logger.Warn("compression.algorithm differs from the storage compression mode, using default level",
+					"configured", cc.Algorithm, "negotiated", negotiated)
+			}
+		} else {
+			c.Level = cc.Level
+		}
+	}
+
+	if cc.SkipCompressedEnabled() || len(cc.SkipExtensions) > 0 {
+		c.raw = make(map[string]bool)
+	}
+	if cc.SkipCompressedEnabled() {
+		for _, ext := range compressedExtensions {
+			c.raw[ext] = true
+		}
+	}
+	for _, ext := range cc.SkipExtensions {
+		c.raw[ext] = true
+	}
+	return c
+}
+
+// compressionModeName retorna o nome do modo como em compression_mode.
+func compressionModeName(mode byte) string {
+	if mode == protocol.CompressionZstd {
+		return "zst"
+	}
+	return "gzip"
+}
+
+// workers retorna o número de goroutines de compressão.
+func (c Compression) workers() int {
+	if c.Workers > 0 {
+		return c.Workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// storeRaw indica se entry deve ser gravada sem compressão.
+func (c Compression) storeRaw(entry FileEntry) bool {
+	if c.none {
+		return true
+	}
+	if c.raw == nil || !entry.Info.Mode().IsRegular() || entry.Info.Size() < rawMinSize {
+		return false
+	}
+	return c.raw[strings.ToLower(filepath.Ext(entry.Path))]
+}
+
+// Formato de frame zstd com blocos raw (RFC 8878 §3.1.1).
+const (
+	zstdFrameMagic = 0xFD2FB528
+	// Frame_Header_Descriptor sem content size, checksum nem dicionário, e
+	// Window_Descriptor de 128KB (Window_Log 17): blocos de até 128KB.
+	zstdRawFHD        = 0x00
+	zstdRawWindow     = (17 - 10) << 3
+	zstdRawBlockLimit = 128 * 1024
+)
+
+// rawZstdWriter grava um frame zstd só com blocos raw (sem compressão), para
+// arquivos já comprimidos em archives zst: decodificadores zstd o leem como
+// qualquer outro frame, sem o custo do encoder.
+type rawZstdWriter struct {
+	w       io.Writer
+	blocks  rawBlocks
+	started bool
+}
+
+func newRawZstdWriter(w io.Writer) *rawZstdWriter {
+	z := &rawZstdWriter{w: w}
+	z.blocks = rawBlocks{limit: zstdRawBlockLimit, emit: z.block}
+	return z
+}
+
+func (z *rawZstdWriter) Write(p []byte) (int, error) {
+	return z.blocks.write(p)
+}
+
+// Close grava o último bloco, encerrando o frame.
+func (z *rawZstdWriter) Close() error {
+	return z.block(z.blocks.buf, true)
+}
+
+// block grava data como um bloco raw (e o header do frame, no primeiro bloco).
+func (z *rawZstdWriter) block(data []byte, last bool) error {
+	var hdr [9]byte
+	n := 0
+	if !z.started {
+		binary.LittleEndian.PutUint32(hdr[:4], zstdFrameMagic)
+		hdr[4], hdr[5] = zstdRawFHD, zstdRawWindow
+		n, z.started = 6, true
+	}
+	bh := uint32(len(data)) << 3 // Block_Type raw = 0
+	if last {
+		bh |= 1
+	}
+	hdr[n], hdr[n+1], hdr[n+2] = byte(bh), byte(bh>>8), byte(bh>>16)
+	if _, err := z.w.Write(hdr[:n+3]); err != nil {
+		return err
+	}
+	_, err := z.w.Write(data)
+	return err
+}
+
+// gzipStoredLimit é o maior bloco deflate stored (RFC 1951 §3.2.4).
+const gzipStoredLimit = 65535
+
+// rawGzipWriter grava um membro gzip só com blocos deflate stored (sem
+// compressão). Diferente do gzip.NoCompression da stdlib, não copia os dados
+// para uma janela: blocos completos saem direto do buffer de quem escreve.
+type rawGzipWriter struct {
+	w      io.Writer
+	blocks rawBlocks
+	crc    uint32
+	size   uint32 // ISIZE: tamanho módulo 2^32
+	header bool
+}
+
+func newRawGzipWriter(w io.Writer) *rawGzipWriter {
+	g := &rawGzipWriter{w: w}
+	g.blocks = rawBlocks{limit: gzipStoredLimit, emit: g.block}
+	return g
+}
+
+func (g *rawGzipWriter) Write(p []byte) (int, error) {
+	g.crc = crc32.Update(g.crc, crc32.IEEETable, p)
+	g.size += uint32(len(p))
+	return g.blocks.write(p)
+}
+
+// Close grava o último bloco e o trailer do membro (CRC-32 e ISIZE).
+func (g *rawGzipWriter) Close() error {
+	if err := g.block(g.blocks.buf, true); err != nil {
+		return err
+	}
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], g.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], g.size)
+	_, err := g.w.Write(trailer[:])
+	return err
+}
+
+// block grava data como um bloco stored (e o header do membro, no primeiro).
+func (g *rawGzipWriter) block(data []byte, last bool) error {
+	var hdr [15]byte
+	n := 0
+	if !g.header {
+		// ID1 ID2 CM=deflate FLG=0 MTIME=0 XFL=0 OS=255 (desconhecido)
+		copy(hdr[:10], []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255})
+		n, g.header = 10, true
+	}
+	if last {
+		hdr[n] = 1 // BFINAL, BTYPE stored
+	}
+	binary.LittleEndian.PutUint16(hdr[n+1:], uint16(len(data)))
+	binary.LittleEndian.PutUint16(hdr[n+3:], ^uint16(len(data)))
+	if _, err := g.w.Write(hdr[:n+5]); err != nil {
+		return err
+	}
+	_, err := g.w.Write(data)
+	return err
+}
+
+// rawBlocks divide as escritas em blocos de até limit bytes para emit. Blocos
+// completos saem direto de p, sem cópia; só o resto fica em buf, para que as
+// escritas pequenas do tar (headers, padding) não virem blocos minúsculos.
+// O último bloco (buf, possivelmente vazio) é emitido pelo Close do formato.
+type rawBlocks struct {
+	limit int
+	emit  func(data []byte, last bool) error
+	buf   []byte
+}
+
+func (b *rawBlocks) write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if len(b.buf) == 0 && len(p) >= b.limit {
+			if err := b.emit(p[:b.limit], false); err != nil {
+				return n - len(p), err
+			}
+			p = p[b.limit:]
+			continue
+		}
+		if len(b.buf) == b.limit {
+			if err := b.emit(b.buf, false); err != nil {
+				return n - len(p), err
+			}
+			b.buf = b.buf[:0]
+		}
+		if b.buf == nil {
+			b.buf = make([]byte, 0, b.limit)
+		}
+		k := copy(b.buf[len(b.buf):b.limit], p)
+		b.buf = b.buf[:len(b.buf)+k]
+		p = p[k:]
+	}
+	return n, nil
+}
@@ -0,0 +1,269 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func TestStream_StoresCompressedFilesRaw(t *testing.T) {
+	dir := t.TempDir()
+	photo := make([]byte, 512*1024)
+	rand.New(rand.NewSource(1)).Read(photo)
+	files := map[string][]byte{
+		"photo.JPG": photo,
+		"notes.txt": bytes.Repeat([]byte("backup "), 64*1024),
+		"icon.png":  []byte("tiny png below rawMinSize"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, mode := range []byte{protocol.CompressionGzip, protocol.CompressionZstd} {
+		comp := newCompression(config.CompressionConfig{}, mode, nil)
+		var buf bytes.Buffer
+		if _, err := Stream(context.Background(), NewScanner([]string{dir}, nil), &buf, nil, nil, comp, 0, 0, nil); err != nil {
+			t.Fatalf("mode %d: Stream: %v", mode, err)
+		}
+
+		// O jpg vai sem compressão: o conteúdo aparece literalmente no archive
+		if !bytes.Contains(buf.Bytes(), photo[:32*1024]) {
+			t.Errorf("mode %d: expected photo.JPG to be stored raw", mode)
+		}
+		// O txt continua comprimido
+		if buf.Len() > len(photo)+64*1024 {
+			t.Errorf("mode %d: archive too large (%d bytes), notes.txt not compressed?", mode, buf.Len())
+		}
+
+		// Os membros raw e comprimidos formam um archive legível por tar
+		var r io.Reader
+		if mode == protocol.CompressionZstd {
+			dec, err := zstd.NewReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dec.Close()
+			r = dec
+		} else {
+			gz, err := gzip.NewReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = gz
+		}
+		tr := tar.NewReader(r)
+		found := 0
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("mode %d: reading tar: %v", mode, err)
+			}
+			want, ok := files[filepath.Base(hdr.Name)]
+			if !ok || hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			got, _ := io.ReadAll(tr)
+			if !bytes.Equal(got, want) {
+				t.Errorf("mode %d: content mismatch for %s", mode, hdr.Name)
+			}
+			found++
+		}
+		if found != len(files) {
+			t.Errorf("mode %d: expected %d files in archive, got %d", mode, len(files), found)
+		}
+	}
+}
+
+func TestNewCompression_LevelAndSkipList(t *testing.T) {
+	off := false
+	cc := config.CompressionConfig{Algorithm: "zst", Level: 19, SkipCompressed: &off, SkipExtensions: []string{".dat"}}
+
+	c := newCompression(cc, protocol.CompressionZstd, nil)
+	if c.Level != 19 {
+		t.Errorf("expected level 19, got %d", c.Level)
+	}
+	if !c.raw[".dat"] || c.raw[".jpg"] {
+		t.Errorf("expected only the configured extensions, got %v", c.raw)
+	}
+
+	// Storage negociou outro algoritmo: o level configurado não se aplica
+	if c := newCompression(cc, protocol.CompressionGzip, nil); c.Level != 0 {
+		t.Errorf("expected default level on algorithm mismatch, got %d", c.Level)
+	}
+}
+
+func TestRawZstdWriter_DecodesAsZstdFrame(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789abcdef", 20*1024)) // 320KB: 3 blocos
+	for _, payload := range [][]byte{data, nil} {
+		var buf bytes.Buffer
+		zw := newRawZstdWriter(&buf)
+		if _, err := zw.Write(payload); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		dec, err := zstd.NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(dec)
+		dec.Close()
+		if err != nil {
+			t.Fatalf("decoding raw frame of %d bytes: %v", len(payload), err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("raw frame roundtrip mismatch: got %d bytes, want %d", len(got), len(payload))
+		}
+	}
+}
+
+func TestStream_CompressionWorkers(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("parallel compression "), 256*1024) // ~5MB: vários blocos pgzip
+	if err := os.WriteFile(filepath.Join(dir, "data.log"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []byte{protocol.CompressionGzip, protocol.CompressionZstd} {
+		for _, workers := range []int{1, 4} {
+			var buf bytes.Buffer
+			comp := Compression{Mode: mode, Workers: workers}
+			if _, err := Stream(context.Background(), NewScanner([]string{dir}, nil), &buf, nil, nil, comp, 0, 0, nil); err != nil {
+				t.Fatalf("mode %d workers %d: Stream: %v", mode, workers, err)
+			}
+			var r io.Reader
+			if mode == protocol.CompressionZstd {
+				dec, err := zstd.NewReader(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer dec.Close()
+				r = dec
+			} else {
+				gz, err := gzip.NewReader(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r = gz
+			}
+			tr := tar.NewReader(r)
+			for {
+				hdr, err := tr.Next()
+				if err != nil {
+					t.Fatalf("mode %d workers %d: data.log not found: %v", mode, workers, err)
+				}
+				if hdr.Typeflag == tar.TypeReg {
+					got, _ := io.ReadAll(tr)
+					if !bytes.Equal(got, data) {
+						t.Errorf("mode %d workers %d: content mismatch", mode, workers)
+					}
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestRawGzipWriter_DecodesAsGzipMember(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789abcdef", 20*1024)) // 320KB: vários blocos stored
+	for _, writes := range [][][]byte{{data}, {nil}, {data[:100], data[100:70000], data[70000:]}} {
+		var buf bytes.Buffer
+		gw := newRawGzipWriter(&buf)
+		var want []byte
+		for _, p := range writes {
+			if _, err := gw.Write(p); err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, p...)
+		}
+		if err := gw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz.Multistream(false)
+		got, err := io.ReadAll(gz) // valida CRC-32 e ISIZE
+		if err != nil {
+			t.Fatalf("decoding stored member of %d bytes: %v", len(want), err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("stored member roundtrip mismatch: got %d bytes, want %d", len(got), len(want))
+		}
+		if buf.Len() != 0 {
+			t.Errorf("expected the member to end at the trailer, %d bytes left", buf.Len())
+		}
+	}
+}
+
+func TestStream_CompressionNone(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("compressible but stored as is "), 8*1024)
+	if err := os.WriteFile(filepath.Join(dir, "data.log"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []byte{protocol.CompressionGzip, protocol.CompressionZstd} {
+		comp := newCompression(config.CompressionConfig{Algorithm: config.CompressionNone}, mode, nil)
+		var buf bytes.Buffer
+		if _, err := Stream(context.Background(), NewScanner([]string{dir}, nil), &buf, nil, nil, comp, 0, 0, nil); err != nil {
+			t.Fatalf("mode %d: Stream: %v", mode, err)
+		}
+		if buf.Len() < len(data) {
+			t.Errorf("mode %d: archive of %d bytes, expected the content stored uncompressed", mode, buf.Len())
+		}
+
+		var r io.Reader
+		if mode == protocol.CompressionZstd {
+			dec, err := zstd.NewReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dec.Close()
+			r = dec
+		} else {
+			gz, err := gzip.NewReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = gz
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				t.Fatalf("mode %d: data.log not found: %v", mode, err)
+			}
+			if hdr.Typeflag == tar.TypeReg {
+				got, _ := io.ReadAll(tr)
+				if !bytes.Equal(got, data) {
+					t.Errorf("mode %d: content mismatch", mode)
+				}
+				break
+			}
+		}
+	}
+}
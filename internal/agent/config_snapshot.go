@@ -0,0 +1,243 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/logging"
+)
+
+// EntryConfigSnapshot registra a configuração efetiva de um backup entry usada
+// em uma execução, com as opções de server.* que afetam a conexão. Caminhos de
+// certificados e chaves TLS não são incluídos; segredos (senha do proxy,
+// caminho da healthcheck_url) são redigidos.
+type EntryConfigSnapshot struct {
+	Server          string          `json:"server"`
+	ServerTransport string          `json:"server_transport,omitempty"`
+	ServerProxy     string          `json:"server_proxy,omitempty"` // URL e usuário; a senha nunca
+	ServerPrefer    string          `json:"server_prefer,omitempty"`
+	ServerSocket    *SocketSnapshot `json:"server_socket,omitempty"`
+
+	Storage        string   `json:"storage"`
+	Schedule       string   `json:"schedule"`
+	Sources        []string `json:"sources"`
+	Include        []string `json:"include,omitempty"`
+	Exclude        []string `json:"exclude,omitempty"`
+	Parallels      int      `json:"parallels"`
+	ProducerShards int      `json:"producer_shards,omitempty"`
+	Transport      string   `json:"parallel_transport,omitempty"` // sockets|mux (apenas com parallels)
+	AutoScaler     string   `json:"auto_scaler"`                  // "off" ou o modo (efficiency|adaptive)
+	BandwidthLimit string   `json:"bandwidth_limit,omitempty"`
+	MaxSize        string   `json:"max_size,omitempty"`
+	Manifest       bool     `json:"manifest,omitempty"`
+	DSCP           string   `json:"dscp,omitempty"`
+	PortRotation   int      `json:"port_rotation_chunks,omitempty"`
+	ChunkSize      string   `json:"chunk_size"`
+	ChunkSizeMin   string   `json:"chunk_size_min,omitempty"`
+	ChunkSizeMax   string   `json:"chunk_size_max,omitempty"`
+	BufferSize     string   `json:"buffer_size"`
+	SACKInterval   string   `json:"sack_interval,omitempty"` // "auto" ou tamanho
+	MaxInFlight    string   `json:"max_inflight,omitempty"`  // "auto" ou tamanho
+	Xattrs         bool     `json:"xattrs,omitempty"`
+	Priority       int      `json:"priority,omitempty"`
+	Jitter         string   `json:"jitter,omitempty"`
+	CatchUp        bool     `json:"catch_up,omitempty"`
+	MinInterval    string   `json:"min_interval,omitempty"`
+	MinStorageFree string   `json:"min_storage_free,omitempty"`
+	HealthcheckURL string   `json:"healthcheck_url,omitempty"` // apenas esquema e host
+
+	Local      *LocalSnapshot         `json:"local,omitempty"`
+	Assertions *AssertionsSnapshot    `json:"assertions,omitempty"`
+	Snapshot   *SnapshotPhaseSnapshot `json:"snapshot,omitempty"`
+
+	SourceOptions map[string]SourceOptionsSnapshot `json:"source_options,omitempty"` // por path; apenas sources com opções
+
+	Compression        string   `json:"compression_algorithm,omitempty"` // vazio = negociado com o storage
+	CompressionLevel   int      `json:"compression_level,omitempty"`     // 0 = default do algoritmo
+	CompressionWorkers int      `json:"compression_workers,omitempty"`
+	SkipCompressed     bool     `json:"skip_compressed"`
+	SkipExtensions     []string `json:"skip_extensions,omitempty"`
+}
+
+// SourceOptionsSnapshot registra as opções não-default de uma source.
+type SourceOptionsSnapshot struct {
+	Required       *bool  `json:"required,omitempty"` // apenas sources opcionais (false)
+	FollowSymlinks bool   `json:"follow_symlinks,omitempty"`
+	OneFilesystem  bool   `json:"one_filesystem,omitempty"`
+	MinFileSize    string `json:"min_file_size,omitempty"`
+	MaxFileSize    string `json:"max_file_size,omitempty"`
+	ModifiedWithin string `json:"modified_within,omitempty"`
+	ModifiedBefore string `json:"modified_before,omitempty"`
+}
+
+// LocalSnapshot registra o destino do modo local.
+type LocalSnapshot struct {
+	Path            string `json:"path"`
+	MaxBackups      int    `json:"max_backups"`
+	CompressionMode string `json:"compression_mode"`
+}
+
+// AssertionsSnapshot registra os critérios de sucesso configurados.
+type AssertionsSnapshot struct {
+	MinBytes      string   `json:"min_bytes,omitempty"`
+	MinObjects    int64    `json:"min_objects,omitempty"`
+	RequiredPaths []string `json:"required_paths,omitempty"`
+}
+
+// SnapshotPhaseSnapshot registra a fase de snapshot. Os comandos passam pela
+// redação do processo (logging.redact).
+type SnapshotPhaseSnapshot struct {
+	Command        string `json:"command,omitempty"`
+	CleanupCommand string `json:"cleanup_command,omitempty"`
+	Timeout        string `json:"timeout,omitempty"`
+	Coordinated    bool   `json:"coordinated,omitempty"`
+}
+
+// SocketSnapshot registra o ajuste dos sockets TCP com o server.
+type SocketSnapshot struct {
+	KeepAlive     string `json:"keepalive,omitempty"`
+	UserTimeout   string `json:"user_timeout,omitempty"`
+	SendBuffer    string `json:"send_buffer,omitempty"`
+	ReceiveBuffer string `json:"receive_buffer,omitempty"`
+	Congestion    string `json:"congestion,omitempty"`
+}
+
+// newEntryConfigSnapshot captura a configuração efetiva de entry.
+func newEntryConfigSnapshot(cfg *config.AgentConfig, entry config.BackupEntry) *EntryConfigSnapshot {
+	snap := &EntryConfigSnapshot{
+		Server:          cfg.Server.Address,
+		ServerTransport: cfg.Server.Transport,
+		ServerProxy:     redactProxy(cfg.Server.Proxy),
+		ServerPrefer:    cfg.Server.Prefer,
+
+		Storage:        entry.Storage,
+		Schedule:       entry.Schedule,
+		Include:        entry.Include,
+		Exclude:        entry.Exclude,
+		Parallels:      entry.Parallels,
+		ProducerShards: entry.ProducerShards,
+		AutoScaler:     "off",
+		BandwidthLimit: entry.BandwidthLimit,
+		MaxSize:        entry.MaxSize,
+		Manifest:       entry.Manifest,
+		DSCP:           entry.DSCP,
+		PortRotation:   entry.PortRotation.EffectiveChunksPerCycle(),
+		ChunkSize:      cfg.Resume.ChunkSize,
+		ChunkSizeMin:   cfg.Resume.ChunkSizeMin,
+		ChunkSizeMax:   cfg.Resume.ChunkSizeMax,
+		BufferSize:     cfg.Resume.BufferSize,
+		SACKInterval:   cfg.Resume.SACKInterval,
+		MaxInFlight:    cfg.Resume.MaxInFlight,
+		Xattrs:         entry.Xattrs,
+		Priority:       entry.Priority,
+		CatchUp:        entry.CatchUp,
+		MinStorageFree: entry.MinStorageFree,
+		HealthcheckURL: redactURL(entry.HealthcheckURL),
+
+		Compression:        entry.Compression.Algorithm,
+		CompressionLevel:   entry.Compression.Level,
+		CompressionWorkers: entry.Compression.Workers,
+		SkipCompressed:     entry.Compression.SkipCompressedEnabled(),
+		SkipExtensions:     entry.Compression.SkipExtensions,
+	}
+	if entry.Jitter > 0 {
+		snap.Jitter = entry.Jitter.String()
+	}
+	if entry.MinInterval > 0 {
+		snap.MinInterval = entry.MinInterval.String()
+	}
+	if sock := cfg.Server.Socket; sock != (config.SocketConfig{}) {
+		snap.ServerSocket = &SocketSnapshot{
+			KeepAlive:     durationString(sock.KeepAlive),
+			UserTimeout:   durationString(sock.UserTimeout),
+			SendBuffer:    sock.SendBuffer,
+			ReceiveBuffer: sock.ReceiveBuffer,
+			Congestion:    sock.Congestion,
+		}
+	}
+	if entry.Local != (config.LocalTarget{}) {
+		snap.Local = &LocalSnapshot{Path: entry.Local.Path, MaxBackups: entry.Local.MaxBackups, CompressionMode: entry.Local.CompressionMode}
+	}
+	if a := entry.Assertions; a.Enabled() || a.MinBytes != "" {
+		snap.Assertions = &AssertionsSnapshot{MinBytes: a.MinBytes, MinObjects: a.MinObjects, RequiredPaths: a.RequiredPaths}
+	}
+	if sp := entry.Snapshot; sp != (config.SnapshotConfig{}) {
+		snap.Snapshot = &SnapshotPhaseSnapshot{
+			Command:        logging.Redact(sp.Command),
+			CleanupCommand: logging.Redact(sp.CleanupCommand),
+			Timeout:        durationString(sp.Timeout),
+			Coordinated:    sp.Coordinated,
+		}
+	}
+	if entry.Parallels > 0 {
+		snap.Transport = entry.ParallelTransport
+	}
+	if entry.AutoScaler.Enabled {
+		snap.AutoScaler = entry.AutoScaler.Mode
+	}
+	for _, src := range entry.Sources {
+		snap.Sources = append(snap.Sources, src.Path)
+		opts := SourceOptionsSnapshot{
+			Required:       src.Required,
+			FollowSymlinks: src.FollowSymlinks,
+			OneFilesystem:  src.OneFilesystem,
+			MinFileSize:    src.MinFileSize,
+			MaxFileSize:    src.MaxFileSize,
+		}
+		if src.ModifiedWithin > 0 {
+			opts.ModifiedWithin = src.ModifiedWithin.String()
+		}
+		if src.ModifiedBefore > 0 {
+			opts.ModifiedBefore = src.ModifiedBefore.String()
+		}
+		if opts != (SourceOptionsSnapshot{}) {
+			if snap.SourceOptions == nil {
+				snap.SourceOptions = make(map[string]SourceOptionsSnapshot)
+			}
+			snap.SourceOptions[src.Path] = opts
+		}
+	}
+	return snap
+}
+
+// durationString formata d; vazio para 0 (default).
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// redactProxy retorna a URL do proxy com o usuário, sem a senha.
+func redactProxy(p config.ProxyConfig) string {
+	if !p.Enabled() {
+		return ""
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return logging.DefaultRedactReplacement
+	}
+	u.User = nil
+	if p.Username != "" {
+		u.User = url.User(p.Username)
+	}
+	return u.String()
+}
+
+// redactURL reduz uma URL ao esquema e host: o caminho e a query de URLs de
+// healthcheck carregam o token do check.
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return logging.DefaultRedactReplacement
+	}
+	return u.Scheme + "://" + u.Host + "/" + logging.DefaultRedactReplacement
+}
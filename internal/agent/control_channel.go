@@ -5,9 +5,12 @@
 package agent
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"math"
 	"net"
 	"sync"
@@ -15,7 +18,6 @@ import (
 	"time"
 
 	"github.com/nishisan-dev/n-backup/internal/config"
-	"github.com/nishisan-dev/n-backup/internal/pki"
 	"github.com/nishisan-dev/n-backup/internal/protocol"
 )
 
@@ -65,15 +67,33 @@ type ControlChannel struct {
 	// A função deve drenar o stream e retornar.
 	onRotate func(streamIndex uint8)
 
-	// Callback que retorna dados de progresso do backup em andamento.
-	// Chamado a cada ping tick para enviar ControlProgress ao server.
-	progressProvider func() (totalObjects, objectsSent uint32, walkComplete bool)
+	// Callback chamado quando o server envia ControlAbort.
+	onAbort func(abort *protocol.ControlAbort)
+
+	// Callbacks da execução coordenada (snapshot_groups): início da fase de
+	// snapshot e liberação/cancelamento da transferência.
+	onSnapshotPrepare func(prep *protocol.ControlSnapshotPrepare)
+	onSnapshotRelease func(rel *protocol.ControlSnapshotRelease)
+
+	// Callbacks que retornam o progresso de cada backup em andamento
+	// (sessionID → progressSource). Chamados a cada ping tick para enviar
+	// ControlProgress ao server.
+	progressMu        sync.Mutex
+	progressProviders map[string]progressSource
 
 	// Callback que retorna stats do sistema.
 	statsProvider func() *protocol.ControlStats
 
-	// Callback que retorna stats do auto-scaler.
-	autoScaleStatsProvider func() *protocol.ControlAutoScaleStats
+	// Callbacks que retornam as stats do auto-scaler de cada sessão paralela
+	// em andamento (sessionID → autoScaleSource).
+	autoScaleMu        sync.Mutex
+	autoScaleProviders map[string]autoScaleSource
+
+	// Callbacks de ControlServerLoad por sessão (sessionID → func).
+	serverLoadHandlers sync.Map
+
+	// Callbacks de ControlStreamLimit por sessão (sessionID → func).
+	streamLimitHandlers sync.Map
 
 	// Lifecycle
 	stopCh chan struct{}
@@ -100,10 +120,88 @@ func (cc *ControlChannel) SetOnRotate(fn func(streamIndex uint8)) {
 	cc.onRotate = fn
 }
 
-// SetProgressProvider define o callback que fornece dados de progresso do backup.
-// Chamado a cada ping tick; quando retorna totalObjects > 0, envia ControlProgress ao server.
-func (cc *ControlChannel) SetProgressProvider(fn func() (totalObjects, objectsSent uint32, walkComplete bool)) {
-	cc.progressProvider = fn
+// SetOnAbort define o callback chamado quando o server aborta uma sessão
+// (ou todas, com SessionID vazio) via ControlAbort. Deve ser chamado antes de Start().
+func (cc *ControlChannel) SetOnAbort(fn func(abort *protocol.ControlAbort)) {
+	cc.onAbort = fn
+}
+
+// SetOnSnapshot define os callbacks chamados quando o server inicia a fase de
+// snapshot de um snapshot_group (ControlSnapshotPrepare) e quando libera ou
+// cancela a transferência (ControlSnapshotRelease). Deve ser chamado antes de Start().
+func (cc *ControlChannel) SetOnSnapshot(prepare func(prep *protocol.ControlSnapshotPrepare), release func(rel *protocol.ControlSnapshotRelease)) {
+	cc.onSnapshotPrepare = prepare
+	cc.onSnapshotRelease = release
+}
+
+// SetServerLoadHandler registra o callback chamado quando o server reporta
+// a pressão sobre a sessão (ControlServerLoad). fn nil remove o registro.
+func (cc *ControlChannel) SetServerLoadHandler(sessionID string, fn func(load *protocol.ControlServerLoad)) {
+	if fn == nil {
+		cc.serverLoadHandlers.Delete(sessionID)
+		return
+	}
+	cc.serverLoadHandlers.Store(sessionID, fn)
+}
+
+// SetStreamLimitHandler registra o callback chamado quando o server recomenda
+// um teto de streams para a sessão (ControlStreamLimit). fn nil remove o registro.
+func (cc *ControlChannel) SetStreamLimitHandler(sessionID string, fn func(limit *protocol.ControlStreamLimit)) {
+	if fn == nil {
+		cc.streamLimitHandlers.Delete(sessionID)
+		return
+	}
+	cc.streamLimitHandlers.Store(sessionID, fn)
+}
+
+// progressSource é o provider de progresso de uma sessão e a versão negociada
+// no seu handshake, que define o frame enviado.
+type progressSource struct {
+	version byte
+	fn      func() (totalObjects, objectsSent uint32, walkComplete bool)
+}
+
+// SetProgressProvider define o callback que fornece dados de progresso do
+// backup da sessão sessionID; fn nil remove o registro. Chamado a cada ping
+// tick, que envia ControlProgress ao server enquanto o provider estiver
+// registrado — mesmo antes do total ser conhecido, pois o frame também
+// sinaliza ao server que o backup segue ativo. version é a versão negociada no
+// handshake da sessão: a partir de v9 o frame leva o sessionID; antes, o
+// server associa o progresso pelo nome do agent.
+func (cc *ControlChannel) SetProgressProvider(sessionID string, version byte, fn func() (totalObjects, objectsSent uint32, walkComplete bool)) {
+	cc.progressMu.Lock()
+	defer cc.progressMu.Unlock()
+	if fn == nil {
+		delete(cc.progressProviders, sessionID)
+		return
+	}
+	if cc.progressProviders == nil {
+		cc.progressProviders = make(map[string]progressSource)
+	}
+	cc.progressProviders[sessionID] = progressSource{version: version, fn: fn}
+}
+
+// writeProgress envia o ControlProgress de cada sessão com provider
+// registrado. Chamado com writeMu held.
+func (cc *ControlChannel) writeProgress(w io.Writer) error {
+	cc.progressMu.Lock()
+	sources := make(map[string]progressSource, len(cc.progressProviders))
+	maps.Copy(sources, cc.progressProviders)
+	cc.progressMu.Unlock()
+
+	for sessionID, src := range sources {
+		total, sent, walk := src.fn()
+		var err error
+		if src.version >= protocol.HandshakeVersionSessionProgress {
+			err = protocol.WriteControlSessionProgress(w, sessionID, total, sent, walk)
+		} else {
+			err = protocol.WriteControlProgress(w, total, sent, walk)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // SetStatsProvider define o callback que fornece estatísticas do sistema.
@@ -112,10 +210,55 @@ func (cc *ControlChannel) SetStatsProvider(fn func() *protocol.ControlStats) {
 	cc.statsProvider = fn
 }
 
-// SetAutoScaleStatsProvider define o callback que fornece estatísticas do auto-scaler.
-// Chamado a cada ping tick; envia ControlAutoScaleStats ao server.
-func (cc *ControlChannel) SetAutoScaleStatsProvider(fn func() *protocol.ControlAutoScaleStats) {
-	cc.autoScaleStatsProvider = fn
+// autoScaleSource é o provider de stats do auto-scaler de uma sessão e a
+// versão negociada no seu handshake, que define o frame enviado.
+type autoScaleSource struct {
+	version byte
+	fn      func() *protocol.ControlAutoScaleStats
+}
+
+// SetAutoScaleStatsProvider define o callback que fornece estatísticas do
+// auto-scaler da sessão sessionID; fn nil remove o registro. Chamado a cada
+// ping tick; envia ControlAutoScaleStats ao server. version é a versão
+// negociada no handshake da sessão: a partir de v10 o frame leva o sessionID;
+// antes, o server associa as stats pelo nome do agent.
+func (cc *ControlChannel) SetAutoScaleStatsProvider(sessionID string, version byte, fn func() *protocol.ControlAutoScaleStats) {
+	cc.autoScaleMu.Lock()
+	defer cc.autoScaleMu.Unlock()
+	if fn == nil {
+		delete(cc.autoScaleProviders, sessionID)
+		return
+	}
+	if cc.autoScaleProviders == nil {
+		cc.autoScaleProviders = make(map[string]autoScaleSource)
+	}
+	cc.autoScaleProviders[sessionID] = autoScaleSource{version: version, fn: fn}
+}
+
+// writeAutoScaleStats envia o ControlAutoScaleStats de cada sessão com
+// provider registrado. Chamado com writeMu held.
+func (cc *ControlChannel) writeAutoScaleStats(w io.Writer) error {
+	cc.autoScaleMu.Lock()
+	sources := make(map[string]autoScaleSource, len(cc.autoScaleProviders))
+	maps.Copy(sources, cc.autoScaleProviders)
+	cc.autoScaleMu.Unlock()
+
+	for sessionID, src := range sources {
+		stats := src.fn()
+		if stats == nil {
+			continue
+		}
+		var err error
+		if src.version >= protocol.HandshakeVersionSessionAutoScale {
+			err = protocol.WriteControlSessionAutoScaleStats(w, sessionID, stats)
+		} else {
+			err = protocol.WriteControlAutoScaleStats(w, stats)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // SendProgress envia um frame ControlProgress ao server imediatamente.
@@ -204,6 +347,67 @@ func (cc *ControlChannel) SendIngestionDone(sessionID string) error {
 	return err
 }
 
+// SendSessionCancel envia ControlSessionCancel ao server, que descarta a
+// sessão abandonada pelo agent (ex: backup abortado no shutdown do daemon).
+// Retorna erro se o control channel estiver desconectado.
+// Thread-safe via writeMu.
+func (cc *ControlChannel) SendSessionCancel(sessionID string) error {
+	cc.connMu.Lock()
+	conn := cc.conn
+	cc.connMu.Unlock()
+
+	if conn == nil {
+		return fmt.Errorf("control channel unavailable: cannot send ControlSessionCancel for session %s", sessionID)
+	}
+
+	cc.writeMu.Lock()
+	err := protocol.WriteControlSessionCancel(conn, sessionID)
+	cc.writeMu.Unlock()
+	return err
+}
+
+// SendSnapshotReady envia ControlSnapshotReady ao server com o resultado da
+// fase de snapshot pedida por ControlSnapshotPrepare.
+// Retorna erro se o control channel estiver desconectado.
+// Thread-safe via writeMu.
+func (cc *ControlChannel) SendSnapshotReady(snapshotID string, status byte, message string) error {
+	cc.connMu.Lock()
+	conn := cc.conn
+	cc.connMu.Unlock()
+
+	if conn == nil {
+		return fmt.Errorf("control channel unavailable: cannot send ControlSnapshotReady for snapshot %s", snapshotID)
+	}
+
+	cc.writeMu.Lock()
+	err := protocol.WriteControlSnapshotReady(conn, snapshotID, status, message)
+	cc.writeMu.Unlock()
+	return err
+}
+
+// SendSessionSummary envia ControlSessionSummary ao server pelo canal de controle
+// com os totais de transferência por stream da sessão.
+// Retorna erro se o control channel estiver desconectado.
+// Thread-safe via writeMu.
+func (cc *ControlChannel) SendSessionSummary(summary protocol.ControlSessionSummary) error {
+	cc.connMu.Lock()
+	conn := cc.conn
+	cc.connMu.Unlock()
+
+	if conn == nil {
+		return fmt.Errorf("control channel unavailable: cannot send ControlSessionSummary for session %s", summary.SessionID)
+	}
+
+	cc.writeMu.Lock()
+	err := protocol.WriteControlSessionSummary(conn, summary)
+	cc.writeMu.Unlock()
+
+	if err != nil {
+		cc.logger.Warn("failed to send ControlSessionSummary", "error", err, "session", summary.SessionID)
+	}
+	return err
+}
+
 // SendSlotPark envia ControlSlotPark ao server para indicar que um slot foi desativado.
 // Thread-safe via writeMu.
 func (cc *ControlChannel) SendSlotPark(slotID uint8) error {
@@ -356,7 +560,11 @@ func (cc *ControlChannel) run() {
 
 // connect estabelece a conexão TLS, envia o magic "CTRL" e o keepalive_interval.
 func (cc *ControlChannel) connect() error {
-	tlsCfg, err := pki.NewClientTLSConfig(cc.cfg.TLS.CACert, cc.cfg.TLS.ClientCert, cc.cfg.TLS.ClientKey)
+	tlsCfg, err := loadClientTLS(cc.cfg, cc.logger)
+	if err != nil {
+		return err
+	}
+	psk, err := loadClientPSK(cc.cfg)
 	if err != nil {
 		return err
 	}
@@ -367,17 +575,42 @@ func (cc *ControlChannel) connect() error {
 	}
 	tlsCfg.ServerName = host
 
-	dialer := &net.Dialer{Timeout: 10 * time.Second}
-	rawConn, err := dialer.Dial("tcp", cc.cfg.Server.Address)
-	if err != nil {
-		return err
-	}
+	var tlsConn net.Conn
+	switch cc.cfg.Server.Transport {
+	case config.TransportQUIC:
+		// Stream QUIC; após uma queda, a reconexão usa 0-RTT (sem psk)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if tlsConn, err = dialQUIC(ctx, cc.cfg.Server.Address, cc.cfg.Server.Prefer, tlsCfg, psk); err != nil {
+			return err
+		}
+	case config.TransportUnix:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if tlsConn, err = dialUnix(ctx, cc.cfg.Server.Address); err != nil {
+			return err
+		}
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		rawConn, err := dialTCP(ctx, cc.cfg.Server, cc.cfg.Server.Address)
+		if err != nil {
+			return err
+		}
 
-	tlsConn := tls.Client(rawConn, tlsCfg)
-	if err := tlsConn.Handshake(); err != nil {
-		rawConn.Close()
-		return err
+		tc := tls.Client(rawConn, tlsCfg)
+		if err := tc.Handshake(); err != nil {
+			rawConn.Close()
+			return err
+		}
+		if err := psk.authenticate(tc); err != nil {
+			tc.Close()
+			return err
+		}
+		tlsConn = tc
 	}
+	conn := traceConn(cc.cfg, config.BackupEntry{}, tlsConn, "control")
+	traceIdentify(conn, "")
 
 	// Envia magic "CTRL" + keepalive_interval (uint32 big-endian, em segundos)
 	// O server usa keepalive_interval para calcular o read timeout (2.5x)
@@ -391,14 +624,14 @@ func (cc *ControlChannel) connect() error {
 	handshake[5] = byte(intervalSecs >> 16)
 	handshake[6] = byte(intervalSecs >> 8)
 	handshake[7] = byte(intervalSecs)
-	if _, err := tlsConn.Write(handshake); err != nil {
-		tlsConn.Close()
+	if _, err := conn.Write(handshake); err != nil {
+		conn.Close()
 		return err
 	}
 
 	// Envia version do agent (string terminada em newline)
-	if _, err := tlsConn.Write([]byte(Version + "\n")); err != nil {
-		tlsConn.Close()
+	if _, err := conn.Write([]byte(Version + "\n")); err != nil {
+		conn.Close()
 		return err
 	}
 
@@ -412,13 +645,13 @@ func (cc *ControlChannel) connect() error {
 			load = st.LoadAverage
 		}
 	}
-	if err := protocol.WriteControlStatsPayload(tlsConn, cpu, mem, disk, load); err != nil {
-		tlsConn.Close()
+	if err := protocol.WriteControlStatsPayload(conn, cpu, mem, disk, load); err != nil {
+		conn.Close()
 		return err
 	}
 
 	cc.connMu.Lock()
-	cc.conn = tlsConn
+	cc.conn = conn
 	cc.connMu.Unlock()
 
 	return nil
@@ -540,6 +773,61 @@ func (cc *ControlChannel) pingLoop() {
 					}
 				}(streamIdx)
 
+			case protocol.MagicControlDefer:
+				// Server adiou um backup (ex: handshake fora da backup_window do storage)
+				waitMinutes, err := protocol.ReadControlDeferPayload(conn)
+				if err != nil {
+					cc.logger.Warn("control channel: reading defer payload", "error", err)
+					return
+				}
+
+				cc.logger.Info("control channel: server deferred backup",
+					"wait_minutes", waitMinutes)
+
+			case protocol.MagicControlAbort:
+				// Server abortou uma sessão (ex: disco do storage cheio)
+				abort, err := protocol.ReadControlAbortPayload(conn)
+				if err != nil {
+					cc.logger.Warn("control channel: reading abort payload", "error", err)
+					return
+				}
+
+				cc.logger.Warn("control channel: server aborted session",
+					"session", abort.SessionID, "reason", protocol.AbortReasonString(abort.Reason))
+				if cc.onAbort != nil {
+					cc.onAbort(abort)
+				}
+
+			case protocol.MagicControlSnapshotPrepare:
+				// Server iniciou a fase de snapshot de um snapshot_group
+				prep, err := protocol.ReadControlSnapshotPreparePayload(conn)
+				if err != nil {
+					cc.logger.Warn("control channel: reading snapshot prepare payload", "error", err)
+					return
+				}
+
+				cc.logger.Info("control channel: snapshot requested",
+					"snapshot", prep.SnapshotID, "backup", prep.Backup)
+				if cc.onSnapshotPrepare != nil {
+					cc.onSnapshotPrepare(prep)
+				} else {
+					go cc.SendSnapshotReady(prep.SnapshotID, protocol.SnapshotStatusFailed, "coordinated snapshots not supported")
+				}
+
+			case protocol.MagicControlSnapshotRelease:
+				// Server liberou (ou cancelou) a transferência após o snapshot
+				rel, err := protocol.ReadControlSnapshotReleasePayload(conn)
+				if err != nil {
+					cc.logger.Warn("control channel: reading snapshot release payload", "error", err)
+					return
+				}
+
+				cc.logger.Info("control channel: snapshot released",
+					"snapshot", rel.SnapshotID, "proceed", rel.Proceed)
+				if cc.onSnapshotRelease != nil {
+					cc.onSnapshotRelease(rel)
+				}
+
 			case protocol.MagicControlAssemblyProgress:
 				// Server enviou progresso da montagem do arquivo final
 				prog, err := protocol.ReadControlAssemblyProgressPayload(conn)
@@ -562,6 +850,30 @@ func (cc *ControlChannel) pingLoop() {
 					"phase", phaseStr,
 				)
 
+			case protocol.MagicControlServerLoad:
+				// Server reportou pressão de disco/assembler sobre uma sessão
+				load, err := protocol.ReadControlServerLoadPayload(conn)
+				if err != nil {
+					cc.logger.Warn("control channel: reading server load payload", "error", err)
+					return
+				}
+
+				if fn, ok := cc.serverLoadHandlers.Load(load.SessionID); ok {
+					fn.(func(*protocol.ControlServerLoad))(load)
+				}
+
+			case protocol.MagicControlStreamLimit:
+				// Server recomendou um teto de streams para uma sessão
+				limit, err := protocol.ReadControlStreamLimitPayload(conn)
+				if err != nil {
+					cc.logger.Warn("control channel: reading stream limit payload", "error", err)
+					return
+				}
+
+				if fn, ok := cc.streamLimitHandlers.Load(limit.SessionID); ok {
+					fn.(func(*protocol.ControlStreamLimit))(limit)
+				}
+
 			default:
 				cc.logger.Warn("control channel: unknown magic from server",
 					"magic", string(magic[:]))
@@ -588,11 +900,8 @@ func (cc *ControlChannel) pingLoop() {
 			cc.writeMu.Lock()
 			err := protocol.WriteControlPing(conn, now)
 			// Coalescendo envio de progress com o mesmo tick de ping
-			if err == nil && cc.progressProvider != nil {
-				total, sent, walk := cc.progressProvider()
-				if total > 0 {
-					err = protocol.WriteControlProgress(conn, total, sent, walk)
-				}
+			if err == nil {
+				err = cc.writeProgress(conn)
 			}
 			if err == nil && cc.statsProvider != nil {
 				stats := cc.statsProvider()
@@ -600,11 +909,8 @@ func (cc *ControlChannel) pingLoop() {
 					err = protocol.WriteControlStats(conn, stats.CPUPercent, stats.MemoryPercent, stats.DiskUsagePercent, stats.LoadAverage)
 				}
 			}
-			if err == nil && cc.autoScaleStatsProvider != nil {
-				asStats := cc.autoScaleStatsProvider()
-				if asStats != nil {
-					err = protocol.WriteControlAutoScaleStats(conn, asStats)
-				}
+			if err == nil {
+				err = cc.writeAutoScaleStats(conn)
 			}
 			cc.writeMu.Unlock()
 
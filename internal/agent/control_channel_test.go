@@ -5,6 +5,7 @@
 package agent
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
 	"log/slog"
@@ -297,3 +298,81 @@ func TestControlChannel_RTT_EWMA(t *testing.T) {
 		t.Errorf("third sample (50ms) should pull average down from %v, got %v", expected, cc.RTT())
 	}
 }
+
+func TestControlChannel_ProgressPerSession(t *testing.T) {
+	cc := NewControlChannel(&config.AgentConfig{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	cc.SetProgressProvider("home", protocol.HandshakeVersionSessionProgress, func() (uint32, uint32, bool) { return 10, 5, false })
+	cc.SetProgressProvider("db", protocol.HandshakeVersionSessionProgress, func() (uint32, uint32, bool) { return 900, 300, true })
+
+	var buf bytes.Buffer
+	if err := cc.writeProgress(&buf); err != nil {
+		t.Fatalf("writeProgress: %v", err)
+	}
+	got := map[string]protocol.ControlProgress{}
+	for buf.Len() > 0 {
+		magic, err := protocol.ReadControlMagic(&buf)
+		if err != nil || magic != protocol.MagicControlSessionProgress {
+			t.Fatalf("expected CPRS frame, got %q (%v)", magic, err)
+		}
+		prog, err := protocol.ReadControlSessionProgressPayload(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[prog.SessionID] = *prog
+	}
+	if len(got) != 2 || got["home"].ObjectsSent != 5 || got["db"].TotalObjects != 900 || !got["db"].WalkComplete {
+		t.Fatalf("unexpected progress frames %+v", got)
+	}
+
+	// Sessão negociada antes do v9: CPRG sem sessão; removida, não envia nada
+	cc.SetProgressProvider("db", protocol.HandshakeVersionSessionProgress, nil)
+	cc.SetProgressProvider("home", protocol.HandshakeVersionChunkRange, func() (uint32, uint32, bool) { return 10, 6, false })
+	buf.Reset()
+	cc.writeProgress(&buf)
+	prog, err := protocol.ReadControlProgress(&buf)
+	if err != nil || prog.ObjectsSent != 6 || buf.Len() != 0 {
+		t.Fatalf("expected a single legacy CPRG frame, got %+v (%v), %d bytes left", prog, err, buf.Len())
+	}
+}
+
+func TestControlChannel_AutoScaleStatsPerSession(t *testing.T) {
+	cc := NewControlChannel(&config.AgentConfig{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	cc.SetAutoScaleStatsProvider("home", protocol.HandshakeVersionSessionAutoScale, func() *protocol.ControlAutoScaleStats {
+		return &protocol.ControlAutoScaleStats{ActiveStreams: 2, MaxStreams: 2}
+	})
+	cc.SetAutoScaleStatsProvider("db", protocol.HandshakeVersionSessionAutoScale, func() *protocol.ControlAutoScaleStats {
+		return &protocol.ControlAutoScaleStats{ActiveStreams: 3, MaxStreams: 4}
+	})
+
+	var buf bytes.Buffer
+	if err := cc.writeAutoScaleStats(&buf); err != nil {
+		t.Fatalf("writeAutoScaleStats: %v", err)
+	}
+	got := map[string]uint8{}
+	for buf.Len() > 0 {
+		magic, err := protocol.ReadControlMagic(&buf)
+		if err != nil || magic != protocol.MagicControlSessionAutoScaleStats {
+			t.Fatalf("expected CSAS frame, got %q (%v)", magic, err)
+		}
+		stats, err := protocol.ReadControlSessionAutoScaleStatsPayload(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[stats.SessionID] = stats.MaxStreams
+	}
+	if len(got) != 2 || got["home"] != 2 || got["db"] != 4 {
+		t.Fatalf("unexpected auto-scale frames %v", got)
+	}
+
+	// Sessão negociada antes do v10: CASS sem sessão; removida, não envia nada
+	cc.SetAutoScaleStatsProvider("db", protocol.HandshakeVersionSessionAutoScale, nil)
+	cc.SetAutoScaleStatsProvider("home", protocol.HandshakeVersionSessionProgress, func() *protocol.ControlAutoScaleStats {
+		return &protocol.ControlAutoScaleStats{MaxStreams: 2}
+	})
+	buf.Reset()
+	cc.writeAutoScaleStats(&buf)
+	stats, err := protocol.ReadControlAutoScaleStats(&buf)
+	if err != nil || stats.MaxStreams != 2 || buf.Len() != 0 {
+		t.Fatalf("expected a single legacy CASS frame, got %+v (%v), %d bytes left", stats, err, buf.Len())
+	}
+}
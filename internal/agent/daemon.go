@@ -5,19 +5,26 @@
 package agent
 
 import (
+	"cmp"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"math"
 	"net"
 	"os"
 	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/logging"
 	"github.com/nishisan-dev/n-backup/internal/pki"
 	"github.com/nishisan-dev/n-backup/internal/protocol"
 )
@@ -35,10 +42,12 @@ func RunDaemon(configPath string, cfg *config.AgentConfig, logger *slog.Logger)
 	var controlCh *ControlChannel
 	if cfg.Daemon.ControlChannel.Enabled != nil && *cfg.Daemon.ControlChannel.Enabled {
 		controlCh = NewControlChannel(cfg, logger)
-		controlCh.Start()
 	}
 
 	runFn := func(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, entryLogger *slog.Logger, job *BackupJob) error {
+		if err := checkStorageHealth(ctx, cfg, entry, entryLogger); err != nil {
+			return err
+		}
 		return RunBackupWithRetry(ctx, cfg, entry, entryLogger, nil, job, controlCh)
 	}
 
@@ -49,6 +58,9 @@ func RunDaemon(configPath string, cfg *config.AgentConfig, logger *slog.Logger)
 
 	sched.Start()
 
+	// Catch-up de execuções perdidas enquanto o daemon estava parado (apenas no start)
+	sched.CatchUp()
+
 	// System monitor — coleta métricas a cada 15s
 	sysMonitor := NewSystemMonitor(logger)
 	sysMonitor.Start()
@@ -73,6 +85,43 @@ func RunDaemon(configPath string, cfg *config.AgentConfig, logger *slog.Logger)
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
 
+	// Admin socket local — mantido entre reloads (o path só muda com restart)
+	backend := &daemonAdmin{sigCh: sigCh}
+	backend.sched.Store(sched)
+
+	// ControlAbort do server cancela o backup da sessão no scheduler corrente
+	onAbort := func(abort *protocol.ControlAbort) {
+		reason := "aborted by server: " + protocol.AbortReasonString(abort.Reason)
+		if names := backend.sched.Load().AbortSession(abort.SessionID, reason); len(names) > 0 {
+			logger.Warn("backups aborted by server", "backups", names, "reason", reason)
+		}
+	}
+	// Execução coordenada (snapshot_groups): o server inicia a fase de
+	// snapshot e depois libera ou cancela a transferência
+	onSnapshotPrepare := func(prep *protocol.ControlSnapshotPrepare) {
+		if err := backend.sched.Load().PrepareSnapshot(prep.SnapshotID, prep.Backup); err != nil {
+			logger.Warn("coordinated snapshot refused", "snapshot", prep.SnapshotID, "backup", prep.Backup, "error", err)
+		}
+	}
+	onSnapshotRelease := func(rel *protocol.ControlSnapshotRelease) {
+		if !backend.sched.Load().ReleaseSnapshot(rel.SnapshotID, rel.Proceed) {
+			logger.Warn("snapshot release for unknown snapshot", "snapshot", rel.SnapshotID)
+		}
+	}
+	if controlCh != nil {
+		controlCh.SetOnAbort(onAbort)
+		controlCh.SetOnSnapshot(onSnapshotPrepare, onSnapshotRelease)
+		controlCh.Start()
+	}
+	var admin *AdminServer
+	if cfg.Daemon.AdminSocket.Enabled != nil && *cfg.Daemon.AdminSocket.Enabled {
+		admin = NewAdminServer(cfg.Daemon.AdminSocket.Path, backend, logger)
+		if err := admin.Start(); err != nil {
+			logger.Error("admin socket unavailable", "error", err)
+			admin = nil
+		}
+	}
+
 	for {
 		sig := <-sigCh
 
@@ -84,139 +133,405 @@ func RunDaemon(configPath string, cfg *config.AgentConfig, logger *slog.Logger)
 				logger.Error("reload failed, keeping current config", "error", loadErr)
 				continue
 			}
+			newCfg.WarnMigrations(logger)
+
+			// Valida a nova config montando o scheduler antes de desmontar o atual:
+			// uma config com schedule inválido mantém tudo como está.
+			// O control channel só é recriado se seus parâmetros de conexão mudaram;
+			// backups em andamento continuam (o BackupJob é reaproveitado por nome).
+			keepControl := controlChannelUnchanged(cfg, newCfg)
+			nextControl := controlCh
+			if !keepControl {
+				nextControl = nil
+				if newCfg.Daemon.ControlChannel.Enabled != nil && *newCfg.Daemon.ControlChannel.Enabled {
+					nextControl = NewControlChannel(newCfg, logger)
+				}
+			}
 
-			// Para scheduler, stats e control channel atuais
-			stopCtx, stopCancel := context.WithTimeout(context.Background(), 10*time.Second)
-			stats.Stop()
-			sysMonitor.Stop()
-			sched.Stop(stopCtx)
-			if controlCh != nil {
-				controlCh.Stop()
+			newSched, schedErr := ReloadScheduler(sched, newCfg, logger, runFn, nextControl)
+			if schedErr != nil {
+				logger.Error("reload failed, keeping current config", "error", schedErr)
+				continue
 			}
-			stopCancel()
 
-			// Recria com nova config
-			cfg = newCfg
+			logReloadChanges(logger, cfg, newCfg)
 
-			// Recria control channel se habilitado na nova config
-			controlCh = nil
-			if cfg.Daemon.ControlChannel.Enabled != nil && *cfg.Daemon.ControlChannel.Enabled {
-				controlCh = NewControlChannel(cfg, logger)
-				controlCh.Start()
+			stats.Stop()
+			sched.Detach()
+			if !keepControl {
+				if controlCh != nil {
+					controlCh.Stop()
+				}
+				controlCh = nextControl
+				if controlCh != nil {
+					controlCh.SetOnAbort(onAbort)
+					controlCh.SetOnSnapshot(onSnapshotPrepare, onSnapshotRelease)
+					controlCh.Start()
+					controlCh.SetStatsProvider(func() *protocol.ControlStats {
+						s := sysMonitor.Stats()
+						return &protocol.ControlStats{
+							CPUPercent:       float32(s.CPUPercent),
+							MemoryPercent:    float32(s.MemoryPercent),
+							DiskUsagePercent: float32(s.DiskUsagePercent),
+							LoadAverage:      float32(s.LoadAverage),
+						}
+					})
+				}
+				logger.Info("control channel restarted with new settings")
 			}
-
-			sched, err = NewScheduler(cfg, logger, runFn, controlCh)
-			if err != nil {
-				logger.Error("failed to create scheduler after reload", "error", err)
-				return fmt.Errorf("reload scheduler: %w", err)
+			if newCfg.Logging.Level != cfg.Logging.Level {
+				logging.SetLevel(newCfg.Logging.Level)
+			}
+			if err := logging.SetRedaction(newCfg.Logging.Redact.Patterns, newCfg.Logging.Redact.Replacement); err != nil {
+				logger.Warn("keeping previous redact patterns", "error", err)
 			}
+			logging.SetSampling(newCfg.Logging.Sampling.SampleRules())
+			logging.SetRotation(newCfg.Logging.Rotation.LogRotation())
+
+			cfg = newCfg
+			sched = newSched
 			sched.Start()
+			backend.sched.Store(sched)
 
-			// Recria SystemMonitor
-			sysMonitor = NewSystemMonitor(logger)
-			sysMonitor.Start()
-
-			if controlCh != nil {
-				controlCh.SetStatsProvider(func() *protocol.ControlStats {
-					s := sysMonitor.Stats()
-					return &protocol.ControlStats{
-						CPUPercent:       float32(s.CPUPercent),
-						MemoryPercent:    float32(s.MemoryPercent),
-						DiskUsagePercent: float32(s.DiskUsagePercent),
-						LoadAverage:      float32(s.LoadAverage),
-					}
-				})
-			}
 			stats = NewStatsReporter(sched, logger)
 			stats.Start()
 
 			logger.Info("config reloaded successfully",
 				"agent", cfg.Agent.Name,
 				"backups", len(cfg.Backups),
+				"control_channel_kept", keepControl,
 			)
 			continue
 		}
 
-		// SIGTERM ou SIGINT — graceful shutdown
+		// SIGTERM ou SIGINT — graceful shutdown conforme daemon.shutdown.
+		// O control channel só é fechado depois, para notificar o server das
+		// sessões abortadas.
 		logger.Info("received signal, shutting down", "signal", sig)
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		stats.Stop()
 		sysMonitor.Stop()
-		sched.Stop(ctx)
+		shutdownErr := shutdownScheduler(sched, cfg.Daemon.Shutdown, sigCh, logger)
 		if controlCh != nil {
 			controlCh.Stop()
 		}
-		cancel()
+		if admin != nil {
+			admin.Stop()
+		}
+		return shutdownErr
+	}
+}
+
+// shutdownAbortGrace é o tempo dado aos backups abortados para fechar as
+// conexões e registrar o resultado antes de o daemon sair.
+const shutdownAbortGrace = 30 * time.Second
+
+// ErrShutdownAborted indica que o daemon encerrou abortando backups em andamento.
+var ErrShutdownAborted = errors.New("in-flight backups aborted by shutdown")
+
+// shutdownScheduler para o scheduler aplicando daemon.shutdown: no modo wait
+// aguarda os backups em andamento até o timeout e só então os aborta; no modo
+// abort aborta imediatamente. Um segundo SIGTERM/SIGINT durante a espera
+// antecipa o abort. Retorna ErrShutdownAborted se algum backup foi abortado.
+func shutdownScheduler(sched *Scheduler, sd config.ShutdownConfig, sigCh <-chan os.Signal, logger *slog.Logger) error {
+	const reason = "aborted by daemon shutdown"
+
+	running := sched.Running()
+	wait := sd.Timeout
+	var aborted []string
+	switch {
+	case len(running) == 0:
+		// Nada em andamento: apenas esperas de jitter/triggers, encerradas pelo Stop
+		wait = shutdownAbortGrace
+	case sd.Mode == config.ShutdownModeAbort:
+		logger.Warn("shutdown: aborting in-flight backups", "backups", running, "mode", sd.Mode)
+		aborted = sched.AbortRunning(reason)
+		wait = shutdownAbortGrace
+	default:
+		logger.Info("shutdown: waiting for in-flight backups to finish", "backups", running, "timeout", wait)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				if sig == syscall.SIGHUP {
+					logger.Warn("shutdown in progress, ignoring reload")
+					continue
+				}
+				logger.Warn("shutdown: second signal received, aborting in-flight backups now", "signal", sig)
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if !sched.Stop(ctx) {
+		still := sched.AbortRunning(reason)
+		if len(still) > 0 && len(aborted) == 0 {
+			logger.Warn("shutdown: aborting in-flight backups", "backups", still, "mode", sd.Mode)
+		}
+		aborted = append(aborted, still...)
+		graceCtx, graceCancel := context.WithTimeout(context.Background(), shutdownAbortGrace)
+		sched.Wait(graceCtx)
+		graceCancel()
+	}
+
+	if len(aborted) == 0 {
+		if len(running) > 0 {
+			logger.Info("shutdown: in-flight backups finished before exiting", "backups", running)
+		}
+		return nil
+	}
+	slices.Sort(aborted)
+	aborted = slices.Compact(aborted)
+	return fmt.Errorf("%w: %s", ErrShutdownAborted, strings.Join(aborted, ", "))
+}
+
+// controlChannelUnchanged indica se os parâmetros usados pelo control channel
+// (endereço do server, TLS, nome do agent e daemon.control_channel) são iguais
+// nas duas configs — nesse caso a conexão é mantida no reload.
+func controlChannelUnchanged(old, cur *config.AgentConfig) bool {
+	return old.Agent == cur.Agent &&
+		old.Server == cur.Server &&
+		old.TLS == cur.TLS &&
+		reflect.DeepEqual(old.Daemon.ControlChannel, cur.Daemon.ControlChannel)
+}
+
+// logReloadChanges registra os entries adicionados, removidos e alterados por um reload.
+func logReloadChanges(logger *slog.Logger, old, cur *config.AgentConfig) {
+	prev := make(map[string]config.BackupEntry, len(old.Backups))
+	for _, e := range old.Backups {
+		prev[e.Name] = e
+	}
+	for _, e := range cur.Backups {
+		p, ok := prev[e.Name]
+		switch {
+		case !ok:
+			logger.Info("reload: backup entry added", "backup", e.Name, "schedule", e.Schedule)
+		case p.Schedule != e.Schedule:
+			logger.Info("reload: backup schedule changed", "backup", e.Name, "old", p.Schedule, "new", e.Schedule)
+		case !reflect.DeepEqual(p, e):
+			logger.Info("reload: backup entry changed", "backup", e.Name)
+		}
+		delete(prev, e.Name)
+	}
+	for name := range prev {
+		logger.Info("reload: backup entry removed", "backup", name)
+	}
+}
+
+// daemonAdmin implementa AdminBackend sobre o scheduler corrente do daemon.
+// O scheduler é trocado a cada reload; o reload em si é delegado ao loop de
+// signals (equivalente a um SIGHUP).
+type daemonAdmin struct {
+	sched atomic.Pointer[Scheduler]
+	sigCh chan os.Signal
+}
+
+func (d *daemonAdmin) Status() []EntryStatus {
+	return d.sched.Load().LiveStatus()
+}
+
+func (d *daemonAdmin) Trigger(name string, force bool) error {
+	return d.sched.Load().Trigger(name, force)
+}
+
+func (d *daemonAdmin) Cancel(name string) error {
+	return d.sched.Load().Cancel(name)
+}
+
+func (d *daemonAdmin) Reload() error {
+	select {
+	case d.sigCh <- syscall.SIGHUP:
 		return nil
+	default:
+		return fmt.Errorf("a signal is already pending, try again")
 	}
 }
 
-// RunAllBackups executa todos os blocos de backup sequencialmente com retry.
-// Se showProgress for true, exibe barra de progresso no terminal.
-func RunAllBackups(ctx context.Context, cfg *config.AgentConfig, showProgress bool, logger *slog.Logger) error {
-	var firstErr error
+// RunAllBackups executa todos os blocos de backup com retry, por ordem de
+// backups[].priority (maior primeiro; no empate, a ordem da config). Com
+// daemon.max_concurrent_backups > 1 executa até esse número de entries em
+// paralelo; caso contrário, sequencialmente. daemon.bandwidth_limit limita a
+// banda somada das execuções.
+// Se showProgress for true, exibe barra de progresso no terminal (apenas em
+// execuções sequenciais).
+// Se force for true, ignora o min_interval dos entries.
+// Retorna o resultado de cada entry na ordem da config (para --output json) e
+// o erro do primeiro que falhou.
+func RunAllBackups(ctx context.Context, cfg *config.AgentConfig, showProgress, force bool, logger *slog.Logger) ([]BackupResult, error) {
+	// Execuções manuais também contam como último sucesso para o catch-up do daemon
+	state, stateErr := LoadScheduleState(cfg.Daemon.StateDir)
+	if stateErr != nil {
+		logger.Warn("schedule state unavailable", "error", stateErr)
+	}
 
-	for _, entry := range cfg.Backups {
-		entryLogger := logger.With("backup", entry.Name, "storage", entry.Storage)
-		entryLogger.Info("starting backup entry")
+	pool := newBackupPool(cfg.Daemon)
+	results := make([]BackupResult, len(cfg.Backups))
+	errs := make([]error, len(cfg.Backups))
+	order := priorityOrder(cfg.Backups)
 
-		var progress *ProgressReporter
+	if cfg.Daemon.MaxConcurrentBackups > 1 && len(cfg.Backups) > 1 {
 		if showProgress {
-			sources := make([]string, len(entry.Sources))
-			for i, s := range entry.Sources {
-				sources[i] = s.Path
+			logger.Warn("progress bar disabled: backups run concurrently (max_concurrent_backups)",
+				"max_concurrent_backups", cfg.Daemon.MaxConcurrentBackups)
+			showProgress = false
+		}
+		var wg sync.WaitGroup
+		for _, i := range order {
+			entry := cfg.Backups[i]
+			release, err := pool.acquire(ctx, entry.Name, entry.Priority, nil)
+			if err != nil {
+				errs[i] = fmt.Errorf("backup %q failed: %w", entry.Name, err)
+				results[i] = BackupResult{Backup: entry.Name, Storage: entry.Storage, Status: "failed", Error: err.Error()}
+				continue
 			}
-			// Inicia reporter imediatamente em modo spinner (totais=0)
-			progress = NewProgressReporter(entry.Name, 0, 0)
-			// PreScan em background — atualiza totais quando terminar
+			wg.Add(1)
 			go func() {
-				scanner := NewScanner(sources, entry.Exclude)
-				stats, err := scanner.PreScan(ctx)
-				if err != nil {
-					entryLogger.Warn("pre-scan failed, progress bar will estimate", "error", err)
-					return
-				}
-				entryLogger.Info("pre-scan complete",
-					"files", stats.TotalObjects,
-					"raw_bytes", stats.TotalBytes,
-				)
-				estimatedCompressed := stats.TotalBytes / 2
-				if estimatedCompressed == 0 {
-					estimatedCompressed = stats.TotalBytes
-				}
-				progress.SetTotals(estimatedCompressed, stats.TotalObjects)
+				defer wg.Done()
+				defer release()
+				results[i], errs[i] = runOnceEntry(ctx, cfg, entry, pool, state, showProgress, force, logger)
 			}()
 		}
+		wg.Wait()
+	} else {
+		for _, i := range order {
+			results[i], errs[i] = runOnceEntry(ctx, cfg, cfg.Backups[i], pool, state, showProgress, force, logger)
+		}
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// priorityOrder retorna os índices de entries por priority decrescente,
+// preservando a ordem da config no empate.
+func priorityOrder(entries []config.BackupEntry) []int {
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(entries[b].Priority, entries[a].Priority)
+	})
+	return order
+}
 
-		err := RunBackupWithRetry(ctx, cfg, entry, entryLogger, progress, nil, nil)
+// runOnceEntry executa um backup entry de RunAllBackups e registra o
+// resultado no state.
+func runOnceEntry(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, pool *backupPool, state *ScheduleState, showProgress, force bool, logger *slog.Logger) (BackupResult, error) {
+	entryLogger := logger.With("backup", entry.Name, "storage", entry.Storage)
 
-		if progress != nil {
-			progress.Stop()
+	if remaining := state.MinIntervalRemaining(entry, time.Now()); remaining > 0 {
+		if !force {
+			entryLogger.Warn("backup suppressed: min_interval since last success not elapsed (use --force to override)",
+				"min_interval", entry.MinInterval,
+				"retry_after", remaining.Round(time.Second),
+			)
+			return BackupResult{
+				Backup:  entry.Name,
+				Storage: entry.Storage,
+				Status:  ResultSkipped,
+				Error:   fmt.Sprintf("min_interval not elapsed (retry after %s)", remaining.Round(time.Second)),
+			}, nil
 		}
+		entryLogger.Info("min_interval not elapsed, running anyway due to --force", "min_interval", entry.MinInterval)
+	}
 
-		if err != nil {
-			entryLogger.Error("backup entry failed", "error", err)
-			if firstErr == nil {
-				firstErr = fmt.Errorf("backup %q failed: %w", entry.Name, err)
+	entryLogger.Info("starting backup entry")
+
+	var progress *ProgressReporter
+	if showProgress {
+		// Inicia reporter imediatamente em modo spinner (totais=0)
+		progress = NewProgressReporter(entry.Name, 0, 0)
+		// PreScan em background — atualiza totais quando terminar
+		go func() {
+			scanner := NewEntryScanner(entry)
+			stats, err := scanner.PreScan(ctx)
+			if err != nil {
+				entryLogger.Warn("pre-scan failed, progress bar will estimate", "error", err)
+				return
 			}
-			continue
-		}
+			entryLogger.Info("pre-scan complete",
+				"files", stats.TotalObjects,
+				"raw_bytes", stats.TotalBytes,
+			)
+			progress.SetTotals(stats.TotalBytes, stats.TotalObjects)
+		}()
+	}
+
+	// Job local apenas para coletar o tamanho do archive para o histórico
+	// (e aplicar o limite de banda combinado do pool)
+	job := &BackupJob{Entry: entry, pool: pool}
+	hc := newHealthcheckPinger(entry, entryLogger)
+	hc.Start(ctx)
+	start := time.Now()
+	err := RunBackupWithRetry(ctx, cfg, entry, entryLogger, progress, job, nil)
+	run := JobRun{
+		Start:           start,
+		DurationSeconds: time.Since(start).Seconds(),
+		Bytes:           atomic.LoadInt64(&job.runBytes),
+		Status:          "completed",
+		Config:          newEntryConfigSnapshot(cfg, entry),
+		MissingSources:  job.MissingSources(),
+	}
+	if err == nil {
+		run.Empty = job.runEmpty.Load()
+	}
 
+	if progress != nil {
+		progress.Stop()
+	}
+
+	if err != nil {
+		entryLogger.Error("backup entry failed", "error", err)
+		run.Status, run.Error = "failed", err.Error()
+		if errors.Is(err, ErrBackupDeferred) || errors.Is(err, ErrLocalTargetUnavailable) {
+			run.Status = "deferred"
+		}
+		err = fmt.Errorf("backup %q failed: %w", entry.Name, err)
+	} else if len(run.MissingSources) > 0 {
+		entryLogger.Warn("backup entry completed without optional sources", "missing", run.MissingSources)
+	} else {
 		entryLogger.Info("backup entry completed successfully")
 	}
 
-	return firstErr
+	if recErr := state.Record(entry.Name, run); recErr != nil {
+		entryLogger.Warn("failed to persist schedule state", "error", recErr)
+	}
+	// Síncrono: o processo termina logo após a última entry
+	hc.Finish(context.Background(), run)
+	return newBackupResult(entry, run, job), err
 }
 
 // RunBackupWithRetry executa um backup entry com retry usando exponential backoff.
 func RunBackupWithRetry(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, logger *slog.Logger, progress *ProgressReporter, job *BackupJob, controlCh *ControlChannel) error {
 	var lastErr error
 
+	// Sources ausentes: obrigatórios falham sem retry; opcionais são removidos do entry
+	entry, missing, err := checkSources(entry)
+	job.setMissingSources(missing)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		logger.Warn("optional source paths missing, continuing without them", "missing", missing)
+	}
+
 	for attempt := 0; attempt < cfg.Retry.MaxAttempts; attempt++ {
 		if attempt > 0 {
 			if progress != nil {
 				progress.AddRetry()
 			}
+			job.addRunRetry()
 			delay := calculateBackoff(attempt, cfg.Retry.InitialDelay, cfg.Retry.MaxDelay)
 			logger.Info("retrying backup",
 				"attempt", attempt+1,
@@ -235,6 +550,31 @@ func RunBackupWithRetry(ctx context.Context, cfg *config.AgentConfig, entry conf
 			return nil
 		}
 
+		if errors.Is(err, ErrBackupDeferred) {
+			logger.Info("backup deferred by server, skipping retries", "reason", err)
+			return err
+		}
+		if errors.Is(err, ErrAgentUnauthorized) {
+			logger.Error("agent not authorized by server, skipping retries", "reason", err)
+			return err
+		}
+		if errors.Is(err, protocol.ErrInvalidVersion) {
+			logger.Error("no protocol version in common with the server, skipping retries", "reason", err)
+			return err
+		}
+		if errors.Is(err, ErrLocalTargetUnavailable) {
+			logger.Warn("local backup target unavailable, skipping retries", "reason", err)
+			return err
+		}
+		if errors.Is(err, ErrAssertionFailed) {
+			logger.Error("backup assertions not met, skipping retries", "reason", err)
+			return err
+		}
+		if errors.Is(err, ErrMaxSizeExceeded) {
+			logger.Error("backup exceeded max_size, skipping retries", "reason", err)
+			return err
+		}
+
 		lastErr = err
 		logger.Warn("backup attempt failed",
 			"attempt", attempt+1,
@@ -254,11 +594,13 @@ func calculateBackoff(attempt int, initialDelay, maxDelay time.Duration) time.Du
 	return delay
 }
 
-// RunHealthCheck executa um health check contra o servidor.
-func RunHealthCheck(address string, cfg *config.AgentConfig, logger *slog.Logger) error {
-	tlsCfg, err := loadClientTLS(cfg)
+// QueryHealth consulta o health check do server: com storage vazio, o status
+// geral e o menor espaço livre entre os storages (PING); com storage, o status
+// e o espaço livre daquele storage (PSTG).
+func QueryHealth(ctx context.Context, address string, cfg *config.AgentConfig, storage string, logger *slog.Logger) (*protocol.HealthResponse, error) {
+	tlsCfg, err := loadClientTLS(cfg, logger)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Extrai hostname para ServerName
@@ -268,48 +610,172 @@ func RunHealthCheck(address string, cfg *config.AgentConfig, logger *slog.Logger
 	}
 	tlsCfg.ServerName = host
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	conn, err := dialWithContext(ctx, address, tlsCfg)
+	conn, err := dialWithContext(ctx, cfg, address, tlsCfg)
 	if err != nil {
-		return fmt.Errorf("connecting for health check: %w", err)
+		return nil, fmt.Errorf("connecting for health check: %w", err)
 	}
 	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
 
-	// Envia PING
-	if _, err := conn.Write([]byte("PING")); err != nil {
-		return fmt.Errorf("sending ping: %w", err)
+	if storage == "" {
+		err = protocol.WritePing(conn)
+	} else {
+		err = protocol.WritePingStorage(conn, storage)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sending ping: %w", err)
 	}
 
-	// Lê resposta (status 1B + diskFree 8B + '\n' 1B = 10B)
-	buf := make([]byte, 10)
-	n, err := io.ReadFull(conn, buf)
+	resp, err := protocol.ReadHealthResponse(conn)
 	if err != nil {
-		return fmt.Errorf("reading health response: %w", err)
+		return nil, fmt.Errorf("reading health response: %w", err)
 	}
+	return resp, nil
+}
+
+// storageHealthTimeout limita a consulta de espaço livre antes de um backup.
+const storageHealthTimeout = 10 * time.Second
 
-	if n < 1 {
-		return fmt.Errorf("empty health response")
+// checkStorageHealth aplica backups[].min_storage_free antes de uma execução:
+// consulta o storage no server (PSTG) e adia o backup (ErrBackupDeferred) se
+// o espaço livre estiver abaixo do mínimo ou o server reportar LOW DISK.
+// Falhas na consulta (server antigo, rede) não bloqueiam o backup — o
+// handshake reporta o erro real.
+func checkStorageHealth(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, logger *slog.Logger) error {
+	if entry.MinStorageFreeRaw <= 0 {
+		return nil
+	}
+	qctx, cancel := context.WithTimeout(ctx, storageHealthTimeout)
+	defer cancel()
+	resp, err := QueryHealth(qctx, cfg.Server.Address, cfg, entry.Storage, logger)
+	if err != nil {
+		logger.Warn("storage health check failed, starting backup anyway", "storage", entry.Storage, "error", err)
+		return nil
+	}
+	switch {
+	case resp.Status == protocol.HealthStatusNotFound:
+		return nil
+	case resp.Status == protocol.HealthStatusLowDisk:
+		return fmt.Errorf("%w: storage %s reports low disk (%s free)", ErrBackupDeferred, entry.Storage, formatBytes(int64(resp.DiskFree)))
+	case resp.DiskFree < uint64(entry.MinStorageFreeRaw):
+		return fmt.Errorf("%w: storage %s has %s free, min_storage_free %s", ErrBackupDeferred, entry.Storage, formatBytes(int64(resp.DiskFree)), entry.MinStorageFree)
 	}
+	return nil
+}
 
-	status := buf[0]
+// healthStatusString retorna o nome legível de um status de health check.
+func healthStatusString(status byte) string {
 	switch status {
-	case 0x00:
-		fmt.Println("Server status: READY")
-	case 0x01:
-		fmt.Println("Server status: BUSY")
-	case 0x02:
-		fmt.Println("Server status: LOW DISK")
-	case 0x03:
-		fmt.Println("Server status: MAINTENANCE")
+	case protocol.HealthStatusReady:
+		return "READY"
+	case protocol.HealthStatusBusy:
+		return "BUSY"
+	case protocol.HealthStatusLowDisk:
+		return "LOW DISK"
+	case protocol.HealthStatusMaintenance:
+		return "MAINTENANCE"
+	case protocol.HealthStatusNotFound:
+		return "NOT FOUND"
 	default:
-		fmt.Printf("Server status: UNKNOWN (0x%02x)\n", status)
+		return fmt.Sprintf("UNKNOWN (0x%02x)", status)
 	}
+}
 
+// RunHealthCheck executa um health check contra o servidor e imprime o status
+// geral e o de cada storage (ver CheckHealth).
+func RunHealthCheck(address string, cfg *config.AgentConfig, storage string, logger *slog.Logger) error {
+	rep, err := CheckHealth(address, cfg, storage, logger)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Server status: %s\n", rep.Status)
+	fmt.Printf("Disk free: %s (lowest among storages)\n", formatBytes(int64(rep.DiskFree)))
+	for _, st := range rep.Storages {
+		switch {
+		case st.Error != "":
+			fmt.Printf("Storage %s: unavailable (%s)\n", st.Name, st.Error)
+		case st.Status == healthStatusString(protocol.HealthStatusNotFound):
+			fmt.Printf("Storage %s: %s\n", st.Name, st.Status)
+		default:
+			fmt.Printf("Storage %s: %s, %s free\n", st.Name, st.Status, formatBytes(int64(st.DiskFree)))
+		}
+	}
 	return nil
 }
 
-func loadClientTLS(cfg *config.AgentConfig) (*tls.Config, error) {
-	return pki.NewClientTLSConfig(cfg.TLS.CACert, cfg.TLS.ClientCert, cfg.TLS.ClientKey)
+// CheckHealth consulta o status geral do servidor e o de cada storage: o
+// pedido em storage ou, se vazio, os usados pelos backups da config. Servers
+// sem suporte a PSTG omitem os storages. Com storage explícito, uma falha na
+// consulta do storage é retornada como erro, junto com o report parcial.
+func CheckHealth(address string, cfg *config.AgentConfig, storage string, logger *slog.Logger) (*HealthReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rep := &HealthReport{Address: address, Storages: []StorageHealth{}}
+	resp, err := QueryHealth(ctx, address, cfg, "", logger)
+	if err != nil {
+		rep.Status, rep.Error = "UNAVAILABLE", err.Error()
+		return rep, err
+	}
+	rep.Status, rep.DiskFree = healthStatusString(resp.Status), resp.DiskFree
+
+	storages := []string{storage}
+	if storage == "" {
+		storages = nil
+		for _, b := range cfg.Backups {
+			if !b.Local.Enabled() && !slices.Contains(storages, b.Storage) {
+				storages = append(storages, b.Storage)
+			}
+		}
+	}
+	for _, name := range storages {
+		resp, err := QueryHealth(ctx, address, cfg, name, logger)
+		if err != nil {
+			if storage != "" {
+				rep.Error = err.Error()
+				return rep, err
+			}
+			rep.Storages = append(rep.Storages, StorageHealth{Name: name, Status: "UNAVAILABLE", Error: err.Error()})
+			continue
+		}
+		st := StorageHealth{Name: name, Status: healthStatusString(resp.Status)}
+		if resp.Status != protocol.HealthStatusNotFound {
+			st.DiskFree = resp.DiskFree
+		}
+		rep.Storages = append(rep.Storages, st)
+	}
+	return rep, nil
+}
+
+// clientCertReloaders guarda um pki.CertReloader por combinação de arquivos
+// (ca|cert|key), compartilhado por backups, control channel e health checks.
+// Rotações de certificado no disco valem para o próximo handshake sem
+// reiniciar o daemon — inclusive reconexões de streams de um backup em curso.
+var clientCertReloaders sync.Map
+
+// loadClientTLS retorna uma nova configuração TLS de client a partir do
+// reloader compartilhado para os arquivos configurados. Com tls.auth psk, a
+// configuração só valida o server pela CA (sem certificado de client). Com
+// server.transport unix não há TLS: a configuração retornada é vazia e não é
+// usada no dial.
+func loadClientTLS(cfg *config.AgentConfig, logger *slog.Logger) (*tls.Config, error) {
+	if cfg.Server.Transport == config.TransportUnix {
+		return &tls.Config{}, nil
+	}
+	if cfg.TLS.Auth == config.AuthModePSK {
+		return pki.NewPSKClientTLSConfig(cfg.TLS.CACert)
+	}
+	key := cfg.TLS.CACert + "|" + cfg.TLS.ClientCert + "|" + cfg.TLS.ClientKey
+	if r, ok := clientCertReloaders.Load(key); ok {
+		return r.(*pki.CertReloader).ClientTLSConfig(), nil
+	}
+
+	r, err := pki.NewCertReloader(cfg.TLS.CACert, cfg.TLS.ClientCert, cfg.TLS.ClientKey, logger.With("component", "tls"))
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := clientCertReloaders.LoadOrStore(key, r)
+	return actual.(*pki.CertReloader).ClientTLSConfig(), nil
 }
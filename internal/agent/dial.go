@@ -0,0 +1,212 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/sockopt"
+)
+
+// fallbackDelay é a vantagem da família preferida antes que a outra entre na
+// corrida (RFC 6555 recomenda 150–250ms).
+const fallbackDelay = 250 * time.Millisecond
+
+// minAttemptTimeout é o piso do timeout de cada endereço quando o deadline do
+// dial é dividido entre vários endereços da mesma família.
+const minAttemptTimeout = 2 * time.Second
+
+// directDialer disca TCP sem proxy, no estilo happy eyeballs (RFC 6555): os
+// endereços da família preferida são tentados primeiro e, se nenhum conectar
+// em fallbackDelay, a outra família corre em paralelo. Uma rota IPv6 quebrada
+// custa 250ms em vez do timeout TCP inteiro. Implementa proxy.ContextDialer
+// para servir também de dialer até o proxy.
+type directDialer struct {
+	prefer string              // server.prefer
+	socket config.SocketConfig // server.socket
+}
+
+// Dial disca sem contexto (interface proxy.Dialer).
+func (d directDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext conecta a address, respeitando server.prefer.
+func (d directDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.prefer == "" || d.prefer == config.PreferAuto {
+		// net.Dialer já corre as famílias, começando pela do primeiro
+		// endereço devolvido pelo resolver
+		dialer := sockopt.Dialer(d.socket)
+		dialer.FallbackDelay = fallbackDelay
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	primaries, fallbacks, err := resolvePreferred(ctx, address, d.prefer)
+	if err != nil {
+		return nil, err
+	}
+	return dialParallel(ctx, primaries, fallbacks, func(ctx context.Context, addr string) (net.Conn, error) {
+		return sockopt.Dialer(d.socket).DialContext(ctx, network, addr)
+	})
+}
+
+// resolvePreferred resolve o host de address e separa os endereços da família
+// preferida (primaries) dos demais. Sem endereço da família preferida, a
+// outra vira a primária.
+func resolvePreferred(ctx context.Context, address, prefer string) (primaries, fallbacks []string, err error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ips []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips = []netip.Addr{ip}
+	} else if ips, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host); err != nil {
+		return nil, nil, err
+	}
+
+	for _, ip := range ips {
+		addr := net.JoinHostPort(ip.Unmap().String(), port)
+		if ip.Unmap().Is4() == (prefer == config.PreferIPv4) {
+			primaries = append(primaries, addr)
+		} else {
+			fallbacks = append(fallbacks, addr)
+		}
+	}
+	if len(primaries) == 0 {
+		primaries, fallbacks = fallbacks, nil
+	}
+	if len(primaries) == 0 {
+		return nil, nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	return primaries, fallbacks, nil
+}
+
+// dialParallel corre primaries contra fallbacks, dando fallbackDelay de
+// vantagem a primaries (que também sobem logo a corrida se falharem antes).
+// A primeira conexão vence; a outra corrida é cancelada e sua conexão,
+// se chegar, é fechada.
+func dialParallel(ctx context.Context, primaries, fallbacks []string, dial func(context.Context, string) (net.Conn, error)) (net.Conn, error) {
+	if len(fallbacks) == 0 {
+		return dialSerial(ctx, primaries, dial)
+	}
+
+	type dialResult struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	returned := make(chan struct{})
+	defer close(returned)
+	results := make(chan dialResult)
+
+	race := func(addrs []string, primary bool) {
+		conn, err := dialSerial(ctx, addrs, dial)
+		select {
+		case results <- dialResult{conn: conn, err: err, primary: primary}:
+		case <-returned:
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+	go race(primaries, true)
+
+	fallbackTimer := time.NewTimer(fallbackDelay)
+	defer fallbackTimer.Stop()
+
+	var primaryErr error
+	fallbackStarted, pending := false, 1
+	for {
+		select {
+		case <-fallbackTimer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go race(fallbacks, false)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if res.primary {
+				primaryErr = res.err
+				if !fallbackStarted {
+					fallbackStarted = true
+					pending++
+					go race(fallbacks, false)
+				}
+			}
+			if pending == 0 {
+				if primaryErr != nil {
+					return nil, primaryErr
+				}
+				return nil, res.err
+			}
+		}
+	}
+}
+
+// dialSerial tenta addrs em ordem. Com deadline, cada endereço recebe uma
+// fatia do tempo restante (mínimo minAttemptTimeout), para que um endereço
+// que não responde não consuma o deadline dos seguintes.
+func dialSerial(ctx context.Context, addrs []string, dial func(context.Context, string) (net.Conn, error)) (net.Conn, error) {
+	var firstErr error
+	for i, addr := range addrs {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok && i < len(addrs)-1 {
+			slice := time.Until(deadline) / time.Duration(len(addrs)-i)
+			if slice < minAttemptTimeout {
+				slice = minAttemptTimeout
+			}
+			attemptCtx, cancel = context.WithTimeout(ctx, slice)
+		}
+		conn, err := dial(attemptCtx, addr)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// preferredUDPAddr resolve address para o dial QUIC respeitando server.prefer.
+// QUIC não corre famílias: usa o primeiro endereço da família preferida.
+func preferredUDPAddr(ctx context.Context, address, prefer string) (*net.UDPAddr, error) {
+	if prefer == "" || prefer == config.PreferAuto {
+		return net.ResolveUDPAddr("udp", address)
+	}
+	primaries, _, err := resolvePreferred(ctx, address, prefer)
+	if err != nil {
+		return nil, err
+	}
+	ap, err := netip.ParseAddrPort(primaries[0])
+	if err != nil {
+		return nil, err
+	}
+	return net.UDPAddrFromAddrPort(ap), nil
+}
+
+// dialUnix conecta ao socket unix de um listener local do server
+// (server.transport: unix). A conexão segue sem TLS nem auth psk: o server
+// identifica o agent pelo uid do processo (SO_PEERCRED).
+func dialUnix(ctx context.Context, path string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", path)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestDialParallel_FallbackWinsWhenPreferredHangs(t *testing.T) {
+	var primaryCancelled atomic.Bool
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		if addr == "[2001:db8::1]:9847" {
+			// Rota IPv6 quebrada: o SYN nunca é respondido
+			<-ctx.Done()
+			primaryCancelled.Store(true)
+			return nil, ctx.Err()
+		}
+		c, _ := net.Pipe()
+		return c, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	start := time.Now()
+	conn, err := dialParallel(ctx, []string{"[2001:db8::1]:9847"}, []string{"192.0.2.1:9847"}, dial)
+	if err != nil {
+		t.Fatalf("dialParallel: %v", err)
+	}
+	conn.Close()
+	if elapsed := time.Since(start); elapsed < fallbackDelay || elapsed > 2*time.Second {
+		t.Errorf("expected the fallback to connect right after %v, took %v", fallbackDelay, elapsed)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !primaryCancelled.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !primaryCancelled.Load() {
+		t.Error("expected the losing attempt to be cancelled")
+	}
+}
+
+func TestDialParallel_PrimaryFailureStartsFallbackImmediately(t *testing.T) {
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		if addr == "[2001:db8::1]:9847" {
+			return nil, errors.New("network is unreachable")
+		}
+		c, _ := net.Pipe()
+		return c, nil
+	}
+	start := time.Now()
+	conn, err := dialParallel(context.Background(), []string{"[2001:db8::1]:9847"}, []string{"192.0.2.1:9847"}, dial)
+	if err != nil {
+		t.Fatalf("dialParallel: %v", err)
+	}
+	conn.Close()
+	if elapsed := time.Since(start); elapsed >= fallbackDelay {
+		t.Errorf("expected the fallback to start without waiting %v, took %v", fallbackDelay, elapsed)
+	}
+
+	// Ambas as famílias falham: prevalece o erro da preferida
+	failAll := func(ctx context.Context, addr string) (net.Conn, error) { return nil, errors.New("refused " + addr) }
+	_, err = dialParallel(context.Background(), []string{"[2001:db8::1]:9847"}, []string{"192.0.2.1:9847"}, failAll)
+	if err == nil || err.Error() != "refused [2001:db8::1]:9847" {
+		t.Errorf("expected the preferred family error, got %v", err)
+	}
+}
+
+func TestDirectDialer_PreferFallsBackToAvailableFamily(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+
+	// Só há endereço IPv4: prefer ipv6 não pode impedir a conexão
+	primaries, fallbacks, err := resolvePreferred(context.Background(), ln.Addr().String(), config.PreferIPv6)
+	if err != nil || len(primaries) != 1 || len(fallbacks) != 0 {
+		t.Fatalf("unexpected resolution: %v %v %v", primaries, fallbacks, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := directDialer{prefer: config.PreferIPv6}.DialContext(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/notify"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// digestStateFile guarda o instante do último digest enviado (dentro de daemon.state_dir).
+const digestStateFile = "digest-state.json"
+
+// digestSendTimeout limita a entrega do digest em todos os canais.
+const digestSendTimeout = 2 * time.Minute
+
+// DigestEntry resume as execuções de um backup entry na janela do digest.
+type DigestEntry struct {
+	Name           string
+	Storage        string
+	Runs           int
+	Completed      int
+	Failed         int // failed + cancelled
+	Bytes          int64
+	Duration       time.Duration // soma das execuções
+	LastStatus     string        // status da execução mais recente na janela ("" = nenhuma)
+	Errors         []string      // erros distintos, mais recente primeiro
+	MissingSources []string      // sources opcionais ausentes em alguma execução
+}
+
+// Digest agrega as execuções de todos os entries em uma janela (ex: a noite anterior).
+type Digest struct {
+	Agent   string
+	Since   time.Time
+	Until   time.Time
+	Entries []DigestEntry
+}
+
+// BuildDigest agrega o histórico persistido das execuções terminadas em (since, until].
+// Entries da config sem execução na janela são incluídos com LastStatus vazio.
+func BuildDigest(cfg *config.AgentConfig, jobs map[string]JobRunState, since, until time.Time) Digest {
+	d := Digest{Agent: cfg.Agent.Name, Since: since, Until: until}
+	for _, entry := range cfg.Backups {
+		de := DigestEntry{Name: entry.Name, Storage: entry.Storage}
+		seenErr := make(map[string]bool)
+		seenMissing := make(map[string]bool)
+
+		// History está em ordem do mais recente para o mais antigo.
+		for _, run := range jobs[entry.Name].History {
+			end := run.End()
+			if !end.After(since) || end.After(until) {
+				continue
+			}
+			de.Runs++
+			if de.LastStatus == "" {
+				de.LastStatus = run.Status
+			}
+			de.Duration += time.Duration(run.DurationSeconds * float64(time.Second))
+			switch run.Status {
+			case "completed":
+				de.Completed++
+				de.Bytes += run.Bytes
+			case "failed", "cancelled":
+				de.Failed++
+			}
+			if run.Error != "" && !seenErr[run.Error] {
+				seenErr[run.Error] = true
+				de.Errors = append(de.Errors, run.Error)
+			}
+			for _, p := range run.MissingSources {
+				if !seenMissing[p] {
+					seenMissing[p] = true
+					de.MissingSources = append(de.MissingSources, p)
+				}
+			}
+		}
+		d.Entries = append(d.Entries, de)
+	}
+	return d
+}
+
+// HasProblems retorna true se algum entry falhou ou não executou na janela.
+func (d Digest) HasProblems() bool {
+	for _, e := range d.Entries {
+		if e.Failed > 0 || e.Runs == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Subject retorna o assunto da notificação (ex: "[nbackup] web-01: 3 ok, 1 failed, 1 not run").
+func (d Digest) Subject() string {
+	var ok, failed, notRun int
+	for _, e := range d.Entries {
+		switch {
+		case e.Runs == 0:
+			notRun++
+		case e.LastStatus == "completed":
+			ok++
+		default:
+			failed++
+		}
+	}
+	parts := []string{fmt.Sprintf("%d ok", ok)}
+	if failed > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", failed))
+	}
+	if notRun > 0 {
+		parts = append(parts, fmt.Sprintf("%d not run", notRun))
+	}
+	return fmt.Sprintf("[nbackup] %s: %s", d.Agent, strings.Join(parts, ", "))
+}
+
+// Text retorna o relatório em texto plano: uma linha por entry e, em seguida,
+// os erros e sources ausentes de cada entry.
+func (d Digest) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Backup digest for agent %s\n", d.Agent)
+	fmt.Fprintf(&b, "Window: %s -> %s\n\n", d.Since.Format(time.RFC3339), d.Until.Format(time.RFC3339))
+
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BACKUP\tSTORAGE\tSTATUS\tRUNS\tOK\tFAILED\tBYTES\tDURATION")
+	for _, e := range d.Entries {
+		status := e.LastStatus
+		if e.Runs == 0 {
+			status = "not run"
+		} else if status == "completed" && len(e.MissingSources) > 0 {
+			status = "completed (partial)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			e.Name, e.Storage, status, e.Runs, e.Completed, e.Failed,
+			formatBytes(e.Bytes), formatDuration(e.Duration))
+	}
+	tw.Flush()
+
+	for _, e := range d.Entries {
+		if len(e.Errors) == 0 && len(e.MissingSources) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n", e.Name)
+		for _, msg := range e.Errors {
+			fmt.Fprintf(&b, "  error: %s\n", msg)
+		}
+		for _, p := range e.MissingSources {
+			fmt.Fprintf(&b, "  missing optional source: %s\n", p)
+		}
+	}
+	return b.String()
+}
+
+// digestState é o conteúdo de digestStateFile.
+type digestState struct {
+	LastSent time.Time `json:"last_sent"`
+}
+
+// loadDigestLastSent retorna o instante do último digest enviado (zero se nunca).
+func loadDigestLastSent(stateDir string) (time.Time, error) {
+	var st digestState
+	_, err := statefile.ReadDocument(filepath.Join(stateDir, digestStateFile), &st)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reading digest state: %w", err)
+	}
+	return st.LastSent, nil
+}
+
+// saveDigestLastSent persiste o instante do último digest enviado (statefile,
+// gravação atômica).
+func saveDigestLastSent(stateDir string, t time.Time) error {
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return fmt.Errorf("creating state dir: %w", err)
+	}
+	if err := statefile.WriteDocument(filepath.Join(stateDir, digestStateFile), digestState{LastSent: t}, 0644); err != nil {
+		return fmt.Errorf("writing digest state: %w", err)
+	}
+	return nil
+}
+
+// sendDigest agrega as execuções desde o último digest enviado (ou das
+// últimas 24h, no primeiro envio) e entrega o relatório pelos canais de
+// notifications. Com only_on_failure, janelas sem problemas não geram envio.
+func (s *Scheduler) sendDigest() {
+	notifCfg := s.cfg.Notifications
+	stateDir := s.cfg.Daemon.StateDir
+	logger := s.logger.With("component", "digest")
+
+	until := time.Now()
+	since, err := loadDigestLastSent(stateDir)
+	if err != nil {
+		logger.Warn("digest state unavailable, using last 24h", "error", err)
+	}
+	if since.IsZero() {
+		since = until.Add(-24 * time.Hour)
+	}
+
+	d := BuildDigest(s.cfg, s.state.Snapshot(), since, until)
+	if notifCfg.Digest.OnlyOnFailure && !d.HasProblems() {
+		logger.Info("digest skipped, no failures in window", "since", since)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), digestSendTimeout)
+		defer cancel()
+		msg := notify.Message{Subject: d.Subject(), Body: d.Text()}
+		if err := notify.SendAll(ctx, notify.SendersFromConfig(notifCfg), msg); err != nil {
+			// Não avança last_sent: a próxima janela inclui as execuções não reportadas.
+			logger.Error("digest delivery failed", "error", err)
+			return
+		}
+		logger.Info("digest sent", "subject", msg.Subject, "entries", len(d.Entries))
+	}
+
+	if err := saveDigestLastSent(stateDir, until); err != nil {
+		logger.Warn("failed to persist digest state", "error", err)
+	}
+}
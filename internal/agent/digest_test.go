@@ -0,0 +1,191 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func newDigestTestConfig(stateDir string) *config.AgentConfig {
+	return &config.AgentConfig{
+		Agent:  config.AgentInfo{Name: "web-01"},
+		Daemon: config.DaemonInfo{StateDir: stateDir},
+		Backups: []config.BackupEntry{
+			{Name: "app", Storage: "scripts", Schedule: "0 2 * * *"},
+			{Name: "db", Storage: "databases", Schedule: "0 3 * * *"},
+			{Name: "home", Storage: "home-dirs", Schedule: "0 4 * * *"},
+		},
+	}
+}
+
+func TestBuildDigest_AggregatesWindow(t *testing.T) {
+	cfg := newDigestTestConfig("")
+	until := time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)
+	since := until.Add(-24 * time.Hour)
+
+	jobs := map[string]JobRunState{
+		"app": {History: []JobRun{
+			{Start: until.Add(-5 * time.Hour), DurationSeconds: 60, Status: "completed", Bytes: 2048, MissingSources: []string{"/opt/extra"}},
+			{Start: until.Add(-6 * time.Hour), DurationSeconds: 30, Status: "failed", Error: "connection refused"},
+			{Start: since.Add(-time.Hour), DurationSeconds: 10, Status: "failed", Error: "old error"}, // fora da janela
+		}},
+		"db": {History: []JobRun{
+			{Start: until.Add(-4 * time.Hour), DurationSeconds: 120, Status: "failed", Error: "disk full"},
+			{Start: until.Add(-4*time.Hour - time.Minute), DurationSeconds: 5, Status: "failed", Error: "disk full"},
+		}},
+	}
+
+	d := BuildDigest(cfg, jobs, since, until)
+	if len(d.Entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(d.Entries))
+	}
+
+	app := d.Entries[0]
+	if app.Runs != 2 || app.Completed != 1 || app.Failed != 1 || app.Bytes != 2048 || app.LastStatus != "completed" {
+		t.Errorf("unexpected app entry: %+v", app)
+	}
+	if app.Duration != 90*time.Second {
+		t.Errorf("expected app duration 90s, got %s", app.Duration)
+	}
+	if len(app.Errors) != 1 || app.Errors[0] != "connection refused" {
+		t.Errorf("expected only in-window error, got %v", app.Errors)
+	}
+
+	db := d.Entries[1]
+	if db.Failed != 2 || len(db.Errors) != 1 {
+		t.Errorf("expected 2 failures with 1 distinct error, got %+v", db)
+	}
+
+	if home := d.Entries[2]; home.Runs != 0 || home.LastStatus != "" {
+		t.Errorf("expected home without runs, got %+v", home)
+	}
+
+	if !d.HasProblems() {
+		t.Error("expected HasProblems with failures and missing runs")
+	}
+	if got, want := d.Subject(), "[nbackup] web-01: 1 ok, 1 failed, 1 not run"; got != want {
+		t.Errorf("Subject = %q, want %q", got, want)
+	}
+
+	text := d.Text()
+	for _, want := range []string{"completed (partial)", "not run", "error: disk full", "missing optional source: /opt/extra", "2.0 KB"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("digest text missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "old error") {
+		t.Errorf("digest text includes run outside window:\n%s", text)
+	}
+}
+
+func TestScheduler_SendDigest(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "digest.txt")
+	cfg := newDigestTestConfig(dir)
+	cfg.Backups = cfg.Backups[:1]
+	cfg.Notifications = config.NotificationsConfig{
+		Command: `{ echo "$NBACKUP_SUBJECT"; cat; } >> ` + out,
+		Digest:  config.DigestConfig{Enabled: true, Schedule: "0 7 * * *"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runFn := func(context.Context, *config.AgentConfig, config.BackupEntry, *slog.Logger, *BackupJob) error {
+		return nil
+	}
+	sched, err := NewScheduler(cfg, logger, runFn, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+
+	if err := sched.state.Record("app", JobRun{Start: time.Now().Add(-time.Hour), DurationSeconds: 1, Status: "completed", Bytes: 10}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	sched.sendDigest()
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("digest not delivered: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "[nbackup] web-01: 1 ok\n") {
+		t.Errorf("unexpected digest:\n%s", data)
+	}
+
+	lastSent, err := loadDigestLastSent(dir)
+	if err != nil || lastSent.IsZero() {
+		t.Fatalf("expected last_sent persisted, got %v (err=%v)", lastSent, err)
+	}
+
+	// Segundo envio cobre apenas a janela desde o anterior: sem execuções → "not run".
+	sched.sendDigest()
+	data, _ = os.ReadFile(out)
+	if !strings.Contains(string(data), "[nbackup] web-01: 0 ok, 1 not run") {
+		t.Errorf("expected second digest without runs:\n%s", data)
+	}
+}
+
+func TestScheduler_SendDigest_OnlyOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "digest.txt")
+	cfg := newDigestTestConfig(dir)
+	cfg.Backups = cfg.Backups[:1]
+	cfg.Notifications = config.NotificationsConfig{
+		Command: "cat > " + out,
+		Digest:  config.DigestConfig{Enabled: true, Schedule: "0 7 * * *", OnlyOnFailure: true},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sched, err := NewScheduler(cfg, logger, nil, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+	sched.state.Record("app", JobRun{Start: time.Now().Add(-time.Hour), DurationSeconds: 1, Status: "completed"})
+
+	sched.sendDigest()
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("expected no delivery without failures, stat err=%v", err)
+	}
+	if lastSent, _ := loadDigestLastSent(dir); lastSent.IsZero() {
+		t.Error("expected last_sent advanced even when skipped")
+	}
+}
+
+func TestScheduler_SendDigest_FailedDeliveryKeepsWindow(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newDigestTestConfig(dir)
+	cfg.Notifications = config.NotificationsConfig{
+		Command: "exit 1",
+		Digest:  config.DigestConfig{Enabled: true, Schedule: "0 7 * * *"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sched, err := NewScheduler(cfg, logger, nil, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+
+	sched.sendDigest()
+	if lastSent, _ := loadDigestLastSent(dir); !lastSent.IsZero() {
+		t.Errorf("expected last_sent unchanged after failed delivery, got %v", lastSent)
+	}
+}
+
+func TestNewScheduler_InvalidDigestSchedule(t *testing.T) {
+	cfg := newDigestTestConfig(t.TempDir())
+	cfg.Notifications.Digest = config.DigestConfig{Enabled: true, Schedule: "not a cron"}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if _, err := NewScheduler(cfg, logger, nil, nil); err == nil {
+		t.Fatal("expected error for invalid digest schedule")
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/nishisan-dev/n-backup/internal/config"
 	"github.com/nishisan-dev/n-backup/internal/protocol"
 )
 
@@ -55,22 +56,37 @@ var ErrAllStreamsDead = errors.New("all parallel streams are permanently dead")
 type Dispatcher struct {
 	streams     []*ParallelStream
 	maxStreams  int
-	activeCount int32 // atomic
-	chunkSize   int
+	activeCount int32        // atomic
+	streamLimit atomic.Int32 // teto recomendado pelo server (ControlStreamLimit), 0 = maxStreams
 	nextStream  int
 	globalSeq   uint32 // sequência global de chunks para reconstrução no server
 	sessionID   string
 	serverAddr  string
 	tlsCfg      *tls.Config
+	psk         *pskCredential
 	agentName   string
 	storageName string
 	logger      *slog.Logger
 
 	// Buffer de acumulação: dados são coletados aqui até completar chunkSize,
 	// momento em que um chunk completo é emitido para o ring buffer do stream.
+	// O buffer tem maxChunkSize bytes para acomodar o ajuste adaptativo.
 	pending    []byte
 	pendingLen int
 
+	// Tamanho de chunk corrente, ajustado em runtime pelo chunkTuner entre
+	// minChunkSize e maxChunkSize (iguais = tamanho fixo). Cada ChunkHeader
+	// carrega o Length do próprio chunk, então o server não precisa ser avisado.
+	chunkSize    atomic.Int64
+	minChunkSize int
+	maxChunkSize int
+
+	// Amostras para o chunkTuner: bytes confirmados via ChunkSACK (cumulativo)
+	// e round-trip dos chunks amostrados (soma em ns e quantidade).
+	ackedBytes    atomic.Int64
+	chunkRTTSum   atomic.Int64
+	chunkRTTCount atomic.Int64
+
 	// Callback invocado quando streams mudam (ativação/desativação)
 	onStreamChange func(active, max int)
 
@@ -93,6 +109,22 @@ type Dispatcher struct {
 	chunksPerCycle int                  // per-N-chunk rotation (0=desabilitado)
 	sackTimeoutFn  func() time.Duration // retorna timeout efetivo para SACK (injeta RTT externo)
 	abortSenders   atomic.Bool          // sinaliza abort para waits/retries pendentes
+
+	// Prefixo contíguo de chunks confirmados por ChunkSACK (ver
+	// AckedWatermark). Protegidos por chunkMapMu.
+	watermarkSeq   uint32
+	watermarkBytes int64
+
+	trace func(conn net.Conn, label string) net.Conn // hook de protocol trace (nil=desabilitado)
+
+	// Transporte multiplexado (parallel_transport: mux): todos os streams são
+	// streams lógicos de uma única conexão, reaberta sob demanda se cair.
+	multiplex bool
+	mux       *protocol.MuxSession
+	muxMu     sync.Mutex // serializa a abertura da conexão multiplexada
+
+	quic   bool              // server.transport: quic — streams QUIC da conexão compartilhada do agent
+	server config.ServerAddr // opções de dial: server.proxy e server.prefer
 }
 
 // ParallelStream representa um stream individual com seu ring buffer e conexão.
@@ -111,6 +143,12 @@ type ParallelStream struct {
 	// retransmitSpans registra retransmits ainda não incorporados em
 	// ackedRetransmit. Protegido por sendMu.
 	retransmitSpans []retransmitSpan
+	// Contadores monotônicos de transferência (protegidos por sendMu):
+	// bytesSent inclui retransmissões; retransmitBytes soma reenvios via NACK
+	// e reenvios de dados já escritos após resume (até maxSendOffset).
+	bytesSent       int64
+	retransmitBytes int64
+	maxSendOffset   int64
 	sendMu          sync.Mutex
 	drainBytes      int64 // atomic — bytes drenados (ACK'd) por este stream
 	// senderStarted evita múltiplos sender goroutines para o mesmo stream.
@@ -128,6 +166,19 @@ type ParallelStream struct {
 	// lastSACKAt armazena o unix nanos do último ChunkSACK recebido neste stream.
 	// Usado para detectar conexões mortas (SACK timeout). Valor 0 = nenhum SACK ainda.
 	lastSACKAt atomic.Int64
+
+	// Amostra de round-trip em andamento: o sender registra o início do envio
+	// de um chunk (unix nanos, 0 = nenhuma amostra) e o wire offset do seu fim;
+	// o ACK reader fecha a amostra quando o ChunkSACK cobre esse offset.
+	rttProbeAt  atomic.Int64
+	rttProbeEnd atomic.Int64
+
+	// StreamTrailer: chunks distintos atribuídos ao stream, se o server aceita
+	// o frame (ParallelACKFlagStreamTrailer) e se ele pediu o reenvio da cauda
+	// (StreamTrailerStatusTruncated), antecipando a reconexão do final drain.
+	chunks     atomic.Uint32
+	trailer    atomic.Bool
+	resendTail atomic.Bool
 }
 
 type retransmitSpan struct {
@@ -148,9 +199,12 @@ type DispatcherConfig struct {
 	MaxStreams     int
 	BufferSize     int64
 	ChunkSize      int
+	MinChunkSize   int // limite inferior do ajuste adaptativo (0 = ChunkSize)
+	MaxChunkSize   int // limite superior do ajuste adaptativo (0 = ChunkSize)
 	SessionID      string
 	ServerAddr     string
 	TLSConfig      *tls.Config
+	PSK            *pskCredential // credencial psk (nil = mTLS)
 	AgentName      string
 	StorageName    string
 	Logger         *slog.Logger
@@ -159,18 +213,41 @@ type DispatcherConfig struct {
 	DSCPValue      int                   // DSCP code point (0=desabilitado)
 	ChunksPerCycle int                   // per-N-chunk rotation (0=desabilitado)
 	SACKTimeoutFn  func() time.Duration  // fornece timeout dinâmico (ex: max(rtt*3, 5s))
+	StartSeq       uint32                // globalSeq do primeiro chunk (> 0 = sessão retomada após restart)
+
+	// Trace envolve a conexão de cada stream após o handshake TLS/PSK
+	// (logging.protocol_trace_dir). nil = desabilitado.
+	Trace func(conn net.Conn, label string) net.Conn
+
+	// Multiplex transporta os streams em uma única conexão TLS (PMUX) em vez
+	// de um socket por stream.
+	Multiplex bool
+
+	// QUIC abre cada stream como stream QUIC (server.transport: quic).
+	QUIC bool
+
+	// Server traz as opções de dial dos streams (server.proxy e server.prefer).
+	Server config.ServerAddr
 }
 
 // NewDispatcher cria um novo Dispatcher.
 // A conn primária não é usada para dados — todas as N streams conectam via ParallelJoin.
 func NewDispatcher(cfg DispatcherConfig) *Dispatcher {
+	if cfg.MinChunkSize <= 0 || cfg.MinChunkSize > cfg.ChunkSize {
+		cfg.MinChunkSize = cfg.ChunkSize
+	}
+	if cfg.MaxChunkSize < cfg.ChunkSize {
+		cfg.MaxChunkSize = cfg.ChunkSize
+	}
 	d := &Dispatcher{
 		streams:        make([]*ParallelStream, cfg.MaxStreams),
 		maxStreams:     cfg.MaxStreams,
-		chunkSize:      cfg.ChunkSize,
+		minChunkSize:   cfg.MinChunkSize,
+		maxChunkSize:   cfg.MaxChunkSize,
 		sessionID:      cfg.SessionID,
 		serverAddr:     cfg.ServerAddr,
 		tlsCfg:         cfg.TLSConfig,
+		psk:            cfg.PSK,
 		agentName:      cfg.AgentName,
 		storageName:    cfg.StorageName,
 		logger:         cfg.Logger,
@@ -178,11 +255,18 @@ func NewDispatcher(cfg DispatcherConfig) *Dispatcher {
 		dscpValue:      cfg.DSCPValue,
 		chunksPerCycle: cfg.ChunksPerCycle,
 		sackTimeoutFn:  cfg.SACKTimeoutFn,
+		trace:          cfg.Trace,
+		multiplex:      cfg.Multiplex,
+		quic:           cfg.QUIC,
+		server:         cfg.Server,
 		lastSampleAt:   time.Now(),
-		pending:        make([]byte, cfg.ChunkSize),
+		pending:        make([]byte, cfg.MaxChunkSize),
 		pendingLen:     0,
 		chunkMap:       make(map[uint32]chunkLocation),
+		globalSeq:      cfg.StartSeq,
+		watermarkSeq:   cfg.StartSeq,
 	}
+	d.chunkSize.Store(int64(cfg.ChunkSize))
 
 	// Inicializa todos os streams com ring buffers (inativos)
 	for i := 0; i < cfg.MaxStreams; i++ {
@@ -206,8 +290,12 @@ func (d *Dispatcher) Write(p []byte) (int, error) {
 	totalWritten := 0
 
 	for totalWritten < len(p) {
-		// Quanto espaço resta no buffer pending?
-		space := d.chunkSize - d.pendingLen
+		// Relido a cada chunk: o chunkTuner pode ter mudado o tamanho
+		size := int(d.chunkSize.Load())
+
+		// Quanto espaço resta no buffer pending? Se o tamanho diminuiu abaixo
+		// do já acumulado, o chunk é emitido como está.
+		space := max(size-d.pendingLen, 0)
 		toCopy := len(p) - totalWritten
 		if toCopy > space {
 			toCopy = space
@@ -219,7 +307,7 @@ func (d *Dispatcher) Write(p []byte) (int, error) {
 		totalWritten += toCopy
 
 		// Se o buffer está cheio, emite um chunk completo
-		if d.pendingLen == d.chunkSize {
+		if d.pendingLen >= size {
 			if err := d.emitChunk(d.pending[:d.pendingLen]); err != nil {
 				return totalWritten, err
 			}
@@ -248,6 +336,10 @@ func (d *Dispatcher) Flush() error {
 func (d *Dispatcher) emitChunk(data []byte) error {
 	d.mu.Lock()
 	seq := d.globalSeq
+	if seq == protocol.StreamTrailerSeq {
+		d.mu.Unlock()
+		return fmt.Errorf("chunk sequence space exhausted (%d chunks)", seq)
+	}
 	d.globalSeq++
 
 	// Procura um stream ativo (round-robin com skip de inativos/mortos)
@@ -303,6 +395,8 @@ func (d *Dispatcher) emitChunk(data []byte) error {
 		atomic.AddInt64(&d.producerBlockedNs, elapsed.Nanoseconds())
 	}
 
+	stream.chunks.Add(1)
+
 	// Registra localização no chunkMap para suportar retransmissão via NACK
 	chunkLen := int64(protocol.ChunkHeaderSize) + int64(len(data))
 	d.chunkMapMu.Lock()
@@ -316,6 +410,24 @@ func (d *Dispatcher) emitChunk(data []byte) error {
 	return nil
 }
 
+// AckedWatermark retorna o prefixo contíguo de chunks confirmados por
+// ChunkSACK desde StartSeq: o globalSeq do primeiro chunk ainda não confirmado
+// e os bytes de dados (sem ChunkHeader) dos chunks anteriores. Um chunk está
+// confirmado quando o tail do ring buffer do seu stream passou do seu fim.
+func (d *Dispatcher) AckedWatermark() (uint32, int64) {
+	d.chunkMapMu.Lock()
+	defer d.chunkMapMu.Unlock()
+	for {
+		loc, ok := d.chunkMap[d.watermarkSeq]
+		if !ok || loc.rbOffset+loc.length > d.streams[loc.streamIdx].rb.Tail() {
+			break
+		}
+		d.watermarkBytes += loc.length - protocol.ChunkHeaderSize
+		d.watermarkSeq++
+	}
+	return d.watermarkSeq, d.watermarkBytes
+}
+
 // RetransmitChunk tenta retransmitir um chunk perdido identificado pelo globalSeq.
 // Consulta o chunkMap para localizar o chunk no ring buffer do stream original.
 // Se o chunk ainda está no buffer, lê os dados e reenvia pelo MESMO stream que
@@ -382,15 +494,12 @@ func (d *Dispatcher) RetransmitChunk(globalSeq uint32) (bool, error) {
 			"altStream", altStream.index)
 		stream = altStream
 	}
-	if err := d.writeFrame(stream, buf); err != nil {
+	if err := d.writeFrame(stream, buf, true); err != nil {
 		d.logger.Warn("retransmit: failed to write to stream",
 			"globalSeq", globalSeq, "stream", stream.index, "error", err)
 		return false, fmt.Errorf("retransmitting chunk %d on stream %d: %w",
 			globalSeq, stream.index, err)
 	}
-	stream.sendMu.Lock()
-	stream.recordRetransmitLocked(int64(len(buf)))
-	stream.sendMu.Unlock()
 
 	d.logger.Info("retransmit: chunk sent successfully",
 		"globalSeq", globalSeq,
@@ -408,11 +517,22 @@ func (s *ParallelStream) recordRetransmitLocked(length int64) {
 		start: start,
 		end:   start + length,
 	})
+	s.bytesSent += length
+	s.retransmitBytes += length
 }
 
 func (s *ParallelStream) advanceNormalLocked(length int64) {
+	// Após resume, o sender reenvia a partir do offset confirmado pelo server;
+	// a parte abaixo de maxSendOffset já havia sido escrita antes.
+	if s.sendOffset < s.maxSendOffset {
+		s.retransmitBytes += minInt64(length, s.maxSendOffset-s.sendOffset)
+	}
 	s.sendOffset += length
 	s.wireOffset += length
+	if s.sendOffset > s.maxSendOffset {
+		s.maxSendOffset = s.sendOffset
+	}
+	s.bytesSent += length
 }
 
 func (s *ParallelStream) translateWireOffsetLocked(wireOffset int64) int64 {
@@ -552,10 +672,10 @@ func (d *Dispatcher) syncStreamAfterReconnect(stream *ParallelStream, streamIdx
 			return fmt.Errorf("stream %d: cannot read header at resume offset %d", streamIdx, resumeOffset)
 		}
 		hdrLength := binary.BigEndian.Uint32(hdrBuf[4:8])
-		if hdrLength > uint32(d.chunkSize) {
+		if hdrLength > uint32(d.maxChunkSize) {
 			d.logger.Error("chunk header at resume offset has invalid length — desync detected",
 				"stream", streamIdx, "offset", resumeOffset,
-				"hdrLength", hdrLength, "maxChunkSize", d.chunkSize)
+				"hdrLength", hdrLength, "maxChunkSize", d.maxChunkSize)
 			stream.dead.Store(true)
 			d.DeactivateStream(streamIdx)
 			return fmt.Errorf("stream %d: desync at resume offset %d (invalid chunk length %d)",
@@ -570,6 +690,7 @@ func (d *Dispatcher) syncStreamAfterReconnect(stream *ParallelStream, streamIdx
 	// liberar o ring buffer imediatamente até o offset informado.
 	stream.rb.Advance(resumeSendOffset)
 	stream.lastSACKAt.Store(time.Now().UnixNano()) // reset após reconexão bem-sucedida
+	stream.rttProbeAt.Store(0)                     // amostra em andamento cruzou a reconexão
 
 	d.logger.Info("stream reconnected, resuming from offset",
 		"stream", streamIdx, "offset", resumeOffset,
@@ -602,6 +723,10 @@ func (d *Dispatcher) waitForFinalDrain(stream *ParallelStream, streamIdx int, re
 		if d.abortSenders.Load() {
 			return false, context.Canceled
 		}
+		// O server acusou o stream truncado: reconecta sem esperar o timeout
+		if stream.resendTail.CompareAndSwap(true, false) {
+			break
+		}
 
 		remaining := time.Until(deadline)
 		if remaining <= 0 {
@@ -619,7 +744,7 @@ func (d *Dispatcher) waitForFinalDrain(stream *ParallelStream, streamIdx int, re
 		return true, nil
 	}
 
-	d.logger.Warn("final drain timeout exceeded, attempting reconnect",
+	d.logger.Warn("final drain incomplete, attempting reconnect",
 		"stream", streamIdx,
 		"pendingBytes", stream.rb.Head()-stream.rb.Tail(),
 		"timeout", timeout,
@@ -659,6 +784,38 @@ func (d *Dispatcher) waitForFinalDrain(stream *ParallelStream, streamIdx int, re
 	return !stream.HasUnackedData(), nil
 }
 
+// writeStreamTrailer envia o StreamTrailer com os totais do stream quando o
+// sender esgota o ring buffer (servers que o aceitam). Reenviado a cada vez
+// que o sender volta ao fim dos dados após uma reconexão. O frame não entra no
+// offset de wire: o server também não o conta.
+func (d *Dispatcher) writeStreamTrailer(stream *ParallelStream) {
+	if !stream.trailer.Load() {
+		return
+	}
+	// writeMu: o offset lido precisa refletir exatamente os frames já no socket
+	stream.writeMu.Lock()
+	defer stream.writeMu.Unlock()
+
+	stream.connMu.Lock()
+	conn := stream.conn
+	stream.connMu.Unlock()
+	if conn == nil {
+		return
+	}
+
+	stream.sendMu.Lock()
+	wireOffset := stream.wireOffset
+	stream.sendMu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(writeDeadline))
+	if err := protocol.WriteStreamTrailer(conn, stream.index, stream.chunks.Load(), uint64(wireOffset)); err != nil {
+		// Conexão caída: o final drain reconecta e o trailer vai de novo
+		d.logger.Debug("writing stream trailer failed", "stream", stream.index, "error", err)
+		return
+	}
+	d.logger.Debug("stream trailer sent", "stream", stream.index, "chunks", stream.chunks.Load(), "wireOffset", wireOffset)
+}
+
 func (d *Dispatcher) readChunkFrame(stream *ParallelStream, offset int64) ([]byte, error) {
 	hdr := make([]byte, protocol.ChunkHeaderSize)
 	n, err := stream.rb.ReadFullAt(offset, hdr)
@@ -670,7 +827,7 @@ func (d *Dispatcher) readChunkFrame(stream *ParallelStream, offset int64) ([]byt
 	}
 
 	length := binary.BigEndian.Uint32(hdr[4:8])
-	if length > uint32(d.chunkSize) {
+	if length > uint32(d.maxChunkSize) {
 		return nil, fmt.Errorf("invalid chunk length %d at offset %d", length, offset)
 	}
 
@@ -691,7 +848,10 @@ func (d *Dispatcher) readChunkFrame(stream *ParallelStream, offset int64) ([]byt
 	return frame, nil
 }
 
-func (d *Dispatcher) writeFrame(stream *ParallelStream, frame []byte) error {
+// writeFrame escreve um frame completo no stream e contabiliza os bytes no
+// offset de wire ainda sob writeMu: um retransmit concorrente com o sender
+// precisa ser registrado na mesma ordem em que os frames saíram no socket.
+func (d *Dispatcher) writeFrame(stream *ParallelStream, frame []byte, retransmit bool) error {
 	stream.writeMu.Lock()
 	defer stream.writeMu.Unlock()
 
@@ -721,6 +881,13 @@ func (d *Dispatcher) writeFrame(stream *ParallelStream, frame []byte) error {
 		}
 	}
 
+	stream.sendMu.Lock()
+	if retransmit {
+		stream.recordRetransmitLocked(int64(len(frame)))
+	} else {
+		stream.advanceNormalLocked(int64(len(frame)))
+	}
+	stream.sendMu.Unlock()
 	return nil
 }
 
@@ -757,6 +924,7 @@ func (d *Dispatcher) startSenderWithRetry(streamIdx int) {
 			}
 			if err != nil {
 				if err == ErrBufferClosed {
+					d.writeStreamTrailer(stream)
 					drained, drainErr := d.waitForFinalDrain(stream, streamIdx, &retries)
 					if drainErr != nil {
 						stream.senderErr <- drainErr
@@ -783,7 +951,8 @@ func (d *Dispatcher) startSenderWithRetry(streamIdx int) {
 
 			// Escreve um frame completo por vez para não quebrar o framing quando
 			// uma retransmissão precisar injetar um chunk no mesmo stream.
-			writeErr := d.writeFrame(stream, frame)
+			writeStart := time.Now()
+			writeErr := d.writeFrame(stream, frame, false)
 
 			if writeErr != nil {
 				d.logger.Warn("stream write failed, attempting reconnect",
@@ -829,11 +998,9 @@ func (d *Dispatcher) startSenderWithRetry(streamIdx int) {
 				continue
 			}
 
-			// Write bem-sucedido — reset retries e avança offset
+			// Write bem-sucedido (offset já avançado por writeFrame) — reset retries
 			retries = 0
-			stream.sendMu.Lock()
-			stream.advanceNormalLocked(int64(len(frame)))
-			stream.sendMu.Unlock()
+			d.startRTTProbe(stream, writeStart)
 
 			// Reseta SACK timer após envio real de dados.
 			// Evita falso-positivo durante startup quando o producer
@@ -897,63 +1064,169 @@ func (d *Dispatcher) startSenderWithRetry(streamIdx int) {
 	}()
 }
 
-// reconnectStream reconecta um stream ao server via ParallelJoin.
-// Retorna o lastOffset reportado pelo server (para resume).
-func (d *Dispatcher) reconnectStream(streamIdx int, flags byte) (int64, error) {
-	stream := d.streams[streamIdx]
+// traceConn aplica o hook de protocol trace à conexão de um stream.
+func (d *Dispatcher) traceConn(conn net.Conn, streamIdx int) net.Conn {
+	if d.trace == nil {
+		return conn
+	}
+	return d.trace(conn, fmt.Sprintf("stream-%d", streamIdx))
+}
 
-	// Fecha a conexão anterior
-	stream.connMu.Lock()
-	if stream.conn != nil {
-		stream.conn.Close()
+// dialStream abre a conexão de dados de um stream: um socket TLS dedicado
+// ou, com multiplex, um stream lógico da conexão multiplexada.
+func (d *Dispatcher) dialStream(streamIdx int) (net.Conn, error) {
+	if d.multiplex {
+		st, err := d.openMuxStream()
+		if err != nil {
+			return nil, fmt.Errorf("opening multiplexed stream %d: %w", streamIdx, err)
+		}
+		return d.traceConn(st, streamIdx), nil
+	}
+	conn, err := d.dialServer(fmt.Sprintf("stream %d", streamIdx))
+	if err != nil {
+		return nil, err
+	}
+	return d.traceConn(conn, streamIdx), nil
+}
+
+// dialServer conecta ao server (TCP, direto ou via proxy + DSCP + TLS + auth
+// psk), ao socket unix do listener local ou, com QUIC, abre um stream na
+// conexão QUIC do agent.
+func (d *Dispatcher) dialServer(label string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if d.quic {
+		conn, err := dialQUIC(ctx, d.serverAddr, d.server.Prefer, d.tlsCfg, d.psk)
+		if err != nil {
+			return nil, fmt.Errorf("connecting %s: %w", label, err)
+		}
+		return conn, nil
+	}
+	if d.server.Transport == config.TransportUnix {
+		conn, err := dialUnix(ctx, d.serverAddr)
+		if err != nil {
+			return nil, fmt.Errorf("connecting %s: %w", label, err)
+		}
+		return conn, nil
 	}
-	stream.connMu.Unlock()
 
-	// Nova conexão TLS
-	dialer := &net.Dialer{Timeout: 30 * time.Second}
-	rawConn, err := dialer.Dial("tcp", d.serverAddr)
+	rawConn, err := dialTCP(ctx, d.server, d.serverAddr)
 	if err != nil {
-		return 0, fmt.Errorf("connecting stream %d: %w", streamIdx, err)
+		return nil, fmt.Errorf("connecting %s: %w", label, err)
 	}
 
 	// Aplica DSCP marking no socket TCP (pré-TLS)
 	if d.dscpValue > 0 {
 		if err := ApplyDSCP(rawConn, d.dscpValue); err != nil {
-			d.logger.Warn("failed to set DSCP on reconnect", "stream", streamIdx, "error", err)
+			d.logger.Warn("failed to set DSCP", "conn", label, "error", err)
 		}
 	}
 
 	tlsConn := tls.Client(rawConn, d.tlsCfg)
 	if err := tlsConn.Handshake(); err != nil {
 		rawConn.Close()
-		return 0, fmt.Errorf("TLS handshake stream %d: %w", streamIdx, err)
+		return nil, fmt.Errorf("TLS handshake %s: %w", label, err)
+	}
+	if err := d.psk.authenticate(tlsConn); err != nil {
+		tlsConn.Close()
+		return nil, fmt.Errorf("%s: %w", label, err)
+	}
+	return tlsConn, nil
+}
+
+// openMuxStream abre um stream lógico, (re)abrindo a conexão multiplexada
+// quando ela ainda não existe ou caiu. Os streams vivos na conexão anterior
+// já falharam e reconectam por aqui.
+func (d *Dispatcher) openMuxStream() (*protocol.MuxStream, error) {
+	d.muxMu.Lock()
+	defer d.muxMu.Unlock()
+
+	if d.mux == nil || d.mux.IsClosed() {
+		if d.mux != nil {
+			d.logger.Warn("multiplexed connection lost, reconnecting", "error", d.mux.Err())
+		}
+		conn, err := d.dialServer("mux connection")
+		if err != nil {
+			return nil, err
+		}
+		conn.SetDeadline(time.Now().Add(writeDeadline))
+		if err := protocol.WriteMuxInit(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		status, err := protocol.ReadMuxACK(conn)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w (server without parallel_transport: mux support?)", err)
+		}
+		if status != protocol.MuxStatusOK {
+			conn.Close()
+			return nil, fmt.Errorf("server rejected multiplexed connection: status=%d", status)
+		}
+		conn.SetDeadline(time.Time{})
+		d.mux = protocol.NewMuxClient(conn)
+		d.logger.Info("multiplexed connection established", "server", d.serverAddr)
+	}
+	return d.mux.Open()
+}
+
+// closeMux encerra a conexão multiplexada, se houver.
+func (d *Dispatcher) closeMux() {
+	d.muxMu.Lock()
+	defer d.muxMu.Unlock()
+	if d.mux != nil {
+		d.mux.Close()
+		d.mux = nil
+	}
+}
+
+// reconnectStream reconecta um stream ao server via ParallelJoin.
+// Retorna o lastOffset reportado pelo server (para resume).
+func (d *Dispatcher) reconnectStream(streamIdx int, flags byte) (int64, error) {
+	stream := d.streams[streamIdx]
+
+	// Fecha a conexão anterior
+	stream.connMu.Lock()
+	if stream.conn != nil {
+		stream.conn.Close()
+	}
+	stream.connMu.Unlock()
+
+	conn, err := d.dialStream(streamIdx)
+	if err != nil {
+		return 0, err
 	}
 
 	// Envia ParallelJoin com medição de RTT
 	joinStart := time.Now()
-	if err := protocol.WriteParallelJoin(tlsConn, d.sessionID, uint8(streamIdx), flags); err != nil {
-		tlsConn.Close()
+	// Rotações mantêm as capacidades anunciadas no join anterior (ver JoinFlagChunkNACK)
+	if flags == protocol.JoinReasonNone {
+		flags |= protocol.JoinFlagChunkNACK | protocol.JoinFlagStreamTrailer | protocol.JoinFlagServerLoad | protocol.JoinFlagStreamLimit
+	}
+	if err := protocol.WriteParallelJoin(conn, d.sessionID, uint8(streamIdx), flags); err != nil {
+		conn.Close()
 		return 0, fmt.Errorf("writing ParallelJoin stream %d: %w", streamIdx, err)
 	}
 
 	// Lê ParallelACK com lastOffset
-	ack, err := protocol.ReadParallelACK(tlsConn)
+	ack, err := protocol.ReadParallelACK(conn)
 	reconnectRTT := time.Since(joinStart)
 	if err != nil {
-		tlsConn.Close()
+		conn.Close()
 		return 0, fmt.Errorf("reading ParallelACK stream %d: %w", streamIdx, err)
 	}
 
 	d.logger.Info("reconnect ACK received", "stream", streamIdx, "reconnect_rtt", reconnectRTT)
 
 	if ack.Status != protocol.ParallelStatusOK {
-		tlsConn.Close()
+		conn.Close()
 		return 0, fmt.Errorf("server rejected ParallelJoin stream %d: status=%d", streamIdx, ack.Status)
 	}
+	stream.trailer.Store(ack.StreamTrailer)
 
 	// Atualiza a conexão do stream
 	stream.connMu.Lock()
-	stream.conn = tlsConn
+	stream.conn = conn
 	stream.connMu.Unlock()
 
 	// Reset SACK timer para a nova conexão
@@ -976,10 +1249,43 @@ func (d *Dispatcher) startACKReader(streamIdx int) {
 			conn := stream.conn
 			stream.connMu.Unlock()
 
-			csack, err := protocol.ReadChunkSACK(conn)
-			if err != nil {
+			var magic [4]byte
+			if _, err := io.ReadFull(conn, magic[:]); err != nil {
 				return // conn fechada ou erro — sender tratará a reconexão
 			}
+			if magic == protocol.MagicChunkNACK {
+				nack, err := protocol.ReadChunkNACKPayload(conn)
+				if err != nil {
+					return
+				}
+				// Retransmite fora do ACK reader: writeFrame pode esperar o sender,
+				// e o sender depende dos ChunkSACKs lidos aqui para liberar o buffer.
+				go d.handleChunkNACK(streamIdx, nack.GlobalSeq)
+				continue
+			}
+			if magic == protocol.MagicStreamTrailerACK {
+				tack, err := protocol.ReadStreamTrailerACKPayload(conn)
+				if err != nil {
+					return
+				}
+				if tack.Status != protocol.StreamTrailerStatusTruncated {
+					d.logger.Debug("stream trailer acknowledged", "stream", streamIdx, "serverOffset", tack.Offset)
+					continue
+				}
+				// O server fecha o stream; o final drain reconecta e reenvia do offset dele
+				d.logger.Warn("server reported truncated stream, resending tail",
+					"stream", streamIdx, "serverOffset", tack.Offset)
+				stream.resendTail.Store(true)
+				return
+			}
+			if magic != protocol.MagicChunkSACK {
+				d.logger.Warn("unexpected frame on parallel stream", "stream", streamIdx, "magic", string(magic[:]))
+				return
+			}
+			csack, err := protocol.ReadChunkSACKPayload(conn)
+			if err != nil {
+				return
+			}
 
 			// Atualiza o SACK timer para este stream — detecta conn morta
 			stream.lastSACKAt.Store(time.Now().UnixNano())
@@ -989,11 +1295,13 @@ func (d *Dispatcher) startACKReader(streamIdx int) {
 			newBaseOffset := stream.applyACKLocked(newWireOffset)
 			stream.sendMu.Unlock()
 			stream.rb.Advance(newBaseOffset)
+			d.finishRTTProbe(stream, newWireOffset)
 
 			// Acumula apenas o delta (bytes novos drenados desde o último SACK)
 			delta := newBaseOffset - lastBaseOffset
 			if delta > 0 {
 				atomic.AddInt64(&stream.drainBytes, delta)
+				d.ackedBytes.Add(delta)
 			}
 			lastBaseOffset = newBaseOffset
 
@@ -1007,6 +1315,25 @@ func (d *Dispatcher) startACKReader(streamIdx int) {
 	}()
 }
 
+// handleChunkNACK retransmite o chunk que o server rejeitou por CRC32. Se o
+// chunk não puder ser retransmitido, fecha a conexão do stream: o server não
+// confirma offsets além do chunk rejeitado, então o resume o reenvia.
+func (d *Dispatcher) handleChunkNACK(streamIdx int, globalSeq uint32) {
+	d.logger.Warn("ChunkNACK received, retransmitting chunk", "stream", streamIdx, "globalSeq", globalSeq)
+	ok, err := d.RetransmitChunk(globalSeq)
+	if err == nil && ok {
+		return
+	}
+	d.logger.Error("retransmit after ChunkNACK failed, forcing stream reconnect",
+		"stream", streamIdx, "globalSeq", globalSeq, "error", err)
+	stream := d.streams[streamIdx]
+	stream.connMu.Lock()
+	if stream.conn != nil {
+		stream.conn.Close()
+	}
+	stream.connMu.Unlock()
+}
+
 // ActivateStream ativa um stream conectando ao server via ParallelJoin.
 // Suporta qualquer stream index (incluindo stream 0).
 func (d *Dispatcher) ActivateStream(streamIdx int) error {
@@ -1021,51 +1348,40 @@ func (d *Dispatcher) ActivateStream(streamIdx int) error {
 	if stream.active.Load() {
 		return nil // já ativo
 	}
-
-	// Conecta ao server
-	dialer := &net.Dialer{Timeout: 30 * time.Second}
-	rawConn, err := dialer.Dial("tcp", d.serverAddr)
-	if err != nil {
-		return fmt.Errorf("connecting stream %d: %w", streamIdx, err)
-	}
-
-	// Aplica DSCP marking no socket TCP (pré-TLS)
-	if d.dscpValue > 0 {
-		if err := ApplyDSCP(rawConn, d.dscpValue); err != nil {
-			d.logger.Warn("failed to set DSCP", "stream", streamIdx, "error", err)
-		}
+	if limit := d.StreamLimit(); d.ActiveStreams() >= limit {
+		return fmt.Errorf("stream limit reached (%d active streams)", limit)
 	}
 
-	tlsConn := tls.Client(rawConn, d.tlsCfg)
-	if err := tlsConn.Handshake(); err != nil {
-		rawConn.Close()
-		return fmt.Errorf("TLS handshake stream %d: %w", streamIdx, err)
+	conn, err := d.dialStream(streamIdx)
+	if err != nil {
+		return err
 	}
 
 	// Envia ParallelJoin com medição de RTT
 	joinStart := time.Now()
-	if err := protocol.WriteParallelJoin(tlsConn, d.sessionID, uint8(streamIdx), protocol.JoinReasonNone); err != nil {
-		tlsConn.Close()
+	if err := protocol.WriteParallelJoin(conn, d.sessionID, uint8(streamIdx), protocol.JoinReasonNone|protocol.JoinFlagChunkNACK|protocol.JoinFlagStreamTrailer|protocol.JoinFlagServerLoad|protocol.JoinFlagStreamLimit); err != nil {
+		conn.Close()
 		return fmt.Errorf("writing ParallelJoin stream %d: %w", streamIdx, err)
 	}
 
 	// Lê ParallelACK
-	ack, err := protocol.ReadParallelACK(tlsConn)
+	ack, err := protocol.ReadParallelACK(conn)
 	joinRTT := time.Since(joinStart)
 	if err != nil {
-		tlsConn.Close()
+		conn.Close()
 		return fmt.Errorf("reading ParallelACK stream %d: %w", streamIdx, err)
 	}
 
 	d.logger.Info("parallel join ACK received", "stream", streamIdx, "parallel_join_rtt", joinRTT)
 
 	if ack.Status != protocol.ParallelStatusOK {
-		tlsConn.Close()
+		conn.Close()
 		return fmt.Errorf("server rejected ParallelJoin stream %d: status=%d", streamIdx, ack.Status)
 	}
+	stream.trailer.Store(ack.StreamTrailer)
 
 	stream.connMu.Lock()
-	stream.conn = tlsConn
+	stream.conn = conn
 	stream.connMu.Unlock()
 
 	stream.active.Store(true)
@@ -1097,6 +1413,55 @@ func (d *Dispatcher) DeactivateStream(streamIdx int) {
 	d.notifyStreamChange()
 }
 
+// StreamLimit retorna o número máximo de streams ativos: maxStreams ou o teto
+// recomendado pelo server, o que for menor.
+func (d *Dispatcher) StreamLimit() int {
+	if limit := int(d.streamLimit.Load()); limit > 0 && limit < d.maxStreams {
+		return limit
+	}
+	return d.maxStreams
+}
+
+// SetStreamLimit aplica o teto de streams recomendado pelo server. Reduções
+// desativam os streams ativos de maior índice até o teto: eles deixam de
+// receber chunks novos, mas os que já estão no buffer continuam sendo
+// enviados e confirmados. O stream 0 nunca é desativado. Aumentos apenas
+// liberam o scale-up. Retorna os índices desativados.
+func (d *Dispatcher) SetStreamLimit(limit int) []int {
+	d.streamLimit.Store(int32(limit))
+
+	var parked []int
+	for d.ActiveStreams() > d.StreamLimit() {
+		idx := d.LastActiveStream()
+		if idx <= 0 {
+			break
+		}
+		d.DeactivateStream(idx)
+		parked = append(parked, idx)
+	}
+	return parked
+}
+
+// TransferStats retorna os totais de transferência (bytes enviados e
+// retransmitidos) de cada stream que chegou a escrever dados.
+func (d *Dispatcher) TransferStats() []protocol.StreamTransferStats {
+	var stats []protocol.StreamTransferStats
+	for i, stream := range d.streams {
+		stream.sendMu.Lock()
+		sent, retransmit := stream.bytesSent, stream.retransmitBytes
+		stream.sendMu.Unlock()
+		if sent == 0 {
+			continue
+		}
+		stats = append(stats, protocol.StreamTransferStats{
+			StreamIndex:     uint8(i),
+			BytesSent:       uint64(sent),
+			RetransmitBytes: uint64(retransmit),
+		})
+	}
+	return stats
+}
+
 // ActiveStreams retorna o número de streams ativos.
 func (d *Dispatcher) ActiveStreams() int {
 	return int(atomic.LoadInt32(&d.activeCount))
@@ -1254,12 +1619,25 @@ func (d *Dispatcher) WaitAllSenders(ctx context.Context) error {
 	case err := <-done:
 		return err
 	case <-ctx.Done():
-		// Timeout: fecha todos os ring buffers para desbloquear senders
-		d.logger.Warn("WaitAllSenders context expired, closing all ring buffers")
-		d.abortSenders.Store(true)
-		for i := 0; i < d.maxStreams; i++ {
-			d.streams[i].rb.Close()
-		}
+		// Timeout ou cancelamento: interrompe os senders sem drenar o buffer
+		d.logger.Warn("WaitAllSenders context expired, aborting senders")
+		d.Abort()
 		return ctx.Err()
 	}
 }
+
+// Abort interrompe os senders sem drenar o buffer — o backup foi cancelado
+// (ex: ControlAbort do server, que já descartou a sessão). Fecha os ring
+// buffers e as conexões dos streams, desbloqueando writes e leituras de
+// ChunkSACK pendentes; reconexões e retries em andamento desistem.
+func (d *Dispatcher) Abort() {
+	d.abortSenders.Store(true)
+	for _, stream := range d.streams {
+		stream.rb.Close()
+		stream.connMu.Lock()
+		if stream.conn != nil {
+			stream.conn.Close()
+		}
+		stream.connMu.Unlock()
+	}
+}
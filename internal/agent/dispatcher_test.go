@@ -309,6 +309,81 @@ func TestDispatcher_RetransmitChunk_UsesOriginalStream(t *testing.T) {
 	}
 }
 
+func TestDispatcher_ChunkNACKTriggersRetransmit(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	agentSide, serverSide := net.Pipe()
+	defer agentSide.Close()
+	defer serverSide.Close()
+
+	d := NewDispatcher(DispatcherConfig{
+		MaxStreams:  1,
+		BufferSize:  1024 * 1024,
+		ChunkSize:   512,
+		SessionID:   "test-chunk-nack",
+		ServerAddr:  "localhost:9847",
+		AgentName:   "test-agent",
+		StorageName: "test-storage",
+		Logger:      logger,
+		PrimaryConn: nil,
+	})
+	activateStreamManually(d, 0, agentSide)
+
+	data := make([]byte, 512)
+	if _, err := d.Write(data); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	d.startACKReader(0)
+
+	// Server rejeita o chunk 0 por CRC32: o agent o reenvia pelo mesmo stream
+	serverSide.SetDeadline(time.Now().Add(2 * time.Second))
+	if err := protocol.WriteChunkNACK(serverSide, 0, 0); err != nil {
+		t.Fatalf("WriteChunkNACK: %v", err)
+	}
+	hdr, err := protocol.ReadChunkHeader(serverSide)
+	if err != nil {
+		t.Fatalf("reading retransmitted chunk: %v", err)
+	}
+	if hdr.GlobalSeq != 0 || hdr.Length != 512 {
+		t.Fatalf("unexpected retransmitted chunk header: %+v", hdr)
+	}
+	if _, err := io.ReadFull(serverSide, make([]byte, hdr.Length)); err != nil {
+		t.Fatalf("reading retransmitted payload: %v", err)
+	}
+
+	// O ACK reader continua tratando ChunkSACKs após o ChunkNACK
+	s := d.streams[0]
+	frameLen := int64(protocol.ChunkHeaderSize + 512)
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		s.sendMu.Lock()
+		recorded := s.wireOffset
+		s.sendMu.Unlock()
+		if recorded == frameLen {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := protocol.WriteChunkSACK(serverSide, 0, 1, uint64(frameLen)); err != nil {
+		t.Fatalf("WriteChunkSACK: %v", err)
+	}
+	var acked int64
+	for acked == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		s.sendMu.Lock()
+		acked = s.ackedRetransmit
+		s.sendMu.Unlock()
+	}
+	if acked != frameLen {
+		t.Fatalf("expected the retransmit span to be ACKed (%d bytes), got %d", frameLen, acked)
+	}
+	s.sendMu.Lock()
+	wire, retransmit := s.wireOffset, s.retransmitBytes
+	s.sendMu.Unlock()
+	if wire != frameLen || retransmit != frameLen {
+		t.Errorf("expected retransmit of %d bytes accounted on the wire, got wire=%d retransmit=%d", frameLen, wire, retransmit)
+	}
+}
+
 func TestParallelStream_TranslateWireOffsetWithRetransmits(t *testing.T) {
 	var s ParallelStream
 	s.sendMu.Lock()
@@ -330,6 +405,27 @@ func TestParallelStream_TranslateWireOffsetWithRetransmits(t *testing.T) {
 	}
 }
 
+func TestParallelStream_TransferCountersTrackRetransmits(t *testing.T) {
+	var s ParallelStream
+	s.sendMu.Lock()
+	s.advanceNormalLocked(4096)
+	s.recordRetransmitLocked(1024) // NACK
+	s.applyACKLocked(2048)
+	// Reconexão: server confirmou até wire 2048, sender reenvia o resto
+	resume := s.resumeFromWireOffsetLocked(2048)
+	s.advanceNormalLocked(4096 - resume)
+	s.advanceNormalLocked(512) // dados novos
+	sent, retransmit := s.bytesSent, s.retransmitBytes
+	s.sendMu.Unlock()
+
+	if sent != 4096+1024+2048+512 {
+		t.Fatalf("expected bytesSent %d, got %d", 4096+1024+2048+512, sent)
+	}
+	if retransmit != 1024+2048 {
+		t.Fatalf("expected retransmitBytes %d, got %d", 1024+2048, retransmit)
+	}
+}
+
 func TestDispatcher_WaitAllSendersContext(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
@@ -417,6 +513,44 @@ func TestSender_FinalDrainWaitsForOutstandingACK(t *testing.T) {
 	}
 }
 
+func TestDispatcher_AbortStopsFinalDrain(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	conn := &mockConn{}
+
+	d := NewDispatcher(DispatcherConfig{
+		MaxStreams:    1,
+		BufferSize:    1024 * 1024,
+		ChunkSize:     256,
+		SessionID:     "test-abort",
+		ServerAddr:    "localhost:9847",
+		AgentName:     "test-agent",
+		StorageName:   "test-storage",
+		Logger:        logger,
+		PrimaryConn:   nil,
+		SACKTimeoutFn: func() time.Duration { return time.Minute },
+	})
+
+	activateStreamManually(d, 0, conn)
+	if _, err := d.Write(make([]byte, 256)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	d.startSenderWithRetry(0)
+	waitForWrittenBytes(t, conn, int64(protocol.ChunkHeaderSize+256))
+
+	// Sessão abortada pelo server: o sender desiste do drain sem esperar o ChunkSACK
+	d.Close()
+	d.Abort()
+
+	select {
+	case <-d.streams[0].senderDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("sender did not stop after Abort")
+	}
+	if err := d.WaitSender(0); err == nil {
+		t.Error("expected sender error after Abort with unacked data")
+	}
+}
+
 func TestAutoScaler_Hysteresis(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
@@ -852,3 +986,40 @@ func TestSender_ResumeValidation_ContainsRange(t *testing.T) {
 		t.Fatal("expected ContainsRange(120,16) = false (exceeds head)")
 	}
 }
+
+func TestDispatcher_AckedWatermark_StartSeq(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	d := NewDispatcher(DispatcherConfig{
+		MaxStreams:  2,
+		BufferSize:  1024 * 1024,
+		ChunkSize:   100,
+		SessionID:   "test-watermark",
+		StartSeq:    10,
+		Logger:      logger,
+		PrimaryConn: nil,
+	})
+	activateStreamManually(d, 0, &mockConn{})
+	activateStreamManually(d, 1, &mockConn{})
+
+	// 4 chunks: seq 10 e 12 no stream 0, 11 e 13 no stream 1
+	if _, err := d.Write(make([]byte, 400)); err != nil {
+		t.Fatal(err)
+	}
+	chunk := int64(protocol.ChunkHeaderSize + 100)
+	if _, ok := d.chunkMap[10]; !ok {
+		t.Fatal("expected the first chunk numbered from StartSeq")
+	}
+
+	if seq, n := d.AckedWatermark(); seq != 10 || n != 0 {
+		t.Errorf("expected empty watermark at seq 10, got seq %d bytes %d", seq, n)
+	}
+	// Stream 0 confirma os dois chunks, stream 1 nenhum: o prefixo para no 11
+	d.streams[0].rb.Advance(2 * chunk)
+	if seq, n := d.AckedWatermark(); seq != 11 || n != 100 {
+		t.Errorf("expected watermark at seq 11 / 100 bytes, got seq %d bytes %d", seq, n)
+	}
+	d.streams[1].rb.Advance(chunk)
+	if seq, n := d.AckedWatermark(); seq != 13 || n != 300 {
+		t.Errorf("expected watermark at seq 13 / 300 bytes, got seq %d bytes %d", seq, n)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+)
+
+// enrollTimeout limita a duração total do enrollment.
+const enrollTimeout = 30 * time.Second
+
+// EnrollOptions parametriza o enrollment do agent.
+type EnrollOptions struct {
+	Token         string // token de uso único emitido por `nbackup-server pki token`
+	Address       string // listener de enrollment (default: host de server.address + ":9849")
+	CAFingerprint string // fingerprint da CA ("sha256:<hex>"), obrigatório se tls.ca_cert não existir
+	Force         bool   // sobrescreve tls.client_cert/tls.client_key existentes
+}
+
+// Enroll gera uma chave e um CSR com CN=agent.name, envia ao listener de
+// enrollment do server junto com o token e grava o certificado emitido em
+// tls.client_cert/tls.client_key (e a CA em tls.ca_cert, se ausente).
+func Enroll(ctx context.Context, cfg *config.AgentConfig, opts EnrollOptions, logger *slog.Logger) error {
+	if opts.Token == "" {
+		return errors.New("enrollment token is required")
+	}
+	if cfg.Server.Transport == config.TransportUnix {
+		return errors.New("enrollment is not needed with server.transport: unix (the server identifies the agent by SO_PEERCRED)")
+	}
+	if !opts.Force {
+		for _, p := range []string{cfg.TLS.ClientCert, cfg.TLS.ClientKey} {
+			if _, err := os.Stat(p); err == nil {
+				return fmt.Errorf("%s already exists (use --force to replace it)", p)
+			}
+		}
+	}
+
+	addr := opts.Address
+	if addr == "" {
+		host, _, err := net.SplitHostPort(cfg.Server.Address)
+		if err != nil {
+			return fmt.Errorf("parsing server.address: %w", err)
+		}
+		addr = net.JoinHostPort(host, pki.DefaultEnrollPort)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("parsing enrollment address: %w", err)
+	}
+
+	tlsCfg, haveCA, err := enrollTLSConfig(cfg.TLS.CACert, host, opts.CAFingerprint)
+	if err != nil {
+		return err
+	}
+
+	keyPEM, csrPEM, err := pki.NewClientCSR(cfg.Agent.Name)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, enrollTimeout)
+	defer cancel()
+	resp, err := sendEnrollRequest(ctx, addr, tlsCfg, cfg.Server, pki.EnrollRequest{Token: opts.Token, CSR: string(csrPEM)})
+	if err != nil {
+		return err
+	}
+
+	// Valida o certificado emitido antes de gravar: par da chave gerada e CN esperado.
+	pair, err := tls.X509KeyPair([]byte(resp.Certificate), keyPEM)
+	if err != nil {
+		return fmt.Errorf("server returned an unusable certificate: %w", err)
+	}
+	if pair.Leaf == nil || pair.Leaf.Subject.CommonName != cfg.Agent.Name {
+		return fmt.Errorf("server issued a certificate for a different agent name")
+	}
+	ca, err := parseEnrollCA(resp.CA)
+	if err != nil {
+		return err
+	}
+	if !haveCA && !pki.MatchFingerprint(ca, opts.CAFingerprint) {
+		return fmt.Errorf("CA returned by server does not match the pinned fingerprint")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	if _, err := pair.Leaf.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return fmt.Errorf("issued certificate does not chain to the server CA: %w", err)
+	}
+
+	if err := writePEMFile(cfg.TLS.ClientKey, keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := writePEMFile(cfg.TLS.ClientCert, []byte(resp.Certificate), 0644); err != nil {
+		return err
+	}
+	if !haveCA {
+		if err := writePEMFile(cfg.TLS.CACert, []byte(resp.CA), 0644); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("agent enrolled",
+		"agent", cfg.Agent.Name,
+		"cert", cfg.TLS.ClientCert,
+		"not_after", pair.Leaf.NotAfter.Format(time.RFC3339),
+	)
+	return nil
+}
+
+// enrollTLSConfig valida o server pela CA local (tls.ca_cert) quando ela
+// existe; caso contrário exige o fingerprint da CA para fixá-la.
+func enrollTLSConfig(caPath, serverName, fingerprint string) (*tls.Config, bool, error) {
+	caPEM, err := os.ReadFile(caPath)
+	switch {
+	case err == nil:
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, false, fmt.Errorf("no valid certificates in %s", caPath)
+		}
+		return &tls.Config{MinVersion: tls.VersionTLS13, ServerName: serverName, RootCAs: pool}, true, nil
+	case errors.Is(err, os.ErrNotExist):
+		if fingerprint == "" {
+			return nil, false, fmt.Errorf("%s not found: --ca-fingerprint is required to trust the server on first contact", caPath)
+		}
+		return pki.PinnedCAConfig(serverName, fingerprint), false, nil
+	default:
+		return nil, false, fmt.Errorf("reading CA certificate: %w", err)
+	}
+}
+
+func sendEnrollRequest(ctx context.Context, addr string, tlsCfg *tls.Config, srv config.ServerAddr, req pki.EnrollRequest) (*pki.EnrollResponse, error) {
+	rawConn, err := dialTCP(ctx, srv, addr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to enrollment endpoint %s: %w", addr, err)
+	}
+	conn := tls.Client(rawConn, tlsCfg)
+	defer conn.Close()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("connecting to enrollment endpoint %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("sending enrollment request: %w", err)
+	}
+	var resp pki.EnrollResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("reading enrollment response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("enrollment rejected by server: %s", resp.Error)
+	}
+	return &resp, nil
+}
+
+func parseEnrollCA(caPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(caPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("server returned no CA certificate")
+	}
+	ca, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CA returned by server: %w", err)
+	}
+	return ca, nil
+}
+
+// writePEMFile grava data atomicamente (tmp + rename) com o modo informado.
+func writePEMFile(path string, data []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating directory for %s: %w", path, err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		return fmt.Errorf("chmod %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("renaming %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+)
+
+// startFakeEnrollServer sobe um endpoint de enrollment mínimo (mesmo protocolo
+// do server) e retorna o endereço, o fingerprint da CA e o arquivo de tokens.
+func startFakeEnrollServer(t *testing.T) (addr, fingerprint, tokensFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	caPEM, caKeyPEM, err := pki.GenerateCA("Agent Enroll Test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPath := filepath.Join(dir, "ca.pem")
+	caKeyPath := filepath.Join(dir, "ca-key.pem")
+	os.WriteFile(caPath, caPEM, 0644)
+	os.WriteFile(caKeyPath, caKeyPEM, 0600)
+	ca, err := pki.LoadCA(caPath, caKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, err := ca.IssueServerCert([]string{"127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert.Certificate = append(cert.Certificate, ca.Cert.Raw)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{cert},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	tokensFile = filepath.Join(dir, "tokens.json")
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var req pki.EnrollRequest
+			var resp pki.EnrollResponse
+			if err := json.NewDecoder(conn).Decode(&req); err != nil {
+				resp.Error = err.Error()
+			} else if agentName, err := pki.ConsumeEnrollToken(tokensFile, req.Token); err != nil {
+				resp.Error = err.Error()
+			} else if issued, err := ca.SignClientCSR([]byte(req.CSR), agentName, time.Hour); err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.Certificate, resp.CA = string(issued), string(ca.CertPEM)
+			}
+			json.NewEncoder(conn).Encode(resp)
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), pki.Fingerprint(ca.Cert), tokensFile
+}
+
+func enrollTestConfig(dir, agentName string) *config.AgentConfig {
+	return &config.AgentConfig{
+		Agent:  config.AgentInfo{Name: agentName},
+		Server: config.ServerAddr{Address: "127.0.0.1:9847"},
+		TLS: config.TLSClient{
+			CACert:     filepath.Join(dir, "ca.pem"),
+			ClientCert: filepath.Join(dir, "agent.pem"),
+			ClientKey:  filepath.Join(dir, "agent-key.pem"),
+		},
+	}
+}
+
+func TestEnroll_WritesCertificateKeyAndCA(t *testing.T) {
+	addr, fingerprint, tokensFile := startFakeEnrollServer(t)
+	cfg := enrollTestConfig(t.TempDir(), "web-01")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	token, err := pki.CreateEnrollToken(tokensFile, "web-01", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Enroll(context.Background(), cfg, EnrollOptions{Token: token, Address: addr, CAFingerprint: fingerprint}, logger)
+	if err != nil {
+		t.Fatalf("Enroll: %v", err)
+	}
+
+	// O material gravado forma uma config mTLS válida.
+	if _, err := pki.NewClientTLSConfig(cfg.TLS.CACert, cfg.TLS.ClientCert, cfg.TLS.ClientKey); err != nil {
+		t.Fatalf("enrolled files are not a valid client TLS config: %v", err)
+	}
+	if fi, err := os.Stat(cfg.TLS.ClientKey); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("expected client key with mode 0600, got %v (%v)", fi.Mode().Perm(), err)
+	}
+
+	// Re-enrollment não sobrescreve sem --force; com a CA já local, o fingerprint é dispensado.
+	token, _ = pki.CreateEnrollToken(tokensFile, "web-01", time.Hour)
+	if err := Enroll(context.Background(), cfg, EnrollOptions{Token: token, Address: addr}, logger); err == nil {
+		t.Fatal("expected enroll to refuse overwriting existing certificate")
+	}
+	if err := Enroll(context.Background(), cfg, EnrollOptions{Token: token, Address: addr, Force: true}, logger); err != nil {
+		t.Fatalf("Enroll --force: %v", err)
+	}
+}
+
+func TestEnroll_RequiresMatchingFingerprintWithoutCA(t *testing.T) {
+	addr, _, tokensFile := startFakeEnrollServer(t)
+	cfg := enrollTestConfig(t.TempDir(), "web-01")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	token, _ := pki.CreateEnrollToken(tokensFile, "web-01", time.Hour)
+
+	if err := Enroll(context.Background(), cfg, EnrollOptions{Token: token, Address: addr}, logger); err == nil {
+		t.Fatal("expected enroll without CA and fingerprint to fail")
+	}
+	wrong := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	if err := Enroll(context.Background(), cfg, EnrollOptions{Token: token, Address: addr, CAFingerprint: wrong}, logger); err == nil {
+		t.Fatal("expected enroll with a non-matching fingerprint to fail")
+	}
+	for _, p := range []string{cfg.TLS.CACert, cfg.TLS.ClientCert, cfg.TLS.ClientKey} {
+		if _, err := os.Stat(p); err == nil {
+			t.Errorf("%s must not be written after a failed enrollment", p)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"io"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// newEntryManifest cria o manifest de arquivos de uma execução em dir
+// (os.TempDir() se vazio); nil se o backup entry não tem manifest habilitado.
+// Os sources opcionais ausentes (missing) vão no header do manifest.
+func newEntryManifest(entry config.BackupEntry, dir string, missing []string) (*manifest.Writer, error) {
+	if !entry.Manifest {
+		return nil, nil
+	}
+	mf, err := manifest.Create(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		if err := mf.WriteHeader(manifest.Header{MissingSources: missing}); err != nil {
+			mf.Remove()
+			return nil, err
+		}
+	}
+	return mf, nil
+}
+
+// writeManifestFrame envia o manifest ao server como frame Manifest, logo
+// antes do trailer. Backups vazios não levam manifest.
+func writeManifestFrame(w io.Writer, mf *manifest.Writer, res *StreamResult) error {
+	if mf == nil || res.Entries == 0 {
+		return nil
+	}
+	r, size, err := mf.Finish()
+	if err != nil {
+		return err
+	}
+	return protocol.WriteManifest(w, r, size)
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"path/filepath"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// FsckStateFiles verifica (e, com repair, repara) os arquivos de estado do
+// agent em daemon.state_dir: o histórico de execuções do scheduler, o
+// instante do último digest e as sessões interrompidas (resume-state). O reparo deve ser feito com o daemon parado.
+func FsckStateFiles(cfg *config.AgentConfig, repair bool) []statefile.Result {
+	return []statefile.Result{
+		statefile.Fsck("schedule-state", filepath.Join(cfg.Daemon.StateDir, scheduleStateFile), repair),
+		statefile.Fsck("digest-state", filepath.Join(cfg.Daemon.StateDir, digestStateFile), repair),
+		statefile.Fsck("resume-state", filepath.Join(cfg.Daemon.StateDir, resumeStateFile), repair),
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// connectUnix faz o handshake do agent com o server em addr (socket unix).
+func connectUnix(addr string) (net.Conn, *protocol.ACK, error) {
+	cfg := &config.AgentConfig{
+		Agent:  config.AgentInfo{Name: "web-01"},
+		Server: config.ServerAddr{Address: addr, Transport: config.TransportUnix},
+		Resume: config.ResumeConfig{BufferSizeRaw: 64 << 20},
+	}
+	entry := config.BackupEntry{Name: "daily", Storage: "app"}
+	conn, ack, _, err := initialConnect(context.Background(), cfg, entry, nil, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return conn, ack, err
+}
+
+// listenUnix abre um socket unix em um diretório temporário de caminho curto
+// (sockets unix têm limite de ~108 bytes).
+func listenUnix(t *testing.T) net.Listener {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "nbv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	ln, err := net.Listen("unix", filepath.Join(dir, "s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+// v6Session é o que o v6Server recebeu em uma conexão.
+type v6Session struct {
+	version  byte   // versão anunciada no handshake
+	afterACK []byte // tudo o que o agent enviou depois do ACK
+}
+
+// newV6Server sobe um server que reproduz o handleBackup de um server v6 já
+// implantado: rejeita apenas versões anteriores à v6, lê o handshake no
+// formato v6 seja qual for a versão anunciada, responde com o ACK v4 (sem
+// versão nem janela) e trata o byte seguinte como modo/ParallelInit v6.
+func newV6Server(t *testing.T) (net.Listener, <-chan v6Session) {
+	t.Helper()
+	ln := listenUnix(t)
+	sessions := make(chan v6Session, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var hdr [5]byte // magic + version
+				if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+					return
+				}
+				if hdr[4] < protocol.ProtocolVersion {
+					protocol.WriteACK(conn, protocol.StatusReject, "unsupported protocol version", "", protocol.CompressionGzip)
+					return
+				}
+				br := bufio.NewReader(conn)
+				for range 4 { // agent, storage, backup, client version
+					if _, err := br.ReadString('\n'); err != nil {
+						return
+					}
+				}
+				protocol.WriteACK(conn, protocol.StatusGo, "", "session-1", protocol.CompressionGzip)
+
+				var after bytes.Buffer
+				mode, err := br.ReadByte()
+				if err != nil {
+					return
+				}
+				after.WriteByte(mode)
+				if mode >= 1 {
+					// ParallelInit v6: [MaxStreams 1B] [ChunkSize 4B]
+					if _, err := io.CopyN(&after, br, 4); err != nil {
+						return
+					}
+					protocol.WriteParallelInitACK(conn, protocol.ParallelInitStatusOK)
+				}
+				io.Copy(&after, br)
+				sessions <- v6Session{version: hdr[4], afterACK: after.Bytes()}
+			}()
+		}
+	}()
+	return ln, sessions
+}
+
+// Agent novo contra um server v6 já implantado: o handshake não leva bytes que
+// o server v6 leria como dados, a sessão fica em v6 na mesma conexão, com a
+// janela default, e o ParallelInit sai no formato v6.
+func TestInitialConnect_V6Server(t *testing.T) {
+	ln, sessions := newV6Server(t)
+	conn, ack, err := connectUnix(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("initialConnect: %v", err)
+	}
+	if ack.Version != protocol.ProtocolVersion {
+		t.Fatalf("expected v%d session, got v%d", protocol.ProtocolVersion, ack.Version)
+	}
+	if ack.Window == nil || ack.Window.Interval != protocol.DefaultSACKInterval {
+		t.Fatalf("expected default window, got %+v", ack.Window)
+	}
+	if err := initParallelSession(conn, ack.Version, 2, 1<<20, 4<<20); err != nil {
+		t.Fatalf("initParallelSession: %v", err)
+	}
+	conn.Close()
+
+	got := <-sessions
+	if got.version != protocol.MaxProtocolVersion {
+		t.Fatalf("expected the v%d handshake, got v%d", protocol.MaxProtocolVersion, got.version)
+	}
+	select {
+	case again := <-sessions:
+		t.Fatalf("unexpected second connection %+v", again)
+	default:
+	}
+	var want bytes.Buffer
+	protocol.WriteParallelInit(&want, 2, 1<<20)
+	if !bytes.Equal(got.afterACK, want.Bytes()) {
+		t.Fatalf("v6 server read %x after the ACK, want the v6 ParallelInit %x", got.afterACK, want.Bytes())
+	}
+}
+
+// Server que só aceita versões mais novas que a do agent: a recusa é final,
+// sem nova tentativa, e aponta o agent como o lado a atualizar.
+func TestInitialConnect_ServerRequiresNewerAgent(t *testing.T) {
+	ln := listenUnix(t)
+	supported := protocol.VersionRange{Min: protocol.MaxProtocolVersion + 1, Max: protocol.MaxProtocolVersion + 2}
+	var handshakes atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			handshakes.Add(1)
+			var hdr [5]byte // magic + version
+			if _, err := io.ReadFull(conn, hdr[:]); err == nil {
+				mismatch := &protocol.VersionMismatchError{Agent: hdr[4], Server: supported}
+				protocol.WriteACKVersionMismatch(conn, mismatch.Error(), supported)
+			}
+			conn.Close()
+		}
+	}()
+
+	_, _, err := connectUnix(ln.Addr().String())
+	var mismatch *protocol.VersionMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected VersionMismatchError, got %v", err)
+	}
+	if mismatch.Agent != protocol.MaxProtocolVersion || mismatch.Server != supported || mismatch.Upgrade() != "agent" {
+		t.Fatalf("unexpected mismatch %+v (upgrade %s)", mismatch, mismatch.Upgrade())
+	}
+	if !errors.Is(err, protocol.ErrInvalidVersion) {
+		t.Fatal("expected errors.Is(err, ErrInvalidVersion)")
+	}
+	if n := handshakes.Load(); n != 1 {
+		t.Fatalf("expected a single handshake, got %d", n)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/logging"
+)
+
+// Parâmetros dos pings de healthcheck_url.
+const (
+	healthcheckTimeout    = 10 * time.Second // por tentativa
+	healthcheckAttempts   = 3
+	healthcheckRetryDelay = 1 * time.Second // dobra a cada retry
+)
+
+// healthcheckPinger pinga a healthcheck_url de um backup entry no estilo
+// healthchecks.io (dead man's switch): {url}/start no início da execução,
+// {url} no sucesso e {url}/fail na falha. Execuções adiadas ou canceladas
+// enviam {url}/log, que registra o motivo sem mudar o estado do check.
+// Falhas de ping são apenas logadas — nunca afetam o backup.
+type healthcheckPinger struct {
+	url        string
+	client     *http.Client
+	logger     *slog.Logger
+	retryDelay time.Duration
+}
+
+// newHealthcheckPinger retorna nil se o entry não tem healthcheck_url. Os
+// métodos aceitam receiver nil.
+func newHealthcheckPinger(entry config.BackupEntry, logger *slog.Logger) *healthcheckPinger {
+	if entry.HealthcheckURL == "" {
+		return nil
+	}
+	return &healthcheckPinger{
+		url:        entry.HealthcheckURL,
+		client:     &http.Client{Timeout: healthcheckTimeout},
+		logger:     logger.With("component", "healthcheck"),
+		retryDelay: healthcheckRetryDelay,
+	}
+}
+
+// Start sinaliza o início da execução.
+func (p *healthcheckPinger) Start(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	p.ping(ctx, "start", nil)
+}
+
+// Finish envia o resultado da execução, com bytes e duração no corpo.
+func (p *healthcheckPinger) Finish(ctx context.Context, run JobRun) {
+	if p == nil {
+		return
+	}
+	var suffix string
+	switch run.Status {
+	case "completed":
+	case "failed":
+		suffix = "fail"
+	default:
+		suffix = "log"
+	}
+	p.ping(ctx, suffix, []byte(healthcheckBody(run)))
+}
+
+// healthcheckBody monta o corpo do ping de resultado (texto, uma chave por
+// linha), com a redação do processo aplicada (logging.redact).
+func healthcheckBody(run JobRun) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "status: %s\n", run.Status)
+	fmt.Fprintf(&b, "bytes: %d\n", run.Bytes)
+	fmt.Fprintf(&b, "duration_seconds: %.1f\n", run.DurationSeconds)
+	if run.Empty {
+		b.WriteString("empty: true\n")
+	}
+	if len(run.MissingSources) > 0 {
+		fmt.Fprintf(&b, "missing_sources: %s\n", strings.Join(run.MissingSources, ", "))
+	}
+	if run.Error != "" {
+		fmt.Fprintf(&b, "error: %s\n", run.Error)
+	}
+	return logging.Redact(b.String())
+}
+
+// healthcheckTarget acrescenta suffix ao path da URL, preservando a query.
+func healthcheckTarget(raw, suffix string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if suffix != "" {
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + suffix
+		u.RawPath = ""
+	}
+	return u.String(), nil
+}
+
+// ping faz o POST com retries (erros de rede e 5xx).
+func (p *healthcheckPinger) ping(ctx context.Context, suffix string, body []byte) {
+	target, err := healthcheckTarget(p.url, suffix)
+	if err != nil {
+		p.logger.Warn("invalid healthcheck_url", "error", err)
+		return
+	}
+	kind := suffix
+	if kind == "" {
+		kind = "success"
+	}
+
+	delay := p.retryDelay
+	for attempt := 1; ; attempt++ {
+		retryable, err := p.post(ctx, target, body)
+		if err == nil {
+			p.logger.Debug("healthcheck ping sent", "ping", kind)
+			return
+		}
+		if !retryable || attempt == healthcheckAttempts {
+			p.logger.Warn("healthcheck ping failed", "ping", kind, "attempts", attempt, "error", err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			p.logger.Warn("healthcheck ping failed", "ping", kind, "error", ctx.Err())
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post faz um único POST e indica se a falha pode ser retentada.
+func (p *healthcheckPinger) post(ctx context.Context, target string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", "nbackup-agent")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, fmt.Errorf("healthcheck returned %s", resp.Status)
+}
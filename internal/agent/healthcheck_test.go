@@ -0,0 +1,123 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+type healthcheckPing struct {
+	path, body string
+}
+
+func newHealthcheckServer(t *testing.T) (*httptest.Server, chan healthcheckPing) {
+	t.Helper()
+	pings := make(chan healthcheckPing, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pings <- healthcheckPing{path: r.URL.Path, body: string(body)}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, pings
+}
+
+func nextPing(t *testing.T, pings chan healthcheckPing) healthcheckPing {
+	t.Helper()
+	select {
+	case p := <-pings:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for healthcheck ping")
+		return healthcheckPing{}
+	}
+}
+
+func TestScheduler_HealthcheckPings(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv, pings := newHealthcheckServer(t)
+
+	tests := []struct {
+		name     string
+		err      error
+		wantPath string
+		wantBody string
+	}{
+		{"success", nil, "/ping/abc", "bytes: 4096"},
+		{"failure", errors.New("connection refused"), "/ping/abc/fail", "error: connection refused"},
+		{"deferred", fmt.Errorf("window: %w", ErrBackupDeferred), "/ping/abc/log", "status: deferred"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := config.BackupEntry{Name: "app", Storage: "default", Schedule: "0 2 * * *", HealthcheckURL: srv.URL + "/ping/abc"}
+			runFn := func(ctx context.Context, cfg *config.AgentConfig, e config.BackupEntry, l *slog.Logger, job *BackupJob) error {
+				atomic.StoreInt64(&job.runBytes, 4096)
+				return tt.err
+			}
+			sched, err := NewScheduler(newTestSchedulerConfig(t.TempDir(), entry), logger, runFn, nil)
+			if err != nil {
+				t.Fatalf("NewScheduler: %v", err)
+			}
+			sched.executeJob(sched.Jobs()[0], entry, runFn, false)
+
+			if p := nextPing(t, pings); p.path != "/ping/abc/start" {
+				t.Errorf("expected start ping first, got %s", p.path)
+			}
+			p := nextPing(t, pings)
+			if p.path != tt.wantPath || !strings.Contains(p.body, tt.wantBody) || !strings.Contains(p.body, "duration_seconds: ") {
+				t.Errorf("got ping %s with body %q, want %s containing %q", p.path, p.body, tt.wantPath, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHealthcheckPinger_RetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < healthcheckAttempts {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	p := newHealthcheckPinger(config.BackupEntry{HealthcheckURL: srv.URL}, logger)
+	p.retryDelay = time.Millisecond
+	p.Finish(context.Background(), JobRun{Status: "completed"})
+	if calls.Load() != healthcheckAttempts {
+		t.Errorf("expected %d attempts, got %d", healthcheckAttempts, calls.Load())
+	}
+
+	// Sem healthcheck_url: pinger nil, métodos são no-op
+	none := newHealthcheckPinger(config.BackupEntry{}, logger)
+	none.Start(context.Background())
+	none.Finish(context.Background(), JobRun{Status: "failed"})
+}
+
+func TestHealthcheckTarget(t *testing.T) {
+	tests := []struct{ raw, suffix, want string }{
+		{"https://hc-ping.com/uuid", "start", "https://hc-ping.com/uuid/start"},
+		{"https://hc-ping.com/uuid/", "fail", "https://hc-ping.com/uuid/fail"},
+		{"https://hc.example.com/ping/key/slug?create=1", "start", "https://hc.example.com/ping/key/slug/start?create=1"},
+		{"https://hc-ping.com/uuid", "", "https://hc-ping.com/uuid"},
+	}
+	for _, tt := range tests {
+		got, err := healthcheckTarget(tt.raw, tt.suffix)
+		if err != nil || got != tt.want {
+			t.Errorf("healthcheckTarget(%q, %q) = %q, %v; want %q", tt.raw, tt.suffix, got, err, tt.want)
+		}
+	}
+}
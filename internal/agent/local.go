@@ -0,0 +1,305 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
+)
+
+// ErrLocalTargetUnavailable indica que o destino local (local.path) não está
+// disponível — tipicamente o drive removível não está montado. Não é
+// retentado: a execução fica como "deferred" e a próxima agendada tenta de novo.
+var ErrLocalTargetUnavailable = errors.New("local backup target unavailable")
+
+// localCatalogName é o catálogo mantido em cada diretório de backup local.
+const localCatalogName = "catalog.json"
+
+// localChecksumSuffix é a extensão do sidecar de checksum de cada archive,
+// no formato do sha256sum (verificável com `sha256sum -c`).
+const localChecksumSuffix = ".sha256"
+
+// LocalCatalog é o catálogo (stub) de um diretório de backup local: lista os
+// archives presentes após o commit e a rotação, do mais antigo ao mais recente.
+type LocalCatalog struct {
+	Agent     string                `json:"agent"`
+	Backup    string                `json:"backup"`
+	UpdatedAt time.Time             `json:"updated_at"`
+	Archives  []LocalCatalogArchive `json:"archives"`
+}
+
+// LocalCatalogArchive descreve um archive do catálogo local.
+type LocalCatalogArchive struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"` // vazio se o sidecar .sha256 estiver ausente
+}
+
+// runLocalBackup executa um backup no modo local (sem server): o stream
+// tar+compressão é gravado em {local.path}/{agent}/{backup}/ com o mesmo
+// commit atômico (temp + rename), nomenclatura e rotação do storage do server.
+//
+// Pipeline: Scanner → tar → compressor → arquivo temporário → rename.
+//
+// Após o commit grava o sidecar .sha256, aplica a rotação (exceto para
+// backups vazios, como no server) e reescreve o catalog.json.
+func runLocalBackup(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, logger *slog.Logger, progress *ProgressReporter, job *BackupJob) error {
+	target := entry.Local
+	logger = logger.With("backup", entry.Name, "local_path", target.Path)
+	logger.Info("starting local backup session")
+
+	// local.path não é criado: um drive removível desmontado deixa apenas o
+	// ponto de montagem (ou nada), e gravar ali encheria o disco do sistema
+	fi, err := os.Stat(target.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %v (is the drive mounted?)", ErrLocalTargetUnavailable, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%w: %s is not a directory", ErrLocalTargetUnavailable, target.Path)
+	}
+
+	dir := filepath.Join(target.Path, cfg.Agent.Name, entry.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating local backup directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "backup-*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	scanner := NewEntryScanner(entry)
+	mf, err := newEntryManifest(entry, dir, job.MissingSources())
+	if err != nil {
+		return err
+	}
+	defer mf.Remove()
+
+	mode := target.CompressionModeByte()
+	res, err := Stream(ctx, scanner, job.output(ctx, tmp), progress, nil, newCompression(entry.Compression, mode, logger), entry.BandwidthLimitRaw, entry.MaxSizeRaw, mf)
+	if err != nil {
+		handleMaxSizeAbort(err, job, nil, "", logger)
+		return fmt.Errorf("pipeline error: %w", err)
+	}
+	if err := checkAssertions(entry.Assertions, res, scanner); err != nil {
+		return err
+	}
+
+	checksum := res.Checksum
+	if res.Entries == 0 {
+		// Mesmo tratamento do server: um archive sem entradas, restaurável com tar
+		logger.Warn("sources produced no entries, writing empty archive")
+		if checksum, err = writeLocalEmptyArchive(tmp, mode); err != nil {
+			return err
+		}
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("syncing temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing temp file: %w", err)
+	}
+
+	finalName := localArchiveName(time.Now(), target.FileExtension())
+	finalPath := filepath.Join(dir, finalName)
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return fmt.Errorf("renaming temp to final: %w", err)
+	}
+	committed = true
+
+	// Manifest de arquivos (backups vazios não levam manifest, como no server)
+	if mf != nil && res.Entries > 0 {
+		if _, _, err := mf.Finish(); err != nil {
+			logger.Warn("writing file manifest failed", "error", err)
+		} else if err := os.Rename(mf.Path(), finalPath+manifest.Suffix); err != nil {
+			logger.Warn("writing file manifest failed", "error", err)
+		}
+	}
+
+	sidecar := fmt.Sprintf("%x  %s\n", checksum, finalName)
+	if err := writeFileAtomic(finalPath+localChecksumSuffix, []byte(sidecar)); err != nil {
+		return fmt.Errorf("writing checksum file: %w", err)
+	}
+
+	if res.Entries == 0 {
+		logger.Warn("empty backup committed (sources produced no entries), skipping rotation", "path", finalPath)
+	} else {
+		removed, err := rotateLocal(dir, target.MaxBackups)
+		if err != nil {
+			logger.Warn("local rotation failed", "error", err)
+		} else if len(removed) > 0 {
+			logger.Info("local rotation completed", "removed", removed)
+		}
+	}
+
+	if err := writeLocalCatalog(dir, cfg.Agent.Name, entry.Name); err != nil {
+		logger.Warn("writing local catalog failed", "error", err)
+	}
+
+	logger.Info("local backup completed successfully",
+		"path", finalPath,
+		"bytes", res.Size,
+		"checksum", fmt.Sprintf("%x", checksum),
+	)
+	res.Checksum = checksum
+	job.setRunResult(res)
+	return nil
+}
+
+// writeLocalEmptyArchive grava em w um archive sem entradas (apenas o
+// end-of-archive do tar) no modo de compressão e retorna o SHA-256 gravado.
+func writeLocalEmptyArchive(w io.Writer, mode byte) ([32]byte, error) {
+	var checksum [32]byte
+	hasher := sha256.New()
+	compressor, err := newCompressor(io.MultiWriter(w, hasher), Compression{Mode: mode}, false)
+	if err != nil {
+		return checksum, err
+	}
+	if err := tar.NewWriter(compressor).Close(); err != nil {
+		compressor.Close()
+		return checksum, fmt.Errorf("writing empty tar: %w", err)
+	}
+	if err := compressor.Close(); err != nil {
+		return checksum, fmt.Errorf("closing empty archive: %w", err)
+	}
+	copy(checksum[:], hasher.Sum(nil))
+	return checksum, nil
+}
+
+// localArchiveName gera o nome do archive com o mesmo timestamp UTC usado
+// pelo storage do server (ordem lexicográfica = ordem cronológica).
+func localArchiveName(now time.Time, fileExtension string) string {
+	timestamp := strings.ReplaceAll(now.UTC().Format("2006-01-02T15-04-05.000"), ".", "-")
+	return timestamp + fileExtension
+}
+
+// isLocalArchive verifica se o nome é um archive de backup (.tar.gz ou .tar.zst).
+func isLocalArchive(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tar.zst")
+}
+
+// listLocalArchives retorna os archives do diretório em ordem cronológica.
+func listLocalArchives(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading local backup directory: %w", err)
+	}
+	var archives []string
+	for _, e := range entries {
+		if !e.IsDir() && isLocalArchive(e.Name()) {
+			archives = append(archives, e.Name())
+		}
+	}
+	sort.Strings(archives)
+	return archives, nil
+}
+
+// rotateLocal remove os archives excedentes (e seus sidecars .sha256 e de manifest),
+// mantendo os maxBackups mais recentes. Retorna os nomes removidos.
+func rotateLocal(dir string, maxBackups int) ([]string, error) {
+	if maxBackups <= 0 {
+		return nil, nil
+	}
+	archives, err := listLocalArchives(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(archives) <= maxBackups {
+		return nil, nil
+	}
+
+	var removed []string
+	for _, name := range archives[:len(archives)-maxBackups] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return removed, fmt.Errorf("removing old backup %s: %w", name, err)
+		}
+		os.Remove(filepath.Join(dir, name+localChecksumSuffix))
+		os.Remove(filepath.Join(dir, name+manifest.Suffix))
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+// writeLocalCatalog reescreve o catalog.json a partir dos archives presentes
+// no diretório, lendo o checksum de cada sidecar .sha256.
+func writeLocalCatalog(dir, agentName, backupName string) error {
+	archives, err := listLocalArchives(dir)
+	if err != nil {
+		return err
+	}
+
+	catalog := LocalCatalog{
+		Agent:     agentName,
+		Backup:    backupName,
+		UpdatedAt: time.Now().UTC(),
+		Archives:  make([]LocalCatalogArchive, 0, len(archives)),
+	}
+	for _, name := range archives {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		catalog.Archives = append(catalog.Archives, LocalCatalogArchive{
+			Name:   name,
+			Size:   fi.Size(),
+			SHA256: readLocalChecksum(filepath.Join(dir, name+localChecksumSuffix)),
+		})
+	}
+
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling local catalog: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(dir, localCatalogName), append(data, '\n'))
+}
+
+// readLocalChecksum lê o hash de um sidecar no formato do sha256sum.
+// Retorna "" se o arquivo não existir ou estiver malformado.
+func readLocalChecksum(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	sum, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if len(sum) != sha256.Size*2 {
+		return ""
+	}
+	return sum
+}
+
+// writeFileAtomic grava data em path atomicamente (tmp + rename).
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
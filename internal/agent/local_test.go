@@ -0,0 +1,211 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
+)
+
+func localTestEntry(target string, sources ...string) config.BackupEntry {
+	entry := config.BackupEntry{
+		Name:  "home",
+		Local: config.LocalTarget{Path: target, MaxBackups: 2, CompressionMode: "gzip"},
+	}
+	for _, s := range sources {
+		entry.Sources = append(entry.Sources, config.BackupSource{Path: s})
+	}
+	return entry
+}
+
+func TestRunLocalBackup_CommitChecksumRotateCatalog(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "notes.txt"), "local backup content")
+	target := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.AgentConfig{Agent: config.AgentInfo{Name: "laptop-01"}}
+	entry := localTestEntry(target, src)
+
+	for i := 0; i < 3; i++ {
+		if err := RunBackup(context.Background(), cfg, entry, logger, nil, nil, nil); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+		time.Sleep(5 * time.Millisecond) // nomes com resolução de ms
+	}
+
+	dir := filepath.Join(target, "laptop-01", "home")
+	archives, err := listLocalArchives(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 2 {
+		t.Fatalf("expected 2 archives after rotation (max_backups 2), got %v", archives)
+	}
+
+	var catalog LocalCatalog
+	data, err := os.ReadFile(filepath.Join(dir, localCatalogName))
+	if err != nil {
+		t.Fatalf("reading catalog: %v", err)
+	}
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		t.Fatalf("parsing catalog: %v", err)
+	}
+	if catalog.Agent != "laptop-01" || catalog.Backup != "home" || len(catalog.Archives) != 2 {
+		t.Fatalf("unexpected catalog: %+v", catalog)
+	}
+
+	for i, name := range archives {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := fmt.Sprintf("%x", sha256.Sum256(content))
+		sidecar, _ := os.ReadFile(filepath.Join(dir, name+localChecksumSuffix))
+		if string(sidecar) != sum+"  "+name+"\n" {
+			t.Errorf("sidecar for %s = %q, want sha256sum line with %s", name, sidecar, sum)
+		}
+		if catalog.Archives[i].Name != name || catalog.Archives[i].SHA256 != sum || catalog.Archives[i].Size != int64(len(content)) {
+			t.Errorf("catalog entry %d = %+v, want %s (%d bytes, %s)", i, catalog.Archives[i], name, len(content), sum)
+		}
+	}
+
+	// Sidecars dos archives rotacionados também são removidos
+	sidecars, _ := filepath.Glob(filepath.Join(dir, "*"+localChecksumSuffix))
+	if len(sidecars) != 2 {
+		t.Errorf("expected 2 checksum sidecars, got %v", sidecars)
+	}
+
+	// O archive é o mesmo formato do server: tar.gz restaurável
+	f, err := os.Open(filepath.Join(dir, archives[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	found := false
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading tar: %v", err)
+		}
+		if filepath.Base(hdr.Name) == "notes.txt" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected notes.txt in local archive")
+	}
+}
+
+func TestRunLocalBackup_EmptySkipsRotation(t *testing.T) {
+	target := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.AgentConfig{Agent: config.AgentInfo{Name: "laptop-01"}}
+	dir := filepath.Join(target, "laptop-01", "home")
+	os.MkdirAll(dir, 0755)
+	for _, name := range []string{"2025-01-01T00-00-00-000.tar.gz", "2025-01-02T00-00-00-000.tar.gz"} {
+		writeFile(t, filepath.Join(dir, name), "old")
+	}
+
+	entry := localTestEntry(target, filepath.Join(t.TempDir(), "missing"))
+	if err := RunBackup(context.Background(), cfg, entry, logger, nil, nil, nil); err != nil {
+		t.Fatalf("RunBackup: %v", err)
+	}
+
+	archives, _ := listLocalArchives(dir)
+	if len(archives) != 3 {
+		t.Fatalf("expected empty backup committed without rotation, got %v", archives)
+	}
+	f, err := os.Open(filepath.Join(dir, archives[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("empty archive is not gzip: %v", err)
+	}
+	if _, err := tar.NewReader(gz).Next(); err != io.EOF {
+		t.Errorf("expected empty tar, got %v", err)
+	}
+}
+
+func TestRunLocalBackup_TargetUnavailable(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.AgentConfig{Agent: config.AgentInfo{Name: "laptop-01"}}
+	target := filepath.Join(t.TempDir(), "unmounted")
+
+	err := RunBackup(context.Background(), cfg, localTestEntry(target, t.TempDir()), logger, nil, nil, nil)
+	if !errors.Is(err, ErrLocalTargetUnavailable) {
+		t.Fatalf("expected ErrLocalTargetUnavailable, got %v", err)
+	}
+	if _, statErr := os.Stat(target); !os.IsNotExist(statErr) {
+		t.Error("local.path must not be created when missing")
+	}
+}
+
+func TestRunLocalBackup_ManifestRecordsMissingSources(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "notes.txt"), "local backup content")
+	missing := filepath.Join(t.TempDir(), "unmounted")
+	target := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.AgentConfig{Agent: config.AgentInfo{Name: "laptop-01"}, Retry: config.RetryInfo{MaxAttempts: 1}}
+	optional := false
+	entry := localTestEntry(target, src)
+	entry.Manifest = true
+	entry.Sources = append(entry.Sources, config.BackupSource{Path: missing, Required: &optional})
+	job := &BackupJob{Entry: entry}
+
+	if err := RunBackupWithRetry(context.Background(), cfg, entry, logger, nil, job, nil); err != nil {
+		t.Fatalf("RunBackupWithRetry: %v", err)
+	}
+
+	dir := filepath.Join(target, "laptop-01", "home")
+	archives, _ := listLocalArchives(dir)
+	if len(archives) != 1 {
+		t.Fatalf("expected 1 archive, got %v", archives)
+	}
+	f, err := os.Open(filepath.Join(dir, archives[0]+manifest.Suffix))
+	if err != nil {
+		t.Fatalf("opening manifest: %v", err)
+	}
+	defer f.Close()
+	var paths []string
+	h, err := manifest.ReadWithHeader(f, func(e manifest.Entry) error {
+		paths = append(paths, e.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("reading manifest: %v", err)
+	}
+	if len(h.MissingSources) != 1 || h.MissingSources[0] != missing {
+		t.Errorf("expected header missing_sources [%s], got %+v", missing, h)
+	}
+	if len(paths) == 0 {
+		t.Error("expected the present source in the manifest entries")
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrMaxSizeExceeded indica que o archive passou do max_size do entry (ex:
+// um diretório de logs que cresceu sem controle). A execução é abortada no
+// meio do stream, a sessão é descartada no server e o backup não é
+// retentado: outra tentativa leria os mesmos sources.
+var ErrMaxSizeExceeded = errors.New("backup exceeded max_size")
+
+// maxSizeLargestFiles é o número de maiores arquivos listados no erro.
+const maxSizeLargestFiles = 5
+
+// maxSizeWriter recusa escritas que levariam o archive além de limit. Os
+// compressores escrevem de goroutines próprias, por isso os contadores são
+// atômicos.
+type maxSizeWriter struct {
+	w        io.Writer
+	limit    int64
+	n        atomic.Int64
+	exceeded atomic.Bool
+}
+
+func (m *maxSizeWriter) Write(p []byte) (int, error) {
+	if m.n.Load()+int64(len(p)) > m.limit {
+		m.exceeded.Store(true)
+		return 0, ErrMaxSizeExceeded
+	}
+	n, err := m.w.Write(p)
+	m.n.Add(int64(n))
+	return n, err
+}
+
+// sizedPath é um arquivo e seu tamanho.
+type sizedPath struct {
+	path string
+	size int64
+}
+
+// largestFiles mantém os maiores arquivos regulares vistos pelo stream.
+type largestFiles []sizedPath
+
+func (l *largestFiles) add(path string, size int64) {
+	if len(*l) == maxSizeLargestFiles && size <= (*l)[len(*l)-1].size {
+		return
+	}
+	*l = append(*l, sizedPath{path, size})
+	sort.SliceStable(*l, func(i, j int) bool { return (*l)[i].size > (*l)[j].size })
+	if len(*l) > maxSizeLargestFiles {
+		*l = (*l)[:maxSizeLargestFiles]
+	}
+}
+
+// maxSizeError descreve o abort por max_size com o que foi observado até
+// ali, para diagnosticar o que cresceu. O texto vai para o log e para o
+// histórico local (`nbackup-agent status`).
+type maxSizeError struct {
+	limit       int64
+	written     int64  // bytes do archive (compactado) produzidos até o abort
+	sourceBytes int64  // soma dos arquivos regulares lidos até o abort
+	objects     int64  // entradas gravadas até o abort
+	path        string // entrada sendo gravada no abort
+	largest     largestFiles
+}
+
+func (e *maxSizeError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v (%s): archive reached %s after %d objects and %s of source files",
+		ErrMaxSizeExceeded, formatBytes(e.limit), formatBytes(e.written), e.objects, formatBytes(e.sourceBytes))
+	if e.path != "" {
+		fmt.Fprintf(&b, ", while archiving %s", e.path)
+	}
+	if len(e.largest) > 0 {
+		parts := make([]string, len(e.largest))
+		for i, f := range e.largest {
+			parts[i] = fmt.Sprintf("%s (%s)", f.path, formatBytes(f.size))
+		}
+		b.WriteString("; largest files: " + strings.Join(parts, ", "))
+	}
+	return b.String()
+}
+
+func (e *maxSizeError) Unwrap() error { return ErrMaxSizeExceeded }
+
+// handleMaxSizeAbort trata um erro de pipeline: se foi um abort por
+// max_size, registra o tamanho do archive no abort no histórico da execução
+// e descarta a sessão no server (sessionID vazio = backup local).
+func handleMaxSizeAbort(err error, job *BackupJob, controlCh *ControlChannel, sessionID string, logger *slog.Logger) {
+	var mse *maxSizeError
+	if !errors.As(err, &mse) {
+		return
+	}
+	job.setRunBytes(uint64(mse.written))
+	if sessionID != "" {
+		discardSession(controlCh, sessionID, logger)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func TestStream_MaxSize(t *testing.T) {
+	dir := t.TempDir()
+	// Dados aleatórios não comprimem: o archive cresce com os arquivos
+	for name, size := range map[string]int{"small.bin": 64 << 10, "runaway.log": 4 << 20} {
+		data := make([]byte, size)
+		rand.Read(data)
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, mode := range []byte{protocol.CompressionGzip, protocol.CompressionZstd} {
+		_, err := Stream(context.Background(), NewScanner([]string{dir}, nil), io.Discard, nil, nil, Compression{Mode: mode}, 0, 1<<20, nil)
+		if !errors.Is(err, ErrMaxSizeExceeded) {
+			t.Fatalf("mode %d: expected ErrMaxSizeExceeded, got %v", mode, err)
+		}
+		msg := err.Error()
+		for _, want := range []string{"(1.0 MB)", "while archiving " + filepath.Join(dir, "runaway.log"), "largest files: " + filepath.Join(dir, "runaway.log") + " (4.0 MB)"} {
+			if !strings.Contains(msg, want) {
+				t.Errorf("mode %d: error %q missing %q", mode, msg, want)
+			}
+		}
+		var mse *maxSizeError
+		if !errors.As(err, &mse) || mse.written > 1<<20 {
+			t.Errorf("mode %d: unexpected size at abort: %+v", mode, mse)
+		}
+
+		res, err := Stream(context.Background(), NewScanner([]string{dir}, nil), io.Discard, nil, nil, Compression{Mode: mode}, 0, 16<<20, nil)
+		if err != nil || res.Entries != 3 {
+			t.Fatalf("mode %d: under the limit: res=%+v err=%v", mode, res, err)
+		}
+	}
+}
+
+func TestLargestFiles(t *testing.T) {
+	var l largestFiles
+	for i, size := range []int64{5, 1, 9, 3, 7, 2, 8} {
+		l.add(string(rune('a'+i)), size)
+	}
+	var got []int64
+	for _, f := range l {
+		got = append(got, f.size)
+	}
+	if len(got) != maxSizeLargestFiles || got[0] != 9 || got[4] != 3 {
+		t.Errorf("unexpected largest files: %v", got)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// Formatos de saída dos comandos do agent (--output).
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// ParseOutput valida o valor de --output.
+func ParseOutput(s string) (string, error) {
+	switch s {
+	case OutputText, OutputJSON:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid output %q (expected %s or %s)", s, OutputText, OutputJSON)
+}
+
+// Status de um BackupResult além dos de JobRun ("completed", "failed", "deferred").
+const ResultSkipped = "skipped" // suprimido por min_interval
+
+// BackupResult é o resultado de um backup entry executado por --once, no
+// formato de --output json.
+type BackupResult struct {
+	Backup          string         `json:"backup"`
+	Storage         string         `json:"storage"`
+	Status          string         `json:"status"`
+	Start           time.Time      `json:"start,omitzero"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	Bytes           int64          `json:"bytes"`                  // archive comprimido enviado
+	SourceBytes     int64          `json:"source_bytes,omitempty"` // conteúdo dos arquivos regulares
+	Objects         int64          `json:"objects,omitempty"`
+	Checksum        string         `json:"checksum,omitempty"` // SHA-256 do archive (hex)
+	Empty           bool           `json:"empty,omitempty"`
+	Retries         int            `json:"retries"`
+	Streams         []StreamTotals `json:"streams,omitempty"` // só em backups paralelos
+	MissingSources  []string       `json:"missing_sources,omitempty"`
+	Error           string         `json:"error,omitempty"`
+}
+
+// StreamTotals são os totais de um stream de um backup paralelo.
+type StreamTotals struct {
+	Index           uint8  `json:"index"`
+	BytesSent       uint64 `json:"bytes_sent"` // inclui retransmissões
+	RetransmitBytes uint64 `json:"retransmit_bytes"`
+}
+
+// newBackupResult monta o BackupResult de entry a partir do registro run e
+// dos detalhes coletados em job.
+func newBackupResult(entry config.BackupEntry, run JobRun, job *BackupJob) BackupResult {
+	res := BackupResult{
+		Backup:          entry.Name,
+		Storage:         entry.Storage,
+		Status:          run.Status,
+		Start:           run.Start,
+		DurationSeconds: run.DurationSeconds,
+		Bytes:           run.Bytes,
+		Empty:           run.Empty,
+		MissingSources:  run.MissingSources,
+		Error:           run.Error,
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	res.Retries = job.runRetries
+	if run.Status == "completed" {
+		res.Objects, res.SourceBytes = job.runObjects, job.runSourceBytes
+		res.Checksum = hex.EncodeToString(job.runChecksum[:])
+	}
+	for _, st := range job.runStreams {
+		res.Streams = append(res.Streams, StreamTotals{
+			Index:           st.StreamIndex,
+			BytesSent:       st.BytesSent,
+			RetransmitBytes: st.RetransmitBytes,
+		})
+	}
+	return res
+}
+
+// OnceReport é a saída de `--once --output json`.
+type OnceReport struct {
+	Status  string         `json:"status"` // "completed" ou "failed" (algum entry falhou)
+	Backups []BackupResult `json:"backups"`
+}
+
+// WriteOnceJSON escreve o resultado de RunAllBackups em JSON indentado.
+func WriteOnceJSON(w io.Writer, results []BackupResult, err error) error {
+	rep := OnceReport{Status: "completed", Backups: results}
+	if rep.Backups == nil {
+		rep.Backups = []BackupResult{}
+	}
+	if err != nil {
+		rep.Status = "failed"
+	}
+	return writeJSON(w, rep)
+}
+
+// HealthReport é o resultado de CheckHealth.
+type HealthReport struct {
+	Address  string          `json:"address"`
+	Status   string          `json:"status"`
+	DiskFree uint64          `json:"disk_free"` // menor entre os storages do server
+	Storages []StorageHealth `json:"storages"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// StorageHealth é o estado de um storage em HealthReport.
+type StorageHealth struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	DiskFree uint64 `json:"disk_free,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// WriteHealthJSON escreve rep em JSON indentado.
+func WriteHealthJSON(w io.Writer, rep *HealthReport) error {
+	return writeJSON(w, rep)
+}
+
+// RestoreReport é a saída de `restore --output json`.
+type RestoreReport struct {
+	Status  string `json:"status"`            // "completed" ou "failed"
+	Archive string `json:"archive,omitempty"` // archive de onde o arquivo foi lido
+	Path    string `json:"path,omitempty"`    // caminho local gravado
+	Size    int64  `json:"size"`
+	Error   string `json:"error,omitempty"`
+}
+
+// WriteRestoreJSON escreve o resultado de RestoreFile em JSON indentado.
+func WriteRestoreJSON(w io.Writer, res *RestoreResult, err error) error {
+	rep := RestoreReport{Status: "completed"}
+	if res != nil {
+		rep.Archive, rep.Path, rep.Size = res.Archive, res.Path, res.Size
+	}
+	if err != nil {
+		rep.Status, rep.Error = "failed", err.Error()
+	}
+	return writeJSON(w, rep)
+}
+
+// ExplainReport é a saída de `explain-path --output json`.
+type ExplainReport struct {
+	Path    string            `json:"path"`
+	Backups []ExplainDecision `json:"backups"` // vazio: nenhum source contém o caminho
+}
+
+// ExplainDecision é a avaliação do caminho para um backup entry.
+type ExplainDecision struct {
+	Backup    string `json:"backup"`
+	Source    string `json:"source"`
+	DecidedBy string `json:"decided_by"` // o próprio caminho ou o diretório ancestral que decidiu
+	Included  bool   `json:"included"`
+	Reason    string `json:"reason"` // excluded, included, filtered ou default
+	Rule      string `json:"rule,omitempty"`
+}
+
+// WriteExplanationsJSON escreve as avaliações de path em JSON indentado.
+func WriteExplanationsJSON(w io.Writer, path string, explanations []PathExplanation) error {
+	rep := ExplainReport{Path: path, Backups: []ExplainDecision{}}
+	for _, e := range explanations {
+		rep.Backups = append(rep.Backups, ExplainDecision{
+			Backup:    e.Backup,
+			Source:    e.Source,
+			DecidedBy: e.DecidedBy,
+			Included:  e.Included,
+			Reason:    e.Reason,
+			Rule:      e.Rule,
+		})
+	}
+	return writeJSON(w, rep)
+}
+
+// WriteAdminJSON escreve a resposta de trigger/cancel/reload em JSON
+// indentado. Sem resposta (daemon inacessível), apenas o erro.
+func WriteAdminJSON(w io.Writer, resp *AdminResponse, err error) error {
+	if resp == nil {
+		resp = &AdminResponse{}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	return writeJSON(w, resp)
+}
+
+// EnrollReport é a saída de `enroll --output json`.
+type EnrollReport struct {
+	Status      string `json:"status"` // "completed" ou "failed"
+	Agent       string `json:"agent"`
+	Certificate string `json:"certificate,omitempty"` // tls.client_cert gravado
+	Error       string `json:"error,omitempty"`
+}
+
+// WriteEnrollJSON escreve o resultado de Enroll em JSON indentado.
+func WriteEnrollJSON(w io.Writer, cfg *config.AgentConfig, err error) error {
+	rep := EnrollReport{Status: "completed", Agent: cfg.Agent.Name, Certificate: cfg.TLS.ClientCert}
+	if err != nil {
+		rep.Status, rep.Certificate, rep.Error = "failed", "", err.Error()
+	}
+	return writeJSON(w, rep)
+}
+
+// MigrateReport é a saída de `migrate-config --output json`.
+type MigrateReport struct {
+	Config        string   `json:"config"`
+	ConfigVersion int      `json:"config_version"` // versão alvo
+	Migrations    []string `json:"migrations"`     // vazio: já está na versão atual
+	Written       bool     `json:"written"`        // arquivo reescrito (original em {config}.bak)
+	Error         string   `json:"error,omitempty"`
+}
+
+// WriteMigrateJSON escreve o resultado de MigrateAgentConfigFile em JSON indentado.
+func WriteMigrateJSON(w io.Writer, path string, notes []string, write bool, err error) error {
+	rep := MigrateReport{Config: path, ConfigVersion: config.CurrentConfigVersion, Migrations: notes, Written: write && err == nil && len(notes) > 0}
+	if rep.Migrations == nil {
+		rep.Migrations = []string{}
+	}
+	if err != nil {
+		rep.Error = err.Error()
+	}
+	return writeJSON(w, rep)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func TestParseOutput(t *testing.T) {
+	for _, s := range []string{OutputText, OutputJSON} {
+		if got, err := ParseOutput(s); err != nil || got != s {
+			t.Errorf("ParseOutput(%q) = %q, %v", s, got, err)
+		}
+	}
+	if _, err := ParseOutput("yaml"); err == nil {
+		t.Error("expected error for unsupported output")
+	}
+}
+
+func TestNewBackupResult_CollectsJobDetails(t *testing.T) {
+	entry := config.BackupEntry{Name: "app", Storage: "scripts"}
+	job := &BackupJob{Entry: entry}
+	job.addRunRetry()
+	job.setRunResult(&StreamResult{Checksum: [32]byte{0xab}, Size: 2048, Entries: 12, Bytes: 8192})
+	job.setRunStreams([]protocol.StreamTransferStats{
+		{StreamIndex: 0, BytesSent: 1500, RetransmitBytes: 100},
+		{StreamIndex: 1, BytesSent: 648},
+	})
+
+	run := JobRun{Start: time.Now(), DurationSeconds: 1.5, Bytes: 2048, Status: "completed"}
+	res := newBackupResult(entry, run, job)
+	if res.Backup != "app" || res.Storage != "scripts" || res.Status != "completed" {
+		t.Fatalf("unexpected identification: %+v", res)
+	}
+	if res.Retries != 1 || res.Objects != 12 || res.SourceBytes != 8192 || res.Bytes != 2048 {
+		t.Errorf("unexpected counters: %+v", res)
+	}
+	if len(res.Checksum) != 64 || res.Checksum[:2] != "ab" {
+		t.Errorf("unexpected checksum %q", res.Checksum)
+	}
+	if len(res.Streams) != 2 || res.Streams[0].RetransmitBytes != 100 || res.Streams[1].BytesSent != 648 {
+		t.Errorf("unexpected streams: %+v", res.Streams)
+	}
+
+	// Execução que falhou não reporta checksum
+	run.Status, run.Error = "failed", "connection refused"
+	if res := newBackupResult(entry, run, job); res.Checksum != "" || res.Error == "" {
+		t.Errorf("unexpected failed result: %+v", res)
+	}
+}
+
+func TestWriteOnceJSON(t *testing.T) {
+	var buf bytes.Buffer
+	results := []BackupResult{{Backup: "app", Status: "failed", Error: "boom"}}
+	if err := WriteOnceJSON(&buf, results, errors.New("backup \"app\" failed")); err != nil {
+		t.Fatalf("WriteOnceJSON: %v", err)
+	}
+	var rep OnceReport
+	if err := json.Unmarshal(buf.Bytes(), &rep); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if rep.Status != "failed" || len(rep.Backups) != 1 || rep.Backups[0].Error != "boom" {
+		t.Errorf("unexpected report: %+v", rep)
+	}
+
+	buf.Reset()
+	WriteOnceJSON(&buf, nil, nil)
+	if got := buf.String(); got != "{\n  \"status\": \"completed\",\n  \"backups\": []\n}\n" {
+		t.Errorf("unexpected empty report: %q", got)
+	}
+}
+
+func TestWriteRestoreJSON(t *testing.T) {
+	var buf bytes.Buffer
+	res := &RestoreResult{Archive: "2026-02-12T02-00-00-000.tar.gz", Path: "/tmp/restore/etc/hosts", Size: 12}
+	if err := WriteRestoreJSON(&buf, res, nil); err != nil {
+		t.Fatalf("WriteRestoreJSON: %v", err)
+	}
+	var rep RestoreReport
+	if err := json.Unmarshal(buf.Bytes(), &rep); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if rep.Status != "completed" || rep.Archive != res.Archive || rep.Path != res.Path || rep.Size != 12 {
+		t.Errorf("unexpected report: %+v", rep)
+	}
+
+	buf.Reset()
+	WriteRestoreJSON(&buf, nil, errors.New("file not found in archive"))
+	rep = RestoreReport{}
+	json.Unmarshal(buf.Bytes(), &rep)
+	if rep.Status != "failed" || rep.Error != "file not found in archive" {
+		t.Errorf("unexpected failed report: %+v", rep)
+	}
+}
+
+func TestWriteExplanationsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	explanations := []PathExplanation{{
+		Backup:       "app",
+		Source:       "/srv/app",
+		DecidedBy:    "/srv/app/cache",
+		PathDecision: PathDecision{Reason: DecisionExcluded, Rule: "**/cache"},
+	}}
+	if err := WriteExplanationsJSON(&buf, "/srv/app/cache/x", explanations); err != nil {
+		t.Fatalf("WriteExplanationsJSON: %v", err)
+	}
+	var rep ExplainReport
+	if err := json.Unmarshal(buf.Bytes(), &rep); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if rep.Path != "/srv/app/cache/x" || len(rep.Backups) != 1 {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+	if d := rep.Backups[0]; d.Included || d.Reason != DecisionExcluded || d.Rule != "**/cache" || d.DecidedBy != "/srv/app/cache" {
+		t.Errorf("unexpected decision: %+v", d)
+	}
+
+	buf.Reset()
+	WriteExplanationsJSON(&buf, "/tmp/x", nil)
+	if !bytes.Contains(buf.Bytes(), []byte(`"backups": []`)) {
+		t.Errorf("expected an empty backups list: %s", buf.String())
+	}
+}
+
+func TestWriteAdminJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAdminJSON(&buf, &AdminResponse{OK: true, Message: "backup app triggered"}, nil); err != nil {
+		t.Fatalf("WriteAdminJSON: %v", err)
+	}
+	var resp AdminResponse
+	if err := json.Unmarshal(buf.Bytes(), &resp); err != nil || !resp.OK || resp.Message != "backup app triggered" {
+		t.Errorf("unexpected response: %+v (%v)", resp, err)
+	}
+
+	// Daemon inacessível: sem resposta, apenas o erro
+	buf.Reset()
+	WriteAdminJSON(&buf, nil, errors.New("connecting to agent daemon"))
+	resp = AdminResponse{}
+	json.Unmarshal(buf.Bytes(), &resp)
+	if resp.OK || resp.Error != "connecting to agent daemon" {
+		t.Errorf("unexpected error response: %+v", resp)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// RegexPatternPrefix marca um pattern de include/exclude como expressão
+// regular (sintaxe RE2), testada contra o caminho absoluto.
+const RegexPatternPrefix = "re:"
+
+// pathPattern é um pattern de include/exclude compilado. Formas aceitas:
+//   - "re:<regex>"          → regex contra o caminho absoluto (ex: "re:^/var/log/.*\.gz$")
+//   - "**/*.log", "a/**/b"  → doublestar: ** casa zero ou mais diretórios,
+//     contra o caminho relativo a / (um "/" inicial é opcional)
+//   - "*.log"               → glob pelo basename ou pelo caminho completo
+//   - ".git/**"             → diretório com esse nome em qualquer nível e todo o conteúdo
+//   - "*/access-logs/"      → trailing slash: apenas diretórios, pelo nome
+type pathPattern struct {
+	raw  string
+	re   *regexp.Regexp // re:
+	glob string         // doublestar (sem "/" inicial)
+}
+
+// compilePatterns compila os patterns; regex inválidas (rejeitadas na
+// validação da config) nunca casam.
+func compilePatterns(raw []string) []pathPattern {
+	patterns := make([]pathPattern, 0, len(raw))
+	for _, r := range raw {
+		p := pathPattern{raw: r}
+		switch {
+		case strings.HasPrefix(r, RegexPatternPrefix):
+			re, err := regexp.Compile(strings.TrimPrefix(r, RegexPatternPrefix))
+			if err != nil {
+				continue
+			}
+			p.re = re
+		case isDoublestar(r):
+			p.glob = strings.TrimPrefix(r, "/")
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// isDoublestar indica se r usa a sintaxe doublestar. "nome/**" sem outra
+// barra mantém a semântica antiga (diretório com esse nome em qualquer nível).
+func isDoublestar(r string) bool {
+	if !strings.Contains(r, "**") {
+		return false
+	}
+	prefix, legacy := strings.CutSuffix(r, "/**")
+	return !legacy || strings.Contains(prefix, "/") || strings.Contains(prefix, "**")
+}
+
+// match testa o pattern contra relPath (caminho relativo a /).
+func (p pathPattern) match(relPath string, isDir bool) bool {
+	switch {
+	case p.re != nil:
+		return p.re.MatchString("/" + relPath)
+	case p.glob != "":
+		return matchDoublestar(strings.Split(p.glob, "/"), strings.Split(relPath, "/"))
+	}
+	return matchLegacy(p.raw, relPath, isDir)
+}
+
+// matchDoublestar casa os segmentos de um glob com os de um caminho; "**"
+// casa zero ou mais segmentos.
+func matchDoublestar(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range path {
+				if matchDoublestar(pattern, path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+// matchLegacy implementa as formas simples de pattern (sem ** nem re:).
+func matchLegacy(pattern, relPath string, isDir bool) bool {
+	parts := strings.Split(relPath, "/")
+
+	// Trailing slash = match apenas diretórios pelo nome
+	if strings.HasSuffix(pattern, "/") {
+		if !isDir {
+			return false
+		}
+		// Remove */ prefix se existir (ex: "*/access-logs/" → "access-logs")
+		dirPattern := strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "*/")
+		for _, part := range parts {
+			if matched, _ := filepath.Match(dirPattern, part); matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Patterns com "/**" suffix — diretório e todo conteúdo recursivamente
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		for _, part := range parts {
+			if matched, _ := filepath.Match(prefix, part); matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Caminho completo ou basename (ex: "*.log" casa qualquer .log)
+	if matched, _ := filepath.Match(pattern, relPath); matched {
+		return true
+	}
+	matched, _ := filepath.Match(pattern, filepath.Base(relPath))
+	return matched
+}
+
+// Motivos de uma PathDecision.
+const (
+	DecisionExcluded = "excluded" // casou um exclude (e nenhum include)
+	DecisionIncluded = "included" // casou um include
+	DecisionFiltered = "filtered" // excluído por um filtro de tamanho/idade do source
+	DecisionDefault  = "default"  // nenhum pattern casou
+)
+
+// PathDecision é o resultado da avaliação dos patterns para um caminho.
+type PathDecision struct {
+	Included bool
+	Reason   string // DecisionExcluded, DecisionIncluded, DecisionFiltered ou DecisionDefault
+	Rule     string // pattern ou filtro que decidiu ("" para default)
+}
+
+// decide aplica as regras de precedência a relPath: um include que casa
+// sempre inclui — é uma exceção aos excludes (ex: exclude "**/*.log" +
+// include "**/important.log"); senão, um exclude que casa exclui (diretórios
+// excluídos não são percorridos); senão, o caminho é incluído.
+func (s *Scanner) decide(relPath string, isDir bool) PathDecision {
+	for _, p := range s.includes {
+		if p.match(relPath, isDir) {
+			return PathDecision{Included: true, Reason: DecisionIncluded, Rule: p.raw}
+		}
+	}
+	for _, p := range s.excludes {
+		if p.match(relPath, isDir) {
+			return PathDecision{Reason: DecisionExcluded, Rule: p.raw}
+		}
+	}
+	return PathDecision{Included: true, Reason: DecisionDefault}
+}
+
+// Explain avalia path como o Scan faria: os diretórios entre o source e path
+// são avaliados primeiro (um diretório excluído esconde todo o conteúdo) e,
+// por fim, os filtros de tamanho/idade do source. info é o stat de path (nil
+// se não existe: avaliado como arquivo, sem filtros). Retorna o source que
+// contém path, o caminho que decidiu (path ou um ancestral) e a decisão; ok
+// é false se path não está em nenhum source.
+func (s *Scanner) Explain(path string, info fs.FileInfo) (source, decidedBy string, d PathDecision, ok bool) {
+	path = filepath.Clean(path)
+	isDir := info != nil && info.IsDir()
+	for _, src := range s.sources {
+		root := filepath.Clean(src.path)
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+
+		// Ancestrais a partir do próprio source
+		cur := root
+		ancestors := []string{root}
+		if rel != "." {
+			for _, part := range strings.Split(rel, "/") {
+				cur = filepath.Join(cur, part)
+				ancestors = append(ancestors, cur)
+			}
+		}
+		for i, p := range ancestors {
+			last := i == len(ancestors)-1
+			d := s.decide(strings.TrimPrefix(p, "/"), !last || isDir)
+			if !d.Included {
+				return root, p, d, true
+			}
+			if last {
+				if info != nil {
+					if rule := src.fileFilter(info, time.Now()); rule != "" {
+						d = PathDecision{Reason: DecisionFiltered, Rule: rule}
+					}
+				}
+				return root, p, d, true
+			}
+		}
+	}
+	return "", "", PathDecision{}, false
+}
+
+// PathExplanation é a avaliação de um caminho para um backup entry
+// (subcomando explain-path).
+type PathExplanation struct {
+	Backup    string
+	Source    string
+	DecidedBy string // o próprio caminho ou o diretório ancestral que decidiu
+	PathDecision
+}
+
+// ExplainPath avalia path em cada backup entry de cfg cujo source o contém
+// (ou apenas em backup, se não vazio). Caminhos inexistentes são avaliados
+// como arquivos, apenas pelos patterns.
+func ExplainPath(cfg *config.AgentConfig, backup, path string) []PathExplanation {
+	info, _ := os.Stat(path)
+
+	var out []PathExplanation
+	for _, entry := range cfg.Backups {
+		if backup != "" && entry.Name != backup {
+			continue
+		}
+		source, decidedBy, d, ok := NewEntryScanner(entry).Explain(path, info)
+		if !ok {
+			continue
+		}
+		out = append(out, PathExplanation{Backup: entry.Name, Source: source, DecidedBy: decidedBy, PathDecision: d})
+	}
+	return out
+}
+
+// WriteExplanations escreve as avaliações de path, uma por backup entry.
+func WriteExplanations(w io.Writer, path string, explanations []PathExplanation) error {
+	for _, e := range explanations {
+		verdict := "included"
+		if !e.Included {
+			verdict = "excluded"
+		}
+		var why string
+		switch e.Reason {
+		case DecisionIncluded:
+			why = fmt.Sprintf("include rule %q", e.Rule)
+		case DecisionExcluded:
+			why = fmt.Sprintf("exclude rule %q", e.Rule)
+		case DecisionFiltered:
+			why = "source filter " + e.Rule
+		default:
+			why = "no rule matched"
+		}
+		if e.DecidedBy != filepath.Clean(path) {
+			why += " on parent directory " + e.DecidedBy
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s (source %s): %s\n", e.Backup, verdict, e.Source, why); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestPathPattern_Match(t *testing.T) {
+	cases := []struct {
+		pattern string
+		relPath string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "var/log/app.log", false, true},
+		{"*.log", "var/log/app.txt", false, false},
+		{".git/**", "src/repo/.git", true, true},
+		{"*/access-logs/", "var/access-logs", true, true},
+		{"*/access-logs/", "var/access-logs", false, false},
+		{"**/*.log", "app.log", false, true},
+		{"**/*.log", "var/log/deep/app.log", false, true},
+		{"**/*.log", "var/log/app.txt", false, false},
+		{"var/cache/**", "var/cache", true, true},
+		{"var/cache/**", "var/cache/a/b", false, true},
+		{"var/cache/**", "srv/var/cache/a", false, false},
+		{"/srv/**/tmp", "srv/a/b/tmp", true, true},
+		{"/srv/**/tmp", "srv/tmp", true, true},
+		{"/srv/**/tmp", "srv/tmp/x", false, false},
+		{`re:^/var/log/.*\.gz$`, "var/log/nginx/access.log.1.gz", false, true},
+		{`re:^/var/log/.*\.gz$`, "srv/var/log/a.gz", false, false},
+		{"re:(", "anything", false, false},
+	}
+	for _, c := range cases {
+		p := compilePatterns([]string{c.pattern})
+		got := len(p) == 1 && p[0].match(c.relPath, c.isDir)
+		if got != c.want {
+			t.Errorf("%q vs %q (dir=%v): got %v, want %v", c.pattern, c.relPath, c.isDir, got, c.want)
+		}
+	}
+}
+
+func TestScanner_IncludePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"app/important.log", "app/debug.log", "app/data.db", "cache/blob", "etc/app.conf"} {
+		path := filepath.Join(dir, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func(include, exclude []string) []string {
+		s := NewEntryScanner(config.BackupEntry{
+			Sources: []config.BackupSource{{Path: dir}},
+			Include: include,
+			Exclude: exclude,
+		})
+		var files []string
+		err := s.Scan(context.Background(), func(e FileEntry) error {
+			if e.Info.Mode().IsRegular() {
+				rel, _ := filepath.Rel(dir, e.Path)
+				files = append(files, rel)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		sort.Strings(files)
+		return files
+	}
+
+	// Include é exceção ao exclude
+	got := scan([]string{"**/important.log"}, []string{"**/*.log", "cache/"})
+	if want := "app/data.db app/important.log etc/app.conf"; strings.Join(got, " ") != want {
+		t.Errorf("include over exclude: got %v, want %s", got, want)
+	}
+
+	// Whitelist: exclude tudo, incluindo diretórios (para a travessia) e os arquivos desejados
+	got = scan([]string{"*/", "**/*.conf", `re:\.db$`}, []string{"**"})
+	if want := "app/data.db etc/app.conf"; strings.Join(got, " ") != want {
+		t.Errorf("include whitelist: got %v, want %s", got, want)
+	}
+}
+
+func TestExplainPath(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "cache", "sub"), 0755)
+	cfg := &config.AgentConfig{Backups: []config.BackupEntry{
+		{Name: "app", Sources: []config.BackupSource{{Path: dir}}, Include: []string{"**/keep.txt"}, Exclude: []string{"cache/", "*.tmp"}},
+		{Name: "other", Sources: []config.BackupSource{{Path: "/nonexistent"}}},
+	}}
+
+	for _, c := range []struct {
+		path      string
+		included  bool
+		reason    string
+		rule      string
+		decidedBy string
+	}{
+		{filepath.Join(dir, "a.txt"), true, DecisionDefault, "", ""},
+		{filepath.Join(dir, "a.tmp"), false, DecisionExcluded, "*.tmp", ""},
+		{filepath.Join(dir, "x", "keep.txt"), true, DecisionIncluded, "**/keep.txt", ""},
+		{filepath.Join(dir, "cache", "sub", "keep.txt"), false, DecisionExcluded, "cache/", filepath.Join(dir, "cache")},
+	} {
+		got := ExplainPath(cfg, "", c.path)
+		if len(got) != 1 || got[0].Backup != "app" {
+			t.Fatalf("%s: unexpected explanations %+v", c.path, got)
+		}
+		want := c.decidedBy
+		if want == "" {
+			want = c.path
+		}
+		if e := got[0]; e.Included != c.included || e.Reason != c.reason || e.Rule != c.rule || e.DecidedBy != want {
+			t.Errorf("%s: got %+v", c.path, e)
+		}
+	}
+
+	// Filtros de tamanho do source
+	big := filepath.Join(dir, "big.bin")
+	os.WriteFile(big, make([]byte, 4096), 0644)
+	cfg.Backups[0].Sources[0].MaxFileSizeRaw = 1024
+	if got := ExplainPath(cfg, "app", big); len(got) != 1 || got[0].Included || got[0].Reason != DecisionFiltered || got[0].Rule != "max_file_size 1.0 KB" {
+		t.Errorf("filtered file: got %+v", got)
+	}
+
+	if got := ExplainPath(cfg, "", "/elsewhere/file"); len(got) != 0 {
+		t.Errorf("path outside sources: %+v", got)
+	}
+
+	var buf bytes.Buffer
+	path := filepath.Join(dir, "cache", "sub", "keep.txt")
+	WriteExplanations(&buf, path, ExplainPath(cfg, "app", path))
+	if out := buf.String(); !strings.Contains(out, "app: excluded") || !strings.Contains(out, `exclude rule "cache/" on parent directory`) {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"golang.org/x/time/rate"
+)
+
+// errPoolClosed é retornado por acquire quando o daemon está encerrando.
+var errPoolClosed = errors.New("backup pool closed: daemon is shutting down")
+
+// backupPool é o pool de execuções do agent: limita os backups simultâneos
+// (daemon.max_concurrent_backups) e aplica o limite de banda combinado
+// (daemon.bandwidth_limit) a todos eles. Execuções além do limite aguardam
+// uma vaga, concedida pela maior backups[].priority e, no empate, por ordem
+// de chegada. É compartilhado entre reloads: backups em andamento continuam
+// ocupando suas vagas e os novos limites valem a partir do reload.
+type backupPool struct {
+	mu      sync.Mutex
+	limit   int // 0 = sem limite
+	running int
+	waiting []*poolWaiter
+	seq     uint64
+	closed  bool
+
+	bandwidth *rate.Limiter // rate.Inf = sem limite
+}
+
+// poolWaiter é uma execução aguardando vaga; ready é fechado quando a vaga é
+// concedida (ou o pool fechado, com err preenchido).
+type poolWaiter struct {
+	name     string
+	priority int
+	seq      uint64
+	ready    chan struct{}
+	err      error
+}
+
+// newBackupPool cria o pool com os limites de daemon.
+func newBackupPool(d config.DaemonInfo) *backupPool {
+	p := &backupPool{bandwidth: rate.NewLimiter(rate.Inf, maxBurstSize)}
+	p.setLimits(d)
+	return p
+}
+
+// setLimits aplica os limites de uma nova config (reload). Um limite maior
+// libera execuções da fila na hora; um menor só vale para as próximas vagas.
+func (p *backupPool) setLimits(d config.DaemonInfo) {
+	if d.BandwidthLimitRaw > 0 {
+		p.bandwidth.SetLimit(rate.Limit(d.BandwidthLimitRaw))
+		p.bandwidth.SetBurst(int(min(d.BandwidthLimitRaw, maxBurstSize)))
+	} else {
+		p.bandwidth.SetLimit(rate.Inf)
+		p.bandwidth.SetBurst(maxBurstSize)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limit = d.MaxConcurrentBackups
+	for len(p.waiting) > 0 && p.hasSlotLocked() {
+		p.grantLocked()
+	}
+}
+
+func (p *backupPool) hasSlotLocked() bool {
+	return p.limit <= 0 || p.running < p.limit
+}
+
+// acquire ocupa uma vaga para o backup name, aguardando na fila se o limite
+// foi atingido. queued é chamado uma vez se a execução precisar esperar.
+// Retorna ctx.Err() se o backup for cancelado na fila e errPoolClosed no
+// shutdown. release devolve a vaga ao fim da execução.
+func (p *backupPool) acquire(ctx context.Context, name string, priority int, queued func(position int)) (release func(), err error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errPoolClosed
+	}
+	if len(p.waiting) == 0 && p.hasSlotLocked() {
+		p.running++
+		p.mu.Unlock()
+		return p.release, nil
+	}
+	p.seq++
+	w := &poolWaiter{name: name, priority: priority, seq: p.seq, ready: make(chan struct{})}
+	p.waiting = append(p.waiting, w)
+	position := p.positionLocked(w)
+	p.mu.Unlock()
+
+	if queued != nil {
+		queued(position)
+	}
+
+	select {
+	case <-w.ready:
+		if w.err != nil {
+			return nil, w.err
+		}
+		return p.release, nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Vaga concedida junto com o cancelamento: devolve
+			if w.err == nil {
+				p.releaseLocked()
+			}
+		default:
+			p.removeLocked(w)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// take ocupa uma vaga sem aguardar o limite (backups coordenados pelo
+// server, que não podem atrasar o snapshot_group).
+func (p *backupPool) take() (release func()) {
+	p.mu.Lock()
+	p.running++
+	p.mu.Unlock()
+	return p.release
+}
+
+func (p *backupPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.releaseLocked()
+}
+
+func (p *backupPool) releaseLocked() {
+	p.running--
+	for len(p.waiting) > 0 && p.hasSlotLocked() {
+		p.grantLocked()
+	}
+}
+
+// grantLocked concede uma vaga à execução de maior prioridade da fila.
+func (p *backupPool) grantLocked() {
+	best := 0
+	for i, w := range p.waiting {
+		b := p.waiting[best]
+		if w.priority > b.priority || (w.priority == b.priority && w.seq < b.seq) {
+			best = i
+		}
+	}
+	w := p.waiting[best]
+	p.waiting = append(p.waiting[:best], p.waiting[best+1:]...)
+	p.running++
+	close(w.ready)
+}
+
+func (p *backupPool) removeLocked(w *poolWaiter) {
+	for i, x := range p.waiting {
+		if x == w {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// positionLocked retorna a posição de w na ordem de concessão (1 = próximo).
+func (p *backupPool) positionLocked(w *poolWaiter) int {
+	pos := 1
+	for _, x := range p.waiting {
+		if x != w && (x.priority > w.priority || (x.priority == w.priority && x.seq < w.seq)) {
+			pos++
+		}
+	}
+	return pos
+}
+
+// queuePositions retorna a posição na fila (1 = próximo) de cada backup
+// aguardando vaga.
+func (p *backupPool) queuePositions() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[string]int, len(p.waiting))
+	for _, w := range p.waiting {
+		out[w.name] = p.positionLocked(w)
+	}
+	return out
+}
+
+// close encerra o pool no shutdown: as execuções na fila desistem com
+// errPoolClosed e novas não começam. As em andamento não são afetadas.
+func (p *backupPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, w := range p.waiting {
+		w.err = errPoolClosed
+		close(w.ready)
+	}
+	p.waiting = nil
+}
+
+// writer aplica o limite de banda combinado a w. Nil-safe.
+func (p *backupPool) writer(ctx context.Context, w io.Writer) io.Writer {
+	if p == nil {
+		return w
+	}
+	return &poolWriter{w: w, limiter: p.bandwidth, ctx: ctx}
+}
+
+// poolWriter é o ThrottledWriter do limite combinado: o limiter é
+// compartilhado entre os backups e pode mudar num reload durante a escrita.
+type poolWriter struct {
+	w       io.Writer
+	limiter *rate.Limiter
+	ctx     context.Context
+}
+
+func (pw *poolWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if pw.limiter.Limit() == rate.Inf {
+			n, err := pw.w.Write(p)
+			return total + n, err
+		}
+		chunk := min(len(p), pw.limiter.Burst())
+		if err := pw.limiter.WaitN(pw.ctx, chunk); err != nil {
+			if chunk > pw.limiter.Burst() {
+				continue // burst reduzido por um reload entre Burst() e WaitN
+			}
+			return total, err
+		}
+		n, err := pw.w.Write(p[:chunk])
+		total += n
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// acquireAsync enfileira name no pool e devolve o canal que recebe o release
+// (ou nil em caso de erro) quando a vaga for concedida.
+func acquireAsync(t *testing.T, ctx context.Context, p *backupPool, name string, priority int) (<-chan func(), <-chan error) {
+	t.Helper()
+	queued := make(chan struct{})
+	granted := make(chan func(), 1)
+	failed := make(chan error, 1)
+	go func() {
+		release, err := p.acquire(ctx, name, priority, func(int) { close(queued) })
+		if err != nil {
+			failed <- err
+			return
+		}
+		granted <- release
+	}()
+	select {
+	case <-queued:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s: expected to wait for a slot", name)
+	}
+	return granted, failed
+}
+
+func TestBackupPool_LimitAndPriorityOrder(t *testing.T) {
+	p := newBackupPool(config.DaemonInfo{MaxConcurrentBackups: 1})
+
+	release, err := p.acquire(context.Background(), "home", 0, nil)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	low1, _ := acquireAsync(t, context.Background(), p, "low-1", 0)
+	low2, _ := acquireAsync(t, context.Background(), p, "low-2", 0)
+	high, _ := acquireAsync(t, context.Background(), p, "config", 10)
+
+	want := map[string]int{"config": 1, "low-1": 2, "low-2": 3}
+	if got := p.queuePositions(); len(got) != 3 || got["config"] != 1 || got["low-1"] != 2 || got["low-2"] != 3 {
+		t.Fatalf("queue positions = %v, want %v", got, want)
+	}
+
+	// Maior prioridade primeiro; no empate, ordem de chegada
+	release()
+	for _, next := range []<-chan func(){high, low1, low2} {
+		select {
+		case r := <-next:
+			r()
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected queued backup to be granted in priority order")
+		}
+	}
+}
+
+func TestBackupPool_CancelWhileQueued(t *testing.T) {
+	p := newBackupPool(config.DaemonInfo{MaxConcurrentBackups: 1})
+	release, _ := p.acquire(context.Background(), "home", 0, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, failed := acquireAsync(t, ctx, p, "config", 0)
+	cancel()
+	if err := <-failed; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(p.queuePositions()) != 0 {
+		t.Error("expected cancelled backup removed from the queue")
+	}
+
+	release()
+	if r, err := p.acquire(context.Background(), "db", 0, nil); err != nil {
+		t.Fatalf("expected slot freed after release, got %v", err)
+	} else {
+		r()
+	}
+}
+
+func TestBackupPool_CloseFailsQueued(t *testing.T) {
+	p := newBackupPool(config.DaemonInfo{MaxConcurrentBackups: 1})
+	p.acquire(context.Background(), "home", 0, nil)
+
+	_, failed := acquireAsync(t, context.Background(), p, "config", 0)
+	p.close()
+	if err := <-failed; !errors.Is(err, errPoolClosed) {
+		t.Fatalf("expected errPoolClosed, got %v", err)
+	}
+	if _, err := p.acquire(context.Background(), "db", 0, nil); !errors.Is(err, errPoolClosed) {
+		t.Fatalf("expected closed pool to refuse new backups, got %v", err)
+	}
+}
+
+func TestBackupPool_SetLimitsGrantsQueued(t *testing.T) {
+	p := newBackupPool(config.DaemonInfo{MaxConcurrentBackups: 1})
+	p.acquire(context.Background(), "home", 0, nil)
+	granted, _ := acquireAsync(t, context.Background(), p, "config", 0)
+
+	// take ignora o limite (backups coordenados)
+	p.take()
+
+	p.setLimits(config.DaemonInfo{MaxConcurrentBackups: 3})
+	select {
+	case <-granted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected raised limit to grant the queued backup")
+	}
+}
+
+func TestBackupPool_WriterCombinedBandwidth(t *testing.T) {
+	var nilPool *backupPool
+	var buf bytes.Buffer
+	if nilPool.writer(context.Background(), &buf) != &buf {
+		t.Error("expected nil pool to return the destination unchanged")
+	}
+
+	// 64KB/s compartilhados: dois writers de 64KB precisam de ~1s juntos
+	// (o burst inicial cobre o primeiro segundo de um deles)
+	p := newBackupPool(config.DaemonInfo{BandwidthLimitRaw: 64 * 1024})
+	data := make([]byte, 64*1024)
+	start := time.Now()
+	for _, name := range []string{"a", "b"} {
+		var out bytes.Buffer
+		if n, err := p.writer(context.Background(), &out).Write(data); err != nil || n != len(data) || out.Len() != len(data) {
+			t.Fatalf("%s: write = %d, %v", name, n, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("expected combined limit to throttle the second writer, took %s", elapsed)
+	}
+}
@@ -8,21 +8,32 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/protocol"
 )
 
+// streamRateWindow é o intervalo mínimo entre duas amostras das taxas por
+// stream: com o ticker de 500ms, a taxa oscilaria a cada chunk enviado.
+const streamRateWindow = 2 * time.Second
+
 // ProgressReporter exibe progresso de backup no terminal.
-// Mostra barra, bytes, velocidade, objetos, elapsed, ETA e retries.
+// Mostra barra, percentual, bytes, velocidade, razão de compressão, objetos,
+// elapsed, ETA, retries e a taxa de cada stream paralelo.
 type ProgressReporter struct {
 	name string
 
-	// Contadores atômicos
+	// Contadores atômicos: bytesWritten é o archive comprimido entregue ao
+	// destino e rawBytes o tar antes da compressão
 	bytesWritten atomic.Int64
+	rawBytes     atomic.Int64
 	objectsDone  atomic.Int64
 	retries      atomic.Int32
 
-	// Totais estimados (do pré-scan) — atômicos pois PreScan roda em background
+	// Totais estimados (do pré-scan) — atômicos pois PreScan roda em background.
+	// totalBytes é o tamanho raw dos arquivos.
 	totalBytes   atomic.Int64
 	totalObjects atomic.Int64
 
@@ -30,11 +41,24 @@ type ProgressReporter struct {
 	activeStreams atomic.Int32
 	maxStreams    atomic.Int32
 
+	// Taxas por stream, amostradas de streamStats a cada streamRateWindow
+	streamMu    sync.Mutex
+	streamStats func() []protocol.StreamTransferStats
+	streamSent  map[uint8]uint64
+	streamRates []streamRate
+	streamAt    time.Time
+
 	startTime      time.Time
 	warmupDuration time.Duration // período sem exibir speed/ETA
 	done           chan struct{}
 }
 
+// streamRate é a taxa de envio de um stream na última amostra.
+type streamRate struct {
+	index uint8
+	bps   float64
+}
+
 // NewProgressReporter cria um reporter e inicia o ticker de renderização.
 func NewProgressReporter(name string, totalBytes, totalObjects int64) *ProgressReporter {
 	p := &ProgressReporter{
@@ -49,11 +73,18 @@ func NewProgressReporter(name string, totalBytes, totalObjects int64) *ProgressR
 	return p
 }
 
-// AddBytes registra bytes escritos (chamado pelo pipeline de streaming).
+// AddBytes registra bytes do archive comprimido escritos no destino
+// (chamado pelo pipeline de streaming).
 func (p *ProgressReporter) AddBytes(n int64) {
 	p.bytesWritten.Add(n)
 }
 
+// AddRawBytes registra bytes de tar entregues ao compressor. É a medida de
+// progresso comparada ao total do pré-scan.
+func (p *ProgressReporter) AddRawBytes(n int64) {
+	p.rawBytes.Add(n)
+}
+
 // AddObject registra um objeto processado (arquivo/dir adicionado ao tar).
 func (p *ProgressReporter) AddObject() {
 	p.objectsDone.Add(1)
@@ -64,7 +95,8 @@ func (p *ProgressReporter) AddRetry() {
 	p.retries.Add(1)
 }
 
-// SetTotals atualiza os totais estimados (chamado quando PreScan termina em background).
+// SetTotals atualiza os totais estimados (chamado quando PreScan termina em
+// background). totalBytes é o tamanho raw dos arquivos.
 func (p *ProgressReporter) SetTotals(totalBytes, totalObjects int64) {
 	p.totalBytes.Store(totalBytes)
 	p.totalObjects.Store(totalObjects)
@@ -76,6 +108,48 @@ func (p *ProgressReporter) SetStreams(active, max int) {
 	p.maxStreams.Store(int32(max))
 }
 
+// SetStreamStats define a fonte dos contadores de envio por stream
+// (Dispatcher.TransferStats) usada para exibir a taxa de cada stream. Cada
+// tentativa de backup paralelo registra o seu dispatcher.
+func (p *ProgressReporter) SetStreamStats(fn func() []protocol.StreamTransferStats) {
+	p.streamMu.Lock()
+	defer p.streamMu.Unlock()
+	p.streamStats = fn
+	p.streamSent = nil
+	p.streamRates = nil
+	p.streamAt = time.Time{}
+}
+
+// sampleStreams recalcula as taxas por stream se streamRateWindow passou
+// desde a última amostra e retorna as taxas vigentes.
+func (p *ProgressReporter) sampleStreams(now time.Time) []streamRate {
+	p.streamMu.Lock()
+	defer p.streamMu.Unlock()
+	if p.streamStats == nil {
+		return nil
+	}
+	if !p.streamAt.IsZero() && now.Sub(p.streamAt) < streamRateWindow {
+		return p.streamRates
+	}
+
+	stats := p.streamStats()
+	sent := make(map[uint8]uint64, len(stats))
+	var rates []streamRate
+	for _, st := range stats {
+		sent[st.StreamIndex] = st.BytesSent
+		if p.streamSent == nil {
+			continue
+		}
+		var bps float64
+		if prev := p.streamSent[st.StreamIndex]; st.BytesSent > prev {
+			bps = float64(st.BytesSent-prev) / now.Sub(p.streamAt).Seconds()
+		}
+		rates = append(rates, streamRate{index: st.StreamIndex, bps: bps})
+	}
+	p.streamSent, p.streamRates, p.streamAt = sent, rates, now
+	return rates
+}
+
 // Stop para o ticker e imprime a linha final.
 func (p *ProgressReporter) Stop() {
 	close(p.done)
@@ -99,36 +173,38 @@ func (p *ProgressReporter) renderLoop() {
 // render desenha a barra de progresso no stderr.
 func (p *ProgressReporter) render(final bool) {
 	bytes := p.bytesWritten.Load()
+	raw := p.rawBytes.Load()
 	objects := p.objectsDone.Load()
 	retries := p.retries.Load()
 	totalBytes := p.totalBytes.Load()
 	totalObjects := p.totalObjects.Load()
-	elapsed := time.Since(p.startTime)
+	now := time.Now()
+	elapsed := now.Sub(p.startTime)
 
-	// Velocidade e ETA só após warm-up
+	// Velocidade e ETA só após warm-up. speed é a taxa do archive comprimido
+	// (o que vai para a rede); rawSpeed a taxa de leitura, comparável ao
+	// total do pré-scan.
 	elapsedSec := elapsed.Seconds()
 	warmedUp := elapsed >= p.warmupDuration
-	var speed float64
+	var speed, rawSpeed float64
 	var objsPerSec float64
 	if warmedUp && elapsedSec > 0.1 {
 		speed = float64(bytes) / elapsedSec
+		rawSpeed = float64(raw) / elapsedSec
 		objsPerSec = float64(objects) / elapsedSec
 	}
 
 	// Barra de progresso (30 chars)
 	barWidth := 30
-	var bar string
-	var pct float64
+	var bar, pctStr string
 	if totalBytes > 0 {
-		pct = float64(bytes) / float64(totalBytes)
+		pct := float64(raw) / float64(totalBytes)
 		if pct > 1.0 {
-			pct = 1.0 // compressão pode levar a menos bytes que raw
+			pct = 1.0 // headers do tar e arquivos que cresceram após o pré-scan
 		}
 		filled := int(pct * float64(barWidth))
-		if filled > barWidth {
-			filled = barWidth
-		}
 		bar = strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled)
+		pctStr = fmt.Sprintf(" %3d%%", int(pct*100))
 	} else {
 		// Sem total — spinner simples
 		pos := int(elapsed.Seconds()*2) % barWidth
@@ -139,13 +215,13 @@ func (p *ProgressReporter) render(final bool) {
 	eta := "∞"
 	var etaBytesSec, etaObjsSec float64
 
-	// ETA por bytes
-	if totalBytes > 0 && speed > 0 {
-		remBytes := float64(totalBytes) - float64(bytes)
+	// ETA por bytes (raw, mesma unidade do total do pré-scan)
+	if totalBytes > 0 && rawSpeed > 0 {
+		remBytes := float64(totalBytes) - float64(raw)
 		if remBytes < 0 {
 			remBytes = 0
 		}
-		etaBytesSec = remBytes / speed
+		etaBytesSec = remBytes / rawSpeed
 	}
 
 	// ETA por objetos
@@ -160,7 +236,7 @@ func (p *ProgressReporter) render(final bool) {
 	// Escolhe o cenário mais pessimista (maior ETA)
 	// Só calcula se temos pelo menos um total conhecido (prescan completo)
 	hasTotals := totalBytes > 0 || totalObjects > 0
-	if hasTotals && (speed > 0 || objsPerSec > 0) {
+	if hasTotals && (rawSpeed > 0 || objsPerSec > 0) {
 		pessimistic := etaBytesSec
 		if etaObjsSec > pessimistic {
 			pessimistic = etaObjsSec
@@ -177,12 +253,15 @@ func (p *ProgressReporter) render(final bool) {
 		retriesStr = fmt.Sprintf("  │  retries: %d", retries)
 	}
 
-	// Streams paralelos
+	// Streams paralelos, com a taxa de cada um quando há amostra
 	streamsStr := ""
 	maxStr := p.maxStreams.Load()
 	if maxStr > 1 {
 		actStr := p.activeStreams.Load()
 		streamsStr = fmt.Sprintf("  │  ⇅ %d/%d", actStr, maxStr)
+		if rates := p.sampleStreams(now); len(rates) > 0 && !final {
+			streamsStr += " (" + formatStreamRates(rates) + ")"
+		}
 	}
 
 	// Formata bytes e velocidade
@@ -191,23 +270,23 @@ func (p *ProgressReporter) render(final bool) {
 	var line string
 	if !warmedUp && !final {
 		// Warm-up: exibe apenas barra + bytes + objetos + elapsed (sem speed/ETA)
-		line = fmt.Sprintf("\r[%s] %s  %s  │  %s objs  │  %s  │  warming up...",
-			p.name, bar, bytesStr,
+		line = fmt.Sprintf("\r[%s] %s%s  %s  │  %s objs  │  %s  │  warming up...",
+			p.name, bar, pctStr, bytesStr,
 			fmtObjs(objects, totalObjects),
 			elapsedStr,
 		)
 	} else {
 		speedStr := formatBytes(int64(speed)) + "/s"
-		line = fmt.Sprintf("\r[%s] %s  %s  │  %s  │  %s objs (%s/s)  │  %s  │  ETA %s%s%s",
-			p.name, bar, bytesStr, speedStr,
+		line = fmt.Sprintf("\r[%s] %s%s  %s  │  %s  │  ratio %s  │  %s objs (%s/s)  │  %s  │  ETA %s%s%s",
+			p.name, bar, pctStr, bytesStr, speedStr, formatRatio(raw, bytes),
 			fmtObjs(objects, totalObjects), formatNumber(int64(objsPerSec)),
 			elapsedStr, eta, streamsStr, retriesStr,
 		)
 	}
 
 	// Pad com espaços para limpar restos de linha anterior.
-	// Usa 200 para acomodar linhas longas com streams + retries.
-	padLen := 200
+	// Usa 240 para acomodar linhas longas com taxas por stream + retries.
+	padLen := 240
 	lineRunes := len([]rune(line))
 	if lineRunes < padLen {
 		line += strings.Repeat(" ", padLen-lineRunes)
@@ -220,6 +299,25 @@ func (p *ProgressReporter) render(final bool) {
 	}
 }
 
+// formatRatio formata a razão de compressão (raw:comprimido), "-" antes do
+// primeiro byte comprimido.
+func formatRatio(raw, compressed int64) string {
+	if raw <= 0 || compressed <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2fx", float64(raw)/float64(compressed))
+}
+
+// formatStreamRates formata as taxas por stream em MB/s, como o detalhe de
+// sessão do server: "#0 4.1 · #1 3.9 MB/s".
+func formatStreamRates(rates []streamRate) string {
+	parts := make([]string, len(rates))
+	for i, r := range rates {
+		parts[i] = fmt.Sprintf("#%d %.1f", r.index, r.bps/(1024*1024))
+	}
+	return strings.Join(parts, " · ") + " MB/s"
+}
+
 // formatBytes formata bytes em unidades legíveis.
 func formatBytes(b int64) string {
 	switch {
@@ -5,8 +5,14 @@
 package agent
 
 import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/protocol"
 )
 
 // computeETA replica a lógica pessimista do render para ser testável isoladamente.
@@ -203,3 +209,69 @@ func TestDispatcher_OnStreamChangeCallback(t *testing.T) {
 		t.Error("DeactivateStream with invalid index should not trigger callback")
 	}
 }
+
+func TestStream_FeedsRawAndCompressedBytes(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), bytes.Repeat([]byte("n-backup "), 16*1024), 0644)
+
+	p := &ProgressReporter{name: "test", startTime: time.Now(), done: make(chan struct{})}
+	var buf bytes.Buffer
+	result, err := Stream(context.Background(), NewScanner([]string{dir}, nil), &buf, p, nil, Compression{Mode: protocol.CompressionGzip}, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	if got := p.bytesWritten.Load(); got != int64(result.Size) {
+		t.Errorf("expected %d compressed bytes, got %d", result.Size, got)
+	}
+	// O tar inclui headers e padding além do conteúdo dos arquivos
+	if got := p.rawBytes.Load(); got < result.Bytes {
+		t.Errorf("expected at least %d raw bytes, got %d", result.Bytes, got)
+	}
+	if ratio := formatRatio(p.rawBytes.Load(), p.bytesWritten.Load()); ratio == "-" {
+		t.Error("expected a compression ratio")
+	}
+}
+
+func TestFormatRatio(t *testing.T) {
+	if got := formatRatio(0, 0); got != "-" {
+		t.Errorf("expected - without data, got %q", got)
+	}
+	if got := formatRatio(4096, 1024); got != "4.00x" {
+		t.Errorf("expected 4.00x, got %q", got)
+	}
+}
+
+func TestSampleStreams_RatesPerWindow(t *testing.T) {
+	p := &ProgressReporter{name: "test", startTime: time.Now(), done: make(chan struct{})}
+	if rates := p.sampleStreams(time.Now()); rates != nil {
+		t.Fatalf("expected no rates without a stats source, got %v", rates)
+	}
+
+	sent := []uint64{0, 0}
+	p.SetStreamStats(func() []protocol.StreamTransferStats {
+		return []protocol.StreamTransferStats{
+			{StreamIndex: 0, BytesSent: sent[0]},
+			{StreamIndex: 1, BytesSent: sent[1]},
+		}
+	})
+
+	// Primeira amostra só registra a base
+	t0 := time.Now()
+	if rates := p.sampleStreams(t0); len(rates) != 0 {
+		t.Fatalf("expected no rates on the first sample, got %v", rates)
+	}
+
+	sent[0], sent[1] = 8<<20, 2<<20
+	// Dentro da janela mantém a amostra anterior
+	if rates := p.sampleStreams(t0.Add(time.Second)); len(rates) != 0 {
+		t.Fatalf("expected cached rates inside the window, got %v", rates)
+	}
+	rates := p.sampleStreams(t0.Add(streamRateWindow))
+	if len(rates) != 2 || rates[0].bps != 4<<20 || rates[1].bps != 1<<20 {
+		t.Fatalf("unexpected rates: %+v", rates)
+	}
+	if got := formatStreamRates(rates); got != "#0 4.0 · #1 1.0 MB/s" {
+		t.Errorf("unexpected formatted rates: %q", got)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// dialTCP abre a conexão TCP com address, diretamente ou pelo proxy de
+// server.proxy, respeitando server.prefer e server.socket (na conexão com o
+// proxy, quando há um). É o ponto único de dial TCP do agent até o server: o TLS e a
+// auth psk seguem por cima da conexão retornada.
+func dialTCP(ctx context.Context, srv config.ServerAddr, address string) (net.Conn, error) {
+	p := srv.Proxy
+	dialer := directDialer{prefer: srv.Prefer, socket: srv.Socket}
+	if !p.Enabled() {
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("server.proxy.url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		// O nome do server é resolvido pelo proxy (o agent pode não ter DNS)
+		var auth *proxy.Auth
+		if p.Username != "" {
+			auth = &proxy.Auth{User: p.Username, Password: p.Password}
+		}
+		socks, err := proxy.SOCKS5("tcp", u.Host, auth, dialer)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := socks.(proxy.ContextDialer).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("socks5 proxy %s: %w", u.Host, err)
+		}
+		return conn, nil
+	default:
+		return dialHTTPConnect(ctx, dialer, u, p, address)
+	}
+}
+
+// dialHTTPConnect abre um túnel HTTP CONNECT até address. Com https://, a
+// conexão com o próprio proxy também é TLS.
+func dialHTTPConnect(ctx context.Context, dialer directDialer, u *url.URL, p config.ProxyConfig, address string) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to proxy %s: %w", u.Host, err)
+	}
+	if u.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{MinVersion: tls.VersionTLS12, ServerName: u.Hostname()})
+	}
+
+	// O handshake com o proxy respeita o deadline e o cancelamento do ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if p.Username != "" {
+		creds := base64.StdEncoding.EncodeToString([]byte(p.Username + ":" + p.Password))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("http proxy %s: writing CONNECT: %w", u.Host, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("http proxy %s: reading CONNECT response: %w", u.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("http proxy %s: CONNECT %s: %s", u.Host, address, resp.Status)
+	}
+	if !stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	conn.SetDeadline(time.Time{})
+
+	// Bytes do server lidos junto com a resposta do proxy não podem se perder
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn é uma conexão cujo início já foi lido para um bufio.Reader.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
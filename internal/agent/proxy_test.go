@@ -0,0 +1,177 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// startEchoServer simula o server: devolve tudo o que recebe.
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// startTestProxy aceita conexões e as entrega a handle, que faz o handshake do
+// proxy e retorna o destino pedido ("" recusa).
+func startTestProxy(t *testing.T, handle func(conn net.Conn, br *bufio.Reader) string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				target := handle(conn, br)
+				if target == "" {
+					return
+				}
+				up, err := net.Dial("tcp", target)
+				if err != nil {
+					return
+				}
+				defer up.Close()
+				go io.Copy(up, br)
+				io.Copy(conn, up)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func assertEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("NBKP"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "NBKP" {
+		t.Fatalf("expected echo through the proxy, got %q (%v)", buf, err)
+	}
+}
+
+func TestDialTCP_HTTPConnect(t *testing.T) {
+	target := startEchoServer(t)
+	proxyAddr := startTestProxy(t, func(conn net.Conn, br *bufio.Reader) string {
+		req, err := http.ReadRequest(br)
+		if err != nil || req.Method != http.MethodConnect {
+			return ""
+		}
+		user, pass, ok := (&http.Request{Header: http.Header{"Authorization": req.Header["Proxy-Authorization"]}}).BasicAuth()
+		if !ok || user != "backup" || pass != "s3cret" {
+			io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return ""
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		return req.Host
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p := config.ProxyConfig{URL: "http://" + proxyAddr, Username: "backup", Password: "s3cret"}
+	conn, err := dialTCP(ctx, config.ServerAddr{Proxy: p}, target)
+	if err != nil {
+		t.Fatalf("dial via http proxy: %v", err)
+	}
+	assertEcho(t, conn)
+
+	p.Password = "wrong"
+	if _, err := dialTCP(ctx, config.ServerAddr{Proxy: p}, target); err == nil || !strings.Contains(err.Error(), "407") {
+		t.Errorf("expected 407 from the proxy, got %v", err)
+	}
+}
+
+func TestDialTCP_SOCKS5(t *testing.T) {
+	target := startEchoServer(t)
+	proxyAddr := startTestProxy(t, func(conn net.Conn, br *bufio.Reader) string {
+		// Saudação: exige usuário/senha (método 0x02, RFC 1929)
+		hdr := make([]byte, 2)
+		io.ReadFull(br, hdr)
+		io.ReadFull(br, make([]byte, hdr[1]))
+		conn.Write([]byte{0x05, 0x02})
+		readField := func() string {
+			n, _ := br.ReadByte()
+			b := make([]byte, n)
+			io.ReadFull(br, b)
+			return string(b)
+		}
+		br.ReadByte() // versão da sub-negociação
+		user, pass := readField(), readField()
+		if user != "backup" || pass != "s3cret" {
+			conn.Write([]byte{0x01, 0x01})
+			return ""
+		}
+		conn.Write([]byte{0x01, 0x00})
+
+		// CONNECT com destino por IPv4 ou nome (resolvido pelo proxy)
+		req := make([]byte, 4)
+		io.ReadFull(br, req)
+		var host string
+		switch req[3] {
+		case 0x01:
+			ip := make([]byte, 4)
+			io.ReadFull(br, ip)
+			host = net.IP(ip).String()
+		case 0x03:
+			host = readField()
+		default:
+			return ""
+		}
+		port := make([]byte, 2)
+		io.ReadFull(br, port)
+		conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p := config.ProxyConfig{URL: "socks5://" + proxyAddr, Username: "backup", Password: "s3cret"}
+	conn, err := dialTCP(ctx, config.ServerAddr{Proxy: p}, target)
+	if err != nil {
+		t.Fatalf("dial via socks5 proxy: %v", err)
+	}
+	assertEcho(t, conn)
+
+	p.Password = "wrong"
+	if _, err := dialTCP(ctx, config.ServerAddr{Proxy: p}, target); err == nil {
+		t.Error("expected socks5 auth failure")
+	}
+}
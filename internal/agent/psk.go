@@ -0,0 +1,71 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/auth"
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// pskChallengeTimeout limita a espera pelo desafio PSK do server. Um server
+// com listener mTLS nunca envia o desafio (e normalmente já recusa o
+// handshake TLS sem certificado de client).
+const pskChallengeTimeout = 10 * time.Second
+
+// pskCredential é a identidade do agent com auth psk (tls.auth: psk).
+type pskCredential struct {
+	agent string
+	key   []byte
+}
+
+// loadClientPSK lê a pre-shared key de tls.psk_file. Retorna nil quando o
+// agent usa mTLS. A chave é relida a cada conexão, então rotações no disco
+// valem sem reiniciar o daemon.
+func loadClientPSK(cfg *config.AgentConfig) (*pskCredential, error) {
+	if cfg.TLS.Auth != config.AuthModePSK {
+		return nil, nil
+	}
+	key, err := pki.LoadPSK(cfg.TLS.PSKFile)
+	if err != nil {
+		return nil, err
+	}
+	return &pskCredential{agent: cfg.Agent.Name, key: key}, nil
+}
+
+// authenticate responde ao desafio PSK do server logo após o handshake TLS.
+// É no-op quando c é nil (mTLS).
+func (c *pskCredential) authenticate(conn auth.TLSConn) error {
+	if c == nil {
+		return nil
+	}
+	binding, err := pki.PSKChannelBinding(conn.ConnectionState())
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(pskChallengeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	nonce, err := protocol.ReadPSKChallenge(conn)
+	if err != nil {
+		return fmt.Errorf("psk auth: %w (is server.auth psk on the server?)", err)
+	}
+	if err := protocol.WritePSKResponse(conn, c.agent, pki.PSKMAC(c.key, nonce[:], c.agent, binding)); err != nil {
+		return fmt.Errorf("psk auth: writing response: %w", err)
+	}
+	status, err := protocol.ReadPSKResult(conn)
+	if err != nil {
+		return fmt.Errorf("psk auth: %w", err)
+	}
+	if status != protocol.PSKStatusOK {
+		return fmt.Errorf("%w: psk rejected for agent %q", ErrAgentUnauthorized, c.agent)
+	}
+	return nil
+}
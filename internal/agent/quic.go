@@ -0,0 +1,104 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// quicDialer mantém uma conexão QUIC por server (server.transport: quic).
+// Control channel, sessões de backup e streams paralelos abrem streams
+// nessa conexão: reconectar um stream (flow rotation, queda) não refaz
+// handshake. Quando a conexão cai, a próxima é retomada com 0-RTT pelo
+// session ticket guardado em sessions.
+type quicDialer struct {
+	mu       sync.Mutex
+	tr       *quic.Transport // socket UDP compartilhado (nil até o primeiro dial)
+	conns    map[string]*quic.Conn
+	sessions tls.ClientSessionCache
+}
+
+var quicConns = &quicDialer{
+	conns:    make(map[string]*quic.Conn),
+	sessions: tls.NewLRUClientSessionCache(16),
+}
+
+// dialQUIC abre um stream QUIC para o server em address e o autentica com
+// psk (quando auth psk). O stream se comporta como a conexão TLS de
+// dialWithContext. prefer é server.prefer.
+func dialQUIC(ctx context.Context, address, prefer string, tlsCfg *tls.Config, psk *pskCredential) (net.Conn, error) {
+	qc, err := quicConns.conn(ctx, address, prefer, tlsCfg)
+	if err != nil {
+		return nil, err
+	}
+	st, err := qc.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("opening quic stream: %w", err)
+	}
+	conn := protocol.NewQUICConn(qc, st)
+	if err := protocol.WriteQUICStreamHeader(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("opening quic stream: %w", err)
+	}
+
+	// O channel binding PSK só existe após o handshake: com psk o stream
+	// espera o handshake em vez de enviar dados 0-RTT
+	if psk != nil {
+		select {
+		case <-qc.HandshakeComplete():
+		case <-qc.Context().Done():
+			conn.Close()
+			return nil, fmt.Errorf("quic handshake: %w", context.Cause(qc.Context()))
+		case <-ctx.Done():
+			conn.Close()
+			return nil, ctx.Err()
+		}
+		if err := psk.authenticate(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// conn retorna a conexão QUIC viva com address, discando uma nova (0-RTT
+// quando há session ticket) se ainda não existe ou caiu.
+func (d *quicDialer) conn(ctx context.Context, address, prefer string, tlsCfg *tls.Config) (*quic.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if qc := d.conns[address]; qc != nil && qc.Context().Err() == nil {
+		return qc, nil
+	}
+	if d.tr == nil {
+		udpConn, err := net.ListenUDP("udp", nil)
+		if err != nil {
+			return nil, fmt.Errorf("opening udp socket: %w", err)
+		}
+		d.tr = &quic.Transport{Conn: udpConn}
+	}
+	udpAddr, err := preferredUDPAddr(ctx, address, prefer)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := tlsCfg.Clone()
+	cfg.NextProtos = []string{protocol.QUICALPN}
+	cfg.ClientSessionCache = d.sessions
+	qc, err := d.tr.DialEarly(ctx, udpAddr, cfg, protocol.NewQUICConfig())
+	if err != nil {
+		return nil, fmt.Errorf("quic dial %s: %w", address, err)
+	}
+	d.conns[address] = qc
+	return qc, nil
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// restoreIdleTimeout limita o tempo sem dados do server durante um restore.
+const restoreIdleTimeout = 60 * time.Second
+
+// RestoreResult descreve um arquivo restaurado.
+type RestoreResult struct {
+	Archive string // archive de onde o arquivo foi lido
+	Path    string // caminho local gravado
+	Size    int64
+}
+
+// RestoreFile pede ao server o arquivo filePath (caminho absoluto de origem
+// ou caminho no archive) de um backup do entry e o extrai sob outDir,
+// recriando os diretórios do caminho original. Com archive vazio, usa o
+// backup mais recente que tenha índice de membros (backups com manifest:
+// true). O server envia apenas a entrada pedida, não o archive.
+func RestoreFile(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, archive, filePath, outDir string, logger *slog.Logger) (*RestoreResult, error) {
+	tlsCfg, err := loadClientTLS(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(cfg.Server.Address)
+	if err != nil {
+		host = cfg.Server.Address
+	}
+	tlsCfg.ServerName = host
+
+	conn, err := dialWithContext(ctx, cfg, cfg.Server.Address, tlsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to server: %w", err)
+	}
+	defer conn.Close()
+
+	req := protocol.RestoreRequest{
+		AgentName:   cfg.Agent.Name,
+		StorageName: entry.Storage,
+		BackupName:  entry.Name,
+		Archive:     archive,
+		Path:        strings.TrimPrefix(path.Clean("/"+filePath), "/"),
+	}
+	conn.SetWriteDeadline(time.Now().Add(restoreIdleTimeout))
+	if err := protocol.WriteRestoreRequest(conn, req); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReaderSize(&idleTimeoutReader{conn: conn, timeout: restoreIdleTimeout}, streamIOBufferSize)
+	resp, err := protocol.ReadRestoreResponse(br)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != protocol.RestoreStatusOK {
+		return nil, fmt.Errorf("server refused restore (%s): %s", restoreStatusString(resp.Status), resp.Message)
+	}
+
+	res, err := extractRestored(br, outDir)
+	if err != nil {
+		return nil, fmt.Errorf("restoring %s from %s: %w", req.Path, resp.Archive, err)
+	}
+	res.Archive = resp.Archive
+	logger.Info("file restored", "backup", entry.Name, "archive", res.Archive, "path", res.Path, "bytes", res.Size)
+	return res, nil
+}
+
+// extractRestored extrai a entrada do stream tar do restore sob outDir.
+// Nomes que escapariam de outDir são recusados; um arquivo incompleto (stream
+// interrompido) é removido.
+func extractRestored(r io.Reader, outDir string) (*RestoreResult, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("reading restored entry: %w", err)
+	}
+	if !filepath.IsLocal(hdr.Name) {
+		return nil, fmt.Errorf("refusing unsafe entry name %q", hdr.Name)
+	}
+	target := filepath.Join(outDir, filepath.FromSlash(hdr.Name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, fmt.Errorf("creating parent directory: %w", err)
+	}
+
+	res := &RestoreResult{Path: target}
+	switch hdr.Typeflag {
+	case tar.TypeReg:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, hdr.FileInfo().Mode().Perm())
+		if err != nil {
+			return nil, fmt.Errorf("creating %s: %w", target, err)
+		}
+		n, err := io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(target)
+			return nil, fmt.Errorf("writing %s: %w", target, err)
+		}
+		res.Size = n
+		os.Chmod(target, hdr.FileInfo().Mode().Perm())
+	case tar.TypeSymlink:
+		os.Remove(target)
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return nil, fmt.Errorf("creating symlink %s: %w", target, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported entry type %q for %s", hdr.Typeflag, hdr.Name)
+	}
+
+	// Dono (apenas como root) e mtime: best-effort, como o tar
+	if os.Geteuid() == 0 {
+		os.Lchown(target, hdr.Uid, hdr.Gid)
+	}
+	if hdr.Typeflag == tar.TypeReg {
+		os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+	}
+
+	// O stream termina com o fim do tar
+	if _, err := tr.Next(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unexpected data after restored entry: %v", err)
+	}
+	return res, nil
+}
+
+// restoreStatusString retorna o nome legível de um status de restore.
+func restoreStatusString(status byte) string {
+	switch status {
+	case protocol.RestoreStatusNotFound:
+		return "not found"
+	case protocol.RestoreStatusNoIndex:
+		return "no index"
+	case protocol.RestoreStatusReject:
+		return "rejected"
+	case protocol.RestoreStatusError:
+		return "server error"
+	}
+	return fmt.Sprintf("status 0x%02x", status)
+}
+
+// idleTimeoutReader renova o read deadline da conexão antes de cada leitura.
+type idleTimeoutReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	return r.conn.Read(p)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func restoredTar(t *testing.T, hdr *tar.Header, content string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte(content))
+	tw.Close()
+	return &buf
+}
+
+func TestExtractRestored(t *testing.T) {
+	out := t.TempDir()
+	mtime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	content := "server {}\n"
+	hdr := &tar.Header{Name: "etc/nginx/app.conf", Mode: 0600, Size: int64(len(content)), ModTime: mtime, Typeflag: tar.TypeReg}
+
+	res, err := extractRestored(restoredTar(t, hdr, content), out)
+	if err != nil {
+		t.Fatalf("extractRestored: %v", err)
+	}
+	target := filepath.Join(out, "etc", "nginx", "app.conf")
+	if res.Path != target || res.Size != int64(len(content)) {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != content || fi.Mode().Perm() != 0600 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("restored file: %q mode=%v mtime=%v", got, fi.Mode(), fi.ModTime())
+	}
+
+	// Nomes que escapam do diretório de saída são recusados
+	hdr.Name = "../escape.conf"
+	if _, err := extractRestored(restoredTar(t, hdr, content), out); err == nil {
+		t.Error("expected unsafe name to be refused")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(out), "escape.conf")); !os.IsNotExist(err) {
+		t.Error("file written outside the output directory")
+	}
+
+	// Stream interrompido: o arquivo parcial é removido
+	hdr.Name = "etc/partial.conf"
+	buf := restoredTar(t, hdr, content)
+	if _, err := extractRestored(bytes.NewReader(buf.Bytes()[:512+4]), out); err == nil {
+		t.Error("expected error for truncated stream")
+	}
+	if _, err := os.Stat(filepath.Join(out, "etc", "partial.conf")); !os.IsNotExist(err) {
+		t.Error("partial file not removed")
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// resumeStateFile guarda a sessão em andamento de cada entry (dentro de
+// daemon.state_dir), para retomar o backup após um restart do agent.
+const resumeStateFile = "resume-state.json"
+
+// resumeRecord identifica a sessão aberta no server por um entry. Gravado no
+// handshake e removido quando a execução termina, exceto se ela foi
+// interrompida (shutdown, crash, resume esgotado ou streams paralelos mortos)
+// com a sessão ainda retomável no server.
+type resumeRecord struct {
+	SessionID   string    `json:"session_id"`
+	Server      string    `json:"server"`
+	Storage     string    `json:"storage"`
+	Compression byte      `json:"compression"`          // modo negociado no handshake
+	Fingerprint string    `json:"fingerprint"`          // entryFingerprint: o stream só é reproduzível com a mesma config
+	Parallels   int       `json:"parallels,omitempty"`  // > 0: sessão paralela
+	ChunkSize   uint32    `json:"chunk_size,omitempty"` // chunk negociado no ParallelInit
+	Version     byte      `json:"version,omitempty"`    // versão negociada no handshake (0 = registro anterior ao campo)
+	StartedAt   time.Time `json:"started_at"`
+
+	// Sessão paralela: maior chunk anunciado no ParallelInit (0 = registro
+	// anterior ao campo, não retomável) e o prefixo de chunks confirmado por
+	// ChunkSACK — globalSeq do primeiro chunk não confirmado e bytes do stream
+	// até ele —, gravado a cada resumeWatermarkInterval
+	ChunkSizeMax uint32 `json:"chunk_size_max,omitempty"`
+	AckedSeq     uint32 `json:"acked_seq,omitempty"`
+	AckedBytes   int64  `json:"acked_bytes,omitempty"`
+
+	// Janela de SACK concedida no handshake: o server mantém o intervalo na
+	// sessão, então o resume respeita a mesma janela (0 = sem limite)
+	SACKInterval uint32 `json:"sack_interval,omitempty"`
+	MaxInFlight  uint64 `json:"max_inflight,omitempty"`
+}
+
+// resumable informa se a sessão pode ser retomada após restart do agent.
+// Registros paralelos anteriores ao ChunkSizeMax só servem para cancelar a
+// sessão no server.
+func (r resumeRecord) resumable() bool {
+	return r.Parallels == 0 || r.ChunkSizeMax > 0
+}
+
+// resumeStateMu serializa o read-modify-write do arquivo: entries diferentes
+// rodam em goroutines diferentes.
+var resumeStateMu sync.Mutex
+
+// loadResumeRecord retorna a sessão persistida do entry. stateDir vazio
+// desabilita a persistência.
+func loadResumeRecord(stateDir, name string) (resumeRecord, bool, error) {
+	if stateDir == "" {
+		return resumeRecord{}, false, nil
+	}
+	resumeStateMu.Lock()
+	defer resumeStateMu.Unlock()
+	records, err := readResumeState(stateDir)
+	rec, ok := records[name]
+	return rec, ok, err
+}
+
+// saveResumeRecord persiste a sessão em andamento do entry.
+func saveResumeRecord(stateDir, name string, rec resumeRecord) error {
+	return updateResumeState(stateDir, func(records map[string]resumeRecord) bool {
+		records[name] = rec
+		return true
+	})
+}
+
+// clearResumeRecord remove a sessão persistida do entry, se houver.
+func clearResumeRecord(stateDir, name string) error {
+	return updateResumeState(stateDir, func(records map[string]resumeRecord) bool {
+		if _, ok := records[name]; !ok {
+			return false
+		}
+		delete(records, name)
+		return true
+	})
+}
+
+// updateResumeState aplica fn ao estado e o regrava se fn retornar true.
+func updateResumeState(stateDir string, fn func(map[string]resumeRecord) bool) error {
+	if stateDir == "" {
+		return nil
+	}
+	resumeStateMu.Lock()
+	defer resumeStateMu.Unlock()
+	records, err := readResumeState(stateDir)
+	if err != nil {
+		// Arquivo corrompido: recomeça vazio (perde-se apenas a chance de resume)
+		records = make(map[string]resumeRecord)
+	}
+	if !fn(records) {
+		return nil
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return fmt.Errorf("creating state dir: %w", err)
+	}
+	if err := statefile.WriteDocument(filepath.Join(stateDir, resumeStateFile), records, 0644); err != nil {
+		return fmt.Errorf("writing resume state: %w", err)
+	}
+	return nil
+}
+
+// readResumeState lê o arquivo (ausente = vazio). Deve ser chamado com resumeStateMu held.
+func readResumeState(stateDir string) (map[string]resumeRecord, error) {
+	records := make(map[string]resumeRecord)
+	_, err := statefile.ReadDocument(filepath.Join(stateDir, resumeStateFile), &records)
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return make(map[string]resumeRecord), fmt.Errorf("reading resume state: %w", err)
+	}
+	return records, nil
+}
+
+// entryFingerprint resume a config do entry que determina o stream gerado
+// (sources, excludes, compressão...). Uma sessão só é retomada após restart
+// se o fingerprint não mudou. Retorna "" se a config não puder ser serializada.
+func entryFingerprint(entry config.BackupEntry) string {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// skipWriter descarta os primeiros skip bytes escritos — a parte do stream
+// que o server já gravou antes do restart — e repassa o restante a w.
+type skipWriter struct {
+	w    io.Writer
+	skip int64
+}
+
+// Write implementa io.Writer.
+func (s *skipWriter) Write(p []byte) (int, error) {
+	if s.skip == 0 {
+		return s.w.Write(p)
+	}
+	if int64(len(p)) <= s.skip {
+		s.skip -= int64(len(p))
+		return len(p), nil
+	}
+	skipped := int(s.skip)
+	s.skip = 0
+	n, err := s.w.Write(p[skipped:])
+	return skipped + n, err
+}
+
+// resumeWatermarkInterval é o intervalo entre gravações do prefixo confirmado
+// de uma sessão paralela em resume-state.json.
+const resumeWatermarkInterval = 30 * time.Second
+
+// resumePoint é de onde o stream regenerado continua após um restart do agent:
+// os bytes já gravados pelo server e, em sessões paralelas, o globalSeq do
+// primeiro chunk a reenviar.
+type resumePoint struct {
+	Offset  int64
+	NextSeq uint32
+}
+
+// resumeAfterRestart retoma a sessão persistida do entry, se houver e ainda
+// for compatível. Retorna resumed=false quando não há o que retomar — o
+// chamador faz o handshake normal — e erro se o server estiver inalcançável,
+// mantendo o registro para a próxima tentativa. O stream é regenerado do
+// início e os bytes já gravados pelo server descartados, então a retomada
+// exige a mesma config do entry e produção determinística (producer_shards
+// <= 1). Sessões paralelas exigem também os mesmos tamanhos de chunk: o server
+// responde ao RESUME com o checkpoint do arquivo montado (ParallelResume), e
+// os streams entram de novo via ParallelJoin a partir dele.
+func resumeAfterRestart(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, tlsCfg *tls.Config, logger *slog.Logger, controlCh *ControlChannel) (conn net.Conn, rec resumeRecord, point resumePoint, resumed bool, err error) {
+	stateDir := cfg.Daemon.StateDir
+	rec, ok, err := loadResumeRecord(stateDir, entry.Name)
+	if err != nil {
+		logger.Warn("failed to read resume state, starting a new session", "error", err)
+	}
+	if !ok {
+		return nil, resumeRecord{}, resumePoint{}, false, nil
+	}
+	logger = logger.With("session", rec.SessionID)
+
+	switch {
+	case rec.Parallels != entry.Parallels || entry.ProducerShards > 1 || rec.Server != cfg.Server.Address ||
+		rec.Storage != entry.Storage || rec.Fingerprint != entryFingerprint(entry):
+		logger.Info("backup config changed since the interrupted session, starting a new session")
+		discardSession(controlCh, rec.SessionID, logger)
+	case rec.Parallels > 0 && (rec.ChunkSizeMax == 0 || int64(rec.ChunkSize) != cfg.Resume.ChunkSizeRaw ||
+		int64(rec.ChunkSizeMax) != chunkSizeMaxFor(cfg, rec.Version)):
+		logger.Info("chunk size changed since the interrupted parallel session, starting a new session",
+			"chunk_size", rec.ChunkSize, "chunk_size_max", rec.ChunkSizeMax)
+		discardSession(controlCh, rec.SessionID, logger)
+	default:
+		conn, point.Offset, err = resumeConnect(ctx, cfg, entry, rec.SessionID, tlsCfg, logger)
+		if err == nil && rec.Parallels > 0 {
+			point.NextSeq, err = readParallelResume(conn, rec, point.Offset, logger)
+			if err != nil {
+				conn.Close()
+				if errors.Is(err, errResumeRejected) {
+					discardSession(controlCh, rec.SessionID, logger)
+				}
+			}
+		}
+		if err == nil {
+			return conn, rec, point, true, nil
+		}
+		if !errors.Is(err, errResumeRejected) {
+			return nil, resumeRecord{}, resumePoint{}, false, fmt.Errorf("resuming interrupted session: %w", err)
+		}
+		logger.Warn("interrupted session could not be resumed, starting a new session", "error", err)
+	}
+
+	if err := clearResumeRecord(stateDir, entry.Name); err != nil {
+		logger.Warn("failed to clear resume state", "error", err)
+	}
+	return nil, resumeRecord{}, resumePoint{}, false, nil
+}
+
+// readParallelResume lê o globalSeq de onde a sessão paralela continua, que o
+// server envia após o ResumeACK, e o confere com o prefixo confirmado
+// persistido: um mesmo globalSeq tem que corresponder aos mesmos bytes do
+// stream. Divergência indica que o stream regenerado não é o original.
+func readParallelResume(conn net.Conn, rec resumeRecord, offset int64, logger *slog.Logger) (uint32, error) {
+	pr, err := protocol.ReadParallelResume(conn)
+	if err != nil {
+		return 0, fmt.Errorf("reading parallel resume: %w", err)
+	}
+	if !watermarkConsistent(rec, pr.NextSeq, offset) {
+		return 0, fmt.Errorf("%w: server checkpoint (seq %d, %d bytes) diverges from acknowledged chunks (seq %d, %d bytes)",
+			errResumeRejected, pr.NextSeq, offset, rec.AckedSeq, rec.AckedBytes)
+	}
+	logger.Info("parallel session checkpoint received", "next_seq", pr.NextSeq, "server_offset", offset,
+		"acked_seq", rec.AckedSeq, "acked_bytes", rec.AckedBytes)
+	return pr.NextSeq, nil
+}
+
+// watermarkConsistent informa se o checkpoint do server (nextSeq, offset) é
+// compatível com o prefixo confirmado do registro: como todo chunk tem dados,
+// globalSeq e bytes crescem juntos. O checkpoint do server é o que vale — os
+// ChunkSACKs cobrem chunks que podem ter ficado só na memória do server.
+func watermarkConsistent(rec resumeRecord, nextSeq uint32, offset int64) bool {
+	switch {
+	case nextSeq == rec.AckedSeq:
+		return offset == rec.AckedBytes
+	case nextSeq > rec.AckedSeq:
+		return offset > rec.AckedBytes
+	default:
+		return offset < rec.AckedBytes
+	}
+}
+
+// trackWatermark chama save com o prefixo confirmado do dispatcher (somado ao
+// ponto de retomada) a cada resumeWatermarkInterval, quando ele avança. A
+// função retornada para o acompanhamento e grava o prefixo final.
+func trackWatermark(d *Dispatcher, start resumePoint, save func(seq uint32, bytes int64)) func() {
+	var lastSeq uint32
+	flush := func() {
+		seq, n := d.AckedWatermark()
+		if seq != lastSeq {
+			lastSeq = seq
+			save(seq, start.Offset+n)
+		}
+	}
+	lastSeq = start.NextSeq
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(resumeWatermarkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		flush()
+	}
+}
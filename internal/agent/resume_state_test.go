@@ -0,0 +1,203 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func TestResumeRecord_SaveLoadClear(t *testing.T) {
+	dir := t.TempDir()
+	rec := resumeRecord{SessionID: "s-1", Server: "backup:9847", Storage: "default", Compression: protocol.CompressionZstd}
+
+	if err := saveResumeRecord(dir, "home", rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveResumeRecord(dir, "etc", resumeRecord{SessionID: "s-2", Parallels: 4, ChunkSize: 1 << 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := loadResumeRecord(dir, "home")
+	if err != nil || !ok {
+		t.Fatalf("expected record for home, ok=%v err=%v", ok, err)
+	}
+	if got.SessionID != "s-1" || got.Compression != protocol.CompressionZstd {
+		t.Errorf("unexpected record: %+v", got)
+	}
+
+	if err := clearResumeRecord(dir, "home"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := loadResumeRecord(dir, "home"); ok {
+		t.Error("expected home record cleared")
+	}
+	if got, ok, _ := loadResumeRecord(dir, "etc"); !ok || got.ChunkSize != 1<<20 {
+		t.Errorf("expected etc record kept, got %+v (ok=%v)", got, ok)
+	}
+
+	// state_dir vazio desabilita a persistência
+	if err := saveResumeRecord("", "home", rec); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := loadResumeRecord("", "home"); ok {
+		t.Error("expected no record without state dir")
+	}
+}
+
+func TestResumeRecord_CorruptFileStartsOver(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, resumeStateFile), []byte("garbage\n"), 0644)
+
+	if err := saveResumeRecord(dir, "home", resumeRecord{SessionID: "s-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok, err := loadResumeRecord(dir, "home"); err != nil || !ok || got.SessionID != "s-1" {
+		t.Errorf("expected record after rewrite, got %+v ok=%v err=%v", got, ok, err)
+	}
+}
+
+func TestEntryFingerprint_ChangesWithConfig(t *testing.T) {
+	entry := config.BackupEntry{Name: "home", Storage: "default", Sources: []config.BackupSource{{Path: "/home"}}}
+	fp := entryFingerprint(entry)
+	if fp == "" || fp != entryFingerprint(entry) {
+		t.Fatalf("expected stable fingerprint, got %q", fp)
+	}
+	entry.Exclude = []string{"*.tmp"}
+	if entryFingerprint(entry) == fp {
+		t.Error("expected fingerprint to change with excludes")
+	}
+}
+
+func TestKeepResumeRecord(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"success", context.Background(), nil, false},
+		{"failure", context.Background(), fmt.Errorf("server reported checksum mismatch"), false},
+		{"cancelled", cancelled, context.Canceled, true},
+		{"resume exhausted", context.Background(), fmt.Errorf("%w: max resume attempts reached", errResumeExhausted), true},
+		{"parallel streams dead", context.Background(), fmt.Errorf("parallel pipeline error: %w", ErrAllStreamsDead), true},
+	}
+	for _, tc := range cases {
+		if got := keepResumeRecord(tc.ctx, tc.err); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestSkipWriter_DiscardsPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	w := &skipWriter{w: &buf, skip: 5}
+
+	for _, p := range []string{"abc", "defg", "hij"} {
+		n, err := w.Write([]byte(p))
+		if err != nil || n != len(p) {
+			t.Fatalf("Write(%q) = %d, %v", p, n, err)
+		}
+	}
+	if buf.String() != "fghij" {
+		t.Errorf("expected %q, got %q", "fghij", buf.String())
+	}
+}
+
+func TestRingBufferAt_StartsAtBase(t *testing.T) {
+	rb := NewRingBufferAt(16, 1000)
+	if rb.Head() != 1000 || rb.Tail() != 1000 {
+		t.Fatalf("expected head=tail=1000, got head=%d tail=%d", rb.Head(), rb.Tail())
+	}
+
+	rb.Write([]byte("resumed"))
+	buf := make([]byte, 7)
+	n, err := rb.ReadAt(1000, buf)
+	if err != nil || string(buf[:n]) != "resumed" {
+		t.Fatalf("ReadAt(1000) = %q, %v", buf[:n], err)
+	}
+	if _, err := rb.ReadAt(999, buf); err != ErrOffsetExpired {
+		t.Errorf("expected ErrOffsetExpired before base, got %v", err)
+	}
+}
+
+// TestStream_RegeneratedSuffixMatches garante a premissa do resume após
+// restart: regenerar o stream descartando o prefixo produz exatamente os bytes
+// que faltam ao server, e o resultado (tamanho e checksum) cobre o archive todo.
+func TestStream_RegeneratedSuffixMatches(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("file-%02d.txt", i)), bytes.Repeat([]byte(fmt.Sprintf("data %d ", i)), 4096), 0644)
+	}
+	comp := Compression{Mode: protocol.CompressionGzip}
+
+	var full bytes.Buffer
+	first, err := Stream(context.Background(), NewScanner([]string{dir}, nil), &full, nil, nil, comp, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offset := int64(full.Len() / 2)
+	var suffix bytes.Buffer
+	second, err := Stream(context.Background(), NewScanner([]string{dir}, nil), &skipWriter{w: &suffix, skip: offset}, nil, nil, comp, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(suffix.Bytes(), full.Bytes()[offset:]) {
+		t.Errorf("regenerated suffix differs from original stream (%d vs %d bytes)", suffix.Len(), full.Len()-int(offset))
+	}
+	if second.Size != first.Size || second.Checksum != first.Checksum {
+		t.Errorf("expected result of the whole archive, got size %d checksum %x (want %d %x)", second.Size, second.Checksum, first.Size, first.Checksum)
+	}
+}
+
+func TestResumeRecord_Resumable(t *testing.T) {
+	if !(resumeRecord{SessionID: "s-1"}).resumable() {
+		t.Error("expected single-stream record resumable")
+	}
+	if (resumeRecord{SessionID: "s-2", Parallels: 4, ChunkSize: 1 << 20}).resumable() {
+		t.Error("expected parallel record without chunk_size_max not resumable")
+	}
+	if !(resumeRecord{SessionID: "s-3", Parallels: 4, ChunkSize: 1 << 20, ChunkSizeMax: 1 << 20}).resumable() {
+		t.Error("expected parallel record with chunk sizes resumable")
+	}
+}
+
+func TestWatermarkConsistent(t *testing.T) {
+	rec := resumeRecord{Parallels: 2, AckedSeq: 10, AckedBytes: 4096}
+	cases := []struct {
+		name    string
+		nextSeq uint32
+		offset  int64
+		want    bool
+	}{
+		{"same point", 10, 4096, true},
+		{"same seq, other bytes", 10, 4000, false},
+		{"server ahead", 12, 5000, true},
+		{"server ahead with fewer bytes", 12, 4096, false},
+		{"server behind", 8, 3000, true},
+		{"server behind with more bytes", 8, 4096, false},
+	}
+	for _, tc := range cases {
+		if got := watermarkConsistent(rec, tc.nextSeq, tc.offset); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+	// Registro sem prefixo confirmado: qualquer checkpoint do server serve
+	if !watermarkConsistent(resumeRecord{Parallels: 2}, 3, 300) || !watermarkConsistent(resumeRecord{Parallels: 2}, 0, 0) {
+		t.Error("expected any checkpoint consistent with an empty watermark")
+	}
+}
@@ -5,6 +5,7 @@
 package agent
 
 import (
+	"context"
 	"errors"
 	"sync"
 )
@@ -47,6 +48,16 @@ func NewRingBuffer(size int64) *RingBuffer {
 	return rb
 }
 
+// NewRingBufferAt cria um ring buffer cujo primeiro byte escrito ocupa o
+// offset absoluto base. Usado para retomar um stream após restart do agent,
+// quando o server já tem os primeiros base bytes.
+func NewRingBufferAt(size, base int64) *RingBuffer {
+	rb := NewRingBuffer(size)
+	rb.head = base
+	rb.tail = base
+	return rb
+}
+
 // Write implementa io.Writer. Bloqueia quando o buffer está cheio (backpressure).
 // Retorna ErrBufferClosed se o buffer foi fechado.
 func (rb *RingBuffer) Write(p []byte) (int, error) {
@@ -168,6 +179,29 @@ func (rb *RingBuffer) Advance(offset int64) {
 	}
 }
 
+// WaitInFlight bloqueia enquanto offset estiver limit bytes ou mais à frente
+// do tail — bytes enviados e ainda não confirmados pelo server — e retorna
+// quantos bytes ainda podem ser enviados a partir de offset. Retorna o erro
+// de ctx se ele for cancelado durante a espera.
+func (rb *RingBuffer) WaitInFlight(ctx context.Context, offset, limit int64) (int64, error) {
+	stop := context.AfterFunc(ctx, func() {
+		rb.mu.Lock()
+		rb.notFull.Broadcast()
+		rb.mu.Unlock()
+	})
+	defer stop()
+
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	for offset-rb.tail >= limit {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		rb.notFull.Wait()
+	}
+	return limit - (offset - rb.tail), nil
+}
+
 // Contains verifica se o offset absoluto ainda está presente no buffer.
 func (rb *RingBuffer) Contains(offset int64) bool {
 	rb.mu.Lock()
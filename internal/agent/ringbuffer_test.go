@@ -6,6 +6,7 @@ package agent
 
 import (
 	"bytes"
+	"context"
 	"sync"
 	"testing"
 	"time"
@@ -116,6 +117,47 @@ func TestRingBuffer_Advance(t *testing.T) {
 	}
 }
 
+func TestRingBuffer_WaitInFlight(t *testing.T) {
+	rb := NewRingBuffer(256)
+	rb.Write(make([]byte, 100))
+
+	allowed, err := rb.WaitInFlight(context.Background(), 30, 64)
+	if err != nil || allowed != 34 {
+		t.Fatalf("expected 34 bytes allowed, got %d (err=%v)", allowed, err)
+	}
+
+	// Janela cheia: bloqueia até o SACK avançar o tail
+	done := make(chan int64, 1)
+	go func() {
+		allowed, _ := rb.WaitInFlight(context.Background(), 64, 64)
+		done <- allowed
+	}()
+	select {
+	case <-done:
+		t.Fatal("WaitInFlight should block while the window is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	rb.Advance(16)
+	select {
+	case allowed := <-done:
+		if allowed != 16 {
+			t.Fatalf("expected 16 bytes allowed, got %d", allowed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitInFlight did not return after Advance")
+	}
+
+	// Cancelamento libera a espera
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := rb.WaitInFlight(ctx, 100, 64); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
 func TestRingBuffer_OffsetExpired(t *testing.T) {
 	rb := NewRingBuffer(256)
 
@@ -0,0 +1,50 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+const (
+	// sackWindowMinInFlight é o piso da janela automática. Com o intervalo
+	// em 1/8 da janela, links de baixa latência mantêm os SACKs a cada 4MB.
+	sackWindowMinInFlight = 32 * 1024 * 1024 // 32MB
+
+	// sackWindowAssumedRate estima o BDP quando o entry não tem
+	// bandwidth_limit (10 Gbit/s): superestimar só aumenta a janela.
+	sackWindowAssumedRate = 1250 * 1000 * 1000
+)
+
+// sackWindowFor calcula a janela de SACK pedida no handshake. Valores
+// configurados em resume.sack_interval/max_inflight são usados como estão; no
+// modo auto, a janela cobre 2× o bandwidth-delay product (taxa do
+// bandwidth_limit ou sackWindowAssumedRate × rtt), entre
+// sackWindowMinInFlight e o buffer_size, e o intervalo é 1/8 da janela.
+// Retorna também o BDP estimado (0 quando rtt é desconhecido).
+func sackWindowFor(res config.ResumeConfig, bandwidthLimit int64, rtt time.Duration) (protocol.SACKWindow, int64) {
+	rate := int64(sackWindowAssumedRate)
+	if bandwidthLimit > 0 {
+		rate = bandwidthLimit
+	}
+	bdp := int64(float64(rate) * rtt.Seconds())
+
+	inflight := res.MaxInFlightRaw
+	if inflight <= 0 {
+		inflight = min(max(2*bdp, sackWindowMinInFlight), res.BufferSizeRaw)
+	}
+
+	interval := res.SACKIntervalRaw
+	if interval <= 0 {
+		interval = min(max(inflight/8, protocol.MinSACKInterval), protocol.MaxSACKInterval)
+	}
+	if interval > inflight/2 {
+		interval = max(inflight/2, protocol.MinSACKInterval)
+	}
+	return protocol.SACKWindow{Interval: uint32(interval), MaxInFlight: uint64(inflight)}, bdp
+}
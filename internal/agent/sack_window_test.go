@@ -0,0 +1,41 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func TestSACKWindowFor(t *testing.T) {
+	const mb = 1024 * 1024
+	buffer := config.ResumeConfig{BufferSizeRaw: 256 * mb}
+
+	tests := []struct {
+		name      string
+		res       config.ResumeConfig
+		bandwidth int64
+		rtt       time.Duration
+		want      protocol.SACKWindow
+	}{
+		{"lan keeps 4mb interval", buffer, 0, time.Millisecond, protocol.SACKWindow{Interval: 4 * mb, MaxInFlight: 32 * mb}},
+		{"wan grows with bdp", buffer, 0, 50 * time.Millisecond, protocol.SACKWindow{Interval: 125 * 1000 * 1000 / 8, MaxInFlight: 125 * 1000 * 1000}},
+		{"capped by buffer", buffer, 0, time.Second, protocol.SACKWindow{Interval: 32 * mb, MaxInFlight: 256 * mb}},
+		{"bandwidth limit", buffer, 10 * mb, 2 * time.Second, protocol.SACKWindow{Interval: 5 * mb, MaxInFlight: 40 * mb}},
+		{"small buffer", config.ResumeConfig{BufferSizeRaw: 4 * mb}, 0, time.Millisecond, protocol.SACKWindow{Interval: 512 * 1024, MaxInFlight: 4 * mb}},
+		{"configured", config.ResumeConfig{BufferSizeRaw: 256 * mb, SACKIntervalRaw: mb, MaxInFlightRaw: 16 * mb}, 0, time.Second, protocol.SACKWindow{Interval: mb, MaxInFlight: 16 * mb}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := sackWindowFor(tt.res, tt.bandwidth, tt.rtt)
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
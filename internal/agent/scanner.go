@@ -7,25 +7,174 @@ package agent
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
 )
 
 // Scanner caminha pelos diretórios de origem e filtra arquivos
-// conforme as regras de exclude (glob patterns).
+// conforme as regras de include/exclude (ver patterns.go).
 type Scanner struct {
-	sources  []string
-	excludes []string
+	sources  []scanSource
+	excludes []pathPattern
+	includes []pathPattern
+	xattrs   bool // captura xattrs, ACLs e contexto SELinux (FileEntry.PAXRecords)
+
+	// required mapeia os caminhos de assertions.required_paths (relativos a
+	// /) para true quando Scan os entrega. Ver MissingRequired.
+	required map[string]bool
+
+	// shards é o número de producers do Stream (backups[].producer_shards);
+	// part restringe Scan a uma partição, nos Scanners criados por split.
+	shards int
+	part   *scanPart
+}
+
+// scanPart é a partição de um Scanner criado por split: os filhos diretos de
+// cada source são distribuídos entre count partições pelo hash do nome, e a
+// raiz do source fica com a partição 0.
+type scanPart struct {
+	index, count int
+}
+
+// owns indica se a partição entrega o filho direto de um source com name.
+func (p scanPart) owns(name string) bool {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32()%uint32(p.count)) == p.index
+}
+
+// scanSource é um diretório de origem com as opções de travessia.
+type scanSource struct {
+	path           string
+	followSymlinks bool // segue symlinks (arquivos e diretórios) em vez de gravá-los como links
+	oneFilesystem  bool // não desce em diretórios de outro filesystem (mount points)
+
+	// Filtros de arquivos regulares (0 = sem filtro)
+	minFileSize    int64
+	maxFileSize    int64
+	modifiedWithin time.Duration
+	modifiedBefore time.Duration
+}
+
+// fileFilter retorna o filtro de tamanho/idade de src que exclui o arquivo
+// (ex: "max_file_size 2gb"), ou "" se ele passa. Apenas arquivos regulares
+// são filtrados; now é fixado no início do walk.
+func (src scanSource) fileFilter(info fs.FileInfo, now time.Time) string {
+	if !info.Mode().IsRegular() {
+		return ""
+	}
+	size, mtime := info.Size(), info.ModTime()
+	switch {
+	case src.minFileSize > 0 && size < src.minFileSize:
+		return fmt.Sprintf("min_file_size %s", formatBytes(src.minFileSize))
+	case src.maxFileSize > 0 && size > src.maxFileSize:
+		return fmt.Sprintf("max_file_size %s", formatBytes(src.maxFileSize))
+	case src.modifiedWithin > 0 && mtime.Before(now.Add(-src.modifiedWithin)):
+		return fmt.Sprintf("modified_within %s", src.modifiedWithin)
+	case src.modifiedBefore > 0 && !mtime.Before(now.Add(-src.modifiedBefore)):
+		return fmt.Sprintf("modified_before %s", src.modifiedBefore)
+	}
+	return ""
 }
 
 // NewScanner cria um Scanner com os sources e excludes fornecidos.
 func NewScanner(sources []string, excludes []string) *Scanner {
-	return &Scanner{
-		sources:  sources,
-		excludes: excludes,
+	s := &Scanner{excludes: compilePatterns(excludes)}
+	for _, src := range sources {
+		s.sources = append(s.sources, scanSource{path: src})
 	}
+	return s
+}
+
+// NewEntryScanner cria o Scanner de um backup entry: sources com as opções
+// follow_symlinks/one_filesystem, includes, excludes e a captura de xattrs.
+func NewEntryScanner(entry config.BackupEntry) *Scanner {
+	s := &Scanner{
+		excludes: compilePatterns(entry.Exclude),
+		includes: compilePatterns(entry.Include),
+		xattrs:   entry.Xattrs,
+		shards:   entry.ProducerShards,
+	}
+	for _, src := range entry.Sources {
+		s.sources = append(s.sources, scanSource{
+			path:           src.Path,
+			followSymlinks: src.FollowSymlinks,
+			oneFilesystem:  src.OneFilesystem,
+			minFileSize:    src.MinFileSizeRaw,
+			maxFileSize:    src.MaxFileSizeRaw,
+			modifiedWithin: src.ModifiedWithin,
+			modifiedBefore: src.ModifiedBefore,
+		})
+	}
+	for _, p := range entry.Assertions.RequiredPaths {
+		if s.required == nil {
+			s.required = make(map[string]bool)
+		}
+		s.required[strings.TrimPrefix(filepath.Clean(p), "/")] = false
+	}
+	return s
+}
+
+// MissingRequired retorna, em ordem, os caminhos de assertions.required_paths
+// que o último Scan não entregou (ausentes ou excluídos).
+func (s *Scanner) MissingRequired() []string {
+	var missing []string
+	for p, seen := range s.required {
+		if !seen {
+			missing = append(missing, "/"+p)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// split divide s em s.shards Scanners cujos Scans juntos entregam as mesmas
+// entradas que s.Scan, cada uma uma única vez. Os required_paths entregues
+// pelas partições voltam para s com mergeRequired.
+func (s *Scanner) split() []*Scanner {
+	parts := make([]*Scanner, s.shards)
+	for i := range parts {
+		part := *s
+		part.part = &scanPart{index: i, count: s.shards}
+		if s.required != nil {
+			part.required = make(map[string]bool, len(s.required))
+			for p := range s.required {
+				part.required[p] = false
+			}
+		}
+		parts[i] = &part
+	}
+	return parts
+}
+
+// mergeRequired marca em s os required_paths entregues por alguma das parts.
+func (s *Scanner) mergeRequired(parts []*Scanner) {
+	for p := range s.required {
+		s.required[p] = false
+	}
+	for _, part := range parts {
+		for p, seen := range part.required {
+			if seen {
+				s.required[p] = true
+			}
+		}
+	}
+}
+
+// WithXattrs habilita a captura dos metadados estendidos (xattrs, ACLs POSIX
+// e contexto SELinux) de cada entrada. Retorna s para encadeamento.
+func (s *Scanner) WithXattrs(enabled bool) *Scanner {
+	s.xattrs = enabled
+	return s
 }
 
 // FileEntry representa um arquivo encontrado pelo scanner.
@@ -36,50 +185,59 @@ type FileEntry struct {
 	RelPath string
 	// Info contém metadados do arquivo.
 	Info fs.FileInfo
+	// PAXRecords contém os metadados estendidos em registros PAX (nil se a
+	// captura está desabilitada ou o arquivo não os tem).
+	PAXRecords map[string]string
 }
 
 // Scan itera sobre todos os arquivos elegíveis e chama fn para cada um.
 // O contexto permite cancelamento durante o scan.
 func (s *Scanner) Scan(ctx context.Context, fn func(entry FileEntry) error) error {
+	for p := range s.required {
+		s.required[p] = false
+	}
 	for _, src := range s.sources {
-		// Normaliza o source path
-		src = filepath.Clean(src)
-
-		err := filepath.WalkDir(src, func(path string, d fs.DirEntry, walkErr error) error {
-			if walkErr != nil {
-				// Pula arquivos inacessíveis
+		now := time.Now()
+		root := filepath.Clean(src.path)
+		err := walkSource(ctx, src, func(path string, info fs.FileInfo) error {
+			// Partição: só os filhos diretos do source desta partição
+			if s.part != nil && path != root && filepath.Dir(path) == root && !s.part.owns(filepath.Base(path)) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
 				return nil
 			}
 
-			// Verifica cancelamento
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
-
 			// Calcula caminho relativo ao root (/) para manter estrutura
 			relPath := strings.TrimPrefix(path, "/")
 
-			// Verifica excludes
-			if s.isExcluded(relPath, d.IsDir()) {
-				if d.IsDir() {
+			// Verifica includes/excludes
+			if !s.decide(relPath, info.IsDir()).Included {
+				if info.IsDir() {
 					return filepath.SkipDir
 				}
 				return nil
 			}
-
-			// Obtém FileInfo
-			info, err := d.Info()
-			if err != nil {
-				return nil // pula se não conseguir obter info
+			// Filtros de tamanho e idade do source
+			if src.fileFilter(info, now) != "" {
+				return nil
+			}
+			if s.part != nil && path == root && s.part.index != 0 {
+				return nil // a raiz é entregue pela partição 0; as demais só descem
 			}
 
-			return fn(FileEntry{
+			entry := FileEntry{
 				Path:    path,
 				RelPath: relPath,
 				Info:    info,
-			})
+			}
+			if s.xattrs && info.Mode()&os.ModeSymlink == 0 {
+				entry.PAXRecords = readXattrRecords(path)
+			}
+			if _, ok := s.required[relPath]; ok {
+				s.required[relPath] = true
+			}
+			return fn(entry)
 		})
 		if err != nil {
 			return err
@@ -88,56 +246,6 @@ func (s *Scanner) Scan(ctx context.Context, fn func(entry FileEntry) error) erro
 	return nil
 }
 
-// isExcluded verifica se o caminho relativo corresponde a algum glob de exclusão.
-// Suporta:
-//   - "*.log"              → match pelo basename
-//   - ".git/**"            → match diretório em qualquer nível
-//   - "*/access-logs/"     → trailing slash indica match de diretório
-//   - "node_modules/**"    → exclui diretório e todo conteúdo
-func (s *Scanner) isExcluded(relPath string, isDir bool) bool {
-	base := filepath.Base(relPath)
-	parts := strings.Split(relPath, string(os.PathSeparator))
-
-	for _, pattern := range s.excludes {
-		// Trailing slash = match apenas diretórios pelo nome
-		if strings.HasSuffix(pattern, "/") {
-			if isDir {
-				dirPattern := strings.TrimSuffix(pattern, "/")
-				// Remove */ prefix se existir (ex: "*/access-logs/" → "access-logs")
-				dirPattern = strings.TrimPrefix(dirPattern, "*/")
-				for _, part := range parts {
-					if matched, _ := filepath.Match(dirPattern, part); matched {
-						return true
-					}
-				}
-			}
-			continue
-		}
-
-		// Patterns com "/**" suffix — exclui diretório e todo conteúdo recursivamente
-		if strings.HasSuffix(pattern, "/**") {
-			prefix := strings.TrimSuffix(pattern, "/**")
-			for _, part := range parts {
-				if matched, _ := filepath.Match(prefix, part); matched {
-					return true
-				}
-			}
-			continue
-		}
-
-		// Testa o caminho completo contra o pattern
-		if matched, _ := filepath.Match(pattern, relPath); matched {
-			return true
-		}
-
-		// Testa o basename contra o pattern (ex: "*.log" matcha qualquer .log)
-		if matched, _ := filepath.Match(pattern, base); matched {
-			return true
-		}
-	}
-	return false
-}
-
 // ScanStats contém o resultado de um pré-scan rápido (sem I/O de leitura).
 type ScanStats struct {
 	TotalBytes   int64
@@ -149,31 +257,22 @@ type ScanStats struct {
 func (s *Scanner) PreScan(ctx context.Context) (*ScanStats, error) {
 	stats := &ScanStats{}
 	for _, src := range s.sources {
-		src = filepath.Clean(src)
-		err := filepath.WalkDir(src, func(path string, d fs.DirEntry, walkErr error) error {
-			if walkErr != nil {
-				return nil
-			}
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
-
+		now := time.Now()
+		err := walkSource(ctx, src, func(path string, info fs.FileInfo) error {
 			relPath := strings.TrimPrefix(path, "/")
-			if s.isExcluded(relPath, d.IsDir()) {
-				if d.IsDir() {
+			if !s.decide(relPath, info.IsDir()).Included {
+				if info.IsDir() {
 					return filepath.SkipDir
 				}
 				return nil
 			}
+			if src.fileFilter(info, now) != "" {
+				return nil
+			}
 
 			stats.TotalObjects++
-			if d.Type().IsRegular() {
-				info, err := d.Info()
-				if err == nil {
-					stats.TotalBytes += info.Size()
-				}
+			if info.Mode().IsRegular() {
+				stats.TotalBytes += info.Size()
 			}
 			return nil
 		})
@@ -183,3 +282,96 @@ func (s *Scanner) PreScan(ctx context.Context) (*ScanStats, error) {
 	}
 	return stats, nil
 }
+
+// walkSource percorre src em ordem lexical (como filepath.WalkDir), chamando
+// fn com o FileInfo de cada entrada. fn retorna filepath.SkipDir para não
+// descer em um diretório. Entradas inacessíveis são ignoradas.
+//
+// Com followSymlinks, symlinks são substituídos pelo alvo (links quebrados
+// continuam como symlinks) e diretórios já presentes no caminho atual são
+// ignorados, evitando ciclos. Com oneFilesystem, diretórios de outro
+// filesystem (mount points) são entregues a fn mas seu conteúdo não é
+// percorrido, como o `tar --one-file-system`.
+func walkSource(ctx context.Context, src scanSource, fn func(path string, info fs.FileInfo) error) error {
+	root := filepath.Clean(src.path)
+	info, err := os.Lstat(root)
+	if err != nil {
+		return nil
+	}
+	if src.followSymlinks && info.Mode()&os.ModeSymlink != 0 {
+		if target, err := os.Stat(root); err == nil {
+			info = target
+		}
+	}
+	w := &sourceWalker{ctx: ctx, src: src, fn: fn, ancestors: make(map[fileID]bool)}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		w.rootDev = uint64(st.Dev) // int32 no darwin
+	}
+	err = w.visit(root, info)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// sourceWalker guarda o estado da travessia de um source por walkSource.
+type sourceWalker struct {
+	ctx       context.Context
+	src       scanSource
+	fn        func(path string, info fs.FileInfo) error
+	rootDev   uint64
+	ancestors map[fileID]bool // diretórios no caminho atual (followSymlinks)
+}
+
+func (w *sourceWalker) visit(path string, info fs.FileInfo) error {
+	// Verifica cancelamento
+	select {
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	default:
+	}
+
+	if err := w.fn(path, info); err != nil || !info.IsDir() {
+		return err
+	}
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if ok && w.src.oneFilesystem && uint64(st.Dev) != w.rootDev {
+		return nil // mount point: o diretório entra, o conteúdo não
+	}
+	if ok && w.src.followSymlinks {
+		id := fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+		if w.ancestors[id] {
+			return nil // ciclo via symlink
+		}
+		w.ancestors[id] = true
+		defer delete(w.ancestors, id)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil // pula diretórios inacessíveis
+	}
+	for _, e := range entries {
+		child := filepath.Join(path, e.Name())
+		ci, err := e.Info()
+		if err != nil {
+			continue // removido durante o scan
+		}
+		if w.src.followSymlinks && ci.Mode()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(child); err == nil {
+				ci = target
+			}
+		}
+		if err := w.visit(child, ci); err != nil {
+			if err == filepath.SkipDir {
+				if ci.IsDir() {
+					continue
+				}
+				return nil // SkipDir em arquivo: ignora o restante do diretório
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -6,24 +6,30 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math/rand/v2"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
 	"github.com/robfig/cron/v3"
 )
 
 // BackupJobResult armazena o resultado do último backup de um job.
 type BackupJobResult struct {
-	Status           string        `json:"status"` // "completed", "failed", "skipped"
+	Status           string        `json:"status"` // "completed", "failed", "cancelled", "skipped", "deferred", "suppressed"
 	DurationSeconds  float64       `json:"duration_seconds"`
 	BytesTransferred int64         `json:"bytes_transferred"`
 	ObjectsCount     int64         `json:"objects_count"`
+	Empty            bool          `json:"empty,omitempty"` // sources sem entradas: archive vazio
 	Timestamp        time.Time     `json:"timestamp"`
 	HandshakeRTT     time.Duration `json:"handshake_rtt,omitempty"`
+	Error            string        `json:"error,omitempty"`
 }
 
 // BackupJob representa um job de backup com guard de execução.
@@ -36,8 +42,143 @@ type BackupJob struct {
 	// Métricas de streams paralelos (atualizadas atomicamente durante execução)
 	ActiveStreams int32 // atomic — streams TCP ativos no momento
 	MaxStreams    int32 // atomic — máximo de streams configurado para esta execução
+
+	// runBytes é o tamanho do archive enviado na execução corrente (preenchido ao fim de RunBackup).
+	runBytes int64 // atomic
+	// runEmpty indica que a execução corrente enviou um backup vazio (sources sem entradas).
+	runEmpty atomic.Bool
+	// liveBytes conta os bytes produzidos durante a execução (status ao vivo via admin socket).
+	liveBytes int64 // atomic
+
+	// Execução corrente (protegidos por mu): início, sessão no server e
+	// cancelamento via admin socket ou shutdown (cancelReason vai para o histórico).
+	startedAt    time.Time
+	sessionID    string
+	cancel       context.CancelFunc
+	cancelReason string
+	// keepSession: abortado pelo shutdown com a sessão mantida no server para
+	// o resume no próximo start (os demais cancelamentos descartam o resume-state)
+	keepSession bool
+
+	// missingSources lista os sources opcionais ausentes na execução corrente (protegido por mu).
+	missingSources []string
+
+	// Detalhes da execução corrente para --output json (protegidos por mu):
+	// checksum e contadores do archive, totais por stream e retries.
+	runChecksum    [32]byte
+	runObjects     int64
+	runSourceBytes int64
+	runStreams     []protocol.StreamTransferStats
+	runRetries     int
+
+	// snapshot é a execução coordenada pedida pelo server (snapshot_groups),
+	// do ControlSnapshotPrepare até o fim da execução (protegido por mu).
+	snapshot *snapshotCoordination
+
+	// pool limita os backups simultâneos e a banda combinada do agent (nil = sem limites).
+	pool *backupPool
+}
+
+// setRunBytes registra o tamanho do archive enviado na execução corrente. Nil-safe.
+func (j *BackupJob) setRunBytes(n uint64) {
+	if j != nil {
+		atomic.StoreInt64(&j.runBytes, int64(n))
+	}
+}
+
+// setRunResult registra tamanho e se o backup enviado foi vazio. Nil-safe.
+func (j *BackupJob) setRunResult(res *StreamResult) {
+	if j != nil {
+		j.setRunBytes(res.Size)
+		j.runEmpty.Store(res.Entries == 0)
+		j.mu.Lock()
+		j.runChecksum, j.runObjects, j.runSourceBytes = res.Checksum, res.Entries, res.Bytes
+		j.mu.Unlock()
+	}
+}
+
+// setRunStreams registra os totais por stream da execução paralela. Nil-safe.
+func (j *BackupJob) setRunStreams(stats []protocol.StreamTransferStats) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	j.runStreams = stats
+	j.mu.Unlock()
+}
+
+// addRunRetry contabiliza uma nova tentativa da execução corrente. Nil-safe.
+func (j *BackupJob) addRunRetry() {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	j.runRetries++
+	j.mu.Unlock()
+}
+
+// setMissingSources registra os sources opcionais ausentes na execução corrente. Nil-safe.
+func (j *BackupJob) setMissingSources(paths []string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	j.missingSources = paths
+	j.mu.Unlock()
+}
+
+// setSessionID registra a sessão aberta no server pela execução corrente. Nil-safe.
+func (j *BackupJob) setSessionID(id string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	j.sessionID = id
+	j.mu.Unlock()
 }
 
+// MissingSources retorna os sources opcionais ausentes na última execução. Nil-safe.
+func (j *BackupJob) MissingSources() []string {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.missingSources
+}
+
+// liveWriter envolve dest contando os bytes produzidos em liveBytes. Nil-safe.
+func (j *BackupJob) liveWriter(dest io.Writer) io.Writer {
+	if j == nil {
+		return dest
+	}
+	return &liveByteWriter{w: dest, n: &j.liveBytes}
+}
+
+// output é o destino do stream da execução: contagem de liveBytes e limite de
+// banda combinado do agent (daemon.bandwidth_limit). Nil-safe.
+func (j *BackupJob) output(ctx context.Context, dest io.Writer) io.Writer {
+	if j == nil {
+		return dest
+	}
+	return j.pool.writer(ctx, j.liveWriter(dest))
+}
+
+// liveByteWriter soma atomicamente os bytes escritos em n.
+type liveByteWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (lw *liveByteWriter) Write(p []byte) (int, error) {
+	n, err := lw.w.Write(p)
+	atomic.AddInt64(lw.n, int64(n))
+	return n, err
+}
+
+// runJobFunc executa um backup entry (injetável para testes).
+type runJobFunc func(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, logger *slog.Logger, job *BackupJob) error
+
 // Scheduler gerencia N cron jobs independentes, um por backup entry.
 type Scheduler struct {
 	cron      *cron.Cron
@@ -45,29 +186,96 @@ type Scheduler struct {
 	jobs      []*BackupJob
 	cfg       *config.AgentConfig
 	controlCh *ControlChannel // nil quando não habilitado (ex: --once)
+	runFn     runJobFunc
+
+	// state persiste o resultado das execuções (usado pelo catch-up).
+	state *ScheduleState
+
+	// stopCh interrompe esperas de jitter, catch-ups e triggers manuais pendentes no Stop.
+	// bgWg conta as execuções em andamento e é compartilhado entre reloads, para que
+	// o Stop final aguarde também jobs iniciados por schedulers anteriores.
+	stopCh      chan struct{}
+	bgWg        *sync.WaitGroup
+	cronStopped context.Context // preenchido no Stop
+
+	// pool é a fila de max_concurrent_backups, compartilhada entre reloads
+	// como bgWg para que os backups em andamento continuem contando no limite.
+	pool *backupPool
 }
 
 // NewScheduler cria um Scheduler com um cron job por backup entry.
 func NewScheduler(cfg *config.AgentConfig, logger *slog.Logger, runFn func(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, logger *slog.Logger, job *BackupJob) error, controlCh *ControlChannel) (*Scheduler, error) {
+	return newScheduler(cfg, logger, runFn, controlCh, nil)
+}
+
+// ReloadScheduler cria o Scheduler para uma nova config a partir do anterior.
+// Entries com o mesmo nome reaproveitam o BackupJob (o guard de execução e o
+// job em andamento são preservados — um backup em curso não é duplicado nem
+// interrompido). O estado persistido é compartilhado quando o state_dir não muda.
+// O chamador deve chamar prev.Detach() e depois Start() no novo scheduler.
+func ReloadScheduler(prev *Scheduler, cfg *config.AgentConfig, logger *slog.Logger, runFn func(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, logger *slog.Logger, job *BackupJob) error, controlCh *ControlChannel) (*Scheduler, error) {
+	return newScheduler(cfg, logger, runFn, controlCh, prev)
+}
+
+func newScheduler(cfg *config.AgentConfig, logger *slog.Logger, runFn runJobFunc, controlCh *ControlChannel, prev *Scheduler) (*Scheduler, error) {
 	s := &Scheduler{
 		logger:    logger,
 		cfg:       cfg,
 		controlCh: controlCh,
+		runFn:     runFn,
+		stopCh:    make(chan struct{}),
+		bgWg:      &sync.WaitGroup{},
+	}
+
+	if prev != nil {
+		s.bgWg = prev.bgWg
+		s.pool = prev.pool
+		s.pool.setLimits(cfg.Daemon)
+	} else {
+		s.pool = newBackupPool(cfg.Daemon)
+	}
+	if prev != nil && prev.cfg.Daemon.StateDir == cfg.Daemon.StateDir {
+		s.state = prev.state
+	} else {
+		state, err := LoadScheduleState(cfg.Daemon.StateDir)
+		if err != nil {
+			logger.Warn("schedule state unavailable, starting with empty state", "error", err)
+		}
+		s.state = state
 	}
 
 	c := cron.New(cron.WithLogger(cron.VerbosePrintfLogger(slog.NewLogLogger(logger.Handler(), slog.LevelDebug))))
 
 	for _, entry := range cfg.Backups {
-		job := &BackupJob{Entry: entry}
+		var job *BackupJob
+		if prev != nil {
+			job = prev.findJob(entry.Name)
+		}
+		if job != nil {
+			job.mu.Lock()
+			job.Entry = entry
+			job.mu.Unlock()
+		} else {
+			job = &BackupJob{Entry: entry}
+		}
+		job.pool = s.pool
 		s.jobs = append(s.jobs, job)
 
 		// Captura variáveis para closure
 		jobRef := job
 		entryRef := entry
-		if _, err := c.AddFunc(entry.Schedule, func() {
-			s.executeJob(jobRef, entryRef, runFn)
-		}); err != nil {
-			return nil, fmt.Errorf("adding cron job for backup %q: %w", entry.Name, err)
+		// Backups coordenados não têm schedule: o server os dispara via snapshot_groups.
+		if entry.Schedule != "" {
+			if _, err := c.AddFunc(entry.Schedule, func() {
+				s.bgWg.Add(1)
+				defer s.bgWg.Done()
+				if !s.waitJitter(entryRef) {
+					return
+				}
+				s.executeJob(jobRef, entryRef, runFn, false)
+			}); err != nil {
+				return nil, fmt.Errorf("adding cron job for backup %q: %w", entry.Name, err)
+			}
 		}
 
 		logger.Info("registered backup job",
@@ -75,6 +283,20 @@ func NewScheduler(cfg *config.AgentConfig, logger *slog.Logger, runFn func(ctx c
 			"storage", entry.Storage,
 			"schedule", entry.Schedule,
 			"parallels", entry.Parallels,
+			"jitter", entry.Jitter,
+			"catch_up", entry.CatchUp,
+			"coordinated", entry.Snapshot.Coordinated,
+			"priority", entry.Priority,
+		)
+	}
+
+	if cfg.Notifications.Digest.Enabled {
+		if _, err := c.AddFunc(cfg.Notifications.Digest.Schedule, s.sendDigest); err != nil {
+			return nil, fmt.Errorf("adding digest schedule %q: %w", cfg.Notifications.Digest.Schedule, err)
+		}
+		logger.Info("registered backup digest",
+			"schedule", cfg.Notifications.Digest.Schedule,
+			"only_on_failure", cfg.Notifications.Digest.OnlyOnFailure,
 		)
 	}
 
@@ -88,16 +310,146 @@ func (s *Scheduler) Start() {
 	s.cron.Start()
 }
 
-// Stop para o scheduler e aguarda jobs em andamento.
-func (s *Scheduler) Stop(ctx context.Context) {
+// Stop para o scheduler e aguarda jobs em andamento até ctx expirar. Backups
+// aguardando vaga no pool desistem sem executar.
+// Retorna false se algum job ainda estava em execução.
+func (s *Scheduler) Stop(ctx context.Context) bool {
 	s.logger.Info("scheduler stopping")
-	stopCtx := s.cron.Stop()
+	close(s.stopCh)
+	s.pool.close()
+	s.cronStopped = s.cron.Stop()
+	return s.Wait(ctx)
+}
+
+// Wait aguarda os jobs em andamento após Stop (ex: depois de AbortRunning).
+// Retorna false se ctx expirou antes.
+func (s *Scheduler) Wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		<-s.cronStopped.Done()
+		s.bgWg.Wait()
+		close(done)
+	}()
 
 	select {
-	case <-stopCtx.Done():
+	case <-done:
 		s.logger.Info("scheduler stopped gracefully")
+		return true
 	case <-ctx.Done():
 		s.logger.Warn("scheduler stop timed out")
+		return false
+	}
+}
+
+// Detach para de agendar novas execuções (usado no reload) sem aguardar os
+// jobs em andamento, que terminam normalmente e continuam contados em bgWg.
+func (s *Scheduler) Detach() {
+	close(s.stopCh)
+	s.cron.Stop()
+}
+
+// CatchUp dispara imediatamente os entries com catch_up habilitado que perderam
+// uma execução agendada enquanto o daemon estava parado (último sucesso mais
+// antigo que o período do schedule, ou nenhum sucesso registrado), além dos
+// entries com uma sessão interrompida pelo restart (resume-state.json).
+// Deve ser chamado apenas no start do daemon — não em reloads via SIGHUP.
+func (s *Scheduler) CatchUp() {
+	now := time.Now()
+	for _, job := range s.jobs {
+		entry := job.Entry
+		entryLogger := s.logger.With("backup", entry.Name, "storage", entry.Storage)
+
+		// Backup interrompido pelo restart anterior: retoma já, sem jitter nem min_interval
+		if rec, ok, _ := loadResumeRecord(s.cfg.Daemon.StateDir, entry.Name); ok && rec.resumable() {
+			entryLogger.Info("backup interrupted by agent restart, resuming session", "session", rec.SessionID)
+			s.bgWg.Add(1)
+			go func(job *BackupJob) {
+				defer s.bgWg.Done()
+				if !s.waitControlChannel(resumeControlWait) {
+					return
+				}
+				s.executeJob(job, job.Entry, s.runFn, true)
+			}(job)
+			continue
+		}
+
+		if !entry.CatchUp {
+			continue
+		}
+
+		st, ok := s.state.Get(entry.Name)
+		if ok && !st.LastSuccess.IsZero() {
+			sched, err := cron.ParseStandard(entry.Schedule)
+			if err != nil {
+				continue
+			}
+			// Próxima execução prevista após o último sucesso ainda está no futuro: nada perdido
+			if sched.Next(st.LastSuccess).After(now) {
+				continue
+			}
+		}
+
+		lastSuccess := "never"
+		if ok && !st.LastSuccess.IsZero() {
+			lastSuccess = st.LastSuccess.Format(time.RFC3339)
+		}
+		entryLogger.Info("missed scheduled run detected, catching up", "last_success", lastSuccess)
+
+		s.bgWg.Add(1)
+		go func(job *BackupJob) {
+			defer s.bgWg.Done()
+			if !s.waitJitter(job.Entry) {
+				return
+			}
+			s.executeJob(job, job.Entry, s.runFn, false)
+		}(job)
+	}
+}
+
+// resumeControlWait limita quanto o resume de um backup interrompido pelo
+// restart aguarda a conexão do control channel antes de disparar.
+const resumeControlWait = 30 * time.Second
+
+// waitControlChannel aguarda até timeout a conexão do control channel, sem a
+// qual o pre-flight de executeJob pula o backup. Retorna false se o scheduler
+// foi parado durante a espera.
+func (s *Scheduler) waitControlChannel(timeout time.Duration) bool {
+	if s.controlCh == nil {
+		return true
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for !s.controlCh.IsConnected() {
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return true
+		case <-s.stopCh:
+			return false
+		}
+	}
+	return true
+}
+
+// waitJitter aguarda um atraso aleatório em [0, entry.Jitter) antes da execução,
+// espalhando no tempo agents com o mesmo schedule. Retorna false se o scheduler
+// foi parado durante a espera.
+func (s *Scheduler) waitJitter(entry config.BackupEntry) bool {
+	if entry.Jitter <= 0 {
+		return true
+	}
+	delay := rand.N(entry.Jitter)
+	s.logger.Debug("applying schedule jitter", "backup", entry.Name, "delay", delay)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stopCh:
+		return false
 	}
 }
 
@@ -106,7 +458,173 @@ func (s *Scheduler) Jobs() []*BackupJob {
 	return s.jobs
 }
 
-func (s *Scheduler) executeJob(job *BackupJob, entry config.BackupEntry, runFn func(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, logger *slog.Logger, job *BackupJob) error) {
+// findJob retorna o job do entry name (nil se não existir).
+func (s *Scheduler) findJob(name string) *BackupJob {
+	for _, job := range s.jobs {
+		if job.Entry.Name == name {
+			return job
+		}
+	}
+	return nil
+}
+
+// Trigger dispara imediatamente um backup entry fora do schedule (sem jitter).
+// force ignora o min_interval. Retorna erro se o entry não existe ou já está em execução.
+func (s *Scheduler) Trigger(name string, force bool) error {
+	job := s.findJob(name)
+	if job == nil {
+		return fmt.Errorf("unknown backup %q", name)
+	}
+	select {
+	case <-s.stopCh:
+		return fmt.Errorf("scheduler is stopping, try again")
+	default:
+	}
+	job.mu.Lock()
+	running := job.running
+	job.mu.Unlock()
+	if running {
+		return fmt.Errorf("backup %q is already running", name)
+	}
+
+	s.logger.Info("manual backup trigger", "backup", name, "force", force)
+	s.bgWg.Add(1)
+	go func() {
+		defer s.bgWg.Done()
+		s.executeJob(job, job.Entry, s.runFn, force)
+	}()
+	return nil
+}
+
+// Cancel cancela a execução corrente de um backup entry.
+func (s *Scheduler) Cancel(name string) error {
+	job := s.findJob(name)
+	if job == nil {
+		return fmt.Errorf("unknown backup %q", name)
+	}
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if !job.running || job.cancel == nil {
+		return fmt.Errorf("backup %q is not running", name)
+	}
+	s.logger.Warn("cancelling backup on admin request", "backup", name)
+	job.cancelReason = "cancelled by admin request"
+	job.cancel()
+	return nil
+}
+
+// Running retorna os nomes dos backups em execução.
+func (s *Scheduler) Running() []string {
+	var names []string
+	for _, job := range s.jobs {
+		job.mu.Lock()
+		if job.running {
+			names = append(names, job.Entry.Name)
+		}
+		job.mu.Unlock()
+	}
+	return names
+}
+
+// AbortRunning cancela todos os backups em execução, registrando reason no
+// histórico, e retorna os nomes abortados. Sessões já abertas no server são
+// canceladas via control channel antes do cancelamento local, para que o
+// server descarte os dados parciais em vez de aguardar um resume até o TTL —
+// exceto as persistidas em resume-state.json, que o próximo start do daemon
+// retoma (ver resumeAfterRestart).
+func (s *Scheduler) AbortRunning(reason string) []string {
+	var aborted []string
+	for _, job := range s.jobs {
+		job.mu.Lock()
+		if !job.running || job.cancel == nil {
+			job.mu.Unlock()
+			continue
+		}
+		sessionID := job.sessionID
+		job.cancelReason = reason
+		cancel := job.cancel
+		keep := sessionID != "" && s.resumable(job.Entry.Name, sessionID)
+		job.keepSession = keep
+		job.mu.Unlock()
+
+		if keep {
+			s.logger.Info("session kept on server for resume after restart",
+				"backup", job.Entry.Name, "session", sessionID)
+		} else if sessionID != "" && s.controlCh != nil {
+			if err := s.controlCh.SendSessionCancel(sessionID); err != nil {
+				s.logger.Warn("server not notified of aborted session, it will expire by TTL",
+					"backup", job.Entry.Name, "session", sessionID, "error", err)
+			}
+		}
+		cancel()
+		aborted = append(aborted, job.Entry.Name)
+	}
+	return aborted
+}
+
+// resumable informa se a sessão sessionID do entry está persistida como
+// retomável após restart do agent.
+func (s *Scheduler) resumable(name, sessionID string) bool {
+	rec, ok, _ := loadResumeRecord(s.cfg.Daemon.StateDir, name)
+	return ok && rec.SessionID == sessionID && rec.resumable()
+}
+
+// AbortSession cancela o backup cuja sessão no server é sessionID (todos os
+// backups com sessão aberta se vazio), registrando reason no histórico, e
+// retorna os nomes abortados. Usado quando o próprio server abortou a sessão
+// (ControlAbort): ele já descartou os dados, então nada é enviado de volta.
+func (s *Scheduler) AbortSession(sessionID, reason string) []string {
+	var aborted []string
+	for _, job := range s.jobs {
+		job.mu.Lock()
+		match := job.running && job.cancel != nil && job.sessionID != "" &&
+			(sessionID == "" || job.sessionID == sessionID)
+		if match {
+			job.cancelReason = reason
+			job.cancel()
+			aborted = append(aborted, job.Entry.Name)
+		}
+		job.mu.Unlock()
+	}
+	return aborted
+}
+
+// LiveStatus retorna o status persistido de cada entry acrescido do estado da
+// execução corrente (bytes produzidos e throughput médio desde o início) ou da
+// posição na fila de max_concurrent_backups.
+func (s *Scheduler) LiveStatus() []EntryStatus {
+	now := time.Now()
+	entries := BuildStatus(s.cfg, s.state, now)
+	queued := s.pool.queuePositions()
+	for i := range entries {
+		job := s.findJob(entries[i].Name)
+		if job == nil {
+			continue
+		}
+		job.mu.Lock()
+		running, startedAt := job.running, job.startedAt
+		job.mu.Unlock()
+		if pos, ok := queued[entries[i].Name]; ok && running {
+			entries[i].QueuePosition = pos
+			continue
+		}
+		if !running || startedAt.IsZero() {
+			continue
+		}
+		sent := atomic.LoadInt64(&job.liveBytes)
+		entries[i].Running = &RunningStatus{
+			Since:         startedAt,
+			BytesSent:     sent,
+			ActiveStreams: atomic.LoadInt32(&job.ActiveStreams),
+		}
+		if elapsed := now.Sub(startedAt).Seconds(); elapsed > 0 {
+			entries[i].Running.ThroughputBps = float64(sent) / elapsed
+		}
+	}
+	return entries
+}
+
+func (s *Scheduler) executeJob(job *BackupJob, entry config.BackupEntry, runFn func(ctx context.Context, cfg *config.AgentConfig, entry config.BackupEntry, logger *slog.Logger, job *BackupJob) error, force bool) {
 	entryLogger := s.logger.With("backup", entry.Name, "storage", entry.Storage)
 
 	job.mu.Lock()
@@ -120,14 +638,68 @@ func (s *Scheduler) executeJob(job *BackupJob, entry config.BackupEntry, runFn f
 		return
 	}
 	job.running = true
+	coord := job.snapshot
 	job.mu.Unlock()
 
 	defer func() {
 		job.mu.Lock()
+		job.snapshot = nil
 		job.running = false
+		job.startedAt = time.Time{}
+		job.sessionID = ""
+		job.cancel = nil
+		job.cancelReason = ""
+		job.keepSession = false
 		job.mu.Unlock()
 	}()
 
+	// Intervalo mínimo entre sucessos: protege contra schedules mal configurados.
+	// Um trigger manual com force ignora a supressão.
+	if remaining := s.state.MinIntervalRemaining(entry, time.Now()); remaining > 0 && !force {
+		entryLogger.Warn("backup suppressed: min_interval since last success not elapsed",
+			"min_interval", entry.MinInterval,
+			"retry_after", remaining.Round(time.Second),
+		)
+		job.mu.Lock()
+		job.LastResult = &BackupJobResult{
+			Status:    "suppressed",
+			Timestamp: time.Now(),
+		}
+		job.mu.Unlock()
+		if coord != nil {
+			s.replySnapshot(coord.id, protocol.SnapshotStatusBusy, "backup suppressed by min_interval")
+		}
+		return
+	}
+
+	// Context sem timeout no nível do job — o timeout real (MaxBackupDuration)
+	// é aplicado POR TENTATIVA dentro de RunBackup/runParallelBackup.
+	// Isso garante que cada retry tem o timeout integral, não o remanescente.
+	// Criado antes da fila do pool para que o cancelamento alcance o job em espera.
+	jobCtx, jobCancel := context.WithCancel(context.Background())
+	defer jobCancel()
+	job.mu.Lock()
+	job.cancel = jobCancel
+	job.mu.Unlock()
+
+	release, err := s.acquireSlot(jobCtx, job, entry, entryLogger, coord)
+	if err != nil {
+		job.mu.Lock()
+		status, reason := "skipped", err.Error()
+		if jobCtx.Err() != nil {
+			status, reason = "cancelled", job.cancelReason
+		}
+		job.LastResult = &BackupJobResult{
+			Status:    status,
+			Timestamp: time.Now(),
+			Error:     reason,
+		}
+		job.mu.Unlock()
+		entryLogger.Warn("backup not started while waiting for a backup slot", "reason", reason)
+		return
+	}
+	defer release()
+
 	// Pre-flight check: se o control channel existe e está desconectado, skip
 	if s.controlCh != nil && !s.controlCh.IsConnected() {
 		entryLogger.Warn("skipping scheduled backup: server unreachable via control channel",
@@ -143,40 +715,109 @@ func (s *Scheduler) executeJob(job *BackupJob, entry config.BackupEntry, runFn f
 	}
 
 	entryLogger.Info("scheduled backup triggered")
+	hc := newHealthcheckPinger(entry, entryLogger)
+	hc.Start(context.Background())
 	start := time.Now()
 
 	// Inicializa métricas de streams antes da execução
 	atomic.StoreInt32(&job.MaxStreams, int32(entry.Parallels))
 	atomic.StoreInt32(&job.ActiveStreams, 0)
+	atomic.StoreInt64(&job.runBytes, 0)
+	atomic.StoreInt64(&job.liveBytes, 0)
+	job.runEmpty.Store(false)
 
-	// Context sem timeout no nível do job — o timeout real (MaxBackupDuration)
-	// é aplicado POR TENTATIVA dentro de RunBackup/runParallelBackup.
-	// Isso garante que cada retry tem o timeout integral, não o remanescente.
-	jobCtx, jobCancel := context.WithCancel(context.Background())
-	defer jobCancel()
+	job.mu.Lock()
+	job.startedAt = start
+	job.missingSources = nil
+	job.mu.Unlock()
 
-	err := runFn(jobCtx, s.cfg, entry, entryLogger, job)
+	err = s.runWithSnapshot(jobCtx, job, entry, entryLogger, coord, runFn)
 	duration := time.Since(start)
 
 	// Reseta métricas de streams após execução
 	atomic.StoreInt32(&job.ActiveStreams, 0)
 	atomic.StoreInt32(&job.MaxStreams, 0)
 
+	bytesSent := atomic.LoadInt64(&job.runBytes)
+
 	job.mu.Lock()
-	if err != nil {
+	if err != nil && jobCtx.Err() != nil {
+		entryLogger.Warn("backup cancelled", "duration", duration, "reason", job.cancelReason)
+		if !job.keepSession {
+			if err := clearResumeRecord(s.cfg.Daemon.StateDir, entry.Name); err != nil {
+				entryLogger.Warn("failed to clear resume state", "error", err)
+			}
+		}
+		job.LastResult = &BackupJobResult{
+			Status:          "cancelled",
+			DurationSeconds: duration.Seconds(),
+			Timestamp:       time.Now(),
+			Error:           job.cancelReason,
+		}
+	} else if errors.Is(err, ErrBackupDeferred) || errors.Is(err, ErrLocalTargetUnavailable) {
+		entryLogger.Warn("backup deferred", "reason", err)
+		job.LastResult = &BackupJobResult{
+			Status:          "deferred",
+			DurationSeconds: duration.Seconds(),
+			Timestamp:       time.Now(),
+			Error:           err.Error(),
+		}
+	} else if err != nil {
 		entryLogger.Error("backup failed", "error", err, "duration", duration)
 		job.LastResult = &BackupJobResult{
 			Status:          "failed",
 			DurationSeconds: duration.Seconds(),
 			Timestamp:       time.Now(),
+			Error:           err.Error(),
 		}
 	} else {
+		if len(job.missingSources) > 0 {
+			entryLogger.Warn("backup completed without optional sources", "missing", job.missingSources)
+		}
 		entryLogger.Info("backup completed", "duration", duration)
 		job.LastResult = &BackupJobResult{
-			Status:          "completed",
-			DurationSeconds: duration.Seconds(),
-			Timestamp:       time.Now(),
+			Status:           "completed",
+			DurationSeconds:  duration.Seconds(),
+			BytesTransferred: bytesSent,
+			Empty:            job.runEmpty.Load(),
+			Timestamp:        time.Now(),
 		}
 	}
+	run := JobRun{
+		Start:           start,
+		DurationSeconds: duration.Seconds(),
+		Bytes:           job.LastResult.BytesTransferred,
+		Status:          job.LastResult.Status,
+		Empty:           job.LastResult.Empty,
+		Error:           job.LastResult.Error,
+		Config:          newEntryConfigSnapshot(s.cfg, entry),
+	}
 	job.mu.Unlock()
+
+	// Persiste o resultado para catch-up, min_interval e `nbackup-agent status`
+	if stateErr := s.state.Record(entry.Name, run); stateErr != nil {
+		entryLogger.Warn("failed to persist schedule state", "error", stateErr)
+	}
+
+	notifyRunWebhook(s.cfg, entry, run, entryLogger)
+	if hc != nil {
+		go hc.Finish(context.Background(), run)
+	}
+}
+
+// acquireSlot ocupa uma vaga de max_concurrent_backups para a execução,
+// aguardando na fila do pool se necessário. Backups coordenados pelo server
+// (snapshot_groups) não aguardam: ocupam a vaga direto para não atrasar o
+// snapshot do grupo.
+func (s *Scheduler) acquireSlot(ctx context.Context, job *BackupJob, entry config.BackupEntry, logger *slog.Logger, coord *snapshotCoordination) (func(), error) {
+	if coord != nil {
+		return s.pool.take(), nil
+	}
+	return s.pool.acquire(ctx, entry.Name, entry.Priority, func(position int) {
+		logger.Info("waiting for a backup slot",
+			"position", position,
+			"max_concurrent_backups", s.cfg.Daemon.MaxConcurrentBackups,
+			"priority", entry.Priority,
+		)
+	})
 }
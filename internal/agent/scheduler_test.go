@@ -0,0 +1,550 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func newTestSchedulerConfig(stateDir string, entry config.BackupEntry) *config.AgentConfig {
+	return &config.AgentConfig{
+		Daemon:  config.DaemonInfo{StateDir: stateDir},
+		Backups: []config.BackupEntry{entry},
+	}
+}
+
+func TestScheduleState_RecordAndReload(t *testing.T) {
+	dir := t.TempDir()
+
+	state, err := LoadScheduleState(dir)
+	if err != nil {
+		t.Fatalf("LoadScheduleState: %v", err)
+	}
+	if _, ok := state.Get("app"); ok {
+		t.Fatal("expected empty state")
+	}
+
+	at := time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC)
+	if err := state.Record("app", JobRun{Status: "completed", Start: at}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if err := state.Record("app", JobRun{Status: "failed", Start: at.Add(time.Hour)}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	reloaded, err := LoadScheduleState(dir)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	st, ok := reloaded.Get("app")
+	if !ok {
+		t.Fatal("expected state for app after reload")
+	}
+	if !st.LastSuccess.Equal(at) {
+		t.Errorf("expected last_success %v, got %v", at, st.LastSuccess)
+	}
+	if st.LastStatus != "failed" || !st.LastAttempt.Equal(at.Add(time.Hour)) {
+		t.Errorf("unexpected last attempt: %+v", st)
+	}
+}
+
+func TestScheduleState_CorruptFileStartsEmpty(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, scheduleStateFile), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	state, err := LoadScheduleState(dir)
+	if err == nil {
+		t.Fatal("expected parse error")
+	}
+	if state == nil {
+		t.Fatal("expected usable empty state on parse error")
+	}
+	if _, ok := state.Get("app"); ok {
+		t.Fatal("expected empty state")
+	}
+}
+
+func TestScheduler_CatchUp(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	entry := config.BackupEntry{Name: "app", Storage: "default", Schedule: "0 2 * * *", CatchUp: true}
+
+	tests := []struct {
+		name        string
+		lastSuccess time.Time
+		wantRun     bool
+	}{
+		{"never ran", time.Time{}, true},
+		{"missed run", time.Now().Add(-49 * time.Hour), true},
+		{"recent success", time.Now().Add(-time.Minute), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if !tt.lastSuccess.IsZero() {
+				state, _ := LoadScheduleState(dir)
+				if err := state.Record("app", JobRun{Status: "completed", Start: tt.lastSuccess}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var runs atomic.Int32
+			runFn := func(ctx context.Context, cfg *config.AgentConfig, e config.BackupEntry, l *slog.Logger, job *BackupJob) error {
+				runs.Add(1)
+				return nil
+			}
+			sched, err := NewScheduler(newTestSchedulerConfig(dir, entry), logger, runFn, nil)
+			if err != nil {
+				t.Fatalf("NewScheduler: %v", err)
+			}
+			sched.CatchUp()
+			sched.bgWg.Wait()
+
+			if got := runs.Load() == 1; got != tt.wantRun {
+				t.Fatalf("expected run=%v, got runs=%d", tt.wantRun, runs.Load())
+			}
+			if tt.wantRun {
+				st, ok := sched.state.Get("app")
+				if !ok || st.LastStatus != "completed" {
+					t.Fatalf("expected catch-up result persisted, got %+v", st)
+				}
+			}
+		})
+	}
+}
+
+func TestScheduler_CatchUpDisabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	entry := config.BackupEntry{Name: "app", Storage: "default", Schedule: "0 2 * * *"}
+
+	var runs atomic.Int32
+	runFn := func(ctx context.Context, cfg *config.AgentConfig, e config.BackupEntry, l *slog.Logger, job *BackupJob) error {
+		runs.Add(1)
+		return nil
+	}
+	sched, err := NewScheduler(newTestSchedulerConfig(t.TempDir(), entry), logger, runFn, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+	sched.CatchUp()
+	sched.bgWg.Wait()
+	if runs.Load() != 0 {
+		t.Fatalf("expected no catch-up run, got %d", runs.Load())
+	}
+}
+
+// TestScheduler_ResumesInterruptedSession verifica que o start dispara na hora
+// o entry com sessão single-stream em resume-state.json (mesmo sem catch_up) e
+// que o abort do shutdown mantém o registro, enquanto o cancel do admin o remove.
+func TestScheduler_ResumesInterruptedSession(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	entry := config.BackupEntry{Name: "app", Storage: "default", Schedule: "0 2 * * *"}
+	dir := t.TempDir()
+	if err := saveResumeRecord(dir, "app", resumeRecord{SessionID: "s-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{}, 1)
+	runFn := func(ctx context.Context, cfg *config.AgentConfig, e config.BackupEntry, l *slog.Logger, job *BackupJob) error {
+		job.setSessionID("s-1")
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	sched, err := NewScheduler(newTestSchedulerConfig(dir, entry), logger, runFn, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+
+	sched.CatchUp()
+	<-started
+	if aborted := sched.AbortRunning("aborted by daemon shutdown"); len(aborted) != 1 {
+		t.Fatalf("expected 1 aborted backup, got %v", aborted)
+	}
+	sched.bgWg.Wait()
+	if _, ok, _ := loadResumeRecord(dir, "app"); !ok {
+		t.Fatal("expected resume record kept after shutdown abort")
+	}
+
+	if err := sched.Trigger("app", true); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := sched.Cancel("app"); err != nil {
+		t.Fatal(err)
+	}
+	sched.bgWg.Wait()
+	if _, ok, _ := loadResumeRecord(dir, "app"); ok {
+		t.Fatal("expected resume record cleared after admin cancel")
+	}
+}
+
+func TestScheduler_JitterInterruptedByStop(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	entry := config.BackupEntry{Name: "app", Storage: "default", Schedule: "0 2 * * *", CatchUp: true, Jitter: time.Hour}
+
+	var runs atomic.Int32
+	runFn := func(ctx context.Context, cfg *config.AgentConfig, e config.BackupEntry, l *slog.Logger, job *BackupJob) error {
+		runs.Add(1)
+		return nil
+	}
+	sched, err := NewScheduler(newTestSchedulerConfig(t.TempDir(), entry), logger, runFn, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+	sched.Start()
+	sched.CatchUp()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	sched.Stop(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("stop should not wait for the jitter delay")
+	}
+	if runs.Load() != 0 {
+		t.Fatalf("expected job cancelled during jitter, got %d runs", runs.Load())
+	}
+}
+
+func TestScheduleState_MinIntervalRemaining(t *testing.T) {
+	state, _ := LoadScheduleState(t.TempDir())
+	now := time.Now()
+	entry := config.BackupEntry{Name: "app", MinInterval: 12 * time.Hour}
+
+	if got := state.MinIntervalRemaining(entry, now); got != 0 {
+		t.Fatalf("expected 0 without previous success, got %v", got)
+	}
+
+	if err := state.Record("app", JobRun{Status: "completed", Start: now.Add(-2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := state.MinIntervalRemaining(entry, now); got != 10*time.Hour {
+		t.Fatalf("expected 10h remaining, got %v", got)
+	}
+
+	// Falha posterior não reinicia o intervalo
+	if err := state.Record("app", JobRun{Status: "failed", Start: now.Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := state.MinIntervalRemaining(entry, now); got != 10*time.Hour {
+		t.Fatalf("expected failure to not reset min_interval, got %v", got)
+	}
+
+	entry.MinInterval = 0
+	if got := state.MinIntervalRemaining(entry, now); got != 0 {
+		t.Fatalf("expected 0 with min_interval disabled, got %v", got)
+	}
+}
+
+func TestScheduler_MinIntervalSuppressesRun(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	entry := config.BackupEntry{Name: "app", Storage: "default", Schedule: "0 2 * * *", MinInterval: time.Hour}
+
+	state, _ := LoadScheduleState(dir)
+	if err := state.Record("app", JobRun{Status: "completed", Start: time.Now().Add(-10 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var runs atomic.Int32
+	runFn := func(ctx context.Context, cfg *config.AgentConfig, e config.BackupEntry, l *slog.Logger, job *BackupJob) error {
+		runs.Add(1)
+		return nil
+	}
+	sched, err := NewScheduler(newTestSchedulerConfig(dir, entry), logger, runFn, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+	job := sched.Jobs()[0]
+	sched.executeJob(job, entry, runFn, false)
+
+	if runs.Load() != 0 {
+		t.Fatalf("expected run suppressed, got %d runs", runs.Load())
+	}
+	if job.LastResult == nil || job.LastResult.Status != "suppressed" {
+		t.Fatalf("expected status suppressed, got %+v", job.LastResult)
+	}
+}
+
+func TestScheduleState_HistoryIsBounded(t *testing.T) {
+	state, _ := LoadScheduleState(t.TempDir())
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < maxJobHistory+5; i++ {
+		if err := state.Record("app", JobRun{Status: "completed", Start: base.Add(time.Duration(i) * time.Second), Bytes: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st, _ := state.Get("app")
+	if len(st.History) != maxJobHistory {
+		t.Fatalf("expected %d history entries, got %d", maxJobHistory, len(st.History))
+	}
+	if st.History[0].Bytes != int64(maxJobHistory+4) {
+		t.Fatalf("expected most recent run first, got bytes=%d", st.History[0].Bytes)
+	}
+}
+
+func TestReloadScheduler_PreservesRunningJob(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	entry := config.BackupEntry{Name: "app", Storage: "default", Schedule: "0 2 * * *"}
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	runFn := func(ctx context.Context, cfg *config.AgentConfig, e config.BackupEntry, l *slog.Logger, job *BackupJob) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+
+	prev, err := NewScheduler(newTestSchedulerConfig(dir, entry), logger, runFn, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+	prev.Start()
+	if err := prev.Trigger("app", false); err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+	<-started
+
+	// Reload: schedule de "app" muda e um entry novo é adicionado
+	changed := entry
+	changed.Schedule = "30 3 * * *"
+	cfg := newTestSchedulerConfig(dir, changed)
+	cfg.Backups = append(cfg.Backups, config.BackupEntry{Name: "db", Storage: "default", Schedule: "0 4 * * *"})
+
+	next, err := ReloadScheduler(prev, cfg, logger, runFn, nil)
+	if err != nil {
+		t.Fatalf("ReloadScheduler: %v", err)
+	}
+	prev.Detach()
+	next.Start()
+
+	if next.findJob("app") != prev.findJob("app") {
+		t.Error("expected BackupJob for app to be reused across reload")
+	}
+	if next.findJob("app").Entry.Schedule != "30 3 * * *" {
+		t.Errorf("expected updated schedule, got %q", next.findJob("app").Entry.Schedule)
+	}
+	if next.findJob("db") == nil {
+		t.Error("expected new entry db registered")
+	}
+	if next.state != prev.state {
+		t.Error("expected schedule state shared when state_dir is unchanged")
+	}
+	if err := next.Trigger("app", false); err == nil {
+		t.Error("expected running backup to block a duplicate trigger after reload")
+	}
+	if err := prev.Trigger("app", false); err == nil {
+		t.Error("expected detached scheduler to refuse triggers")
+	}
+
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	next.Stop(ctx)
+
+	st, ok := next.state.Get("app")
+	if !ok || st.LastStatus != "completed" {
+		t.Fatalf("expected in-flight run to complete and be recorded, got %+v", st)
+	}
+}
+
+func TestControlChannelUnchanged(t *testing.T) {
+	enabled := true
+	base := &config.AgentConfig{
+		Agent:  config.AgentInfo{Name: "web-01"},
+		Server: config.ServerAddr{Address: "backup:9847"},
+		Daemon: config.DaemonInfo{ControlChannel: config.ControlChannelConfig{Enabled: &enabled, KeepaliveInterval: 30 * time.Second}},
+	}
+
+	other := *base
+	other.Backups = []config.BackupEntry{{Name: "new"}}
+	if !controlChannelUnchanged(base, &other) {
+		t.Error("backup changes should keep the control channel")
+	}
+
+	enabledCopy := true
+	other.Daemon.ControlChannel.Enabled = &enabledCopy
+	if !controlChannelUnchanged(base, &other) {
+		t.Error("equal *bool values should compare equal")
+	}
+
+	other.Server.Address = "backup2:9847"
+	if controlChannelUnchanged(base, &other) {
+		t.Error("server address change should restart the control channel")
+	}
+}
+
+// startBlockingJob dispara "app" com um runFn que só retorna ao ser liberado
+// (release) ou cancelado.
+func startBlockingJob(t *testing.T) (*Scheduler, chan struct{}) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	entry := config.BackupEntry{Name: "app", Storage: "default", Schedule: "0 2 * * *"}
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	runFn := func(ctx context.Context, cfg *config.AgentConfig, e config.BackupEntry, l *slog.Logger, job *BackupJob) error {
+		job.setSessionID("sess-1")
+		started <- struct{}{}
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	sched, err := NewScheduler(newTestSchedulerConfig(t.TempDir(), entry), logger, runFn, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+	sched.Start()
+	if err := sched.Trigger("app", false); err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+	<-started
+	return sched, release
+}
+
+func TestShutdownScheduler_WaitFinishesJob(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sched, release := startBlockingJob(t)
+
+	time.AfterFunc(100*time.Millisecond, func() { close(release) })
+	err := shutdownScheduler(sched, config.ShutdownConfig{Mode: config.ShutdownModeWait, Timeout: 5 * time.Second}, make(chan os.Signal), logger)
+	if err != nil {
+		t.Fatalf("expected clean shutdown, got %v", err)
+	}
+	if st, _ := sched.state.Get("app"); st.LastStatus != "completed" {
+		t.Errorf("expected completed run, got %+v", st)
+	}
+}
+
+func TestShutdownScheduler_AbortsAfterTimeout(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sched, _ := startBlockingJob(t)
+
+	start := time.Now()
+	err := shutdownScheduler(sched, config.ShutdownConfig{Mode: config.ShutdownModeWait, Timeout: 100 * time.Millisecond}, make(chan os.Signal), logger)
+	if !errors.Is(err, ErrShutdownAborted) {
+		t.Fatalf("expected ErrShutdownAborted, got %v", err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("expected shutdown to wait for the timeout before aborting")
+	}
+	st, _ := sched.state.Get("app")
+	if st.LastStatus != "cancelled" || len(st.History) == 0 || st.History[0].Error != "aborted by daemon shutdown" {
+		t.Errorf("expected run recorded as aborted, got %+v", st)
+	}
+}
+
+func TestShutdownScheduler_SecondSignalAborts(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sched, _ := startBlockingJob(t)
+
+	sigCh := make(chan os.Signal, 1)
+	sigCh <- syscall.SIGTERM
+	start := time.Now()
+	err := shutdownScheduler(sched, config.ShutdownConfig{Mode: config.ShutdownModeWait, Timeout: time.Minute}, sigCh, logger)
+	if !errors.Is(err, ErrShutdownAborted) {
+		t.Fatalf("expected ErrShutdownAborted, got %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("expected second signal to abort without waiting for the timeout")
+	}
+}
+
+func TestScheduler_AbortSession(t *testing.T) {
+	sched, _ := startBlockingJob(t)
+
+	if names := sched.AbortSession("other", "aborted by server: disk full"); len(names) != 0 {
+		t.Fatalf("expected no backup aborted for another session, got %v", names)
+	}
+	if names := sched.AbortSession("sess-1", "aborted by server: disk full"); len(names) != 1 || names[0] != "app" {
+		t.Fatalf("expected app aborted, got %v", names)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !sched.Stop(ctx) {
+		t.Fatal("expected aborted job to finish")
+	}
+
+	st, _ := sched.state.Get("app")
+	if st.LastStatus != "cancelled" || len(st.History) == 0 || st.History[0].Error != "aborted by server: disk full" {
+		t.Errorf("expected run recorded as aborted by server, got %+v", st)
+	}
+}
+
+func TestScheduler_MaxConcurrentBackupsQueuesJob(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := newTestSchedulerConfig(t.TempDir(), config.BackupEntry{Name: "home", Storage: "default", Schedule: "0 2 * * *"})
+	cfg.Backups = append(cfg.Backups, config.BackupEntry{Name: "config", Storage: "default", Schedule: "0 2 * * *", Priority: 10})
+	cfg.Daemon.MaxConcurrentBackups = 1
+
+	release := make(chan struct{})
+	started := make(chan string, 2)
+	runFn := func(ctx context.Context, cfg *config.AgentConfig, e config.BackupEntry, l *slog.Logger, job *BackupJob) error {
+		started <- e.Name
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	sched, err := NewScheduler(cfg, logger, runFn, nil)
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+	sched.Start()
+	if err := sched.Trigger("home", false); err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+	<-started
+	if err := sched.Trigger("config", false); err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sched.LiveStatus()[1].QueuePosition != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected config queued behind home, got %+v", sched.LiveStatus()[1])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sched.LiveStatus()[1].Running != nil {
+		t.Error("expected queued backup not reported as running")
+	}
+
+	// Cancelado na fila: não chega a executar
+	if err := sched.Cancel("config"); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sched.Stop(ctx)
+
+	select {
+	case name := <-started:
+		t.Errorf("expected cancelled queued backup not to run, %s started", name)
+	default:
+	}
+	if r := sched.findJob("config").LastResult; r == nil || r.Status != "cancelled" {
+		t.Errorf("expected queued backup cancelled, got %+v", r)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// maxSnapshotOutput limita a saída do comando de snapshot incluída no erro.
+const maxSnapshotOutput = 512
+
+// ErrSnapshotNotReleased indica que o server não liberou a transferência de
+// um snapshot coordenado dentro de snapshot.timeout.
+var ErrSnapshotNotReleased = errors.New("coordinated snapshot not released by server")
+
+// snapshotCoordination é uma fase de snapshot pedida pelo server
+// (ControlSnapshotPrepare) para o snapshot_group snapshotID.
+type snapshotCoordination struct {
+	id      string
+	release chan struct{} // fechado no ControlSnapshotRelease com proceed
+}
+
+// PrepareSnapshot inicia a execução coordenada do backup name pedida pelo
+// server: o snapshot.command roda imediatamente, o resultado é confirmado via
+// ControlSnapshotReady e a transferência aguarda o ControlSnapshotRelease.
+// Recusas (backup desconhecido, não coordenado ou em execução) são respondidas
+// ao server e retornadas como erro.
+func (s *Scheduler) PrepareSnapshot(snapshotID, name string) error {
+	status, err := s.prepareSnapshot(snapshotID, name)
+	if err != nil {
+		s.replySnapshot(snapshotID, status, err.Error())
+	}
+	return err
+}
+
+func (s *Scheduler) prepareSnapshot(snapshotID, name string) (byte, error) {
+	job := s.findJob(name)
+	if job == nil {
+		return protocol.SnapshotStatusFailed, fmt.Errorf("unknown backup %q", name)
+	}
+	select {
+	case <-s.stopCh:
+		return protocol.SnapshotStatusBusy, fmt.Errorf("scheduler is stopping")
+	default:
+	}
+
+	job.mu.Lock()
+	if !job.Entry.Snapshot.Coordinated {
+		job.mu.Unlock()
+		return protocol.SnapshotStatusFailed, fmt.Errorf("backup %q is not coordinated (snapshot.coordinated)", name)
+	}
+	if job.running || job.snapshot != nil {
+		job.mu.Unlock()
+		return protocol.SnapshotStatusBusy, fmt.Errorf("backup %q is already running", name)
+	}
+	job.snapshot = &snapshotCoordination{id: snapshotID, release: make(chan struct{})}
+	job.mu.Unlock()
+
+	s.logger.Info("coordinated snapshot requested", "backup", name, "snapshot", snapshotID)
+	s.bgWg.Add(1)
+	go func() {
+		defer s.bgWg.Done()
+		s.executeJob(job, job.Entry, s.runFn, true)
+	}()
+	return protocol.SnapshotStatusReady, nil
+}
+
+// ReleaseSnapshot aplica o ControlSnapshotRelease do server: com proceed a
+// transferência do backup que aguarda snapshotID começa; sem proceed (outro
+// agent do grupo falhou) a execução é cancelada e o cleanup_command executado.
+func (s *Scheduler) ReleaseSnapshot(snapshotID string, proceed bool) bool {
+	for _, job := range s.jobs {
+		job.mu.Lock()
+		coord := job.snapshot
+		if coord == nil || coord.id != snapshotID {
+			job.mu.Unlock()
+			continue
+		}
+		if proceed {
+			select {
+			case <-coord.release:
+			default:
+				close(coord.release)
+			}
+		} else if job.cancel != nil {
+			job.cancelReason = "snapshot group cancelled by server"
+			job.cancel()
+		}
+		job.mu.Unlock()
+		return true
+	}
+	return false
+}
+
+// replySnapshot envia o ControlSnapshotReady ao server (nil-safe sem control channel).
+func (s *Scheduler) replySnapshot(snapshotID string, status byte, message string) {
+	if s.controlCh == nil {
+		return
+	}
+	if err := s.controlCh.SendSnapshotReady(snapshotID, status, message); err != nil {
+		s.logger.Warn("failed to send snapshot confirmation", "snapshot", snapshotID, "error", err)
+	}
+}
+
+// runWithSnapshot executa runFn envolto pela fase de snapshot do entry:
+// snapshot.command antes, cleanup_command depois (sempre, mesmo em falha ou
+// cancelamento). Em execuções coordenadas o resultado do snapshot é confirmado
+// ao server e a transferência só começa após o release.
+func (s *Scheduler) runWithSnapshot(ctx context.Context, job *BackupJob, entry config.BackupEntry, logger *slog.Logger, coord *snapshotCoordination, runFn runJobFunc) error {
+	snap := entry.Snapshot
+	if snap.Command == "" && coord == nil {
+		return runFn(ctx, s.cfg, entry, logger, job)
+	}
+
+	env := []string{"NBACKUP_BACKUP=" + entry.Name}
+	if coord != nil {
+		env = append(env, "NBACKUP_SNAPSHOT_ID="+coord.id)
+	}
+
+	if snap.Command != "" {
+		logger.Info("running snapshot command")
+		start := time.Now()
+		if err := runSnapshotCommand(ctx, snap.Command, snap.Timeout, env); err != nil {
+			if coord != nil {
+				s.replySnapshot(coord.id, protocol.SnapshotStatusFailed, err.Error())
+			}
+			return fmt.Errorf("snapshot command: %w", err)
+		}
+		logger.Info("snapshot command completed", "duration", time.Since(start).Round(time.Millisecond))
+	}
+	if snap.CleanupCommand != "" {
+		defer func() {
+			// Contexto próprio: o cleanup roda mesmo com a execução cancelada.
+			if err := runSnapshotCommand(context.Background(), snap.CleanupCommand, snap.Timeout, env); err != nil {
+				logger.Warn("snapshot cleanup command failed", "error", err)
+			}
+		}()
+	}
+
+	if coord != nil {
+		s.replySnapshot(coord.id, protocol.SnapshotStatusReady, "")
+		logger.Info("snapshot ready, waiting for group release", "snapshot", coord.id)
+
+		timer := time.NewTimer(snap.Timeout)
+		defer timer.Stop()
+		select {
+		case <-coord.release:
+			logger.Info("snapshot group released, starting transfer", "snapshot", coord.id)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return ErrSnapshotNotReleased
+		}
+	}
+
+	return runFn(ctx, s.cfg, entry, logger, job)
+}
+
+// runSnapshotCommand executa command via /bin/sh -c com timeout, acrescentando
+// env ao ambiente do daemon. A saída combinada (truncada) vai no erro.
+func runSnapshotCommand(ctx context.Context, command string, timeout time.Duration, env []string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		output := strings.TrimSpace(out.String())
+		if len(output) > maxSnapshotOutput {
+			output = output[:maxSnapshotOutput] + "..."
+		}
+		if output != "" {
+			return fmt.Errorf("%w: %s", err, output)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// ErrSourceMissing indica que um source obrigatório (required: true) não existe,
+// ou que nenhum source do entry existe. O backup falha antes de conectar ao
+// server e não é retentado.
+var ErrSourceMissing = errors.New("source path missing")
+
+// checkSources verifica a existência dos sources de um entry antes do backup.
+// Retorna o entry apenas com os sources presentes e a lista de sources
+// opcionais ausentes. Um source obrigatório ausente resulta em
+// ErrSourceMissing (todos os obrigatórios ausentes são listados).
+func checkSources(entry config.BackupEntry) (config.BackupEntry, []string, error) {
+	var present []config.BackupSource
+	var missingRequired, missingOptional []string
+
+	for _, src := range entry.Sources {
+		if _, err := os.Stat(src.Path); err != nil {
+			if src.IsRequired() {
+				missingRequired = append(missingRequired, src.Path)
+			} else {
+				missingOptional = append(missingOptional, src.Path)
+			}
+			continue
+		}
+		present = append(present, src)
+	}
+
+	if len(missingRequired) > 0 {
+		return entry, missingOptional, fmt.Errorf("%w: required: %s", ErrSourceMissing, strings.Join(missingRequired, ", "))
+	}
+	if len(present) == 0 {
+		return entry, missingOptional, fmt.Errorf("%w: no source available: %s", ErrSourceMissing, strings.Join(missingOptional, ", "))
+	}
+
+	entry.Sources = present
+	return entry, missingOptional, nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestCheckSources(t *testing.T) {
+	present := t.TempDir()
+	missing := filepath.Join(t.TempDir(), "unmounted")
+	optional := false
+
+	tests := []struct {
+		name        string
+		sources     []config.BackupSource
+		wantErr     bool
+		wantSources int
+		wantMissing []string
+	}{
+		{
+			name:        "all present",
+			sources:     []config.BackupSource{{Path: present}},
+			wantSources: 1,
+		},
+		{
+			name:    "required missing (default)",
+			sources: []config.BackupSource{{Path: present}, {Path: missing}},
+			wantErr: true,
+		},
+		{
+			name:        "optional missing",
+			sources:     []config.BackupSource{{Path: present}, {Path: missing, Required: &optional}},
+			wantSources: 1,
+			wantMissing: []string{missing},
+		},
+		{
+			name:        "all optional missing",
+			sources:     []config.BackupSource{{Path: missing, Required: &optional}},
+			wantErr:     true,
+			wantMissing: []string{missing},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, gotMissing, err := checkSources(config.BackupEntry{Name: "app", Sources: tt.sources})
+			if tt.wantErr {
+				if !errors.Is(err, ErrSourceMissing) {
+					t.Fatalf("expected ErrSourceMissing, got %v", err)
+				}
+				if !strings.Contains(err.Error(), missing) {
+					t.Errorf("error should name the missing path, got %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(entry.Sources) != tt.wantSources {
+					t.Errorf("expected %d sources, got %d", tt.wantSources, len(entry.Sources))
+				}
+			}
+			if strings.Join(gotMissing, ",") != strings.Join(tt.wantMissing, ",") {
+				t.Errorf("expected missing %v, got %v", tt.wantMissing, gotMissing)
+			}
+		})
+	}
+}
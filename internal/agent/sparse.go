@@ -0,0 +1,245 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Valores de whence do lseek(2) no Linux para navegar entre dados e buracos
+// de arquivos esparsos (não exportados pelo pacote syscall).
+const (
+	seekData = 3 // SEEK_DATA
+	seekHole = 4 // SEEK_HOLE
+)
+
+// sparseRegion é um fragmento com dados de um arquivo esparso.
+type sparseRegion struct {
+	Offset int64
+	Length int64
+}
+
+// sparseRegions retorna o mapa de dados de f se o arquivo for esparso, ou nil
+// se for denso (ou se o filesystem não suportar SEEK_DATA/SEEK_HOLE). Só
+// arquivos que ocupam menos blocos que o tamanho lógico são inspecionados.
+// Um buraco no fim do arquivo é registrado como fragmento vazio em size,
+// como faz o GNU tar.
+func sparseRegions(f *os.File, fi os.FileInfo) []sparseRegion {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	size := fi.Size()
+	if !ok || size == 0 || st.Blocks*512 >= size {
+		return nil
+	}
+
+	var regions []sparseRegion
+	var data int64
+	for off := int64(0); off < size; {
+		start, err := f.Seek(off, seekData)
+		if err != nil {
+			if errors.Is(err, syscall.ENXIO) {
+				break // só buraco até o fim
+			}
+			return nil
+		}
+		if start >= size {
+			break
+		}
+		end, err := f.Seek(start, seekHole)
+		if err != nil {
+			return nil
+		}
+		if end > size {
+			end = size
+		}
+		regions = append(regions, sparseRegion{Offset: start, Length: end - start})
+		data += end - start
+		off = end
+	}
+	if data == size {
+		return nil
+	}
+	if n := len(regions); n == 0 || regions[n-1].Offset+regions[n-1].Length < size {
+		regions = append(regions, sparseRegion{Offset: size})
+	}
+	return regions
+}
+
+// writeSparseFile grava f no formato GNU sparse 1.0 (PAX): o header estendido
+// leva o nome e o tamanho reais em registros GNU.sparse.*, e o conteúdo é o
+// mapa de fragmentos (texto, alinhado a 512 bytes) seguido apenas dos dados.
+// GNU tar e archive/tar extraem o arquivo com os buracos restaurados.
+//
+// archive/tar descarta registros GNU.sparse.* de Header.PAXRecords, então a
+// entrada inteira é escrita em raw, entre duas entradas do tw: os headers
+// gerados pelo archive/tar (em um writer descartável) recebem os registros
+// GNU.sparse.* no header estendido. Retorna handled=false, sem escrever
+// nada, se o archive/tar não conseguir representar o header.
+func writeSparseFile(tw *tar.Writer, raw io.Writer, hdr *tar.Header, f *os.File, regions []sparseRegion, copyBuf []byte) (handled bool, err error) {
+	var m strings.Builder
+	fmt.Fprintf(&m, "%d\n", len(regions))
+	var dataSize int64
+	for _, r := range regions {
+		fmt.Fprintf(&m, "%d\n%d\n", r.Offset, r.Length)
+		dataSize += r.Length
+	}
+	if pad := m.Len() % tarBlockSize; pad != 0 {
+		m.WriteString(strings.Repeat("\x00", tarBlockSize-pad))
+	}
+	sparseMap := m.String()
+
+	sparseHdr := *hdr
+	sparseHdr.Name = path.Join(path.Dir(hdr.Name), "GNUSparseFile.0", path.Base(hdr.Name))
+	sparseHdr.Size = int64(len(sparseMap)) + dataSize
+	sparseHdr.Format = tar.FormatPAX
+	var scratch bytes.Buffer
+	if err := tar.NewWriter(&scratch).WriteHeader(&sparseHdr); err != nil {
+		return false, nil
+	}
+	headers := scratch.Bytes()
+
+	// Mescla o header estendido gerado (se houver) com os registros do sparse.
+	// "path" é descartado: o nome real vai em GNU.sparse.name.
+	records := map[string]string{
+		"GNU.sparse.major":    "1",
+		"GNU.sparse.minor":    "0",
+		"GNU.sparse.name":     hdr.Name,
+		"GNU.sparse.realsize": strconv.FormatInt(hdr.Size, 10),
+	}
+	if headers[156] == tar.TypeXHeader {
+		size, err := strconv.ParseInt(strings.TrimRight(string(headers[124:136]), "\x00 "), 8, 64)
+		if err != nil {
+			return false, nil
+		}
+		for k, v := range parsePAXRecords(headers[tarBlockSize : tarBlockSize+size]) {
+			if _, ok := records[k]; !ok && k != "path" {
+				records[k] = v
+			}
+		}
+		headers = headers[tarBlockSize+blockAlign(size):]
+	}
+
+	// Completa o padding da entrada anterior antes de escrever em raw
+	if err := tw.Flush(); err != nil {
+		return true, fmt.Errorf("writing tar header for %s: %w", f.Name(), err)
+	}
+	if _, err := raw.Write(paxHeader(sparseHdr.Name, records)); err != nil {
+		return true, fmt.Errorf("writing tar header for %s: %w", f.Name(), err)
+	}
+	if _, err := raw.Write(headers); err != nil {
+		return true, fmt.Errorf("writing tar header for %s: %w", f.Name(), err)
+	}
+	if _, err := io.WriteString(raw, sparseMap); err != nil {
+		return true, fmt.Errorf("writing sparse map for %s: %w", f.Name(), err)
+	}
+	for _, r := range regions {
+		if r.Length == 0 {
+			continue
+		}
+		// Fora do tw não há checagem de tamanho: um fragmento que encolheu
+		// durante a leitura corromperia o archive.
+		n, err := io.CopyBuffer(raw, io.NewSectionReader(f, r.Offset, r.Length), copyBuf)
+		if err == nil && n != r.Length {
+			err = fmt.Errorf("file changed during backup (read %d of %d bytes at offset %d)", n, r.Length, r.Offset)
+		}
+		if err != nil {
+			return true, fmt.Errorf("writing file %s to tar: %w", f.Name(), err)
+		}
+	}
+	if _, err := raw.Write(make([]byte, blockAlign(dataSize)-dataSize)); err != nil {
+		return true, fmt.Errorf("writing file %s to tar: %w", f.Name(), err)
+	}
+	return true, nil
+}
+
+// blockAlign arredonda n para o múltiplo seguinte do bloco tar.
+func blockAlign(n int64) int64 {
+	return (n + tarBlockSize - 1) / tarBlockSize * tarBlockSize
+}
+
+// parsePAXRecords decodifica o corpo de um header estendido PAX
+// ("<len> <key>=<value>\n" por registro). Registros malformados encerram a
+// leitura.
+func parsePAXRecords(body []byte) map[string]string {
+	records := make(map[string]string)
+	for len(body) > 0 {
+		sp := bytes.IndexByte(body, ' ')
+		if sp <= 0 {
+			break
+		}
+		n, err := strconv.Atoi(string(body[:sp]))
+		if err != nil || n <= sp+1 || n > len(body) || body[n-1] != '\n' {
+			break
+		}
+		k, v, ok := strings.Cut(string(body[sp+1:n-1]), "=")
+		if !ok {
+			break
+		}
+		records[k] = v
+		body = body[n:]
+	}
+	return records
+}
+
+// tarBlockSize é o tamanho do bloco do formato tar.
+const tarBlockSize = 512
+
+// paxHeader codifica um header estendido PAX ('x') com records, já com o
+// padding do bloco, para a entrada name.
+func paxHeader(name string, records map[string]string) []byte {
+	keys := make([]string, 0, len(records))
+	for k := range records {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Cada record é "<len> <key>=<value>\n", onde len inclui os próprios dígitos
+	var body []byte
+	for _, k := range keys {
+		rec := " " + k + "=" + records[k] + "\n"
+		size := len(rec) + len(strconv.Itoa(len(rec)))
+		if len(strconv.Itoa(size)) > len(strconv.Itoa(len(rec))) {
+			size++
+		}
+		body = append(body, strconv.Itoa(size)+rec...)
+	}
+
+	blk := make([]byte, tarBlockSize)
+	extName := path.Join(path.Dir(name), "PaxHeaders.0", path.Base(name))
+	if len(extName) > 99 {
+		extName = extName[:99]
+	}
+	copy(blk[0:], extName)
+	copy(blk[100:], "0000644\x00")                       // mode
+	copy(blk[108:], "0000000\x00")                       // uid
+	copy(blk[116:], "0000000\x00")                       // gid
+	copy(blk[124:], fmt.Sprintf("%011o\x00", len(body))) // size
+	copy(blk[136:], "00000000000\x00")                   // mtime
+	blk[156] = tar.TypeXHeader
+	copy(blk[257:], "ustar\x0000")
+
+	// Checksum: soma dos bytes com o próprio campo preenchido por espaços
+	copy(blk[148:156], "        ")
+	sum := 0
+	for _, b := range blk {
+		sum += int(b)
+	}
+	copy(blk[148:], fmt.Sprintf("%06o\x00 ", sum))
+
+	out := append(blk, body...)
+	if pad := len(body) % tarBlockSize; pad != 0 {
+		out = append(out, make([]byte, tarBlockSize-pad)...)
+	}
+	return out
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// scheduleStateFile é o nome do arquivo de estado de execuções dentro de daemon.state_dir.
+const scheduleStateFile = "schedule-state.json"
+
+// maxJobHistory é o número de execuções mantidas no histórico de cada entry.
+const maxJobHistory = 20
+
+// JobRun descreve uma execução de um backup entry.
+type JobRun struct {
+	Start           time.Time `json:"start"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Bytes           int64     `json:"bytes,omitempty"`
+	Status          string    `json:"status"`          // "completed", "failed", "deferred"
+	Empty           bool      `json:"empty,omitempty"` // backup concluído sem nenhuma entrada (archive vazio)
+	Error           string    `json:"error,omitempty"`
+
+	// MissingSources lista os sources opcionais (required: false) ausentes nesta execução.
+	MissingSources []string `json:"missing_sources,omitempty"`
+
+	// Snapshot da configuração efetiva do entry nesta execução.
+	ConfigHash    string               `json:"config_hash,omitempty"`
+	Config        *EntryConfigSnapshot `json:"config,omitempty"`
+	ConfigChanges []string             `json:"config_changes,omitempty"` // diff contra a execução anterior (preenchido por Record)
+}
+
+// End retorna o instante de término da execução.
+func (r JobRun) End() time.Time {
+	return r.Start.Add(time.Duration(r.DurationSeconds * float64(time.Second)))
+}
+
+// JobRunState é o estado persistido de um backup entry entre reinícios do agent.
+type JobRunState struct {
+	LastAttempt time.Time `json:"last_attempt"`
+	LastStatus  string    `json:"last_status"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	History     []JobRun  `json:"history,omitempty"` // mais recente primeiro, até maxJobHistory
+}
+
+// ScheduleState persiste localmente o histórico de execuções de cada entry.
+// É usado pelo catch-up, pelo min_interval e pelo comando `nbackup-agent status`.
+// Todos os métodos são nil-safe.
+type ScheduleState struct {
+	mu   sync.Mutex
+	path string
+	jobs map[string]JobRunState
+}
+
+// LoadScheduleState carrega o estado de stateDir. Arquivo ausente resulta em estado vazio.
+// Um arquivo corrompido é descartado (retorna estado vazio + erro para log).
+// stateDir vazio desabilita a persistência (retorna nil).
+func LoadScheduleState(stateDir string) (*ScheduleState, error) {
+	if stateDir == "" {
+		return nil, nil
+	}
+	s := &ScheduleState{
+		path: filepath.Join(stateDir, scheduleStateFile),
+		jobs: make(map[string]JobRunState),
+	}
+
+	_, err := statefile.ReadDocument(s.path, &s.jobs)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		s.jobs = make(map[string]JobRunState)
+		return s, fmt.Errorf("reading schedule state %s: %w", s.path, err)
+	}
+	return s, nil
+}
+
+// Get retorna o estado de um entry (ok=false se nunca executou).
+func (s *ScheduleState) Get(name string) (JobRunState, bool) {
+	if s == nil {
+		return JobRunState{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.jobs[name]
+	return st, ok
+}
+
+// MinIntervalRemaining retorna quanto falta para o min_interval do entry expirar,
+// contado a partir do último sucesso. Retorna 0 quando a execução está liberada.
+func (s *ScheduleState) MinIntervalRemaining(entry config.BackupEntry, now time.Time) time.Duration {
+	if entry.MinInterval <= 0 {
+		return 0
+	}
+	st, ok := s.Get(entry.Name)
+	if !ok || st.LastSuccess.IsZero() {
+		return 0
+	}
+	if elapsed := now.Sub(st.LastSuccess); elapsed < entry.MinInterval {
+		return entry.MinInterval - elapsed
+	}
+	return 0
+}
+
+// Snapshot retorna uma cópia do estado de todos os entries.
+func (s *ScheduleState) Snapshot() map[string]JobRunState {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]JobRunState, len(s.jobs))
+	for name, st := range s.jobs {
+		st.History = append([]JobRun(nil), st.History...)
+		out[name] = st
+	}
+	return out
+}
+
+// Record registra uma execução no histórico do entry e persiste o arquivo.
+func (s *ScheduleState) Record(name string, run JobRun) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.jobs[name]
+	if run.Config != nil {
+		run.ConfigHash = config.SnapshotHash(run.Config)
+		if len(st.History) > 0 && st.History[0].Config != nil && st.History[0].ConfigHash != run.ConfigHash {
+			run.ConfigChanges = config.SnapshotDiff(st.History[0].Config, run.Config)
+		}
+	}
+	st.LastAttempt = run.End()
+	st.LastStatus = run.Status
+	if run.Status == "completed" {
+		st.LastSuccess = run.End()
+	}
+	st.History = append([]JobRun{run}, st.History...)
+	if len(st.History) > maxJobHistory {
+		st.History = st.History[:maxJobHistory]
+	}
+	s.jobs[name] = st
+	return s.saveLocked()
+}
+
+// saveLocked grava o estado de forma atômica (statefile: tmp + fsync + rename).
+// Deve ser chamado com mu travado.
+func (s *ScheduleState) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("creating state dir: %w", err)
+	}
+	if err := statefile.WriteDocument(s.path, s.jobs, 0644); err != nil {
+		return fmt.Errorf("writing schedule state: %w", err)
+	}
+	return nil
+}
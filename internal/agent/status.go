@@ -0,0 +1,150 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/robfig/cron/v3"
+)
+
+// EntryStatus é a visão de um backup entry exibida por `nbackup-agent status`.
+type EntryStatus struct {
+	Name        string    `json:"name"`
+	Storage     string    `json:"storage"`
+	Schedule    string    `json:"schedule"`
+	LastRun     *JobRun   `json:"last_run,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	NextRun     time.Time `json:"next_run,omitzero"`
+	History     []JobRun  `json:"history,omitempty"`
+
+	// Running é preenchido apenas pelo daemon (via admin socket) quando o entry está em execução.
+	Running *RunningStatus `json:"running,omitempty"`
+	// QueuePosition é a posição do entry na fila de max_concurrent_backups
+	// (1 = próximo a executar), preenchida pelo daemon enquanto aguarda vaga.
+	QueuePosition int `json:"queue_position,omitempty"`
+}
+
+// RunningStatus descreve a execução em andamento de um entry.
+type RunningStatus struct {
+	Since         time.Time `json:"since"`
+	BytesSent     int64     `json:"bytes_sent"`
+	ThroughputBps float64   `json:"throughput_bps"` // média desde o início da execução
+	ActiveStreams int32     `json:"active_streams"`
+}
+
+// BuildStatus combina os entries configurados com o histórico persistido em state.
+// Entries que nunca executaram aparecem sem LastRun.
+func BuildStatus(cfg *config.AgentConfig, state *ScheduleState, now time.Time) []EntryStatus {
+	snapshot := state.Snapshot()
+
+	out := make([]EntryStatus, 0, len(cfg.Backups))
+	for _, entry := range cfg.Backups {
+		es := EntryStatus{
+			Name:     entry.Name,
+			Storage:  entry.Storage,
+			Schedule: entry.Schedule,
+		}
+		if sched, err := cron.ParseStandard(entry.Schedule); err == nil {
+			es.NextRun = sched.Next(now)
+		}
+		if st, ok := snapshot[entry.Name]; ok {
+			es.LastSuccess = st.LastSuccess
+			es.History = st.History
+			if len(st.History) > 0 {
+				last := st.History[0]
+				es.LastRun = &last
+			}
+		}
+		out = append(out, es)
+	}
+	return out
+}
+
+// WriteStatusJSON escreve o status em JSON indentado.
+func WriteStatusJSON(w io.Writer, entries []EntryStatus) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// WriteStatusTable escreve o status em formato de tabela, seguido dos erros
+// das últimas execuções que falharam e das mudanças de config detectadas.
+func WriteStatusTable(w io.Writer, entries []EntryStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BACKUP\tSTORAGE\tRESULT\tSTARTED\tDURATION\tSIZE\tCONFIG\tLAST SUCCESS\tNEXT RUN")
+
+	for _, es := range entries {
+		result, started, duration, size, cfgHash := "never", "-", "-", "-", "-"
+		if es.LastRun != nil {
+			if es.LastRun.ConfigHash != "" {
+				cfgHash = es.LastRun.ConfigHash
+				if len(es.LastRun.ConfigChanges) > 0 {
+					cfgHash += "*"
+				}
+			}
+			result = es.LastRun.Status
+			if len(es.LastRun.MissingSources) > 0 {
+				result += " (partial)"
+			}
+			if es.LastRun.Empty {
+				result += " (empty)"
+			}
+			started = formatStatusTime(es.LastRun.Start)
+			duration = formatDuration(time.Duration(es.LastRun.DurationSeconds * float64(time.Second)))
+			if es.LastRun.Bytes > 0 {
+				size = formatBytes(es.LastRun.Bytes)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			es.Name, es.Storage, result, started, duration, size, cfgHash,
+			formatStatusTime(es.LastSuccess), formatStatusTime(es.NextRun))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, es := range entries {
+		if es.QueuePosition > 0 {
+			fmt.Fprintf(w, "\n%s: waiting for a backup slot (position %d)\n", es.Name, es.QueuePosition)
+		}
+		if es.Running != nil {
+			fmt.Fprintf(w, "\n%s: running since %s, %s sent (%s/s, %d streams)\n",
+				es.Name, formatStatusTime(es.Running.Since), formatBytes(es.Running.BytesSent),
+				formatBytes(int64(es.Running.ThroughputBps)), es.Running.ActiveStreams)
+		}
+		if es.LastRun == nil {
+			continue
+		}
+		if es.LastRun.Error != "" {
+			fmt.Fprintf(w, "\n%s: %s\n", es.Name, es.LastRun.Error)
+		}
+		if len(es.LastRun.MissingSources) > 0 {
+			fmt.Fprintf(w, "\n%s: optional sources missing (not in archive):\n", es.Name)
+			for _, path := range es.LastRun.MissingSources {
+				fmt.Fprintf(w, "  %s\n", path)
+			}
+		}
+		if len(es.LastRun.ConfigChanges) > 0 {
+			fmt.Fprintf(w, "\n%s: config changed since previous run (*):\n", es.Name)
+			for _, change := range es.LastRun.ConfigChanges {
+				fmt.Fprintf(w, "  %s\n", change)
+			}
+		}
+	}
+	return nil
+}
+
+func formatStatusTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
@@ -7,17 +7,22 @@ package agent
 import (
 	"archive/tar"
 	"bufio"
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
 	"os"
-	"runtime"
+	"sync"
+	"syscall"
 
 	"github.com/klauspost/compress/zstd"
 	"github.com/klauspost/pgzip"
 
+	"github.com/nishisan-dev/n-backup/internal/manifest"
 	"github.com/nishisan-dev/n-backup/internal/protocol"
 )
 
@@ -25,10 +30,23 @@ import (
 // de upload para reduzir syscalls e melhorar throughput sustentado.
 const streamIOBufferSize = 1 * 1024 * 1024 // 1MB
 
+// copyBufPool reaproveita entre arquivos os buffers de leitura de
+// streamIOBufferSize, em vez de alocar um por arquivo.
+var copyBufPool = sync.Pool{New: func() any {
+	b := make([]byte, streamIOBufferSize)
+	return &b
+}}
+
+// checkpointInterval é o volume de tar (antes da compressão) entre dois
+// checkpoints de compressão quando o backup leva manifest de arquivos.
+var checkpointInterval int64 = 64 * 1024 * 1024 // 64MB
+
 // StreamResult contém o resultado de uma operação de streaming.
 type StreamResult struct {
 	Checksum [32]byte
 	Size     uint64
+	Entries  int64 // entradas gravadas no tar (0 = backup vazio, Size 0)
+	Bytes    int64 // soma do tamanho dos arquivos regulares, antes da compressão
 }
 
 // Stream executa o pipeline de streaming zero-copy:
@@ -36,8 +54,22 @@ type StreamResult struct {
 // O SHA-256 é calculado inline sobre o stream compactado.
 // Se progress não for nil, alimenta contadores de bytes e objetos.
 // Se onObject não for nil, é chamado após cada objeto processado (usado para contadores externos).
+// Com maxSize > 0, o stream é abortado com ErrMaxSizeExceeded assim que o
+// archive compactado passaria desse tamanho.
+// Se mf não for nil, cada entrada gravada no tar é registrada no manifest de
+// arquivos (com o SHA-256 do conteúdo dos arquivos regulares) e o compressor é
+// reiniciado a cada checkpointInterval bytes de tar, sempre entre duas
+// entradas: o archive vira uma sequência de membros gzip (ou frames zstd) que
+// o server consegue descomprimir a partir do meio (restore de arquivos).
+// Arquivos já comprimidos (ver Compression) vão em membros sem compressão,
+// abertos e fechados também entre duas entradas.
+// Com scanner.shards > 1, ver streamShards.
 // Retorna o checksum e total de bytes escritos no destino.
-func Stream(ctx context.Context, scanner *Scanner, dest io.Writer, progress *ProgressReporter, onObject func(), compressionMode byte, bandwidthLimit int64) (*StreamResult, error) {
+//
+// tar e compressor só são criados na primeira entrada: sources sem nenhuma
+// entrada produzem um payload vazio (Size 0, checksum protocol.EmptyChecksum),
+// que o server reconhece como backup vazio.
+func Stream(ctx context.Context, scanner *Scanner, dest io.Writer, progress *ProgressReporter, onObject func(), comp Compression, bandwidthLimit, maxSize int64, mf *manifest.Writer) (*StreamResult, error) {
 	// Buffer de escrita para reduzir syscalls na conexão TLS
 	bufDest := bufio.NewWriterSize(dest, streamIOBufferSize)
 
@@ -48,26 +80,47 @@ func Stream(ctx context.Context, scanner *Scanner, dest io.Writer, progress *Pro
 	hasher := sha256.New()
 	counter := &countWriter{w: io.MultiWriter(throttled, hasher), progress: progress}
 
-	// Cria compressor com base no modo negociado
-	compressor, err := newCompressor(counter, compressionMode)
-	if err != nil {
-		return nil, err
+	// Teto de tamanho do archive (max_size): acompanha os maiores arquivos e a
+	// entrada corrente para o diagnóstico do abort
+	var capped *maxSizeWriter
+	if maxSize > 0 {
+		capped = &maxSizeWriter{w: counter.w, limit: maxSize}
+		counter.w = capped
 	}
+	st := &streamStats{}
 
-	tw := tar.NewWriter(compressor)
+	// maxSizeErr substitui err pelo diagnóstico do max_size se o teto foi atingido.
+	maxSizeErr := func(err error) error {
+		if capped == nil || !capped.exceeded.Load() {
+			return err
+		}
+		return &maxSizeError{
+			limit:       maxSize,
+			written:     capped.n.Load(),
+			sourceBytes: st.sourceBytes,
+			objects:     st.entries,
+			path:        st.current,
+			largest:     st.largest,
+		}
+	}
 
-	// Itera sobre os arquivos via scanner
-	scanErr := scanner.Scan(ctx, func(entry FileEntry) error {
+	// add grava entry com o producer p e atualiza os contadores
+	add := func(p *tarProducer, entry FileEntry) error {
 		// Verifica cancelamento
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
-
-		if err := addToTar(tw, entry); err != nil {
+		// O compressor pode ter recusado a escrita em background
+		if capped != nil && capped.exceeded.Load() {
+			return ErrMaxSizeExceeded
+		}
+		st.begin(entry, capped != nil)
+		if err := p.add(entry); err != nil {
 			return err
 		}
+		st.done(entry)
 		if progress != nil {
 			progress.AddObject()
 		}
@@ -75,28 +128,32 @@ func Stream(ctx context.Context, scanner *Scanner, dest io.Writer, progress *Pro
 			onObject()
 		}
 		return nil
-	})
-
-	if scanErr != nil {
-		tw.Close()
-		compressor.Close()
-		return nil, fmt.Errorf("scanning files: %w", scanErr)
-	}
-
-	// Fecha o tar writer (escreve os trailers)
-	if err := tw.Close(); err != nil {
-		compressor.Close()
-		return nil, fmt.Errorf("closing tar writer: %w", err)
 	}
 
-	// Fecha o compressor (flush + trailer)
-	if err := compressor.Close(); err != nil {
-		return nil, fmt.Errorf("closing compressor: %w", err)
+	if scanner.shards > 1 {
+		if err := streamShards(ctx, scanner, counter, comp, mf, progress, add); err != nil {
+			return nil, maxSizeErr(err)
+		}
+	} else {
+		// Compressor (modo negociado) e tar writer, criados na primeira entrada
+		p := newTarProducer(counter, comp, mf)
+		p.progress = progress
+		if mf != nil {
+			p.cut = checkpointInterval
+		}
+		if err := scanner.Scan(ctx, func(entry FileEntry) error { return add(p, entry) }); err != nil {
+			p.abort()
+			return nil, maxSizeErr(fmt.Errorf("scanning files: %w", err))
+		}
+		st.current = ""
+		if err := p.close(); err != nil {
+			return nil, maxSizeErr(err)
+		}
 	}
 
 	// Flush do buffer para a conexão
 	if err := bufDest.Flush(); err != nil {
-		return nil, fmt.Errorf("flushing buffer: %w", err)
+		return nil, maxSizeErr(fmt.Errorf("flushing buffer: %w", err))
 	}
 
 	var checksum [32]byte
@@ -105,33 +162,345 @@ func Stream(ctx context.Context, scanner *Scanner, dest io.Writer, progress *Pro
 	return &StreamResult{
 		Checksum: checksum,
 		Size:     counter.n,
+		Entries:  st.entries,
+		Bytes:    st.sourceBytes,
 	}, nil
 }
 
-// newCompressor cria um io.WriteCloser para compressão com base no mode.
-func newCompressor(w io.Writer, mode byte) (io.WriteCloser, error) {
-	switch mode {
+// streamStats acumula os contadores do Stream, compartilhados pelos producers.
+type streamStats struct {
+	mu          sync.Mutex
+	entries     int64
+	sourceBytes int64
+	current     string // entrada sendo gravada (diagnóstico do max_size)
+	largest     largestFiles
+}
+
+// begin registra entry como a entrada corrente; com track, acompanha também
+// os maiores arquivos.
+func (st *streamStats) begin(entry FileEntry, track bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.current = entry.Path
+	if track && entry.Info.Mode().IsRegular() {
+		st.largest.add(entry.Path, entry.Info.Size())
+	}
+}
+
+// done contabiliza entry, já gravada no tar.
+func (st *streamStats) done(entry FileEntry) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.entries++
+	if entry.Info.Mode().IsRegular() {
+		st.sourceBytes += entry.Info.Size()
+	}
+}
+
+// Segmentos dos producers com producer_shards: shardSegmentSize é o volume de
+// tar (antes da compressão) de cada segmento e shardSegmentLimit o máximo de
+// archive comprimido que um segmento acumula em memória; acima disso (um
+// arquivo grande) o segmento segue direto para o destino, com os demais
+// producers aguardando o fim dele.
+const (
+	shardSegmentSize  = 8 * 1024 * 1024  // 8MB
+	shardSegmentLimit = 16 * 1024 * 1024 // 16MB
+)
+
+// streamShards grava o archive com scanner.shards producers em paralelo:
+// cada partição do scanner (ver Scanner.split) alimenta seu próprio tar e
+// compressor, e o archive comprimido de cada um é gravado em out em
+// segmentos inteiros, sempre entre duas entradas. Como membros gzip (e frames
+// zstd) concatenados formam um único stream, out continua sendo um tar
+// comprimido comum: os tars das partições não têm trailer, gravado ao final
+// em um membro próprio. Hardlinks entre partições diferentes viram cópias.
+func streamShards(ctx context.Context, scanner *Scanner, out io.Writer, comp Compression, mf *manifest.Writer, progress *ProgressReporter, add func(*tarProducer, FileEntry) error) error {
+	parts := scanner.split()
+	defer scanner.mergeRequired(parts)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Os workers de compressão são divididos entre os producers
+	comp.Workers = max(1, comp.workers()/len(parts))
+
+	var mu sync.Mutex // um segmento por vez em out
+	producers := make([]*tarProducer, len(parts))
+	errs := make([]error, len(parts))
+	var wg sync.WaitGroup
+	for i, part := range parts {
+		seg := &segmentWriter{out: out, mu: &mu}
+		p := newTarProducer(seg, comp, mf)
+		p.cut, p.onCut = shardSegmentSize, seg.flush
+		p.progress = progress
+		producers[i] = p
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := part.Scan(ctx, func(entry FileEntry) error { return add(p, entry) })
+			if err != nil {
+				p.abort()
+				err = fmt.Errorf("scanning files: %w", err)
+			} else {
+				err = p.endMember()
+			}
+			if err != nil {
+				seg.release()
+				cancel() // interrompe os demais producers
+				errs[i] = err
+			}
+		}()
+	}
+	wg.Wait()
+
+	// O erro de origem prevalece sobre o cancelamento dos demais producers
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	// Trailer do tar, se alguma partição gravou entradas
+	for _, p := range producers {
+		if p.tw != nil {
+			return writeTarTrailer(out, comp)
+		}
+	}
+	return nil
+}
+
+// writeTarTrailer grava o fim do tar (dois blocos zerados) em um membro próprio.
+func writeTarTrailer(w io.Writer, comp Compression) error {
+	c, err := newCompressor(w, comp, false)
+	if err != nil {
+		return err
+	}
+	if err := tar.NewWriter(c).Close(); err != nil {
+		c.Close()
+		return fmt.Errorf("closing tar writer: %w", err)
+	}
+	if err := c.Close(); err != nil {
+		return fmt.Errorf("closing compressor: %w", err)
+	}
+	return nil
+}
+
+// segmentWriter acumula o archive comprimido de um producer até o fim do
+// segmento (flush) e o grava de uma vez em out, sob mu. Um segmento maior que
+// shardSegmentLimit passa a ser gravado direto, com mu retido até o flush.
+type segmentWriter struct {
+	out    io.Writer
+	mu     *sync.Mutex
+	buf    bytes.Buffer
+	locked bool
+}
+
+func (s *segmentWriter) Write(p []byte) (int, error) {
+	if !s.locked {
+		if s.buf.Len()+len(p) <= shardSegmentLimit {
+			return s.buf.Write(p)
+		}
+		s.mu.Lock()
+		s.locked = true
+		_, err := s.out.Write(s.buf.Bytes())
+		s.buf.Reset()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return s.out.Write(p)
+}
+
+// flush grava o segmento corrente e libera out para os demais producers.
+func (s *segmentWriter) flush() error {
+	if !s.locked {
+		if s.buf.Len() == 0 {
+			return nil
+		}
+		s.mu.Lock()
+	}
+	_, err := s.out.Write(s.buf.Bytes())
+	s.buf.Reset()
+	s.locked = false
+	s.mu.Unlock()
+	return err
+}
+
+// release descarta o segmento corrente e libera out (abort do producer).
+func (s *segmentWriter) release() {
+	s.buf.Reset()
+	if s.locked {
+		s.locked = false
+		s.mu.Unlock()
+	}
+}
+
+// tarProducer grava entradas em um tar comprimido sobre out. O compressor é
+// reiniciado (novo membro gzip ou frame zstd) a cada cut bytes de tar e
+// quando a entrada alterna entre comprimida e raw, sempre entre duas entradas.
+type tarProducer struct {
+	out   io.Writer
+	comp  Compression
+	mf    *manifest.Writer
+	cut   int64        // bytes de tar por membro (0 = sem limite)
+	onCut func() error // chamado a cada membro fechado (fim de segmento)
+
+	progress *ProgressReporter // recebe os bytes de tar (opcional)
+
+	// Compressor (modo negociado) e tar writer, criados na primeira entrada
+	compressor io.WriteCloser
+	tw         *tar.Writer
+	sw         *switchWriter
+	memberRaw  bool
+	links      map[fileID]string
+}
+
+func newTarProducer(out io.Writer, comp Compression, mf *manifest.Writer) *tarProducer {
+	return &tarProducer{out: out, comp: comp, mf: mf, links: make(map[fileID]string)}
+}
+
+// add grava entry no tar, abrindo um membro novo se necessário.
+func (p *tarProducer) add(entry FileEntry) error {
+	if raw := p.comp.storeRaw(entry); p.tw == nil || raw != p.memberRaw {
+		if err := p.newMember(raw); err != nil {
+			return err
+		}
+	}
+	if err := addToTar(p.tw, p.sw, entry, p.links, p.mf); err != nil {
+		return err
+	}
+	if p.cut > 0 && p.sw.n >= p.cut {
+		// Checkpoint: fecha o membro na fronteira da entrada
+		return p.newMember(p.memberRaw)
+	}
+	return nil
+}
+
+// newMember fecha o membro corrente e abre outro, comprimido ou raw.
+func (p *tarProducer) newMember(raw bool) error {
+	if err := p.endMember(); err != nil {
+		return err
+	}
+	c, err := newCompressor(p.out, p.comp, raw)
+	if err != nil {
+		return err
+	}
+	p.compressor, p.memberRaw = c, raw
+	if p.sw == nil {
+		p.sw = &switchWriter{w: c, progress: p.progress}
+		p.tw = tar.NewWriter(p.sw)
+	} else {
+		p.sw.w, p.sw.n = c, 0
+	}
+	return nil
+}
+
+// endMember fecha o membro corrente, completando o padding da última entrada
+// (sem o trailer do tar). No-op antes da primeira entrada.
+func (p *tarProducer) endMember() error {
+	if p.tw == nil {
+		return nil
+	}
+	if err := p.tw.Flush(); err != nil {
+		return fmt.Errorf("flushing tar writer: %w", err)
+	}
+	if err := p.compressor.Close(); err != nil {
+		return fmt.Errorf("closing compressor: %w", err)
+	}
+	if p.onCut != nil {
+		return p.onCut()
+	}
+	return nil
+}
+
+// close grava o trailer do tar e fecha o compressor. No-op sem entradas.
+func (p *tarProducer) close() error {
+	if p.tw == nil {
+		return nil
+	}
+	if err := p.tw.Close(); err != nil {
+		p.compressor.Close()
+		return fmt.Errorf("closing tar writer: %w", err)
+	}
+	if err := p.compressor.Close(); err != nil {
+		return fmt.Errorf("closing compressor: %w", err)
+	}
+	return nil
+}
+
+// abort fecha tar e compressor ignorando erros (stream interrompido).
+func (p *tarProducer) abort() {
+	if p.tw != nil {
+		p.tw.Close()
+		p.compressor.Close()
+	}
+}
+
+// newCompressor cria um io.WriteCloser para compressão com base em comp.
+// Com raw, o membro é gravado sem compressão (gzip stored ou frame zstd raw).
+func newCompressor(w io.Writer, comp Compression, raw bool) (io.WriteCloser, error) {
+	switch comp.Mode {
 	case protocol.CompressionZstd:
+		if raw {
+			return newRawZstdWriter(w), nil
+		}
+		level := zstd.SpeedDefault
+		if comp.Level > 0 {
+			level = zstd.EncoderLevelFromZstd(comp.Level)
+		}
 		return zstd.NewWriter(w,
-			zstd.WithEncoderLevel(zstd.SpeedDefault),
-			zstd.WithEncoderConcurrency(runtime.GOMAXPROCS(0)),
+			zstd.WithEncoderLevel(level),
+			zstd.WithEncoderConcurrency(comp.workers()),
 		)
 	default: // CompressionGzip
-		gzWriter, err := pgzip.NewWriterLevel(w, pgzip.BestSpeed)
+		if raw {
+			return newRawGzipWriter(w), nil
+		}
+		level := pgzip.BestSpeed
+		if comp.Level > 0 {
+			level = comp.Level
+		}
+		gzWriter, err := pgzip.NewWriterLevel(w, level)
 		if err != nil {
 			return nil, fmt.Errorf("creating gzip writer: %w", err)
 		}
-		if err := gzWriter.SetConcurrency(1<<20, runtime.GOMAXPROCS(0)); err != nil {
+		if err := gzWriter.SetConcurrency(1<<20, comp.workers()); err != nil {
 			return nil, fmt.Errorf("configuring gzip concurrency: %w", err)
 		}
 		return gzWriter, nil
 	}
 }
 
+// fileID identifica um inode (device + número do inode) para detectar hardlinks.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// hardlinkID retorna o fileID de fi se o arquivo tiver mais de um link.
+func hardlinkID(fi os.FileInfo) (fileID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: st.Ino}, true
+}
+
 // addToTar adiciona um arquivo ou diretório ao tar archive.
 // Para arquivos regulares, usa stat do fd aberto + LimitReader para evitar
 // "write too long" em arquivos que crescem durante o backup (ex: logs ativos).
-func addToTar(tw *tar.Writer, entry FileEntry) error {
+// raw é o writer subjacente ao tw, usado para os headers que archive/tar não
+// gera (ver writeSparseFile). links mapeia os inodes com múltiplos links já gravados para o nome da
+// primeira ocorrência: as demais viram entradas de hardlink, sem conteúdo.
+// Arquivos esparsos são gravados apenas com os fragmentos de dados.
+// Se mf não for nil, a entrada gravada é registrada no manifest.
+func addToTar(tw *tar.Writer, raw io.Writer, entry FileEntry, links map[fileID]string, mf *manifest.Writer) error {
 	// Trata symlinks
 	link := ""
 	if entry.Info.Mode()&os.ModeSymlink != 0 {
@@ -162,19 +531,58 @@ func addToTar(tw *tar.Writer, entry FileEntry) error {
 			return fmt.Errorf("creating tar header for %s: %w", entry.Path, err)
 		}
 		header.Name = entry.RelPath
+		header.PAXRecords = entry.PAXRecords
+
+		id, linked := hardlinkID(fi)
+		if linked {
+			if first, seen := links[id]; seen {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = first
+				header.Size = 0
+				header.PAXRecords = nil // metadados já gravados na primeira ocorrência
+				if err := tw.WriteHeader(header); err != nil {
+					return fmt.Errorf("writing tar header for %s: %w", entry.Path, err)
+				}
+				return addToManifest(mf, header, nil)
+			}
+			links[id] = entry.RelPath
+		}
+
+		// CopyBuffer evita o buffer interno pequeno do io.Copy no hot path.
+		bufp := copyBufPool.Get().(*[]byte)
+		defer copyBufPool.Put(bufp)
+		copyBuf := *bufp
+		if regions := sparseRegions(f, fi); regions != nil {
+			if handled, err := writeSparseFile(tw, raw, header, f, regions, copyBuf); handled {
+				if err != nil || mf == nil {
+					return err
+				}
+				// Os buracos não passam pelo tar: o hash relê o arquivo
+				// (buracos são lidos como zeros, sem I/O de disco)
+				sum := sha256.New()
+				if _, err := io.CopyBuffer(sum, io.NewSectionReader(f, 0, header.Size), copyBuf); err != nil {
+					return fmt.Errorf("hashing file %s: %w", entry.Path, err)
+				}
+				return addToManifest(mf, header, sum)
+			}
+		}
 
 		if err := tw.WriteHeader(header); err != nil {
 			return fmt.Errorf("writing tar header for %s: %w", entry.Path, err)
 		}
 
 		// LimitReader garante que nunca escrevemos mais que o declarado no header.
-		// CopyBuffer evita o buffer interno pequeno do io.Copy no hot path.
-		copyBuf := make([]byte, streamIOBufferSize)
-		if _, err := io.CopyBuffer(tw, io.LimitReader(f, fi.Size()), copyBuf); err != nil {
+		var dst io.Writer = tw
+		var sum hash.Hash
+		if mf != nil {
+			sum = sha256.New()
+			dst = io.MultiWriter(tw, sum)
+		}
+		if _, err := io.CopyBuffer(dst, io.LimitReader(f, fi.Size()), copyBuf); err != nil {
 			return fmt.Errorf("writing file %s to tar: %w", entry.Path, err)
 		}
 
-		return nil
+		return addToManifest(mf, header, sum)
 	}
 
 	// Diretórios e symlinks
@@ -183,12 +591,62 @@ func addToTar(tw *tar.Writer, entry FileEntry) error {
 		return fmt.Errorf("creating tar header for %s: %w", entry.Path, err)
 	}
 	header.Name = entry.RelPath
+	header.PAXRecords = entry.PAXRecords
 
 	if err := tw.WriteHeader(header); err != nil {
 		return fmt.Errorf("writing tar header for %s: %w", entry.Path, err)
 	}
 
-	return nil
+	return addToManifest(mf, header, nil)
+}
+
+// addToManifest registra no manifest a entrada gravada com header; sum é o
+// hash do conteúdo (nil para entradas sem conteúdo). No-op se mf for nil.
+func addToManifest(mf *manifest.Writer, header *tar.Header, sum hash.Hash) error {
+	if mf == nil {
+		return nil
+	}
+	e := manifest.Entry{
+		Path:  header.Name,
+		Size:  header.Size,
+		MTime: header.ModTime.UTC(),
+		Mode:  fmt.Sprintf("%04o", header.Mode&07777),
+		Link:  header.Linkname,
+	}
+	switch header.Typeflag {
+	case tar.TypeReg:
+		e.Type = manifest.TypeFile
+	case tar.TypeDir:
+		e.Type = manifest.TypeDir
+	case tar.TypeSymlink:
+		e.Type = manifest.TypeSymlink
+	case tar.TypeLink:
+		e.Type = manifest.TypeHardlink
+	default:
+		e.Type = manifest.TypeOther
+	}
+	if sum != nil {
+		e.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	}
+	return mf.Add(e)
+}
+
+// switchWriter repassa as escritas do tar para o compressor corrente, que é
+// trocado a cada checkpoint. n conta os bytes desde o último checkpoint e
+// alimenta o progress reporter (bytes raw) se houver.
+type switchWriter struct {
+	w        io.Writer
+	n        int64
+	progress *ProgressReporter
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.n += int64(n)
+	if s.progress != nil {
+		s.progress.AddRawBytes(int64(n))
+	}
+	return n, err
 }
 
 // countWriter conta os bytes escritos e opcionalmente alimenta o progress reporter.
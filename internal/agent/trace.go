@@ -0,0 +1,52 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"net"
+	"slices"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// traceConn envolve conn em um protocol.TraceConn quando
+// logging.protocol_trace_dir está configurado e o backup (entry vazio = control
+// channel) passa pelo filtro logging.protocol_trace_only. Sem trace, retorna conn.
+func traceConn(cfg *config.AgentConfig, entry config.BackupEntry, conn net.Conn, label string) net.Conn {
+	dir := cfg.Logging.ProtocolTraceDir
+	if dir == "" {
+		return conn
+	}
+	if only := cfg.Logging.ProtocolTraceOnly; len(only) > 0 && !slices.Contains(only, entry.Name) {
+		return conn
+	}
+	return protocol.NewTraceConn(conn, dir, protocol.TraceInfo{
+		Side:    "agent",
+		Version: Version,
+		Conn:    label,
+		Agent:   cfg.Agent.Name,
+		Storage: entry.Storage,
+		Backup:  entry.Name,
+	})
+}
+
+// traceIdentify grava o trace em disco a partir do momento em que a sessão
+// é conhecida. Falhas ao criar o arquivo apenas desabilitam o trace.
+func traceIdentify(conn net.Conn, sessionID string) {
+	if tc, ok := conn.(*protocol.TraceConn); ok {
+		tc.Identify(protocol.TraceInfo{Session: sessionID})
+	}
+}
+
+// traceSessionConn retorna o hook DispatcherConfig.Trace para os streams de
+// uma sessão paralela.
+func traceSessionConn(cfg *config.AgentConfig, entry config.BackupEntry, sessionID string) func(net.Conn, string) net.Conn {
+	return func(conn net.Conn, label string) net.Conn {
+		conn = traceConn(cfg, entry, conn, label)
+		traceIdentify(conn, sessionID)
+		return conn
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/notify"
+)
+
+// webhookSendTimeout limita a entrega de um evento de execução (incluindo retries).
+const webhookSendTimeout = 2 * time.Minute
+
+// notifyRunWebhook envia o resultado de uma execução agendada ao webhook de
+// notifications.webhook (eventos backup_completed e backup_failed), em
+// background para não atrasar o scheduler.
+func notifyRunWebhook(cfg *config.AgentConfig, entry config.BackupEntry, run JobRun, logger *slog.Logger) {
+	var event, level, message string
+	switch run.Status {
+	case "completed":
+		event, level = config.WebhookEventBackupCompleted, "info"
+		message = fmt.Sprintf("%s completed: %d bytes in %.0fs", entry.Name, run.Bytes, run.DurationSeconds)
+	case "failed":
+		event, level = config.WebhookEventBackupFailed, "error"
+		message = fmt.Sprintf("%s failed: %s", entry.Name, run.Error)
+	default:
+		return
+	}
+	webhook := cfg.Notifications.Webhook
+	if !webhook.Wants(event) {
+		return
+	}
+
+	ev := notify.WebhookEvent{
+		Event:   event,
+		Source:  "agent",
+		Level:   level,
+		Agent:   cfg.Agent.Name,
+		Storage: entry.Storage,
+		Backup:  entry.Name,
+		Message: message,
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), webhookSendTimeout)
+		defer cancel()
+		if err := notify.NewWebhookSender(webhook).Post(ctx, ev); err != nil {
+			logger.Warn("webhook delivery failed", "event", event, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,303 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Registros PAX dos metadados estendidos, nos mesmos nomes usados pelo GNU
+// tar (--xattrs, --acls, --selinux) e pelo star: um archive do agent extraído
+// com `tar --xattrs --acls --selinux` reaplica os metadados.
+const (
+	paxXattrPrefix  = "SCHILY.xattr."        // xattr genérico (user.*, trusted.*, security.capability...)
+	paxACLAccess    = "SCHILY.acl.access"    // ACL POSIX de acesso, em texto
+	paxACLDefault   = "SCHILY.acl.default"   // ACL POSIX default (diretórios), em texto
+	paxSELinuxLabel = "RHT.security.selinux" // contexto SELinux
+)
+
+// Nomes dos xattrs do kernel com tratamento próprio.
+const (
+	xattrACLAccess  = "system.posix_acl_access"
+	xattrACLDefault = "system.posix_acl_default"
+	xattrSELinux    = "security.selinux"
+)
+
+// readXattrRecords lê os xattrs de path e os converte em registros PAX: ACLs
+// POSIX em texto, contexto SELinux e demais xattrs crus. Retorna nil se o
+// arquivo não tem xattrs ou o filesystem não os suporta. Symlinks são
+// ignorados (o pacote syscall só expõe as variantes que seguem o link).
+func readXattrRecords(path string) map[string]string {
+	names, err := listXattrs(path)
+	if err != nil || len(names) == 0 {
+		return nil
+	}
+
+	records := make(map[string]string, len(names))
+	for _, name := range names {
+		value, err := getXattr(path, name)
+		if err != nil {
+			continue // removido entre o list e o get, ou sem permissão
+		}
+		switch name {
+		case xattrACLAccess, xattrACLDefault:
+			text, err := aclToText(value)
+			if err != nil {
+				continue
+			}
+			key := paxACLAccess
+			if name == xattrACLDefault {
+				key = paxACLDefault
+			}
+			records[key] = text
+		case xattrSELinux:
+			records[paxSELinuxLabel] = strings.TrimRight(string(value), "\x00")
+		default:
+			records[paxXattrPrefix+name] = string(value)
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return records
+}
+
+// applyXattrRecords reaplica em path os metadados estendidos de records
+// (Header.PAXRecords de uma entrada do archive). Usado pelo restore; falhas
+// em xattrs individuais (ex: trusted.* sem root, SELinux desabilitado) são
+// acumuladas e retornadas juntas, sem interromper as demais.
+func applyXattrRecords(path string, records map[string]string) error {
+	var errs []error
+	set := func(name string, value []byte) {
+		if err := setXattr(path, name, value); err != nil {
+			errs = append(errs, fmt.Errorf("setting %s on %s: %w", name, path, err))
+		}
+	}
+
+	keys := make([]string, 0, len(records))
+	for k := range records {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := records[k]
+		switch {
+		case k == paxACLAccess || k == paxACLDefault:
+			value, err := aclFromText(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("parsing %s of %s: %w", k, path, err))
+				continue
+			}
+			name := xattrACLAccess
+			if k == paxACLDefault {
+				name = xattrACLDefault
+			}
+			set(name, value)
+		case k == paxSELinuxLabel:
+			set(xattrSELinux, []byte(v))
+		case strings.HasPrefix(k, paxXattrPrefix):
+			set(strings.TrimPrefix(k, paxXattrPrefix), []byte(v))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Formato binário das ACLs POSIX nos xattrs system.posix_acl_* (Linux):
+// cabeçalho com a versão (uint32 LE) seguido de entradas {tag uint16,
+// perm uint16, id uint32}.
+const (
+	aclXattrVersion = 2
+	aclEntrySize    = 8
+
+	aclUserObj  = 0x01
+	aclUser     = 0x02
+	aclGroupObj = 0x04
+	aclGroup    = 0x08
+	aclMask     = 0x10
+	aclOther    = 0x20
+
+	aclUndefinedID = 0xffffffff
+)
+
+// aclEntry é uma entrada de ACL POSIX.
+type aclEntry struct {
+	tag  uint16
+	perm uint16
+	id   uint32
+}
+
+var aclTagNames = map[uint16]string{
+	aclUserObj:  "user",
+	aclUser:     "user",
+	aclGroupObj: "group",
+	aclGroup:    "group",
+	aclMask:     "mask",
+	aclOther:    "other",
+}
+
+// aclToText converte uma ACL binária na forma textual curta aceita por
+// setfacl e acl_from_text (ex: "user::rw-,user:1000:r--,group::r--,mask::r--,other::---"),
+// com ids numéricos.
+func aclToText(value []byte) (string, error) {
+	if len(value) < 4 || (len(value)-4)%aclEntrySize != 0 {
+		return "", fmt.Errorf("invalid ACL xattr size %d", len(value))
+	}
+	if v := binary.LittleEndian.Uint32(value); v != aclXattrVersion {
+		return "", fmt.Errorf("unsupported ACL xattr version %d", v)
+	}
+
+	var parts []string
+	for off := 4; off < len(value); off += aclEntrySize {
+		e := aclEntry{
+			tag:  binary.LittleEndian.Uint16(value[off:]),
+			perm: binary.LittleEndian.Uint16(value[off+2:]),
+			id:   binary.LittleEndian.Uint32(value[off+4:]),
+		}
+		name, ok := aclTagNames[e.tag]
+		if !ok {
+			return "", fmt.Errorf("unknown ACL tag 0x%x", e.tag)
+		}
+		qualifier := ""
+		if e.tag == aclUser || e.tag == aclGroup {
+			qualifier = strconv.FormatUint(uint64(e.id), 10)
+		}
+		parts = append(parts, name+":"+qualifier+":"+aclPermText(e.perm))
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// aclPermText formata as permissões de uma entrada como "rwx".
+func aclPermText(perm uint16) string {
+	b := []byte("---")
+	if perm&4 != 0 {
+		b[0] = 'r'
+	}
+	if perm&2 != 0 {
+		b[1] = 'w'
+	}
+	if perm&1 != 0 {
+		b[2] = 'x'
+	}
+	return string(b)
+}
+
+// aclFromText converte a forma textual de uma ACL (separada por vírgulas ou
+// quebras de linha, como gravada por aclToText, GNU tar ou star) no formato
+// binário do xattr. Qualificadores podem ser ids ou nomes; a forma do star
+// "user:nome:rwx:uid" usa o uid.
+func aclFromText(text string) ([]byte, error) {
+	var entries []aclEntry
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' }) {
+		field = strings.TrimSpace(field)
+		if i := strings.IndexByte(field, '#'); i >= 0 {
+			field = strings.TrimSpace(field[:i])
+		}
+		if field == "" {
+			continue
+		}
+		parts := strings.Split(field, ":")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("invalid ACL entry %q", field)
+		}
+
+		e := aclEntry{id: aclUndefinedID}
+		for _, c := range parts[2] {
+			switch c {
+			case 'r':
+				e.perm |= 4
+			case 'w':
+				e.perm |= 2
+			case 'x':
+				e.perm |= 1
+			case '-':
+			default:
+				return nil, fmt.Errorf("invalid ACL permissions in %q", field)
+			}
+		}
+
+		qualifier := parts[1]
+		if len(parts) >= 4 && parts[3] != "" {
+			qualifier = parts[3] // star: nome:perm:id
+		}
+		switch parts[0] {
+		case "user", "u":
+			e.tag = aclUserObj
+			if qualifier != "" {
+				e.tag = aclUser
+			}
+		case "group", "g":
+			e.tag = aclGroupObj
+			if qualifier != "" {
+				e.tag = aclGroup
+			}
+		case "mask", "m":
+			e.tag = aclMask
+		case "other", "o":
+			e.tag = aclOther
+		default:
+			return nil, fmt.Errorf("invalid ACL entry %q", field)
+		}
+		if e.tag == aclUser || e.tag == aclGroup {
+			id, err := aclQualifierID(qualifier, e.tag == aclUser)
+			if err != nil {
+				return nil, err
+			}
+			e.id = id
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("empty ACL")
+	}
+
+	// O kernel exige as entradas ordenadas por tag e, dentro da tag, por id.
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].tag != entries[j].tag {
+			return entries[i].tag < entries[j].tag
+		}
+		return entries[i].id < entries[j].id
+	})
+	out := make([]byte, 4, 4+len(entries)*aclEntrySize)
+	binary.LittleEndian.PutUint32(out, aclXattrVersion)
+	for _, e := range entries {
+		out = binary.LittleEndian.AppendUint16(out, e.tag)
+		out = binary.LittleEndian.AppendUint16(out, e.perm)
+		out = binary.LittleEndian.AppendUint32(out, e.id)
+	}
+	return out, nil
+}
+
+// aclQualifierID resolve o qualificador de uma entrada user:/group: — id
+// numérico ou nome de usuário/grupo local.
+func aclQualifierID(qualifier string, isUser bool) (uint32, error) {
+	if id, err := strconv.ParseUint(qualifier, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+	var idStr string
+	if isUser {
+		u, err := user.Lookup(qualifier)
+		if err != nil {
+			return 0, fmt.Errorf("resolving ACL user %q: %w", qualifier, err)
+		}
+		idStr = u.Uid
+	} else {
+		g, err := user.LookupGroup(qualifier)
+		if err != nil {
+			return 0, fmt.Errorf("resolving ACL group %q: %w", qualifier, err)
+		}
+		idStr = g.Gid
+	}
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %q for ACL qualifier %q", idStr, qualifier)
+	}
+	return uint32(id), nil
+}
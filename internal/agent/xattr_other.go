@@ -0,0 +1,24 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+//go:build !linux
+
+package agent
+
+import "errors"
+
+// Fora do Linux os xattrs não são preservados: o archive sai sem os registros
+// PAX e o restore falha ao reaplicá-los.
+
+func listXattrs(path string) ([]string, error) {
+	return nil, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func setXattr(path, name string, value []byte) error {
+	return errors.ErrUnsupported
+}
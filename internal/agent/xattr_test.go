@@ -0,0 +1,112 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// aclXattr monta o valor binário de system.posix_acl_* a partir de entradas
+// {tag, perm, id}.
+func aclXattr(entries ...aclEntry) []byte {
+	out := binary.LittleEndian.AppendUint32(nil, aclXattrVersion)
+	for _, e := range entries {
+		out = binary.LittleEndian.AppendUint16(out, e.tag)
+		out = binary.LittleEndian.AppendUint16(out, e.perm)
+		out = binary.LittleEndian.AppendUint32(out, e.id)
+	}
+	return out
+}
+
+func TestACLText_RoundTrip(t *testing.T) {
+	value := aclXattr(
+		aclEntry{aclUserObj, 6, aclUndefinedID},
+		aclEntry{aclUser, 4, 1000},
+		aclEntry{aclGroupObj, 4, aclUndefinedID},
+		aclEntry{aclGroup, 5, 33},
+		aclEntry{aclMask, 5, aclUndefinedID},
+		aclEntry{aclOther, 0, aclUndefinedID},
+	)
+	text, err := aclToText(value)
+	if err != nil {
+		t.Fatalf("aclToText: %v", err)
+	}
+	const want = "user::rw-,user:1000:r--,group::r--,group:33:r-x,mask::r-x,other::---"
+	if text != want {
+		t.Errorf("aclToText = %q, want %q", text, want)
+	}
+
+	back, err := aclFromText(text)
+	if err != nil {
+		t.Fatalf("aclFromText: %v", err)
+	}
+	if !bytes.Equal(back, value) {
+		t.Errorf("round trip mismatch:\n got %x\nwant %x", back, value)
+	}
+}
+
+func TestACLFromText_Variants(t *testing.T) {
+	// Ordem arbitrária, quebras de linha, comentários e a forma do star
+	// (nome:perm:id) produzem a ACL ordenada como o kernel exige.
+	got, err := aclFromText("other::r--\nuser:alice:rwx:1001 # comment\nuser::rwx\ngroup::r-x\nmask::rwx")
+	if err != nil {
+		t.Fatalf("aclFromText: %v", err)
+	}
+	want := aclXattr(
+		aclEntry{aclUserObj, 7, aclUndefinedID},
+		aclEntry{aclUser, 7, 1001},
+		aclEntry{aclGroupObj, 5, aclUndefinedID},
+		aclEntry{aclMask, 7, aclUndefinedID},
+		aclEntry{aclOther, 4, aclUndefinedID},
+	)
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+
+	for _, bad := range []string{"", "user", "user::rwz", "bogus::rwx"} {
+		if _, err := aclFromText(bad); err == nil {
+			t.Errorf("aclFromText(%q): expected error", bad)
+		}
+	}
+	if _, err := aclToText([]byte{1, 2, 3}); err == nil {
+		t.Error("aclToText: expected error for truncated value")
+	}
+}
+
+func TestXattrRecords_CaptureAndApply(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.WriteFile(src, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := setXattr(src, "user.checksum", []byte("abc")); err != nil {
+		t.Skipf("user xattrs not supported: %v", err)
+	}
+
+	records := readXattrRecords(src)
+	if records[paxXattrPrefix+"user.checksum"] != "abc" {
+		t.Fatalf("unexpected records: %q", records)
+	}
+
+	dst := filepath.Join(dir, "dst")
+	if err := os.WriteFile(dst, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyXattrRecords(dst, records); err != nil {
+		t.Fatalf("applyXattrRecords: %v", err)
+	}
+	value, err := getXattr(dst, "user.checksum")
+	if err != nil || string(value) != "abc" {
+		t.Errorf("restored xattr = %q, %v", value, err)
+	}
+
+	if readXattrRecords(filepath.Join(dir, "missing")) != nil {
+		t.Error("expected nil records for a missing file")
+	}
+}
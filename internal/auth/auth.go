@@ -0,0 +1,143 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// Package auth define a identidade autenticada de um peer, independente do
+// transporte pelo qual ela foi verificada: certificado mTLS (CN), SPIFFE SVID
+// (URI SAN spiffe://), PSK, token Bearer ou login da WebUI.
+//
+// Cada transporte verifica a credencial do seu jeito (handshake TLS, desafio
+// PSK, digest do token) e entrega uma Identity; autorização (allow-list,
+// roles), auditoria e logs usam apenas a Identity. Um transporte novo só
+// precisa produzir uma Identity — diretamente ou implementando Identified na
+// sua net.Conn.
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Method identifica como a identidade foi verificada.
+type Method string
+
+const (
+	MethodMTLS     Method = "mtls"     // certificado de client, nome = CN
+	MethodSPIFFE   Method = "spiffe"   // SVID X.509, nome = último segmento do SPIFFE ID
+	MethodPSK      Method = "psk"      // desafio HMAC com chave pré-compartilhada (server.psk_file)
+	MethodPeerCred Method = "peercred" // uid do processo local no socket unix (listeners[].peer_agents)
+	MethodToken    Method = "token"    // token Bearer da API (web_ui.api_tokens)
+	MethodUser     Method = "user"     // login da WebUI (web_ui.users)
+)
+
+// Identity é a identidade autenticada de um peer.
+type Identity struct {
+	Method Method
+	// Name é o nome usado na autorização: agent (CN, SPIFFE ou PSK), nome
+	// do token ou usuário da WebUI.
+	Name string
+	// Credential descreve a credencial apresentada para logs e eventos
+	// (ex: "serial 1a2b", "spiffe://example.org/nbackup/web-01", "psk").
+	Credential string
+	// Role é o role do token ou usuário (vazio para agents).
+	Role string
+}
+
+// String identifica o peer em eventos de auditoria ("token ops", "user alice",
+// "mtls web-01").
+func (id Identity) String() string {
+	return string(id.Method) + " " + id.Name
+}
+
+// Identified é implementado por conexões autenticadas fora do TLS (ex: PSK,
+// SO_PEERCRED), que carregam a identidade verificada.
+type Identified interface {
+	Identity() Identity
+}
+
+// FromCertificate extrai a identidade de um certificado de client já
+// verificado. Um URI SAN spiffe:// tem precedência sobre o CN.
+func FromCertificate(cert *x509.Certificate) Identity {
+	if id, ok := SPIFFEID(cert); ok {
+		return Identity{Method: MethodSPIFFE, Name: spiffeName(id), Credential: id}
+	}
+	return Identity{
+		Method:     MethodMTLS,
+		Name:       cert.Subject.CommonName,
+		Credential: "serial " + cert.SerialNumber.Text(16),
+	}
+}
+
+// SPIFFEID retorna o SPIFFE ID (URI SAN spiffe://) do certificado, se houver.
+func SPIFFEID(cert *x509.Certificate) (string, bool) {
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" && u.Host != "" {
+			return u.String(), true
+		}
+	}
+	return "", false
+}
+
+// spiffeName deriva o nome do agent do SPIFFE ID: o último segmento do path
+// (spiffe://example.org/nbackup/web-01 → web-01) ou o trust domain se o path
+// for vazio.
+func spiffeName(id string) string {
+	rest := strings.TrimPrefix(id, "spiffe://")
+	rest = strings.TrimRight(rest, "/")
+	if i := strings.LastIndex(rest, "/"); i >= 0 {
+		return rest[i+1:]
+	}
+	return rest
+}
+
+// FromConn retorna a identidade autenticada da conexão: a de uma conexão
+// Identified ou a do certificado peer de uma conexão TLS. Retorna false se a
+// conexão não carrega identidade (sem TLS ou TLS sem certificado de client).
+func FromConn(conn net.Conn) (Identity, bool) {
+	if ic, ok := conn.(Identified); ok {
+		return ic.Identity(), true
+	}
+	if cert := PeerCertificate(conn); cert != nil {
+		return FromCertificate(cert), true
+	}
+	return Identity{}, false
+}
+
+// TLSConn é uma conexão com estado TLS: *tls.Conn ou um stream QUIC
+// (protocol.QUICConn).
+type TLSConn interface {
+	net.Conn
+	ConnectionState() tls.ConnectionState
+}
+
+// PeerCertificate retorna o certificado de client de uma conexão TLS (nil se
+// a conexão não é TLS ou o peer não apresentou certificado).
+func PeerCertificate(conn net.Conn) *x509.Certificate {
+	tlsConn, ok := conn.(TLSConn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
+
+// BearerToken extrai o token do header Authorization ("Bearer <token>").
+// present indica se o header existe; um header com outro esquema retorna
+// token vazio com present true.
+func BearerToken(r *http.Request) (token string, present bool) {
+	h := r.Header.Get("Authorization")
+	if h == "" {
+		return "", false
+	}
+	scheme, value, ok := strings.Cut(h, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", true
+	}
+	return strings.TrimSpace(value), true
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestFromCertificate(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "web-01"}, SerialNumber: big.NewInt(0x1a2b)}
+	id := FromCertificate(cert)
+	if id.Method != MethodMTLS || id.Name != "web-01" || id.Credential != "serial 1a2b" {
+		t.Errorf("unexpected mTLS identity %+v", id)
+	}
+
+	svid, _ := url.Parse("spiffe://example.org/nbackup/db-01")
+	cert.URIs = []*url.URL{{Scheme: "https", Host: "example.org"}, svid}
+	id = FromCertificate(cert)
+	if id.Method != MethodSPIFFE || id.Name != "db-01" || id.Credential != "spiffe://example.org/nbackup/db-01" {
+		t.Errorf("unexpected SPIFFE identity %+v", id)
+	}
+	if got := id.String(); got != "spiffe db-01" {
+		t.Errorf("unexpected String() %q", got)
+	}
+}
+
+func TestSPIFFEName(t *testing.T) {
+	for id, want := range map[string]string{
+		"spiffe://example.org/nbackup/web-01":  "web-01",
+		"spiffe://example.org/nbackup/web-01/": "web-01",
+		"spiffe://example.org":                 "example.org",
+	} {
+		if got := spiffeName(id); got != want {
+			t.Errorf("spiffeName(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+type identifiedConn struct {
+	net.Conn
+	id Identity
+}
+
+func (c *identifiedConn) Identity() Identity { return c.id }
+
+func TestFromConn(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	if _, ok := FromConn(a); ok {
+		t.Error("plain connection should carry no identity")
+	}
+	want := Identity{Method: MethodPSK, Name: "web-01", Credential: "psk"}
+	if id, ok := FromConn(&identifiedConn{Conn: a, id: want}); !ok || id != want {
+		t.Errorf("expected identity %+v, got %+v (ok=%v)", want, id, ok)
+	}
+	if PeerCertificate(a) != nil {
+		t.Error("plain connection should have no peer certificate")
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	for header, want := range map[string]struct {
+		token   string
+		present bool
+	}{
+		"":               {"", false},
+		"Bearer abc":     {"abc", true},
+		"bearer  abc ":   {"abc", true},
+		"Basic dXNlcjpw": {"", true},
+	} {
+		r := httptest.NewRequest("GET", "/api/v1/health", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		token, present := BearerToken(r)
+		if token != want.token || present != want.present {
+			t.Errorf("BearerToken(%q) = %q, %v; want %q, %v", header, token, present, want.token, want.present)
+		}
+	}
+}
@@ -6,16 +6,26 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/nishisan-dev/n-backup/internal/logging"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
 )
 
 // AgentConfig representa a configuração completa do nbackup-agent.
 type AgentConfig struct {
+	ConfigVersion      int      `yaml:"config_version"`       // versão do schema (ver CurrentConfigVersion); ausente = 0, migrado na carga
+	AllowUnknownFields []string `yaml:"allow_unknown_fields"` // globs de campos desconhecidos tolerados (ex: "backups.legacy_*")
+	Migrations         []string `yaml:"-"`                    // migrações de schema aplicadas na carga (ver WarnMigrations)
+
 	Agent   AgentInfo     `yaml:"agent"`
 	Daemon  DaemonInfo    `yaml:"daemon"`
 	Server  ServerAddr    `yaml:"server"`
@@ -24,6 +34,8 @@ type AgentConfig struct {
 	Retry   RetryInfo     `yaml:"retry"`
 	Resume  ResumeConfig  `yaml:"resume"`
 	Logging LoggingInfo   `yaml:"logging"`
+
+	Notifications NotificationsConfig `yaml:"notifications"`
 }
 
 // AgentInfo identifica o agent.
@@ -34,6 +46,38 @@ type AgentInfo struct {
 // DaemonInfo contém configurações do modo daemon.
 type DaemonInfo struct {
 	ControlChannel ControlChannelConfig `yaml:"control_channel"`
+	StateDir       string               `yaml:"state_dir"` // estado local de execuções (default: /var/lib/nbackup/agent)
+	AdminSocket    AdminSocketConfig    `yaml:"admin_socket"`
+	Shutdown       ShutdownConfig       `yaml:"shutdown"`
+
+	// Execuções simultâneas: além de max_concurrent_backups, as demais
+	// aguardam vaga por ordem de backups[].priority. bandwidth_limit é o
+	// limite combinado de todos os backups em andamento, além do de cada entry.
+	MaxConcurrentBackups int    `yaml:"max_concurrent_backups"` // 0 = sem limite no daemon; em --once, 0 ou 1 = sequencial (default: 0)
+	BandwidthLimit       string `yaml:"bandwidth_limit"`        // limite combinado de upload em Bytes/seg (ex: "200mb"), vazio = sem limite
+	BandwidthLimitRaw    int64  `yaml:"-"`                      // valor parseado em bytes/seg
+}
+
+// Modos de shutdown do daemon com backups em andamento.
+const (
+	ShutdownModeWait  = "wait"  // aguarda os backups até o timeout, depois aborta
+	ShutdownModeAbort = "abort" // aborta imediatamente
+)
+
+// ShutdownConfig define o que o daemon faz com backups em andamento ao
+// receber SIGTERM/SIGINT. Backups abortados são cancelados no server via
+// control channel (os dados parciais são descartados na hora).
+type ShutdownConfig struct {
+	Mode    string        `yaml:"mode"`    // wait (default) | abort
+	Timeout time.Duration `yaml:"timeout"` // espera máxima no modo wait (default: 5m)
+}
+
+// AdminSocketConfig configura o socket unix local de administração do daemon
+// (usado por `nbackup-agent trigger|cancel|reload|status` e, em server.admin_socket,
+// por `nbackup-server sessions|agents|storage`).
+type AdminSocketConfig struct {
+	Enabled *bool  `yaml:"enabled"` // default: true
+	Path    string `yaml:"path"`    // default: /run/nbackup/agent.sock
 }
 
 // ControlChannelConfig configura o canal de controle persistente com o server.
@@ -46,14 +90,50 @@ type ControlChannelConfig struct {
 
 // ServerAddr contém o endereço do servidor de backup.
 type ServerAddr struct {
-	Address string `yaml:"address"`
+	Address   string       `yaml:"address"`   // host:porta ou, com transport unix, o caminho do socket
+	Transport string       `yaml:"transport"` // tcp | quic (experimental) | unix (default: tcp)
+	Proxy     ProxyConfig  `yaml:"proxy"`     // proxy de saída para todas as conexões com o server
+	Prefer    string       `yaml:"prefer"`    // auto | ipv4 | ipv6: família tentada primeiro quando o nome resolve para ambas (default: auto)
+	Socket    SocketConfig `yaml:"socket"`    // ajuste dos sockets TCP com o server (keepalive, buffers, congestion control)
+}
+
+// ProxyConfig define o proxy (HTTP CONNECT ou SOCKS5) pelo qual o agent
+// alcança o server em redes sem saída direta. Vale para todas as conexões:
+// control channel, backups, streams paralelos, restore, health check e enroll.
+type ProxyConfig struct {
+	URL      string `yaml:"url"`      // http://, https:// ou socks5://host:porta; vazio = conexão direta
+	Username string `yaml:"username"` // autenticação no proxy (Basic no HTTP, usuário/senha no SOCKS5)
+	Password string `yaml:"password"`
 }
 
-// TLSClient contém os caminhos dos certificados mTLS do client.
+// Enabled indica se as conexões passam pelo proxy.
+func (p ProxyConfig) Enabled() bool { return p.URL != "" }
+
+// Transportes entre agent e server (server.transport).
+const (
+	TransportTCP  = "tcp"  // TLS sobre TCP, uma conexão por sessão e por stream (default)
+	TransportQUIC = "quic" // experimental: QUIC (UDP), sessões e streams como streams de uma conexão QUIC
+	TransportUnix = "unix" // socket unix de um listener local do server, sem TLS (identidade via SO_PEERCRED)
+)
+
+// Família de IP preferida no dial do server (server.prefer).
+const (
+	PreferAuto = "auto" // ordem do resolver (RFC 6724)
+	PreferIPv4 = "ipv4"
+	PreferIPv6 = "ipv6"
+)
+
+// TLSClient contém os caminhos dos certificados mTLS do client ou, com
+// auth psk, da pre-shared key do agent.
 type TLSClient struct {
 	CACert     string `yaml:"ca_cert"`
 	ClientCert string `yaml:"client_cert"`
 	ClientKey  string `yaml:"client_key"`
+
+	// Auth psk dispensa client_cert/client_key: o agent se autentica com o
+	// HMAC de um desafio do server usando a chave de psk_file.
+	Auth    string `yaml:"auth"`     // mtls | psk (default: mtls)
+	PSKFile string `yaml:"psk_file"` // arquivo com a pre-shared key do agent (obrigatório com auth: psk)
 }
 
 // BackupEntry representa um bloco de backup nomeado com storage de destino.
@@ -62,13 +142,146 @@ type BackupEntry struct {
 	Storage           string             `yaml:"storage"`  // Nome do storage no server
 	Schedule          string             `yaml:"schedule"` // Cron expression individual deste backup
 	Sources           []BackupSource     `yaml:"sources"`
-	Exclude           []string           `yaml:"exclude"`
-	Parallels         int                `yaml:"parallels"`       // 0=desabilitado (single stream), 1-255=máx streams paralelos
-	DSCP              string             `yaml:"dscp"`            // DSCP marking (ex: "AF41", "EF"), vazio=desabilitado
-	AutoScaler        AutoScalerMode     `yaml:"auto_scaler"`     // string legado ("efficiency"/"adaptive") ou map { enabled, mode }
-	BandwidthLimit    string             `yaml:"bandwidth_limit"` // Limite de upload em Bytes/seg (ex: "50mb", "1gb"), vazio=sem limite
-	BandwidthLimitRaw int64              `yaml:"-"`               // valor parseado em bytes/seg
-	PortRotation      PortRotationConfig `yaml:"port_rotation"`   // rotação de source port por N chunks
+	Include           []string           `yaml:"include"`            // exceções aos excludes (mesma sintaxe)
+	Exclude           []string           `yaml:"exclude"`            // globs, doublestar (**/*.log) ou regex (re:...)
+	Parallels         int                `yaml:"parallels"`          // 0=desabilitado (single stream), 1-255=máx streams paralelos
+	ParallelTransport string             `yaml:"parallel_transport"` // sockets|mux — um socket TLS por stream ou todos em uma conexão (default: sockets)
+	ProducerShards    int                `yaml:"producer_shards"`    // producers (scanner+tar+compressor) em paralelo; 0/1 = um só (default)
+	DSCP              string             `yaml:"dscp"`               // DSCP marking (ex: "AF41", "EF"), vazio=desabilitado
+	AutoScaler        AutoScalerMode     `yaml:"auto_scaler"`        // string legado ("efficiency"/"adaptive") ou map { enabled, mode }
+	BandwidthLimit    string             `yaml:"bandwidth_limit"`    // Limite de upload em Bytes/seg (ex: "50mb", "1gb"), vazio=sem limite
+	BandwidthLimitRaw int64              `yaml:"-"`                  // valor parseado em bytes/seg
+	PortRotation      PortRotationConfig `yaml:"port_rotation"`      // rotação de source port por N chunks
+	Jitter            time.Duration      `yaml:"jitter"`             // atraso aleatório em [0, jitter) antes de cada execução agendada (default: 0)
+	CatchUp           bool               `yaml:"catch_up"`           // executa no start do daemon se o último sucesso for mais antigo que o período do schedule
+	MinInterval       time.Duration      `yaml:"min_interval"`       // intervalo mínimo entre execuções bem-sucedidas (default: 0 = sem limite)
+	Local             LocalTarget        `yaml:"local"`              // destino local/removível (modo sem server); vazio = envia ao server
+	HealthcheckURL    string             `yaml:"healthcheck_url"`    // URL de ping estilo healthchecks.io (/start, base = sucesso, /fail), vazio = desabilitado
+	MinStorageFree    string             `yaml:"min_storage_free"`   // espaço livre mínimo no storage do server para iniciar execuções agendadas (ex: "50gb"), vazio = sem verificação
+	MinStorageFreeRaw int64              `yaml:"-"`                  // valor parseado em bytes
+	Snapshot          SnapshotConfig     `yaml:"snapshot"`           // fase de snapshot antes da transferência (opcional)
+	Xattrs            bool               `yaml:"xattrs"`             // preserva xattrs, ACLs POSIX e contexto SELinux no archive (default: false)
+	Assertions        BackupAssertions   `yaml:"assertions"`         // critérios de sucesso verificados antes do commit (opcional)
+	MaxSize           string             `yaml:"max_size"`           // tamanho máximo do archive (compactado, ex: "200gb"); excedido, a execução é abortada. Vazio = sem limite
+	MaxSizeRaw        int64              `yaml:"-"`                  // valor parseado em bytes
+	Manifest          bool               `yaml:"manifest"`           // envia o manifest de arquivos (path, size, mtime, mode, sha256) gravado ao lado do archive (default: false)
+	Compression       CompressionConfig  `yaml:"compression"`        // nível de compressão e arquivos gravados sem compressão (opcional)
+	Priority          int                `yaml:"priority"`           // ordem na fila por vaga de daemon.max_concurrent_backups: maior primeiro (default: 0)
+}
+
+// CompressionConfig ajusta a compressão do archive de um backup. O algoritmo
+// é o do storage (storages.*.compression_mode no server) ou, no modo local,
+// local.compression_mode; algorithm declara para qual deles vale o level.
+type CompressionConfig struct {
+	Algorithm      string   `yaml:"algorithm"`       // gzip | zst (ou zstd) | none (tudo sem compressão, no formato negociado); vazio = o negociado
+	Level          int      `yaml:"level"`           // gzip 1-9, zst 1-22; 0 = default (gzip 1, zst 3). Exige algorithm
+	SkipCompressed *bool    `yaml:"skip_compressed"` // grava sem compressão os arquivos já comprimidos (jpg, mp4, zst, gz...) (default: true)
+	SkipExtensions []string `yaml:"skip_extensions"` // extensões adicionais gravadas sem compressão (ex: ".dat")
+	Workers        int      `yaml:"workers"`         // goroutines de compressão (pgzip/zstd) do producer; 0 = um por CPU (GOMAXPROCS)
+}
+
+// CompressionNone em compression.algorithm grava todas as entradas sem
+// compressão (gzip stored / frames zstd raw): o archive mantém o formato do
+// storage, sem o custo de CPU do compressor.
+const CompressionNone = "none"
+
+// MaxCompressionWorkers limita compression.workers: cada worker pgzip
+// mantém ~2 blocos de 1MB em memória.
+const MaxCompressionWorkers = 256
+
+// SkipCompressedEnabled indica se a lista embutida de extensões já
+// comprimidas está ativa (default: true).
+func (c CompressionConfig) SkipCompressedEnabled() bool {
+	return c.SkipCompressed == nil || *c.SkipCompressed
+}
+
+// MaxProducerShards limita backups[].producer_shards: cada shard mantém um
+// compressor e até dois segmentos de archive em memória.
+const MaxProducerShards = 32
+
+// Valores de backups[].parallel_transport.
+const (
+	ParallelTransportSockets = "sockets" // um socket TLS por stream paralelo
+	ParallelTransportMux     = "mux"     // streams lógicos em uma única conexão TLS
+)
+
+// BackupAssertions são os critérios mínimos para que uma execução seja
+// considerada bem-sucedida, verificados pelo agent ao fim do stream e antes
+// do commit. Protegem contra backups "vazios mas válidos" (ex: o source é um
+// mount point que não estava montado): uma violação falha a execução com o
+// motivo e a sessão é descartada no server.
+type BackupAssertions struct {
+	MinBytes      string   `yaml:"min_bytes"`      // soma mínima do tamanho dos arquivos regulares (ex: "1gb"), vazio = sem verificação
+	MinBytesRaw   int64    `yaml:"-"`              // valor parseado em bytes
+	MinObjects    int64    `yaml:"min_objects"`    // número mínimo de entradas no archive (default: 0 = sem verificação)
+	RequiredPaths []string `yaml:"required_paths"` // caminhos absolutos que devem estar no archive
+}
+
+// Enabled indica se alguma assertion está configurada.
+func (a BackupAssertions) Enabled() bool {
+	return a.MinBytesRaw > 0 || a.MinObjects > 0 || len(a.RequiredPaths) > 0
+}
+
+// SnapshotConfig configura a fase de snapshot de um backup: command roda antes
+// da transferência (ex: snapshot LVM/ZFS, pg_backup_start) e cleanup_command
+// depois dela, com sucesso ou falha. Com coordinated o backup não tem schedule
+// próprio: é disparado pelo server junto com os demais agents de um
+// snapshot_group, e a transferência só começa depois que todos confirmaram o
+// snapshot.
+type SnapshotConfig struct {
+	Command        string        `yaml:"command"`         // executado via /bin/sh -c
+	CleanupCommand string        `yaml:"cleanup_command"` // executado após a transferência (exige command ou coordinated)
+	Timeout        time.Duration `yaml:"timeout"`         // tempo máximo de cada comando (default: 5m)
+	Coordinated    bool          `yaml:"coordinated"`     // disparado pelo server (snapshot_groups); dispensa schedule
+}
+
+// Enabled indica se o backup tem fase de snapshot.
+func (s SnapshotConfig) Enabled() bool {
+	return s.Command != "" || s.Coordinated
+}
+
+// LocalTarget configura o modo local (sem server): o agent grava o archive
+// diretamente em {path}/{agent}/{backup}/, no mesmo formato, nomenclatura e
+// rotação do storage do server, com sidecar .sha256 e um catalog.json.
+type LocalTarget struct {
+	Path            string `yaml:"path"`             // raiz do destino (ex: ponto de montagem do drive); deve existir
+	MaxBackups      int    `yaml:"max_backups"`      // default: 5
+	CompressionMode string `yaml:"compression_mode"` // gzip|zst (default: gzip)
+}
+
+// Enabled indica se o backup usa o modo local em vez do server.
+func (l LocalTarget) Enabled() bool {
+	return l.Path != ""
+}
+
+// CompressionModeByte converte o compression_mode para a constante de protocolo.
+func (l LocalTarget) CompressionModeByte() byte {
+	if l.CompressionMode == "zst" {
+		return protocol.CompressionZstd
+	}
+	return protocol.CompressionGzip
+}
+
+// FileExtension retorna a extensão dos archives gravados no destino local.
+func (l LocalTarget) FileExtension() string {
+	if l.CompressionMode == "zst" {
+		return ".tar.zst"
+	}
+	return ".tar.gz"
+}
+
+// UsesServer indica se algum backup envia ao server. Configs apenas com
+// backups locais não exigem server.address nem tls.
+func (c *AgentConfig) UsesServer() bool {
+	if len(c.Backups) == 0 {
+		return true
+	}
+	for _, b := range c.Backups {
+		if !b.Local.Enabled() {
+			return true
+		}
+	}
+	return false
 }
 
 // PortRotationConfig controla a rotação intencional de source port TCP por stream.
@@ -149,7 +362,23 @@ func (a *AutoScalerMode) UnmarshalYAML(value *yaml.Node) error {
 
 // BackupSource representa um diretório de origem para backup.
 type BackupSource struct {
-	Path string `yaml:"path"`
+	Path           string `yaml:"path"`
+	Required       *bool  `yaml:"required"`        // default: true — source ausente falha o backup antes de conectar
+	FollowSymlinks bool   `yaml:"follow_symlinks"` // grava o conteúdo apontado pelos symlinks em vez dos links (default: false)
+	OneFilesystem  bool   `yaml:"one_filesystem"`  // não atravessa mount points, como tar --one-file-system (default: false)
+
+	// Filtros de arquivos regulares, avaliados pelo scanner (vazio/0 = sem filtro)
+	MinFileSize    string        `yaml:"min_file_size"`   // ignora arquivos menores (ex: "1kb")
+	MinFileSizeRaw int64         `yaml:"-"`               // valor parseado em bytes
+	MaxFileSize    string        `yaml:"max_file_size"`   // ignora arquivos maiores (ex: "2gb")
+	MaxFileSizeRaw int64         `yaml:"-"`               // valor parseado em bytes
+	ModifiedWithin time.Duration `yaml:"modified_within"` // apenas arquivos modificados nesse período (ex: 168h)
+	ModifiedBefore time.Duration `yaml:"modified_before"` // apenas arquivos modificados há mais que isso (ex: 720h)
+}
+
+// IsRequired retorna true por padrão quando o campo required não foi informado.
+func (s BackupSource) IsRequired() bool {
+	return s.Required == nil || *s.Required
 }
 
 // RetryInfo contém configurações de retry com exponential backoff.
@@ -168,15 +397,214 @@ type ResumeConfig struct {
 	BufferSizeRaw int64  `yaml:"-"`           // valor parseado em bytes
 	ChunkSize     string `yaml:"chunk_size"`  // ex: "1mb", "4mb" (default: 1mb)
 	ChunkSizeRaw  int64  `yaml:"-"`           // valor parseado em bytes
+
+	// ChunkSizeMin e ChunkSizeMax limitam o ajuste adaptativo do chunk em
+	// backups paralelos: o agent parte de chunk_size e dobra ou divide por dois
+	// conforme o throughput e o round-trip medidos. Iguais a chunk_size
+	// (default) = tamanho fixo.
+	ChunkSizeMin    string `yaml:"chunk_size_min"` // ex: "256kb" (default: chunk_size)
+	ChunkSizeMinRaw int64  `yaml:"-"`
+	ChunkSizeMax    string `yaml:"chunk_size_max"` // ex: "8mb" (default: chunk_size)
+	ChunkSizeMaxRaw int64  `yaml:"-"`
+
+	// SACKInterval e MaxInFlight compõem a janela de SACK pedida ao server no
+	// handshake (single-stream): "auto" (default) calcula a partir do RTT e
+	// do buffer_size; um tamanho fixa o valor.
+	SACKInterval    string `yaml:"sack_interval"` // ex: "8mb" (default: auto)
+	SACKIntervalRaw int64  `yaml:"-"`             // 0 = auto
+	MaxInFlight     string `yaml:"max_inflight"`  // ex: "64mb" (default: auto)
+	MaxInFlightRaw  int64  `yaml:"-"`             // 0 = auto
 }
 
 // LoggingInfo contém configurações de logging.
 type LoggingInfo struct {
-	Level         string `yaml:"level"`
-	Format        string `yaml:"format"`
-	File          string `yaml:"file"`            // Caminho para arquivo de log (ex: /var/log/nbackup/agent.log)
-	StreamStats   bool   `yaml:"stream_stats"`    // Habilita stats por stream em sessões paralelas (padrão: false)
-	SessionLogDir string `yaml:"session_log_dir"` // Diretório para logs por sessão (ex: /var/log/nbackup/sessions), vazio = desabilitado
+	Level         string         `yaml:"level"`
+	Format        string         `yaml:"format"`
+	File          string         `yaml:"file"`            // Caminho para arquivo de log (ex: /var/log/nbackup/agent.log)
+	Target        string         `yaml:"target"`          // stdout (default), syslog ou journald
+	Syslog        SyslogConfig   `yaml:"syslog"`          // coletor de logging.target: syslog
+	Rotation      RotationConfig `yaml:"rotation"`        // rotação de logging.file
+	StreamStats   bool           `yaml:"stream_stats"`    // Habilita stats por stream em sessões paralelas (padrão: false)
+	SessionLogDir string         `yaml:"session_log_dir"` // Diretório para logs por sessão (ex: /var/log/nbackup/sessions), vazio = desabilitado
+
+	// ProtocolTraceDir habilita a captura do transcript de protocolo (tipos,
+	// tamanhos, offsets e tempos dos frames, sem payload) por conexão, para
+	// diagnóstico offline. Vazio = desabilitado. Apenas para debug.
+	ProtocolTraceDir string `yaml:"protocol_trace_dir"`
+	// ProtocolTraceOnly restringe o trace a estes nomes: agents no server,
+	// entradas de backup no agent. Vazio = todas as conexões.
+	ProtocolTraceOnly []string `yaml:"protocol_trace_only"`
+
+	// Redact remove trechos sensíveis (usuários, tokens embutidos em nomes de
+	// arquivo) de logs, eventos, WebUI e notificações.
+	Redact RedactConfig `yaml:"redact"`
+
+	// Sampling limita a taxa de registros de alta frequência (SACKs, chunks,
+	// stream stats) no log do processo.
+	Sampling SamplingConfig `yaml:"sampling"`
+}
+
+// RedactConfig define os padrões de redação (logging.redact).
+type RedactConfig struct {
+	// Patterns são expressões regulares (sintaxe RE2). Se a expressão tem
+	// grupos de captura, apenas os grupos são substituídos.
+	Patterns []string `yaml:"patterns"`
+	// Replacement substitui cada trecho redigido (default: "[REDACTED]").
+	Replacement string `yaml:"replacement"`
+}
+
+// validate verifica se os padrões de redação compilam.
+func (r RedactConfig) validate() error {
+	for _, p := range r.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("logging.redact.patterns: invalid pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// SyslogConfig define o coletor do destino syslog (logging.syslog).
+type SyslogConfig struct {
+	Address  string `yaml:"address"`  // udp://host:port, tcp://host:port ou tls://host:port
+	Facility string `yaml:"facility"` // default: daemon
+	AppName  string `yaml:"app_name"` // default: nome do executável
+	CACert   string `yaml:"ca_cert"`  // só tls:// (default: CAs do sistema)
+}
+
+// validateTarget verifica logging.target e, com syslog, o coletor.
+func (l LoggingInfo) validateTarget() error {
+	switch l.Target {
+	case "", logging.TargetStdout, logging.TargetJournald:
+		return nil
+	case logging.TargetSyslog:
+	default:
+		return fmt.Errorf("logging.target must be %s, %s or %s, got %q", logging.TargetStdout, logging.TargetSyslog, logging.TargetJournald, l.Target)
+	}
+	if l.Syslog.Address == "" {
+		return fmt.Errorf("logging.syslog.address is required when logging.target is syslog")
+	}
+	network, _, err := logging.ParseSyslogAddress(l.Syslog.Address)
+	if err != nil {
+		return fmt.Errorf("logging.syslog.address: %w", err)
+	}
+	if _, err := logging.ParseFacility(l.Syslog.Facility); err != nil {
+		return fmt.Errorf("logging.syslog.facility: %w", err)
+	}
+	if l.Syslog.CACert != "" && network != "tls" {
+		return fmt.Errorf("logging.syslog.ca_cert requires a tls:// address")
+	}
+	return nil
+}
+
+// LogTarget converte logging.target para logging.NewTargetLogger.
+func (l LoggingInfo) LogTarget() logging.Target {
+	return logging.Target{
+		Kind:    l.Target,
+		AppName: l.Syslog.AppName,
+		Syslog: logging.SyslogOptions{
+			Address:  l.Syslog.Address,
+			Facility: l.Syslog.Facility,
+			CACert:   l.Syslog.CACert,
+		},
+	}
+}
+
+// RotationConfig define a rotação do arquivo de log (logging.rotation).
+// Habilitada com max_size e/ou max_age.
+type RotationConfig struct {
+	MaxSize    string        `yaml:"max_size"` // ex: "100mb"; vazio = sem limite de tamanho
+	MaxSizeRaw int64         `yaml:"-"`
+	MaxAge     time.Duration `yaml:"max_age"`   // rotaciona o arquivo aberto há mais que isso; 0 = sem limite
+	MaxFiles   int           `yaml:"max_files"` // arquivos rotacionados mantidos (default: 5)
+	Compress   *bool         `yaml:"compress"`  // gzip dos arquivos rotacionados (default: true)
+}
+
+// validateRotation valida logging.rotation e aplica os defaults.
+func (l *LoggingInfo) validateRotation() error {
+	r := &l.Rotation
+	if r.MaxSize == "" && r.MaxAge == 0 {
+		return nil
+	}
+	if l.File == "" {
+		return fmt.Errorf("logging.rotation requires logging.file")
+	}
+	if r.MaxSize != "" {
+		size, err := ParseByteSize(r.MaxSize)
+		if err != nil {
+			return fmt.Errorf("logging.rotation.max_size: %w", err)
+		}
+		if size < 1024*1024 {
+			return fmt.Errorf("logging.rotation.max_size must be at least 1mb, got %s", r.MaxSize)
+		}
+		r.MaxSizeRaw = size
+	}
+	if r.MaxAge < 0 {
+		return fmt.Errorf("logging.rotation.max_age must be >= 0, got %s", r.MaxAge)
+	}
+	if r.MaxAge > 0 && r.MaxAge < time.Minute {
+		return fmt.Errorf("logging.rotation.max_age must be at least 1m, got %s", r.MaxAge)
+	}
+	if r.MaxFiles < 0 {
+		return fmt.Errorf("logging.rotation.max_files must be >= 0, got %d", r.MaxFiles)
+	}
+	if r.MaxFiles == 0 {
+		r.MaxFiles = 5
+	}
+	if r.Compress == nil {
+		compress := true
+		r.Compress = &compress
+	}
+	return nil
+}
+
+// LogRotation converte logging.rotation para logging.SetRotation.
+func (r RotationConfig) LogRotation() logging.Rotation {
+	return logging.Rotation{
+		MaxSize:  r.MaxSizeRaw,
+		MaxAge:   r.MaxAge,
+		MaxFiles: r.MaxFiles,
+		Compress: r.Compress != nil && *r.Compress,
+	}
+}
+
+// SamplingConfig define a amostragem de logs (logging.sampling).
+type SamplingConfig struct {
+	Rules []SamplingRule `yaml:"rules"`
+}
+
+// SamplingRule limita a taxa de um tipo de registro, identificado pela mensagem.
+type SamplingRule struct {
+	Message string  `yaml:"message"` // mensagem exata, ou prefixo terminado em "*"
+	Rate    float64 `yaml:"rate"`    // registros por segundo
+	Burst   int     `yaml:"burst"`   // registros de uma vez (default: rate, no mínimo 1)
+}
+
+// validate verifica as regras de amostragem.
+func (s SamplingConfig) validate() error {
+	seen := make(map[string]bool, len(s.Rules))
+	for i, r := range s.Rules {
+		switch {
+		case r.Message == "" || r.Message == "*":
+			return fmt.Errorf("logging.sampling.rules[%d].message is required (an exact message or a prefix ending in \"*\")", i)
+		case seen[r.Message]:
+			return fmt.Errorf("logging.sampling.rules[%d]: duplicate message %q", i, r.Message)
+		case r.Rate <= 0:
+			return fmt.Errorf("logging.sampling.rules[%d].rate must be > 0, got %v", i, r.Rate)
+		case r.Burst < 0:
+			return fmt.Errorf("logging.sampling.rules[%d].burst must be >= 0, got %d", i, r.Burst)
+		}
+		seen[r.Message] = true
+	}
+	return nil
+}
+
+// SampleRules converte as regras para logging.SetSampling.
+func (s SamplingConfig) SampleRules() []logging.SampleRule {
+	rules := make([]logging.SampleRule, len(s.Rules))
+	for i, r := range s.Rules {
+		rules[i] = logging.SampleRule{Message: r.Message, Rate: r.Rate, Burst: r.Burst}
+	}
+	return rules
 }
 
 // LoadAgentConfig lê e valida o arquivo YAML de configuração do agent.
@@ -187,9 +615,11 @@ func LoadAgentConfig(path string) (*AgentConfig, error) {
 	}
 
 	var cfg AgentConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	migrations, err := decodeConfig(data, &cfg, agentMigrations)
+	if err != nil {
 		return nil, fmt.Errorf("parsing agent config: %w", err)
 	}
+	cfg.Migrations = migrations
 
 	if err := cfg.validate(); err != nil {
 		return nil, fmt.Errorf("validating agent config: %w", err)
@@ -198,22 +628,163 @@ func LoadAgentConfig(path string) (*AgentConfig, error) {
 	return &cfg, nil
 }
 
+// Faixas de compression.level por algoritmo.
+const (
+	maxGzipLevel = 9
+	maxZstdLevel = 22
+)
+
+func (c *CompressionConfig) validate(i int) error {
+	switch strings.ToLower(strings.TrimSpace(c.Algorithm)) {
+	case "":
+		c.Algorithm = ""
+		if c.Level != 0 {
+			return fmt.Errorf("backups[%d].compression.level requires compression.algorithm (levels differ between gzip and zst)", i)
+		}
+	case "gzip":
+		c.Algorithm = "gzip"
+		if c.Level < 0 || c.Level > maxGzipLevel {
+			return fmt.Errorf("backups[%d].compression.level must be between 1 and %d for gzip, got %d", i, maxGzipLevel, c.Level)
+		}
+	case "zst", "zstd":
+		c.Algorithm = "zst"
+		if c.Level < 0 || c.Level > maxZstdLevel {
+			return fmt.Errorf("backups[%d].compression.level must be between 1 and %d for zst, got %d", i, maxZstdLevel, c.Level)
+		}
+	case CompressionNone:
+		c.Algorithm = CompressionNone
+		if c.Level != 0 {
+			return fmt.Errorf("backups[%d].compression.level is not supported with compression.algorithm: none", i)
+		}
+	default:
+		return fmt.Errorf("backups[%d].compression.algorithm must be gzip, zst or none, got %q", i, c.Algorithm)
+	}
+	if c.Workers < 0 || c.Workers > MaxCompressionWorkers {
+		return fmt.Errorf("backups[%d].compression.workers must be between 0 and %d, got %d", i, MaxCompressionWorkers, c.Workers)
+	}
+	for j, ext := range c.SkipExtensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" || ext == "." || strings.ContainsRune(ext, '/') {
+			return fmt.Errorf("backups[%d].compression.skip_extensions[%d]: invalid extension %q", i, j, c.SkipExtensions[j])
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		c.SkipExtensions[j] = ext
+	}
+	return nil
+}
+
+func (p *ProxyConfig) validate() error {
+	if p.URL == "" {
+		if p.Username != "" || p.Password != "" {
+			return fmt.Errorf("server.proxy.username/password require server.proxy.url")
+		}
+		return nil
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return fmt.Errorf("server.proxy.url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("server.proxy.url: unsupported scheme %q (valid: http, https, socks5)", u.Scheme)
+	}
+	if u.User != nil {
+		return fmt.Errorf("server.proxy.url must not embed credentials, use server.proxy.username/password")
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return fmt.Errorf("server.proxy.url must be scheme://host:port, got %q", p.URL)
+	}
+	if p.Password != "" && p.Username == "" {
+		return fmt.Errorf("server.proxy.password requires server.proxy.username")
+	}
+	if strings.HasPrefix(u.Scheme, "socks5") && (len(p.Username) > 255 || len(p.Password) > 255) {
+		return fmt.Errorf("server.proxy: socks5 username and password must be at most 255 bytes")
+	}
+	return nil
+}
+
 func (c *AgentConfig) validate() error {
 	if c.Agent.Name == "" {
 		return fmt.Errorf("agent.name is required")
 	}
 
-	if c.Server.Address == "" {
+	usesServer := c.UsesServer()
+	if usesServer && c.Server.Address == "" {
 		return fmt.Errorf("server.address is required")
 	}
-	if c.TLS.CACert == "" {
-		return fmt.Errorf("tls.ca_cert is required")
+	switch strings.ToLower(strings.TrimSpace(c.Server.Transport)) {
+	case "", TransportTCP:
+		c.Server.Transport = TransportTCP
+	case TransportQUIC:
+		c.Server.Transport = TransportQUIC
+	case TransportUnix:
+		c.Server.Transport = TransportUnix
+	default:
+		return fmt.Errorf("server.transport: unknown value %q (valid: tcp, quic, unix)", c.Server.Transport)
+	}
+	switch strings.ToLower(strings.TrimSpace(c.Server.Prefer)) {
+	case "", PreferAuto:
+		c.Server.Prefer = PreferAuto
+	case PreferIPv4:
+		c.Server.Prefer = PreferIPv4
+	case PreferIPv6:
+		c.Server.Prefer = PreferIPv6
+	default:
+		return fmt.Errorf("server.prefer: unknown value %q (valid: auto, ipv4, ipv6)", c.Server.Prefer)
+	}
+	if err := c.Server.Proxy.validate(); err != nil {
+		return err
+	}
+	if c.Server.Proxy.Enabled() && c.Server.Transport == TransportQUIC {
+		return fmt.Errorf("server.proxy is not supported with server.transport: quic")
+	}
+	if err := c.Server.Socket.validate("server.socket"); err != nil {
+		return err
+	}
+	if !c.Server.Socket.IsZero() && c.Server.Transport == TransportQUIC {
+		return fmt.Errorf("server.socket is not supported with server.transport: quic (tcp socket options)")
 	}
-	if c.TLS.ClientCert == "" {
-		return fmt.Errorf("tls.client_cert is required")
+	// Com transport unix o server identifica o agent pelo uid do processo
+	// (SO_PEERCRED): não há TLS nem PSK, e as opções de rede não se aplicam
+	usesTLS := usesServer
+	if c.Server.Transport == TransportUnix {
+		switch {
+		case c.Server.Proxy.Enabled():
+			return fmt.Errorf("server.proxy is not supported with server.transport: unix")
+		case !c.Server.Socket.IsZero():
+			return fmt.Errorf("server.socket is not supported with server.transport: unix (tcp socket options)")
+		case c.TLS.Auth == AuthModePSK:
+			return fmt.Errorf("tls.auth psk is not supported with server.transport: unix (identity comes from SO_PEERCRED)")
+		}
+		usesTLS = false
+	}
+	if usesTLS && c.TLS.CACert == "" {
+		return fmt.Errorf("tls.ca_cert is required")
 	}
-	if c.TLS.ClientKey == "" {
-		return fmt.Errorf("tls.client_key is required")
+	switch c.TLS.Auth {
+	case "", AuthModeMTLS:
+		c.TLS.Auth = AuthModeMTLS
+		if !usesTLS {
+			break
+		}
+		if c.TLS.ClientCert == "" {
+			return fmt.Errorf("tls.client_cert is required")
+		}
+		if c.TLS.ClientKey == "" {
+			return fmt.Errorf("tls.client_key is required")
+		}
+	case AuthModePSK:
+		if usesServer && c.TLS.PSKFile == "" {
+			return fmt.Errorf("tls.psk_file is required when tls.auth is psk")
+		}
+		if len(c.Agent.Name) > 255 {
+			return fmt.Errorf("agent.name too long for psk auth: %d bytes, maximum 255", len(c.Agent.Name))
+		}
+	default:
+		return fmt.Errorf("tls.auth must be %q or %q, got %q", AuthModeMTLS, AuthModePSK, c.TLS.Auth)
 	}
 	if len(c.Backups) == 0 {
 		return fmt.Errorf("backups must have at least one entry")
@@ -222,7 +793,35 @@ func (c *AgentConfig) validate() error {
 		if b.Name == "" {
 			return fmt.Errorf("backups[%d].name is required", i)
 		}
-		if b.Storage == "" {
+		if err := c.Backups[i].Compression.validate(i); err != nil {
+			return err
+		}
+		b.Compression = c.Backups[i].Compression
+		if b.Local.Enabled() {
+			if !filepath.IsAbs(b.Local.Path) {
+				return fmt.Errorf("backups[%d].local.path must be absolute, got %q", i, b.Local.Path)
+			}
+			if b.Local.MaxBackups < 0 {
+				return fmt.Errorf("backups[%d].local.max_backups must be >= 0, got %d", i, b.Local.MaxBackups)
+			}
+			if b.Local.MaxBackups == 0 {
+				c.Backups[i].Local.MaxBackups = 5
+			}
+			if b.Local.CompressionMode == "" && b.Compression.Algorithm != CompressionNone {
+				b.Local.CompressionMode = b.Compression.Algorithm
+				c.Backups[i].Local.CompressionMode = b.Compression.Algorithm
+			}
+			if b.Compression.Algorithm != "" && b.Compression.Algorithm != CompressionNone && b.Local.CompressionMode != b.Compression.Algorithm {
+				return fmt.Errorf("backups[%d].compression.algorithm %q conflicts with local.compression_mode %q", i, b.Compression.Algorithm, b.Local.CompressionMode)
+			}
+			switch b.Local.CompressionMode {
+			case "":
+				c.Backups[i].Local.CompressionMode = "gzip"
+			case "gzip", "zst":
+			default:
+				return fmt.Errorf("backups[%d].local.compression_mode must be gzip or zst, got %q", i, b.Local.CompressionMode)
+			}
+		} else if b.Storage == "" {
 			return fmt.Errorf("backups[%d].storage is required", i)
 		}
 		if len(b.Sources) == 0 {
@@ -232,13 +831,83 @@ func (c *AgentConfig) validate() error {
 			if src.Path == "" {
 				return fmt.Errorf("backups[%d].sources[%d].path is required", i, j)
 			}
+			if err := parseSourceFilters(&c.Backups[i].Sources[j]); err != nil {
+				return fmt.Errorf("backups[%d].sources[%d].%w", i, j, err)
+			}
+		}
+		for field, patterns := range map[string][]string{"include": b.Include, "exclude": b.Exclude} {
+			for j, p := range patterns {
+				if expr, ok := strings.CutPrefix(p, "re:"); ok {
+					if _, err := regexp.Compile(expr); err != nil {
+						return fmt.Errorf("backups[%d].%s[%d]: invalid regex %q: %w", i, field, j, expr, err)
+					}
+				}
+			}
 		}
-		if b.Schedule == "" {
+		if b.Snapshot.Coordinated {
+			if b.Schedule != "" {
+				return fmt.Errorf("backups[%d].schedule must be empty with snapshot.coordinated (the server triggers the backup)", i)
+			}
+			if b.CatchUp {
+				return fmt.Errorf("backups[%d].catch_up is not supported with snapshot.coordinated", i)
+			}
+			if b.Local.Enabled() {
+				return fmt.Errorf("backups[%d].snapshot.coordinated is not supported with local", i)
+			}
+		} else if b.Schedule == "" {
 			return fmt.Errorf("backups[%d].schedule is required", i)
 		}
+		if b.Snapshot.CleanupCommand != "" && !b.Snapshot.Enabled() {
+			return fmt.Errorf("backups[%d].snapshot.cleanup_command requires snapshot.command or snapshot.coordinated", i)
+		}
+		if b.Snapshot.Timeout < 0 {
+			return fmt.Errorf("backups[%d].snapshot.timeout must be >= 0, got %s", i, b.Snapshot.Timeout)
+		}
+		if b.Snapshot.Timeout == 0 {
+			c.Backups[i].Snapshot.Timeout = 5 * time.Minute
+		}
 		if b.Parallels < 0 || b.Parallels > 255 {
 			return fmt.Errorf("backups[%d].parallels must be between 0 and 255, got %d", i, b.Parallels)
 		}
+		if b.ProducerShards < 0 || b.ProducerShards > MaxProducerShards {
+			return fmt.Errorf("backups[%d].producer_shards must be between 0 and %d, got %d", i, MaxProducerShards, b.ProducerShards)
+		}
+		switch strings.ToLower(strings.TrimSpace(b.ParallelTransport)) {
+		case "", ParallelTransportSockets:
+			c.Backups[i].ParallelTransport = ParallelTransportSockets
+		case ParallelTransportMux:
+			if b.Parallels == 0 {
+				return fmt.Errorf("backups[%d].parallel_transport: mux requires parallels > 0", i)
+			}
+			// Rotação de source port não tem efeito com uma única conexão
+			if b.PortRotation.EffectiveChunksPerCycle() > 0 {
+				return fmt.Errorf("backups[%d].port_rotation is not supported with parallel_transport: mux", i)
+			}
+			c.Backups[i].ParallelTransport = ParallelTransportMux
+		default:
+			return fmt.Errorf("backups[%d].parallel_transport: unknown value %q (valid: sockets, mux)", i, b.ParallelTransport)
+		}
+		// Com QUIC todos os streams compartilham um socket UDP: não há conexão
+		// por stream para multiplexar, rotacionar ou marcar
+		if c.Server.Transport == TransportQUIC {
+			switch {
+			case c.Backups[i].ParallelTransport == ParallelTransportMux:
+				return fmt.Errorf("backups[%d].parallel_transport: mux is not supported with server.transport: quic", i)
+			case b.PortRotation.EffectiveChunksPerCycle() > 0:
+				return fmt.Errorf("backups[%d].port_rotation is not supported with server.transport: quic", i)
+			case b.DSCP != "":
+				return fmt.Errorf("backups[%d].dscp is not supported with server.transport: quic", i)
+			}
+		}
+		// Socket unix não tem source port nem cabeçalho IP
+		if c.Server.Transport == TransportUnix {
+			switch {
+			case b.PortRotation.EffectiveChunksPerCycle() > 0:
+				return fmt.Errorf("backups[%d].port_rotation is not supported with server.transport: unix", i)
+			case b.DSCP != "":
+				return fmt.Errorf("backups[%d].dscp is not supported with server.transport: unix", i)
+			}
+		}
 		if b.DSCP != "" {
 			dscp := strings.TrimSpace(strings.ToUpper(b.DSCP))
 			validDSCP := map[string]bool{
@@ -287,6 +956,65 @@ func (c *AgentConfig) validate() error {
 		default:
 			return fmt.Errorf("backups[%d].port_rotation.mode: unknown value %q (valid: off, per-n-chunks)", i, b.PortRotation.Mode)
 		}
+		if b.Jitter < 0 {
+			return fmt.Errorf("backups[%d].jitter must be >= 0, got %s", i, b.Jitter)
+		}
+		if b.MinInterval < 0 {
+			return fmt.Errorf("backups[%d].min_interval must be >= 0, got %s", i, b.MinInterval)
+		}
+		if b.HealthcheckURL != "" {
+			u, err := url.Parse(b.HealthcheckURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("backups[%d].healthcheck_url: expected an http(s) URL, got %q", i, b.HealthcheckURL)
+			}
+		}
+		if b.MinStorageFree != "" {
+			if b.Local.Enabled() {
+				return fmt.Errorf("backups[%d].min_storage_free is not supported with local", i)
+			}
+			minFree, err := ParseByteSize(b.MinStorageFree)
+			if err != nil {
+				return fmt.Errorf("backups[%d].min_storage_free: %w", i, err)
+			}
+			if minFree <= 0 {
+				return fmt.Errorf("backups[%d].min_storage_free must be > 0, got %s", i, b.MinStorageFree)
+			}
+			c.Backups[i].MinStorageFreeRaw = minFree
+		}
+		if b.MaxSize != "" {
+			maxSize, err := ParseByteSize(b.MaxSize)
+			if err != nil {
+				return fmt.Errorf("backups[%d].max_size: %w", i, err)
+			}
+			if maxSize <= 0 {
+				return fmt.Errorf("backups[%d].max_size must be > 0, got %s", i, b.MaxSize)
+			}
+			c.Backups[i].MaxSizeRaw = maxSize
+		}
+		if b.Assertions.MinBytes != "" {
+			minBytes, err := ParseByteSize(b.Assertions.MinBytes)
+			if err != nil {
+				return fmt.Errorf("backups[%d].assertions.min_bytes: %w", i, err)
+			}
+			if minBytes <= 0 {
+				return fmt.Errorf("backups[%d].assertions.min_bytes must be > 0, got %s", i, b.Assertions.MinBytes)
+			}
+			c.Backups[i].Assertions.MinBytesRaw = minBytes
+		}
+		if b.Assertions.MinObjects < 0 {
+			return fmt.Errorf("backups[%d].assertions.min_objects must be >= 0, got %d", i, b.Assertions.MinObjects)
+		}
+		for j, p := range b.Assertions.RequiredPaths {
+			if !filepath.IsAbs(p) {
+				return fmt.Errorf("backups[%d].assertions.required_paths[%d] must be an absolute path, got %q", i, j, p)
+			}
+		}
+	}
+	if c.Daemon.StateDir == "" {
+		c.Daemon.StateDir = "/var/lib/nbackup/agent"
+	}
+	if err := c.Notifications.validate(); err != nil {
+		return err
 	}
 	if c.Retry.MaxAttempts <= 0 {
 		c.Retry.MaxAttempts = 5
@@ -303,6 +1031,18 @@ func (c *AgentConfig) validate() error {
 	if c.Logging.Format == "" {
 		c.Logging.Format = "json"
 	}
+	if err := c.Logging.Redact.validate(); err != nil {
+		return err
+	}
+	if err := c.Logging.Sampling.validate(); err != nil {
+		return err
+	}
+	if err := c.Logging.validateTarget(); err != nil {
+		return err
+	}
+	if err := c.Logging.validateRotation(); err != nil {
+		return err
+	}
 
 	// Resume defaults
 	if c.Resume.BufferSize == "" {
@@ -330,10 +1070,74 @@ func (c *AgentConfig) validate() error {
 	}
 	c.Resume.ChunkSizeRaw = chunkParsed
 
+	// Limites do chunk adaptativo: vazio = chunk_size (ajuste desabilitado)
+	if c.Resume.ChunkSizeMin == "" {
+		c.Resume.ChunkSizeMin = c.Resume.ChunkSize
+	}
+	if c.Resume.ChunkSizeMax == "" {
+		c.Resume.ChunkSizeMax = c.Resume.ChunkSize
+	}
+	for _, b := range []struct {
+		name  string
+		value string
+		raw   *int64
+	}{
+		{"chunk_size_min", c.Resume.ChunkSizeMin, &c.Resume.ChunkSizeMinRaw},
+		{"chunk_size_max", c.Resume.ChunkSizeMax, &c.Resume.ChunkSizeMaxRaw},
+	} {
+		v, err := ParseByteSize(b.value)
+		if err != nil {
+			return fmt.Errorf("resume.%s: %w", b.name, err)
+		}
+		if v < 64*1024 || v > 16*1024*1024 {
+			return fmt.Errorf("resume.%s must be between 64kb and 16mb, got %s", b.name, b.value)
+		}
+		*b.raw = v
+	}
+	if c.Resume.ChunkSizeMinRaw > c.Resume.ChunkSizeRaw || c.Resume.ChunkSizeMaxRaw < c.Resume.ChunkSizeRaw {
+		return fmt.Errorf("resume.chunk_size (%s) must be between resume.chunk_size_min (%s) and resume.chunk_size_max (%s)",
+			c.Resume.ChunkSize, c.Resume.ChunkSizeMin, c.Resume.ChunkSizeMax)
+	}
+
+	// Janela de SACK: vazio ou "auto" = calculada pelo agent no handshake
+	if c.Resume.SACKInterval == "" {
+		c.Resume.SACKInterval = "auto"
+	}
+	if c.Resume.SACKInterval != "auto" {
+		v, err := ParseByteSize(c.Resume.SACKInterval)
+		if err != nil {
+			return fmt.Errorf("resume.sack_interval: %w", err)
+		}
+		if v < protocol.MinSACKInterval || v > protocol.MaxSACKInterval {
+			return fmt.Errorf("resume.sack_interval must be between 64kb and 64mb, got %s", c.Resume.SACKInterval)
+		}
+		c.Resume.SACKIntervalRaw = v
+	}
+	if c.Resume.MaxInFlight == "" {
+		c.Resume.MaxInFlight = "auto"
+	}
+	if c.Resume.MaxInFlight != "auto" {
+		v, err := ParseByteSize(c.Resume.MaxInFlight)
+		if err != nil {
+			return fmt.Errorf("resume.max_inflight: %w", err)
+		}
+		if v < 1024*1024 {
+			return fmt.Errorf("resume.max_inflight must be at least 1mb, got %s", c.Resume.MaxInFlight)
+		}
+		if v > c.Resume.BufferSizeRaw {
+			return fmt.Errorf("resume.max_inflight (%s) must not exceed resume.buffer_size (%s)", c.Resume.MaxInFlight, c.Resume.BufferSize)
+		}
+		if c.Resume.SACKIntervalRaw > v/2 {
+			return fmt.Errorf("resume.sack_interval (%s) must be at most half of resume.max_inflight (%s)", c.Resume.SACKInterval, c.Resume.MaxInFlight)
+		}
+		c.Resume.MaxInFlightRaw = v
+	}
+
 	// Control channel defaults
 	cc := &c.Daemon.ControlChannel
 	if cc.Enabled == nil {
-		defaultEnabled := true
+		// Sem backups para o server não há com quem manter o canal
+		defaultEnabled := usesServer
 		cc.Enabled = &defaultEnabled
 	}
 	if cc.KeepaliveInterval <= 0 {
@@ -352,6 +1156,81 @@ func (c *AgentConfig) validate() error {
 		cc.MaxReconnectDelay = cc.ReconnectDelay
 	}
 
+	// Admin socket defaults
+	as := &c.Daemon.AdminSocket
+	if as.Enabled == nil {
+		defaultEnabled := true
+		as.Enabled = &defaultEnabled
+	}
+	if as.Path == "" {
+		as.Path = "/run/nbackup/agent.sock"
+	}
+
+	// Shutdown defaults
+	sd := &c.Daemon.Shutdown
+	switch sd.Mode {
+	case "":
+		sd.Mode = ShutdownModeWait
+	case ShutdownModeWait, ShutdownModeAbort:
+	default:
+		return fmt.Errorf("daemon.shutdown.mode must be %q or %q, got %q", ShutdownModeWait, ShutdownModeAbort, sd.Mode)
+	}
+	if sd.Timeout < 0 {
+		return fmt.Errorf("daemon.shutdown.timeout must be >= 0, got %s", sd.Timeout)
+	}
+	if sd.Timeout == 0 {
+		sd.Timeout = 5 * time.Minute
+	}
+
+	if c.Daemon.MaxConcurrentBackups < 0 {
+		return fmt.Errorf("daemon.max_concurrent_backups must be >= 0, got %d", c.Daemon.MaxConcurrentBackups)
+	}
+	if c.Daemon.BandwidthLimit != "" {
+		bw, err := ParseByteSize(c.Daemon.BandwidthLimit)
+		if err != nil {
+			return fmt.Errorf("daemon.bandwidth_limit: %w", err)
+		}
+		if bw < 64*1024 {
+			return fmt.Errorf("daemon.bandwidth_limit must be at least 64kb, got %s", c.Daemon.BandwidthLimit)
+		}
+		c.Daemon.BandwidthLimitRaw = bw
+	}
+
+	return nil
+}
+
+// parseSourceFilters valida e converte os filtros de tamanho e idade de um
+// source. O erro começa pelo nome do campo.
+func parseSourceFilters(src *BackupSource) error {
+	for _, f := range []struct {
+		name string
+		raw  string
+		dst  *int64
+	}{
+		{"min_file_size", src.MinFileSize, &src.MinFileSizeRaw},
+		{"max_file_size", src.MaxFileSize, &src.MaxFileSizeRaw},
+	} {
+		if f.raw == "" {
+			continue
+		}
+		v, err := ParseByteSize(f.raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+		if v <= 0 {
+			return fmt.Errorf("%s must be > 0, got %s", f.name, f.raw)
+		}
+		*f.dst = v
+	}
+	if src.MinFileSizeRaw > 0 && src.MaxFileSizeRaw > 0 && src.MinFileSizeRaw > src.MaxFileSizeRaw {
+		return fmt.Errorf("min_file_size (%s) must not exceed max_file_size (%s)", src.MinFileSize, src.MaxFileSize)
+	}
+	if src.ModifiedWithin < 0 || src.ModifiedBefore < 0 {
+		return fmt.Errorf("modified_within and modified_before must be >= 0")
+	}
+	if src.ModifiedWithin > 0 && src.ModifiedBefore > 0 && src.ModifiedBefore >= src.ModifiedWithin {
+		return fmt.Errorf("modified_before (%s) must be shorter than modified_within (%s), or no file matches", src.ModifiedBefore, src.ModifiedWithin)
+	}
 	return nil
 }
 
@@ -369,6 +1248,7 @@ func ParseByteSize(s string) (int64, error) {
 		m int64
 	}
 	suffixes := []suffix{
+		{"tb", 1024 * 1024 * 1024 * 1024},
 		{"gb", 1024 * 1024 * 1024},
 		{"mb", 1024 * 1024},
 		{"kb", 1024},
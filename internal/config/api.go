@@ -0,0 +1,153 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Roles dos tokens da API REST (web_ui.api_tokens).
+const (
+	APIRoleViewer = "viewer" // leitura: observabilidade e catálogo
+	APIRoleAdmin  = "admin"  // leitura + ações de gerenciamento
+)
+
+// minAPITokenLength é o tamanho mínimo de um token da API.
+const minAPITokenLength = 16
+
+// APITokenConfig é um token de acesso à API REST do server.
+type APITokenConfig struct {
+	Name      string `yaml:"name"`       // identifica o token nos logs e eventos (obrigatório, único)
+	Token     string `yaml:"token"`      // valor do token (ou token_file)
+	TokenFile string `yaml:"token_file"` // arquivo com o token (conteúdo sem espaços nas pontas)
+	Role      string `yaml:"role"`       // viewer | admin (default: viewer)
+}
+
+// validateAPITokens valida os tokens da API e resolve token_file.
+func validateAPITokens(tokens []APITokenConfig) error {
+	names := make(map[string]struct{}, len(tokens))
+	values := make(map[string]struct{}, len(tokens))
+	for i := range tokens {
+		t := &tokens[i]
+		prefix := fmt.Sprintf("web_ui.api_tokens[%d]", i)
+
+		if t.Name == "" {
+			return fmt.Errorf("%s.name is required", prefix)
+		}
+		if _, dup := names[t.Name]; dup {
+			return fmt.Errorf("%s: duplicate name %q", prefix, t.Name)
+		}
+		names[t.Name] = struct{}{}
+
+		switch {
+		case t.Token != "" && t.TokenFile != "":
+			return fmt.Errorf("%s: token and token_file are mutually exclusive", prefix)
+		case t.TokenFile != "":
+			data, err := os.ReadFile(t.TokenFile)
+			if err != nil {
+				return fmt.Errorf("%s: reading token_file: %w", prefix, err)
+			}
+			t.Token = strings.TrimSpace(string(data))
+		case t.Token == "":
+			return fmt.Errorf("%s: token or token_file is required", prefix)
+		}
+		if len(t.Token) < minAPITokenLength {
+			return fmt.Errorf("%s: token must have at least %d characters", prefix, minAPITokenLength)
+		}
+		if _, dup := values[t.Token]; dup {
+			return fmt.Errorf("%s: token is already used by another entry", prefix)
+		}
+		values[t.Token] = struct{}{}
+
+		if t.Role == "" {
+			t.Role = APIRoleViewer
+		}
+		if t.Role != APIRoleViewer && t.Role != APIRoleAdmin {
+			return fmt.Errorf("%s.role: invalid value %q (expected %s or %s)", prefix, t.Role, APIRoleViewer, APIRoleAdmin)
+		}
+	}
+	return nil
+}
+
+// Roles dos usuários da WebUI (web_ui.users).
+const (
+	WebUIRoleViewer   = "viewer"   // leitura: observabilidade, histórico e catálogo
+	WebUIRoleOperator = "operator" // leitura + cancelar/expirar sessões, rotação e quarentena
+)
+
+// PasswordHashScheme é o prefixo de web_ui.users[].password_hash, no formato
+// pbkdf2-sha256$<iterações>$<salt base64>$<chave base64> (gerado por
+// `nbackup-server webui passwd`).
+const PasswordHashScheme = "pbkdf2-sha256"
+
+// MinPasswordHashIterations é o mínimo de iterações PBKDF2 aceito.
+const MinPasswordHashIterations = 100000
+
+// WebUIUserConfig é um usuário local da WebUI. Com usuários configurados, a
+// WebUI e a API exigem login (ou token Bearer).
+type WebUIUserConfig struct {
+	Name         string `yaml:"name"`          // login (obrigatório, único)
+	PasswordHash string `yaml:"password_hash"` // pbkdf2-sha256$... (nunca a senha em claro)
+	Role         string `yaml:"role"`          // viewer | operator (default: viewer)
+}
+
+// ParsePasswordHash decompõe um password_hash no formato PasswordHashScheme.
+func ParsePasswordHash(s string) (iterations int, salt, key []byte, err error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 4 || parts[0] != PasswordHashScheme {
+		return 0, nil, nil, fmt.Errorf("expected %s$<iterations>$<salt>$<key>", PasswordHashScheme)
+	}
+	iterations, err = strconv.Atoi(parts[1])
+	if err != nil || iterations < MinPasswordHashIterations {
+		return 0, nil, nil, fmt.Errorf("iterations must be a number >= %d", MinPasswordHashIterations)
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil || len(salt) < 8 {
+		return 0, nil, nil, fmt.Errorf("invalid salt")
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil || len(key) < 16 {
+		return 0, nil, nil, fmt.Errorf("invalid key")
+	}
+	return iterations, salt, key, nil
+}
+
+// validateWebUIUsers valida os usuários da WebUI. Os nomes não podem colidir
+// com os dos tokens da API, para que a auditoria identifique o autor.
+func validateWebUIUsers(users []WebUIUserConfig, tokens []APITokenConfig) error {
+	names := make(map[string]struct{}, len(users))
+	for _, t := range tokens {
+		names[t.Name] = struct{}{}
+	}
+	for i := range users {
+		u := &users[i]
+		prefix := fmt.Sprintf("web_ui.users[%d]", i)
+
+		if u.Name == "" {
+			return fmt.Errorf("%s.name is required", prefix)
+		}
+		if _, dup := names[u.Name]; dup {
+			return fmt.Errorf("%s: duplicate name %q (user and api token names must be unique)", prefix, u.Name)
+		}
+		names[u.Name] = struct{}{}
+
+		if u.PasswordHash == "" {
+			return fmt.Errorf("%s.password_hash is required (generate with `nbackup-server webui passwd`)", prefix)
+		}
+		if _, _, _, err := ParsePasswordHash(u.PasswordHash); err != nil {
+			return fmt.Errorf("%s.password_hash: %w", prefix, err)
+		}
+
+		if u.Role == "" {
+			u.Role = WebUIRoleViewer
+		}
+		if u.Role != WebUIRoleViewer && u.Role != WebUIRoleOperator {
+			return fmt.Errorf("%s.role: invalid value %q (expected %s or %s)", prefix, u.Role, WebUIRoleViewer, WebUIRoleOperator)
+		}
+	}
+	return nil
+}
@@ -5,8 +5,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
@@ -307,6 +310,236 @@ backups:
 	}
 }
 
+func TestLoadAgentConfig_ParallelTransport(t *testing.T) {
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"    parallels: 4\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Backups[0].ParallelTransport; got != ParallelTransportSockets {
+		t.Errorf("expected default transport sockets, got %q", got)
+	}
+
+	cfg, err = LoadAgentConfig(writeTempConfig(t, validAgentYAML+"    parallels: 4\n    parallel_transport: MUX\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Backups[0].ParallelTransport; got != ParallelTransportMux {
+		t.Errorf("expected transport mux, got %q", got)
+	}
+
+	for name, extra := range map[string]string{
+		"unknown transport":     "    parallels: 4\n    parallel_transport: quic\n",
+		"mux without parallels": "    parallel_transport: mux\n",
+		"mux with port rotation": "    parallels: 4\n    parallel_transport: mux\n" +
+			"    port_rotation:\n      mode: per-n-chunks\n      chunks_per_cycle: 10\n",
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+extra)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_ServerTransport(t *testing.T) {
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Transport != TransportTCP {
+		t.Errorf("expected default transport tcp, got %q", cfg.Server.Transport)
+	}
+
+	quic := strings.Replace(validAgentYAML, `address: "localhost:9847"`, "address: \"localhost:9847\"\n  transport: QUIC", 1)
+	cfg, err = LoadAgentConfig(writeTempConfig(t, quic+"    parallels: 4\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Transport != TransportQUIC {
+		t.Errorf("expected transport quic, got %q", cfg.Server.Transport)
+	}
+
+	for name, content := range map[string]string{
+		"unknown transport": strings.Replace(validAgentYAML, `address: "localhost:9847"`, "address: \"localhost:9847\"\n  transport: sctp", 1),
+		"quic with mux":     quic + "    parallels: 4\n    parallel_transport: mux\n",
+		"quic with dscp":    quic + "    dscp: AF41\n",
+		"quic with port rotation": quic + "    parallels: 4\n" +
+			"    port_rotation:\n      mode: per-n-chunks\n      chunks_per_cycle: 10\n",
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_ServerTransportUnix(t *testing.T) {
+	unixYAML := `
+agent:
+  name: "test-agent"
+server:
+  address: /run/nbackup/agent.sock
+  transport: unix
+backups:
+  - name: "test"
+    storage: "default"
+    schedule: "0 2 * * *"
+    sources:
+      - path: /tmp
+`
+	cfg, err := LoadAgentConfig(writeTempConfig(t, unixYAML+"    parallels: 4\n    parallel_transport: mux\n"))
+	if err != nil {
+		t.Fatalf("unix transport must not require tls: %v", err)
+	}
+	if cfg.Server.Transport != TransportUnix {
+		t.Errorf("expected transport unix, got %q", cfg.Server.Transport)
+	}
+
+	for name, content := range map[string]string{
+		"unix with psk":    strings.Replace(unixYAML, "backups:", "tls:\n  auth: psk\n  psk_file: /tmp/agent.psk\nbackups:", 1),
+		"unix with proxy":  strings.Replace(unixYAML, "  transport: unix", "  transport: unix\n  proxy:\n    url: \"http://proxy.corp:3128\"", 1),
+		"unix with socket": strings.Replace(unixYAML, "  transport: unix", "  transport: unix\n  socket:\n    keepalive: 30s", 1),
+		"unix with dscp":   unixYAML + "    dscp: AF41\n",
+		"unix with port rotation": unixYAML + "    parallels: 4\n" +
+			"    port_rotation:\n      mode: per-n-chunks\n      chunks_per_cycle: 10\n",
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_ServerProxy(t *testing.T) {
+	withProxy := func(proxy string) string {
+		return strings.Replace(validAgentYAML, `address: "localhost:9847"`, "address: \"localhost:9847\"\n  proxy:\n"+proxy, 1)
+	}
+
+	cfg, err := LoadAgentConfig(writeTempConfig(t, withProxy("    url: \"socks5://proxy.corp:1080\"\n    username: backup\n    password: s3cret\n")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Server.Proxy.Enabled() || cfg.Server.Proxy.Username != "backup" {
+		t.Errorf("unexpected proxy config: %+v", cfg.Server.Proxy)
+	}
+	if _, err := LoadAgentConfig(writeTempConfig(t, withProxy("    url: \"http://proxy.corp:3128\"\n"))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"unknown scheme":          withProxy("    url: \"ftp://proxy.corp:21\"\n"),
+		"missing port":            withProxy("    url: \"http://proxy.corp\"\n"),
+		"credentials in url":      withProxy("    url: \"http://u:p@proxy.corp:3128\"\n"),
+		"password with no user":   withProxy("    url: \"http://proxy.corp:3128\"\n    password: s3cret\n"),
+		"credentials with no url": withProxy("    username: backup\n"),
+		"proxy with quic": strings.Replace(withProxy("    url: \"http://proxy.corp:3128\"\n"),
+			"  proxy:", "  transport: quic\n  proxy:", 1),
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_ServerPrefer(t *testing.T) {
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Prefer != PreferAuto {
+		t.Errorf("expected default prefer auto, got %q", cfg.Server.Prefer)
+	}
+
+	withPrefer := func(v string) string {
+		return strings.Replace(validAgentYAML, `address: "localhost:9847"`, "address: \"localhost:9847\"\n  prefer: "+v, 1)
+	}
+	cfg, err = LoadAgentConfig(writeTempConfig(t, withPrefer("IPv6")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Prefer != PreferIPv6 {
+		t.Errorf("expected prefer ipv6, got %q", cfg.Server.Prefer)
+	}
+	if _, err := LoadAgentConfig(writeTempConfig(t, withPrefer("inet6"))); err == nil {
+		t.Error("expected error for unknown server.prefer")
+	}
+}
+
+func TestLoadAgentConfig_ServerSocket(t *testing.T) {
+	withSocket := func(socket string) string {
+		return strings.Replace(validAgentYAML, `address: "localhost:9847"`, "address: \"localhost:9847\"\n  socket:\n"+socket, 1)
+	}
+
+	cfg, err := LoadAgentConfig(writeTempConfig(t, withSocket("    keepalive: 30s\n    user_timeout: 2m\n    send_buffer: 4mb\n    congestion: bbr\n")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := cfg.Server.Socket
+	if s.SendBufferRaw != 4*1024*1024 || s.ReceiveBufferRaw != 0 || s.UserTimeout != 2*time.Minute || s.Congestion != "bbr" {
+		t.Errorf("unexpected socket config: %+v", s)
+	}
+
+	for name, content := range map[string]string{
+		"buffer too small":   withSocket("    receive_buffer: 1kb\n"),
+		"invalid buffer":     withSocket("    send_buffer: lots\n"),
+		"sub-second timeout": withSocket("    user_timeout: 500ms\n"),
+		"invalid congestion": withSocket("    congestion: \"bbr; rm\"\n"),
+		"socket with quic":   strings.Replace(withSocket("    keepalive: 30s\n"), "  socket:", "  transport: quic\n  socket:", 1),
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_Compression(t *testing.T) {
+	withCompression := func(comp string) string {
+		return validAgentYAML + "    compression:\n" + comp
+	}
+
+	cfg, err := LoadAgentConfig(writeTempConfig(t, withCompression("      algorithm: ZSTD\n      level: 19\n      workers: 4\n      skip_extensions: [DAT, \".iso\"]\n")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := cfg.Backups[0].Compression
+	if c.Algorithm != "zst" || c.Level != 19 || c.Workers != 4 || !c.SkipCompressedEnabled() {
+		t.Errorf("unexpected compression config: %+v", c)
+	}
+	if strings.Join(c.SkipExtensions, ",") != ".dat,.iso" {
+		t.Errorf("expected normalized extensions, got %v", c.SkipExtensions)
+	}
+
+	cfg, err = LoadAgentConfig(writeTempConfig(t, withCompression("      algorithm: NONE\n")))
+	if err != nil || cfg.Backups[0].Compression.Algorithm != CompressionNone {
+		t.Errorf("expected algorithm none to be accepted, got %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"level without algorithm": withCompression("      level: 5\n"),
+		"gzip level too high":     withCompression("      algorithm: gzip\n      level: 12\n"),
+		"unknown algorithm":       withCompression("      algorithm: brotli\n"),
+		"invalid extension":       withCompression("      skip_extensions: [\"a/b\"]\n"),
+		"too many workers":        withCompression("      workers: 1000\n"),
+		"level with none":         withCompression("      algorithm: none\n      level: 3\n"),
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_ProducerShards(t *testing.T) {
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"    producer_shards: 4\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Backups[0].ProducerShards != 4 {
+		t.Errorf("expected producer_shards 4, got %d", cfg.Backups[0].ProducerShards)
+	}
+
+	for _, v := range []string{"-1", "33"} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"    producer_shards: "+v+"\n")); err == nil {
+			t.Errorf("producer_shards %s: expected error", v)
+		}
+	}
+}
+
 func TestLoadAgentConfig_AutoScalerLegacyString(t *testing.T) {
 	content := `
 agent:
@@ -444,6 +677,177 @@ storages:
 	}
 }
 
+func TestLoadServerConfig_IngestLimit(t *testing.T) {
+	base := `
+server:
+  listen: "0.0.0.0:9847"
+tls:
+  ca_cert: /tmp/ca.pem
+  server_cert: /tmp/server.pem
+  server_key: /tmp/server-key.pem
+ingest_limit: %s
+storages:
+  default:
+    base_dir: /tmp/backups
+    ingest_limit: %s
+`
+	cfg, err := LoadServerConfig(writeTempConfig(t, fmt.Sprintf(base, "800mb", "200mb")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, _ := cfg.GetStorage("default")
+	if cfg.IngestLimitRaw != 800*1024*1024 || s.IngestLimitRaw != 200*1024*1024 {
+		t.Errorf("unexpected limits: global=%d storage=%d", cfg.IngestLimitRaw, s.IngestLimitRaw)
+	}
+
+	for _, tc := range [][2]string{{"10kb", `""`}, {`""`, "fast"}} {
+		if _, err := LoadServerConfig(writeTempConfig(t, fmt.Sprintf(base, tc[0], tc[1]))); err == nil {
+			t.Errorf("expected error for ingest_limit %v", tc)
+		}
+	}
+}
+
+func TestLoadServerConfig_StreamBudget(t *testing.T) {
+	base := `
+server:
+  listen: "0.0.0.0:9847"
+tls:
+  ca_cert: /tmp/ca.pem
+  server_cert: /tmp/server.pem
+  server_key: /tmp/server-key.pem
+stream_budget: %d
+storages:
+  default:
+    base_dir: /tmp/backups
+`
+	cfg, err := LoadServerConfig(writeTempConfig(t, fmt.Sprintf(base, 96)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.StreamBudget != 96 {
+		t.Errorf("expected stream_budget 96, got %d", cfg.StreamBudget)
+	}
+	if _, err := LoadServerConfig(writeTempConfig(t, fmt.Sprintf(base, -1))); err == nil {
+		t.Error("expected error for negative stream_budget")
+	}
+}
+
+func TestLoadServerConfig_Listeners(t *testing.T) {
+	base := `
+server:
+  listen: "0.0.0.0:9847"
+  socket:
+    keepalive: 30s
+tls:
+  ca_cert: /tmp/ca.pem
+  server_cert: /tmp/server.pem
+  server_key: /tmp/server-key.pem
+storages:
+  default:
+    base_dir: /tmp/backups
+listeners:
+%s`
+	cfg, err := LoadServerConfig(writeTempConfig(t, fmt.Sprintf(base, `
+  - name: lan
+    listen: "10.0.0.1:9847"
+  - name: wan
+    listen: "203.0.113.10:443"
+    tls:
+      server_cert: /tmp/wan.pem
+      server_key: /tmp/wan-key.pem
+    allowed_agents: [" branch-01 ", branch-02]
+    ingest_limit: 50mb
+`)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lan, wan := cfg.Listeners[0], cfg.Listeners[1]
+	if lan.Auth != AuthModeMTLS || lan.TLS.ServerCert != "/tmp/server.pem" || lan.Socket.KeepAlive != 30*time.Second {
+		t.Errorf("expected lan to inherit server and tls defaults, got %+v", lan)
+	}
+	if wan.TLS.CACert != "/tmp/ca.pem" || wan.TLS.ServerCert != "/tmp/wan.pem" {
+		t.Errorf("unexpected wan tls: %+v", wan.TLS)
+	}
+	if wan.AllowedAgents[0] != "branch-01" || wan.IngestLimitRaw != 50*1024*1024 {
+		t.Errorf("unexpected wan policy: %+v", wan)
+	}
+	if cfg.PSKEnabled() {
+		t.Error("expected psk disabled")
+	}
+
+	for name, listeners := range map[string]string{
+		"missing name":        "  - listen: \"10.0.0.1:9847\"\n",
+		"duplicate name":      "  - name: lan\n    listen: \"10.0.0.1:9847\"\n  - name: lan\n    listen: \"10.0.0.2:9847\"\n",
+		"address in use":      "  - name: lan\n    listen: \"0.0.0.0:9847\"\n",
+		"invalid auth":        "  - name: lan\n    listen: \"10.0.0.1:9847\"\n    auth: token\n",
+		"psk without keyring": "  - name: wan\n    listen: \"10.0.0.1:9847\"\n    auth: psk\n",
+		"low ingest_limit":    "  - name: wan\n    listen: \"10.0.0.1:9847\"\n    ingest_limit: 1kb\n",
+	} {
+		if _, err := LoadServerConfig(writeTempConfig(t, fmt.Sprintf(base, listeners))); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadServerConfig_UnixListener(t *testing.T) {
+	base := `
+server:
+  listen: "0.0.0.0:9847"
+tls:
+  ca_cert: /tmp/ca.pem
+  server_cert: /tmp/server.pem
+  server_key: /tmp/server-key.pem
+storages:
+  default:
+    base_dir: /tmp/backups
+listeners:
+  - name: local
+    listen: "unix:/run/nbackup/agent.sock"
+%s`
+	cfg, err := LoadServerConfig(writeTempConfig(t, fmt.Sprintf(base, `    peer_agents:
+      "0": host-01
+      "1001": sidecar-01
+    ingest_limit: 50mb
+`)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l := cfg.Listeners[0]
+	if path, ok := l.UnixPath(); !ok || path != "/run/nbackup/agent.sock" {
+		t.Errorf("unexpected unix path %q (ok=%v)", path, ok)
+	}
+	if l.Auth != AuthModePeerCred || l.TLS != (ListenerTLSConfig{}) || l.SocketModeRaw != 0o660 {
+		t.Errorf("unexpected unix listener defaults: %+v", l)
+	}
+	if l.PeerAgentsRaw[0] != "host-01" || l.PeerAgentsRaw[1001] != "sidecar-01" || l.IngestLimitRaw != 50*1024*1024 {
+		t.Errorf("unexpected unix listener policy: %+v", l)
+	}
+
+	for name, extra := range map[string]string{
+		"missing peer_agents": "",
+		"relative path":       "",
+		"tcp auth":            "    auth: mtls\n    peer_agents: {\"0\": host-01}\n",
+		"tls":                 "    tls:\n      server_cert: /tmp/x.pem\n    peer_agents: {\"0\": host-01}\n",
+		"tcp socket options":  "    socket:\n      keepalive: 30s\n    peer_agents: {\"0\": host-01}\n",
+		"empty agent":         "    peer_agents: {\"0\": \"\"}\n",
+		"unknown user":        "    peer_agents: {no-such-user-nbackup: host-01}\n",
+		"invalid socket_mode": "    peer_agents: {\"0\": host-01}\n    socket_mode: \"0999\"\n",
+	} {
+		content := fmt.Sprintf(base, extra)
+		if name == "relative path" {
+			content = strings.Replace(fmt.Sprintf(base, "    peer_agents: {\"0\": host-01}\n"), "unix:/run", "unix:run", 1)
+		}
+		if _, err := LoadServerConfig(writeTempConfig(t, content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	tcpPeer := strings.Replace(fmt.Sprintf(base, "    peer_agents: {\"0\": host-01}\n"), "unix:/run/nbackup/agent.sock", "10.0.0.1:9847", 1)
+	if _, err := LoadServerConfig(writeTempConfig(t, tcpPeer)); err == nil {
+		t.Error("expected error for peer_agents on a tcp listener")
+	}
+}
+
 func TestLoadServerConfig_GapDetectionDeprecatedIgnored(t *testing.T) {
 	content := `
 server:
@@ -632,7 +1036,7 @@ storages:
 	}
 }
 
-func TestLoadServerConfig_InvalidChunkShardLevels(t *testing.T) {
+func TestLoadServerConfig_MinFreeInodes(t *testing.T) {
 	content := `
 server:
   listen: "0.0.0.0:9847"
@@ -644,83 +1048,484 @@ storages:
   default:
     base_dir: /tmp/backups
     max_backups: 3
-    chunk_shard_levels: 5
+  scratch:
+    base_dir: /tmp/scratch
+    max_backups: 3
+    min_free_inodes: 0
 `
 	cfgPath := writeTempConfig(t, content)
-	_, err := LoadServerConfig(cfgPath)
-	if err == nil {
-		t.Fatal("expected error for invalid chunk_shard_levels")
-	}
-}
-
-func TestLoadAgentConfig_DefaultRetry(t *testing.T) {
-	cfgPath := writeTempConfig(t, validAgentYAML)
-	cfg, err := LoadAgentConfig(cfgPath)
+	cfg, err := LoadServerConfig(cfgPath)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if cfg.Retry.MaxAttempts != 5 {
-		t.Errorf("expected default max_attempts 5, got %d", cfg.Retry.MaxAttempts)
+	s, _ := cfg.GetStorage("default")
+	if got := s.MinFreeInodesThreshold(); got != DefaultMinFreeInodes {
+		t.Errorf("expected default min_free_inodes %d, got %d", DefaultMinFreeInodes, got)
+	}
+	s, _ = cfg.GetStorage("scratch")
+	if got := s.MinFreeInodesThreshold(); got != 0 {
+		t.Errorf("explicit min_free_inodes: 0 should disable the check, got %d", got)
 	}
 }
 
-func TestLoadAgentConfig_BandwidthLimitValid(t *testing.T) {
+func TestLoadServerConfig_QuotaAndMinFreeSpace(t *testing.T) {
 	content := `
-agent:
-  name: "test-agent"
 server:
-  address: "localhost:9847"
+  listen: "0.0.0.0:9847"
 tls:
   ca_cert: /tmp/ca.pem
-  client_cert: /tmp/client.pem
-  client_key: /tmp/client-key.pem
-backups:
-  - name: "test"
-    storage: "default"
-    schedule: "0 2 * * *"
-    bandwidth_limit: "50mb"
-    sources:
-      - path: /tmp
+  server_cert: /tmp/server.pem
+  server_key: /tmp/server-key.pem
+storages:
+  default:
+    base_dir: /tmp/backups
+    max_backups: 3
+    min_free_space: 50gb
+    quota: 2tb
+  scratch:
+    base_dir: /tmp/scratch
+    max_backups: 3
 `
-	cfgPath := writeTempConfig(t, content)
-	cfg, err := LoadAgentConfig(cfgPath)
+	cfg, err := LoadServerConfig(writeTempConfig(t, content))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	expectedBytes := int64(50 * 1024 * 1024)
-	if cfg.Backups[0].BandwidthLimitRaw != expectedBytes {
-		t.Errorf("expected BandwidthLimitRaw %d, got %d", expectedBytes, cfg.Backups[0].BandwidthLimitRaw)
+	s, _ := cfg.GetStorage("default")
+	if s.MinFreeSpaceRaw != 50<<30 || s.QuotaRaw != 2<<40 {
+		t.Errorf("expected 50gb/2tb, got %d/%d", s.MinFreeSpaceRaw, s.QuotaRaw)
+	}
+	s, _ = cfg.GetStorage("scratch")
+	if s.MinFreeSpaceRaw != 0 || s.QuotaRaw != 0 {
+		t.Errorf("expected checks disabled by default, got %d/%d", s.MinFreeSpaceRaw, s.QuotaRaw)
+	}
+
+	for name, extra := range map[string]string{
+		"invalid quota":          "    quota: lots\n",
+		"zero quota":             "    quota: 0\n",
+		"invalid min_free_space": "    min_free_space: 10xb\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadServerConfig(writeTempConfig(t, content+extra)); err == nil {
+				t.Error("expected validation error")
+			}
+		})
 	}
 }
 
-func TestLoadAgentConfig_BandwidthLimitDefault(t *testing.T) {
-	cfgPath := writeTempConfig(t, validAgentYAML)
-	cfg, err := LoadAgentConfig(cfgPath)
+func TestLoadServerConfig_DiskHealth(t *testing.T) {
+	content := `
+server:
+  listen: "0.0.0.0:9847"
+tls:
+  ca_cert: /tmp/ca.pem
+  server_cert: /tmp/server.pem
+  server_key: /tmp/server-key.pem
+storages:
+  default:
+    base_dir: /tmp/backups
+    max_backups: 3
+    disk_health:
+      device: /dev/sdb
+`
+	cfg, err := LoadServerConfig(writeTempConfig(t, content))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	// Sem bandwidth_limit configurado, deve ser 0 (sem limite)
-	if cfg.Backups[0].BandwidthLimitRaw != 0 {
-		t.Errorf("expected BandwidthLimitRaw 0 (no limit), got %d", cfg.Backups[0].BandwidthLimitRaw)
+	s, _ := cfg.GetStorage("default")
+	dh := s.DiskHealth
+	if !dh.Enabled() || dh.Smartctl != "smartctl" || dh.Interval != DefaultDiskHealthInterval || dh.OnDegraded != DiskHealthActionVerify {
+		t.Errorf("unexpected defaults: %+v", dh)
+	}
+
+	for name, extra := range map[string]string{
+		"device and command":  "      command: /usr/local/bin/probe\n",
+		"interval too short":  "      interval: 10s\n",
+		"invalid on_degraded": "      on_degraded: panic\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadServerConfig(writeTempConfig(t, content+extra)); err == nil {
+				t.Error("expected validation error")
+			}
+		})
 	}
 }
 
-func TestLoadAgentConfig_BandwidthLimitTooLow(t *testing.T) {
+func TestLoadServerConfig_Lifecycle(t *testing.T) {
 	content := `
-agent:
-  name: "test-agent"
 server:
-  address: "localhost:9847"
+  listen: "0.0.0.0:9847"
 tls:
   ca_cert: /tmp/ca.pem
-  client_cert: /tmp/client.pem
-  client_key: /tmp/client-key.pem
-backups:
-  - name: "test"
-    storage: "default"
-    schedule: "0 2 * * *"
-    bandwidth_limit: "32kb"
-    sources:
+  server_cert: /tmp/server.pem
+  server_key: /tmp/server-key.pem
+storages:
+  default:
+    base_dir: /tmp/backups
+    max_backups: 3
+`
+	cfg, err := LoadServerConfig(writeTempConfig(t, content+"    lifecycle:\n      recompress_after_days: 30\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, _ := cfg.GetStorage("default")
+	if lc := s.Lifecycle; !lc.Enabled() || lc.Level != LifecycleLevelBest || lc.WindowRaw != 128<<20 {
+		t.Errorf("unexpected defaults: %+v", lc)
+	}
+
+	for name, extra := range map[string]string{
+		"negative days":      "    lifecycle:\n      recompress_after_days: -1\n",
+		"invalid level":      "    lifecycle:\n      recompress_after_days: 30\n      level: ultra\n",
+		"window not power 2": "    lifecycle:\n      recompress_after_days: 30\n      window: 100mb\n",
+		"window too large":   "    lifecycle:\n      recompress_after_days: 30\n      window: 1gb\n",
+		"dedup storage":      "    type: dedup\n    lifecycle:\n      recompress_after_days: 30\n",
+		"with sync bucket": `    lifecycle:
+      recompress_after_days: 30
+    buckets:
+      - name: s3
+        provider: s3
+        bucket: backups
+        mode: sync
+        credentials:
+          access_key: a
+          secret_key: b
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadServerConfig(writeTempConfig(t, content+extra)); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
+func TestLoadServerConfig_Placements(t *testing.T) {
+	base := `
+server:
+  listen: "0.0.0.0:9847"
+tls:
+  ca_cert: /tmp/ca.pem
+  server_cert: /tmp/server.pem
+  server_key: /tmp/server-key.pem
+storages:
+  array-a:
+    base_dir: /mnt/a
+    failure_domain: rack1
+  array-b:
+    base_dir: /mnt/b
+`
+	cfg, err := LoadServerConfig(writeTempConfig(t, base+`placements:
+  - name: spread
+    storages: [array-a, array-b]
+    backups:
+      logs: PIN
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p, ok := cfg.GetPlacement("spread")
+	if !ok || p.Policy != PlacementSpread || p.PolicyFor("logs") != PlacementPin || p.PolicyFor("daily") != PlacementSpread {
+		t.Errorf("unexpected placement: %+v", p)
+	}
+	if s, _ := cfg.GetStorage("array-b"); s.FailureDomain != "array-b" {
+		t.Errorf("failure_domain default = %q, want the storage name", s.FailureDomain)
+	}
+
+	for name, placements := range map[string]string{
+		"single storage":    "  - name: p\n    storages: [array-a]\n",
+		"unknown storage":   "  - name: p\n    storages: [array-a, nope]\n",
+		"storage name":      "  - name: array-a\n    storages: [array-a, array-b]\n",
+		"invalid policy":    "  - name: p\n    storages: [array-a, array-b]\n    policy: random\n",
+		"invalid override":  "  - name: p\n    storages: [array-a, array-b]\n    backups:\n      logs: random\n",
+		"duplicated name":   "  - name: p\n    storages: [array-a, array-b]\n  - name: p\n    storages: [array-a, array-b]\n",
+		"duplicated member": "  - name: p\n    storages: [array-a, array-a]\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadServerConfig(writeTempConfig(t, base+"placements:\n"+placements)); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
+func TestLoadServerConfig_StorageType(t *testing.T) {
+	content := `
+server:
+  listen: "0.0.0.0:9847"
+tls:
+  ca_cert: /tmp/ca.pem
+  server_cert: /tmp/server.pem
+  server_key: /tmp/server-key.pem
+storages:
+  default:
+    base_dir: /tmp/backups
+  bench:
+    base_dir: /tmp/bench
+    type: discard
+  loadtest:
+    base_dir: /tmp/loadtest
+    type: null
+  ci:
+    base_dir: /tmp/ci
+    type: "null"
+  pool:
+    base_dir: /tmp/pool
+    type: Dedup
+`
+	cfg, err := LoadServerConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s, _ := cfg.GetStorage("default"); s.Type != StorageTypeFile || s.IsDedup() {
+		t.Errorf("expected default type file, got %q", s.Type)
+	}
+	if s, _ := cfg.GetStorage("pool"); !s.IsDedup() {
+		t.Errorf("expected type dedup, got %q", s.Type)
+	}
+	if s, _ := cfg.GetStorage("bench"); !s.IsDiscard() || s.IsDedup() {
+		t.Errorf("expected type discard, got %q", s.Type)
+	}
+	// null (com ou sem aspas) é sinônimo de discard
+	for _, name := range []string{"loadtest", "ci"} {
+		if s, _ := cfg.GetStorage(name); !s.IsDiscard() {
+			t.Errorf("expected %s type null as discard, got %q", name, s.Type)
+		}
+	}
+
+	for name, extra := range map[string]string{
+		"unknown type":   "    type: blob\n",
+		"yaml null ~":    "  other:\n    base_dir: /tmp/other\n    type: ~\n",
+		"yaml null NULL": "  other:\n    base_dir: /tmp/other\n    type: NULL\n",
+		"discard with post_commit": `  discard:
+    base_dir: /tmp/discard
+    type: discard
+    post_commit:
+      - type: command
+        command: "true"
+`,
+		"dedup with buckets": `    buckets:
+      - name: s3
+        provider: s3
+        bucket: backups
+        mode: sync
+        credentials:
+          access_key: a
+          secret_key: b
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadServerConfig(writeTempConfig(t, content+extra)); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
+func TestLoadServerConfig_InvalidChunkShardLevels(t *testing.T) {
+	content := `
+server:
+  listen: "0.0.0.0:9847"
+tls:
+  ca_cert: /tmp/ca.pem
+  server_cert: /tmp/server.pem
+  server_key: /tmp/server-key.pem
+storages:
+  default:
+    base_dir: /tmp/backups
+    max_backups: 3
+    chunk_shard_levels: 5
+`
+	cfgPath := writeTempConfig(t, content)
+	_, err := LoadServerConfig(cfgPath)
+	if err == nil {
+		t.Fatal("expected error for invalid chunk_shard_levels")
+	}
+}
+
+func TestLoadAgentConfig_DefaultRetry(t *testing.T) {
+	cfgPath := writeTempConfig(t, validAgentYAML)
+	cfg, err := LoadAgentConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Retry.MaxAttempts != 5 {
+		t.Errorf("expected default max_attempts 5, got %d", cfg.Retry.MaxAttempts)
+	}
+}
+
+func TestLoadAgentConfig_LoggingTarget(t *testing.T) {
+	content := validAgentYAML + `
+logging:
+  target: syslog
+  syslog:
+    address: tls://logs.example.com:6514
+    facility: local3
+    app_name: backup-agent
+`
+	cfg, err := LoadAgentConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tg := cfg.Logging.LogTarget(); tg.Kind != "syslog" || tg.AppName != "backup-agent" || tg.Syslog.Address != "tls://logs.example.com:6514" {
+		t.Errorf("unexpected target: %+v", tg)
+	}
+
+	for name, bad := range map[string]string{
+		"unknown target":      "logging:\n  target: kafka\n",
+		"missing address":     "logging:\n  target: syslog\n",
+		"bad scheme":          "logging:\n  target: syslog\n  syslog:\n    address: http://logs:514\n",
+		"unknown facility":    "logging:\n  target: syslog\n  syslog:\n    address: udp://logs:514\n    facility: local9\n",
+		"ca_cert without tls": "logging:\n  target: syslog\n  syslog:\n    address: udp://logs:514\n    ca_cert: /tmp/ca.pem\n",
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+bad)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_LoggingRotation(t *testing.T) {
+	content := validAgentYAML + `
+logging:
+  file: /var/log/nbackup/agent.log
+  rotation:
+    max_size: 50mb
+    max_age: 24h
+`
+	cfg, err := LoadAgentConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r := cfg.Logging.Rotation.LogRotation(); r.MaxSize != 50*1024*1024 || r.MaxAge != 24*time.Hour || r.MaxFiles != 5 || !r.Compress {
+		t.Errorf("unexpected rotation: %+v", r)
+	}
+
+	for name, bad := range map[string]string{
+		"without file":       "logging:\n  rotation:\n    max_size: 50mb\n",
+		"max_size too small": "logging:\n  file: /tmp/a.log\n  rotation:\n    max_size: 10kb\n",
+		"max_age too small":  "logging:\n  file: /tmp/a.log\n  rotation:\n    max_age: 10s\n",
+		"negative max_files": "logging:\n  file: /tmp/a.log\n  rotation:\n    max_size: 50mb\n    max_files: -1\n",
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+bad)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_LoggingSampling(t *testing.T) {
+	content := validAgentYAML + `
+logging:
+  sampling:
+    rules:
+      - message: "SACK received"
+        rate: 5
+      - message: "chunk_*"
+        rate: 0.5
+        burst: 20
+`
+	cfg, err := LoadAgentConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rules := cfg.Logging.Sampling.SampleRules()
+	if len(rules) != 2 || rules[1].Message != "chunk_*" || rules[1].Rate != 0.5 || rules[1].Burst != 20 {
+		t.Errorf("unexpected sampling rules: %+v", rules)
+	}
+
+	for name, bad := range map[string]string{
+		"missing message":   "logging:\n  sampling:\n    rules:\n      - rate: 1\n",
+		"zero rate":         "logging:\n  sampling:\n    rules:\n      - message: x\n",
+		"negative burst":    "logging:\n  sampling:\n    rules:\n      - message: x\n        rate: 1\n        burst: -1\n",
+		"duplicate message": "logging:\n  sampling:\n    rules:\n      - message: x\n        rate: 1\n      - message: x\n        rate: 2\n",
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+bad)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_LoggingRedact(t *testing.T) {
+	content := validAgentYAML + `
+logging:
+  redact:
+    patterns:
+      - "/home/[^/]+"
+      - "token=([A-Za-z0-9]+)"
+    replacement: "***"
+`
+	cfg, err := LoadAgentConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Logging.Redact.Patterns) != 2 || cfg.Logging.Redact.Replacement != "***" {
+		t.Errorf("unexpected redact config: %+v", cfg.Logging.Redact)
+	}
+
+	invalid := validAgentYAML + `
+logging:
+  redact:
+    patterns: ["(unclosed"]
+`
+	if _, err := LoadAgentConfig(writeTempConfig(t, invalid)); err == nil {
+		t.Fatal("expected error for invalid redact pattern")
+	}
+}
+
+func TestLoadAgentConfig_BandwidthLimitValid(t *testing.T) {
+	content := `
+agent:
+  name: "test-agent"
+server:
+  address: "localhost:9847"
+tls:
+  ca_cert: /tmp/ca.pem
+  client_cert: /tmp/client.pem
+  client_key: /tmp/client-key.pem
+backups:
+  - name: "test"
+    storage: "default"
+    schedule: "0 2 * * *"
+    bandwidth_limit: "50mb"
+    sources:
+      - path: /tmp
+`
+	cfgPath := writeTempConfig(t, content)
+	cfg, err := LoadAgentConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedBytes := int64(50 * 1024 * 1024)
+	if cfg.Backups[0].BandwidthLimitRaw != expectedBytes {
+		t.Errorf("expected BandwidthLimitRaw %d, got %d", expectedBytes, cfg.Backups[0].BandwidthLimitRaw)
+	}
+}
+
+func TestLoadAgentConfig_BandwidthLimitDefault(t *testing.T) {
+	cfgPath := writeTempConfig(t, validAgentYAML)
+	cfg, err := LoadAgentConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Sem bandwidth_limit configurado, deve ser 0 (sem limite)
+	if cfg.Backups[0].BandwidthLimitRaw != 0 {
+		t.Errorf("expected BandwidthLimitRaw 0 (no limit), got %d", cfg.Backups[0].BandwidthLimitRaw)
+	}
+}
+
+func TestLoadAgentConfig_BandwidthLimitTooLow(t *testing.T) {
+	content := `
+agent:
+  name: "test-agent"
+server:
+  address: "localhost:9847"
+tls:
+  ca_cert: /tmp/ca.pem
+  client_cert: /tmp/client.pem
+  client_key: /tmp/client-key.pem
+backups:
+  - name: "test"
+    storage: "default"
+    schedule: "0 2 * * *"
+    bandwidth_limit: "32kb"
+    sources:
       - path: /tmp
 `
 	cfgPath := writeTempConfig(t, content)
@@ -755,6 +1560,49 @@ backups:
 	}
 }
 
+func TestLoadAgentConfig_DaemonConcurrency(t *testing.T) {
+	content := `
+agent:
+  name: "test-agent"
+server:
+  address: "localhost:9847"
+tls:
+  ca_cert: /tmp/ca.pem
+  client_cert: /tmp/client.pem
+  client_key: /tmp/client-key.pem
+daemon:
+  max_concurrent_backups: 2
+  bandwidth_limit: "200mb"
+backups:
+  - name: "config"
+    storage: "default"
+    schedule: "0 2 * * *"
+    priority: 10
+    sources:
+      - path: /tmp
+`
+	cfg, err := LoadAgentConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Daemon.MaxConcurrentBackups != 2 {
+		t.Errorf("expected max_concurrent_backups 2, got %d", cfg.Daemon.MaxConcurrentBackups)
+	}
+	if cfg.Daemon.BandwidthLimitRaw != 200*1024*1024 {
+		t.Errorf("expected BandwidthLimitRaw %d, got %d", 200*1024*1024, cfg.Daemon.BandwidthLimitRaw)
+	}
+	if cfg.Backups[0].Priority != 10 {
+		t.Errorf("expected priority 10, got %d", cfg.Backups[0].Priority)
+	}
+
+	for _, daemon := range []string{"max_concurrent_backups: -1", `bandwidth_limit: "32kb"`} {
+		bad := strings.Replace(content, "max_concurrent_backups: 2\n  bandwidth_limit: \"200mb\"", daemon, 1)
+		if _, err := LoadAgentConfig(writeTempConfig(t, bad)); err == nil {
+			t.Errorf("expected error for daemon %s", daemon)
+		}
+	}
+}
+
 func TestLoadAgentConfig_ControlChannelKeepaliveTooLow(t *testing.T) {
 	content := `
 agent:
@@ -1403,3 +2251,1250 @@ func writeTempConfig(t *testing.T, content string) string {
 	}
 	return path
 }
+
+func TestLoadServerConfig_ChaosDefaults(t *testing.T) {
+	content := validServerYAMLBase + `
+chaos:
+  enabled: true
+`
+	cfgPath := writeTempConfig(t, content)
+	cfg, err := LoadServerConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Chaos.RotateProbabilityRaw != 0.01 {
+		t.Errorf("expected default rotate_probability 0.01, got %v", cfg.Chaos.RotateProbabilityRaw)
+	}
+	if cfg.Chaos.SACKDelayMax != 2*time.Second {
+		t.Errorf("expected default sack_delay_max 2s, got %v", cfg.Chaos.SACKDelayMax)
+	}
+	if cfg.Chaos.DropProbabilityRaw != 0.0005 {
+		t.Errorf("expected default drop_probability 0.0005, got %v", cfg.Chaos.DropProbabilityRaw)
+	}
+}
+
+func TestLoadServerConfig_ChaosExplicitZeroProbability(t *testing.T) {
+	content := validServerYAMLBase + `
+chaos:
+  enabled: true
+  rotate_probability: 0
+  drop_probability: 0.0
+`
+	cfg, err := LoadServerConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 0 explícito desliga a falha; só a ausente recebe default
+	if cfg.Chaos.RotateProbabilityRaw != 0 || cfg.Chaos.DropProbabilityRaw != 0 {
+		t.Errorf("expected explicit 0 to disable rotate/drop, got rotate=%v drop=%v",
+			cfg.Chaos.RotateProbabilityRaw, cfg.Chaos.DropProbabilityRaw)
+	}
+	if cfg.Chaos.SACKDelayProbabilityRaw != 0.001 {
+		t.Errorf("expected default sack_delay_probability 0.001, got %v", cfg.Chaos.SACKDelayProbabilityRaw)
+	}
+}
+
+func TestLoadServerConfig_ChaosInvalidProbability(t *testing.T) {
+	content := validServerYAMLBase + `
+chaos:
+  enabled: true
+  drop_probability: 1.5
+`
+	cfgPath := writeTempConfig(t, content)
+	if _, err := LoadServerConfig(cfgPath); err == nil {
+		t.Fatal("expected error for drop_probability > 1")
+	}
+}
+
+func TestLoadServerConfig_ChaosFaults(t *testing.T) {
+	content := validServerYAMLBase + `
+chaos:
+  enabled: true
+  faults:
+    - action: drop
+      stream: 1
+      after_bytes: 4mb
+    - action: corrupt
+      chunk: 12
+      times: -1
+    - action: delay_sack
+      delay: 500ms
+`
+	cfg, err := LoadServerConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Com faults, as probabilidades não recebem default
+	if cfg.Chaos.DropProbabilityRaw != 0 || cfg.Chaos.RotateProbabilityRaw != 0 || cfg.Chaos.SACKDelayProbabilityRaw != 0 {
+		t.Errorf("expected no random faults, got %+v", cfg.Chaos)
+	}
+	f := cfg.Chaos.Faults
+	if len(f) != 3 || f[0].AfterBytesRaw != 4*1024*1024 || *f[0].Stream != 1 || f[0].Times != 1 {
+		t.Errorf("unexpected drop fault: %+v", f)
+	}
+	if *f[1].Chunk != 12 || f[1].Times != -1 || f[2].Delay != 500*time.Millisecond {
+		t.Errorf("unexpected faults: %+v", f)
+	}
+
+	for name, fault := range map[string]string{
+		"unknown action":           "action: explode",
+		"drop without after_bytes": "action: drop",
+		"kill without after":       "action: kill",
+		"delay_sack without delay": "action: delay_sack",
+		"stream out of range":      "{action: corrupt, stream: 300}",
+	} {
+		t.Run(name, func(t *testing.T) {
+			content := validServerYAMLBase + "\nchaos:\n  enabled: true\n  faults:\n    - " + fault + "\n"
+			if _, err := LoadServerConfig(writeTempConfig(t, content)); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
+func TestLoadServerConfig_ChaosRejectedInProduction(t *testing.T) {
+	t.Setenv("NBACKUP_ENV", "production")
+	content := validServerYAMLBase + `
+chaos:
+  enabled: true
+`
+	cfgPath := writeTempConfig(t, content)
+	if _, err := LoadServerConfig(cfgPath); err == nil {
+		t.Fatal("expected error for chaos enabled with NBACKUP_ENV=production")
+	}
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	w, err := ParseTimeWindow("22:00-06:00")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.String() != "22:00-06:00" {
+		t.Errorf("expected 22:00-06:00, got %s", w.String())
+	}
+
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		at       time.Time
+		contains bool
+		until    time.Duration
+	}{
+		{day.Add(23 * time.Hour), true, 0},
+		{day.Add(3 * time.Hour), true, 0},
+		{day.Add(6 * time.Hour), false, 16 * time.Hour},
+		{day.Add(12 * time.Hour), false, 10 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := w.Contains(tt.at); got != tt.contains {
+			t.Errorf("Contains(%s) = %v, want %v", tt.at.Format("15:04"), got, tt.contains)
+		}
+		if got := w.UntilOpen(tt.at); got != tt.until {
+			t.Errorf("UntilOpen(%s) = %s, want %s", tt.at.Format("15:04"), got, tt.until)
+		}
+	}
+
+	for _, invalid := range []string{"", "22:00", "25:00-06:00", "08:00-08:00", "aa-bb"} {
+		if _, err := ParseTimeWindow(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestLoadServerConfig_BackupWindow(t *testing.T) {
+	content := validServerYAMLBase + `    backup_window: "22:00-06:00"
+`
+	cfgPath := writeTempConfig(t, content)
+	cfg, err := LoadServerConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, _ := cfg.GetStorage("default")
+	if s.BackupWindowRaw == nil || s.BackupWindowRaw.String() != "22:00-06:00" {
+		t.Errorf("expected parsed backup window 22:00-06:00, got %v", s.BackupWindowRaw)
+	}
+
+	content = validServerYAMLBase + `    backup_window: "nope"
+`
+	if _, err := LoadServerConfig(writeTempConfig(t, content)); err == nil {
+		t.Fatal("expected error for invalid backup_window")
+	}
+}
+
+func TestLoadServerConfig_HandshakeDefaults(t *testing.T) {
+	cfgPath := writeTempConfig(t, validServerYAMLBase)
+	cfg, err := LoadServerConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TLS.MaxConcurrentHandshakes != 2*runtime.NumCPU() {
+		t.Errorf("expected default max_concurrent_handshakes %d, got %d", 2*runtime.NumCPU(), cfg.TLS.MaxConcurrentHandshakes)
+	}
+	if cfg.TLS.HandshakeQueueTimeout != 30*time.Second {
+		t.Errorf("expected default handshake_queue_timeout 30s, got %v", cfg.TLS.HandshakeQueueTimeout)
+	}
+	if cfg.TLS.HandshakeTimeout != 10*time.Second {
+		t.Errorf("expected default handshake_timeout 10s, got %v", cfg.TLS.HandshakeTimeout)
+	}
+}
+
+func TestLoadServerConfig_HandshakeNegativeLimit(t *testing.T) {
+	content := strings.Replace(validServerYAMLBase, "tls:\n", "tls:\n  max_concurrent_handshakes: -1\n", 1)
+	cfgPath := writeTempConfig(t, content)
+	if _, err := LoadServerConfig(cfgPath); err == nil {
+		t.Fatal("expected error for negative max_concurrent_handshakes")
+	}
+}
+
+func TestLoadAgentConfig_JitterAndCatchUp(t *testing.T) {
+	content := validAgentYAML + `    jitter: 15m
+    catch_up: true
+`
+	cfgPath := writeTempConfig(t, content)
+	cfg, err := LoadAgentConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Backups[0].Jitter != 15*time.Minute {
+		t.Errorf("expected jitter 15m, got %v", cfg.Backups[0].Jitter)
+	}
+	if !cfg.Backups[0].CatchUp {
+		t.Error("expected catch_up true")
+	}
+	if cfg.Daemon.StateDir != "/var/lib/nbackup/agent" {
+		t.Errorf("expected default state_dir /var/lib/nbackup/agent, got %q", cfg.Daemon.StateDir)
+	}
+}
+
+func TestLoadAgentConfig_SACKWindow(t *testing.T) {
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Resume.SACKInterval != "auto" || cfg.Resume.SACKIntervalRaw != 0 || cfg.Resume.MaxInFlight != "auto" || cfg.Resume.MaxInFlightRaw != 0 {
+		t.Errorf("expected auto sack window by default, got %+v", cfg.Resume)
+	}
+
+	cfg, err = LoadAgentConfig(writeTempConfig(t, validAgentYAML+"resume:\n  sack_interval: 8mb\n  max_inflight: 64mb\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Resume.SACKIntervalRaw != 8*1024*1024 || cfg.Resume.MaxInFlightRaw != 64*1024*1024 {
+		t.Errorf("unexpected sack window: %+v", cfg.Resume)
+	}
+
+	for _, bad := range []string{
+		"  sack_interval: 32kb\n",
+		"  sack_interval: 128mb\n",
+		"  max_inflight: 512kb\n",
+		"  max_inflight: 512mb\n", // acima do buffer_size default (256mb)
+		"  sack_interval: 8mb\n  max_inflight: 8mb\n",
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"resume:\n"+bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadAgentConfig_ChunkSizeRange(t *testing.T) {
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Resume.ChunkSizeMinRaw != DefaultChunkSize || cfg.Resume.ChunkSizeMaxRaw != DefaultChunkSize {
+		t.Errorf("expected fixed chunk size by default, got %+v", cfg.Resume)
+	}
+
+	cfg, err = LoadAgentConfig(writeTempConfig(t, validAgentYAML+"resume:\n  chunk_size_min: 256kb\n  chunk_size_max: 8mb\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Resume.ChunkSizeMinRaw != 256*1024 || cfg.Resume.ChunkSizeMaxRaw != 8*1024*1024 {
+		t.Errorf("unexpected chunk size range: %+v", cfg.Resume)
+	}
+
+	for _, bad := range []string{
+		"  chunk_size_min: 32kb\n",
+		"  chunk_size_max: 32mb\n",
+		"  chunk_size_min: 2mb\n", // acima do chunk_size default (1mb)
+		"  chunk_size: 4mb\n  chunk_size_max: 2mb\n",
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"resume:\n"+bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadAgentConfig_NegativeJitter(t *testing.T) {
+	content := validAgentYAML + `    jitter: -1m
+`
+	cfgPath := writeTempConfig(t, content)
+	if _, err := LoadAgentConfig(cfgPath); err == nil {
+		t.Fatal("expected error for negative jitter")
+	}
+}
+
+func TestLoadAgentConfig_MinInterval(t *testing.T) {
+	cfgPath := writeTempConfig(t, validAgentYAML+`    min_interval: 12h
+`)
+	cfg, err := LoadAgentConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Backups[0].MinInterval != 12*time.Hour {
+		t.Errorf("expected min_interval 12h, got %v", cfg.Backups[0].MinInterval)
+	}
+
+	cfgPath = writeTempConfig(t, validAgentYAML+`    min_interval: -1h
+`)
+	if _, err := LoadAgentConfig(cfgPath); err == nil {
+		t.Fatal("expected error for negative min_interval")
+	}
+}
+
+func TestSnapshotHashAndDiff(t *testing.T) {
+	type snap struct {
+		Mode   string `json:"mode"`
+		Level  int    `json:"level"`
+		Extras string `json:"extras,omitempty"`
+	}
+	a := snap{Mode: "gzip", Level: 1}
+	b := snap{Mode: "zst", Level: 1, Extras: "x"}
+
+	if SnapshotHash(a) != SnapshotHash(snap{Mode: "gzip", Level: 1}) {
+		t.Fatal("expected equal snapshots to have equal hashes")
+	}
+	if SnapshotHash(a) == SnapshotHash(b) {
+		t.Fatal("expected different snapshots to have different hashes")
+	}
+	if len(SnapshotHash(a)) != 12 {
+		t.Fatalf("expected 12-char hash, got %q", SnapshotHash(a))
+	}
+
+	diff := SnapshotDiff(a, b)
+	want := []string{`extras: (unset) -> "x"`, `mode: "gzip" -> "zst"`}
+	if len(diff) != len(want) {
+		t.Fatalf("expected %v, got %v", want, diff)
+	}
+	for i := range want {
+		if diff[i] != want[i] {
+			t.Errorf("diff[%d] = %q, want %q", i, diff[i], want[i])
+		}
+	}
+	if SnapshotDiff(nil, b) != nil {
+		t.Error("expected nil diff without previous snapshot")
+	}
+}
+
+func TestLoadAgentConfig_AdminSocketDefaults(t *testing.T) {
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	as := cfg.Daemon.AdminSocket
+	if as.Enabled == nil || !*as.Enabled {
+		t.Error("expected admin_socket enabled by default")
+	}
+	if as.Path != "/run/nbackup/agent.sock" {
+		t.Errorf("expected default admin socket path, got %q", as.Path)
+	}
+}
+
+func TestLoadAgentConfig_Shutdown(t *testing.T) {
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sd := cfg.Daemon.Shutdown; sd.Mode != ShutdownModeWait || sd.Timeout != 5*time.Minute {
+		t.Errorf("expected wait/5m by default, got %+v", sd)
+	}
+
+	cfg, err = LoadAgentConfig(writeTempConfig(t, validAgentYAML+"\ndaemon:\n  shutdown:\n    mode: abort\n    timeout: 30s\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sd := cfg.Daemon.Shutdown; sd.Mode != ShutdownModeAbort || sd.Timeout != 30*time.Second {
+		t.Errorf("unexpected shutdown config %+v", sd)
+	}
+
+	if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"\ndaemon:\n  shutdown:\n    mode: checkpoint\n")); err == nil {
+		t.Error("expected error for invalid daemon.shutdown.mode")
+	}
+}
+
+func TestLoadAgentConfig_SourceRequired(t *testing.T) {
+	content := strings.Replace(validAgentYAML, "      - path: ", "      - path: /mnt/usb\n        required: false\n      - path: ", 1)
+	cfg, err := LoadAgentConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srcs := cfg.Backups[0].Sources
+	if len(srcs) < 2 {
+		t.Fatalf("expected at least 2 sources, got %d", len(srcs))
+	}
+	if srcs[0].IsRequired() {
+		t.Error("expected /mnt/usb optional")
+	}
+	if !srcs[1].IsRequired() {
+		t.Error("expected source required by default")
+	}
+}
+
+func TestLoadServerConfig_WriteBufferSize(t *testing.T) {
+	cfg, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := cfg.Storages["default"]; s.WriteBufferSize != "auto" || s.WriteBufferSizeRaw != 0 {
+		t.Errorf("expected write_buffer_size auto by default, got %q (%d)", s.WriteBufferSize, s.WriteBufferSizeRaw)
+	}
+
+	cfg, err = LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"    write_buffer_size: 4MB\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Storages["default"].WriteBufferSizeRaw; got != 4*1024*1024 {
+		t.Errorf("expected 4MB, got %d", got)
+	}
+
+	for _, bad := range []string{"1kb", "128mb", "lots"} {
+		if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"    write_buffer_size: "+bad+"\n")); err == nil {
+			t.Errorf("expected error for write_buffer_size %q", bad)
+		}
+	}
+}
+
+func TestLoadServerConfig_WriteWorkers(t *testing.T) {
+	cfg, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"    write_workers: 4\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Storages["default"].WriteWorkers; got != 4 {
+		t.Errorf("expected 4 write workers, got %d", got)
+	}
+
+	for _, bad := range []string{"-1", "65"} {
+		if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"    write_workers: "+bad+"\n")); err == nil {
+			t.Errorf("expected error for write_workers %s", bad)
+		}
+	}
+}
+
+func TestLoadServerConfig_SessionTTL(t *testing.T) {
+	cfg, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Storages["default"].SessionTTL; got != DefaultSessionTTL {
+		t.Errorf("expected default session_ttl %s, got %s", DefaultSessionTTL, got)
+	}
+
+	cfg, err = LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"    session_ttl: 6h\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Storages["default"].SessionTTL; got != 6*time.Hour {
+		t.Errorf("expected session_ttl 6h, got %s", got)
+	}
+
+	for _, bad := range []string{"-1h", "30s"} {
+		if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"    session_ttl: "+bad+"\n")); err == nil {
+			t.Errorf("expected error for session_ttl %s", bad)
+		}
+	}
+}
+
+func TestLoadServerConfig_AdminSocketDefaults(t *testing.T) {
+	cfg, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	as := cfg.Server.AdminSocket
+	if as.Enabled == nil || !*as.Enabled {
+		t.Error("expected admin_socket enabled by default")
+	}
+	if as.Path != "/run/nbackup/server.sock" {
+		t.Errorf("expected default admin socket path, got %q", as.Path)
+	}
+}
+
+func TestLoadServerConfig_Enrollment(t *testing.T) {
+	cfg, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Enrollment.Enabled {
+		t.Error("expected enrollment disabled by default")
+	}
+	if cfg.Enrollment.TokensFile != "/var/lib/nbackup/enroll-tokens.json" {
+		t.Errorf("expected default tokens_file, got %q", cfg.Enrollment.TokensFile)
+	}
+
+	cfg, err = LoadServerConfig(writeTempConfig(t, validServerYAMLBase+`
+enrollment:
+  enabled: true
+  ca_key: /tmp/ca-key.pem
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Enrollment.Listen != ":9849" || cfg.Enrollment.CertValidity != 8760*time.Hour {
+		t.Errorf("expected defaults :9849/8760h, got %s/%s", cfg.Enrollment.Listen, cfg.Enrollment.CertValidity)
+	}
+
+	for name, extra := range map[string]string{
+		"missing ca_key": "enrollment:\n  enabled: true\n",
+		"same listen":    "enrollment:\n  enabled: true\n  ca_key: /tmp/k.pem\n  listen: \"0.0.0.0:9847\"\n",
+	} {
+		if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+extra)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_NotificationsDigest(t *testing.T) {
+	content := validAgentYAML + `
+notifications:
+  smtp:
+    host: smtp.example.com
+    from: nbackup@example.com
+    to: [ops@example.com]
+  digest:
+    enabled: true
+`
+	cfg, err := LoadAgentConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n := cfg.Notifications
+	if n.SMTP.Port != 587 || n.SMTP.TLS != "starttls" {
+		t.Errorf("expected smtp defaults 587/starttls, got %d/%s", n.SMTP.Port, n.SMTP.TLS)
+	}
+	if n.Digest.Schedule != "0 7 * * *" {
+		t.Errorf("expected default digest schedule, got %q", n.Digest.Schedule)
+	}
+
+	cfg, err = LoadAgentConfig(writeTempConfig(t, strings.Replace(content, "    to: [ops@example.com]\n", "    to: [ops@example.com]\n    tls: tls\n", 1)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Notifications.SMTP.Port != 465 {
+		t.Errorf("expected port 465 with tls: tls, got %d", cfg.Notifications.SMTP.Port)
+	}
+
+	for name, bad := range map[string]string{
+		"digest without sender": validAgentYAML + "\nnotifications:\n  digest:\n    enabled: true\n",
+		"smtp without from":     validAgentYAML + "\nnotifications:\n  smtp:\n    host: smtp.example.com\n    to: [ops@example.com]\n",
+		"smtp without to":       validAgentYAML + "\nnotifications:\n  smtp:\n    host: smtp.example.com\n    from: a@example.com\n",
+		"smtp invalid tls":      strings.Replace(content, "    to: [ops@example.com]\n", "    to: [ops@example.com]\n    tls: ssl\n", 1),
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, bad)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadServerConfig_AgentAccess(t *testing.T) {
+	base := strings.Replace(validServerYAMLBase, "  server_key: /tmp/server-key.pem\n",
+		"  server_key: /tmp/server-key.pem\n  crl_file: /tmp/crl.pem\n  allowed_agents: [\" web-01 \", db-01]\n", 1)
+	cfg, err := LoadServerConfig(writeTempConfig(t, base))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TLS.CRLFile != "/tmp/crl.pem" {
+		t.Errorf("expected crl_file /tmp/crl.pem, got %q", cfg.TLS.CRLFile)
+	}
+	if len(cfg.TLS.AllowedAgents) != 2 || cfg.TLS.AllowedAgents[0] != "web-01" {
+		t.Errorf("expected trimmed allowed_agents, got %q", cfg.TLS.AllowedAgents)
+	}
+
+	bad := strings.Replace(base, "db-01]", "\"\"]", 1)
+	if _, err := LoadServerConfig(writeTempConfig(t, bad)); err == nil {
+		t.Error("expected error for empty allowed_agents entry")
+	}
+}
+
+func TestLoadServerConfig_PSKAuth(t *testing.T) {
+	cfg, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Auth != AuthModeMTLS {
+		t.Errorf("expected default auth %q, got %q", AuthModeMTLS, cfg.Server.Auth)
+	}
+
+	psk := strings.Replace(validServerYAMLBase, "  listen: \"0.0.0.0:9847\"\n",
+		"  listen: \"0.0.0.0:9847\"\n  auth: psk\n  psk_file: /etc/nbackup/psk\n", 1)
+	cfg, err = LoadServerConfig(writeTempConfig(t, psk))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Auth != AuthModePSK || cfg.Server.PSKFile != "/etc/nbackup/psk" {
+		t.Errorf("unexpected psk config: %+v", cfg.Server)
+	}
+
+	noFile := strings.Replace(psk, "  psk_file: /etc/nbackup/psk\n", "", 1)
+	if _, err := LoadServerConfig(writeTempConfig(t, noFile)); err == nil {
+		t.Error("expected error for auth psk without psk_file")
+	}
+	bad := strings.Replace(psk, "auth: psk", "auth: token", 1)
+	if _, err := LoadServerConfig(writeTempConfig(t, bad)); err == nil {
+		t.Error("expected error for unknown server.auth")
+	}
+}
+
+func TestLoadAgentConfig_PSKAuth(t *testing.T) {
+	psk := strings.Replace(validAgentYAML,
+		"  client_cert: /tmp/client.pem\n  client_key: /tmp/client-key.pem\n",
+		"  auth: psk\n  psk_file: /etc/nbackup/agent.psk\n", 1)
+	cfg, err := LoadAgentConfig(writeTempConfig(t, psk))
+	if err != nil {
+		t.Fatalf("expected psk auth without client certificate, got %v", err)
+	}
+	if cfg.TLS.Auth != AuthModePSK || cfg.TLS.PSKFile != "/etc/nbackup/agent.psk" {
+		t.Errorf("unexpected tls config: %+v", cfg.TLS)
+	}
+
+	noFile := strings.Replace(psk, "  psk_file: /etc/nbackup/agent.psk\n", "", 1)
+	if _, err := LoadAgentConfig(writeTempConfig(t, noFile)); err == nil {
+		t.Error("expected error for auth psk without psk_file")
+	}
+	mtls := strings.Replace(psk, "auth: psk", "auth: mtls", 1)
+	if _, err := LoadAgentConfig(writeTempConfig(t, mtls)); err == nil {
+		t.Error("expected error for mtls without client_cert")
+	}
+}
+
+func TestLoadAgentConfig_LocalTarget(t *testing.T) {
+	content := `
+agent:
+  name: "laptop-01"
+backups:
+  - name: "home"
+    schedule: "0 * * * *"
+    sources:
+      - path: /home
+    local:
+      path: /media/backup
+`
+	cfg, err := LoadAgentConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("expected local-only config without server/tls, got %v", err)
+	}
+	if cfg.UsesServer() {
+		t.Error("expected UsesServer false for local-only config")
+	}
+	local := cfg.Backups[0].Local
+	if local.MaxBackups != 5 || local.CompressionMode != "gzip" || local.FileExtension() != ".tar.gz" {
+		t.Errorf("unexpected local defaults: %+v", local)
+	}
+	if *cfg.Daemon.ControlChannel.Enabled {
+		t.Error("expected control channel disabled by default without server backups")
+	}
+
+	relative := strings.Replace(content, "path: /media/backup", "path: media/backup", 1)
+	if _, err := LoadAgentConfig(writeTempConfig(t, relative)); err == nil {
+		t.Error("expected error for relative local.path")
+	}
+	badMode := strings.Replace(content, "path: /media/backup", "path: /media/backup\n      compression_mode: lz4", 1)
+	if _, err := LoadAgentConfig(writeTempConfig(t, badMode)); err == nil {
+		t.Error("expected error for unknown local.compression_mode")
+	}
+
+	// Um backup para o server volta a exigir server.address
+	mixed := content + `  - name: "docs"
+    storage: "default"
+    schedule: "0 2 * * *"
+    sources:
+      - path: /srv
+`
+	if _, err := LoadAgentConfig(writeTempConfig(t, mixed)); err == nil {
+		t.Error("expected server.address required when some backup targets the server")
+	}
+}
+
+func TestLoadServerConfig_Webhook(t *testing.T) {
+	content := validServerYAMLBase + `
+notifications:
+  webhook:
+    urls:
+      - https://hooks.example.com/nbackup
+    secret: s3cret
+`
+	cfg, err := LoadServerConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wh := cfg.Notifications.Webhook
+	if len(wh.Events) != len(ServerWebhookEvents) || wh.Timeout != 10*time.Second || wh.MaxRetries != 3 {
+		t.Errorf("unexpected webhook defaults: %+v", wh)
+	}
+	if !wh.Wants(WebhookEventChecksumMismatch) || wh.Wants(WebhookEventDigest) {
+		t.Error("expected server webhook to want server events only")
+	}
+
+	for name, bad := range map[string]string{
+		"scheme": "    urls: [ftp://hooks.example.com]\n",
+		"event":  "    urls: [https://hooks.example.com]\n    events: [backup_completed]\n",
+	} {
+		if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"notifications:\n  webhook:\n"+bad)); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_WebhookDigest(t *testing.T) {
+	content := validAgentYAML + `notifications:
+  webhook:
+    urls: [https://hooks.example.com/nbackup]
+    events: [backup_failed]
+  digest:
+    enabled: true
+`
+	if _, err := LoadAgentConfig(writeTempConfig(t, content)); err == nil {
+		t.Error("expected digest without a digest-capable channel to be rejected")
+	}
+	withDigest := strings.Replace(content, "events: [backup_failed]", "events: [backup_failed, digest]", 1)
+	cfg, err := LoadAgentConfig(writeTempConfig(t, withDigest))
+	if err != nil {
+		t.Fatalf("expected webhook as digest channel, got %v", err)
+	}
+	if cfg.Notifications.Digest.Schedule != "0 7 * * *" {
+		t.Errorf("unexpected digest schedule %q", cfg.Notifications.Digest.Schedule)
+	}
+}
+
+func TestLoadServerConfig_MailNotifications(t *testing.T) {
+	mail := `notifications:
+  failures:
+    enabled: true
+  digest:
+    enabled: true
+`
+	if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+mail)); err == nil {
+		t.Error("expected failures/digest without notifications.smtp to be rejected")
+	}
+
+	withSMTP := validServerYAMLBase + `notifications:
+  smtp:
+    host: smtp.example.com
+    from: nbackup@example.com
+    to: [ops@example.com]
+  failures:
+    enabled: true
+  digest:
+    enabled: true
+`
+	cfg, err := LoadServerConfig(writeTempConfig(t, withSMTP))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Notifications.Failures.Interval != 5*time.Minute {
+		t.Errorf("expected default failures interval 5m, got %s", cfg.Notifications.Failures.Interval)
+	}
+	if cfg.Notifications.Digest.Schedule != "0 7 * * *" {
+		t.Errorf("unexpected digest schedule %q", cfg.Notifications.Digest.Schedule)
+	}
+}
+
+func TestLoadServerConfig_ChatNotifications(t *testing.T) {
+	content := validServerYAMLBase + `notifications:
+  slack:
+    - name: oncall
+      webhook_url: https://hooks.slack.com/services/T0/B0/x
+      events: [failures, checksum_mismatch]
+    - webhook_url: https://hooks.slack.com/services/T0/B1/y
+      events: [digest]
+  telegram:
+    - bot_token: "123:abc"
+      chat_id: "-100200"
+  failures:
+    enabled: true
+  digest:
+    enabled: true
+`
+	cfg, err := LoadServerConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("expected chat routes to satisfy failures/digest, got %v", err)
+	}
+	n := cfg.Notifications
+	if n.Slack[1].Name != "slack[1]" || n.Slack[0].Timeout != 10*time.Second {
+		t.Errorf("unexpected slack defaults: %+v", n.Slack)
+	}
+	tg := n.Telegram[0]
+	if tg.Name != "telegram[0]" || tg.APIURL != "https://api.telegram.org" || len(tg.Events) != len(ServerChatEvents) {
+		t.Errorf("unexpected telegram defaults: %+v", tg)
+	}
+	if !n.ChatWants(ChatEventDigest) || !n.ChatWants(WebhookEventAgentOffline) {
+		t.Error("expected telegram route to want all events by default")
+	}
+
+	for name, bad := range map[string]string{
+		"slack url":      "  slack:\n    - webhook_url: hooks.slack.com\n",
+		"slack event":    "  slack:\n    - webhook_url: https://hooks.slack.com/x\n      events: [backup_failed]\n",
+		"telegram token": "  telegram:\n    - chat_id: \"1\"\n",
+		"telegram chat":  "  telegram:\n    - bot_token: \"123:abc\"\n",
+		"failures route": "  slack:\n    - webhook_url: https://hooks.slack.com/x\n      events: [digest]\n  failures:\n    enabled: true\n",
+	} {
+		if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"notifications:\n"+bad)); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_HealthcheckURL(t *testing.T) {
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"    healthcheck_url: https://hc-ping.com/abc\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Backups[0].HealthcheckURL != "https://hc-ping.com/abc" {
+		t.Errorf("unexpected healthcheck_url %q", cfg.Backups[0].HealthcheckURL)
+	}
+	if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"    healthcheck_url: hc-ping.com/abc\n")); err == nil {
+		t.Error("expected error for healthcheck_url without scheme")
+	}
+}
+
+func TestLoadAgentConfig_MinStorageFree(t *testing.T) {
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"    min_storage_free: 50gb\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Backups[0].MinStorageFreeRaw; got != 50*1024*1024*1024 {
+		t.Errorf("expected 50gb parsed, got %d", got)
+	}
+	for _, bad := range []string{"abc", "0"} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"    min_storage_free: "+bad+"\n")); err == nil {
+			t.Errorf("expected error for min_storage_free %q", bad)
+		}
+	}
+}
+
+func TestLoadAgentConfig_Assertions(t *testing.T) {
+	assertions := "    assertions:\n      min_bytes: 10mb\n      min_objects: 100\n      required_paths: [/etc/passwd]\n"
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+assertions))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a := cfg.Backups[0].Assertions; !a.Enabled() || a.MinBytesRaw != 10*1024*1024 || a.MinObjects != 100 {
+		t.Errorf("unexpected assertions: %+v", a)
+	}
+	for name, bad := range map[string]string{
+		"invalid min_bytes":      "    assertions:\n      min_bytes: abc\n",
+		"negative min_objects":   "    assertions:\n      min_objects: -1\n",
+		"relative required path": "    assertions:\n      required_paths: [etc/passwd]\n",
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+bad)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_SourceFileFilters(t *testing.T) {
+	withFilters := func(filters string) string {
+		return strings.Replace(validAgentYAML, "      - path: /tmp\n", "      - path: /tmp\n"+filters, 1)
+	}
+	cfg, err := LoadAgentConfig(writeTempConfig(t, withFilters("        min_file_size: 1kb\n        max_file_size: 2gb\n        modified_within: 168h\n        modified_before: 1h\n")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	src := cfg.Backups[0].Sources[0]
+	if src.MinFileSizeRaw != 1024 || src.MaxFileSizeRaw != 2<<30 || src.ModifiedWithin != 168*time.Hour || src.ModifiedBefore != time.Hour {
+		t.Errorf("unexpected filters: %+v", src)
+	}
+	for name, bad := range map[string]string{
+		"invalid size":     "        max_file_size: huge\n",
+		"min above max":    "        min_file_size: 2gb\n        max_file_size: 1gb\n",
+		"negative age":     "        modified_within: -1h\n",
+		"empty age window": "        modified_within: 24h\n        modified_before: 48h\n",
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, withFilters(bad))); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_MaxSize(t *testing.T) {
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"    max_size: 200gb\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Backups[0].MaxSizeRaw; got != 200*1024*1024*1024 {
+		t.Errorf("expected 200gb, got %d", got)
+	}
+	for _, bad := range []string{"abc", "0"} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"    max_size: "+bad+"\n")); err == nil {
+			t.Errorf("max_size %q: expected error", bad)
+		}
+	}
+}
+
+func TestLoadAgentConfig_IncludeExcludePatterns(t *testing.T) {
+	patterns := "    include: [\"**/important.log\", \"re:\\\\.conf$\"]\n    exclude: [\"**/*.log\"]\n"
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+patterns))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b := cfg.Backups[0]; len(b.Include) != 2 || b.Include[1] != `re:\.conf$` || len(b.Exclude) != 1 {
+		t.Errorf("unexpected patterns: include=%v exclude=%v", b.Include, b.Exclude)
+	}
+	for name, bad := range map[string]string{
+		"invalid include regex": "    include: [\"re:(\"]\n",
+		"invalid exclude regex": "    exclude: [\"re:[a-\"]\n",
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+bad)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_Snapshot(t *testing.T) {
+	cfg, err := LoadAgentConfig(writeTempConfig(t, validAgentYAML+"    snapshot:\n      command: lvcreate -s -n snap vg/data\n      cleanup_command: lvremove -f vg/snap\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snap := cfg.Backups[0].Snapshot; !snap.Enabled() || snap.Timeout != 5*time.Minute {
+		t.Errorf("unexpected snapshot config: %+v", snap)
+	}
+
+	coordinated := strings.Replace(validAgentYAML, `    schedule: "0 2 * * *"`+"\n", "", 1) + "    snapshot:\n      coordinated: true\n"
+	if _, err := LoadAgentConfig(writeTempConfig(t, coordinated)); err != nil {
+		t.Fatalf("coordinated backup without schedule should be valid: %v", err)
+	}
+	for name, bad := range map[string]string{
+		"coordinated with schedule": validAgentYAML + "    snapshot:\n      coordinated: true\n",
+		"coordinated with catch_up": coordinated + "    catch_up: true\n",
+		"cleanup without command":   validAgentYAML + "    snapshot:\n      cleanup_command: lvremove -f vg/snap\n",
+	} {
+		if _, err := LoadAgentConfig(writeTempConfig(t, bad)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadServerConfig_RestoreDrills(t *testing.T) {
+	scratch := t.TempDir()
+	cfg, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"restore_drills:\n  enabled: true\n  scratch_dir: "+scratch+"\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d := cfg.RestoreDrills
+	if d.Interval != 24*time.Hour || d.Archives != 1 || d.SampleFiles != 20 || d.ResultsFile != filepath.Join(scratch, "restore-drills.jsonl") {
+		t.Errorf("unexpected defaults: %+v", d)
+	}
+
+	for name, bad := range map[string]string{
+		"missing scratch_dir":    "restore_drills:\n  enabled: true\n",
+		"scratch inside storage": "restore_drills:\n  enabled: true\n  scratch_dir: " + cfg.Storages["default"].BaseDir + "/drills\n",
+		"negative sample_files":  "restore_drills:\n  enabled: true\n  scratch_dir: " + scratch + "\n  sample_files: -1\n",
+	} {
+		if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+bad)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadServerConfig_AuditLog(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"audit_log:\n  enabled: true\n  dir: "+dir+"\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a := cfg.AuditLog; a.MaxSizeRaw != 64*1024*1024 || a.MaxFiles != 20 {
+		t.Errorf("unexpected defaults: %+v", a)
+	}
+
+	for name, bad := range map[string]string{
+		"missing dir":        "audit_log:\n  enabled: true\n",
+		"dir inside storage": "audit_log:\n  enabled: true\n  dir: " + cfg.Storages["default"].BaseDir + "/audit\n",
+		"max_size too small": "audit_log:\n  enabled: true\n  dir: " + dir + "\n  max_size: 100kb\n",
+	} {
+		if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+bad)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadServerConfig_Accounting(t *testing.T) {
+	cfg, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"accounting:\n  enabled: true\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a := cfg.Accounting; a.File != "accounting.jsonl" || a.RetentionDays != 400 {
+		t.Errorf("unexpected defaults: %+v", a)
+	}
+
+	if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"accounting:\n  enabled: true\n  retention_days: -1\n")); err == nil {
+		t.Error("expected error for negative retention_days")
+	}
+}
+
+func TestLoadServerConfig_SnapshotGroups(t *testing.T) {
+	group := "snapshot_groups:\n  - name: pg-cluster\n    backup: pgdata\n    schedule: \"0 3 * * *\"\n    agents: [db-01, db-02]\n"
+	cfg, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+group))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if g := cfg.SnapshotGroups[0]; g.PrepareTimeout != 5*time.Minute || len(g.Agents) != 2 {
+		t.Errorf("unexpected snapshot group: %+v", g)
+	}
+
+	for name, bad := range map[string]string{
+		"single agent":    "snapshot_groups:\n  - name: g\n    backup: b\n    agents: [db-01]\n",
+		"duplicate agent": "snapshot_groups:\n  - name: g\n    backup: b\n    agents: [db-01, db-01]\n",
+		"missing backup":  "snapshot_groups:\n  - name: g\n    agents: [db-01, db-02]\n",
+		"duplicate name":  group + "  - name: pg-cluster\n    backup: other\n    agents: [db-03, db-04]\n",
+	} {
+		if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+bad)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadServerConfig_APITokens(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "api.token")
+	if err := os.WriteFile(tokenFile, []byte("  file-token-0123456789\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	webUI := "web_ui:\n  enabled: true\n  allow_origins: [127.0.0.1]\n  api_require_token: true\n  api_tokens:\n"
+	content := validServerYAMLBase + webUI + `    - name: grafana
+      token: viewer-token-0123456789
+    - name: ops
+      token_file: ` + tokenFile + `
+      role: admin
+`
+	cfg, err := LoadServerConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tokens := cfg.WebUI.APITokens
+	if tokens[0].Role != APIRoleViewer {
+		t.Errorf("expected default role viewer, got %q", tokens[0].Role)
+	}
+	if tokens[1].Token != "file-token-0123456789" || tokens[1].Role != APIRoleAdmin {
+		t.Errorf("unexpected token_file resolution: %+v", tokens[1])
+	}
+
+	for name, bad := range map[string]string{
+		"short":     "    - name: a\n      token: short\n",
+		"no name":   "    - token: viewer-token-0123456789\n",
+		"role":      "    - name: a\n      token: viewer-token-0123456789\n      role: root\n",
+		"both":      "    - name: a\n      token: viewer-token-0123456789\n      token_file: " + tokenFile + "\n",
+		"dup name":  "    - name: a\n      token: viewer-token-0123456789\n    - name: a\n      token: other-token-0123456789\n",
+		"dup token": "    - name: a\n      token: viewer-token-0123456789\n    - name: b\n      token: viewer-token-0123456789\n",
+	} {
+		if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+webUI+bad)); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+	if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"web_ui:\n  enabled: true\n  allow_origins: [127.0.0.1]\n  api_require_token: true\n")); err == nil {
+		t.Error("expected error for api_require_token without tokens")
+	}
+}
+
+func TestLoadServerConfig_WebUIUsers(t *testing.T) {
+	const hash = "pbkdf2-sha256$600000$TVOBGo8EjtAkiYjiPP5pjw$3h1DtL7Wp8LonxRcF9O3ZLukbK4jgiJ7Nj6bITACgAE"
+	webUI := "web_ui:\n  enabled: true\n  allow_origins: [127.0.0.1]\n  api_tokens:\n    - name: ops\n      token: admin-token-0123456789\n  users:\n"
+	content := validServerYAMLBase + webUI + "    - name: alice\n      password_hash: " + hash + "\n      role: operator\n    - name: bob\n      password_hash: " + hash + "\n"
+	cfg, err := LoadServerConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if users := cfg.WebUI.Users; users[0].Role != WebUIRoleOperator || users[1].Role != WebUIRoleViewer {
+		t.Errorf("unexpected roles: %+v", users)
+	}
+	if cfg.WebUI.SessionTTL != 12*time.Hour {
+		t.Errorf("expected default session_ttl 12h, got %s", cfg.WebUI.SessionTTL)
+	}
+
+	for name, bad := range map[string]string{
+		"no hash":    "    - name: a\n",
+		"plain text": "    - name: a\n      password_hash: hunter2\n",
+		"weak":       "    - name: a\n      password_hash: pbkdf2-sha256$1000$TVOBGo8EjtAkiYjiPP5pjw$3h1DtL7Wp8LonxRcF9O3ZLukbK4jgiJ7Nj6bITACgAE\n",
+		"role":       "    - name: a\n      password_hash: " + hash + "\n      role: admin\n",
+		"token name": "    - name: ops\n      password_hash: " + hash + "\n",
+	} {
+		if _, err := LoadServerConfig(writeTempConfig(t, validServerYAMLBase+webUI+bad)); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestLoadAgentConfig_SchemaMigration(t *testing.T) {
+	legacy := strings.Replace(validAgentYAML, "    sources:\n", "    auto_scaler: adaptive\n    sources:\n", 1)
+	cfg, err := LoadAgentConfig(writeTempConfig(t, legacy))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ConfigVersion != CurrentConfigVersion || cfg.Backups[0].AutoScaler.Mode != "adaptive" || !cfg.Backups[0].AutoScaler.IsEnabled() {
+		t.Errorf("legacy config not migrated: version=%d auto_scaler=%+v", cfg.ConfigVersion, cfg.Backups[0].AutoScaler)
+	}
+	if len(cfg.Migrations) != 2 || !strings.Contains(cfg.Migrations[0], "backups[0].auto_scaler") || cfg.Migrations[1] != "config_version: 0 -> 1" {
+		t.Errorf("unexpected migrations: %q", cfg.Migrations)
+	}
+
+	// migrate-config --write: grava o arquivo migrado e preserva o original
+	path := writeTempConfig(t, "# comentário preservado\n"+legacy)
+	if notes, err := MigrateAgentConfigFile(path, false); err != nil || len(notes) != 2 {
+		t.Fatalf("dry run: notes=%q err=%v", notes, err)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "config_version") {
+		t.Fatal("dry run must not rewrite the file")
+	}
+	if _, err := MigrateAgentConfigFile(path, true); err != nil {
+		t.Fatalf("MigrateAgentConfigFile: %v", err)
+	}
+	if bak, _ := os.ReadFile(path + ".bak"); !strings.HasPrefix(string(bak), "# comentário preservado\n") || strings.Contains(string(bak), "config_version") {
+		t.Errorf("original not preserved in .bak: %q", bak)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "# comentário preservado") || !strings.Contains(string(data), "mode: adaptive") {
+		t.Errorf("unexpected migrated file:\n%s", data)
+	}
+	cfg, err = LoadAgentConfig(path)
+	if err != nil || len(cfg.Migrations) != 0 {
+		t.Errorf("migrated file should load without migrations: %q, %v", cfg.Migrations, err)
+	}
+
+	// Versão mais nova que a suportada é recusada
+	if _, err := LoadAgentConfig(writeTempConfig(t, "config_version: 99\n"+validAgentYAML)); err == nil || !strings.Contains(err.Error(), "newer than supported") {
+		t.Errorf("expected newer config_version error, got %v", err)
+	}
+}
+
+func TestLoadConfig_UnknownFields(t *testing.T) {
+	typo := strings.Replace(validAgentYAML, "    sources:\n", "    exclud: ['*.log']\n    sources:\n", 1)
+	_, err := LoadAgentConfig(writeTempConfig(t, "config_version: 1\nretention: 7\n"+typo))
+	if err == nil || !strings.Contains(err.Error(), "retention, backups[0].exclud") {
+		t.Fatalf("expected unknown fields error, got %v", err)
+	}
+
+	// Allowlist (caminho sem índices) e chaves x- com âncoras
+	allowed := "config_version: 1\nallow_unknown_fields: [retention, 'backups.excl*']\nx-sources: &src\n  - path: /tmp\nretention: 7\n" +
+		strings.Replace(typo, "    sources:\n      - path: /tmp\n", "    sources: *src\n", 1)
+	if _, err := LoadAgentConfig(writeTempConfig(t, allowed)); err != nil {
+		t.Errorf("allowlisted fields must load: %v", err)
+	}
+
+	_, err = LoadServerConfig(writeTempConfig(t, validServerYAMLBase+"    max_backup: 3\n"))
+	if err == nil || !strings.Contains(err.Error(), "storages.default.max_backup") {
+		t.Errorf("expected unknown storage field error, got %v", err)
+	}
+}
+
+func TestParseStorageLayout(t *testing.T) {
+	layout, err := ParseStorageLayout("{agent}/{backup}/{year}/{month}/d{day}-{hour}/{timestamp}.tar.{ext}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	at := time.Date(2026, 3, 7, 4, 5, 6, 0, time.UTC)
+	if got := layout.Dir(at); got != "2026/03/d07-04" {
+		t.Errorf("unexpected dir %q", got)
+	}
+	if flat, err := ParseStorageLayout(DefaultStorageLayout); err != nil || flat.Dir(at) != "" {
+		t.Errorf("expected default layout without directories, got %q (err=%v)", flat.Dir(at), err)
+	}
+	var none *StorageLayout
+	if none.Dir(at) != "" {
+		t.Error("expected nil layout without directories")
+	}
+
+	for _, bad := range []string{
+		"{backup}/{agent}/{timestamp}.tar.{ext}",
+		"{agent}/{backup}/{year}/{timestamp}.tar.gz",
+		"{agent}/{backup}/{year}/{agent}/{timestamp}.tar.{ext}",
+		"{agent}/{backup}/../{timestamp}.tar.{ext}",
+		"{agent}/{backup}/.hidden/{timestamp}.tar.{ext}",
+		"{agent}/{backup}//{timestamp}.tar.{ext}",
+		"{agent}/{backup}/{week}/{timestamp}.tar.{ext}",
+	} {
+		if _, err := ParseStorageLayout(bad); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestLoadServerConfig_PostCommit(t *testing.T) {
+	base := `
+server:
+  listen: "0.0.0.0:9847"
+tls:
+  ca_cert: /tmp/ca.pem
+  server_cert: /tmp/server.pem
+  server_key: /tmp/server-key.pem
+storages:
+  default:
+    base_dir: /tmp/backups
+%s    post_commit:
+%s`
+	cfg, err := LoadServerConfig(writeTempConfig(t, fmt.Sprintf(base, "", `      - type: command
+        command: /usr/local/bin/ship.sh
+      - name: offsite
+        type: rclone
+        remote: "b2:backups/{agent}"
+        retries: 2
+        on_failure: stop
+`)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	actions := cfg.Storages["default"].PostCommit
+	if len(actions) != 2 {
+		t.Fatalf("expected 2 actions, got %d", len(actions))
+	}
+	if a := actions[0]; a.Name != "command-0" || a.Timeout != DefaultPostCommitTimeout || a.OnFailure != PostCommitOnFailureContinue {
+		t.Errorf("unexpected command defaults: %+v", a)
+	}
+	if a := actions[1]; a.Rclone != "rclone" || a.Retries != 2 || a.OnFailure != PostCommitOnFailureStop {
+		t.Errorf("unexpected rclone action: %+v", a)
+	}
+
+	for name, c := range map[string][2]string{
+		"missing type":     {"", "      - command: x\n"},
+		"unknown type":     {"", "      - type: ftp\n"},
+		"missing command":  {"", "      - type: command\n"},
+		"rclone no remote": {"", "      - type: rclone\n        remote: bucket\n"},
+		"rclone command":   {"", "      - type: rclone\n        remote: \"b2:x\"\n        command: x\n"},
+		"bad on_failure":   {"", "      - type: command\n        command: x\n        on_failure: abort\n"},
+		"short timeout":    {"", "      - type: command\n        command: x\n        timeout: 10ms\n"},
+		"duplicate names":  {"", "      - {name: a, type: command, command: x}\n      - {name: a, type: command, command: y}\n"},
+		"dedup":            {"    type: dedup\n", "      - type: command\n        command: x\n"},
+	} {
+		if _, err := LoadServerConfig(writeTempConfig(t, fmt.Sprintf(base, c[0], c[1]))); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadServerConfig_Immutable(t *testing.T) {
+	base := `
+server:
+  listen: "0.0.0.0:9847"
+tls:
+  ca_cert: /tmp/ca.pem
+  server_cert: /tmp/server.pem
+  server_key: /tmp/server-key.pem
+storages:
+  default:
+    base_dir: /tmp/backups
+%s    immutable:
+      enabled: true
+%s`
+	cfg, err := LoadServerConfig(writeTempConfig(t, fmt.Sprintf(base, "", "      ledger_key_file: /etc/nbackup/ledger.key\n")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if im := cfg.Storages["default"].Immutable; im.Mode != ImmutableModeReadOnly || im.UnlockGrace != DefaultUnlockGrace {
+		t.Errorf("unexpected immutable defaults: %+v", im)
+	}
+
+	for name, c := range map[string][2]string{
+		"missing key":  {"", "      mode: chattr\n"},
+		"unknown mode": {"", "      ledger_key_file: /k\n      mode: append\n"},
+		"short grace":  {"", "      ledger_key_file: /k\n      unlock_grace: 30s\n"},
+		"dedup":        {"    type: dedup\n", "      ledger_key_file: /k\n"},
+	} {
+		if _, err := LoadServerConfig(writeTempConfig(t, fmt.Sprintf(base, c[0], c[1]))); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultStorageLayout é o layout sem storages.*.layout: backups direto em
+// {agent}/{backup}.
+const DefaultStorageLayout = "{agent}/{backup}/{timestamp}.tar.{ext}"
+
+// Placeholders de data aceitos nos diretórios de storages.*.layout. As datas
+// são as do commit em UTC, como o timestamp do nome do arquivo.
+var layoutDatePlaceholders = map[string]func(time.Time) string{
+	"{year}":  func(t time.Time) string { return fmt.Sprintf("%04d", t.Year()) },
+	"{month}": func(t time.Time) string { return fmt.Sprintf("%02d", t.Month()) },
+	"{day}":   func(t time.Time) string { return fmt.Sprintf("%02d", t.Day()) },
+	"{hour}":  func(t time.Time) string { return fmt.Sprintf("%02d", t.Hour()) },
+}
+
+// StorageLayout é um storages.*.layout validado: os diretórios de data entre
+// {agent}/{backup} e o arquivo do backup. O template sempre começa com
+// {agent}/{backup}/ e termina com {timestamp}.tar.{ext}, então o nome do
+// arquivo continua único e cronológico e cada backup continua dentro do
+// diretório do seu agent/backup.
+type StorageLayout struct {
+	dirs []string // segmentos de diretório, com placeholders de data
+}
+
+// ParseStorageLayout valida um template como
+// "{agent}/{backup}/{year}/{month}/{timestamp}.tar.{ext}".
+func ParseStorageLayout(s string) (*StorageLayout, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) < 3 || parts[0] != "{agent}" || parts[1] != "{backup}" {
+		return nil, fmt.Errorf("invalid layout %q: must start with {agent}/{backup}/", s)
+	}
+	if parts[len(parts)-1] != "{timestamp}.tar.{ext}" {
+		return nil, fmt.Errorf("invalid layout %q: must end with /{timestamp}.tar.{ext}", s)
+	}
+
+	dirs := parts[2 : len(parts)-1]
+	for _, dir := range dirs {
+		literal := dir
+		for p := range layoutDatePlaceholders {
+			literal = strings.ReplaceAll(literal, p, "")
+		}
+		switch {
+		case dir == "" || dir == "." || dir == "..":
+			return nil, fmt.Errorf("invalid layout %q: empty or relative directory %q", s, dir)
+		case strings.HasPrefix(dir, "."):
+			// Diretórios ocultos são reservados (ex: .quarantine)
+			return nil, fmt.Errorf("invalid layout %q: directory %q must not start with a dot", s, dir)
+		case strings.ContainsAny(literal, "{}\\"):
+			return nil, fmt.Errorf("invalid layout %q: unknown placeholder in %q (valid: {year}, {month}, {day}, {hour})", s, dir)
+		}
+	}
+	return &StorageLayout{dirs: dirs}, nil
+}
+
+// Dir retorna o diretório, relativo a {agent}/{backup}, de um backup
+// commitado em t ("" no layout default).
+func (l *StorageLayout) Dir(t time.Time) string {
+	if l == nil || len(l.dirs) == 0 {
+		return ""
+	}
+	t = t.UTC()
+	segs := make([]string, len(l.dirs))
+	for i, dir := range l.dirs {
+		for p, format := range layoutDatePlaceholders {
+			dir = strings.ReplaceAll(dir, p, format(t))
+		}
+		segs[i] = dir
+	}
+	return path.Join(segs...)
+}
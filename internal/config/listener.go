@@ -0,0 +1,235 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// unixListenPrefix marca o listen de um listener em socket unix
+// ("unix:/run/nbackup/agent.sock").
+const unixListenPrefix = "unix:"
+
+// defaultUnixSocketMode é a permissão do socket unix sem socket_mode: dono e
+// grupo do server conectam, o SO_PEERCRED decide qual agent cada um é.
+const defaultUnixSocketMode = 0o660
+
+// ListenerConfig define um listener adicional do server (listeners), atendido
+// pelo mesmo Handler do listener principal (server.listen). Útil para frotas
+// mistas: uma interface interna de 10Gb e outra exposta à WAN, cada uma com
+// seus certificados, agents aceitos e teto de banda.
+//
+// Com listen "unix:<caminho>" o listener atende agents do mesmo host (ou
+// sidecars com o socket montado) por um socket unix, sem TLS: a identidade do
+// agent vem do uid do processo conectado (SO_PEERCRED), mapeado em peer_agents.
+type ListenerConfig struct {
+	Name          string            `yaml:"name"`           // identificador nos logs e eventos (obrigatório, único)
+	Listen        string            `yaml:"listen"`         // endereço host:porta ou unix:<caminho absoluto> (obrigatório)
+	Auth          string            `yaml:"auth"`           // mtls | psk (default: server.auth); psk usa server.psk_file. Socket unix: peercred
+	TLS           ListenerTLSConfig `yaml:"tls"`            // certificados do listener; campos vazios herdam de tls
+	AllowedAgents []string          `yaml:"allowed_agents"` // agents aceitos neste listener, além de tls.allowed_agents; vazio = todos
+	IngestLimit   string            `yaml:"ingest_limit"`   // teto de ingestão das conexões do listener em bytes/seg, vazio = sem limite
+	Socket        SocketConfig      `yaml:"socket"`         // ajuste dos sockets TCP (default: server.socket)
+	PeerAgents    map[string]string `yaml:"peer_agents"`    // socket unix: usuário local (nome ou uid) → agent
+	SocketMode    string            `yaml:"socket_mode"`    // socket unix: permissão do arquivo em octal (default: 0660)
+
+	IngestLimitRaw int64             `yaml:"-"`
+	PeerAgentsRaw  map[uint32]string `yaml:"-"` // uid → agent, resolvido de peer_agents
+	SocketModeRaw  os.FileMode       `yaml:"-"`
+}
+
+// UnixPath retorna o caminho do socket de um listener unix ("unix:<caminho>").
+func (l ListenerConfig) UnixPath() (string, bool) {
+	return strings.CutPrefix(l.Listen, unixListenPrefix)
+}
+
+// ListenerTLSConfig sobrescreve os certificados de tls em um listener.
+type ListenerTLSConfig struct {
+	CACert     string `yaml:"ca_cert"`
+	ServerCert string `yaml:"server_cert"`
+	ServerKey  string `yaml:"server_key"`
+}
+
+// validateListeners valida os listeners adicionais e aplica os defaults
+// herdados de server e tls.
+func (c *ServerConfig) validateListeners() error {
+	names := make(map[string]bool, len(c.Listeners))
+	addrs := map[string]bool{c.Server.Listen: true}
+	if c.Enrollment.Enabled {
+		addrs[c.Enrollment.Listen] = true
+	}
+
+	for i := range c.Listeners {
+		l := &c.Listeners[i]
+		prefix := fmt.Sprintf("listeners[%d]", i)
+
+		l.Name = strings.TrimSpace(l.Name)
+		if l.Name == "" {
+			return fmt.Errorf("%s.name is required", prefix)
+		}
+		if names[l.Name] {
+			return fmt.Errorf("%s.name %q is duplicated", prefix, l.Name)
+		}
+		names[l.Name] = true
+
+		if l.Listen == "" {
+			return fmt.Errorf("%s.listen is required", prefix)
+		}
+		if addrs[l.Listen] {
+			return fmt.Errorf("%s.listen %q is already in use by another listener", prefix, l.Listen)
+		}
+		addrs[l.Listen] = true
+
+		if _, ok := l.UnixPath(); ok {
+			if err := l.validateUnix(prefix); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(l.PeerAgents) > 0 || l.SocketMode != "" {
+			return fmt.Errorf("%s.peer_agents and socket_mode require a unix listener (listen: unix:<path>)", prefix)
+		}
+
+		switch l.Auth {
+		case "":
+			l.Auth = c.Server.Auth
+		case AuthModeMTLS:
+		case AuthModePSK:
+		default:
+			return fmt.Errorf("%s.auth must be %q or %q, got %q", prefix, AuthModeMTLS, AuthModePSK, l.Auth)
+		}
+		if err := l.validatePolicy(prefix); err != nil {
+			return err
+		}
+		if l.TLS.CACert == "" {
+			l.TLS.CACert = c.TLS.CACert
+		}
+		if l.TLS.ServerCert == "" {
+			l.TLS.ServerCert = c.TLS.ServerCert
+		}
+		if l.TLS.ServerKey == "" {
+			l.TLS.ServerKey = c.TLS.ServerKey
+		}
+
+		if l.Socket.IsZero() {
+			l.Socket = c.Server.Socket
+		} else if err := l.Socket.validate(prefix + ".socket"); err != nil {
+			return err
+		}
+	}
+
+	if c.PSKEnabled() && c.Server.PSKFile == "" {
+		return fmt.Errorf("server.psk_file is required when a listener uses auth psk")
+	}
+	return nil
+}
+
+// validatePolicy valida allowed_agents e ingest_limit, comuns a listeners TCP
+// e unix.
+func (l *ListenerConfig) validatePolicy(prefix string) error {
+	for j, agent := range l.AllowedAgents {
+		l.AllowedAgents[j] = strings.TrimSpace(agent)
+		if l.AllowedAgents[j] == "" {
+			return fmt.Errorf("%s.allowed_agents[%d] must not be empty", prefix, j)
+		}
+	}
+
+	limit, err := parseIngestLimit(prefix+".ingest_limit", l.IngestLimit)
+	if err != nil {
+		return err
+	}
+	l.IngestLimitRaw = limit
+	return nil
+}
+
+// validateUnix valida um listener em socket unix: auth peercred, sem TLS nem
+// opções de socket TCP, e peer_agents resolvido para uids.
+func (l *ListenerConfig) validateUnix(prefix string) error {
+	path, _ := l.UnixPath()
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("%s.listen: unix socket path must be absolute, got %q", prefix, path)
+	}
+	switch l.Auth {
+	case "":
+		l.Auth = AuthModePeerCred
+	case AuthModePeerCred:
+	default:
+		return fmt.Errorf("%s.auth must be %q on a unix listener, got %q", prefix, AuthModePeerCred, l.Auth)
+	}
+	if l.TLS != (ListenerTLSConfig{}) {
+		return fmt.Errorf("%s.tls is not supported on a unix listener", prefix)
+	}
+	if !l.Socket.IsZero() {
+		return fmt.Errorf("%s.socket is not supported on a unix listener (tcp socket options)", prefix)
+	}
+	if err := l.validatePolicy(prefix); err != nil {
+		return err
+	}
+
+	if len(l.PeerAgents) == 0 {
+		return fmt.Errorf("%s.peer_agents is required on a unix listener", prefix)
+	}
+	l.PeerAgentsRaw = make(map[uint32]string, len(l.PeerAgents))
+	for local, agent := range l.PeerAgents {
+		agent = strings.TrimSpace(agent)
+		if agent == "" {
+			return fmt.Errorf("%s.peer_agents[%q] must not be empty", prefix, local)
+		}
+		uid, err := lookupUID(local)
+		if err != nil {
+			return fmt.Errorf("%s.peer_agents[%q]: %w", prefix, local, err)
+		}
+		if other, dup := l.PeerAgentsRaw[uid]; dup && other != agent {
+			return fmt.Errorf("%s.peer_agents: uid %d maps to both %q and %q", prefix, uid, other, agent)
+		}
+		l.PeerAgentsRaw[uid] = agent
+	}
+
+	l.SocketModeRaw = defaultUnixSocketMode
+	if l.SocketMode != "" {
+		mode, err := strconv.ParseUint(l.SocketMode, 8, 32)
+		if err != nil || mode > 0o777 {
+			return fmt.Errorf("%s.socket_mode must be an octal permission like 0660, got %q", prefix, l.SocketMode)
+		}
+		l.SocketModeRaw = os.FileMode(mode)
+	}
+	return nil
+}
+
+// lookupUID resolve um usuário local de peer_agents: uid numérico ou nome.
+func lookupUID(local string) (uint32, error) {
+	local = strings.TrimSpace(local)
+	if uid, err := strconv.ParseUint(local, 10, 32); err == nil {
+		return uint32(uid), nil
+	}
+	u, err := user.Lookup(local)
+	if err != nil {
+		return 0, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("user %s has non-numeric uid %q", local, u.Uid)
+	}
+	return uint32(uid), nil
+}
+
+// PSKEnabled indica se algum listener (server.listen ou listeners) autentica
+// agents por PSK, exigindo o keyring de server.psk_file.
+func (c *ServerConfig) PSKEnabled() bool {
+	if c.Server.Auth == AuthModePSK {
+		return true
+	}
+	for _, l := range c.Listeners {
+		if l.Auth == AuthModePSK {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,354 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// NotificationsConfig configura o envio de notificações (bloco `notifications`).
+type NotificationsConfig struct {
+	SMTP    SMTPConfig    `yaml:"smtp"`
+	Command string        `yaml:"command"` // comando (sh -c) que recebe a mensagem no stdin, vazio = desabilitado
+	Webhook WebhookConfig `yaml:"webhook"`
+	Digest  DigestConfig  `yaml:"digest"`
+}
+
+// HasSender retorna true se ao menos um canal de entrega do digest está
+// configurado (o webhook conta apenas se inclui o evento digest).
+func (n NotificationsConfig) HasSender() bool {
+	return n.SMTP.Enabled() || n.Command != "" || n.Webhook.Wants(WebhookEventDigest)
+}
+
+// ServerNotificationsConfig configura as notificações do server (bloco
+// `notifications` do server.yaml).
+type ServerNotificationsConfig struct {
+	SMTP     SMTPConfig           `yaml:"smtp"`
+	Webhook  WebhookConfig        `yaml:"webhook"`
+	Slack    []SlackConfig        `yaml:"slack"`
+	Telegram []TelegramConfig     `yaml:"telegram"`
+	Failures FailureSummaryConfig `yaml:"failures"`
+	Digest   ServerDigestConfig   `yaml:"digest"`
+}
+
+// ChatWants retorna true se alguma rota de chat (Slack ou Telegram) assina o
+// evento.
+func (n ServerNotificationsConfig) ChatWants(event string) bool {
+	for _, s := range n.Slack {
+		if slices.Contains(s.Events, event) {
+			return true
+		}
+	}
+	for _, t := range n.Telegram {
+		if slices.Contains(t.Events, event) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasChat retorna true quando há ao menos uma rota de chat configurada.
+func (n ServerNotificationsConfig) HasChat() bool {
+	return len(n.Slack) > 0 || len(n.Telegram) > 0
+}
+
+// SlackConfig é uma rota de notificação para um canal do Slack (incoming
+// webhook). Cada incoming webhook publica em um canal fixo: para enviar
+// eventos diferentes a canais diferentes, declare uma rota por canal.
+type SlackConfig struct {
+	Name       string        `yaml:"name"`        // identifica a rota nos logs (default: "slack[i]")
+	WebhookURL string        `yaml:"webhook_url"` // URL do incoming webhook
+	Events     []string      `yaml:"events"`      // eventos enviados (default: todos)
+	Timeout    time.Duration `yaml:"timeout"`     // timeout de cada POST (default: 10s)
+}
+
+// TelegramConfig é uma rota de notificação para um chat do Telegram (Bot API).
+type TelegramConfig struct {
+	Name     string        `yaml:"name"`      // identifica a rota nos logs (default: "telegram[i]")
+	BotToken string        `yaml:"bot_token"` // token do bot (@BotFather)
+	ChatID   string        `yaml:"chat_id"`   // ID numérico do chat/grupo/canal ou @username do canal
+	APIURL   string        `yaml:"api_url"`   // base da Bot API (default: https://api.telegram.org)
+	Events   []string      `yaml:"events"`    // eventos enviados (default: todos)
+	Timeout  time.Duration `yaml:"timeout"`   // timeout de cada POST (default: 10s)
+}
+
+// FailureSummaryConfig configura o e-mail de resumo de falhas do server: as
+// falhas são agrupadas por janela (interval) e enviadas em uma única mensagem.
+type FailureSummaryConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"` // janela de agrupamento (default: 5m)
+	Template string        `yaml:"template"` // arquivo text/template com "subject" e "body" (vazio = embutido)
+}
+
+// ServerDigestConfig configura o digest do server: um e-mail por janela com
+// os backups concluídos e falhos por storage.
+type ServerDigestConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Schedule string `yaml:"schedule"` // cron expression do envio (default: "0 7 * * *")
+	Template string `yaml:"template"` // arquivo text/template com "subject" e "body" (vazio = embutido)
+}
+
+// Eventos de webhook do server (notifications.webhook.events).
+const (
+	WebhookEventBackupCommitted  = "backup_committed"  // backup gravado e verificado (inclui backups vazios)
+	WebhookEventChecksumMismatch = "checksum_mismatch" // checksum do trailer não confere com o recebido
+	WebhookEventSessionExpired   = "session_expired"   // sessão removida por inatividade
+	WebhookEventAgentOffline     = "agent_offline"     // control channel do agent caiu
+)
+
+// Eventos de webhook do agent (notifications.webhook.events).
+const (
+	WebhookEventBackupCompleted = "backup_completed" // execução concluída com sucesso
+	WebhookEventBackupFailed    = "backup_failed"    // execução falhou após os retries
+	WebhookEventDigest          = "digest"           // digest das execuções (notifications.digest)
+)
+
+// Eventos de resumo do server, roteáveis apenas para SMTP e chat
+// (notifications.slack/telegram[].events).
+const (
+	ChatEventFailures = "failures" // resumo de falhas (notifications.failures)
+	ChatEventDigest   = "digest"   // digest por storage (notifications.digest)
+)
+
+// ServerWebhookEvents lista os eventos aceitos no webhook do server.
+var ServerWebhookEvents = []string{WebhookEventBackupCommitted, WebhookEventChecksumMismatch, WebhookEventSessionExpired, WebhookEventAgentOffline}
+
+// AgentWebhookEvents lista os eventos aceitos no webhook do agent.
+var AgentWebhookEvents = []string{WebhookEventBackupCompleted, WebhookEventBackupFailed, WebhookEventDigest}
+
+// ServerChatEvents lista os eventos aceitos nas rotas de chat do server: os
+// eventos do webhook mais o resumo de falhas e o digest.
+var ServerChatEvents = append(slices.Clone(ServerWebhookEvents), ChatEventFailures, ChatEventDigest)
+
+// WebhookConfig configura o envio de eventos em JSON (POST) para URLs
+// externas, com retries e assinatura HMAC-SHA256 opcional do corpo.
+type WebhookConfig struct {
+	URLs       []string      `yaml:"urls"`        // vazio = desabilitado
+	Secret     string        `yaml:"secret"`      // chave do HMAC-SHA256 (header X-NBackup-Signature), vazio = sem assinatura
+	Events     []string      `yaml:"events"`      // eventos enviados (default: todos)
+	Timeout    time.Duration `yaml:"timeout"`     // timeout de cada POST (default: 10s)
+	MaxRetries int           `yaml:"max_retries"` // retries após a primeira tentativa (default: 3)
+}
+
+// Enabled retorna true quando o webhook está configurado.
+func (w WebhookConfig) Enabled() bool {
+	return len(w.URLs) > 0
+}
+
+// Wants retorna true se o evento deve ser enviado.
+func (w WebhookConfig) Wants(event string) bool {
+	return w.Enabled() && slices.Contains(w.Events, event)
+}
+
+// validate aplica defaults e valida o bloco webhook. valid são os eventos
+// aceitos (server ou agent) e o default de events.
+func (w *WebhookConfig) validate(prefix string, valid []string) error {
+	if !w.Enabled() {
+		return nil
+	}
+	for i, raw := range w.URLs {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s.urls[%d]: expected an http(s) URL, got %q", prefix, i, raw)
+		}
+	}
+	if len(w.Events) == 0 {
+		w.Events = slices.Clone(valid)
+	}
+	for _, e := range w.Events {
+		if !slices.Contains(valid, e) {
+			return fmt.Errorf("%s.events: unknown event %q (valid: %s)", prefix, e, strings.Join(valid, ", "))
+		}
+	}
+	if w.Timeout < 0 {
+		return fmt.Errorf("%s.timeout must be >= 0, got %s", prefix, w.Timeout)
+	}
+	if w.Timeout == 0 {
+		w.Timeout = 10 * time.Second
+	}
+	if w.MaxRetries < 0 {
+		return fmt.Errorf("%s.max_retries must be >= 0, got %d", prefix, w.MaxRetries)
+	}
+	if w.MaxRetries == 0 {
+		w.MaxRetries = 3
+	}
+	return nil
+}
+
+// validate aplica defaults ao bloco notifications do server.
+func (n *ServerNotificationsConfig) validate() error {
+	if err := n.SMTP.validate("notifications.smtp"); err != nil {
+		return err
+	}
+	if err := n.Webhook.validate("notifications.webhook", ServerWebhookEvents); err != nil {
+		return err
+	}
+	for i := range n.Slack {
+		if err := n.Slack[i].validate(fmt.Sprintf("notifications.slack[%d]", i), i); err != nil {
+			return err
+		}
+	}
+	for i := range n.Telegram {
+		if err := n.Telegram[i].validate(fmt.Sprintf("notifications.telegram[%d]", i), i); err != nil {
+			return err
+		}
+	}
+	if n.Failures.Enabled {
+		if !n.SMTP.Enabled() && !n.ChatWants(ChatEventFailures) {
+			return fmt.Errorf("notifications.failures requires notifications.smtp or a slack/telegram route with event %q", ChatEventFailures)
+		}
+		if n.Failures.Interval < 0 {
+			return fmt.Errorf("notifications.failures.interval must be >= 0, got %s", n.Failures.Interval)
+		}
+		if n.Failures.Interval == 0 {
+			n.Failures.Interval = 5 * time.Minute
+		}
+	}
+	if n.Digest.Enabled {
+		if !n.SMTP.Enabled() && !n.ChatWants(ChatEventDigest) {
+			return fmt.Errorf("notifications.digest requires notifications.smtp or a slack/telegram route with event %q", ChatEventDigest)
+		}
+		if n.Digest.Schedule == "" {
+			n.Digest.Schedule = "0 7 * * *"
+		}
+	}
+	return nil
+}
+
+// validateChatRoute aplica os defaults comuns às rotas de chat (name, events
+// e timeout) e valida os eventos.
+func validateChatRoute(prefix, kind string, index int, name *string, events *[]string, timeout *time.Duration) error {
+	if *name == "" {
+		*name = fmt.Sprintf("%s[%d]", kind, index)
+	}
+	if len(*events) == 0 {
+		*events = slices.Clone(ServerChatEvents)
+	}
+	for _, e := range *events {
+		if !slices.Contains(ServerChatEvents, e) {
+			return fmt.Errorf("%s.events: unknown event %q (valid: %s)", prefix, e, strings.Join(ServerChatEvents, ", "))
+		}
+	}
+	if *timeout < 0 {
+		return fmt.Errorf("%s.timeout must be >= 0, got %s", prefix, *timeout)
+	}
+	if *timeout == 0 {
+		*timeout = 10 * time.Second
+	}
+	return nil
+}
+
+// validate aplica defaults e valida uma rota do Slack.
+func (s *SlackConfig) validate(prefix string, index int) error {
+	u, err := url.Parse(s.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s.webhook_url: expected an http(s) URL, got %q", prefix, s.WebhookURL)
+	}
+	return validateChatRoute(prefix, "slack", index, &s.Name, &s.Events, &s.Timeout)
+}
+
+// validate aplica defaults e valida uma rota do Telegram.
+func (t *TelegramConfig) validate(prefix string, index int) error {
+	if t.BotToken == "" {
+		return fmt.Errorf("%s.bot_token is required", prefix)
+	}
+	if t.ChatID == "" {
+		return fmt.Errorf("%s.chat_id is required", prefix)
+	}
+	if t.APIURL == "" {
+		t.APIURL = "https://api.telegram.org"
+	}
+	u, err := url.Parse(t.APIURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s.api_url: expected an http(s) URL, got %q", prefix, t.APIURL)
+	}
+	t.APIURL = strings.TrimRight(t.APIURL, "/")
+	return validateChatRoute(prefix, "telegram", index, &t.Name, &t.Events, &t.Timeout)
+}
+
+// SMTPConfig configura o envio de e-mail via SMTP.
+type SMTPConfig struct {
+	Host     string   `yaml:"host"` // vazio = desabilitado
+	Port     int      `yaml:"port"` // default: 587 (465 com tls: tls, 25 com tls: none)
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	TLS      string   `yaml:"tls"` // "starttls" (default) | "tls" | "none"
+}
+
+// Enabled retorna true quando o SMTP está configurado.
+func (s SMTPConfig) Enabled() bool {
+	return s.Host != ""
+}
+
+// validate aplica defaults e valida o bloco SMTP. prefix é o caminho do bloco
+// na config (ex: "notifications.smtp") usado nas mensagens de erro.
+func (s *SMTPConfig) validate(prefix string) error {
+	if !s.Enabled() {
+		return nil
+	}
+	switch strings.ToLower(strings.TrimSpace(s.TLS)) {
+	case "", "starttls":
+		s.TLS = "starttls"
+	case "tls":
+		s.TLS = "tls"
+	case "none":
+		s.TLS = "none"
+	default:
+		return fmt.Errorf("%s.tls: unknown value %q (valid: starttls, tls, none)", prefix, s.TLS)
+	}
+	if s.Port == 0 {
+		switch s.TLS {
+		case "tls":
+			s.Port = 465
+		case "none":
+			s.Port = 25
+		default:
+			s.Port = 587
+		}
+	}
+	if s.Port < 1 || s.Port > 65535 {
+		return fmt.Errorf("%s.port must be between 1 and 65535, got %d", prefix, s.Port)
+	}
+	if s.From == "" {
+		return fmt.Errorf("%s.from is required", prefix)
+	}
+	if len(s.To) == 0 {
+		return fmt.Errorf("%s.to must have at least one recipient", prefix)
+	}
+	return nil
+}
+
+// DigestConfig configura o resumo periódico das execuções (um por janela
+// noturna, em vez de uma notificação por backup entry).
+type DigestConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Schedule      string `yaml:"schedule"`        // cron expression do envio (default: "0 7 * * *")
+	OnlyOnFailure bool   `yaml:"only_on_failure"` // envia apenas se houve falha ou entry sem execução na janela
+}
+
+// validate aplica defaults ao bloco notifications.
+func (n *NotificationsConfig) validate() error {
+	if err := n.SMTP.validate("notifications.smtp"); err != nil {
+		return err
+	}
+	if err := n.Webhook.validate("notifications.webhook", AgentWebhookEvents); err != nil {
+		return err
+	}
+	if n.Digest.Enabled {
+		if !n.HasSender() {
+			return fmt.Errorf("notifications.digest requires notifications.smtp, notifications.command or notifications.webhook")
+		}
+		if n.Digest.Schedule == "" {
+			n.Digest.Schedule = "0 7 * * *"
+		}
+	}
+	return nil
+}
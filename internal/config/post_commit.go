@@ -0,0 +1,117 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PostCommitAction é uma ação de storages.*.post_commit, executada em
+// background após cada commit bem-sucedido do storage, na ordem configurada.
+type PostCommitAction struct {
+	Name      string        `yaml:"name"`       // identificador nos logs e eventos (default: tipo + índice)
+	Type      string        `yaml:"type"`       // command | rclone
+	Command   string        `yaml:"command"`    // command: executado via sh -c com o backup em $NBACKUP_ARTIFACT
+	Remote    string        `yaml:"remote"`     // rclone: diretório de destino "remote:path", aceita {agent}, {backup} e {storage}
+	Rclone    string        `yaml:"rclone"`     // rclone: binário (default: rclone, via PATH)
+	Args      []string      `yaml:"args"`       // rclone: flags extras (ex: ["--bwlimit", "50M"])
+	Timeout   time.Duration `yaml:"timeout"`    // duração máxima de cada tentativa (default: 10m)
+	Retries   int           `yaml:"retries"`    // novas tentativas após uma falha (default: 0)
+	OnFailure string        `yaml:"on_failure"` // continue | stop: segue ou interrompe as ações seguintes (default: continue)
+}
+
+// Tipos de storages.*.post_commit[].type.
+const (
+	PostCommitCommand = "command" // comando externo com o caminho do backup
+	PostCommitRclone  = "rclone"  // rclone copyto do backup para um remote
+)
+
+// Políticas de storages.*.post_commit[].on_failure.
+const (
+	PostCommitOnFailureContinue = "continue"
+	PostCommitOnFailureStop     = "stop"
+)
+
+// DefaultPostCommitTimeout é o default de storages.*.post_commit[].timeout.
+const DefaultPostCommitTimeout = 10 * time.Minute
+
+// validatePostCommit valida as ações post_commit do storage s e aplica os
+// defaults.
+func validatePostCommit(name string, s StorageInfo) error {
+	if len(s.PostCommit) == 0 {
+		return nil
+	}
+	// O backup no disco é o artefato das ações: dedup guarda só o manifest e
+	// offload apaga o arquivo local após o upload
+	if s.IsDedup() {
+		return fmt.Errorf("storages.%s.post_commit is not supported with type dedup", name)
+	}
+	for _, b := range s.Buckets {
+		if b.Mode == BucketModeOffload {
+			return fmt.Errorf("storages.%s.post_commit cannot be combined with offload buckets (the local backup is deleted)", name)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i := range s.PostCommit {
+		a := &s.PostCommit[i]
+		prefix := fmt.Sprintf("storages.%s.post_commit[%d]", name, i)
+
+		a.Type = strings.ToLower(strings.TrimSpace(a.Type))
+		switch a.Type {
+		case PostCommitCommand:
+			if strings.TrimSpace(a.Command) == "" {
+				return fmt.Errorf("%s.command is required for type command", prefix)
+			}
+			if a.Remote != "" || a.Rclone != "" || len(a.Args) > 0 {
+				return fmt.Errorf("%s: remote, rclone and args are only valid for type rclone", prefix)
+			}
+		case PostCommitRclone:
+			if !strings.Contains(a.Remote, ":") {
+				return fmt.Errorf("%s.remote must be an rclone destination like \"remote:path\", got %q", prefix, a.Remote)
+			}
+			if a.Command != "" {
+				return fmt.Errorf("%s.command is only valid for type command", prefix)
+			}
+			if a.Rclone == "" {
+				a.Rclone = "rclone"
+			}
+		case "":
+			return fmt.Errorf("%s.type is required (command or rclone)", prefix)
+		default:
+			return fmt.Errorf("%s.type must be command or rclone, got %q", prefix, a.Type)
+		}
+
+		if a.Name == "" {
+			a.Name = fmt.Sprintf("%s-%d", a.Type, i)
+		}
+		if names[a.Name] {
+			return fmt.Errorf("%s.name %q is duplicated", prefix, a.Name)
+		}
+		names[a.Name] = true
+
+		if a.Timeout == 0 {
+			a.Timeout = DefaultPostCommitTimeout
+		}
+		if a.Timeout < time.Second {
+			return fmt.Errorf("%s.timeout must be at least 1s, got %s", prefix, a.Timeout)
+		}
+		if a.Retries < 0 || a.Retries > 10 {
+			return fmt.Errorf("%s.retries must be between 0 and 10, got %d", prefix, a.Retries)
+		}
+
+		a.OnFailure = strings.ToLower(strings.TrimSpace(a.OnFailure))
+		switch a.OnFailure {
+		case "":
+			a.OnFailure = PostCommitOnFailureContinue
+		case PostCommitOnFailureContinue, PostCommitOnFailureStop:
+		default:
+			return fmt.Errorf("%s.on_failure must be continue or stop, got %q", prefix, a.OnFailure)
+		}
+	}
+	return nil
+}
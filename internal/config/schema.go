@@ -0,0 +1,374 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentConfigVersion é a versão do schema de agent.yaml e server.yaml
+// entendida por este build (campo config_version). Arquivos sem o campo são
+// versão 0. Versões anteriores são migradas automaticamente na carga (em
+// memória; o subcomando migrate-config grava o resultado) e versões
+// posteriores são recusadas.
+const CurrentConfigVersion = 1
+
+// UnknownFieldPrefix marca chaves de extensão, ignoradas pela detecção de
+// campos desconhecidos em qualquer nível (ex: "x-defaults: &defaults" para
+// âncoras YAML).
+const UnknownFieldPrefix = "x-"
+
+// schemaMigration converte um documento da versão from para from+1,
+// retornando a descrição de cada alteração feita.
+type schemaMigration struct {
+	from  int
+	apply func(root *yaml.Node) []string
+}
+
+// agentMigrations são as migrações de schema do agent.yaml, em ordem.
+var agentMigrations = []schemaMigration{
+	{from: 0, apply: migrateAgentV0},
+}
+
+// serverMigrations são as migrações de schema do server.yaml, em ordem.
+var serverMigrations = []schemaMigration{
+	{from: 0, apply: func(*yaml.Node) []string { return nil }},
+}
+
+// migrateAgentV0: auto_scaler no formato string legado ("auto_scaler:
+// efficiency") vira o formato estruturado ("auto_scaler: {mode: efficiency}"),
+// com a mesma semântica (enabled ausente = habilitado).
+func migrateAgentV0(root *yaml.Node) []string {
+	var notes []string
+	backups := mappingValue(root, "backups")
+	if backups == nil || backups.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for i, b := range backups.Content {
+		as := mappingValue(b, "auto_scaler")
+		if as == nil || as.Kind != yaml.ScalarNode || as.Value == "" {
+			continue
+		}
+		mode := as.Value
+		*as = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "mode"},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: mode},
+		}}
+		notes = append(notes, fmt.Sprintf("backups[%d].auto_scaler: legacy string %q rewritten as {mode: %s}", i, mode, mode))
+	}
+	return notes
+}
+
+// MigrateAgentConfig aplica ao agent.yaml em data as migrações até
+// CurrentConfigVersion e retorna o YAML resultante (comentários preservados)
+// e a descrição das alterações; nenhuma alteração se já estiver na versão atual.
+func MigrateAgentConfig(data []byte) ([]byte, []string, error) {
+	return migrateConfig(data, agentMigrations)
+}
+
+// MigrateServerConfig é o equivalente de MigrateAgentConfig para o server.yaml.
+func MigrateServerConfig(data []byte) ([]byte, []string, error) {
+	return migrateConfig(data, serverMigrations)
+}
+
+// MigrateAgentConfigFile migra o agent.yaml em path (ver MigrateAgentConfig).
+// Com write, o resultado é validado e grava o arquivo; o original é
+// preservado em {path}.bak.
+func MigrateAgentConfigFile(path string, write bool) ([]string, error) {
+	return migrateConfigFile(path, write, MigrateAgentConfig, func(p string) error {
+		_, err := LoadAgentConfig(p)
+		return err
+	})
+}
+
+// MigrateServerConfigFile é o equivalente de MigrateAgentConfigFile para o server.yaml.
+func MigrateServerConfigFile(path string, write bool) ([]string, error) {
+	return migrateConfigFile(path, write, MigrateServerConfig, func(p string) error {
+		_, err := LoadServerConfig(p)
+		return err
+	})
+}
+
+func migrateConfigFile(path string, write bool, migrate func([]byte) ([]byte, []string, error), load func(string) error) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	migrated, notes, err := migrate(data)
+	if err != nil {
+		return nil, fmt.Errorf("migrating config: %w", err)
+	}
+	if !write || len(notes) == 0 {
+		return notes, nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".migrate-*")
+	if err != nil {
+		return nil, fmt.Errorf("writing migrated config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(migrated); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("writing migrated config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("writing migrated config: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), fi.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("writing migrated config: %w", err)
+	}
+	if err := load(tmp.Name()); err != nil {
+		return nil, fmt.Errorf("migrated config is invalid, original left untouched: %w", err)
+	}
+	if err := os.WriteFile(path+".bak", data, fi.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("writing backup of original config: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("writing migrated config: %w", err)
+	}
+	return notes, nil
+}
+
+func migrateConfig(data []byte, migrations []schemaMigration) ([]byte, []string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	notes, err := migrateDocument(&doc, migrations)
+	if err != nil || len(notes) == 0 {
+		return data, notes, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("encoding migrated config: %w", err)
+	}
+	return buf.Bytes(), notes, nil
+}
+
+// decodeConfig decodifica o YAML em data para out: migra o documento para
+// CurrentConfigVersion, recusa campos desconhecidos (exceto os de
+// allow_unknown_fields e os com prefixo UnknownFieldPrefix) e retorna as
+// migrações aplicadas.
+func decodeConfig(data []byte, out any, migrations []schemaMigration) ([]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	notes, err := migrateDocument(&doc, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var allow []string
+	if n := mappingValue(doc.Content[0], "allow_unknown_fields"); n != nil {
+		if err := n.Decode(&allow); err != nil {
+			return nil, fmt.Errorf("allow_unknown_fields: %w", err)
+		}
+	}
+	var unknown []string
+	unknownFields(doc.Content[0], reflect.TypeOf(out).Elem(), "", "", allow, &unknown)
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown fields: %s (misspelled or renamed? list them in allow_unknown_fields to ignore)", strings.Join(unknown, ", "))
+	}
+
+	if err := doc.Decode(out); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// migrateDocument aplica as migrações a partir do config_version do
+// documento e atualiza o campo para CurrentConfigVersion.
+func migrateDocument(doc *yaml.Node, migrations []schemaMigration) ([]string, error) {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	root := doc.Content[0]
+
+	version := 0
+	vnode := mappingValue(root, "config_version")
+	if vnode != nil {
+		v, err := strconv.Atoi(vnode.Value)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("config_version must be a non-negative integer, got %q", vnode.Value)
+		}
+		version = v
+	}
+	if version > CurrentConfigVersion {
+		return nil, fmt.Errorf("config_version %d is newer than supported by this build (%d); upgrade nbackup", version, CurrentConfigVersion)
+	}
+	if version == CurrentConfigVersion {
+		return nil, nil
+	}
+
+	var notes []string
+	for _, m := range migrations {
+		if m.from >= version {
+			notes = append(notes, m.apply(root)...)
+		}
+	}
+	notes = append(notes, fmt.Sprintf("config_version: %d -> %d", version, CurrentConfigVersion))
+
+	current := strconv.Itoa(CurrentConfigVersion)
+	if vnode != nil {
+		vnode.Value, vnode.Tag, vnode.Style = current, "!!int", 0
+	} else {
+		root.Content = append([]*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "config_version"},
+			{Kind: yaml.ScalarNode, Tag: "!!int", Value: current},
+		}, root.Content...)
+	}
+	return notes, nil
+}
+
+// mappingValue retorna o valor de key no mapping node (nil se ausente).
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// unknownFields acumula em out as chaves de node sem campo correspondente em
+// t. field é o caminho exibido (com índices: "backups[0].name"); pattern é o
+// mesmo caminho sem índices ("backups.name"), comparado com os globs de allow.
+func unknownFields(node *yaml.Node, t reflect.Type, field, pattern string, allow []string, out *[]string) {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return // formas alternativas tratadas por UnmarshalYAML (ex: auto_scaler string)
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			if key == "<<" { // merge key: o conteúdo pertence a este mapping
+				for _, m := range append([]*yaml.Node{value}, value.Content...) {
+					if m.Kind == yaml.AliasNode {
+						unknownFields(m, t, field, pattern, allow, out)
+					}
+				}
+				continue
+			}
+			keyPath, keyPattern := joinPath(field, key), joinPath(pattern, key)
+			ft, ok := fields[key]
+			if !ok {
+				if !strings.HasPrefix(key, UnknownFieldPrefix) && !allowedField(keyPattern, allow) {
+					*out = append(*out, keyPath)
+				}
+				continue
+			}
+			unknownFields(value, ft, keyPath, keyPattern, allow, out)
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", field, i), pattern, allow, out)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			unknownFields(node.Content[i+1], t.Elem(), joinPath(field, key), joinPath(pattern, "*"), allow, out)
+		}
+	}
+}
+
+// yamlFields mapeia as chaves YAML de t (incluindo structs inline) para o
+// tipo de cada campo.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			for k, v := range yamlFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func joinPath(base, key string) string {
+	if base == "" {
+		return key
+	}
+	return base + "." + key
+}
+
+// allowedField indica se o caminho (sem índices) casa algum glob de allow.
+func allowedField(pattern string, allow []string) bool {
+	for _, a := range allow {
+		if ok, _ := path.Match(a, pattern); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// WarnMigrations registra as migrações de schema aplicadas em memória na
+// carga do agent.yaml.
+func (c *AgentConfig) WarnMigrations(logger interface{ Warn(msg string, args ...any) }) {
+	warnMigrations(logger, c.Migrations, "nbackup-agent")
+}
+
+// WarnMigrations registra as migrações de schema aplicadas em memória na
+// carga do server.yaml.
+func (c *ServerConfig) WarnMigrations(logger interface{ Warn(msg string, args ...any) }) {
+	warnMigrations(logger, c.Migrations, "nbackup-server")
+}
+
+func warnMigrations(logger interface{ Warn(msg string, args ...any) }, migrations []string, cmd string) {
+	for _, m := range migrations {
+		logger.Warn("config migrated in memory", "change", m,
+			"hint", fmt.Sprintf("run '%s migrate-config --write' to persist", cmd))
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
@@ -17,7 +19,11 @@ import (
 
 // ServerConfig representa a configuração completa do nbackup-server.
 type ServerConfig struct {
+	ConfigVersion           int                    `yaml:"config_version"`       // versão do schema (ver CurrentConfigVersion); ausente = 0, migrado na carga
+	AllowUnknownFields      []string               `yaml:"allow_unknown_fields"` // globs de campos desconhecidos tolerados (ex: "storages.*.legacy_*")
+	Migrations              []string               `yaml:"-"`                    // migrações de schema aplicadas na carga (ver WarnMigrations)
 	Server                  ServerListen           `yaml:"server"`
+	Listeners               []ListenerConfig       `yaml:"listeners"` // listeners adicionais (outras interfaces/portas), atendidos pelo mesmo Handler
 	TLS                     TLSServer              `yaml:"tls"`
 	Storages                map[string]StorageInfo  `yaml:"storages"`
 	Logging                 LoggingInfo            `yaml:"logging"`
@@ -26,8 +32,154 @@ type ServerConfig struct {
 	WebUI                   WebUIConfig            `yaml:"web_ui"`
 	ChunkBuffer             ChunkBufferConfig      `yaml:"chunk_buffer"`
 	ControlLostGracePeriod  time.Duration          `yaml:"control_lost_grace_period"` // default: 5m
+	IngestLimit             string                 `yaml:"ingest_limit"`              // teto global de ingestão em bytes/seg (ex: "800mb"), vazio = sem limite
+	IngestLimitRaw          int64                  `yaml:"-"`
+	StreamBudget            int                    `yaml:"stream_budget"`             // teto de streams paralelos somados entre as sessões em andamento, 0 = sem limite
+	Chaos                   ChaosConfig            `yaml:"chaos"`
+	Enrollment              EnrollmentConfig       `yaml:"enrollment"`
+	Notifications           ServerNotificationsConfig `yaml:"notifications"`
+	SnapshotGroups          []SnapshotGroupConfig  `yaml:"snapshot_groups"`
+	Placements              []PlacementConfig      `yaml:"placements"`
+	RestoreDrills           RestoreDrillConfig     `yaml:"restore_drills"`
+	AuditLog                AuditLogConfig         `yaml:"audit_log"`
+	Accounting              AccountingConfig       `yaml:"accounting"`
 }
 
+// AccountingConfig habilita a contabilidade de ingestão: bytes e sessões
+// (ok/falha) acumulados por agent, storage e dia, consultados pelo comando
+// `nbackup-server report` e pela página de relatórios da WebUI.
+type AccountingConfig struct {
+	Enabled       bool   `yaml:"enabled"`        // default: false
+	File          string `yaml:"file"`           // default: accounting.jsonl
+	RetentionDays int    `yaml:"retention_days"` // dias mantidos no arquivo (default: 400)
+}
+
+// AuditLogConfig habilita o audit log de sessões: um registro JSONL
+// append-only, separado dos logs do slog, com o ciclo de vida completo de
+// cada sessão (handshake, streams, rotações, retransmissões, resultado e
+// path do commit). Os arquivos rotacionam por tamanho e um índice por sessão
+// localiza os registros de cada uma (usado pela página de histórico da WebUI).
+type AuditLogConfig struct {
+	Enabled    bool   `yaml:"enabled"`   // default: false
+	Dir        string `yaml:"dir"`       // diretório dos arquivos e do índice (obrigatório, fora dos storages)
+	MaxSize    string `yaml:"max_size"`  // tamanho de cada arquivo antes da rotação (default: 64mb)
+	MaxFiles   int    `yaml:"max_files"` // arquivos mantidos, incluindo o corrente (default: 20)
+	MaxSizeRaw int64  `yaml:"-"`
+}
+
+// RestoreDrillConfig habilita os restore drills automáticos: periodicamente o
+// server sorteia archives dos storages, restaura uma amostra aleatória de
+// arquivos em um diretório de quarentena e compara o SHA-256 dos arquivos
+// restaurados com o manifest do archive. O resultado fica no catálogo.
+type RestoreDrillConfig struct {
+	Enabled     bool          `yaml:"enabled"`      // default: false
+	Interval    time.Duration `yaml:"interval"`     // intervalo entre rodadas (default: 24h)
+	Archives    int           `yaml:"archives"`     // archives sorteados por rodada (default: 1)
+	SampleFiles int           `yaml:"sample_files"` // arquivos restaurados por archive (default: 20)
+	ScratchDir  string        `yaml:"scratch_dir"`  // área de quarentena para os restores (obrigatório, fora dos storages)
+	ResultsFile string        `yaml:"results_file"` // histórico dos drills (default: {scratch_dir}/restore-drills.jsonl)
+}
+
+// SnapshotGroupConfig define um grupo de agents cujo backup é disparado em
+// conjunto pelo server (ex: nós de um cluster de banco): todos executam a fase
+// de snapshot ao mesmo tempo e só iniciam a transferência depois que todos
+// confirmaram, produzindo backups mutuamente consistentes. O backup de cada
+// agent deve ter snapshot.coordinated habilitado.
+type SnapshotGroupConfig struct {
+	Name           string        `yaml:"name"`
+	Backup         string        `yaml:"backup"`          // nome do backup entry nos agents
+	Agents         []string      `yaml:"agents"`          // pelo menos 2 agents
+	Schedule       string        `yaml:"schedule"`        // cron expression; vazio = apenas sob demanda (nbackup-server snapshot)
+	PrepareTimeout time.Duration `yaml:"prepare_timeout"` // espera máxima pelas confirmações de snapshot (default: 5m)
+}
+
+// PlacementConfig distribui os backups entre storages em failure domains
+// distintos (ex: arrays físicos diferentes). Os agents usam Name no campo
+// storage do backup entry e o server escolhe o storage real no handshake:
+// spread alterna as execuções sucessivas do mesmo agent/backup entre os
+// failure domains, para que a perda de um array não leve todo o histórico do
+// host; pin fixa cada agent/backup em um dos storages (hash estável),
+// distribuindo os hosts sem separar o histórico de cada um.
+type PlacementConfig struct {
+	Name     string            `yaml:"name"`     // nome usado no campo storage dos agents (não pode coincidir com um storage)
+	Storages []string          `yaml:"storages"` // pelo menos 2 storages
+	Policy   string            `yaml:"policy"`   // spread|pin (default: spread)
+	Backups  map[string]string `yaml:"backups"`  // policy por nome de backup entry, sobrepõe policy
+}
+
+// Políticas de placements.*.policy.
+const (
+	PlacementSpread = "spread"
+	PlacementPin    = "pin"
+)
+
+// PolicyFor retorna a policy do placement para o backup entry backup.
+func (p PlacementConfig) PolicyFor(backup string) string {
+	if policy, ok := p.Backups[backup]; ok {
+		return policy
+	}
+	return p.Policy
+}
+
+// EnrollmentConfig habilita o enrollment de agents pela PKI embutida: um agent
+// apresenta um token de uso único (`nbackup-server pki token`) e um CSR em um
+// listener TLS dedicado (sem mTLS) e recebe um certificado de client assinado
+// pela CA com CN=nome do agent.
+type EnrollmentConfig struct {
+	Enabled      bool          `yaml:"enabled"`       // default: false
+	Listen       string        `yaml:"listen"`        // default: ":9849"
+	CAKey        string        `yaml:"ca_key"`        // chave privada da CA (tls.ca_cert), obrigatória quando habilitado
+	TokensFile   string        `yaml:"tokens_file"`   // default: "/var/lib/nbackup/enroll-tokens.json"
+	CertValidity time.Duration `yaml:"cert_validity"` // validade dos certificados emitidos (default: 8760h)
+}
+
+// ChaosConfig habilita a injeção aleatória de falhas no data plane do server
+// (rotações de stream, SACKs atrasados e quedas de conexão), exercitando
+// continuamente os caminhos de resume, re-join e retransmissão.
+// Destinado exclusivamente a ambientes de staging/homologação: o server recusa
+// iniciar com chaos habilitado quando NBACKUP_ENV=production.
+type ChaosConfig struct {
+	Enabled bool `yaml:"enabled"` // default: false
+	// Probabilidades: ptr, nil = default e &0.0 = falha desligada.
+	RotateProbability    *float64      `yaml:"rotate_probability"`     // por stream a cada tick de 15s (default: 0.01)
+	SACKDelayProbability *float64      `yaml:"sack_delay_probability"` // por SACK/ChunkSACK enviado (default: 0.001)
+	SACKDelayMax         time.Duration `yaml:"sack_delay_max"`         // atraso máximo de um SACK (default: 2s)
+	DropProbability      *float64      `yaml:"drop_probability"`       // por chunk/SACK recebido (default: 0.0005)
+	// Faults são falhas determinísticas nos streams paralelos. Com faults,
+	// as probabilidades não recebem default (só as informadas valem).
+	Faults []ChaosFault `yaml:"faults"`
+
+	// Os *Raw são preenchidos por validate() com o valor efetivo; não vêm do YAML.
+	RotateProbabilityRaw    float64 `yaml:"-"`
+	SACKDelayProbabilityRaw float64 `yaml:"-"`
+	DropProbabilityRaw      float64 `yaml:"-"`
+}
+
+// Ações de uma falha determinística (chaos.faults[].action).
+const (
+	ChaosFaultDrop      = "drop"       // corta a leitura do stream após after_bytes
+	ChaosFaultKill      = "kill"       // fecha a conexão do stream after após o join
+	ChaosFaultCorrupt   = "corrupt"    // corrompe o payload do chunk (CRC32 inválido)
+	ChaosFaultDelaySACK = "delay_sack" // atrasa o ChunkSACK do chunk em delay
+	ChaosFaultRotate    = "rotate"     // força a flow rotation do stream após o chunk
+)
+
+// ChaosFault é uma falha disparada em um ponto exato de um stream paralelo,
+// em vez de sorteada: reproduz um cenário de falha em testes de integração.
+// Cada falha dispara times vezes no total, somando todas as sessões e
+// conexões do stream.
+type ChaosFault struct {
+	Action        string        `yaml:"action"`      // drop|kill|corrupt|delay_sack|rotate
+	Stream        *int          `yaml:"stream"`      // índice do stream (ausente = qualquer)
+	Chunk         *uint32       `yaml:"chunk"`       // corrupt/delay_sack/rotate: GlobalSeq do chunk (ausente = qualquer)
+	AfterBytes    string        `yaml:"after_bytes"` // drop: bytes lidos na conexão do stream (ex: "4mb")
+	AfterBytesRaw int64         `yaml:"-"`
+	After         time.Duration `yaml:"after"` // kill: tempo desde o join
+	Delay         time.Duration `yaml:"delay"` // delay_sack: atraso do ChunkSACK
+	Times         int           `yaml:"times"` // disparos (default: 1; -1 = sem limite)
+}
+
+
 // ChunkBufferConfig define o buffer de chunks em memória compartilhado globalmente
 // entre todas as sessões de backup paralelo.
 // Quando Size for "0" ou vazio, o buffer é desabilitado e o comportamento atual
@@ -85,6 +237,18 @@ type WebUIConfig struct {
 	BucketUploadFile     string `yaml:"bucket_upload_file"`      // default: "bucket-uploads.jsonl"
 	BucketUploadMaxLines int    `yaml:"bucket_upload_max_lines"` // default: 5000
 
+	// API REST: tokens Bearer com role. Sem tokens, as ações de gerenciamento
+	// ficam desabilitadas e a leitura depende apenas de allow_origins.
+	APITokens       []APITokenConfig `yaml:"api_tokens"`
+	APIRequireToken bool             `yaml:"api_require_token"` // exige token também nas rotas de leitura
+
+	// Download dos backups do catálogo pela WebUI/API (auditado via evento backup_downloaded).
+	AllowDownloads bool `yaml:"allow_downloads"` // default: false
+
+	// Login da WebUI: com usuários, a WebUI e a API exigem login (ou token).
+	Users      []WebUIUserConfig `yaml:"users"`
+	SessionTTL time.Duration     `yaml:"session_ttl"` // default: 12h
+
 	// Parsed é preenchido em validate(); não vem do YAML.
 	ParsedCIDRs []*net.IPNet `yaml:"-"`
 }
@@ -147,16 +311,53 @@ func (g *GapDetectionConfig) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
-// ServerListen contém o endereço de escuta do server.
+// Modos de autenticação de agents em um listener (server.auth / tls.auth).
+const (
+	AuthModeMTLS     = "mtls"     // certificado de client assinado pela CA (default)
+	AuthModePSK      = "psk"      // TLS sem certificado de client + HMAC com pre-shared key por agent
+	AuthModePeerCred = "peercred" // listener unix: uid do processo local (SO_PEERCRED) mapeado em peer_agents
+)
+
+// ServerListen contém o endereço de escuta do server e o modo de
+// autenticação de agents do listener.
 type ServerListen struct {
-	Listen string `yaml:"listen"`
+	Listen  string `yaml:"listen"`
+	Auth    string `yaml:"auth"`     // mtls | psk (default: mtls)
+	PSKFile string `yaml:"psk_file"` // keyring `agent:chave` (obrigatório com auth: psk)
+
+	// Experimental: aceita também agents com server.transport: quic, via
+	// QUIC (UDP) no mesmo endereço de listen.
+	QUIC bool `yaml:"quic"`
+
+	// Ajuste dos sockets TCP aceitos (keepalive, buffers, congestion control).
+	// Não se aplica ao listener QUIC.
+	Socket SocketConfig `yaml:"socket"`
+
+	// Socket unix local usado por `nbackup-server sessions|agents|storage`
+	AdminSocket AdminSocketConfig `yaml:"admin_socket"` // default path: /run/nbackup/server.sock
+
+	// Persistência das sessões parciais: com o arquivo, backups single-stream
+	// interrompidos por um restart do server são retomados pelo agent.
+	SessionsFile string `yaml:"sessions_file"` // ex: /var/lib/nbackup/sessions.jsonl; vazio = sessões só em memória
 }
 
-// TLSServer contém os caminhos dos certificados mTLS do server.
+// TLSServer contém os caminhos dos certificados mTLS do server e os limites
+// de concorrência de handshakes TLS.
 type TLSServer struct {
 	CACert     string `yaml:"ca_cert"`
 	ServerCert string `yaml:"server_cert"`
 	ServerKey  string `yaml:"server_key"`
+
+	// Controle de acesso de agents (aplicado sem restart: a CRL é recarregada
+	// quando o arquivo muda e a allow-list a cada SIGHUP).
+	CRLFile       string   `yaml:"crl_file"`       // CRL (PEM ou DER) assinada pela CA; vazio = sem revogação
+	AllowedAgents []string `yaml:"allowed_agents"` // agents autorizados (CN, SPIFFE ou PSK); vazio = qualquer agent autenticado
+
+	// Limita handshakes TLS simultâneos para proteger o data plane em
+	// tempestades de reconexão (ex: restart do server com centenas de agents).
+	MaxConcurrentHandshakes int           `yaml:"max_concurrent_handshakes"` // default: 2 × NumCPU
+	HandshakeQueueTimeout   time.Duration `yaml:"handshake_queue_timeout"`   // espera máxima na fila (default: 30s)
+	HandshakeTimeout        time.Duration `yaml:"handshake_timeout"`         // duração máxima do handshake (default: 10s)
 }
 
 // BucketMode define os modos de operação do object storage pós-commit.
@@ -198,6 +399,7 @@ type BucketConfig struct {
 // StorageInfo contém configurações de armazenamento e rotação de um storage nomeado.
 type StorageInfo struct {
 	BaseDir                string         `yaml:"base_dir"`
+	Type                   string         `yaml:"type"`                        // file|dedup|discard|null (default: file)
 	MaxBackups             int            `yaml:"max_backups"`
 	AssemblerMode          string         `yaml:"assembler_mode"`              // eager|lazy (default: eager)
 	AssemblerPendingMem    string         `yaml:"assembler_pending_mem_limit"` // ex: "8mb" (default: 8mb)
@@ -207,8 +409,311 @@ type StorageInfo struct {
 	ChunkFsync             *bool          `yaml:"chunk_fsync"`        // fsync nos writes de chunk staging (default: true desde v4.0.0)
 	VerifyIntegrity        bool           `yaml:"verify_integrity"`   // valida integridade do archive antes do rotate (default: false)
 	Buckets                []BucketConfig `yaml:"buckets"`            // destinos de object storage pós-commit (opcional)
+	BackupWindow           string         `yaml:"backup_window"`      // janela diária "HH:MM-HH:MM" (hora local) em que handshakes são aceitos (default: sem restrição)
+	BackupWindowRaw        *TimeWindow    `yaml:"-"`
+	WriteBufferSize        string         `yaml:"write_buffer_size"`  // buffer de escrita em disco: "auto" ou tamanho (ex: "4mb") (default: auto)
+	WriteBufferSizeRaw     int64          `yaml:"-"`                  // 0 = auto (definido pelo server conforme o disco do base_dir)
+	WriteWorkers           int            `yaml:"write_workers"`      // writes simultâneos em disco das sessões do storage, com fsync agrupado (default: 0 = sem fila)
+	Preallocate            bool           `yaml:"preallocate"`        // reserva (fallocate) o arquivo montado dos backups paralelos com o tamanho do último backup (default: false)
+	DropPageCache          bool           `yaml:"drop_page_cache"`    // remove do page cache o arquivo montado à medida que é gravado (default: false)
+	MinFreeInodes          *uint64        `yaml:"min_free_inodes"`    // inodes livres mínimos para aceitar backups (default: 10000, 0 = desabilitado)
+	MinFreeSpace           string         `yaml:"min_free_space"`     // espaço livre mínimo no filesystem para aceitar backups (ex: "50gb"), vazio = desabilitado
+	MinFreeSpaceRaw        int64          `yaml:"-"`
+	Quota                  string         `yaml:"quota"`              // espaço máximo ocupado pelos backups do storage (ex: "2tb"), vazio = sem limite
+	QuotaRaw               int64          `yaml:"-"`
+	IngestLimit            string         `yaml:"ingest_limit"`      // teto de ingestão do storage em bytes/seg (ex: "200mb"), vazio = sem limite
+	IngestLimitRaw         int64          `yaml:"-"`
+	DiskHealth             DiskHealthConfig `yaml:"disk_health"` // monitoramento da saúde do disco do base_dir (opcional)
+	FailureDomain          string           `yaml:"failure_domain"` // array/disco físico do storage, usado pelos placements (default: nome do storage)
+	Lifecycle              LifecycleConfig  `yaml:"lifecycle"`      // recompressão dos backups antigos em background (opcional)
+	SessionTTL             time.Duration    `yaml:"session_ttl"`    // inatividade máxima de uma sessão parcial antes de expirar; idade mínima de um .tmp órfão (default: 1h)
+	Layout                 string           `yaml:"layout"`         // caminho dos backups, ex: "{agent}/{backup}/{year}/{month}/{timestamp}.tar.{ext}" (default: DefaultStorageLayout)
+	LayoutRaw              *StorageLayout   `yaml:"-"`              // nil = layout default
+	PostCommit             []PostCommitAction `yaml:"post_commit"`  // ações executadas em background após cada commit (comando, rclone)
+	Immutable              ImmutableConfig    `yaml:"immutable"`    // WORM: backups commitados travados e registrados em um ledger assinado (opcional)
+}
+
+// ImmutableConfig configura o modo WORM de um storage (storages.*.immutable):
+// cada backup commitado é travado no disco (chattr +i ou somente leitura) e
+// registrado em um ledger append-only, encadeado por hash e assinado com
+// HMAC. A rotação não apaga um backup imutável na hora: ela o libera
+// (registro unlock no ledger) e só o remove após UnlockGrace.
+type ImmutableConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Mode          string        `yaml:"mode"`            // chattr | read_only (default: read_only)
+	LedgerKeyFile string        `yaml:"ledger_key_file"` // chave HMAC do ledger, mínimo 32 bytes (obrigatório)
+	UnlockGrace   time.Duration `yaml:"unlock_grace"`    // espera entre a liberação pela rotação e a remoção (default: 24h)
+}
+
+// Modos de storages.*.immutable.mode.
+const (
+	ImmutableModeChattr   = "chattr"    // atributo imutável do ext4/xfs (requer CAP_LINUX_IMMUTABLE)
+	ImmutableModeReadOnly = "read_only" // permissão 0444; alterações são detectadas pelo ledger
+)
+
+// DefaultUnlockGrace é o default de storages.*.immutable.unlock_grace.
+const DefaultUnlockGrace = 24 * time.Hour
+
+// validate valida o bloco immutable do storage s e aplica os defaults.
+func (im *ImmutableConfig) validate(name string, s StorageInfo) error {
+	if !im.Enabled {
+		return nil
+	}
+	// Backups imutáveis não podem ser substituídos nem apagados fora da rotação
+	switch {
+	case s.IsDedup():
+		return fmt.Errorf("storages.%s.immutable is not supported with type dedup", name)
+	case s.Lifecycle.Enabled():
+		return fmt.Errorf("storages.%s.immutable cannot be combined with lifecycle (recompression rewrites backups)", name)
+	}
+	for _, b := range s.Buckets {
+		if b.Mode == BucketModeOffload || b.Mode == BucketModeArchive {
+			return fmt.Errorf("storages.%s.immutable cannot be combined with %s buckets", name, b.Mode)
+		}
+	}
+
+	im.Mode = strings.ToLower(strings.TrimSpace(im.Mode))
+	switch im.Mode {
+	case "":
+		im.Mode = ImmutableModeReadOnly
+	case ImmutableModeChattr, ImmutableModeReadOnly:
+	default:
+		return fmt.Errorf("storages.%s.immutable.mode must be chattr or read_only, got %q", name, im.Mode)
+	}
+	if im.LedgerKeyFile == "" {
+		return fmt.Errorf("storages.%s.immutable.ledger_key_file is required", name)
+	}
+	if im.UnlockGrace == 0 {
+		im.UnlockGrace = DefaultUnlockGrace
+	}
+	if im.UnlockGrace < time.Minute {
+		return fmt.Errorf("storages.%s.immutable.unlock_grace must be at least 1m, got %s", name, im.UnlockGrace)
+	}
+	return nil
+}
+
+// LifecycleConfig configura o tier de recompressão de um storage
+// (storages.*.lifecycle): um worker em background recompacta com zstd, em
+// nível alto e janela longa (como zstd -19 --long), os backups mais antigos
+// que RecompressAfterDays. Backups .tar.gz viram .tar.zst.
+type LifecycleConfig struct {
+	RecompressAfterDays int    `yaml:"recompress_after_days"` // idade mínima (dias desde o commit); 0 = desabilitado
+	Level               string `yaml:"level"`                 // better|best (default: best)
+	Window              string `yaml:"window"`                // janela do zstd, potência de 2 entre 1mb e 512mb (default: 128mb)
+	WindowRaw           int64  `yaml:"-"`
+}
+
+// Níveis de storages.*.lifecycle.level.
+const (
+	LifecycleLevelBetter = "better"
+	LifecycleLevelBest   = "best"
+)
+
+// Enabled indica se o storage tem recompressão de backups antigos.
+func (l LifecycleConfig) Enabled() bool {
+	return l.RecompressAfterDays > 0
+}
+
+// validate valida o bloco lifecycle do storage s e aplica os defaults.
+func (l *LifecycleConfig) validate(name string, s StorageInfo) error {
+	if l.RecompressAfterDays < 0 {
+		return fmt.Errorf("storages.%s.lifecycle.recompress_after_days must be >= 0, got %d", name, l.RecompressAfterDays)
+	}
+	if !l.Enabled() {
+		return nil
+	}
+	if s.IsDedup() {
+		return fmt.Errorf("storages.%s.lifecycle is not supported with type dedup", name)
+	}
+	// Os nomes no bucket deixariam de coincidir com os locais (.tar.gz → .tar.zst)
+	for _, b := range s.Buckets {
+		if b.Mode == BucketModeSync {
+			return fmt.Errorf("storages.%s.lifecycle cannot be combined with sync buckets", name)
+		}
+	}
+	l.Level = strings.ToLower(l.Level)
+	switch l.Level {
+	case "":
+		l.Level = LifecycleLevelBest
+	case LifecycleLevelBetter, LifecycleLevelBest:
+	default:
+		return fmt.Errorf("storages.%s.lifecycle.level must be better or best, got %q", name, l.Level)
+	}
+	if l.Window == "" {
+		l.Window = "128mb"
+	}
+	size, err := ParseByteSize(l.Window)
+	if err != nil {
+		return fmt.Errorf("storages.%s.lifecycle.window: %w", name, err)
+	}
+	if size < 1<<20 || size > 512<<20 || size&(size-1) != 0 {
+		return fmt.Errorf("storages.%s.lifecycle.window must be a power of 2 between 1mb and 512mb, got %s", name, l.Window)
+	}
+	l.WindowRaw = size
+	return nil
+}
+
+// DiskHealthConfig configura o monitoramento da saúde do disco de um storage
+// (storages.*.disk_health): smartctl no device ou um probe próprio.
+type DiskHealthConfig struct {
+	Device     string        `yaml:"device"`      // device consultado com `smartctl -H -A` (ex: /dev/sdb)
+	Command    string        `yaml:"command"`     // probe alternativo (sh -c): exit 0 = ok, 1 = degraded, 2 = failing
+	Smartctl   string        `yaml:"smartctl"`    // binário do smartctl (default: smartctl, via PATH)
+	Interval   time.Duration `yaml:"interval"`    // intervalo entre probes (default: 15m)
+	OnDegraded string        `yaml:"on_degraded"` // verify|read_only (default: verify); failing é sempre read_only
 }
 
+// Ações de storages.*.disk_health.on_degraded.
+const (
+	DiskHealthActionVerify   = "verify"    // força verify_integrity e verifica os backups existentes
+	DiskHealthActionReadOnly = "read_only" // recusa novos backups no storage
+)
+
+// DefaultDiskHealthInterval é o default de storages.*.disk_health.interval.
+const DefaultDiskHealthInterval = 15 * time.Minute
+
+// Enabled indica se o storage tem monitoramento de saúde do disco.
+func (d DiskHealthConfig) Enabled() bool {
+	return d.Device != "" || d.Command != ""
+}
+
+// validate valida o bloco disk_health do storage name e aplica os defaults.
+func (d *DiskHealthConfig) validate(name string) error {
+	if !d.Enabled() {
+		return nil
+	}
+	if d.Device != "" && d.Command != "" {
+		return fmt.Errorf("storages.%s.disk_health: device and command are mutually exclusive", name)
+	}
+	if d.Smartctl == "" {
+		d.Smartctl = "smartctl"
+	}
+	if d.Interval == 0 {
+		d.Interval = DefaultDiskHealthInterval
+	}
+	if d.Interval < time.Minute {
+		return fmt.Errorf("storages.%s.disk_health.interval must be at least 1m, got %s", name, d.Interval)
+	}
+	d.OnDegraded = strings.ToLower(d.OnDegraded)
+	switch d.OnDegraded {
+	case "":
+		d.OnDegraded = DiskHealthActionVerify
+	case DiskHealthActionVerify, DiskHealthActionReadOnly:
+	default:
+		return fmt.Errorf("storages.%s.disk_health.on_degraded must be verify or read_only, got %q", name, d.OnDegraded)
+	}
+	return nil
+}
+
+func (f *ChaosFault) validate(i int) error {
+	field := fmt.Sprintf("chaos.faults[%d]", i)
+	if f.Stream != nil && (*f.Stream < 0 || *f.Stream > 255) {
+		return fmt.Errorf("%s.stream must be between 0 and 255, got %d", field, *f.Stream)
+	}
+	if f.Times == 0 {
+		f.Times = 1
+	}
+	if f.Times < -1 {
+		return fmt.Errorf("%s.times must be positive or -1 (unlimited), got %d", field, f.Times)
+	}
+	switch f.Action {
+	case ChaosFaultDrop:
+		if f.AfterBytes == "" {
+			return fmt.Errorf("%s.after_bytes is required for action drop", field)
+		}
+		n, err := ParseByteSize(f.AfterBytes)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%s.after_bytes must be a positive size, got %q", field, f.AfterBytes)
+		}
+		f.AfterBytesRaw = n
+	case ChaosFaultKill:
+		if f.After <= 0 {
+			return fmt.Errorf("%s.after is required for action kill", field)
+		}
+	case ChaosFaultDelaySACK:
+		if f.Delay <= 0 {
+			return fmt.Errorf("%s.delay is required for action delay_sack", field)
+		}
+	case ChaosFaultCorrupt, ChaosFaultRotate:
+	default:
+		return fmt.Errorf("%s.action must be drop, kill, corrupt, delay_sack or rotate, got %q", field, f.Action)
+	}
+	return nil
+}
+
+// Tipos de storage (storages.*.type).
+const (
+	StorageTypeFile  = "file"  // um archive por backup
+	StorageTypeDedup = "dedup" // chunks deduplicados em um pool + manifest por backup
+	// StorageTypeDiscard recebe e valida as sessões sem gravar nem commitar
+	// nada: destino do `nbackup-agent bench` e de testes de carga.
+	StorageTypeDiscard = "discard"
+	// StorageTypeNull é sinônimo de StorageTypeDiscard, normalizado na validação.
+	StorageTypeNull = "null"
+)
+
+// UnmarshalYAML trata `type: null` sem aspas, que o YAML lê como valor nulo
+// (e deixaria o storage no default file), como o tipo null. As demais grafias
+// de nulo do YAML (~, Null, NULL) são recusadas: quem as escreve em geral quer
+// o default, e um storage que descarta os backups não pode surgir por engano.
+func (s *StorageInfo) UnmarshalYAML(value *yaml.Node) error {
+	type plain StorageInfo
+	if err := value.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	if n := mappingValue(value, "type"); n != nil && n.Tag == "!!null" && n.Value != "" {
+		if n.Value != StorageTypeNull {
+			return fmt.Errorf("line %d: type: %s is a YAML null; omit type for the default (file) or use type: discard", n.Line, n.Value)
+		}
+		s.Type = StorageTypeNull
+	}
+	return nil
+}
+
+// IsDedup indica se o storage é do tipo dedup.
+func (s StorageInfo) IsDedup() bool {
+	return s.Type == StorageTypeDedup
+}
+
+// IsDiscard indica se o storage é do tipo discard.
+func (s StorageInfo) IsDiscard() bool {
+	return s.Type == StorageTypeDiscard
+}
+
+// DefaultMinFreeInodes é o default de storages.*.min_free_inodes: margem para
+// os arquivos de chunk do lazy assembly e do spill de uma sessão paralela.
+const DefaultMinFreeInodes uint64 = 10000
+
+// DefaultSessionTTL é o default de storages.*.session_ttl.
+const DefaultSessionTTL = time.Hour
+
+// MinIngestLimit é o menor teto aceito em ingest_limit (global e por storage).
+const MinIngestLimit = 64 * 1024
+
+// parseIngestLimit valida um ingest_limit ("" = sem limite).
+func parseIngestLimit(field, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := ParseByteSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", field, err)
+	}
+	if limit < MinIngestLimit {
+		return 0, fmt.Errorf("%s must be at least 64kb, got %s", field, value)
+	}
+	return limit, nil
+}
+
+// Limites aceitos para storages.*.write_buffer_size.
+const (
+	MinWriteBufferSize = 4 * 1024         // 4KB
+	MaxWriteBufferSize = 64 * 1024 * 1024 // 64MB
+)
+
+// MaxWriteWorkers é o maior valor aceito em storages.*.write_workers.
+const MaxWriteWorkers = 64
+
 // CompressionModeByte converte o compression_mode string para a constante de protocolo.
 func (s StorageInfo) CompressionModeByte() byte {
 	switch s.CompressionMode {
@@ -219,6 +724,15 @@ func (s StorageInfo) CompressionModeByte() byte {
 	}
 }
 
+// MinFreeInodesThreshold retorna o mínimo de inodes livres exigido no
+// handshake. Default: DefaultMinFreeInodes; 0 desabilita a verificação.
+func (s StorageInfo) MinFreeInodesThreshold() uint64 {
+	if s.MinFreeInodes == nil {
+		return DefaultMinFreeInodes
+	}
+	return *s.MinFreeInodes
+}
+
 // FsyncChunkWrites retorna se o fsync de chunk writes está habilitado.
 // Default: true (desde v4.0.0).
 func (s StorageInfo) FsyncChunkWrites() bool {
@@ -244,6 +758,16 @@ func (c *ServerConfig) GetStorage(name string) (StorageInfo, bool) {
 	return s, ok
 }
 
+// GetPlacement busca um placement pelo nome.
+func (c *ServerConfig) GetPlacement(name string) (PlacementConfig, bool) {
+	for _, p := range c.Placements {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return PlacementConfig{}, false
+}
+
 // LoadServerConfig lê e valida o arquivo YAML de configuração do server.
 func LoadServerConfig(path string) (*ServerConfig, error) {
 	data, err := os.ReadFile(path)
@@ -252,9 +776,11 @@ func LoadServerConfig(path string) (*ServerConfig, error) {
 	}
 
 	var cfg ServerConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	migrations, err := decodeConfig(data, &cfg, serverMigrations)
+	if err != nil {
 		return nil, fmt.Errorf("parsing server config: %w", err)
 	}
+	cfg.Migrations = migrations
 
 	if err := cfg.validate(); err != nil {
 		return nil, fmt.Errorf("validating server config: %w", err)
@@ -267,6 +793,32 @@ func (c *ServerConfig) validate() error {
 	if c.Server.Listen == "" {
 		return fmt.Errorf("server.listen is required")
 	}
+	switch c.Server.Auth {
+	case "":
+		c.Server.Auth = AuthModeMTLS
+	case AuthModeMTLS:
+	case AuthModePSK:
+		if c.Server.PSKFile == "" {
+			return fmt.Errorf("server.psk_file is required when server.auth is psk")
+		}
+	default:
+		return fmt.Errorf("server.auth must be %q or %q, got %q", AuthModeMTLS, AuthModePSK, c.Server.Auth)
+	}
+
+	if err := c.Server.Socket.validate("server.socket"); err != nil {
+		return err
+	}
+
+	// Admin socket defaults
+	as := &c.Server.AdminSocket
+	if as.Enabled == nil {
+		defaultEnabled := true
+		as.Enabled = &defaultEnabled
+	}
+	if as.Path == "" {
+		as.Path = "/run/nbackup/server.sock"
+	}
+
 	if c.TLS.CACert == "" {
 		return fmt.Errorf("tls.ca_cert is required")
 	}
@@ -276,6 +828,50 @@ func (c *ServerConfig) validate() error {
 	if c.TLS.ServerKey == "" {
 		return fmt.Errorf("tls.server_key is required")
 	}
+	for i, cn := range c.TLS.AllowedAgents {
+		c.TLS.AllowedAgents[i] = strings.TrimSpace(cn)
+		if c.TLS.AllowedAgents[i] == "" {
+			return fmt.Errorf("tls.allowed_agents[%d] must not be empty", i)
+		}
+	}
+	if c.TLS.MaxConcurrentHandshakes < 0 {
+		return fmt.Errorf("tls.max_concurrent_handshakes must be >= 0, got %d", c.TLS.MaxConcurrentHandshakes)
+	}
+	if c.TLS.MaxConcurrentHandshakes == 0 {
+		c.TLS.MaxConcurrentHandshakes = 2 * runtime.NumCPU()
+	}
+	if c.TLS.HandshakeQueueTimeout <= 0 {
+		c.TLS.HandshakeQueueTimeout = 30 * time.Second
+	}
+	if c.TLS.HandshakeTimeout <= 0 {
+		c.TLS.HandshakeTimeout = 10 * time.Second
+	}
+	if c.Enrollment.Enabled {
+		if c.Enrollment.CAKey == "" {
+			return fmt.Errorf("enrollment.ca_key is required when enrollment is enabled")
+		}
+		if c.Enrollment.Listen == "" {
+			c.Enrollment.Listen = ":9849"
+		}
+		if c.Enrollment.Listen == c.Server.Listen {
+			return fmt.Errorf("enrollment.listen must differ from server.listen")
+		}
+		if c.Enrollment.CertValidity < 0 {
+			return fmt.Errorf("enrollment.cert_validity must be >= 0, got %s", c.Enrollment.CertValidity)
+		}
+	}
+	if c.Enrollment.TokensFile == "" {
+		c.Enrollment.TokensFile = "/var/lib/nbackup/enroll-tokens.json"
+	}
+	if c.Enrollment.CertValidity == 0 {
+		c.Enrollment.CertValidity = 8760 * time.Hour
+	}
+	if err := c.Notifications.validate(); err != nil {
+		return err
+	}
+	if err := validateSnapshotGroups(c.SnapshotGroups); err != nil {
+		return err
+	}
 	if len(c.Storages) == 0 {
 		return fmt.Errorf("storages must have at least one entry")
 	}
@@ -316,6 +912,34 @@ func (c *ServerConfig) validate() error {
 			return fmt.Errorf("storages.%s.compression_mode must be gzip or zst, got %q", name, s.CompressionMode)
 		}
 
+		// Tipo: default file
+		s.Type = strings.ToLower(strings.TrimSpace(s.Type))
+		switch s.Type {
+		case "":
+			s.Type = StorageTypeFile
+		case StorageTypeNull:
+			s.Type = StorageTypeDiscard
+		}
+		if s.Type != StorageTypeFile && s.Type != StorageTypeDedup && s.Type != StorageTypeDiscard {
+			return fmt.Errorf("storages.%s.type must be file, dedup, discard or null, got %q", name, s.Type)
+		}
+		if s.IsDedup() && len(s.Buckets) > 0 {
+			return fmt.Errorf("storages.%s.buckets are not supported with type dedup", name)
+		}
+		// Storage discard não commita backups: nada para enviar, travar ou recomprimir
+		if s.IsDiscard() {
+			switch {
+			case len(s.Buckets) > 0:
+				return fmt.Errorf("storages.%s.buckets are not supported with type discard", name)
+			case len(s.PostCommit) > 0:
+				return fmt.Errorf("storages.%s.post_commit is not supported with type discard", name)
+			case s.Immutable.Enabled:
+				return fmt.Errorf("storages.%s.immutable is not supported with type discard", name)
+			case s.Lifecycle.Enabled():
+				return fmt.Errorf("storages.%s.lifecycle is not supported with type discard", name)
+			}
+		}
+
 		// Chunk shard levels: default 1
 		if s.ChunkShardLevels == 0 {
 			s.ChunkShardLevels = 1
@@ -330,14 +954,128 @@ func (c *ServerConfig) validate() error {
 			s.ChunkFsync = &fsyncDefault
 		}
 
+		// Min free inodes: default 10000 (0 desabilita a verificação no handshake)
+		if s.MinFreeInodes == nil {
+			minInodes := DefaultMinFreeInodes
+			s.MinFreeInodes = &minInodes
+		}
+
+		// Espaço livre mínimo e quota: vazio = desabilitado
+		if s.MinFreeSpace != "" {
+			size, err := ParseByteSize(s.MinFreeSpace)
+			if err != nil {
+				return fmt.Errorf("storages.%s.min_free_space: %w", name, err)
+			}
+			if size < 0 {
+				return fmt.Errorf("storages.%s.min_free_space must be >= 0, got %s", name, s.MinFreeSpace)
+			}
+			s.MinFreeSpaceRaw = size
+		}
+		if s.Quota != "" {
+			size, err := ParseByteSize(s.Quota)
+			if err != nil {
+				return fmt.Errorf("storages.%s.quota: %w", name, err)
+			}
+			if size <= 0 {
+				return fmt.Errorf("storages.%s.quota must be greater than 0, got %s", name, s.Quota)
+			}
+			s.QuotaRaw = size
+		}
+
+		if err := s.DiskHealth.validate(name); err != nil {
+			return err
+		}
+
+		// Session TTL: default 1h, mínimo 1m (abaixo disso uma pausa curta do agent expira a sessão)
+		if s.SessionTTL == 0 {
+			s.SessionTTL = DefaultSessionTTL
+		}
+		if s.SessionTTL < time.Minute {
+			return fmt.Errorf("storages.%s.session_ttl must be at least 1m, got %s", name, s.SessionTTL)
+		}
+
+		// Layout: vazio = backups direto em {agent}/{backup}
+		if s.Layout != "" {
+			layout, err := ParseStorageLayout(s.Layout)
+			if err != nil {
+				return fmt.Errorf("storages.%s.layout: %w", name, err)
+			}
+			s.LayoutRaw = layout
+		}
+
+		// Backup window: vazio = sem restrição
+		if s.BackupWindow != "" {
+			window, err := ParseTimeWindow(s.BackupWindow)
+			if err != nil {
+				return fmt.Errorf("storages.%s.backup_window: %w", name, err)
+			}
+			s.BackupWindowRaw = window
+		}
+
+		// Write buffer: vazio ou "auto" = detectado pelo server (HDD vs SSD/NVMe)
+		s.WriteBufferSize = strings.ToLower(strings.TrimSpace(s.WriteBufferSize))
+		if s.WriteBufferSize == "" {
+			s.WriteBufferSize = "auto"
+		}
+		if s.WriteBufferSize != "auto" {
+			size, err := ParseByteSize(s.WriteBufferSize)
+			if err != nil {
+				return fmt.Errorf("storages.%s.write_buffer_size: %w", name, err)
+			}
+			if size < MinWriteBufferSize || size > MaxWriteBufferSize {
+				return fmt.Errorf("storages.%s.write_buffer_size must be between 4kb and 64mb, got %s", name, s.WriteBufferSize)
+			}
+			s.WriteBufferSizeRaw = size
+		}
+
+		if s.WriteWorkers < 0 || s.WriteWorkers > MaxWriteWorkers {
+			return fmt.Errorf("storages.%s.write_workers must be between 0 and %d, got %d", name, MaxWriteWorkers, s.WriteWorkers)
+		}
+
+		// Teto de ingestão (bytes/seg) aplicado às conexões de dados do storage
+		limit, err := parseIngestLimit("storages."+name+".ingest_limit", s.IngestLimit)
+		if err != nil {
+			return err
+		}
+		s.IngestLimitRaw = limit
+
 		// Bucket configs (object storage pós-commit)
 		if err := validateBuckets(name, s.Buckets); err != nil {
 			return err
 		}
 
+		if err := s.Lifecycle.validate(name, s); err != nil {
+			return err
+		}
+
+		if err := validatePostCommit(name, s); err != nil {
+			return err
+		}
+
+		if err := s.Immutable.validate(name, s); err != nil {
+			return err
+		}
+
+		if s.FailureDomain == "" {
+			s.FailureDomain = name
+		}
+
 		c.Storages[name] = s
 	}
 
+	if err := c.validatePlacements(); err != nil {
+		return err
+	}
+	if err := c.validateRestoreDrills(); err != nil {
+		return err
+	}
+	if err := c.validateAuditLog(); err != nil {
+		return err
+	}
+	if err := c.validateAccounting(); err != nil {
+		return err
+	}
+
 	// Chunk Buffer global
 	if c.ChunkBuffer.Size == "" || c.ChunkBuffer.Size == "0" {
 		c.ChunkBuffer.SizeRaw = 0 // desabilitado
@@ -367,6 +1105,18 @@ func (c *ServerConfig) validate() error {
 	if c.Logging.Format == "" {
 		c.Logging.Format = "json"
 	}
+	if err := c.Logging.Redact.validate(); err != nil {
+		return err
+	}
+	if err := c.Logging.Sampling.validate(); err != nil {
+		return err
+	}
+	if err := c.Logging.validateTarget(); err != nil {
+		return err
+	}
+	if err := c.Logging.validateRotation(); err != nil {
+		return err
+	}
 
 	// Flow Rotation defaults
 	if c.FlowRotation.Enabled {
@@ -390,6 +1140,62 @@ func (c *ServerConfig) validate() error {
 		c.ControlLostGracePeriod = 5 * time.Minute
 	}
 
+	// Teto global de ingestão, somado sobre todos os storages
+	limit, err := parseIngestLimit("ingest_limit", c.IngestLimit)
+	if err != nil {
+		return err
+	}
+	c.IngestLimitRaw = limit
+
+	// Listeners adicionais: defaults herdados de server e tls
+	if err := c.validateListeners(); err != nil {
+		return err
+	}
+
+	// Orçamento de streams paralelos repartido entre as sessões (ControlStreamLimit)
+	if c.StreamBudget < 0 {
+		return fmt.Errorf("stream_budget must be >= 0, got %d", c.StreamBudget)
+	}
+
+	// Chaos mode: defaults conservadores e guarda contra uso em produção
+	if c.Chaos.Enabled {
+		if strings.EqualFold(os.Getenv("NBACKUP_ENV"), "production") {
+			return fmt.Errorf("chaos.enabled is not allowed when NBACKUP_ENV=production")
+		}
+		if c.Chaos.SACKDelayMax <= 0 {
+			c.Chaos.SACKDelayMax = 2 * time.Second
+		}
+		// Sem faults, as probabilidades ausentes recebem default; informadas
+		// (inclusive 0) valem como estão
+		for _, p := range []struct {
+			field string
+			value *float64
+			def   float64
+			raw   *float64
+		}{
+			{"rotate_probability", c.Chaos.RotateProbability, 0.01, &c.Chaos.RotateProbabilityRaw},
+			{"sack_delay_probability", c.Chaos.SACKDelayProbability, 0.001, &c.Chaos.SACKDelayProbabilityRaw},
+			{"drop_probability", c.Chaos.DropProbability, 0.0005, &c.Chaos.DropProbabilityRaw},
+		} {
+			switch {
+			case p.value != nil:
+				if *p.value < 0 || *p.value > 1 {
+					return fmt.Errorf("chaos.%s must be between 0.0 and 1.0, got %.4f", p.field, *p.value)
+				}
+				*p.raw = *p.value
+			case len(c.Chaos.Faults) == 0:
+				*p.raw = p.def
+			default:
+				*p.raw = 0
+			}
+		}
+		for i := range c.Chaos.Faults {
+			if err := c.Chaos.Faults[i].validate(i); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Web UI defaults e validação
 	if c.WebUI.Enabled {
 		if c.WebUI.Listen == "" {
@@ -456,8 +1262,195 @@ func (c *ServerConfig) validate() error {
 			}
 			c.WebUI.ParsedCIDRs = append(c.WebUI.ParsedCIDRs, cidr)
 		}
+		if err := validateAPITokens(c.WebUI.APITokens); err != nil {
+			return err
+		}
+		if c.WebUI.APIRequireToken && len(c.WebUI.APITokens) == 0 {
+			return fmt.Errorf("web_ui.api_require_token requires at least one entry in web_ui.api_tokens")
+		}
+		if err := validateWebUIUsers(c.WebUI.Users, c.WebUI.APITokens); err != nil {
+			return err
+		}
+		if c.WebUI.SessionTTL <= 0 {
+			c.WebUI.SessionTTL = 12 * time.Hour
+		}
+	}
+
+	return nil
+}
+
+// validateSnapshotGroups valida os snapshot_groups e aplica os defaults.
+func validateSnapshotGroups(groups []SnapshotGroupConfig) error {
+	names := make(map[string]bool, len(groups))
+	for i, g := range groups {
+		if g.Name == "" {
+			return fmt.Errorf("snapshot_groups[%d].name is required", i)
+		}
+		if names[g.Name] {
+			return fmt.Errorf("snapshot_groups[%d].name %q is duplicated", i, g.Name)
+		}
+		names[g.Name] = true
+		if g.Backup == "" {
+			return fmt.Errorf("snapshot_groups[%d].backup is required", i)
+		}
+		if len(g.Agents) < 2 {
+			return fmt.Errorf("snapshot_groups[%d].agents must have at least 2 entries", i)
+		}
+		agents := make(map[string]bool, len(g.Agents))
+		for _, a := range g.Agents {
+			if a == "" {
+				return fmt.Errorf("snapshot_groups[%d].agents: empty agent name", i)
+			}
+			if agents[a] {
+				return fmt.Errorf("snapshot_groups[%d].agents: %q is duplicated", i, a)
+			}
+			agents[a] = true
+		}
+		if g.PrepareTimeout < 0 {
+			return fmt.Errorf("snapshot_groups[%d].prepare_timeout must be >= 0, got %s", i, g.PrepareTimeout)
+		}
+		if g.PrepareTimeout == 0 {
+			groups[i].PrepareTimeout = 5 * time.Minute
+		}
 	}
+	return nil
+}
 
+// validatePlacements valida os placements e aplica os defaults.
+func (c *ServerConfig) validatePlacements() error {
+	validPolicy := func(p string) bool { return p == PlacementSpread || p == PlacementPin }
+	names := make(map[string]bool, len(c.Placements))
+	for i := range c.Placements {
+		p := &c.Placements[i]
+		if p.Name == "" {
+			return fmt.Errorf("placements[%d].name is required", i)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("placements[%d].name %q is duplicated", i, p.Name)
+		}
+		names[p.Name] = true
+		if _, ok := c.Storages[p.Name]; ok {
+			return fmt.Errorf("placements[%d].name %q conflicts with a storage of the same name", i, p.Name)
+		}
+		if len(p.Storages) < 2 {
+			return fmt.Errorf("placements[%d].storages must have at least 2 entries", i)
+		}
+		seen := make(map[string]bool, len(p.Storages))
+		for _, s := range p.Storages {
+			if _, ok := c.Storages[s]; !ok {
+				return fmt.Errorf("placements[%d].storages: unknown storage %q", i, s)
+			}
+			if seen[s] {
+				return fmt.Errorf("placements[%d].storages: %q is duplicated", i, s)
+			}
+			seen[s] = true
+		}
+		p.Policy = strings.ToLower(p.Policy)
+		if p.Policy == "" {
+			p.Policy = PlacementSpread
+		}
+		if !validPolicy(p.Policy) {
+			return fmt.Errorf("placements[%d].policy must be spread or pin, got %q", i, p.Policy)
+		}
+		for backup, policy := range p.Backups {
+			policy = strings.ToLower(policy)
+			if !validPolicy(policy) {
+				return fmt.Errorf("placements[%d].backups.%s must be spread or pin, got %q", i, backup, policy)
+			}
+			p.Backups[backup] = policy
+		}
+	}
+	return nil
+}
+
+// validateRestoreDrills valida restore_drills e aplica os defaults. O
+// scratch_dir não pode ficar dentro de um storage: os arquivos restaurados
+// seriam vistos pelo catálogo, pela rotação e pelo GC do dedup.
+func (c *ServerConfig) validateRestoreDrills() error {
+	d := &c.RestoreDrills
+	if !d.Enabled {
+		return nil
+	}
+	if d.ScratchDir == "" {
+		return fmt.Errorf("restore_drills.scratch_dir is required")
+	}
+	d.ScratchDir = filepath.Clean(d.ScratchDir)
+	for name, s := range c.Storages {
+		base := filepath.Clean(s.BaseDir)
+		if d.ScratchDir == base || strings.HasPrefix(d.ScratchDir, base+string(filepath.Separator)) {
+			return fmt.Errorf("restore_drills.scratch_dir must be outside storage %q (%s)", name, s.BaseDir)
+		}
+	}
+	if d.Interval < 0 || d.Archives < 0 || d.SampleFiles < 0 {
+		return fmt.Errorf("restore_drills.interval, archives and sample_files must be >= 0")
+	}
+	if d.Interval == 0 {
+		d.Interval = 24 * time.Hour
+	}
+	if d.Archives == 0 {
+		d.Archives = 1
+	}
+	if d.SampleFiles == 0 {
+		d.SampleFiles = 20
+	}
+	if d.ResultsFile == "" {
+		d.ResultsFile = filepath.Join(d.ScratchDir, "restore-drills.jsonl")
+	}
+	return nil
+}
+
+// validateAuditLog valida audit_log e aplica os defaults. Como o scratch_dir
+// dos restore drills, o dir não pode ficar dentro de um storage.
+func (c *ServerConfig) validateAuditLog() error {
+	a := &c.AuditLog
+	if !a.Enabled {
+		return nil
+	}
+	if a.Dir == "" {
+		return fmt.Errorf("audit_log.dir is required")
+	}
+	a.Dir = filepath.Clean(a.Dir)
+	for name, s := range c.Storages {
+		base := filepath.Clean(s.BaseDir)
+		if a.Dir == base || strings.HasPrefix(a.Dir, base+string(filepath.Separator)) {
+			return fmt.Errorf("audit_log.dir must be outside storage %q (%s)", name, s.BaseDir)
+		}
+	}
+	if a.MaxSize == "" {
+		a.MaxSize = "64mb"
+	}
+	size, err := ParseByteSize(a.MaxSize)
+	if err != nil {
+		return fmt.Errorf("audit_log.max_size: %w", err)
+	}
+	if size < 1024*1024 {
+		return fmt.Errorf("audit_log.max_size must be at least 1mb, got %s", a.MaxSize)
+	}
+	a.MaxSizeRaw = size
+	if a.MaxFiles < 0 {
+		return fmt.Errorf("audit_log.max_files must be >= 0")
+	}
+	if a.MaxFiles == 0 {
+		a.MaxFiles = 20
+	}
+	return nil
+}
+
+// validateAccounting valida accounting e aplica os defaults.
+func (c *ServerConfig) validateAccounting() error {
+	a := &c.Accounting
+	if !a.Enabled {
+		return nil
+	}
+	if a.File == "" {
+		a.File = "accounting.jsonl"
+	}
+	if a.RetentionDays < 0 {
+		return fmt.Errorf("accounting.retention_days must be >= 0, got %d", a.RetentionDays)
+	}
+	if a.RetentionDays == 0 {
+		a.RetentionDays = 400
+	}
 	return nil
 }
 
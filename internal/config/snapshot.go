@@ -0,0 +1,76 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// SnapshotHash retorna um hash curto (12 hex) da serialização JSON de um
+// snapshot de configuração. A serialização de structs é determinística,
+// então snapshots iguais geram o mesmo hash.
+func SnapshotHash(snapshot any) string {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// SnapshotDiff compara dois snapshots de configuração campo a campo (pelas
+// chaves JSON de primeiro nível) e retorna as diferenças no formato
+// "campo: antigo -> novo", em ordem alfabética. prev nil resulta em nil.
+func SnapshotDiff(prev, cur any) []string {
+	if prev == nil || cur == nil {
+		return nil
+	}
+	prevMap, err1 := snapshotFields(prev)
+	curMap, err2 := snapshotFields(cur)
+	if err1 != nil || err2 != nil || prevMap == nil {
+		return nil
+	}
+
+	keys := make(map[string]struct{}, len(curMap))
+	for k := range prevMap {
+		keys[k] = struct{}{}
+	}
+	for k := range curMap {
+		keys[k] = struct{}{}
+	}
+
+	var diff []string
+	for k := range keys {
+		oldVal, newVal := string(prevMap[k]), string(curMap[k])
+		if oldVal == newVal {
+			continue
+		}
+		if oldVal == "" {
+			oldVal = "(unset)"
+		}
+		if newVal == "" {
+			newVal = "(unset)"
+		}
+		diff = append(diff, fmt.Sprintf("%s: %s -> %s", k, oldVal, newVal))
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+func snapshotFields(v any) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// SocketConfig ajusta os sockets TCP entre agent e server (server.socket no
+// agent e no server). Campos vazios mantêm o default do SO.
+type SocketConfig struct {
+	KeepAlive     time.Duration `yaml:"keepalive"`      // ociosidade antes do 1º probe e intervalo entre probes; 0 = default (15s), negativo = desabilitado
+	UserTimeout   time.Duration `yaml:"user_timeout"`   // TCP_USER_TIMEOUT: tempo máximo com dados sem ACK antes de derrubar a conexão
+	SendBuffer    string        `yaml:"send_buffer"`    // SO_SNDBUF (ex: "4mb"), limitado por net.core.wmem_max
+	ReceiveBuffer string        `yaml:"receive_buffer"` // SO_RCVBUF (ex: "4mb"), limitado por net.core.rmem_max
+	Congestion    string        `yaml:"congestion"`     // TCP_CONGESTION (ex: bbr, cubic); precisa estar disponível no kernel
+
+	SendBufferRaw    int64 `yaml:"-"` // valor parseado em bytes
+	ReceiveBufferRaw int64 `yaml:"-"` // valor parseado em bytes
+}
+
+// Limites aceitos em send_buffer/receive_buffer.
+const (
+	minSocketBuffer = 4 * 1024
+	maxSocketBuffer = 1024 * 1024 * 1024
+)
+
+// IsZero indica que nenhum ajuste foi configurado.
+func (s SocketConfig) IsZero() bool {
+	return s.KeepAlive == 0 && s.UserTimeout == 0 && s.SendBuffer == "" && s.ReceiveBuffer == "" && s.Congestion == ""
+}
+
+// validate parseia os buffers e valida os demais campos. prefix é o caminho
+// do bloco no YAML, usado nas mensagens de erro.
+func (s *SocketConfig) validate(prefix string) error {
+	if s.UserTimeout < 0 || (s.UserTimeout > 0 && s.UserTimeout < time.Second) {
+		return fmt.Errorf("%s.user_timeout must be at least 1s, got %s", prefix, s.UserTimeout)
+	}
+	if s.KeepAlive > 0 && s.KeepAlive < time.Second {
+		return fmt.Errorf("%s.keepalive must be at least 1s, got %s", prefix, s.KeepAlive)
+	}
+
+	parseBuffer := func(field, value string) (int64, error) {
+		if value == "" {
+			return 0, nil
+		}
+		n, err := ParseByteSize(value)
+		if err != nil {
+			return 0, fmt.Errorf("%s.%s: %w", prefix, field, err)
+		}
+		if n < minSocketBuffer || n > maxSocketBuffer {
+			return 0, fmt.Errorf("%s.%s must be between 4kb and 1gb, got %s", prefix, field, value)
+		}
+		return n, nil
+	}
+	var err error
+	if s.SendBufferRaw, err = parseBuffer("send_buffer", s.SendBuffer); err != nil {
+		return err
+	}
+	if s.ReceiveBufferRaw, err = parseBuffer("receive_buffer", s.ReceiveBuffer); err != nil {
+		return err
+	}
+
+	// O kernel aceita nomes de até TCP_CA_NAME_MAX-1 bytes; a disponibilidade
+	// do algoritmo só é conhecida no setsockopt
+	if len(s.Congestion) > 15 {
+		return fmt.Errorf("%s.congestion: algorithm name %q is too long", prefix, s.Congestion)
+	}
+	for _, r := range s.Congestion {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return fmt.Errorf("%s.congestion: invalid algorithm name %q", prefix, s.Congestion)
+		}
+	}
+	return nil
+}
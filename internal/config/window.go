@@ -0,0 +1,88 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow representa uma janela diária no formato "HH:MM-HH:MM" (hora local).
+// A janela pode atravessar a meia-noite (ex: "22:00-06:00").
+type TimeWindow struct {
+	Start time.Duration // offset desde 00:00
+	End   time.Duration // offset desde 00:00
+}
+
+// ParseTimeWindow converte uma string "HH:MM-HH:MM" em TimeWindow.
+func ParseTimeWindow(s string) (*TimeWindow, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid time window %q (expected HH:MM-HH:MM)", s)
+	}
+
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid time window %q: %w", s, err)
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid time window %q: %w", s, err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid time window %q: start and end must differ", s)
+	}
+
+	return &TimeWindow{Start: start, End: end}, nil
+}
+
+// parseClock converte "HH:MM" em offset desde 00:00.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid clock %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// sinceMidnight retorna o offset de t desde 00:00 no fuso de t.
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+}
+
+// Contains indica se t está dentro da janela.
+func (w TimeWindow) Contains(t time.Time) bool {
+	x := sinceMidnight(t)
+	if w.Start < w.End {
+		return x >= w.Start && x < w.End
+	}
+	// Janela atravessa a meia-noite
+	return x >= w.Start || x < w.End
+}
+
+// UntilOpen retorna quanto falta para a janela abrir a partir de t.
+// Retorna 0 se t já está dentro da janela.
+func (w TimeWindow) UntilOpen(t time.Time) time.Duration {
+	if w.Contains(t) {
+		return 0
+	}
+	x := sinceMidnight(t)
+	if x < w.Start {
+		return w.Start - x
+	}
+	return 24*time.Hour - x + w.Start
+}
+
+// String retorna a janela no formato "HH:MM-HH:MM".
+func (w TimeWindow) String() string {
+	return fmt.Sprintf("%s-%s", formatClock(w.Start), formatClock(w.End))
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package dedup
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// Tamanhos dos chunks produzidos pelo Chunker.
+const (
+	MinChunkSize = 256 << 10 // nenhum corte antes disso (exceto no fim do stream)
+	AvgChunkSize = 1 << 20   // tamanho esperado
+	MaxChunkSize = 4 << 20   // corte forçado
+)
+
+// Máscaras do FastCDC com normalização nível 2: antes de AvgChunkSize o corte
+// exige 22 bits zerados (mais difícil), depois 18 (mais fácil), concentrando
+// os tamanhos em torno da média. Usam os bits altos do fingerprint, que
+// dependem das últimas 64 posições do stream.
+const (
+	maskS = uint64(1<<22-1) << (64 - 22)
+	maskL = uint64(1<<18-1) << (64 - 18)
+)
+
+// gear é a tabela de valores aleatórios do gear hash. É gerada com seed fixa:
+// mudar a tabela (ou os tamanhos acima) muda os pontos de corte, e backups
+// novos deixam de deduplicar contra os chunks já armazenados.
+var gear = func() (t [256]uint64) {
+	seed := uint64(0x6e6261636b7570) // "nbackup"
+	for i := range t {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}()
+
+// Chunker divide um stream em chunks definidos pelo conteúdo (FastCDC): os
+// pontos de corte dependem apenas dos bytes próximos, então uma inserção ou
+// remoção no meio do stream altera só os chunks vizinhos e o restante continua
+// deduplicando.
+type Chunker struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewChunker cria um Chunker que lê de r.
+func NewChunker(r io.Reader) *Chunker {
+	return &Chunker{
+		r:   bufio.NewReaderSize(r, MaxChunkSize),
+		buf: make([]byte, 0, MaxChunkSize),
+	}
+}
+
+// Next retorna o próximo chunk, ou io.EOF no fim do stream. O slice retornado
+// só é válido até a próxima chamada.
+func (c *Chunker) Next() ([]byte, error) {
+	data, err := c.r.Peek(MaxChunkSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, io.EOF
+	}
+
+	n := cutPoint(data)
+	c.buf = append(c.buf[:0], data[:n]...)
+	if _, err := c.r.Discard(n); err != nil {
+		return nil, err
+	}
+	return c.buf, nil
+}
+
+// cutPoint retorna o tamanho do primeiro chunk de data.
+func cutPoint(data []byte) int {
+	n := len(data)
+	if n <= MinChunkSize {
+		return n
+	}
+	if n > MaxChunkSize {
+		n = MaxChunkSize
+	}
+	normal := AvgChunkSize
+	if n < normal {
+		normal = n
+	}
+
+	var fp uint64
+	i := MinChunkSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package dedup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// chunkHashes divide data e retorna o SHA-256 de cada chunk.
+func chunkHashes(t *testing.T, data []byte) [][32]byte {
+	t.Helper()
+	var hashes [][32]byte
+	var total int
+	c := NewChunker(bytes.NewReader(data))
+	for {
+		chunk, err := c.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if len(chunk) > MaxChunkSize {
+			t.Fatalf("chunk of %d bytes exceeds MaxChunkSize", len(chunk))
+		}
+		total += len(chunk)
+		hashes = append(hashes, sha256.Sum256(chunk))
+	}
+	if total != len(data) {
+		t.Fatalf("chunks cover %d bytes, want %d", total, len(data))
+	}
+	return hashes
+}
+
+func randomData(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestChunker_InsertionOnlyChangesNearbyChunks(t *testing.T) {
+	data := randomData(1, 24<<20)
+	before := chunkHashes(t, data)
+	if len(before) < 8 {
+		t.Fatalf("expected content-defined cuts, got %d chunks for 24MiB", len(before))
+	}
+
+	// Insere 100 bytes no meio: os chunks do início e do fim se mantêm.
+	mid := len(data) / 2
+	edited := append(append(append([]byte{}, data[:mid]...), randomData(2, 100)...), data[mid:]...)
+	after := chunkHashes(t, edited)
+
+	known := make(map[[32]byte]bool, len(before))
+	for _, h := range before {
+		known[h] = true
+	}
+	var reused int
+	for _, h := range after {
+		if known[h] {
+			reused++
+		}
+	}
+	if reused < len(before)-3 {
+		t.Errorf("only %d of %d chunks reused after a 100-byte insertion", reused, len(before))
+	}
+}
+
+func TestChunker_SmallAndEmptyStreams(t *testing.T) {
+	if hashes := chunkHashes(t, nil); len(hashes) != 0 {
+		t.Errorf("empty stream produced %d chunks", len(hashes))
+	}
+	if hashes := chunkHashes(t, randomData(3, MinChunkSize/2)); len(hashes) != 1 {
+		t.Errorf("stream below MinChunkSize produced %d chunks, want 1", len(hashes))
+	}
+}
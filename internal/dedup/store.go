@@ -0,0 +1,567 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// Package dedup implementa o chunk store deduplicado dos storages
+// `type: dedup`: o tar de cada backup é dividido em chunks definidos pelo
+// conteúdo (FastCDC), os chunks são gravados uma única vez em um pool
+// endereçado por SHA-256 e o backup vira um manifest com as referências.
+//
+// Layout em {base_dir}:
+//
+//	.dedup/chunks/ab/ab12…ef      chunk comprimido com zstd (nome = SHA-256 do conteúdo original)
+//	.dedup/tmp/                   arquivos temporários (restore para download)
+//	{agent}/{backup}/{timestamp}.tar.gz.dedup   manifest (formato statefile)
+//
+// A deduplicação opera sobre o tar descomprimido: a compressão do agent
+// (gzip/zstd) propaga qualquer mudança até o fim do stream, enquanto no tar
+// os arquivos inalterados produzem os mesmos chunks. O archive reconstruído
+// é recomprimido no formato original — tem o mesmo conteúdo, mas não os
+// mesmos bytes do archive enviado pelo agent.
+//
+// Não há contadores de referência persistidos: o GC conta as referências
+// lendo os manifests existentes (a fonte da verdade) e remove os chunks sem
+// nenhuma. Ingest e restore seguram o lock compartilhado do Store; o GC, o
+// exclusivo — um chunk recém-gravado nunca é coletado antes do seu manifest
+// existir.
+package dedup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// PoolDirName é o diretório do pool de chunks dentro do base_dir do storage.
+const PoolDirName = ".dedup"
+
+// ManifestSuffix é acrescentado ao nome do archive para formar o manifest
+// (ex: 2026-03-01T02-00-00-000.tar.gz.dedup).
+const ManifestSuffix = ".dedup"
+
+// manifestVersion é a versão atual do formato do manifest.
+const manifestVersion = 1
+
+// refsPerRecord limita as referências por registro do manifest, mantendo
+// cada linha bem abaixo do limite de registro do statefile.
+const refsPerRecord = 8192
+
+// IsManifest indica se name é um manifest de backup deduplicado.
+func IsManifest(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz"+ManifestSuffix) || strings.HasSuffix(name, ".tar.zst"+ManifestSuffix)
+}
+
+// ManifestHeader é o primeiro registro de um manifest.
+type ManifestHeader struct {
+	Version     int       `json:"version"`
+	Archive     string    `json:"archive"`      // nome do archive original
+	Compression string    `json:"compression"`  // gzip | zst
+	ArchiveSize int64     `json:"archive_size"` // tamanho do archive recebido do agent
+	TarSize     int64     `json:"tar_size"`     // soma dos chunks (tar descomprimido)
+	Chunks      int       `json:"chunks"`       // referências no manifest
+	NewChunks   int       `json:"new_chunks"`   // chunks gravados por este backup
+	NewBytes    int64     `json:"new_bytes"`    // bytes gravados no pool por este backup (comprimidos)
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ChunkRef referencia um chunk do pool.
+type ChunkRef struct {
+	Hash string `json:"h"` // SHA-256 (hex) do conteúdo
+	Size int64  `json:"s"` // tamanho do conteúdo descomprimido
+}
+
+// manifestRecord é uma linha do manifest: o header (primeira linha) ou um
+// lote de referências, na ordem do stream.
+type manifestRecord struct {
+	Header *ManifestHeader `json:"header,omitempty"`
+	Chunks []ChunkRef      `json:"chunks,omitempty"`
+}
+
+// GCStats resume uma coleta de lixo do pool.
+type GCStats struct {
+	Manifests  int   // manifests lidos
+	Referenced int   // chunks distintos referenciados
+	Removed    int   // chunks removidos
+	FreedBytes int64 // bytes liberados no pool
+}
+
+// Store é o pool de chunks de um storage dedup.
+type Store struct {
+	baseDir string
+	dir     string // {base_dir}/.dedup
+
+	// mu: ingest e restore usam RLock; GC usa Lock.
+	mu sync.RWMutex
+
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+// Open abre (criando se necessário) o pool de chunks em {baseDir}/.dedup.
+func Open(baseDir string) (*Store, error) {
+	dir := filepath.Join(baseDir, PoolDirName)
+	for _, sub := range []string{"chunks", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("creating dedup pool: %w", err)
+		}
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	if err != nil {
+		return nil, fmt.Errorf("creating zstd encoder: %w", err)
+	}
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating zstd decoder: %w", err)
+	}
+	return &Store{baseDir: baseDir, dir: dir, enc: enc, dec: dec}, nil
+}
+
+// Dir retorna o diretório do pool.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// chunkPath retorna o caminho do chunk hash no pool (sharding pelos 2
+// primeiros dígitos).
+func (s *Store) chunkPath(hash string) string {
+	return filepath.Join(s.dir, "chunks", hash[:2], hash)
+}
+
+// Ingest substitui o archive em archivePath (.tar.gz ou .tar.zst) por um
+// manifest em archivePath+ManifestSuffix: descomprime o archive, grava no pool
+// os chunks ainda inexistentes e remove o archive só depois que o manifest
+// está persistido. Em caso de erro o archive é preservado.
+func (s *Store) Ingest(archivePath string) (*ManifestHeader, error) {
+	compression, err := compressionOf(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening archive: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stating archive: %w", err)
+	}
+
+	var tarStream io.Reader
+	switch compression {
+	case "zst":
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("opening zstd stream: %w", err)
+		}
+		defer zr.Close()
+		tarStream = zr
+	default:
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("opening gzip stream: %w", err)
+		}
+		defer gr.Close()
+		tarStream = gr
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hdr := &ManifestHeader{
+		Version:     manifestVersion,
+		Archive:     filepath.Base(archivePath),
+		Compression: compression,
+		ArchiveSize: fi.Size(),
+		CreatedAt:   time.Now().UTC(),
+	}
+	var refs []ChunkRef
+	shards := make(map[string]bool)
+
+	chunker := NewChunker(tarStream)
+	for {
+		data, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading archive: %w", err)
+		}
+
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		written, err := s.putChunk(hash, data)
+		if err != nil {
+			return nil, err
+		}
+		if written > 0 {
+			hdr.NewChunks++
+			hdr.NewBytes += written
+			shards[filepath.Dir(s.chunkPath(hash))] = true
+		}
+		refs = append(refs, ChunkRef{Hash: hash, Size: int64(len(data))})
+		hdr.TarSize += int64(len(data))
+	}
+	hdr.Chunks = len(refs)
+
+	// Persiste os renames dos chunks novos antes do manifest que os referencia.
+	for dir := range shards {
+		if err := syncDir(dir); err != nil {
+			return nil, fmt.Errorf("syncing dedup pool: %w", err)
+		}
+	}
+
+	records := []manifestRecord{{Header: hdr}}
+	for start := 0; start < len(refs); start += refsPerRecord {
+		end := min(start+refsPerRecord, len(refs))
+		records = append(records, manifestRecord{Chunks: refs[start:end]})
+	}
+	if err := statefile.WriteLog(archivePath+ManifestSuffix, records, 0644); err != nil {
+		return nil, fmt.Errorf("writing manifest: %w", err)
+	}
+	if err := os.Remove(archivePath); err != nil {
+		return hdr, fmt.Errorf("removing archive after ingest: %w", err)
+	}
+	return hdr, nil
+}
+
+// putChunk grava data no pool se o chunk ainda não existe. Retorna os bytes
+// gravados (0 quando o chunk já existia).
+func (s *Store) putChunk(hash string, data []byte) (int64, error) {
+	path := s.chunkPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return 0, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("creating chunk shard: %w", err)
+	}
+
+	compressed := s.enc.EncodeAll(data, nil)
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+hash+".tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("creating chunk: %w", err)
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(compressed); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("writing chunk: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("syncing chunk: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("closing chunk: %w", err)
+	}
+	// Ingests concorrentes podem gravar o mesmo chunk: o rename é idempotente.
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("committing chunk: %w", err)
+	}
+	return int64(len(compressed)), nil
+}
+
+// ReadManifestHeader lê apenas o header de um manifest (primeira linha).
+func ReadManifestHeader(path string) (*ManifestHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("reading manifest %s: %w", filepath.Base(path), err)
+	}
+	var rec manifestRecord
+	rep := statefile.Parse(line, func(payload []byte) error {
+		return json.Unmarshal(payload, &rec)
+	})
+	if rep.Records != 1 || rec.Header == nil {
+		return nil, fmt.Errorf("manifest %s: invalid header", filepath.Base(path))
+	}
+	return rec.Header, nil
+}
+
+// ReadManifest lê e valida um manifest completo: registros íntegros, header
+// na primeira linha e referências consistentes com Chunks e TarSize (um
+// manifest truncado nunca é aceito).
+func ReadManifest(path string) (*ManifestHeader, []ChunkRef, error) {
+	records, rep, err := statefile.ReadLog[manifestRecord](path)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := filepath.Base(path)
+	if !rep.Clean() {
+		return nil, nil, fmt.Errorf("manifest %s is damaged: %s", name, rep)
+	}
+	if len(records) == 0 || records[0].Header == nil {
+		return nil, nil, fmt.Errorf("manifest %s: missing header", name)
+	}
+	hdr := records[0].Header
+	if hdr.Version > manifestVersion {
+		return nil, nil, fmt.Errorf("manifest %s: unsupported version %d", name, hdr.Version)
+	}
+
+	refs := make([]ChunkRef, 0, hdr.Chunks)
+	var size int64
+	for _, rec := range records[1:] {
+		for _, ref := range rec.Chunks {
+			if len(ref.Hash) != sha256.Size*2 {
+				return nil, nil, fmt.Errorf("manifest %s: invalid chunk reference %q", name, ref.Hash)
+			}
+			size += ref.Size
+		}
+		refs = append(refs, rec.Chunks...)
+	}
+	if len(refs) != hdr.Chunks || size != hdr.TarSize {
+		return nil, nil, fmt.Errorf("manifest %s is incomplete: %d/%d chunks, %d/%d bytes", name, len(refs), hdr.Chunks, size, hdr.TarSize)
+	}
+	return hdr, refs, nil
+}
+
+// WriteArchive reconstrói o archive de manifestPath em w: concatena os chunks
+// (verificando o SHA-256 de cada um) e recomprime o tar no formato original.
+func (s *Store) WriteArchive(manifestPath string, w io.Writer) error {
+	hdr, refs, err := ReadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cw io.WriteCloser
+	switch hdr.Compression {
+	case "zst":
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return fmt.Errorf("creating zstd writer: %w", err)
+		}
+		cw = zw
+	default:
+		cw = gzip.NewWriter(w)
+	}
+
+	for _, ref := range refs {
+		data, err := s.readChunk(ref)
+		if err != nil {
+			cw.Close()
+			return err
+		}
+		if _, err := cw.Write(data); err != nil {
+			cw.Close()
+			return fmt.Errorf("writing archive: %w", err)
+		}
+	}
+	return cw.Close()
+}
+
+// Verify lê todos os chunks referenciados por manifestPath e confere o
+// SHA-256 de cada um, sem reconstruir o archive.
+func (s *Store) Verify(manifestPath string) error {
+	_, refs, err := ReadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, ref := range refs {
+		if _, err := s.readChunk(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MissingChunks retorna os hashes dos chunks referenciados por manifestPath
+// que não existem no pool, sem lê-los (Verify confere também o conteúdo).
+func (s *Store) MissingChunks(manifestPath string) ([]string, error) {
+	_, refs, err := ReadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var missing []string
+	seen := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		if seen[ref.Hash] {
+			continue
+		}
+		seen[ref.Hash] = true
+		if _, err := os.Stat(s.chunkPath(ref.Hash)); err != nil {
+			missing = append(missing, ref.Hash)
+		}
+	}
+	return missing, nil
+}
+
+// readChunk lê, descomprime e verifica um chunk do pool.
+func (s *Store) readChunk(ref ChunkRef) ([]byte, error) {
+	compressed, err := os.ReadFile(s.chunkPath(ref.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("reading chunk %s: %w", ref.Hash, err)
+	}
+	data, err := s.dec.DecodeAll(compressed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decoding chunk %s: %w", ref.Hash, err)
+	}
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != ref.Size || hex.EncodeToString(sum[:]) != ref.Hash {
+		return nil, fmt.Errorf("chunk %s is corrupt (checksum mismatch)", ref.Hash)
+	}
+	return data, nil
+}
+
+// Materialize reconstrói o archive de manifestPath em um arquivo temporário
+// do pool e o retorna aberto e posicionado no início. O arquivo já está
+// removido do disco (o espaço é liberado no Close) e seu Name() termina com
+// o nome do archive original.
+func (s *Store) Materialize(manifestPath string) (*os.File, error) {
+	hdr, err := ReadManifestHeader(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(filepath.Join(s.dir, "tmp"), "restore-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating restore directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := os.Create(filepath.Join(dir, filepath.Base(hdr.Archive)))
+	if err != nil {
+		return nil, fmt.Errorf("creating restore file: %w", err)
+	}
+	if err := s.WriteArchive(manifestPath, f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// GC remove do pool os chunks que nenhum manifest em baseDir referencia
+// (incluindo os em quarentena), além de temporários órfãos. Um manifest
+// ilegível aborta a coleta sem remover nada.
+func (s *Store) GC() (GCStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stats GCStats
+	referenced := make(map[[sha256.Size]byte]struct{})
+	err := filepath.WalkDir(s.baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == s.dir || strings.HasPrefix(d.Name(), "chunks_") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !IsManifest(d.Name()) {
+			return nil
+		}
+		_, refs, err := ReadManifest(path)
+		if err != nil {
+			return err
+		}
+		stats.Manifests++
+		for _, ref := range refs {
+			var key [sha256.Size]byte
+			if _, err := hex.Decode(key[:], []byte(ref.Hash)); err != nil {
+				return fmt.Errorf("manifest %s: invalid chunk reference %q", d.Name(), ref.Hash)
+			}
+			referenced[key] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("reading manifests, no chunk removed: %w", err)
+	}
+	stats.Referenced = len(referenced)
+
+	// Com o lock exclusivo nenhum ingest ou restore está em andamento:
+	// temporários são restos de um crash.
+	if entries, err := os.ReadDir(filepath.Join(s.dir, "tmp")); err == nil {
+		for _, e := range entries {
+			os.RemoveAll(filepath.Join(s.dir, "tmp", e.Name()))
+		}
+	}
+
+	err = filepath.WalkDir(filepath.Join(s.dir, "chunks"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if !strings.HasPrefix(name, ".") {
+			var key [sha256.Size]byte
+			if len(name) != sha256.Size*2 {
+				return nil
+			}
+			if _, err := hex.Decode(key[:], []byte(name)); err != nil {
+				return nil
+			}
+			if _, ok := referenced[key]; ok {
+				return nil
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("removing chunk %s: %w", name, err)
+		}
+		if !strings.HasPrefix(name, ".") {
+			stats.Removed++
+			stats.FreedBytes += info.Size()
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// compressionOf deduz a compressão do archive pela extensão.
+func compressionOf(path string) (string, error) {
+	switch {
+	case strings.HasSuffix(path, ".tar.gz"):
+		return "gzip", nil
+	case strings.HasSuffix(path, ".tar.zst"):
+		return "zst", nil
+	}
+	return "", fmt.Errorf("unsupported archive %s: expected .tar.gz or .tar.zst", filepath.Base(path))
+}
+
+// syncDir faz fsync de um diretório para persistir renames.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
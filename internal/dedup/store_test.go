@@ -0,0 +1,237 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package dedup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeArchive grava um .tar.gz em path com os arquivos files (nome → conteúdo).
+func writeArchive(t *testing.T, path string, files map[string][]byte, order []string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, name := range order {
+		data := files[name]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(data)
+	}
+	tw.Close()
+	gw.Close()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tarContents lê o archive gzip de r e retorna o conteúdo de cada arquivo.
+func tarContents(t *testing.T, r io.Reader) map[string][]byte {
+	t.Helper()
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	tr := tar.NewReader(gr)
+	files := make(map[string][]byte)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("tar: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		files[h.Name] = data
+	}
+}
+
+func TestStore_IngestDeduplicatesAndRestores(t *testing.T) {
+	base := t.TempDir()
+	store, err := Open(base)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	dir := filepath.Join(base, "agent", "daily")
+	files := map[string][]byte{"a.bin": randomData(10, 6<<20), "b.bin": randomData(11, 3<<20)}
+	order := []string{"a.bin", "b.bin"}
+
+	first := filepath.Join(dir, "2026-03-01T02-00-00-000.tar.gz")
+	writeArchive(t, first, files, order)
+	hdr1, err := store.Ingest(first)
+	if err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("archive should be removed after ingest, stat err = %v", err)
+	}
+	if hdr1.NewChunks != hdr1.Chunks || hdr1.Chunks == 0 {
+		t.Errorf("first ingest: new=%d chunks=%d", hdr1.NewChunks, hdr1.Chunks)
+	}
+
+	// Segundo backup com um arquivo a mais: os chunks anteriores são reutilizados.
+	files["c.txt"] = []byte("changed")
+	second := filepath.Join(dir, "2026-03-02T02-00-00-000.tar.gz")
+	writeArchive(t, second, files, append(order, "c.txt"))
+	hdr2, err := store.Ingest(second)
+	if err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if hdr2.NewChunks >= hdr2.Chunks/2 {
+		t.Errorf("second ingest should reuse most chunks: new=%d chunks=%d", hdr2.NewChunks, hdr2.Chunks)
+	}
+
+	var out bytes.Buffer
+	if err := store.WriteArchive(second+ManifestSuffix, &out); err != nil {
+		t.Fatalf("WriteArchive: %v", err)
+	}
+	got := tarContents(t, &out)
+	for name, data := range files {
+		if !bytes.Equal(got[name], data) {
+			t.Errorf("restored %s differs (%d bytes, want %d)", name, len(got[name]), len(data))
+		}
+	}
+
+	f, err := store.Materialize(first + ManifestSuffix)
+	if err != nil {
+		t.Fatalf("Materialize: %v", err)
+	}
+	defer f.Close()
+	if filepath.Base(f.Name()) != "2026-03-01T02-00-00-000.tar.gz" {
+		t.Errorf("materialized name = %s", f.Name())
+	}
+	if got := tarContents(t, f); len(got) != 2 {
+		t.Errorf("materialized archive has %d files, want 2", len(got))
+	}
+}
+
+func TestStore_GCRemovesUnreferencedChunks(t *testing.T) {
+	base := t.TempDir()
+	store, _ := Open(base)
+	dir := filepath.Join(base, "agent", "daily")
+
+	shared := randomData(20, 4<<20)
+	old := filepath.Join(dir, "2026-03-01T02-00-00-000.tar.gz")
+	writeArchive(t, old, map[string][]byte{"shared": shared, "gone": randomData(21, 4<<20)}, []string{"shared", "gone"})
+	cur := filepath.Join(dir, "2026-03-02T02-00-00-000.tar.gz")
+	writeArchive(t, cur, map[string][]byte{"shared": shared}, []string{"shared"})
+	for _, p := range []string{old, cur} {
+		if _, err := store.Ingest(p); err != nil {
+			t.Fatalf("Ingest: %v", err)
+		}
+	}
+
+	stats, err := store.GC()
+	if err != nil || stats.Removed != 0 || stats.Manifests != 2 {
+		t.Fatalf("GC with all manifests present: %+v, %v", stats, err)
+	}
+
+	// Rotação: o manifest antigo sai, os chunks exclusivos dele são coletados.
+	os.Remove(old + ManifestSuffix)
+	stats, err = store.GC()
+	if err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if stats.Removed == 0 || stats.FreedBytes == 0 {
+		t.Errorf("expected unreferenced chunks to be removed, got %+v", stats)
+	}
+	var out bytes.Buffer
+	if err := store.WriteArchive(cur+ManifestSuffix, &out); err != nil {
+		t.Fatalf("remaining backup must stay restorable: %v", err)
+	}
+}
+
+func TestStore_GCAbortsOnDamagedManifest(t *testing.T) {
+	base := t.TempDir()
+	store, _ := Open(base)
+	dir := filepath.Join(base, "agent", "daily")
+	path := filepath.Join(dir, "2026-03-01T02-00-00-000.tar.gz")
+	writeArchive(t, path, map[string][]byte{"f": randomData(30, 2<<20)}, []string{"f"})
+	if _, err := store.Ingest(path); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	// Manifest truncado (crash/disco cheio): nenhuma referência pode ser perdida.
+	data, _ := os.ReadFile(path + ManifestSuffix)
+	os.WriteFile(path+ManifestSuffix, data[:strings.IndexByte(string(data), '\n')+1], 0644)
+	if _, err := store.GC(); err == nil {
+		t.Fatal("GC should fail on an incomplete manifest")
+	}
+	entries, _ := os.ReadDir(filepath.Join(store.Dir(), "chunks"))
+	if len(entries) == 0 {
+		t.Error("GC removed chunks despite the damaged manifest")
+	}
+}
+
+func TestStore_VerifyDetectsCorruptChunk(t *testing.T) {
+	base := t.TempDir()
+	store, _ := Open(base)
+	path := filepath.Join(base, "agent", "daily", "2026-03-01T02-00-00-000.tar.gz")
+	writeArchive(t, path, map[string][]byte{"f": randomData(40, 2<<20)}, []string{"f"})
+	if _, err := store.Ingest(path); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	manifest := path + ManifestSuffix
+	if err := store.Verify(manifest); err != nil {
+		t.Fatalf("Verify of an intact manifest: %v", err)
+	}
+
+	// Sobrescreve um dos chunks do pool
+	var chunk string
+	filepath.WalkDir(filepath.Join(store.Dir(), "chunks"), func(p string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && chunk == "" {
+			chunk = p
+		}
+		return nil
+	})
+	if chunk == "" {
+		t.Fatal("no chunk found in the pool")
+	}
+	if err := os.WriteFile(chunk, []byte("not a chunk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Verify(manifest); err == nil {
+		t.Fatal("Verify should fail on a corrupt chunk")
+	}
+}
+
+func TestStore_MissingChunks(t *testing.T) {
+	base := t.TempDir()
+	store, _ := Open(base)
+	path := filepath.Join(base, "agent", "daily", "2026-03-01T02-00-00-000.tar.gz")
+	writeArchive(t, path, map[string][]byte{"f": randomData(41, 2<<20)}, []string{"f"})
+	if _, err := store.Ingest(path); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	manifest := path + ManifestSuffix
+	if missing, err := store.MissingChunks(manifest); err != nil || len(missing) != 0 {
+		t.Fatalf("MissingChunks of a complete manifest: %v %v", missing, err)
+	}
+
+	var chunk string
+	filepath.WalkDir(filepath.Join(store.Dir(), "chunks"), func(p string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && chunk == "" {
+			chunk = p
+		}
+		return nil
+	})
+	os.Remove(chunk)
+	missing, err := store.MissingChunks(manifest)
+	if err != nil || len(missing) != 1 || missing[0] != filepath.Base(chunk) {
+		t.Fatalf("expected %s missing, got %v %v", filepath.Base(chunk), missing, err)
+	}
+}
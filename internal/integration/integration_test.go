@@ -6,6 +6,7 @@ package integration
 
 import (
 	"archive/tar"
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"context"
@@ -17,6 +18,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
@@ -26,9 +28,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/nishisan-dev/n-backup/internal/agent"
 	"github.com/nishisan-dev/n-backup/internal/config"
 	"github.com/nishisan-dev/n-backup/internal/protocol"
 	"github.com/nishisan-dev/n-backup/internal/server"
@@ -253,6 +257,72 @@ func TestEndToEnd_StorageNotFound(t *testing.T) {
 	}
 }
 
+// TestEndToEnd_OutsideBackupWindow verifica que handshakes fora da backup_window
+// do storage são recusados com StatusOutsideWindow.
+func TestEndToEnd_OutsideBackupWindow(t *testing.T) {
+	pkiDir := t.TempDir()
+	pki := generatePKI(t, pkiDir, "window-agent")
+
+	// Janela de 1h começando daqui a 1h — garantidamente fechada agora
+	opens := time.Now().Add(time.Hour)
+	start := time.Duration(opens.Hour())*time.Hour + time.Duration(opens.Minute())*time.Minute
+	window := &config.TimeWindow{Start: start, End: (start + time.Hour) % (24 * time.Hour)}
+
+	serverCfg := &config.ServerConfig{
+		Storages: map[string]config.StorageInfo{
+			testStorageName: {BaseDir: t.TempDir(), MaxBackups: 3, BackupWindow: window.String(), BackupWindowRaw: window},
+		},
+		Logging: config.LoggingInfo{Level: "debug", Format: "text"},
+	}
+
+	serverTLS, _ := tls.LoadX509KeyPair(pki.serverCertPath, pki.serverKeyPath)
+	caPool := loadCAPool(t, pki.caCertPath)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{serverTLS},
+		ClientCAs:    caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("TLS listen: %v", err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	go server.RunWithListener(ctx, ln, serverCfg, testLogger())
+
+	clientTLS, _ := tls.LoadX509KeyPair(pki.clientCertPath, pki.clientKeyPath)
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{clientTLS},
+		RootCAs:      caPool,
+		ServerName:   "localhost",
+	})
+	if err != nil {
+		t.Fatalf("TLS dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := protocol.WriteHandshake(conn, "window-agent", testStorageName, testBackupName, "v1.2.3"); err != nil {
+		t.Fatalf("WriteHandshake: %v", err)
+	}
+
+	ack, err := protocol.ReadACK(conn)
+	if err != nil {
+		t.Fatalf("ReadACK: %v", err)
+	}
+
+	if ack.Status != protocol.StatusOutsideWindow {
+		t.Errorf("expected StatusOutsideWindow, got %d: %s", ack.Status, ack.Message)
+	}
+	if !strings.Contains(ack.Message, window.String()) {
+		t.Errorf("expected message to mention window %s, got %q", window.String(), ack.Message)
+	}
+}
+
 // TestEndToEnd_HealthCheck testa o fluxo de health check.
 func TestEndToEnd_HealthCheck(t *testing.T) {
 	pkiDir := t.TempDir()
@@ -410,6 +480,16 @@ func TestEndToEnd_Rotation(t *testing.T) {
 // TestEndToEnd_ParallelBackupSession testa o fluxo paralelo:
 // Agent → Handshake → ACK GO → ParallelInit → ParallelJoin(stream 0) → Stream data → Trailer (primary) → FinalACK → Commit
 func TestEndToEnd_ParallelBackupSession(t *testing.T) {
+	testParallelBackupSession(t, false)
+}
+
+// TestEndToEnd_ParallelBackupSessionMux repete a sessão paralela com o stream
+// de dados dentro de uma conexão multiplexada (PMUX).
+func TestEndToEnd_ParallelBackupSessionMux(t *testing.T) {
+	testParallelBackupSession(t, true)
+}
+
+func testParallelBackupSession(t *testing.T, multiplexed bool) {
 	pkiDir := t.TempDir()
 	storageDir := t.TempDir()
 	agentName := "test-agent-parallel"
@@ -536,13 +616,41 @@ func TestEndToEnd_ParallelBackupSession(t *testing.T) {
 
 	// 4. Conecta stream 0 via ParallelJoin (com retry para tolerar race em CI)
 	// O server precisa processar o ParallelInit e registrar a sessão antes do Join.
-	var stream0Conn *tls.Conn
-	var pAck *protocol.ParallelACK
-	for attempt := 0; attempt < 10; attempt++ {
+	// Com multiplexed, cada tentativa é um stream lógico da mesma conexão PMUX
+	var muxSess *protocol.MuxSession
+	if multiplexed {
+		mc, err := tls.Dial("tcp", ln.Addr().String(), clientTLSCfg)
+		if err != nil {
+			t.Fatalf("TLS dial mux connection: %v", err)
+		}
+		if err := protocol.WriteMuxInit(mc); err != nil {
+			t.Fatalf("WriteMuxInit: %v", err)
+		}
+		if status, err := protocol.ReadMuxACK(mc); err != nil || status != protocol.MuxStatusOK {
+			t.Fatalf("ReadMuxACK: status=%d err=%v", status, err)
+		}
+		muxSess = protocol.NewMuxClient(mc)
+		defer muxSess.Close()
+	}
+	dialStream := func() net.Conn {
+		if muxSess != nil {
+			st, err := muxSess.Open()
+			if err != nil {
+				t.Fatalf("opening mux stream 0: %v", err)
+			}
+			return st
+		}
 		sc, err := tls.Dial("tcp", ln.Addr().String(), clientTLSCfg)
 		if err != nil {
 			t.Fatalf("TLS dial stream 0: %v", err)
 		}
+		return sc
+	}
+
+	var stream0Conn net.Conn
+	var pAck *protocol.ParallelACK
+	for attempt := 0; attempt < 10; attempt++ {
+		sc := dialStream()
 
 		if err := protocol.WriteParallelJoin(sc, sessionID, 0, protocol.JoinReasonNone); err != nil {
 			sc.Close()
@@ -594,7 +702,11 @@ func TestEndToEnd_ParallelBackupSession(t *testing.T) {
 	}
 
 	// Fecha stream 0 (EOF) — server receiveParallelStream termina
-	stream0Conn.CloseWrite()
+	if tc, ok := stream0Conn.(*tls.Conn); ok {
+		tc.CloseWrite()
+	} else {
+		stream0Conn.Close()
+	}
 
 	// Aguarda server processar antes de enviar CIDN
 	time.Sleep(200 * time.Millisecond)
@@ -972,4 +1084,822 @@ func TestEndToEnd_ParallelCRC32Mismatch(t *testing.T) {
 	t.Logf("server correctly rejected corrupted chunk: %v", readErr)
 }
 
+// TestEndToEnd_ParallelChunkNACK testa que, com JoinFlagChunkNACK, o server
+// responde um chunk com CRC32 inválido com ChunkNACK em vez de fechar o
+// stream, e só confirma offsets além dele após a retransmissão.
+func TestEndToEnd_ParallelChunkNACK(t *testing.T) {
+	pkiDir := t.TempDir()
+	storageDir := t.TempDir()
+	agentName := "test-agent-nack"
+	pki := generatePKI(t, pkiDir, agentName)
+
+	serverCfg := &config.ServerConfig{
+		Storages: map[string]config.StorageInfo{
+			testStorageName: {BaseDir: storageDir, MaxBackups: 3},
+		},
+		Logging: config.LoggingInfo{Level: "debug", Format: "text"},
+	}
+
+	serverTLS, err := tls.LoadX509KeyPair(pki.serverCertPath, pki.serverKeyPath)
+	if err != nil {
+		t.Fatalf("loading server cert: %v", err)
+	}
+
+	caPool := loadCAPool(t, pki.caCertPath)
+
+	serverTLSCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{serverTLS},
+		ClientCAs:    caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverTLSCfg)
+	if err != nil {
+		t.Fatalf("TLS listen: %v", err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	logger := testLogger()
+	go server.RunWithListener(ctx, ln, serverCfg, logger)
+
+	// Client TLS config
+	clientTLS, err := tls.LoadX509KeyPair(pki.clientCertPath, pki.clientKeyPath)
+	if err != nil {
+		t.Fatalf("loading client cert: %v", err)
+	}
+
+	clientTLSCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{clientTLS},
+		RootCAs:      caPool,
+		ServerName:   "localhost",
+	}
+
+	// Conn primária
+	conn, err := tls.Dial("tcp", ln.Addr().String(), clientTLSCfg)
+	if err != nil {
+		t.Fatalf("TLS dial: %v", err)
+	}
+	defer conn.Close()
+
+	// 1. Handshake
+	if err := protocol.WriteHandshake(conn, agentName, testStorageName, testBackupName, "v4.0.0-nacktest"); err != nil {
+		t.Fatalf("WriteHandshake: %v", err)
+	}
+
+	ack, err := protocol.ReadACK(conn)
+	if err != nil {
+		t.Fatalf("ReadACK: %v", err)
+	}
+	if ack.Status != protocol.StatusGo {
+		t.Fatalf("expected StatusGo, got %d: %s", ack.Status, ack.Message)
+	}
+
+	sessionID := ack.SessionID
+
+	// 2. ParallelInit: 1 stream
+	if err := protocol.WriteParallelInit(conn, 1, 256*1024); err != nil {
+		t.Fatalf("WriteParallelInit: %v", err)
+	}
+
+	initACK, err := protocol.ReadParallelInitACK(conn)
+	if err != nil {
+		t.Fatalf("ReadParallelInitACK: %v", err)
+	}
+	if initACK.Status != protocol.ParallelInitStatusOK {
+		t.Fatalf("expected ParallelInitStatusOK, got %d", initACK.Status)
+	}
+
+	// 3. Abre stream 0 com ParallelJoin
+	var stream0Conn *tls.Conn
+	for retry := 0; retry < 10; retry++ {
+		sc, err := tls.Dial("tcp", ln.Addr().String(), clientTLSCfg)
+		if err != nil {
+			t.Fatalf("stream TLS dial: %v", err)
+		}
+
+		if err := protocol.WriteParallelJoin(sc, sessionID, 0, protocol.JoinReasonNone|protocol.JoinFlagChunkNACK); err != nil {
+			sc.Close()
+			t.Fatalf("WriteParallelJoin: %v", err)
+		}
+
+		joinACK, err := protocol.ReadParallelACK(sc)
+		if err != nil {
+			sc.Close()
+			t.Fatalf("ReadParallelACK: %v", err)
+		}
+
+		if joinACK.Status == protocol.ParallelStatusOK {
+			stream0Conn = sc
+			break
+		}
+
+		sc.Close()
+		time.Sleep(50 * time.Millisecond)
+	}
+	if stream0Conn == nil {
+		t.Fatal("ParallelJoin failed after retries")
+	}
+	defer stream0Conn.Close()
+
+	payload0 := bytes.Repeat([]byte{0xA0}, 1024)
+	payload1 := bytes.Repeat([]byte{0xB1}, 1024)
+	frameLen := uint64(protocol.ChunkHeaderSize + 1024)
+	sendChunk := func(seq uint32, payload []byte, crc uint32) {
+		t.Helper()
+		if err := protocol.WriteChunkHeader(stream0Conn, seq, uint32(len(payload)), 0, crc); err != nil {
+			t.Fatalf("WriteChunkHeader seq %d: %v", seq, err)
+		}
+		if _, err := stream0Conn.Write(payload); err != nil {
+			t.Fatalf("writing chunk seq %d: %v", seq, err)
+		}
+	}
+	stream0Conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// 4. Chunk 0 corrompido: o server responde ChunkNACK e mantém o stream
+	sendChunk(0, payload0, crc32.ChecksumIEEE(payload0)^0xDEADBEEF)
+	var magic [4]byte
+	if _, err := io.ReadFull(stream0Conn, magic[:]); err != nil {
+		t.Fatalf("reading frame after CRC32 mismatch: %v", err)
+	}
+	if magic != protocol.MagicChunkNACK {
+		t.Fatalf("expected ChunkNACK, got magic %q", magic)
+	}
+	nack, err := protocol.ReadChunkNACKPayload(stream0Conn)
+	if err != nil {
+		t.Fatalf("ReadChunkNACKPayload: %v", err)
+	}
+	if nack.GlobalSeq != 0 {
+		t.Fatalf("expected ChunkNACK for seq 0, got %d", nack.GlobalSeq)
+	}
+
+	// 5. Chunk 1 íntegro: o ChunkSACK não passa do chunk 0 pendente
+	sendChunk(1, payload1, crc32.ChecksumIEEE(payload1))
+	sack, err := protocol.ReadChunkSACK(stream0Conn)
+	if err != nil {
+		t.Fatalf("ReadChunkSACK after chunk 1: %v", err)
+	}
+	if sack.Offset != 0 {
+		t.Fatalf("expected ChunkSACK held at offset 0 while seq 0 is pending, got %d", sack.Offset)
+	}
+
+	// 6. Retransmissão do chunk 0: confirma os três frames do wire
+	sendChunk(0, payload0, crc32.ChecksumIEEE(payload0))
+	sack, err = protocol.ReadChunkSACK(stream0Conn)
+	if err != nil {
+		t.Fatalf("ReadChunkSACK after retransmit: %v", err)
+	}
+	if sack.Offset != 3*frameLen {
+		t.Fatalf("expected ChunkSACK offset %d after retransmit, got %d", 3*frameLen, sack.Offset)
+	}
+}
+
+// TestEndToEnd_ParallelStreamTrailer testa que, com JoinFlagStreamTrailer, o
+// server confirma a capacidade no ParallelACK, responde a um StreamTrailer que
+// declara mais bytes do que recebeu com StreamTrailerACK truncated e aceita o
+// reenvio da parte faltante após o re-join.
+func TestEndToEnd_ParallelStreamTrailer(t *testing.T) {
+	pkiDir := t.TempDir()
+	storageDir := t.TempDir()
+	agentName := "test-agent-trailer"
+	pki := generatePKI(t, pkiDir, agentName)
+
+	serverCfg := &config.ServerConfig{
+		Storages: map[string]config.StorageInfo{
+			testStorageName: {BaseDir: storageDir, MaxBackups: 3},
+		},
+		Logging: config.LoggingInfo{Level: "debug", Format: "text"},
+	}
+
+	serverTLS, err := tls.LoadX509KeyPair(pki.serverCertPath, pki.serverKeyPath)
+	if err != nil {
+		t.Fatalf("loading server cert: %v", err)
+	}
+
+	caPool := loadCAPool(t, pki.caCertPath)
+
+	serverTLSCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{serverTLS},
+		ClientCAs:    caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverTLSCfg)
+	if err != nil {
+		t.Fatalf("TLS listen: %v", err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	logger := testLogger()
+	go server.RunWithListener(ctx, ln, serverCfg, logger)
+
+	clientTLS, err := tls.LoadX509KeyPair(pki.clientCertPath, pki.clientKeyPath)
+	if err != nil {
+		t.Fatalf("loading client cert: %v", err)
+	}
+
+	clientTLSCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{clientTLS},
+		RootCAs:      caPool,
+		ServerName:   "localhost",
+	}
 
+	conn, err := tls.Dial("tcp", ln.Addr().String(), clientTLSCfg)
+	if err != nil {
+		t.Fatalf("TLS dial: %v", err)
+	}
+	defer conn.Close()
+
+	// 1. Handshake + ParallelInit com 1 stream
+	if err := protocol.WriteHandshake(conn, agentName, testStorageName, testBackupName, "v4.0.0-trailertest"); err != nil {
+		t.Fatalf("WriteHandshake: %v", err)
+	}
+	ack, err := protocol.ReadACK(conn)
+	if err != nil {
+		t.Fatalf("ReadACK: %v", err)
+	}
+	if ack.Status != protocol.StatusGo {
+		t.Fatalf("expected StatusGo, got %d: %s", ack.Status, ack.Message)
+	}
+	sessionID := ack.SessionID
+
+	if err := protocol.WriteParallelInit(conn, 1, 256*1024); err != nil {
+		t.Fatalf("WriteParallelInit: %v", err)
+	}
+	initACK, err := protocol.ReadParallelInitACK(conn)
+	if err != nil {
+		t.Fatalf("ReadParallelInitACK: %v", err)
+	}
+	if initACK.Status != protocol.ParallelInitStatusOK {
+		t.Fatalf("expected ParallelInitStatusOK, got %d", initACK.Status)
+	}
+
+	// join abre (ou reabre) o stream 0 anunciando o StreamTrailer
+	join := func() (*tls.Conn, *protocol.ParallelACK) {
+		t.Helper()
+		for retry := 0; retry < 20; retry++ {
+			sc, err := tls.Dial("tcp", ln.Addr().String(), clientTLSCfg)
+			if err != nil {
+				t.Fatalf("stream TLS dial: %v", err)
+			}
+			if err := protocol.WriteParallelJoin(sc, sessionID, 0, protocol.JoinReasonNone|protocol.JoinFlagChunkNACK|protocol.JoinFlagStreamTrailer); err != nil {
+				sc.Close()
+				t.Fatalf("WriteParallelJoin: %v", err)
+			}
+			joinACK, err := protocol.ReadParallelACK(sc)
+			if err != nil {
+				sc.Close()
+				t.Fatalf("ReadParallelACK: %v", err)
+			}
+			if joinACK.Status == protocol.ParallelStatusOK {
+				return sc, joinACK
+			}
+			sc.Close()
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatal("ParallelJoin failed after retries")
+		return nil, nil
+	}
+
+	payload0 := bytes.Repeat([]byte{0xA0}, 1024)
+	payload1 := bytes.Repeat([]byte{0xB1}, 1024)
+	frameLen := uint64(protocol.ChunkHeaderSize + 1024)
+	sendChunk := func(sc *tls.Conn, seq uint32, payload []byte) {
+		t.Helper()
+		if err := protocol.WriteChunkHeader(sc, seq, uint32(len(payload)), 0, crc32.ChecksumIEEE(payload)); err != nil {
+			t.Fatalf("WriteChunkHeader seq %d: %v", seq, err)
+		}
+		if _, err := sc.Write(payload); err != nil {
+			t.Fatalf("writing chunk seq %d: %v", seq, err)
+		}
+		if _, err := protocol.ReadChunkSACK(sc); err != nil {
+			t.Fatalf("ReadChunkSACK after seq %d: %v", seq, err)
+		}
+	}
+	readTrailerACK := func(sc *tls.Conn) *protocol.StreamTrailerACK {
+		t.Helper()
+		var magic [4]byte
+		if _, err := io.ReadFull(sc, magic[:]); err != nil {
+			t.Fatalf("reading frame after StreamTrailer: %v", err)
+		}
+		if magic != protocol.MagicStreamTrailerACK {
+			t.Fatalf("expected StreamTrailerACK, got magic %q", magic)
+		}
+		stAck, err := protocol.ReadStreamTrailerACKPayload(sc)
+		if err != nil {
+			t.Fatalf("ReadStreamTrailerACKPayload: %v", err)
+		}
+		return stAck
+	}
+
+	stream0, joinACK := join()
+	if !joinACK.StreamTrailer {
+		t.Fatal("expected server to confirm StreamTrailer capability in ParallelACK")
+	}
+	stream0.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// 2. Só o chunk 0 chega, mas o trailer declara dois chunks: truncated
+	sendChunk(stream0, 0, payload0)
+	if err := protocol.WriteStreamTrailer(stream0, 0, 2, 2*frameLen); err != nil {
+		t.Fatalf("WriteStreamTrailer: %v", err)
+	}
+	stAck := readTrailerACK(stream0)
+	if stAck.Status != protocol.StreamTrailerStatusTruncated || stAck.Offset != frameLen {
+		t.Fatalf("expected truncated at offset %d, got status %d offset %d", frameLen, stAck.Status, stAck.Offset)
+	}
+	// O server encerra o stream truncado
+	if _, err := stream0.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected stream closed after truncated trailer")
+	}
+	stream0.Close()
+
+	// 3. Re-join retoma do offset confirmado; reenvio + novo trailer: ok
+	stream0, joinACK = join()
+	defer stream0.Close()
+	if joinACK.LastOffset != frameLen {
+		t.Fatalf("expected re-join at offset %d, got %d", frameLen, joinACK.LastOffset)
+	}
+	stream0.SetReadDeadline(time.Now().Add(5 * time.Second))
+	sendChunk(stream0, 1, payload1)
+	if err := protocol.WriteStreamTrailer(stream0, 0, 2, 2*frameLen); err != nil {
+		t.Fatalf("WriteStreamTrailer: %v", err)
+	}
+	if stAck := readTrailerACK(stream0); stAck.Status != protocol.StreamTrailerStatusOK || stAck.Offset != 2*frameLen {
+		t.Fatalf("expected trailer ok at offset %d, got status %d offset %d", 2*frameLen, stAck.Status, stAck.Offset)
+	}
+}
+
+
+
+// TestEndToEnd_PSKAuth testa o listener com auth psk: agent sem certificado
+// de client se autentica com a pre-shared key; chave errada é recusada.
+func TestEndToEnd_PSKAuth(t *testing.T) {
+	pkiDir := t.TempDir()
+	pki := generatePKI(t, pkiDir, "unused")
+	agentName := "psk-agent"
+	key := "0123456789abcdef0123456789abcdef"
+
+	keyringPath := filepath.Join(pkiDir, "psk")
+	os.WriteFile(keyringPath, []byte(agentName+":"+key+"\n"), 0600)
+	serverCfg := &config.ServerConfig{
+		Server: config.ServerListen{Auth: config.AuthModePSK, PSKFile: keyringPath},
+		Storages: map[string]config.StorageInfo{
+			"default": {BaseDir: t.TempDir(), MaxBackups: 3},
+		},
+		Logging: config.LoggingInfo{Level: "debug", Format: "text"},
+	}
+
+	serverTLS, _ := tls.LoadX509KeyPair(pki.serverCertPath, pki.serverKeyPath)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{serverTLS},
+	})
+	if err != nil {
+		t.Fatalf("TLS listen: %v", err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	go server.RunWithListener(ctx, ln, serverCfg, testLogger())
+
+	agentPSK := filepath.Join(pkiDir, "agent.psk")
+	os.WriteFile(agentPSK, []byte(key+"\n"), 0600)
+	agentCfg := &config.AgentConfig{
+		Agent: config.AgentInfo{Name: agentName},
+		TLS:   config.TLSClient{CACert: pki.caCertPath, Auth: config.AuthModePSK, PSKFile: agentPSK},
+	}
+	if err := agent.RunHealthCheck(ln.Addr().String(), agentCfg, "", testLogger()); err != nil {
+		t.Fatalf("health check with psk: %v", err)
+	}
+	rep, err := agent.CheckHealth(ln.Addr().String(), agentCfg, "default", testLogger())
+	if err != nil || rep.Status != "READY" || len(rep.Storages) != 1 || rep.Storages[0].DiskFree == 0 {
+		t.Fatalf("unexpected health report: %+v (err %v)", rep, err)
+	}
+
+	// Health check por storage (PSTG): espaço livre real do storage
+	resp, err := agent.QueryHealth(ctx, ln.Addr().String(), agentCfg, "default", testLogger())
+	if err != nil {
+		t.Fatalf("storage health check: %v", err)
+	}
+	if resp.Status != protocol.HealthStatusReady || resp.DiskFree == 0 {
+		t.Errorf("expected ready storage with disk free, got %+v", resp)
+	}
+	resp, err = agent.QueryHealth(ctx, ln.Addr().String(), agentCfg, "nope", testLogger())
+	if err != nil || resp.Status != protocol.HealthStatusNotFound {
+		t.Errorf("expected NOT FOUND for unknown storage, got %+v (err %v)", resp, err)
+	}
+
+	os.WriteFile(agentPSK, []byte(strings.Repeat("f", len(key))+"\n"), 0600)
+	err = agent.RunHealthCheck(ln.Addr().String(), agentCfg, "", testLogger())
+	if !errors.Is(err, agent.ErrAgentUnauthorized) {
+		t.Fatalf("expected ErrAgentUnauthorized with wrong psk, got %v", err)
+	}
+}
+
+// TestEndToEnd_SACKWindowNegotiation valida o handshake v7: o ACK confirma a
+// versão, o server concede a janela pedida logo após o ACK GO e passa a
+// enviar SACKs no intervalo negociado (64KB), em vez do default de 4MB.
+func TestEndToEnd_SACKWindowNegotiation(t *testing.T) {
+	pkiDir := t.TempDir()
+	storageDir := t.TempDir()
+	agentName := "sack-window-agent"
+	pki := generatePKI(t, pkiDir, agentName)
+
+	serverCfg := &config.ServerConfig{
+		Storages: map[string]config.StorageInfo{
+			testStorageName: {BaseDir: storageDir, MaxBackups: 3},
+		},
+		Logging: config.LoggingInfo{Level: "debug", Format: "text"},
+	}
+
+	serverTLS, _ := tls.LoadX509KeyPair(pki.serverCertPath, pki.serverKeyPath)
+	caPool := loadCAPool(t, pki.caCertPath)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{serverTLS},
+		ClientCAs:    caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("TLS listen: %v", err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	go server.RunWithListener(ctx, ln, serverCfg, testLogger())
+
+	clientTLS, _ := tls.LoadX509KeyPair(pki.clientCertPath, pki.clientKeyPath)
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{clientTLS},
+		RootCAs:      caPool,
+		ServerName:   "localhost",
+	})
+	if err != nil {
+		t.Fatalf("TLS dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := protocol.WriteHandshakeVersion(conn, protocol.HandshakeVersionSACKWindow, agentName, testStorageName, testBackupName, "v1.2.3"); err != nil {
+		t.Fatalf("WriteHandshakeVersion: %v", err)
+	}
+	br := bufio.NewReader(conn)
+	ack, err := protocol.ReadACK(br)
+	if err != nil {
+		t.Fatalf("ReadACK: %v", err)
+	}
+	if ack.Status != protocol.StatusGo || ack.Version != protocol.HandshakeVersionSACKWindow {
+		t.Fatalf("expected StatusGo at v%d, got %+v", protocol.HandshakeVersionSACKWindow, ack)
+	}
+	req := protocol.SACKWindow{Interval: 64 * 1024, MaxInFlight: 256 * 1024}
+	if err := protocol.WriteSACKWindow(conn, req); err != nil {
+		t.Fatalf("WriteSACKWindow: %v", err)
+	}
+	granted, err := protocol.ReadSACKWindow(br)
+	if err != nil {
+		t.Fatalf("ReadSACKWindow: %v", err)
+	}
+	if *granted != req {
+		t.Fatalf("expected granted window %+v, got %+v", req, *granted)
+	}
+
+	if _, err := conn.Write([]byte{0x00}); err != nil {
+		t.Fatalf("writing single-stream marker: %v", err)
+	}
+
+	// Arquivo aleatório: o tar.gz não comprime e passa de alguns intervalos
+	sourceDir := t.TempDir()
+	random := make([]byte, 512*1024)
+	rand.Read(random)
+	os.WriteFile(filepath.Join(sourceDir, "random.bin"), random, 0644)
+
+	var streamBuf bytes.Buffer
+	gzW, _ := gzip.NewWriterLevel(&streamBuf, gzip.BestSpeed)
+	tw := tar.NewWriter(gzW)
+	tw.WriteHeader(&tar.Header{Name: "random.bin", Mode: 0644, Size: int64(len(random)), Typeflag: tar.TypeReg})
+	tw.Write(random)
+	tw.Close()
+	gzW.Close()
+	stream := streamBuf.Bytes()
+	checksum := sha256.Sum256(stream)
+
+	// Um intervalo e pouco: com o default (4MB) nenhum SACK chegaria aqui
+	first := 100 * 1024
+	if _, err := conn.Write(stream[:first]); err != nil {
+		t.Fatalf("writing stream: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	sack, err := protocol.ReadSACK(br)
+	if err != nil {
+		t.Fatalf("expected a SACK after %d bytes with a 64KB interval: %v", first, err)
+	}
+	if sack.Offset < uint64(req.Interval) || sack.Offset > uint64(first) {
+		t.Fatalf("unexpected SACK offset %d", sack.Offset)
+	}
+
+	if _, err := conn.Write(stream[first:]); err != nil {
+		t.Fatalf("writing stream: %v", err)
+	}
+	if err := protocol.WriteTrailer(conn, checksum, uint64(len(stream))); err != nil {
+		t.Fatalf("WriteTrailer: %v", err)
+	}
+	conn.CloseWrite()
+
+	// Descarta os SACKs restantes antes do FinalACK (status de 1 byte)
+	for {
+		next, err := br.Peek(1)
+		if err != nil {
+			t.Fatalf("reading final ack: %v", err)
+		}
+		if next[0] != protocol.MagicSACK[0] {
+			break
+		}
+		if _, err := protocol.ReadSACK(br); err != nil {
+			t.Fatalf("ReadSACK: %v", err)
+		}
+	}
+	finalACK, err := protocol.ReadFinalACK(br)
+	if err != nil {
+		t.Fatalf("ReadFinalACK: %v", err)
+	}
+	if finalACK.Status != protocol.FinalStatusOK {
+		t.Fatalf("expected FinalStatusOK, got %d", finalACK.Status)
+	}
+}
+
+// TestEndToEnd_BenchDiscardStorage roda o `nbackup-agent bench` contra um
+// storage discard: a sessão paralela completa (com control channel) termina
+// em FinalStatusOK sem gravar nada no base_dir. Em storage file, o handshake
+// do benchmark é recusado.
+func TestEndToEnd_BenchDiscardStorage(t *testing.T) {
+	pkiDir := t.TempDir()
+	discardDir := t.TempDir()
+	agentName := "bench-agent"
+	pki := generatePKI(t, pkiDir, agentName)
+
+	serverCfg := &config.ServerConfig{
+		Storages: map[string]config.StorageInfo{
+			"bench":   {BaseDir: discardDir, Type: config.StorageTypeDiscard},
+			"regular": {BaseDir: t.TempDir(), MaxBackups: 3},
+		},
+		Logging: config.LoggingInfo{Level: "debug", Format: "text"},
+	}
+
+	serverTLS, _ := tls.LoadX509KeyPair(pki.serverCertPath, pki.serverKeyPath)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{serverTLS},
+		ClientCAs:    loadCAPool(t, pki.caCertPath),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("TLS listen: %v", err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	go server.RunWithListener(ctx, ln, serverCfg, testLogger())
+
+	cfgPath := filepath.Join(pkiDir, "agent.yaml")
+	os.WriteFile(cfgPath, []byte(fmt.Sprintf(`
+agent:
+  name: %q
+server:
+  address: %q
+tls:
+  ca_cert: %q
+  client_cert: %q
+  client_key: %q
+resume:
+  buffer_size: 8mb
+backups:
+  - name: "unused"
+    storage: "bench"
+    schedule: "0 2 * * *"
+    sources:
+      - path: /tmp
+`, agentName, ln.Addr().String(), pki.caCertPath, pki.clientCertPath, pki.clientKeyPath)), 0600)
+	agentCfg, err := config.LoadAgentConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("loading agent config: %v", err)
+	}
+
+	const size = 20*1024*1024 + 12345
+	var samples int
+	res, err := agent.RunBench(ctx, agentCfg, agent.BenchOptions{
+		Storage:   "bench",
+		Streams:   3,
+		Size:      size,
+		ChunkSize: 256 * 1024,
+		Interval:  50 * time.Millisecond,
+		OnSample:  func(agent.BenchSample) { samples++ },
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("RunBench: %v", err)
+	}
+	if res.Bytes != size || res.ActiveStreams != 3 || res.ChunkSize != 256*1024 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	// BytesSent inclui o framing dos chunks
+	var sent uint64
+	for _, s := range res.PerStream {
+		sent += s.Bytes - s.RetransmitBytes
+	}
+	if sent < size {
+		t.Errorf("expected at least %d bytes across streams, got %d", size, sent)
+	}
+	if samples == 0 || samples != len(res.Samples) || res.Bottleneck == "" || res.HandshakeRTTMs <= 0 {
+		t.Errorf("unexpected samples/diagnosis: samples=%d result=%+v", samples, res)
+	}
+
+	// Nada gravado no storage discard (nem o arquivo montado, nem o manifest)
+	filepath.WalkDir(discardDir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			t.Errorf("unexpected file in discard storage: %s", path)
+		}
+		return nil
+	})
+
+	_, err = agent.RunBench(ctx, agentCfg, agent.BenchOptions{Storage: "regular", Streams: 1, Size: 1024}, testLogger())
+	if err == nil || !strings.Contains(err.Error(), "discard") {
+		t.Errorf("expected benchmark rejected on file storage, got %v", err)
+	}
+}
+
+// syncBuffer é um bytes.Buffer seguro para escrita concorrente (logs do server).
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// runBenchUnderFaults executa um nbackup-agent bench real contra um server
+// com as falhas determinísticas de chaos.faults e retorna o resultado e os
+// logs do server. O storage discard valida o checksum da sessão inteira:
+// qualquer byte perdido ou duplicado na recuperação falha o benchmark.
+func runBenchUnderFaults(t *testing.T, faults []config.ChaosFault, opts agent.BenchOptions) (*agent.BenchResult, string) {
+	t.Helper()
+	pkiDir := t.TempDir()
+	agentName := "chaos-agent"
+	pki := generatePKI(t, pkiDir, agentName)
+
+	serverCfg := &config.ServerConfig{
+		Storages: map[string]config.StorageInfo{
+			"bench": {BaseDir: t.TempDir(), Type: config.StorageTypeDiscard},
+		},
+		Logging: config.LoggingInfo{Level: "info", Format: "text"},
+		Chaos:   config.ChaosConfig{Enabled: true, Faults: faults},
+	}
+
+	serverTLS, _ := tls.LoadX509KeyPair(pki.serverCertPath, pki.serverKeyPath)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{serverTLS},
+		ClientCAs:    loadCAPool(t, pki.caCertPath),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("TLS listen: %v", err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	var logs syncBuffer
+	serverLogger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	go server.RunWithListener(ctx, ln, serverCfg, serverLogger)
+
+	cfgPath := filepath.Join(pkiDir, "agent.yaml")
+	os.WriteFile(cfgPath, []byte(fmt.Sprintf(`
+agent:
+  name: %q
+server:
+  address: %q
+tls:
+  ca_cert: %q
+  client_cert: %q
+  client_key: %q
+resume:
+  buffer_size: 8mb
+backups:
+  - name: "unused"
+    storage: "bench"
+    schedule: "0 2 * * *"
+    sources:
+      - path: /tmp
+`, agentName, ln.Addr().String(), pki.caCertPath, pki.clientCertPath, pki.clientKeyPath)), 0600)
+	agentCfg, err := config.LoadAgentConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("loading agent config: %v", err)
+	}
+
+	opts.Storage = "bench"
+	res, err := agent.RunBench(ctx, agentCfg, opts, testLogger())
+	if err != nil {
+		t.Fatalf("RunBench under faults: %v\nserver logs:\n%s", err, logs.String())
+	}
+	if res.Bytes != opts.Size {
+		t.Errorf("expected %d bytes, got %d", opts.Size, res.Bytes)
+	}
+	return res, logs.String()
+}
+
+// retransmitted soma os bytes reenviados pelo agent em todos os streams.
+func retransmitted(res *agent.BenchResult) uint64 {
+	var n uint64
+	for _, s := range res.PerStream {
+		n += s.RetransmitBytes
+	}
+	return n
+}
+
+// TestEndToEnd_ChaosFaults exercita os caminhos de recuperação do protocolo
+// paralelo sob falhas determinísticas injetadas pelo server (chaos.faults):
+// resume após corte no meio de um frame, re-join após conexão morta,
+// retransmissão via ChunkNACK, SACKs atrasados e flow rotation forçada.
+func TestEndToEnd_ChaosFaults(t *testing.T) {
+	stream := func(i int) *int { return &i }
+	chunk := func(seq uint32) *uint32 { return &seq }
+	opts := agent.BenchOptions{Streams: 3, Size: 12*1024*1024 + 777, ChunkSize: 256 * 1024}
+
+	t.Run("drop after bytes resumes the stream", func(t *testing.T) {
+		res, logs := runBenchUnderFaults(t, []config.ChaosFault{
+			// 1mb + 100 bytes: o corte cai no meio de um frame
+			{Action: config.ChaosFaultDrop, Stream: stream(1), AfterBytesRaw: 1024*1024 + 100},
+		}, opts)
+		if !strings.Contains(logs, "chaos: dropping parallel stream") {
+			t.Error("expected drop fault to fire")
+		}
+		if !strings.Contains(logs, "reconnects=1") {
+			t.Errorf("expected stream re-join after drop, logs:\n%s", logs)
+		}
+		if res.PerStream[1].RetransmitBytes == 0 {
+			t.Error("expected stream 1 to resend the unacknowledged tail")
+		}
+	})
+
+	t.Run("killed stream re-joins", func(t *testing.T) {
+		// SACKs atrasados mantêm o stream 0 em transferência quando o kill dispara
+		_, logs := runBenchUnderFaults(t, []config.ChaosFault{
+			{Action: config.ChaosFaultDelaySACK, Stream: stream(0), Delay: 20 * time.Millisecond, Times: -1},
+			{Action: config.ChaosFaultKill, Stream: stream(0), After: 150 * time.Millisecond},
+		}, opts)
+		if !strings.Contains(logs, "chaos: killing parallel stream") {
+			t.Error("expected kill fault to fire")
+		}
+		if !strings.Contains(logs, "reconnects=1") {
+			t.Errorf("expected stream re-join after kill, logs:\n%s", logs)
+		}
+	})
+
+	t.Run("corrupted chunk is retransmitted", func(t *testing.T) {
+		res, logs := runBenchUnderFaults(t, []config.ChaosFault{
+			{Action: config.ChaosFaultCorrupt, Chunk: chunk(4)},
+		}, opts)
+		if !strings.Contains(logs, "ChunkNACK sent") || !strings.Contains(logs, "retransmitted chunk received") {
+			t.Errorf("expected ChunkNACK and retransmission, logs:\n%s", logs)
+		}
+		if retransmitted(res) == 0 {
+			t.Error("expected retransmitted bytes")
+		}
+	})
+
+	t.Run("forced flow rotation", func(t *testing.T) {
+		_, logs := runBenchUnderFaults(t, []config.ChaosFault{
+			{Action: config.ChaosFaultDelaySACK, Stream: stream(2), Delay: 10 * time.Millisecond, Times: -1},
+			{Action: config.ChaosFaultRotate, Stream: stream(2), Chunk: chunk(5)},
+		}, opts)
+		if !strings.Contains(logs, "chaos: forcing stream rotation") || !strings.Contains(logs, "ControlRotate") {
+			t.Errorf("expected graceful rotation, logs:\n%s", logs)
+		}
+		if n := strings.Count(logs, "parallel join accepted"); n <= opts.Streams {
+			t.Errorf("expected a rotation re-join, got %d joins for %d streams", n, opts.Streams)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// field é um atributo achatado de um registro: grupos viram prefixos
+// separados por ponto (ex: "stream.index").
+type field struct {
+	key, value string
+}
+
+// recordSink recebe os registros achatados de um fieldHandler. Usado pelos
+// destinos estruturados (syslog e journald), que mapeiam cada atributo para
+// um campo próprio em vez de serializar o registro inteiro.
+type recordSink interface {
+	emit(r slog.Record, fields []field) error
+	io.Closer
+}
+
+// fieldHandler é um slog.Handler que achata os atributos de cada registro
+// (inclusive os de WithAttrs/WithGroup) e os entrega a um recordSink.
+type fieldHandler struct {
+	level  slog.Leveler
+	sink   recordSink
+	attrs  []field // de WithAttrs, já com o prefixo dos grupos
+	prefix string  // grupos de WithGroup (ex: "a.b.")
+}
+
+func newFieldHandler(sink recordSink, level slog.Leveler) *fieldHandler {
+	return &fieldHandler{level: level, sink: sink}
+}
+
+func (h *fieldHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *fieldHandler) Handle(_ context.Context, r slog.Record) error {
+	fields := make([]field, len(h.attrs), len(h.attrs)+r.NumAttrs())
+	copy(fields, h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendField(fields, h.prefix, a)
+		return true
+	})
+	return h.sink.emit(r, fields)
+}
+
+func (h *fieldHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = make([]field, len(h.attrs), len(h.attrs)+len(attrs))
+	copy(h2.attrs, h.attrs)
+	for _, a := range attrs {
+		h2.attrs = appendField(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+func (h *fieldHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// appendField acrescenta a (com prefix) a fields, achatando grupos.
+func appendField(fields []field, prefix string, a slog.Attr) []field {
+	v := a.Value.Resolve()
+	switch {
+	case a.Equal(slog.Attr{}):
+		return fields
+	case v.Kind() == slog.KindGroup:
+		p := prefix
+		if a.Key != "" {
+			p += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			fields = appendField(fields, p, ga)
+		}
+		return fields
+	}
+	var s string
+	switch v.Kind() {
+	case slog.KindTime:
+		s = v.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			s = err.Error()
+		} else {
+			s = v.String()
+		}
+	default:
+		s = v.String()
+	}
+	return append(fields, field{key: prefix + a.Key, value: s})
+}
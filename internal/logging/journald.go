@@ -0,0 +1,87 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// journalSocket é o socket do protocolo nativo do journald (variável para os testes).
+var journalSocket = "/run/systemd/journal/socket"
+
+// journalReserved são os campos preenchidos pelo próprio sink; um atributo
+// com o mesmo nome recebe o prefixo NBACKUP_.
+var journalReserved = map[string]bool{"MESSAGE": true, "PRIORITY": true, "SYSLOG_IDENTIFIER": true}
+
+// journaldSink envia os registros ao journald pelo protocolo nativo: cada
+// atributo vira um campo (ex: session_id → SESSION_ID, stream.index →
+// STREAM_INDEX), consultável com `journalctl SESSION_ID=...`.
+type journaldSink struct {
+	conn    *net.UnixConn
+	appName string
+}
+
+// newJournaldSink conecta ao socket do journald.
+func newJournaldSink(appName string) (*journaldSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to journald: %w", err)
+	}
+	return &journaldSink{conn: conn, appName: appName}, nil
+}
+
+func (s *journaldSink) emit(r slog.Record, fields []field) error {
+	var b bytes.Buffer
+	journalField(&b, "MESSAGE", r.Message)
+	journalField(&b, "PRIORITY", strconv.Itoa(syslogSeverity(r.Level)))
+	journalField(&b, "SYSLOG_IDENTIFIER", s.appName)
+	for _, f := range fields {
+		journalField(&b, journalFieldName(f.key), f.value)
+	}
+	// Cada registro é um datagrama: o envio é atômico e não precisa de lock
+	_, err := s.conn.Write(b.Bytes())
+	return err
+}
+
+func (s *journaldSink) Close() error {
+	return s.conn.Close()
+}
+
+// journalField escreve um campo. Valores com quebra de linha usam o formato
+// binário do protocolo (nome, tamanho em 64 bits little-endian e valor).
+func journalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name + "=" + value + "\n")
+		return
+	}
+	b.WriteString(name + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
+
+// journalFieldName converte uma chave em nome de campo do journal: letras
+// maiúsculas, dígitos e '_', começando por letra, até 64 caracteres.
+func journalFieldName(key string) string {
+	b := []byte(strings.ToUpper(key))
+	for i, c := range b {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			b[i] = '_'
+		}
+	}
+	name := string(b)
+	if name == "" || name[0] < 'A' || name[0] > 'Z' || journalReserved[name] {
+		name = "NBACKUP_" + strings.TrimLeft(name, "_")
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
@@ -9,42 +9,148 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 )
 
+// processLevel é o nível do último logger criado por NewLogger (o logger do
+// processo), ajustável em runtime via SetLevel — usado no reload via SIGHUP.
+var processLevel atomic.Pointer[slog.LevelVar]
+
 // NewLogger cria um slog.Logger configurado com o nível, formato e output especificados.
 // Formatos suportados: "json" (default) e "text".
 // Níveis suportados: "debug", "info" (default), "warn", "error".
 // Se filePath não for vazio, grava logs em stdout + file (MultiWriter).
 // Retorna o logger e um io.Closer que deve ser chamado no shutdown para fechar o arquivo.
-// Se filePath for vazio, o Closer retornado é um no-op.
+// Se filePath for vazio, o Closer retornado é um no-op. O arquivo é rotacionado
+// conforme a rotação do processo (ver SetRotation).
+// Mensagens e atributos passam pela redação do processo (ver SetRedaction) e
+// os registros pela amostragem do processo (ver SetSampling).
 func NewLogger(level, format, filePath string) (*slog.Logger, io.Closer) {
-	lvl := parseLevel(level)
+	return NewLoggerTo(level, format, filePath, os.Stdout)
+}
+
+// NewLoggerTo é NewLogger com console no lugar de stdout — usado quando
+// stdout é reservado para a saída estruturada de um comando (--output json).
+func NewLoggerTo(level, format, filePath string, console io.Writer) (*slog.Logger, io.Closer) {
+	return NewTargetLogger(level, format, filePath, console, Target{})
+}
+
+// Destinos do log do processo (logging.target).
+const (
+	TargetStdout   = "stdout"
+	TargetSyslog   = "syslog"
+	TargetJournald = "journald"
+)
+
+// Target é o destino do log do processo no lugar do console.
+type Target struct {
+	Kind   string // TargetStdout (default), TargetSyslog ou TargetJournald
+	Syslog SyslogOptions
+	// AppName identifica o processo (APP-NAME do syslog, SYSLOG_IDENTIFIER do
+	// journald). Default: nome do executável.
+	AppName string
+}
+
+// NewTargetLogger é NewLoggerTo com o destino target: em syslog e journald,
+// os registros vão para o destino (com os atributos como campos) em vez do
+// console, e filePath, se configurado, continua recebendo o formato de
+// format. Se o destino não puder ser aberto, loga no console.
+func NewTargetLogger(level, format, filePath string, console io.Writer, target Target) (*slog.Logger, io.Closer) {
+	lvl := new(slog.LevelVar)
+	lvl.Set(parseLevel(level))
+	processLevel.Store(lvl)
 	opts := &slog.HandlerOptions{Level: lvl}
 
-	var w io.Writer = os.Stdout
-	var closer io.Closer = io.NopCloser(strings.NewReader(""))
+	var sink recordSink
+	if target.Kind == TargetSyslog || target.Kind == TargetJournald {
+		var err error
+		if sink, err = newSink(target); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: could not open %s log target: %v (logging to console)\n", target.Kind, err)
+		}
+	}
 
+	var file *rotatingFile
 	if filePath != "" {
-		f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		f, err := openRotatingFile(filePath)
 		if err != nil {
 			// Se não conseguir abrir o arquivo, loga stderr e continua só com stdout
 			fmt.Fprintf(os.Stderr, "WARNING: could not open log file %q: %v (logging to stdout only)\n", filePath, err)
 		} else {
-			w = io.MultiWriter(os.Stdout, f)
-			closer = f
+			file = f
 		}
 	}
 
 	var handler slog.Handler
-	switch strings.ToLower(format) {
-	case "text":
-		handler = slog.NewTextHandler(w, opts)
+	var closer io.Closer = io.NopCloser(strings.NewReader(""))
+	switch {
+	case sink != nil && file != nil:
+		handler = &fanOutHandler{primary: newFieldHandler(sink, lvl), secondary: newFormatHandler(file, format, opts)}
+		closer = multiCloser{sink, file}
+	case sink != nil:
+		handler, closer = newFieldHandler(sink, lvl), sink
+	case file != nil:
+		handler, closer = newFormatHandler(io.MultiWriter(console, file), format, opts), file
 	default:
-		handler = slog.NewJSONHandler(w, opts)
+		handler = newFormatHandler(console, format, opts)
 	}
 
-	return slog.New(handler), closer
+	return slog.New(newRedactHandler(newSampleHandler(handler))), closer
+}
+
+// newSink abre o destino estruturado de target.
+func newSink(target Target) (recordSink, error) {
+	appName := target.AppName
+	if appName == "" {
+		appName = filepath.Base(os.Args[0])
+	}
+	var (
+		sink recordSink
+		err  error
+	)
+	if target.Kind == TargetJournald {
+		sink, err = newJournaldSink(appName)
+	} else {
+		sink, err = newSyslogSink(target.Syslog, appName)
+	}
+	if err != nil {
+		// Evita um recordSink não-nil com ponteiro nil
+		return nil, err
+	}
+	return sink, nil
+}
+
+// newFormatHandler cria o handler de texto ou JSON (default) sobre w.
+func newFormatHandler(w io.Writer, format string, opts *slog.HandlerOptions) slog.Handler {
+	if strings.ToLower(format) == "text" {
+		return slog.NewTextHandler(w, opts)
+	}
+	return slog.NewJSONHandler(w, opts)
+}
+
+// multiCloser fecha todos os closers, retornando o primeiro erro.
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var first error
+	for _, c := range m {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// SetLevel altera em runtime o nível do logger do processo (o último criado
+// por NewLogger). Retorna false se nenhum logger foi criado.
+func SetLevel(level string) bool {
+	lvl := processLevel.Load()
+	if lvl == nil {
+		return false
+	}
+	lvl.Set(parseLevel(level))
+	return true
 }
 
 func parseLevel(level string) slog.Level {
@@ -5,6 +5,8 @@
 package logging
 
 import (
+	"context"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -89,3 +91,22 @@ func TestNewLogger_WithFileOutput_InvalidPath(t *testing.T) {
 	// Logger deve funcionar (stdout only)
 	logger.Info("still works")
 }
+
+func TestSetLevel_AdjustsProcessLogger(t *testing.T) {
+	logger, closer := NewLogger("info", "json", "")
+	defer closer.Close()
+
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Fatal("debug should be disabled at info level")
+	}
+	if !SetLevel("debug") {
+		t.Fatal("expected SetLevel to find the process logger")
+	}
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("debug should be enabled after SetLevel(debug)")
+	}
+	SetLevel("error")
+	if logger.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("warn should be disabled after SetLevel(error)")
+	}
+}
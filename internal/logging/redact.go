@@ -0,0 +1,186 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultRedactReplacement substitui os trechos redigidos quando
+// logging.redact.replacement não é configurado.
+const DefaultRedactReplacement = "[REDACTED]"
+
+// Redactor substitui em strings os trechos que casam com um conjunto de
+// expressões regulares. Se a expressão tem grupos de captura, apenas o
+// conteúdo dos grupos é substituído (ex: `token=([^/]+)` preserva o
+// "token="); senão, o match inteiro.
+type Redactor struct {
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+// NewRedactor compila patterns. Retorna nil (redação desabilitada) se
+// patterns for vazio.
+func NewRedactor(patterns []string, replacement string) (*Redactor, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	if replacement == "" {
+		replacement = DefaultRedactReplacement
+	}
+	r := &Redactor{replacement: replacement}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// Redact retorna s com os trechos sensíveis substituídos. Um Redactor nil
+// retorna s inalterada.
+func (r *Redactor) Redact(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, re := range r.patterns {
+		if re.NumSubexp() == 0 {
+			s = re.ReplaceAllLiteralString(s, r.replacement)
+			continue
+		}
+		s = r.replaceGroups(re, s)
+	}
+	return s
+}
+
+// replaceGroups substitui apenas os grupos de captura de cada match de re.
+func (r *Redactor) replaceGroups(re *regexp.Regexp, s string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		for g := 2; g < len(m); g += 2 {
+			start, end := m[g], m[g+1]
+			// Grupos que não participaram do match ou aninhados em um grupo
+			// já substituído são ignorados.
+			if start < 0 || start < last {
+				continue
+			}
+			b.WriteString(s[last:start])
+			b.WriteString(r.replacement)
+			last = end
+		}
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// processRedactor é o Redactor do processo, aplicado pelos loggers criados
+// por NewLogger/NewSessionLogger e por Redact. Ajustável em runtime via
+// SetRedaction (reload via SIGHUP).
+var processRedactor atomic.Pointer[Redactor]
+
+// SetRedaction define os padrões de redação do processo (logging.redact).
+// patterns vazio desabilita a redação.
+func SetRedaction(patterns []string, replacement string) error {
+	r, err := NewRedactor(patterns, replacement)
+	if err != nil {
+		return err
+	}
+	processRedactor.Store(r)
+	return nil
+}
+
+// Redact aplica a redação do processo a s. Usado pelos canais que saem do
+// processo sem passar pelo logger: eventos, WebUI, webhooks e notificações.
+func Redact(s string) string {
+	return processRedactor.Load().Redact(s)
+}
+
+// redactHandler é um slog.Handler que aplica a redação do processo à
+// mensagem e aos atributos antes de repassá-los ao handler interno.
+type redactHandler struct {
+	inner slog.Handler
+}
+
+// newRedactHandler envolve inner com a redação do processo.
+func newRedactHandler(inner slog.Handler) slog.Handler {
+	return &redactHandler{inner: inner}
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	red := processRedactor.Load()
+	if red == nil {
+		return h.inner.Handle(ctx, r)
+	}
+	out := slog.NewRecord(r.Time, r.Level, red.Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(red, a))
+		return true
+	})
+	return h.inner.Handle(ctx, out)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	// Atributos fixos (ex: logger.With("path", ...)) são redigidos com os
+	// padrões vigentes na criação do logger derivado.
+	if red := processRedactor.Load(); red != nil {
+		redacted := make([]slog.Attr, len(attrs))
+		for i, a := range attrs {
+			redacted[i] = redactAttr(red, a)
+		}
+		attrs = redacted
+	}
+	return &redactHandler{inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{inner: h.inner.WithGroup(name)}
+}
+
+// redactAttr redige os valores textuais de a: strings, erros, []string,
+// fmt.Stringer e grupos (recursivamente). Demais tipos passam inalterados.
+func redactAttr(red *Redactor, a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, red.Redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redacted[i] = redactAttr(red, ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, red.Redact(x.Error()))
+		case []string:
+			redacted := make([]string, len(x))
+			for i, s := range x {
+				redacted[i] = red.Redact(s)
+			}
+			return slog.Any(a.Key, redacted)
+		case fmt.Stringer:
+			return slog.String(a.Key, red.Redact(x.String()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
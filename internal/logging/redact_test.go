@@ -0,0 +1,125 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactor_Redact(t *testing.T) {
+	r, err := NewRedactor([]string{`/home/[^/]+`, `token=([A-Za-z0-9]+)`}, "")
+	if err != nil {
+		t.Fatalf("NewRedactor: %v", err)
+	}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"/home/alice/docs/a.txt", "[REDACTED]/docs/a.txt"},
+		{"/data/export-token=abc123.csv", "/data/export-token=[REDACTED].csv"},
+		{"token=a token=b", "token=[REDACTED] token=[REDACTED]"},
+		{"/var/lib/app", "/var/lib/app"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := r.Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactor_CustomReplacementAndNil(t *testing.T) {
+	r, err := NewRedactor([]string{`secret`}, "***")
+	if err != nil {
+		t.Fatalf("NewRedactor: %v", err)
+	}
+	if got := r.Redact("my-secret-file"); got != "my-***-file" {
+		t.Errorf("got %q", got)
+	}
+
+	none, err := NewRedactor(nil, "")
+	if err != nil || none != nil {
+		t.Fatalf("expected nil redactor without patterns, got %v, %v", none, err)
+	}
+	if got := none.Redact("secret"); got != "secret" {
+		t.Errorf("nil redactor changed input: %q", got)
+	}
+}
+
+func TestRedactor_InvalidPattern(t *testing.T) {
+	if _, err := NewRedactor([]string{`(unclosed`}, ""); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+	if err := SetRedaction([]string{`(unclosed`}, ""); err == nil {
+		t.Fatal("expected SetRedaction error for invalid pattern")
+	}
+}
+
+func TestRedactHandler_RedactsMessageAndAttrs(t *testing.T) {
+	if err := SetRedaction([]string{`alice`}, ""); err != nil {
+		t.Fatalf("SetRedaction: %v", err)
+	}
+	t.Cleanup(func() { SetRedaction(nil, "") })
+
+	var buf bytes.Buffer
+	logger := slog.New(newRedactHandler(slog.NewJSONHandler(&buf, nil)))
+	logger.With("base", "/home/alice").WithGroup("g").Info("opened /home/alice/x",
+		"path", "/home/alice/y",
+		"error", errors.New("open /home/alice/z: denied"),
+		"missing", []string{"/home/alice/w"},
+		"bytes", 42,
+	)
+
+	out := buf.String()
+	if strings.Contains(out, "alice") {
+		t.Fatalf("log output not redacted: %s", out)
+	}
+	if !strings.Contains(out, `"bytes":42`) {
+		t.Errorf("non-string attribute changed: %s", out)
+	}
+	if strings.Count(out, DefaultRedactReplacement) != 5 {
+		t.Errorf("expected 5 redactions, got: %s", out)
+	}
+}
+
+func TestRedact_Disabled(t *testing.T) {
+	SetRedaction(nil, "")
+	if got := Redact("/home/alice"); got != "/home/alice" {
+		t.Errorf("Redact without patterns = %q", got)
+	}
+}
+
+func TestSessionLogger_Redacts(t *testing.T) {
+	if err := SetRedaction([]string{`alice`}, "x"); err != nil {
+		t.Fatalf("SetRedaction: %v", err)
+	}
+	t.Cleanup(func() { SetRedaction(nil, "") })
+
+	dir := t.TempDir()
+	base := slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+	logger, closer, path, err := NewSessionLogger(base, dir, "agent", "s1")
+	if err != nil {
+		t.Fatalf("NewSessionLogger: %v", err)
+	}
+	logger.Info("file", "path", "/home/alice/a")
+	closer.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading session log: %v", err)
+	}
+	if strings.Contains(string(data), "alice") {
+		t.Fatalf("session log not redacted: %s", data)
+	}
+	if filepath.Dir(path) != filepath.Join(dir, "agent") {
+		t.Errorf("unexpected session log path %s", path)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rotatedLayout é o instante UTC no nome dos arquivos rotacionados:
+// {file}.{instante}[.gz].
+const rotatedLayout = "20060102T150405.000"
+
+// rotatedSuffix reconhece os arquivos rotacionados de um arquivo de log.
+var rotatedSuffix = regexp.MustCompile(`^\.\d{8}T\d{6}\.\d{3}(\.gz)?$`)
+
+// Rotation define a rotação do arquivo de log (logging.rotation).
+type Rotation struct {
+	MaxSize  int64         // rotaciona antes de passar deste tamanho; 0 = sem limite
+	MaxAge   time.Duration // rotaciona o arquivo aberto há mais que isso; 0 = sem limite
+	MaxFiles int           // arquivos rotacionados mantidos; 0 = todos
+	Compress bool          // gzip dos arquivos rotacionados
+}
+
+func (r *Rotation) enabled() bool {
+	return r != nil && (r.MaxSize > 0 || r.MaxAge > 0)
+}
+
+// processRotation é a rotação do arquivo de log do processo. Consultada a
+// cada escrita: SetRotation vale imediatamente (reload via SIGHUP).
+var processRotation atomic.Pointer[Rotation]
+
+// SetRotation define a rotação do arquivo de log do processo. Uma Rotation
+// sem MaxSize nem MaxAge desabilita a rotação.
+func SetRotation(r Rotation) {
+	processRotation.Store(&r)
+}
+
+// rotatingFile é o arquivo de log (logging.file) com rotação por tamanho e
+// idade. O arquivo rotacionado é renomeado com o instante da rotação; a
+// compressão e a remoção dos excedentes rodam em background.
+type rotatingFile struct {
+	path string
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+
+	bgMu sync.Mutex     // serializa compressão e limpeza
+	bg   sync.WaitGroup // rotações em background, aguardadas no Close
+}
+
+// openRotatingFile abre path para append.
+func openRotatingFile(path string) (*rotatingFile, error) {
+	w := &rotatingFile{path: path}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingFile) open() error {
+	f, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f, w.size, w.opened = f, info.Size(), time.Now()
+	return nil
+}
+
+func (w *rotatingFile) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if r := processRotation.Load(); r.enabled() && w.size > 0 &&
+		((r.MaxSize > 0 && w.size+int64(len(p)) > r.MaxSize) || (r.MaxAge > 0 && time.Since(w.opened) >= r.MaxAge)) {
+		if err := w.rotate(*r); err != nil {
+			// Sem rotação, o log continua no arquivo atual
+			fmt.Fprintf(os.Stderr, "WARNING: log rotation of %q failed: %v\n", w.path, err)
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate renomeia o arquivo atual e abre um novo. Chamado com mu.
+func (w *rotatingFile) rotate(r Rotation) error {
+	rotated := w.path + "." + time.Now().UTC().Format(rotatedLayout)
+	if err := os.Rename(w.path, rotated); err != nil {
+		return err
+	}
+	w.f.Close()
+	if err := w.open(); err != nil {
+		// Reabre o renomeado para não perder o log
+		f, ferr := os.OpenFile(rotated, os.O_APPEND|os.O_WRONLY, 0644)
+		if ferr != nil {
+			return fmt.Errorf("reopening log file: %w", err)
+		}
+		w.f = f
+		return fmt.Errorf("reopening log file: %w", err)
+	}
+
+	w.bg.Add(1)
+	go func() {
+		defer w.bg.Done()
+		w.bgMu.Lock()
+		defer w.bgMu.Unlock()
+		if r.Compress {
+			if err := gzipFile(rotated); err != nil {
+				fmt.Fprintf(os.Stderr, "WARNING: compressing rotated log %q failed: %v\n", rotated, err)
+			}
+		}
+		if r.MaxFiles > 0 {
+			pruneRotated(w.path, r.MaxFiles)
+		}
+	}()
+	return nil
+}
+
+func (w *rotatingFile) Close() error {
+	w.mu.Lock()
+	err := w.f.Close()
+	w.mu.Unlock()
+	w.bg.Wait()
+	return err
+}
+
+// gzipFile comprime path em path.gz e remove o original.
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// pruneRotated remove os arquivos rotacionados de path além dos keep mais recentes.
+func pruneRotated(path string, keep int) {
+	matches, _ := filepath.Glob(path + ".*")
+	var rotated []string
+	for _, m := range matches {
+		if rotatedSuffix.MatchString(m[len(path):]) {
+			rotated = append(rotated, m)
+		}
+	}
+	if len(rotated) <= keep {
+		return
+	}
+	// O instante no nome ordena cronologicamente
+	sort.Strings(rotated)
+	for _, m := range rotated[:len(rotated)-keep] {
+		os.Remove(m)
+	}
+}
@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile_SizeRotationCompressesAndPrunes(t *testing.T) {
+	SetRotation(Rotation{MaxSize: 100, MaxFiles: 2, Compress: true})
+	t.Cleanup(func() { SetRotation(Rotation{}) })
+
+	path := filepath.Join(t.TempDir(), "agent.log")
+	w, err := openRotatingFile(path)
+	if err != nil {
+		t.Fatalf("openRotatingFile: %v", err)
+	}
+	line := strings.Repeat("x", 59) + "\n"
+	for i := 0; i < 8; i++ {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		// Instantes distintos no nome dos rotacionados
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != line {
+		t.Fatalf("current file should hold only the last line, got %q (%v)", data, err)
+	}
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 2 {
+		t.Fatalf("expected 2 rotated files after pruning, got %v", rotated)
+	}
+	for _, r := range rotated {
+		if !strings.HasSuffix(r, ".gz") {
+			t.Errorf("rotated file not compressed: %s", r)
+			continue
+		}
+		f, _ := os.Open(r)
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("gzip %s: %v", r, err)
+		}
+		content, _ := io.ReadAll(gz)
+		f.Close()
+		if string(content) != line {
+			t.Errorf("unexpected content in %s: %q", r, content)
+		}
+	}
+}
+
+func TestRotatingFile_AgeRotationAndDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	w, err := openRotatingFile(path)
+	if err != nil {
+		t.Fatalf("openRotatingFile: %v", err)
+	}
+
+	// Sem rotação configurada, o arquivo só cresce
+	SetRotation(Rotation{})
+	t.Cleanup(func() { SetRotation(Rotation{}) })
+	w.Write([]byte("a\n"))
+	w.Write([]byte("b\n"))
+	if rotated, _ := filepath.Glob(path + ".*"); len(rotated) != 0 {
+		t.Fatalf("unexpected rotation without limits: %v", rotated)
+	}
+
+	SetRotation(Rotation{MaxAge: time.Hour})
+	w.mu.Lock()
+	w.opened = time.Now().Add(-2 * time.Hour)
+	w.mu.Unlock()
+	w.Write([]byte("c\n"))
+	w.Close()
+
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 1 || strings.HasSuffix(rotated[0], ".gz") {
+		t.Fatalf("expected 1 uncompressed rotated file, got %v", rotated)
+	}
+	if data, _ := os.ReadFile(rotated[0]); string(data) != "a\nb\n" {
+		t.Errorf("unexpected rotated content %q", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "c\n" {
+		t.Errorf("unexpected current content %q", data)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SampledDroppedKey é o atributo com a quantidade de registros do mesmo tipo
+// descartados pela amostragem desde o último registro emitido.
+const SampledDroppedKey = "sampled_dropped"
+
+// SampleRule limita a taxa de um tipo de registro de log, identificado pela
+// mensagem (logging.sampling.rules).
+type SampleRule struct {
+	// Message é a mensagem exata do registro, ou um prefixo terminado em "*"
+	// (ex: "chunk_*"). Cada mensagem distinta tem o seu próprio limite.
+	Message string
+	// Rate é a quantidade de registros por segundo emitidos em regime.
+	Rate float64
+	// Burst é a quantidade de registros emitidos de uma vez antes do limite
+	// (default: Rate arredondado para cima, no mínimo 1).
+	Burst int
+}
+
+func (r SampleRule) matches(msg string) bool {
+	if prefix, ok := strings.CutSuffix(r.Message, "*"); ok {
+		return strings.HasPrefix(msg, prefix)
+	}
+	return msg == r.Message
+}
+
+// Sampler aplica SampleRules com um token bucket por mensagem.
+type Sampler struct {
+	rules []SampleRule
+
+	mu      sync.Mutex
+	buckets map[string]*sampleBucket
+}
+
+type sampleBucket struct {
+	tokens  float64
+	burst   float64
+	rate    float64
+	last    time.Time
+	dropped int64
+}
+
+// NewSampler cria um Sampler para rules. Retorna nil (amostragem
+// desabilitada) se rules for vazio.
+func NewSampler(rules []SampleRule) *Sampler {
+	if len(rules) == 0 {
+		return nil
+	}
+	s := &Sampler{rules: make([]SampleRule, len(rules)), buckets: make(map[string]*sampleBucket)}
+	for i, r := range rules {
+		if r.Burst <= 0 {
+			r.Burst = max(1, int(math.Ceil(r.Rate)))
+		}
+		s.rules[i] = r
+	}
+	return s
+}
+
+// Allow decide se um registro com a mensagem msg, no instante now, é
+// emitido. A primeira regra que casa com msg se aplica; mensagens sem regra
+// são sempre emitidas. Quando emitido, dropped é a quantidade de registros
+// da mesma mensagem descartados desde o anterior. Um Sampler nil emite tudo.
+func (s *Sampler) Allow(msg string, now time.Time) (ok bool, dropped int64) {
+	if s == nil {
+		return true, 0
+	}
+	var rule *SampleRule
+	for i := range s.rules {
+		if s.rules[i].matches(msg) {
+			rule = &s.rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return true, 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, found := s.buckets[msg]
+	if !found {
+		b = &sampleBucket{tokens: float64(rule.Burst), burst: float64(rule.Burst), rate: rule.Rate, last: now}
+		s.buckets[msg] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+	if b.tokens < 1 {
+		b.dropped++
+		return false, 0
+	}
+	b.tokens--
+	dropped, b.dropped = b.dropped, 0
+	return true, dropped
+}
+
+// processSampler é o Sampler do processo, aplicado pelos loggers criados por
+// NewLogger. Ajustável em runtime via SetSampling (reload via SIGHUP).
+var processSampler atomic.Pointer[Sampler]
+
+// SetSampling define as regras de amostragem do processo (logging.sampling).
+// rules vazio desabilita a amostragem. Os limites recomeçam do burst.
+func SetSampling(rules []SampleRule) {
+	processSampler.Store(NewSampler(rules))
+}
+
+// sampleHandler é um slog.Handler que descarta os registros além do limite
+// da amostragem do processo. Fica abaixo do logger do processo: o arquivo de
+// log por sessão (NewSessionLogger) recebe todos os registros.
+type sampleHandler struct {
+	inner slog.Handler
+}
+
+// newSampleHandler envolve inner com a amostragem do processo.
+func newSampleHandler(inner slog.Handler) slog.Handler {
+	return &sampleHandler{inner: inner}
+}
+
+func (h *sampleHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *sampleHandler) Handle(ctx context.Context, r slog.Record) error {
+	ok, dropped := processSampler.Load().Allow(r.Message, r.Time)
+	if !ok {
+		return nil
+	}
+	if dropped > 0 {
+		r = r.Clone()
+		r.AddAttrs(slog.Int64(SampledDroppedKey, dropped))
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *sampleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sampleHandler{inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *sampleHandler) WithGroup(name string) slog.Handler {
+	return &sampleHandler{inner: h.inner.WithGroup(name)}
+}
@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSampler_TokenBucketPerMessage(t *testing.T) {
+	s := NewSampler([]SampleRule{{Message: "SACK sent", Rate: 1, Burst: 2}, {Message: "chunk_*", Rate: 0.5}})
+	now := time.Now()
+
+	for i, want := range []bool{true, true, false, false} {
+		if ok, _ := s.Allow("SACK sent", now); ok != want {
+			t.Errorf("SACK #%d: ok=%v, want %v", i, ok, want)
+		}
+	}
+	// Um segundo depois, um token: emite e reporta os 2 descartados
+	if ok, dropped := s.Allow("SACK sent", now.Add(time.Second)); !ok || dropped != 2 {
+		t.Errorf("after refill: ok=%v dropped=%d", ok, dropped)
+	}
+
+	// Prefixo: burst default 1, limite separado por mensagem
+	if ok, _ := s.Allow("chunk_received", now); !ok {
+		t.Error("first chunk_received dropped")
+	}
+	if ok, _ := s.Allow("chunk_received", now.Add(time.Second)); ok {
+		t.Error("chunk_received emitted before refill")
+	}
+	if ok, _ := s.Allow("chunk_buffered", now); !ok {
+		t.Error("chunk_buffered shares the chunk_received limit")
+	}
+
+	if ok, _ := s.Allow("session started", now); !ok {
+		t.Error("message without rule dropped")
+	}
+	var none *Sampler
+	if ok, _ := none.Allow("SACK sent", now); !ok || NewSampler(nil) != nil {
+		t.Error("nil sampler must emit everything")
+	}
+}
+
+func TestSampleHandler_DropsAndReportsCount(t *testing.T) {
+	SetSampling([]SampleRule{{Message: "ChunkSACK sent", Rate: 1, Burst: 1}})
+	t.Cleanup(func() { SetSampling(nil) })
+
+	var buf bytes.Buffer
+	h := newSampleHandler(slog.NewJSONHandler(&buf, nil)).WithAttrs([]slog.Attr{slog.String("session", "s1")})
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		h.Handle(context.Background(), slog.NewRecord(now, slog.LevelDebug, "ChunkSACK sent", 0))
+	}
+	h.Handle(context.Background(), slog.NewRecord(now, slog.LevelInfo, "stream stats", 0))
+	h.Handle(context.Background(), slog.NewRecord(now.Add(time.Second), slog.LevelDebug, "ChunkSACK sent", 0))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 records, got %d: %s", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[2]), &rec); err != nil {
+		t.Fatalf("decoding record: %v", err)
+	}
+	if rec[SampledDroppedKey] != float64(4) || rec["session"] != "s1" {
+		t.Errorf("unexpected record after refill: %v", rec)
+	}
+}
+
+func TestSessionLogger_NotSampled(t *testing.T) {
+	SetSampling([]SampleRule{{Message: "SACK sent", Rate: 0.001, Burst: 1}})
+	t.Cleanup(func() { SetSampling(nil) })
+
+	var global bytes.Buffer
+	base := slog.New(newSampleHandler(slog.NewJSONHandler(&global, nil)))
+	logger, closer, path, err := NewSessionLogger(base, t.TempDir(), "agent", "s1")
+	if err != nil {
+		t.Fatalf("NewSessionLogger: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		logger.Info("SACK sent")
+	}
+	closer.Close()
+
+	if n := strings.Count(global.String(), "\n"); n != 1 {
+		t.Errorf("expected 1 record in the process log, got %d", n)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading session log: %v", err)
+	}
+	if strings.Count(string(data), "\n") != 3 {
+		t.Errorf("expected 3 records in the session log, got: %s", data)
+	}
+}
@@ -82,9 +82,9 @@ func NewSessionLogger(baseLogger *slog.Logger, sessionLogDir, agentName, session
 	}
 
 	// Arquivo de sessão sempre usa JSON com nível DEBUG para captura máxima.
-	fileHandler := slog.NewJSONHandler(f, &slog.HandlerOptions{
+	fileHandler := newRedactHandler(slog.NewJSONHandler(f, &slog.HandlerOptions{
 		Level: slog.LevelDebug,
-	})
+	}))
 
 	// Fan-out: despacha para o handler do logger base + handler do arquivo.
 	combined := &fanOutHandler{
@@ -0,0 +1,287 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyslogSDID é o SD-ID do elemento de structured data (RFC 5424) com os
+// atributos de cada registro. 32473 é o enterprise number reservado para
+// exemplos e documentação (RFC 5612).
+const SyslogSDID = "nbackup@32473"
+
+const (
+	syslogDialTimeout  = 5 * time.Second
+	syslogWriteTimeout = 5 * time.Second
+	// syslogRedialDelay é o intervalo mínimo entre tentativas de reconexão:
+	// com o coletor fora do ar, os registros são descartados sem bloquear
+	// o processo a cada log.
+	syslogRedialDelay = 10 * time.Second
+)
+
+// syslogFacilities mapeia os nomes de facility para os códigos da RFC 5424.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogOptions configuram o destino syslog (logging.syslog).
+type SyslogOptions struct {
+	// Address é o coletor: "udp://host:port", "tcp://host:port" ou
+	// "tls://host:port".
+	Address string
+	// Facility é o nome da facility (default: "daemon").
+	Facility string
+	// CACert valida o certificado do coletor em tls:// (default: CAs do sistema).
+	CACert string
+}
+
+// ParseFacility converte o nome de uma facility; "" é "daemon".
+func ParseFacility(name string) (int, error) {
+	if name == "" {
+		return syslogFacilities["daemon"], nil
+	}
+	f, ok := syslogFacilities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %q", name)
+	}
+	return f, nil
+}
+
+// ParseSyslogAddress separa o protocolo ("udp", "tcp" ou "tls") e o
+// host:port de um endereço de coletor syslog.
+func ParseSyslogAddress(address string) (network, hostport string, err error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog address %q: %w", address, err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp", "tls":
+	default:
+		return "", "", fmt.Errorf("invalid syslog address %q: scheme must be udp://, tcp:// or tls://", address)
+	}
+	if _, port, err := net.SplitHostPort(u.Host); err != nil || port == "" {
+		return "", "", fmt.Errorf("invalid syslog address %q: expected %s://host:port", address, u.Scheme)
+	}
+	return u.Scheme, u.Host, nil
+}
+
+// syslogSink envia os registros em RFC 5424 para um coletor remoto. Em TCP e
+// TLS usa o framing por contagem de octetos (RFC 6587); em UDP, um datagrama
+// por registro. Uma conexão perdida é refeita no próximo registro.
+type syslogSink struct {
+	network, addr string
+	tlsConfig     *tls.Config
+	facility      int
+	hostname      string
+	appName       string
+	procID        string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	retryAt time.Time
+}
+
+// newSyslogSink valida opts e conecta ao coletor.
+func newSyslogSink(opts SyslogOptions, appName string) (*syslogSink, error) {
+	network, addr, err := ParseSyslogAddress(opts.Address)
+	if err != nil {
+		return nil, err
+	}
+	facility, err := ParseFacility(opts.Facility)
+	if err != nil {
+		return nil, err
+	}
+	s := &syslogSink{
+		network:  network,
+		addr:     addr,
+		facility: facility,
+		hostname: syslogToken(hostname(), 255),
+		appName:  syslogToken(appName, 48),
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+	if network == "tls" {
+		host, _, _ := net.SplitHostPort(addr)
+		s.tlsConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		if opts.CACert != "" {
+			pem, err := os.ReadFile(opts.CACert)
+			if err != nil {
+				return nil, fmt.Errorf("reading syslog ca_cert: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("syslog ca_cert %s: no certificates found", opts.CACert)
+			}
+			s.tlsConfig.RootCAs = pool
+		}
+	}
+	if err := s.dial(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *syslogSink) dial() error {
+	var (
+		conn net.Conn
+		err  error
+	)
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	switch s.network {
+	case "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, s.tlsConfig)
+	default:
+		conn, err = dialer.Dial(s.network, s.addr)
+	}
+	if err != nil {
+		s.retryAt = time.Now().Add(syslogRedialDelay)
+		return fmt.Errorf("connecting to syslog %s://%s: %w", s.network, s.addr, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *syslogSink) emit(r slog.Record, fields []field) error {
+	msg := s.format(r, fields)
+	if s.network != "udp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Uma reconexão por registro: em TCP, uma escrita em conexão já fechada
+	// pelo coletor só falha na segunda tentativa
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if time.Now().Before(s.retryAt) {
+				return errors.New("syslog collector unavailable")
+			}
+			if err := s.dial(); err != nil {
+				return err
+			}
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+		if _, err := s.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return fmt.Errorf("writing to syslog %s://%s failed", s.network, s.addr)
+}
+
+// format monta a mensagem RFC 5424 (sem o framing).
+func (s *syslogSink) format(r slog.Record, fields []field) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s - ",
+		s.facility*8+syslogSeverity(r.Level),
+		r.Time.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		s.hostname, s.appName, s.procID)
+	if len(fields) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[" + SyslogSDID)
+		for _, f := range fields {
+			b.WriteString(" " + syslogParamName(f.key) + `="`)
+			syslogEscapeParam(&b, f.value)
+			b.WriteString(`"`)
+		}
+		b.WriteString("]")
+	}
+	if r.Message != "" {
+		b.WriteString(" " + r.Message)
+	}
+	return b.String()
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// syslogSeverity mapeia o nível do slog para a severity da RFC 5424.
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3 // err
+	case level >= slog.LevelWarn:
+		return 4 // warning
+	case level >= slog.LevelInfo:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
+
+// syslogParamName converte uma chave em PARAM-NAME (até 32 caracteres ASCII
+// imprimíveis, exceto '=', ' ', ']' e '"').
+func syslogParamName(key string) string {
+	b := []byte(key)
+	if len(b) > 32 {
+		b = b[:32]
+	}
+	for i, c := range b {
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+// syslogEscapeParam escreve v escapando '"', '\' e ']' (RFC 5424, 6.3.3).
+func syslogEscapeParam(b *strings.Builder, v string) {
+	for _, r := range v {
+		if r == '"' || r == '\\' || r == ']' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+}
+
+// syslogToken adapta s a um campo do header (ASCII imprimível sem espaços,
+// até max caracteres); vazio vira o NILVALUE "-".
+func syslogToken(s string, max int) string {
+	b := []byte(s)
+	if len(b) > max {
+		b = b[:max]
+	}
+	for i, c := range b {
+		if c <= ' ' || c > '~' {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+func hostname() string {
+	h, _ := os.Hostname()
+	return h
+}
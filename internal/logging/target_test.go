@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTargetLogger_SyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer pc.Close()
+
+	logger, closer := NewTargetLogger("debug", "json", "", &bytes.Buffer{}, Target{
+		Kind:    TargetSyslog,
+		AppName: "nbackup-server",
+		Syslog:  SyslogOptions{Address: "udp://" + pc.LocalAddr().String(), Facility: "local3"},
+	})
+	defer closer.Close()
+	logger.With("agent", "web-01").WithGroup("stream").Warn("stream stalled", "index", 3, "note", `a"b]c`)
+
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("reading datagram: %v", err)
+	}
+	msg := string(buf[:n])
+	// local3 (19) * 8 + warning (4)
+	if !strings.HasPrefix(msg, "<156>1 ") || !strings.Contains(msg, " nbackup-server ") {
+		t.Errorf("unexpected header: %s", msg)
+	}
+	want := `[nbackup@32473 agent="web-01" stream.index="3" stream.note="a\"b\]c"] stream stalled`
+	if !strings.HasSuffix(msg, want) {
+		t.Errorf("unexpected structured data/message:\n got %s\nwant suffix %s", msg, want)
+	}
+}
+
+func TestNewTargetLogger_SyslogTCPFramingAndReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+	msgs := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			// Lê um registro (octet counting) e derruba a conexão
+			size, err := r.ReadString(' ')
+			if err == nil {
+				n, _ := strconv.Atoi(strings.TrimSpace(size))
+				b := make([]byte, n)
+				if _, err := r.Read(b); err == nil {
+					msgs <- string(b)
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	logger, closer := NewTargetLogger("info", "json", "", &bytes.Buffer{}, Target{
+		Kind:   TargetSyslog,
+		Syslog: SyslogOptions{Address: "tcp://" + ln.Addr().String()},
+	})
+	defer closer.Close()
+	logger.Info("first")
+	if got := <-msgs; !strings.HasPrefix(got, "<30>1 ") || !strings.HasSuffix(got, "- first") {
+		t.Errorf("unexpected first record: %q", got)
+	}
+
+	// O coletor fechou a conexão: o registro seguinte chega por uma nova
+	deadline := time.After(5 * time.Second)
+	for {
+		logger.Info("second")
+		select {
+		case got := <-msgs:
+			if !strings.HasSuffix(got, "- second") {
+				t.Errorf("unexpected record after reconnect: %q", got)
+			}
+			return
+		case <-deadline:
+			t.Fatal("no record after reconnect")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestNewTargetLogger_Journald(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram: %v", err)
+	}
+	defer conn.Close()
+	prev := journalSocket
+	journalSocket = sock
+	t.Cleanup(func() { journalSocket = prev })
+
+	logger, closer := NewTargetLogger("info", "json", "", &bytes.Buffer{}, Target{Kind: TargetJournald, AppName: "nbackup-agent"})
+	defer closer.Close()
+	logger.Error("backup failed", "session_id", "a1b2", "message", "dup", "error", "line1\nline2")
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("reading datagram: %v", err)
+	}
+	got := string(buf[:n])
+	for _, want := range []string{"MESSAGE=backup failed\n", "PRIORITY=3\n", "SYSLOG_IDENTIFIER=nbackup-agent\n", "SESSION_ID=a1b2\n", "NBACKUP_MESSAGE=dup\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+	// Valor com quebra de linha: formato binário
+	var bin bytes.Buffer
+	bin.WriteString("ERROR\n")
+	binary.Write(&bin, binary.LittleEndian, uint64(len("line1\nline2")))
+	bin.WriteString("line1\nline2\n")
+	if !strings.Contains(got, bin.String()) {
+		t.Errorf("multi-line field not in binary format: %q", got)
+	}
+}
+
+func TestNewTargetLogger_FallsBackToConsole(t *testing.T) {
+	prev := journalSocket
+	journalSocket = filepath.Join(t.TempDir(), "missing.sock")
+	t.Cleanup(func() { journalSocket = prev })
+
+	var console bytes.Buffer
+	logger, closer := NewTargetLogger("info", "json", "", &console, Target{Kind: TargetJournald})
+	defer closer.Close()
+	logger.Info("still logged")
+	if !strings.Contains(console.String(), `"msg":"still logged"`) {
+		t.Errorf("expected console fallback, got %q", console.String())
+	}
+}
+
+func TestParseSyslogAddress(t *testing.T) {
+	if network, addr, err := ParseSyslogAddress("tls://logs.example.com:6514"); err != nil || network != "tls" || addr != "logs.example.com:6514" {
+		t.Errorf("unexpected parse: %s %s %v", network, addr, err)
+	}
+	for _, bad := range []string{"logs.example.com:514", "http://logs:514", "udp://logs", "tcp://"} {
+		if _, _, err := ParseSyslogAddress(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
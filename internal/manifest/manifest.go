@@ -0,0 +1,180 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// Package manifest implementa o manifest de arquivos de um backup: uma linha
+// JSON por entrada do archive (caminho, tamanho, mtime, modo e SHA-256 do
+// conteúdo dos arquivos regulares), comprimida com gzip.
+//
+// O agent produz o manifest durante o stream e o envia ao fim da sessão; o
+// server o grava ao lado do archive como {archive}.files.jsonl.gz. Ele
+// permite verificar arquivos individuais e localizar um arquivo sem
+// descompactar o archive inteiro (`zcat ... | jq`).
+package manifest
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Suffix é o sufixo do manifest gravado ao lado do archive.
+const Suffix = ".files.jsonl.gz"
+
+// Tipos de entrada.
+const (
+	TypeFile     = "file"
+	TypeDir      = "dir"
+	TypeSymlink  = "symlink"
+	TypeHardlink = "hardlink"
+	TypeOther    = "other" // devices, FIFOs, sockets
+)
+
+// Entry é uma linha do manifest.
+type Entry struct {
+	Path   string    `json:"path"` // caminho no archive (relativo a /)
+	Type   string    `json:"type"`
+	Size   int64     `json:"size"`
+	MTime  time.Time `json:"mtime"`
+	Mode   string    `json:"mode"`             // permissões em octal (ex: "0644")
+	SHA256 string    `json:"sha256,omitempty"` // conteúdo dos arquivos regulares (hex)
+	Link   string    `json:"link,omitempty"`   // alvo de symlinks e hardlinks
+}
+
+// Header é a primeira linha do manifest, antes das entradas. É opcional:
+// manifests sem metadados (e os gerados antes dele) começam na primeira Entry.
+type Header struct {
+	Header         bool     `json:"header"`                    // sempre true: distingue a linha de uma Entry
+	MissingSources []string `json:"missing_sources,omitempty"` // sources opcionais (required: false) ausentes na execução
+}
+
+// Writer grava um manifest em um arquivo temporário. Add e Entries podem ser
+// chamados concorrentemente (producers do backup com producer_shards).
+type Writer struct {
+	mu      sync.Mutex
+	f       *os.File
+	gz      *gzip.Writer
+	buf     *bufio.Writer
+	enc     *json.Encoder
+	entries int64
+}
+
+// Create cria o manifest em um arquivo temporário em dir (os.TempDir() se
+// vazio). O arquivo é removido por Remove.
+func Create(dir string) (*Writer, error) {
+	f, err := os.CreateTemp(dir, "nbackup-manifest-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("creating manifest file: %w", err)
+	}
+	buf := bufio.NewWriter(f)
+	gz := gzip.NewWriter(buf)
+	return &Writer{f: f, gz: gz, buf: buf, enc: json.NewEncoder(gz)}, nil
+}
+
+// WriteHeader grava o header; deve preceder o primeiro Add.
+func (w *Writer) WriteHeader(h Header) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.entries > 0 {
+		return fmt.Errorf("writing manifest header: %d entries already written", w.entries)
+	}
+	h.Header = true
+	if err := w.enc.Encode(h); err != nil {
+		return fmt.Errorf("writing manifest header: %w", err)
+	}
+	return nil
+}
+
+// Add grava uma entrada.
+func (w *Writer) Add(e Entry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.enc.Encode(e); err != nil {
+		return fmt.Errorf("writing manifest entry: %w", err)
+	}
+	w.entries++
+	return nil
+}
+
+// Entries retorna o número de entradas gravadas.
+func (w *Writer) Entries() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.entries
+}
+
+// Finish fecha o gzip e retorna o manifest pronto para leitura, com o
+// tamanho em bytes. O arquivo continua aberto até Remove.
+func (w *Writer) Finish() (io.Reader, int64, error) {
+	if err := w.gz.Close(); err != nil {
+		return nil, 0, fmt.Errorf("closing manifest: %w", err)
+	}
+	if err := w.buf.Flush(); err != nil {
+		return nil, 0, fmt.Errorf("flushing manifest: %w", err)
+	}
+	size, err := w.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, fmt.Errorf("sizing manifest: %w", err)
+	}
+	return io.NewSectionReader(w.f, 0, size), size, nil
+}
+
+// Path retorna o caminho do arquivo temporário.
+func (w *Writer) Path() string {
+	return w.f.Name()
+}
+
+// Remove fecha e remove o arquivo temporário. Nil-safe.
+func (w *Writer) Remove() {
+	if w == nil {
+		return
+	}
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// Read decodifica um manifest (gzip) chamando fn para cada entrada. O
+// header, se houver, é ignorado.
+func Read(r io.Reader, fn func(Entry) error) error {
+	_, err := ReadWithHeader(r, fn)
+	return err
+}
+
+// ReadWithHeader é como Read, mas retorna também o header (zero se o
+// manifest não tem).
+func ReadWithHeader(r io.Reader, fn func(Entry) error) (Header, error) {
+	var h Header
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return h, fmt.Errorf("opening manifest: %w", err)
+	}
+	defer gz.Close()
+	dec := json.NewDecoder(gz)
+	for first := true; ; first = false {
+		var l struct {
+			Entry
+			Header         bool     `json:"header"`
+			MissingSources []string `json:"missing_sources"`
+		}
+		if err := dec.Decode(&l); err == io.EOF {
+			return h, nil
+		} else if err != nil {
+			return h, fmt.Errorf("decoding manifest entry: %w", err)
+		}
+		if l.Header {
+			if !first {
+				return h, fmt.Errorf("decoding manifest: header after the first entry")
+			}
+			h = Header{Header: true, MissingSources: l.MissingSources}
+			continue
+		}
+		if err := fn(l.Entry); err != nil {
+			return h, err
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package manifest
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWriter_RoundTrip(t *testing.T) {
+	w, err := Create(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := []Entry{
+		{Path: "etc", Type: TypeDir, MTime: mtime, Mode: "0755"},
+		{Path: "etc/hosts", Type: TypeFile, Size: 12, MTime: mtime, Mode: "0644", SHA256: "abc"},
+		{Path: "etc/localtime", Type: TypeSymlink, MTime: mtime, Mode: "0777", Link: "/usr/share/zoneinfo/UTC"},
+	}
+	for _, e := range want {
+		if err := w.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, size, err := w.Finish()
+	if err != nil || size == 0 || w.Entries() != 3 {
+		t.Fatalf("Finish: size=%d entries=%d err=%v", size, w.Entries(), err)
+	}
+
+	var got []Entry
+	if err := Read(r, func(e Entry) error {
+		got = append(got, e)
+		return nil
+	}); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+
+	path := w.Path()
+	w.Remove()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Remove must delete the temp file")
+	}
+}
+
+func TestWriter_HeaderRoundTrip(t *testing.T) {
+	w, err := Create(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Remove()
+	missing := []string{"/mnt/usb", "/srv/optional"}
+	if err := w.WriteHeader(Header{MissingSources: missing}); err != nil {
+		t.Fatal(err)
+	}
+	entry := Entry{Path: "etc/hosts", Type: TypeFile, Size: 12, MTime: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Mode: "0644"}
+	if err := w.Add(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteHeader(Header{}); err == nil {
+		t.Error("expected WriteHeader after Add to fail")
+	}
+	r, _, err := w.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Entries() != 1 {
+		t.Errorf("the header must not count as an entry, got %d", w.Entries())
+	}
+
+	var got []Entry
+	h, err := ReadWithHeader(r, func(e Entry) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadWithHeader: %v", err)
+	}
+	if !h.Header || len(h.MissingSources) != 2 || h.MissingSources[0] != missing[0] || h.MissingSources[1] != missing[1] {
+		t.Errorf("unexpected header %+v", h)
+	}
+	if len(got) != 1 || got[0] != entry {
+		t.Errorf("expected only %+v, got %+v", entry, got)
+	}
+
+	// Read ignora o header
+	f, err := os.Open(w.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	if err := Read(f, func(Entry) error { n++; return nil }); err != nil || n != 1 {
+		t.Errorf("Read: entries=%d err=%v", n, err)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// chatMaxRetries é o número de retries de um POST de chat após a primeira
+// tentativa (erros de rede, 429 e 5xx).
+const chatMaxRetries = 2
+
+// maxChatBody limita o corpo da mensagem de chat: o Telegram rejeita textos
+// acima de 4096 caracteres e o Slack trunca mensagens longas.
+const maxChatBody = 3500
+
+// SlackSender entrega mensagens a um canal do Slack via incoming webhook.
+type SlackSender struct {
+	cfg        config.SlackConfig
+	client     *http.Client
+	retryDelay time.Duration
+}
+
+// NewSlackSender cria um SlackSender. cfg deve ter sido validado (defaults aplicados).
+func NewSlackSender(cfg config.SlackConfig) *SlackSender {
+	return &SlackSender{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		retryDelay: webhookRetryDelay,
+	}
+}
+
+// Name implementa Sender.
+func (s *SlackSender) Name() string { return s.cfg.Name }
+
+// Send implementa Sender: o assunto em negrito e o corpo em bloco de código,
+// preservando o alinhamento dos resumos.
+func (s *SlackSender) Send(ctx context.Context, msg Message) error {
+	text := "*" + msg.Subject + "*"
+	if msg.Body != "" {
+		text += "\n```\n" + truncateChat(msg.Body) + "\n```"
+	}
+	return postChat(ctx, s.client, s.cfg.WebhookURL, map[string]string{"text": text}, s.retryDelay)
+}
+
+// TelegramSender entrega mensagens a um chat do Telegram via Bot API
+// (sendMessage).
+type TelegramSender struct {
+	cfg        config.TelegramConfig
+	client     *http.Client
+	retryDelay time.Duration
+}
+
+// NewTelegramSender cria um TelegramSender. cfg deve ter sido validado (defaults aplicados).
+func NewTelegramSender(cfg config.TelegramConfig) *TelegramSender {
+	return &TelegramSender{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		retryDelay: webhookRetryDelay,
+	}
+}
+
+// Name implementa Sender.
+func (t *TelegramSender) Name() string { return t.cfg.Name }
+
+// Send implementa Sender. O texto vai sem parse_mode: nomes de agents e
+// mensagens de erro não precisam de escape.
+func (t *TelegramSender) Send(ctx context.Context, msg Message) error {
+	text := msg.Subject
+	if msg.Body != "" {
+		text += "\n\n" + truncateChat(msg.Body)
+	}
+	payload := map[string]any{
+		"chat_id":                  t.cfg.ChatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	}
+	return postChat(ctx, t.client, t.cfg.APIURL+"/bot"+t.cfg.BotToken+"/sendMessage", payload, t.retryDelay)
+}
+
+// truncateChat corta body em maxChatBody caracteres, sem quebrar UTF-8.
+func truncateChat(body string) string {
+	if utf8.RuneCountInString(body) <= maxChatBody {
+		return body
+	}
+	runes := []rune(body)
+	return string(runes[:maxChatBody]) + "\n... (truncated)"
+}
+
+// postChat envia payload em JSON para target com até chatMaxRetries retries.
+// Os erros não incluem a URL: o webhook do Slack e a URL da Bot API contêm
+// credenciais.
+func postChat(ctx context.Context, client *http.Client, target string, payload any, retryDelay time.Duration) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshaling chat message: %w", err)
+	}
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		retryable, err := postChatOnce(ctx, client, target, body)
+		if err == nil || !retryable {
+			return err
+		}
+		if attempt == chatMaxRetries {
+			return fmt.Errorf("after %d attempts: %w", chatMaxRetries+1, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// postChatOnce faz um único POST e indica se a falha pode ser retentada.
+func postChatOnce(ctx context.Context, client *http.Client, target string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.New("invalid chat endpoint URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "nbackup-notify")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, fmt.Errorf("chat endpoint returned %s: %s", resp.Status, bytes.TrimSpace(snippet))
+}
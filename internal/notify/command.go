@@ -0,0 +1,54 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// maxCommandOutput limita a saída do comando incluída na mensagem de erro.
+const maxCommandOutput = 512
+
+// CommandSender entrega a mensagem a um comando externo (via sh -c): o corpo
+// vai no stdin e o assunto na variável de ambiente NBACKUP_SUBJECT.
+// Permite integrar com mail(1), sendmail ou scripts próprios.
+type CommandSender struct {
+	command string
+}
+
+// NewCommandSender cria um CommandSender para command.
+func NewCommandSender(command string) *CommandSender {
+	return &CommandSender{command: command}
+}
+
+// Name implementa Sender.
+func (c *CommandSender) Name() string { return "command" }
+
+// Send implementa Sender.
+func (c *CommandSender) Send(ctx context.Context, msg Message) error {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", c.command)
+	cmd.Stdin = strings.NewReader(msg.Body)
+	cmd.Env = append(os.Environ(), "NBACKUP_SUBJECT="+msg.Subject)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(out.String())
+		if len(output) > maxCommandOutput {
+			output = output[:maxCommandOutput] + "..."
+		}
+		if output != "" {
+			return fmt.Errorf("running notification command: %w: %s", err, output)
+		}
+		return fmt.Errorf("running notification command: %w", err)
+	}
+	return nil
+}
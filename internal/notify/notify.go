@@ -0,0 +1,84 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// Package notify define a interface e os canais de entrega de notificações
+// (e-mail via SMTP, comando externo, webhook, Slack e Telegram). Usado pelo
+// digest do agent e pelos alertas de eventos.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/logging"
+)
+
+// Message é uma notificação em texto plano.
+type Message struct {
+	Subject string
+	Body    string
+}
+
+// Sender entrega uma Message por um canal.
+type Sender interface {
+	// Name identifica o canal nos logs (ex: "smtp", "command", "slack[0]").
+	Name() string
+
+	// Send entrega a mensagem, respeitando o cancelamento de ctx.
+	Send(ctx context.Context, msg Message) error
+}
+
+// SendersFromConfig cria os canais configurados no bloco notifications.
+func SendersFromConfig(cfg config.NotificationsConfig) []Sender {
+	var senders []Sender
+	if cfg.SMTP.Enabled() {
+		senders = append(senders, NewSMTPSender(cfg.SMTP))
+	}
+	if cfg.Command != "" {
+		senders = append(senders, NewCommandSender(cfg.Command))
+	}
+	if cfg.Webhook.Wants(config.WebhookEventDigest) {
+		senders = append(senders, NewWebhookSender(cfg.Webhook))
+	}
+	return senders
+}
+
+// ServerSendersFor cria os canais do server que recebem event: o SMTP recebe
+// apenas o resumo de falhas e o digest; as rotas do Slack e do Telegram
+// recebem os eventos listados em events.
+func ServerSendersFor(cfg config.ServerNotificationsConfig, event string) []Sender {
+	var senders []Sender
+	if cfg.SMTP.Enabled() && (event == config.ChatEventFailures || event == config.ChatEventDigest) {
+		senders = append(senders, NewSMTPSender(cfg.SMTP))
+	}
+	for _, s := range cfg.Slack {
+		if slices.Contains(s.Events, event) {
+			senders = append(senders, NewSlackSender(s))
+		}
+	}
+	for _, t := range cfg.Telegram {
+		if slices.Contains(t.Events, event) {
+			senders = append(senders, NewTelegramSender(t))
+		}
+	}
+	return senders
+}
+
+// SendAll entrega msg em todos os canais, após a redação do processo
+// (logging.redact). Uma falha em um canal não impede os demais; os erros são
+// agregados.
+func SendAll(ctx context.Context, senders []Sender, msg Message) error {
+	msg.Subject = logging.Redact(msg.Subject)
+	msg.Body = logging.Redact(msg.Body)
+	var errs []error
+	for _, s := range senders {
+		if err := s.Send(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
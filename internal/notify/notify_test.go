@@ -0,0 +1,369 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// fakeSMTP é um servidor SMTP mínimo (sem TLS/auth) que registra o envelope e o DATA.
+type fakeSMTP struct {
+	ln   net.Listener
+	from string
+	rcpt []string
+	data string
+	done chan struct{}
+}
+
+func startFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeSMTP{ln: ln, done: make(chan struct{})}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		defer close(f.done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimSpace(line)
+			upper := strings.ToUpper(cmd)
+			switch {
+			case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+				reply("250 fake")
+			case strings.HasPrefix(upper, "MAIL FROM:"):
+				f.from = strings.Trim(cmd[len("MAIL FROM:"):], "<> ")
+				reply("250 ok")
+			case strings.HasPrefix(upper, "RCPT TO:"):
+				f.rcpt = append(f.rcpt, strings.Trim(cmd[len("RCPT TO:"):], "<> "))
+				reply("250 ok")
+			case upper == "DATA":
+				reply("354 go ahead")
+				var b strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					b.WriteString(l)
+				}
+				f.data = b.String()
+				reply("250 queued")
+			case upper == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 unsupported")
+			}
+		}
+	}()
+	return f
+}
+
+func TestSMTPSender_Send(t *testing.T) {
+	srv := startFakeSMTP(t)
+	_, port, _ := net.SplitHostPort(srv.ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	s := NewSMTPSender(config.SMTPConfig{
+		Host: "127.0.0.1",
+		Port: portNum,
+		From: "nbackup@example.com",
+		To:   []string{"ops@example.com", "admin@example.com"},
+		TLS:  "none",
+	})
+	msg := Message{Subject: "[nbackup] relatório ✓", Body: "linha 1\nlinha 2 — ok\n"}
+	if err := s.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	<-srv.done
+
+	if srv.from != "nbackup@example.com" {
+		t.Errorf("MAIL FROM = %q", srv.from)
+	}
+	if len(srv.rcpt) != 2 || srv.rcpt[1] != "admin@example.com" {
+		t.Errorf("RCPT TO = %v", srv.rcpt)
+	}
+
+	headers, body, ok := strings.Cut(srv.data, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("message without header/body separator: %q", srv.data)
+	}
+	if !strings.Contains(headers, "Subject: =?utf-8?q?") {
+		t.Errorf("expected encoded subject, headers:\n%s", headers)
+	}
+	if !strings.Contains(headers, "To: ops@example.com, admin@example.com") {
+		t.Errorf("missing To header:\n%s", headers)
+	}
+	decoded, err := readQP(body)
+	if err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if !strings.Contains(decoded, "linha 2 — ok") {
+		t.Errorf("unexpected body %q", decoded)
+	}
+}
+
+func readQP(s string) (string, error) {
+	var b strings.Builder
+	_, err := bufio.NewReader(quotedprintable.NewReader(strings.NewReader(s))).WriteTo(&b)
+	return b.String(), err
+}
+
+func TestCommandSender(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "msg.txt")
+	s := NewCommandSender(`{ echo "$NBACKUP_SUBJECT"; cat; } > ` + out)
+
+	if err := s.Send(context.Background(), Message{Subject: "assunto", Body: "corpo\n"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("reading output: %v", err)
+	}
+	if string(data) != "assunto\ncorpo\n" {
+		t.Errorf("unexpected command input %q", data)
+	}
+
+	err = NewCommandSender("echo boom >&2; exit 3").Send(context.Background(), Message{})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected error with command output, got %v", err)
+	}
+}
+
+type failingSender struct{ called *int }
+
+func (f failingSender) Name() string { return "failing" }
+func (f failingSender) Send(context.Context, Message) error {
+	*f.called++
+	return errors.New("down")
+}
+
+func TestSendAll_ContinuesAfterFailure(t *testing.T) {
+	var calls int
+	out := filepath.Join(t.TempDir(), "msg.txt")
+	senders := []Sender{failingSender{&calls}, NewCommandSender("cat > " + out)}
+
+	err := SendAll(context.Background(), senders, Message{Body: "x"})
+	if err == nil || !strings.Contains(err.Error(), "failing: down") {
+		t.Fatalf("expected aggregated error, got %v", err)
+	}
+	if _, statErr := os.Stat(out); statErr != nil {
+		t.Errorf("second sender should still run: %v", statErr)
+	}
+}
+
+func TestSendersFromConfig(t *testing.T) {
+	if got := SendersFromConfig(config.NotificationsConfig{}); len(got) != 0 {
+		t.Errorf("expected no senders, got %d", len(got))
+	}
+	got := SendersFromConfig(config.NotificationsConfig{
+		SMTP:    config.SMTPConfig{Host: "smtp.example.com"},
+		Command: "true",
+	})
+	if len(got) != 2 || got[0].Name() != "smtp" || got[1].Name() != "command" {
+		t.Errorf("unexpected senders %v", got)
+	}
+}
+
+func TestWebhookSender_SignsAndRetries(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan WebhookEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		if got, want := r.Header.Get(WebhookSignatureHeader), "sha256="+WebhookSignature([]byte("s3cret"), body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if r.Header.Get(WebhookEventHeader) != "backup_committed" {
+			t.Errorf("unexpected event header %q", r.Header.Get(WebhookEventHeader))
+		}
+		var ev WebhookEvent
+		json.Unmarshal(body, &ev)
+		received <- ev
+	}))
+	defer srv.Close()
+
+	w := NewWebhookSender(config.WebhookConfig{URLs: []string{srv.URL}, Secret: "s3cret", Timeout: 5 * time.Second, MaxRetries: 2})
+	w.retryDelay = time.Millisecond
+	err := w.Post(context.Background(), WebhookEvent{Event: "backup_committed", Source: "server", Agent: "web-01", Message: "ok"})
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected 1 retry after 503, got %d calls", calls.Load())
+	}
+	ev := <-received
+	if ev.Event != "backup_committed" || ev.Agent != "web-01" || ev.Timestamp == "" {
+		t.Errorf("unexpected payload %+v", ev)
+	}
+}
+
+func TestWebhookSender_NoRetryOnClientError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	w := NewWebhookSender(config.WebhookConfig{URLs: []string{srv.URL}, Timeout: 5 * time.Second, MaxRetries: 3})
+	w.retryDelay = time.Millisecond
+	err := w.Post(context.Background(), WebhookEvent{Event: "agent_offline"})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected 401 error, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected no retries on 4xx, got %d calls", calls.Load())
+	}
+}
+
+func TestSendersFromConfig_WebhookDigest(t *testing.T) {
+	webhook := config.WebhookConfig{URLs: []string{"https://hooks.example.com/nbackup"}, Events: []string{config.WebhookEventDigest}}
+	got := SendersFromConfig(config.NotificationsConfig{Webhook: webhook})
+	if len(got) != 1 || got[0].Name() != "webhook" {
+		t.Errorf("expected webhook sender for digest, got %v", got)
+	}
+	webhook.Events = []string{config.WebhookEventBackupFailed}
+	if got := SendersFromConfig(config.NotificationsConfig{Webhook: webhook}); len(got) != 0 {
+		t.Errorf("expected no digest sender without digest event, got %v", got)
+	}
+}
+
+func TestSlackSender_Send(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan map[string]string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer srv.Close()
+
+	s := NewSlackSender(config.SlackConfig{Name: "oncall", WebhookURL: srv.URL, Timeout: 5 * time.Second})
+	s.retryDelay = time.Millisecond
+	if err := s.Send(context.Background(), Message{Subject: "2 failures", Body: "web-01  checksum_mismatch"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected 1 retry after 429, got %d calls", calls.Load())
+	}
+	text := (<-received)["text"]
+	if !strings.HasPrefix(text, "*2 failures*\n```\n") || !strings.Contains(text, "web-01  checksum_mismatch") {
+		t.Errorf("unexpected slack text %q", text)
+	}
+	if s.Name() != "oncall" {
+		t.Errorf("unexpected name %q", s.Name())
+	}
+}
+
+func TestTelegramSender_Send(t *testing.T) {
+	received := make(chan map[string]any, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot123:secret/sendMessage" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"ok":false,"description":"Not Found"}`)
+			return
+		}
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	defer srv.Close()
+
+	cfg := config.TelegramConfig{Name: "ops", BotToken: "123:secret", ChatID: "-100200", APIURL: srv.URL, Timeout: 5 * time.Second}
+	if err := NewTelegramSender(cfg).Send(context.Background(), Message{Subject: "digest", Body: strings.Repeat("x", maxChatBody+10)}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	payload := <-received
+	text, _ := payload["text"].(string)
+	if payload["chat_id"] != "-100200" || !strings.HasPrefix(text, "digest\n\n") || !strings.HasSuffix(text, "(truncated)") {
+		t.Errorf("unexpected telegram payload %v", payload)
+	}
+
+	// Erros não podem expor o token do bot (parte da URL)
+	cfg.BotToken = "999:other"
+	err := NewTelegramSender(cfg).Send(context.Background(), Message{Subject: "x"})
+	if err == nil || !strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "999:other") {
+		t.Errorf("expected 404 without token, got %v", err)
+	}
+	cfg.APIURL = "http://127.0.0.1:1"
+	s := NewTelegramSender(cfg)
+	s.retryDelay = time.Millisecond
+	if err := s.Send(context.Background(), Message{Subject: "x"}); err == nil || strings.Contains(err.Error(), "999:other") {
+		t.Errorf("expected network error without token, got %v", err)
+	}
+}
+
+func TestServerSendersFor(t *testing.T) {
+	nc := config.ServerNotificationsConfig{
+		SMTP: config.SMTPConfig{Host: "smtp.example.com"},
+		Slack: []config.SlackConfig{
+			{Name: "oncall", WebhookURL: "https://hooks.slack.com/a", Events: []string{config.ChatEventFailures, config.WebhookEventChecksumMismatch}},
+			{Name: "backups", WebhookURL: "https://hooks.slack.com/b", Events: []string{config.ChatEventDigest}},
+		},
+		Telegram: []config.TelegramConfig{{Name: "ops", BotToken: "t", ChatID: "1", Events: []string{config.ChatEventDigest}}},
+	}
+	names := func(event string) []string {
+		var out []string
+		for _, s := range ServerSendersFor(nc, event) {
+			out = append(out, s.Name())
+		}
+		return out
+	}
+	tests := map[string][]string{
+		config.ChatEventFailures:            {"smtp", "oncall"},
+		config.ChatEventDigest:              {"smtp", "backups", "ops"},
+		config.WebhookEventChecksumMismatch: {"oncall"},
+		config.WebhookEventBackupCommitted:  nil,
+	}
+	for event, want := range tests {
+		if got := names(event); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: got %v, want %v", event, got, want)
+		}
+	}
+}
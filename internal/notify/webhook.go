@@ -0,0 +1,158 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/logging"
+)
+
+// Headers enviados em cada POST do webhook.
+const (
+	WebhookEventHeader     = "X-NBackup-Event"
+	WebhookSignatureHeader = "X-NBackup-Signature" // "sha256=<hex>" do HMAC-SHA256 do corpo com notifications.webhook.secret
+)
+
+// webhookRetryDelay é o backoff inicial entre tentativas (dobra a cada retry).
+const webhookRetryDelay = 1 * time.Second
+
+// maxWebhookResponse limita o corpo da resposta incluído na mensagem de erro.
+const maxWebhookResponse = 512
+
+// WebhookEvent é o payload JSON enviado ao webhook.
+type WebhookEvent struct {
+	Event     string `json:"event"`
+	Timestamp string `json:"timestamp"` // RFC 3339
+	Source    string `json:"source"`    // "server" ou "agent"
+	Level     string `json:"level,omitempty"`
+	Agent     string `json:"agent,omitempty"`
+	Storage   string `json:"storage,omitempty"`
+	Backup    string `json:"backup,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	Message   string `json:"message"`
+}
+
+// WebhookSender entrega eventos em JSON via POST para as URLs configuradas,
+// com retries (backoff exponencial) e assinatura HMAC-SHA256 do corpo.
+type WebhookSender struct {
+	cfg        config.WebhookConfig
+	client     *http.Client
+	retryDelay time.Duration
+}
+
+// NewWebhookSender cria um WebhookSender. cfg deve ter sido validado (defaults aplicados).
+func NewWebhookSender(cfg config.WebhookConfig) *WebhookSender {
+	return &WebhookSender{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		retryDelay: webhookRetryDelay,
+	}
+}
+
+// Name implementa Sender.
+func (w *WebhookSender) Name() string { return "webhook" }
+
+// Send implementa Sender: entrega a mensagem (digest do agent) como evento
+// digest.
+func (w *WebhookSender) Send(ctx context.Context, msg Message) error {
+	return w.Post(ctx, WebhookEvent{
+		Event:   config.WebhookEventDigest,
+		Source:  "agent",
+		Subject: msg.Subject,
+		Message: msg.Body,
+	})
+}
+
+// Post envia ev para todas as URLs, com assunto e mensagem redigidos
+// (logging.redact). Uma URL que falha após os retries não impede as demais;
+// os erros são agregados.
+func (w *WebhookSender) Post(ctx context.Context, ev WebhookEvent) error {
+	if ev.Timestamp == "" {
+		ev.Timestamp = time.Now().Format(time.RFC3339)
+	}
+	ev.Subject = logging.Redact(ev.Subject)
+	ev.Message = logging.Redact(ev.Message)
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("marshaling webhook event: %w", err)
+	}
+
+	var errs []error
+	for _, url := range w.cfg.URLs {
+		if err := w.postWithRetry(ctx, url, ev.Event, body); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// postWithRetry faz o POST com até cfg.MaxRetries retries. Erros de rede,
+// 429 e 5xx são retentados; demais 4xx falham imediatamente.
+func (w *WebhookSender) postWithRetry(ctx context.Context, url, event string, body []byte) error {
+	delay := w.retryDelay
+	var err error
+	for attempt := 0; attempt <= w.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		var retryable bool
+		if retryable, err = w.post(ctx, url, event, body); err == nil || !retryable {
+			return err
+		}
+	}
+	return fmt.Errorf("after %d attempts: %w", w.cfg.MaxRetries+1, err)
+}
+
+// post faz um único POST e indica se a falha pode ser retentada.
+func (w *WebhookSender) post(ctx context.Context, url, event string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "nbackup-webhook")
+	req.Header.Set(WebhookEventHeader, event)
+	if w.cfg.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+WebhookSignature([]byte(w.cfg.Secret), body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(snippet))
+}
+
+// WebhookSignature retorna o HMAC-SHA256 (hex) de body com secret — o valor
+// do header X-NBackup-Signature, sem o prefixo "sha256=".
+func WebhookSignature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// initTestCA grava uma CA gerada por GenerateCA em dir e a carrega.
+func initTestCA(t *testing.T, dir string) *CA {
+	t.Helper()
+	certPEM, keyPEM, err := GenerateCA("Test CA", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateCA: %v", err)
+	}
+	certPath := filepath.Join(dir, "ca.pem")
+	keyPath := filepath.Join(dir, "ca-key.pem")
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := LoadCA(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("LoadCA: %v", err)
+	}
+	return ca
+}
+
+func TestCA_IssueServerAndClientCerts(t *testing.T) {
+	ca := initTestCA(t, t.TempDir())
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	serverPEM, serverKeyPEM, err := ca.IssueServerCert([]string{"backup.example.com", "127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatalf("IssueServerCert: %v", err)
+	}
+	server, err := tls.X509KeyPair(serverPEM, serverKeyPEM)
+	if err != nil {
+		t.Fatalf("server key pair: %v", err)
+	}
+	for _, name := range []string{"backup.example.com", "127.0.0.1"} {
+		if _, err := server.Leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Errorf("server cert not valid for %s: %v", name, err)
+		}
+	}
+
+	keyPEM, csrPEM, err := NewClientCSR("web-01")
+	if err != nil {
+		t.Fatalf("NewClientCSR: %v", err)
+	}
+	clientPEM, err := ca.SignClientCSR(csrPEM, "web-01", time.Hour)
+	if err != nil {
+		t.Fatalf("SignClientCSR: %v", err)
+	}
+	client, err := tls.X509KeyPair(clientPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("client key pair: %v", err)
+	}
+	if client.Leaf.Subject.CommonName != "web-01" {
+		t.Errorf("expected CN web-01, got %q", client.Leaf.Subject.CommonName)
+	}
+	if _, err := client.Leaf.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		t.Errorf("client cert does not verify as clientAuth: %v", err)
+	}
+}
+
+func TestCA_SignClientCSR_RejectsCNMismatch(t *testing.T) {
+	ca := initTestCA(t, t.TempDir())
+
+	_, csrPEM, err := NewClientCSR("db-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.SignClientCSR(csrPEM, "web-01", time.Hour); err == nil {
+		t.Fatal("expected CN mismatch to be rejected")
+	}
+	if _, err := ca.SignClientCSR([]byte("garbage"), "web-01", time.Hour); err == nil {
+		t.Fatal("expected invalid CSR to be rejected")
+	}
+}
+
+func TestMatchFingerprint(t *testing.T) {
+	ca := initTestCA(t, t.TempDir())
+	fp := Fingerprint(ca.Cert)
+	hexPart := strings.TrimPrefix(fp, "sha256:")
+
+	var colon []string
+	for i := 0; i < len(hexPart); i += 2 {
+		colon = append(colon, hexPart[i:i+2])
+	}
+	for _, in := range []string{fp, hexPart, strings.ToUpper(strings.Join(colon, ":"))} {
+		if !MatchFingerprint(ca.Cert, in) {
+			t.Errorf("expected %q to match", in)
+		}
+	}
+	for _, in := range []string{"", "sha256:", "sha256:00" + hexPart[2:]} {
+		if MatchFingerprint(ca.Cert, in) {
+			t.Errorf("expected %q not to match", in)
+		}
+	}
+}
+
+func TestEnrollToken_SingleUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	token, err := CreateEnrollToken(path, "web-01", time.Hour)
+	if err != nil {
+		t.Fatalf("CreateEnrollToken: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), token) {
+		t.Fatal("tokens file must not contain the clear-text token")
+	}
+
+	agent, err := ConsumeEnrollToken(path, token)
+	if err != nil {
+		t.Fatalf("ConsumeEnrollToken: %v", err)
+	}
+	if agent != "web-01" {
+		t.Errorf("expected agent web-01, got %q", agent)
+	}
+	if _, err := ConsumeEnrollToken(path, token); !errors.Is(err, ErrInvalidEnrollToken) {
+		t.Fatalf("expected reused token to be rejected, got %v", err)
+	}
+}
+
+func TestEnrollToken_ExpiredAndUnknown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	expired, err := CreateEnrollToken(path, "web-01", -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := CreateEnrollToken(path, "web-02", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ConsumeEnrollToken(path, expired); !errors.Is(err, ErrInvalidEnrollToken) {
+		t.Fatalf("expected expired token to be rejected, got %v", err)
+	}
+	if _, err := ConsumeEnrollToken(path, "unknown"); !errors.Is(err, ErrInvalidEnrollToken) {
+		t.Fatalf("expected unknown token to be rejected, got %v", err)
+	}
+	if agent, err := ConsumeEnrollToken(path, valid); err != nil || agent != "web-02" {
+		t.Fatalf("expected valid token for web-02, got %q, %v", agent, err)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// CRLChecker mantém uma CRL (Certificate Revocation List) carregada do disco e
+// a recarrega quando o arquivo muda, com a mesma estratégia do CertReloader
+// (stat sob demanda, no máximo a cada checkInterval). A assinatura da CRL é
+// validada contra as CAs de caPath; uma CRL nova inválida é ignorada e a
+// anterior continua valendo.
+type CRLChecker struct {
+	crlPath, caPath string
+	checkInterval   time.Duration
+	logger          *slog.Logger
+
+	mu        sync.RWMutex
+	revoked   map[string]struct{} // RawIssuer + serial
+	stamp     fileStamp
+	lastCheck time.Time
+}
+
+// NewCRLChecker carrega a CRL inicial. Erros de carga inicial são retornados.
+func NewCRLChecker(crlPath, caPath string, logger *slog.Logger) (*CRLChecker, error) {
+	c := &CRLChecker{
+		crlPath:       crlPath,
+		caPath:        caPath,
+		checkInterval: DefaultReloadCheckInterval,
+		logger:        logger,
+	}
+	fi, err := os.Stat(crlPath)
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: %w", crlPath, err)
+	}
+	if err := c.load(fileStamp{modTime: fi.ModTime(), size: fi.Size()}); err != nil {
+		return nil, err
+	}
+	c.lastCheck = time.Now()
+	return c, nil
+}
+
+// IsRevoked retorna true se o certificado consta na CRL vigente.
+func (c *CRLChecker) IsRevoked(cert *x509.Certificate) bool {
+	c.maybeCheck()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, revoked := c.revoked[revocationKey(cert.RawIssuer, cert.SerialNumber.String())]
+	return revoked
+}
+
+// Count retorna o número de certificados revogados na CRL vigente.
+func (c *CRLChecker) Count() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.revoked)
+}
+
+// Check verifica imediatamente se o arquivo mudou e recarrega se necessário.
+func (c *CRLChecker) Check() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.checkLocked()
+}
+
+func (c *CRLChecker) maybeCheck() {
+	c.mu.RLock()
+	due := time.Since(c.lastCheck) >= c.checkInterval
+	c.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.lastCheck) < c.checkInterval {
+		return
+	}
+	c.checkLocked()
+}
+
+// checkLocked deve ser chamado com c.mu held (escrita).
+func (c *CRLChecker) checkLocked() (bool, error) {
+	c.lastCheck = time.Now()
+
+	fi, err := os.Stat(c.crlPath)
+	if err != nil {
+		c.logger.Warn("crl check failed, keeping current crl", "error", err)
+		return false, err
+	}
+	stamp := fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+	if stamp == c.stamp {
+		return false, nil
+	}
+	if err := c.load(stamp); err != nil {
+		c.stamp = stamp
+		c.logger.Warn("crl reload failed, keeping current crl", "error", err)
+		return false, err
+	}
+	c.logger.Info("crl reloaded", "path", c.crlPath, "revoked", len(c.revoked))
+	return true, nil
+}
+
+// load lê e valida a CRL. Deve ser chamado com c.mu held (escrita) ou antes
+// do checker ser publicado.
+func (c *CRLChecker) load(stamp fileStamp) error {
+	data, err := os.ReadFile(c.crlPath)
+	if err != nil {
+		return fmt.Errorf("reading crl: %w", err)
+	}
+	// Aceita PEM ("X509 CRL") ou DER
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "X509 CRL" {
+			return fmt.Errorf("parsing crl %s: unexpected PEM block %q", c.crlPath, block.Type)
+		}
+		data = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return fmt.Errorf("parsing crl %s: %w", c.crlPath, err)
+	}
+
+	cas, err := loadCertificates(c.caPath)
+	if err != nil {
+		return err
+	}
+	var sigErr error = errors.New("no CA in ca_cert issued this crl")
+	for _, ca := range cas {
+		if sigErr = crl.CheckSignatureFrom(ca); sigErr == nil {
+			break
+		}
+	}
+	if sigErr != nil {
+		return fmt.Errorf("verifying crl signature: %w", sigErr)
+	}
+
+	revoked := make(map[string]struct{}, len(crl.RevokedCertificateEntries))
+	for _, e := range crl.RevokedCertificateEntries {
+		revoked[revocationKey(crl.RawIssuer, e.SerialNumber.String())] = struct{}{}
+	}
+	if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+		c.logger.Warn("crl is past its next update, publish a new one", "path", c.crlPath, "next_update", crl.NextUpdate.Format(time.RFC3339))
+	}
+
+	c.revoked = revoked
+	c.stamp = stamp
+	return nil
+}
+
+func revocationKey(rawIssuer []byte, serial string) string {
+	return string(rawIssuer) + "|" + serial
+}
+
+// loadCertificates lê todos os certificados de um arquivo PEM (bundle).
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA certificate: %w", err)
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing CA certificate %s: %w", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return certs, nil
+}
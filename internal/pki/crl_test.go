@@ -0,0 +1,102 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package pki
+
+import (
+	"crypto/x509"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issueTestClient emite um certificado de client assinado pela CA.
+func issueTestClient(t *testing.T, ca *CA, cn string) *x509.Certificate {
+	t.Helper()
+	_, csrPEM, err := NewClientCSR(cn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := ca.SignClientCSR(csrPEM, cn, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := parseCertPEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCRLChecker_RevokesAndReloads(t *testing.T) {
+	dir := t.TempDir()
+	ca := initTestCA(t, dir)
+	web01 := issueTestClient(t, ca, "web-01")
+	web02 := issueTestClient(t, ca, "web-02")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	crlPath := filepath.Join(dir, "crl.pem")
+	crl, err := ca.CreateCRL(nil, []*big.Int{web01.SerialNumber}, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateCRL: %v", err)
+	}
+	os.WriteFile(crlPath, crl, 0644)
+
+	checker, err := NewCRLChecker(crlPath, filepath.Join(dir, "ca.pem"), logger)
+	if err != nil {
+		t.Fatalf("NewCRLChecker: %v", err)
+	}
+	if !checker.IsRevoked(web01) || checker.IsRevoked(web02) {
+		t.Fatal("expected only web-01 to be revoked")
+	}
+
+	// Nova CRL acumula as revogações anteriores.
+	crl, err = ca.CreateCRL(crl, []*big.Int{web02.SerialNumber, web01.SerialNumber}, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateCRL (append): %v", err)
+	}
+	os.WriteFile(crlPath, crl, 0644)
+	os.Chtimes(crlPath, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if reloaded, err := checker.Check(); !reloaded || err != nil {
+		t.Fatalf("expected reload, got %v (%v)", reloaded, err)
+	}
+	if !checker.IsRevoked(web01) || !checker.IsRevoked(web02) || checker.Count() != 2 {
+		t.Fatalf("expected web-01 and web-02 revoked, count=%d", checker.Count())
+	}
+}
+
+func TestCRLChecker_InvalidCRLKeepsCurrent(t *testing.T) {
+	dir := t.TempDir()
+	ca := initTestCA(t, dir)
+	web01 := issueTestClient(t, ca, "web-01")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	crlPath := filepath.Join(dir, "crl.pem")
+	crl, _ := ca.CreateCRL(nil, []*big.Int{web01.SerialNumber}, time.Hour)
+	os.WriteFile(crlPath, crl, 0644)
+	checker, err := NewCRLChecker(crlPath, filepath.Join(dir, "ca.pem"), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CRL assinada por outra CA é recusada; a anterior continua valendo.
+	other := initTestCA(t, t.TempDir())
+	forged, _ := other.CreateCRL(nil, nil, time.Hour)
+	os.WriteFile(crlPath, forged, 0644)
+	os.Chtimes(crlPath, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if _, err := checker.Check(); err == nil {
+		t.Fatal("expected CRL signed by another CA to be rejected")
+	}
+	if !checker.IsRevoked(web01) {
+		t.Fatal("expected previous CRL to remain active")
+	}
+
+	if _, err := ca.CreateCRL(forged, nil, time.Hour); err == nil {
+		t.Fatal("expected CreateCRL to refuse a previous CRL from another CA")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultEnrollPort é a porta default do listener de enrollment do server.
+const DefaultEnrollPort = "9849"
+
+// EnrollRequest é enviado pelo agent (JSON, uma mensagem por conexão TLS).
+type EnrollRequest struct {
+	Token string `json:"token"`
+	CSR   string `json:"csr"` // PEM "CERTIFICATE REQUEST"
+}
+
+// EnrollResponse é a resposta do server. Error vazio indica sucesso.
+type EnrollResponse struct {
+	Certificate string `json:"certificate,omitempty"` // PEM do certificado de client emitido
+	CA          string `json:"ca,omitempty"`          // PEM da CA (para validar o server e gravar tls.ca_cert)
+	Error       string `json:"error,omitempty"`
+}
+
+// PinnedCAConfig retorna uma configuração TLS de client para o primeiro
+// contato com o server, quando o agent ainda não possui a CA: o server deve
+// apresentar a CA na cadeia e o fingerprint dela precisa coincidir com
+// fingerprint ("sha256:<hex>", obtido com `nbackup-server pki token`).
+// O certificado do server é então validado contra essa CA.
+func PinnedCAConfig(serverName, fingerprint string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		ServerName: serverName,
+		// A validação padrão é substituída por VerifyConnection (CA fixada).
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			var ca *x509.Certificate
+			for _, c := range cs.PeerCertificates {
+				if MatchFingerprint(c, fingerprint) {
+					ca = c
+					break
+				}
+			}
+			if ca == nil {
+				return errors.New("server did not present a CA matching the pinned fingerprint")
+			}
+			pool := x509.NewCertPool()
+			pool.AddCert(ca)
+			_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+				DNSName: serverName,
+				Roots:   pool,
+			})
+			if err != nil {
+				return fmt.Errorf("verifying server certificate against pinned CA: %w", err)
+			}
+			return nil
+		},
+	}
+}
+
+// MatchFingerprint compara o certificado com um fingerprint SHA-256. Aceita o
+// formato de Fingerprint ("sha256:<hex>"), hex puro e hex separado por ":".
+func MatchFingerprint(cert *x509.Certificate, fingerprint string) bool {
+	normalize := func(s string) string {
+		s = strings.ToLower(strings.TrimSpace(s))
+		s = strings.TrimPrefix(s, "sha256:")
+		return strings.ReplaceAll(s, ":", "")
+	}
+	want := normalize(fingerprint)
+	return want != "" && normalize(Fingerprint(cert)) == want
+}
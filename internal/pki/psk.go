@@ -0,0 +1,206 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package pki
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PSKMinKeyLength é o tamanho mínimo (em bytes) de uma pre-shared key.
+// Gere com `openssl rand -hex 32`.
+const PSKMinKeyLength = 32
+
+// pskExporterLabel é o label do TLS exporter (RFC 8446 §7.5) usado como
+// channel binding: o HMAC fica amarrado à sessão TLS em que foi calculado e
+// não pode ser repassado para outra conexão.
+const pskExporterLabel = "EXPORTER-nbackup-psk"
+
+// pskMACContext separa o HMAC do PSK de outros usos da mesma chave.
+const pskMACContext = "nbackup-psk-v1"
+
+// PSKChannelBinding deriva 32 bytes da sessão TLS para o HMAC do PSK.
+func PSKChannelBinding(state tls.ConnectionState) ([]byte, error) {
+	binding, err := state.ExportKeyingMaterial(pskExporterLabel, nil, 32)
+	if err != nil {
+		return nil, fmt.Errorf("exporting tls keying material: %w", err)
+	}
+	return binding, nil
+}
+
+// PSKMAC calcula HMAC-SHA256(key, contexto || nonce || agent || binding).
+func PSKMAC(key, nonce []byte, agent string, binding []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(pskMACContext))
+	mac.Write(nonce)
+	mac.Write([]byte{byte(len(agent))})
+	mac.Write([]byte(agent))
+	mac.Write(binding)
+	return mac.Sum(nil)
+}
+
+// LoadPSK lê a pre-shared key do agent (conteúdo do arquivo, sem espaços nas
+// bordas).
+func LoadPSK(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading psk file: %w", err)
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) < PSKMinKeyLength {
+		return nil, fmt.Errorf("psk in %s too short: %d bytes, minimum %d", path, len(key), PSKMinKeyLength)
+	}
+	return key, nil
+}
+
+// PSKKeyring mantém as pre-shared keys dos agents carregadas do disco e as
+// recarrega quando o arquivo muda, com a mesma estratégia do CRLChecker
+// (stat sob demanda, no máximo a cada checkInterval). Um arquivo novo inválido
+// é ignorado e as chaves anteriores continuam valendo.
+//
+// Formato: uma linha `nome-do-agent:chave` por agent; linhas vazias e
+// iniciadas por '#' são ignoradas.
+type PSKKeyring struct {
+	path          string
+	checkInterval time.Duration
+	logger        *slog.Logger
+
+	mu        sync.RWMutex
+	keys      map[string][]byte
+	stamp     fileStamp
+	lastCheck time.Time
+}
+
+// NewPSKKeyring carrega o keyring inicial. Erros de carga inicial são retornados.
+func NewPSKKeyring(path string, logger *slog.Logger) (*PSKKeyring, error) {
+	k := &PSKKeyring{
+		path:          path,
+		checkInterval: DefaultReloadCheckInterval,
+		logger:        logger,
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: %w", path, err)
+	}
+	if err := k.load(fileStamp{modTime: fi.ModTime(), size: fi.Size()}); err != nil {
+		return nil, err
+	}
+	k.lastCheck = time.Now()
+	return k, nil
+}
+
+// Key retorna a chave do agent e se ele consta no keyring vigente.
+func (k *PSKKeyring) Key(agent string) ([]byte, bool) {
+	k.maybeCheck()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[agent]
+	return key, ok
+}
+
+// Count retorna o número de agents no keyring vigente.
+func (k *PSKKeyring) Count() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.keys)
+}
+
+// Check verifica imediatamente se o arquivo mudou e recarrega se necessário.
+func (k *PSKKeyring) Check() (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.checkLocked()
+}
+
+func (k *PSKKeyring) maybeCheck() {
+	k.mu.RLock()
+	due := time.Since(k.lastCheck) >= k.checkInterval
+	k.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if time.Since(k.lastCheck) < k.checkInterval {
+		return
+	}
+	k.checkLocked()
+}
+
+// checkLocked deve ser chamado com k.mu held (escrita).
+func (k *PSKKeyring) checkLocked() (bool, error) {
+	k.lastCheck = time.Now()
+
+	fi, err := os.Stat(k.path)
+	if err != nil {
+		k.logger.Warn("psk keyring check failed, keeping current keys", "error", err)
+		return false, err
+	}
+	stamp := fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+	if stamp == k.stamp {
+		return false, nil
+	}
+	if err := k.load(stamp); err != nil {
+		k.stamp = stamp
+		k.logger.Warn("psk keyring reload failed, keeping current keys", "error", err)
+		return false, err
+	}
+	k.logger.Info("psk keyring reloaded", "path", k.path, "agents", len(k.keys))
+	return true, nil
+}
+
+// load lê e valida o keyring. Deve ser chamado com k.mu held (escrita) ou
+// antes do keyring ser publicado.
+func (k *PSKKeyring) load(stamp fileStamp) error {
+	f, err := os.Open(k.path)
+	if err != nil {
+		return fmt.Errorf("reading psk keyring: %w", err)
+	}
+	defer f.Close()
+
+	keys := make(map[string][]byte)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		agent, key, ok := strings.Cut(line, ":")
+		agent, key = strings.TrimSpace(agent), strings.TrimSpace(key)
+		if !ok || agent == "" {
+			return fmt.Errorf("%s:%d: expected \"agent:key\"", k.path, lineNo)
+		}
+		if len(agent) > 255 {
+			return fmt.Errorf("%s:%d: agent name too long", k.path, lineNo)
+		}
+		if len(key) < PSKMinKeyLength {
+			return fmt.Errorf("%s:%d: key for %q too short: %d bytes, minimum %d", k.path, lineNo, agent, len(key), PSKMinKeyLength)
+		}
+		if _, dup := keys[agent]; dup {
+			return fmt.Errorf("%s:%d: duplicate agent %q", k.path, lineNo, agent)
+		}
+		keys[agent] = []byte(key)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading psk keyring: %w", err)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("psk keyring %s has no agents", k.path)
+	}
+
+	k.keys = keys
+	k.stamp = stamp
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package pki
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPSKKey = "0123456789abcdef0123456789abcdef"
+
+func TestPSKKeyring_LoadsAndReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "psk")
+	os.WriteFile(path, []byte("# comentário\n\nweb-01:"+testPSKKey+"\n db-01 : "+testPSKKey+"-db\n"), 0600)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	k, err := NewPSKKeyring(path, logger)
+	if err != nil {
+		t.Fatalf("NewPSKKeyring: %v", err)
+	}
+	if k.Count() != 2 {
+		t.Fatalf("expected 2 agents, got %d", k.Count())
+	}
+	if key, ok := k.Key("db-01"); !ok || string(key) != testPSKKey+"-db" {
+		t.Fatalf("expected trimmed db-01 key, got %q ok=%v", key, ok)
+	}
+
+	// Arquivo inválido mantém as chaves atuais
+	os.WriteFile(path, []byte("web-01:short\n"), 0600)
+	os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if _, err := k.Check(); err == nil {
+		t.Fatal("expected error for short key")
+	}
+	if _, ok := k.Key("db-01"); !ok {
+		t.Fatal("expected previous keys kept after invalid reload")
+	}
+
+	os.WriteFile(path, []byte("app-01:"+testPSKKey+"\n"), 0600)
+	os.Chtimes(path, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute))
+	if changed, err := k.Check(); !changed || err != nil {
+		t.Fatalf("expected reload, got changed=%v err=%v", changed, err)
+	}
+	if _, ok := k.Key("db-01"); ok {
+		t.Error("expected db-01 removed after reload")
+	}
+	if _, ok := k.Key("app-01"); !ok {
+		t.Error("expected app-01 after reload")
+	}
+}
+
+func TestPSKKeyring_InvalidFiles(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for name, content := range map[string]string{
+		"empty":     "# nada\n",
+		"no colon":  "web-01 " + testPSKKey + "\n",
+		"no agent":  ":" + testPSKKey + "\n",
+		"duplicate": "web-01:" + testPSKKey + "\nweb-01:" + testPSKKey + "\n",
+		"long name": strings.Repeat("a", 256) + ":" + testPSKKey + "\n",
+	} {
+		path := filepath.Join(t.TempDir(), "psk")
+		os.WriteFile(path, []byte(content), 0600)
+		if _, err := NewPSKKeyring(path, logger); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadPSK(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.psk")
+	os.WriteFile(path, []byte(testPSKKey+"\n"), 0600)
+	key, err := LoadPSK(path)
+	if err != nil || string(key) != testPSKKey {
+		t.Fatalf("LoadPSK: key=%q err=%v", key, err)
+	}
+
+	os.WriteFile(path, []byte("short\n"), 0600)
+	if _, err := LoadPSK(path); err == nil {
+		t.Fatal("expected error for short psk")
+	}
+}
+
+func TestPSKMAC_BindsAllInputs(t *testing.T) {
+	key := []byte(testPSKKey)
+	nonce := bytes.Repeat([]byte{1}, 32)
+	binding := bytes.Repeat([]byte{2}, 32)
+	base := PSKMAC(key, nonce, "web-01", binding)
+
+	if !bytes.Equal(base, PSKMAC(key, nonce, "web-01", binding)) {
+		t.Fatal("expected deterministic mac")
+	}
+	for name, mac := range map[string][]byte{
+		"key":     PSKMAC([]byte(testPSKKey+"x"), nonce, "web-01", binding),
+		"nonce":   PSKMAC(key, bytes.Repeat([]byte{3}, 32), "web-01", binding),
+		"agent":   PSKMAC(key, nonce, "web-02", binding),
+		"binding": PSKMAC(key, nonce, "web-01", bytes.Repeat([]byte{4}, 32)),
+	} {
+		if bytes.Equal(base, mac) {
+			t.Errorf("expected mac to change with %s", name)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultReloadCheckInterval é o intervalo mínimo entre verificações (stat)
+// dos arquivos de certificado. A verificação ocorre sob demanda, no momento
+// de um handshake, portanto não há goroutine de polling.
+const DefaultReloadCheckInterval = 10 * time.Second
+
+// fileStamp identifica a versão de um arquivo no disco (mtime + tamanho).
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// CertReloader mantém o certificado, a chave e a CA carregados do disco e os
+// recarrega quando os arquivos mudam, sem reiniciar o processo. Conexões já
+// estabelecidas não são afetadas; novos handshakes usam o material atual.
+//
+// Se os novos arquivos forem inválidos (ex: cert e key de pares diferentes
+// durante uma rotação não atômica), o material anterior é mantido e a carga é
+// retentada quando algum dos arquivos mudar novamente.
+type CertReloader struct {
+	caPath, certPath, keyPath string
+	checkInterval             time.Duration
+	logger                    *slog.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	caPool    *x509.CertPool
+	serverCfg *tls.Config
+	stamps    [3]fileStamp
+	lastCheck time.Time
+
+	// verifyPeer é aplicado como VerifyPeerCertificate na config de server.
+	verifyPeer func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+}
+
+// NewCertReloader carrega os arquivos iniciais. Erros de carga inicial são
+// retornados (o processo não deve subir com TLS inválido).
+func NewCertReloader(caPath, certPath, keyPath string, logger *slog.Logger) (*CertReloader, error) {
+	r := &CertReloader{
+		caPath:        caPath,
+		certPath:      certPath,
+		keyPath:       keyPath,
+		checkInterval: DefaultReloadCheckInterval,
+		logger:        logger,
+	}
+	stamps, _ := r.statFiles()
+	if err := r.load(stamps); err != nil {
+		return nil, err
+	}
+	r.lastCheck = time.Now()
+	return r, nil
+}
+
+// Check verifica imediatamente se os arquivos mudaram e recarrega se necessário.
+// Retorna true se um novo certificado foi carregado. Em caso de erro o
+// material anterior continua em uso.
+func (r *CertReloader) Check() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.checkLocked()
+}
+
+// maybeCheck executa Check no máximo uma vez por checkInterval.
+func (r *CertReloader) maybeCheck() {
+	r.mu.RLock()
+	due := time.Since(r.lastCheck) >= r.checkInterval
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.lastCheck) < r.checkInterval {
+		return // outro handshake verificou enquanto aguardávamos o lock
+	}
+	r.checkLocked()
+}
+
+// checkLocked deve ser chamado com r.mu held (escrita).
+func (r *CertReloader) checkLocked() (bool, error) {
+	r.lastCheck = time.Now()
+
+	stamps, err := r.statFiles()
+	if err != nil {
+		r.logger.Warn("tls certificate check failed, keeping current certificate", "error", err)
+		return false, err
+	}
+	if stamps == r.stamps {
+		return false, nil
+	}
+
+	if err := r.load(stamps); err != nil {
+		// Registra os stamps mesmo na falha: só retenta quando algum arquivo mudar de novo.
+		r.stamps = stamps
+		r.logger.Warn("tls certificate reload failed, keeping current certificate", "error", err)
+		return false, err
+	}
+
+	attrs := []any{"cert", r.certPath}
+	if leaf := r.cert.Leaf; leaf != nil {
+		attrs = append(attrs, "subject", leaf.Subject.CommonName, "not_after", leaf.NotAfter.Format(time.RFC3339))
+	}
+	r.logger.Info("tls certificates reloaded", attrs...)
+	return true, nil
+}
+
+// load lê cert, key e CA e substitui o material atual. Deve ser chamado com
+// r.mu held (escrita) ou antes do reloader ser publicado.
+func (r *CertReloader) load(stamps [3]fileStamp) error {
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+	caPool, err := loadCACertPool(r.caPath)
+	if err != nil {
+		return err
+	}
+
+	r.cert = &cert
+	r.caPool = caPool
+	r.serverCfg = &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+
+		VerifyPeerCertificate: r.verifyPeer,
+	}
+	r.stamps = stamps
+	return nil
+}
+
+// SetVerifyPeerCertificate instala uma verificação adicional do certificado do
+// client (ex: CRL), executada após a validação da cadeia em cada handshake.
+// Vale também para o material recarregado em rotações.
+func (r *CertReloader) SetVerifyPeerCertificate(fn func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.verifyPeer = fn
+	if r.serverCfg != nil {
+		cfg := r.serverCfg.Clone()
+		cfg.VerifyPeerCertificate = fn
+		r.serverCfg = cfg
+	}
+}
+
+func (r *CertReloader) statFiles() ([3]fileStamp, error) {
+	var stamps [3]fileStamp
+	for i, p := range []string{r.caPath, r.certPath, r.keyPath} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return stamps, fmt.Errorf("stat %s: %w", p, err)
+		}
+		stamps[i] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+	}
+	return stamps, nil
+}
+
+// ServerTLSConfig retorna uma configuração TLS 1.3 com mTLS obrigatório cujo
+// certificado e CA de clients são resolvidos a cada handshake
+// (GetConfigForClient), refletindo rotações sem reiniciar o listener.
+func (r *CertReloader) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.maybeCheck()
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.serverCfg, nil
+		},
+	}
+}
+
+// ClientTLSConfig retorna uma nova configuração TLS 1.3 de client (mTLS).
+// O certificado do client é resolvido a cada handshake (GetClientCertificate),
+// inclusive em reconexões de streams durante um backup longo. A CA usada para
+// validar o server é a vigente no momento da chamada.
+func (r *CertReloader) ClientTLSConfig() *tls.Config {
+	r.maybeCheck()
+	r.mu.RLock()
+	caPool := r.caPool
+	r.mu.RUnlock()
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		RootCAs:    caPool,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			r.maybeCheck()
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.cert, nil
+		},
+	}
+}
+
+// Certificate retorna o certificado vigente (verificando rotação no disco).
+func (r *CertReloader) Certificate() *tls.Certificate {
+	r.maybeCheck()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package pki
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// copyFile copia src para dst e avança o mtime, garantindo que o reloader detecte a mudança.
+func copyFile(t *testing.T, src, dst string, mtime time.Time) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("reading %s: %v", src, err)
+	}
+	if err := os.WriteFile(dst, data, 0600); err != nil {
+		t.Fatalf("writing %s: %v", dst, err)
+	}
+	if err := os.Chtimes(dst, mtime, mtime); err != nil {
+		t.Fatalf("chtimes %s: %v", dst, err)
+	}
+}
+
+// installServerPKI copia CA, cert e key do server de p para dir.
+func installServerPKI(t *testing.T, p *testPKI, dir string, mtime time.Time) (ca, cert, key string) {
+	t.Helper()
+	ca, cert, key = filepath.Join(dir, "ca.pem"), filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+	copyFile(t, p.CACertPath, ca, mtime)
+	copyFile(t, p.ServerCertPath, cert, mtime)
+	copyFile(t, p.ServerKeyPath, key, mtime)
+	return ca, cert, key
+}
+
+// handshakeServerCert conecta ao listener com clientCfg e retorna o certificado apresentado pelo server.
+func handshakeServerCert(t *testing.T, ln net.Listener, clientCfg *tls.Config) ([]byte, error) {
+	t.Helper()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+		io.Copy(io.Discard, conn)
+	}()
+
+	clientCfg.ServerName = "localhost"
+	conn, err := tls.Dial("tcp", ln.Addr().String(), clientCfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// Em TLS 1.3 a falha de verificação do client cert aparece no primeiro read.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != nil && !isTimeout(err) {
+		return nil, err
+	}
+	return conn.ConnectionState().PeerCertificates[0].Raw, nil
+}
+
+func pemDER(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("no PEM block in %s", path)
+	}
+	return block.Bytes
+}
+
+func TestCertReloader_ServerRotation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	oldPKI, newPKI := generateTestPKI(t), generateTestPKI(t)
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+
+	ca, cert, key := installServerPKI(t, oldPKI, dir, base)
+	r, err := NewCertReloader(ca, cert, key, logger)
+	if err != nil {
+		t.Fatalf("NewCertReloader: %v", err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", r.ServerTLSConfig())
+	if err != nil {
+		t.Fatalf("TLS listen: %v", err)
+	}
+	defer ln.Close()
+
+	oldClient, err := NewClientTLSConfig(oldPKI.CACertPath, oldPKI.ClientCertPath, oldPKI.ClientKeyPath)
+	if err != nil {
+		t.Fatalf("NewClientTLSConfig: %v", err)
+	}
+	got, err := handshakeServerCert(t, ln, oldClient)
+	if err != nil {
+		t.Fatalf("handshake before rotation: %v", err)
+	}
+	if !bytes.Equal(got, pemDER(t, oldPKI.ServerCertPath)) {
+		t.Fatal("expected old server certificate before rotation")
+	}
+
+	// Rotação: nova CA, novo cert e nova key no mesmo path.
+	installServerPKI(t, newPKI, dir, base.Add(time.Minute))
+	changed, err := r.Check()
+	if err != nil || !changed {
+		t.Fatalf("Check after rotation: changed=%v err=%v", changed, err)
+	}
+
+	newClient, err := NewClientTLSConfig(newPKI.CACertPath, newPKI.ClientCertPath, newPKI.ClientKeyPath)
+	if err != nil {
+		t.Fatalf("NewClientTLSConfig: %v", err)
+	}
+	got, err = handshakeServerCert(t, ln, newClient)
+	if err != nil {
+		t.Fatalf("handshake after rotation: %v", err)
+	}
+	if !bytes.Equal(got, pemDER(t, newPKI.ServerCertPath)) {
+		t.Fatal("expected new server certificate after rotation")
+	}
+
+	oldClient, _ = NewClientTLSConfig(oldPKI.CACertPath, oldPKI.ClientCertPath, oldPKI.ClientKeyPath)
+	if _, err := handshakeServerCert(t, ln, oldClient); err == nil {
+		t.Fatal("expected handshake with old PKI to fail after rotation")
+	}
+}
+
+func TestCertReloader_InvalidFilesKeepCurrent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	p := generateTestPKI(t)
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+
+	ca, cert, key := installServerPKI(t, p, dir, base)
+	r, err := NewCertReloader(ca, cert, key, logger)
+	if err != nil {
+		t.Fatalf("NewCertReloader: %v", err)
+	}
+
+	if changed, err := r.Check(); changed || err != nil {
+		t.Fatalf("Check without changes: changed=%v err=%v", changed, err)
+	}
+
+	// Cert reescrito sem a key correspondente (rotação não atômica).
+	other := generateTestPKI(t)
+	copyFile(t, other.ServerCertPath, cert, base.Add(time.Minute))
+	if changed, err := r.Check(); changed || err == nil {
+		t.Fatalf("expected reload failure for mismatched key, changed=%v err=%v", changed, err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", r.ServerTLSConfig())
+	if err != nil {
+		t.Fatalf("TLS listen: %v", err)
+	}
+	defer ln.Close()
+
+	clientCfg, _ := NewClientTLSConfig(p.CACertPath, p.ClientCertPath, p.ClientKeyPath)
+	got, err := handshakeServerCert(t, ln, clientCfg)
+	if err != nil {
+		t.Fatalf("handshake with previous certificate: %v", err)
+	}
+	if !bytes.Equal(got, pemDER(t, p.ServerCertPath)) {
+		t.Fatal("expected previous server certificate to remain in use")
+	}
+
+	// Completa a rotação com a key correspondente.
+	copyFile(t, other.ServerKeyPath, key, base.Add(2*time.Minute))
+	copyFile(t, other.CACertPath, ca, base.Add(2*time.Minute))
+	if changed, err := r.Check(); !changed || err != nil {
+		t.Fatalf("expected reload after key rotation, changed=%v err=%v", changed, err)
+	}
+}
+
+func TestCertReloader_ClientCertificateRotation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	p := generateTestPKI(t)
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+
+	ca, cert, key := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	copyFile(t, p.CACertPath, ca, base)
+	copyFile(t, p.ClientCertPath, cert, base)
+	copyFile(t, p.ClientKeyPath, key, base)
+
+	r, err := NewCertReloader(ca, cert, key, logger)
+	if err != nil {
+		t.Fatalf("NewCertReloader: %v", err)
+	}
+	r.checkInterval = 0 // verifica a cada handshake
+
+	cfg := r.ClientTLSConfig()
+	if cfg.MinVersion != tls.VersionTLS13 || cfg.RootCAs == nil || cfg.GetClientCertificate == nil {
+		t.Fatalf("unexpected client config: %+v", cfg)
+	}
+	first, _ := cfg.GetClientCertificate(nil)
+
+	// Mesmo tls.Config (ex: reconexão de stream) passa a apresentar o novo cert.
+	other := generateTestPKI(t)
+	copyFile(t, other.ClientCertPath, cert, base.Add(time.Minute))
+	copyFile(t, other.ClientKeyPath, key, base.Add(time.Minute))
+	second, _ := cfg.GetClientCertificate(nil)
+
+	if bytes.Equal(first.Certificate[0], second.Certificate[0]) {
+		t.Fatal("expected rotated client certificate on next handshake")
+	}
+	if !bytes.Equal(second.Certificate[0], pemDER(t, other.ClientCertPath)) {
+		t.Fatal("expected client certificate loaded from rotated file")
+	}
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
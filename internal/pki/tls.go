@@ -35,6 +35,20 @@ func NewClientTLSConfig(caCertPath, clientCertPath, clientKeyPath string) (*tls.
 	}, nil
 }
 
+// NewPSKClientTLSConfig cria uma configuração TLS 1.3 de client sem
+// certificado próprio (auth psk): a CA valida o server e o agent se autentica
+// depois do handshake com a pre-shared key.
+func NewPSKClientTLSConfig(caCertPath string) (*tls.Config, error) {
+	caPool, err := loadCACertPool(caCertPath)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		RootCAs:    caPool,
+	}, nil
+}
+
 // NewServerTLSConfig cria uma configuração TLS 1.3 para o server
 // com autenticação mútua obrigatória (mTLS).
 func NewServerTLSConfig(caCertPath, serverCertPath, serverKeyPath string) (*tls.Config, error) {
@@ -0,0 +1,135 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// DefaultEnrollTokenTTL é a validade default de um token de enrollment.
+const DefaultEnrollTokenTTL = 24 * time.Hour
+
+// ErrInvalidEnrollToken indica token inexistente, já usado ou expirado.
+// Os três casos são indistinguíveis para o solicitante.
+var ErrInvalidEnrollToken = errors.New("invalid or expired enrollment token")
+
+// enrollToken é uma entrada do arquivo de tokens. Apenas o hash do token é
+// persistido: quem lê o arquivo não consegue se registrar como o agent.
+type enrollToken struct {
+	Hash    string    `json:"hash"`
+	Agent   string    `json:"agent"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// CreateEnrollToken gera um token de uso único que autoriza a emissão de um
+// certificado com CN=agent e o registra em path. Retorna o token em claro,
+// que não é recuperável depois.
+func CreateEnrollToken(path, agent string, ttl time.Duration) (string, error) {
+	if agent == "" {
+		return "", errors.New("agent name is required")
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	err := withTokenStore(path, func(tokens []enrollToken) ([]enrollToken, error) {
+		now := time.Now()
+		return append(tokens, enrollToken{
+			Hash:    hashEnrollToken(token),
+			Agent:   agent,
+			Created: now,
+			Expires: now.Add(ttl),
+		}), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeEnrollToken valida o token e o remove do arquivo (uso único),
+// retornando o nome do agent ao qual ele foi emitido. Tokens expirados são
+// descartados na mesma operação.
+func ConsumeEnrollToken(path, token string) (string, error) {
+	hash := hashEnrollToken(token)
+	var agent string
+	err := withTokenStore(path, func(tokens []enrollToken) ([]enrollToken, error) {
+		now := time.Now()
+		kept := tokens[:0]
+		for _, t := range tokens {
+			if !now.Before(t.Expires) {
+				continue
+			}
+			if agent == "" && subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+				agent = t.Agent
+				continue
+			}
+			kept = append(kept, t)
+		}
+		return kept, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if agent == "" {
+		return "", ErrInvalidEnrollToken
+	}
+	return agent, nil
+}
+
+func hashEnrollToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// withTokenStore lê o arquivo de tokens sob flock exclusivo (o CLI que cria
+// tokens e o server que os consome são processos distintos), aplica fn e
+// regrava o resultado atomicamente (statefile: tmp + fsync + rename).
+func withTokenStore(path string, fn func([]enrollToken) ([]enrollToken, error)) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating tokens dir: %w", err)
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("opening tokens lock: %w", err)
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("locking tokens file: %w", err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	var tokens []enrollToken
+	if _, err := statefile.ReadDocument(path, &tokens); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading tokens file: %w", err)
+	}
+
+	tokens, err = fn(tokens)
+	if err != nil {
+		return err
+	}
+	if tokens == nil {
+		tokens = []enrollToken{}
+	}
+	if err := statefile.WriteDocument(path, tokens, 0600); err != nil {
+		return fmt.Errorf("writing tokens file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Matriz de compatibilidade: encodings fixados de frames já publicados. Um
+// agent ou server antigo continua enviando exatamente estes bytes, então os
+// readers atuais precisam aceitá-los e os writers atuais não podem alterá-los
+// sem uma nova versão de handshake.
+
+// golden monta um frame a partir de pedaços em hex (espaços ignorados).
+func golden(t *testing.T, parts ...string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(strings.Join(parts, ""), " ", ""))
+	if err != nil {
+		t.Fatalf("bad golden hex: %v", err)
+	}
+	return b
+}
+
+const (
+	hexMagicHandshake = "4e424b50"       // "NBKP"
+	hexAgent          = "7765622d30310a" // "web-01\n"
+	hexStorage        = "6170700a"       // "app\n"
+	hexBackup         = "6461696c790a"   // "daily\n"
+	hexClientVersion  = "312e300a"       // "1.0\n"
+	hexSessionID      = "306633650a"     // "0f3e\n"
+)
+
+func TestCompat_Handshake(t *testing.T) {
+	fields := hexAgent + hexStorage + hexBackup + hexClientVersion
+	tests := []struct {
+		name  string
+		wire  []byte
+		write func(io.Writer) error
+		want  Handshake
+	}{
+		{
+			name:  "v6",
+			wire:  golden(t, hexMagicHandshake, "06", fields),
+			write: func(w io.Writer) error { return WriteHandshake(w, "web-01", "app", "daily", "1.0") },
+			want:  Handshake{Version: 0x06, AgentName: "web-01", StorageName: "app", BackupName: "daily", ClientVersion: "1.0"},
+		},
+		{
+			// Versões acima da v6 mudam só o byte de versão: um server v6 lê
+			// o handshake inteiro sem sobrar bytes
+			name: "v10 announced",
+			wire: golden(t, hexMagicHandshake, "0a", fields),
+			write: func(w io.Writer) error {
+				return WriteHandshakeVersion(w, HandshakeVersionSessionAutoScale, "web-01", "app", "daily", "1.0")
+			},
+			want: Handshake{Version: 0x0A, AgentName: "web-01", StorageName: "app", BackupName: "daily", ClientVersion: "1.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.wire) {
+				t.Fatalf("encoding changed:\n got %x\nwant %x", buf.Bytes(), tt.wire)
+			}
+			r := bytes.NewReader(tt.wire)
+			hs, err := ReadHandshake(r)
+			if err != nil {
+				t.Fatalf("ReadHandshake: %v", err)
+			}
+			if r.Len() != 0 {
+				t.Fatalf("%d trailing bytes not consumed", r.Len())
+			}
+			if hs.Version != tt.want.Version || hs.AgentName != tt.want.AgentName || hs.StorageName != tt.want.StorageName ||
+				hs.BackupName != tt.want.BackupName || hs.ClientVersion != tt.want.ClientVersion {
+				t.Fatalf("got %+v, want %+v", hs, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompat_HandshakeUnsupportedVersions(t *testing.T) {
+	fields := hexAgent + hexStorage + hexBackup + hexClientVersion
+	for _, v := range []byte{0x03, 0x04, 0x05} {
+		_, err := ReadHandshake(bytes.NewReader(golden(t, hexMagicHandshake, hex.EncodeToString([]byte{v}), fields)))
+		var verr *VersionError
+		if !errors.As(err, &verr) {
+			t.Fatalf("v%d: expected VersionError, got %v", v, err)
+		}
+		if verr.Got != v || verr.Supported != SupportedVersions {
+			t.Fatalf("v%d: unexpected error %+v", v, verr)
+		}
+		if !errors.Is(err, ErrInvalidVersion) {
+			t.Fatalf("v%d: expected errors.Is(err, ErrInvalidVersion)", v)
+		}
+	}
+
+	// Um agent mais novo que este build usa o mesmo formato: o handshake é
+	// lido e a versão negociada no ACK
+	hs, err := ReadHandshake(bytes.NewReader(golden(t, hexMagicHandshake, hex.EncodeToString([]byte{MaxProtocolVersion + 1}), fields)))
+	if err != nil || hs.Version != MaxProtocolVersion+1 || hs.ClientVersion != "1.0" {
+		t.Fatalf("newer agent: got %+v, %v", hs, err)
+	}
+}
+
+func TestCompat_ACK(t *testing.T) {
+	tests := []struct {
+		name  string
+		wire  []byte
+		read  func(io.Reader) (*ACK, error)
+		write func(io.Writer) error
+		want  ACK
+	}{
+		{
+			name:  "v4 go",
+			wire:  golden(t, "00 0a", hexSessionID, "00"),
+			read:  ReadACK,
+			write: func(w io.Writer) error { return WriteACK(w, StatusGo, "", "0f3e", CompressionGzip) },
+			want:  ACK{Status: StatusGo, SessionID: "0f3e", CompressionMode: CompressionGzip, Version: ProtocolVersion},
+		},
+		{
+			name:  "v4 reject",
+			wire:  golden(t, "03 6e6f7065 0a 0a 01"),
+			read:  ReadACK,
+			write: func(w io.Writer) error { return WriteACK(w, StatusReject, "nope", "", CompressionZstd) },
+			want:  ACK{Status: StatusReject, Message: "nope", CompressionMode: CompressionZstd, Version: ProtocolVersion},
+		},
+		{
+			name: "negotiated version",
+			wire: golden(t, "00 0a", hexSessionID, "81 08"),
+			read: ReadACK,
+			write: func(w io.Writer) error {
+				return WriteACKVersion(w, StatusGo, "", "0f3e", CompressionZstd, HandshakeVersionChunkRange)
+			},
+			want: ACK{Status: StatusGo, SessionID: "0f3e", CompressionMode: CompressionZstd, Version: HandshakeVersionChunkRange},
+		},
+		{
+			name: "version mismatch",
+			wire: golden(t, "09 756e737570706f72746564 0a 0a 00 06 07"),
+			read: ReadACK,
+			write: func(w io.Writer) error {
+				return WriteACKVersionMismatch(w, "unsupported", VersionRange{Min: 6, Max: 7})
+			},
+			want: ACK{Status: StatusVersionMismatch, Message: "unsupported", Versions: &VersionRange{Min: 6, Max: 7}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.wire) {
+				t.Fatalf("encoding changed:\n got %x\nwant %x", buf.Bytes(), tt.wire)
+			}
+			r := bytes.NewReader(tt.wire)
+			ack, err := tt.read(r)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if r.Len() != 0 {
+				t.Fatalf("%d trailing bytes not consumed", r.Len())
+			}
+			if ack.Status != tt.want.Status || ack.Message != tt.want.Message ||
+				ack.SessionID != tt.want.SessionID || ack.CompressionMode != tt.want.CompressionMode ||
+				ack.Version != tt.want.Version {
+				t.Fatalf("got %+v, want %+v", ack, tt.want)
+			}
+			if (ack.Versions == nil) != (tt.want.Versions == nil) || (ack.Versions != nil && *ack.Versions != *tt.want.Versions) {
+				t.Fatalf("versions: got %+v, want %+v", ack.Versions, tt.want.Versions)
+			}
+		})
+	}
+}
+
+// Um agent anterior a StatusVersionMismatch lê a recusa como um ACK v4 comum:
+// o status e a mensagem chegam intactos e o intervalo sobra no buffer.
+func TestCompat_VersionMismatchReadByLegacyAgent(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteACKVersionMismatch(&buf, "upgrade the agent", SupportedVersions); err != nil {
+		t.Fatal(err)
+	}
+	wire := buf.Bytes()
+	// Parser v4 puro: status, mensagem, sessão e compression mode
+	legacy := bytes.SplitN(wire[1:], []byte{'\n'}, 3)
+	if wire[0] != StatusVersionMismatch || string(legacy[0]) != "upgrade the agent" || len(legacy[1]) != 0 {
+		t.Fatalf("legacy parse of %x failed", wire)
+	}
+	if rest := legacy[2]; len(rest) != 3 || rest[0] != CompressionGzip {
+		t.Fatalf("unexpected tail %x", rest)
+	}
+}
+
+func TestCompat_ParallelJoin(t *testing.T) {
+	tests := []struct {
+		name string
+		wire []byte
+		want ParallelJoin
+	}{
+		// Agents anteriores às flags encerram o frame após o stream index.
+		{"legacy without flags", golden(t, "06", hexSessionID, "02"), ParallelJoin{SessionID: "0f3e", StreamIndex: 2}},
+		{"rotation", golden(t, "06", hexSessionID, "02 01"), ParallelJoin{SessionID: "0f3e", StreamIndex: 2, Flags: JoinReasonRotation}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pj, err := ReadParallelJoin(bytes.NewReader(tt.wire))
+			if err != nil {
+				t.Fatalf("ReadParallelJoin: %v", err)
+			}
+			if *pj != tt.want {
+				t.Fatalf("got %+v, want %+v", pj, tt.want)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := WriteParallelJoin(&buf, "0f3e", 2, JoinReasonRotation); err != nil {
+		t.Fatal(err)
+	}
+	if want := golden(t, "504a494e 06", hexSessionID, "02 01"); !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("encoding changed:\n got %x\nwant %x", buf.Bytes(), want)
+	}
+
+	_, err := ReadParallelJoin(bytes.NewReader(golden(t, "05", hexSessionID, "02")))
+	if !errors.Is(err, ErrInvalidVersion) {
+		t.Fatalf("expected ErrInvalidVersion for v5 join, got %v", err)
+	}
+}
+
+func TestCompat_ChunkHeaderAndTrailer(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteChunkHeader(&buf, 7, 1024, 3, 0xdeadbeef); err != nil {
+		t.Fatal(err)
+	}
+	wire := golden(t, "00000007 00000400 03 deadbeef")
+	if !bytes.Equal(buf.Bytes(), wire) {
+		t.Fatalf("chunk header changed:\n got %x\nwant %x", buf.Bytes(), wire)
+	}
+	hdr, err := ReadChunkHeader(bytes.NewReader(wire))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *hdr != (ChunkHeader{GlobalSeq: 7, Length: 1024, SlotID: 3, CRC32: 0xdeadbeef}) {
+		t.Fatalf("unexpected chunk header %+v", hdr)
+	}
+
+	var sum [32]byte
+	for i := range sum {
+		sum[i] = byte(i)
+	}
+	buf.Reset()
+	if err := WriteTrailer(&buf, sum, 4096); err != nil {
+		t.Fatal(err)
+	}
+	wire = golden(t, "444f4e45", hex.EncodeToString(sum[:]), "0000000000001000")
+	if !bytes.Equal(buf.Bytes(), wire) {
+		t.Fatalf("trailer changed:\n got %x\nwant %x", buf.Bytes(), wire)
+	}
+	tr, err := ReadTrailer(bytes.NewReader(wire))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Checksum != sum || tr.Size != 4096 {
+		t.Fatalf("unexpected trailer %+v", tr)
+	}
+}
+
+func TestVersionRange(t *testing.T) {
+	if SupportedVersions.Contains(MinProtocolVersion-1) || SupportedVersions.Contains(MaxProtocolVersion+1) ||
+		!SupportedVersions.Contains(ProtocolVersion) || !SupportedVersions.Contains(HandshakeVersionSACKWindow) ||
+		!SupportedVersions.Contains(HandshakeVersionChunkRange) || !SupportedVersions.Contains(HandshakeVersionSessionProgress) ||
+		!SupportedVersions.Contains(HandshakeVersionSessionAutoScale) {
+		t.Fatalf("unexpected SupportedVersions %s", SupportedVersions)
+	}
+	if s := (VersionRange{6, 6}).String(); s != "v6" {
+		t.Fatalf("String() = %q", s)
+	}
+}
+
+func TestVersionMismatchError(t *testing.T) {
+	tests := []struct {
+		agent   byte
+		server  VersionRange
+		upgrade string
+		msg     string
+	}{
+		{5, VersionRange{6, 7}, "agent", "protocol version mismatch: agent speaks v5, server supports v6-v7; upgrade the agent"},
+		{8, VersionRange{6, 7}, "server", "protocol version mismatch: agent speaks v8, server supports v6-v7; upgrade the server"},
+	}
+	for _, tt := range tests {
+		err := &VersionMismatchError{Agent: tt.agent, Server: tt.server}
+		if err.Upgrade() != tt.upgrade || err.Error() != tt.msg {
+			t.Errorf("got %q (upgrade %s), want %q", err.Error(), err.Upgrade(), tt.msg)
+		}
+		if !errors.Is(err, ErrInvalidVersion) {
+			t.Errorf("expected errors.Is(err, ErrInvalidVersion)")
+		}
+	}
+}
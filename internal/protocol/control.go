@@ -35,17 +35,37 @@ var MagicControlAbort = [4]byte{'C', 'A', 'B', 'T'}
 // MagicControlProgress é o magic para frames ControlProgress (Agent → Server).
 var MagicControlProgress = [4]byte{'C', 'P', 'R', 'G'}
 
+// MagicControlSessionProgress é o magic para frames ControlProgress com a
+// sessão (Agent → Server). Enviado apenas para sessões negociadas no handshake
+// v9+ (HandshakeVersionSessionProgress); nas demais o agent usa o CPRG.
+var MagicControlSessionProgress = [4]byte{'C', 'P', 'R', 'S'}
+
 // MagicControlStats é o magic para frames ControlStats (Agent → Server).
 var MagicControlStats = [4]byte{'C', 'S', 'T', 'S'}
 
 // MagicControlAutoScaleStats é o magic para frames ControlAutoScaleStats (Agent → Server).
 var MagicControlAutoScaleStats = [4]byte{'C', 'A', 'S', 'S'}
 
+// MagicControlSessionAutoScaleStats é o magic para frames ControlAutoScaleStats
+// com a sessão (Agent → Server). Enviado apenas para sessões negociadas no
+// handshake v10+ (HandshakeVersionSessionAutoScale); nas demais o agent usa o CASS.
+var MagicControlSessionAutoScaleStats = [4]byte{'C', 'S', 'A', 'S'}
+
 // MagicControlIngestionDone é o magic para frames ControlIngestionDone (Agent → Server).
 // Sinaliza explicitamente que o agent terminou de enviar todos os chunks com sucesso.
 // Formato: [Magic "CIDN" 4B] — sem payload.
 var MagicControlIngestionDone = [4]byte{'C', 'I', 'D', 'N'}
 
+// MagicControlSessionCancel é o magic para frames ControlSessionCancel (Agent → Server).
+// Sinaliza que o agent abandonou a sessão (ex: shutdown do daemon): o server
+// descarta os dados parciais sem aguardar o TTL.
+var MagicControlSessionCancel = [4]byte{'C', 'S', 'C', 'N'}
+
+// MagicControlSessionSummary é o magic para frames ControlSessionSummary (Agent → Server).
+// Enviado imediatamente antes do ControlIngestionDone com os totais de
+// transferência por stream (bytes enviados e retransmitidos).
+var MagicControlSessionSummary = [4]byte{'C', 'S', 'S', 'M'}
+
 // MagicControlSlotPark é o magic para frames ControlSlotPark (Agent → Server).
 // Sinaliza que o agent vai parar de enviar por um slot (scale-down).
 var MagicControlSlotPark = [4]byte{'C', 'S', 'L', 'P'}
@@ -54,6 +74,28 @@ var MagicControlSlotPark = [4]byte{'C', 'S', 'L', 'P'}
 // Sinaliza que o agent vai retomar envio por um slot (scale-up).
 var MagicControlSlotResume = [4]byte{'C', 'S', 'L', 'R'}
 
+// MagicControlSnapshotPrepare é o magic para frames ControlSnapshotPrepare (Server → Agent).
+// Inicia a fase de snapshot de um snapshot group: o agent executa o
+// snapshot.command do backup e responde com ControlSnapshotReady.
+var MagicControlSnapshotPrepare = [4]byte{'C', 'S', 'N', 'P'}
+
+// MagicControlSnapshotReady é o magic para frames ControlSnapshotReady (Agent → Server).
+// Confirma (ou recusa) o snapshot pedido por ControlSnapshotPrepare.
+var MagicControlSnapshotReady = [4]byte{'C', 'S', 'N', 'R'}
+
+// MagicControlSnapshotRelease é o magic para frames ControlSnapshotRelease (Server → Agent).
+// Libera a transferência (todos os agents do grupo confirmaram) ou a cancela.
+var MagicControlSnapshotRelease = [4]byte{'C', 'S', 'N', 'G'}
+
+// MagicControlServerLoad é o magic para frames ControlServerLoad (Server → Agent).
+// Enviado junto com o ControlPong apenas para sessões cujos streams anunciaram
+// JoinFlagServerLoad, então agents antigos nunca o recebem.
+var MagicControlServerLoad = [4]byte{'C', 'S', 'V', 'L'}
+
+// MagicControlStreamLimit é o magic para frames ControlStreamLimit (Server → Agent).
+// Enviado apenas para sessões cujos streams anunciaram JoinFlagStreamLimit.
+var MagicControlStreamLimit = [4]byte{'C', 'S', 'L', 'M'}
+
 // ControlPing é enviado pelo agent para o server no canal de controle.
 // Formato: [Magic "CPNG" 4B] [Timestamp int64 8B]
 type ControlPing struct {
@@ -93,9 +135,32 @@ type ControlDefer struct {
 }
 
 // ControlAbort é enviado pelo server ao agent para abortar um backup em andamento.
-// Formato: [Magic "CABT" 4B] [Reason uint32 4B]
+// Formato: [Magic "CABT" 4B] [Reason uint32 4B] [SessionIDLen 1B] [SessionID ...B]
+// SessionID vazio aborta todos os backups do agent.
 type ControlAbort struct {
-	Reason uint32
+	Reason    uint32
+	SessionID string
+}
+
+// ControlServerLoad reporta a pressão do lado do server sobre uma sessão
+// paralela, para o auto-scaler do agent não abrir streams quando o gargalo é
+// o disco do server e não a rede.
+// Formato: [Magic "CSVL" 4B] [SessionIDLen 1B] [SessionID] [PendingBytes uint64 8B]
+// [WriteLatencyUs uint32 4B] [QueueDepth uint32 4B]
+type ControlServerLoad struct {
+	SessionID    string
+	PendingBytes uint64 // bytes recebidos e ainda não gravados (assembler + chunk buffer)
+	WriteLatency uint32 // média móvel da gravação de um chunk, em microssegundos
+	QueueDepth   uint32 // writes aguardando worker no storage (write_workers)
+}
+
+// ControlStreamLimit recomenda o número máximo de streams paralelos de uma
+// sessão, repartindo o stream_budget do server entre as sessões em andamento.
+// O agent desativa os streams excedentes e não abre novos acima do teto.
+// Formato: [Magic "CSLM" 4B] [SessionIDLen 1B] [SessionID] [MaxStreams uint8 1B]
+type ControlStreamLimit struct {
+	SessionID  string
+	MaxStreams uint8 // teto recomendado; o MaxStreams da sessão remove o teto
 }
 
 // Abort reasons.
@@ -104,12 +169,48 @@ const (
 	AbortReasonServerBusy  uint32 = 2
 	AbortReasonMaintenance uint32 = 3
 	AbortReasonChunkLost   uint32 = 4 // chunk irrecuperável (ring buffer sobrescrito)
+	AbortReasonCancelled   uint32 = 5 // sessão cancelada pelo operador (API, Web UI ou admin socket)
 )
 
+// AbortReasonString retorna o nome legível de um abort reason.
+func AbortReasonString(reason uint32) string {
+	switch reason {
+	case AbortReasonDiskFull:
+		return "disk full"
+	case AbortReasonServerBusy:
+		return "server busy"
+	case AbortReasonMaintenance:
+		return "maintenance"
+	case AbortReasonChunkLost:
+		return "chunk lost"
+	case AbortReasonCancelled:
+		return "cancelled by operator"
+	default:
+		return fmt.Sprintf("reason %d", reason)
+	}
+}
+
+// ParseAbortReason converte o reason informado pelo operador ao cancelar uma
+// sessão (cancelled, maintenance ou server_busy; vazio = cancelled) no código
+// do ControlAbort. disk_full e chunk_lost são reservados ao próprio server.
+func ParseAbortReason(name string) (uint32, error) {
+	switch name {
+	case "", "cancelled":
+		return AbortReasonCancelled, nil
+	case "maintenance":
+		return AbortReasonMaintenance, nil
+	case "server_busy":
+		return AbortReasonServerBusy, nil
+	}
+	return 0, fmt.Errorf("unknown abort reason %q (use cancelled, maintenance or server_busy)", name)
+}
+
 // ControlProgress é enviado pelo agent ao server para reportar progresso do backup.
 // Formato: [Magic "CPRG" 4B] [TotalObjects uint32 4B] [ObjectsSent uint32 4B] [Flags uint8 1B]
+// ou, com a sessão: [Magic "CPRS" 4B] [SessionIDLen 1B] [SessionID] seguido dos mesmos 9B.
 // Flags: bit 0 = WalkComplete (1 = prescan finalizado, total confiável)
 type ControlProgress struct {
+	SessionID    string // vazio no CPRG: o server associa o progresso pelo agent
 	TotalObjects uint32
 	ObjectsSent  uint32
 	WalkComplete bool
@@ -139,7 +240,9 @@ const (
 //	[State uint8 1B] [ProbeActive uint8 1B]
 //
 // Payload: 16B. Frame total: 20B.
+// Com a sessão: [Magic "CSAS" 4B] [SessionIDLen 1B] [SessionID] seguido do mesmo payload.
 type ControlAutoScaleStats struct {
+	SessionID     string  // vazio no CASS: o server associa as métricas pelo agent
 	Efficiency    float32 // ratio producer/drain
 	ProducerMBs   float32 // taxa de produção MB/s
 	DrainMBs      float32 // taxa de consumo MB/s
@@ -331,21 +434,30 @@ func ReadControlDeferPayload(r io.Reader) (uint32, error) {
 }
 
 // WriteControlAbort escreve o frame ControlAbort (Server → Agent).
-func WriteControlAbort(w io.Writer, reason uint32) error {
-	buf := make([]byte, 8) // 4B magic + 4B reason
+func WriteControlAbort(w io.Writer, reason uint32, sessionID string) error {
+	if len(sessionID) > 255 {
+		return fmt.Errorf("sessionID too long for ControlAbort: %d", len(sessionID))
+	}
+	buf := make([]byte, 4+4+1+len(sessionID)) // 4B magic + 4B reason + 1B len + sessionID
 	copy(buf[0:4], MagicControlAbort[:])
 	binary.BigEndian.PutUint32(buf[4:8], reason)
+	buf[8] = byte(len(sessionID))
+	copy(buf[9:], sessionID)
 	_, err := w.Write(buf)
 	return err
 }
 
-// ReadControlAbortPayload lê o payload de ControlAbort (4B) após o magic já ter sido lido.
-func ReadControlAbortPayload(r io.Reader) (uint32, error) {
-	buf := make([]byte, 4)
+// ReadControlAbortPayload lê o payload de ControlAbort após o magic já ter sido lido.
+func ReadControlAbortPayload(r io.Reader) (*ControlAbort, error) {
+	buf := make([]byte, 5)
 	if _, err := io.ReadFull(r, buf); err != nil {
-		return 0, fmt.Errorf("reading control abort payload: %w", err)
+		return nil, fmt.Errorf("reading control abort payload: %w", err)
 	}
-	return binary.BigEndian.Uint32(buf), nil
+	sid := make([]byte, buf[4])
+	if _, err := io.ReadFull(r, sid); err != nil {
+		return nil, fmt.Errorf("reading control abort sessionID: %w", err)
+	}
+	return &ControlAbort{Reason: binary.BigEndian.Uint32(buf[0:4]), SessionID: string(sid)}, nil
 }
 
 // WriteControlProgress escreve o frame ControlProgress (Agent → Server).
@@ -374,6 +486,42 @@ func ReadControlProgressPayload(r io.Reader) (*ControlProgress, error) {
 	}, nil
 }
 
+// WriteControlSessionProgress escreve o frame ControlProgress da sessão sessionID
+// (magic "CPRS", Agent → Server).
+func WriteControlSessionProgress(w io.Writer, sessionID string, totalObjects, objectsSent uint32, walkComplete bool) error {
+	if len(sessionID) > 255 {
+		return fmt.Errorf("sessionID too long for ControlProgress: %d", len(sessionID))
+	}
+	buf := make([]byte, 0, 4+1+len(sessionID)+9)
+	buf = append(buf, MagicControlSessionProgress[:]...)
+	buf = append(buf, byte(len(sessionID)))
+	buf = append(buf, sessionID...)
+	buf = binary.BigEndian.AppendUint32(buf, totalObjects)
+	buf = binary.BigEndian.AppendUint32(buf, objectsSent)
+	var flags byte
+	if walkComplete {
+		flags = 1
+	}
+	buf = append(buf, flags)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadControlSessionProgressPayload lê o payload de um ControlProgress com a
+// sessão (CPRS) após o magic já ter sido lido.
+func ReadControlSessionProgressPayload(r io.Reader) (*ControlProgress, error) {
+	sid, err := readShortString(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading control progress sessionID: %w", err)
+	}
+	prog, err := ReadControlProgressPayload(r)
+	if err != nil {
+		return nil, err
+	}
+	prog.SessionID = sid
+	return prog, nil
+}
+
 // ReadControlProgress lê o frame ControlProgress completo (magic + payload).
 func ReadControlProgress(r io.Reader) (*ControlProgress, error) {
 	buf := make([]byte, 13)
@@ -450,19 +598,20 @@ func ReadControlStats(r io.Reader) (*ControlStats, error) {
 // WriteControlAutoScaleStats escreve o frame ControlAutoScaleStats (Agent → Server).
 // Frame: [Magic 4B] [Efficiency 4B] [ProducerMBs 4B] [DrainMBs 4B] [Active 1B] [Max 1B] [State 1B] [Probe 1B] = 20B
 func WriteControlAutoScaleStats(w io.Writer, stats *ControlAutoScaleStats) error {
-	buf := make([]byte, 20) // 4B magic + 16B payload
-	copy(buf[0:4], MagicControlAutoScaleStats[:])
-	binary.BigEndian.PutUint32(buf[4:8], math.Float32bits(stats.Efficiency))
-	binary.BigEndian.PutUint32(buf[8:12], math.Float32bits(stats.ProducerMBs))
-	binary.BigEndian.PutUint32(buf[12:16], math.Float32bits(stats.DrainMBs))
-	buf[16] = stats.ActiveStreams
-	buf[17] = stats.MaxStreams
-	buf[18] = stats.State
-	buf[19] = stats.ProbeActive
-	_, err := w.Write(buf)
+	buf := make([]byte, 0, 20) // 4B magic + 16B payload
+	buf = append(buf, MagicControlAutoScaleStats[:]...)
+	_, err := w.Write(appendAutoScaleStats(buf, stats))
 	return err
 }
 
+// appendAutoScaleStats acrescenta a buf o payload (16B) de stats.
+func appendAutoScaleStats(buf []byte, stats *ControlAutoScaleStats) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(stats.Efficiency))
+	buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(stats.ProducerMBs))
+	buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(stats.DrainMBs))
+	return append(buf, stats.ActiveStreams, stats.MaxStreams, stats.State, stats.ProbeActive)
+}
+
 // ReadControlAutoScaleStatsPayload lê o payload (16B) após o magic já ter sido lido.
 func ReadControlAutoScaleStatsPayload(r io.Reader) (*ControlAutoScaleStats, error) {
 	buf := make([]byte, 16)
@@ -480,6 +629,35 @@ func ReadControlAutoScaleStatsPayload(r io.Reader) (*ControlAutoScaleStats, erro
 	}, nil
 }
 
+// WriteControlSessionAutoScaleStats escreve o frame ControlAutoScaleStats da
+// sessão sessionID (magic "CSAS", Agent → Server).
+func WriteControlSessionAutoScaleStats(w io.Writer, sessionID string, stats *ControlAutoScaleStats) error {
+	if len(sessionID) > 255 {
+		return fmt.Errorf("sessionID too long for ControlAutoScaleStats: %d", len(sessionID))
+	}
+	buf := make([]byte, 0, 4+1+len(sessionID)+16)
+	buf = append(buf, MagicControlSessionAutoScaleStats[:]...)
+	buf = append(buf, byte(len(sessionID)))
+	buf = append(buf, sessionID...)
+	_, err := w.Write(appendAutoScaleStats(buf, stats))
+	return err
+}
+
+// ReadControlSessionAutoScaleStatsPayload lê o payload de um
+// ControlAutoScaleStats com a sessão (CSAS) após o magic já ter sido lido.
+func ReadControlSessionAutoScaleStatsPayload(r io.Reader) (*ControlAutoScaleStats, error) {
+	sid, err := readShortString(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading auto-scale stats sessionID: %w", err)
+	}
+	stats, err := ReadControlAutoScaleStatsPayload(r)
+	if err != nil {
+		return nil, err
+	}
+	stats.SessionID = sid
+	return stats, nil
+}
+
 // ReadControlAutoScaleStats lê o frame completo (magic + payload).
 func ReadControlAutoScaleStats(r io.Reader) (*ControlAutoScaleStats, error) {
 	buf := make([]byte, 20)
@@ -515,6 +693,95 @@ func WriteControlIngestionDone(w io.Writer, sessionID string) error {
 	return err
 }
 
+// WriteControlSessionCancel escreve o frame ControlSessionCancel (Agent → Server).
+// Frame: [Magic 4B][SessionIDLen 1B][SessionID ...B]
+func WriteControlSessionCancel(w io.Writer, sessionID string) error {
+	if len(sessionID) > 255 {
+		return fmt.Errorf("sessionID too long for ControlSessionCancel: %d", len(sessionID))
+	}
+	buf := make([]byte, 4+1+len(sessionID))
+	copy(buf[0:4], MagicControlSessionCancel[:])
+	buf[4] = byte(len(sessionID))
+	copy(buf[5:], sessionID)
+	_, err := w.Write(buf)
+	return err
+}
+
+// StreamTransferStats contém os totais de transferência de um stream paralelo.
+type StreamTransferStats struct {
+	StreamIndex     uint8
+	BytesSent       uint64 // bytes escritos no socket, incluindo retransmissões
+	RetransmitBytes uint64 // bytes reenviados (NACK ou reenvio após reconexão)
+}
+
+// ControlSessionSummary contém os totais de transferência de uma sessão paralela.
+type ControlSessionSummary struct {
+	SessionID string
+	Streams   []StreamTransferStats
+}
+
+// sessionSummaryStreamSize é o tamanho de cada entrada de stream do ControlSessionSummary.
+const sessionSummaryStreamSize = 1 + 8 + 8
+
+// WriteControlSessionSummary escreve o frame ControlSessionSummary (Agent → Server).
+// Frame: [Magic 4B][SessionIDLen 1B][SessionID ...B][NumStreams 1B]
+// [StreamIndex 1B][BytesSent uint64 8B][RetransmitBytes uint64 8B] × NumStreams
+func WriteControlSessionSummary(w io.Writer, summary ControlSessionSummary) error {
+	if len(summary.SessionID) > 255 {
+		return fmt.Errorf("sessionID too long for ControlSessionSummary: %d", len(summary.SessionID))
+	}
+	if len(summary.Streams) > 255 {
+		return fmt.Errorf("too many streams for ControlSessionSummary: %d", len(summary.Streams))
+	}
+	buf := make([]byte, 4+1+len(summary.SessionID)+1+len(summary.Streams)*sessionSummaryStreamSize)
+	copy(buf[0:4], MagicControlSessionSummary[:])
+	buf[4] = byte(len(summary.SessionID))
+	off := 5 + copy(buf[5:], summary.SessionID)
+	buf[off] = byte(len(summary.Streams))
+	off++
+	for _, s := range summary.Streams {
+		buf[off] = s.StreamIndex
+		binary.BigEndian.PutUint64(buf[off+1:off+9], s.BytesSent)
+		binary.BigEndian.PutUint64(buf[off+9:off+17], s.RetransmitBytes)
+		off += sessionSummaryStreamSize
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadControlSessionSummaryPayload lê o payload de ControlSessionSummary.
+// O magic já foi lido pelo dispatcher.
+func ReadControlSessionSummaryPayload(r io.Reader) (*ControlSessionSummary, error) {
+	var lenBuf [1]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, fmt.Errorf("reading ControlSessionSummary sessionID length: %w", err)
+	}
+	sid := make([]byte, lenBuf[0])
+	if _, err := io.ReadFull(r, sid); err != nil {
+		return nil, fmt.Errorf("reading ControlSessionSummary sessionID: %w", err)
+	}
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, fmt.Errorf("reading ControlSessionSummary stream count: %w", err)
+	}
+	buf := make([]byte, int(lenBuf[0])*sessionSummaryStreamSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("reading ControlSessionSummary streams: %w", err)
+	}
+	summary := &ControlSessionSummary{
+		SessionID: string(sid),
+		Streams:   make([]StreamTransferStats, lenBuf[0]),
+	}
+	for i := range summary.Streams {
+		off := i * sessionSummaryStreamSize
+		summary.Streams[i] = StreamTransferStats{
+			StreamIndex:     buf[off],
+			BytesSent:       binary.BigEndian.Uint64(buf[off+1 : off+9]),
+			RetransmitBytes: binary.BigEndian.Uint64(buf[off+9 : off+17]),
+		}
+	}
+	return summary, nil
+}
+
 // ReadControlIngestionDonePayload lê o payload de ControlIngestionDone.
 // Retorna o sessionID informado pelo agent.
 // O magic já foi lido pelo dispatcher.
@@ -532,6 +799,20 @@ func ReadControlIngestionDonePayload(r io.Reader) (sessionID string, err error)
 	return string(sid), nil
 }
 
+// ReadControlSessionCancelPayload lê o payload de ControlSessionCancel.
+// O magic já foi lido pelo dispatcher.
+func ReadControlSessionCancelPayload(r io.Reader) (sessionID string, err error) {
+	var lenBuf [1]byte
+	if _, err = io.ReadFull(r, lenBuf[:]); err != nil {
+		return "", fmt.Errorf("reading ControlSessionCancel sessionID length: %w", err)
+	}
+	sid := make([]byte, lenBuf[0])
+	if _, err = io.ReadFull(r, sid); err != nil {
+		return "", fmt.Errorf("reading ControlSessionCancel sessionID: %w", err)
+	}
+	return string(sid), nil
+}
+
 // MagicControlAssemblyProgress é o magic para frames ControlAssemblyProgress (Server → Agent).
 // Informa o agente sobre o progresso da montagem do arquivo final durante finalize.
 var MagicControlAssemblyProgress = [4]byte{'C', 'A', 'S', 'P'}
@@ -576,3 +857,202 @@ func ReadControlAssemblyProgressPayload(r io.Reader) (*ControlAssemblyProgress,
 	}, nil
 }
 
+
+// Status do ControlSnapshotReady.
+const (
+	SnapshotStatusReady  byte = 0x00 // snapshot feito, aguardando release
+	SnapshotStatusFailed byte = 0x01 // snapshot.command falhou ou backup não coordenado
+	SnapshotStatusBusy   byte = 0x02 // backup já em execução
+)
+
+// ControlSnapshotPrepare pede ao agent o snapshot do backup Backup.
+// Formato: [Magic "CSNP" 4B] [SnapshotIDLen 1B] [SnapshotID] [BackupLen 1B] [Backup]
+type ControlSnapshotPrepare struct {
+	SnapshotID string
+	Backup     string
+}
+
+// ControlSnapshotReady é a resposta do agent ao ControlSnapshotPrepare.
+// Formato: [Magic "CSNR" 4B] [SnapshotIDLen 1B] [SnapshotID] [Status 1B] [MessageLen uint16 2B] [Message]
+type ControlSnapshotReady struct {
+	SnapshotID string
+	Status     byte
+	Message    string
+}
+
+// ControlSnapshotRelease libera (Proceed) ou cancela a transferência após o snapshot.
+// Formato: [Magic "CSNG" 4B] [SnapshotIDLen 1B] [SnapshotID] [Proceed 1B]
+type ControlSnapshotRelease struct {
+	SnapshotID string
+	Proceed    bool
+}
+
+// readShortString lê uma string prefixada por 1 byte de tamanho.
+func readShortString(r io.Reader) (string, error) {
+	var l [1]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return "", err
+	}
+	b := make([]byte, l[0])
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// WriteControlSnapshotPrepare escreve o frame ControlSnapshotPrepare (Server → Agent).
+func WriteControlSnapshotPrepare(w io.Writer, snapshotID, backup string) error {
+	if len(snapshotID) > 255 || len(backup) > 255 {
+		return fmt.Errorf("snapshotID or backup too long for ControlSnapshotPrepare")
+	}
+	buf := make([]byte, 0, 4+1+len(snapshotID)+1+len(backup))
+	buf = append(buf, MagicControlSnapshotPrepare[:]...)
+	buf = append(buf, byte(len(snapshotID)))
+	buf = append(buf, snapshotID...)
+	buf = append(buf, byte(len(backup)))
+	buf = append(buf, backup...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadControlSnapshotPreparePayload lê o payload de ControlSnapshotPrepare após o magic.
+func ReadControlSnapshotPreparePayload(r io.Reader) (*ControlSnapshotPrepare, error) {
+	id, err := readShortString(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot prepare id: %w", err)
+	}
+	backup, err := readShortString(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot prepare backup: %w", err)
+	}
+	return &ControlSnapshotPrepare{SnapshotID: id, Backup: backup}, nil
+}
+
+// WriteControlSnapshotReady escreve o frame ControlSnapshotReady (Agent → Server).
+// Mensagens acima de 64KiB são truncadas.
+func WriteControlSnapshotReady(w io.Writer, snapshotID string, status byte, message string) error {
+	if len(snapshotID) > 255 {
+		return fmt.Errorf("snapshotID too long for ControlSnapshotReady: %d", len(snapshotID))
+	}
+	if len(message) > math.MaxUint16 {
+		message = message[:math.MaxUint16]
+	}
+	buf := make([]byte, 0, 4+1+len(snapshotID)+1+2+len(message))
+	buf = append(buf, MagicControlSnapshotReady[:]...)
+	buf = append(buf, byte(len(snapshotID)))
+	buf = append(buf, snapshotID...)
+	buf = append(buf, status)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(message)))
+	buf = append(buf, message...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadControlSnapshotReadyPayload lê o payload de ControlSnapshotReady após o magic.
+func ReadControlSnapshotReadyPayload(r io.Reader) (*ControlSnapshotReady, error) {
+	id, err := readShortString(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot ready id: %w", err)
+	}
+	var hdr [3]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("reading snapshot ready status: %w", err)
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(hdr[1:3]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("reading snapshot ready message: %w", err)
+	}
+	return &ControlSnapshotReady{SnapshotID: id, Status: hdr[0], Message: string(msg)}, nil
+}
+
+// WriteControlSnapshotRelease escreve o frame ControlSnapshotRelease (Server → Agent).
+func WriteControlSnapshotRelease(w io.Writer, snapshotID string, proceed bool) error {
+	if len(snapshotID) > 255 {
+		return fmt.Errorf("snapshotID too long for ControlSnapshotRelease: %d", len(snapshotID))
+	}
+	buf := make([]byte, 0, 4+1+len(snapshotID)+1)
+	buf = append(buf, MagicControlSnapshotRelease[:]...)
+	buf = append(buf, byte(len(snapshotID)))
+	buf = append(buf, snapshotID...)
+	if proceed {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadControlSnapshotReleasePayload lê o payload de ControlSnapshotRelease após o magic.
+func ReadControlSnapshotReleasePayload(r io.Reader) (*ControlSnapshotRelease, error) {
+	id, err := readShortString(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot release id: %w", err)
+	}
+	var proceed [1]byte
+	if _, err := io.ReadFull(r, proceed[:]); err != nil {
+		return nil, fmt.Errorf("reading snapshot release flag: %w", err)
+	}
+	return &ControlSnapshotRelease{SnapshotID: id, Proceed: proceed[0] == 1}, nil
+}
+
+// WriteControlServerLoad escreve o frame ControlServerLoad (Server → Agent).
+func WriteControlServerLoad(w io.Writer, load *ControlServerLoad) error {
+	if len(load.SessionID) > 255 {
+		return fmt.Errorf("sessionID too long for ControlServerLoad: %d", len(load.SessionID))
+	}
+	buf := make([]byte, 0, 4+1+len(load.SessionID)+16)
+	buf = append(buf, MagicControlServerLoad[:]...)
+	buf = append(buf, byte(len(load.SessionID)))
+	buf = append(buf, load.SessionID...)
+	buf = binary.BigEndian.AppendUint64(buf, load.PendingBytes)
+	buf = binary.BigEndian.AppendUint32(buf, load.WriteLatency)
+	buf = binary.BigEndian.AppendUint32(buf, load.QueueDepth)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadControlServerLoadPayload lê o payload de ControlServerLoad após o magic.
+func ReadControlServerLoadPayload(r io.Reader) (*ControlServerLoad, error) {
+	sid, err := readShortString(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading server load sessionID: %w", err)
+	}
+	var buf [16]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, fmt.Errorf("reading server load payload: %w", err)
+	}
+	return &ControlServerLoad{
+		SessionID:    sid,
+		PendingBytes: binary.BigEndian.Uint64(buf[0:8]),
+		WriteLatency: binary.BigEndian.Uint32(buf[8:12]),
+		QueueDepth:   binary.BigEndian.Uint32(buf[12:16]),
+	}, nil
+}
+
+// WriteControlStreamLimit escreve um frame ControlStreamLimit completo.
+func WriteControlStreamLimit(w io.Writer, limit *ControlStreamLimit) error {
+	if len(limit.SessionID) > 255 {
+		return fmt.Errorf("sessionID too long for ControlStreamLimit: %d", len(limit.SessionID))
+	}
+	buf := make([]byte, 0, 4+1+len(limit.SessionID)+1)
+	buf = append(buf, MagicControlStreamLimit[:]...)
+	buf = append(buf, byte(len(limit.SessionID)))
+	buf = append(buf, limit.SessionID...)
+	buf = append(buf, limit.MaxStreams)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadControlStreamLimitPayload lê o payload de ControlStreamLimit após o magic.
+func ReadControlStreamLimitPayload(r io.Reader) (*ControlStreamLimit, error) {
+	sid, err := readShortString(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading stream limit sessionID: %w", err)
+	}
+	var buf [1]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, fmt.Errorf("reading stream limit payload: %w", err)
+	}
+	return &ControlStreamLimit{SessionID: sid, MaxStreams: buf[0]}, nil
+}
@@ -6,6 +6,7 @@ package protocol
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -126,8 +127,13 @@ func TestReadControlMagic(t *testing.T) {
 		{"CDFE", MagicControlDefer},
 		{"CABT", MagicControlAbort},
 		{"CPRG", MagicControlProgress},
+		{"CPRS", MagicControlSessionProgress},
 		{"CSTS", MagicControlStats},
 		{"CASS", MagicControlAutoScaleStats},
+		{"CSAS", MagicControlSessionAutoScaleStats},
+		{"CSNP", MagicControlSnapshotPrepare},
+		{"CSNR", MagicControlSnapshotReady},
+		{"CSNG", MagicControlSnapshotRelease},
 	}
 
 	for _, tt := range tests {
@@ -298,12 +304,13 @@ func TestControlDefer_RoundTrip(t *testing.T) {
 func TestControlAbort_RoundTrip(t *testing.T) {
 	var buf bytes.Buffer
 	reason := AbortReasonDiskFull
+	sessionID := "3f0c9a52-6d1e-4b7a-9c2f-0e8d1a7b5c44"
 
-	if err := WriteControlAbort(&buf, reason); err != nil {
+	if err := WriteControlAbort(&buf, reason, sessionID); err != nil {
 		t.Fatalf("WriteControlAbort failed: %v", err)
 	}
-	if buf.Len() != 8 {
-		t.Fatalf("expected 8 bytes, got %d", buf.Len())
+	if buf.Len() != 9+len(sessionID) {
+		t.Fatalf("expected %d bytes, got %d", 9+len(sessionID), buf.Len())
 	}
 
 	magic, _ := ReadControlMagic(&buf)
@@ -314,8 +321,129 @@ func TestControlAbort_RoundTrip(t *testing.T) {
 	if err != nil {
 		t.Fatalf("ReadControlAbortPayload failed: %v", err)
 	}
-	if got != reason {
-		t.Errorf("reason: want %d, got %d", reason, got)
+	if got.Reason != reason {
+		t.Errorf("reason: want %d, got %d", reason, got.Reason)
+	}
+	if got.SessionID != sessionID {
+		t.Errorf("sessionID: want %q, got %q", sessionID, got.SessionID)
+	}
+}
+
+func TestControlAbort_AllSessions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteControlAbort(&buf, AbortReasonMaintenance, ""); err != nil {
+		t.Fatalf("WriteControlAbort failed: %v", err)
+	}
+	if buf.Len() != 9 {
+		t.Fatalf("expected 9 bytes, got %d", buf.Len())
+	}
+	ReadControlMagic(&buf)
+	got, err := ReadControlAbortPayload(&buf)
+	if err != nil {
+		t.Fatalf("ReadControlAbortPayload failed: %v", err)
+	}
+	if got.Reason != AbortReasonMaintenance || got.SessionID != "" {
+		t.Errorf("unexpected abort: %+v", got)
+	}
+}
+
+func TestControlServerLoad_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	want := ControlServerLoad{
+		SessionID:    "3f0c9a52-6d1e-4b7a-9c2f-0e8d1a7b5c44",
+		PendingBytes: 96 * 1024 * 1024,
+		WriteLatency: 75000,
+		QueueDepth:   6,
+	}
+	if err := WriteControlServerLoad(&buf, &want); err != nil {
+		t.Fatalf("WriteControlServerLoad failed: %v", err)
+	}
+	if buf.Len() != 4+1+len(want.SessionID)+16 {
+		t.Fatalf("unexpected frame size %d", buf.Len())
+	}
+
+	magic, _ := ReadControlMagic(&buf)
+	if magic != MagicControlServerLoad {
+		t.Fatalf("expected CSVL magic, got %q", magic)
+	}
+	got, err := ReadControlServerLoadPayload(&buf)
+	if err != nil {
+		t.Fatalf("ReadControlServerLoadPayload failed: %v", err)
+	}
+	if *got != want {
+		t.Errorf("want %+v, got %+v", want, *got)
+	}
+}
+
+func TestControlStreamLimit_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	want := ControlStreamLimit{SessionID: "3f0c9a52-6d1e-4b7a-9c2f-0e8d1a7b5c44", MaxStreams: 3}
+	if err := WriteControlStreamLimit(&buf, &want); err != nil {
+		t.Fatalf("WriteControlStreamLimit failed: %v", err)
+	}
+
+	magic, _ := ReadControlMagic(&buf)
+	if magic != MagicControlStreamLimit {
+		t.Fatalf("expected CSLM magic, got %q", magic)
+	}
+	got, err := ReadControlStreamLimitPayload(&buf)
+	if err != nil {
+		t.Fatalf("ReadControlStreamLimitPayload failed: %v", err)
+	}
+	if *got != want {
+		t.Errorf("want %+v, got %+v", want, *got)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected frame fully consumed, %d bytes left", buf.Len())
+	}
+}
+
+func TestControlSnapshot_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteControlSnapshotPrepare(&buf, "pg-cluster-1760000000", "pgdata"); err != nil {
+		t.Fatalf("WriteControlSnapshotPrepare failed: %v", err)
+	}
+	if err := WriteControlSnapshotReady(&buf, "pg-cluster-1760000000", SnapshotStatusFailed, "pg_backup_start: timeout"); err != nil {
+		t.Fatalf("WriteControlSnapshotReady failed: %v", err)
+	}
+	if err := WriteControlSnapshotRelease(&buf, "pg-cluster-1760000000", true); err != nil {
+		t.Fatalf("WriteControlSnapshotRelease failed: %v", err)
+	}
+
+	if magic, _ := ReadControlMagic(&buf); magic != MagicControlSnapshotPrepare {
+		t.Fatalf("expected CSNP magic, got %q", magic)
+	}
+	prep, err := ReadControlSnapshotPreparePayload(&buf)
+	if err != nil {
+		t.Fatalf("ReadControlSnapshotPreparePayload failed: %v", err)
+	}
+	if prep.SnapshotID != "pg-cluster-1760000000" || prep.Backup != "pgdata" {
+		t.Errorf("unexpected prepare: %+v", prep)
+	}
+
+	if magic, _ := ReadControlMagic(&buf); magic != MagicControlSnapshotReady {
+		t.Fatalf("expected CSNR magic, got %q", magic)
+	}
+	ready, err := ReadControlSnapshotReadyPayload(&buf)
+	if err != nil {
+		t.Fatalf("ReadControlSnapshotReadyPayload failed: %v", err)
+	}
+	if ready.SnapshotID != "pg-cluster-1760000000" || ready.Status != SnapshotStatusFailed || ready.Message != "pg_backup_start: timeout" {
+		t.Errorf("unexpected ready: %+v", ready)
+	}
+
+	if magic, _ := ReadControlMagic(&buf); magic != MagicControlSnapshotRelease {
+		t.Fatalf("expected CSNG magic, got %q", magic)
+	}
+	rel, err := ReadControlSnapshotReleasePayload(&buf)
+	if err != nil {
+		t.Fatalf("ReadControlSnapshotReleasePayload failed: %v", err)
+	}
+	if rel.SnapshotID != "pg-cluster-1760000000" || !rel.Proceed {
+		t.Errorf("unexpected release: %+v", rel)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected buffer fully consumed, %d bytes left", buf.Len())
 	}
 }
 
@@ -443,6 +571,34 @@ func TestControlProgress_PayloadAfterMagic(t *testing.T) {
 	}
 }
 
+func TestControlSessionProgress_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteControlSessionProgress(&buf, "0f3e-41", 8000, 4500, true); err != nil {
+		t.Fatalf("WriteControlSessionProgress failed: %v", err)
+	}
+	// 4B magic + 1B len + 7B sessionID + 9B payload
+	if buf.Len() != 21 {
+		t.Fatalf("expected 21 bytes, got %d", buf.Len())
+	}
+
+	magic, _ := ReadControlMagic(&buf)
+	if magic != MagicControlSessionProgress {
+		t.Fatalf("expected CPRS magic, got %q", magic)
+	}
+	got, err := ReadControlSessionProgressPayload(&buf)
+	if err != nil {
+		t.Fatalf("ReadControlSessionProgressPayload failed: %v", err)
+	}
+	want := ControlProgress{SessionID: "0f3e-41", TotalObjects: 8000, ObjectsSent: 4500, WalkComplete: true}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+
+	if err := WriteControlSessionProgress(&buf, strings.Repeat("x", 256), 0, 0, false); err == nil {
+		t.Error("expected error for sessionID longer than 255 bytes")
+	}
+}
+
 func TestControlStatsPayload_RoundTrip(t *testing.T) {
 	var buf bytes.Buffer
 	cpu := float32(45.5)
@@ -527,6 +683,36 @@ func TestControlAutoScaleStats_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestControlSessionAutoScaleStats_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	stats := &ControlAutoScaleStats{Efficiency: 0.8, ProducerMBs: 40, DrainMBs: 50, ActiveStreams: 3, MaxStreams: 4, State: AutoScaleStateScalingUp}
+	if err := WriteControlSessionAutoScaleStats(&buf, "0f3e-41", stats); err != nil {
+		t.Fatalf("WriteControlSessionAutoScaleStats failed: %v", err)
+	}
+	// 4B magic + 1B len + 7B sessionID + 16B payload
+	if buf.Len() != 28 {
+		t.Fatalf("expected 28 bytes, got %d", buf.Len())
+	}
+
+	magic, _ := ReadControlMagic(&buf)
+	if magic != MagicControlSessionAutoScaleStats {
+		t.Fatalf("expected CSAS magic, got %q", magic)
+	}
+	got, err := ReadControlSessionAutoScaleStatsPayload(&buf)
+	if err != nil {
+		t.Fatalf("ReadControlSessionAutoScaleStatsPayload failed: %v", err)
+	}
+	want := *stats
+	want.SessionID = "0f3e-41"
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+
+	if err := WriteControlSessionAutoScaleStats(&buf, strings.Repeat("x", 256), stats); err == nil {
+		t.Error("expected error for sessionID longer than 255 bytes")
+	}
+}
+
 func TestControlAutoScaleStats_PayloadAfterMagic(t *testing.T) {
 	var buf bytes.Buffer
 	stats := &ControlAutoScaleStats{
@@ -570,3 +756,75 @@ func TestControlAutoScaleStats_InvalidMagic(t *testing.T) {
 		t.Fatal("expected error for invalid magic")
 	}
 }
+
+func TestControlSessionSummary_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	summary := ControlSessionSummary{
+		SessionID: "sess-123",
+		Streams: []StreamTransferStats{
+			{StreamIndex: 0, BytesSent: 1 << 30, RetransmitBytes: 0},
+			{StreamIndex: 3, BytesSent: 5000, RetransmitBytes: 1200},
+		},
+	}
+	if err := WriteControlSessionSummary(&buf, summary); err != nil {
+		t.Fatalf("WriteControlSessionSummary failed: %v", err)
+	}
+
+	magic, _ := ReadControlMagic(&buf)
+	if magic != MagicControlSessionSummary {
+		t.Fatalf("expected CSSM magic, got %q", magic)
+	}
+
+	got, err := ReadControlSessionSummaryPayload(&buf)
+	if err != nil {
+		t.Fatalf("ReadControlSessionSummaryPayload failed: %v", err)
+	}
+	if got.SessionID != summary.SessionID {
+		t.Errorf("session: want %q, got %q", summary.SessionID, got.SessionID)
+	}
+	if len(got.Streams) != len(summary.Streams) {
+		t.Fatalf("streams: want %d, got %d", len(summary.Streams), len(got.Streams))
+	}
+	for i, s := range summary.Streams {
+		if got.Streams[i] != s {
+			t.Errorf("stream %d: want %+v, got %+v", i, s, got.Streams[i])
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected payload fully consumed, %d bytes left", buf.Len())
+	}
+}
+
+func TestControlSessionSummary_Truncated(t *testing.T) {
+	var buf bytes.Buffer
+	WriteControlSessionSummary(&buf, ControlSessionSummary{
+		SessionID: "s",
+		Streams:   []StreamTransferStats{{StreamIndex: 1, BytesSent: 10}},
+	})
+	data := buf.Bytes()[4 : buf.Len()-3]
+	if _, err := ReadControlSessionSummaryPayload(bytes.NewReader(data)); err == nil {
+		t.Fatal("expected error for truncated payload")
+	}
+}
+
+func TestControlSessionCancel_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteControlSessionCancel(&buf, "session-abc"); err != nil {
+		t.Fatalf("WriteControlSessionCancel failed: %v", err)
+	}
+
+	magic, _ := ReadControlMagic(&buf)
+	if magic != MagicControlSessionCancel {
+		t.Fatalf("expected CSCN magic, got %q", magic)
+	}
+	got, err := ReadControlSessionCancelPayload(&buf)
+	if err != nil {
+		t.Fatalf("ReadControlSessionCancelPayload failed: %v", err)
+	}
+	if got != "session-abc" {
+		t.Errorf("session: want %q, got %q", "session-abc", got)
+	}
+	if err := WriteControlSessionCancel(&buf, strings.Repeat("x", 256)); err == nil {
+		t.Error("expected error for sessionID longer than 255 bytes")
+	}
+}
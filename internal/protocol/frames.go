@@ -6,17 +6,23 @@
 // entre agent e server sobre TCP+TLS.
 package protocol
 
-import "errors"
+import (
+	"crypto/sha256"
+	"errors"
+)
 
 // Magic bytes para identificação de frames.
 var (
 	MagicHandshake    = [4]byte{'N', 'B', 'K', 'P'}
 	MagicTrailer      = [4]byte{'D', 'O', 'N', 'E'}
 	MagicPing         = [4]byte{'P', 'I', 'N', 'G'}
+	MagicPingStorage  = [4]byte{'P', 'S', 'T', 'G'}
 	MagicResume       = [4]byte{'R', 'S', 'M', 'E'}
 	MagicSACK         = [4]byte{'S', 'A', 'C', 'K'}
 	MagicParallelJoin = [4]byte{'P', 'J', 'I', 'N'}
 	MagicChunkSACK    = [4]byte{'C', 'S', 'A', 'K'}
+	MagicChunkNACK    = [4]byte{'C', 'N', 'A', 'K'}
+	MagicManifest     = [4]byte{'M', 'N', 'F', 'T'}
 )
 
 // ParallelACK status codes (Server → Client após ParallelJoin).
@@ -34,18 +40,104 @@ const (
 	JoinReasonRotation byte = 0x01 // reconexão intencional por port rotation
 )
 
+// JoinFlagChunkNACK é combinado (OR) ao JoinReasonNone pelo agent que trata
+// ChunkNACK: o server só envia NACKs para streams que o anunciaram. Joins
+// de port rotation não o carregam (servers antigos comparam Flags com
+// JoinReasonRotation) e mantêm o que foi anunciado no join anterior.
+const JoinFlagChunkNACK byte = 0x80
+
+// JoinFlagStreamTrailer é combinado (OR) ao JoinReasonNone pelo agent que
+// envia o StreamTrailer ao fim de cada stream. O server confirma a capacidade
+// com ParallelACKFlagStreamTrailer; sem a confirmação o agent não envia o frame.
+const JoinFlagStreamTrailer byte = 0x40
+
+// JoinFlagServerLoad é combinado (OR) ao JoinReasonNone pelo agent que trata
+// ControlServerLoad: o server só envia o frame no control channel para
+// sessões com algum stream que o anunciou.
+const JoinFlagServerLoad byte = 0x20
+
+// JoinFlagStreamLimit é combinado (OR) ao JoinReasonNone pelo agent que trata
+// ControlStreamLimit: o server só recomenda um teto de streams para sessões
+// com algum stream que o anunciou.
+const JoinFlagStreamLimit byte = 0x10
+
+// JoinReason extrai o motivo do join de Flags, sem os bits de capacidade.
+func JoinReason(flags byte) byte {
+	return flags &^ (JoinFlagChunkNACK | JoinFlagStreamTrailer | JoinFlagServerLoad | JoinFlagStreamLimit)
+}
+
+// ParallelACKFlagStreamTrailer é combinado (OR) ao Status do ParallelACK pelo
+// server que aceita o StreamTrailer — apenas para joins que anunciaram
+// JoinFlagStreamTrailer, então agents antigos nunca o recebem.
+const ParallelACKFlagStreamTrailer byte = 0x80
+
 // ParallelACK representa a resposta do server ao ParallelJoin.
 // Formato: [Status 1B] [LastOffset uint64 8B]
 // LastOffset indica quantos bytes o server já recebeu neste stream (0 para novo, >0 para resume).
+// StreamTrailer reflete ParallelACKFlagStreamTrailer (já removido de Status).
 type ParallelACK struct {
-	Status     byte
-	LastOffset uint64
+	Status        byte
+	LastOffset    uint64
+	StreamTrailer bool
 }
 
 // ProtocolVersion é a versão atual do protocolo.
 // v6: CRC32 per-chunk no ChunkHeader para validação de integridade inline.
 const ProtocolVersion byte = 0x06
 
+// HandshakeVersionSACKWindow é a versão do handshake que negocia a janela de
+// SACK: logo após o ACK GO o agent envia a janela pedida [SACKWindow 12B] e o
+// server responde com a concedida. Os demais frames continuam em
+// ProtocolVersion.
+const HandshakeVersionSACKWindow byte = 0x07
+
+// HandshakeVersionChunkRange é a versão do handshake em que o ParallelInit
+// termina com ChunkSizeMax: o maior Length de chunk que o agent envia com
+// chunk adaptativo. O server recusa chunks maiores antes de alocá-los.
+const HandshakeVersionChunkRange byte = 0x08
+
+// HandshakeVersionSessionProgress é a versão do handshake a partir da qual o
+// server entende o ControlProgress com a sessão (MagicControlSessionProgress):
+// o agent só o envia para sessões negociadas nessa versão ou acima.
+const HandshakeVersionSessionProgress byte = 0x09
+
+// HandshakeVersionSessionAutoScale é a versão do handshake a partir da qual o
+// server entende o ControlAutoScaleStats com a sessão
+// (MagicControlSessionAutoScaleStats): com backups simultâneos, cada sessão
+// paralela reporta as métricas do seu auto-scaler.
+const HandshakeVersionSessionAutoScale byte = 0x0A
+
+// ACKFlagVersion é combinado (OR) ao CompressionMode do ACK pelo server que
+// entende versões acima de ProtocolVersion — apenas para agents que anunciaram
+// uma delas, então agents antigos nunca o recebem. O ACK termina então com
+// [Version 1B], a versão negociada. Um server v6 aceita o handshake de qualquer
+// versão sem ler nada além do formato v6 e responde sem a flag: o agent fala
+// v6 com ele.
+const ACKFlagVersion byte = 0x80
+
+// Limites do intervalo de SACK negociado no handshake.
+const (
+	MinSACKInterval     = 64 * 1024        // 64KB
+	MaxSACKInterval     = 64 * 1024 * 1024 // 64MB
+	DefaultSACKInterval = 4 * 1024 * 1024  // 4MB — usado por agents sem negociação
+)
+
+// SACKWindowSize é o tamanho do SACKWindow no wire.
+const SACKWindowSize = 4 + 8
+
+// SACKWindow é a janela de confirmação de uma sessão single-stream.
+// Formato: [Interval uint32 4B] [MaxInFlight uint64 8B]
+// No handshake é o pedido do agent (0 = default do server); no ACK, o valor
+// concedido pelo server, que o agent passa a respeitar.
+type SACKWindow struct {
+	Interval    uint32 // bytes recebidos entre SACKs
+	MaxInFlight uint64 // bytes enviados e ainda não confirmados (0 = limitado só pelo ring buffer)
+}
+
+// BenchBackupName é o nome de backup das sessões do `nbackup-agent bench`. O
+// server só as aceita em storages do tipo discard, que não commitam os dados.
+const BenchBackupName = "nbackup-bench"
+
 // Status codes para ACK (Server → Client após Handshake).
 const (
 	StatusGo              byte = 0x00 // Pronto para receber
@@ -53,6 +145,11 @@ const (
 	StatusBusy            byte = 0x02 // Backup deste agent já em andamento
 	StatusReject          byte = 0x03 // Agent não autorizado
 	StatusStorageNotFound byte = 0x04 // Storage solicitado não existe
+	StatusOutsideWindow   byte = 0x05 // Handshake fora da backup_window do storage
+	StatusUnauthorized    byte = 0x06 // Certificado revogado ou agent fora de tls.allowed_agents
+	StatusLowSpace        byte = 0x07 // Storage abaixo de min_free_space ou acima da quota
+	StatusReadOnly        byte = 0x08 // Storage somente leitura (disco com saúde degradada)
+	StatusVersionMismatch byte = 0x09 // Versão do handshake fora das aceitas; o ACK traz o intervalo (ver WriteACKVersionMismatch)
 )
 
 // Status codes para Resume ACK (Server → Client após Resume).
@@ -74,6 +171,7 @@ const (
 	HealthStatusBusy        byte = 0x01
 	HealthStatusLowDisk     byte = 0x02
 	HealthStatusMaintenance byte = 0x03
+	HealthStatusNotFound    byte = 0x04 // storage consultado (PSTG) não existe
 )
 
 // Erros do protocolo.
@@ -97,8 +195,11 @@ type Handshake struct {
 type ACK struct {
 	Status          byte
 	Message         string
-	SessionID       string // UUID da sessão (gerado pelo server)
-	CompressionMode byte   // Tipo de compressão negociado (v4+)
+	SessionID       string        // UUID da sessão (gerado pelo server)
+	CompressionMode byte          // Tipo de compressão negociado (v4+)
+	Window          *SACKWindow   // janela concedida (trocada após o ACK GO, preenchida pelo agent)
+	Versions        *VersionRange // versões aceitas pelo server (StatusVersionMismatch)
+	Version         byte          // versão negociada (ACKFlagVersion; ProtocolVersion sem a flag)
 }
 
 // Compression mode constants.
@@ -113,6 +214,19 @@ type Trailer struct {
 	Size     uint64   // Bytes transferidos
 }
 
+// MaxManifestSize limita o tamanho de um frame Manifest aceito pelo server.
+const MaxManifestSize = 1 << 30
+
+// EmptyChecksum é o SHA-256 de um payload vazio.
+var EmptyChecksum = sha256.Sum256(nil)
+
+// IsEmpty indica se o trailer declara um backup vazio: nenhum byte de payload
+// (Size 0) e checksum EmptyChecksum. O agent envia este trailer quando os
+// sources não produzem nenhuma entrada no tar.
+func (t *Trailer) IsEmpty() bool {
+	return t.Size == 0 && t.Checksum == EmptyChecksum
+}
+
 // FinalACK representa a resposta final do server após validação.
 type FinalACK struct {
 	Status byte
@@ -131,12 +245,21 @@ type ResumeACK struct {
 	LastOffset uint64
 }
 
+// ParallelResume complementa o ResumeACK OK de uma sessão paralela: o arquivo
+// montado no server (LastOffset bytes) termina no chunk NextSeq-1, e o agent
+// retoma a numeração dos chunks em NextSeq.
+type ParallelResume struct {
+	NextSeq uint32
+}
+
 // SACK representa um selective acknowledgment do server (offset confirmado).
 type SACK struct {
 	Offset uint64
 }
 
 // HealthResponse representa a resposta do server ao health check.
+// DiskFree é o espaço livre em bytes: o menor entre os storages (PING) ou o
+// do storage consultado (PSTG).
 type HealthResponse struct {
 	Status   byte
 	DiskFree uint64
@@ -145,8 +268,9 @@ type HealthResponse struct {
 // ParallelInit é enviado dentro do handshake para indicar suporte a streams paralelos.
 // Incluído como extensão opcional do Handshake (Client → Server).
 type ParallelInit struct {
-	MaxStreams uint8  // Número máximo de streams paralelos (1-8)
-	ChunkSize  uint32 // Tamanho de cada chunk em bytes
+	MaxStreams   uint8  // Número máximo de streams paralelos (1-8)
+	ChunkSize    uint32 // Tamanho de cada chunk em bytes
+	ChunkSizeMax uint32 // Maior Length de chunk aceito (v8+; antes, igual a ChunkSize)
 }
 
 // Status codes para ParallelInitACK.
@@ -177,6 +301,15 @@ type ChunkSACK struct {
 	Offset      uint64
 }
 
+// ChunkNACK pede a retransmissão de um chunk rejeitado por CRC32 (Server → Client).
+// O server descarta o chunk e não avança o ChunkSACK do stream além dele até
+// a retransmissão chegar.
+// Formato: Magic "CNAK" [4B] [StreamIndex uint8 1B] [GlobalSeq uint32 4B]
+type ChunkNACK struct {
+	StreamIndex uint8
+	GlobalSeq   uint32
+}
+
 // ChunkHeaderSize é o tamanho em bytes do ChunkHeader no wire:
 // GlobalSeq(4B) + Length(4B) + SlotID(1B) + CRC32(4B) = 13 bytes.
 const ChunkHeaderSize = 13
@@ -205,3 +338,42 @@ type ControlSlotPark struct {
 type ControlSlotResume struct {
 	SlotID uint8
 }
+
+// StreamTrailerSeq é o GlobalSeq reservado que identifica o StreamTrailer no
+// lugar de um chunk. O dispatcher nunca atribui essa sequência a dados.
+const StreamTrailerSeq uint32 = 0xFFFFFFFF
+
+// StreamTrailerPayloadSize é o tamanho do payload do StreamTrailer:
+// Chunks(4B) + Bytes(8B).
+const StreamTrailerPayloadSize = 12
+
+// StreamTrailer encerra um stream paralelo (Client → Server) com os totais
+// enviados por ele, para o server detectar um stream truncado na hora em vez
+// de no checksum do commit. Vai no wire com o framing de chunk: um ChunkHeader
+// com GlobalSeq = StreamTrailerSeq, Length = 12, SlotID = StreamIndex e o
+// CRC32 do payload, seguido de [Chunks uint32 4B] [Bytes uint64 8B].
+// Bytes é o offset de wire do stream (headers e retransmissões incluídos, o
+// próprio trailer não) — o mesmo contado pelo server para o resume.
+type StreamTrailer struct {
+	StreamIndex uint8
+	Chunks      uint32 // chunks distintos atribuídos ao stream
+	Bytes       uint64
+}
+
+// Status codes para StreamTrailerACK.
+const (
+	StreamTrailerStatusOK        byte = 0x00 // server recebeu todos os bytes do stream
+	StreamTrailerStatusTruncated byte = 0x01 // faltam bytes após Offset: o agent refaz o join e reenvia
+)
+
+// MagicStreamTrailerACK identifica o StreamTrailerACK.
+var MagicStreamTrailerACK = [4]byte{'S', 'T', 'A', 'K'}
+
+// StreamTrailerACK é a resposta do server ao StreamTrailer (Server → Client).
+// Formato: Magic "STAK" [4B] [StreamIndex uint8 1B] [Status 1B] [Offset uint64 8B]
+// Offset é o offset confirmado do stream no server.
+type StreamTrailerACK struct {
+	StreamIndex uint8
+	Status      byte
+	Offset      uint64
+}
@@ -0,0 +1,395 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+// Fuzz targets dos readers do protocolo. Sem -fuzz, `go test` executa só as
+// sementes (frames válidos gerados pelos writers); para explorar entradas:
+//
+//	go test ./internal/protocol -run '^$' -fuzz '^FuzzReadChunkHeader$' -fuzztime 1m
+//
+// Além de não entrar em pânico com entrada arbitrária, um frame aceito pelo
+// reader, reescrito pelo writer correspondente e relido precisa produzir os
+// mesmos bytes: o reader não aceita nada que o writer não saiba representar.
+
+// fuzzFrame adiciona as sementes e executa o fuzz de read. write reescreve
+// o valor lido (nil = só a ausência de pânico é verificada).
+func fuzzFrame[T any](f *testing.F, read func(io.Reader) (T, error), write func(io.Writer, T) error, seeds ...func(io.Writer) error) {
+	f.Helper()
+	for _, seed := range seeds {
+		var b bytes.Buffer
+		if err := seed(&b); err != nil {
+			f.Fatalf("writing seed: %v", err)
+		}
+		f.Add(b.Bytes())
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, err := read(bytes.NewReader(data))
+		if err != nil || write == nil {
+			return
+		}
+		var first bytes.Buffer
+		if err := write(&first, v); err != nil {
+			t.Fatalf("rewriting accepted frame %x: %v", data, err)
+		}
+		v2, err := read(bytes.NewReader(first.Bytes()))
+		if err != nil {
+			t.Fatalf("re-reading rewritten frame %x: %v", first.Bytes(), err)
+		}
+		var second bytes.Buffer
+		if err := write(&second, v2); err != nil {
+			t.Fatalf("rewriting re-read frame: %v", err)
+		}
+		if !bytes.Equal(first.Bytes(), second.Bytes()) {
+			t.Fatalf("frame not stable across read/write: %x then %x", first.Bytes(), second.Bytes())
+		}
+	})
+}
+
+// payload adapta um writer de frame completo aos readers de payload, cujo
+// magic já foi lido pelo dispatcher: os 4 bytes de magic são descartados.
+func payload(write func(io.Writer) error) func(io.Writer) error {
+	return func(w io.Writer) error {
+		return write(&skipWriter{w: w, skip: 4})
+	}
+}
+
+// skipWriter descarta os primeiros skip bytes escritos.
+type skipWriter struct {
+	w    io.Writer
+	skip int
+}
+
+func (s *skipWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if s.skip > 0 {
+		k := min(s.skip, len(p))
+		s.skip -= k
+		p = p[k:]
+	}
+	if len(p) > 0 {
+		if _, err := s.w.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+func FuzzReadHandshake(f *testing.F) {
+	fuzzFrame(f, ReadHandshake, func(w io.Writer, hs *Handshake) error {
+		return WriteHandshakeVersion(w, hs.Version, hs.AgentName, hs.StorageName, hs.BackupName, hs.ClientVersion)
+	},
+		func(w io.Writer) error { return WriteHandshake(w, "web-01", "app", "daily", "v3.4.0") },
+		func(w io.Writer) error {
+			return WriteHandshakeVersion(w, MaxProtocolVersion, "web-01", "app", "daily", "v3.4.0")
+		},
+	)
+}
+
+func FuzzReadACK(f *testing.F) {
+	fuzzFrame(f, ReadACK, func(w io.Writer, a *ACK) error {
+		if a.Versions != nil {
+			return WriteACKVersionMismatch(w, a.Message, *a.Versions)
+		}
+		if a.Version > ProtocolVersion {
+			return WriteACKVersion(w, a.Status, a.Message, a.SessionID, a.CompressionMode, a.Version)
+		}
+		return WriteACK(w, a.Status, a.Message, a.SessionID, a.CompressionMode)
+	},
+		func(w io.Writer) error { return WriteACK(w, StatusGo, "", "0f3e-41", CompressionGzip) },
+		func(w io.Writer) error { return WriteACK(w, StatusReject, "storage busy", "", CompressionZstd) },
+		func(w io.Writer) error { return WriteACKVersionMismatch(w, "upgrade the agent", SupportedVersions) },
+		func(w io.Writer) error {
+			return WriteACKVersion(w, StatusGo, "", "0f3e-41", CompressionGzip, MaxProtocolVersion)
+		},
+	)
+}
+
+func FuzzReadTrailer(f *testing.F) {
+	fuzzFrame(f, ReadTrailer, func(w io.Writer, t *Trailer) error {
+		return WriteTrailer(w, t.Checksum, t.Size)
+	},
+		func(w io.Writer) error { return WriteTrailer(w, EmptyChecksum, 0) },
+		func(w io.Writer) error { return WriteTrailer(w, [32]byte{1, 2, 3}, 1<<40) },
+	)
+}
+
+func FuzzReadTrailerWithManifest(f *testing.F) {
+	fuzzFrame(f, func(r io.Reader) (*Trailer, error) {
+		t, _, err := ReadTrailerWithManifest(r, io.Discard)
+		return t, err
+	}, nil,
+		func(w io.Writer) error { return WriteTrailer(w, EmptyChecksum, 0) },
+		func(w io.Writer) error {
+			if err := WriteManifest(w, bytes.NewReader([]byte("manifest")), 8); err != nil {
+				return err
+			}
+			return WriteTrailer(w, [32]byte{9}, 4096)
+		},
+	)
+}
+
+func FuzzReadResume(f *testing.F) {
+	fuzzFrame(f, ReadResume, func(w io.Writer, r *Resume) error {
+		return payload(func(w io.Writer) error { return WriteResume(w, r.SessionID, r.AgentName, r.StorageName) })(w)
+	},
+		payload(func(w io.Writer) error { return WriteResume(w, "0f3e-41", "web-01", "app") }),
+	)
+}
+
+func FuzzReadPingStorage(f *testing.F) {
+	fuzzFrame(f, ReadPingStorage, func(w io.Writer, s string) error {
+		return payload(func(w io.Writer) error { return WritePingStorage(w, s) })(w)
+	},
+		payload(func(w io.Writer) error { return WritePingStorage(w, "app") }),
+	)
+}
+
+func FuzzReadParallelInit(f *testing.F) {
+	fuzzFrame(f, ReadParallelInit, func(w io.Writer, pi *ParallelInit) error {
+		return WriteParallelInit(w, pi.MaxStreams, pi.ChunkSize)
+	},
+		func(w io.Writer) error { return WriteParallelInit(w, 8, 1<<20) },
+	)
+}
+
+func FuzzReadParallelJoin(f *testing.F) {
+	fuzzFrame(f, ReadParallelJoin, func(w io.Writer, pj *ParallelJoin) error {
+		return payload(func(w io.Writer) error { return WriteParallelJoin(w, pj.SessionID, pj.StreamIndex, pj.Flags) })(w)
+	},
+		payload(func(w io.Writer) error { return WriteParallelJoin(w, "0f3e-41", 3, 0) }),
+		payload(func(w io.Writer) error { return WriteParallelJoin(w, "0f3e-41", 0, 1) }),
+		// Agent antigo, sem o byte de flags
+		func(w io.Writer) error { _, err := w.Write([]byte{ProtocolVersion, 'a', '\n', 2}); return err },
+	)
+}
+
+func FuzzReadParallelACK(f *testing.F) {
+	fuzzFrame(f, ReadParallelACK, func(w io.Writer, a *ParallelACK) error {
+		status := a.Status
+		if a.StreamTrailer {
+			status |= ParallelACKFlagStreamTrailer
+		}
+		return WriteParallelACK(w, status, a.LastOffset)
+	},
+		func(w io.Writer) error { return WriteParallelACK(w, ParallelStatusOK, 4<<20) },
+		func(w io.Writer) error { return WriteParallelACK(w, ParallelStatusOK|ParallelACKFlagStreamTrailer, 0) },
+	)
+}
+
+func FuzzReadChunkHeader(f *testing.F) {
+	fuzzFrame(f, ReadChunkHeader, func(w io.Writer, h *ChunkHeader) error {
+		return WriteChunkHeader(w, h.GlobalSeq, h.Length, h.SlotID, h.CRC32)
+	},
+		func(w io.Writer) error { return WriteChunkHeader(w, 0, 1<<20, 0, 0xdeadbeef) },
+		func(w io.Writer) error { return WriteChunkHeader(w, StreamTrailerSeq, StreamTrailerPayloadSize, 7, 1) },
+	)
+}
+
+func FuzzReadChunkSACK(f *testing.F) {
+	fuzzFrame(f, ReadChunkSACK, func(w io.Writer, s *ChunkSACK) error {
+		return WriteChunkSACK(w, s.StreamIndex, s.ChunkSeq, s.Offset)
+	},
+		func(w io.Writer) error { return WriteChunkSACK(w, 2, 41, 42<<20) },
+	)
+}
+
+func FuzzReadChunkNACKPayload(f *testing.F) {
+	fuzzFrame(f, ReadChunkNACKPayload, func(w io.Writer, n *ChunkNACK) error {
+		return payload(func(w io.Writer) error { return WriteChunkNACK(w, n.StreamIndex, n.GlobalSeq) })(w)
+	},
+		payload(func(w io.Writer) error { return WriteChunkNACK(w, 1, 12) }),
+	)
+}
+
+func FuzzReadStreamTrailerACKPayload(f *testing.F) {
+	fuzzFrame(f, ReadStreamTrailerACKPayload, func(w io.Writer, a *StreamTrailerACK) error {
+		return payload(func(w io.Writer) error { return WriteStreamTrailerACK(w, a.StreamIndex, a.Status, a.Offset) })(w)
+	},
+		payload(func(w io.Writer) error { return WriteStreamTrailerACK(w, 1, 0, 8<<20) }),
+	)
+}
+
+func FuzzReadRestoreRequest(f *testing.F) {
+	fuzzFrame(f, ReadRestoreRequest, func(w io.Writer, req *RestoreRequest) error {
+		return payload(func(w io.Writer) error { return WriteRestoreRequest(w, *req) })(w)
+	},
+		payload(func(w io.Writer) error {
+			return WriteRestoreRequest(w, RestoreRequest{AgentName: "web-01", StorageName: "app", BackupName: "daily", Path: "etc/hosts"})
+		}),
+	)
+}
+
+func FuzzReadRestoreResponse(f *testing.F) {
+	fuzzFrame(f, func(r io.Reader) (*RestoreResponse, error) {
+		return ReadRestoreResponse(bufio.NewReader(r))
+	}, func(w io.Writer, resp *RestoreResponse) error {
+		return WriteRestoreResponse(w, resp.Status, resp.Archive, resp.Message)
+	},
+		func(w io.Writer) error {
+			return WriteRestoreResponse(w, RestoreStatusOK, "2026-01-01T00-00-00-000.tar.gz", "")
+		},
+	)
+}
+
+func FuzzReadPSKResponse(f *testing.F) {
+	type pskResponse struct {
+		agent string
+		mac   []byte
+	}
+	fuzzFrame(f, func(r io.Reader) (pskResponse, error) {
+		agent, mac, err := ReadPSKResponse(r)
+		return pskResponse{agent, mac}, err
+	}, func(w io.Writer, resp pskResponse) error {
+		return WritePSKResponse(w, resp.agent, resp.mac)
+	},
+		func(w io.Writer) error { return WritePSKResponse(w, "web-01", make([]byte, PSKMACSize)) },
+	)
+}
+
+// FuzzFixedSizeReaders cobre os readers de frames de tamanho fixo sem
+// campos de tamanho: a mesma entrada passa por todos eles.
+func FuzzFixedSizeReaders(f *testing.F) {
+	f.Add([]byte("CPNG\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00"))
+	f.Add([]byte("CROT\x01"))
+	f.Add([]byte("PING"))
+	f.Add([]byte{0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		readers := []func(io.Reader) error{
+			func(r io.Reader) error { _, err := ReadSACKWindow(r); return err },
+			func(r io.Reader) error { _, err := ReadFinalACK(r); return err },
+			ReadPing,
+			func(r io.Reader) error { _, err := ReadHealthResponse(r); return err },
+			func(r io.Reader) error { _, err := ReadSACK(r); return err },
+			func(r io.Reader) error { _, err := ReadResumeACK(r); return err },
+			func(r io.Reader) error { _, err := ReadParallelInitACK(r); return err },
+			func(r io.Reader) error { _, err := ReadParallelInitAfterMaxStreams(r, 4, ProtocolVersion); return err },
+			func(r io.Reader) error {
+				_, err := ReadParallelInitAfterMaxStreams(r, 4, HandshakeVersionChunkRange)
+				return err
+			},
+			func(r io.Reader) error { _, err := ReadChunkSACKPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlSlotParkPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlSlotResumePayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlMagic(r); return err },
+			func(r io.Reader) error { _, err := ReadControlPing(r); return err },
+			func(r io.Reader) error { _, err := ReadControlPingPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlPong(r); return err },
+			func(r io.Reader) error { _, err := ReadControlPongPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlRotate(r); return err },
+			func(r io.Reader) error { _, err := ReadControlRotatePayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlRotateACK(r); return err },
+			func(r io.Reader) error { _, err := ReadControlRotateACKPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlAdmitPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlDeferPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlProgress(r); return err },
+			func(r io.Reader) error { _, err := ReadControlProgressPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlSessionProgressPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlStats(r); return err },
+			func(r io.Reader) error { _, err := ReadControlStatsPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlAutoScaleStats(r); return err },
+			func(r io.Reader) error { _, err := ReadControlSessionAutoScaleStatsPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlAutoScaleStatsPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadControlAssemblyProgressPayload(r); return err },
+			func(r io.Reader) error { _, err := ReadMuxInit(r); return err },
+			func(r io.Reader) error { _, err := ReadMuxACK(r); return err },
+			func(r io.Reader) error { _, err := ReadPSKChallenge(r); return err },
+			func(r io.Reader) error { _, err := ReadPSKResult(r); return err },
+			func(r io.Reader) error { _, err := ReadQUICStreamHeader(r); return err },
+		}
+		for _, read := range readers {
+			read(bytes.NewReader(data))
+		}
+	})
+}
+
+func FuzzReadControlAbortPayload(f *testing.F) {
+	fuzzFrame(f, ReadControlAbortPayload, func(w io.Writer, a *ControlAbort) error {
+		return payload(func(w io.Writer) error { return WriteControlAbort(w, a.Reason, a.SessionID) })(w)
+	},
+		payload(func(w io.Writer) error { return WriteControlAbort(w, AbortReasonDiskFull, "0f3e-41") }),
+	)
+}
+
+func FuzzReadControlSessionSummaryPayload(f *testing.F) {
+	fuzzFrame(f, ReadControlSessionSummaryPayload, func(w io.Writer, s *ControlSessionSummary) error {
+		return payload(func(w io.Writer) error { return WriteControlSessionSummary(w, *s) })(w)
+	},
+		payload(func(w io.Writer) error {
+			return WriteControlSessionSummary(w, ControlSessionSummary{
+				SessionID: "0f3e-41",
+				Streams:   []StreamTransferStats{{StreamIndex: 0, BytesSent: 1 << 30}, {StreamIndex: 1, BytesSent: 1 << 20, RetransmitBytes: 4096}},
+			})
+		}),
+	)
+}
+
+func FuzzReadControlIngestionDonePayload(f *testing.F) {
+	fuzzFrame(f, ReadControlIngestionDonePayload, func(w io.Writer, sid string) error {
+		return payload(func(w io.Writer) error { return WriteControlIngestionDone(w, sid) })(w)
+	},
+		payload(func(w io.Writer) error { return WriteControlIngestionDone(w, "0f3e-41") }),
+	)
+}
+
+func FuzzReadControlSessionCancelPayload(f *testing.F) {
+	fuzzFrame(f, ReadControlSessionCancelPayload, func(w io.Writer, sid string) error {
+		return payload(func(w io.Writer) error { return WriteControlSessionCancel(w, sid) })(w)
+	},
+		payload(func(w io.Writer) error { return WriteControlSessionCancel(w, "0f3e-41") }),
+	)
+}
+
+func FuzzReadControlSnapshotPreparePayload(f *testing.F) {
+	fuzzFrame(f, ReadControlSnapshotPreparePayload, func(w io.Writer, p *ControlSnapshotPrepare) error {
+		return payload(func(w io.Writer) error { return WriteControlSnapshotPrepare(w, p.SnapshotID, p.Backup) })(w)
+	},
+		payload(func(w io.Writer) error { return WriteControlSnapshotPrepare(w, "snap-1", "daily") }),
+	)
+}
+
+func FuzzReadControlSnapshotReadyPayload(f *testing.F) {
+	fuzzFrame(f, ReadControlSnapshotReadyPayload, func(w io.Writer, r *ControlSnapshotReady) error {
+		return payload(func(w io.Writer) error { return WriteControlSnapshotReady(w, r.SnapshotID, r.Status, r.Message) })(w)
+	},
+		payload(func(w io.Writer) error {
+			return WriteControlSnapshotReady(w, "snap-1", SnapshotStatusFailed, "lvcreate failed")
+		}),
+	)
+}
+
+func FuzzReadControlSnapshotReleasePayload(f *testing.F) {
+	fuzzFrame(f, ReadControlSnapshotReleasePayload, func(w io.Writer, r *ControlSnapshotRelease) error {
+		return payload(func(w io.Writer) error { return WriteControlSnapshotRelease(w, r.SnapshotID, r.Proceed) })(w)
+	},
+		payload(func(w io.Writer) error { return WriteControlSnapshotRelease(w, "snap-1", true) }),
+	)
+}
+
+func FuzzReadControlServerLoadPayload(f *testing.F) {
+	fuzzFrame(f, ReadControlServerLoadPayload, func(w io.Writer, l *ControlServerLoad) error {
+		return payload(func(w io.Writer) error { return WriteControlServerLoad(w, l) })(w)
+	},
+		payload(func(w io.Writer) error {
+			return WriteControlServerLoad(w, &ControlServerLoad{SessionID: "0f3e-41", PendingBytes: 64 << 20, WriteLatency: 1500, QueueDepth: 3})
+		}),
+	)
+}
+
+func FuzzReadControlStreamLimitPayload(f *testing.F) {
+	fuzzFrame(f, ReadControlStreamLimitPayload, func(w io.Writer, l *ControlStreamLimit) error {
+		return payload(func(w io.Writer) error { return WriteControlStreamLimit(w, l) })(w)
+	},
+		payload(func(w io.Writer) error {
+			return WriteControlStreamLimit(w, &ControlStreamLimit{SessionID: "0f3e-41", MaxStreams: 4})
+		}),
+	)
+}
@@ -0,0 +1,582 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// MagicMux abre uma conexão multiplexada (parallel_transport: mux): os N
+// streams paralelos de uma sessão trafegam como streams lógicos em uma única
+// conexão TLS, em vez de um socket por stream.
+var MagicMux = [4]byte{'P', 'M', 'U', 'X'}
+
+// MuxVersion é a versão do framing multiplexado.
+const MuxVersion byte = 0x01
+
+// Status codes para o MuxACK (Server → Client após MuxInit).
+const (
+	MuxStatusOK          byte = 0x00
+	MuxStatusUnsupported byte = 0x01 // versão do framing não suportada
+)
+
+// Tipos de frame da conexão multiplexada.
+// Formato: [Type 1B] [StreamID uint32 4B] [Length uint32 4B] [Payload]
+const (
+	muxFrameOpen   byte = 0x01 // Client → Server: abre o stream StreamID (sem payload)
+	muxFrameData   byte = 0x02 // dados do stream (payload de até muxMaxPayload)
+	muxFrameWindow byte = 0x03 // crédito de envio devolvido pelo receptor (payload uint32)
+	muxFrameClose  byte = 0x04 // fecha o stream nos dois sentidos (sem payload)
+)
+
+const (
+	muxHeaderSize = 9
+	muxMaxPayload = 64 << 10 // 64KB por frame de dados
+
+	// muxWindowSize é o crédito inicial de cada stream em cada sentido: o
+	// emissor bloqueia quando o receptor tem esse volume ainda não lido, de
+	// modo que um stream lento não trava os demais na mesma conexão.
+	muxWindowSize = 4 << 20
+
+	// muxMaxStreams limita os streams lógicos abertos ao mesmo tempo em uma
+	// conexão (o índice de stream de uma sessão paralela é um uint8).
+	muxMaxStreams = 256
+
+	// muxWriteTimeout detecta a conexão half-open: um frame que não sai nesse
+	// prazo derruba a conexão inteira.
+	muxWriteTimeout = 30 * time.Second
+)
+
+// Erros da conexão multiplexada.
+var (
+	ErrMuxClosed       = errors.New("protocol: mux connection closed")
+	ErrMuxStreamClosed = errors.New("protocol: mux stream closed by peer")
+)
+
+// WriteMuxInit escreve a abertura da conexão multiplexada (Client → Server).
+// Formato: [Magic "PMUX" 4B] [Version 1B]
+func WriteMuxInit(w io.Writer) error {
+	buf := append(MagicMux[:], MuxVersion)
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("writing mux init: %w", err)
+	}
+	return nil
+}
+
+// ReadMuxInit lê a versão do framing (Server). O magic já foi lido pelo caller.
+func ReadMuxInit(r io.Reader) (byte, error) {
+	var version [1]byte
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return 0, fmt.Errorf("reading mux version: %w", err)
+	}
+	return version[0], nil
+}
+
+// WriteMuxACK escreve a resposta à abertura da conexão multiplexada (Server → Client).
+// Formato: [Status 1B]
+func WriteMuxACK(w io.Writer, status byte) error {
+	if _, err := w.Write([]byte{status}); err != nil {
+		return fmt.Errorf("writing mux ack: %w", err)
+	}
+	return nil
+}
+
+// ReadMuxACK lê a resposta do server à abertura da conexão multiplexada.
+func ReadMuxACK(r io.Reader) (byte, error) {
+	var status [1]byte
+	if _, err := io.ReadFull(r, status[:]); err != nil {
+		return 0, fmt.Errorf("reading mux ack: %w", err)
+	}
+	return status[0], nil
+}
+
+// MuxSession multiplexa streams lógicos sobre uma conexão. Apenas o client
+// abre streams (Open); o server os recebe com Accept. Cada stream tem controle
+// de fluxo próprio (janela de muxWindowSize), e a queda da conexão encerra
+// todos os streams com ErrMuxClosed.
+type MuxSession struct {
+	conn   net.Conn
+	client bool
+
+	writeMu sync.Mutex
+	wbuf    []byte // frame montado sob writeMu (um único Write por frame)
+
+	mu      sync.Mutex
+	streams map[uint32]*MuxStream
+	nextID  uint32
+	err     error // causa do fechamento
+
+	acceptCh  chan *MuxStream
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMuxClient cria o lado client de uma conexão multiplexada já aberta
+// (MuxInit/MuxACK trocados).
+func NewMuxClient(conn net.Conn) *MuxSession {
+	return newMuxSession(conn, true)
+}
+
+// NewMuxServer cria o lado server de uma conexão multiplexada já aberta.
+func NewMuxServer(conn net.Conn) *MuxSession {
+	return newMuxSession(conn, false)
+}
+
+func newMuxSession(conn net.Conn, client bool) *MuxSession {
+	s := &MuxSession{
+		conn:     conn,
+		client:   client,
+		wbuf:     make([]byte, muxHeaderSize+muxMaxPayload),
+		streams:  make(map[uint32]*MuxStream),
+		acceptCh: make(chan *MuxStream, muxMaxStreams),
+		closed:   make(chan struct{}),
+	}
+	go s.recvLoop()
+	return s
+}
+
+// Open abre um novo stream lógico (client).
+func (s *MuxSession) Open() (*MuxStream, error) {
+	if !s.client {
+		return nil, errors.New("protocol: only the mux client opens streams")
+	}
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, ErrMuxClosed
+	}
+	s.nextID++
+	st := newMuxStream(s.nextID, s)
+	s.streams[st.id] = st
+	s.mu.Unlock()
+
+	if err := s.writeFrame(muxFrameOpen, st.id, nil); err != nil {
+		s.removeStream(st.id)
+		return nil, err
+	}
+	return st, nil
+}
+
+// Accept aguarda o próximo stream aberto pelo client (server). Retorna
+// ErrMuxClosed quando a conexão é encerrada.
+func (s *MuxSession) Accept() (*MuxStream, error) {
+	select {
+	case st := <-s.acceptCh:
+		return st, nil
+	case <-s.closed:
+		return nil, ErrMuxClosed
+	}
+}
+
+// Close encerra a conexão e todos os streams.
+func (s *MuxSession) Close() error {
+	s.closeWithErr(ErrMuxClosed)
+	return nil
+}
+
+// IsClosed indica se a conexão foi encerrada.
+func (s *MuxSession) IsClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Err retorna a causa do encerramento da conexão (nil enquanto aberta).
+func (s *MuxSession) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// NumStreams retorna o número de streams lógicos abertos.
+func (s *MuxSession) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+func (s *MuxSession) closeWithErr(cause error) {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.err = cause
+		streams := s.streams
+		s.streams = make(map[uint32]*MuxStream)
+		s.mu.Unlock()
+
+		close(s.closed)
+		s.conn.Close()
+		for _, st := range streams {
+			st.fail(ErrMuxClosed)
+		}
+	})
+}
+
+func (s *MuxSession) stream(id uint32) *MuxStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id]
+}
+
+func (s *MuxSession) removeStream(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
+
+// writeFrame serializa um frame na conexão. Uma falha de escrita derruba a
+// conexão: o framing não pode ser retomado no meio de um frame.
+func (s *MuxSession) writeFrame(typ byte, id uint32, payload []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.IsClosed() {
+		return ErrMuxClosed
+	}
+
+	frame := s.wbuf[:muxHeaderSize+len(payload)]
+	frame[0] = typ
+	binary.BigEndian.PutUint32(frame[1:5], id)
+	binary.BigEndian.PutUint32(frame[5:9], uint32(len(payload)))
+	copy(frame[muxHeaderSize:], payload)
+
+	s.conn.SetWriteDeadline(time.Now().Add(muxWriteTimeout))
+	if _, err := s.conn.Write(frame); err != nil {
+		s.closeWithErr(fmt.Errorf("writing mux frame: %w", err))
+		return ErrMuxClosed
+	}
+	return nil
+}
+
+// recvLoop lê os frames da conexão e os entrega aos streams.
+func (s *MuxSession) recvLoop() {
+	hdr := make([]byte, muxHeaderSize)
+	for {
+		if _, err := io.ReadFull(s.conn, hdr); err != nil {
+			s.closeWithErr(err)
+			return
+		}
+		typ := hdr[0]
+		id := binary.BigEndian.Uint32(hdr[1:5])
+		length := binary.BigEndian.Uint32(hdr[5:9])
+
+		var err error
+		switch typ {
+		case muxFrameOpen:
+			if s.client || length != 0 {
+				err = fmt.Errorf("protocol: unexpected mux open frame for stream %d", id)
+				break
+			}
+			s.accept(id)
+		case muxFrameData:
+			if length > muxMaxPayload {
+				err = fmt.Errorf("protocol: mux data frame of %d bytes exceeds %d", length, muxMaxPayload)
+				break
+			}
+			st := s.stream(id)
+			if st == nil {
+				// Stream já fechado localmente: descarta os dados em trânsito
+				_, err = io.CopyN(io.Discard, s.conn, int64(length))
+				break
+			}
+			data := make([]byte, length)
+			if _, err = io.ReadFull(s.conn, data); err != nil {
+				break
+			}
+			err = st.push(data)
+		case muxFrameWindow:
+			if length != 4 {
+				err = fmt.Errorf("protocol: invalid mux window frame length %d", length)
+				break
+			}
+			var credit [4]byte
+			if _, err = io.ReadFull(s.conn, credit[:]); err != nil {
+				break
+			}
+			if st := s.stream(id); st != nil {
+				st.addCredit(binary.BigEndian.Uint32(credit[:]))
+			}
+		case muxFrameClose:
+			if length != 0 {
+				err = fmt.Errorf("protocol: invalid mux close frame length %d", length)
+				break
+			}
+			if st := s.stream(id); st != nil {
+				s.removeStream(id)
+				st.remoteClose()
+			}
+		default:
+			err = fmt.Errorf("protocol: unknown mux frame type 0x%02x", typ)
+		}
+		if err != nil {
+			s.closeWithErr(err)
+			return
+		}
+	}
+}
+
+// accept registra um stream aberto pelo client. Acima de muxMaxStreams o
+// stream é recusado com um frame Close.
+func (s *MuxSession) accept(id uint32) {
+	s.mu.Lock()
+	if _, dup := s.streams[id]; dup || len(s.streams) >= muxMaxStreams {
+		s.mu.Unlock()
+		s.writeFrame(muxFrameClose, id, nil)
+		return
+	}
+	st := newMuxStream(id, s)
+	s.streams[id] = st
+	s.mu.Unlock()
+
+	select {
+	case s.acceptCh <- st:
+	default:
+		s.removeStream(id)
+		s.writeFrame(muxFrameClose, id, nil)
+	}
+}
+
+// MuxStream é um stream lógico de uma MuxSession. Implementa net.Conn.
+type MuxStream struct {
+	id   uint32
+	sess *MuxSession
+
+	mu            sync.Mutex
+	buf           []byte // recebido e ainda não lido
+	consumed      int    // lido desde o último crédito devolvido
+	credit        int    // bytes que ainda podem ser enviados
+	remoteClosed  bool   // Close recebido: Read retorna EOF após o buffer
+	localClosed   bool
+	err           error // conexão encerrada
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	readNotify  chan struct{}
+	writeNotify chan struct{}
+}
+
+func newMuxStream(id uint32, sess *MuxSession) *MuxStream {
+	return &MuxStream{
+		id:          id,
+		sess:        sess,
+		credit:      muxWindowSize,
+		readNotify:  make(chan struct{}, 1),
+		writeNotify: make(chan struct{}, 1),
+	}
+}
+
+// ID retorna o identificador do stream na conexão.
+func (st *MuxStream) ID() uint32 {
+	return st.id
+}
+
+// Read lê dados do stream. Após o Close do peer, os dados já recebidos são
+// entregues antes do io.EOF.
+func (st *MuxStream) Read(p []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		if st.localClosed {
+			st.mu.Unlock()
+			return 0, net.ErrClosed
+		}
+		if len(st.buf) > 0 {
+			n := copy(p, st.buf)
+			st.buf = st.buf[n:]
+			st.consumed += n
+			var credit int
+			if st.consumed >= muxWindowSize/2 && !st.remoteClosed && st.err == nil {
+				credit, st.consumed = st.consumed, 0
+			}
+			st.mu.Unlock()
+			if credit > 0 {
+				var payload [4]byte
+				binary.BigEndian.PutUint32(payload[:], uint32(credit))
+				st.sess.writeFrame(muxFrameWindow, st.id, payload[:])
+			}
+			return n, nil
+		}
+		if st.remoteClosed {
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		if st.err != nil {
+			err := st.err
+			st.mu.Unlock()
+			return 0, err
+		}
+		deadline := st.readDeadline
+		st.mu.Unlock()
+
+		if err := waitNotify(st.readNotify, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write envia p em frames de dados, bloqueando enquanto o receptor não
+// devolve crédito.
+func (st *MuxStream) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		st.mu.Lock()
+		switch {
+		case st.localClosed:
+			st.mu.Unlock()
+			return written, net.ErrClosed
+		case st.remoteClosed:
+			st.mu.Unlock()
+			return written, ErrMuxStreamClosed
+		case st.err != nil:
+			err := st.err
+			st.mu.Unlock()
+			return written, err
+		}
+		if st.credit == 0 {
+			deadline := st.writeDeadline
+			st.mu.Unlock()
+			if err := waitNotify(st.writeNotify, deadline); err != nil {
+				return written, err
+			}
+			continue
+		}
+		n := min(len(p)-written, st.credit, muxMaxPayload)
+		st.credit -= n
+		st.mu.Unlock()
+
+		if err := st.sess.writeFrame(muxFrameData, st.id, p[written:written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// Close fecha o stream nos dois sentidos e avisa o peer.
+func (st *MuxStream) Close() error {
+	st.mu.Lock()
+	if st.localClosed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.localClosed = true
+	notifyPeer := !st.remoteClosed && st.err == nil
+	st.buf = nil
+	st.mu.Unlock()
+	notify(st.readNotify)
+	notify(st.writeNotify)
+
+	st.sess.removeStream(st.id)
+	if notifyPeer {
+		st.sess.writeFrame(muxFrameClose, st.id, nil)
+	}
+	return nil
+}
+
+// LocalAddr retorna o endereço local da conexão multiplexada.
+func (st *MuxStream) LocalAddr() net.Addr { return st.sess.conn.LocalAddr() }
+
+// RemoteAddr retorna o endereço remoto da conexão multiplexada.
+func (st *MuxStream) RemoteAddr() net.Addr { return st.sess.conn.RemoteAddr() }
+
+// SetDeadline define os deadlines de leitura e escrita do stream.
+func (st *MuxStream) SetDeadline(t time.Time) error {
+	st.SetReadDeadline(t)
+	return st.SetWriteDeadline(t)
+}
+
+// SetReadDeadline define o deadline de leitura do stream.
+func (st *MuxStream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	notify(st.readNotify)
+	return nil
+}
+
+// SetWriteDeadline define o deadline da espera por crédito de envio. A
+// escrita de um frame na conexão é limitada por muxWriteTimeout.
+func (st *MuxStream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	notify(st.writeNotify)
+	return nil
+}
+
+// push entrega dados recebidos. Exceder a janela é erro de protocolo.
+func (st *MuxStream) push(data []byte) error {
+	st.mu.Lock()
+	if st.localClosed {
+		st.mu.Unlock()
+		return nil
+	}
+	if len(st.buf)+st.consumed+len(data) > muxWindowSize {
+		st.mu.Unlock()
+		return fmt.Errorf("protocol: mux stream %d exceeded its receive window", st.id)
+	}
+	st.buf = append(st.buf, data...)
+	st.mu.Unlock()
+	notify(st.readNotify)
+	return nil
+}
+
+func (st *MuxStream) addCredit(n uint32) {
+	st.mu.Lock()
+	st.credit += int(n)
+	st.mu.Unlock()
+	notify(st.writeNotify)
+}
+
+func (st *MuxStream) remoteClose() {
+	st.mu.Lock()
+	st.remoteClosed = true
+	st.mu.Unlock()
+	notify(st.readNotify)
+	notify(st.writeNotify)
+}
+
+func (st *MuxStream) fail(err error) {
+	st.mu.Lock()
+	st.err = err
+	st.mu.Unlock()
+	notify(st.readNotify)
+	notify(st.writeNotify)
+}
+
+// notify acorda quem espera em ch sem bloquear.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// waitNotify espera um aviso em ch ou o deadline (zero = sem deadline).
+func waitNotify(ch chan struct{}, deadline time.Time) error {
+	if deadline.IsZero() {
+		<-ch
+		return nil
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		return os.ErrDeadlineExceeded
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ch:
+		return nil
+	case <-t.C:
+		return os.ErrDeadlineExceeded
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func newMuxPair(t *testing.T) (*MuxSession, *MuxSession) {
+	t.Helper()
+	c, s := net.Pipe()
+	client, server := NewMuxClient(c), NewMuxServer(s)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestMux_OpenAcceptAndClose(t *testing.T) {
+	client, server := newMuxPair(t)
+
+	cs, err := client.Open()
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := cs.Write([]byte("PJIN hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	ss, err := server.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(ss, buf); err != nil || string(buf) != "PJIN hello" {
+		t.Fatalf("server read %q (%v)", buf, err)
+	}
+	if _, err := ss.Write([]byte("ack")); err != nil {
+		t.Fatalf("server Write: %v", err)
+	}
+	if _, err := io.ReadFull(cs, buf[:3]); err != nil || string(buf[:3]) != "ack" {
+		t.Fatalf("client read %q (%v)", buf[:3], err)
+	}
+
+	// Dados enviados antes do Close são entregues antes do EOF
+	cs.Write([]byte("tail"))
+	cs.Close()
+	if data, err := io.ReadAll(ss); err != nil || string(data) != "tail" {
+		t.Fatalf("expected tail then EOF, got %q (%v)", data, err)
+	}
+	if _, err := ss.Write([]byte("x")); !errors.Is(err, ErrMuxStreamClosed) {
+		t.Errorf("write after peer close: expected ErrMuxStreamClosed, got %v", err)
+	}
+	if _, err := cs.Write([]byte("x")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("write after local close: expected net.ErrClosed, got %v", err)
+	}
+}
+
+func TestMux_FlowControlIsPerStream(t *testing.T) {
+	client, server := newMuxPair(t)
+
+	// Stream A: o server não lê, então o emissor para na janela
+	a, _ := client.Open()
+	payload := bytes.Repeat([]byte("0123456789abcdef"), (muxWindowSize+muxMaxPayload*3)/16)
+	written := make(chan error, 1)
+	go func() {
+		_, err := a.Write(payload)
+		written <- err
+	}()
+	sa, _ := server.Accept()
+
+	// Stream B continua fluindo com A bloqueado
+	b, _ := client.Open()
+	b.Write([]byte("ping"))
+	sb, _ := server.Accept()
+	buf := make([]byte, 4)
+	sb.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(sb, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("stream B blocked by stream A: %q (%v)", buf, err)
+	}
+	select {
+	case err := <-written:
+		t.Fatalf("write beyond the window should block, returned %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Ao ler A, o crédito volta e o restante chega íntegro
+	got := make([]byte, len(payload))
+	if _, err := io.ReadFull(sa, got); err != nil {
+		t.Fatalf("reading stream A: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Error("stream A payload corrupted")
+	}
+	if err := <-written; err != nil {
+		t.Errorf("stream A write: %v", err)
+	}
+}
+
+func TestMux_DeadlinesAndSessionClose(t *testing.T) {
+	client, server := newMuxPair(t)
+
+	cs, _ := client.Open()
+	cs.Write([]byte("x"))
+	ss, _ := server.Accept()
+	io.ReadFull(ss, make([]byte, 1))
+
+	ss.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := ss.Read(make([]byte, 1))
+	var netErr net.Error
+	if !errors.Is(err, os.ErrDeadlineExceeded) || !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+
+	// A queda da conexão encerra todos os streams
+	server.Close()
+	if _, err := cs.Read(make([]byte, 1)); !errors.Is(err, ErrMuxClosed) {
+		t.Errorf("expected ErrMuxClosed on read, got %v", err)
+	}
+	if _, err := client.Open(); err == nil {
+		t.Error("Open on a closed session should fail")
+	}
+	if !client.IsClosed() || client.NumStreams() != 0 {
+		t.Errorf("client session should be closed and empty (streams=%d)", client.NumStreams())
+	}
+}
+
+func TestMuxInit_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMuxInit(&buf); err != nil {
+		t.Fatal(err)
+	}
+	magic := make([]byte, 4)
+	io.ReadFull(&buf, magic)
+	if string(magic) != string(MagicMux[:]) {
+		t.Fatalf("expected magic PMUX, got %q", magic)
+	}
+	if v, err := ReadMuxInit(&buf); err != nil || v != MuxVersion {
+		t.Fatalf("ReadMuxInit: %d (%v)", v, err)
+	}
+	WriteMuxACK(&buf, MuxStatusOK)
+	if s, err := ReadMuxACK(&buf); err != nil || s != MuxStatusOK {
+		t.Fatalf("ReadMuxACK: %d (%v)", s, err)
+	}
+}
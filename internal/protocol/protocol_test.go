@@ -5,9 +5,12 @@
 package protocol
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/sha256"
+	"errors"
 	"hash/crc32"
+	"io"
 	"testing"
 )
 
@@ -44,6 +47,60 @@ func TestHandshake_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestHandshakeVersion_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHandshakeVersion(&buf, MaxProtocolVersion, "web-server-01", "scripts", "app", "v1.2.3"); err != nil {
+		t.Fatalf("WriteHandshakeVersion: %v", err)
+	}
+
+	hs, err := ReadHandshake(&buf)
+	if err != nil {
+		t.Fatalf("ReadHandshake: %v", err)
+	}
+	if hs.Version != MaxProtocolVersion {
+		t.Errorf("expected version %d, got %d", MaxProtocolVersion, hs.Version)
+	}
+	if hs.ClientVersion != "v1.2.3" {
+		t.Errorf("expected client version v1.2.3, got %q", hs.ClientVersion)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no bytes after the v6 layout, got %d", buf.Len())
+	}
+}
+
+func TestACKVersion_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteACKVersion(&buf, StatusGo, "", "abc-123", CompressionZstd, HandshakeVersionChunkRange); err != nil {
+		t.Fatalf("WriteACKVersion: %v", err)
+	}
+
+	ack, err := ReadACK(&buf)
+	if err != nil {
+		t.Fatalf("ReadACK: %v", err)
+	}
+	if ack.Status != StatusGo || ack.SessionID != "abc-123" || ack.CompressionMode != CompressionZstd {
+		t.Errorf("unexpected ack: %+v", ack)
+	}
+	if ack.Version != HandshakeVersionChunkRange {
+		t.Errorf("expected version %d, got %d", HandshakeVersionChunkRange, ack.Version)
+	}
+}
+
+func TestSACKWindow_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	win := SACKWindow{Interval: 8 * 1024 * 1024, MaxInFlight: 64 * 1024 * 1024}
+	if err := WriteSACKWindow(&buf, win); err != nil {
+		t.Fatalf("WriteSACKWindow: %v", err)
+	}
+	got, err := ReadSACKWindow(&buf)
+	if err != nil {
+		t.Fatalf("ReadSACKWindow: %v", err)
+	}
+	if *got != win {
+		t.Errorf("expected window %+v, got %+v", win, *got)
+	}
+}
+
 func TestACK_RoundTrip(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -111,6 +168,48 @@ func TestTrailer_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestTrailerWithManifest_RoundTrip(t *testing.T) {
+	checksum := sha256.Sum256([]byte("test data"))
+	manifest := []byte("{\"path\":\"etc/hosts\"}\n")
+
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, bytes.NewReader(manifest), int64(len(manifest))); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	if err := WriteTrailer(&buf, checksum, 42); err != nil {
+		t.Fatalf("WriteTrailer: %v", err)
+	}
+
+	var got bytes.Buffer
+	trailer, hasManifest, err := ReadTrailerWithManifest(&buf, &got)
+	if err != nil {
+		t.Fatalf("ReadTrailerWithManifest: %v", err)
+	}
+	if !hasManifest || !bytes.Equal(got.Bytes(), manifest) {
+		t.Errorf("manifest mismatch: has=%v got=%q", hasManifest, got.Bytes())
+	}
+	if trailer.Checksum != checksum || trailer.Size != 42 {
+		t.Errorf("unexpected trailer: %+v", trailer)
+	}
+
+	// Sem frame Manifest: trailer puro, nada copiado
+	buf.Reset()
+	got.Reset()
+	WriteTrailer(&buf, checksum, 7)
+	trailer, hasManifest, err = ReadTrailerWithManifest(&buf, &got)
+	if err != nil || hasManifest || got.Len() != 0 || trailer.Size != 7 {
+		t.Errorf("plain trailer: trailer=%+v has=%v copied=%d err=%v", trailer, hasManifest, got.Len(), err)
+	}
+
+	// Manifest acima do limite é rejeitado antes da cópia
+	buf.Reset()
+	buf.Write(MagicManifest[:])
+	buf.Write([]byte{0, 0, 0, 1, 0, 0, 0, 0})
+	if _, _, err := ReadTrailerWithManifest(&buf, io.Discard); err == nil {
+		t.Error("expected error for oversized manifest")
+	}
+}
+
 func TestFinalACK_RoundTrip(t *testing.T) {
 	statuses := []byte{FinalStatusOK, FinalStatusChecksumMismatch, FinalStatusWriteError}
 
@@ -164,6 +263,26 @@ func TestHealthCheck_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestPingStorage_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePingStorage(&buf, "scripts"); err != nil {
+		t.Fatalf("WritePingStorage: %v", err)
+	}
+
+	var magic [4]byte
+	io.ReadFull(&buf, magic[:])
+	if magic != MagicPingStorage {
+		t.Fatalf("expected PSTG magic, got %q", magic)
+	}
+	name, err := ReadPingStorage(&buf)
+	if err != nil {
+		t.Fatalf("ReadPingStorage: %v", err)
+	}
+	if name != "scripts" {
+		t.Errorf("expected storage scripts, got %q", name)
+	}
+}
+
 func TestHandshake_InvalidMagic(t *testing.T) {
 	var buf bytes.Buffer
 	buf.Write([]byte("XXXX")) // magic errado
@@ -348,6 +467,32 @@ func TestResumeACK_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestParallelResume_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := WriteResumeACK(&buf, ResumeStatusOK, 3<<20); err != nil {
+		t.Fatalf("WriteResumeACK: %v", err)
+	}
+	if err := WriteParallelResume(&buf, 3); err != nil {
+		t.Fatalf("WriteParallelResume: %v", err)
+	}
+
+	rACK, err := ReadResumeACK(&buf)
+	if err != nil {
+		t.Fatalf("ReadResumeACK: %v", err)
+	}
+	pr, err := ReadParallelResume(&buf)
+	if err != nil {
+		t.Fatalf("ReadParallelResume: %v", err)
+	}
+	if rACK.LastOffset != 3<<20 || pr.NextSeq != 3 {
+		t.Errorf("expected offset %d and next seq 3, got %d and %d", 3<<20, rACK.LastOffset, pr.NextSeq)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no trailing bytes, got %d", buf.Len())
+	}
+}
+
 func TestParallelInit_RoundTrip(t *testing.T) {
 	var buf bytes.Buffer
 
@@ -369,6 +514,37 @@ func TestParallelInit_RoundTrip(t *testing.T) {
 	if pi.ChunkSize != chunkSize {
 		t.Errorf("expected chunkSize %d, got %d", chunkSize, pi.ChunkSize)
 	}
+	if pi.ChunkSizeMax != chunkSize {
+		t.Errorf("expected chunkSizeMax to default to chunkSize, got %d", pi.ChunkSizeMax)
+	}
+}
+
+func TestParallelInitRange_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteParallelInitRange(&buf, 4, 1<<20, 8<<20); err != nil {
+		t.Fatalf("WriteParallelInitRange: %v", err)
+	}
+	// MaxStreams(1) + ChunkSize(4) + ChunkSizeMax(4) = 9 bytes
+	if buf.Len() != 9 {
+		t.Fatalf("expected ParallelInit v8 size 9, got %d", buf.Len())
+	}
+
+	maxStreams, _ := buf.ReadByte()
+	pi, err := ReadParallelInitAfterMaxStreams(&buf, maxStreams, HandshakeVersionChunkRange)
+	if err != nil {
+		t.Fatalf("ReadParallelInitAfterMaxStreams: %v", err)
+	}
+	if pi.MaxStreams != 4 || pi.ChunkSize != 1<<20 || pi.ChunkSizeMax != 8<<20 {
+		t.Errorf("unexpected ParallelInit %+v", pi)
+	}
+
+	// ChunkSizeMax abaixo do ChunkSize é inválido
+	buf.Reset()
+	WriteParallelInitRange(&buf, 4, 1<<20, 64<<10)
+	buf.ReadByte()
+	if _, err := ReadParallelInitAfterMaxStreams(&buf, 4, HandshakeVersionChunkRange); err == nil {
+		t.Error("expected error for chunk size max below chunk size")
+	}
 }
 
 func TestParallelInit_FrameSize(t *testing.T) {
@@ -519,6 +695,30 @@ func TestChunkSACK_InvalidMagic(t *testing.T) {
 	}
 }
 
+func TestChunkNACK_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteChunkNACK(&buf, 2, 70000); err != nil {
+		t.Fatalf("WriteChunkNACK: %v", err)
+	}
+	// Magic(4) + StreamIndex(1) + GlobalSeq(4) = 9 bytes
+	if buf.Len() != 9 {
+		t.Fatalf("expected ChunkNACK size 9, got %d", buf.Len())
+	}
+
+	var magic [4]byte
+	io.ReadFull(&buf, magic[:])
+	if magic != MagicChunkNACK {
+		t.Fatalf("expected magic CNAK, got %q", magic)
+	}
+	nack, err := ReadChunkNACKPayload(&buf)
+	if err != nil {
+		t.Fatalf("ReadChunkNACKPayload: %v", err)
+	}
+	if nack.StreamIndex != 2 || nack.GlobalSeq != 70000 {
+		t.Errorf("unexpected ChunkNACK: %+v", nack)
+	}
+}
+
 func TestParallelACK_RoundTrip(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -554,6 +754,97 @@ func TestParallelACK_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestParallelACK_StreamTrailerFlag(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteParallelACK(&buf, ParallelStatusOK|ParallelACKFlagStreamTrailer, 4096); err != nil {
+		t.Fatalf("WriteParallelACK: %v", err)
+	}
+	got, err := ReadParallelACK(&buf)
+	if err != nil {
+		t.Fatalf("ReadParallelACK: %v", err)
+	}
+	if got.Status != ParallelStatusOK || !got.StreamTrailer || got.LastOffset != 4096 {
+		t.Errorf("unexpected ParallelACK: %+v", got)
+	}
+
+	// Server antigo: sem o bit, StreamTrailer fica desligado
+	buf.Reset()
+	WriteParallelACK(&buf, ParallelStatusOK, 0)
+	if got, _ := ReadParallelACK(&buf); got.StreamTrailer {
+		t.Error("expected StreamTrailer false without the ACK flag")
+	}
+}
+
+func TestJoinReason_MasksCapabilityFlags(t *testing.T) {
+	if got := JoinReason(JoinReasonNone | JoinFlagChunkNACK | JoinFlagStreamTrailer); got != JoinReasonNone {
+		t.Errorf("expected JoinReasonNone, got %d", got)
+	}
+	if got := JoinReason(JoinReasonRotation); got != JoinReasonRotation {
+		t.Errorf("expected JoinReasonRotation, got %d", got)
+	}
+}
+
+func TestStreamTrailer_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteStreamTrailer(&buf, 3, 42, 1<<33); err != nil {
+		t.Fatalf("WriteStreamTrailer: %v", err)
+	}
+	if buf.Len() != ChunkHeaderSize+StreamTrailerPayloadSize {
+		t.Fatalf("expected StreamTrailer size %d, got %d", ChunkHeaderSize+StreamTrailerPayloadSize, buf.Len())
+	}
+
+	// O server lê o trailer como um chunk: header primeiro, depois o payload
+	hdr, err := ReadChunkHeader(&buf)
+	if err != nil {
+		t.Fatalf("ReadChunkHeader: %v", err)
+	}
+	if hdr.GlobalSeq != StreamTrailerSeq || hdr.SlotID != 3 {
+		t.Fatalf("unexpected trailer header: %+v", hdr)
+	}
+	payload := make([]byte, hdr.Length)
+	io.ReadFull(&buf, payload)
+
+	st, err := ParseStreamTrailer(hdr, payload)
+	if err != nil {
+		t.Fatalf("ParseStreamTrailer: %v", err)
+	}
+	if st.StreamIndex != 3 || st.Chunks != 42 || st.Bytes != 1<<33 {
+		t.Errorf("unexpected StreamTrailer: %+v", st)
+	}
+
+	payload[0] ^= 0xFF
+	if _, err := ParseStreamTrailer(hdr, payload); !errors.Is(err, ErrChunkCRCMismatch) {
+		t.Errorf("expected ErrChunkCRCMismatch for corrupted payload, got %v", err)
+	}
+	if _, err := ParseStreamTrailer(hdr, payload[:8]); !errors.Is(err, ErrTruncatedFrame) {
+		t.Errorf("expected ErrTruncatedFrame for short payload, got %v", err)
+	}
+}
+
+func TestStreamTrailerACK_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteStreamTrailerACK(&buf, 1, StreamTrailerStatusTruncated, 70000); err != nil {
+		t.Fatalf("WriteStreamTrailerACK: %v", err)
+	}
+	// Magic(4) + StreamIndex(1) + Status(1) + Offset(8) = 14 bytes
+	if buf.Len() != 14 {
+		t.Fatalf("expected StreamTrailerACK size 14, got %d", buf.Len())
+	}
+
+	var magic [4]byte
+	io.ReadFull(&buf, magic[:])
+	if magic != MagicStreamTrailerACK {
+		t.Fatalf("expected magic STAK, got %q", magic)
+	}
+	ack, err := ReadStreamTrailerACKPayload(&buf)
+	if err != nil {
+		t.Fatalf("ReadStreamTrailerACKPayload: %v", err)
+	}
+	if ack.StreamIndex != 1 || ack.Status != StreamTrailerStatusTruncated || ack.Offset != 70000 {
+		t.Errorf("unexpected StreamTrailerACK: %+v", ack)
+	}
+}
+
 func TestChunkHeader_RoundTrip(t *testing.T) {
 	var buf bytes.Buffer
 
@@ -761,3 +1052,79 @@ func TestChunkHeader_CRC32MismatchDetection(t *testing.T) {
 	}
 }
 
+
+func TestPSKFrames_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	var nonce [PSKNonceSize]byte
+	for i := range nonce {
+		nonce[i] = byte(i)
+	}
+	if err := WritePSKChallenge(&buf, nonce); err != nil {
+		t.Fatalf("WritePSKChallenge: %v", err)
+	}
+	gotNonce, err := ReadPSKChallenge(&buf)
+	if err != nil || gotNonce != nonce {
+		t.Fatalf("ReadPSKChallenge: nonce=%x err=%v", gotNonce, err)
+	}
+
+	mac := bytes.Repeat([]byte{0xAB}, PSKMACSize)
+	if err := WritePSKResponse(&buf, "web-01", mac); err != nil {
+		t.Fatalf("WritePSKResponse: %v", err)
+	}
+	agent, gotMAC, err := ReadPSKResponse(&buf)
+	if err != nil || agent != "web-01" || !bytes.Equal(gotMAC, mac) {
+		t.Fatalf("ReadPSKResponse: agent=%q mac=%x err=%v", agent, gotMAC, err)
+	}
+
+	WritePSKResult(&buf, PSKStatusUnauthorized)
+	if status, err := ReadPSKResult(&buf); err != nil || status != PSKStatusUnauthorized {
+		t.Fatalf("ReadPSKResult: status=%d err=%v", status, err)
+	}
+
+	if err := WritePSKResponse(&buf, "", mac); err == nil {
+		t.Error("expected error for empty agent name")
+	}
+	if _, err := ReadPSKChallenge(bytes.NewBufferString("NBKP" + string(nonce[:]))); err == nil {
+		t.Error("expected error for invalid challenge magic")
+	}
+}
+
+func TestRestore_RoundTrip(t *testing.T) {
+	req := RestoreRequest{
+		AgentName:   "web-01",
+		StorageName: "default",
+		BackupName:  "app",
+		Path:        "etc/nginx/nginx.conf",
+	}
+	var buf bytes.Buffer
+	if err := WriteRestoreRequest(&buf, req); err != nil {
+		t.Fatalf("WriteRestoreRequest: %v", err)
+	}
+	var magic [4]byte
+	io.ReadFull(&buf, magic[:])
+	if magic != MagicRestore {
+		t.Fatalf("expected magic RSTR, got %q", magic)
+	}
+	got, err := ReadRestoreRequest(&buf)
+	if err != nil {
+		t.Fatalf("ReadRestoreRequest: %v", err)
+	}
+	if *got != req {
+		t.Errorf("expected %+v, got %+v", req, *got)
+	}
+
+	buf.Reset()
+	WriteRestoreResponse(&buf, RestoreStatusOK, "2026-01-01T00-00-00-000.tar.gz", "")
+	buf.WriteString("tar stream")
+	br := bufio.NewReader(&buf)
+	resp, err := ReadRestoreResponse(br)
+	if err != nil {
+		t.Fatalf("ReadRestoreResponse: %v", err)
+	}
+	if resp.Status != RestoreStatusOK || resp.Archive != "2026-01-01T00-00-00-000.tar.gz" || resp.Message != "" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if rest, _ := io.ReadAll(br); string(rest) != "tar stream" {
+		t.Errorf("stream after response: %q", rest)
+	}
+}
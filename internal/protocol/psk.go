@@ -0,0 +1,102 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"fmt"
+	"io"
+)
+
+// MagicPSKChallenge é o magic do desafio de autenticação por pre-shared key,
+// enviado pelo server logo após o handshake TLS em listeners com auth psk,
+// antes de qualquer frame de sessão.
+var MagicPSKChallenge = [4]byte{'P', 'S', 'K', 'C'}
+
+// PSKNonceSize é o tamanho do nonce do PSKChallenge.
+const PSKNonceSize = 32
+
+// PSKMACSize é o tamanho do HMAC-SHA256 do PSKResponse.
+const PSKMACSize = 32
+
+// PSKResult status codes (Server → Client após PSKResponse).
+const (
+	PSKStatusOK           byte = 0x00 // Agent autenticado
+	PSKStatusUnauthorized byte = 0x06 // Agent desconhecido ou HMAC inválido (mesmo valor de StatusUnauthorized)
+)
+
+// WritePSKChallenge escreve o frame PSKChallenge (Server → Client).
+// Frame: [Magic "PSKC" 4B][Nonce 32B]
+func WritePSKChallenge(w io.Writer, nonce [PSKNonceSize]byte) error {
+	buf := make([]byte, 4+PSKNonceSize)
+	copy(buf[0:4], MagicPSKChallenge[:])
+	copy(buf[4:], nonce[:])
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadPSKChallenge lê o frame PSKChallenge completo (incluindo magic).
+func ReadPSKChallenge(r io.Reader) ([PSKNonceSize]byte, error) {
+	var nonce [PSKNonceSize]byte
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nonce, fmt.Errorf("reading PSKChallenge magic: %w", err)
+	}
+	if magic != MagicPSKChallenge {
+		return nonce, fmt.Errorf("invalid PSKChallenge magic: %q", magic)
+	}
+	if _, err := io.ReadFull(r, nonce[:]); err != nil {
+		return nonce, fmt.Errorf("reading PSKChallenge nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+// WritePSKResponse escreve o frame PSKResponse (Client → Server).
+// Frame: [AgentNameLen 1B][AgentName ...B][MAC 32B]
+func WritePSKResponse(w io.Writer, agentName string, mac []byte) error {
+	if len(agentName) == 0 || len(agentName) > 255 {
+		return fmt.Errorf("invalid agent name length for PSKResponse: %d", len(agentName))
+	}
+	if len(mac) != PSKMACSize {
+		return fmt.Errorf("invalid mac length for PSKResponse: %d", len(mac))
+	}
+	buf := make([]byte, 0, 1+len(agentName)+PSKMACSize)
+	buf = append(buf, byte(len(agentName)))
+	buf = append(buf, agentName...)
+	buf = append(buf, mac...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadPSKResponse lê o frame PSKResponse.
+func ReadPSKResponse(r io.Reader) (agentName string, mac []byte, err error) {
+	var lenBuf [1]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return "", nil, fmt.Errorf("reading PSKResponse agent name length: %w", err)
+	}
+	if lenBuf[0] == 0 {
+		return "", nil, fmt.Errorf("empty agent name in PSKResponse")
+	}
+	buf := make([]byte, int(lenBuf[0])+PSKMACSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", nil, fmt.Errorf("reading PSKResponse: %w", err)
+	}
+	return string(buf[:lenBuf[0]]), buf[lenBuf[0]:], nil
+}
+
+// WritePSKResult escreve o status da autenticação PSK (Server → Client).
+// Frame: [Status 1B]
+func WritePSKResult(w io.Writer, status byte) error {
+	_, err := w.Write([]byte{status})
+	return err
+}
+
+// ReadPSKResult lê o status da autenticação PSK.
+func ReadPSKResult(r io.Reader) (byte, error) {
+	var buf [1]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, fmt.Errorf("reading PSKResult: %w", err)
+	}
+	return buf[0], nil
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// QUICALPN é o protocolo negociado via ALPN nas conexões QUIC (server.transport: quic).
+const QUICALPN = "nbackup"
+
+// QUICStreamVersion é o primeiro byte de todo stream QUIC aberto pelo agent,
+// antes do magic da sessão. Além de versionar o uso de streams, anuncia o
+// stream ao server: um stream QUIC só chega ao peer com o primeiro byte, e
+// com auth psk quem fala primeiro é o server (PSKChallenge).
+const QUICStreamVersion byte = 0x01
+
+// Cada sessão (handshake, control channel, stream paralelo, restore, ping)
+// ocupa um stream QUIC bidirecional; o limite cobre 255 streams paralelos
+// por backup com folga para vários backups simultâneos do mesmo agent.
+const quicMaxStreams = 1024
+
+// NewQUICConfig retorna a configuração QUIC comum a agent e server.
+// Allow0RTT só tem efeito no server.
+func NewQUICConfig() *quic.Config {
+	return &quic.Config{
+		HandshakeIdleTimeout:       10 * time.Second,
+		MaxIdleTimeout:             60 * time.Second,
+		KeepAlivePeriod:            15 * time.Second,
+		InitialStreamReceiveWindow: 1 << 20,
+		MaxStreamReceiveWindow:     16 << 20,
+		MaxConnectionReceiveWindow: 64 << 20,
+		MaxIncomingStreams:         quicMaxStreams,
+		Allow0RTT:                  true,
+	}
+}
+
+// WriteQUICStreamHeader escreve o byte de versão que abre um stream QUIC.
+func WriteQUICStreamHeader(w io.Writer) error {
+	_, err := w.Write([]byte{QUICStreamVersion})
+	return err
+}
+
+// ReadQUICStreamHeader lê o byte de versão de um stream QUIC.
+func ReadQUICStreamHeader(r io.Reader) (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, fmt.Errorf("reading quic stream header: %w", err)
+	}
+	return b[0], nil
+}
+
+// QUICConn adapta um stream QUIC bidirecional a net.Conn, para que os
+// handlers de sessão tratem streams QUIC como conexões TLS: endereços e
+// estado TLS vêm da conexão QUIC.
+type QUICConn struct {
+	*quic.Stream
+	conn *quic.Conn
+}
+
+// NewQUICConn cria o net.Conn do stream st da conexão conn.
+func NewQUICConn(conn *quic.Conn, st *quic.Stream) *QUICConn {
+	return &QUICConn{Stream: st, conn: conn}
+}
+
+// Conn retorna a conexão QUIC do stream.
+func (c *QUICConn) Conn() *quic.Conn { return c.conn }
+
+// LocalAddr retorna o endereço UDP local da conexão QUIC.
+func (c *QUICConn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+// RemoteAddr retorna o endereço UDP do peer.
+func (c *QUICConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+// ConnectionState retorna o estado TLS da conexão QUIC (certificado do
+// peer e exporter usado pelo channel binding PSK).
+func (c *QUICConn) ConnectionState() tls.ConnectionState {
+	return c.conn.ConnectionState().TLS
+}
+
+// Close encerra o stream nos dois sentidos: além do FIN de escrita, avisa o
+// peer para parar de enviar, como o fechamento de um socket TCP.
+func (c *QUICConn) Close() error {
+	c.Stream.CancelRead(0)
+	return c.Stream.Close()
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 )
 
@@ -53,8 +54,10 @@ func ReadHandshake(r io.Reader) (*Handshake, error) {
 	if _, err := io.ReadFull(r, version[:]); err != nil {
 		return nil, fmt.Errorf("reading handshake version: %w", err)
 	}
-	if version[0] != ProtocolVersion {
-		return nil, ErrInvalidVersion
+	// Versões acima de MaxProtocolVersion têm o mesmo formato: o server
+	// negocia a sua no ACK
+	if version[0] < MinProtocolVersion {
+		return nil, &VersionError{Got: version[0], Supported: SupportedVersions}
 	}
 
 	// Lê agent name até '\n'
@@ -98,8 +101,23 @@ func ReadHandshake(r io.Reader) (*Handshake, error) {
 	}, nil
 }
 
+// ReadSACKWindow lê um SACKWindow [Interval uint32] [MaxInFlight uint64].
+func ReadSACKWindow(r io.Reader) (*SACKWindow, error) {
+	var buf [SACKWindowSize]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	return &SACKWindow{
+		Interval:    binary.BigEndian.Uint32(buf[0:4]),
+		MaxInFlight: binary.BigEndian.Uint64(buf[4:12]),
+	}, nil
+}
+
 // ReadACK lê o frame ACK (Server → Client).
 // Formato v4: [Status 1B] [Message UTF-8] ['\n'] [SessionID UTF-8] ['\n'] [CompressionMode 1B]
+// Com StatusVersionMismatch, o intervalo de versões do server vem em ACK.Versions.
+// Com ACKFlagVersion em CompressionMode, a versão negociada vem em ACK.Version
+// (sem a flag, ProtocolVersion).
 func ReadACK(r io.Reader) (*ACK, error) {
 	// Lê status
 	var status [1]byte
@@ -128,12 +146,32 @@ func ReadACK(r io.Reader) (*ACK, error) {
 		return nil, fmt.Errorf("reading ack compression mode: %w", err)
 	}
 
-	return &ACK{
+	ack := &ACK{
 		Status:          status[0],
 		Message:         msg,
 		SessionID:       sessionID,
 		CompressionMode: compMode[0],
-	}, nil
+	}
+	if ack.Status == StatusVersionMismatch {
+		// A recusa por versão tem formato próprio, sem a janela: o server não
+		// sabe qual versão de ACK o agent entende
+		var versions [2]byte
+		if _, err := io.ReadFull(br, versions[:]); err != nil {
+			return nil, fmt.Errorf("reading ack supported versions: %w", err)
+		}
+		ack.Versions = &VersionRange{Min: versions[0], Max: versions[1]}
+		return ack, nil
+	}
+	ack.Version = ProtocolVersion
+	if ack.CompressionMode&ACKFlagVersion != 0 {
+		var version [1]byte
+		if _, err := io.ReadFull(br, version[:]); err != nil {
+			return nil, fmt.Errorf("reading ack version: %w", err)
+		}
+		ack.CompressionMode &^= ACKFlagVersion
+		ack.Version = version[0]
+	}
+	return ack, nil
 }
 
 // ReadTrailer lê o frame trailer (Client → Server).
@@ -146,7 +184,42 @@ func ReadTrailer(r io.Reader) (*Trailer, error) {
 	if magic != MagicTrailer {
 		return nil, ErrInvalidMagic
 	}
+	return readTrailerBody(r)
+}
 
+// ReadTrailerWithManifest lê o trailer precedido opcionalmente por um frame
+// Manifest, cujo conteúdo é copiado para manifest. hasManifest indica se o
+// frame estava presente.
+func ReadTrailerWithManifest(r io.Reader, manifest io.Writer) (t *Trailer, hasManifest bool, err error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, false, fmt.Errorf("reading trailer magic: %w", err)
+	}
+	if magic == MagicManifest {
+		var size uint64
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, false, fmt.Errorf("reading manifest size: %w", err)
+		}
+		if size > MaxManifestSize {
+			return nil, false, fmt.Errorf("manifest too large: %d bytes (max %d)", size, MaxManifestSize)
+		}
+		if _, err := io.CopyN(manifest, r, int64(size)); err != nil {
+			return nil, false, fmt.Errorf("reading manifest: %w", err)
+		}
+		hasManifest = true
+		if _, err := io.ReadFull(r, magic[:]); err != nil {
+			return nil, true, fmt.Errorf("reading trailer magic: %w", err)
+		}
+	}
+	if magic != MagicTrailer {
+		return nil, hasManifest, ErrInvalidMagic
+	}
+	t, err = readTrailerBody(r)
+	return t, hasManifest, err
+}
+
+// readTrailerBody lê o trailer após o magic "DONE".
+func readTrailerBody(r io.Reader) (*Trailer, error) {
 	// Lê checksum SHA-256
 	var checksum [32]byte
 	if _, err := io.ReadFull(r, checksum[:]); err != nil {
@@ -210,6 +283,16 @@ func ReadHealthResponse(r io.Reader) (*HealthResponse, error) {
 	}, nil
 }
 
+// ReadPingStorage lê o nome do storage do health check PSTG (Client → Server).
+// O magic "PSTG" já foi lido pelo dispatcher.
+func ReadPingStorage(r io.Reader) (string, error) {
+	storageName, err := readLineLimited(bufio.NewReader(r), maxLineLength)
+	if err != nil {
+		return "", fmt.Errorf("reading ping storage name: %w", err)
+	}
+	return storageName, nil
+}
+
 // ReadResume lê o frame RESUME (Client → Server).
 // O magic "RSME" já foi lido pelo dispatcher; lê version + sessionID + agentName + storageName.
 func ReadResume(r io.Reader) (*Resume, error) {
@@ -219,7 +302,7 @@ func ReadResume(r io.Reader) (*Resume, error) {
 		return nil, fmt.Errorf("reading resume version: %w", err)
 	}
 	if version[0] != ProtocolVersion {
-		return nil, ErrInvalidVersion
+		return nil, &VersionError{Got: version[0], Supported: VersionRange{Min: ProtocolVersion, Max: ProtocolVersion}}
 	}
 
 	br := bufio.NewReader(r)
@@ -282,6 +365,17 @@ func ReadResumeACK(r io.Reader) (*ResumeACK, error) {
 	}, nil
 }
 
+// ReadParallelResume lê a extensão do Resume ACK de uma sessão paralela
+// (Server → Client), enviada logo após um ResumeACK OK.
+// Formato: [NextSeq uint32 4B]
+func ReadParallelResume(r io.Reader) (*ParallelResume, error) {
+	var nextSeq uint32
+	if err := binary.Read(r, binary.BigEndian, &nextSeq); err != nil {
+		return nil, fmt.Errorf("reading parallel resume next seq: %w", err)
+	}
+	return &ParallelResume{NextSeq: nextSeq}, nil
+}
+
 // ReadParallelInit lê a extensão ParallelInit do handshake (Client → Server).
 // Formato: [MaxStreams uint8 1B] [ChunkSize uint32 4B]
 func ReadParallelInit(r io.Reader) (*ParallelInit, error) {
@@ -296,8 +390,9 @@ func ReadParallelInit(r io.Reader) (*ParallelInit, error) {
 	}
 
 	return &ParallelInit{
-		MaxStreams: maxStreams[0],
-		ChunkSize:  chunkSize,
+		MaxStreams:   maxStreams[0],
+		ChunkSize:    chunkSize,
+		ChunkSizeMax: chunkSize,
 	}, nil
 }
 
@@ -316,16 +411,28 @@ func ReadParallelInitACK(r io.Reader) (*ParallelInitACK, error) {
 
 // ReadParallelInitAfterMaxStreams lê o restante do ParallelInit quando o byte
 // MaxStreams já foi consumido pelo discriminador de modo (handler.go).
-// Lê apenas ChunkSize (4B) e reconstrói o ParallelInit completo.
-func ReadParallelInitAfterMaxStreams(r io.Reader, maxStreams uint8) (*ParallelInit, error) {
+// Lê ChunkSize (4B) e, no handshake v8+, ChunkSizeMax (4B); em versões
+// anteriores ChunkSizeMax é o próprio ChunkSize.
+func ReadParallelInitAfterMaxStreams(r io.Reader, maxStreams uint8, version byte) (*ParallelInit, error) {
 	var chunkSize uint32
 	if err := binary.Read(r, binary.BigEndian, &chunkSize); err != nil {
 		return nil, fmt.Errorf("reading parallel init chunk size: %w", err)
 	}
 
+	chunkSizeMax := chunkSize
+	if version >= HandshakeVersionChunkRange {
+		if err := binary.Read(r, binary.BigEndian, &chunkSizeMax); err != nil {
+			return nil, fmt.Errorf("reading parallel init chunk size max: %w", err)
+		}
+		if chunkSizeMax < chunkSize {
+			return nil, fmt.Errorf("parallel init chunk size max %d is below chunk size %d", chunkSizeMax, chunkSize)
+		}
+	}
+
 	return &ParallelInit{
-		MaxStreams: maxStreams,
-		ChunkSize:  chunkSize,
+		MaxStreams:   maxStreams,
+		ChunkSize:    chunkSize,
+		ChunkSizeMax: chunkSizeMax,
 	}, nil
 }
 
@@ -339,7 +446,7 @@ func ReadParallelJoin(r io.Reader) (*ParallelJoin, error) {
 		return nil, fmt.Errorf("reading parallel join version: %w", err)
 	}
 	if version[0] != ProtocolVersion {
-		return nil, ErrInvalidVersion
+		return nil, &VersionError{Got: version[0], Supported: VersionRange{Min: ProtocolVersion, Max: ProtocolVersion}}
 	}
 
 	// Lê sessionID até '\n'
@@ -384,8 +491,9 @@ func ReadParallelACK(r io.Reader) (*ParallelACK, error) {
 	}
 
 	return &ParallelACK{
-		Status:     status[0],
-		LastOffset: lastOffset,
+		Status:        status[0] &^ ParallelACKFlagStreamTrailer,
+		LastOffset:    lastOffset,
+		StreamTrailer: status[0]&ParallelACKFlagStreamTrailer != 0,
 	}, nil
 }
 
@@ -398,7 +506,11 @@ func ReadChunkSACK(r io.Reader) (*ChunkSACK, error) {
 	if magic != MagicChunkSACK {
 		return nil, ErrInvalidMagic
 	}
+	return ReadChunkSACKPayload(r)
+}
 
+// ReadChunkSACKPayload lê o payload de ChunkSACK após o magic já ter sido lido.
+func ReadChunkSACKPayload(r io.Reader) (*ChunkSACK, error) {
 	var streamIndex [1]byte
 	if _, err := io.ReadFull(r, streamIndex[:]); err != nil {
 		return nil, fmt.Errorf("reading chunk sack stream index: %w", err)
@@ -421,6 +533,47 @@ func ReadChunkSACK(r io.Reader) (*ChunkSACK, error) {
 	}, nil
 }
 
+// ReadChunkNACKPayload lê o payload de ChunkNACK (5B) após o magic já ter sido lido.
+func ReadChunkNACKPayload(r io.Reader) (*ChunkNACK, error) {
+	var buf [5]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, fmt.Errorf("reading chunk nack: %w", err)
+	}
+	return &ChunkNACK{
+		StreamIndex: buf[0],
+		GlobalSeq:   binary.BigEndian.Uint32(buf[1:]),
+	}, nil
+}
+
+// ReadStreamTrailerACKPayload lê o payload de StreamTrailerACK (10B) após o magic já ter sido lido.
+func ReadStreamTrailerACKPayload(r io.Reader) (*StreamTrailerACK, error) {
+	var buf [10]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, fmt.Errorf("reading stream trailer ack: %w", err)
+	}
+	return &StreamTrailerACK{
+		StreamIndex: buf[0],
+		Status:      buf[1],
+		Offset:      binary.BigEndian.Uint64(buf[2:]),
+	}, nil
+}
+
+// ParseStreamTrailer decodifica o StreamTrailer a partir do header (GlobalSeq
+// = StreamTrailerSeq) e do payload já lidos do stream, validando tamanho e CRC32.
+func ParseStreamTrailer(hdr *ChunkHeader, payload []byte) (*StreamTrailer, error) {
+	if hdr.Length != StreamTrailerPayloadSize || len(payload) != StreamTrailerPayloadSize {
+		return nil, fmt.Errorf("%w: stream trailer payload of %d bytes", ErrTruncatedFrame, len(payload))
+	}
+	if crc := crc32.ChecksumIEEE(payload); crc != hdr.CRC32 {
+		return nil, fmt.Errorf("%w: stream trailer expected %08x got %08x", ErrChunkCRCMismatch, hdr.CRC32, crc)
+	}
+	return &StreamTrailer{
+		StreamIndex: hdr.SlotID,
+		Chunks:      binary.BigEndian.Uint32(payload[0:4]),
+		Bytes:       binary.BigEndian.Uint64(payload[4:12]),
+	}, nil
+}
+
 // ReadChunkHeader lê o header de chunk paralelo (Client → Server).
 // Formato: [GlobalSeq uint32 4B] [Length uint32 4B] [SlotID uint8 1B] [CRC32 uint32 4B]
 func ReadChunkHeader(r io.Reader) (*ChunkHeader, error) {
@@ -0,0 +1,124 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// MagicRestore é o magic da requisição de restore de um arquivo (Client → Server).
+var MagicRestore = [4]byte{'R', 'S', 'T', 'R'}
+
+// maxRestorePathLength é o limite do caminho pedido em um RestoreRequest.
+const maxRestorePathLength = 4096
+
+// Status codes para RestoreResponse (Server → Client após RestoreRequest).
+const (
+	RestoreStatusOK       byte = 0x00 // Segue o stream tar com o arquivo
+	RestoreStatusNotFound byte = 0x01 // Backup, archive ou arquivo não encontrado
+	RestoreStatusNoIndex  byte = 0x02 // Archive sem índice de membros (backup sem manifest)
+	RestoreStatusReject   byte = 0x03 // Agent não autorizado
+	RestoreStatusError    byte = 0x04 // Erro de leitura no server
+)
+
+// RestoreRequest pede um arquivo de um backup.
+// Formato: [Magic "RSTR" 4B] [Version 1B] [AgentName '\n'] [StorageName '\n']
+// [BackupName '\n'] [Archive '\n'] [Path '\n']
+// Archive vazio = backup mais recente com índice; Path é o caminho no archive.
+type RestoreRequest struct {
+	AgentName   string
+	StorageName string
+	BackupName  string
+	Archive     string
+	Path        string
+}
+
+// RestoreResponse é a resposta do server ao RestoreRequest.
+// Formato: [Status 1B] [Archive '\n'] [Message '\n']
+// Com RestoreStatusOK, segue um stream tar (sem compressão) até o fim da conexão.
+type RestoreResponse struct {
+	Status  byte
+	Archive string // archive de onde o arquivo é lido
+	Message string
+}
+
+// WriteRestoreRequest escreve o frame RestoreRequest (Client → Server).
+func WriteRestoreRequest(w io.Writer, req RestoreRequest) error {
+	buf := append([]byte{}, MagicRestore[:]...)
+	buf = append(buf, ProtocolVersion)
+	for _, field := range []string{req.AgentName, req.StorageName, req.BackupName, req.Archive, req.Path} {
+		buf = append(buf, field...)
+		buf = append(buf, '\n')
+	}
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("writing restore request: %w", err)
+	}
+	return nil
+}
+
+// ReadRestoreRequest lê o frame RestoreRequest (Client → Server).
+// O magic "RSTR" já foi consumido pelo dispatcher do server.
+func ReadRestoreRequest(r io.Reader) (*RestoreRequest, error) {
+	var version [1]byte
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return nil, fmt.Errorf("reading restore version: %w", err)
+	}
+	if version[0] != ProtocolVersion {
+		return nil, &VersionError{Got: version[0], Supported: VersionRange{Min: ProtocolVersion, Max: ProtocolVersion}}
+	}
+
+	br := bufio.NewReader(r)
+	var req RestoreRequest
+	for _, f := range []struct {
+		name string
+		dst  *string
+		max  int
+	}{
+		{"agent name", &req.AgentName, maxLineLength},
+		{"storage name", &req.StorageName, maxLineLength},
+		{"backup name", &req.BackupName, maxLineLength},
+		{"archive", &req.Archive, maxLineLength},
+		{"path", &req.Path, maxRestorePathLength},
+	} {
+		v, err := readLineLimited(br, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("reading restore %s: %w", f.name, err)
+		}
+		*f.dst = v
+	}
+	return &req, nil
+}
+
+// WriteRestoreResponse escreve a resposta ao RestoreRequest (Server → Client).
+func WriteRestoreResponse(w io.Writer, status byte, archive, message string) error {
+	buf := append([]byte{status}, archive...)
+	buf = append(buf, '\n')
+	buf = append(buf, message...)
+	buf = append(buf, '\n')
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("writing restore response: %w", err)
+	}
+	return nil
+}
+
+// ReadRestoreResponse lê a resposta ao RestoreRequest (Server → Client). O
+// stream tar que segue uma resposta OK deve ser lido do mesmo br.
+func ReadRestoreResponse(br *bufio.Reader) (*RestoreResponse, error) {
+	status, err := br.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("reading restore status: %w", err)
+	}
+	archive, err := readLineLimited(br, maxLineLength)
+	if err != nil {
+		return nil, fmt.Errorf("reading restore archive: %w", err)
+	}
+	msg, err := readLineLimited(br, maxRestorePathLength)
+	if err != nil {
+		return nil, fmt.Errorf("reading restore message: %w", err)
+	}
+	return &RestoreResponse{Status: status, Archive: archive, Message: msg}, nil
+}
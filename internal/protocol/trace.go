@@ -0,0 +1,354 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceMaxBytes limita o tamanho de cada arquivo de trace. Ao atingir o
+// limite, o trace registra "truncated" e para de gravar operações.
+const TraceMaxBytes = 64 << 20
+
+// tracePendingMax limita os registros mantidos em memória enquanto a conexão
+// ainda não foi identificada (agent/sessão desconhecidos).
+const tracePendingMax = 4096
+
+// TraceInfo identifica a conexão no cabeçalho e no nome do arquivo de trace.
+type TraceInfo struct {
+	Side    string `json:"side"`                   // agent | server
+	Version string `json:"version,omitempty"`      // versão do binário que gravou o trace
+	Peer    string `json:"peer_version,omitempty"` // versão informada pelo outro lado, se conhecida
+	Conn    string `json:"conn,omitempty"`         // primary | resume | stream-N | control | ...
+	Agent   string `json:"agent,omitempty"`
+	Storage string `json:"storage,omitempty"`
+	Backup  string `json:"backup,omitempty"`
+	Session string `json:"session,omitempty"`
+}
+
+// merge preenche os campos vazios de i com os de o.
+func (i *TraceInfo) merge(o TraceInfo) {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&i.Peer, o.Peer}, {&i.Conn, o.Conn}, {&i.Agent, o.Agent}, {&i.Storage, o.Storage},
+		{&i.Backup, o.Backup}, {&i.Session, o.Session},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+}
+
+// TraceRecord é uma operação de I/O no transcript. Nunca contém bytes de payload.
+type TraceRecord struct {
+	T     int64  `json:"t_us"`            // microssegundos desde a abertura do trace
+	Dir   string `json:"dir"`             // tx | rx
+	Off   int64  `json:"off"`             // offset do primeiro byte no sentido
+	Size  int    `json:"size"`            // bytes transferidos na operação
+	Frame string `json:"frame,omitempty"` // tipo do frame, se a operação começa com um magic conhecido
+	Err   string `json:"err,omitempty"`
+}
+
+// traceFrames mapeia os magics do protocolo para o nome gravado no trace.
+var traceFrames = map[[4]byte]string{
+	MagicHandshake:               "handshake",
+	MagicTrailer:                 "trailer",
+	MagicPing:                    "ping",
+	MagicResume:                  "resume",
+	MagicSACK:                    "sack",
+	MagicParallelJoin:            "parallel_join",
+	MagicChunkSACK:               "chunk_sack",
+	MagicChunkNACK:               "chunk_nack",
+	MagicPSKChallenge:            "psk_challenge",
+	MagicControl:                 "control",
+	MagicControlPing:             "control_ping",
+	MagicControlRotate:           "control_rotate",
+	MagicControlRotateACK:        "control_rotate_ack",
+	MagicControlAdmit:            "control_admit",
+	MagicControlDefer:            "control_defer",
+	MagicControlAbort:            "control_abort",
+	MagicControlProgress:         "control_progress",
+	MagicControlStats:            "control_stats",
+	MagicControlAutoScaleStats:   "control_autoscale_stats",
+	MagicControlIngestionDone:    "control_ingestion_done",
+	MagicControlSessionSummary:   "control_session_summary",
+	MagicControlSessionCancel:    "control_session_cancel",
+	MagicControlSlotPark:         "control_slot_park",
+	MagicControlSlotResume:       "control_slot_resume",
+	MagicControlAssemblyProgress: "control_assembly_progress",
+}
+
+// traceFrame identifica o frame pelo magic no início da operação. Em rx a
+// leitura pode agrupar vários frames (bufio): apenas o primeiro é nomeado.
+func traceFrame(p []byte) string {
+	if len(p) < 4 {
+		return ""
+	}
+	return traceFrames[[4]byte(p[:4])]
+}
+
+// Estados de um TraceConn.
+const (
+	tracePending = iota // gravando em memória até Identify
+	traceActive         // gravando no arquivo
+	traceOff            // desabilitado, fechado ou truncado
+)
+
+// TraceConn envolve uma net.Conn (acima do TLS) e grava um transcript JSONL
+// das operações de I/O: sentido, offset, tamanho, tempo e tipo de frame.
+// Nomes, checksums e dados não são gravados — o trace pode ser anexado a um
+// bug report. O arquivo é criado em Identify (ou no Close, se a conexão
+// nunca foi identificada), com o nome {timestamp}-{side}-{agent}-{session}-{conn}.trace.jsonl.
+type TraceConn struct {
+	net.Conn
+
+	dir   string
+	start time.Time
+
+	mu      sync.Mutex
+	info    TraceInfo
+	state   int
+	pending [][]byte
+	f       *os.File
+	w       *bufio.Writer
+	path    string
+	off     [2]int64 // tx, rx
+	written int64
+	records int
+	dropped int
+
+	closeOnce sync.Once
+}
+
+// NewTraceConn inicia o trace de conn. Os registros ficam em memória até
+// Identify (ou Close).
+func NewTraceConn(conn net.Conn, dir string, info TraceInfo) *TraceConn {
+	return &TraceConn{Conn: conn, dir: dir, info: info, start: time.Now()}
+}
+
+// NetConn retorna a conexão envolvida (ex: para inspecionar o *tls.Conn).
+func (c *TraceConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// Path retorna o caminho do arquivo de trace (vazio enquanto não criado).
+func (c *TraceConn) Path() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.path
+}
+
+// Annotate acrescenta informações à identificação sem criar o arquivo (ex:
+// agent conhecido após o handshake, sessão ainda não). Se a conexão for
+// encerrada antes de Identify, o trace é gravado no Close com o que se sabe.
+func (c *TraceConn) Annotate(info TraceInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == tracePending {
+		c.info.merge(info)
+	}
+}
+
+// Identify completa a identificação da conexão, cria o arquivo e grava os
+// registros pendentes. Chamadas seguintes são ignoradas.
+func (c *TraceConn) Identify(info TraceInfo) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != tracePending {
+		return nil
+	}
+	c.info.merge(info)
+	return c.openLocked()
+}
+
+// Disable descarta o trace (ex: conexão fora do filtro). A conexão segue normalmente.
+func (c *TraceConn) Disable() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == tracePending {
+		c.pending = nil
+		c.state = traceOff
+	}
+}
+
+// Read implementa net.Conn, registrando a operação.
+func (c *TraceConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.record(1, p[:n], err)
+	return n, err
+}
+
+// Write implementa net.Conn, registrando a operação.
+func (c *TraceConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.record(0, p[:n], err)
+	return n, err
+}
+
+// Close grava o resumo, fecha o arquivo de trace e a conexão.
+func (c *TraceConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		if c.state == tracePending {
+			c.openLocked()
+		}
+		if c.w != nil {
+			c.writeLocked(map[string]any{
+				"event":    "close",
+				"t_us":     time.Since(c.start).Microseconds(),
+				"tx_bytes": c.off[0],
+				"rx_bytes": c.off[1],
+				"records":  c.records,
+				"dropped":  c.dropped,
+			}, true)
+			c.w.Flush()
+			c.f.Close()
+			c.w = nil
+		}
+		c.state = traceOff
+		c.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// record registra uma operação de I/O (dir 0 = tx, 1 = rx).
+func (c *TraceConn) record(dir int, p []byte, err error) {
+	if len(p) == 0 && err == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rec := TraceRecord{
+		T:     time.Since(c.start).Microseconds(),
+		Dir:   [2]string{"tx", "rx"}[dir],
+		Off:   c.off[dir],
+		Size:  len(p),
+		Frame: traceFrame(p),
+	}
+	c.off[dir] += int64(len(p))
+	if err != nil {
+		rec.Err = traceError(err)
+	}
+
+	switch c.state {
+	case tracePending:
+		if len(c.pending) >= tracePendingMax {
+			c.dropped++
+			return
+		}
+		data, _ := json.Marshal(rec)
+		c.pending = append(c.pending, data)
+		c.records++
+	case traceActive:
+		c.writeLocked(rec, false)
+	}
+}
+
+// traceError resume um erro de I/O sem expor dados (EOF, timeout, reset...).
+func traceError(err error) string {
+	if errors.Is(err, io.EOF) {
+		return "EOF"
+	}
+	if errors.Is(err, net.ErrClosed) {
+		return "closed"
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return "timeout"
+	}
+	return err.Error()
+}
+
+// openLocked cria o arquivo, grava o cabeçalho e os registros pendentes.
+// Falhas desabilitam o trace sem afetar a conexão.
+func (c *TraceConn) openLocked() error {
+	c.state = traceOff
+	if err := os.MkdirAll(c.dir, 0750); err != nil {
+		return fmt.Errorf("creating trace dir: %w", err)
+	}
+	name := strings.Join([]string{
+		c.start.UTC().Format("20060102T150405.000"),
+		c.info.Side, traceNamePart(c.info.Agent), traceNamePart(c.info.Session), traceNamePart(c.info.Conn),
+	}, "-") + ".trace.jsonl"
+	path := filepath.Join(c.dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0640)
+	if err != nil {
+		return fmt.Errorf("creating trace file: %w", err)
+	}
+	c.f, c.w, c.path, c.state = f, bufio.NewWriterSize(f, 32*1024), path, traceActive
+
+	header := struct {
+		Trace    string `json:"trace"`
+		Protocol byte   `json:"protocol_version"`
+		TraceInfo
+		Local     string `json:"local"`
+		Remote    string `json:"remote"`
+		StartedAt string `json:"started_at"`
+	}{"nbackup-protocol", ProtocolVersion, c.info, addrString(c.Conn.LocalAddr()), addrString(c.Conn.RemoteAddr()), c.start.UTC().Format(time.RFC3339Nano)}
+	c.writeLocked(header, true)
+	for _, data := range c.pending {
+		c.writeRawLocked(data, false)
+	}
+	c.pending = nil
+	return nil
+}
+
+// writeLocked serializa v como uma linha do trace.
+func (c *TraceConn) writeLocked(v any, force bool) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	c.writeRawLocked(data, force)
+}
+
+// writeRawLocked grava uma linha respeitando TraceMaxBytes (force ignora o
+// limite, para cabeçalho e resumo).
+func (c *TraceConn) writeRawLocked(data []byte, force bool) {
+	if c.w == nil {
+		return
+	}
+	if !force && c.written+int64(len(data))+1 > TraceMaxBytes {
+		c.w.WriteString(`{"event":"truncated"}` + "\n")
+		c.state = traceOff
+		return
+	}
+	c.w.Write(data)
+	c.w.WriteByte('\n')
+	c.written += int64(len(data)) + 1
+}
+
+// traceNamePart normaliza um componente do nome do arquivo.
+func traceNamePart(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func addrString(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
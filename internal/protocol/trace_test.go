@@ -0,0 +1,126 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readTrace lê as linhas JSON do único arquivo de trace em dir.
+func readTrace(t *testing.T, dir string) (string, []map[string]any) {
+	t.Helper()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.trace.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 trace file, got %v", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []map[string]any
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		var m map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("invalid trace line %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, m)
+	}
+	return string(data), lines
+}
+
+func TestTraceConn_RecordsFramesWithoutPayload(t *testing.T) {
+	dir := t.TempDir()
+	client, server := net.Pipe()
+	tc := NewTraceConn(client, dir, TraceInfo{Side: "agent", Version: "1.2.3", Conn: "primary", Agent: "web-01"})
+
+	go func() {
+		io.Copy(io.Discard, io.LimitReader(server, 1<<20))
+	}()
+	if err := WriteHandshake(tc, "web-01", "default", "secret-backup-name", "1.2.3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tc.Write([]byte("top-secret-payload")); err != nil {
+		t.Fatal(err)
+	}
+	if tc.Path() != "" {
+		t.Fatal("expected no trace file before Identify")
+	}
+	if err := tc.Identify(TraceInfo{Session: "sess-1", Backup: "daily"}); err != nil {
+		t.Fatalf("Identify: %v", err)
+	}
+	if !strings.Contains(filepath.Base(tc.Path()), "-agent-web-01-sess-1-primary") {
+		t.Errorf("unexpected trace file name %s", tc.Path())
+	}
+	tc.Close()
+	server.Close()
+
+	raw, lines := readTrace(t, dir)
+	if strings.Contains(raw, "top-secret-payload") || strings.Contains(raw, "secret-backup-name") {
+		t.Error("trace must not contain payload bytes")
+	}
+	header := lines[0]
+	if header["trace"] != "nbackup-protocol" || header["session"] != "sess-1" || header["version"] != "1.2.3" {
+		t.Errorf("unexpected header %v", header)
+	}
+	if lines[1]["frame"] != "handshake" || lines[1]["dir"] != "tx" || lines[1]["off"] != float64(0) {
+		t.Errorf("expected handshake tx at offset 0, got %v", lines[1])
+	}
+	footer := lines[len(lines)-1]
+	if footer["event"] != "close" || footer["records"] != float64(len(lines)-2) {
+		t.Errorf("unexpected footer %v", footer)
+	}
+}
+
+func TestTraceConn_UnidentifiedWrittenOnClose(t *testing.T) {
+	dir := t.TempDir()
+	client, server := net.Pipe()
+	tc := NewTraceConn(server, dir, TraceInfo{Side: "server"})
+
+	go func() {
+		client.Write(MagicResume[:])
+		client.Close()
+	}()
+	buf := make([]byte, 4)
+	io.ReadFull(tc, buf)
+	tc.Read(buf) // EOF
+	tc.Annotate(TraceInfo{Agent: "db-01"})
+	tc.Close()
+	tc.Close() // idempotente
+
+	_, lines := readTrace(t, dir)
+	if lines[0]["agent"] != "db-01" || lines[0]["session"] != nil {
+		t.Errorf("unexpected header %v", lines[0])
+	}
+	if lines[1]["frame"] != "resume" || lines[1]["dir"] != "rx" {
+		t.Errorf("expected resume rx, got %v", lines[1])
+	}
+	if lines[2]["err"] != "EOF" || lines[2]["off"] != float64(4) {
+		t.Errorf("expected EOF at offset 4, got %v", lines[2])
+	}
+}
+
+func TestTraceConn_Disable(t *testing.T) {
+	dir := t.TempDir()
+	client, server := net.Pipe()
+	defer server.Close()
+	tc := NewTraceConn(client, dir, TraceInfo{Side: "server"})
+
+	tc.Disable()
+	tc.Identify(TraceInfo{Session: "s1"})
+	tc.Close()
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Errorf("expected no trace file when disabled, got %v", files)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package protocol
+
+import "fmt"
+
+// Versões de handshake suportadas por este build: o agent anuncia
+// MaxProtocolVersion e o server aceita handshakes a partir de
+// MinProtocolVersion, negociando no ACK a menor entre a anunciada e a sua
+// MaxProtocolVersion (ver ACKFlagVersion).
+//
+//	v6: CRC32 por chunk (ProtocolVersion)
+//	v7: janela de SACK negociada (HandshakeVersionSACKWindow)
+//	v8: ParallelInit com o tamanho máximo de chunk (HandshakeVersionChunkRange)
+//	v9: ControlProgress por sessão no canal de controle (HandshakeVersionSessionProgress)
+//	v10: ControlAutoScaleStats por sessão no canal de controle (HandshakeVersionSessionAutoScale)
+const (
+	MinProtocolVersion = ProtocolVersion
+	MaxProtocolVersion = HandshakeVersionSessionAutoScale
+)
+
+// SupportedVersions é o intervalo de versões de handshake deste build.
+var SupportedVersions = VersionRange{Min: MinProtocolVersion, Max: MaxProtocolVersion}
+
+// VersionRange é um intervalo fechado de versões de handshake.
+type VersionRange struct {
+	Min, Max byte
+}
+
+// Contains indica se v está no intervalo.
+func (r VersionRange) Contains(v byte) bool {
+	return v >= r.Min && v <= r.Max
+}
+
+func (r VersionRange) String() string {
+	if r.Min == r.Max {
+		return fmt.Sprintf("v%d", r.Min)
+	}
+	return fmt.Sprintf("v%d-v%d", r.Min, r.Max)
+}
+
+// VersionError é retornado pelos readers quando um frame traz uma versão fora
+// das suportadas. errors.Is(err, ErrInvalidVersion) continua valendo.
+type VersionError struct {
+	Got       byte
+	Supported VersionRange
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("protocol: unsupported protocol version %d (supported: %s)", e.Got, e.Supported)
+}
+
+func (e *VersionError) Is(target error) bool {
+	return target == ErrInvalidVersion
+}
+
+// VersionMismatchError é a recusa de um handshake por versão
+// (StatusVersionMismatch): Agent é a versão enviada pelo agent e Server, as
+// versões aceitas pelo server.
+type VersionMismatchError struct {
+	Agent  byte
+	Server VersionRange
+}
+
+// Upgrade indica o lado a atualizar: "agent" se a versão do agent é anterior
+// às aceitas pelo server, "server" caso contrário.
+func (e *VersionMismatchError) Upgrade() string {
+	if e.Agent < e.Server.Min {
+		return "agent"
+	}
+	return "server"
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("protocol version mismatch: agent speaks v%d, server supports %s; upgrade the %s",
+		e.Agent, e.Server, e.Upgrade())
+}
+
+func (e *VersionMismatchError) Is(target error) bool {
+	return target == ErrInvalidVersion
+}
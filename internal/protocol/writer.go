@@ -7,16 +7,43 @@ package protocol
 import (
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 )
 
 // WriteHandshake escreve o frame de handshake (Client → Server).
 // Formato: [Magic 4B] [Version 1B] [AgentName UTF-8] ['\n' 1B] [StorageName UTF-8] ['\n' 1B] [BackupName UTF-8] ['\n' 1B] [ClientVersion UTF-8] ['\n' 1B]
 func WriteHandshake(w io.Writer, agentName, storageName, backupName, clientVersion string) error {
+	return writeHandshake(w, ProtocolVersion, agentName, storageName, backupName, clientVersion)
+}
+
+// WriteHandshakeVersion escreve o handshake anunciando version, no formato do
+// v6: a versão é o único campo que muda, então um server v6 (que aceita
+// qualquer versão a partir da sua) o lê sem erro. O que as versões seguintes
+// acrescentam só é trocado depois que o ACK confirma a versão negociada
+// (ACKFlagVersion).
+func WriteHandshakeVersion(w io.Writer, version byte, agentName, storageName, backupName, clientVersion string) error {
+	return writeHandshake(w, version, agentName, storageName, backupName, clientVersion)
+}
+
+// WriteSACKWindow escreve [Interval uint32] [MaxInFlight uint64]: a janela
+// pedida pelo agent e a concedida pelo server, trocadas logo após o ACK GO em
+// sessões v7+.
+func WriteSACKWindow(w io.Writer, win SACKWindow) error {
+	var buf [SACKWindowSize]byte
+	binary.BigEndian.PutUint32(buf[0:4], win.Interval)
+	binary.BigEndian.PutUint64(buf[4:12], win.MaxInFlight)
+	if _, err := w.Write(buf[:]); err != nil {
+		return fmt.Errorf("writing sack window: %w", err)
+	}
+	return nil
+}
+
+func writeHandshake(w io.Writer, version byte, agentName, storageName, backupName, clientVersion string) error {
 	if _, err := w.Write(MagicHandshake[:]); err != nil {
 		return fmt.Errorf("writing handshake magic: %w", err)
 	}
-	if _, err := w.Write([]byte{ProtocolVersion}); err != nil {
+	if _, err := w.Write([]byte{version}); err != nil {
 		return fmt.Errorf("writing handshake version: %w", err)
 	}
 	if _, err := w.Write([]byte(agentName)); err != nil {
@@ -74,6 +101,34 @@ func WriteACK(w io.Writer, status byte, message string, sessionID string, compre
 	return nil
 }
 
+// WriteACKVersion escreve o ACK para um agent que anunciou uma versão acima
+// de ProtocolVersion: o ACK v4 com ACKFlagVersion em CompressionMode, seguido
+// de [Version 1B], a versão negociada.
+func WriteACKVersion(w io.Writer, status byte, message string, sessionID string, compressionMode, version byte) error {
+	if err := WriteACK(w, status, message, sessionID, compressionMode|ACKFlagVersion); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{version}); err != nil {
+		return fmt.Errorf("writing ack version: %w", err)
+	}
+	return nil
+}
+
+// WriteACKVersionMismatch escreve a recusa de um handshake por versão:
+// [Status 0x09] [Message] ['\n'] ['\n'] [CompressionMode 1B] [Min 1B] [Max 1B].
+// O ACK v4 inicial é lido por agents de qualquer versão, que exibem a
+// mensagem; agents que conhecem StatusVersionMismatch leem também o intervalo
+// aceito para indicar o lado a atualizar.
+func WriteACKVersionMismatch(w io.Writer, message string, supported VersionRange) error {
+	if err := WriteACK(w, StatusVersionMismatch, message, "", CompressionGzip); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{supported.Min, supported.Max}); err != nil {
+		return fmt.Errorf("writing ack supported versions: %w", err)
+	}
+	return nil
+}
+
 // WriteACKLegacy foi removido na v4.0.0 — não há mais suporte a agents sem CompressionMode.
 
 // WriteTrailer escreve o frame trailer (Client → Server).
@@ -91,6 +146,22 @@ func WriteTrailer(w io.Writer, checksum [32]byte, size uint64) error {
 	return nil
 }
 
+// WriteManifest escreve o frame Manifest (Client → Server), enviado
+// imediatamente antes do trailer quando o backup entry gera manifest de arquivos.
+// Formato: [Magic "MNFT" 4B] [Size uint64 8B] [Manifest Size bytes]
+func WriteManifest(w io.Writer, manifest io.Reader, size int64) error {
+	if _, err := w.Write(MagicManifest[:]); err != nil {
+		return fmt.Errorf("writing manifest magic: %w", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, uint64(size)); err != nil {
+		return fmt.Errorf("writing manifest size: %w", err)
+	}
+	if _, err := io.CopyN(w, manifest, size); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	return nil
+}
+
 // WriteFinalACK escreve o frame Final ACK (Server → Client).
 // Formato: [Status 1B]
 func WriteFinalACK(w io.Writer, status byte) error {
@@ -109,6 +180,18 @@ func WritePing(w io.Writer) error {
 	return nil
 }
 
+// WritePingStorage escreve o health check de um storage específico (Client → Server).
+// Formato: [Magic "PSTG" 4B] [StorageName UTF-8] ['\n' 1B]
+func WritePingStorage(w io.Writer, storageName string) error {
+	if _, err := w.Write(MagicPingStorage[:]); err != nil {
+		return fmt.Errorf("writing ping storage magic: %w", err)
+	}
+	if _, err := w.Write([]byte(storageName + "\n")); err != nil {
+		return fmt.Errorf("writing ping storage name: %w", err)
+	}
+	return nil
+}
+
 // WriteHealthResponse escreve a resposta do health check (Server → Client).
 // Formato: [Status 1B] [DiskFree uint64 8B] ['\n' 1B]
 func WriteHealthResponse(w io.Writer, status byte, diskFree uint64) error {
@@ -168,6 +251,16 @@ func WriteResumeACK(w io.Writer, status byte, lastOffset uint64) error {
 	return nil
 }
 
+// WriteParallelResume escreve a extensão do Resume ACK de uma sessão paralela
+// (Server → Client), logo após um ResumeACK OK.
+// Formato: [NextSeq uint32 4B]
+func WriteParallelResume(w io.Writer, nextSeq uint32) error {
+	if err := binary.Write(w, binary.BigEndian, nextSeq); err != nil {
+		return fmt.Errorf("writing parallel resume next seq: %w", err)
+	}
+	return nil
+}
+
 // WriteParallelInit escreve a extensão ParallelInit no handshake (Client → Server).
 // Formato: [MaxStreams uint8 1B] [ChunkSize uint32 4B]
 func WriteParallelInit(w io.Writer, maxStreams uint8, chunkSize uint32) error {
@@ -180,6 +273,18 @@ func WriteParallelInit(w io.Writer, maxStreams uint8, chunkSize uint32) error {
 	return nil
 }
 
+// WriteParallelInitRange escreve o ParallelInit do handshake v8+.
+// Formato: [MaxStreams uint8 1B] [ChunkSize uint32 4B] [ChunkSizeMax uint32 4B]
+func WriteParallelInitRange(w io.Writer, maxStreams uint8, chunkSize, chunkSizeMax uint32) error {
+	if err := WriteParallelInit(w, maxStreams, chunkSize); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, chunkSizeMax); err != nil {
+		return fmt.Errorf("writing parallel init chunk size max: %w", err)
+	}
+	return nil
+}
+
 // WriteParallelInitACK escreve a resposta ao ParallelInit (Server → Client).
 // Formato: [Status 1B]
 func WriteParallelInitACK(w io.Writer, status byte) error {
@@ -243,6 +348,51 @@ func WriteChunkSACK(w io.Writer, streamIndex uint8, chunkSeq uint32, offset uint
 	return nil
 }
 
+// WriteChunkNACK escreve o frame ChunkNACK (Server → Client, por stream).
+// Formato: [Magic "CNAK" 4B] [StreamIndex uint8 1B] [GlobalSeq uint32 4B]
+func WriteChunkNACK(w io.Writer, streamIndex uint8, globalSeq uint32) error {
+	buf := make([]byte, 0, 9)
+	buf = append(buf, MagicChunkNACK[:]...)
+	buf = append(buf, streamIndex)
+	buf = binary.BigEndian.AppendUint32(buf, globalSeq)
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("writing chunk nack: %w", err)
+	}
+	return nil
+}
+
+// WriteStreamTrailer escreve o StreamTrailer de um stream paralelo (Client → Server):
+// ChunkHeader com GlobalSeq = StreamTrailerSeq seguido de [Chunks uint32 4B] [Bytes uint64 8B].
+func WriteStreamTrailer(w io.Writer, streamIndex uint8, chunks uint32, bytes uint64) error {
+	payload := make([]byte, 0, StreamTrailerPayloadSize)
+	payload = binary.BigEndian.AppendUint32(payload, chunks)
+	payload = binary.BigEndian.AppendUint64(payload, bytes)
+
+	buf := make([]byte, 0, ChunkHeaderSize+StreamTrailerPayloadSize)
+	buf = binary.BigEndian.AppendUint32(buf, StreamTrailerSeq)
+	buf = binary.BigEndian.AppendUint32(buf, StreamTrailerPayloadSize)
+	buf = append(buf, streamIndex)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(payload))
+	buf = append(buf, payload...)
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("writing stream trailer: %w", err)
+	}
+	return nil
+}
+
+// WriteStreamTrailerACK escreve a resposta ao StreamTrailer (Server → Client, por stream).
+// Formato: [Magic "STAK" 4B] [StreamIndex uint8 1B] [Status 1B] [Offset uint64 8B]
+func WriteStreamTrailerACK(w io.Writer, streamIndex, status uint8, offset uint64) error {
+	buf := make([]byte, 0, 14)
+	buf = append(buf, MagicStreamTrailerACK[:]...)
+	buf = append(buf, streamIndex, status)
+	buf = binary.BigEndian.AppendUint64(buf, offset)
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("writing stream trailer ack: %w", err)
+	}
+	return nil
+}
+
 // WriteChunkHeader escreve o header de chunk paralelo (Client → Server).
 // Formato: [GlobalSeq uint32 4B] [Length uint32 4B] [SlotID uint8 1B] [CRC32 uint32 4B]
 func WriteChunkHeader(w io.Writer, globalSeq, length uint32, slotID uint8, crc32val uint32) error {
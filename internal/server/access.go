@@ -0,0 +1,110 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+
+	"github.com/nishisan-dev/n-backup/internal/auth"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+)
+
+// Erros de autorização de agents (tls.crl_file / tls.allowed_agents /
+// listeners.allowed_agents).
+var (
+	errAgentRevoked              = errors.New("agent certificate revoked")
+	errAgentNotAllowed           = errors.New("agent not in tls.allowed_agents")
+	errAgentNotAllowedOnListener = errors.New("agent not in listeners.allowed_agents")
+)
+
+// loadCRL (re)carrega o CRLChecker de tls.crl_file. Path vazio desabilita a
+// verificação de revogação. Em caso de erro, o checker anterior é mantido.
+func (h *Handler) loadCRL(crlPath, caPath string) error {
+	if crlPath == "" {
+		h.crl.Store(nil)
+		return nil
+	}
+	checker, err := pki.NewCRLChecker(crlPath, caPath, h.logger.With("component", "crl"))
+	if err != nil {
+		return fmt.Errorf("loading tls.crl_file: %w", err)
+	}
+	h.crl.Store(checker)
+	h.logger.Info("crl loaded", "path", crlPath, "revoked", checker.Count())
+	return nil
+}
+
+// checkAgent verifica a identidade do agent contra a allow-list vigente e,
+// se a conexão apresentou certificado, contra a CRL. Retorna errAgentRevoked
+// ou errAgentNotAllowed.
+func (h *Handler) checkAgent(id auth.Identity, cert *x509.Certificate) error {
+	if crl := h.crl.Load(); cert != nil && crl != nil && crl.IsRevoked(cert) {
+		return errAgentRevoked
+	}
+	if allowed := h.config().TLS.AllowedAgents; len(allowed) > 0 && !slices.Contains(allowed, id.Name) {
+		return errAgentNotAllowed
+	}
+	return nil
+}
+
+// verifyPeerCertificate é o callback tls.Config.VerifyPeerCertificate do
+// listener principal: executado após a validação da cadeia, recusa o
+// handshake TLS de certificados revogados. CNs fora da allow-list passam pelo
+// TLS e são recusados no handshake do protocolo (authorizeAgent), onde o agent
+// recebe um status explícito.
+func (h *Handler) verifyPeerCertificate(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+		return nil // sem cadeia verificada o handshake já falha em RequireAndVerifyClientCert
+	}
+	leaf := verifiedChains[0][0]
+	id := auth.FromCertificate(leaf)
+	if err := h.checkAgent(id, leaf); errors.Is(err, errAgentRevoked) {
+		h.rejectAgent(id, err, "tls", h.logger)
+		return err
+	}
+	return nil
+}
+
+// authorizeAgent aplica a allow-list à identidade da conexão (certificado ou
+// PSK), a CRL ao certificado e a allow-list do listener que aceitou a conexão
+// (ctx), no handshake do protocolo. Conexões sem identidade (ex: testes com
+// net.Pipe) não são verificadas — o listener de produção sempre exige mTLS ou PSK.
+func (h *Handler) authorizeAgent(ctx context.Context, conn net.Conn, logger *slog.Logger) error {
+	conn = untraced(conn)
+	id, ok := auth.FromConn(conn)
+	if !ok {
+		return nil
+	}
+	err := h.checkAgent(id, auth.PeerCertificate(conn))
+	if lp := listenerFrom(ctx); err == nil && !lp.allows(id.Name) {
+		err = fmt.Errorf("%w (listener %s)", errAgentNotAllowedOnListener, lp.name)
+	}
+	if err != nil {
+		h.rejectAgent(id, err, "handshake", logger)
+		return err
+	}
+	return nil
+}
+
+// rejectAgent registra a recusa de um agent (log + evento agent_rejected)
+// com a credencial apresentada (ex: "serial 1a2b", "psk").
+func (h *Handler) rejectAgent(id auth.Identity, reason error, stage string, logger *slog.Logger) {
+	logger.Warn("agent rejected",
+		"agent", id.Name,
+		"auth", id.Method,
+		"credential", id.Credential,
+		"reason", reason,
+		"stage", stage,
+	)
+	if h.Events != nil {
+		h.Events.PushEvent("warn", "agent_rejected", id.Name,
+			fmt.Sprintf("%s (%s)", reason, id.Credential), 0)
+	}
+}
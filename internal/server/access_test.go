@@ -0,0 +1,179 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/auth"
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+)
+
+// issueAgentTLS emite um certificado de agent e retorna a config TLS do client.
+func issueAgentTLS(t *testing.T, cfg *config.ServerConfig, ca *pki.CA, agent string) (*tls.Config, *big.Int) {
+	t.Helper()
+	dir := t.TempDir()
+	keyPEM, csrPEM, err := pki.NewClientCSR(agent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := ca.SignClientCSR(csrPEM, agent, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, "agent.pem")
+	keyPath := filepath.Join(dir, "agent-key.pem")
+	os.WriteFile(certPath, certPEM, 0644)
+	os.WriteFile(keyPath, keyPEM, 0600)
+	clientCfg, err := pki.NewClientTLSConfig(cfg.TLS.CACert, certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCfg.ServerName = "127.0.0.1"
+	cert, err := pki.LoadCertificate(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientCfg, cert.SerialNumber
+}
+
+func TestAgentAccess_CRLAndAllowList(t *testing.T) {
+	cfg, _ := setupEnrollPKI(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ca, err := pki.LoadCA(cfg.TLS.CACert, cfg.Enrollment.CAKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedCfg, revokedSerial := issueAgentTLS(t, cfg, ca, "old-01")
+	allowedCfg, _ := issueAgentTLS(t, cfg, ca, "web-01")
+	strangerCfg, _ := issueAgentTLS(t, cfg, ca, "db-01")
+
+	cfg.TLS.CRLFile = filepath.Join(filepath.Dir(cfg.TLS.CACert), "crl.pem")
+	crl, err := ca.CreateCRL(nil, []*big.Int{revokedSerial}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(cfg.TLS.CRLFile, crl, 0644)
+	cfg.TLS.AllowedAgents = []string{"web-01", "old-01"}
+
+	h := &Handler{cfg: cfg, logger: logger}
+	if err := h.loadCRL(cfg.TLS.CRLFile, cfg.TLS.CACert); err != nil {
+		t.Fatalf("loadCRL: %v", err)
+	}
+	reloader, err := pki.NewCertReloader(cfg.TLS.CACert, cfg.TLS.ServerCert, cfg.TLS.ServerKey, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader.SetVerifyPeerCertificate(h.verifyPeerCertificate)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", reloader.ServerTLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	authz := make(chan error, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if err := tlsConn.Handshake(); err == nil {
+				authz <- h.authorizeAgent(context.Background(), conn, logger)
+			}
+			conn.Close()
+		}
+	}()
+
+	dial := func(clientCfg *tls.Config) error {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), clientCfg)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// Em TLS 1.3 o alerta do server chega na primeira leitura.
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+
+	// Certificado revogado: recusado já no handshake TLS.
+	if err := dial(revokedCfg); err == nil {
+		t.Fatal("expected revoked certificate to fail the TLS handshake")
+	}
+
+	if err := dial(allowedCfg); err != nil {
+		t.Fatalf("allowed agent: %v", err)
+	}
+	if err := <-authz; err != nil {
+		t.Fatalf("expected allowed agent to be authorized, got %v", err)
+	}
+
+	// CN fora da allow-list: TLS ok, recusado no handshake do protocolo.
+	if err := dial(strangerCfg); err != nil {
+		t.Fatalf("stranger agent TLS: %v", err)
+	}
+	if err := <-authz; !errors.Is(err, errAgentNotAllowed) {
+		t.Fatalf("expected errAgentNotAllowed, got %v", err)
+	}
+
+	// Reload liberando o agent aplica a allow-list sem restart.
+	newCfg := *cfg
+	newCfg.TLS.AllowedAgents = []string{"web-01", "db-01"}
+	h.Reload(&newCfg)
+	if err := dial(strangerCfg); err != nil {
+		t.Fatalf("stranger agent TLS after reload: %v", err)
+	}
+	if err := <-authz; err != nil {
+		t.Fatalf("expected db-01 authorized after reload, got %v", err)
+	}
+}
+
+func TestCheckAgent_SPIFFEIdentity(t *testing.T) {
+	h := &Handler{cfg: &config.ServerConfig{TLS: config.TLSServer{AllowedAgents: []string{"web-01"}}}}
+	svid, _ := url.Parse("spiffe://example.org/nbackup/web-01")
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "workload"}, SerialNumber: big.NewInt(1), URIs: []*url.URL{svid}}
+
+	if err := h.checkAgent(auth.FromCertificate(cert), cert); err != nil {
+		t.Fatalf("expected SPIFFE name in the allow-list to be authorized, got %v", err)
+	}
+	cert.URIs = nil
+	if err := h.checkAgent(auth.FromCertificate(cert), cert); !errors.Is(err, errAgentNotAllowed) {
+		t.Fatalf("expected CN outside the allow-list to be rejected, got %v", err)
+	}
+}
+
+func TestRestartRequiredSections_AgentAccessIsReloadable(t *testing.T) {
+	old := &config.ServerConfig{TLS: config.TLSServer{CACert: "/etc/nbackup/ca.pem"}}
+	cur := &config.ServerConfig{TLS: config.TLSServer{
+		CACert:        "/etc/nbackup/ca.pem",
+		CRLFile:       "/etc/nbackup/crl.pem",
+		AllowedAgents: []string{"web-01"},
+	}}
+	if sections := restartRequiredSections(old, cur); len(sections) != 0 {
+		t.Fatalf("expected crl_file/allowed_agents to be reloadable, got %v", sections)
+	}
+	cur.TLS.CACert = "/etc/nbackup/other-ca.pem"
+	if sections := restartRequiredSections(old, cur); len(sections) != 1 || sections[0] != "tls" {
+		t.Fatalf("expected tls restart for ca_cert change, got %v", sections)
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"log/slog"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// OpenAccounting abre a contabilidade de ingestão (accounting), se habilitada.
+func (h *Handler) OpenAccounting(cfg config.AccountingConfig, logger *slog.Logger) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	store, err := observability.NewAccountingStore(cfg.File, cfg.RetentionDays)
+	if err != nil {
+		return err
+	}
+	h.Accounting = store
+	logger.Info("ingest accounting enabled", "file", cfg.File, "retention_days", cfg.RetentionDays)
+	return nil
+}
+
+// AccountingReport monta o relatório de ingestão do período de f.
+// Implementa observability.AccountingReporter.
+func (h *Handler) AccountingReport(f observability.AccountingFilter) (*observability.AccountingReport, error) {
+	if h.Accounting == nil {
+		return nil, observability.ErrAccountingDisabled
+	}
+	rep := observability.BuildAccountingReport(h.Accounting.Days(), f)
+	return &rep, nil
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// adminIOTimeout limita a duração de uma requisição no socket de administração.
+const adminIOTimeout = 10 * time.Second
+
+// Comandos aceitos pelo socket de administração do server.
+const (
+	AdminCmdSessions = "sessions"
+	AdminCmdCancel   = "cancel"
+	AdminCmdAgents   = "agents"
+	AdminCmdStorage  = "storage"
+	AdminCmdSnapshot = "snapshot"
+)
+
+// AdminRequest é uma requisição JSON (uma por conexão) ao socket de administração.
+type AdminRequest struct {
+	Command string `json:"command"`
+	Session string `json:"session,omitempty"`
+	Reason  string `json:"reason,omitempty"` // cancel: reason do ControlAbort enviado ao agent
+	Group   string `json:"group,omitempty"`
+}
+
+// AdminResponse é a resposta JSON do server.
+type AdminResponse struct {
+	OK       bool                           `json:"ok"`
+	Error    string                         `json:"error,omitempty"`
+	Message  string                         `json:"message,omitempty"`
+	Sessions []observability.SessionSummary `json:"sessions,omitempty"`
+	Agents   []observability.AgentInfo      `json:"agents,omitempty"`
+	Storage  []observability.StorageUsage   `json:"storage,omitempty"`
+}
+
+// AdminBackend implementa as operações expostas pelo socket de administração.
+type AdminBackend interface {
+	SessionsSnapshot() []observability.SessionSummary
+	ConnectedAgents() []observability.AgentInfo
+	StorageUsageSnapshot() []observability.StorageUsage
+	CancelSession(id, reason string) error
+	TriggerSnapshotGroup(name string) error
+}
+
+// AdminServer atende o socket unix local de administração do server
+// (`nbackup-server sessions|agents|storage`).
+type AdminServer struct {
+	path    string
+	backend AdminBackend
+	logger  *slog.Logger
+	ln      net.Listener
+	wg      sync.WaitGroup
+}
+
+// NewAdminServer cria um AdminServer para o socket em path.
+func NewAdminServer(path string, backend AdminBackend, logger *slog.Logger) *AdminServer {
+	return &AdminServer{
+		path:    path,
+		backend: backend,
+		logger:  logger.With("component", "admin_socket"),
+	}
+}
+
+// Start cria o socket e começa a aceitar conexões.
+// Um socket residual de um server morto é removido; se outro server
+// estiver respondendo no mesmo path, retorna erro.
+func (a *AdminServer) Start() error {
+	if err := os.MkdirAll(filepath.Dir(a.path), 0750); err != nil {
+		return fmt.Errorf("creating admin socket dir: %w", err)
+	}
+	if _, err := os.Stat(a.path); err == nil {
+		if conn, dialErr := net.DialTimeout("unix", a.path, time.Second); dialErr == nil {
+			conn.Close()
+			return fmt.Errorf("admin socket %s already in use by another server", a.path)
+		}
+		os.Remove(a.path)
+	}
+
+	ln, err := net.Listen("unix", a.path)
+	if err != nil {
+		return fmt.Errorf("listening on admin socket: %w", err)
+	}
+	if err := os.Chmod(a.path, 0660); err != nil {
+		ln.Close()
+		return fmt.Errorf("setting admin socket permissions: %w", err)
+	}
+	a.ln = ln
+
+	a.wg.Add(1)
+	go a.acceptLoop()
+
+	a.logger.Info("admin socket listening", "path", a.path)
+	return nil
+}
+
+// Stop fecha o socket e aguarda as requisições em andamento.
+func (a *AdminServer) Stop() {
+	if a.ln == nil {
+		return
+	}
+	a.ln.Close()
+	a.wg.Wait()
+	os.Remove(a.path)
+	a.logger.Info("admin socket stopped")
+}
+
+func (a *AdminServer) acceptLoop() {
+	defer a.wg.Done()
+	for {
+		conn, err := a.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			a.logger.Warn("admin socket accept failed", "error", err)
+			continue
+		}
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.handle(conn)
+		}()
+	}
+}
+
+func (a *AdminServer) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(adminIOTimeout))
+
+	var req AdminRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		json.NewEncoder(conn).Encode(AdminResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	resp := a.dispatch(req)
+	switch req.Command {
+	case AdminCmdCancel:
+		a.logger.Info("admin command", "command", req.Command, "session", req.Session, "ok", resp.OK, "error", resp.Error)
+	case AdminCmdSnapshot:
+		a.logger.Info("admin command", "command", req.Command, "group", req.Group, "ok", resp.OK, "error", resp.Error)
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+func (a *AdminServer) dispatch(req AdminRequest) AdminResponse {
+	switch req.Command {
+	case AdminCmdSessions:
+		return AdminResponse{OK: true, Sessions: a.backend.SessionsSnapshot()}
+	case AdminCmdAgents:
+		return AdminResponse{OK: true, Agents: a.backend.ConnectedAgents()}
+	case AdminCmdStorage:
+		return AdminResponse{OK: true, Storage: a.backend.StorageUsageSnapshot()}
+	case AdminCmdCancel:
+		if req.Session == "" {
+			return AdminResponse{Error: "session id is required"}
+		}
+		if err := a.backend.CancelSession(req.Session, req.Reason); err != nil {
+			return AdminResponse{Error: err.Error()}
+		}
+		return AdminResponse{OK: true, Message: fmt.Sprintf("session %s cancelled", req.Session)}
+	case AdminCmdSnapshot:
+		if req.Group == "" {
+			return AdminResponse{Error: "snapshot group is required"}
+		}
+		if err := a.backend.TriggerSnapshotGroup(req.Group); err != nil {
+			return AdminResponse{Error: err.Error()}
+		}
+		return AdminResponse{OK: true, Message: fmt.Sprintf("snapshot group %s triggered (result in the server log and events)", req.Group)}
+	}
+	return AdminResponse{Error: fmt.Sprintf("unknown command %q", req.Command)}
+}
+
+// AdminCall envia uma requisição ao socket de administração de um server em execução.
+func AdminCall(path string, req AdminRequest) (*AdminResponse, error) {
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to server at %s: %w", path, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(adminIOTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("sending admin request: %w", err)
+	}
+	var resp AdminResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("reading admin response: %w", err)
+	}
+	if !resp.OK {
+		return &resp, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// handlerAdmin adapta o Handler ao AdminBackend: cancelamentos pelo socket
+// são identificados como "admin" nos logs e geram um evento de auditoria.
+type handlerAdmin struct {
+	*Handler
+}
+
+func (h handlerAdmin) CancelSession(id, reason string) error {
+	agent := sessionAgent(h.sessions, id)
+	if err := h.abortSession(id, "admin", reason); err != nil {
+		return err
+	}
+	if h.Events != nil {
+		h.Events.PushEvent("info", "admin_action", agent, "session "+id+" cancelled (by admin socket)", 0)
+	}
+	return nil
+}
+
+// TriggerSnapshotGroup dispara o snapshot_group name em background: a fase de
+// snapshot dura até prepare_timeout, mais que uma requisição do socket.
+func (h handlerAdmin) TriggerSnapshotGroup(name string) error {
+	if _, ok := h.snapshotGroup(name); !ok {
+		return fmt.Errorf("unknown snapshot group %q", name)
+	}
+	if _, running := h.snapshotGroupsActive.Load(name); running {
+		return fmt.Errorf("snapshot group %q is already running", name)
+	}
+	if h.Events != nil {
+		h.Events.PushEvent("info", "admin_action", "", "snapshot group "+name+" triggered (by admin socket)", 0)
+	}
+	go func() {
+		if _, err := h.RunSnapshotGroup(context.Background(), name); err != nil {
+			h.logger.Warn("snapshot group run failed", "group", name, "error", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// WriteAdminJSON escreve a resposta de um comando de administração em JSON indentado.
+func WriteAdminJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// WriteSessionsTable escreve as sessões ativas em formato de tabela.
+func WriteSessionsTable(w io.Writer, sessions []observability.SessionSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SESSION\tAGENT\tSTORAGE\tBACKUP\tMODE\tPHASE\tSTATUS\tSTREAMS\tRECEIVED\tSTARTED\tETA")
+	for _, s := range sessions {
+		streams := fmt.Sprintf("%d", s.ActiveStreams)
+		if s.MaxStreams > 0 {
+			streams = fmt.Sprintf("%d/%d", s.ActiveStreams, s.MaxStreams)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.SessionID, s.Agent, s.Storage, orDash(s.Backup), s.Mode, orDash(s.Phase), s.Status,
+			streams, formatBytesGo(s.BytesReceived), s.StartedAt, orDash(s.ETA))
+	}
+	return tw.Flush()
+}
+
+// WriteAgentsTable escreve os agents conectados via control channel em formato de tabela.
+func WriteAgentsTable(w io.Writer, agents []observability.AgentInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "AGENT\tADDRESS\tVERSION\tCONNECTED\tSESSION\tCPU\tMEM\tDISK")
+	for _, a := range agents {
+		session := "no"
+		if a.HasSession {
+			session = "yes"
+		}
+		cpu, mem, disk := "-", "-", "-"
+		if a.Stats != nil {
+			cpu = fmt.Sprintf("%.0f%%", a.Stats.CPUPercent)
+			mem = fmt.Sprintf("%.0f%%", a.Stats.MemoryPercent)
+			disk = fmt.Sprintf("%.0f%%", a.Stats.DiskUsagePercent)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			a.Name, a.RemoteAddr, orDash(a.ClientVersion), a.ConnectedFor, session, cpu, mem, disk)
+	}
+	return tw.Flush()
+}
+
+// WriteStorageTable escreve o uso de disco de cada storage em formato de tabela.
+func WriteStorageTable(w io.Writer, storages []observability.StorageUsage) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STORAGE\tBASE DIR\tUSED\tFREE\tTOTAL\tUSE%\tINODES%\tBACKUPS\tWINDOW")
+	for _, s := range storages {
+		inodes := "-"
+		if s.TotalInodes > 0 {
+			inodes = fmt.Sprintf("%.1f%%", s.InodeUsagePct)
+		}
+		window := "always"
+		if s.BackupWindow != "" {
+			window = s.BackupWindow + " (closed)"
+			if s.WindowOpen {
+				window = s.BackupWindow + " (open)"
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%.1f%%\t%s\t%d\t%s\n",
+			s.Name, s.BaseDir, formatBytesGo(int64(s.UsedBytes)), formatBytesGo(int64(s.FreeBytes)),
+			formatBytesGo(int64(s.TotalBytes)), s.UsagePercent, inodes, s.BackupsCount, window)
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+type fakeServerAdminBackend struct {
+	cancelled string
+	reason    string
+	snapshot  string
+}
+
+func (f *fakeServerAdminBackend) SessionsSnapshot() []observability.SessionSummary {
+	return []observability.SessionSummary{{SessionID: "s1", Agent: "web-01", Storage: "default", Mode: "parallel", BytesReceived: 2048}}
+}
+
+func (f *fakeServerAdminBackend) ConnectedAgents() []observability.AgentInfo {
+	return []observability.AgentInfo{{Name: "web-01", RemoteAddr: "10.0.0.5:41000"}}
+}
+
+func (f *fakeServerAdminBackend) StorageUsageSnapshot() []observability.StorageUsage {
+	return []observability.StorageUsage{{Name: "default", BaseDir: "/srv/backups", TotalBytes: 100 << 30}}
+}
+
+func (f *fakeServerAdminBackend) TriggerSnapshotGroup(name string) error {
+	if name != "pg-cluster" {
+		return fmt.Errorf("unknown snapshot group %q", name)
+	}
+	f.snapshot = name
+	return nil
+}
+
+func (f *fakeServerAdminBackend) CancelSession(id, reason string) error {
+	if id != "s1" {
+		return fmt.Errorf("session %s: %w", id, observability.ErrNotFound)
+	}
+	f.cancelled, f.reason = id, reason
+	return nil
+}
+
+func startTestServerAdmin(t *testing.T, backend AdminBackend) string {
+	t.Helper()
+	// Paths de socket unix são limitados a ~108 bytes; evita TempDir longos
+	dir, err := os.MkdirTemp("", "nbsadm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "run", "server.sock")
+
+	srv := NewAdminServer(path, backend, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(srv.Stop)
+	return path
+}
+
+func TestAdminServer_Commands(t *testing.T) {
+	backend := &fakeServerAdminBackend{}
+	path := startTestServerAdmin(t, backend)
+
+	resp, err := AdminCall(path, AdminRequest{Command: AdminCmdSessions})
+	if err != nil {
+		t.Fatalf("sessions: %v", err)
+	}
+	if len(resp.Sessions) != 1 || resp.Sessions[0].SessionID != "s1" {
+		t.Fatalf("unexpected sessions response: %+v", resp.Sessions)
+	}
+
+	resp, err = AdminCall(path, AdminRequest{Command: AdminCmdAgents})
+	if err != nil || len(resp.Agents) != 1 || resp.Agents[0].Name != "web-01" {
+		t.Fatalf("unexpected agents response: %+v (err=%v)", resp, err)
+	}
+
+	resp, err = AdminCall(path, AdminRequest{Command: AdminCmdStorage})
+	if err != nil || len(resp.Storage) != 1 || resp.Storage[0].Name != "default" {
+		t.Fatalf("unexpected storage response: %+v (err=%v)", resp, err)
+	}
+
+	if _, err := AdminCall(path, AdminRequest{Command: AdminCmdCancel, Session: "s1", Reason: "maintenance"}); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if backend.cancelled != "s1" || backend.reason != "maintenance" {
+		t.Errorf("cancel not forwarded: %+v", backend)
+	}
+
+	if _, err := AdminCall(path, AdminRequest{Command: AdminCmdSnapshot, Group: "pg-cluster"}); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if backend.snapshot != "pg-cluster" {
+		t.Errorf("snapshot not forwarded: %+v", backend)
+	}
+}
+
+func TestAdminServer_Errors(t *testing.T) {
+	path := startTestServerAdmin(t, &fakeServerAdminBackend{})
+
+	if _, err := AdminCall(path, AdminRequest{Command: AdminCmdCancel, Session: "nope"}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error for unknown session, got %v", err)
+	}
+	if _, err := AdminCall(path, AdminRequest{Command: AdminCmdCancel}); err == nil {
+		t.Error("expected error for missing session id")
+	}
+	if _, err := AdminCall(path, AdminRequest{Command: AdminCmdSnapshot}); err == nil {
+		t.Error("expected error for missing snapshot group")
+	}
+	if _, err := AdminCall(path, AdminRequest{Command: "explode"}); err == nil {
+		t.Error("expected error for unknown command")
+	}
+}
+
+func TestHandlerAdmin_CancelAudited(t *testing.T) {
+	base := t.TempDir()
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: base}})
+	h.ensureEventStore()
+
+	tmpPath := filepath.Join(base, "backup-1.tmp")
+	os.WriteFile(tmpPath, []byte("partial"), 0644)
+	s := &PartialSession{TmpPath: tmpPath, AgentName: "web-01", StorageName: "default", CreatedAt: time.Now(), Phase: NewSessionPhaseTracker()}
+	h.sessions.Store("s1", s)
+
+	if err := (handlerAdmin{h}).CancelSession("s1", ""); err != nil {
+		t.Fatalf("CancelSession: %v", err)
+	}
+	if _, ok := h.sessions.Load("s1"); ok {
+		t.Error("expected session removed")
+	}
+	events := h.Events.Recent(10)
+	if len(events) == 0 || events[len(events)-1].Type != "admin_action" || events[len(events)-1].Agent != "web-01" {
+		t.Errorf("expected admin_action event for web-01, got %+v", events)
+	}
+}
+
+func TestWriteSessionsTable(t *testing.T) {
+	var buf bytes.Buffer
+	sessions := []observability.SessionSummary{{SessionID: "s1", Agent: "web-01", Storage: "default", Mode: "parallel", ActiveStreams: 2, MaxStreams: 4, BytesReceived: 2048}}
+	if err := WriteSessionsTable(&buf, sessions); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"SESSION", "s1", "web-01", "2/4", "2.0 KB"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+}
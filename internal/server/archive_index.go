@@ -0,0 +1,444 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// archive_index.go gera e consulta o índice de membros de um archive, usado
+// pelo restore de arquivos individuais (RSTR).
+//
+// Backups com manifest de arquivos chegam como uma sequência de membros gzip
+// (ou frames zstd) reiniciados pelo agent em fronteiras de entrada do tar. No
+// commit, o server percorre o archive e grava, para cada entrada, o offset do
+// membro onde o header começa e quantos bytes descomprimidos pular a partir
+// dele. O restore abre o archive nesse offset e lê apenas a entrada pedida.
+// Archives sem checkpoints (um único membro) também são indexados: o offset é
+// 0 e o restore descomprime até a entrada, mas ainda sem enviar o archive.
+
+package server
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/dedup"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
+)
+
+// archiveIndexSuffix é o sufixo do índice de membros gravado ao lado do archive.
+const archiveIndexSuffix = ".index.jsonl.gz"
+
+// errNotInIndex indica que o caminho pedido não está no índice do archive.
+var errNotInIndex = errors.New("path not found in archive")
+
+// indexEntry é uma linha do índice de membros.
+type indexEntry struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"` // manifest.Type*
+	Link   string `json:"link,omitempty"`
+	Offset int64  `json:"offset"`         // offset (comprimido) do membro que contém o header
+	Skip   int64  `json:"skip,omitempty"` // bytes descomprimidos do início do membro até o header
+}
+
+// archiveIndexPath retorna o caminho do índice de membros do backup em path.
+func archiveIndexPath(path string) string {
+	return strings.TrimSuffix(path, dedup.ManifestSuffix) + archiveIndexSuffix
+}
+
+// indexArchive gera o índice de membros de um backup recém-commitado. Só
+// backups com manifest de arquivos são indexados (são os que o agent grava
+// com checkpoints); storages dedup não guardam o archive. Falhas são apenas
+// registradas: o backup continua válido, só sem restore de arquivos.
+func (h *Handler) indexArchive(finalPath string, storageInfo config.StorageInfo, logger *slog.Logger) {
+	if storageInfo.IsDedup() {
+		return
+	}
+	if _, err := os.Stat(fileManifestPath(finalPath)); err != nil {
+		return
+	}
+	entries, members, err := buildArchiveIndex(finalPath)
+	if err != nil {
+		logger.Warn("indexing archive members failed — single-file restore unavailable", "path", finalPath, "error", err)
+		return
+	}
+	logger.Info("archive members indexed", "path", finalPath, "entries", entries, "members", members)
+}
+
+// buildArchiveIndex percorre o archive em path e grava o índice em
+// archiveIndexPath(path). Retorna o número de entradas e de membros.
+func buildArchiveIndex(path string) (int64, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("opening archive: %w", err)
+	}
+	defer f.Close()
+
+	var ms *memberStream
+	switch {
+	case strings.HasSuffix(path, ".tar.gz"):
+		ms = gzipMembers(f)
+	case strings.HasSuffix(path, ".tar.zst"):
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, 0, fmt.Errorf("stat archive: %w", err)
+		}
+		if ms, err = zstdMembers(f, fi.Size()); err != nil {
+			return 0, 0, err
+		}
+	default:
+		return 0, 0, fmt.Errorf("unsupported archive extension: %s", path)
+	}
+	defer ms.close()
+
+	out, err := os.CreateTemp(filepath.Dir(path), "index-*.tmp")
+	if err != nil {
+		return 0, 0, fmt.Errorf("creating index file: %w", err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	buf := bufio.NewWriter(out)
+	gz := gzip.NewWriter(buf)
+	enc := json.NewEncoder(gz)
+
+	tr := tar.NewReader(ms)
+	var entries int64
+	for {
+		// Antes do Next o stream está no fim dos dados da entrada anterior:
+		// o header começa no próximo bloco de 512 bytes
+		headerStart := (ms.n + 511) &^ 511
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("reading tar entry #%d: %w", entries+1, err)
+		}
+		m := ms.memberAt(headerStart)
+		e := indexEntry{Path: hdr.Name, Type: indexType(hdr.Typeflag), Offset: m.offset, Skip: headerStart - m.start}
+		if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+			e.Link = hdr.Linkname
+		}
+		if err := enc.Encode(e); err != nil {
+			return 0, 0, fmt.Errorf("writing index entry: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return 0, 0, fmt.Errorf("reading content of tar entry #%d: %w", entries+1, err)
+		}
+		entries++
+	}
+
+	if err := gz.Close(); err != nil {
+		return 0, 0, fmt.Errorf("closing index: %w", err)
+	}
+	if err := buf.Flush(); err != nil {
+		return 0, 0, fmt.Errorf("flushing index: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return 0, 0, fmt.Errorf("closing index: %w", err)
+	}
+	if err := os.Rename(out.Name(), archiveIndexPath(path)); err != nil {
+		return 0, 0, fmt.Errorf("renaming index: %w", err)
+	}
+	return entries, len(ms.members), nil
+}
+
+// indexType converte o typeflag do tar no tipo do manifest de arquivos.
+func indexType(flag byte) string {
+	switch flag {
+	case tar.TypeReg:
+		return manifest.TypeFile
+	case tar.TypeDir:
+		return manifest.TypeDir
+	case tar.TypeSymlink:
+		return manifest.TypeSymlink
+	case tar.TypeLink:
+		return manifest.TypeHardlink
+	}
+	return manifest.TypeOther
+}
+
+// lookupArchiveIndex busca path no índice do archive. Com entradas repetidas,
+// vale a última (como na extração do tar). Retorna os.ErrNotExist se o
+// archive não tem índice e errNotInIndex se path não está nele.
+func lookupArchiveIndex(archivePath, path string) (indexEntry, error) {
+	f, err := os.Open(archiveIndexPath(archivePath))
+	if err != nil {
+		return indexEntry{}, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return indexEntry{}, fmt.Errorf("opening index: %w", err)
+	}
+	defer gz.Close()
+
+	var found indexEntry
+	ok := false
+	dec := json.NewDecoder(gz)
+	for {
+		var e indexEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return indexEntry{}, fmt.Errorf("decoding index entry: %w", err)
+		}
+		if strings.TrimSuffix(e.Path, "/") == path {
+			found, ok = e, true
+		}
+	}
+	if !ok {
+		return indexEntry{}, errNotInIndex
+	}
+	return found, nil
+}
+
+// writeArchiveMember escreve em w um stream tar (sem compressão) com a
+// entrada e do archive. Para um hardlink, content é a entrada alvo: o
+// conteúdo dela é enviado como arquivo regular com o nome de e. Senão,
+// content é a própria e.
+func writeArchiveMember(w io.Writer, archivePath string, e, content indexEntry) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(content.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking archive: %w", err)
+	}
+	r, closeFn, err := archiveDecompressor(f)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	if _, err := io.CopyN(io.Discard, r, content.Skip); err != nil {
+		return fmt.Errorf("skipping to entry: %w", err)
+	}
+
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("reading tar entry: %w", err)
+	}
+	if hdr.Name != content.Path {
+		return fmt.Errorf("index out of date: expected %s at offset %d, found %s", content.Path, content.Offset, hdr.Name)
+	}
+
+	out := *hdr
+	out.Name = e.Path
+	out.Format = tar.FormatUnknown
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&out); err != nil {
+		return fmt.Errorf("writing tar header: %w", err)
+	}
+	if _, err := io.Copy(tw, tr); err != nil {
+		return fmt.Errorf("copying entry content: %w", err)
+	}
+	return tw.Close()
+}
+
+// memberStream concatena os membros de um archive em um único stream
+// descomprimido, registrando onde cada membro começa.
+type memberStream struct {
+	next    func() (io.Reader, int64, error) // próximo membro e seu offset; io.EOF no fim
+	close   func()
+	cur     io.Reader
+	n       int64 // bytes descomprimidos entregues
+	members []archiveMember
+}
+
+// archiveMember é um membro gzip (ou frame zstd) do archive.
+type archiveMember struct {
+	offset int64 // offset no archive comprimido
+	start  int64 // offset no stream descomprimido
+}
+
+func (m *memberStream) Read(p []byte) (int, error) {
+	for {
+		if m.cur == nil {
+			r, offset, err := m.next()
+			if err != nil {
+				return 0, err
+			}
+			m.cur = r
+			m.members = append(m.members, archiveMember{offset: offset, start: m.n})
+		}
+		n, err := m.cur.Read(p)
+		m.n += int64(n)
+		if err == io.EOF {
+			m.cur = nil
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+// memberAt retorna o último membro que começa em ou antes de pos.
+func (m *memberStream) memberAt(pos int64) archiveMember {
+	for i := len(m.members) - 1; i > 0; i-- {
+		if m.members[i].start <= pos {
+			return m.members[i]
+		}
+	}
+	return m.members[0]
+}
+
+// gzipMembers lê os membros de um .tar.gz um a um (sem multistream),
+// contando os bytes comprimidos consumidos para obter o offset de cada um.
+func gzipMembers(f io.Reader) *memberStream {
+	src := &countingByteReader{br: bufio.NewReaderSize(f, 1<<20)}
+	var gz *gzip.Reader
+	return &memberStream{close: func() {}, next: func() (io.Reader, int64, error) {
+		offset := src.n
+		var err error
+		if gz == nil {
+			gz, err = gzip.NewReader(src)
+		} else {
+			err = gz.Reset(src)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		gz.Multistream(false)
+		return gz, offset, nil
+	}}
+}
+
+// countingByteReader conta os bytes lidos de br. Implementa io.ByteReader
+// para que o gzip não leia além do fim de cada membro.
+type countingByteReader struct {
+	br *bufio.Reader
+	n  int64
+}
+
+func (c *countingByteReader) Read(p []byte) (int, error) {
+	n, err := c.br.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingByteReader) ReadByte() (byte, error) {
+	b, err := c.br.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// zstdMembers lê os frames de um .tar.zst um a um, a partir dos limites
+// obtidos por zstdFrames.
+func zstdMembers(f io.ReaderAt, size int64) (*memberStream, error) {
+	frames, err := zstdFrames(f, size)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("initializing zstd reader: %w", err)
+	}
+	i := 0
+	return &memberStream{
+		next: func() (io.Reader, int64, error) {
+			if i >= len(frames) {
+				return nil, 0, io.EOF
+			}
+			start, end := frames[i][0], frames[i][1]
+			i++
+			if err := dec.Reset(io.NewSectionReader(f, start, end-start)); err != nil {
+				return nil, 0, fmt.Errorf("initializing zstd reader: %w", err)
+			}
+			return dec, start, nil
+		},
+		close: dec.Close,
+	}, nil
+}
+
+// Magic numbers do formato zstd (RFC 8878).
+const (
+	zstdFrameMagic     = 0xFD2FB528
+	zstdSkippableMagic = 0x184D2A50 // 0x184D2A50..0x184D2A5F
+)
+
+// zstdFrames percorre os headers de frame e de bloco de um stream zstd e
+// retorna o intervalo [início, fim) de cada frame de dados. Frames skippable
+// são ignorados.
+func zstdFrames(f io.ReaderAt, size int64) ([][2]int64, error) {
+	var frames [][2]int64
+	var buf [14]byte
+	for pos := int64(0); pos < size; {
+		if _, err := f.ReadAt(buf[:4], pos); err != nil {
+			return nil, fmt.Errorf("reading zstd frame at %d: %w", pos, err)
+		}
+		magic := binary.LittleEndian.Uint32(buf[:4])
+		if magic&0xFFFFFFF0 == zstdSkippableMagic {
+			if _, err := f.ReadAt(buf[:4], pos+4); err != nil {
+				return nil, fmt.Errorf("reading zstd skippable frame at %d: %w", pos, err)
+			}
+			pos += 8 + int64(binary.LittleEndian.Uint32(buf[:4]))
+			continue
+		}
+		if magic != zstdFrameMagic {
+			return nil, fmt.Errorf("invalid zstd frame magic at %d", pos)
+		}
+
+		// Frame header: descriptor, window, dictionary ID e content size
+		if _, err := f.ReadAt(buf[:1], pos+4); err != nil {
+			return nil, fmt.Errorf("reading zstd frame header at %d: %w", pos, err)
+		}
+		fhd := buf[0]
+		singleSegment := fhd&0x20 != 0
+		hasChecksum := fhd&0x04 != 0
+		headerSize := int64(1)
+		if !singleSegment {
+			headerSize++
+		}
+		headerSize += [4]int64{0, 1, 2, 4}[fhd&0x03]
+		fcsSize := [4]int64{0, 2, 4, 8}[fhd>>6]
+		if fhd>>6 == 0 && singleSegment {
+			fcsSize = 1
+		}
+		headerSize += fcsSize
+
+		start := pos
+		pos += 4 + headerSize
+		for {
+			if _, err := f.ReadAt(buf[:3], pos); err != nil {
+				return nil, fmt.Errorf("reading zstd block header at %d: %w", pos, err)
+			}
+			bh := uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16
+			last := bh&1 != 0
+			blockSize := int64(bh >> 3)
+			switch (bh >> 1) & 3 {
+			case 1: // RLE: um byte repetido blockSize vezes
+				blockSize = 1
+			case 3:
+				return nil, fmt.Errorf("reserved zstd block type at %d", pos)
+			}
+			pos += 3 + blockSize
+			if last {
+				break
+			}
+		}
+		if hasChecksum {
+			pos += 4
+		}
+		if pos > size {
+			return nil, fmt.Errorf("truncated zstd frame at %d", start)
+		}
+		frames = append(frames, [2]int64{start, pos})
+	}
+	return frames, nil
+}
@@ -7,6 +7,7 @@ package server
 import (
 	"bufio"
 	"crypto/sha256"
+	"encoding"
 	"fmt"
 	"hash"
 	"io"
@@ -47,8 +48,13 @@ var syncFile = func(f *os.File) error {
 type ChunkAssemblerOptions struct {
 	Mode             string
 	PendingMemLimit  int64
-	ShardLevels      int  // 1 ou 2 (default: 1)
-	FsyncChunkWrites bool // true = fsync a cada write de chunk em staging
+	ShardLevels      int        // 1 ou 2 (default: 1)
+	FsyncChunkWrites bool       // true = fsync a cada write de chunk em staging
+	WriteBufferSize  int        // buffer de escrita do arquivo montado (default: 1MB)
+	Preallocate      int64      // bytes reservados para o arquivo montado com fallocate (0 = sem reserva)
+	DropPageCache    bool       // remove do page cache o que já foi gravado do arquivo montado
+	Disk             *diskQueue // fila de escrita do storage (nil = writes diretos)
+	Discard          bool       // não grava o arquivo montado, só calcula o checksum (storage discard)
 }
 
 // ChunkAssembler gerencia chunks de streams paralelos por sessão.
@@ -72,8 +78,12 @@ type ChunkAssembler struct {
 	mode             string                  // assembler mode (imutável)
 	shardLevels      int                     // 1 ou 2 níveis de sharding (imutável)
 	fsyncChunkWrites bool                    // fsync em writes de chunk staging (imutável)
+	preallocated     bool                    // outFile tem blocos reservados além do tamanho (imutável)
+	discard          bool                    // storage discard: nada vai para o disco (imutável)
+	disk             *diskQueue              // fila de escrita do storage, nil = sem fila (imutável)
 	createdShards    map[string]struct{}     // cache de diretórios de shard já criados
-	mu               sync.Mutex              // protege pendingChunks, outBuf, outFile, chunkDirExists, createdShards
+	shardRefs        map[string]int          // arquivos de chunk (reservados ou gravados) por shard dir
+	mu               sync.Mutex              // protege pendingChunks, outBuf, outFile, chunkDirExists, createdShards, shardRefs
 	logger           *slog.Logger
 
 	// Campos atômicos — lidos por Stats() sem lock.
@@ -87,6 +97,7 @@ type ChunkAssembler struct {
 	assembling        atomic.Bool   // true durante finalizeLazy()
 	assembledChunks   atomic.Uint32 // chunks já montados no finalize lazy
 	assemblyStartedAt atomic.Value  // time.Time — quando finalizeLazy() iniciou
+	writeLatencyNs    atomic.Int64  // média móvel (peso 1/8) da gravação de um chunk, incluindo a espera pelo lock
 }
 
 // AssemblerStats contém métricas do estado atual do assembler.
@@ -182,13 +193,31 @@ func NewChunkAssemblerWithMemLimit(sessionID, agentDir string, logger *slog.Logg
 
 // NewChunkAssemblerWithOptions cria um assembler com modo configurável.
 func NewChunkAssemblerWithOptions(sessionID, agentDir string, logger *slog.Logger, opts ChunkAssemblerOptions) (*ChunkAssembler, error) {
+	return newChunkAssembler(sessionID, agentDir, logger, opts, nil)
+}
+
+// ResumeChunkAssembler reabre o staging de uma sessão a partir de um
+// checkpoint (ver Checkpoint): o arquivo montado é truncado em cp.Bytes, o
+// hash continua do estado gravado e os chunks fora de ordem são descartados —
+// o agent os reenvia a partir de cp.NextSeq. Só o modo eager é retomável.
+func ResumeChunkAssembler(sessionID, agentDir string, logger *slog.Logger, opts ChunkAssemblerOptions, cp AssemblerCheckpoint) (*ChunkAssembler, error) {
+	return newChunkAssembler(sessionID, agentDir, logger, opts, &cp)
+}
+
+// newChunkAssembler implementa NewChunkAssemblerWithOptions e
+// ResumeChunkAssembler (cp != nil).
+func newChunkAssembler(sessionID, agentDir string, logger *slog.Logger, opts ChunkAssemblerOptions, cp *AssemblerCheckpoint) (*ChunkAssembler, error) {
 	mode := opts.Mode
-	if mode == "" {
+	// Discard: lazy gravaria todos os chunks em staging só para descartá-los
+	if mode == "" || opts.Discard {
 		mode = AssemblerModeEager
 	}
 	if mode != AssemblerModeEager && mode != AssemblerModeLazy {
 		return nil, fmt.Errorf("invalid assembler mode %q", mode)
 	}
+	if cp != nil && mode != AssemblerModeEager {
+		return nil, fmt.Errorf("assembler mode %q cannot be resumed", mode)
+	}
 
 	shardLevels := opts.ShardLevels
 	if shardLevels == 0 {
@@ -203,21 +232,67 @@ func NewChunkAssemblerWithOptions(sessionID, agentDir string, logger *slog.Logge
 		pendingMemLimit = defaultPendingMemLimit
 	}
 
-	outPath := filepath.Join(agentDir, fmt.Sprintf("assembled_%s.tmp", sessionID))
-	outFile, err := os.Create(outPath)
-	if err != nil {
-		return nil, fmt.Errorf("creating output file: %w", err)
+	writeBufSize := opts.WriteBufferSize
+	if writeBufSize <= 0 {
+		writeBufSize = defaultWriteBufferSize
 	}
 
+	outPath := filepath.Join(agentDir, fmt.Sprintf("assembled_%s.tmp", sessionID))
 	chunkDir := filepath.Join(agentDir, fmt.Sprintf("chunks_%s", sessionID))
 	hasher := sha256.New()
+	var (
+		outFile      *os.File
+		out          io.Writer = io.Discard
+		preallocated bool
+	)
+	if cp != nil {
+		if err := hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(cp.Hash); err != nil {
+			return nil, fmt.Errorf("restoring assembled checksum state: %w", err)
+		}
+		if err := removeChunkTree(chunkDir); err != nil {
+			return nil, fmt.Errorf("removing out-of-order chunks: %w", err)
+		}
+	}
+	// Discard: o arquivo montado nunca é criado (outPath fica só como nome)
+	if !opts.Discard && cp != nil {
+		var err error
+		if outFile, err = openCheckpointOutput(outPath, cp.Bytes); err != nil {
+			return nil, err
+		}
+	} else if !opts.Discard {
+		var err error
+		outFile, err = os.Create(outPath)
+		if err != nil {
+			return nil, fmt.Errorf("creating output file: %w", describeNoSpace(agentDir, err))
+		}
+
+		if opts.Preallocate > 0 {
+			if err := preallocateFile(outFile, opts.Preallocate); err != nil {
+				logger.Warn("preallocating assembled output failed, continuing without reservation",
+					"bytes", opts.Preallocate, "error", err)
+			} else {
+				preallocated = true
+			}
+		}
+	}
+	if outFile != nil {
+		out = outFile
+		if opts.DropPageCache {
+			var off int64
+			if cp != nil {
+				off = cp.Bytes
+			}
+			out = &pageCacheDropWriter{f: outFile, off: off, started: off, dropped: off}
+		}
+		out = opts.Disk.writer(out)
+	}
 
 	ca := &ChunkAssembler{
 		sessionID:        sessionID,
 		baseDir:          agentDir,
 		outPath:          outPath,
 		outFile:          outFile,
-		outBuf:           bufio.NewWriterSize(io.MultiWriter(outFile, hasher), 1024*1024),
+		outBuf:           bufio.NewWriterSize(io.MultiWriter(out, hasher), writeBufSize),
 		hasher:           hasher,
 		chunkDir:         chunkDir,
 		chunkDirExists:   false,
@@ -226,13 +301,48 @@ func NewChunkAssemblerWithOptions(sessionID, agentDir string, logger *slog.Logge
 		mode:             mode,
 		shardLevels:      shardLevels,
 		fsyncChunkWrites: opts.FsyncChunkWrites,
+		preallocated:     preallocated,
+		discard:          opts.Discard,
+		disk:             opts.Disk,
 		createdShards:    make(map[string]struct{}),
+		shardRefs:        make(map[string]int),
 		logger:           logger,
 	}
 	ca.nextExpectedSeq.Store(0)
+	if cp != nil {
+		ca.nextExpectedSeq.Store(cp.NextSeq)
+		ca.totalBytes.Store(cp.Bytes)
+	}
 	return ca, nil
 }
 
+// openCheckpointOutput reabre o arquivo montado para continuar a escrita em
+// size, descartando o que foi gravado após o checkpoint.
+func openCheckpointOutput(path string, size int64) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("reopening output file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reopening output file: %w", err)
+	}
+	if fi.Size() < size {
+		f.Close()
+		return nil, fmt.Errorf("output file has %d bytes, checkpoint needs %d", fi.Size(), size)
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("truncating output file to checkpoint: %w", err)
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("seeking output file to checkpoint: %w", err)
+	}
+	return f, nil
+}
+
 // WriteChunk recebe um chunk com sua sequência global e dados.
 // IMPORTANT: lê os dados do reader FORA do mutex para evitar que I/O TCP lento
 // bloqueie o assembler inteiro. Apenas a escrita local (memória/disco) é protegida.
@@ -242,6 +352,11 @@ func NewChunkAssemblerWithOptions(sessionID, agentDir string, logger *slog.Logge
 // Nota sobre o lock: usa unlocks explícitos (não defer) para permitir que
 // saveOutOfOrder libere/readquira ca.mu durante I/O de disco sem reentrada.
 func (ca *ChunkAssembler) WriteChunk(globalSeq uint32, data io.Reader, length int64) error {
+	return describeNoSpace(ca.baseDir, ca.writeChunk(globalSeq, data, length))
+}
+
+// writeChunk implementa WriteChunk; ENOSPC é enriquecido pelo chamador.
+func (ca *ChunkAssembler) writeChunk(globalSeq uint32, data io.Reader, length int64) error {
 	// Proteção contra OOM: rejeita chunks com tamanho absurdo (header malformado).
 	if length <= 0 || length > maxChunkLength {
 		return fmt.Errorf("chunk seq %d has invalid length %d (max %d)", globalSeq, length, maxChunkLength)
@@ -255,6 +370,9 @@ func (ca *ChunkAssembler) WriteChunk(globalSeq uint32, data io.Reader, length in
 		return fmt.Errorf("reading chunk seq %d from stream: %w", globalSeq, err)
 	}
 
+	start := time.Now()
+	defer func() { ca.observeWriteLatency(time.Since(start)) }()
+
 	ca.mu.Lock()
 
 	if ca.mode == AssemblerModeLazy {
@@ -289,6 +407,13 @@ func (ca *ChunkAssembler) WriteChunk(globalSeq uint32, data io.Reader, length in
 		return nil
 	}
 
+	if _, exists := ca.pendingChunks[globalSeq]; exists {
+		// Chunk já pendente reenviado pelo resume de um stream — ignora
+		ca.logger.Warn("ignoring duplicate out-of-order chunk", "globalSeq", globalSeq)
+		ca.mu.Unlock()
+		return nil
+	}
+
 	// Out-of-order: salva em arquivo temporário.
 	// saveOutOfOrder é chamado com ca.mu held e retorna com ca.mu held.
 	// No path de spill em disco, pode liberar/readquirir ca.mu internamente.
@@ -297,6 +422,25 @@ func (ca *ChunkAssembler) WriteChunk(globalSeq uint32, data io.Reader, length in
 	return err
 }
 
+// observeWriteLatency incorpora uma amostra à média móvel de gravação.
+func (ca *ChunkAssembler) observeWriteLatency(d time.Duration) {
+	for {
+		old := ca.writeLatencyNs.Load()
+		next := int64(d)
+		if old > 0 {
+			next = old + (int64(d)-old)/8
+		}
+		if ca.writeLatencyNs.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// WriteLatency retorna a média móvel do tempo de gravação de um chunk.
+func (ca *ChunkAssembler) WriteLatency() time.Duration {
+	return time.Duration(ca.writeLatencyNs.Load())
+}
+
 // writeChunkLazy grava cada chunk em staging e posterga montagem para Finalize.
 // Deve ser chamado com ca.mu held.
 //
@@ -315,7 +459,8 @@ func (ca *ChunkAssembler) writeChunkLazy(globalSeq uint32, buf []byte) error {
 	if err != nil {
 		return err
 	}
-	if err := writeChunkFile(path, buf, ca.fsyncChunkWrites); err != nil {
+	if err := writeChunkFile(path, buf, ca.fsyncChunkWrites, ca.disk); err != nil {
+		ca.releaseShard(path)
 		return fmt.Errorf("writing lazy chunk seq %d: %w", globalSeq, err)
 	}
 
@@ -367,6 +512,7 @@ func (ca *ChunkAssembler) flushPending() error {
 
 			// Remove arquivo temporário
 			os.Remove(pc.filePath)
+			ca.releaseShard(pc.filePath)
 		}
 		ca.totalBytes.Add(n)
 
@@ -393,7 +539,9 @@ func (ca *ChunkAssembler) saveOutOfOrder(globalSeq uint32, data []byte) error {
 	currentMem := ca.pendingMemBytes.Load()
 
 	// Caminho rápido: cabe em memória — sem I/O, permanece sob lock.
-	if currentMem+int64(len(data)) <= ca.pendingMemLimit {
+	// Storage discard nunca faz spill: a pendência fica limitada pela janela
+	// de chunks em voo dos streams do agent, não pelo pendingMemLimit.
+	if ca.discard || currentMem+int64(len(data)) <= ca.pendingMemLimit {
 		copyBuf := append([]byte(nil), data...)
 		ca.pendingChunks[globalSeq] = pendingChunk{data: copyBuf, length: int64(len(copyBuf))}
 		ca.pendingCount.Add(1)
@@ -420,10 +568,11 @@ func (ca *ChunkAssembler) saveOutOfOrder(globalSeq uint32, data []byte) error {
 	// Passo 2: escreve arquivo temporário FORA do lock.
 	// shardDir existe (garantido pelo passo 1), portanto CreateTemp não falha por dir ausente.
 	ca.mu.Unlock()
-	tmpPath, writeErr := writeChunkToTemp(shardDir, data, ca.fsyncChunkWrites)
+	tmpPath, writeErr := writeChunkToTemp(shardDir, data, ca.fsyncChunkWrites, ca.disk)
 	ca.mu.Lock() // readquire antes de qualquer acesso ao estado
 
 	if writeErr != nil {
+		ca.releaseShard(finalPath)
 		return writeErr
 	}
 
@@ -434,6 +583,7 @@ func (ca *ChunkAssembler) saveOutOfOrder(globalSeq uint32, data []byte) error {
 	// (a) Já registrado em pendingChunks — duplicata concorrente: descarta o temp.
 	if _, exists := ca.pendingChunks[globalSeq]; exists {
 		os.Remove(tmpPath)
+		ca.releaseShard(finalPath)
 		ca.logger.Warn("spill chunk registered concurrently, discarding temp", "globalSeq", globalSeq)
 		return nil
 	}
@@ -443,6 +593,7 @@ func (ca *ChunkAssembler) saveOutOfOrder(globalSeq uint32, data []byte) error {
 	// (b) Chunk virou late/duplicata durante o I/O externo: descarta o temp.
 	if globalSeq < currentNext {
 		os.Remove(tmpPath)
+		ca.releaseShard(finalPath)
 		ca.logger.Warn("spill chunk became late during disk I/O, discarding",
 			"globalSeq", globalSeq, "nextExpected", currentNext)
 		return nil
@@ -452,6 +603,7 @@ func (ca *ChunkAssembler) saveOutOfOrder(globalSeq uint32, data []byte) error {
 	// Os dados ainda estão em memória (parâmetro data), evitando uma leitura extra em disco.
 	if globalSeq == currentNext {
 		os.Remove(tmpPath)
+		ca.releaseShard(finalPath)
 		n, err := ca.outBuf.Write(data)
 		if err != nil {
 			return fmt.Errorf("writing promoted spill chunk seq %d: %w", globalSeq, err)
@@ -465,6 +617,7 @@ func (ca *ChunkAssembler) saveOutOfOrder(globalSeq uint32, data []byte) error {
 	// Passo 4: globalSeq ainda é out-of-order — commit atômico sob lock.
 	if err := os.Rename(tmpPath, finalPath); err != nil {
 		os.Remove(tmpPath)
+		ca.releaseShard(finalPath)
 		return fmt.Errorf("committing spill chunk seq %d: %w", globalSeq, err)
 	}
 	ca.pendingChunks[globalSeq] = pendingChunk{filePath: finalPath, length: int64(len(data))}
@@ -480,12 +633,17 @@ func (ca *ChunkAssembler) saveOutOfOrder(globalSeq uint32, data []byte) error {
 
 // writeChunkFile cria/trunca um arquivo no path, escreve data e fecha.
 // Quando fsyncEnabled=true, força Sync() antes do close para persistir chunk staging.
-func writeChunkFile(path string, data []byte, fsyncEnabled bool) error {
+// O write passa pela fila de disco do storage e o fsync é agrupado por ela.
+func writeChunkFile(path string, data []byte, fsyncEnabled bool, disk *diskQueue) error {
 	f, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("creating chunk file: %w", err)
 	}
-	n, err := f.Write(data)
+	var n int
+	err = disk.do(len(data), func() (err error) {
+		n, err = f.Write(data)
+		return err
+	})
 	if err != nil {
 		f.Close()
 		os.Remove(path)
@@ -497,7 +655,7 @@ func writeChunkFile(path string, data []byte, fsyncEnabled bool) error {
 		return fmt.Errorf("short write on chunk file: wrote %d of %d bytes", n, len(data))
 	}
 	if fsyncEnabled {
-		if err := syncFile(f); err != nil {
+		if err := disk.fsync(f); err != nil {
 			f.Close()
 			os.Remove(path)
 			return fmt.Errorf("syncing chunk file: %w", err)
@@ -512,19 +670,22 @@ func writeChunkFile(path string, data []byte, fsyncEnabled bool) error {
 
 // writeChunkToTemp cria um arquivo temporário em dir, escreve data e fecha.
 // Chamado sem ca.mu held. Retorna o path do arquivo temporário criado.
-func writeChunkToTemp(dir string, data []byte, fsyncEnabled bool) (string, error) {
+func writeChunkToTemp(dir string, data []byte, fsyncEnabled bool, disk *diskQueue) (string, error) {
 	f, err := os.CreateTemp(dir, "spill-*.tmp")
 	if err != nil {
 		return "", fmt.Errorf("creating spill temp file: %w", err)
 	}
 	name := f.Name()
-	if _, err := f.Write(data); err != nil {
+	if err := disk.do(len(data), func() error {
+		_, err := f.Write(data)
+		return err
+	}); err != nil {
 		f.Close()
 		os.Remove(name)
 		return "", fmt.Errorf("writing spill temp file: %w", err)
 	}
 	if fsyncEnabled {
-		if err := syncFile(f); err != nil {
+		if err := disk.fsync(f); err != nil {
 			f.Close()
 			os.Remove(name)
 			return "", fmt.Errorf("syncing spill temp file: %w", err)
@@ -539,6 +700,8 @@ func writeChunkToTemp(dir string, data []byte, fsyncEnabled bool) (string, error
 
 // chunkPath retorna o caminho de staging do chunk usando directory sharding
 // de 1 ou 2 níveis, conforme configurado em shardLevels.
+// Reserva uma referência no shard dir, liberada via releaseShard quando o
+// chunk é consumido ou descartado.
 // Deve ser chamado com ca.mu held.
 //
 // Importante: o cache createdShards é apenas uma pista para observabilidade;
@@ -559,12 +722,90 @@ func (ca *ChunkAssembler) chunkPath(globalSeq uint32) (string, error) {
 		return "", fmt.Errorf("creating chunk shard directory: %w", err)
 	}
 	ca.createdShards[shardDir] = struct{}{}
+	ca.shardRefs[shardDir]++
 	ca.chunkDirExists = true
 
 	name := fmt.Sprintf("chunk_%010d.tmp", globalSeq)
 	return filepath.Join(shardDir, name), nil
 }
 
+// releaseShard libera a referência do chunk em chunkPath no seu shard dir.
+// Quando o shard fica sem chunks, o diretório é removido — e, com 2 níveis,
+// também o nível 1 se ficou vazio (os.Remove falha sem efeito se não estiver).
+// Evita acumular milhares de diretórios vazios em sessões longas.
+// Deve ser chamado com ca.mu held.
+func (ca *ChunkAssembler) releaseShard(chunkPath string) {
+	shardDir := filepath.Dir(chunkPath)
+	ca.shardRefs[shardDir]--
+	if ca.shardRefs[shardDir] > 0 {
+		return
+	}
+	delete(ca.shardRefs, shardDir)
+	delete(ca.createdShards, shardDir)
+	if err := os.Remove(shardDir); err != nil {
+		return
+	}
+	if ca.shardLevels == 2 {
+		os.Remove(filepath.Dir(shardDir))
+	}
+}
+
+// AssemblerCheckpoint é o prefixo durável do arquivo montado: os chunks
+// [0, NextSeq), gravados com fsync em Bytes bytes, e o estado do SHA-256 até
+// ali. Persistido com a sessão, permite retomá-la após um restart do server.
+type AssemblerCheckpoint struct {
+	NextSeq uint32 `json:"next_seq"`
+	Bytes   int64  `json:"bytes"`
+	Hash    []byte `json:"hash"` // estado serializado do sha256 (encoding.BinaryMarshaler)
+}
+
+// Checkpoint descarrega o buffer do arquivo montado, faz fsync e retorna o
+// prefixo durável. ok=false quando a sessão não é retomável: modo lazy (os
+// chunks só são montados no Finalize) ou assembler já finalizado.
+func (ca *ChunkAssembler) Checkpoint() (cp AssemblerCheckpoint, ok bool, err error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if ca.mode != AssemblerModeEager || ca.finalized.Load() || ca.outBuf == nil {
+		return AssemblerCheckpoint{}, false, nil
+	}
+	if err := ca.outBuf.Flush(); err != nil {
+		return AssemblerCheckpoint{}, false, fmt.Errorf("flushing output buffer: %w", describeNoSpace(ca.baseDir, err))
+	}
+	if ca.outFile != nil {
+		if err := ca.disk.fsync(ca.outFile); err != nil {
+			return AssemblerCheckpoint{}, false, fmt.Errorf("syncing output file: %w", err)
+		}
+	}
+	state, err := ca.hasher.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return AssemblerCheckpoint{}, false, fmt.Errorf("saving assembled checksum state: %w", err)
+	}
+	return AssemblerCheckpoint{
+		NextSeq: ca.nextExpectedSeq.Load(),
+		Bytes:   ca.totalBytes.Load(),
+		Hash:    state,
+	}, true, nil
+}
+
+// Release fecha o arquivo montado sem removê-lo nem finalizar, mantendo o
+// staging para um ResumeChunkAssembler (sessão assumida por um resume). Os
+// chunks fora de ordem continuam em disco; o resume os descarta.
+func (ca *ChunkAssembler) Release() {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if ca.outFile != nil {
+		ca.outBuf.Flush()
+		ca.outFile.Close()
+		ca.outFile = nil
+	}
+	ca.outBuf = nil
+	ca.pendingChunks = make(map[uint32]pendingChunk)
+	ca.pendingCount.Store(0)
+	ca.pendingMemBytes.Store(0)
+}
+
 // Finalize faz flush do buffer e fecha o arquivo de saída.
 // Retorna o path do arquivo montado e o total de bytes escritos.
 func (ca *ChunkAssembler) Finalize() (string, int64, error) {
@@ -576,7 +817,7 @@ func (ca *ChunkAssembler) Finalize() (string, int64, error) {
 		ca.assembling.Store(true)
 		defer ca.assembling.Store(false)
 		if err := ca.finalizeLazy(); err != nil {
-			return "", 0, err
+			return "", 0, describeNoSpace(ca.baseDir, err)
 		}
 	}
 
@@ -589,11 +830,19 @@ func (ca *ChunkAssembler) Finalize() (string, int64, error) {
 	}
 
 	if err := ca.outBuf.Flush(); err != nil {
-		return "", 0, fmt.Errorf("flushing output buffer: %w", err)
+		return "", 0, fmt.Errorf("flushing output buffer: %w", describeNoSpace(ca.baseDir, err))
+	}
+
+	if ca.preallocated {
+		if err := releasePreallocation(ca.outFile); err != nil {
+			ca.logger.Warn("releasing preallocated blocks of assembled output", "error", err)
+		}
 	}
 
-	if err := ca.outFile.Close(); err != nil {
-		return "", 0, fmt.Errorf("closing output file: %w", err)
+	if ca.outFile != nil {
+		if err := ca.outFile.Close(); err != nil {
+			return "", 0, fmt.Errorf("closing output file: %w", describeNoSpace(ca.baseDir, err))
+		}
 	}
 	copy(ca.checksum[:], ca.hasher.Sum(nil))
 	ca.finalized.Store(true)
@@ -641,6 +890,7 @@ func (ca *ChunkAssembler) finalizeLazy() error {
 		}
 		f.Close()
 		os.Remove(pc.filePath)
+		ca.releaseShard(pc.filePath)
 		delete(ca.pendingChunks, seq)
 		ca.pendingCount.Add(-1)
 		ca.assembledChunks.Add(1)
@@ -674,14 +924,54 @@ func (ca *ChunkAssembler) Cleanup() error {
 	}
 
 	if ca.chunkDirExists {
-		os.RemoveAll(ca.chunkDir)
+		if err := removeChunkTree(ca.chunkDir); err != nil {
+			ca.logger.Warn("removing chunk staging dir", "dir", ca.chunkDir, "error", err)
+		}
 	}
 	ca.pendingChunks = make(map[uint32]pendingChunk)
+	ca.createdShards = make(map[string]struct{})
+	ca.shardRefs = make(map[string]int)
 	ca.pendingCount.Store(0)
 	ca.pendingMemBytes.Store(0)
 	return nil
 }
 
+// chunkTreeSweepWorkers limita a remoção concorrente de shards no Cleanup.
+const chunkTreeSweepWorkers = 8
+
+// removeChunkTree remove o diretório de staging de chunks. Os shards de nível 1
+// (até 256, cada um com até 256 subdiretórios em 2 níveis) são removidos em
+// paralelo — em árvores profundas o custo é dominado por unlink/rmdir e a
+// concorrência reduz a latência do Cleanup em SSD/NFS.
+func removeChunkTree(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return os.RemoveAll(dir)
+	}
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < min(chunkTreeSweepWorkers, len(entries)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range work {
+				os.RemoveAll(p)
+			}
+		}()
+	}
+	for _, e := range entries {
+		work <- filepath.Join(dir, e.Name())
+	}
+	close(work)
+	wg.Wait()
+
+	return os.RemoveAll(dir)
+}
+
 // ChunkDir retorna o caminho do diretório de staging dos chunks out-of-order.
 func (ca *ChunkAssembler) ChunkDir() string {
 	return ca.chunkDir
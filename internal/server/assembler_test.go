@@ -6,6 +6,8 @@ package server
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
@@ -99,6 +101,85 @@ func TestChunkAssembler_WriteChunk_OutOfOrder(t *testing.T) {
 	}
 }
 
+// Discard (storage discard): o checksum cobre os dados na ordem de
+// sequência, mas nenhum arquivo é criado no diretório do agent, nem com
+// assembler_mode lazy nem com chunks out-of-order além do pendingMemLimit.
+func TestChunkAssembler_Discard(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ca, err := NewChunkAssemblerWithOptions("test-discard", tmpDir, logger, ChunkAssemblerOptions{Mode: AssemblerModeLazy, PendingMemLimit: 1, Discard: true})
+	if err != nil {
+		t.Fatalf("NewChunkAssemblerWithOptions: %v", err)
+	}
+	defer ca.Cleanup()
+
+	for _, c := range []struct {
+		seq  uint32
+		data string
+	}{{2, "CCCC"}, {1, "BBBB"}, {0, "AAAA"}} {
+		if c.seq == 0 {
+			if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+				t.Fatalf("expected out-of-order chunks kept in memory with discard, got %d files", len(entries))
+			}
+		}
+		if err := ca.WriteChunk(c.seq, bytes.NewReader([]byte(c.data)), 4); err != nil {
+			t.Fatalf("WriteChunk(%d): %v", c.seq, err)
+		}
+	}
+	if _, totalBytes, err := ca.Finalize(); err != nil || totalBytes != 12 {
+		t.Fatalf("Finalize: totalBytes=%d err=%v", totalBytes, err)
+	}
+	sum, err := ca.Checksum()
+	if err != nil {
+		t.Fatalf("Checksum: %v", err)
+	}
+	if sum != sha256.Sum256([]byte("AAAABBBBCCCC")) {
+		t.Errorf("unexpected checksum %x", sum)
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("expected no files with discard, got %d", len(entries))
+	}
+}
+
+func TestChunkAssembler_WriteChunk_DuplicateOutOfOrderIgnored(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ca, err := NewChunkAssembler("test-ooo-dup", tmpDir, logger)
+	if err != nil {
+		t.Fatalf("NewChunkAssembler: %v", err)
+	}
+	defer ca.Cleanup()
+
+	// Chunk 1 chega duas vezes (resume de stream) antes do chunk 0
+	for i := 0; i < 2; i++ {
+		if err := ca.WriteChunk(1, bytes.NewReader([]byte("BBBB")), 4); err != nil {
+			t.Fatalf("WriteChunk(1) #%d: %v", i, err)
+		}
+	}
+	if err := ca.WriteChunk(0, bytes.NewReader([]byte("AAAA")), 4); err != nil {
+		t.Fatalf("WriteChunk(0): %v", err)
+	}
+
+	resultPath, totalBytes, err := ca.Finalize()
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	defer os.Remove(resultPath)
+
+	if totalBytes != 8 {
+		t.Errorf("expected totalBytes=8, got %d", totalBytes)
+	}
+	content, err := os.ReadFile(resultPath)
+	if err != nil {
+		t.Fatalf("reading assembled file: %v", err)
+	}
+	if string(content) != "AAAABBBB" {
+		t.Errorf("expected %q, got %q", "AAAABBBB", content)
+	}
+}
+
 func TestChunkAssembler_WriteChunk_MultiStream_RoundRobin(t *testing.T) {
 	tmpDir := t.TempDir()
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
@@ -818,3 +899,202 @@ func TestChunkAssembler_LazyMode_WriteFailure_LazyMaxSeqNotCorrupted(t *testing.
 		t.Errorf("expected %q, got %q", "AABB", content)
 	}
 }
+
+func TestChunkAssembler_LazyTwoLevel_RemovesEmptyShardsOnConsume(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ca, err := NewChunkAssemblerWithOptions("test-lazy-shard-gc", tmpDir, logger, ChunkAssemblerOptions{
+		Mode:        AssemblerModeLazy,
+		ShardLevels: 2,
+	})
+	if err != nil {
+		t.Fatalf("NewChunkAssemblerWithOptions: %v", err)
+	}
+	defer ca.Cleanup()
+
+	// 600 chunks → cada seq em um shard folha próprio (ab/cd), espalhados em 256 shards de nível 1.
+	const n = 600
+	for seq := uint32(n - 1); ; seq-- {
+		if err := ca.WriteChunk(seq, bytes.NewReader([]byte("X")), 1); err != nil {
+			t.Fatalf("WriteChunk(%d): %v", seq, err)
+		}
+		if seq == 0 {
+			break
+		}
+	}
+
+	entries, err := os.ReadDir(ca.ChunkDir())
+	if err != nil {
+		t.Fatalf("ReadDir before finalize: %v", err)
+	}
+	if len(entries) != 256 {
+		t.Fatalf("expected 256 level-1 shards before finalize, got %d", len(entries))
+	}
+
+	resultPath, total, err := ca.Finalize()
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	defer os.Remove(resultPath)
+	if total != n {
+		t.Fatalf("expected totalBytes=%d, got %d", n, total)
+	}
+
+	entries, err = os.ReadDir(ca.ChunkDir())
+	if err != nil {
+		t.Fatalf("ReadDir after finalize: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no shard dirs after finalize, got %d (first: %s)", len(entries), entries[0].Name())
+	}
+	ca.mu.Lock()
+	refs, cached := len(ca.shardRefs), len(ca.createdShards)
+	ca.mu.Unlock()
+	if refs != 0 || cached != 0 {
+		t.Errorf("expected empty shard bookkeeping, got refs=%d cached=%d", refs, cached)
+	}
+}
+
+func TestChunkAssembler_EagerSpill_RemovesShardWhenFlushed(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ca, err := NewChunkAssemblerWithOptions("test-eager-shard-gc", tmpDir, logger, ChunkAssemblerOptions{
+		Mode:            AssemblerModeEager,
+		PendingMemLimit: 1,
+		ShardLevels:     1,
+	})
+	if err != nil {
+		t.Fatalf("NewChunkAssemblerWithOptions: %v", err)
+	}
+	defer ca.Cleanup()
+
+	// seq 1 e 257 compartilham o shard "01"; seq 2 usa o shard "02".
+	for _, seq := range []uint32{1, 257, 2} {
+		if err := ca.WriteChunk(seq, bytes.NewReader([]byte("XX")), 2); err != nil {
+			t.Fatalf("WriteChunk(%d): %v", seq, err)
+		}
+	}
+	shard01 := filepath.Join(ca.ChunkDir(), "01")
+	shard02 := filepath.Join(ca.ChunkDir(), "02")
+
+	// Preenche o gap: 1 e 2 são consumidos, 257 continua pendente no shard "01".
+	if err := ca.WriteChunk(0, bytes.NewReader([]byte("XX")), 2); err != nil {
+		t.Fatalf("WriteChunk(0): %v", err)
+	}
+	if _, err := os.Stat(shard02); !os.IsNotExist(err) {
+		t.Errorf("expected shard %q removed after flush, stat err=%v", shard02, err)
+	}
+	if _, err := os.Stat(filepath.Join(shard01, "chunk_0000000257.tmp")); err != nil {
+		t.Errorf("expected pending chunk 257 to remain in shard 01: %v", err)
+	}
+
+	// Novo chunk no shard já criado continua funcionando após remoções.
+	if err := ca.WriteChunk(258, bytes.NewReader([]byte("XX")), 2); err != nil {
+		t.Fatalf("WriteChunk(258): %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(shard02, "chunk_0000000258.tmp")); err != nil {
+		t.Errorf("expected shard 02 recreated for chunk 258: %v", err)
+	}
+}
+
+func TestRemoveChunkTree_DeepTree(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "chunks")
+	for i := 0; i < 64; i++ {
+		for j := 0; j < 4; j++ {
+			leaf := filepath.Join(dir, fmt.Sprintf("%02x", i), fmt.Sprintf("%02x", j))
+			if err := os.MkdirAll(leaf, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(leaf, "chunk.tmp"), []byte("x"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := removeChunkTree(dir); err != nil {
+		t.Fatalf("removeChunkTree: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected %q removed, stat err=%v", dir, err)
+	}
+	if err := removeChunkTree(dir); err != nil {
+		t.Errorf("removeChunkTree on missing dir: %v", err)
+	}
+}
+
+func TestChunkAssembler_CheckpointResume_SameChecksum(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	opts := ChunkAssemblerOptions{Mode: AssemblerModeEager}
+	chunks := []string{"AAAA", "BBBB", "CCCC", "DDDD", "EEEE"}
+
+	ca, err := NewChunkAssemblerWithOptions("test-resume", tmpDir, logger, opts)
+	if err != nil {
+		t.Fatalf("NewChunkAssemblerWithOptions: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := ca.WriteChunk(uint32(i), bytes.NewReader([]byte(chunks[i])), 4); err != nil {
+			t.Fatalf("WriteChunk(%d): %v", i, err)
+		}
+	}
+	cp, ok, err := ca.Checkpoint()
+	if err != nil || !ok {
+		t.Fatalf("Checkpoint: ok=%v err=%v", ok, err)
+	}
+	if cp.NextSeq != 3 || cp.Bytes != 12 {
+		t.Fatalf("expected checkpoint at seq 3 / 12 bytes, got %+v", cp)
+	}
+	// Chunk montado depois do checkpoint: o resume o descarta e o recebe de novo
+	if err := ca.WriteChunk(3, bytes.NewReader([]byte("XXXX")), 4); err != nil {
+		t.Fatalf("WriteChunk(3): %v", err)
+	}
+	// Fora de ordem, só em staging
+	if err := ca.WriteChunk(4, bytes.NewReader([]byte("YYYY")), 4); err != nil {
+		t.Fatalf("WriteChunk(4): %v", err)
+	}
+	ca.Release()
+
+	resumed, err := ResumeChunkAssembler("test-resume", tmpDir, logger, opts, cp)
+	if err != nil {
+		t.Fatalf("ResumeChunkAssembler: %v", err)
+	}
+	defer resumed.Cleanup()
+	if _, err := os.Stat(resumed.ChunkDir()); !os.IsNotExist(err) {
+		t.Error("expected staging chunks removed on resume")
+	}
+	for i := 3; i < len(chunks); i++ {
+		if err := resumed.WriteChunk(uint32(i), bytes.NewReader([]byte(chunks[i])), 4); err != nil {
+			t.Fatalf("WriteChunk(%d) after resume: %v", i, err)
+		}
+	}
+	resultPath, totalBytes, err := resumed.Finalize()
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	if totalBytes != 20 {
+		t.Errorf("expected totalBytes=20, got %d", totalBytes)
+	}
+	content, err := os.ReadFile(resultPath)
+	if err != nil {
+		t.Fatalf("reading assembled file: %v", err)
+	}
+	if string(content) != "AAAABBBBCCCCDDDDEEEE" {
+		t.Errorf("unexpected assembled content %q", content)
+	}
+	sum, err := resumed.Checksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != sha256.Sum256(content) {
+		t.Error("checksum after resume differs from the assembled file")
+	}
+}
+
+func TestResumeChunkAssembler_RejectsLazyMode(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if _, err := ResumeChunkAssembler("test-lazy", t.TempDir(), logger, ChunkAssemblerOptions{Mode: AssemblerModeLazy}, AssemblerCheckpoint{}); err == nil {
+		t.Error("expected lazy mode not to be resumable")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// OpenAuditLog abre o audit log de sessões (audit_log), se habilitado.
+func (h *Handler) OpenAuditLog(cfg config.AuditLogConfig, logger *slog.Logger) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	a, err := observability.OpenAuditLog(cfg.Dir, cfg.MaxSizeRaw, cfg.MaxFiles)
+	if err != nil {
+		return fmt.Errorf("audit_log: %w", err)
+	}
+	h.Audit = a
+	logger.Info("session audit log enabled", "dir", cfg.Dir, "max_size", cfg.MaxSize, "max_files", cfg.MaxFiles)
+	return nil
+}
+
+// auditKey é a chave das sessões em andamento no audit log — a mesma do lock
+// por agent:storage:backup, conhecida pelos pontos de commit.
+func auditKey(agent, storage, backup string) string {
+	return agent + ":" + storage + ":" + backup
+}
+
+// auditCommit registra o commit de path na sessão que detém lockKey.
+func (h *Handler) auditCommit(lockKey, path, message string) {
+	h.Audit.RecordKey(lockKey, observability.AuditRecord{Event: observability.AuditCommit, CommitPath: path, Message: message})
+}
+
+// auditEnd registra o fim da sessão e sua entrada no índice do audit log.
+func (h *Handler) auditEnd(sessionID, agent, storage, backup, mode, compression, result string, startedAt time.Time, bytesTotal int64, streams []observability.StreamTransfer) {
+	if h.Audit == nil {
+		return
+	}
+	now := time.Now()
+	rec := observability.AuditRecord{
+		Time:            now,
+		SessionID:       sessionID,
+		Agent:           agent,
+		Storage:         storage,
+		Backup:          backup,
+		Mode:            mode,
+		Compression:     compression,
+		Result:          result,
+		Bytes:           bytesTotal,
+		DurationSeconds: now.Sub(startedAt).Seconds(),
+		Streams:         streams,
+	}
+	for _, s := range streams {
+		rec.RetransmitBytes += s.RetransmitBytes
+	}
+	h.Audit.End(auditKey(agent, storage, backup), rec, startedAt)
+}
+
+// QueryAuditSessions consulta o índice do audit log.
+// Implementa observability.AuditQuerier.
+func (h *Handler) QueryAuditSessions(f observability.SessionHistoryFilter) ([]observability.AuditIndexEntry, error) {
+	if h.Audit == nil {
+		return []observability.AuditIndexEntry{}, nil
+	}
+	return h.Audit.Sessions(f)
+}
+
+// AuditSession retorna os registros do audit log de uma sessão finalizada.
+// Implementa observability.AuditQuerier.
+func (h *Handler) AuditSession(sessionID string) ([]observability.AuditRecord, error) {
+	if h.Audit == nil {
+		return nil, observability.ErrAuditDisabled
+	}
+	return h.Audit.Session(sessionID)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// capacity.go verifica a capacidade dos storages em bytes e em inodes.
+//
+// O lazy assembly e o spill criam um arquivo por chunk: um filesystem pode
+// ficar sem inodes com espaço de sobra, e o ENOSPC resultante é idêntico ao
+// de disco cheio. As funções aqui distinguem os dois casos no admission
+// control (handshake), no health check e nas mensagens de erro de escrita.
+//
+// Além do limite físico, cada storage pode exigir um espaço livre mínimo
+// (min_free_space) e limitar o espaço ocupado pelos seus backups (quota);
+// o handshake é recusado com STATUS LOW_SPACE quando um deles é violado.
+// Se o disco enche durante um backup, a sessão é abortada e o agent é
+// avisado via ControlAbort(AbortReasonDiskFull).
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// errLowSpace indica que o storage violou min_free_space ou quota: o
+// handshake é recusado com StatusLowSpace (o agent adia o backup) em vez de
+// StatusFull.
+var errLowSpace = errors.New("insufficient storage space")
+
+// lowSpaceDeferWait é o tempo sugerido ao agent (via ControlDefer) antes de
+// tentar de novo um backup recusado por falta de espaço.
+const lowSpaceDeferWait = 30 * time.Minute
+
+// storageCapacity é o espaço e os inodes livres do filesystem de um storage.
+type storageCapacity struct {
+	TotalBytes  uint64
+	FreeBytes   uint64 // disponíveis para usuários não-root (Bavail)
+	TotalInodes uint64 // 0 = filesystem não reporta inodes (btrfs, ZFS, ...)
+	FreeInodes  uint64
+}
+
+// statCapacity lê a capacidade do filesystem que contém dir.
+func statCapacity(dir string) (storageCapacity, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return storageCapacity{}, err
+	}
+	return storageCapacity{
+		TotalBytes:  stat.Blocks * uint64(stat.Bsize),
+		FreeBytes:   stat.Bavail * uint64(stat.Bsize),
+		TotalInodes: stat.Files,
+		FreeInodes:  stat.Ffree,
+	}, nil
+}
+
+// inodesKnown indica se o filesystem tem um limite fixo de inodes.
+func (c storageCapacity) inodesKnown() bool {
+	return c.TotalInodes > 0
+}
+
+// inodeUsagePercent retorna o percentual de inodes em uso (0 se desconhecido).
+func (c storageCapacity) inodeUsagePercent() float64 {
+	if !c.inodesKnown() {
+		return 0
+	}
+	return float64(c.TotalInodes-c.FreeInodes) / float64(c.TotalInodes) * 100
+}
+
+// checkStorageCapacity retorna erro quando o storage não tem inodes livres
+// suficientes (storages.*.min_free_inodes) ou não tem espaço livre algum.
+// Falhas no Statfs não bloqueiam o backup: o erro real, se houver, aparece
+// na escrita.
+func checkStorageCapacity(si config.StorageInfo) error {
+	c, err := statCapacity(si.BaseDir)
+	if err != nil {
+		return nil
+	}
+	if c.TotalBytes > 0 && c.FreeBytes == 0 {
+		return fmt.Errorf("storage disk is full (0 bytes free of %s)", formatBytesGo(int64(c.TotalBytes)))
+	}
+	if min := si.MinFreeInodesThreshold(); min > 0 && c.inodesKnown() && c.FreeInodes < min {
+		return fmt.Errorf("storage is running out of inodes (%d free of %d, min_free_inodes %d)", c.FreeInodes, c.TotalInodes, min)
+	}
+	if si.MinFreeSpaceRaw > 0 && c.TotalBytes > 0 && c.FreeBytes < uint64(si.MinFreeSpaceRaw) {
+		return fmt.Errorf("%w: %s free, min_free_space %s", errLowSpace, formatBytesGo(int64(c.FreeBytes)), formatBytesGo(si.MinFreeSpaceRaw))
+	}
+	if si.QuotaRaw > 0 {
+		if used := storageUsedBytes(si.BaseDir); used >= si.QuotaRaw {
+			return fmt.Errorf("%w: backups use %s of quota %s", errLowSpace, formatBytesGo(used), formatBytesGo(si.QuotaRaw))
+		}
+	}
+	return nil
+}
+
+// storageUsedBytes soma o tamanho dos backups armazenados em baseDir,
+// incluindo os em quarentena e os arquivos .tmp de sessões em andamento.
+// Diretórios de chunks (chunks_*) não são percorridos: são transitórios e
+// podem ter milhares de arquivos.
+func storageUsedBytes(baseDir string) int64 {
+	var used int64
+	_ = filepath.WalkDir(baseDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil // ignora erros de permissão e continua
+		}
+		if d.IsDir() {
+			if strings.HasPrefix(d.Name(), "chunks_") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			used += info.Size()
+		}
+		return nil
+	})
+	return used
+}
+
+// describeNoSpace enriquece um ENOSPC com a causa real — inodes esgotados
+// ou disco cheio — lida do filesystem de dir. Outros erros são retornados
+// sem alteração.
+func describeNoSpace(dir string, err error) error {
+	if err == nil || !errors.Is(err, syscall.ENOSPC) {
+		return err
+	}
+	c, statErr := statCapacity(dir)
+	if statErr != nil {
+		return err
+	}
+	if c.inodesKnown() && c.FreeInodes == 0 {
+		return fmt.Errorf("%w (inodes exhausted: 0 free of %d, %s still free)", err, c.TotalInodes, formatBytesGo(int64(c.FreeBytes)))
+	}
+	return fmt.Errorf("%w (disk full: %s free, %d inodes free)", err, formatBytesGo(int64(c.FreeBytes)), c.FreeInodes)
+}
+
+// abortOnDiskFull aborta a sessão quando err é um ENOSPC: o disco (ou os
+// inodes) do storage acabou durante o backup e retentar não adianta. Os dados
+// parciais são descartados, o agent recebe ControlAbort(AbortReasonDiskFull)
+// e um evento storage_full é emitido. Retorna true se err era um ENOSPC.
+func (h *Handler) abortOnDiskFull(sessionID, agent, storage, backup string, err error, logger *slog.Logger) bool {
+	if !errors.Is(err, syscall.ENOSPC) {
+		return false
+	}
+	// Outro stream da mesma sessão pode ter abortado primeiro
+	if discardErr := h.discardSession(sessionID, "disk full", "write_error"); discardErr != nil {
+		logger.Debug("disk full: session already discarded", "error", discardErr)
+		return true
+	}
+	logger.Error("storage full during backup, session aborted", "error", err)
+	h.sendControlAbort(agent, protocol.AbortReasonDiskFull, sessionID, logger)
+	if h.Events != nil {
+		h.Events.Push(observability.EventEntry{
+			Level:   "error",
+			Type:    "storage_full",
+			Agent:   agent,
+			Storage: storage,
+			Backup:  backup,
+			Message: fmt.Sprintf("%s/%s aborted: %v", storage, backup, err),
+		})
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func uint64Ptr(v uint64) *uint64 { return &v }
+
+// requireInodes pula o teste em filesystems sem limite fixo de inodes.
+func requireInodes(t *testing.T, dir string) {
+	t.Helper()
+	c, err := statCapacity(dir)
+	if err != nil {
+		t.Fatalf("statCapacity: %v", err)
+	}
+	if !c.inodesKnown() {
+		t.Skip("filesystem does not report inodes")
+	}
+}
+
+func TestCheckStorageCapacity_MinFreeInodes(t *testing.T) {
+	dir := t.TempDir()
+	requireInodes(t, dir)
+
+	si := config.StorageInfo{BaseDir: dir, MinFreeInodes: uint64Ptr(math.MaxUint64)}
+	err := checkStorageCapacity(si)
+	if err == nil || !strings.Contains(err.Error(), "running out of inodes") {
+		t.Fatalf("expected inode shortage error, got %v", err)
+	}
+
+	si.MinFreeInodes = uint64Ptr(0)
+	if err := checkStorageCapacity(si); err != nil {
+		t.Fatalf("min_free_inodes 0 should disable the check, got %v", err)
+	}
+}
+
+func TestCheckStorageCapacity_StatfsErrorIgnored(t *testing.T) {
+	si := config.StorageInfo{BaseDir: "/nonexistent/n-backup-capacity", MinFreeInodes: uint64Ptr(math.MaxUint64)}
+	if err := checkStorageCapacity(si); err != nil {
+		t.Fatalf("statfs failure should not block the backup, got %v", err)
+	}
+}
+
+func TestCheckStorageCapacity_MinFreeSpace(t *testing.T) {
+	si := config.StorageInfo{BaseDir: t.TempDir(), MinFreeSpaceRaw: math.MaxInt64}
+	if err := checkStorageCapacity(si); !errors.Is(err, errLowSpace) {
+		t.Fatalf("expected errLowSpace, got %v", err)
+	}
+
+	si.MinFreeSpaceRaw = 1
+	if err := checkStorageCapacity(si); err != nil {
+		t.Fatalf("expected enough free space, got %v", err)
+	}
+}
+
+func TestCheckStorageCapacity_Quota(t *testing.T) {
+	base := t.TempDir()
+	dir := writeBackups(t, base, "web-01", "daily", "2025-01-01T00-00-00-000.tar.gz")
+	// Chunks de sessões em andamento não contam para a quota
+	os.MkdirAll(filepath.Join(dir, "chunks_abc"), 0755)
+	os.WriteFile(filepath.Join(dir, "chunks_abc", "chunk_000000"), make([]byte, 1024), 0644)
+
+	if used := storageUsedBytes(base); used != 4 {
+		t.Fatalf("expected 4 bytes used, got %d", used)
+	}
+
+	si := config.StorageInfo{BaseDir: base, QuotaRaw: 4}
+	if err := checkStorageCapacity(si); !errors.Is(err, errLowSpace) {
+		t.Fatalf("expected errLowSpace at quota, got %v", err)
+	}
+
+	si.QuotaRaw = 1024
+	if err := checkStorageCapacity(si); err != nil {
+		t.Fatalf("expected storage under quota, got %v", err)
+	}
+}
+
+func TestAbortOnDiskFull(t *testing.T) {
+	base := t.TempDir()
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: base}})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tmpPath := filepath.Join(base, "backup-1.tmp")
+	os.WriteFile(tmpPath, []byte("partial"), 0644)
+	h.sessions.Store("s1", &PartialSession{TmpPath: tmpPath, AgentName: "web-01", StorageName: "default", CreatedAt: time.Now(), Phase: NewSessionPhaseTracker()})
+
+	serverConn, agentConn := net.Pipe()
+	defer agentConn.Close()
+	h.controlConns.Store("web-01", &ControlConnInfo{Conn: serverConn})
+	h.controlConnsMu.Store("web-01", &sync.Mutex{})
+
+	if h.abortOnDiskFull("s1", "web-01", "default", "daily", errors.New("connection reset"), logger) {
+		t.Fatal("non-ENOSPC error should not abort the session")
+	}
+
+	received := make(chan *protocol.ControlAbort, 1)
+	go func() {
+		if magic, err := protocol.ReadControlMagic(agentConn); err == nil && magic == protocol.MagicControlAbort {
+			abort, _ := protocol.ReadControlAbortPayload(agentConn)
+			received <- abort
+		}
+		close(received)
+	}()
+
+	enospc := describeNoSpace(base, fmt.Errorf("writing: %w", syscall.ENOSPC))
+	if !h.abortOnDiskFull("s1", "web-01", "default", "daily", enospc, logger) {
+		t.Fatal("expected ENOSPC to abort the session")
+	}
+
+	select {
+	case abort := <-received:
+		if abort == nil || abort.Reason != protocol.AbortReasonDiskFull || abort.SessionID != "s1" {
+			t.Errorf("unexpected ControlAbort %+v", abort)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ControlAbort not sent")
+	}
+	if _, ok := h.sessions.Load("s1"); ok {
+		t.Error("expected session removed")
+	}
+	if _, err := os.Stat(tmpPath); !os.IsNotExist(err) {
+		t.Error("expected tmp file removed")
+	}
+}
+
+func TestDescribeNoSpace(t *testing.T) {
+	dir := t.TempDir()
+
+	other := errors.New("permission denied")
+	if got := describeNoSpace(dir, other); got != other {
+		t.Fatalf("non-ENOSPC error should be returned unchanged, got %v", got)
+	}
+	if describeNoSpace(dir, nil) != nil {
+		t.Fatal("nil error should stay nil")
+	}
+
+	enospc := fmt.Errorf("writing chunk: %w", syscall.ENOSPC)
+	got := describeNoSpace(dir, enospc)
+	if !errors.Is(got, syscall.ENOSPC) {
+		t.Fatalf("described error should still wrap ENOSPC: %v", got)
+	}
+	if !strings.Contains(got.Error(), "disk full") && !strings.Contains(got.Error(), "inodes exhausted") {
+		t.Fatalf("expected cause detail in %q", got.Error())
+	}
+}
+
+func TestHealthCapacity_LowInodes(t *testing.T) {
+	dir := t.TempDir()
+	requireInodes(t, dir)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	h := &Handler{cfg: &config.ServerConfig{Storages: map[string]config.StorageInfo{
+		"default": {BaseDir: dir, MinFreeInodes: uint64Ptr(0)},
+	}}, logger: logger}
+	status, diskFree := h.healthCapacity(logger)
+	if status != protocol.HealthStatusReady {
+		t.Fatalf("expected ready, got %d", status)
+	}
+	if diskFree == 0 {
+		t.Fatal("expected disk free to be reported")
+	}
+
+	h.cfg.Storages["default"] = config.StorageInfo{BaseDir: dir, MinFreeInodes: uint64Ptr(math.MaxUint64)}
+	if status, _ := h.healthCapacity(logger); status != protocol.HealthStatusLowDisk {
+		t.Fatalf("expected low disk status, got %d", status)
+	}
+}
+
+func TestHandleStorageHealthCheck(t *testing.T) {
+	base := t.TempDir()
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: base}})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	query := func(storage string) *protocol.HealthResponse {
+		t.Helper()
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		go func() {
+			defer serverConn.Close()
+			h.handleStorageHealthCheck(serverConn, logger)
+		}()
+		// O dispatcher já consumiu o magic; envia só o nome
+		clientConn.Write([]byte(storage + "\n"))
+		resp, err := protocol.ReadHealthResponse(clientConn)
+		if err != nil {
+			t.Fatalf("ReadHealthResponse: %v", err)
+		}
+		return resp
+	}
+
+	if resp := query("default"); resp.Status != protocol.HealthStatusReady || resp.DiskFree == 0 {
+		t.Errorf("expected ready storage with disk free, got %+v", resp)
+	}
+	if resp := query("nope"); resp.Status != protocol.HealthStatusNotFound {
+		t.Errorf("expected not found, got %+v", resp)
+	}
+
+	h.cfg.Storages["default"] = config.StorageInfo{BaseDir: base, MinFreeSpaceRaw: math.MaxInt64}
+	if resp := query("default"); resp.Status != protocol.HealthStatusLowDisk {
+		t.Errorf("expected low disk below min_free_space, got %+v", resp)
+	}
+}
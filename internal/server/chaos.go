@@ -0,0 +1,244 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// chaos.go implementa o chaos mode: injeção aleatória e de baixa probabilidade
+// de falhas no data plane (rotações, SACKs atrasados, quedas de stream).
+// Serve para exercitar continuamente os caminhos de resume, re-join e
+// retransmissão em staging. As falhas determinísticas de chaos.faults
+// (corte após N bytes, conexão morta, chunk corrompido, SACK atrasado e
+// rotação em um chunk exato) servem aos testes de integração dos mesmos
+// caminhos. Todos os métodos são nil-safe: com chaos desabilitado o Handler
+// mantém chaos == nil e nenhum custo é adicionado.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// errChaosDrop é retornado pelos loops de recepção quando o chaos mode
+// derruba intencionalmente uma conexão de dados.
+var errChaosDrop = errors.New("chaos: connection dropped intentionally")
+
+// chaosInjector decide, a cada ponto de injeção, se uma falha deve ocorrer.
+type chaosInjector struct {
+	cfg config.ChaosConfig
+	// roll retorna um float em [0.0, 1.0). Substituível em testes.
+	roll   func() float64
+	faults []*chaosFault
+}
+
+// chaosFault é uma falha determinística (chaos.faults) com os disparos restantes.
+type chaosFault struct {
+	config.ChaosFault
+	remaining atomic.Int64 // < 0 = sem limite
+}
+
+// newChaosInjector retorna nil quando o chaos mode está desabilitado.
+func newChaosInjector(cfg config.ChaosConfig) *chaosInjector {
+	if !cfg.Enabled {
+		return nil
+	}
+	c := &chaosInjector{cfg: cfg, roll: rand.Float64}
+	for _, f := range cfg.Faults {
+		cf := &chaosFault{ChaosFault: f}
+		times := f.Times
+		if times == 0 {
+			times = 1
+		}
+		cf.remaining.Store(int64(times))
+		c.faults = append(c.faults, cf)
+	}
+	return c
+}
+
+// matches indica se a falha se aplica ao stream e ao chunk (seq < 0 = qualquer).
+func (f *chaosFault) matches(action string, stream uint8, seq int64) bool {
+	if f.Action != action || f.remaining.Load() == 0 {
+		return false
+	}
+	if f.Stream != nil && *f.Stream != int(stream) {
+		return false
+	}
+	return seq < 0 || f.Chunk == nil || int64(*f.Chunk) == seq
+}
+
+// fire consome um disparo; false quando a falha já se esgotou.
+func (f *chaosFault) fire() bool {
+	for {
+		n := f.remaining.Load()
+		if n < 0 {
+			return true
+		}
+		if n == 0 {
+			return false
+		}
+		if f.remaining.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+}
+
+// fault retorna a primeira falha de action aplicável ao stream e ao chunk,
+// já consumindo o disparo (nil quando nenhuma se aplica).
+func (c *chaosInjector) fault(action string, stream uint8, seq uint32) *chaosFault {
+	if c == nil {
+		return nil
+	}
+	for _, f := range c.faults {
+		if f.matches(action, stream, int64(seq)) && f.fire() {
+			return f
+		}
+	}
+	return nil
+}
+
+// streamReader aplica as falhas drop ao reader de uma conexão de stream:
+// a leitura é cortada com errChaosDrop após after_bytes (inclusive no meio
+// de um frame). onDrop é chamado no corte.
+func (c *chaosInjector) streamReader(r io.Reader, stream uint8, onDrop func(after int64)) io.Reader {
+	if c == nil {
+		return r
+	}
+	for _, f := range c.faults {
+		if f.matches(config.ChaosFaultDrop, stream, -1) {
+			r = &chaosDropReader{r: r, fault: f, left: f.AfterBytesRaw, onDrop: onDrop}
+		}
+	}
+	return r
+}
+
+// chaosDropReader corta a leitura após left bytes, se a falha ainda tiver
+// disparos quando o limite for atingido.
+type chaosDropReader struct {
+	r      io.Reader
+	fault  *chaosFault
+	left   int64 // < 0 = falha não disparou, leitura livre
+	onDrop func(after int64)
+}
+
+func (d *chaosDropReader) Read(p []byte) (int, error) {
+	if d.left == 0 {
+		if !d.fault.fire() {
+			d.left = -1
+			return d.r.Read(p)
+		}
+		if d.onDrop != nil {
+			d.onDrop(d.fault.AfterBytesRaw)
+		}
+		return 0, errChaosDrop
+	}
+	if d.left > 0 && int64(len(p)) > d.left {
+		p = p[:d.left]
+	}
+	n, err := d.r.Read(p)
+	if d.left > 0 {
+		d.left -= int64(n)
+	}
+	return n, err
+}
+
+// armKill agenda as falhas kill de uma conexão de stream: conn é fechada
+// after após o join. stop cancela os timers quando o stream termina antes.
+func (c *chaosInjector) armKill(conn net.Conn, stream uint8, onKill func(after time.Duration)) (stop func()) {
+	if c == nil {
+		return func() {}
+	}
+	var timers []*time.Timer
+	for _, f := range c.faults {
+		if !f.matches(config.ChaosFaultKill, stream, -1) {
+			continue
+		}
+		f := f
+		timers = append(timers, time.AfterFunc(f.After, func() {
+			if f.fire() {
+				onKill(f.After)
+				conn.Close()
+			}
+		}))
+	}
+	return func() {
+		for _, t := range timers {
+			t.Stop()
+		}
+	}
+}
+
+// corruptChunk inverte o primeiro byte do payload de um chunk com falha
+// corrupt, simulando corrupção no caminho (CRC32 inválido).
+func (c *chaosInjector) corruptChunk(stream uint8, seq uint32, data []byte) bool {
+	if len(data) == 0 || c.fault(config.ChaosFaultCorrupt, stream, seq) == nil {
+		return false
+	}
+	data[0] ^= 0xFF
+	return true
+}
+
+// chunkSACKDelay retorna o atraso do ChunkSACK de um chunk: o da falha
+// delay_sack aplicável ou, sem ela, o sorteado por sackDelay.
+func (c *chaosInjector) chunkSACKDelay(stream uint8, seq uint32) time.Duration {
+	if f := c.fault(config.ChaosFaultDelaySACK, stream, seq); f != nil {
+		return f.Delay
+	}
+	return c.sackDelay()
+}
+
+// rotateAfterChunk indica se o stream deve ser rotacionado após o chunk.
+func (c *chaosInjector) rotateAfterChunk(stream uint8, seq uint32) bool {
+	return c.fault(config.ChaosFaultRotate, stream, seq) != nil
+}
+
+// shouldRotate indica se um stream ativo deve ser rotacionado neste tick.
+func (c *chaosInjector) shouldRotate() bool {
+	return c != nil && c.roll() < c.cfg.RotateProbabilityRaw
+}
+
+// sackDelay retorna quanto tempo o próximo SACK deve ser atrasado (0 = sem atraso).
+func (c *chaosInjector) sackDelay() time.Duration {
+	if c == nil || c.cfg.SACKDelayMax <= 0 || c.roll() >= c.cfg.SACKDelayProbabilityRaw {
+		return 0
+	}
+	return time.Duration(c.roll() * float64(c.cfg.SACKDelayMax))
+}
+
+// shouldDrop indica se a conexão de dados corrente deve ser derrubada.
+func (c *chaosInjector) shouldDrop() bool {
+	return c != nil && c.roll() < c.cfg.DropProbabilityRaw
+}
+
+// injectChaosRotations sorteia streams ativos para rotação, reutilizando o mesmo
+// caminho do flow rotation (graceful via ControlRotate com fallback abrupto).
+// Limita a 1 rotação por tick, assim como evaluateFlowRotation.
+func (h *Handler) injectChaosRotations() {
+	h.sessions.Range(func(key, value any) bool {
+		ps, ok := value.(*ParallelSession)
+		if !ok {
+			return true
+		}
+		for _, slot := range ps.Slots {
+			slot.ConnMu.Lock()
+			hasConn := slot.Conn != nil
+			slot.ConnMu.Unlock()
+			if !hasConn || !h.chaos.shouldRotate() {
+				continue
+			}
+
+			h.logger.Warn("chaos: forcing stream rotation", "session", key, "agent", ps.AgentName, "stream", slot.Index)
+			if h.Events != nil {
+				h.Events.PushEvent("warn", "chaos_rotation", ps.AgentName, fmt.Sprintf("stream %d rotation forced by chaos mode", slot.Index), int(slot.Index))
+			}
+			h.rotateStream(key, ps, slot.Index, 0, 0)
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestChaosInjector_DisabledIsNil(t *testing.T) {
+	c := newChaosInjector(config.ChaosConfig{Enabled: false, DropProbabilityRaw: 1})
+	if c != nil {
+		t.Fatal("expected nil injector when chaos is disabled")
+	}
+	// Métodos devem ser nil-safe
+	if c.shouldDrop() || c.shouldRotate() || c.sackDelay() != 0 {
+		t.Error("nil injector must never inject faults")
+	}
+}
+
+func TestChaosInjector_Probabilities(t *testing.T) {
+	c := newChaosInjector(config.ChaosConfig{
+		Enabled:                 true,
+		RotateProbabilityRaw:    0.5,
+		SACKDelayProbabilityRaw: 0.5,
+		SACKDelayMax:            2 * time.Second,
+		DropProbabilityRaw:      0.5,
+	})
+
+	c.roll = func() float64 { return 0.25 }
+	if !c.shouldDrop() || !c.shouldRotate() {
+		t.Error("expected fault injection when roll < probability")
+	}
+	if d := c.sackDelay(); d != 500*time.Millisecond {
+		t.Errorf("expected 500ms delay, got %s", d)
+	}
+
+	c.roll = func() float64 { return 0.75 }
+	if c.shouldDrop() || c.shouldRotate() || c.sackDelay() != 0 {
+		t.Error("expected no fault injection when roll >= probability")
+	}
+}
+
+func TestChaosInjector_Faults(t *testing.T) {
+	stream1 := 1
+	seq := uint32(7)
+	c := newChaosInjector(config.ChaosConfig{Enabled: true, Faults: []config.ChaosFault{
+		{Action: config.ChaosFaultCorrupt, Stream: &stream1, Chunk: &seq},
+		{Action: config.ChaosFaultDelaySACK, Delay: time.Second, Times: -1},
+		{Action: config.ChaosFaultRotate, Chunk: &seq, Times: 2},
+	}})
+	c.roll = func() float64 { return 0.99 }
+
+	data := []byte{0x0F, 0x01}
+	if c.corruptChunk(0, 7, data) || c.corruptChunk(1, 6, data) {
+		t.Error("corrupt must only match stream 1, chunk 7")
+	}
+	if !c.corruptChunk(1, 7, data) || data[0] != 0xF0 {
+		t.Errorf("expected first byte flipped, got %x", data)
+	}
+	if c.corruptChunk(1, 7, data) {
+		t.Error("corrupt must fire only once by default")
+	}
+
+	for i := 0; i < 5; i++ {
+		if d := c.chunkSACKDelay(uint8(i), uint32(i)); d != time.Second {
+			t.Fatalf("expected unlimited delay_sack, got %s", d)
+		}
+	}
+
+	if c.rotateAfterChunk(0, 6) || !c.rotateAfterChunk(0, 7) || !c.rotateAfterChunk(2, 7) || c.rotateAfterChunk(0, 7) {
+		t.Error("rotate must fire twice on chunk 7")
+	}
+}
+
+func TestChaosInjector_DropReader(t *testing.T) {
+	stream0 := 0
+	c := newChaosInjector(config.ChaosConfig{Enabled: true, Faults: []config.ChaosFault{
+		{Action: config.ChaosFaultDrop, Stream: &stream0, AfterBytesRaw: 10},
+	}})
+
+	var dropped int64
+	r := c.streamReader(bytes.NewReader(make([]byte, 64)), 0, func(after int64) { dropped = after })
+	n, err := io.ReadFull(r, make([]byte, 64))
+	if n != 10 || !errors.Is(err, errChaosDrop) || dropped != 10 {
+		t.Fatalf("expected drop after 10 bytes, got n=%d err=%v dropped=%d", n, err, dropped)
+	}
+
+	// A falha já disparou: a próxima conexão do stream lê tudo
+	r = c.streamReader(bytes.NewReader(make([]byte, 64)), 0, nil)
+	if n, err := io.ReadFull(r, make([]byte, 64)); n != 64 || err != nil {
+		t.Fatalf("expected full read after the fault is exhausted, got n=%d err=%v", n, err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/notify"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// chatQueueSize limita as mensagens de chat pendentes. Com a fila cheia os
+// eventos novos são descartados.
+const chatQueueSize = 256
+
+// chatEvent é um evento pendente de entrega às rotas de chat.
+type chatEvent struct {
+	event string
+	msg   notify.Message
+}
+
+// chatDispatcher entrega os eventos individuais (backup_committed,
+// checksum_mismatch, session_expired, agent_offline) às rotas do Slack e do
+// Telegram que os assinam. O resumo de falhas e o digest são enviados pelo
+// mailNotifier. As rotas são relidas a cada evento (valem após SIGHUP).
+type chatDispatcher struct {
+	config func() *config.ServerConfig
+	logger *slog.Logger
+	server string
+	queue  chan chatEvent
+}
+
+// startChatNotifier assina o EventStore do handler e inicia a entrega quando
+// há rotas de chat configuradas.
+func startChatNotifier(ctx context.Context, cfg *config.ServerConfig, handler *Handler, logger *slog.Logger) {
+	nc := cfg.Notifications
+	if !nc.HasChat() {
+		return
+	}
+	handler.ensureEventStore()
+
+	server, _ := os.Hostname()
+	d := &chatDispatcher{
+		config: handler.config,
+		logger: logger.With("component", "chat"),
+		server: server,
+		queue:  make(chan chatEvent, chatQueueSize),
+	}
+	handler.Events.Subscribe(d.handle)
+	go d.run(ctx)
+
+	logger.Info("chat notifications enabled", "slack_routes", len(nc.Slack), "telegram_routes", len(nc.Telegram))
+}
+
+// handle é o subscriber do EventStore: filtra, formata e enfileira o evento
+// sem bloquear quem o emitiu.
+func (d *chatDispatcher) handle(e observability.EventEntry) {
+	event, ok := webhookEventFor(e)
+	if !ok || !d.config().Notifications.ChatWants(event) {
+		return
+	}
+	select {
+	case d.queue <- chatEvent{event: event, msg: chatMessage(d.server, event, e)}:
+	default:
+		d.logger.Warn("chat queue full, dropping event", "event", event, "agent", e.Agent)
+	}
+}
+
+// run entrega os eventos da fila, um por vez, até o context ser cancelado.
+func (d *chatDispatcher) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ce := <-d.queue:
+			senders := notify.ServerSendersFor(d.config().Notifications, ce.event)
+			if err := notify.SendAll(ctx, senders, ce.msg); err != nil {
+				d.logger.Warn("chat delivery failed", "event", ce.event, "error", err)
+				continue
+			}
+			d.logger.Debug("chat message delivered", "event", ce.event, "routes", len(senders))
+		}
+	}
+}
+
+// chatMessage formata um evento individual: o assunto identifica o evento e
+// o backup, o corpo traz a mensagem do evento.
+func chatMessage(server, event string, e observability.EventEntry) notify.Message {
+	subject := fmt.Sprintf("[nbackup] %s: %s %s", server, event, e.Agent)
+	if e.Storage != "" {
+		subject += fmt.Sprintf(" %s/%s", e.Storage, e.Backup)
+	}
+	body := e.Message
+	if event == config.WebhookEventBackupCommitted && e.Bytes > 0 {
+		body += fmt.Sprintf(" (%s)", formatBytesGo(e.Bytes))
+	}
+	return notify.Message{Subject: subject, Body: body}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+func TestStartChatNotifier_RoutesPerEvent(t *testing.T) {
+	type post struct{ route, text string }
+	received := make(chan post, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		text, _ := payload["text"].(string)
+		received <- post{route: r.URL.Path, text: text}
+	}))
+	defer srv.Close()
+
+	cfg := &config.ServerConfig{}
+	cfg.Notifications.Slack = []config.SlackConfig{
+		{Name: "oncall", WebhookURL: srv.URL + "/oncall", Events: []string{config.WebhookEventChecksumMismatch}, Timeout: 5 * time.Second},
+		{Name: "backups", WebhookURL: srv.URL + "/backups", Events: []string{config.WebhookEventBackupCommitted}, Timeout: 5 * time.Second},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := &Handler{cfg: cfg, logger: logger}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startChatNotifier(ctx, cfg, h, logger)
+	if h.Events == nil {
+		t.Fatal("expected in-memory event store without web ui")
+	}
+
+	// agent_offline não é assinado por nenhuma rota
+	h.Events.PushEvent("warn", "agent_disconnected", "db-01", "control channel closed: EOF", 0)
+	h.recordSessionEnd("s1", "web-01", "default", "app", "single", "gzip", "checksum_mismatch", time.Now(), 0, nil, nil)
+	h.recordSessionEnd("s2", "web-01", "default", "app", "single", "gzip", "ok", time.Now(), 2048, nil, nil)
+
+	want := []post{
+		{route: "/oncall", text: "checksum_mismatch web-01 default/app"},
+		{route: "/backups", text: "backup_committed web-01 default/app"},
+	}
+	for _, w := range want {
+		select {
+		case got := <-received:
+			if got.route != w.route || !strings.Contains(got.text, w.text) {
+				t.Errorf("got %+v, want route %s with %q", got, w.route, w.text)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", w.route)
+		}
+	}
+	select {
+	case got := <-received:
+		t.Errorf("unexpected extra chat message %+v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMailNotifier_ChatOnlyFailures(t *testing.T) {
+	received := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/revoked" {
+			http.Error(w, "invalid_token", http.StatusForbidden)
+			return
+		}
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload["text"]
+	}))
+	defer srv.Close()
+
+	cfg := &config.ServerConfig{}
+	cfg.Notifications.Slack = []config.SlackConfig{
+		{Name: "oncall", WebhookURL: srv.URL, Events: []string{config.ChatEventFailures}, Timeout: 5 * time.Second},
+		{Name: "revoked", WebhookURL: srv.URL + "/revoked", Events: []string{config.ChatEventFailures}, Timeout: 5 * time.Second},
+	}
+	cfg.Notifications.Failures = config.FailureSummaryConfig{Enabled: true, Interval: time.Minute}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := &Handler{cfg: cfg, logger: logger}
+	n, err := newMailNotifier(cfg, h.config, logger)
+	if err != nil {
+		t.Fatalf("newMailNotifier: %v", err)
+	}
+	h.ensureEventStore()
+	h.Events.Subscribe(n.handle)
+
+	h.recordSessionEnd("s1", "web-01", "default", "app", "single", "gzip", "write_error", time.Now(), 0, nil, nil)
+	n.flushFailures(context.Background())
+
+	select {
+	case text := <-received:
+		if !strings.Contains(text, "1 backup failure(s)") || !strings.Contains(text, "write_error") {
+			t.Errorf("unexpected summary %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for failure summary")
+	}
+	// Uma rota entregou: as falhas não voltam para o próximo resumo
+	n.mu.Lock()
+	pending := len(n.failures)
+	n.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("expected failures to be cleared after a partial delivery, got %d pending", pending)
+	}
+}
+
+func TestChatMessage(t *testing.T) {
+	e := observability.EventEntry{Type: "session_end", Agent: "web-01", Storage: "default", Backup: "app", Result: "ok", Bytes: 3072, Message: "default/app ok (single)"}
+	msg := chatMessage("nas", config.WebhookEventBackupCommitted, e)
+	if msg.Subject != "[nbackup] nas: backup_committed web-01 default/app" || msg.Body != "default/app ok (single) (3.0 KB)" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	msg = chatMessage("nas", config.WebhookEventAgentOffline, observability.EventEntry{Agent: "db-01", Message: "control channel closed"})
+	if msg.Subject != "[nbackup] nas: agent_offline db-01" || msg.Body != "control channel closed" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/dedup"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
+)
+
+// Severidades de um CheckFinding.
+const (
+	CheckWarning = "warning" // não compromete o restore (ex: sidecar órfão)
+	CheckError   = "error"   // backup irrecuperável, incompleto ou adulterado
+)
+
+// Verificações de CheckStorage (campo CheckFinding.Check).
+const (
+	checkFilesystem = "filesystem" // arquivos no disco
+	checkCatalog    = "catalog"    // nomes de backup vistos pelo catálogo e pelo restore
+	checkSidecar    = "sidecar"    // manifest de arquivos e índice de membros
+	checkArchive    = "archive"    // integridade do archive comprimido (--deep)
+	checkChain      = "chain"      // manifest dedup → chunks do pool
+	checkLedger     = "ledger"     // ledger de storages imutáveis
+)
+
+// staleTempAge é a idade a partir da qual um temporário no diretório de um
+// backup é considerado sobra de uma sessão interrompida.
+const staleTempAge = 24 * time.Hour
+
+// CheckFinding é uma divergência encontrada por CheckStorage.
+type CheckFinding struct {
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Path     string `json:"path,omitempty"` // relativo a base_dir
+	Message  string `json:"message"`
+}
+
+// CheckReport é o resultado de CheckStorage.
+type CheckReport struct {
+	Storage  string         `json:"storage"`
+	BaseDir  string         `json:"base_dir"`
+	Deep     bool           `json:"deep"`
+	Backups  int            `json:"backups"`
+	Findings []CheckFinding `json:"findings"`
+	Errors   int            `json:"errors"`
+	Warnings int            `json:"warnings"`
+}
+
+// ExitCode segue a convenção de plugins de monitoração: 0 sem divergências,
+// 1 só warnings, 2 com erros.
+func (r *CheckReport) ExitCode() int {
+	switch {
+	case r.Errors > 0:
+		return 2
+	case r.Warnings > 0:
+		return 1
+	}
+	return 0
+}
+
+func (r *CheckReport) add(severity, check, path, format string, args ...any) {
+	r.Findings = append(r.Findings, CheckFinding{Severity: severity, Check: check, Path: filepath.ToSlash(path), Message: fmt.Sprintf(format, args...)})
+	if severity == CheckError {
+		r.Errors++
+	} else {
+		r.Warnings++
+	}
+}
+
+// CheckStorage confere a consistência dos backups do storage si: nomes
+// únicos no catálogo, arquivos vazios, temporários e sidecars órfãos,
+// legibilidade dos sidecars, manifests dedup contra o pool e, em storages
+// imutáveis, o ledger. Com deep, também descomprime cada archive, lê o
+// conteúdo dos chunks dedup e recalcula os SHA-256 do ledger.
+func CheckStorage(si config.StorageInfo, storage string, deep bool) (*CheckReport, error) {
+	if _, err := os.Stat(si.BaseDir); err != nil {
+		return nil, fmt.Errorf("base_dir: %w", err)
+	}
+	rep := &CheckReport{Storage: storage, BaseDir: si.BaseDir, Deep: deep, Findings: []CheckFinding{}}
+
+	var store *dedup.Store
+	if si.IsDedup() {
+		var err error
+		if store, err = dedup.Open(si.BaseDir); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, agent := range listSubdirs(si.BaseDir) {
+		for _, backup := range listSubdirs(filepath.Join(si.BaseDir, agent)) {
+			if err := checkBackupDir(rep, si, filepath.Join(agent, backup), store, deep); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if si.Immutable.Enabled {
+		lrep, err := VerifyLedger(si, deep)
+		if err != nil {
+			rep.add(CheckError, checkLedger, ledgerFileName, "%v", err)
+		} else {
+			for _, p := range lrep.Problems {
+				rep.add(CheckError, checkLedger, ledgerFileName, "%s", p)
+			}
+		}
+	}
+	return rep, nil
+}
+
+// checkBackupDir confere {agent}/{backup} (dir, relativo a base_dir).
+func checkBackupDir(rep *CheckReport, si config.StorageInfo, dir string, store *dedup.Store, deep bool) error {
+	agentDir := filepath.Join(si.BaseDir, dir)
+	backups, err := listBackups(agentDir)
+	if err != nil {
+		return fmt.Errorf("listing %s: %w", dir, err)
+	}
+
+	// Catálogo e restore identificam o backup só pelo nome
+	seen := make(map[string]string, len(backups))
+	for _, b := range backups {
+		rel := filepath.Join(dir, b.Rel)
+		if prev, dup := seen[b.Name]; dup {
+			rep.add(CheckError, checkCatalog, rel, "duplicate backup name (also at %s): catalog and restore resolve only one", filepath.ToSlash(prev))
+		}
+		seen[b.Name] = rel
+		if _, ok := backupCommitTime(b.Name); !ok {
+			rep.add(CheckWarning, checkCatalog, rel, "name has no commit timestamp")
+		}
+		rep.Backups++
+		checkBackup(rep, filepath.Join(agentDir, b.Rel), rel, store, deep)
+	}
+
+	// Temporários antigos e sidecars sem backup
+	return filepath.WalkDir(agentDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != agentDir && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "chunks_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel := filepath.Join(dir, strings.TrimPrefix(path, agentDir+string(filepath.Separator)))
+		name := d.Name()
+		switch {
+		case strings.HasSuffix(name, ".tmp"):
+			if info, err := d.Info(); err == nil && time.Since(info.ModTime()) > staleTempAge {
+				rep.add(CheckWarning, checkFilesystem, rel, "stale temporary file (modified %s)", info.ModTime().UTC().Format(time.RFC3339))
+			}
+		case strings.HasSuffix(name, manifest.Suffix), strings.HasSuffix(name, archiveIndexSuffix):
+			archive := strings.TrimSuffix(strings.TrimSuffix(path, manifest.Suffix), archiveIndexSuffix)
+			if !fileExists(archive) && !fileExists(archive+dedup.ManifestSuffix) {
+				rep.add(CheckWarning, checkSidecar, rel, "orphan sidecar (backup not found)")
+			}
+		}
+		return nil
+	})
+}
+
+// checkBackup confere um backup (path) e seus sidecars.
+func checkBackup(rep *CheckReport, path, rel string, store *dedup.Store, deep bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		rep.add(CheckError, checkFilesystem, rel, "%v", err)
+		return
+	}
+	if info.Size() == 0 {
+		rep.add(CheckError, checkFilesystem, rel, "backup is empty (0 bytes)")
+		return
+	}
+
+	if dedup.IsManifest(path) {
+		switch {
+		case store == nil:
+			rep.add(CheckError, checkChain, rel, "dedup manifest in a storage that is not type dedup")
+		case deep:
+			if err := store.Verify(path); err != nil {
+				rep.add(CheckError, checkChain, rel, "%v", err)
+			}
+		default:
+			missing, err := store.MissingChunks(path)
+			if err != nil {
+				rep.add(CheckError, checkChain, rel, "%v", err)
+			} else if len(missing) > 0 {
+				rep.add(CheckError, checkChain, rel, "%d chunk(s) missing from the pool (first: %s)", len(missing), missing[0])
+			}
+		}
+	} else if deep {
+		// Backups vazios (sem entradas) são válidos
+		if err := VerifyArchiveIntegrity(path, nil, nil); err != nil && !errors.Is(err, errArchiveNoEntries) {
+			rep.add(CheckError, checkArchive, rel, "%v", err)
+		}
+	}
+
+	if mp := fileManifestPath(path); fileExists(mp) {
+		if err := checkFileManifest(mp); err != nil {
+			rep.add(CheckError, checkSidecar, filepath.Join(filepath.Dir(rel), filepath.Base(mp)), "%v", err)
+		}
+	}
+	if ip := archiveIndexPath(path); fileExists(ip) {
+		if err := checkArchiveIndex(ip, info.Size()); err != nil {
+			rep.add(CheckError, checkSidecar, filepath.Join(filepath.Dir(rel), filepath.Base(ip)), "%v", err)
+		}
+	}
+}
+
+// checkFileManifest lê o manifest de arquivos inteiro (CRC do gzip e JSON de
+// cada entrada).
+func checkFileManifest(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return manifest.Read(bufio.NewReader(f), func(manifest.Entry) error { return nil })
+}
+
+// checkArchiveIndex lê o índice de membros inteiro e confere que os offsets
+// cabem no archive de archiveSize bytes.
+func checkArchiveIndex(path string, archiveSize int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("opening index: %w", err)
+	}
+	defer gz.Close()
+	dec := json.NewDecoder(gz)
+	for {
+		var e indexEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("decoding index entry: %w", err)
+		}
+		if e.Offset < 0 || e.Offset >= archiveSize {
+			return fmt.Errorf("index entry %s points past the archive (offset %d, size %d)", e.Path, e.Offset, archiveSize)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
+)
+
+// writeCheckArchive grava um archive vazio (mas válido) em path.
+func writeCheckArchive(t *testing.T, path string) {
+	t.Helper()
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeEmptyArchive(path, ".tar.gz"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckStorage(t *testing.T) {
+	si := config.StorageInfo{BaseDir: t.TempDir()}
+	agentDir := filepath.Join(si.BaseDir, "web-01", "app")
+	if err := os.MkdirAll(filepath.Join(agentDir, "2026", "03"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	good := filepath.Join(agentDir, "2026-03-01T02-00-00-000.tar.gz")
+	writeCheckArchive(t, good)
+	rep, err := CheckStorage(si, "scripts", true)
+	if err != nil {
+		t.Fatalf("CheckStorage: %v", err)
+	}
+	if rep.Backups != 1 || rep.ExitCode() != 0 {
+		t.Fatalf("expected a clean storage, got %+v", rep)
+	}
+
+	// Mesmo nome em um diretório de data, arquivo vazio, sidecar corrompido,
+	// sidecar órfão e temporário antigo
+	writeCheckArchive(t, filepath.Join(agentDir, "2026", "03", "2026-03-01T02-00-00-000.tar.gz"))
+	os.WriteFile(filepath.Join(agentDir, "2026-03-02T02-00-00-000.tar.gz"), nil, 0644)
+	os.WriteFile(good+manifest.Suffix, []byte("not gzip"), 0644)
+	os.WriteFile(filepath.Join(agentDir, "2026-02-01T02-00-00-000.tar.gz"+archiveIndexSuffix), []byte("x"), 0644)
+	tmp := filepath.Join(agentDir, "backup-123.tmp")
+	os.WriteFile(tmp, []byte("partial"), 0644)
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(tmp, old, old)
+
+	rep, err = CheckStorage(si, "scripts", false)
+	if err != nil {
+		t.Fatalf("CheckStorage: %v", err)
+	}
+	if rep.Errors != 3 || rep.Warnings != 2 || rep.ExitCode() != 2 {
+		t.Fatalf("expected 3 errors and 2 warnings, got %+v", rep.Findings)
+	}
+	want := map[string]string{
+		"web-01/app/2026/03/2026-03-01T02-00-00-000.tar.gz":           checkCatalog,
+		"web-01/app/2026-03-01T02-00-00-000.tar.gz":                   checkCatalog, // duplicata: qualquer um dos dois
+		"web-01/app/2026-03-02T02-00-00-000.tar.gz":                   checkFilesystem,
+		"web-01/app/2026-03-01T02-00-00-000.tar.gz" + manifest.Suffix: checkSidecar,
+		"web-01/app/2026-02-01T02-00-00-000.tar.gz.index.jsonl.gz":    checkSidecar,
+		"web-01/app/backup-123.tmp":                                   checkFilesystem,
+	}
+	for _, f := range rep.Findings {
+		if want[f.Path] != f.Check {
+			t.Errorf("unexpected finding: %+v", f)
+		}
+	}
+}
+
+func TestCheckStorage_DeepDetectsTruncatedArchive(t *testing.T) {
+	si := config.StorageInfo{BaseDir: t.TempDir()}
+	agentDir := filepath.Join(si.BaseDir, "web-01", "app")
+	os.MkdirAll(agentDir, 0755)
+	path := filepath.Join(agentDir, "2026-03-01T02-00-00-000.tar.gz")
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	content := bytes.Repeat([]byte("data "), 1<<16)
+	tw.WriteHeader(&tar.Header{Name: "etc/app.conf", Mode: 0644, Size: int64(len(content))})
+	tw.Write(content)
+	tw.Close()
+	gw.Close()
+	os.WriteFile(path, buf.Bytes()[:buf.Len()/2], 0644)
+
+	rep, _ := CheckStorage(si, "scripts", false)
+	if rep.ExitCode() != 0 {
+		t.Fatalf("shallow check should not read archives: %+v", rep.Findings)
+	}
+	rep, _ = CheckStorage(si, "scripts", true)
+	if rep.Errors != 1 || rep.Findings[0].Check != checkArchive {
+		t.Fatalf("expected an archive error, got %+v", rep.Findings)
+	}
+	if !strings.Contains(rep.Findings[0].Path, "2026-03-01T02-00-00-000.tar.gz") {
+		t.Errorf("unexpected path: %s", rep.Findings[0].Path)
+	}
+}
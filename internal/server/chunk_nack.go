@@ -0,0 +1,99 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// maxChunkNACKs é quantas vezes o mesmo chunk pode falhar o CRC32 antes de o
+// server desistir do ChunkNACK e derrubar o stream (reconexão + resume).
+const maxChunkNACKs = 3
+
+// nackedChunk é um chunk rejeitado por CRC32 aguardando retransmissão.
+type nackedChunk struct {
+	slot   uint8 // stream que recebeu o chunk corrompido
+	offset int64 // offset do stream antes do chunk (teto do ChunkSACK até a retransmissão)
+	count  int   // ChunkNACKs enviados para o chunk
+}
+
+// chunkNACKs rastreia os chunks de uma sessão paralela rejeitados por CRC32.
+// Enquanto um chunk está pendente, o offset confirmado do seu stream não passa
+// do offset anterior a ele: se o stream cair antes da retransmissão, o resume
+// reenvia o chunk junto com o restante.
+type chunkNACKs struct {
+	mu      sync.Mutex
+	pending map[uint32]nackedChunk
+	count   atomic.Int32 // len(pending), para o caminho rápido sem lock
+}
+
+// add registra o ChunkNACK de seq recebido em slot com o offset anterior ao
+// chunk e retorna quantos ChunkNACKs o chunk já recebeu (incluindo este).
+func (n *chunkNACKs) add(seq uint32, slot uint8, offset int64) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.pending == nil {
+		n.pending = make(map[uint32]nackedChunk)
+	}
+	c, ok := n.pending[seq]
+	if !ok {
+		c = nackedChunk{slot: slot, offset: offset}
+		n.count.Add(1)
+	} else if slot == c.slot && offset < c.offset {
+		c.offset = offset
+	}
+	c.count++
+	n.pending[seq] = c
+	return c.count
+}
+
+// resolve remove seq dos pendentes quando o chunk chega íntegro e informa se
+// ele era uma retransmissão.
+func (n *chunkNACKs) resolve(seq uint32) bool {
+	if n.count.Load() == 0 {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.pending[seq]; !ok {
+		return false
+	}
+	delete(n.pending, seq)
+	n.count.Add(-1)
+	return true
+}
+
+// ackOffset retorna o offset que pode ser confirmado para slot: received,
+// limitado ao menor offset dos chunks pendentes recebidos por ele.
+func (n *chunkNACKs) ackOffset(slot uint8, received int64) int64 {
+	if n.count.Load() == 0 {
+		return received
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, c := range n.pending {
+		if c.slot == slot && c.offset < received {
+			received = c.offset
+		}
+	}
+	return received
+}
+
+// clearSlot descarta os pendentes de slot: no re-join o agent reenvia tudo a
+// partir do offset confirmado, que já inclui esses chunks.
+func (n *chunkNACKs) clearSlot(slot uint8) {
+	if n.count.Load() == 0 {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for seq, c := range n.pending {
+		if c.slot == slot {
+			delete(n.pending, seq)
+			n.count.Add(-1)
+		}
+	}
+}
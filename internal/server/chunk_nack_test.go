@@ -0,0 +1,48 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import "testing"
+
+func TestChunkNACKs_HoldsAckOffsetUntilResolved(t *testing.T) {
+	var n chunkNACKs
+
+	if got := n.ackOffset(0, 5000); got != 5000 {
+		t.Fatalf("expected unclamped offset without pending chunks, got %d", got)
+	}
+
+	if c := n.add(7, 0, 1000); c != 1 {
+		t.Fatalf("expected first NACK count 1, got %d", c)
+	}
+	if c := n.add(7, 0, 3000); c != 2 {
+		t.Fatalf("expected second NACK count 2, got %d", c)
+	}
+	n.add(9, 1, 2000)
+
+	if got := n.ackOffset(0, 5000); got != 1000 {
+		t.Errorf("expected stream 0 held at 1000, got %d", got)
+	}
+	if got := n.ackOffset(1, 5000); got != 2000 {
+		t.Errorf("expected stream 1 held at 2000, got %d", got)
+	}
+
+	if !n.resolve(7) {
+		t.Fatal("expected seq 7 to be pending")
+	}
+	if n.resolve(7) {
+		t.Error("expected seq 7 to be resolved only once")
+	}
+	if got := n.ackOffset(0, 5000); got != 5000 {
+		t.Errorf("expected stream 0 released after resolve, got %d", got)
+	}
+
+	n.clearSlot(1)
+	if got := n.ackOffset(1, 5000); got != 5000 {
+		t.Errorf("expected stream 1 released after clearSlot, got %d", got)
+	}
+	if n.count.Load() != 0 {
+		t.Errorf("expected no pending chunks, got %d", n.count.Load())
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/agent"
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+)
+
+// TestConcurrentParallelBackups_SharedControlChannel executa dois entries
+// paralelos do mesmo agent ao mesmo tempo (max_concurrent_backups > 1), com um
+// único control channel: cada sessão recebe as stats do próprio auto-scaler e
+// os dois backups terminam.
+func TestConcurrentParallelBackups_SharedControlChannel(t *testing.T) {
+	cfg, _ := setupEnrollPKI(t)
+	cfg.Storages = map[string]config.StorageInfo{"default": {BaseDir: t.TempDir(), MaxBackups: 3}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ca, err := pki.LoadCA(cfg.TLS.CACert, cfg.Enrollment.CAKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader, err := pki.NewCertReloader(cfg.TLS.CACert, cfg.TLS.ServerCert, cfg.TLS.ServerKey, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", reloader.ServerTLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	h := NewHandler(cfg, logger, &sync.Map{}, &sync.Map{})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go h.HandleConnection(ctx, conn)
+		}
+	}()
+
+	// Certificado do agent e fontes incompressíveis: com bandwidth_limit, cada
+	// backup dura alguns pings do control channel
+	dir := t.TempDir()
+	keyPEM, csrPEM, err := pki.NewClientCSR("pipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := ca.SignClientCSR(csrPEM, "pipe", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "agent.pem"), certPEM, 0644)
+	os.WriteFile(filepath.Join(dir, "agent-key.pem"), keyPEM, 0600)
+	for _, name := range []string{"home", "db"} {
+		data := make([]byte, 256*1024)
+		rand.Read(data)
+		os.MkdirAll(filepath.Join(dir, name), 0755)
+		os.WriteFile(filepath.Join(dir, name, "data.bin"), data, 0644)
+	}
+
+	cfgPath := filepath.Join(dir, "agent.yaml")
+	os.WriteFile(cfgPath, []byte(fmt.Sprintf(`
+agent:
+  name: pipe
+server:
+  address: %q
+tls:
+  ca_cert: %q
+  client_cert: %q
+  client_key: %q
+daemon:
+  state_dir: %q
+  max_concurrent_backups: 2
+  control_channel:
+    keepalive_interval: 1s
+backups:
+  - name: home
+    storage: default
+    schedule: "0 2 * * *"
+    parallels: 2
+    bandwidth_limit: 64kb
+    sources:
+      - path: %q
+  - name: db
+    storage: default
+    schedule: "0 2 * * *"
+    parallels: 3
+    bandwidth_limit: 64kb
+    sources:
+      - path: %q
+`, ln.Addr().String(), cfg.TLS.CACert, filepath.Join(dir, "agent.pem"), filepath.Join(dir, "agent-key.pem"),
+		filepath.Join(dir, "state"), filepath.Join(dir, "home"), filepath.Join(dir, "db"))), 0600)
+	agentCfg, err := config.LoadAgentConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("loading agent config: %v", err)
+	}
+
+	controlCh := agent.NewControlChannel(agentCfg, logger)
+	controlCh.Start()
+	defer controlCh.Stop()
+	for !controlCh.IsConnected() {
+		if ctx.Err() != nil {
+			t.Fatal("control channel did not connect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(agentCfg.Backups))
+	for i, entry := range agentCfg.Backups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = agent.RunBackup(ctx, agentCfg, entry, logger, nil, nil, controlCh)
+		}()
+	}
+
+	// Enquanto as duas sessões estão ativas, cada uma deve receber as stats
+	// do seu auto-scaler
+	scaled := map[string]bool{}
+	for len(scaled) < 2 && ctx.Err() == nil {
+		h.sessions.Range(func(_, value any) bool {
+			if ps, ok := value.(*ParallelSession); ok && ps.AutoScaleInfo.Load() != nil {
+				scaled[ps.BackupName] = true
+			}
+			return true
+		})
+		time.Sleep(20 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if !scaled["home"] || !scaled["db"] {
+		t.Errorf("expected auto-scale stats on both sessions, got %v", scaled)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("backup %s: %v", agentCfg.Backups[i].Name, err)
+		}
+	}
+}
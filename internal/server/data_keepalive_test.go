@@ -0,0 +1,146 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func TestControlProgress_KeepsSingleSessionAlive(t *testing.T) {
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: t.TempDir()}})
+
+	// Sem certificado (net.Pipe) o agent do control channel é o remote address: "pipe"
+	session := &PartialSession{AgentName: "pipe", StorageName: "default", CreatedAt: time.Now()}
+	h.sessions.Store("single", session)
+
+	serverConn, agentConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		h.handleControlChannel(context.Background(), serverConn, slog.Default())
+		close(done)
+	}()
+
+	agentConn.Write([]byte{0, 0, 0, 30})
+	agentConn.Write([]byte("test\n"))
+	protocol.WriteControlStatsPayload(agentConn, 0, 0, 0, 0)
+	protocol.WriteControlProgress(agentConn, 0, 1200, false)
+	protocol.WriteControlPing(agentConn, time.Now().UnixNano())
+	protocol.ReadControlMagic(agentConn) // pong: os frames anteriores já foram processados
+	agentConn.Close()
+	<-done
+
+	if session.ObjectsSent.Load() != 1200 || session.TotalObjects.Load() != 0 || session.WalkComplete.Load() != 0 {
+		t.Fatalf("unexpected progress: sent=%d total=%d walk=%d",
+			session.ObjectsSent.Load(), session.TotalObjects.Load(), session.WalkComplete.Load())
+	}
+	if !session.progressSince(time.Now().Add(-time.Minute)) {
+		t.Fatal("expected LastProgress updated by ControlProgress")
+	}
+}
+
+func TestControlProgress_SessionScoped(t *testing.T) {
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: t.TempDir()}})
+
+	// Duas sessões do mesmo agent ("pipe", ver acima) e uma de outro agent
+	home := &PartialSession{AgentName: "pipe", StorageName: "default", CreatedAt: time.Now()}
+	db := &ParallelSession{SessionID: "db", AgentName: "pipe", StorageName: "default", ControlLost: make(chan struct{})}
+	other := &PartialSession{AgentName: "web-01", StorageName: "default", CreatedAt: time.Now()}
+	h.sessions.Store("home", home)
+	h.sessions.Store("db", db)
+	h.sessions.Store("other", other)
+
+	serverConn, agentConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		h.handleControlChannel(context.Background(), serverConn, slog.Default())
+		close(done)
+	}()
+
+	agentConn.Write([]byte{0, 0, 0, 30})
+	agentConn.Write([]byte("test\n"))
+	protocol.WriteControlStatsPayload(agentConn, 0, 0, 0, 0)
+	protocol.WriteControlSessionProgress(agentConn, "home", 10, 5, false)
+	protocol.WriteControlSessionProgress(agentConn, "db", 900, 300, true)
+	protocol.WriteControlSessionProgress(agentConn, "other", 1, 1, true) // sessão de outro agent
+	protocol.WriteControlProgress(agentConn, 7, 7, true)                 // CPRG ambíguo: duas sessões
+	protocol.WriteControlPing(agentConn, time.Now().UnixNano())
+	protocol.ReadControlMagic(agentConn)
+	agentConn.Close()
+	<-done
+
+	if home.TotalObjects.Load() != 10 || home.ObjectsSent.Load() != 5 || home.WalkComplete.Load() != 0 {
+		t.Errorf("unexpected home progress: total=%d sent=%d walk=%d",
+			home.TotalObjects.Load(), home.ObjectsSent.Load(), home.WalkComplete.Load())
+	}
+	if db.TotalObjects.Load() != 900 || db.ObjectsSent.Load() != 300 || db.WalkComplete.Load() != 1 {
+		t.Errorf("unexpected db progress: total=%d sent=%d walk=%d",
+			db.TotalObjects.Load(), db.ObjectsSent.Load(), db.WalkComplete.Load())
+	}
+	if other.ObjectsSent.Load() != 0 || other.progressSince(time.Now().Add(-time.Minute)) {
+		t.Error("expected another agent's session untouched")
+	}
+}
+
+func TestReceiveWithSACK_IdleConnection(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: t.TempDir()}})
+	h.readInactivityTimeout = timeout
+	logger := slog.Default()
+
+	receive := func(t *testing.T, reportProgress bool) (int64, error) {
+		t.Helper()
+		tmpPath := filepath.Join(t.TempDir(), "backup.tmp")
+		tmpFile, err := os.Create(tmpPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tmpFile.Close()
+		session := &PartialSession{TmpPath: tmpPath, AgentName: "web-01", StorageName: "default", CreatedAt: time.Now()}
+
+		// serverConn fecha antes da espera pelo produtor, liberando o Write final
+		producerDone := make(chan struct{})
+		defer func() { <-producerDone }()
+		serverConn, agentConn := net.Pipe()
+		defer serverConn.Close()
+		go func() {
+			defer close(producerDone)
+			defer agentConn.Close()
+			// Produtor lento: 5× o timeout de inatividade sem bytes
+			deadline := time.Now().Add(5 * timeout)
+			for time.Now().Before(deadline) {
+				if reportProgress {
+					session.LastProgress.Store(time.Now().UnixNano())
+				}
+				time.Sleep(timeout / 5)
+			}
+			agentConn.Write([]byte("late data"))
+		}()
+		return h.receiveWithSACK(context.Background(), serverConn, serverConn, tmpFile, tmpPath, session, logger)
+	}
+
+	t.Run("agent reporting progress", func(t *testing.T) {
+		n, err := receive(t, true)
+		if err != nil || n != int64(len("late data")) {
+			t.Fatalf("expected idle connection kept alive, got n=%d err=%v", n, err)
+		}
+	})
+	t.Run("no progress", func(t *testing.T) {
+		_, err := receive(t, false)
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("expected inactivity timeout, got %v", err)
+		}
+	})
+}
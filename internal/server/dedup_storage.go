@@ -0,0 +1,110 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// dedup_storage.go integra os storages `type: dedup` ao ciclo de commit: o
+// archive commitado é convertido em manifest (internal/dedup) antes da
+// rotação, e a rotação passa a coletar do pool os chunks que nenhum manifest
+// referencia mais.
+
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/dedup"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// dedupStore retorna o pool de chunks de baseDir, aberto no primeiro uso.
+func (h *Handler) dedupStore(baseDir string) (*dedup.Store, error) {
+	if raw, ok := h.dedupStores.Load(baseDir); ok {
+		return raw.(*dedup.Store), nil
+	}
+	store, err := dedup.Open(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	raw, _ := h.dedupStores.LoadOrStore(baseDir, store)
+	return raw.(*dedup.Store), nil
+}
+
+// ingestDedup substitui o archive commitado em um storage dedup pelo seu
+// manifest e retorna o caminho final do backup. Se a ingestão falhar, o
+// archive é mantido como um backup comum (continua válido e restaurável).
+func (h *Handler) ingestDedup(si config.StorageInfo, storage, agent, backup, archivePath string, logger *slog.Logger) string {
+	store, err := h.dedupStore(si.BaseDir)
+	if err == nil {
+		start := time.Now()
+		var hdr *dedup.ManifestHeader
+		hdr, err = store.Ingest(archivePath)
+		if err == nil {
+			logger.Info("backup deduplicated",
+				"manifest", archivePath+dedup.ManifestSuffix,
+				"tar_bytes", hdr.TarSize,
+				"chunks", hdr.Chunks,
+				"new_chunks", hdr.NewChunks,
+				"new_bytes", hdr.NewBytes,
+				"duration", time.Since(start).Round(time.Millisecond),
+			)
+			return archivePath + dedup.ManifestSuffix
+		}
+	}
+
+	logger.Error("dedup ingest failed — keeping the archive as a regular backup", "path", archivePath, "error", err)
+	if h.Events != nil {
+		h.Events.Push(observability.EventEntry{
+			Level:   "error",
+			Type:    "dedup_failed",
+			Agent:   agent,
+			Storage: storage,
+			Backup:  backup,
+			Message: fmt.Sprintf("%s/%s: dedup ingest of %s failed: %v", storage, backup, filepath.Base(archivePath), err),
+		})
+	}
+	// Se o manifest chegou a ser gravado, o archive não é mais necessário.
+	if _, statErr := os.Stat(archivePath); os.IsNotExist(statErr) {
+		return archivePath + dedup.ManifestSuffix
+	}
+	return archivePath
+}
+
+// collectDedupGarbage remove do pool de baseDir os chunks que deixaram de ser
+// referenciados depois que a rotação removeu manifests. Não faz nada se
+// nenhum dos removidos é um manifest (storages file).
+func (h *Handler) collectDedupGarbage(baseDir string, removed []string, logger *slog.Logger) {
+	hasManifest := false
+	for _, name := range removed {
+		if dedup.IsManifest(name) {
+			hasManifest = true
+			break
+		}
+	}
+	if !hasManifest {
+		return
+	}
+
+	store, err := h.dedupStore(baseDir)
+	if err != nil {
+		logger.Warn("dedup garbage collection skipped", "error", err)
+		return
+	}
+	start := time.Now()
+	stats, err := store.GC()
+	if err != nil {
+		logger.Error("dedup garbage collection failed", "error", err)
+		return
+	}
+	logger.Info("dedup garbage collected",
+		"manifests", stats.Manifests,
+		"referenced_chunks", stats.Referenced,
+		"removed_chunks", stats.Removed,
+		"freed_bytes", stats.FreedBytes,
+		"duration", time.Since(start).Round(time.Millisecond),
+	)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/dedup"
+)
+
+// writeTarGz grava em path um .tar.gz com um arquivo de n bytes aleatórios.
+func writeTarGz(t *testing.T, path string, seed int64, n int) {
+	t.Helper()
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "data.bin", Mode: 0644, Size: int64(n)})
+	tw.Write(data)
+	tw.Close()
+	gw.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDedupStorage_IngestRotateAndDownload(t *testing.T) {
+	base := t.TempDir()
+	si := config.StorageInfo{BaseDir: base, MaxBackups: 1, Type: config.StorageTypeDedup}
+	h := newTestHandler(t, map[string]config.StorageInfo{"pool": si})
+	dir := writeBackups(t, base, "db-01", "daily")
+
+	var manifests []string
+	for i, name := range []string{"2026-03-01T02-00-00-000.tar.gz", "2026-03-02T02-00-00-000.tar.gz"} {
+		archive := filepath.Join(dir, name)
+		writeTarGz(t, archive, int64(i), 3<<20)
+		manifest := h.ingestDedup(si, "pool", "db-01", "daily", archive, slog.Default())
+		if manifest != archive+dedup.ManifestSuffix {
+			t.Fatalf("ingestDedup returned %s", manifest)
+		}
+		manifests = append(manifests, filepath.Base(manifest))
+	}
+
+	catalog := h.BackupCatalog()
+	if len(catalog) != 2 || !catalog[0].Dedup || catalog[0].SizeBytes < 3<<20 {
+		t.Fatalf("expected 2 dedup entries with the archive size, got %+v", catalog)
+	}
+
+	removed, err := h.RotateBackups("pool", "db-01", "daily")
+	if err != nil || len(removed) != 1 || removed[0] != manifests[0] {
+		t.Fatalf("RotateBackups: removed=%v err=%v", removed, err)
+	}
+	// Os chunks exclusivos do manifest rotacionado foram coletados.
+	store, _ := h.dedupStore(base)
+	if stats, err := store.GC(); err != nil || stats.Removed != 0 || stats.Manifests != 1 {
+		t.Errorf("expected the pool to be already collected, got %+v (%v)", stats, err)
+	}
+
+	f, err := h.OpenBackup("pool", "db-01", "daily", manifests[1], false)
+	if err != nil {
+		t.Fatalf("OpenBackup: %v", err)
+	}
+	defer f.Close()
+	if filepath.Base(f.Name()) != "2026-03-02T02-00-00-000.tar.gz" {
+		t.Errorf("download should be named after the archive, got %s", f.Name())
+	}
+	if _, err := os.Stat(f.Name()); !os.IsNotExist(err) {
+		t.Errorf("materialized archive should not stay on disk, stat err = %v", err)
+	}
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("reconstructed archive is not gzip: %v", err)
+	}
+	if hdr, err := tar.NewReader(gr).Next(); err != nil || hdr.Size != 3<<20 {
+		t.Errorf("reconstructed archive: %+v, %v", hdr, err)
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// discardBackup encerra uma sessão de um storage discard já validada
+// (checksum e tamanho): remove o que tiver sido gravado e responde OK sem
+// commit, rotação ou ações pós-commit. Sessões paralelas não gravam o arquivo
+// montado; as single-stream descartam o .tmp.
+func (h *Handler) discardBackup(conn net.Conn, writer *AtomicWriter, tmpPath string, totalBytes int64, checksum [32]byte, logger *slog.Logger) string {
+	writer.Abort(tmpPath)
+	logger.Info("backup discarded (storage type discard)",
+		"bytes", totalBytes,
+		"checksum", fmt.Sprintf("%x", checksum),
+	)
+	protocol.WriteFinalACK(conn, protocol.FinalStatusOK)
+	return "ok"
+}
@@ -0,0 +1,407 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// disk_health.go monitora a saúde do disco de cada storage com
+// disk_health configurado (smartctl ou probe próprio). Um disco degradado
+// (setores pendentes, erros de mídia) força verify_integrity nos novos
+// backups e dispara um scrub dos backups existentes — ou torna o storage
+// somente leitura com on_degraded: read_only. Um disco failing é sempre
+// somente leitura.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/dedup"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// Estados de saúde do disco de um storage.
+const (
+	DiskHealthOK       = "ok"
+	DiskHealthDegraded = "degraded" // setores pendentes/realocados, erros de mídia
+	DiskHealthFailing  = "failing"  // SMART reporta falha iminente
+	DiskHealthUnknown  = "unknown"  // probe falhou (não bloqueia backups)
+)
+
+const (
+	// diskHealthTick é a granularidade do monitor; cada storage é consultado
+	// no seu próprio disk_health.interval.
+	diskHealthTick = time.Minute
+
+	// diskHealthProbeTimeout limita cada execução do smartctl/probe.
+	diskHealthProbeTimeout = time.Minute
+
+	// maxDiskHealthDetail trunca a saída do probe guardada no status.
+	maxDiskHealthDetail = 512
+)
+
+// diskHealthStatus é o último resultado do probe de um storage.
+type diskHealthStatus struct {
+	State     string
+	Detail    string
+	CheckedAt time.Time
+	Since     time.Time // início do estado atual
+}
+
+// scrubProgress acompanha a verificação dos backups existentes de um storage
+// disparada por um disco degradado.
+type scrubProgress struct {
+	StartedAt  time.Time
+	FinishedAt atomic.Value // time.Time (zero enquanto em andamento)
+	Checked    atomic.Int64
+	Corrupt    atomic.Int64
+}
+
+// StartDiskHealth inicia o monitor de saúde dos discos dos storages. A config
+// é relida a cada tick, então storages adicionados ou alterados por reload
+// passam a ser monitorados sem restart.
+func (h *Handler) StartDiskHealth(ctx context.Context) {
+	go func() {
+		h.probeDiskHealth(ctx)
+		ticker := time.NewTicker(diskHealthTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.probeDiskHealth(ctx)
+			}
+		}
+	}()
+}
+
+// probeDiskHealth consulta os storages cujo interval já expirou.
+func (h *Handler) probeDiskHealth(ctx context.Context) {
+	for name, si := range h.config().Storages {
+		dh := si.DiskHealth
+		if !dh.Enabled() {
+			h.diskHealth.Delete(name)
+			continue
+		}
+		if prev, ok := h.diskHealthOf(name); ok && time.Since(prev.CheckedAt) < dh.Interval {
+			continue
+		}
+
+		state, detail := runDiskHealthProbe(ctx, dh)
+		if ctx.Err() != nil {
+			return
+		}
+		h.recordDiskHealth(ctx, name, si, state, detail)
+	}
+}
+
+// recordDiskHealth grava o resultado do probe e reage a mudanças de estado.
+func (h *Handler) recordDiskHealth(ctx context.Context, name string, si config.StorageInfo, state, detail string) {
+	now := time.Now()
+	st := diskHealthStatus{State: state, Detail: detail, CheckedAt: now, Since: now}
+	prev, known := h.diskHealthOf(name)
+	if known && prev.State == state {
+		st.Since = prev.Since
+	}
+	h.diskHealth.Store(name, st)
+	if known && prev.State == state {
+		return
+	}
+
+	logger := h.logger.With("storage", name)
+	level := "warn"
+	switch state {
+	case DiskHealthOK:
+		level = "info"
+		if !known {
+			logger.Info("storage disk health", "state", state)
+			return
+		}
+		logger.Info("storage disk health recovered", "state", state, "previous", prev.State)
+	case DiskHealthFailing:
+		level = "error"
+		logger.Error("storage disk is failing — storage is now read-only", "detail", detail)
+	case DiskHealthDegraded:
+		logger.Warn("storage disk is degraded", "on_degraded", si.DiskHealth.OnDegraded, "detail", detail)
+	default:
+		logger.Warn("storage disk health unknown", "detail", detail)
+	}
+	if h.Events != nil {
+		h.Events.Push(observability.EventEntry{
+			Level:   level,
+			Type:    "storage_health",
+			Storage: name,
+			Message: fmt.Sprintf("%s: disk health %s: %s", name, state, detail),
+		})
+	}
+
+	if state == DiskHealthDegraded && si.DiskHealth.OnDegraded == config.DiskHealthActionVerify {
+		go h.scrubStorage(ctx, name, si.BaseDir)
+	}
+}
+
+// diskHealthOf retorna o último status do disco do storage name.
+func (h *Handler) diskHealthOf(name string) (diskHealthStatus, bool) {
+	raw, ok := h.diskHealth.Load(name)
+	if !ok {
+		return diskHealthStatus{}, false
+	}
+	return raw.(diskHealthStatus), true
+}
+
+// storageReadOnly indica se o storage recusa novos backups pela saúde do
+// disco: failing, ou degraded com on_degraded: read_only. Estado unknown não
+// bloqueia (um smartctl ausente não deve parar os backups).
+func (h *Handler) storageReadOnly(name string, si config.StorageInfo) (bool, diskHealthStatus) {
+	st, ok := h.diskHealthOf(name)
+	if !ok || !si.DiskHealth.Enabled() {
+		return false, st
+	}
+	switch st.State {
+	case DiskHealthFailing:
+		return true, st
+	case DiskHealthDegraded:
+		return si.DiskHealth.OnDegraded == config.DiskHealthActionReadOnly, st
+	}
+	return false, st
+}
+
+// storageForceVerify indica se os backups do storage devem passar por
+// verify_integrity por causa de um disco degradado (on_degraded: verify).
+func (h *Handler) storageForceVerify(name string, si config.StorageInfo) bool {
+	st, ok := h.diskHealthOf(name)
+	return ok && si.DiskHealth.Enabled() && st.State == DiskHealthDegraded &&
+		si.DiskHealth.OnDegraded == config.DiskHealthActionVerify
+}
+
+// runDiskHealthProbe executa o probe configurado: `smartctl -H -A device` ou
+// o command próprio (exit 0 = ok, 1 = degraded, 2 = failing).
+func runDiskHealthProbe(ctx context.Context, dh config.DiskHealthConfig) (state, detail string) {
+	ctx, cancel := context.WithTimeout(ctx, diskHealthProbeTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if dh.Device != "" {
+		cmd = exec.CommandContext(ctx, dh.Smartctl, "-H", "-A", dh.Device)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", dh.Command)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+
+	exitCode := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if ctx.Err() != nil || !errors.As(err, &exitErr) {
+			if ctx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("timed out after %s", diskHealthProbeTimeout)
+			}
+			return DiskHealthUnknown, fmt.Sprintf("probe failed: %v", err)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+
+	if dh.Device != "" {
+		return parseSmartctl(exitCode, out.String())
+	}
+	detail = truncateDetail(strings.TrimSpace(out.String()))
+	switch exitCode {
+	case 0:
+		return DiskHealthOK, detail
+	case 1:
+		return DiskHealthDegraded, detail
+	case 2:
+		return DiskHealthFailing, detail
+	}
+	return DiskHealthUnknown, truncateDetail(fmt.Sprintf("probe exited with status %d: %s", exitCode, detail))
+}
+
+// Bits do exit status do smartctl (smartctl(8), "RETURN VALUES").
+const (
+	smartctlCommandError  = 1<<0 | 1<<1 | 1<<2 // linha de comando, device não abriu, comando SMART falhou
+	smartctlDiskFailing   = 1 << 3             // "SMART status check returned DISK FAILING"
+	smartctlPrefailBelow  = 1 << 4             // atributo pre-fail abaixo do threshold
+	smartctlSelfTestError = 1 << 7             // self-test log com erros
+)
+
+// parseSmartctl classifica a saída de `smartctl -H -A` a partir do exit
+// status e dos atributos de setores pendentes/incorrigíveis (ATA) ou de erros
+// de mídia (NVMe).
+func parseSmartctl(exitCode int, out string) (state, detail string) {
+	if exitCode&smartctlCommandError != 0 {
+		return DiskHealthUnknown, truncateDetail(fmt.Sprintf("smartctl exited with status %d: %s", exitCode, strings.TrimSpace(out)))
+	}
+	if exitCode&(smartctlDiskFailing|smartctlPrefailBelow) != 0 {
+		return DiskHealthFailing, fmt.Sprintf("smartctl exited with status %d (disk failing or pre-fail attribute below threshold)", exitCode)
+	}
+
+	var problems []string
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		fields := strings.Fields(line)
+		// Tabela de atributos ATA: ID# ATTRIBUTE_NAME FLAG VALUE WORST THRESH TYPE UPDATED WHEN_FAILED RAW_VALUE
+		if len(fields) >= 10 && (fields[0] == "197" || fields[0] == "198") {
+			if raw, err := strconv.ParseInt(fields[9], 10, 64); err == nil && raw > 0 {
+				problems = append(problems, fmt.Sprintf("%s=%d", fields[1], raw))
+			}
+			continue
+		}
+		// NVMe: "Media and Data Integrity Errors:    3"
+		if k, v, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(k) == "Media and Data Integrity Errors" {
+			v = strings.ReplaceAll(strings.TrimSpace(v), ",", "")
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+				problems = append(problems, fmt.Sprintf("Media_and_Data_Integrity_Errors=%d", n))
+			}
+		}
+	}
+	if exitCode&smartctlSelfTestError != 0 {
+		problems = append(problems, "self-test log has errors")
+	}
+	if len(problems) > 0 {
+		return DiskHealthDegraded, strings.Join(problems, ", ")
+	}
+	return DiskHealthOK, "SMART overall-health passed"
+}
+
+// truncateDetail limita s a maxDiskHealthDetail bytes.
+func truncateDetail(s string) string {
+	if len(s) > maxDiskHealthDetail {
+		return s[:maxDiskHealthDetail] + "..."
+	}
+	return s
+}
+
+// scrubStorage verifica todos os backups de baseDir (archives com
+// VerifyArchiveIntegrity, manifests dedup com Store.Verify) e emite um evento
+// por backup corrompido. Um scrub por storage de cada vez.
+func (h *Handler) scrubStorage(ctx context.Context, name, baseDir string) {
+	if prev := h.scrubOf(name); prev != nil && prev.FinishedAt.Load().(time.Time).IsZero() {
+		return // scrub anterior ainda em andamento
+	}
+	p := &scrubProgress{StartedAt: time.Now()}
+	p.FinishedAt.Store(time.Time{})
+	h.scrubs.Store(name, p)
+	defer func() { p.FinishedAt.Store(time.Now()) }()
+
+	logger := h.logger.With("storage", name)
+	logger.Info("scrubbing storage backups after degraded disk report")
+
+	_ = filepath.WalkDir(baseDir, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && (strings.HasPrefix(d.Name(), "chunks_") || d.Name() == quarantineDirName || d.Name() == dedup.PoolDirName) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !isBackupFile(d.Name()) {
+			return nil
+		}
+
+		var verr error
+		if dedup.IsManifest(path) {
+			store, err := h.dedupStore(baseDir)
+			if err != nil {
+				verr = err
+			} else {
+				verr = store.Verify(path)
+			}
+		} else {
+			verr = VerifyArchiveIntegrity(path, nil, nil)
+		}
+		p.Checked.Add(1)
+		if verr == nil {
+			return nil
+		}
+		if errors.Is(verr, os.ErrNotExist) {
+			return nil // removido pela rotação durante o scrub
+		}
+		p.Corrupt.Add(1)
+		logger.Error("scrub found a corrupt backup", "path", path, "error", verr)
+		if h.Events != nil {
+			h.Events.Push(observability.EventEntry{
+				Level:   "error",
+				Type:    "scrub_corrupt",
+				Storage: name,
+				Message: fmt.Sprintf("%s: backup %s failed verification: %v", name, filepath.Base(path), verr),
+			})
+		}
+		return nil
+	})
+
+	checked, corrupt := p.Checked.Load(), p.Corrupt.Load()
+	logger.Info("storage scrub finished", "checked", checked, "corrupt", corrupt,
+		"duration", time.Since(p.StartedAt).Round(time.Second))
+	if h.Events != nil {
+		level := "info"
+		if corrupt > 0 {
+			level = "error"
+		}
+		h.Events.Push(observability.EventEntry{
+			Level:   level,
+			Type:    "scrub_finished",
+			Storage: name,
+			Message: fmt.Sprintf("%s: scrub checked %d backups, %d corrupt", name, checked, corrupt),
+		})
+	}
+}
+
+// scrubOf retorna o último scrub do storage name (nil se nunca houve).
+func (h *Handler) scrubOf(name string) *scrubProgress {
+	raw, ok := h.scrubs.Load(name)
+	if !ok {
+		return nil
+	}
+	return raw.(*scrubProgress)
+}
+
+// diskHealthDTO monta o estado de saúde do disco do storage para a API de
+// observabilidade (nil se o storage não tem disk_health).
+func (h *Handler) diskHealthDTO(name string, si config.StorageInfo) *observability.DiskHealthDTO {
+	if !si.DiskHealth.Enabled() {
+		return nil
+	}
+	dto := &observability.DiskHealthDTO{
+		State:      DiskHealthUnknown,
+		OnDegraded: si.DiskHealth.OnDegraded,
+	}
+	if st, ok := h.diskHealthOf(name); ok {
+		dto.State = st.State
+		dto.Detail = st.Detail
+		dto.CheckedAt = st.CheckedAt.Format(time.RFC3339)
+		dto.Since = st.Since.Format(time.RFC3339)
+	}
+	dto.ReadOnly, _ = h.storageReadOnly(name, si)
+	dto.ForceVerify = h.storageForceVerify(name, si)
+	if p := h.scrubOf(name); p != nil {
+		scrub := &observability.ScrubDTO{
+			StartedAt: p.StartedAt.Format(time.RFC3339),
+			Checked:   p.Checked.Load(),
+			Corrupt:   p.Corrupt.Load(),
+			Running:   true,
+		}
+		if fin := p.FinishedAt.Load().(time.Time); !fin.IsZero() {
+			scrub.Running = false
+			scrub.FinishedAt = fin.Format(time.RFC3339)
+		}
+		dto.Scrub = scrub
+	}
+	return dto
+}
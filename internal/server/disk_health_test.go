@@ -0,0 +1,143 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+const smartctlATAOutput = `smartctl 7.3 2022-02-28 r5338 [x86_64-linux-6.1.0] (local build)
+=== START OF READ SMART DATA SECTION ===
+SMART overall-health self-assessment test result: PASSED
+
+ID# ATTRIBUTE_NAME          FLAG     VALUE WORST THRESH TYPE      UPDATED  WHEN_FAILED RAW_VALUE
+  5 Reallocated_Sector_Ct   0x0033   100   100   010    Pre-fail  Always       -       0
+197 Current_Pending_Sector  0x0012   100   100   000    Old_age   Always       -       %s
+198 Offline_Uncorrectable   0x0010   100   100   000    Old_age   Offline      -       0
+`
+
+func TestParseSmartctl(t *testing.T) {
+	tests := []struct {
+		name     string
+		exitCode int
+		out      string
+		want     string
+		detail   string
+	}{
+		{"healthy", 0, strings.Replace(smartctlATAOutput, "%s", "0", 1), DiskHealthOK, ""},
+		{"pending sectors", 0, strings.Replace(smartctlATAOutput, "%s", "8", 1), DiskHealthDegraded, "Current_Pending_Sector=8"},
+		{"disk failing", 1 << 3, "", DiskHealthFailing, ""},
+		{"prefail below threshold", 1 << 4, "", DiskHealthFailing, ""},
+		{"self-test errors", 1 << 7, strings.Replace(smartctlATAOutput, "%s", "0", 1), DiskHealthDegraded, "self-test"},
+		{"device open failed", 1 << 1, "Smartctl open device: /dev/sdz failed", DiskHealthUnknown, "/dev/sdz"},
+		{"nvme media errors", 0, "Media and Data Integrity Errors:    3\n", DiskHealthDegraded, "Media_and_Data_Integrity_Errors=3"},
+		{"nvme clean", 0, "Media and Data Integrity Errors:    0\n", DiskHealthOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, detail := parseSmartctl(tt.exitCode, tt.out)
+			if got != tt.want {
+				t.Errorf("state = %q, want %q (detail %q)", got, tt.want, detail)
+			}
+			if tt.detail != "" && !strings.Contains(detail, tt.detail) {
+				t.Errorf("detail %q does not contain %q", detail, tt.detail)
+			}
+		})
+	}
+}
+
+func TestRunDiskHealthProbe_Command(t *testing.T) {
+	for cmd, want := range map[string]string{
+		"echo fine":             DiskHealthOK,
+		"echo pending; exit 1":  DiskHealthDegraded,
+		"echo dying; exit 2":    DiskHealthFailing,
+		"echo confused; exit 7": DiskHealthUnknown,
+	} {
+		state, detail := runDiskHealthProbe(context.Background(), config.DiskHealthConfig{Command: cmd})
+		if state != want {
+			t.Errorf("%q: state = %q (detail %q), want %q", cmd, state, detail, want)
+		}
+	}
+
+	state, _ := runDiskHealthProbe(context.Background(), config.DiskHealthConfig{Device: "/dev/null", Smartctl: "/nonexistent/smartctl"})
+	if state != DiskHealthUnknown {
+		t.Errorf("missing smartctl: state = %q, want unknown", state)
+	}
+}
+
+func TestDiskHealth_ReadOnlyAndForceVerify(t *testing.T) {
+	verify := config.StorageInfo{BaseDir: t.TempDir(), DiskHealth: config.DiskHealthConfig{Command: "true", OnDegraded: config.DiskHealthActionVerify}}
+	readOnly := config.StorageInfo{BaseDir: t.TempDir(), DiskHealth: config.DiskHealthConfig{Command: "true", OnDegraded: config.DiskHealthActionReadOnly}}
+	h := newTestHandler(t, map[string]config.StorageInfo{"v": verify, "ro": readOnly})
+	ctx := context.Background()
+
+	// Sem probe ainda: nada bloqueia
+	if ro, _ := h.storageReadOnly("v", verify); ro {
+		t.Fatal("storage read-only before any probe")
+	}
+
+	h.recordDiskHealth(ctx, "v", verify, DiskHealthDegraded, "Current_Pending_Sector=1")
+	h.recordDiskHealth(ctx, "ro", readOnly, DiskHealthDegraded, "Current_Pending_Sector=1")
+	if ro, _ := h.storageReadOnly("v", verify); ro || !h.storageForceVerify("v", verify) {
+		t.Errorf("on_degraded verify: read_only=%v force_verify=%v", ro, h.storageForceVerify("v", verify))
+	}
+	if ro, _ := h.storageReadOnly("ro", readOnly); !ro || h.storageForceVerify("ro", readOnly) {
+		t.Errorf("on_degraded read_only: read_only=%v force_verify=%v", ro, h.storageForceVerify("ro", readOnly))
+	}
+
+	// failing é sempre somente leitura; unknown nunca bloqueia
+	h.recordDiskHealth(ctx, "v", verify, DiskHealthFailing, "")
+	if ro, st := h.storageReadOnly("v", verify); !ro || st.State != DiskHealthFailing {
+		t.Errorf("failing disk: read_only=%v state=%q", ro, st.State)
+	}
+	h.recordDiskHealth(ctx, "v", verify, DiskHealthUnknown, "probe failed")
+	if ro, _ := h.storageReadOnly("v", verify); ro || h.storageForceVerify("v", verify) {
+		t.Error("unknown disk health should not restrict backups")
+	}
+
+	dto := h.diskHealthDTO("ro", readOnly)
+	if dto == nil || dto.State != DiskHealthDegraded || !dto.ReadOnly {
+		t.Errorf("unexpected DTO: %+v", dto)
+	}
+	if h.diskHealthDTO("x", config.StorageInfo{}) != nil {
+		t.Error("expected nil DTO for storage without disk_health")
+	}
+}
+
+func TestScrubStorage_ReportsCorruptBackups(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "agent1", "daily")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	createTestTarGz(t, dir, "2026-01-01T00-00-00-000.tar.gz")
+	good := createTestTarGz(t, dir, "2026-01-02T00-00-00-000.tar.gz")
+	data, _ := os.ReadFile(good)
+	bad := filepath.Join(dir, "2026-01-03T00-00-00-000.tar.gz")
+	if err := os.WriteFile(bad, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestHandler(t, map[string]config.StorageInfo{"s": {BaseDir: base}})
+	h.scrubStorage(context.Background(), "s", base)
+
+	p := h.scrubOf("s")
+	if p == nil {
+		t.Fatal("no scrub recorded")
+	}
+	if p.Checked.Load() != 3 || p.Corrupt.Load() != 1 {
+		t.Errorf("checked=%d corrupt=%d, want 3/1", p.Checked.Load(), p.Corrupt.Load())
+	}
+	if p.FinishedAt.Load().(time.Time).IsZero() {
+		t.Error("scrub not marked as finished")
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// disk_queue.go coordena as escritas em disco das sessões de um storage
+// (storages.*.write_workers).
+//
+// Sem coordenação, cada sessão grava no seu ritmo e dezenas de agents
+// intercalam writes no mesmo disco. Com write_workers, no máximo N writes do
+// storage (flush do buffer de escrita, chunk de staging) executam ao mesmo
+// tempo; os demais aguardam na fila. Os fsyncs das sessões do storage
+// são agrupados: um syncfs atende todos os pedidos que chegaram enquanto o
+// anterior executava. As filas são atualizadas a cada reload, inclusive para
+// as sessões em andamento.
+
+package server
+
+import (
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// diskQueue limita os writes concorrentes de um storage e agrupa os fsyncs.
+type diskQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	workers int // writes simultâneos; 0 = sem limite
+	active  int // writes em execução
+
+	// Grupo de fsync: started/finished numeram os syncfs executados.
+	syncMu       sync.Mutex
+	syncCond     *sync.Cond
+	syncRunning  bool
+	syncStarted  uint64
+	syncFinished uint64
+	syncErr      error
+
+	queued    atomic.Int32 // writes aguardando um worker
+	writes    atomic.Int64
+	bytes     atomic.Int64
+	waitNs    atomic.Int64 // tempo acumulado na fila
+	syncs     atomic.Int64 // pedidos de fsync
+	syncCalls atomic.Int64 // syncfs executados
+}
+
+func newDiskQueue() *diskQueue {
+	q := &diskQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	q.syncCond = sync.NewCond(&q.syncMu)
+	return q
+}
+
+// setWorkers ajusta o limite de writes simultâneos (0 = sem limite).
+func (q *diskQueue) setWorkers(n int) {
+	q.mu.Lock()
+	q.workers = n
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// do executa fn, um write de n bytes, quando houver worker livre. É no-op
+// (executa direto) quando q é nil.
+func (q *diskQueue) do(n int, fn func() error) error {
+	if q == nil {
+		return fn()
+	}
+	start := time.Now()
+	q.mu.Lock()
+	if q.workers > 0 && q.active >= q.workers {
+		q.queued.Add(1)
+		for q.workers > 0 && q.active >= q.workers {
+			q.cond.Wait()
+		}
+		q.queued.Add(-1)
+	}
+	q.active++
+	q.mu.Unlock()
+	q.waitNs.Add(int64(time.Since(start)))
+
+	err := fn()
+
+	q.mu.Lock()
+	q.active--
+	q.mu.Unlock()
+	q.cond.Signal()
+	q.writes.Add(1)
+	q.bytes.Add(int64(n))
+	return err
+}
+
+// writer envolve w para que cada Write passe pela fila.
+func (q *diskQueue) writer(w io.Writer) io.Writer {
+	if q == nil {
+		return w
+	}
+	return &diskQueueWriter{q: q, w: w}
+}
+
+// fsync persiste f com um syncfs compartilhado: espera um syncfs iniciado
+// depois da chamada, executando-o se nenhum estiver em andamento. Os pedidos
+// que chegam durante um syncfs são atendidos juntos pelo seguinte. Sem fila
+// (q nil) ou sem syncfs (fora do Linux), é o fsync do próprio arquivo.
+func (q *diskQueue) fsync(f *os.File) error {
+	if q == nil || !syncfsSupported {
+		return syncFile(f)
+	}
+	q.syncs.Add(1)
+	q.syncMu.Lock()
+	defer q.syncMu.Unlock()
+	ticket := q.syncStarted + 1
+	for q.syncRunning {
+		q.syncCond.Wait()
+		if q.syncFinished >= ticket {
+			return q.syncErr
+		}
+	}
+	q.syncRunning = true
+	q.syncStarted++
+	gen := q.syncStarted
+	q.syncMu.Unlock()
+
+	err := syncfs(f)
+	q.syncCalls.Add(1)
+
+	q.syncMu.Lock()
+	q.syncRunning = false
+	q.syncFinished = gen
+	q.syncErr = err
+	q.syncCond.Broadcast()
+	return err
+}
+
+// stats retorna as métricas da fila do storage.
+func (q *diskQueue) stats(storage string) observability.DiskQueueDTO {
+	q.mu.Lock()
+	dto := observability.DiskQueueDTO{
+		Storage:  storage,
+		Workers:  q.workers,
+		InFlight: q.active,
+	}
+	q.mu.Unlock()
+	dto.Queued = q.queued.Load()
+	dto.Writes = q.writes.Load()
+	dto.Bytes = q.bytes.Load()
+	dto.WaitSeconds = time.Duration(q.waitNs.Load()).Seconds()
+	dto.Syncs = q.syncs.Load()
+	dto.SyncCalls = q.syncCalls.Load()
+	return dto
+}
+
+// diskQueueWriter é o io.Writer de uma sessão sobre a fila do storage.
+type diskQueueWriter struct {
+	q *diskQueue
+	w io.Writer
+}
+
+// Write implementa io.Writer.
+func (w *diskQueueWriter) Write(p []byte) (n int, err error) {
+	err = w.q.do(len(p), func() error {
+		n, err = w.w.Write(p)
+		return err
+	})
+	return n, err
+}
+
+// diskQueues agrupa as filas dos storages com write_workers.
+type diskQueues struct {
+	mu     sync.Mutex
+	queues map[string]*diskQueue
+}
+
+// newDiskQueues cria as filas a partir da config.
+func newDiskQueues(cfg *config.ServerConfig) *diskQueues {
+	d := &diskQueues{queues: make(map[string]*diskQueue)}
+	d.apply(cfg)
+	return d
+}
+
+// apply atualiza os limites (no start e a cada reload). Storages que deixam
+// de usar write_workers ficam sem limite, mas mantêm a fila (e as métricas)
+// para as sessões que já a referenciam.
+func (d *diskQueues) apply(cfg *config.ServerConfig) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for name, q := range d.queues {
+		if si, ok := cfg.Storages[name]; !ok || si.WriteWorkers == 0 {
+			q.setWorkers(0)
+		}
+	}
+	for name, si := range cfg.Storages {
+		if si.WriteWorkers == 0 {
+			continue
+		}
+		q, ok := d.queues[name]
+		if !ok {
+			q = newDiskQueue()
+			d.queues[name] = q
+		}
+		q.setWorkers(si.WriteWorkers)
+	}
+}
+
+// queue retorna a fila do storage, ou nil se ele não usa write_workers.
+func (d *diskQueues) queue(storage string) *diskQueue {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q, ok := d.queues[storage]
+	if !ok {
+		return nil
+	}
+	q.mu.Lock()
+	enabled := q.workers > 0
+	q.mu.Unlock()
+	if !enabled {
+		return nil
+	}
+	return q
+}
+
+// stats retorna as métricas das filas, ordenadas por storage.
+func (d *diskQueues) stats() []observability.DiskQueueDTO {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := make([]observability.DiskQueueDTO, 0, len(d.queues))
+	for name, q := range d.queues {
+		result = append(result, q.stats(name))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Storage < result[j].Storage })
+	return result
+}
@@ -0,0 +1,19 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// syncfsSupported indica que diskQueue.fsync pode agrupar pedidos num syncfs.
+const syncfsSupported = true
+
+// syncfs persiste o filesystem inteiro de f.
+func syncfs(f *os.File) error {
+	return unix.Syncfs(int(f.Fd()))
+}
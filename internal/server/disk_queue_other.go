@@ -0,0 +1,16 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+//go:build !linux
+
+package server
+
+import "os"
+
+// Fora do Linux não há syncfs: o fsync da fila de disco é o do próprio arquivo.
+const syncfsSupported = false
+
+func syncfs(f *os.File) error {
+	return f.Sync()
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestDiskQueue_LimitsConcurrentWrites(t *testing.T) {
+	disk := newDiskQueues(&config.ServerConfig{Storages: map[string]config.StorageInfo{
+		"default": {WriteWorkers: 2},
+		"fast":    {},
+	}})
+	if disk.queue("fast") != nil {
+		t.Fatal("expected no queue for storage without write_workers")
+	}
+	q := disk.queue("default")
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.do(1024, func() error {
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				running.Add(-1)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	if peak.Load() != 2 {
+		t.Errorf("expected at most 2 concurrent writes, peak was %d", peak.Load())
+	}
+	stats := disk.stats()
+	if len(stats) != 1 || stats[0].Writes != 8 || stats[0].Bytes != 8*1024 || stats[0].WaitSeconds <= 0 || stats[0].InFlight != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestDiskQueue_ReloadReleasesWaiters(t *testing.T) {
+	cfg := &config.ServerConfig{Storages: map[string]config.StorageInfo{"default": {WriteWorkers: 1}}}
+	disk := newDiskQueues(cfg)
+	q := disk.queue("default")
+
+	release := make(chan struct{})
+	go q.do(0, func() error { <-release; return nil })
+	for q.stats("default").InFlight == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		q.do(0, func() error { return nil })
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected second write to wait for the single worker")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Reload sem write_workers: a fila deixa de limitar as sessões em andamento
+	disk.apply(&config.ServerConfig{Storages: map[string]config.StorageInfo{"default": {}}})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected reload to release the waiting write")
+	}
+	close(release)
+
+	if disk.queue("default") != nil {
+		t.Error("expected no queue for new sessions after write_workers was removed")
+	}
+}
+
+func TestDiskQueue_BatchesFsync(t *testing.T) {
+	q := newDiskQueue()
+	q.setWorkers(4)
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := writeChunkFile(filepath.Join(dir, string(rune('a'+i))), []byte("chunk"), true, q); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := q.stats("default")
+	if stats.Syncs != 16 {
+		t.Errorf("expected 16 fsync requests, got %d", stats.Syncs)
+	}
+	if stats.SyncCalls < 1 || stats.SyncCalls > stats.Syncs {
+		t.Errorf("expected between 1 and %d syncfs calls, got %d", stats.Syncs, stats.SyncCalls)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 16 {
+		t.Errorf("expected 16 chunk files, got %d", len(entries))
+	}
+}
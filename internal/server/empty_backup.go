@@ -0,0 +1,87 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// writeEmptyArchive grava em path um archive sem entradas (apenas o
+// end-of-archive do tar) no formato da extensão (.tar.gz ou .tar.zst).
+// O arquivo resultante continua restaurável com tar.
+func writeEmptyArchive(path, fileExtension string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return fmt.Errorf("opening empty archive: %w", err)
+	}
+	defer f.Close()
+
+	var compressor io.WriteCloser
+	if strings.HasSuffix(fileExtension, ".zst") {
+		compressor, err = zstd.NewWriter(f)
+		if err != nil {
+			return fmt.Errorf("creating zstd writer: %w", err)
+		}
+	} else {
+		compressor = gzip.NewWriter(f)
+	}
+	if err := tar.NewWriter(compressor).Close(); err != nil {
+		compressor.Close()
+		return fmt.Errorf("writing empty tar: %w", err)
+	}
+	if err := compressor.Close(); err != nil {
+		return fmt.Errorf("closing empty archive: %w", err)
+	}
+	return f.Close()
+}
+
+// commitEmptyBackup comita um backup vazio (Trailer com Size 0): grava um
+// archive sem entradas no lugar do payload e faz o rename atômico. Backups
+// vazios não passam pela verificação de integridade nem disparam rotação ou
+// uploads pós-commit — um agent cujos sources sumiram não deve apagar backups
+// anteriores com conteúdo.
+func (h *Handler) commitEmptyBackup(conn net.Conn, writer *AtomicWriter, storageInfo config.StorageInfo, tmpPath, lockKey string, logger *slog.Logger) string {
+	if err := writeEmptyArchive(tmpPath, writer.fileExtension); err != nil {
+		logger.Error("writing empty archive", "error", err)
+		writer.Abort(tmpPath)
+		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
+		return "write_error"
+	}
+	finalPath, err := writer.Commit(tmpPath)
+	if err != nil {
+		logger.Error("committing backup", "error", err)
+		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
+		return "write_error"
+	}
+	h.auditCommit(lockKey, finalPath, "empty archive")
+	if storageInfo.Immutable.Enabled {
+		if sum, err := hashFile(finalPath); err != nil {
+			logger.Error("hashing empty backup for the ledger", "error", err)
+		} else {
+			h.sealBackup(storageInfo, writer.AgentName(), finalPath, sum, logger)
+		}
+	}
+
+	logger.Warn("empty backup committed (sources produced no entries), skipping rotation", "path", finalPath)
+	if h.Events != nil {
+		h.Events.PushEvent("warn", "backup_empty", writer.AgentName(),
+			fmt.Sprintf("%s: sources produced no entries, committed empty archive %s", writer.backupName, filepath.Base(finalPath)), 0)
+	}
+	protocol.WriteFinalACK(conn, protocol.FinalStatusOK)
+	return "ok"
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// commitSingleTrailerOnly simula uma sessão single-stream cujo payload é
+// apenas o trailer informado e retorna o resultado e o FinalACK recebido.
+func commitSingleTrailerOnly(t *testing.T, writer *AtomicWriter, si config.StorageInfo, checksum [32]byte, size uint64) (string, byte) {
+	t.Helper()
+	tmpFile, tmpPath, err := writer.TempFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protocol.WriteTrailer(tmpFile, checksum, size); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	h := &Handler{cfg: &config.ServerConfig{}, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	resultCh := make(chan string, 1)
+	go func() {
+		result, _ := h.validateAndCommitSingle(serverConn, writer, tmpPath, 4+32+8, nil, si, nil, "", h.logger)
+		resultCh <- result
+		serverConn.Close()
+	}()
+	ack, err := protocol.ReadFinalACK(clientConn)
+	if err != nil {
+		t.Fatalf("ReadFinalACK: %v", err)
+	}
+	return <-resultCh, ack.Status
+}
+
+func TestValidateAndCommitSingle_EmptyBackup(t *testing.T) {
+	baseDir := t.TempDir()
+	writer, err := NewAtomicWriter(baseDir, "web-01", "app", ".tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Backups anteriores com conteúdo: não podem ser rotacionados por um backup vazio.
+	for _, name := range []string{"2026-01-01T00-00-00-000.tar.gz", "2026-01-02T00-00-00-000.tar.gz"} {
+		os.WriteFile(filepath.Join(writer.AgentDir(), name), []byte("data"), 0644)
+	}
+	si := config.StorageInfo{BaseDir: baseDir, MaxBackups: 1, VerifyIntegrity: true}
+
+	result, status := commitSingleTrailerOnly(t, writer, si, protocol.EmptyChecksum, 0)
+	if result != "ok" || status != protocol.FinalStatusOK {
+		t.Fatalf("expected empty backup to be committed, got %s/%d", result, status)
+	}
+
+	entries, _ := os.ReadDir(writer.AgentDir())
+	var backups []string
+	for _, e := range entries {
+		if isBackupFile(e.Name()) {
+			backups = append(backups, e.Name())
+		}
+	}
+	if len(backups) != 3 {
+		t.Fatalf("expected empty backup committed without rotation, got %v", backups)
+	}
+
+	// O archive vazio é um tar.gz válido sem entradas.
+	f, err := os.Open(filepath.Join(writer.AgentDir(), backups[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("empty archive is not valid gzip: %v", err)
+	}
+	if _, err := tar.NewReader(gz).Next(); err != io.EOF {
+		t.Fatalf("expected tar with no entries, got %v", err)
+	}
+}
+
+func TestValidateAndCommitSingle_NoDataWithNonEmptyTrailer(t *testing.T) {
+	baseDir := t.TempDir()
+	writer, err := NewAtomicWriter(baseDir, "web-01", "app", ".tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Checksum de payload vazio, mas o agent declara 1024 bytes: não é backup vazio.
+	result, status := commitSingleTrailerOnly(t, writer, config.StorageInfo{BaseDir: baseDir}, protocol.EmptyChecksum, 1024)
+	if result != "write_error" || status != protocol.FinalStatusWriteError {
+		t.Fatalf("expected write_error, got %s/%d", result, status)
+	}
+	entries, _ := os.ReadDir(writer.AgentDir())
+	for _, e := range entries {
+		if isBackupFile(e.Name()) || strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("unexpected file left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestWriteEmptyArchive_Zstd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.tar.zst")
+	os.WriteFile(path, []byte("leftover payload"), 0644)
+	if err := writeEmptyArchive(path, ".tar.zst"); err != nil {
+		t.Fatalf("writeEmptyArchive: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if _, err := tar.NewReader(zr).Next(); err != io.EOF {
+		t.Fatalf("expected zstd tar with no entries, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+)
+
+// enrollConnTimeout limita a duração de uma conexão de enrollment.
+const enrollConnTimeout = 30 * time.Second
+
+// enrollMaxRequestSize limita o tamanho do EnrollRequest (token + CSR PEM).
+const enrollMaxRequestSize = 64 * 1024
+
+// enrollTLSConfig retorna a configuração TLS do listener de enrollment: o
+// agent ainda não tem certificado, portanto não há mTLS. O server apresenta
+// o certificado vigente seguido da CA, permitindo que o agent fixe a CA pelo
+// fingerprint quando ainda não possui tls.ca_cert.
+func enrollTLSConfig(cfg *config.ServerConfig, certReloader *pki.CertReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert := certReloader.Certificate()
+			ca, err := pki.LoadCA(cfg.TLS.CACert, cfg.Enrollment.CAKey)
+			if err != nil {
+				return nil, err
+			}
+			chain := *cert
+			chain.Certificate = append(append([][]byte(nil), cert.Certificate...), ca.Cert.Raw)
+			return &chain, nil
+		},
+	}
+}
+
+// startEnrollment abre o listener de enrollment em background. Retorna erro
+// apenas se o listen falhar.
+func startEnrollment(ctx context.Context, cfg *config.ServerConfig, handler *Handler, certReloader *pki.CertReloader, logger *slog.Logger) error {
+	logger = logger.With("component", "enrollment")
+	ln, err := tls.Listen("tcp", cfg.Enrollment.Listen, enrollTLSConfig(cfg, certReloader))
+	if err != nil {
+		return fmt.Errorf("enrollment listen on %s: %w", cfg.Enrollment.Listen, err)
+	}
+	logger.Info("enrollment listening", "address", cfg.Enrollment.Listen)
+	go serveEnrollment(ctx, ln, cfg, handler, logger)
+	return nil
+}
+
+// serveEnrollment aceita conexões de enrollment até o context ser cancelado.
+func serveEnrollment(ctx context.Context, ln net.Listener, cfg *config.ServerConfig, handler *Handler, logger *slog.Logger) {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Error("accepting enrollment connection", "error", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go handler.handleEnroll(conn, cfg, logger)
+	}
+}
+
+// handleEnroll processa um EnrollRequest: consome o token (uso único) e
+// assina o CSR com CN = agent ao qual o token foi emitido.
+func (h *Handler) handleEnroll(conn net.Conn, cfg *config.ServerConfig, logger *slog.Logger) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(enrollConnTimeout))
+	remote := conn.RemoteAddr().String()
+
+	resp := h.processEnroll(conn, cfg, logger.With("remote", remote))
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		logger.Warn("writing enrollment response", "remote", remote, "error", err)
+	}
+}
+
+func (h *Handler) processEnroll(r io.Reader, cfg *config.ServerConfig, logger *slog.Logger) pki.EnrollResponse {
+	var req pki.EnrollRequest
+	if err := json.NewDecoder(io.LimitReader(r, enrollMaxRequestSize)).Decode(&req); err != nil {
+		logger.Warn("invalid enrollment request", "error", err)
+		return pki.EnrollResponse{Error: "invalid request"}
+	}
+
+	agent, err := pki.ConsumeEnrollToken(cfg.Enrollment.TokensFile, req.Token)
+	if err != nil {
+		logger.Warn("enrollment rejected", "error", err)
+		if errors.Is(err, pki.ErrInvalidEnrollToken) {
+			return pki.EnrollResponse{Error: err.Error()}
+		}
+		return pki.EnrollResponse{Error: "internal error"}
+	}
+
+	ca, err := pki.LoadCA(cfg.TLS.CACert, cfg.Enrollment.CAKey)
+	if err != nil {
+		logger.Error("enrollment: loading CA", "agent", agent, "error", err)
+		return pki.EnrollResponse{Error: "internal error"}
+	}
+	certPEM, err := ca.SignClientCSR([]byte(req.CSR), agent, cfg.Enrollment.CertValidity)
+	if err != nil {
+		// O token já foi consumido: um CSR inválido exige novo token.
+		logger.Warn("enrollment: CSR rejected", "agent", agent, "error", err)
+		return pki.EnrollResponse{Error: err.Error()}
+	}
+
+	logger.Info("agent enrolled", "agent", agent, "valid_for", cfg.Enrollment.CertValidity.String())
+	if h.Events != nil {
+		h.Events.PushEvent("info", "agent_enrolled", agent,
+			fmt.Sprintf("client certificate issued (valid for %s)", cfg.Enrollment.CertValidity), 0)
+	}
+	return pki.EnrollResponse{Certificate: string(certPEM), CA: string(ca.CertPEM)}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+)
+
+// setupEnrollPKI cria CA + certificado do server com a PKI embutida e
+// retorna uma ServerConfig com enrollment habilitado.
+func setupEnrollPKI(t *testing.T) (*config.ServerConfig, string) {
+	t.Helper()
+	dir := t.TempDir()
+	caPEM, caKeyPEM, err := pki.GenerateCA("Enroll Test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPath := filepath.Join(dir, "ca.pem")
+	caKeyPath := filepath.Join(dir, "ca-key.pem")
+	os.WriteFile(caPath, caPEM, 0644)
+	os.WriteFile(caKeyPath, caKeyPEM, 0600)
+
+	ca, err := pki.LoadCA(caPath, caKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, err := ca.IssueServerCert([]string{"127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, "server.pem")
+	keyPath := filepath.Join(dir, "server-key.pem")
+	os.WriteFile(certPath, certPEM, 0644)
+	os.WriteFile(keyPath, keyPEM, 0600)
+
+	cfg := &config.ServerConfig{
+		TLS: config.TLSServer{CACert: caPath, ServerCert: certPath, ServerKey: keyPath},
+		Enrollment: config.EnrollmentConfig{
+			Enabled:      true,
+			CAKey:        caKeyPath,
+			TokensFile:   filepath.Join(dir, "tokens.json"),
+			CertValidity: time.Hour,
+		},
+	}
+	return cfg, pki.Fingerprint(ca.Cert)
+}
+
+func enrollRoundTrip(t *testing.T, addr string, tlsCfg *tls.Config, req pki.EnrollRequest) pki.EnrollResponse {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, tlsCfg)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	var resp pki.EnrollResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return resp
+}
+
+func TestEnrollment_IssuesCertificateForTokenAgent(t *testing.T) {
+	cfg, fingerprint := setupEnrollPKI(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	reloader, err := pki.NewCertReloader(cfg.TLS.CACert, cfg.TLS.ServerCert, cfg.TLS.ServerKey, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", enrollTLSConfig(cfg, reloader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serveEnrollment(ctx, ln, cfg, &Handler{cfg: cfg, logger: logger}, logger)
+
+	token, err := pki.CreateEnrollToken(cfg.Enrollment.TokensFile, "web-01", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, csrPEM, err := pki.NewClientCSR("web-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sem CA local: o agent fixa a CA pelo fingerprint apresentado na cadeia.
+	clientCfg := pki.PinnedCAConfig("127.0.0.1", fingerprint)
+	resp := enrollRoundTrip(t, ln.Addr().String(), clientCfg, pki.EnrollRequest{Token: token, CSR: string(csrPEM)})
+	if resp.Error != "" {
+		t.Fatalf("enrollment failed: %s", resp.Error)
+	}
+	pair, err := tls.X509KeyPair([]byte(resp.Certificate), keyPEM)
+	if err != nil {
+		t.Fatalf("issued certificate does not match key: %v", err)
+	}
+	if pair.Leaf.Subject.CommonName != "web-01" {
+		t.Errorf("expected CN web-01, got %q", pair.Leaf.Subject.CommonName)
+	}
+
+	// Token é de uso único.
+	resp = enrollRoundTrip(t, ln.Addr().String(), clientCfg, pki.EnrollRequest{Token: token, CSR: string(csrPEM)})
+	if resp.Error == "" {
+		t.Fatal("expected reused token to be rejected")
+	}
+
+	// CSR com CN diferente do agent do token é recusado.
+	token, _ = pki.CreateEnrollToken(cfg.Enrollment.TokensFile, "web-02", time.Hour)
+	resp = enrollRoundTrip(t, ln.Addr().String(), clientCfg, pki.EnrollRequest{Token: token, CSR: string(csrPEM)})
+	if resp.Error == "" || resp.Certificate != "" {
+		t.Fatal("expected CSR for a different agent to be rejected")
+	}
+}
+
+func TestEnrollment_WrongFingerprintRejected(t *testing.T) {
+	cfg, _ := setupEnrollPKI(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	reloader, err := pki.NewCertReloader(cfg.TLS.CACert, cfg.TLS.ServerCert, cfg.TLS.ServerKey, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", enrollTLSConfig(cfg, reloader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serveEnrollment(ctx, ln, cfg, &Handler{cfg: cfg, logger: logger}, logger)
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), pki.PinnedCAConfig("127.0.0.1", "sha256:00"))
+	if err == nil {
+		conn.Close()
+		t.Fatal("expected handshake to fail with a non-matching CA fingerprint")
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// ExportManifestName é o índice de uma mídia exportada, na raiz do destino.
+const ExportManifestName = "nbackup-export.json"
+
+// exportManifestVersion é a versão atual do formato de ExportManifest.
+const exportManifestVersion = 1
+
+// backupTimeLayout é o prefixo de data do nome de um backup (ver
+// AtomicWriter.Commit), em UTC.
+const backupTimeLayout = "2006-01-02T15-04-05"
+
+// ExportManifest descreve os backups de uma mídia exportada: as entradas do
+// catálogo e o SHA-256 de cada arquivo, conferidos pelo import.
+type ExportManifest struct {
+	Version   int           `json:"version"`
+	Storage   string        `json:"storage"`    // storage de origem
+	UpdatedAt string        `json:"updated_at"` // último export na mídia
+	Backups   []ExportEntry `json:"backups"`
+}
+
+// ExportEntry é um backup exportado.
+type ExportEntry struct {
+	Agent       string       `json:"agent"`
+	Backup      string       `json:"backup"`
+	File        string       `json:"file"` // nome do backup, como no catálogo
+	CommittedAt string       `json:"committed_at"`
+	Archive     ExportFile   `json:"archive"`
+	Sidecars    []ExportFile `json:"sidecars,omitempty"` // manifest de arquivos e índice de membros
+}
+
+// ExportFile é um arquivo na mídia.
+type ExportFile struct {
+	Path   string `json:"path"` // relativo à raiz da mídia, com "/"
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Resultados de ExportBackups e ImportBackups por backup.
+const (
+	TransferCopied  = "copied"  // copiado e verificado
+	TransferSkipped = "skipped" // já presente no destino
+	TransferFailed  = "failed"
+)
+
+// TransferResult é o resultado de um backup no export ou no import.
+type TransferResult struct {
+	Entry  ExportEntry
+	Status string
+	Err    error
+}
+
+// backupCommitTime extrai a data do commit do nome de um backup.
+func backupCommitTime(name string) (time.Time, bool) {
+	if len(name) < len(backupTimeLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(backupTimeLayout, name[:len(backupTimeLayout)])
+	return t, err == nil
+}
+
+// ExportBackups copia para o diretório to os backups do storage si
+// commitados a partir de since (zero = todos), com os sidecars, e grava
+// ExportManifestName. Cada cópia é relida da mídia e conferida contra o
+// SHA-256 da origem. Uma mídia que já tem um export do mesmo storage é
+// complementada: backups já presentes são pulados.
+func ExportBackups(si config.StorageInfo, storage string, since time.Time, to string) ([]TransferResult, error) {
+	if si.IsDedup() {
+		return nil, errors.New("export of dedup storages is not supported (use nbackup-server dedup cat)")
+	}
+	if err := os.MkdirAll(to, 0755); err != nil {
+		return nil, fmt.Errorf("creating destination: %w", err)
+	}
+	m, err := readExportManifest(to)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		m = &ExportManifest{Version: exportManifestVersion, Storage: storage}
+	case err != nil:
+		return nil, err
+	case m.Storage != storage:
+		return nil, fmt.Errorf("%s already holds an export of storage %q", to, m.Storage)
+	}
+	present := make(map[string]bool, len(m.Backups))
+	for _, e := range m.Backups {
+		present[e.Archive.Path] = true
+	}
+
+	var results []TransferResult
+	for _, agent := range listSubdirs(si.BaseDir) {
+		for _, backup := range listSubdirs(filepath.Join(si.BaseDir, agent)) {
+			agentDir := filepath.Join(si.BaseDir, agent, backup)
+			files, err := listBackups(agentDir)
+			if err != nil {
+				return results, fmt.Errorf("listing %s/%s: %w", agent, backup, err)
+			}
+			for _, f := range files {
+				committed, ok := backupCommitTime(f.Name)
+				if !ok || committed.Before(since) {
+					continue
+				}
+				entry := ExportEntry{
+					Agent:       agent,
+					Backup:      backup,
+					File:        f.Name,
+					CommittedAt: committed.Format(time.RFC3339),
+					Archive:     ExportFile{Path: path.Join(agent, backup, f.Name)},
+				}
+				if present[entry.Archive.Path] {
+					results = append(results, TransferResult{Entry: entry, Status: TransferSkipped})
+					continue
+				}
+				entry, err := exportBackup(filepath.Join(agentDir, f.Rel), to, entry)
+				if err != nil {
+					results = append(results, TransferResult{Entry: entry, Status: TransferFailed, Err: err})
+					continue
+				}
+				m.Backups = append(m.Backups, entry)
+				results = append(results, TransferResult{Entry: entry, Status: TransferCopied})
+			}
+		}
+	}
+
+	sort.Slice(m.Backups, func(i, j int) bool { return m.Backups[i].Archive.Path < m.Backups[j].Archive.Path })
+	m.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := writeExportManifest(to, m); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// exportBackup copia o backup em src e seus sidecars para a mídia em to.
+func exportBackup(src, to string, entry ExportEntry) (ExportEntry, error) {
+	var err error
+	entry.Archive, err = exportFile(src, to, entry.Archive.Path)
+	if err != nil {
+		return entry, err
+	}
+	for _, p := range backupFiles(src)[1:] {
+		sc, err := exportFile(p, to, path.Join(path.Dir(entry.Archive.Path), filepath.Base(p)))
+		if err != nil {
+			return entry, err
+		}
+		entry.Sidecars = append(entry.Sidecars, sc)
+	}
+	return entry, nil
+}
+
+// exportFile copia src para rel na mídia e confere a cópia relida.
+func exportFile(src, to, rel string) (ExportFile, error) {
+	dst := filepath.Join(to, filepath.FromSlash(rel))
+	size, sum, err := copyFileHashed(src, dst)
+	if err != nil {
+		return ExportFile{}, err
+	}
+	written, err := hashFile(dst)
+	if err != nil {
+		return ExportFile{}, err
+	}
+	if written != sum {
+		os.Remove(dst)
+		return ExportFile{}, fmt.Errorf("%s: verification after write failed (sha256 %x, source %x)", rel, written, sum)
+	}
+	return ExportFile{Path: rel, Size: size, SHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+// ImportBackups copia para o storage si os backups de uma mídia gerada por
+// ExportBackups. Cada arquivo é conferido contra o SHA-256 do manifest
+// durante a cópia; backups que já existem no storage são pulados. Os
+// backups vão para os diretórios de data do layout do storage.
+func ImportBackups(si config.StorageInfo, from string) ([]TransferResult, error) {
+	switch {
+	case si.IsDedup():
+		return nil, errors.New("import into dedup storages is not supported")
+	case si.Immutable.Enabled:
+		// O ledger pertence ao server em execução
+		return nil, errors.New("import into immutable storages is not supported")
+	}
+	m, err := readExportManifest(from)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []TransferResult
+	for _, entry := range m.Backups {
+		status, err := importBackup(si, from, entry)
+		results = append(results, TransferResult{Entry: entry, Status: status, Err: err})
+	}
+	return results, nil
+}
+
+// importBackup importa um backup da mídia em from.
+func importBackup(si config.StorageInfo, from string, entry ExportEntry) (string, error) {
+	// A mídia não é confiável: nomes e caminhos são validados como os do handshake
+	for _, c := range []struct{ name, field string }{{entry.Agent, "agent"}, {entry.Backup, "backup"}, {entry.File, "file"}} {
+		if err := validatePathComponent(c.name, c.field); err != nil {
+			return TransferFailed, err
+		}
+	}
+	committed, ok := backupCommitTime(entry.File)
+	if !isBackupFile(entry.File) || !ok {
+		return TransferFailed, fmt.Errorf("file %q is not a backup file", entry.File)
+	}
+
+	agentDir := filepath.Join(si.BaseDir, entry.Agent, entry.Backup)
+	if _, exists := findBackup(agentDir, entry.File); exists {
+		return TransferSkipped, nil
+	}
+	finalDir := filepath.Join(agentDir, filepath.FromSlash(si.LayoutRaw.Dir(committed)))
+	if err := validatePathInBaseDir(si.BaseDir, finalDir); err != nil {
+		return TransferFailed, err
+	}
+	if err := os.MkdirAll(finalDir, 0755); err != nil {
+		return TransferFailed, fmt.Errorf("creating backup directory: %w", err)
+	}
+
+	// Sidecars antes do archive: o backup só aparece no catálogo completo
+	for _, sc := range entry.Sidecars {
+		name := path.Base(sc.Path)
+		if name != fileManifestPath(entry.File) && name != archiveIndexPath(entry.File) {
+			return TransferFailed, fmt.Errorf("sidecar %q does not belong to %s", sc.Path, entry.File)
+		}
+		if err := importFile(from, sc, filepath.Join(finalDir, name)); err != nil {
+			return TransferFailed, err
+		}
+	}
+	if path.Base(entry.Archive.Path) != entry.File {
+		return TransferFailed, fmt.Errorf("archive %q does not match file %s", entry.Archive.Path, entry.File)
+	}
+	if err := importFile(from, entry.Archive, filepath.Join(finalDir, entry.File)); err != nil {
+		return TransferFailed, err
+	}
+	return TransferCopied, nil
+}
+
+// importFile copia f da mídia para dst, conferindo tamanho e SHA-256.
+func importFile(from string, f ExportFile, dst string) error {
+	src := filepath.Join(from, filepath.FromSlash(path.Clean("/"+f.Path)))
+	tmp := dst + ".import.tmp"
+	size, sum, err := copyFileHashed(src, tmp)
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(sum[:]); size != f.Size || got != f.SHA256 {
+		os.Remove(tmp)
+		return fmt.Errorf("%s: integrity check failed (size %d sha256 %s, manifest %d %s)", f.Path, size, got, f.Size, f.SHA256)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("renaming %s: %w", filepath.Base(dst), err)
+	}
+	return nil
+}
+
+// copyFileHashed copia src para dst (criando os diretórios), faz fsync e
+// retorna o tamanho e o SHA-256 do conteúdo copiado.
+func copyFileHashed(src, dst string) (int64, [32]byte, error) {
+	var sum [32]byte
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, sum, err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, sum, err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, sum, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, h), in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return 0, sum, fmt.Errorf("copying %s: %w", filepath.Base(src), err)
+	}
+	copy(sum[:], h.Sum(nil))
+	return size, sum, nil
+}
+
+// readExportManifest lê o ExportManifestName de dir.
+func readExportManifest(dir string) (*ExportManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ExportManifestName))
+	if err != nil {
+		return nil, err
+	}
+	var m ExportManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", ExportManifestName, err)
+	}
+	if m.Version != exportManifestVersion {
+		return nil, fmt.Errorf("%s: unsupported version %d", ExportManifestName, m.Version)
+	}
+	return &m, nil
+}
+
+// writeExportManifest grava m em dir de forma atômica.
+func writeExportManifest(dir string, m *ExportManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, ExportManifestName+".tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", ExportManifestName, err)
+	}
+	f, err := os.Open(tmp)
+	if err == nil {
+		err = f.Sync()
+		f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("syncing %s: %w", ExportManifestName, err)
+	}
+	return os.Rename(tmp, filepath.Join(dir, ExportManifestName))
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
+)
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	src := config.StorageInfo{BaseDir: t.TempDir()}
+	agentDir := filepath.Join(src.BaseDir, "web-01", "app")
+	os.MkdirAll(agentDir, 0755)
+	os.WriteFile(filepath.Join(agentDir, "2026-03-01T02-00-00-000.tar.gz"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(agentDir, "2026-03-07T02-00-00-000.tar.gz"), []byte("new"), 0644)
+	os.WriteFile(filepath.Join(agentDir, "2026-03-07T02-00-00-000.tar.gz"+manifest.Suffix), []byte("files"), 0644)
+
+	media := t.TempDir()
+	since := time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)
+	results, err := ExportBackups(src, "scripts", since, media)
+	if err != nil {
+		t.Fatalf("ExportBackups: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != TransferCopied || len(results[0].Entry.Sidecars) != 1 {
+		t.Fatalf("unexpected export results: %+v", results)
+	}
+
+	// Segundo export na mesma mídia complementa e pula o que já existe
+	results, err = ExportBackups(src, "scripts", time.Time{}, media)
+	if err != nil {
+		t.Fatalf("ExportBackups (again): %v", err)
+	}
+	if len(results) != 2 || results[0].Status != TransferCopied || results[1].Status != TransferSkipped {
+		t.Fatalf("unexpected second export results: %+v", results)
+	}
+	if _, err := ExportBackups(src, "other", time.Time{}, media); err == nil {
+		t.Error("expected error exporting another storage to the same media")
+	}
+
+	layout, _ := config.ParseStorageLayout("{agent}/{backup}/{year}/{month}/{timestamp}.tar.{ext}")
+	dst := config.StorageInfo{BaseDir: t.TempDir(), LayoutRaw: layout}
+	results, err = ImportBackups(dst, media)
+	if err != nil {
+		t.Fatalf("ImportBackups: %v", err)
+	}
+	for _, r := range results {
+		if r.Status != TransferCopied {
+			t.Fatalf("unexpected import result: %+v", r)
+		}
+	}
+	imported := filepath.Join(dst.BaseDir, "web-01", "app", "2026", "03", "2026-03-07T02-00-00-000.tar.gz")
+	if data, _ := os.ReadFile(imported); string(data) != "new" {
+		t.Errorf("unexpected imported archive: %q", data)
+	}
+	if !fileExists(imported + manifest.Suffix) {
+		t.Error("expected sidecar imported next to the archive")
+	}
+
+	results, _ = ImportBackups(dst, media)
+	if len(results) != 2 || results[0].Status != TransferSkipped {
+		t.Fatalf("expected re-import to skip existing backups: %+v", results)
+	}
+}
+
+func TestImport_RejectsCorruptedMedia(t *testing.T) {
+	src := config.StorageInfo{BaseDir: t.TempDir()}
+	agentDir := filepath.Join(src.BaseDir, "web-01", "app")
+	os.MkdirAll(agentDir, 0755)
+	os.WriteFile(filepath.Join(agentDir, "2026-03-07T02-00-00-000.tar.gz"), []byte("data"), 0644)
+
+	media := t.TempDir()
+	if _, err := ExportBackups(src, "scripts", time.Time{}, media); err != nil {
+		t.Fatalf("ExportBackups: %v", err)
+	}
+	os.WriteFile(filepath.Join(media, "web-01", "app", "2026-03-07T02-00-00-000.tar.gz"), []byte("DATA"), 0644)
+
+	dst := config.StorageInfo{BaseDir: t.TempDir()}
+	results, err := ImportBackups(dst, media)
+	if err != nil {
+		t.Fatalf("ImportBackups: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != TransferFailed {
+		t.Fatalf("expected integrity failure, got %+v", results)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dst.BaseDir, "web-01", "app")); len(entries) != 0 {
+		t.Errorf("expected nothing left in the storage, got %d entries", len(entries))
+	}
+}
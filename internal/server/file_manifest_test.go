@@ -0,0 +1,88 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func TestValidateAndCommitSingle_FileManifest(t *testing.T) {
+	baseDir := t.TempDir()
+	writer, err := NewAtomicWriter(baseDir, "web-01", "app", ".tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := os.ReadFile(createTestTarGz(t, t.TempDir(), "src.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfData := []byte("manifest bytes")
+
+	// Stream single-stream: archive + frame Manifest + trailer
+	tmpFile, tmpPath, err := writer.TempFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Write(archive)
+	protocol.WriteManifest(tmpFile, bytes.NewReader(mfData), int64(len(mfData)))
+	protocol.WriteTrailer(tmpFile, sha256.Sum256(archive), uint64(len(archive)))
+	fi, _ := tmpFile.Stat()
+	tmpFile.Close()
+
+	h := &Handler{cfg: &config.ServerConfig{}, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	resultCh := make(chan string, 1)
+	go func() {
+		result, _ := h.validateAndCommitSingle(serverConn, writer, tmpPath, fi.Size(), nil, config.StorageInfo{BaseDir: baseDir}, nil, "", h.logger)
+		resultCh <- result
+		serverConn.Close()
+	}()
+	ack, err := protocol.ReadFinalACK(clientConn)
+	if err != nil {
+		t.Fatalf("ReadFinalACK: %v", err)
+	}
+	if result := <-resultCh; result != "ok" || ack.Status != protocol.FinalStatusOK {
+		t.Fatalf("expected commit, got %s/%d", result, ack.Status)
+	}
+
+	backup := latestBackup(writer.AgentDir())
+	finalPath := filepath.Join(writer.AgentDir(), backup)
+	if got, _ := os.ReadFile(finalPath); !bytes.Equal(got, archive) {
+		t.Error("committed archive must not carry the manifest frame")
+	}
+	if got, err := os.ReadFile(finalPath + manifest.Suffix); err != nil || !bytes.Equal(got, mfData) {
+		t.Errorf("manifest sidecar: %q, %v", got, err)
+	}
+
+	// A rotação remove o manifest junto com o archive
+	os.WriteFile(filepath.Join(writer.AgentDir(), "2999-01-01T00-00-00-000.tar.gz"), archive, 0644)
+	if removed, err := Rotate(writer.AgentDir(), 1); err != nil || len(removed) != 1 || removed[0] != backup {
+		t.Fatalf("Rotate: removed=%v err=%v", removed, err)
+	}
+	if _, err := os.Stat(finalPath + manifest.Suffix); !os.IsNotExist(err) {
+		t.Error("manifest sidecar not removed with the rotated backup")
+	}
+}
+
+func TestFileManifestPath(t *testing.T) {
+	if got := fileManifestPath("/d/2026-01-01T00-00-00-000.tar.gz.dedup"); got != "/d/2026-01-01T00-00-00-000.tar.gz"+manifest.Suffix {
+		t.Errorf("dedup backup: %s", got)
+	}
+	if got := fileManifestPath("/d/x.tar.zst"); got != "/d/x.tar.zst"+manifest.Suffix {
+		t.Errorf("archive: %s", got)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"path/filepath"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// FsckStateFiles verifica (e, com repair, repara) os arquivos de estado do
+// server habilitados na config: os históricos JSONL da WebUI e dos restore
+// drills, os tokens de enrollment, as sessões persistidas, a contabilidade de
+// ingestão e o índice do audit log (os arquivos do audit log não são
+// reparados: o índice aponta para offsets neles). O reparo deve ser feito com
+// o daemon parado — ele mantém os históricos abertos para append.
+func FsckStateFiles(cfg *config.ServerConfig, repair bool) []statefile.Result {
+	type target struct{ kind, path string }
+	var targets []target
+	if cfg.WebUI.Enabled {
+		targets = append(targets,
+			target{"events", cfg.WebUI.EventsFile},
+			target{"session-history", cfg.WebUI.SessionHistoryFile},
+			target{"active-sessions", cfg.WebUI.ActiveSessionsFile},
+			target{"bucket-uploads", cfg.WebUI.BucketUploadFile},
+		)
+	}
+	if cfg.Enrollment.Enabled {
+		targets = append(targets, target{"enroll-tokens", cfg.Enrollment.TokensFile})
+	}
+	if cfg.RestoreDrills.Enabled {
+		targets = append(targets, target{"restore-drills", cfg.RestoreDrills.ResultsFile})
+	}
+	if cfg.Server.SessionsFile != "" {
+		targets = append(targets, target{"sessions", cfg.Server.SessionsFile})
+	}
+	if cfg.Accounting.Enabled {
+		targets = append(targets, target{"accounting", cfg.Accounting.File})
+	}
+	if cfg.AuditLog.Enabled {
+		targets = append(targets, target{"audit-index", filepath.Join(cfg.AuditLog.Dir, observability.AuditIndexFile)})
+	}
+
+	results := make([]statefile.Result, 0, len(targets))
+	for _, t := range targets {
+		results = append(results, statefile.Fsck(t.kind, t.path, repair))
+	}
+	return results
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// fuzzConn é uma conexão que entrega uma entrada fixa e depois EOF, como um
+// agent que envia bytes arbitrários e fecha o lado de escrita. As respostas
+// do server são descartadas.
+type fuzzConn struct {
+	testConn
+	r *bytes.Reader
+}
+
+func (c *fuzzConn) Read(p []byte) (int, error)  { return c.r.Read(p) }
+func (c *fuzzConn) Write(p []byte) (int, error) { return len(p), nil }
+
+// newFuzzHandler cria um Handler com um storage file (fuzz) e um discard
+// (bench), carregados de YAML para receber os mesmos defaults do server.
+func newFuzzHandler(f *testing.F) *Handler {
+	dir := f.TempDir()
+	path := filepath.Join(dir, "server.yaml")
+	err := os.WriteFile(path, []byte(fmt.Sprintf(`server:
+  listen: 127.0.0.1:0
+tls:
+  ca_cert: ca.pem
+  server_cert: server.pem
+  server_key: server-key.pem
+storages:
+  fuzz:
+    base_dir: %q
+    max_backups: 2
+  bench:
+    base_dir: %q
+    type: discard
+`, filepath.Join(dir, "fuzz"), filepath.Join(dir, "bench"))), 0600)
+	if err != nil {
+		f.Fatal(err)
+	}
+	cfg, err := config.LoadServerConfig(path)
+	if err != nil {
+		f.Fatal(err)
+	}
+	return NewHandler(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), &sync.Map{}, &sync.Map{})
+}
+
+// fuzzSeed monta uma semente com os writers do protocolo.
+func fuzzSeed(f *testing.F, writes ...func(io.Writer) error) {
+	var b bytes.Buffer
+	for _, write := range writes {
+		if err := write(&b); err != nil {
+			f.Fatal(err)
+		}
+	}
+	f.Add(b.Bytes())
+}
+
+// FuzzHandleConnection envia bytes arbitrários a HandleConnection, como um
+// agent malformado: o handler não pode entrar em pânico e precisa retornar
+// logo após o cancelamento do contexto (sessões paralelas aguardam streams
+// que nunca chegam). Para explorar entradas:
+//
+//	go test ./internal/server -run '^$' -fuzz '^FuzzHandleConnection$' -fuzztime 5m
+func FuzzHandleConnection(f *testing.F) {
+	h := newFuzzHandler(f)
+
+	data := []byte("fuzz payload")
+	sum := sha256.Sum256(data)
+	handshake := func(storage, backup string) func(io.Writer) error {
+		return func(w io.Writer) error { return protocol.WriteHandshake(w, "web-01", storage, backup, "v3.4.0") }
+	}
+	raw := func(b ...byte) func(io.Writer) error {
+		return func(w io.Writer) error { _, err := w.Write(b); return err }
+	}
+
+	// Backup single-stream completo
+	fuzzSeed(f, handshake("fuzz", "daily"), raw(0), raw(data...),
+		func(w io.Writer) error { return protocol.WriteTrailer(w, sum, uint64(len(data))) })
+	// Handshake v7+ com janela de SACK e ParallelInit, no storage discard
+	fuzzSeed(f, func(w io.Writer) error {
+		return protocol.WriteHandshakeVersion(w, protocol.MaxProtocolVersion, "web-01", "bench", protocol.BenchBackupName, "v3.4.0")
+	}, func(w io.Writer) error {
+		return protocol.WriteSACKWindow(w, protocol.SACKWindow{Interval: 4, MaxInFlight: 1 << 20})
+	}, func(w io.Writer) error { return protocol.WriteParallelInitRange(w, 4, 64*1024, 64*1024) })
+	// Storage inexistente e nome com path traversal
+	fuzzSeed(f, handshake("missing", "daily"))
+	fuzzSeed(f, handshake("fuzz", "../etc"))
+	// Stream paralelo de uma sessão inexistente, com um chunk
+	fuzzSeed(f, func(w io.Writer) error { return protocol.WriteParallelJoin(w, "0f3e-41", 1, 0) },
+		func(w io.Writer) error { return protocol.WriteChunkHeader(w, 0, uint32(len(data)), 1, 0) }, raw(data...))
+	fuzzSeed(f, func(w io.Writer) error { return protocol.WriteResume(w, "0f3e-41", "web-01", "fuzz") })
+	// Canal de controle com frames do agent
+	fuzzSeed(f, raw(protocol.MagicControl[:]...),
+		func(w io.Writer) error { return protocol.WriteControlPing(w, time.Now().UnixNano()) },
+		func(w io.Writer) error { return protocol.WriteControlStats(w, 12.5, 40, 70, 1.5) },
+		func(w io.Writer) error { return protocol.WriteControlProgress(w, 100, 10, false) },
+		func(w io.Writer) error { return protocol.WriteControlSessionProgress(w, "0f3e-41", 100, 10, false) },
+		func(w io.Writer) error {
+			return protocol.WriteControlSessionAutoScaleStats(w, "0f3e-41", &protocol.ControlAutoScaleStats{ActiveStreams: 2, MaxStreams: 4})
+		},
+		func(w io.Writer) error { return protocol.WriteControlIngestionDone(w, "0f3e-41") })
+	fuzzSeed(f, func(w io.Writer) error { return protocol.WritePing(w) })
+	fuzzSeed(f, func(w io.Writer) error { return protocol.WritePingStorage(w, "fuzz") })
+	fuzzSeed(f, func(w io.Writer) error {
+		return protocol.WriteRestoreRequest(w, protocol.RestoreRequest{AgentName: "web-01", StorageName: "fuzz", BackupName: "daily", Path: "etc/hosts"})
+	})
+	fuzzSeed(f, func(w io.Writer) error { return protocol.WriteMuxInit(w) })
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			h.HandleConnection(ctx, &fuzzConn{r: bytes.NewReader(input)})
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("HandleConnection did not return for input %q", input)
+		}
+	})
+}
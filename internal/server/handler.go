@@ -17,7 +17,6 @@ package server
 
 import (
 	"context"
-	"crypto/tls"
 	"io"
 	"log/slog"
 	"net"
@@ -25,7 +24,10 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/nishisan-dev/n-backup/internal/auth"
 	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
 	"github.com/nishisan-dev/n-backup/internal/server/observability"
 )
 
@@ -33,20 +35,22 @@ import (
 // Constantes de tunning do Handler
 // ---------------------------------------------------------------------------
 
-// sackInterval define a cada quantos bytes o server envia um SACK.
+// sackInterval define a cada quantos bytes o server envia um SACK quando o
+// agent não negocia a janela no handshake (v6) ou pede o default.
 // 4MB reduz overhead de ACK/flush em WAN sem atrasar demais o progresso de resume.
-const sackInterval = 4 * 1024 * 1024 // 4MB
+const sackInterval = protocol.DefaultSACKInterval
 
 // singleStreamIOBufferSize é o tamanho dos buffers do caminho single-stream.
 // 1MB reduz syscalls e melhora vazão sustentada em transferências grandes.
 const singleStreamIOBufferSize = 1 * 1024 * 1024 // 1MB
 
-// readInactivityTimeout é o tempo máximo de inatividade na leitura de dados (single-stream).
-// Se expirar, a conexão é considerada morta e a goroutine é liberada.
-const readInactivityTimeout = 90 * time.Second
+// defaultReadInactivityTimeout é o tempo máximo de inatividade na leitura de dados (single-stream).
+// Se expirar, a conexão é considerada morta e a goroutine é liberada — exceto
+// se o agent reportou progresso pelo canal de controle nesse intervalo.
+const defaultReadInactivityTimeout = 90 * time.Second
 
 // streamReadDeadline é o deadline de read para streams paralelos.
-// Menor que readInactivityTimeout porque streams paralelos têm reconexão automática:
+// Menor que defaultReadInactivityTimeout porque streams paralelos têm reconexão automática:
 // quanto mais rápido detectar a falha, mais rápido o agent pode reconectar.
 const streamReadDeadline = 30 * time.Second
 
@@ -63,6 +67,7 @@ type PartialSession struct {
 	BytesWritten    atomic.Int64
 	AgentName       string
 	StorageName     string
+	Placement       string // placement pedido no handshake ("" = storage pedido diretamente)
 	BackupName      string
 	BaseDir         string
 	CreatedAt       time.Time
@@ -70,10 +75,63 @@ type PartialSession struct {
 	ClientVersion   string       // Versão do client (protocolo v3+)
 	CompressionMode string       // gzip | zst
 
+	// Progresso reportado pelo agent via ControlProgress (canal de controle).
+	// LastProgress também serve de keepalive da conexão de dados: enquanto o
+	// agent reporta, o server tolera períodos sem bytes (ver receiveWithSACK).
+	TotalObjects atomic.Uint32
+	ObjectsSent  atomic.Uint32
+	WalkComplete atomic.Int32 // 1 = prescan concluído, total confiável
+	LastProgress atomic.Int64 // UnixNano do último ControlProgress
+
+	// hash é o SHA-256 incremental dos bytes gravados no tmp (nil = a
+	// validação relê o arquivo, como após um resume que perdeu a sequência).
+	hash *receiveHash
+
+	// Config é o snapshot da configuração efetiva no início da sessão (session history).
+	Config *observability.SessionConfigSnapshot
+
 	// Lifecycle phases — rastreamento de fase pós-streaming para WebUI
 	Phase       *SessionPhaseTracker // fase atual da sessão
 	IntProgress *IntegrityProgress   // progresso da verificação de integridade (nil quando não ativo)
 	PCProgress  *PostCommitProgress  // progresso do upload pós-commit (nil quando não ativo)
+
+	// conn é a conexão de dados corrente (nil entre uma queda e o resume),
+	// fechada quando a sessão é cancelada ou expirada via API.
+	connMu    sync.Mutex
+	conn      net.Conn
+	cancelled atomic.Bool // true após CancelSession/ExpireSession: dados descartados
+}
+
+// progressSince indica se o agent reportou progresso pelo canal de controle
+// depois de t.
+func (s *PartialSession) progressSince(t time.Time) bool {
+	return s.LastProgress.Load() > t.UnixNano()
+}
+
+// sackInterval retorna o intervalo de SACK da sessão: o negociado no
+// handshake (preservado no resume e no sessions_file) ou o default.
+func (s *PartialSession) sackInterval() int64 {
+	if s.Config != nil && s.Config.SACKInterval > 0 {
+		return s.Config.SACKInterval
+	}
+	return sackInterval
+}
+
+// attachConn registra a conexão que está alimentando a sessão.
+func (s *PartialSession) attachConn(conn net.Conn) {
+	s.connMu.Lock()
+	s.conn = conn
+	s.connMu.Unlock()
+}
+
+// stop marca a sessão como cancelada e fecha a conexão de dados, se houver.
+func (s *PartialSession) stop() {
+	s.cancelled.Store(true)
+	s.connMu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.connMu.Unlock()
 }
 
 // Handler processa conexões individuais de backup.
@@ -88,12 +146,58 @@ type Handler struct {
 	// chunkBuffer é o buffer de chunks em memória global (nil quando desabilitado).
 	chunkBuffer *ChunkBuffer
 
+	// chaos injeta falhas aleatórias no data plane (nil quando chaos mode desabilitado).
+	chaos *chaosInjector
+
+	// handshakes limita a concorrência de handshakes TLS (nil em testes sem config TLS).
+	handshakes *handshakeLimiter
+
+	// ingest aplica ingest_limit (global e por storage) às conexões de dados.
+	ingest *ingestLimits
+
+	// disk coordena os writes em disco por storage (write_workers).
+	disk *diskQueues
+
+	// orphans acumula os resultados do sweep de artefatos temporários órfãos.
+	orphans orphanSweepStats
+
+	// sessionStore persiste as sessões parciais (server.sessions_file); nil = desabilitado.
+	sessionStore *sessionStore
+
+	// readInactivityTimeout substitui defaultReadInactivityTimeout (0 = default; menor nos testes).
+	readInactivityTimeout time.Duration
+
+	// cfgMu protege a troca de cfg no reload via SIGHUP. Leituras usam config().
+	cfgMu sync.RWMutex
+
 	// Control channel registry: agentName → *ControlConnInfo
 	// Registrado em handleControlChannel, usado por evaluateFlowRotation
 	// para enviar ControlRotate graceful, e por ConnectedAgents para observabilidade.
 	controlConns   sync.Map // agentName (string) → *ControlConnInfo
 	controlConnsMu sync.Map // agentName (string) → *sync.Mutex (protege writes na conn)
 
+	// snapshot_groups: execuções em andamento por snapshotID e grupos ativos
+	// (uma execução por grupo).
+	snapshotRuns         sync.Map // snapshotID (string) → *snapshotGroupRun
+	snapshotGroupsActive sync.Map // group name (string) → true
+
+	// Pools dos storages dedup, abertos no primeiro uso.
+	dedupStores sync.Map // base_dir (string) → *dedup.Store
+
+	// Ledgers dos storages imutáveis, abertos no start ou no primeiro uso.
+	ledgers sync.Map // base_dir (string) → *wormLedger
+
+	// Saúde do disco dos storages com disk_health e scrubs disparados por
+	// discos degradados.
+	diskHealth sync.Map // storage name (string) → diskHealthStatus
+	scrubs     sync.Map // storage name (string) → *scrubProgress
+
+	// Último restore drill de cada archive (restore_drill.go).
+	restoreDrills sync.Map // "storage/agent/backup/file" → observability.RestoreDrillEntry
+
+	// Recompressão de cada backup pelo lifecycle do storage (lifecycle.go).
+	lifecycle sync.Map // "storage/agent/backup/file" → observability.LifecycleEntry
+
 	// Métricas observáveis pelo stats reporter
 	TrafficIn   atomic.Int64 // bytes recebidos da rede (acumulado desde último reset)
 	DiskWrite   atomic.Int64 // bytes escritos em disco (acumulado desde último reset)
@@ -111,10 +215,22 @@ type Handler struct {
 	// BucketUploads mantém histórico de uploads pós-commit para Object Storage (nil quando WebUI desabilitada).
 	BucketUploads *observability.BucketUploadStore
 
+	// Audit é o audit log de sessões (nil quando audit_log desabilitado).
+	Audit *observability.AuditLog
+
+	// Accounting acumula a ingestão por agent/storage/dia (nil quando accounting desabilitado).
+	Accounting *observability.AccountingStore
+
 	// storageCache mantém snapshot cacheado de StorageUsage, atualizado por StartStorageScanner.
 	// Evita syscall.Statfs + filepath.WalkDir a cada request HTTP.
 	storageCache atomic.Value // []observability.StorageUsage
 
+	// crl é a CRL vigente de tls.crl_file (nil = sem verificação de revogação).
+	crl atomic.Pointer[pki.CRLChecker]
+
+	// psk é o keyring de server.psk_file (nil = listener mTLS, sem desafio PSK).
+	psk atomic.Pointer[pki.PSKKeyring]
+
 	// syncRunning guarda o estado do sync retroativo para evitar execuções concorrentes.
 	syncRunning atomic.Bool
 
@@ -143,13 +259,60 @@ type ControlConnInfo struct {
 
 // NewHandler cria um novo Handler inicializado com config, logger e maps compartilhados.
 func NewHandler(cfg *config.ServerConfig, logger *slog.Logger, locks *sync.Map, sessions *sync.Map) *Handler {
-	return &Handler{
+	h := &Handler{
 		cfg:         cfg,
 		logger:      logger,
 		locks:       locks,
 		sessions:    sessions,
 		chunkBuffer: NewChunkBuffer(cfg.ChunkBuffer, logger),
+		chaos:       newChaosInjector(cfg.Chaos),
+		handshakes:  newHandshakeLimiter(cfg.TLS),
+		ingest:      newIngestLimits(cfg),
+		disk:        newDiskQueues(cfg),
+	}
+	for name, si := range cfg.Storages {
+		logger.Info("storage write buffer",
+			"storage", name,
+			"media", detectStorageMedia(si.BaseDir),
+			"write_buffer_size", writeBufferSize(si),
+			"configured", si.WriteBufferSize,
+		)
+		if si.IngestLimit != "" {
+			logger.Info("storage ingest limit", "storage", name, "ingest_limit", si.IngestLimit)
+		}
+		if si.WriteWorkers > 0 {
+			logger.Info("storage disk write queue", "storage", name, "write_workers", si.WriteWorkers)
+		}
+	}
+	if cfg.IngestLimit != "" {
+		logger.Info("global ingest limit", "ingest_limit", cfg.IngestLimit)
 	}
+	if h.chaos != nil {
+		logger.Warn("chaos mode enabled: faults will be injected into the data plane (not for production)",
+			"rotate_probability", cfg.Chaos.RotateProbabilityRaw,
+			"sack_delay_probability", cfg.Chaos.SACKDelayProbabilityRaw,
+			"sack_delay_max", cfg.Chaos.SACKDelayMax,
+			"drop_probability", cfg.Chaos.DropProbabilityRaw,
+			"faults", len(cfg.Chaos.Faults),
+		)
+	}
+	return h
+}
+
+// config retorna a configuração corrente (substituída atomicamente por Reload).
+// Sessões ativas copiam o StorageInfo no handshake e não são afetadas por reloads.
+func (h *Handler) config() *config.ServerConfig {
+	h.cfgMu.RLock()
+	defer h.cfgMu.RUnlock()
+	return h.cfg
+}
+
+// inactivityTimeout retorna o tempo máximo de inatividade na leitura de dados.
+func (h *Handler) inactivityTimeout() time.Duration {
+	if h.readInactivityTimeout > 0 {
+		return h.readInactivityTimeout
+	}
+	return defaultReadInactivityTimeout
 }
 
 // StartChunkBuffer inicia a goroutine de drenagem do buffer de chunks.
@@ -193,6 +356,28 @@ func (h *Handler) HandleConnection(ctx context.Context, conn net.Conn) {
 
 	logger := h.logger.With("remote", conn.RemoteAddr().String())
 
+	// Handshake TLS explícito sob o limite de concorrência, antes de qualquer leitura
+	if err := h.handshakes.Handshake(ctx, conn); err != nil {
+		logger.Warn("tls handshake not completed", "error", err)
+		return
+	}
+
+	// Listener com auth psk: autentica o agent antes de qualquer frame de sessão
+	if keyring := h.psk.Load(); keyring != nil && listenerFrom(ctx).psk() {
+		authConn, err := h.authenticatePSK(conn, keyring, logger)
+		if err != nil {
+			logger.Warn("psk authentication failed", "error", err)
+			return
+		}
+		conn = authConn
+	}
+
+	// logging.protocol_trace_dir: transcript dos frames da conexão (debug)
+	if traced := h.traceConn(conn); traced != conn {
+		conn = traced
+		defer conn.Close()
+	}
+
 	// Lê os primeiros 4 bytes para determinar o tipo de sessão
 	magic := make([]byte, 4)
 	if _, err := io.ReadFull(conn, magic); err != nil {
@@ -202,15 +387,23 @@ func (h *Handler) HandleConnection(ctx context.Context, conn net.Conn) {
 
 	switch string(magic) {
 	case "PING":
+		traceDisable(conn) // health checks não geram trace
 		h.handleHealthCheck(conn, logger)
+	case "PSTG":
+		traceDisable(conn)
+		h.handleStorageHealthCheck(conn, logger)
 	case "NBKP":
 		h.handleBackup(ctx, conn, logger)
 	case "RSME":
 		h.handleResume(ctx, conn, logger)
 	case "PJIN":
 		h.handleParallelJoin(ctx, conn, logger)
+	case "PMUX":
+		h.handleMux(ctx, conn, logger)
 	case "CTRL":
 		h.handleControlChannel(ctx, conn, logger)
+	case "RSTR":
+		h.handleRestore(ctx, conn, logger)
 	default:
 		logger.Warn("unknown magic bytes", "magic", string(magic))
 	}
@@ -220,19 +413,15 @@ func (h *Handler) HandleConnection(ctx context.Context, conn net.Conn) {
 // TLS helper
 // ---------------------------------------------------------------------------
 
-// extractAgentName extrai o CN do certificado TLS peer para usar como agentName.
+// extractAgentName retorna o nome da identidade autenticada da conexão (CN,
+// SPIFFE ID ou agent PSK — ver auth.FromConn) para usar como agentName.
 func (h *Handler) extractAgentName(conn net.Conn, logger *slog.Logger) string {
-	tlsConn, ok := conn.(*tls.Conn)
-	if !ok {
-		return ""
+	conn = untraced(conn)
+	if id, ok := auth.FromConn(conn); ok && id.Name != "" {
+		return id.Name
 	}
-
-	state := tlsConn.ConnectionState()
-	if len(state.PeerCertificates) > 0 {
-		cn := state.PeerCertificates[0].Subject.CommonName
-		if cn != "" {
-			return cn
-		}
+	if _, ok := conn.(auth.TLSConn); !ok {
+		return ""
 	}
 
 	// Fallback: usa o remote address agrupado por IP (sem porta)
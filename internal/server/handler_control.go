@@ -8,10 +8,13 @@
 // O Control Channel é uma conexão TLS bidirecional de longa duração entre
 // agent e server, usada para:
 //   - Keep-alive (ControlPing/Pong) com medição de RTT
+//   - Pressão do server por sessão paralela (ControlServerLoad, junto do Pong)
+//   - Teto de streams por sessão paralela (ControlStreamLimit, junto do Pong)
 //   - Estatísticas do agent (CPU, memória, disco, load)
 //   - AutoScaler stats (eficiência, streams ativos, modo)
 //   - Progresso de backup (objetos escaneados/enviados)
 //   - Sinalização de fim de ingestão (ControlIngestionDone)
+//   - Totais de transferência por stream (ControlSessionSummary)
 //   - Orquestração de rotação de streams (ControlRotate/RotateACK)
 //   - Gerenciamento de slots (ControlSlotPark/Resume)
 //
@@ -26,9 +29,9 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"net"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/nishisan-dev/n-backup/internal/protocol"
@@ -87,6 +90,15 @@ func (h *Handler) handleControlChannel(ctx context.Context, conn net.Conn, logge
 	if agentName == "" {
 		agentName = conn.RemoteAddr().String() // fallback
 	}
+	// Canal aberto via QUIC 0-RTT: registra só após o handshake (anti-replay)
+	if err := awaitHandshake(ctx, conn); err != nil {
+		logger.Warn("control channel: quic handshake not completed", "error", err)
+		return
+	}
+	if err := h.authorizeAgent(ctx, conn, logger); err != nil {
+		return
+	}
+	h.traceIdentify(conn, protocol.TraceInfo{Conn: "control", Agent: agentName})
 
 	// Registra control conn e mutex de write para este agent
 	writeMu := &sync.Mutex{}
@@ -189,17 +201,17 @@ func (h *Handler) handleControlChannel(ctx context.Context, conn net.Conn, logge
 				serverLoad = 1.0
 			}
 
-			// Disk free do volume atual (MB)
-			var diskFree uint32
-			var stat syscall.Statfs_t
-			if err := syscall.Statfs(".", &stat); err == nil {
-				// Bavail * Bsize = bytes available to non-root users
-				// / 1024 / 1024 = MB
-				diskFree = uint32(stat.Bavail * uint64(stat.Bsize) / 1024 / 1024)
-			}
+			// Menor espaço livre entre os storages (MB)
+			diskFree := uint32(min(h.minStorageFree()/1024/1024, math.MaxUint32))
 
 			writeMu.Lock()
 			err = protocol.WriteControlPong(conn, ping, serverLoad, diskFree)
+			if err == nil {
+				err = h.writeServerLoad(conn, agentName)
+			}
+			if err == nil {
+				err = h.writeStreamLimits(conn, agentName, logger)
+			}
 			writeMu.Unlock()
 			if err != nil {
 				logger.Warn("control channel pong write failed", "error", err)
@@ -230,45 +242,24 @@ func (h *Handler) handleControlChannel(ctx context.Context, conn net.Conn, logge
 				})
 			}
 
-		case protocol.MagicControlAutoScaleStats:
+		case protocol.MagicControlAutoScaleStats, protocol.MagicControlSessionAutoScaleStats:
 			// Agent enviou AutoScale Stats
-			asStats, err := protocol.ReadControlAutoScaleStatsPayload(conn)
+			var asStats *protocol.ControlAutoScaleStats
+			if magic == protocol.MagicControlSessionAutoScaleStats {
+				asStats, err = protocol.ReadControlSessionAutoScaleStatsPayload(conn)
+			} else {
+				asStats, err = protocol.ReadControlAutoScaleStatsPayload(conn)
+			}
 			if err != nil {
 				logger.Warn("control channel: reading auto-scale stats payload", "error", err)
 				return
 			}
 
-			// Mapeia state numérico para string
-			stateStr := "stable"
-			switch asStats.State {
-			case protocol.AutoScaleStateScalingUp:
-				stateStr = "scaling_up"
-			case protocol.AutoScaleStateScaleDown:
-				stateStr = "scaling_down"
-			case protocol.AutoScaleStateProbing:
-				stateStr = "probing"
-			}
-
-			info := &observability.AutoScaleInfo{
-				Efficiency:    asStats.Efficiency,
-				ProducerMBs:   asStats.ProducerMBs,
-				DrainMBs:      asStats.DrainMBs,
-				ActiveStreams: asStats.ActiveStreams,
-				MaxStreams:    asStats.MaxStreams,
-				State:         stateStr,
-				ProbeActive:   asStats.ProbeActive == 1,
+			if !h.applyControlAutoScaleStats(agentName, asStats) {
+				logger.Debug("control channel: auto-scale stats without a matching session",
+					"session", asStats.SessionID)
 			}
 
-			// Armazena na ParallelSession deste agent
-			h.sessions.Range(func(_, value any) bool {
-				ps, ok := value.(*ParallelSession)
-				if !ok || ps.AgentName != agentName {
-					return true
-				}
-				ps.AutoScaleInfo.Store(info)
-				return false
-			})
-
 		case protocol.MagicControlRotateACK:
 			// Agent confirmou drain de stream após ControlRotate
 			streamIdx, err := protocol.ReadControlRotateACKPayload(conn)
@@ -301,34 +292,52 @@ func (h *Handler) handleControlChannel(ctx context.Context, conn net.Conn, logge
 				return true // esta sessão não tem RotatePend para este idx, continua
 			})
 
-		case protocol.MagicControlProgress:
+		case protocol.MagicControlProgress, protocol.MagicControlSessionProgress:
 			// Agent enviou progresso de backup (objetos escaneados/enviados)
-			prog, err := protocol.ReadControlProgressPayload(conn)
+			var prog *protocol.ControlProgress
+			if magic == protocol.MagicControlSessionProgress {
+				prog, err = protocol.ReadControlSessionProgressPayload(conn)
+			} else {
+				prog, err = protocol.ReadControlProgressPayload(conn)
+			}
 			if err != nil {
 				logger.Warn("control channel: reading progress payload", "error", err)
 				return
 			}
 
-			// Atualiza a ParallelSession deste agent
-			h.sessions.Range(func(_, value any) bool {
-				ps, ok := value.(*ParallelSession)
-				if !ok || ps.AgentName != agentName {
-					return true
-				}
-				ps.TotalObjects.Store(prog.TotalObjects)
-				ps.ObjectsSent.Store(prog.ObjectsSent)
-				if prog.WalkComplete {
-					ps.WalkComplete.Store(1)
-				}
-				return false
-			})
+			if !h.applyControlProgress(agentName, prog) {
+				logger.Debug("control channel: progress without a matching session",
+					"session", prog.SessionID)
+			}
 
 			logger.Debug("control channel: progress update",
+				"session", prog.SessionID,
 				"total_objects", prog.TotalObjects,
 				"objects_sent", prog.ObjectsSent,
 				"walk_complete", prog.WalkComplete,
 			)
 
+		case protocol.MagicControlSessionSummary:
+			// Totais de transferência por stream, enviados antes do IngestionDone
+			summary, err := protocol.ReadControlSessionSummaryPayload(conn)
+			if err != nil {
+				logger.Warn("control channel: reading ControlSessionSummary payload", "error", err)
+				return
+			}
+
+			if val, ok := h.sessions.Load(summary.SessionID); ok {
+				if ps, ok := val.(*ParallelSession); ok {
+					ps.TransferSummary.Store(summary)
+				}
+			} else {
+				logger.Warn("control channel: ControlSessionSummary for unknown session", "session", summary.SessionID)
+			}
+
+			logger.Debug("control channel: received ControlSessionSummary",
+				"session", summary.SessionID,
+				"streams", len(summary.Streams),
+			)
+
 		case protocol.MagicControlIngestionDone:
 			// Agent sinalizou que toda a ingestão foi completada com sucesso
 			cidnSessionID, err := protocol.ReadControlIngestionDonePayload(conn)
@@ -354,6 +363,41 @@ func (h *Handler) handleControlChannel(ctx context.Context, conn net.Conn, logge
 				h.Events.PushEvent("info", "ingestion_done_signal", agentName, fmt.Sprintf("agent confirmed all data sent (session %s)", cidnSessionID), 0)
 			}
 
+		case protocol.MagicControlSessionCancel:
+			// Agent abandonou a sessão (ex: shutdown do daemon): descarta os
+			// dados parciais sem esperar o TTL. Só vale para sessões do próprio agent.
+			cscnSessionID, err := protocol.ReadControlSessionCancelPayload(conn)
+			if err != nil {
+				logger.Warn("control channel: reading ControlSessionCancel payload", "error", err)
+				return
+			}
+
+			logger.Info("control channel: received ControlSessionCancel", "session", cscnSessionID)
+
+			if owner := sessionAgent(h.sessions, cscnSessionID); owner != agentName {
+				logger.Warn("control channel: ControlSessionCancel for unknown or foreign session", "session", cscnSessionID)
+				break
+			}
+			if err := h.cancelSession(cscnSessionID, "agent"); err != nil {
+				logger.Warn("control channel: session not cancelled", "session", cscnSessionID, "error", err)
+				break
+			}
+			if h.Events != nil {
+				h.Events.PushEvent("warn", "session_cancelled", agentName, fmt.Sprintf("agent abandoned session %s (daemon shutdown)", cscnSessionID), 0)
+			}
+
+		case protocol.MagicControlSnapshotReady:
+			// Agent confirmou (ou recusou) o snapshot de um snapshot_group
+			ready, err := protocol.ReadControlSnapshotReadyPayload(conn)
+			if err != nil {
+				logger.Warn("control channel: reading ControlSnapshotReady payload", "error", err)
+				return
+			}
+
+			logger.Info("control channel: received ControlSnapshotReady",
+				"snapshot", ready.SnapshotID, "status", snapshotStatusString(ready))
+			h.handleSnapshotReady(agentName, ready, logger)
+
 		case protocol.MagicControlSlotPark:
 			// Agent desativou um slot (scale-down via auto-scaler)
 			slotID, err := protocol.ReadControlSlotParkPayload(conn)
@@ -412,7 +456,7 @@ func (h *Handler) handleControlChannel(ctx context.Context, conn net.Conn, logge
 func (h *Handler) evaluateFlowRotation(intervalSecs float64) {
 	const maxRotationsPerTick = 1
 
-	frCfg := h.cfg.FlowRotation
+	frCfg := h.config().FlowRotation
 
 	h.sessions.Range(func(key, value any) bool {
 		ps, ok := value.(*ParallelSession)
@@ -422,6 +466,10 @@ func (h *Handler) evaluateFlowRotation(intervalSecs float64) {
 
 		var rotated int
 
+		// Com ingest_limit ativo o server é quem espaça as leituras: a lentidão
+		// não indica um flow degradado e rotacionar não aumentaria o throughput.
+		capped := h.ingest.limited(ps.StorageName)
+
 		for _, slot := range ps.Slots {
 			// Swap-and-reset: lê bytes reais do intervalo e zera o contador.
 			// Isso garante que o flow rotation veja o throughput real,
@@ -435,7 +483,7 @@ func (h *Handler) evaluateFlowRotation(intervalSecs float64) {
 			// Sem tráfego no intervalo: stream pode estar apenas ocioso
 			// (ex.: fim de pipeline ou producer momentaneamente sem dados).
 			// Não tratar como degradação para evitar rotações desnecessárias.
-			if bytes == 0 {
+			if bytes == 0 || capped {
 				slot.ClearSlowSince()
 				continue
 			}
@@ -527,6 +575,11 @@ func (h *Handler) rotateStream(sessionKey any, ps *ParallelSession, idx uint8, m
 				"slowFor", slowFor.String(),
 			)
 
+			h.Audit.Record(observability.AuditRecord{
+				SessionID: ps.SessionID, Event: observability.AuditStreamRotate, Stream: &idx, Reason: "graceful",
+				Message: fmt.Sprintf("%.2f MB/s, slow for %s", mbps, slowFor),
+			})
+
 			// Emite evento de flow rotation graceful
 			if h.Events != nil {
 				h.Events.PushEvent("warn", "flow_rotation", ps.AgentName, fmt.Sprintf("stream %d rotated (graceful, %.2f MB/s, slow for %s)", idx, mbps, slowFor.String()), int(idx))
@@ -555,6 +608,11 @@ func (h *Handler) rotateStream(sessionKey any, ps *ParallelSession, idx uint8, m
 		"slowFor", slowFor.String(),
 	)
 
+	h.Audit.Record(observability.AuditRecord{
+		SessionID: ps.SessionID, Event: observability.AuditStreamRotate, Stream: &idx, Reason: "abrupt",
+		Message: fmt.Sprintf("%.2f MB/s, slow for %s", mbps, slowFor),
+	})
+
 	// Emite evento de flow rotation abrupta
 	if h.Events != nil {
 		h.Events.PushEvent("warn", "flow_rotation", ps.AgentName, fmt.Sprintf("stream %d rotated (abrupt, %.2f MB/s, slow for %s)", idx, mbps, slowFor.String()), int(idx))
@@ -562,3 +620,191 @@ func (h *Handler) rotateStream(sessionKey any, ps *ParallelSession, idx uint8, m
 
 	conn.Close()
 }
+
+// sendControlDefer envia ControlDefer ao agent pelo control channel, se conectado.
+// O tempo de espera é arredondado para cima em minutos (mínimo 1).
+func (h *Handler) sendControlDefer(agentName string, wait time.Duration, logger *slog.Logger) {
+	ctrlInfo, ok := h.controlConns.Load(agentName)
+	if !ok {
+		return
+	}
+	muRaw, ok := h.controlConnsMu.Load(agentName)
+	if !ok {
+		return
+	}
+
+	minutes := uint32((wait + time.Minute - 1) / time.Minute)
+	if minutes == 0 {
+		minutes = 1
+	}
+
+	mu := muRaw.(*sync.Mutex)
+	mu.Lock()
+	err := protocol.WriteControlDefer(ctrlInfo.(*ControlConnInfo).Conn, minutes)
+	mu.Unlock()
+	if err != nil {
+		logger.Warn("control channel: failed to send ControlDefer", "agent", agentName, "error", err)
+		return
+	}
+	logger.Info("control channel: sent ControlDefer", "agent", agentName, "wait_minutes", minutes)
+}
+
+// sendControlFrame escreve um frame no control channel do agent, serializado
+// com os demais writes da conexão. Retorna erro se o agent não está conectado.
+func (h *Handler) sendControlFrame(agentName string, write func(conn net.Conn) error) error {
+	ctrlInfo, ok := h.controlConns.Load(agentName)
+	if !ok {
+		return fmt.Errorf("agent %q has no control channel", agentName)
+	}
+	muRaw, ok := h.controlConnsMu.Load(agentName)
+	if !ok {
+		return fmt.Errorf("agent %q has no control channel", agentName)
+	}
+
+	mu := muRaw.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+	return write(ctrlInfo.(*ControlConnInfo).Conn)
+}
+
+// sendControlAbort envia ControlAbort ao agent pelo control channel, se
+// conectado. sessionID vazio aborta todas as sessões do agent.
+func (h *Handler) sendControlAbort(agentName string, reason uint32, sessionID string, logger *slog.Logger) {
+	if _, ok := h.controlConns.Load(agentName); !ok {
+		return
+	}
+	err := h.sendControlFrame(agentName, func(conn net.Conn) error {
+		return protocol.WriteControlAbort(conn, reason, sessionID)
+	})
+	if err != nil {
+		logger.Warn("control channel: failed to send ControlAbort", "agent", agentName, "error", err)
+		return
+	}
+	logger.Info("control channel: sent ControlAbort", "agent", agentName, "reason", reason, "session", sessionID)
+}
+
+// applyControlAutoScaleStats armazena as stats do auto-scaler do agent
+// agentName na sessão paralela indicada no frame (CSAS) ou, no CASS legado, na
+// única sessão paralela do agent: com mais de uma, o frame é ambíguo e
+// ignorado. Retorna false se nenhuma sessão foi atualizada.
+func (h *Handler) applyControlAutoScaleStats(agentName string, stats *protocol.ControlAutoScaleStats) bool {
+	var ps *ParallelSession
+	if stats.SessionID != "" {
+		raw, _ := h.sessions.Load(stats.SessionID)
+		ps, _ = raw.(*ParallelSession)
+	} else {
+		matches := 0
+		h.sessions.Range(func(_, value any) bool {
+			if s, ok := value.(*ParallelSession); ok && s.AgentName == agentName {
+				ps = s
+				matches++
+			}
+			return matches < 2
+		})
+		if matches != 1 {
+			return false
+		}
+	}
+	if ps == nil || ps.AgentName != agentName {
+		return false
+	}
+
+	// Mapeia state numérico para string
+	stateStr := "stable"
+	switch stats.State {
+	case protocol.AutoScaleStateScalingUp:
+		stateStr = "scaling_up"
+	case protocol.AutoScaleStateScaleDown:
+		stateStr = "scaling_down"
+	case protocol.AutoScaleStateProbing:
+		stateStr = "probing"
+	}
+
+	ps.AutoScaleInfo.Store(&observability.AutoScaleInfo{
+		Efficiency:    stats.Efficiency,
+		ProducerMBs:   stats.ProducerMBs,
+		DrainMBs:      stats.DrainMBs,
+		ActiveStreams: stats.ActiveStreams,
+		MaxStreams:    stats.MaxStreams,
+		State:         stateStr,
+		ProbeActive:   stats.ProbeActive == 1,
+	})
+	return true
+}
+
+// applyControlProgress aplica o ControlProgress do agent agentName à sessão
+// indicada no frame (CPRS) ou, no CPRG legado, à única sessão do agent: com
+// mais de uma, o frame é ambíguo e ignorado. Numa sessão single-stream o
+// progresso também mantém viva a conexão de dados sem bytes. Retorna false se
+// nenhuma sessão foi atualizada.
+func (h *Handler) applyControlProgress(agentName string, prog *protocol.ControlProgress) bool {
+	id := prog.SessionID
+	if id == "" {
+		matches := 0
+		h.sessions.Range(func(key, _ any) bool {
+			if sessionAgent(h.sessions, key.(string)) == agentName {
+				id = key.(string)
+				matches++
+			}
+			return matches < 2
+		})
+		if matches != 1 {
+			return false
+		}
+	}
+	if sessionAgent(h.sessions, id) != agentName {
+		return false
+	}
+
+	raw, _ := h.sessions.Load(id)
+	switch s := raw.(type) {
+	case *ParallelSession:
+		s.TotalObjects.Store(prog.TotalObjects)
+		s.ObjectsSent.Store(prog.ObjectsSent)
+		if prog.WalkComplete {
+			s.WalkComplete.Store(1)
+		}
+	case *PartialSession:
+		s.TotalObjects.Store(prog.TotalObjects)
+		s.ObjectsSent.Store(prog.ObjectsSent)
+		if prog.WalkComplete {
+			s.WalkComplete.Store(1)
+		}
+		s.LastProgress.Store(time.Now().UnixNano())
+	default:
+		return false
+	}
+	return true
+}
+
+// writeServerLoad envia, logo após o ControlPong e com o writeMu do control
+// channel held, um ControlServerLoad para cada sessão paralela do agent que
+// anunciou JoinFlagServerLoad.
+func (h *Handler) writeServerLoad(w io.Writer, agentName string) error {
+	var err error
+	h.sessions.Range(func(_, value any) bool {
+		ps, ok := value.(*ParallelSession)
+		if !ok || ps.AgentName != agentName || !ps.ServerLoad.Load() {
+			return true
+		}
+		err = protocol.WriteControlServerLoad(w, h.serverLoadOf(ps))
+		return err == nil
+	})
+	return err
+}
+
+// serverLoadOf mede a pressão do server sobre a sessão: bytes recebidos e
+// ainda não gravados (pendentes no assembler e no chunk buffer), latência
+// média de gravação de um chunk e writes na fila do storage.
+func (h *Handler) serverLoadOf(ps *ParallelSession) *protocol.ControlServerLoad {
+	load := &protocol.ControlServerLoad{SessionID: ps.SessionID}
+	if ps.Assembler != nil {
+		pending := ps.Assembler.Stats().PendingMemBytes + h.chunkBuffer.SessionBytes(ps.Assembler)
+		load.PendingBytes = uint64(max(pending, 0))
+		load.WriteLatency = uint32(min(ps.Assembler.WriteLatency().Microseconds(), math.MaxUint32))
+	}
+	if q := h.disk.queue(ps.StorageName); q != nil {
+		load.QueueDepth = uint32(max(q.queued.Load(), 0))
+	}
+	return load
+}
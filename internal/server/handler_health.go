@@ -5,8 +5,9 @@
 // handler_health.go contém o processamento de health check do server.
 //
 // Quando o agent (ou qualquer client) envia o magic "PING", o server responde
-// com o status atual (ready) e o espaço em disco disponível. Esse fluxo é
-// leve e idempotente — não altera nenhum estado interno.
+// com o status atual e o menor espaço livre entre os storages; com "PSTG" +
+// nome do storage, responde com o status e o espaço livre daquele storage.
+// Esse fluxo é leve e idempotente — não altera nenhum estado interno.
 
 package server
 
@@ -21,10 +22,85 @@ import (
 func (h *Handler) handleHealthCheck(conn net.Conn, logger *slog.Logger) {
 	logger.Debug("health check received")
 
-	// TODO: implementar disk free real com syscall.Statfs
-	diskFree := uint64(0)
+	status, diskFree := h.healthCapacity(logger)
+	if err := protocol.WriteHealthResponse(conn, status, diskFree); err != nil {
+		logger.Error("writing health response", "error", err)
+	}
+}
+
+// handleStorageHealthCheck processa um health check PSTG: status e espaço
+// livre (bytes) do storage pedido, ou HealthStatusNotFound se ele não existe.
+func (h *Handler) handleStorageHealthCheck(conn net.Conn, logger *slog.Logger) {
+	storageName, err := protocol.ReadPingStorage(conn)
+	if err != nil {
+		logger.Warn("reading storage health check", "error", err)
+		return
+	}
+	logger.Debug("storage health check received", "storage", storageName)
+
+	// Placement: reporta o storage mais livre entre os que aceitariam o backup
+	if p, ok := h.config().GetPlacement(storageName); ok {
+		status, diskFree := h.placementHealth(p)
+		if err := protocol.WriteHealthResponse(conn, status, diskFree); err != nil {
+			logger.Error("writing health response", "error", err)
+		}
+		return
+	}
 
-	if err := protocol.WriteHealthResponse(conn, protocol.HealthStatusReady, diskFree); err != nil {
+	status := protocol.HealthStatusNotFound
+	var diskFree uint64
+	if si, ok := h.config().GetStorage(storageName); ok {
+		status = protocol.HealthStatusReady
+		if c, err := statCapacity(si.BaseDir); err == nil {
+			diskFree = c.FreeBytes
+		}
+		if err := checkStorageCapacity(si); err != nil {
+			logger.Warn("health check: storage low on capacity", "storage", storageName, "error", err)
+			status = protocol.HealthStatusLowDisk
+		}
+	}
+	if err := protocol.WriteHealthResponse(conn, status, diskFree); err != nil {
 		logger.Error("writing health response", "error", err)
 	}
 }
+
+// minStorageFree retorna o menor espaço livre (bytes) entre os storages,
+// sem as verificações de quota e inodes do healthCapacity (usado no pong do
+// control channel, a cada keepalive).
+func (h *Handler) minStorageFree() uint64 {
+	var diskFree uint64
+	first := true
+	for _, si := range h.config().Storages {
+		c, err := statCapacity(si.BaseDir)
+		if err != nil {
+			continue
+		}
+		if first || c.FreeBytes < diskFree {
+			diskFree, first = c.FreeBytes, false
+		}
+	}
+	return diskFree
+}
+
+// healthCapacity retorna o status do health check e o menor espaço livre
+// (bytes) entre os storages. Um storage sem inodes livres suficientes
+// (min_free_inodes) ou sem espaço reporta HealthStatusLowDisk.
+func (h *Handler) healthCapacity(logger *slog.Logger) (byte, uint64) {
+	status := protocol.HealthStatusReady
+	var diskFree uint64
+	first := true
+	for name, si := range h.config().Storages {
+		c, err := statCapacity(si.BaseDir)
+		if err != nil {
+			continue
+		}
+		if first || c.FreeBytes < diskFree {
+			diskFree, first = c.FreeBytes, false
+		}
+		if err := checkStorageCapacity(si); err != nil {
+			logger.Warn("health check: storage low on capacity", "storage", name, "error", err)
+			status = protocol.HealthStatusLowDisk
+		}
+	}
+	return status, diskFree
+}
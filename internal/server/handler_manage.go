@@ -0,0 +1,348 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// handler_manage.go implementa observability.BackupManager: o catálogo de
+// backups armazenados, o download de backups e as ações de gerenciamento da
+// API REST (cancelar e expirar sessões, disparar rotação, colocar backups em
+// quarentena).
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/dedup"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// BackupCatalog lista os backups de todos os storages, agrupados em
+// {base_dir}/{agent}/{backup}/, incluindo os que estão em quarentena.
+// Implementa observability.BackupManager.
+func (h *Handler) BackupCatalog() []observability.CatalogEntry {
+	storages := h.config().Storages
+	names := make([]string, 0, len(storages))
+	for name := range storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var entries []observability.CatalogEntry
+	for _, storage := range names {
+		baseDir := storages[storage].BaseDir
+		for _, agent := range listSubdirs(baseDir) {
+			for _, backup := range listSubdirs(filepath.Join(baseDir, agent)) {
+				dir := filepath.Join(baseDir, agent, backup)
+				entries = appendCatalogDir(entries, dir, storage, agent, backup, false)
+				entries = appendCatalogDir(entries, filepath.Join(dir, quarantineDirName), storage, agent, backup, true)
+			}
+		}
+	}
+	for i := range entries {
+		if e := &entries[i]; !e.Quarantined {
+			e.LastDrill = h.lastDrill(e.Storage, e.Agent, e.Backup, e.File)
+			e.Lifecycle = h.lifecycleOf(e.Storage, e.Agent, e.Backup, e.File)
+		}
+	}
+	return entries
+}
+
+// listSubdirs retorna os subdiretórios de dir que são nomes válidos de agent
+// ou backup (ignora chunks, quarentena e ocultos). Erros resultam em lista vazia.
+func listSubdirs(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && validatePathComponent(e.Name(), "dir") == nil {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// appendCatalogDir acrescenta os arquivos de backup de dir (inclusive os dos
+// diretórios de data de storages.*.layout) ao catálogo.
+func appendCatalogDir(entries []observability.CatalogEntry, dir, storage, agent, backup string, quarantined bool) []observability.CatalogEntry {
+	files, err := listBackups(dir)
+	if err != nil {
+		return entries
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.Rel)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		entry := observability.CatalogEntry{
+			Storage:     storage,
+			Agent:       agent,
+			Backup:      backup,
+			File:        f.Name,
+			SizeBytes:   info.Size(),
+			ModifiedAt:  info.ModTime().UTC().Format(time.RFC3339),
+			Quarantined: quarantined,
+		}
+		// Manifest dedup: o tamanho exibido é o do archive que ele representa.
+		if dedup.IsManifest(f.Name) {
+			entry.Dedup = true
+			if hdr, err := dedup.ReadManifestHeader(path); err == nil {
+				entry.SizeBytes = hdr.ArchiveSize
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// CancelSession interrompe uma sessão que ainda está recebendo dados: fecha
+// as conexões, descarta o .tmp (single) ou os chunks (parallel), registra a
+// sessão como "cancelled" e avisa o agent via ControlAbort com reason (ver
+// protocol.ParseAbortReason). Sessões em assembly, verificação ou upload não
+// podem ser canceladas — o backup já está sendo commitado.
+// Implementa observability.BackupManager.
+func (h *Handler) CancelSession(id, reason string) error {
+	return h.abortSession(id, "api", reason)
+}
+
+// abortSession cancela a sessão a pedido do operador (origin "api" ou
+// "admin") e envia ControlAbort ao agent, que interrompe o backup em vez de
+// insistir em resumes de uma sessão que não existe mais.
+func (h *Handler) abortSession(id, origin, reason string) error {
+	code, err := protocol.ParseAbortReason(reason)
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, observability.ErrInvalid)
+	}
+	agent := sessionAgent(h.sessions, id)
+	if err := h.cancelSession(id, origin); err != nil {
+		return err
+	}
+	h.sendControlAbort(agent, code, id, h.logger)
+	return nil
+}
+
+// cancelSession implementa o cancelamento; origin identifica quem pediu
+// ("api" ou "agent", via ControlSessionCancel).
+func (h *Handler) cancelSession(id, origin string) error {
+	return h.discardSession(id, origin, "cancelled")
+}
+
+// discardSession interrompe uma sessão em recepção, descarta os dados
+// parciais e a registra no histórico com result.
+func (h *Handler) discardSession(id, origin, result string) error {
+	raw, ok := h.sessions.Load(id)
+	if !ok {
+		return fmt.Errorf("session %s: %w", id, observability.ErrNotFound)
+	}
+
+	switch s := raw.(type) {
+	case *PartialSession:
+		if phase := s.Phase.Get(); phase != PhaseReceiving {
+			return fmt.Errorf("session %s is %s: %w", id, phase, observability.ErrConflict)
+		}
+		s.stop()
+		os.Remove(s.TmpPath)
+		h.deleteSession(id)
+		h.recordSessionEnd(id, s.AgentName, s.StorageName, s.BackupName, "single", s.CompressionMode, result, s.CreatedAt, s.BytesWritten.Load(), s.Config, nil)
+		h.logger.Info("session cancelled", "session", id, "agent", s.AgentName, "storage", s.StorageName, "by", origin)
+	case *ParallelSession:
+		if phase := s.Phase.Get(); phase != PhaseReceiving {
+			return fmt.Errorf("session %s is %s: %w", id, phase, observability.ErrConflict)
+		}
+		if _, already := s.aborted(); already {
+			return fmt.Errorf("session %s is already aborted: %w", id, observability.ErrConflict)
+		}
+		// O handleParallelBackup observa Aborted, responde ao agent e remove a sessão.
+		s.abort(errors.New(result + " via " + origin))
+		if s.Detached.Load() && s.claimed.CompareAndSwap(false, true) {
+			// Restaurada após restart e não retomada: não há goroutine primária
+			s.Assembler.Cleanup()
+			h.deleteSession(id)
+		}
+		h.recordSessionEnd(id, s.AgentName, s.StorageName, s.BackupName, "parallel", s.StorageInfo.CompressionMode, result, s.CreatedAt, s.DiskWriteBytes.Load(), s.Config, s.streamTransfers())
+		h.logger.Info("parallel session cancelled", "session", id, "agent", s.AgentName, "storage", s.StorageName, "by", origin)
+	default:
+		return fmt.Errorf("session %s: %w", id, observability.ErrNotFound)
+	}
+	return nil
+}
+
+// sessionAgent retorna o agent dono da sessão ("" se não existir).
+func sessionAgent(sessions *sync.Map, id string) string {
+	raw, _ := sessions.Load(id)
+	switch s := raw.(type) {
+	case *PartialSession:
+		return s.AgentName
+	case *ParallelSession:
+		return s.AgentName
+	}
+	return ""
+}
+
+// ExpireSession aplica a expiração por TTL imediatamente, sem esperar o
+// cleanup periódico (ex: sessão órfã aguardando um resume que não virá).
+// Implementa observability.BackupManager.
+func (h *Handler) ExpireSession(id string) error {
+	raw, ok := h.sessions.Load(id)
+	if !ok {
+		return fmt.Errorf("session %s: %w", id, observability.ErrNotFound)
+	}
+
+	switch s := raw.(type) {
+	case *PartialSession:
+		if phase := s.Phase.Get(); phase != PhaseReceiving {
+			return fmt.Errorf("session %s is %s: %w", id, phase, observability.ErrConflict)
+		}
+		s.stop()
+	case *ParallelSession:
+		if phase := s.Phase.Get(); phase != PhaseReceiving {
+			return fmt.Errorf("session %s is %s: %w", id, phase, observability.ErrConflict)
+		}
+	}
+	h.expireSession(id, raw, h.logger)
+	return nil
+}
+
+// RotateBackups aplica max_backups a {storage}/{agent}/{backup} fora de um
+// commit (ex: após reduzir max_backups via SIGHUP). Backups de archive são
+// enviados ao bucket antes da remoção, como na rotação pós-commit.
+// Implementa observability.BackupManager.
+func (h *Handler) RotateBackups(storage, agent, backup string) ([]string, error) {
+	storageInfo, agentDir, err := h.backupDir(storage, agent, backup)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := h.logger.With("storage", storage, "agent", agent, "backup", backup)
+	if hasArchiveBuckets(storageInfo.Buckets) {
+		candidates, _ := ListRotationCandidates(agentDir, storageInfo.MaxBackups)
+		bctx := BucketUploadContext{Agent: agent, Storage: storage, Backup: backup}
+		h.runArchivePreRotate(storageInfo, candidates, agentDir, bctx, logger)
+	}
+
+	removed, err := h.rotateBackups(storageInfo, agent, agentDir, logger)
+	for _, name := range removed {
+		logger.Info("backup rotated (deleted)", "file", name)
+		if h.Events != nil {
+			h.Events.PushEvent("warn", "backup_rotated", agent, fmt.Sprintf("deleted old backup: %s", name), 0)
+		}
+	}
+	h.collectDedupGarbage(storageInfo.BaseDir, removed, logger)
+	if err != nil {
+		return removed, fmt.Errorf("rotating %s/%s/%s: %w", storage, agent, backup, err)
+	}
+	return removed, nil
+}
+
+// QuarantineBackup move um backup para {agent}/{backup}/.quarantine/, onde ele
+// é preservado: fica fora da rotação, do sync retroativo e da contagem de
+// backups. Retorna o novo caminho. Implementa observability.BackupManager.
+func (h *Handler) QuarantineBackup(storage, agent, backup, file string) (string, error) {
+	storageInfo, agentDir, err := h.backupDir(storage, agent, backup)
+	if err != nil {
+		return "", err
+	}
+	if storageInfo.Immutable.Enabled {
+		return "", errImmutable
+	}
+	if validatePathComponent(file, "file") != nil || !isBackupFile(file) {
+		return "", fmt.Errorf("file %q is not a backup file: %w", file, observability.ErrInvalid)
+	}
+
+	src, ok := findBackup(agentDir, file)
+	if !ok {
+		return "", fmt.Errorf("backup %s: %w", file, observability.ErrNotFound)
+	}
+	qDir := filepath.Join(agentDir, quarantineDirName)
+	if err := os.MkdirAll(qDir, 0755); err != nil {
+		return "", fmt.Errorf("creating quarantine directory: %w", err)
+	}
+	dst := filepath.Join(qDir, file)
+	if err := os.Rename(src, dst); err != nil {
+		return "", fmt.Errorf("moving backup to quarantine: %w", err)
+	}
+
+	h.logger.Warn("backup quarantined", "storage", storage, "agent", agent, "backup", backup, "file", file)
+	if h.Events != nil {
+		h.Events.Push(observability.EventEntry{
+			Level:   "warn",
+			Type:    "backup_quarantined",
+			Agent:   agent,
+			Storage: storage,
+			Backup:  backup,
+			Message: fmt.Sprintf("%s/%s: %s moved to quarantine", storage, backup, file),
+		})
+	}
+	return dst, nil
+}
+
+// OpenBackup abre um backup do catálogo para download. Com quarantined, o
+// arquivo é procurado em {agent}/{backup}/.quarantine/. Manifests dedup são
+// reconstruídos em um arquivo temporário, cujo Name() é o do archive original.
+// Implementa observability.BackupManager.
+func (h *Handler) OpenBackup(storage, agent, backup, file string, quarantined bool) (*os.File, error) {
+	storageInfo, dir, err := h.backupDir(storage, agent, backup)
+	if err != nil {
+		return nil, err
+	}
+	if validatePathComponent(file, "file") != nil || !isBackupFile(file) {
+		return nil, fmt.Errorf("file %q is not a backup file: %w", file, observability.ErrInvalid)
+	}
+	if quarantined {
+		dir = filepath.Join(dir, quarantineDirName)
+	}
+	path, ok := findBackup(dir, file)
+	if !ok {
+		return nil, fmt.Errorf("backup %s: %w", file, observability.ErrNotFound)
+	}
+
+	if dedup.IsManifest(file) {
+		store, err := h.dedupStore(storageInfo.BaseDir)
+		if err != nil {
+			return nil, err
+		}
+		return store.Materialize(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("backup %s: %w", file, observability.ErrNotFound)
+	}
+	if fi, err := f.Stat(); err != nil || !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("backup %s: %w", file, observability.ErrNotFound)
+	}
+	return f, nil
+}
+
+// backupDir valida os nomes e resolve o diretório {base_dir}/{agent}/{backup}.
+func (h *Handler) backupDir(storage, agent, backup string) (storageInfo config.StorageInfo, dir string, err error) {
+	storageInfo, ok := h.config().GetStorage(storage)
+	if !ok {
+		return storageInfo, "", fmt.Errorf("storage %s: %w", storage, observability.ErrNotFound)
+	}
+	if err := validatePathComponent(agent, "agent"); err != nil {
+		return storageInfo, "", fmt.Errorf("%v: %w", err, observability.ErrInvalid)
+	}
+	if err := validatePathComponent(backup, "backup"); err != nil {
+		return storageInfo, "", fmt.Errorf("%v: %w", err, observability.ErrInvalid)
+	}
+	dir = filepath.Join(storageInfo.BaseDir, agent, backup)
+	if err := validatePathInBaseDir(storageInfo.BaseDir, dir); err != nil {
+		return storageInfo, "", fmt.Errorf("%v: %w", err, observability.ErrInvalid)
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return storageInfo, "", fmt.Errorf("backup %s/%s/%s: %w", storage, agent, backup, observability.ErrNotFound)
+	}
+	return storageInfo, dir, nil
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// writeBackups cria arquivos de backup vazios em {base}/{agent}/{backup}/.
+func writeBackups(t *testing.T, base, agent, backup string, names ...string) string {
+	t.Helper()
+	dir := filepath.Join(base, agent, backup)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBackupCatalog_ListsAndQuarantines(t *testing.T) {
+	base := t.TempDir()
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: base, MaxBackups: 5}})
+	dir := writeBackups(t, base, "web-01", "daily", "2025-01-01T00-00-00-000.tar.gz", "2025-01-02T00-00-00-000.tar.gz", "backup-1.tmp")
+	os.MkdirAll(filepath.Join(dir, "chunks_abc"), 0755)
+
+	if got := len(h.BackupCatalog()); got != 2 {
+		t.Fatalf("expected 2 catalog entries, got %d", got)
+	}
+
+	path, err := h.QuarantineBackup("default", "web-01", "daily", "2025-01-01T00-00-00-000.tar.gz")
+	if err != nil {
+		t.Fatalf("QuarantineBackup: %v", err)
+	}
+	if path != filepath.Join(dir, quarantineDirName, "2025-01-01T00-00-00-000.tar.gz") {
+		t.Errorf("unexpected quarantine path %s", path)
+	}
+
+	catalog := h.BackupCatalog()
+	if len(catalog) != 2 || catalog[0].Quarantined || !catalog[1].Quarantined {
+		t.Errorf("expected one live and one quarantined entry, got %+v", catalog)
+	}
+	if n := countBackups(base); n != 1 {
+		t.Errorf("expected quarantined backup out of the count, got %d", n)
+	}
+	if candidates, _ := ListRotationCandidates(dir, 0); len(candidates) != 0 {
+		t.Errorf("unexpected rotation candidates %v", candidates)
+	}
+
+	for name, args := range map[string][4]string{
+		"traversal":    {"default", "web-01", "daily", "../x.tar.gz"},
+		"not a backup": {"default", "web-01", "daily", "backup-1.tmp"},
+		"bad agent":    {"default", "..", "daily", "a.tar.gz"},
+	} {
+		if _, err := h.QuarantineBackup(args[0], args[1], args[2], args[3]); !errors.Is(err, observability.ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+	if _, err := h.QuarantineBackup("nope", "web-01", "daily", "a.tar.gz"); !errors.Is(err, observability.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for unknown storage, got %v", err)
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	base := t.TempDir()
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: base, MaxBackups: 1}})
+	writeBackups(t, base, "web-01", "daily", "2025-01-01T00-00-00-000.tar.gz", "2025-01-02T00-00-00-000.tar.gz")
+
+	removed, err := h.RotateBackups("default", "web-01", "daily")
+	if err != nil {
+		t.Fatalf("RotateBackups: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "2025-01-01T00-00-00-000.tar.gz" {
+		t.Errorf("unexpected removed list %v", removed)
+	}
+	if _, err := h.RotateBackups("default", "web-01", "weekly"); !errors.Is(err, observability.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing backup dir, got %v", err)
+	}
+}
+
+func TestCancelSession_Single(t *testing.T) {
+	base := t.TempDir()
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: base}})
+
+	tmpPath := filepath.Join(base, "backup-1.tmp")
+	os.WriteFile(tmpPath, []byte("partial"), 0644)
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	s := &PartialSession{TmpPath: tmpPath, AgentName: "web-01", StorageName: "default", CreatedAt: time.Now(), Phase: NewSessionPhaseTracker()}
+	s.attachConn(serverConn)
+	h.sessions.Store("s1", s)
+
+	if err := h.CancelSession("s1", ""); err != nil {
+		t.Fatalf("CancelSession: %v", err)
+	}
+	if !s.cancelled.Load() {
+		t.Error("expected session marked as cancelled")
+	}
+	if _, err := serverConn.Write([]byte("x")); err == nil {
+		t.Error("expected data connection closed")
+	}
+	if _, err := os.Stat(tmpPath); !os.IsNotExist(err) {
+		t.Error("expected tmp file removed")
+	}
+	if _, ok := h.sessions.Load("s1"); ok {
+		t.Error("expected session removed")
+	}
+	if err := h.CancelSession("s1", ""); !errors.Is(err, observability.ErrNotFound) {
+		t.Errorf("expected ErrNotFound on second cancel, got %v", err)
+	}
+}
+
+func TestCancelSession_RefusesAfterReceiving(t *testing.T) {
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: t.TempDir()}})
+	s := &PartialSession{AgentName: "web-01", Phase: NewSessionPhaseTracker()}
+	s.Phase.Set(PhaseVerifying)
+	h.sessions.Store("s1", s)
+
+	if err := h.CancelSession("s1", ""); !errors.Is(err, observability.ErrConflict) {
+		t.Errorf("cancel: expected ErrConflict, got %v", err)
+	}
+	if err := h.ExpireSession("s1"); !errors.Is(err, observability.ErrConflict) {
+		t.Errorf("expire: expected ErrConflict, got %v", err)
+	}
+}
+
+func TestCancelSession_SendsControlAbort(t *testing.T) {
+	base := t.TempDir()
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: base}})
+
+	tmpPath := filepath.Join(base, "backup-1.tmp")
+	os.WriteFile(tmpPath, []byte("partial"), 0644)
+	h.sessions.Store("s1", &PartialSession{TmpPath: tmpPath, AgentName: "web-01", StorageName: "default", CreatedAt: time.Now(), Phase: NewSessionPhaseTracker()})
+
+	serverConn, agentConn := net.Pipe()
+	defer agentConn.Close()
+	h.controlConns.Store("web-01", &ControlConnInfo{Conn: serverConn})
+	h.controlConnsMu.Store("web-01", &sync.Mutex{})
+
+	if err := h.CancelSession("s1", "disk_full"); !errors.Is(err, observability.ErrInvalid) {
+		t.Fatalf("expected ErrInvalid for reserved reason, got %v", err)
+	}
+	if _, ok := h.sessions.Load("s1"); !ok {
+		t.Fatal("expected session kept after invalid reason")
+	}
+
+	received := make(chan *protocol.ControlAbort, 1)
+	go func() {
+		if magic, err := protocol.ReadControlMagic(agentConn); err == nil && magic == protocol.MagicControlAbort {
+			abort, _ := protocol.ReadControlAbortPayload(agentConn)
+			received <- abort
+		}
+		close(received)
+	}()
+
+	if err := h.CancelSession("s1", "maintenance"); err != nil {
+		t.Fatalf("CancelSession: %v", err)
+	}
+	select {
+	case abort := <-received:
+		if abort == nil || abort.Reason != protocol.AbortReasonMaintenance || abort.SessionID != "s1" {
+			t.Errorf("unexpected ControlAbort %+v", abort)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ControlAbort not sent")
+	}
+	if _, err := os.Stat(tmpPath); !os.IsNotExist(err) {
+		t.Error("expected tmp file removed")
+	}
+}
+
+func TestExpireSession_Single(t *testing.T) {
+	base := t.TempDir()
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: base}})
+	h.ensureEventStore()
+
+	tmpPath := filepath.Join(base, "backup-1.tmp")
+	os.WriteFile(tmpPath, []byte("partial"), 0644)
+	s := &PartialSession{TmpPath: tmpPath, AgentName: "web-01", StorageName: "default", CreatedAt: time.Now(), Phase: NewSessionPhaseTracker()}
+	s.LastActivity.Store(time.Now().UnixNano())
+	h.sessions.Store("s1", s)
+
+	if err := h.ExpireSession("s1"); err != nil {
+		t.Fatalf("ExpireSession: %v", err)
+	}
+	if _, ok := h.sessions.Load("s1"); ok {
+		t.Error("expected session removed")
+	}
+	if _, err := os.Stat(tmpPath); !os.IsNotExist(err) {
+		t.Error("expected tmp file removed")
+	}
+	var expired bool
+	for _, e := range h.Events.Recent(10) {
+		expired = expired || e.Type == "session_expired"
+	}
+	if !expired {
+		t.Error("expected session_expired event")
+	}
+}
+
+func TestControlSessionCancel_FromAgent(t *testing.T) {
+	base := t.TempDir()
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: base}})
+
+	// Sem certificado (net.Pipe) o agent do control channel é o remote address: "pipe"
+	newSession := func(id, agent string) *PartialSession {
+		tmpPath := filepath.Join(base, id+".tmp")
+		os.WriteFile(tmpPath, []byte("partial"), 0644)
+		s := &PartialSession{TmpPath: tmpPath, AgentName: agent, StorageName: "default", CreatedAt: time.Now(), Phase: NewSessionPhaseTracker()}
+		h.sessions.Store(id, s)
+		return s
+	}
+	newSession("own", "pipe")
+	newSession("foreign", "web-01")
+
+	serverConn, agentConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		h.handleControlChannel(context.Background(), serverConn, slog.Default())
+		close(done)
+	}()
+
+	agentConn.Write([]byte{0, 0, 0, 30})
+	agentConn.Write([]byte("test\n"))
+	protocol.WriteControlStatsPayload(agentConn, 0, 0, 0, 0)
+	protocol.WriteControlSessionCancel(agentConn, "foreign")
+	protocol.WriteControlSessionCancel(agentConn, "own")
+	protocol.WriteControlPing(agentConn, time.Now().UnixNano())
+	protocol.ReadControlMagic(agentConn) // pong: os frames anteriores já foram processados
+	agentConn.Close()
+	<-done
+
+	if _, ok := h.sessions.Load("own"); ok {
+		t.Error("expected own session cancelled")
+	}
+	if _, ok := h.sessions.Load("foreign"); !ok {
+		t.Error("expected session of another agent kept")
+	}
+}
+
+func TestOpenBackup(t *testing.T) {
+	base := t.TempDir()
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: base}})
+	dir := writeBackups(t, base, "web-01", "daily", "2025-01-01T00-00-00-000.tar.gz", "backup-1.tmp")
+	writeBackups(t, dir, quarantineDirName, "", "2024-12-31T00-00-00-000.tar.gz")
+
+	f, err := h.OpenBackup("default", "web-01", "daily", "2025-01-01T00-00-00-000.tar.gz", false)
+	if err != nil {
+		t.Fatalf("OpenBackup: %v", err)
+	}
+	f.Close()
+	if f, err := h.OpenBackup("default", "web-01", "daily", "2024-12-31T00-00-00-000.tar.gz", true); err != nil {
+		t.Errorf("OpenBackup quarantined: %v", err)
+	} else {
+		f.Close()
+	}
+
+	if _, err := h.OpenBackup("default", "web-01", "daily", "2024-12-31T00-00-00-000.tar.gz", false); !errors.Is(err, observability.ErrNotFound) {
+		t.Errorf("expected ErrNotFound outside quarantine, got %v", err)
+	}
+	for _, file := range []string{"backup-1.tmp", "../daily/x.tar.gz"} {
+		if _, err := h.OpenBackup("default", "web-01", "daily", file, false); !errors.Is(err, observability.ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", file, err)
+		}
+	}
+}
@@ -20,8 +20,11 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/logging"
 	"github.com/nishisan-dev/n-backup/internal/server/observability"
 )
 
@@ -39,6 +42,11 @@ func (h *Handler) MetricsSnapshot() observability.MetricsData {
 		ActiveConns: h.ActiveConns.Load(),
 		Sessions:    sessionCount,
 		ChunkBuffer: h.ChunkBufferStats(),
+		Handshakes:  h.handshakes.Stats(),
+
+		IngestThrottle: h.ingest.stats(),
+		DiskQueues:     h.disk.stats(),
+		OrphanSweep:    h.OrphanSweepStats(),
 	}
 }
 
@@ -119,21 +127,88 @@ func (h *Handler) ConnectedAgents() []observability.AgentInfo {
 	return agents
 }
 
+// newSessionConfigSnapshot captura a configuração efetiva de uma sessão.
+// maxStreams e chunkSize são 0 em sessões single-stream.
+func newSessionConfigSnapshot(si config.StorageInfo, maxStreams uint8, chunkSize uint32) *observability.SessionConfigSnapshot {
+	snap := &observability.SessionConfigSnapshot{
+		CompressionMode:     si.CompressionMode,
+		AssemblerMode:       si.AssemblerMode,
+		AssemblerPendingMem: si.AssemblerPendingMem,
+		ChunkShardLevels:    si.ChunkShardLevels,
+		ChunkFsync:          si.FsyncChunkWrites(),
+		VerifyIntegrity:     si.VerifyIntegrity,
+		MaxBackups:          si.MaxBackups,
+		BackupWindow:        si.BackupWindow,
+		MaxStreams:          int(maxStreams),
+		ChunkSize:           int(chunkSize),
+	}
+	for _, b := range si.Buckets {
+		snap.Buckets = append(snap.Buckets, b.Name+":"+b.Mode)
+	}
+	return snap
+}
+
 // recordSessionEnd registra uma sessão finalizada no SessionHistoryRing.
 // Chamado quando um backup (single ou parallel) termina com qualquer resultado.
-func (h *Handler) recordSessionEnd(sessionID, agent, storage, backup, mode, compression, result string, startedAt time.Time, bytesTotal int64) {
+// snap é a configuração efetiva capturada no início da sessão (pode ser nil).
+// streams traz os totais de transferência por stream reportados pelo agent
+// (nil em sessões single ou quando o agent não enviou ControlSessionSummary).
+func (h *Handler) recordSessionEnd(sessionID, agent, storage, backup, mode, compression, result string, startedAt time.Time, bytesTotal int64, snap *observability.SessionConfigSnapshot, streams []observability.StreamTransfer) {
+	// Emite evento de sessão finalizada (também consumido pelos webhooks,
+	// que funcionam sem a WebUI)
+	if h.Events != nil {
+		level := "info"
+		if result != "ok" {
+			level = "error"
+		}
+		h.Events.Push(observability.EventEntry{
+			Level:   level,
+			Type:    "session_end",
+			Agent:   agent,
+			Storage: storage,
+			Backup:  backup,
+			Result:  result,
+			Bytes:   bytesTotal,
+			Message: fmt.Sprintf("%s/%s %s (%s)", storage, backup, result, mode),
+		})
+	}
+
+	h.auditEnd(sessionID, agent, storage, backup, mode, compression, result, startedAt, bytesTotal, streams)
+	if h.Accounting != nil {
+		h.Accounting.Add(agent, storage, result, bytesTotal, time.Now())
+	}
+
 	if h.SessionHistory == nil {
 		return
 	}
 	now := time.Now()
 
-	// Emite evento de sessão finalizada
-	if h.Events != nil {
-		level := "info"
-		if result != "ok" {
-			level = "error"
+	// Compara com a sessão anterior do mesmo agent/storage/backup para registrar mudanças de config
+	var configHash string
+	var configChanges []string
+	if snap != nil {
+		configHash = config.SnapshotHash(snap)
+		history := h.SessionHistory.Recent(0)
+		for i := len(history) - 1; i >= 0; i-- {
+			prev := history[i]
+			if prev.Agent == agent && prev.Storage == storage && prev.Backup == backup && prev.Config != nil {
+				if prev.ConfigHash != configHash {
+					configChanges = config.SnapshotDiff(prev.Config, snap)
+				}
+				break
+			}
 		}
-		h.Events.PushEvent(level, "session_end", agent, fmt.Sprintf("%s/%s %s (%s)", storage, backup, result, mode), 0)
+	}
+
+	// Overhead de retransmissão agregado a partir dos totais por stream
+	var sentTotal, retransmitTotal int64
+	for _, s := range streams {
+		sentTotal += s.BytesSent
+		retransmitTotal += s.RetransmitBytes
+	}
+	var overheadPct float64
+	if sentTotal > 0 {
+		overheadPct = float64(retransmitTotal) * 100 / float64(sentTotal)
 	}
 
 	h.SessionHistory.Push(observability.SessionHistoryEntry{
@@ -148,7 +223,20 @@ func (h *Handler) recordSessionEnd(sessionID, agent, storage, backup, mode, comp
 		Duration:    now.Sub(startedAt).Truncate(time.Second).String(),
 		BytesTotal:  bytesTotal,
 		Result:      result,
+		Empty:       result == "ok" && bytesTotal == 0,
+
+		RetransmitBytes:       retransmitTotal,
+		RetransmitOverheadPct: overheadPct,
+		Streams:               streams,
+
+		ConfigHash:    configHash,
+		Config:        snap,
+		ConfigChanges: configChanges,
 	})
+
+	if len(configChanges) > 0 && h.Events != nil {
+		h.Events.PushEvent("info", "session_config_changed", agent, fmt.Sprintf("%s/%s: %s", storage, backup, strings.Join(configChanges, "; ")), 0)
+	}
 }
 
 // SessionHistorySnapshot retorna as últimas sessões finalizadas.
@@ -159,6 +247,15 @@ func (h *Handler) SessionHistorySnapshot() []observability.SessionHistoryEntry {
 	return h.SessionHistory.Recent(0)
 }
 
+// QuerySessionHistory consulta o histórico persistido de sessões finalizadas.
+// Implementa observability.SessionHistoryQuerier.
+func (h *Handler) QuerySessionHistory(f observability.SessionHistoryFilter) ([]observability.SessionHistoryEntry, error) {
+	if h.SessionHistory == nil {
+		return []observability.SessionHistoryEntry{}, nil
+	}
+	return h.SessionHistory.Query(f)
+}
+
 // ActiveSessionHistorySnapshot retorna snapshots periódicos de sessões ativas.
 func (h *Handler) ActiveSessionHistorySnapshot(sessionID string, limit int) []observability.ActiveSessionSnapshotEntry {
 	if h.ActiveSessionHistory == nil {
@@ -209,7 +306,7 @@ func (h *Handler) SyncStatusSnapshot() observability.SyncStatusDTO {
 			}
 
 			status.Progress = &observability.SyncProgressDTO{
-				CurrentFile:    currentFile,
+				CurrentFile:    logging.Redact(currentFile),
 				CurrentBucket:  currentBucket,
 				TotalFiles:     total,
 				ProcessedFiles: processed,
@@ -236,7 +333,7 @@ func (h *Handler) SyncStatusSnapshot() observability.SyncStatusDTO {
 				Skipped:     b.Skipped,
 				Errors:      b.Errors,
 				Duration:    b.Duration.Truncate(time.Millisecond).String(),
-				Error:       b.Error,
+				Error:       logging.Redact(b.Error),
 			})
 		}
 		status.LastResult = &observability.SyncResultDTO{
@@ -272,25 +369,11 @@ func (h *Handler) SessionsSnapshot() []observability.SessionSummary {
 
 		switch s := value.(type) {
 		case *PartialSession:
-			lastAct := time.Unix(0, s.LastActivity.Load())
 			phase := ""
 			if s.Phase != nil {
 				phase = s.Phase.Get()
 			}
-			sessions = append(sessions, observability.SessionSummary{
-				SessionID:     sessionID,
-				Agent:         s.AgentName,
-				Storage:       s.StorageName,
-				Backup:        s.BackupName,
-				Mode:          "single",
-				Compression:   s.CompressionMode,
-				StartedAt:     s.CreatedAt.Format(time.RFC3339),
-				LastActivity:  lastAct.Format(time.RFC3339),
-				BytesReceived: s.BytesWritten.Load(),
-				ActiveStreams: 1,
-				Status:        sessionStatus(lastAct),
-				Phase:         phase,
-			})
+			sessions = append(sessions, s.summary(sessionID, phase))
 
 		case *ParallelSession:
 			lastAct := time.Unix(0, s.LastActivity.Load())
@@ -306,16 +389,7 @@ func (h *Handler) SessionsSnapshot() []observability.SessionSummary {
 			totalObj := s.TotalObjects.Load()
 			sentObj := s.ObjectsSent.Load()
 			walkDone := s.WalkComplete.Load() != 0
-			eta := "∞"
-			if walkDone && totalObj > 0 && sentObj > 0 && sentObj < totalObj {
-				elapsed := time.Since(s.CreatedAt).Seconds()
-				rate := float64(sentObj) / elapsed
-				remaining := float64(totalObj - sentObj)
-				etaSecs := remaining / rate
-				eta = (time.Duration(etaSecs) * time.Second).Truncate(time.Second).String()
-			} else if walkDone && sentObj >= totalObj && totalObj > 0 {
-				eta = "0s"
-			}
+			eta := objectsETA(s.CreatedAt, totalObj, sentObj, walkDone)
 
 			// Assembly stats (single call)
 			asmStats := s.Assembler.Stats()
@@ -405,26 +479,12 @@ func (h *Handler) SessionDetail(id string) (*observability.SessionDetail, bool)
 
 	switch s := raw.(type) {
 	case *PartialSession:
-		lastAct := time.Unix(0, s.LastActivity.Load())
 		phase := ""
 		if s.Phase != nil {
 			phase = s.Phase.Get()
 		}
 		return &observability.SessionDetail{
-			SessionSummary: observability.SessionSummary{
-				SessionID:     id,
-				Agent:         s.AgentName,
-				Storage:       s.StorageName,
-				Backup:        s.BackupName,
-				Mode:          "single",
-				Compression:   s.CompressionMode,
-				StartedAt:     s.CreatedAt.Format(time.RFC3339),
-				LastActivity:  lastAct.Format(time.RFC3339),
-				BytesReceived: s.BytesWritten.Load(),
-				ActiveStreams: 1,
-				Status:        sessionStatus(lastAct),
-				Phase:         phase,
-			},
+			SessionSummary:     s.summary(id, phase),
 			IntegrityProgress:  h.buildIntegrityProgressDTO(s.IntProgress),
 			PostCommitProgress: h.buildPostCommitProgressDTO(s.PCProgress),
 		}, true
@@ -450,7 +510,7 @@ func (h *Handler) SessionDetail(id string) (*observability.SessionDetail, bool)
 			// evaluateFlowRotation faz Swap(0) nos contadores TrafficIn.
 			// Sem FlowRotation, lê direto do TrafficIn acumulado.
 			var mbps float64
-			if h.cfg.FlowRotation.Enabled {
+			if h.config().FlowRotation.Enabled {
 				mbps = float64(slot.TickBytes.Load()) / 15.0 / (1024 * 1024)
 			} else {
 				mbps = float64(slot.TrafficIn.Load()) / 15.0 / (1024 * 1024)
@@ -483,7 +543,7 @@ func (h *Handler) SessionDetail(id string) (*observability.SessionDetail, bool)
 				IdleSecs:            idleSecs,
 				SlowSince:           slowSince,
 				Active:              active,
-				Status:              streamStatus(active, idleSecs, slowSince, h.cfg.FlowRotation.EvalWindow, status),
+				Status:              streamStatus(active, idleSecs, slowSince, h.config().FlowRotation.EvalWindow, status),
 				ConnectedFor:        connectedFor,
 				Reconnects:          reconnects,
 				Rotations:           slot.Rotations.Load(),
@@ -503,16 +563,7 @@ func (h *Handler) SessionDetail(id string) (*observability.SessionDetail, bool)
 		totalObj := s.TotalObjects.Load()
 		sentObj := s.ObjectsSent.Load()
 		walkDone := s.WalkComplete.Load() != 0
-		eta := "∞"
-		if walkDone && totalObj > 0 && sentObj > 0 && sentObj < totalObj {
-			elapsed := time.Since(s.CreatedAt).Seconds()
-			rate := float64(sentObj) / elapsed // objetos/s
-			remaining := float64(totalObj - sentObj)
-			etaSecs := remaining / rate
-			eta = (time.Duration(etaSecs) * time.Second).Truncate(time.Second).String()
-		} else if walkDone && sentObj >= totalObj && totalObj > 0 {
-			eta = "0s"
-		}
+		eta := objectsETA(s.CreatedAt, totalObj, sentObj, walkDone)
 
 		// Assembly stats (single call)
 		asmStats := s.Assembler.Stats()
@@ -676,6 +727,54 @@ func formatBytesGo(b int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
 }
 
+// summary monta o resumo de uma sessão single-stream. Com progresso reportado
+// pelo agent para esta sessão (ControlProgress, ver applyControlProgress),
+// inclui objetos e ETA, e o status considera o último progresso: um produtor
+// lento que ainda não emitiu bytes não aparece como degradado.
+func (s *PartialSession) summary(id, phase string) observability.SessionSummary {
+	lastAct := time.Unix(0, s.LastActivity.Load())
+	summary := observability.SessionSummary{
+		SessionID:     id,
+		Agent:         s.AgentName,
+		Storage:       s.StorageName,
+		Backup:        s.BackupName,
+		Mode:          "single",
+		Compression:   s.CompressionMode,
+		StartedAt:     s.CreatedAt.Format(time.RFC3339),
+		LastActivity:  lastAct.Format(time.RFC3339),
+		BytesReceived: s.BytesWritten.Load(),
+		ActiveStreams: 1,
+		Status:        sessionStatus(lastAct),
+		Phase:         phase,
+	}
+	if lastProg := s.LastProgress.Load(); lastProg != 0 {
+		summary.TotalObjects = s.TotalObjects.Load()
+		summary.ObjectsSent = s.ObjectsSent.Load()
+		summary.WalkComplete = s.WalkComplete.Load() != 0
+		summary.ETA = objectsETA(s.CreatedAt, summary.TotalObjects, summary.ObjectsSent, summary.WalkComplete)
+		if t := time.Unix(0, lastProg); t.After(lastAct) {
+			summary.Status = sessionStatus(t)
+		}
+	}
+	return summary
+}
+
+// objectsETA estima o tempo restante pelo ritmo de objetos enviados desde
+// startedAt: "∞" até o prescan do agent completar, "0s" com todos enviados.
+func objectsETA(startedAt time.Time, total, sent uint32, walkDone bool) string {
+	switch {
+	case !walkDone || total == 0:
+		return "∞"
+	case sent >= total:
+		return "0s"
+	case sent == 0:
+		return "∞"
+	}
+	rate := float64(sent) / time.Since(startedAt).Seconds() // objetos/s
+	etaSecs := float64(total-sent) / rate
+	return (time.Duration(etaSecs) * time.Second).Truncate(time.Second).String()
+}
+
 // sessionStatus determina o status de uma sessão baseado na última atividade.
 func sessionStatus(lastActivity time.Time) string {
 	idle := time.Since(lastActivity)
@@ -742,10 +841,15 @@ func (h *Handler) StartStatsReporter(ctx context.Context) {
 			// Flow Rotation ANTES do reset de counters globais.
 			// evaluateFlowRotation faz Swap(0) nos StreamTrafficIn,
 			// garantindo que lê os bytes reais do intervalo.
-			if h.cfg.FlowRotation.Enabled {
+			if h.config().FlowRotation.Enabled {
 				h.evaluateFlowRotation(secs)
 			}
 
+			// Chaos mode: rotações aleatórias independentes do throughput
+			if h.chaos != nil {
+				h.injectChaosRotations()
+			}
+
 			// Swap-and-reset: lê o acumulado e zera
 			trafficIn := h.TrafficIn.Swap(0)
 			diskWrite := h.DiskWrite.Swap(0)
@@ -771,9 +875,20 @@ func (h *Handler) StartStatsReporter(ctx context.Context) {
 				"disk_write_total_MB", fmt.Sprintf("%.1f", float64(diskWrite)/(1024*1024)),
 			)
 
+			// Fila de handshakes TLS — só loga quando há contenção
+			if hs := h.handshakes.Stats(); hs != nil && (hs.Queued > 0 || hs.InFlight >= int32(hs.MaxConcurrent)) {
+				h.logger.Warn("tls handshake contention",
+					"in_flight", hs.InFlight,
+					"queued", hs.Queued,
+					"max_concurrent", hs.MaxConcurrent,
+					"rejected_total", hs.Rejected,
+					"avg_queue_wait_ms", fmt.Sprintf("%.1f", hs.AvgQueueWaitMs),
+				)
+			}
+
 			// Per-stream stats (configurável) — usa Load() porque
 			// evaluateFlowRotation já fez Swap(0) nos counters.
-			if h.cfg.Logging.StreamStats {
+			if h.config().Logging.StreamStats {
 				h.logPerStreamStats(secs)
 			}
 		}
@@ -795,7 +910,7 @@ func (h *Handler) logPerStreamStats(intervalSecs float64) {
 			// Caso contrário, precisamos fazer o Swap(0) aqui para
 			// exibir a taxa do intervalo (não acumulativa).
 			var bytes int64
-			if h.cfg.FlowRotation.Enabled {
+			if h.config().FlowRotation.Enabled {
 				// Em flow rotation, o contador já foi consumido por evaluateFlowRotation.
 				// Usa snapshot do último tick para manter o log fiel ao intervalo.
 				bytes = slot.TickBytes.Load()
@@ -0,0 +1,126 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func TestObjectsETA(t *testing.T) {
+	started := time.Now().Add(-100 * time.Second)
+	tests := []struct {
+		name        string
+		total, sent uint32
+		walkDone    bool
+		want        string
+	}{
+		{"prescan running", 0, 500, false, "∞"},
+		{"nothing sent", 1000, 0, true, "∞"},
+		{"halfway", 1000, 500, true, "1m40s"},
+		{"all sent", 1000, 1000, true, "0s"},
+	}
+	for _, tt := range tests {
+		got := objectsETA(started, tt.total, tt.sent, tt.walkDone)
+		// Tolera o segundo que pode passar entre started e o cálculo
+		if got != tt.want && !(tt.want == "1m40s" && got == "1m39s") {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSessionsSnapshot_SingleStreamProgress(t *testing.T) {
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: t.TempDir()}})
+
+	// Sem ControlProgress: nenhum campo de progresso, como antes
+	quiet := &PartialSession{AgentName: "db-01", StorageName: "default", CreatedAt: time.Now()}
+	quiet.LastActivity.Store(time.Now().Add(-5 * time.Minute).UnixNano())
+	h.sessions.Store("quiet", quiet)
+
+	// Produtor lento: sem bytes há 5min, mas reportando progresso
+	busy := &PartialSession{AgentName: "web-01", StorageName: "default", CreatedAt: time.Now().Add(-10 * time.Minute)}
+	busy.LastActivity.Store(time.Now().Add(-5 * time.Minute).UnixNano())
+	busy.TotalObjects.Store(4000)
+	busy.ObjectsSent.Store(1000)
+	busy.WalkComplete.Store(1)
+	busy.LastProgress.Store(time.Now().UnixNano())
+	h.sessions.Store("busy", busy)
+
+	summaries := map[string]bool{}
+	for _, s := range h.SessionsSnapshot() {
+		summaries[s.SessionID] = true
+		switch s.SessionID {
+		case "quiet":
+			if s.ETA != "" || s.TotalObjects != 0 || s.Status != "degraded" {
+				t.Errorf("quiet: unexpected summary %+v", s)
+			}
+		case "busy":
+			if s.TotalObjects != 4000 || s.ObjectsSent != 1000 || !s.WalkComplete {
+				t.Errorf("busy: unexpected progress %+v", s)
+			}
+			if s.ETA != "30m0s" && s.ETA != "29m59s" {
+				t.Errorf("busy: unexpected ETA %q", s.ETA)
+			}
+			if s.Status != "running" {
+				t.Errorf("busy: expected running while reporting progress, got %s", s.Status)
+			}
+		}
+	}
+	if !summaries["quiet"] || !summaries["busy"] {
+		t.Fatalf("missing sessions in snapshot: %v", summaries)
+	}
+
+	detail, ok := h.SessionDetail("busy")
+	if !ok || detail.ETA == "" || detail.ObjectsSent != 1000 || detail.Mode != "single" {
+		t.Fatalf("unexpected detail %+v", detail)
+	}
+}
+
+func TestSessionsSnapshot_ProgressPerSession(t *testing.T) {
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: t.TempDir()}})
+
+	// Duas sessões single-stream do mesmo agent ("pipe": net.Pipe sem certificado)
+	start := time.Now().Add(-10 * time.Minute)
+	for _, id := range []string{"home", "db"} {
+		s := &PartialSession{AgentName: "pipe", StorageName: "default", CreatedAt: start}
+		s.LastActivity.Store(start.UnixNano())
+		h.sessions.Store(id, s)
+	}
+
+	serverConn, agentConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		h.handleControlChannel(context.Background(), serverConn, slog.Default())
+		close(done)
+	}()
+	agentConn.Write([]byte{0, 0, 0, 30})
+	agentConn.Write([]byte("test\n"))
+	protocol.WriteControlStatsPayload(agentConn, 0, 0, 0, 0)
+	protocol.WriteControlSessionProgress(agentConn, "home", 4000, 1000, true)
+	protocol.WriteControlPing(agentConn, time.Now().UnixNano())
+	protocol.ReadControlMagic(agentConn)
+	agentConn.Close()
+	<-done
+
+	// Só a sessão reportada ganha progresso, ETA e status pelo progresso
+	for _, s := range h.SessionsSnapshot() {
+		switch s.SessionID {
+		case "home":
+			if s.ObjectsSent != 1000 || (s.ETA != "30m0s" && s.ETA != "29m59s") || s.Status != "running" {
+				t.Errorf("home: unexpected summary %+v", s)
+			}
+		case "db":
+			if s.ObjectsSent != 0 || s.ETA != "" || s.Status != "degraded" {
+				t.Errorf("db: expected no progress from another session's report, got %+v", s)
+			}
+		}
+	}
+}
@@ -10,12 +10,15 @@
 //   - receiveParallelStream — recebe chunks com ChunkHeader framing por stream
 //   - readParallelChunkPayload — lê payload de um chunk individual
 //   - handleParallelJoin — processa conexões secundárias (join/re-join)
+//   - serveParallelSession — conexão primária (ver também parallel_resume.go)
+//   - handleMux — conexão multiplexada (PMUX): streams lógicos com ParallelJoin
 //   - validateAndCommitWithTrailer — validação e commit para backup paralelo
 //
 // O fluxo paralelo funciona assim:
 //   1. Agent envia handshake + ParallelInit (MaxStreams, ChunkSize)
 //   2. Server cria ParallelSession com slots pré-alocados
-//   3. Agent abre N conexões secundárias via ParallelJoin (PJIN)
+//   3. Agent abre N conexões secundárias via ParallelJoin (PJIN), ou N streams
+//      lógicos em uma única conexão multiplexada (PMUX)
 //   4. Cada stream envia chunks com ChunkHeader (GlobalSeq + Length + SlotID)
 //   5. Server monta arquivo via ChunkAssembler (in-order ou buffered)
 //   6. Agent envia ControlIngestionDone quando toda ingestão terminou
@@ -40,7 +43,9 @@ import (
 
 	"github.com/nishisan-dev/n-backup/internal/config"
 	"github.com/nishisan-dev/n-backup/internal/logging"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
 	"github.com/nishisan-dev/n-backup/internal/protocol"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
 )
 
 // ParallelSession rastreia uma sessão de backup com streams paralelos.
@@ -51,10 +56,12 @@ type ParallelSession struct {
 	StorageInfo     config.StorageInfo
 	AgentName       string
 	StorageName     string
+	Placement       string // placement pedido no handshake ("" = storage pedido diretamente)
 	BackupName      string
 	Slots           []*Slot // pré-alocados no ParallelInitACK, indexados por SlotID
 	MaxStreams      uint8
 	ChunkSize       uint32
+	ChunkSizeMax    uint32         // maior Length de chunk aceito (ParallelInit v8+; antes, ChunkSize)
 	StreamWg        sync.WaitGroup // barreira para todos os streams
 	Closing         atomic.Bool    // true após StreamWg.Wait() retornar — rejeita novos Add()
 	StreamReady     chan struct{}  // fechado quando o primeiro stream conecta
@@ -68,15 +75,37 @@ type ParallelSession struct {
 	WalkComplete    atomic.Int32  // 1 = prescan concluído, total confiável (via ControlProgress)
 	ClientVersion   string        // Versão do client (protocolo v3+)
 	AutoScaleInfo   atomic.Value  // *observability.AutoScaleInfo (atualizado via ControlAutoScaleStats)
+	ServerLoad      atomic.Bool   // algum stream anunciou JoinFlagServerLoad: recebe ControlServerLoad
+	StreamLimit     atomic.Bool   // algum stream anunciou JoinFlagStreamLimit: recebe ControlStreamLimit
+	StreamLimitSent atomic.Uint32 // último teto enviado via ControlStreamLimit (0 = nenhum)
+
+	// Config é o snapshot da configuração efetiva no início da sessão (session history).
+	Config *observability.SessionConfigSnapshot
+
 	IngestionDone    chan struct{} // fechado quando agent envia ControlIngestionDone
+	TransferSummary  atomic.Pointer[protocol.ControlSessionSummary] // totais por stream (via ControlSessionSummary)
 	ingestionOnce    sync.Once     // garante close único do IngestionDone
 	Aborted          chan struct{} // fechado quando a sessão é abortada antes do finalize
 	abortOnce        sync.Once     // garante close único do Aborted
 	AbortErr         atomic.Value  // error do aborto (quando houver)
+	NACKs            chunkNACKs    // chunks rejeitados por CRC32 aguardando retransmissão
 	ControlLost      chan struct{} // fechado quando o control channel deste agent cai
 	controlLostMu    sync.Mutex    // protege ControlLost + controlLostOnce para reset thread-safe
 	controlLostOnce  sync.Once     // garante close único do ControlLost
 
+	// Resume (server.sessions_file / restart do agent): Checkpoint é o último
+	// prefixo durável do arquivo montado (nil = sessão não retomável). Uma
+	// sessão restaurada após restart do server fica Detached — sem conexão
+	// primária — até o RESUME do agent; uma sessão ativa é liberada pela
+	// goroutine primária quando um RESUME a assume (handover).
+	Checkpoint   atomic.Pointer[AssemblerCheckpoint]
+	Detached     atomic.Bool
+	claimed      atomic.Bool   // um RESUME já assumiu a sessão
+	handover     chan struct{} // fechado pelo RESUME que assume uma sessão ativa
+	handoverOnce sync.Once     // garante close único do handover
+	handedOver   atomic.Bool   // a goroutine primária liberou a sessão com checkpoint
+	released     chan struct{} // fechado quando a goroutine primária retorna
+
 	// Lifecycle phases — rastreamento de fase pós-streaming para WebUI
 	Phase      *SessionPhaseTracker // fase atual da sessão
 	IntProgress *IntegrityProgress   // progresso da verificação de integridade (nil quando não ativo)
@@ -85,6 +114,25 @@ type ParallelSession struct {
 	Logger *slog.Logger // Session logger (enriquecido com session_log_dir quando habilitado)
 }
 
+// streamTransfers converte o ControlSessionSummary recebido do agent nos
+// totais por stream do session history. Retorna nil se o agent não enviou.
+func (ps *ParallelSession) streamTransfers() []observability.StreamTransfer {
+	summary := ps.TransferSummary.Load()
+	if summary == nil {
+		return nil
+	}
+	streams := make([]observability.StreamTransfer, 0, len(summary.Streams))
+	for _, s := range summary.Streams {
+		streams = append(streams, observability.StreamTransfer{
+			Stream:          s.StreamIndex,
+			BytesSent:       int64(s.BytesSent),
+			GoodputBytes:    int64(s.BytesSent - min(s.RetransmitBytes, s.BytesSent)),
+			RetransmitBytes: int64(s.RetransmitBytes),
+		})
+	}
+	return streams
+}
+
 // signalControlLost fecha o channel ControlLost de forma segura (idempotente).
 // Chamado por handleControlChannel quando o control channel do agent é encerrado.
 func (ps *ParallelSession) signalControlLost() {
@@ -103,6 +151,27 @@ func (ps *ParallelSession) resetControlLost() {
 	ps.controlLostOnce = sync.Once{}
 }
 
+// newParallelSession cria uma sessão paralela com os slots pré-alocados e os
+// channels de sinalização; o chamador preenche identidade e staging.
+func newParallelSession(sessionID string, maxStreams uint8, createdAt time.Time) *ParallelSession {
+	ps := &ParallelSession{
+		SessionID:     sessionID,
+		Slots:         PreallocateSlots(maxStreams),
+		MaxStreams:    maxStreams,
+		StreamReady:   make(chan struct{}),
+		Done:          make(chan struct{}),
+		CreatedAt:     createdAt,
+		IngestionDone: make(chan struct{}),
+		Aborted:       make(chan struct{}),
+		ControlLost:   make(chan struct{}),
+		handover:      make(chan struct{}),
+		released:      make(chan struct{}),
+		Phase:         NewSessionPhaseTracker(),
+	}
+	ps.LastActivity.Store(time.Now().UnixNano())
+	return ps
+}
+
 // abort marca a sessão como abortada, fecha o channel Aborted e cancela todos os slots.
 func (ps *ParallelSession) abort(err error) {
 	if err != nil {
@@ -112,7 +181,11 @@ func (ps *ParallelSession) abort(err error) {
 	ps.abortOnce.Do(func() {
 		close(ps.Aborted)
 	})
+	ps.closeSlots()
+}
 
+// closeSlots cancela as goroutines dos streams e fecha suas conexões.
+func (ps *ParallelSession) closeSlots() {
 	for _, slot := range ps.Slots {
 		if slot.CancelFn != nil {
 			slot.CancelFn()
@@ -141,25 +214,12 @@ func (ps *ParallelSession) aborted() (error, bool) {
 // handleParallelBackup processa um backup paralelo.
 // A conexão primária é usada apenas como canal de controle (Trailer + FinalACK).
 // Todos os dados são recebidos via streams secundários (ParallelJoin).
-func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io.Reader, sessionID, agentName, storageName, backupName, clientVersion string, storageInfo config.StorageInfo, pi *protocol.ParallelInit, lockKey string, logger *slog.Logger) {
-	defer h.locks.Delete(lockKey)
-
+func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io.Reader, sessionID, agentName, storageName, placement, backupName, clientVersion string, storageInfo config.StorageInfo, pi *protocol.ParallelInit, lockKey string, logger *slog.Logger) {
 	logger = logger.With("session", sessionID, "mode", "parallel", "maxStreams", pi.MaxStreams)
 
 	// Session logger: grava logs desta sessão em arquivo dedicado para post-mortem.
-	var sessionLogPath string
-	if h.cfg.Logging.SessionLogDir != "" {
-		var sessionLogCloser io.Closer
-		var slErr error
-		logger, sessionLogCloser, sessionLogPath, slErr = logging.NewSessionLogger(
-			logger, h.cfg.Logging.SessionLogDir, agentName, sessionID)
-		if slErr != nil {
-			logger.Warn("failed to create session logger", "error", slErr)
-		} else {
-			defer sessionLogCloser.Close()
-			logger.Info("session log file created", "path", sessionLogPath)
-		}
-	}
+	logger, sessionLogPath, closeSessionLog := h.openSessionLog(logger, agentName, sessionID)
+	defer closeSessionLog()
 
 	logger.Info("starting parallel backup session")
 
@@ -169,7 +229,7 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 	}
 
 	// Prepara escrita atômica
-	writer, err := NewAtomicWriter(storageInfo.BaseDir, agentName, backupName, storageInfo.FileExtension())
+	writer, err := NewStorageWriter(storageInfo, agentName, backupName)
 	if err != nil {
 		logger.Error("creating atomic writer", "error", err)
 		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
@@ -177,12 +237,7 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 	}
 
 	// Cria assembler para staging de chunks (configurável por storage)
-	assembler, err := NewChunkAssemblerWithOptions(sessionID, writer.AgentDir(), logger, ChunkAssemblerOptions{
-		Mode:             storageInfo.AssemblerMode,
-		PendingMemLimit:  storageInfo.AssemblerPendingMemRaw,
-		ShardLevels:      storageInfo.ChunkShardLevels,
-		FsyncChunkWrites: storageInfo.FsyncChunkWrites(),
-	})
+	assembler, err := NewChunkAssemblerWithOptions(sessionID, writer.AgentDir(), logger, h.assemblerOptions(storageName, storageInfo, writer.AgentDir()))
 	if err != nil {
 		logger.Error("creating chunk assembler", "error", err)
 		if ackErr := protocol.WriteParallelInitACK(conn, protocol.ParallelInitStatusError); ackErr != nil {
@@ -190,41 +245,82 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 		}
 		return
 	}
-	defer assembler.Cleanup()
 
 	// Registra sessão paralela para que handleParallelJoin possa encontrar
-	now := time.Now()
-	pSession := &ParallelSession{
-		SessionID:     sessionID,
-		Assembler:     assembler,
-		Writer:        writer,
-		StorageInfo:   storageInfo,
-		AgentName:     agentName,
-		StorageName:   storageName,
-		BackupName:    backupName,
-		ClientVersion: clientVersion,
-		Slots:         PreallocateSlots(pi.MaxStreams),
-		MaxStreams:    pi.MaxStreams,
-		ChunkSize:     pi.ChunkSize,
-		StreamReady:   make(chan struct{}),
-		Done:          make(chan struct{}),
-		CreatedAt:     now,
-		IngestionDone: make(chan struct{}),
-		Aborted:       make(chan struct{}),
-		ControlLost:   make(chan struct{}),
-		Phase:         NewSessionPhaseTracker(),
-	}
-
+	pSession := newParallelSession(sessionID, pi.MaxStreams, time.Now())
+	pSession.Assembler = assembler
+	pSession.Writer = writer
+	pSession.StorageInfo = storageInfo
+	pSession.AgentName = agentName
+	pSession.StorageName = storageName
+	pSession.Placement = placement
+	pSession.BackupName = backupName
+	pSession.ClientVersion = clientVersion
+	pSession.ChunkSize = pi.ChunkSize
+	pSession.ChunkSizeMax = pi.ChunkSizeMax
+	pSession.Config = newSessionConfigSnapshot(storageInfo, pi.MaxStreams, pi.ChunkSize)
 	pSession.Logger = logger // session logger (com fan-out para arquivo quando habilitado)
-	pSession.LastActivity.Store(now.UnixNano())
-	h.sessions.Store(sessionID, pSession)
+	h.storeSession(sessionID, pSession)
 
 	if err := protocol.WriteParallelInitACK(conn, protocol.ParallelInitStatusOK); err != nil {
 		logger.Error("writing ParallelInit ACK", "error", err)
-		h.sessions.Delete(sessionID)
+		h.deleteSession(sessionID)
+		assembler.Cleanup()
 		return
 	}
 
+	h.serveParallelSession(ctx, conn, br, pSession, lockKey, sessionLogPath, logger)
+}
+
+// openSessionLog cria o session logger (logging.session_log_dir) de uma sessão
+// paralela. Retorna o logger a usar, o caminho do arquivo ("" se desabilitado)
+// e a função que o fecha.
+func (h *Handler) openSessionLog(logger *slog.Logger, agentName, sessionID string) (*slog.Logger, string, func()) {
+	sessionLogDir := h.config().Logging.SessionLogDir
+	if sessionLogDir == "" {
+		return logger, "", func() {}
+	}
+	sessionLogger, closer, path, err := logging.NewSessionLogger(logger, sessionLogDir, agentName, sessionID)
+	if err != nil {
+		logger.Warn("failed to create session logger", "error", err)
+		return logger, "", func() {}
+	}
+	sessionLogger.Info("session log file created", "path", path)
+	return sessionLogger, path, func() { closer.Close() }
+}
+
+// assemblerOptions monta as opções do ChunkAssembler de uma sessão no storage.
+func (h *Handler) assemblerOptions(storageName string, storageInfo config.StorageInfo, agentDir string) ChunkAssemblerOptions {
+	return ChunkAssemblerOptions{
+		Mode:             storageInfo.AssemblerMode,
+		PendingMemLimit:  storageInfo.AssemblerPendingMemRaw,
+		ShardLevels:      storageInfo.ChunkShardLevels,
+		FsyncChunkWrites: storageInfo.FsyncChunkWrites(),
+		WriteBufferSize:  writeBufferSize(storageInfo),
+		Preallocate:      preallocateHint(storageInfo, agentDir),
+		DropPageCache:    storageInfo.DropPageCache,
+		Disk:             h.disk.queue(storageName),
+		Discard:          storageInfo.IsDiscard(),
+	}
+}
+
+// serveParallelSession conduz uma sessão paralela já registrada, com conn como
+// conexão primária: espera os streams e o ControlIngestionDone, finaliza a
+// montagem, lê o Trailer e comita. Usado pelo handshake (handleParallelBackup)
+// e pelo resume (handleParallelResume). Se um RESUME assumir a sessão antes do
+// fim da ingestão, ela é liberada com checkpoint e o staging é mantido.
+func (h *Handler) serveParallelSession(ctx context.Context, conn net.Conn, br io.Reader, pSession *ParallelSession, lockKey, sessionLogPath string, logger *slog.Logger) {
+	defer close(pSession.released)
+	assembler := pSession.Assembler
+	defer assembler.Cleanup()
+
+	sessionID, agentName, storageName, backupName := pSession.SessionID, pSession.AgentName, pSession.StorageName, pSession.BackupName
+	storageInfo, writer, now := pSession.StorageInfo, pSession.Writer, pSession.CreatedAt
+
+	// Checkpoints periódicos do arquivo montado (server.sessions_file)
+	stopCheckpoints := h.startCheckpoints(pSession, logger)
+	defer stopCheckpoints()
+
 	// Conn primária é control-only: não recebe dados de stream 0 aqui.
 	// Todos os N streams de dados conectam via ParallelJoin (handleParallelJoin).
 
@@ -233,14 +329,16 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 	select {
 	case <-pSession.StreamReady:
 		// Pelo menos 1 stream conectou — espera todos finalizarem.
+	case <-pSession.handover:
+		h.releaseParallelSession(pSession, logger)
+		return
 	case <-ctx.Done():
 		logger.Error("context cancelled waiting for streams")
-		h.sessions.Delete(sessionID)
-		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
+		h.suspendParallelSession(conn, pSession, logger)
 		return
 	case <-time.After(5 * time.Minute):
 		logger.Error("timeout waiting for streams to connect")
-		h.sessions.Delete(sessionID)
+		h.deleteSession(sessionID)
 		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
 		return
 	}
@@ -250,21 +348,28 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 	select {
 	case <-pSession.IngestionDone:
 		logger.Info("agent confirmed ingestion complete")
+	case <-pSession.handover:
+		h.releaseParallelSession(pSession, logger)
+		return
 	case <-pSession.ControlLost:
 		// Control channel caiu — aguarda reconexão por grace period antes de abortar.
-		gracePeriod := h.cfg.ControlLostGracePeriod
+		gracePeriod := h.config().ControlLostGracePeriod
 		logger.Warn("control channel lost during active session, waiting for reconnection",
 			"grace_period", gracePeriod)
 		select {
 		case <-pSession.IngestionDone:
 			logger.Info("agent delivered IngestionDone after control reconnect")
+		case <-pSession.handover:
+			// Agent reiniciado retomando a sessão pelo RESUME
+			h.releaseParallelSession(pSession, logger)
+			return
 		case <-time.After(gracePeriod):
 			logger.Error("control channel not recovered after grace period — aborting session",
 				"grace_period", gracePeriod)
 			pSession.abort(fmt.Errorf("control channel lost and not recovered within %s", gracePeriod))
 			h.recordSessionEnd(sessionID, agentName, storageName, backupName, "parallel",
-				storageInfo.CompressionMode, "control_lost", now, pSession.DiskWriteBytes.Load())
-			h.sessions.Delete(sessionID)
+				storageInfo.CompressionMode, "control_lost", now, pSession.DiskWriteBytes.Load(), pSession.Config, pSession.streamTransfers())
+			h.deleteSession(sessionID)
 			protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
 			if h.Events != nil {
 				h.Events.PushEvent("error", "session_control_lost", agentName,
@@ -273,8 +378,7 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 			return
 		case <-ctx.Done():
 			logger.Error("context cancelled during control lost grace period")
-			h.sessions.Delete(sessionID)
-			protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
+			h.suspendParallelSession(conn, pSession, logger)
 			return
 		}
 	case <-pSession.Aborted:
@@ -290,7 +394,7 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 		} else {
 			logger.Error("parallel session aborted before ingestion completed")
 		}
-		h.sessions.Delete(sessionID)
+		h.deleteSession(sessionID)
 		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
 		if h.Events != nil {
 			msg := fmt.Sprintf("%s/%s aborted before ingestion completed", storageName, backupName)
@@ -302,7 +406,7 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 		return
 	case <-time.After(25 * time.Hour):
 		logger.Error("ingestion timeout — agent never confirmed completion")
-		h.sessions.Delete(sessionID)
+		h.deleteSession(sessionID)
 		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
 		if h.Events != nil {
 			h.Events.PushEvent("error", "ingestion_timeout", agentName, fmt.Sprintf("%s/%s timed out waiting for ControlIngestionDone", storageName, backupName), 0)
@@ -310,11 +414,11 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 		return
 	case <-ctx.Done():
 		logger.Error("context cancelled waiting for ingestion done")
-		h.sessions.Delete(sessionID)
-		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
+		h.suspendParallelSession(conn, pSession, logger)
 		return
 	}
 
+	stopCheckpoints()
 	pSession.Closing.Store(true)
 	pSession.Phase.Set(PhaseAssembling)
 	pSession.StreamWg.Wait()
@@ -332,8 +436,8 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 		if err := h.chunkBuffer.Flush(assembler); err != nil {
 			logger.Error("flushing chunk buffer before finalize", "error", err)
 			h.recordSessionEnd(sessionID, agentName, storageName, backupName, "parallel",
-				storageInfo.CompressionMode, "flush_timeout", now, pSession.DiskWriteBytes.Load())
-			h.sessions.Delete(sessionID)
+				storageInfo.CompressionMode, "flush_timeout", now, pSession.DiskWriteBytes.Load(), pSession.Config, pSession.streamTransfers())
+			h.deleteSession(sessionID)
 			protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
 			if h.Events != nil {
 				h.Events.PushEvent("error", "flush_timeout", agentName,
@@ -377,10 +481,19 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 	logger.Info("parallel assembly complete, waiting for trailer", "totalBytes", totalBytes)
 
 	// Set read deadline para a conn primária enquanto espera o Trailer
-	conn.SetReadDeadline(time.Now().Add(readInactivityTimeout))
-	trailer, err := protocol.ReadTrailer(br)
+	// O trailer pode vir precedido do frame Manifest (manifest de arquivos),
+	// gravado ao lado do arquivo montado; o deadline é renovado a cada escrita.
+	conn.SetReadDeadline(time.Now().Add(h.inactivityTimeout()))
+	mf := &manifestFile{path: assembledPath + manifest.Suffix, onWrite: func() {
+		conn.SetReadDeadline(time.Now().Add(h.inactivityTimeout()))
+	}}
+	trailer, _, err := protocol.ReadTrailerWithManifest(br, mf)
+	if cErr := mf.Close(); err == nil && cErr != nil {
+		err = cErr
+	}
 	if err != nil {
 		logger.Error("reading trailer from primary conn", "error", err)
+		os.Remove(mf.path)
 		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
 		return
 	}
@@ -394,7 +507,7 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 		return
 	}
 	result := h.validateAndCommitWithTrailer(conn, writer, assembledPath, totalBytes, trailer, serverChecksum, storageInfo, pSession, lockKey, logger)
-	h.recordSessionEnd(sessionID, agentName, storageName, backupName, "parallel", storageInfo.CompressionMode, result, now, totalBytes)
+	h.recordSessionEnd(sessionID, agentName, storageName, backupName, "parallel", storageInfo.CompressionMode, result, now, totalBytes, pSession.Config, pSession.streamTransfers())
 	if result == "ok" {
 		pSession.Phase.Set(PhaseDone)
 	} else {
@@ -402,13 +515,13 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 	}
 	// Mantém sessão visível por 3s para que o WebUI capture a fase final
 	time.AfterFunc(3*time.Second, func() {
-		h.sessions.Delete(sessionID)
+		h.deleteSession(sessionID)
 	})
 
 	// Gerencia arquivo de log da sessão: remove em sucesso, retém para post-mortem em falha.
 	if sessionLogPath != "" {
 		if result == "ok" {
-			logging.RemoveSessionLog(h.cfg.Logging.SessionLogDir, agentName, sessionID)
+			logging.RemoveSessionLog(h.config().Logging.SessionLogDir, agentName, sessionID)
 			logger.Info("session log removed (backup ok)")
 		} else {
 			logger.Warn("session log retained for post-mortem", "path", sessionLogPath, "result", result)
@@ -418,7 +531,11 @@ func (h *Handler) handleParallelBackup(ctx context.Context, conn net.Conn, br io
 
 // readParallelChunkPayload lê o payload de um chunk paralelo.
 // O deadline TCP usa streamReadDeadline (mesma constante usada para o header).
+// Chunks maiores que o ChunkSizeMax negociado são recusados antes da alocação.
 func (h *Handler) readParallelChunkPayload(conn net.Conn, reader io.Reader, length uint32, globalSeq uint32, session *ParallelSession) ([]byte, error) {
+	if length > session.ChunkSizeMax {
+		return nil, fmt.Errorf("chunk seq %d length %d exceeds negotiated chunk size max %d", globalSeq, length, session.ChunkSizeMax)
+	}
 	buf := make([]byte, length)
 
 	for offset := 0; offset < len(buf); {
@@ -446,12 +563,18 @@ func (h *Handler) receiveParallelStream(ctx context.Context, conn net.Conn, read
 	var bytesReceived int64
 	var localChunkSeq uint32
 
+	// Teto de ingestão (ingest_limit) do storage e global
+	reader = h.ingest.reader(ctx, reader, session.StorageName)
+
 	// Recupera offset corrente do slot para suporte a resume
 	slot := session.Slots[streamIndex]
 	bytesReceived = slot.Offset.Load()
 	if bytesReceived > 0 {
 		logger.Info("resuming stream from offset", "stream", streamIndex, "offset", bytesReceived)
 	}
+	// O resume reenvia tudo após o offset confirmado, inclusive chunks com
+	// ChunkNACK pendente neste stream.
+	session.NACKs.clearSlot(streamIndex)
 
 	for {
 		// Verifica cancelamento do contexto (ex: re-join de outro stream com mesmo index)
@@ -475,6 +598,14 @@ func (h *Handler) receiveParallelStream(ctx context.Context, conn net.Conn, read
 			return bytesReceived, fmt.Errorf("reading chunk header from stream %d: %w", streamIndex, err)
 		}
 
+		// Fim do stream: confere os totais declarados pelo agent
+		if hdr.GlobalSeq == protocol.StreamTrailerSeq {
+			if err := h.handleStreamTrailer(conn, reader, sackWriter, hdr, streamIndex, bytesReceived, session, logger); err != nil {
+				return bytesReceived, err
+			}
+			continue
+		}
+
 		// Marco de início do chunk: o header foi lido com sucesso e o server vai
 		// iniciar a leitura do payload. Isso ajuda a distinguir "nunca chegou" de
 		// "chegou o header, mas falhou/travou durante o payload".
@@ -489,9 +620,16 @@ func (h *Handler) receiveParallelStream(ctx context.Context, conn net.Conn, read
 		if err != nil {
 			return bytesReceived, err
 		}
+		if h.chaos.corruptChunk(streamIndex, hdr.GlobalSeq, chunkData) {
+			logger.Warn("chaos: corrupting chunk", "stream", streamIndex, "globalSeq", hdr.GlobalSeq)
+			if h.Events != nil {
+				h.Events.PushEvent("warn", "chaos_corrupt", session.AgentName, fmt.Sprintf("stream %d chunk %d corrupted by chaos mode", streamIndex, hdr.GlobalSeq), int(streamIndex))
+			}
+		}
 
 		// Validação de integridade per-chunk via CRC32 IEEE (Protocol v6).
-		// Rejeita chunk se mismatch — força reconexão do stream.
+		// Com JoinFlagChunkNACK o chunk é descartado e o agent o retransmite no
+		// mesmo stream; sem ele (ou após maxChunkNACKs) força reconexão do stream.
 		computedCRC := crc32.ChecksumIEEE(chunkData)
 		if computedCRC != hdr.CRC32 {
 			logger.Error("chunk_crc_mismatch",
@@ -506,6 +644,24 @@ func (h *Handler) receiveParallelStream(ctx context.Context, conn net.Conn, read
 					fmt.Sprintf("stream %d seq %d: CRC32 %08x != %08x",
 						streamIndex, hdr.GlobalSeq, computedCRC, hdr.CRC32), 0)
 			}
+			if slot.ChunkNACK.Load() {
+				if n := session.NACKs.add(hdr.GlobalSeq, streamIndex, bytesReceived); n <= maxChunkNACKs {
+					// O frame corrompido ocupa o wire como qualquer outro: o offset
+					// continua contando bytes lidos, mas o ChunkSACK fica limitado ao
+					// offset anterior ao chunk até a retransmissão chegar.
+					bytesReceived += int64(hdr.Length) + protocol.ChunkHeaderSize
+					slot.ChunksLost.Add(1)
+					slot.Offset.Store(session.NACKs.ackOffset(streamIndex, bytesReceived))
+					if netConn, ok := sackWriter.(net.Conn); ok {
+						netConn.SetWriteDeadline(time.Now().Add(sackWriteTimeout))
+					}
+					if nErr := protocol.WriteChunkNACK(sackWriter, streamIndex, hdr.GlobalSeq); nErr != nil {
+						return bytesReceived, fmt.Errorf("sending ChunkNACK for seq %d: %w", hdr.GlobalSeq, nErr)
+					}
+					logger.Warn("ChunkNACK sent", "stream", streamIndex, "globalSeq", hdr.GlobalSeq, "attempt", n)
+					continue
+				}
+			}
 			return bytesReceived, fmt.Errorf("%w: stream %d seq %d expected %08x got %08x",
 				protocol.ErrChunkCRCMismatch, streamIndex, hdr.GlobalSeq, hdr.CRC32, computedCRC)
 		}
@@ -544,6 +700,11 @@ func (h *Handler) receiveParallelStream(ctx context.Context, conn net.Conn, read
 			}
 		}
 
+		if session.NACKs.resolve(hdr.GlobalSeq) {
+			slot.ChunksRetransmitted.Add(1)
+			logger.Info("retransmitted chunk received", "stream", streamIndex, "globalSeq", hdr.GlobalSeq)
+		}
+
 		nowNano := time.Now().UnixNano()
 		bytesReceived += int64(hdr.Length) + protocol.ChunkHeaderSize
 		session.LastActivity.Store(nowNano)
@@ -566,18 +727,42 @@ func (h *Handler) receiveParallelStream(ctx context.Context, conn net.Conn, read
 		slot.ChunksReceived.Add(1)
 		slot.LastChunkSeq.Store(hdr.GlobalSeq)
 
-		// Atualiza offset atômico — usado por handleParallelJoin para resume
-		slot.Offset.Store(bytesReceived)
+		// Atualiza offset atômico — usado por handleParallelJoin para resume.
+		// Não passa de um chunk com ChunkNACK pendente neste stream.
+		ackOffset := session.NACKs.ackOffset(streamIndex, bytesReceived)
+		slot.Offset.Store(ackOffset)
+
+		// Chaos mode: derruba o stream antes do ChunkSACK (força re-join + retransmissão)
+		// ou atrasa o ChunkSACK (exercita timeouts de SACK no agent).
+		if h.chaos.shouldDrop() {
+			logger.Warn("chaos: dropping parallel stream", "stream", streamIndex, "globalSeq", hdr.GlobalSeq)
+			if h.Events != nil {
+				h.Events.PushEvent("warn", "chaos_drop", session.AgentName, fmt.Sprintf("stream %d dropped by chaos mode", streamIndex), int(streamIndex))
+			}
+			return bytesReceived, errChaosDrop
+		}
+		if d := h.chaos.chunkSACKDelay(streamIndex, hdr.GlobalSeq); d > 0 {
+			logger.Debug("chaos: delaying ChunkSACK", "stream", streamIndex, "delay", d)
+			time.Sleep(d)
+		}
 
 		// Envia ChunkSACK com write timeout para não bloquear se a conn está morta
 		if netConn, ok := sackWriter.(net.Conn); ok {
 			netConn.SetWriteDeadline(time.Now().Add(sackWriteTimeout))
 		}
 		localChunkSeq++
-		if sErr := protocol.WriteChunkSACK(sackWriter, streamIndex, localChunkSeq, uint64(bytesReceived)); sErr != nil {
+		if sErr := protocol.WriteChunkSACK(sackWriter, streamIndex, localChunkSeq, uint64(ackOffset)); sErr != nil {
 			logger.Warn("failed to send ChunkSACK", "error", sErr, "stream", streamIndex, "seq", localChunkSeq)
 		} else {
-			logger.Debug("ChunkSACK sent", "stream", streamIndex, "globalSeq", hdr.GlobalSeq, "offset", bytesReceived)
+			logger.Debug("ChunkSACK sent", "stream", streamIndex, "globalSeq", hdr.GlobalSeq, "offset", ackOffset)
+		}
+
+		if h.chaos.rotateAfterChunk(streamIndex, hdr.GlobalSeq) {
+			logger.Warn("chaos: forcing stream rotation", "stream", streamIndex, "globalSeq", hdr.GlobalSeq)
+			if h.Events != nil {
+				h.Events.PushEvent("warn", "chaos_rotation", session.AgentName, fmt.Sprintf("stream %d rotation forced by chaos mode", streamIndex), int(streamIndex))
+			}
+			go h.rotateStream(session.SessionID, session, streamIndex, 0, 0)
 		}
 	}
 
@@ -612,6 +797,13 @@ func (h *Handler) handleParallelJoin(ctx context.Context, conn net.Conn, logger
 		protocol.WriteParallelACK(conn, protocol.ParallelStatusNotFound, 0)
 		return
 	}
+	h.traceIdentify(conn, protocol.TraceInfo{
+		Conn:    fmt.Sprintf("stream-%d", pj.StreamIndex),
+		Agent:   pSession.AgentName,
+		Storage: pSession.StorageName,
+		Backup:  pSession.BackupName,
+		Session: pj.SessionID,
+	})
 
 	// Valida stream index
 	if pj.StreamIndex >= pSession.MaxStreams {
@@ -637,6 +829,14 @@ func (h *Handler) handleParallelJoin(ctx context.Context, conn net.Conn, logger
 		return
 	}
 
+	// Sessão restaurada após restart do server e ainda não retomada: os
+	// streams só voltam depois do RESUME, a partir do checkpoint
+	if pSession.Detached.Load() {
+		logger.Warn("session restored after restart, rejecting join before resume", "stream", pj.StreamIndex)
+		protocol.WriteParallelACK(conn, protocol.ParallelStatusNotFound, 0)
+		return
+	}
+
 	// --- Cancelamento da goroutine anterior (proteção contra goroutine leak) ---
 	// Se este stream já foi conectado antes (re-join), cancela o contexto da goroutine
 	// anterior para que ela saia imediatamente em vez de esperar o read timeout.
@@ -660,8 +860,24 @@ func (h *Handler) handleParallelJoin(ctx context.Context, conn net.Conn, logger
 		logger.Info("parallel stream re-join (resume)", "lastOffset", lastOffset)
 	}
 
+	// Capacidades anunciadas nos joins normais, mantidas nas rotações
+	if protocol.JoinReason(pj.Flags) == protocol.JoinReasonNone {
+		slot.ChunkNACK.Store(pj.Flags&protocol.JoinFlagChunkNACK != 0)
+		slot.StreamTrailer.Store(pj.Flags&protocol.JoinFlagStreamTrailer != 0)
+		if pj.Flags&protocol.JoinFlagServerLoad != 0 {
+			pSession.ServerLoad.Store(true)
+		}
+		if pj.Flags&protocol.JoinFlagStreamLimit != 0 {
+			pSession.StreamLimit.Store(true)
+		}
+	}
+
 	// ACK OK com lastOffset para negociação de resume
-	if err := protocol.WriteParallelACK(conn, protocol.ParallelStatusOK, lastOffset); err != nil {
+	ackStatus := protocol.ParallelStatusOK
+	if slot.StreamTrailer.Load() {
+		ackStatus |= protocol.ParallelACKFlagStreamTrailer
+	}
+	if err := protocol.WriteParallelACK(conn, ackStatus, lastOffset); err != nil {
 		logger.Error("writing ParallelACK", "error", err)
 		return
 	}
@@ -674,17 +890,20 @@ func (h *Handler) handleParallelJoin(ctx context.Context, conn net.Conn, logger
 
 	// Atualiza uptime e reconnects/rotations do slot
 	var reconnectCount int32
+	joinReason := "join"
 	if slot.GetConnectedAt().IsZero() {
 		// Primeira conexão
 		reconnectCount = 0
-	} else if pj.Flags == protocol.JoinReasonRotation {
+	} else if protocol.JoinReason(pj.Flags) == protocol.JoinReasonRotation {
 		// Port rotation intencional — não conta como reconnect
+		joinReason = "rotation"
 		rotationCount := slot.Rotations.Add(1)
 		if h.Events != nil {
 			h.Events.PushEvent("info", "port_rotation", pSession.AgentName, fmt.Sprintf("stream %d port rotation (session %s, rotation #%d)", pj.StreamIndex, pj.SessionID, rotationCount), int(pj.StreamIndex))
 		}
 	} else {
 		// Re-join por erro de rede
+		joinReason = "reconnect"
 		reconnectCount = slot.Reconnects.Add(1)
 		if h.Events != nil {
 			h.Events.PushEvent("warn", "stream_reconnect", pSession.AgentName, fmt.Sprintf("stream %d re-joined (session %s)", pj.StreamIndex, pj.SessionID), int(pj.StreamIndex))
@@ -692,6 +911,10 @@ func (h *Handler) handleParallelJoin(ctx context.Context, conn net.Conn, logger
 	}
 	slot.SetConnectedAt(time.Now())
 	logger.Info("parallel join accepted", "lastOffset", lastOffset, "reconnects", reconnectCount)
+	h.Audit.Record(observability.AuditRecord{
+		SessionID: pj.SessionID, Event: observability.AuditStreamJoin,
+		Stream: &pj.StreamIndex, Reason: joinReason, Offset: int64(lastOffset), RemoteAddr: conn.RemoteAddr().String(),
+	})
 
 	// Atualiza last activity do slot
 	slot.LastActivity.Store(time.Now().UnixNano())
@@ -716,7 +939,20 @@ func (h *Handler) handleParallelJoin(ctx context.Context, conn net.Conn, logger
 	// Usa o session logger da ParallelSession (com fan-out para arquivo de sessão)
 	// em vez do logger da conexão TCP do stream.
 	streamLogger := pSession.Logger.With("stream", pj.StreamIndex, "remote", conn.RemoteAddr().String())
-	bytesReceived, err := h.receiveParallelStream(streamCtx, conn, conn, conn, pj.StreamIndex, pSession, streamLogger)
+	reader := h.chaos.streamReader(conn, pj.StreamIndex, func(after int64) {
+		streamLogger.Warn("chaos: dropping parallel stream", "after_bytes", after)
+		if h.Events != nil {
+			h.Events.PushEvent("warn", "chaos_drop", pSession.AgentName, fmt.Sprintf("stream %d dropped by chaos mode after %s", pj.StreamIndex, formatBytesGo(after)), int(pj.StreamIndex))
+		}
+	})
+	stopKill := h.chaos.armKill(conn, pj.StreamIndex, func(after time.Duration) {
+		streamLogger.Warn("chaos: killing parallel stream", "after", after)
+		if h.Events != nil {
+			h.Events.PushEvent("warn", "chaos_drop", pSession.AgentName, fmt.Sprintf("stream %d killed by chaos mode after %s", pj.StreamIndex, after), int(pj.StreamIndex))
+		}
+	})
+	bytesReceived, err := h.receiveParallelStream(streamCtx, conn, reader, conn, pj.StreamIndex, pSession, streamLogger)
+	stopKill()
 	pSession.StreamWg.Done()
 
 	if err != nil {
@@ -729,6 +965,11 @@ func (h *Handler) handleParallelJoin(ctx context.Context, conn net.Conn, logger
 			slot.SetStatus(SlotDisconnected)
 			return
 		}
+		// Disco cheio: aborta a sessão inteira em vez de esperar re-join
+		if h.abortOnDiskFull(pj.SessionID, pSession.AgentName, pSession.StorageName, pSession.BackupName, err, logger) {
+			slot.SetStatus(SlotDisconnected)
+			return
+		}
 		// context.Canceled é esperado em re-join — não é um erro real
 		if ctx.Err() == nil && streamCtx.Err() == context.Canceled {
 			logger.Info("parallel stream replaced by re-join", "bytes", bytesReceived)
@@ -754,10 +995,81 @@ func (h *Handler) handleParallelJoin(ctx context.Context, conn net.Conn, logger
 	logger.Info("parallel stream complete", "bytes", bytesReceived)
 }
 
+// handleMux atende uma conexão multiplexada (PMUX, parallel_transport: mux):
+// cada stream lógico carrega um ParallelJoin e segue o mesmo caminho de um
+// socket de stream dedicado, incluindo resume e flow rotation.
+func (h *Handler) handleMux(ctx context.Context, conn net.Conn, logger *slog.Logger) {
+	// O magic "PMUX" já foi lido; o trace é gravado por stream lógico
+	traceDisable(conn)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	version, err := protocol.ReadMuxInit(conn)
+	if err != nil {
+		logger.Error("reading mux init", "error", err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	if version != protocol.MuxVersion {
+		logger.Warn("unsupported mux version", "version", version)
+		protocol.WriteMuxACK(conn, protocol.MuxStatusUnsupported)
+		return
+	}
+	if err := protocol.WriteMuxACK(conn, protocol.MuxStatusOK); err != nil {
+		logger.Error("writing mux ACK", "error", err)
+		return
+	}
+
+	sess := protocol.NewMuxServer(conn)
+	defer sess.Close()
+	stop := context.AfterFunc(ctx, func() { sess.Close() })
+	defer stop()
+	logger.Info("multiplexed connection established")
+
+	var wg sync.WaitGroup
+	var streams int
+	for {
+		st, err := sess.Accept()
+		if err != nil {
+			break
+		}
+		streams++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.handleMuxStream(ctx, st, logger.With("mux_stream", st.ID()))
+		}()
+	}
+	wg.Wait()
+	logger.Info("multiplexed connection closed", "streams", streams, "reason", sess.Err())
+}
+
+// handleMuxStream despacha um stream lógico da conexão multiplexada. Apenas
+// ParallelJoin é aceito: handshake e control channel usam conexões próprias.
+func (h *Handler) handleMuxStream(ctx context.Context, st net.Conn, logger *slog.Logger) {
+	defer st.Close()
+	conn := st
+	if traced := h.traceConn(st); traced != st {
+		conn = traced
+		defer conn.Close()
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(conn, magic); err != nil {
+		logger.Warn("reading magic bytes on multiplexed stream", "error", err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	if string(magic) != string(protocol.MagicParallelJoin[:]) {
+		logger.Warn("unexpected magic on multiplexed stream", "magic", string(magic))
+		return
+	}
+	h.handleParallelJoin(ctx, conn, logger)
+}
+
 // lockKey identifica o lock agent:storage:backup para liberação antecipada em async_upload.
 func (h *Handler) validateAndCommitWithTrailer(conn net.Conn, writer *AtomicWriter, tmpPath string, totalBytes int64, trailer *protocol.Trailer, serverChecksum [32]byte, storageInfo config.StorageInfo, pSession *ParallelSession, lockKey string, logger *slog.Logger) string {
-	if totalBytes == 0 {
-		logger.Error("no data received")
+	if totalBytes == 0 && !trailer.IsEmpty() {
+		logger.Error("no data received", "trailer_size", trailer.Size)
 		writer.Abort(tmpPath)
 		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
 		return "write_error"
@@ -814,6 +1126,16 @@ func (h *Handler) validateAndCommitWithTrailer(conn net.Conn, writer *AtomicWrit
 		return "write_error"
 	}
 
+	// Storage discard (benchmark): validado, mas nada é commitado
+	if storageInfo.IsDiscard() {
+		return h.discardBackup(conn, writer, tmpPath, totalBytes, serverChecksum, logger)
+	}
+
+	// Backup vazio declarado pelo agent (Trailer com Size 0)
+	if totalBytes == 0 {
+		return h.commitEmptyBackup(conn, writer, storageInfo, tmpPath, lockKey, logger)
+	}
+
 	// Commit (rename atômico)
 	finalPath, err := writer.Commit(tmpPath)
 	if err != nil {
@@ -821,6 +1143,13 @@ func (h *Handler) validateAndCommitWithTrailer(conn net.Conn, writer *AtomicWrit
 		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
 		return "write_error"
 	}
+	h.auditCommit(lockKey, finalPath, "")
+
+	// Índice de membros para o restore de arquivos individuais
+	h.indexArchive(finalPath, storageInfo, logger)
+
+	// Storage imutável: registra no ledger e trava o backup
+	h.sealBackup(storageInfo, writer.AgentName(), finalPath, serverChecksum, logger)
 
 	// Verifica integridade do archive antes de rotacionar.
 	// Se falhar, o backup fica no disco mas NÃO apaga os antigos (fail-safe).
@@ -841,6 +1170,13 @@ func (h *Handler) validateAndCommitWithTrailer(conn net.Conn, writer *AtomicWrit
 		logger.Info("backup integrity verified", "path", finalPath)
 	}
 
+	// Storage dedup: o archive vira um manifest de chunks do pool
+	if storageInfo.IsDedup() {
+		pSession.Phase.Set(PhaseDeduplicating)
+		finalPath = h.ingestDedup(storageInfo, pSession.StorageName, pSession.AgentName, pSession.BackupName, finalPath, logger)
+		h.auditCommit(lockKey, finalPath, "dedup manifest")
+	}
+
 	// Archive pre-Rotate: envia backups que SERÃO deletados pelo Rotate
 	// (antes da deleção, para que os arquivos ainda existam no disco).
 	if hasArchiveBuckets(storageInfo.Buckets) {
@@ -849,7 +1185,7 @@ func (h *Handler) validateAndCommitWithTrailer(conn net.Conn, writer *AtomicWrit
 	}
 
 	// Rotação
-	removed, err := Rotate(writer.AgentDir(), storageInfo.MaxBackups)
+	removed, err := h.rotateBackups(storageInfo, writer.AgentName(), writer.AgentDir(), logger)
 	if err != nil {
 		logger.Warn("rotation failed", "error", err)
 	}
@@ -859,6 +1195,12 @@ func (h *Handler) validateAndCommitWithTrailer(conn net.Conn, writer *AtomicWrit
 			h.Events.PushEvent("warn", "backup_rotated", writer.AgentName(), fmt.Sprintf("deleted old backup: %s", name), 0)
 		}
 	}
+	h.collectDedupGarbage(storageInfo.BaseDir, removed, logger)
+
+	// Ações post_commit (comando, rclone): em background, não atrasam o FinalACK
+	if len(storageInfo.PostCommit) > 0 {
+		go h.runPostCommitActions(storageInfo, finalPath, BucketUploadContext{Agent: pSession.AgentName, Storage: pSession.StorageName, Backup: pSession.BackupName, SessionID: pSession.SessionID}, logger)
+	}
 
 	// Object Storage pós-commit (sync/offload — archive já tratado acima)
 	// Offload bloqueia até upload confirmado; sync é fire-and-forget.
@@ -0,0 +1,198 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/manifest"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// restoreWriteTimeout limita cada escrita do stream de restore (agent parado).
+const restoreWriteTimeout = 60 * time.Second
+
+// handleRestore atende um RestoreRequest (RSTR): localiza o arquivo pedido
+// no índice de membros do archive e envia apenas essa entrada, como um stream
+// tar sem compressão. O agent só restaura os próprios backups.
+func (h *Handler) handleRestore(ctx context.Context, conn net.Conn, logger *slog.Logger) {
+	// O magic "RSTR" já foi lido; deadline previne slowloris
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	req, err := protocol.ReadRestoreRequest(conn)
+	if err != nil {
+		logger.Error("reading restore request", "error", err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	reqPath := strings.TrimPrefix(path.Clean("/"+req.Path), "/")
+	logger = logger.With("agent", req.AgentName, "storage", req.StorageName, "backup", req.BackupName, "path", reqPath)
+	logger.Info("restore request received", "archive", req.Archive)
+	h.traceAnnotate(conn, protocol.TraceInfo{Conn: "restore", Agent: req.AgentName, Storage: req.StorageName, Backup: req.BackupName})
+
+	reply := func(status byte, archive, msg string) {
+		protocol.WriteRestoreResponse(conn, status, archive, msg)
+	}
+
+	// Valida componentes de path contra traversal
+	fields := []struct{ val, field string }{
+		{req.AgentName, "agentName"},
+		{req.StorageName, "storageName"},
+		{req.BackupName, "backupName"},
+	}
+	if req.Archive != "" {
+		fields = append(fields, struct{ val, field string }{req.Archive, "archive"})
+	}
+	for _, v := range fields {
+		if err := validatePathComponent(v.val, v.field); err != nil {
+			logger.Warn("invalid path component in restore request", "field", v.field, "value", v.val, "error", err)
+			reply(protocol.RestoreStatusReject, "", fmt.Sprintf("invalid %s: %s", v.field, err))
+			return
+		}
+	}
+	if reqPath == "" {
+		reply(protocol.RestoreStatusNotFound, "", "empty path")
+		return
+	}
+
+	// Valida identidade: o agent só restaura os próprios backups
+	certName := h.extractAgentName(conn, logger)
+	if certName != "" && certName != req.AgentName {
+		logger.Warn("agent identity mismatch: protocol agentName does not match TLS certificate CN",
+			"protocol_agent", req.AgentName, "cert_cn", certName)
+		reply(protocol.RestoreStatusReject, "",
+			fmt.Sprintf("agent name %q does not match certificate CN %q", req.AgentName, certName))
+		return
+	}
+	if err := h.authorizeAgent(ctx, conn, logger); err != nil {
+		reply(protocol.RestoreStatusReject, "", fmt.Sprintf("agent %q not authorized: %s", req.AgentName, err))
+		return
+	}
+
+	archivePath, err := h.findRestoreArchive(req.AgentName, req.StorageName, req.BackupName, req.Archive)
+	if err != nil {
+		logger.Warn("restore archive not found", "error", err)
+		reply(protocol.RestoreStatusNotFound, "", err.Error())
+		return
+	}
+	archive := filepath.Base(archivePath)
+	logger = logger.With("archive", archive)
+
+	e, err := lookupArchiveIndex(archivePath, reqPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		reply(protocol.RestoreStatusNoIndex, archive, "archive has no member index (backup without manifest: true)")
+		return
+	case errors.Is(err, errNotInIndex):
+		reply(protocol.RestoreStatusNotFound, archive, fmt.Sprintf("%s not found in %s", reqPath, archive))
+		return
+	case err != nil:
+		logger.Error("reading archive index", "error", err)
+		reply(protocol.RestoreStatusError, archive, err.Error())
+		return
+	}
+	if e.Type == manifest.TypeDir {
+		reply(protocol.RestoreStatusNotFound, archive, fmt.Sprintf("%s is a directory: only single files can be restored", reqPath))
+		return
+	}
+
+	// Hardlink: o conteúdo está na entrada alvo
+	content := e
+	if e.Type == manifest.TypeHardlink {
+		if content, err = lookupArchiveIndex(archivePath, e.Link); err != nil {
+			logger.Error("resolving hardlink target", "link", e.Link, "error", err)
+			reply(protocol.RestoreStatusError, archive, fmt.Sprintf("resolving hardlink target %s: %v", e.Link, err))
+			return
+		}
+	}
+
+	if err := protocol.WriteRestoreResponse(conn, protocol.RestoreStatusOK, archive, ""); err != nil {
+		logger.Warn("writing restore response", "error", err)
+		return
+	}
+	start := time.Now()
+	if err := writeArchiveMember(&deadlineWriter{conn: conn, timeout: restoreWriteTimeout}, archivePath, e, content); err != nil {
+		// O stream tar fica incompleto: o agent detecta pelo EOF inesperado
+		logger.Error("streaming restored file", "error", err)
+		return
+	}
+	logger.Info("file restored", "duration", time.Since(start).Round(time.Millisecond))
+	if h.Events != nil {
+		h.Events.PushEvent("info", "file_restored", req.AgentName,
+			fmt.Sprintf("%s restored from %s/%s/%s", reqPath, req.StorageName, req.BackupName, archive), 0)
+	}
+}
+
+// findRestoreArchive localiza o archive de agent/backup no storage (ou nos
+// storages do placement) pedido. Com archive vazio, escolhe o backup mais
+// recente que tenha índice de membros.
+func (h *Handler) findRestoreArchive(agent, storage, backup, archive string) (string, error) {
+	cfg := h.config()
+	storages := []string{storage}
+	if p, ok := cfg.GetPlacement(storage); ok {
+		storages = p.Storages
+	}
+
+	var found string
+	for _, name := range storages {
+		si, ok := cfg.GetStorage(name)
+		if !ok {
+			continue
+		}
+		agentDir := filepath.Join(si.BaseDir, agent, backup)
+		if err := validatePathInBaseDir(si.BaseDir, agentDir); err != nil {
+			return "", fmt.Errorf("path traversal detected: %w", err)
+		}
+		if archive != "" {
+			if !isBackupFile(archive) || validatePathComponent(archive, "archive") != nil {
+				continue
+			}
+			if p, ok := findBackup(agentDir, archive); ok {
+				return p, nil
+			}
+			continue
+		}
+		backups, err := listBackups(agentDir)
+		if err != nil {
+			continue
+		}
+		for _, b := range backups {
+			if found != "" && b.Name <= filepath.Base(found) {
+				continue
+			}
+			p := filepath.Join(agentDir, b.Rel)
+			if _, err := os.Stat(archiveIndexPath(p)); err == nil {
+				found = p
+			}
+		}
+	}
+	if found == "" {
+		if archive != "" {
+			return "", fmt.Errorf("archive %s not found for %s/%s", archive, storage, backup)
+		}
+		return "", fmt.Errorf("no indexed backup found for %s/%s", storage, backup)
+	}
+	return found, nil
+}
+
+// deadlineWriter renova o write deadline da conexão antes de cada escrita.
+type deadlineWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	return w.conn.Write(p)
+}
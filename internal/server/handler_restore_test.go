@@ -0,0 +1,194 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// writeCheckpointedArchive grava um archive com um membro gzip (ou frame
+// zstd) por entrada, como o agent faz nos checkpoints.
+func writeCheckpointedArchive(t *testing.T, path string, files map[string]string, order []string) {
+	t.Helper()
+	var out bytes.Buffer
+	for _, name := range order {
+		var c io.WriteCloser
+		if strings.HasSuffix(path, ".tar.zst") {
+			c, _ = zstd.NewWriter(&out)
+		} else {
+			c = gzip.NewWriter(&out)
+		}
+		tw := tar.NewWriter(c)
+		hdr := &tar.Header{Name: name, Mode: 0640, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		if strings.HasPrefix(files[name], "link:") {
+			hdr = &tar.Header{Name: name, Mode: 0640, Typeflag: tar.TypeLink, Linkname: strings.TrimPrefix(files[name], "link:")}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			io.WriteString(tw, files[name])
+		}
+		if name == order[len(order)-1] {
+			tw.Close()
+		} else {
+			tw.Flush()
+		}
+		c.Close()
+	}
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// requestRestore envia um RestoreRequest ao handler e retorna a resposta e
+// as entradas do stream tar.
+func requestRestore(t *testing.T, h *Handler, req protocol.RestoreRequest) (*protocol.RestoreResponse, map[string]string) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		magic := make([]byte, 4)
+		io.ReadFull(serverConn, magic)
+		h.handleRestore(context.Background(), serverConn, h.logger)
+		serverConn.Close()
+	}()
+	if err := protocol.WriteRestoreRequest(clientConn, req); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(clientConn)
+	resp, err := protocol.ReadRestoreResponse(br)
+	if err != nil {
+		t.Fatalf("ReadRestoreResponse: %v", err)
+	}
+	got := make(map[string]string)
+	if resp.Status != protocol.RestoreStatusOK {
+		return resp, got
+	}
+	tr := tar.NewReader(br)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading restored tar: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(data)
+	}
+	return resp, got
+}
+
+func TestHandleRestore_SingleFile(t *testing.T) {
+	for _, ext := range []string{".tar.gz", ".tar.zst"} {
+		t.Run(ext, func(t *testing.T) {
+			baseDir := t.TempDir()
+			agentDir := filepath.Join(baseDir, "web-01", "app")
+			os.MkdirAll(agentDir, 0755)
+			files := map[string]string{
+				"etc/hosts":          "127.0.0.1 localhost\n",
+				"var/lib/big.db":     strings.Repeat("x", 10000),
+				"etc/nginx/app.conf": "server {}\n",
+				"srv/hosts.link":     "link:etc/hosts",
+			}
+			order := []string{"etc/hosts", "var/lib/big.db", "etc/nginx/app.conf", "srv/hosts.link"}
+			archive := filepath.Join(agentDir, "2026-01-02T00-00-00-000"+ext)
+			writeCheckpointedArchive(t, archive, files, order)
+
+			// Backups sem índice não são candidatos ao restore
+			older := filepath.Join(agentDir, "2026-01-01T00-00-00-000"+ext)
+			writeCheckpointedArchive(t, older, files, order)
+			unindexed := filepath.Join(agentDir, "2026-01-03T00-00-00-000"+ext)
+			writeCheckpointedArchive(t, unindexed, files, order)
+
+			entries, members, err := buildArchiveIndex(archive)
+			if err != nil || entries != 4 || members != 4 {
+				t.Fatalf("buildArchiveIndex: entries=%d members=%d err=%v", entries, members, err)
+			}
+			if e, err := lookupArchiveIndex(archive, "etc/nginx/app.conf"); err != nil || e.Offset == 0 || e.Skip != 0 {
+				t.Errorf("expected the entry at the start of its own member, got %+v (%v)", e, err)
+			}
+
+			h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: baseDir}})
+			req := protocol.RestoreRequest{AgentName: "web-01", StorageName: "default", BackupName: "app", Path: "/etc/nginx/app.conf"}
+			resp, got := requestRestore(t, h, req)
+			if resp.Status != protocol.RestoreStatusOK || resp.Archive != filepath.Base(archive) {
+				t.Fatalf("unexpected response: %+v", resp)
+			}
+			if len(got) != 1 || got["etc/nginx/app.conf"] != files["etc/nginx/app.conf"] {
+				t.Errorf("expected only the requested file, got %v", got)
+			}
+
+			// Hardlink: conteúdo da entrada alvo com o nome pedido
+			req.Path = "srv/hosts.link"
+			if _, got = requestRestore(t, h, req); got["srv/hosts.link"] != files["etc/hosts"] {
+				t.Errorf("hardlink restore: %v", got)
+			}
+
+			// Arquivo inexistente e archive sem índice
+			req.Path = "etc/missing"
+			if resp, _ = requestRestore(t, h, req); resp.Status != protocol.RestoreStatusNotFound {
+				t.Errorf("missing file: expected NotFound, got %+v", resp)
+			}
+			req.Path, req.Archive = "etc/hosts", filepath.Base(older)
+			if resp, _ = requestRestore(t, h, req); resp.Status != protocol.RestoreStatusNoIndex {
+				t.Errorf("unindexed archive: expected NoIndex, got %+v", resp)
+			}
+
+			// Traversal no nome do archive
+			req.Archive = "../../other/app/x" + ext
+			if resp, _ = requestRestore(t, h, req); resp.Status != protocol.RestoreStatusReject {
+				t.Errorf("traversal: expected Reject, got %+v", resp)
+			}
+		})
+	}
+}
+
+func TestBuildArchiveIndex_SingleMember(t *testing.T) {
+	// Archive sem checkpoints: offset 0, skip até o header
+	path := createTestTarGz(t, t.TempDir(), "2026-01-01T00-00-00-000.tar.gz")
+	if _, members, err := buildArchiveIndex(path); err != nil || members != 1 {
+		t.Fatalf("buildArchiveIndex: members=%d err=%v", members, err)
+	}
+	f, _ := os.Open(path)
+	defer f.Close()
+	tr, closeFn, _ := archiveTarReader(f)
+	defer closeFn()
+	var last string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		last = hdr.Name
+	}
+	e, err := lookupArchiveIndex(path, last)
+	if err != nil || e.Offset != 0 || e.Skip == 0 {
+		t.Fatalf("expected offset 0 and a skip for %s, got %+v (%v)", last, e, err)
+	}
+	var buf bytes.Buffer
+	if err := writeArchiveMember(&buf, path, e, e); err != nil {
+		t.Fatalf("writeArchiveMember: %v", err)
+	}
+	if hdr, err := tar.NewReader(&buf).Next(); err != nil || hdr.Name != last {
+		t.Errorf("expected %s, got %v (%v)", last, hdr, err)
+	}
+}
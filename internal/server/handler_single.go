@@ -24,6 +24,7 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -33,7 +34,9 @@ import (
 	"time"
 
 	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
 	"github.com/nishisan-dev/n-backup/internal/protocol"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
 )
 
 // handleBackup processa uma sessão de backup completa.
@@ -45,12 +48,18 @@ func (h *Handler) handleBackup(ctx context.Context, conn net.Conn, logger *slog.
 		return
 	}
 
-	handshakeVersion := versionBuf[0]
-	if handshakeVersion < protocol.ProtocolVersion {
-		logger.Error("unsupported protocol version", "version", handshakeVersion)
-		protocol.WriteACK(conn, protocol.StatusReject, "unsupported protocol version", "", protocol.CompressionGzip)
+	// Agent anterior às versões aceitas: recusa antes de ler o restante. O
+	// ACK informa o intervalo aceito para o operador saber qual lado atualizar.
+	if versionBuf[0] < protocol.MinProtocolVersion {
+		mismatch := &protocol.VersionMismatchError{Agent: versionBuf[0], Server: protocol.SupportedVersions}
+		logger.Error("unsupported protocol version",
+			"version", versionBuf[0], "supported", protocol.SupportedVersions.String(), "upgrade", mismatch.Upgrade())
+		protocol.WriteACKVersionMismatch(conn, mismatch.Error(), protocol.SupportedVersions)
 		return
 	}
+	// Agent mais novo: o handshake tem o mesmo formato em todas as versões, e
+	// a sessão segue na maior versão deste server, informada no ACK
+	handshakeVersion := min(versionBuf[0], protocol.MaxProtocolVersion)
 
 	// Deadline para leitura do handshake (previne slowloris)
 	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
@@ -91,6 +100,7 @@ func (h *Handler) handleBackup(ctx context.Context, conn net.Conn, logger *slog.
 
 	logger = logger.With("agent", agentName, "storage", storageName, "backup", backupName, "client_ver", clientVersion)
 	logger.Info("backup handshake received")
+	h.traceAnnotate(conn, protocol.TraceInfo{Conn: "primary", Agent: agentName, Storage: storageName, Backup: backupName, Peer: clientVersion})
 
 	// Emite evento de início de sessão
 	if h.Events != nil {
@@ -120,15 +130,115 @@ func (h *Handler) handleBackup(ctx context.Context, conn net.Conn, logger *slog.
 		return
 	}
 
+	// Controle de acesso: CRL (tls.crl_file) e allow-list (tls.allowed_agents)
+	if err := h.authorizeAgent(ctx, conn, logger); err != nil {
+		sendACK(conn, handshakeVersion, protocol.StatusUnauthorized,
+			fmt.Sprintf("agent %q not authorized: %s", agentName, err), "")
+		return
+	}
+
+	// Placement: o agent pediu um placement em vez de um storage — o server
+	// escolhe o storage real e a sessão segue com ele.
+	var placement string
+	if placed, policy, ok := h.resolvePlacement(storageName, agentName, backupName); ok {
+		logger = logger.With("placed_storage", placed)
+		logger.Info("placement selected storage", "placement", storageName, "policy", policy)
+		placement, storageName = storageName, placed
+	}
+
 	// Busca storage nomeado
 	conn.SetReadDeadline(time.Time{}) // limpa deadline do handshake
-	storageInfo, ok := h.cfg.GetStorage(storageName)
+	storageInfo, ok := h.config().GetStorage(storageName)
 	if !ok {
 		logger.Warn("storage not found")
 		sendACK(conn, handshakeVersion, protocol.StatusStorageNotFound, fmt.Sprintf("storage %q not found", storageName), "")
 		return
 	}
 
+	// Benchmark (nbackup-agent bench): os dados sintéticos não podem virar
+	// backup, então a sessão só é aceita em storage discard
+	if backupName == protocol.BenchBackupName && !storageInfo.IsDiscard() {
+		logger.Warn("rejecting benchmark session: storage is not of type discard")
+		sendACK(conn, handshakeVersion, protocol.StatusReject,
+			fmt.Sprintf("storage %q is not of type discard (required by nbackup-agent bench)", storageName), "")
+		return
+	}
+
+	// Backup window: fora da janela, o handshake é recusado e o agent é avisado
+	// via ControlDefer (quando há control channel) de quanto tempo esperar.
+	if w := storageInfo.BackupWindowRaw; w != nil && !w.Contains(time.Now()) {
+		wait := w.UntilOpen(time.Now())
+		logger.Info("handshake outside backup window, deferring",
+			"window", w.String(), "opens_in", wait.Round(time.Minute))
+		h.sendControlDefer(agentName, wait, logger)
+		if h.Events != nil {
+			h.Events.PushEvent("info", "backup_deferred", agentName,
+				fmt.Sprintf("%s/%s deferred: outside backup window %s (opens in %s)", storageName, backupName, w.String(), wait.Round(time.Minute)), 0)
+		}
+		sendACK(conn, handshakeVersion, protocol.StatusOutsideWindow,
+			fmt.Sprintf("outside backup window %s, opens in %s", w.String(), wait.Round(time.Minute)), "")
+		return
+	}
+
+	// Saúde do disco (disk_health): disco failing, ou degraded com
+	// on_degraded: read_only, recusa novos backups; degraded com verify força
+	// verify_integrity nesta sessão.
+	if readOnly, st := h.storageReadOnly(storageName, storageInfo); readOnly {
+		logger.Warn("rejecting backup: storage is read-only due to disk health", "disk_health", st.State, "detail", st.Detail)
+		if h.Events != nil {
+			h.Events.Push(observability.EventEntry{
+				Level:   "error",
+				Type:    "storage_read_only",
+				Agent:   agentName,
+				Storage: storageName,
+				Backup:  backupName,
+				Message: fmt.Sprintf("%s/%s rejected: storage is read-only (disk %s)", storageName, backupName, st.State),
+			})
+		}
+		sendACK(conn, handshakeVersion, protocol.StatusReadOnly,
+			fmt.Sprintf("storage %q is read-only: disk health %s", storageName, st.State), "")
+		return
+	}
+	if !storageInfo.VerifyIntegrity && h.storageForceVerify(storageName, storageInfo) {
+		logger.Info("forcing verify_integrity: storage disk is degraded")
+		storageInfo.VerifyIntegrity = true
+	}
+
+	// Admission control: storage sem inodes (ou sem espaço) recusa o handshake
+	// com STATUS FULL em vez de falhar depois com um write error genérico
+	if err := checkStorageCapacity(storageInfo); err != nil {
+		// min_free_space/quota: o agent adia o backup em vez de falhar
+		if errors.Is(err, errLowSpace) {
+			logger.Warn("deferring backup: storage low on space", "error", err)
+			h.sendControlDefer(agentName, lowSpaceDeferWait, logger)
+			if h.Events != nil {
+				h.Events.Push(observability.EventEntry{
+					Level:   "warn",
+					Type:    "storage_low_space",
+					Agent:   agentName,
+					Storage: storageName,
+					Backup:  backupName,
+					Message: fmt.Sprintf("%s/%s deferred: %v", storageName, backupName, err),
+				})
+			}
+			sendACK(conn, handshakeVersion, protocol.StatusLowSpace, err.Error(), "")
+			return
+		}
+		logger.Warn("rejecting backup: storage capacity", "error", err)
+		if h.Events != nil {
+			h.Events.Push(observability.EventEntry{
+				Level:   "error",
+				Type:    "storage_full",
+				Agent:   agentName,
+				Storage: storageName,
+				Backup:  backupName,
+				Message: fmt.Sprintf("%s/%s rejected: %v", storageName, backupName, err),
+			})
+		}
+		sendACK(conn, handshakeVersion, protocol.StatusFull, err.Error(), "")
+		return
+	}
+
 	// Lock: por agent:storage:backup (permite backups simultâneos de entries diferentes)
 	lockKey := agentName + ":" + storageName + ":" + backupName
 	if _, loaded := h.locks.LoadOrStore(lockKey, true); loaded {
@@ -141,14 +251,32 @@ func (h *Handler) handleBackup(ctx context.Context, conn net.Conn, logger *slog.
 	// Gera sessionID
 	sessionID := generateSessionID()
 	logger = logger.With("session", sessionID)
+	h.traceIdentify(conn, protocol.TraceInfo{Agent: agentName, Session: sessionID})
 
 	// ACK GO
 	compressionMode := storageInfo.CompressionModeByte()
-	if err := protocol.WriteACK(conn, protocol.StatusGo, "", sessionID, compressionMode); err != nil {
+	if err := writeHandshakeACK(conn, handshakeVersion, protocol.StatusGo, "", sessionID, compressionMode); err != nil {
 		logger.Error("writing ACK", "error", err)
 		return
 	}
 
+	// Handshake v7+: o agent pede a janela de SACK logo após o ACK GO e
+	// aguarda a concedida (nil = agent v6, intervalo default)
+	var window *protocol.SACKWindow
+	if handshakeVersion >= protocol.HandshakeVersionSACKWindow {
+		req, err := protocol.ReadSACKWindow(conn)
+		if err != nil {
+			logger.Error("reading sack window", "error", err)
+			return
+		}
+		granted := negotiateSACKWindow(*req)
+		if err := protocol.WriteSACKWindow(conn, granted); err != nil {
+			logger.Error("writing sack window", "error", err)
+			return
+		}
+		window = &granted
+	}
+
 	// Detecta modo: lê 1 byte discriminador
 	// 0x00 = single-stream, 1-255 = MaxStreams de ParallelInit → modo paralelo
 	br := bufio.NewReaderSize(conn, 8)
@@ -159,22 +287,34 @@ func (h *Handler) handleBackup(ctx context.Context, conn net.Conn, logger *slog.
 	}
 
 	if modeByte[0] >= 1 {
-		// Modo paralelo — o byte já lido é MaxStreams; lê ChunkSize (4B restantes)
-		pi, err := protocol.ReadParallelInitAfterMaxStreams(br, modeByte[0])
+		// Modo paralelo — o byte já lido é MaxStreams; lê ChunkSize (e ChunkSizeMax em v8+)
+		pi, err := protocol.ReadParallelInitAfterMaxStreams(br, modeByte[0], handshakeVersion)
 		if err != nil {
 			logger.Error("reading ParallelInit", "error", err)
 			return
 		}
-		logger.Info("parallel mode detected", "maxStreams", pi.MaxStreams, "chunkSize", pi.ChunkSize)
+		logger.Info("parallel mode detected", "maxStreams", pi.MaxStreams, "chunkSize", pi.ChunkSize, "chunkSizeMax", pi.ChunkSizeMax)
+		h.Audit.Begin(lockKey, observability.AuditRecord{
+			SessionID: sessionID, Event: observability.AuditHandshake,
+			Agent: agentName, Storage: storageName, Backup: backupName, Placement: placement,
+			ClientVersion: clientVersion, Protocol: handshakeVersion, RemoteAddr: conn.RemoteAddr().String(),
+			Mode: "parallel", Compression: storageInfo.CompressionMode, MaxStreams: pi.MaxStreams, ChunkSize: pi.ChunkSize,
+		})
 
-		h.handleParallelBackup(ctx, conn, br, sessionID, agentName, storageName, backupName, clientVersion, storageInfo, pi, lockKey, logger)
+		h.handleParallelBackup(ctx, conn, br, sessionID, agentName, storageName, placement, backupName, clientVersion, storageInfo, pi, lockKey, logger)
 		return
 	}
 
 	// Modo single-stream — byte 0x00 já consumido, br contém os dados
+	h.Audit.Begin(lockKey, observability.AuditRecord{
+		SessionID: sessionID, Event: observability.AuditHandshake,
+		Agent: agentName, Storage: storageName, Backup: backupName, Placement: placement,
+		ClientVersion: clientVersion, Protocol: handshakeVersion, RemoteAddr: conn.RemoteAddr().String(),
+		Mode: "single", Compression: storageInfo.CompressionMode,
+	})
 
 	// Prepara escrita atômica
-	writer, err := NewAtomicWriter(storageInfo.BaseDir, agentName, backupName, storageInfo.FileExtension())
+	writer, err := NewStorageWriter(storageInfo, agentName, backupName)
 	if err != nil {
 		logger.Error("creating atomic writer", "error", err)
 		if ackErr := protocol.WriteParallelInitACK(conn, protocol.ParallelInitStatusError); ackErr != nil {
@@ -185,7 +325,7 @@ func (h *Handler) handleBackup(ctx context.Context, conn net.Conn, logger *slog.
 
 	tmpFile, tmpPath, err := writer.TempFile()
 	if err != nil {
-		logger.Error("creating temp file", "error", err)
+		logger.Error("creating temp file", "error", describeNoSpace(storageInfo.BaseDir, err))
 		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
 		return
 	}
@@ -196,19 +336,35 @@ func (h *Handler) handleBackup(ctx context.Context, conn net.Conn, logger *slog.
 		TmpPath:         tmpPath,
 		AgentName:       agentName,
 		StorageName:     storageName,
+		Placement:       placement,
 		BackupName:      backupName,
 		BaseDir:         storageInfo.BaseDir,
 		CreatedAt:       now,
 		ClientVersion:   clientVersion,
 		CompressionMode: storageInfo.CompressionMode,
+		Config:          newSessionConfigSnapshot(storageInfo, 0, 0),
 		Phase:           NewSessionPhaseTracker(),
+		hash:            newReceiveHash(),
+	}
+	if window != nil {
+		session.Config.SACKInterval = int64(window.Interval)
+		session.Config.MaxInFlight = int64(window.MaxInFlight)
+		logger.Info("sack window negotiated", "sack_interval", window.Interval, "max_inflight", window.MaxInFlight)
 	}
 	session.LastActivity.Store(now.UnixNano())
-	h.sessions.Store(sessionID, session)
+	h.storeSession(sessionID, session)
+	session.attachConn(conn)
+	defer session.attachConn(nil)
+	// keep: a conexão caiu no meio do stream e a sessão fica para o resume
+	// (expira pelo TTL de CleanupExpiredSessions se o agent não voltar)
+	keep := false
 	defer func() {
+		if keep {
+			return
+		}
 		// Mantém sessão visível por 3s para que o WebUI capture a fase final
 		time.AfterFunc(3*time.Second, func() {
-			h.sessions.Delete(sessionID)
+			h.deleteSession(sessionID)
 		})
 	}()
 
@@ -216,16 +372,26 @@ func (h *Handler) handleBackup(ctx context.Context, conn net.Conn, logger *slog.
 	bytesReceived, err := h.receiveWithSACK(ctx, br, conn, tmpFile, tmpPath, session, logger)
 	tmpFile.Close()
 
+	if session.cancelled.Load() {
+		logger.Info("session cancelled via api, discarding data", "bytes", bytesReceived)
+		return
+	}
 	if err != nil {
+		err = describeNoSpace(storageInfo.BaseDir, err)
+		// Disco cheio: resume não adianta, descarta o tmp e avisa o agent
+		if h.abortOnDiskFull(sessionID, agentName, storageName, backupName, err, logger) {
+			return
+		}
 		logger.Error("receiving data stream", "error", err, "bytes", bytesReceived)
 		// NÃO aborta o tmp — mantém para resume
+		keep = true
 		return
 	}
 
 	// Remove sessão parcial — backup recebido com sucesso, resume não será necessário
 
-	result, dataSize := h.validateAndCommitSingle(conn, writer, tmpPath, bytesReceived, storageInfo, session, lockKey, logger)
-	h.recordSessionEnd(sessionID, agentName, storageName, backupName, "single", storageInfo.CompressionMode, result, now, dataSize)
+	result, dataSize := h.validateAndCommitSingle(conn, writer, tmpPath, bytesReceived, session.hash, storageInfo, session, lockKey, logger)
+	h.recordSessionEnd(sessionID, agentName, storageName, backupName, "single", storageInfo.CompressionMode, result, now, dataSize, session.Config, nil)
 	if result == "ok" {
 		session.Phase.Set(PhaseDone)
 	} else {
@@ -243,6 +409,7 @@ func (h *Handler) handleResume(ctx context.Context, conn net.Conn, logger *slog.
 
 	logger = logger.With("session", resume.SessionID, "agent", resume.AgentName, "storage", resume.StorageName)
 	logger.Info("resume request received")
+	h.traceIdentify(conn, protocol.TraceInfo{Conn: "resume", Agent: resume.AgentName, Storage: resume.StorageName, Session: resume.SessionID})
 
 	// Busca sessão parcial
 	raw, ok := h.sessions.Load(resume.SessionID)
@@ -251,6 +418,10 @@ func (h *Handler) handleResume(ctx context.Context, conn net.Conn, logger *slog.
 		protocol.WriteResumeACK(conn, protocol.ResumeStatusNotFound, 0)
 		return
 	}
+	if pSession, ok := raw.(*ParallelSession); ok {
+		h.handleParallelResume(ctx, conn, resume, pSession, logger)
+		return
+	}
 	session, ok := raw.(*PartialSession)
 	if !ok {
 		logger.Warn("resume: session is not a PartialSession (type mismatch)",
@@ -260,7 +431,8 @@ func (h *Handler) handleResume(ctx context.Context, conn net.Conn, logger *slog.
 	}
 
 	// Valida agent e storage
-	if session.AgentName != resume.AgentName || session.StorageName != resume.StorageName {
+	// O agent repete no resume o storage do handshake, que pode ser um placement
+	if session.AgentName != resume.AgentName || (session.StorageName != resume.StorageName && (session.Placement == "" || session.Placement != resume.StorageName)) {
 		logger.Warn("resume session mismatch",
 			"expected_agent", session.AgentName, "got_agent", resume.AgentName,
 			"expected_storage", session.StorageName, "got_storage", resume.StorageName)
@@ -272,13 +444,19 @@ func (h *Handler) handleResume(ctx context.Context, conn net.Conn, logger *slog.
 	fi, err := os.Stat(session.TmpPath)
 	if err != nil {
 		logger.Warn("tmp file gone for resume", "path", session.TmpPath, "error", err)
-		h.sessions.Delete(resume.SessionID)
+		h.deleteSession(resume.SessionID)
 		protocol.WriteResumeACK(conn, protocol.ResumeStatusNotFound, 0)
 		return
 	}
 
 	lastOffset := fi.Size()
 	session.BytesWritten.Store(lastOffset)
+	if session.hash != nil && session.hash.size() != lastOffset {
+		// O tmp não tem exatamente os bytes vistos pelo hash (flush perdido na queda)
+		logger.Warn("incremental hash out of sync with tmp file, checksum will be computed from disk",
+			"hashed", session.hash.size(), "last_offset", lastOffset)
+		session.hash = nil
+	}
 	logger.Info("resume accepted", "last_offset", lastOffset)
 
 	if err := protocol.WriteResumeACK(conn, protocol.ResumeStatusOK, uint64(lastOffset)); err != nil {
@@ -293,6 +471,12 @@ func (h *Handler) handleResume(ctx context.Context, conn net.Conn, logger *slog.
 		return
 	}
 	defer h.locks.Delete(lockKey)
+	h.Audit.Begin(lockKey, observability.AuditRecord{
+		SessionID: resume.SessionID, Event: observability.AuditResume,
+		Agent: session.AgentName, Storage: session.StorageName, Backup: session.BackupName,
+		ClientVersion: session.ClientVersion, RemoteAddr: conn.RemoteAddr().String(),
+		Mode: "single", Offset: lastOffset,
+	})
 
 	// Reabrir tmp file para append
 	tmpFile, err := os.OpenFile(session.TmpPath, os.O_WRONLY|os.O_APPEND, 0644)
@@ -301,7 +485,7 @@ func (h *Handler) handleResume(ctx context.Context, conn net.Conn, logger *slog.
 		return
 	}
 
-	storageInfo, ok := h.cfg.GetStorage(session.StorageName)
+	storageInfo, ok := h.config().GetStorage(session.StorageName)
 	if !ok {
 		logger.Error("storage not found during resume")
 		tmpFile.Close()
@@ -309,48 +493,66 @@ func (h *Handler) handleResume(ctx context.Context, conn net.Conn, logger *slog.
 	}
 
 	// Continua recebendo dados
+	session.attachConn(conn)
 	bytesReceived, err := h.receiveWithSACK(ctx, conn, conn, tmpFile, session.TmpPath, session, logger)
+	session.attachConn(nil)
 	tmpFile.Close()
 
 	totalBytes := lastOffset + bytesReceived
 
+	if session.cancelled.Load() {
+		logger.Info("session cancelled via api, discarding data", "new_bytes", bytesReceived)
+		return
+	}
 	if err != nil {
+		err = describeNoSpace(storageInfo.BaseDir, err)
+		if h.abortOnDiskFull(resume.SessionID, session.AgentName, session.StorageName, session.BackupName, err, logger) {
+			return
+		}
 		logger.Error("receiving resumed data", "error", err, "new_bytes", bytesReceived, "total", totalBytes)
 		return
 	}
 
 	// Sucesso — remove sessão
-	h.sessions.Delete(resume.SessionID)
+	h.deleteSession(resume.SessionID)
 
 	// Validação e commit
-	writer, wErr := NewAtomicWriter(storageInfo.BaseDir, session.AgentName, session.BackupName, storageInfo.FileExtension())
+	writer, wErr := NewStorageWriter(storageInfo, session.AgentName, session.BackupName)
 	if wErr != nil {
 		logger.Error("creating atomic writer for resume", "error", wErr)
 		return
 	}
 
-	result, dataSize := h.validateAndCommitSingle(conn, writer, session.TmpPath, totalBytes, storageInfo, nil, lockKey, logger)
-	h.recordSessionEnd(resume.SessionID, session.AgentName, session.StorageName, session.BackupName, "single", session.CompressionMode, result, session.CreatedAt, dataSize)
+	result, dataSize := h.validateAndCommitSingle(conn, writer, session.TmpPath, totalBytes, session.hash, storageInfo, nil, lockKey, logger)
+	h.recordSessionEnd(resume.SessionID, session.AgentName, session.StorageName, session.BackupName, "single", session.CompressionMode, result, session.CreatedAt, dataSize, session.Config, nil)
 }
 
 // receiveWithSACK lê dados do conn, escreve no tmpFile, e envia SACKs periódicos.
 // Retorna o número de bytes recebidos nesta sessão (não o total do arquivo).
 func (h *Handler) receiveWithSACK(ctx context.Context, reader io.Reader, sackWriter io.Writer, tmpFile *os.File, tmpPath string, session *PartialSession, logger *slog.Logger) (int64, error) {
-	bufConn := bufio.NewReaderSize(reader, singleStreamIOBufferSize)
-	bufFile := bufio.NewWriterSize(tmpFile, singleStreamIOBufferSize)
+	// Buffer de escrita em disco do storage (write_buffer_size); o flush também
+	// ocorre antes de cada SACK, então valores acima do intervalo não agregam.
+	writeBufSize := singleStreamIOBufferSize
+	if si, ok := h.config().GetStorage(session.StorageName); ok {
+		writeBufSize = writeBufferSize(si)
+	}
+	bufConn := bufio.NewReaderSize(h.ingest.reader(ctx, reader, session.StorageName), singleStreamIOBufferSize)
+	bufFile := bufio.NewWriterSize(h.disk.queue(session.StorageName).writer(tmpFile), writeBufSize)
 
 	var bytesReceived int64
 	var lastSACK int64
 	var sackErr atomic.Value // armazena erro de SACK para não bloquear
+	interval := session.sackInterval()
 
 	// Sliding read deadline: reseta a cada read bem-sucedido.
 	// Se a rede morrer silenciosamente (sem TCP RST), o read expirará em vez de travar para sempre.
 	netConn, hasDeadline := sackWriter.(net.Conn)
+	inactivity := h.inactivityTimeout()
 
 	buf := make([]byte, singleStreamIOBufferSize)
 	for {
 		if hasDeadline {
-			netConn.SetReadDeadline(time.Now().Add(readInactivityTimeout))
+			netConn.SetReadDeadline(time.Now().Add(inactivity))
 		}
 		n, readErr := bufConn.Read(buf)
 		if n > 0 {
@@ -358,17 +560,24 @@ func (h *Handler) receiveWithSACK(ctx context.Context, reader io.Reader, sackWri
 				bufFile.Flush()
 				return bytesReceived, fmt.Errorf("writing to tmp: %w", wErr)
 			}
+			if session.hash != nil {
+				session.hash.Write(buf[:n])
+			}
 			bytesReceived += int64(n)
 			totalWritten := session.BytesWritten.Add(int64(n))
 			session.LastActivity.Store(time.Now().UnixNano())
 			h.TrafficIn.Add(int64(n))
 			h.DiskWrite.Add(int64(n))
 
-			// Envia SACK a cada sackInterval bytes
-			if bytesReceived-lastSACK >= sackInterval {
+			// Envia SACK a cada intervalo negociado
+			if bytesReceived-lastSACK >= interval {
 				if fErr := bufFile.Flush(); fErr != nil {
 					return bytesReceived, fmt.Errorf("flushing before sack: %w", fErr)
 				}
+				if d := h.chaos.sackDelay(); d > 0 {
+					logger.Debug("chaos: delaying SACK", "delay", d)
+					time.Sleep(d)
+				}
 				if sErr := protocol.WriteSACK(sackWriter, uint64(totalWritten)); sErr != nil {
 					sackErr.Store(sErr)
 					logger.Warn("failed to send SACK", "error", sErr, "offset", totalWritten)
@@ -376,10 +585,29 @@ func (h *Handler) receiveWithSACK(ctx context.Context, reader io.Reader, sackWri
 					logger.Debug("SACK sent", "offset", totalWritten)
 				}
 				lastSACK = bytesReceived
+
+				// Chaos mode: derruba a conexão logo após o SACK (força resume)
+				if h.chaos.shouldDrop() {
+					logger.Warn("chaos: dropping single-stream connection", "offset", totalWritten)
+					if h.Events != nil {
+						h.Events.PushEvent("warn", "chaos_drop", session.AgentName, fmt.Sprintf("single-stream dropped by chaos mode at offset %d", totalWritten), 0)
+					}
+					return bytesReceived, errChaosDrop
+				}
 			}
 		}
 
 		if readErr != nil {
+			// Sem bytes há inactivity, mas o agent segue reportando
+			// progresso pelo canal de controle (produtor lento, ex: varredura de
+			// milhões de arquivos pequenos): renova o deadline em vez de derrubar.
+			var netErr net.Error
+			if hasDeadline && ctx.Err() == nil && errors.As(readErr, &netErr) && netErr.Timeout() &&
+				session.progressSince(time.Now().Add(-inactivity)) {
+				logger.Debug("no data within inactivity timeout, agent still reporting progress",
+					"timeout", inactivity, "objects_sent", session.ObjectsSent.Load())
+				continue
+			}
 			// Flush antes de retornar
 			if fErr := bufFile.Flush(); fErr != nil && readErr == io.EOF {
 				return bytesReceived, fmt.Errorf("flushing file: %w", fErr)
@@ -394,9 +622,10 @@ func (h *Handler) receiveWithSACK(ctx context.Context, reader io.Reader, sackWri
 
 // validateAndCommitSingle valida o trailer, checksum e comita o backup.
 // Retorna (resultado, dataSize). resultado: "ok", "checksum_mismatch" ou "write_error".
+// hash é o SHA-256 calculado durante a recepção; nil relê tmpPath.
 // session pode ser nil (resume não tem PartialSession com phase tracker).
 // lockKey identifica o lock agent:storage:backup para liberação antecipada em async_upload.
-func (h *Handler) validateAndCommitSingle(conn net.Conn, writer *AtomicWriter, tmpPath string, totalBytes int64, storageInfo config.StorageInfo, session *PartialSession, lockKey string, logger *slog.Logger) (string, int64) {
+func (h *Handler) validateAndCommitSingle(conn net.Conn, writer *AtomicWriter, tmpPath string, totalBytes int64, hash *receiveHash, storageInfo config.StorageInfo, session *PartialSession, lockKey string, logger *slog.Logger) (string, int64) {
 	const trailerSize int64 = 4 + 32 + 8
 
 	if totalBytes < trailerSize {
@@ -417,6 +646,18 @@ func (h *Handler) validateAndCommitSingle(conn net.Conn, writer *AtomicWriter, t
 
 	// Trunca o arquivo para remover o trailer (mantém apenas os dados)
 	dataSize := totalBytes - trailerSize
+
+	// Bytes entre o archive e o trailer: frame Manifest (manifest de arquivos)
+	if trailer.Size < uint64(dataSize) {
+		if err := extractManifestFrame(tmpPath, int64(trailer.Size), totalBytes); err != nil {
+			logger.Error("reading file manifest", "error", err)
+			writer.Abort(tmpPath)
+			protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
+			return "write_error", dataSize
+		}
+		dataSize = int64(trailer.Size)
+	}
+
 	if err := os.Truncate(tmpPath, dataSize); err != nil {
 		logger.Error("truncating temp file", "error", err)
 		writer.Abort(tmpPath)
@@ -424,8 +665,17 @@ func (h *Handler) validateAndCommitSingle(conn net.Conn, writer *AtomicWriter, t
 		return "write_error", dataSize
 	}
 
-	// Calcula SHA-256 dos dados (sem trailer)
-	serverChecksum, err := hashFile(tmpPath)
+	// SHA-256 dos dados (sem trailer): do hash incremental ou relendo o arquivo
+	var serverChecksum [32]byte
+	hashed := false
+	if hash != nil {
+		if serverChecksum, hashed = hash.sum(dataSize); !hashed {
+			logger.Debug("incremental hash unavailable for data size, hashing tmp file", "data_size", dataSize)
+		}
+	}
+	if !hashed {
+		serverChecksum, err = hashFile(tmpPath)
+	}
 	if err != nil {
 		logger.Error("computing server checksum", "error", err)
 		writer.Abort(tmpPath)
@@ -444,6 +694,22 @@ func (h *Handler) validateAndCommitSingle(conn net.Conn, writer *AtomicWriter, t
 		return "checksum_mismatch", dataSize
 	}
 
+	// Storage discard (benchmark): validado, mas nada é commitado
+	if storageInfo.IsDiscard() && (dataSize > 0 || trailer.IsEmpty()) {
+		return h.discardBackup(conn, writer, tmpPath, dataSize, serverChecksum, logger), dataSize
+	}
+
+	// Payload vazio: só é válido quando o agent declara um backup vazio
+	if dataSize == 0 {
+		if !trailer.IsEmpty() {
+			logger.Error("no data received", "trailer_size", trailer.Size)
+			writer.Abort(tmpPath)
+			protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
+			return "write_error", 0
+		}
+		return h.commitEmptyBackup(conn, writer, storageInfo, tmpPath, lockKey, logger), 0
+	}
+
 	// Commit (rename atômico)
 	finalPath, err := writer.Commit(tmpPath)
 	if err != nil {
@@ -451,6 +717,13 @@ func (h *Handler) validateAndCommitSingle(conn net.Conn, writer *AtomicWriter, t
 		protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
 		return "write_error", dataSize
 	}
+	h.auditCommit(lockKey, finalPath, "")
+
+	// Índice de membros para o restore de arquivos individuais
+	h.indexArchive(finalPath, storageInfo, logger)
+
+	// Storage imutável: registra no ledger e trava o backup
+	h.sealBackup(storageInfo, writer.AgentName(), finalPath, serverChecksum, logger)
 
 	// Verifica integridade do archive antes de rotacionar.
 	// Se falhar, o backup fica no disco mas NÃO apaga os antigos (fail-safe).
@@ -475,6 +748,15 @@ func (h *Handler) validateAndCommitSingle(conn net.Conn, writer *AtomicWriter, t
 		logger.Info("backup integrity verified", "path", finalPath)
 	}
 
+	// Storage dedup: o archive vira um manifest de chunks do pool
+	if storageInfo.IsDedup() {
+		if session != nil {
+			session.Phase.Set(PhaseDeduplicating)
+		}
+		finalPath = h.ingestDedup(storageInfo, bucketCtxFromSession(session).Storage, writer.AgentName(), writer.backupName, finalPath, logger)
+		h.auditCommit(lockKey, finalPath, "dedup manifest")
+	}
+
 	// Archive pre-Rotate: envia backups que SERÃO deletados pelo Rotate
 	// (antes da deleção, para que os arquivos ainda existam no disco).
 	if hasArchiveBuckets(storageInfo.Buckets) {
@@ -484,7 +766,7 @@ func (h *Handler) validateAndCommitSingle(conn net.Conn, writer *AtomicWriter, t
 	}
 
 	// Rotação
-	removed, err := Rotate(writer.AgentDir(), storageInfo.MaxBackups)
+	removed, err := h.rotateBackups(storageInfo, writer.AgentName(), writer.AgentDir(), logger)
 	if err != nil {
 		logger.Warn("rotation failed", "error", err)
 	}
@@ -494,6 +776,12 @@ func (h *Handler) validateAndCommitSingle(conn net.Conn, writer *AtomicWriter, t
 			h.Events.PushEvent("warn", "backup_rotated", writer.AgentName(), fmt.Sprintf("deleted old backup: %s", name), 0)
 		}
 	}
+	h.collectDedupGarbage(storageInfo.BaseDir, removed, logger)
+
+	// Ações post_commit (comando, rclone): em background, não atrasam o FinalACK
+	if len(storageInfo.PostCommit) > 0 {
+		go h.runPostCommitActions(storageInfo, finalPath, bucketCtxFromSession(session), logger)
+	}
 
 	// Object Storage pós-commit (sync/offload — archive já tratado acima)
 	// Offload bloqueia até upload confirmado; sync é fire-and-forget.
@@ -535,8 +823,39 @@ const maxHandshakeFieldLen = 512
 
 // sendACK envia um ACK com CompressionMode default (gzip).
 // Desde v4.0.0, todos os clients devem suportar o campo CompressionMode.
-func sendACK(conn net.Conn, _ byte, status byte, message, sessionID string) error {
-	return protocol.WriteACK(conn, status, message, sessionID, protocol.CompressionGzip)
+func sendACK(conn net.Conn, version byte, status byte, message, sessionID string) error {
+	return writeHandshakeACK(conn, version, status, message, sessionID, protocol.CompressionGzip)
+}
+
+// writeHandshakeACK envia o ACK do handshake no formato do agent: com a
+// versão negociada (ACKFlagVersion) se o agent anunciou uma versão acima de
+// v6, ou o ACK v4 puro.
+func writeHandshakeACK(conn net.Conn, version byte, status byte, message, sessionID string, compressionMode byte) error {
+	if version > protocol.ProtocolVersion {
+		return protocol.WriteACKVersion(conn, status, message, sessionID, compressionMode, version)
+	}
+	return protocol.WriteACK(conn, status, message, sessionID, compressionMode)
+}
+
+// negotiateSACKWindow ajusta a janela pedida pelo agent aos limites do
+// server: intervalo entre MinSACKInterval e MaxSACKInterval (0 = default) e
+// no máximo metade de MaxInFlight, para que o agent nunca espere por um SACK
+// que o server só enviaria com mais bytes do que a janela permite.
+func negotiateSACKWindow(req protocol.SACKWindow) protocol.SACKWindow {
+	interval := int64(req.Interval)
+	if interval == 0 {
+		interval = sackInterval
+	}
+	interval = min(max(interval, protocol.MinSACKInterval), protocol.MaxSACKInterval)
+
+	inflight := int64(req.MaxInFlight)
+	if inflight > 0 {
+		if interval > inflight/2 {
+			interval = max(inflight/2, protocol.MinSACKInterval)
+		}
+		inflight = max(inflight, 2*interval)
+	}
+	return protocol.SACKWindow{Interval: uint32(interval), MaxInFlight: uint64(inflight)}
 }
 
 // readUntilNewline lê bytes até encontrar '\n', retornando a string sem o delimitador.
@@ -580,6 +899,60 @@ func readTrailerFromFile(path string, trailerSize int64) (*protocol.Trailer, err
 	return protocol.ReadTrailer(f)
 }
 
+// extractManifestFrame extrai para path+manifest.Suffix o frame Manifest
+// gravado em path entre o fim do archive (archiveSize) e o trailer, que
+// termina em totalBytes.
+func extractManifestFrame(path string, archiveSize, totalBytes int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening file for manifest: %w", err)
+	}
+	defer f.Close()
+
+	out := &manifestFile{path: path + manifest.Suffix}
+	defer out.Close()
+
+	frame := io.NewSectionReader(f, archiveSize, totalBytes-archiveSize)
+	_, hasManifest, err := protocol.ReadTrailerWithManifest(frame, out)
+	if err != nil {
+		return err
+	}
+	if pos, _ := frame.Seek(0, io.SeekCurrent); !hasManifest || pos != frame.Size() {
+		return fmt.Errorf("unexpected data between archive and trailer (%d bytes)", totalBytes-archiveSize)
+	}
+	return out.Close()
+}
+
+// manifestFile é o destino do frame Manifest: o arquivo em path só é criado
+// se o frame vier. onWrite, se não nil, é chamado a cada escrita.
+type manifestFile struct {
+	path    string
+	f       *os.File
+	onWrite func()
+}
+
+func (m *manifestFile) Write(p []byte) (int, error) {
+	if m.f == nil {
+		f, err := os.Create(m.path)
+		if err != nil {
+			return 0, fmt.Errorf("creating manifest file: %w", err)
+		}
+		m.f = f
+	}
+	if m.onWrite != nil {
+		m.onWrite()
+	}
+	return m.f.Write(p)
+}
+
+// Close fecha o arquivo, se criado.
+func (m *manifestFile) Close() error {
+	if m.f == nil {
+		return nil
+	}
+	return m.f.Close()
+}
+
 // hashFile calcula o SHA-256 do conteúdo completo do arquivo.
 func hashFile(path string) ([32]byte, error) {
 	f, err := os.Open(path)
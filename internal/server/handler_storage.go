@@ -11,8 +11,8 @@
 // filepath.WalkDir a cada request HTTP.
 //
 // O CleanupExpiredSessions remove sessões parciais (single e parallel)
-// que ultrapassaram o TTL de inatividade, liberando recursos e arquivos
-// temporários no disco.
+// que ultrapassaram o TTL de inatividade (storages.*.session_ttl),
+// liberando recursos e arquivos temporários no disco.
 
 package server
 
@@ -27,6 +27,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/nishisan-dev/n-backup/internal/dedup"
 	"github.com/nishisan-dev/n-backup/internal/server/observability"
 )
 
@@ -35,11 +36,26 @@ import (
 // Quando não há cache (ex: WebUI desabilitada), faz scan síncrono.
 // Implementa observability.HandlerMetrics.
 func (h *Handler) StorageUsageSnapshot() []observability.StorageUsage {
+	var result []observability.StorageUsage
 	if cached := h.storageCache.Load(); cached != nil {
-		return cached.([]observability.StorageUsage)
+		// Copia para não mutar o cache compartilhado ao atualizar WindowOpen
+		result = append([]observability.StorageUsage(nil), cached.([]observability.StorageUsage)...)
+	} else {
+		// Fallback: scan síncrono (geralmente só quando WebUI está desabilitada)
+		result = h.scanStorages()
+	}
+
+	// Estado da backup_window é calculado no momento da consulta, não no scan
+	now := time.Now()
+	storages := h.config().Storages
+	for i := range result {
+		result[i].WindowOpen = true
+		if w := storages[result[i].Name].BackupWindowRaw; w != nil {
+			result[i].BackupWindow = w.String()
+			result[i].WindowOpen = w.Contains(now)
+		}
 	}
-	// Fallback: scan síncrono (geralmente só quando WebUI está desabilitada)
-	return h.scanStorages()
+	return result
 }
 
 // refreshStorageCache executa o scan de storages e armazena no cache atômico.
@@ -71,14 +87,15 @@ func (h *Handler) scanStorages() []observability.StorageUsage {
 	var result []observability.StorageUsage
 
 	// Ordena nomes para output determinístico
-	names := make([]string, 0, len(h.cfg.Storages))
-	for name := range h.cfg.Storages {
+	storages := h.config().Storages
+	names := make([]string, 0, len(storages))
+	for name := range storages {
 		names = append(names, name)
 	}
 	sort.Strings(names)
 
 	for _, name := range names {
-		si := h.cfg.Storages[name]
+		si := storages[name]
 		su := observability.StorageUsage{
 			Name:            name,
 			BaseDir:         si.BaseDir,
@@ -96,7 +113,14 @@ func (h *Handler) scanStorages() []observability.StorageUsage {
 			if su.TotalBytes > 0 {
 				su.UsagePercent = float64(su.UsedBytes) / float64(su.TotalBytes) * 100.0
 			}
+			// Inodes: lazy assembly e spill criam um arquivo por chunk
+			c := storageCapacity{TotalInodes: stat.Files, FreeInodes: stat.Ffree}
+			su.TotalInodes = c.TotalInodes
+			su.FreeInodes = c.FreeInodes
+			su.InodeUsagePct = c.inodeUsagePercent()
 		}
+		su.MinFreeInodes = si.MinFreeInodesThreshold()
+		su.DiskHealth = h.diskHealthDTO(name, si)
 
 		// Conta backups existentes no diretório
 		su.BackupsCount = countBackups(si.BaseDir)
@@ -107,20 +131,21 @@ func (h *Handler) scanStorages() []observability.StorageUsage {
 	return result
 }
 
-// countBackups conta recursivamente quantos arquivos de backup (.tar.gz / .tar.zst)
-// existem em qualquer nível de profundidade abaixo de baseDir.
-// Ignora diretórios de chunks temporários (chunks_*) para evitar percorrer
-// a estrutura de sharding (256×256 subpastas) durante backups ativos.
+// countBackups conta recursivamente quantos arquivos de backup (.tar.gz /
+// .tar.zst / manifests .dedup) existem em qualquer nível de profundidade
+// abaixo de baseDir. Ignora diretórios de chunks temporários (chunks_*) e o
+// pool dedup para evitar percorrer estruturas de sharding, e backups em
+// quarentena.
 func countBackups(baseDir string) int {
 	count := 0
 	_ = filepath.WalkDir(baseDir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return nil // ignora erros de permissão e continua
 		}
-		if d.IsDir() && strings.HasPrefix(d.Name(), "chunks_") {
+		if d.IsDir() && (strings.HasPrefix(d.Name(), "chunks_") || d.Name() == quarantineDirName || d.Name() == dedup.PoolDirName) {
 			return filepath.SkipDir
 		}
-		if !d.IsDir() && (strings.HasSuffix(d.Name(), ".tar.gz") || strings.HasSuffix(d.Name(), ".tar.zst")) {
+		if !d.IsDir() && isBackupFile(d.Name()) {
 			count++
 		}
 		return nil
@@ -131,56 +156,110 @@ func countBackups(baseDir string) int {
 // CleanupExpiredSessions remove sessões parciais expiradas e seus arquivos .tmp.
 // O critério de expiração é baseado em LastActivity (último I/O bem-sucedido),
 // não em CreatedAt, para evitar matar sessões ativas com backups grandes.
+// O TTL é o session_ttl do storage da sessão; defaultTTL vale para storages
+// sem o campo (configs não validadas, storage removido por reload).
 // Sessões expiradas são registradas no histórico e emitem evento para o dashboard.
-func (h *Handler) CleanupExpiredSessions(ttl time.Duration, logger *slog.Logger) {
+func (h *Handler) CleanupExpiredSessions(defaultTTL time.Duration, logger *slog.Logger) {
 	h.sessions.Range(func(key, value any) bool {
-		switch s := value.(type) {
-		case *PartialSession:
-			lastAct := time.Unix(0, s.LastActivity.Load())
-			if time.Since(lastAct) > ttl {
-				logger.Info("cleaning expired session",
-					"session", key,
-					"agent", s.AgentName,
-					"storage", s.StorageName,
-					"age", time.Since(s.CreatedAt).Round(time.Second),
-					"idle", time.Since(lastAct).Round(time.Second),
-				)
-				h.recordSessionEnd(key.(string), s.AgentName, s.StorageName, s.BackupName, "single", s.CompressionMode, "expired", s.CreatedAt, s.BytesWritten.Load())
-				if h.Events != nil {
-					h.Events.PushEvent("error", "session_expired", s.AgentName, fmt.Sprintf("%s/%s expired (idle %s)", s.StorageName, s.BackupName, time.Since(lastAct).Round(time.Second)), 0)
-				}
-				os.Remove(s.TmpPath)
-				h.sessions.Delete(key)
-			}
-		case *ParallelSession:
-			lastAct := time.Unix(0, s.LastActivity.Load())
-			if time.Since(lastAct) > ttl {
-				logger.Info("cleaning expired parallel session",
-					"session", key,
-					"agent", s.AgentName,
-					"storage", s.StorageName,
-					"age", time.Since(s.CreatedAt).Round(time.Second),
-					"idle", time.Since(lastAct).Round(time.Second),
-				)
-				h.recordSessionEnd(key.(string), s.AgentName, s.StorageName, s.BackupName, "parallel", s.StorageInfo.CompressionMode, "expired", s.CreatedAt, s.DiskWriteBytes.Load())
-				if h.Events != nil {
-					h.Events.PushEvent("error", "session_expired", s.AgentName, fmt.Sprintf("%s/%s expired (idle %s)", s.StorageName, s.BackupName, time.Since(lastAct).Round(time.Second)), 0)
-				}
-				s.Closing.Store(true)
-				for _, slot := range s.Slots {
-					if slot.CancelFn != nil {
-						slot.CancelFn()
-					}
-					slot.ConnMu.Lock()
-					if slot.Conn != nil {
-						slot.Conn.Close()
-					}
-					slot.ConnMu.Unlock()
-				}
-				s.Assembler.Cleanup()
-				h.sessions.Delete(key)
-			}
+		if time.Since(sessionLastActivity(value)) > h.storageSessionTTL(sessionStorage(value), defaultTTL) {
+			h.expireSession(key.(string), value, logger)
 		}
 		return true
 	})
 }
+
+// storageSessionTTL retorna o session_ttl do storage, ou fallback se não definido.
+func (h *Handler) storageSessionTTL(storage string, fallback time.Duration) time.Duration {
+	if s, ok := h.config().GetStorage(storage); ok && s.SessionTTL > 0 {
+		return s.SessionTTL
+	}
+	return fallback
+}
+
+// sessionStorage retorna o storage de uma sessão.
+func sessionStorage(value any) string {
+	switch s := value.(type) {
+	case *PartialSession:
+		return s.StorageName
+	case *ParallelSession:
+		return s.StorageName
+	}
+	return ""
+}
+
+// sessionLastActivity retorna o último I/O bem-sucedido de uma sessão.
+func sessionLastActivity(value any) time.Time {
+	switch s := value.(type) {
+	case *PartialSession:
+		return time.Unix(0, s.LastActivity.Load())
+	case *ParallelSession:
+		return time.Unix(0, s.LastActivity.Load())
+	}
+	return time.Now()
+}
+
+// expireSession encerra uma sessão expirada: registra no histórico, emite
+// session_expired e libera o .tmp (single) ou os slots e chunks (parallel).
+// Usado pelo cleanup periódico e pela ação expire da API.
+func (h *Handler) expireSession(id string, value any, logger *slog.Logger) {
+	lastAct := sessionLastActivity(value)
+	switch s := value.(type) {
+	case *PartialSession:
+		logger.Info("cleaning expired session",
+			"session", id,
+			"agent", s.AgentName,
+			"storage", s.StorageName,
+			"age", time.Since(s.CreatedAt).Round(time.Second),
+			"idle", time.Since(lastAct).Round(time.Second),
+		)
+		h.recordSessionEnd(id, s.AgentName, s.StorageName, s.BackupName, "single", s.CompressionMode, "expired", s.CreatedAt, s.BytesWritten.Load(), s.Config, nil)
+		if h.Events != nil {
+			h.Events.Push(observability.EventEntry{
+				Level:   "error",
+				Type:    "session_expired",
+				Agent:   s.AgentName,
+				Storage: s.StorageName,
+				Backup:  s.BackupName,
+				Message: fmt.Sprintf("%s/%s expired (idle %s)", s.StorageName, s.BackupName, time.Since(lastAct).Round(time.Second)),
+			})
+		}
+		os.Remove(s.TmpPath)
+		h.deleteSession(id)
+	case *ParallelSession:
+		// Sessão restaurada sendo retomada neste instante: o RESUME venceu
+		if s.Detached.Load() && !s.claimed.CompareAndSwap(false, true) {
+			return
+		}
+		logger.Info("cleaning expired parallel session",
+			"session", id,
+			"agent", s.AgentName,
+			"storage", s.StorageName,
+			"age", time.Since(s.CreatedAt).Round(time.Second),
+			"idle", time.Since(lastAct).Round(time.Second),
+		)
+		h.recordSessionEnd(id, s.AgentName, s.StorageName, s.BackupName, "parallel", s.StorageInfo.CompressionMode, "expired", s.CreatedAt, s.DiskWriteBytes.Load(), s.Config, s.streamTransfers())
+		if h.Events != nil {
+			h.Events.Push(observability.EventEntry{
+				Level:   "error",
+				Type:    "session_expired",
+				Agent:   s.AgentName,
+				Storage: s.StorageName,
+				Backup:  s.BackupName,
+				Message: fmt.Sprintf("%s/%s expired (idle %s)", s.StorageName, s.BackupName, time.Since(lastAct).Round(time.Second)),
+			})
+		}
+		s.Closing.Store(true)
+		for _, slot := range s.Slots {
+			if slot.CancelFn != nil {
+				slot.CancelFn()
+			}
+			slot.ConnMu.Lock()
+			if slot.Conn != nil {
+				slot.Conn.Close()
+			}
+			slot.ConnMu.Unlock()
+		}
+		s.Assembler.Cleanup()
+		h.deleteSession(id)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// TestHandleBackup_VersionMatrix envia handshakes em cada versão e verifica o
+// ACK: versões a partir da mínima recebem a versão negociada — a anunciada, ou
+// a máxima do server para agents mais novos — (aqui, numa recusa por storage
+// inexistente); as anteriores recebem StatusVersionMismatch com o intervalo
+// aceito pelo server.
+func TestHandleBackup_VersionMatrix(t *testing.T) {
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: t.TempDir()}})
+
+	handshake := func(w io.Writer, version byte) {
+		w.Write(protocol.MagicHandshake[:])
+		w.Write([]byte{version})
+		io.WriteString(w, "web-01\nmissing\ndaily\n1.0\n")
+	}
+
+	tests := []struct {
+		version    byte
+		status     byte
+		negotiated byte
+	}{
+		{0x04, protocol.StatusVersionMismatch, 0},
+		{0x05, protocol.StatusVersionMismatch, 0},
+		{protocol.ProtocolVersion, protocol.StatusStorageNotFound, protocol.ProtocolVersion},
+		{protocol.HandshakeVersionSACKWindow, protocol.StatusStorageNotFound, protocol.HandshakeVersionSACKWindow},
+		{protocol.HandshakeVersionChunkRange, protocol.StatusStorageNotFound, protocol.HandshakeVersionChunkRange},
+		{protocol.HandshakeVersionSessionProgress, protocol.StatusStorageNotFound, protocol.HandshakeVersionSessionProgress},
+		{protocol.HandshakeVersionSessionAutoScale, protocol.StatusStorageNotFound, protocol.HandshakeVersionSessionAutoScale},
+		{protocol.MaxProtocolVersion + 1, protocol.StatusStorageNotFound, protocol.MaxProtocolVersion},
+		{0xFF, protocol.StatusStorageNotFound, protocol.MaxProtocolVersion},
+	}
+	for _, tt := range tests {
+		serverConn, agentConn := net.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer serverConn.Close()
+			h.HandleConnection(context.Background(), serverConn)
+		}()
+
+		go handshake(agentConn, tt.version)
+		agentConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		ack, err := protocol.ReadACK(agentConn)
+		agentConn.Close()
+		<-done
+		if err != nil {
+			t.Fatalf("v%d: reading ACK: %v", tt.version, err)
+		}
+		if ack.Status != tt.status {
+			t.Fatalf("v%d: expected status %d, got %+v", tt.version, tt.status, ack)
+		}
+
+		if tt.status != protocol.StatusVersionMismatch {
+			if ack.Versions != nil {
+				t.Errorf("v%d: unexpected versions %+v", tt.version, ack.Versions)
+			}
+			if ack.Version != tt.negotiated {
+				t.Errorf("v%d: expected negotiated v%d, got v%d", tt.version, tt.negotiated, ack.Version)
+			}
+			continue
+		}
+		if ack.Versions == nil || *ack.Versions != protocol.SupportedVersions {
+			t.Errorf("v%d: expected versions %s, got %+v", tt.version, protocol.SupportedVersions, ack.Versions)
+		}
+		if !strings.Contains(ack.Message, "upgrade the agent") {
+			t.Errorf("v%d: message %q does not ask to upgrade the agent", tt.version, ack.Message)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// handshake_limiter.go limita a concorrência de handshakes TLS.
+//
+// Em uma tempestade de reconexões (ex: restart do server com centenas de agents),
+// handshakes TLS simultâneos podem saturar as CPUs e degradar o ingest das sessões
+// em andamento. O limiter usa um semáforo: conexões além do limite aguardam em fila
+// até handshake_queue_timeout e são descartadas se o slot não abrir a tempo.
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// handshakeLimiter controla quantos handshakes TLS executam simultaneamente.
+type handshakeLimiter struct {
+	sem          chan struct{}
+	queueTimeout time.Duration
+	timeout      time.Duration
+
+	inFlight  atomic.Int32 // handshakes executando agora
+	queued    atomic.Int32 // conexões aguardando slot
+	completed atomic.Int64 // handshakes concluídos com sucesso
+	rejected  atomic.Int64 // descartados por timeout de fila
+	failed    atomic.Int64 // handshakes que falharam (cert inválido, timeout, EOF)
+	waitNanos atomic.Int64 // soma do tempo de espera em fila (para média)
+	waited    atomic.Int64 // número de conexões que passaram pela fila
+}
+
+// newHandshakeLimiter cria o limiter a partir da config TLS.
+func newHandshakeLimiter(cfg config.TLSServer) *handshakeLimiter {
+	if cfg.MaxConcurrentHandshakes <= 0 {
+		return nil
+	}
+	return &handshakeLimiter{
+		sem:          make(chan struct{}, cfg.MaxConcurrentHandshakes),
+		queueTimeout: cfg.HandshakeQueueTimeout,
+		timeout:      cfg.HandshakeTimeout,
+	}
+}
+
+// Handshake executa o handshake TLS de conn respeitando o limite de concorrência.
+// Conexões não-TLS (ex: testes com net.Pipe) passam direto.
+// É no-op quando o limiter é nil.
+func (l *handshakeLimiter) Handshake(ctx context.Context, conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if l == nil || !ok {
+		return nil
+	}
+
+	// Aguarda slot na fila
+	l.queued.Add(1)
+	waitStart := time.Now()
+	timer := time.NewTimer(l.queueTimeout)
+	select {
+	case l.sem <- struct{}{}:
+		timer.Stop()
+	case <-timer.C:
+		l.queued.Add(-1)
+		l.rejected.Add(1)
+		return fmt.Errorf("tls handshake queue timeout after %s", l.queueTimeout)
+	case <-ctx.Done():
+		timer.Stop()
+		l.queued.Add(-1)
+		return ctx.Err()
+	}
+	l.queued.Add(-1)
+	l.waitNanos.Add(int64(time.Since(waitStart)))
+	l.waited.Add(1)
+
+	l.inFlight.Add(1)
+	defer func() {
+		l.inFlight.Add(-1)
+		<-l.sem
+	}()
+
+	hsCtx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(hsCtx); err != nil {
+		l.failed.Add(1)
+		return fmt.Errorf("tls handshake: %w", err)
+	}
+	l.completed.Add(1)
+	return nil
+}
+
+// Stats retorna um snapshot das métricas do limiter (nil quando desabilitado).
+func (l *handshakeLimiter) Stats() *observability.HandshakeDTO {
+	if l == nil {
+		return nil
+	}
+	dto := &observability.HandshakeDTO{
+		MaxConcurrent: cap(l.sem),
+		InFlight:      l.inFlight.Load(),
+		Queued:        l.queued.Load(),
+		Completed:     l.completed.Load(),
+		Rejected:      l.rejected.Load(),
+		Failed:        l.failed.Load(),
+	}
+	if n := l.waited.Load(); n > 0 {
+		dto.AvgQueueWaitMs = float64(l.waitNanos.Load()) / float64(n) / float64(time.Millisecond)
+	}
+	return dto
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestHandshakeLimiter_NilAndNonTLSPassThrough(t *testing.T) {
+	var nilLimiter *handshakeLimiter
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	if err := nilLimiter.Handshake(context.Background(), c1); err != nil {
+		t.Fatalf("nil limiter should be no-op, got %v", err)
+	}
+	if nilLimiter.Stats() != nil {
+		t.Fatal("nil limiter should return nil stats")
+	}
+
+	l := newHandshakeLimiter(config.TLSServer{MaxConcurrentHandshakes: 1, HandshakeQueueTimeout: time.Second, HandshakeTimeout: time.Second})
+	if err := l.Handshake(context.Background(), c1); err != nil {
+		t.Fatalf("non-TLS conn should pass through, got %v", err)
+	}
+	if st := l.Stats(); st.Completed != 0 || st.Queued != 0 {
+		t.Fatalf("non-TLS conn should not touch metrics, got %+v", st)
+	}
+}
+
+func TestHandshakeLimiter_DisabledWhenZero(t *testing.T) {
+	if l := newHandshakeLimiter(config.TLSServer{}); l != nil {
+		t.Fatal("expected nil limiter when max_concurrent_handshakes is 0")
+	}
+}
+
+func TestHandshakeLimiter_QueueTimeout(t *testing.T) {
+	l := newHandshakeLimiter(config.TLSServer{
+		MaxConcurrentHandshakes: 1,
+		HandshakeQueueTimeout:   50 * time.Millisecond,
+		HandshakeTimeout:        time.Second,
+	})
+	// Ocupa o único slot
+	l.sem <- struct{}{}
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	err := l.Handshake(context.Background(), tls.Server(c1, &tls.Config{}))
+	if err == nil {
+		t.Fatal("expected queue timeout error")
+	}
+	st := l.Stats()
+	if st.Rejected != 1 {
+		t.Errorf("expected rejected=1, got %d", st.Rejected)
+	}
+	if st.Queued != 0 || st.InFlight != 0 {
+		t.Errorf("expected empty queue after timeout, got queued=%d in_flight=%d", st.Queued, st.InFlight)
+	}
+}
+
+func TestHandshakeLimiter_HandshakeTimeoutReleasesSlot(t *testing.T) {
+	l := newHandshakeLimiter(config.TLSServer{
+		MaxConcurrentHandshakes: 1,
+		HandshakeQueueTimeout:   time.Second,
+		HandshakeTimeout:        50 * time.Millisecond,
+	})
+
+	// Peer nunca envia ClientHello — o handshake expira
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	if err := l.Handshake(context.Background(), tls.Server(c1, &tls.Config{})); err == nil {
+		t.Fatal("expected handshake timeout error")
+	}
+	st := l.Stats()
+	if st.Failed != 1 {
+		t.Errorf("expected failed=1, got %d", st.Failed)
+	}
+	if st.InFlight != 0 {
+		t.Errorf("expected in_flight=0, got %d", st.InFlight)
+	}
+	if len(l.sem) != 0 {
+		t.Errorf("slot not released after failed handshake")
+	}
+}
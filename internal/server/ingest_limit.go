@@ -0,0 +1,194 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// ingest_limit.go aplica os tetos de ingestão (ingest_limit global, por
+// storage e por listener) às conexões de dados.
+//
+// O server não descarta dados: ele espaça as leituras das conexões e o
+// backpressure do TCP desacelera os agents, qualquer que seja o número de
+// agents conectados. Os limiters são compartilhados por todas as conexões do
+// storage (e pelo teto global) e atualizados a cada reload, inclusive para as
+// sessões em andamento.
+
+package server
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// ingestMaxBurst limita o burst dos limiters: leituras maiores aguardam os
+// tokens em pedaços, mantendo o ritmo uniforme.
+const ingestMaxBurst = 256 * 1024
+
+// ingestLimiter é um token bucket de bytes/seg com o tempo acumulado de espera.
+type ingestLimiter struct {
+	lim    *rate.Limiter
+	waited atomic.Int64 // nanossegundos aguardando tokens
+}
+
+func newIngestLimiter() *ingestLimiter {
+	return &ingestLimiter{lim: rate.NewLimiter(rate.Inf, 0)}
+}
+
+// set ajusta o teto; bytesPerSec <= 0 remove o limite.
+func (l *ingestLimiter) set(bytesPerSec int64) {
+	if bytesPerSec <= 0 {
+		l.lim.SetLimit(rate.Inf)
+		return
+	}
+	l.lim.SetBurst(int(min(bytesPerSec, ingestMaxBurst)))
+	l.lim.SetLimit(rate.Limit(bytesPerSec))
+}
+
+// stats retorna o teto e o tempo acumulado de espera do limiter.
+func (l *ingestLimiter) stats(storage string) observability.IngestThrottleDTO {
+	dto := observability.IngestThrottleDTO{
+		Storage:          storage,
+		ThrottledSeconds: time.Duration(l.waited.Load()).Seconds(),
+	}
+	if limit := l.lim.Limit(); limit != rate.Inf {
+		dto.LimitBytes = int64(limit)
+	}
+	return dto
+}
+
+// wait consome n bytes do bucket, em pedaços de até um burst.
+func (l *ingestLimiter) wait(ctx context.Context, n int) error {
+	if l.lim.Limit() == rate.Inf {
+		return nil
+	}
+	start := time.Now()
+	defer func() { l.waited.Add(int64(time.Since(start))) }()
+	for n > 0 {
+		chunk := min(n, l.lim.Burst())
+		if err := l.lim.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// ingestLimits agrupa o teto global e os tetos por storage.
+type ingestLimits struct {
+	global *ingestLimiter
+
+	mu       sync.Mutex
+	storages map[string]*ingestLimiter
+}
+
+// newIngestLimits cria os limiters a partir da config.
+func newIngestLimits(cfg *config.ServerConfig) *ingestLimits {
+	l := &ingestLimits{global: newIngestLimiter(), storages: make(map[string]*ingestLimiter)}
+	l.apply(cfg)
+	return l
+}
+
+// apply atualiza os tetos (no start e a cada reload). Storages removidos
+// ficam sem limite até voltarem à config.
+func (l *ingestLimits) apply(cfg *config.ServerConfig) {
+	if l == nil {
+		return
+	}
+	l.global.set(cfg.IngestLimitRaw)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name, lim := range l.storages {
+		if _, ok := cfg.Storages[name]; !ok {
+			lim.set(0)
+		}
+	}
+	for name, si := range cfg.Storages {
+		l.storageLocked(name).set(si.IngestLimitRaw)
+	}
+}
+
+// storageLocked retorna (criando, se preciso) o limiter do storage.
+func (l *ingestLimits) storageLocked(name string) *ingestLimiter {
+	lim, ok := l.storages[name]
+	if !ok {
+		lim = newIngestLimiter()
+		l.storages[name] = lim
+	}
+	return lim
+}
+
+// limited indica se o storage (ou o teto global) tem ingest_limit ativo.
+func (l *ingestLimits) limited(storage string) bool {
+	if l == nil {
+		return false
+	}
+	if l.global.lim.Limit() != rate.Inf {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lim, ok := l.storages[storage]
+	return ok && lim.lim.Limit() != rate.Inf
+}
+
+// reader envolve r para que as leituras respeitem o teto do storage, o
+// global e o do listener que aceitou a conexão (ctx). É no-op quando l é nil.
+func (l *ingestLimits) reader(ctx context.Context, r io.Reader, storage string) io.Reader {
+	if l == nil {
+		return r
+	}
+	l.mu.Lock()
+	lim := l.storageLocked(storage)
+	l.mu.Unlock()
+	limiters := []*ingestLimiter{lim, l.global}
+	if lp := listenerFrom(ctx); lp != nil && lp.ingest != nil {
+		limiters = append(limiters, lp.ingest)
+	}
+	return &ingestReader{ctx: ctx, r: r, limiters: limiters}
+}
+
+// stats retorna o teto e o tempo acumulado de espera do global e de cada
+// storage, ordenados por storage (o global primeiro).
+func (l *ingestLimits) stats() []observability.IngestThrottleDTO {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	result := []observability.IngestThrottleDTO{l.global.stats("")}
+	for name, lim := range l.storages {
+		result = append(result, lim.stats(name))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Storage < result[j].Storage })
+	return result
+}
+
+// ingestReader espaça as leituras de uma conexão de dados: após cada leitura,
+// aguarda os tokens correspondentes no storage, no global e no listener. Enquanto aguarda,
+// a conexão não é lida e o TCP aplica backpressure ao agent.
+type ingestReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*ingestLimiter
+}
+
+// Read implementa io.Reader.
+func (r *ingestReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		for _, lim := range r.limiters {
+			if werr := lim.wait(r.ctx, n); werr != nil && err == nil {
+				err = werr
+			}
+		}
+	}
+	return n, err
+}
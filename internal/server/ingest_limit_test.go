@@ -0,0 +1,67 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestIngestReader_PacesReads(t *testing.T) {
+	cfg := &config.ServerConfig{Storages: map[string]config.StorageInfo{
+		"default": {IngestLimitRaw: config.MinIngestLimit},
+		"fast":    {},
+	}}
+	limits := newIngestLimits(cfg)
+
+	// O primeiro burst (64KB) é imediato; os 32KB restantes levam ~0,5s
+	data := make([]byte, config.MinIngestLimit+config.MinIngestLimit/2)
+	start := time.Now()
+	n, err := io.Copy(io.Discard, limits.reader(context.Background(), bytes.NewReader(data), "default"))
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("copy: n=%d err=%v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("expected paced read, took %s", elapsed)
+	}
+
+	start = time.Now()
+	io.Copy(io.Discard, limits.reader(context.Background(), bytes.NewReader(data), "fast"))
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("expected unlimited storage to read immediately, took %s", elapsed)
+	}
+
+	stats := limits.stats()
+	if len(stats) != 3 || stats[0].Storage != "" || stats[1].Storage != "default" || stats[1].ThrottledSeconds <= 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestIngestLimits_Reload(t *testing.T) {
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: t.TempDir(), IngestLimit: "1mb", IngestLimitRaw: 1 << 20}})
+
+	newCfg := *h.config()
+	newCfg.IngestLimit, newCfg.IngestLimitRaw = "10mb", 10<<20
+	newCfg.Storages = map[string]config.StorageInfo{"default": {BaseDir: h.config().Storages["default"].BaseDir}}
+	h.Reload(&newCfg)
+
+	for _, s := range h.ingest.stats() {
+		switch s.Storage {
+		case "":
+			if s.LimitBytes != 10<<20 {
+				t.Errorf("expected global limit 10mb after reload, got %d", s.LimitBytes)
+			}
+		case "default":
+			if s.LimitBytes != 0 {
+				t.Errorf("expected storage limit removed after reload, got %d", s.LimitBytes)
+			}
+		}
+	}
+}
@@ -14,6 +14,7 @@ package server
 import (
 	"archive/tar"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -24,6 +25,10 @@ import (
 	"github.com/klauspost/compress/zstd"
 )
 
+// errArchiveNoEntries indica um archive válido, mas sem entradas (backup
+// vazio).
+var errArchiveNoEntries = errors.New("archive contains no entries")
+
 // countingReader wraps an io.Reader and atomically tracks bytes read.
 // Used by VerifyArchiveIntegrity to expose progress to the WebUI.
 type countingReader struct {
@@ -152,7 +157,7 @@ func VerifyArchiveIntegrity(path string, progress *IntegrityProgress, logger *sl
 	}
 
 	if entryCount == 0 {
-		return fmt.Errorf("archive contains no entries")
+		return errArchiveNoEntries
 	}
 
 	// Log final
@@ -0,0 +1,402 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// lifecycle.go implementa o tier de recompressão (storages.*.lifecycle): um
+// worker em background recompacta com zstd, em nível alto e janela longa, os
+// backups mais antigos que recompress_after_days. O backup é descomprimido e
+// recompactado em um .tmp ao lado dele; o tar recompactado é relido e
+// comparado (SHA-256) com o original antes de substituí-lo. Backups .tar.gz
+// viram .tar.zst, com o mesmo timestamp no nome e o mesmo mtime.
+//
+// Cada resultado é gravado em {base_dir}/.lifecycle.jsonl, para que o
+// catálogo mostre a recompressão e um restart não reprocesse os backups.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/dedup"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// Resultados da recompressão de um backup.
+const (
+	LifecycleResultRecompressed = "recompressed"
+	LifecycleResultKept         = "kept"  // o zstd não reduziu o archive: original mantido
+	LifecycleResultError        = "error" // não persistido: nova tentativa após restart
+)
+
+// lifecycleTick é o intervalo entre as rodadas do worker.
+const lifecycleTick = time.Hour
+
+// lifecycleStateFile é o histórico das recompressões, na raiz do base_dir.
+const lifecycleStateFile = ".lifecycle.jsonl"
+
+// lifecycleFrameSize é o volume de tar por frame zstd nos archives com
+// índice de membros: os frames reiniciados mantêm o restore de arquivos
+// individuais sem descomprimir o archive desde o início.
+var lifecycleFrameSize int64 = 256 << 20 // 256MB
+
+// StartLifecycle inicia o worker de recompressão. A config é relida a cada
+// rodada, então lifecycle pode ser habilitado ou alterado por reload.
+func (h *Handler) StartLifecycle(ctx context.Context) {
+	go func() {
+		logs := make(map[string]*os.File) // base_dir → histórico aberto
+		defer func() {
+			for _, f := range logs {
+				if f != nil {
+					f.Close()
+				}
+			}
+		}()
+
+		ticker := time.NewTicker(lifecycleTick)
+		defer ticker.Stop()
+		for {
+			h.runLifecycleRound(ctx, logs)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runLifecycleRound recompacta, um por vez, os backups elegíveis de cada
+// storage com lifecycle. Storages somente leitura (disk_health) são pulados.
+func (h *Handler) runLifecycleRound(ctx context.Context, logs map[string]*os.File) {
+	storages := h.config().Storages
+	names := make([]string, 0, len(storages))
+	for name := range storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		si := storages[name]
+		if !si.Lifecycle.Enabled() || si.IsDedup() {
+			continue
+		}
+		if readOnly, _ := h.storageReadOnly(name, si); readOnly {
+			continue
+		}
+		log, ok := logs[si.BaseDir]
+		if !ok {
+			log = h.openLifecycleLog(si.BaseDir)
+			logs[si.BaseDir] = log
+		}
+
+		cutoff := time.Now().AddDate(0, 0, -si.Lifecycle.RecompressAfterDays)
+		for _, agent := range listSubdirs(si.BaseDir) {
+			for _, backup := range listSubdirs(filepath.Join(si.BaseDir, agent)) {
+				dir := filepath.Join(si.BaseDir, agent, backup)
+				files, err := listBackups(dir)
+				if err != nil {
+					continue
+				}
+				for _, f := range files {
+					if ctx.Err() != nil {
+						return
+					}
+					if dedup.IsManifest(f.Name) {
+						continue
+					}
+					if _, done := h.lifecycle.Load(drillKey(name, agent, backup, f.Name)); done {
+						continue
+					}
+					path := filepath.Join(dir, f.Rel)
+					info, err := os.Stat(path)
+					if err != nil || info.ModTime().After(cutoff) {
+						continue
+					}
+					res := h.recompressBackup(ctx, name, agent, backup, path, si.Lifecycle)
+					if ctx.Err() != nil {
+						return
+					}
+					h.recordLifecycle(res, log)
+				}
+			}
+		}
+	}
+}
+
+// openLifecycleLog abre o histórico do base_dir para append e carrega os
+// resultados. Falhas são logadas e o worker segue sem histórico persistido.
+func (h *Handler) openLifecycleLog(baseDir string) *os.File {
+	path := filepath.Join(baseDir, lifecycleStateFile)
+	entries, f, rep, err := statefile.OpenLog[observability.LifecycleEntry](path, 0644)
+	if err != nil {
+		h.logger.Warn("lifecycle: opening state file", "path", path, "error", err)
+		return nil
+	}
+	if !rep.Clean() {
+		h.logger.Warn("lifecycle: state file had damaged records", "path", path, "report", rep.String())
+	}
+	for _, e := range entries {
+		h.lifecycle.Store(drillKey(e.Storage, e.Agent, e.Backup, e.File), e)
+	}
+	return f
+}
+
+// recordLifecycle guarda o resultado no catálogo e no histórico e emite o evento.
+func (h *Handler) recordLifecycle(res observability.LifecycleEntry, log *os.File) {
+	logger := h.logger.With("storage", res.Storage, "agent", res.Agent, "backup", res.Backup, "file", res.File)
+	target := fmt.Sprintf("%s/%s/%s/%s", res.Storage, res.Agent, res.Backup, res.Source)
+
+	h.lifecycle.Store(drillKey(res.Storage, res.Agent, res.Backup, res.File), res)
+	if res.Result != LifecycleResultError && log != nil {
+		if err := statefile.Append(log, res); err != nil {
+			logger.Warn("lifecycle: appending result", "error", err)
+		}
+	}
+
+	level, msg := "info", ""
+	switch res.Result {
+	case LifecycleResultRecompressed:
+		logger.Info("backup recompressed", "source", res.Source, "old_bytes", res.OldSizeBytes, "new_bytes", res.NewSizeBytes, "sha256", res.SHA256, "duration", res.Duration)
+		msg = fmt.Sprintf("%s recompressed to %s: %s → %s", target, res.File, formatBytesGo(res.OldSizeBytes), formatBytesGo(res.NewSizeBytes))
+	case LifecycleResultKept:
+		logger.Info("backup kept: recompression did not reduce size", "old_bytes", res.OldSizeBytes, "new_bytes", res.NewSizeBytes)
+		return
+	default:
+		logger.Error("backup recompression failed", "error", res.Error)
+		level, msg = "error", fmt.Sprintf("%s: recompression failed: %s", target, res.Error)
+	}
+	if h.Events != nil {
+		h.Events.Push(observability.EventEntry{
+			Level:   level,
+			Type:    "backup_recompressed",
+			Agent:   res.Agent,
+			Storage: res.Storage,
+			Backup:  res.Backup,
+			Message: msg,
+		})
+	}
+}
+
+// lifecycleOf retorna a recompressão do backup, ou nil se não houve uma.
+func (h *Handler) lifecycleOf(storage, agent, backup, file string) *observability.LifecycleEntry {
+	raw, ok := h.lifecycle.Load(drillKey(storage, agent, backup, file))
+	if !ok {
+		return nil
+	}
+	e := raw.(observability.LifecycleEntry)
+	return &e
+}
+
+// recompressBackup recompacta o backup em path e descreve o resultado.
+func (h *Handler) recompressBackup(ctx context.Context, storage, agent, backup, path string, lc config.LifecycleConfig) observability.LifecycleEntry {
+	start := time.Now()
+	res := observability.LifecycleEntry{
+		Storage:        storage,
+		Agent:          agent,
+		Backup:         backup,
+		File:           filepath.Base(path),
+		Source:         filepath.Base(path),
+		RecompressedAt: start.UTC().Format(time.RFC3339),
+	}
+	logger := h.logger.With("storage", storage, "agent", agent, "backup", backup, "file", res.Source)
+	logger.Info("recompressing backup", "level", lc.Level, "window", lc.Window)
+
+	finalPath, err := recompressArchive(ctx, path, lc, &res, logger)
+	res.Duration = time.Since(start).Round(time.Millisecond).String()
+	if err != nil {
+		res.Result, res.Error = LifecycleResultError, err.Error()
+		return res
+	}
+	res.File = filepath.Base(finalPath)
+	return res
+}
+
+// recompressArchive recompacta path com zstd e, se o resultado for menor,
+// substitui o archive (renomeando .tar.gz para .tar.zst), levando junto o
+// manifest de arquivos e regenerando o índice de membros. Preenche os
+// tamanhos, o SHA-256 e o Result de res e retorna o caminho final.
+func recompressArchive(ctx context.Context, path string, lc config.LifecycleConfig, res *observability.LifecycleEntry, logger *slog.Logger) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("opening archive: %w", err)
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return "", fmt.Errorf("stat archive: %w", err)
+	}
+	res.OldSizeBytes = fi.Size()
+
+	r, closeFn, err := archiveDecompressor(src)
+	if err != nil {
+		return "", err
+	}
+	defer closeFn()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "lifecycle-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("creating temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	level := zstd.SpeedBestCompression
+	if lc.Level == config.LifecycleLevelBetter {
+		level = zstd.SpeedBetterCompression
+	}
+	enc, err := zstd.NewWriter(tmp,
+		zstd.WithEncoderLevel(level),
+		zstd.WithWindowSize(int(lc.WindowRaw)),
+		zstd.WithEncoderConcurrency(1), // background: um core
+	)
+	if err != nil {
+		return "", fmt.Errorf("creating zstd writer: %w", err)
+	}
+	var w io.Writer = enc
+	_, statErr := os.Stat(archiveIndexPath(path))
+	indexed := statErr == nil
+	if indexed {
+		w = &frameWriter{enc: enc, dst: tmp, limit: lifecycleFrameSize}
+	}
+
+	tarSum := sha256.New()
+	if _, err := io.Copy(w, io.TeeReader(&ctxReader{ctx: ctx, r: r}, tarSum)); err != nil {
+		enc.Close()
+		return "", fmt.Errorf("recompressing: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("closing zstd writer: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", fmt.Errorf("syncing temp file: %w", err)
+	}
+
+	// Relê o archive novo: o tar descomprimido tem de ser idêntico ao original
+	archiveSum, newSize, err := verifyRecompressed(ctx, tmp, tarSum.Sum(nil))
+	if err != nil {
+		return "", err
+	}
+	res.NewSizeBytes = newSize
+	if newSize >= res.OldSizeBytes {
+		sum, err := hashFile(path)
+		if err != nil {
+			return "", err
+		}
+		res.Result, res.SHA256 = LifecycleResultKept, hex.EncodeToString(sum[:])
+		return path, nil
+	}
+
+	// A rotação pode ter removido o backup durante a recompressão
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("backup removed during recompression")
+	}
+	finalPath := strings.TrimSuffix(strings.TrimSuffix(path, ".tar.gz"), ".tar.zst") + ".tar.zst"
+	os.Chtimes(tmp.Name(), fi.ModTime(), fi.ModTime())
+	if err := os.Rename(tmp.Name(), finalPath); err != nil {
+		return "", fmt.Errorf("replacing archive: %w", err)
+	}
+	if finalPath != path {
+		os.Remove(path)
+		os.Rename(fileManifestPath(path), fileManifestPath(finalPath))
+		os.Remove(archiveIndexPath(path))
+	}
+	if indexed {
+		if _, _, err := buildArchiveIndex(finalPath); err != nil {
+			os.Remove(archiveIndexPath(finalPath))
+			logger.Warn("lifecycle: rebuilding member index failed — single-file restore unavailable", "path", finalPath, "error", err)
+		}
+	}
+	res.Result, res.SHA256 = LifecycleResultRecompressed, hex.EncodeToString(archiveSum)
+	return finalPath, nil
+}
+
+// verifyRecompressed relê o archive recompactado em f, conferindo o SHA-256
+// do tar descomprimido com wantTar. Retorna o SHA-256 e o tamanho do archive.
+func verifyRecompressed(ctx context.Context, f *os.File, wantTar []byte) ([]byte, int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	archiveSum := sha256.New()
+	dec, err := zstd.NewReader(io.TeeReader(&ctxReader{ctx: ctx, r: f}, archiveSum), zstd.WithDecoderMaxWindow(zstd.MaxWindowSize))
+	if err != nil {
+		return nil, 0, fmt.Errorf("initializing zstd reader: %w", err)
+	}
+	defer dec.Close()
+	tarSum := sha256.New()
+	if _, err := io.Copy(tarSum, dec); err != nil {
+		return nil, 0, fmt.Errorf("verifying recompressed archive: %w", err)
+	}
+	if got := tarSum.Sum(nil); !bytes.Equal(got, wantTar) {
+		return nil, 0, fmt.Errorf("recompressed archive does not match the original (tar sha256 %x, want %x)", got, wantTar)
+	}
+	// O decoder pode parar antes do fim do arquivo: o hash cobre o arquivo inteiro
+	if _, err := io.Copy(archiveSum, f); err != nil {
+		return nil, 0, fmt.Errorf("hashing recompressed archive: %w", err)
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, err
+	}
+	return archiveSum.Sum(nil), size, nil
+}
+
+// frameWriter reinicia o frame zstd a cada limit bytes de tar.
+type frameWriter struct {
+	enc   *zstd.Encoder
+	dst   io.Writer
+	limit int64
+	n     int64
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if room := w.limit - w.n; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		n, err := w.enc.Write(chunk)
+		written += n
+		w.n += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		if w.n >= w.limit {
+			if err := w.enc.Close(); err != nil {
+				return written, err
+			}
+			w.enc.Reset(w.dst)
+			w.n = 0
+		}
+	}
+	return written, nil
+}
+
+// ctxReader interrompe a leitura quando ctx é cancelado (shutdown do server).
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestLifecycle_RecompressesOldBackups(t *testing.T) {
+	oldFrame := lifecycleFrameSize
+	lifecycleFrameSize = 64 << 10 // vários frames, para exercitar o índice
+	defer func() { lifecycleFrameSize = oldFrame }()
+
+	base := t.TempDir()
+	dir := filepath.Join(base, "web-01", "app")
+	os.MkdirAll(dir, 0755)
+	files := map[string]string{
+		"etc/hosts":          "127.0.0.1 localhost\n",
+		"var/lib/big.db":     strings.Repeat("0123456789abcdef", 20000),
+		"etc/nginx/app.conf": "server {}\n",
+	}
+	order := []string{"etc/hosts", "var/lib/big.db", "etc/nginx/app.conf"}
+
+	old := filepath.Join(dir, "2026-01-01T00-00-00-000.tar.gz")
+	writeCheckpointedArchive(t, old, files, order)
+	if _, _, err := buildArchiveIndex(old); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(fileManifestPath(old), []byte("manifest"), 0644)
+	mtime := time.Now().AddDate(0, 0, -10)
+	os.Chtimes(old, mtime, mtime)
+
+	// Backup recente: fora da janela de recompressão
+	recent := filepath.Join(dir, "2026-01-09T00-00-00-000.tar.gz")
+	writeCheckpointedArchive(t, recent, files, order)
+
+	lc := config.LifecycleConfig{RecompressAfterDays: 7, Level: config.LifecycleLevelBest, Window: "1mb", WindowRaw: 1 << 20}
+	h := newTestHandler(t, map[string]config.StorageInfo{"s": {BaseDir: base, Lifecycle: lc}})
+	logs := make(map[string]*os.File)
+	h.runLifecycleRound(context.Background(), logs)
+	for _, f := range logs {
+		f.Close()
+	}
+
+	zst := filepath.Join(dir, "2026-01-01T00-00-00-000.tar.zst")
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("original .tar.gz should have been replaced: %v", err)
+	}
+	info, err := os.Stat(zst)
+	if err != nil {
+		t.Fatalf("recompressed archive missing: %v", err)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %v preserved, got %v", mtime, info.ModTime())
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("recent backup should be untouched: %v", err)
+	}
+	if data, err := os.ReadFile(fileManifestPath(zst)); err != nil || string(data) != "manifest" {
+		t.Errorf("manifest should follow the archive: %q (%v)", data, err)
+	}
+	if _, err := os.Stat(archiveIndexPath(old)); !os.IsNotExist(err) {
+		t.Errorf("stale index should be removed: %v", err)
+	}
+
+	// Conteúdo idêntico e restore de arquivo individual pelo novo índice
+	if got := readTarEntries(t, zst); len(got) != len(files) || got["var/lib/big.db"] != files["var/lib/big.db"] {
+		t.Errorf("recompressed content differs: %d entries", len(got))
+	}
+	e, err := lookupArchiveIndex(zst, "etc/nginx/app.conf")
+	if err != nil {
+		t.Fatalf("lookupArchiveIndex: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := writeArchiveMember(&buf, zst, e, e); err != nil {
+		t.Fatalf("writeArchiveMember: %v", err)
+	}
+	if !strings.Contains(buf.String(), files["etc/nginx/app.conf"]) {
+		t.Error("restored member does not contain the file content")
+	}
+
+	// Catálogo mostra a recompressão; o histórico sobrevive a um restart
+	reloaded := newTestHandler(t, map[string]config.StorageInfo{"s": {BaseDir: base, Lifecycle: lc}})
+	reloaded.openLifecycleLog(base).Close()
+	var found bool
+	for _, c := range reloaded.BackupCatalog() {
+		if c.File != filepath.Base(zst) {
+			continue
+		}
+		found = true
+		if c.Lifecycle == nil || c.Lifecycle.Result != LifecycleResultRecompressed || c.Lifecycle.Source != filepath.Base(old) ||
+			c.Lifecycle.NewSizeBytes >= c.Lifecycle.OldSizeBytes || c.Lifecycle.SHA256 == "" {
+			t.Errorf("unexpected catalog lifecycle: %+v", c.Lifecycle)
+		}
+	}
+	if !found {
+		t.Error("recompressed backup missing from the catalog")
+	}
+}
+
+func TestLifecycle_KeepsArchiveThatDoesNotShrink(t *testing.T) {
+	dir := t.TempDir()
+	// Archive já compactado com o mesmo encoder: a recompressão não diminui
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	tw.WriteHeader(&tar.Header{Name: "a", Mode: 0644, Size: 4, Typeflag: tar.TypeReg})
+	tw.Write([]byte("data"))
+	tw.Close()
+	var out bytes.Buffer
+	enc, _ := zstd.NewWriter(&out, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithWindowSize(1<<20), zstd.WithEncoderConcurrency(1))
+	enc.Write(tarBuf.Bytes())
+	enc.Close()
+	path := filepath.Join(dir, "2026-01-01T00-00-00-000.tar.zst")
+	os.WriteFile(path, out.Bytes(), 0644)
+
+	lc := config.LifecycleConfig{RecompressAfterDays: 1, Level: config.LifecycleLevelBest, Window: "1mb", WindowRaw: 1 << 20}
+	h := newTestHandler(t, map[string]config.StorageInfo{"s": {BaseDir: dir, Lifecycle: lc}})
+	res := h.recompressBackup(context.Background(), "s", "a", "b", path, lc)
+	if res.Result != LifecycleResultKept || res.File != filepath.Base(path) {
+		t.Fatalf("expected the archive to be kept, got %+v", res)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(out.Bytes(), after) {
+		t.Error("kept archive should be unchanged")
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, "lifecycle-*.tmp")); len(tmps) != 0 {
+		t.Errorf("temp files left behind: %v", tmps)
+	}
+}
+
+// readTarEntries lê todas as entradas regulares de um archive.
+func readTarEntries(t *testing.T, path string) map[string]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tr, closeFn, err := archiveTarReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeFn()
+	got := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading %s: %v", path, err)
+		}
+		data, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(data)
+	}
+	return got
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// listener.go atende os listeners adicionais (listeners) com o mesmo Handler
+// do listener principal (server.listen).
+//
+// Cada listener tem seus certificados, modo de autenticação, allow-list e teto
+// de ingestão. A política do listener que aceitou a conexão viaja no context
+// até HandleConnection (autenticação PSK), authorizeAgent (allow-list) e
+// ingestLimits.reader (teto), então sessões, locks e storages continuam
+// compartilhados entre os listeners.
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+	"github.com/nishisan-dev/n-backup/internal/sockopt"
+)
+
+// mainListenerName identifica o listener de server.listen nos logs.
+const mainListenerName = "main"
+
+// listenerPolicy é a política de um listener aplicada às conexões que ele aceita.
+type listenerPolicy struct {
+	name          string
+	auth          string         // config.AuthModeMTLS | config.AuthModePSK | config.AuthModePeerCred
+	allowedAgents []string       // vazio = qualquer agent autorizado por tls.allowed_agents
+	ingest        *ingestLimiter // nil = sem teto próprio
+}
+
+// newListenerPolicy cria a política de um listener adicional.
+func newListenerPolicy(lc config.ListenerConfig) *listenerPolicy {
+	lp := &listenerPolicy{name: lc.Name, auth: lc.Auth, allowedAgents: lc.AllowedAgents}
+	if lc.IngestLimitRaw > 0 {
+		lp.ingest = newIngestLimiter()
+		lp.ingest.set(lc.IngestLimitRaw)
+	}
+	return lp
+}
+
+// psk indica se as conexões do listener se autenticam por PSK. Conexões sem
+// listener (RunWithListener e testes) seguem o keyring carregado.
+func (lp *listenerPolicy) psk() bool {
+	return lp == nil || lp.auth == config.AuthModePSK
+}
+
+// allows indica se o agent é aceito pela allow-list do listener.
+func (lp *listenerPolicy) allows(agent string) bool {
+	return lp == nil || len(lp.allowedAgents) == 0 || slices.Contains(lp.allowedAgents, agent)
+}
+
+type listenerKey struct{}
+
+// withListener associa a política do listener ao context das conexões aceitas.
+func withListener(ctx context.Context, lp *listenerPolicy) context.Context {
+	return context.WithValue(ctx, listenerKey{}, lp)
+}
+
+// listenerFrom retorna a política do listener da conexão (nil = nenhuma).
+func listenerFrom(ctx context.Context) *listenerPolicy {
+	lp, _ := ctx.Value(listenerKey{}).(*listenerPolicy)
+	return lp
+}
+
+// startListeners abre os listeners adicionais e atende cada um em background
+// até ctx ser cancelado. Listeners com os certificados de tls reutilizam
+// certReloader; os demais ganham um CertReloader próprio, retornado para que
+// o chamador o verifique a cada reload.
+func startListeners(ctx context.Context, cfg *config.ServerConfig, handler *Handler, certReloader *pki.CertReloader, logger *slog.Logger) ([]*pki.CertReloader, error) {
+	var reloaders []*pki.CertReloader
+	var lns []net.Listener
+	closeAll := func() {
+		for _, ln := range lns {
+			ln.Close()
+		}
+	}
+
+	for _, lc := range cfg.Listeners {
+		llogger := logger.With("listener", lc.Name)
+
+		if path, ok := lc.UnixPath(); ok {
+			ln, err := listenUnix(lc, handler, llogger)
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf("listening on %s (listener %s): %w", path, lc.Name, err)
+			}
+			lns = append(lns, ln)
+			llogger.Info("server listening", "address", lc.Listen, "auth", lc.Auth,
+				"peerAgents", len(lc.PeerAgentsRaw), "allowedAgents", len(lc.AllowedAgents), "ingestLimit", lc.IngestLimit)
+			go handler.acceptLoop(withListener(ctx, newListenerPolicy(lc)), ln, llogger)
+			continue
+		}
+
+		reloader := certReloader
+		if lc.TLS != (config.ListenerTLSConfig{CACert: cfg.TLS.CACert, ServerCert: cfg.TLS.ServerCert, ServerKey: cfg.TLS.ServerKey}) {
+			var err error
+			reloader, err = pki.NewCertReloader(lc.TLS.CACert, lc.TLS.ServerCert, lc.TLS.ServerKey, llogger.With("component", "tls"))
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf("configuring TLS for listener %s: %w", lc.Name, err)
+			}
+			reloader.SetVerifyPeerCertificate(handler.verifyPeerCertificate)
+			reloaders = append(reloaders, reloader)
+		}
+
+		tlsCfg := reloader.ServerTLSConfig()
+		if lc.Auth == config.AuthModePSK {
+			tlsCfg = pskServerTLSConfig(reloader)
+		}
+		tcpLn, err := sockopt.ListenConfig(lc.Socket).Listen(ctx, "tcp", lc.Listen)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("listening on %s (listener %s): %w", lc.Listen, lc.Name, err)
+		}
+		ln := tls.NewListener(tcpLn, tlsCfg)
+		lns = append(lns, ln)
+
+		llogger.Info("server listening", "address", lc.Listen, "auth", lc.Auth,
+			"allowedAgents", len(lc.AllowedAgents), "ingestLimit", lc.IngestLimit)
+		go handler.acceptLoop(withListener(ctx, newListenerPolicy(lc)), ln, llogger)
+	}
+
+	go func() {
+		<-ctx.Done()
+		closeAll()
+	}()
+	return reloaders, nil
+}
+
+// acceptLoop aceita conexões de ln e as despacha para HandleConnection até
+// ctx ser cancelado, com backoff para prevenir hot loop em erros consecutivos.
+// O chamador fecha ln no cancelamento.
+func (h *Handler) acceptLoop(ctx context.Context, ln net.Listener, logger *slog.Logger) {
+	consecutiveErrors := 0
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			consecutiveErrors++
+			logger.Error("accepting connection", "error", err, "consecutive_errors", consecutiveErrors)
+			if consecutiveErrors > 5 {
+				delay := time.Duration(consecutiveErrors) * 100 * time.Millisecond
+				if delay > 5*time.Second {
+					delay = 5 * time.Second
+				}
+				time.Sleep(delay)
+			}
+			continue
+		}
+
+		consecutiveErrors = 0
+		go h.HandleConnection(ctx, conn)
+	}
+}
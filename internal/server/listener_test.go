@@ -0,0 +1,74 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestAuthorizeAgent_ListenerAllowList(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := &Handler{cfg: &config.ServerConfig{}, logger: logger}
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := &pskConn{Conn: c1, agent: "web-01"}
+
+	wan := newListenerPolicy(config.ListenerConfig{Name: "wan", Auth: config.AuthModePSK, AllowedAgents: []string{"db-01"}})
+	if err := h.authorizeAgent(withListener(context.Background(), wan), conn, logger); !errors.Is(err, errAgentNotAllowedOnListener) {
+		t.Fatalf("expected errAgentNotAllowedOnListener, got %v", err)
+	}
+
+	lan := newListenerPolicy(config.ListenerConfig{Name: "lan", Auth: config.AuthModeMTLS, AllowedAgents: []string{"web-01"}})
+	if err := h.authorizeAgent(withListener(context.Background(), lan), conn, logger); err != nil {
+		t.Fatalf("expected web-01 authorized on lan, got %v", err)
+	}
+	if err := h.authorizeAgent(context.Background(), conn, logger); err != nil {
+		t.Fatalf("expected no listener restriction without policy, got %v", err)
+	}
+
+	// tls.allowed_agents continua valendo em todos os listeners
+	h.cfg.TLS.AllowedAgents = []string{"db-01"}
+	if err := h.authorizeAgent(withListener(context.Background(), lan), conn, logger); !errors.Is(err, errAgentNotAllowed) {
+		t.Fatalf("expected errAgentNotAllowed, got %v", err)
+	}
+}
+
+func TestListenerPolicy_PSK(t *testing.T) {
+	var none *listenerPolicy
+	if !none.psk() {
+		t.Error("expected connections without listener to follow the loaded keyring")
+	}
+	if (&listenerPolicy{auth: config.AuthModeMTLS}).psk() {
+		t.Error("expected mtls listener to skip psk authentication")
+	}
+	if !(&listenerPolicy{auth: config.AuthModePSK}).psk() {
+		t.Error("expected psk listener to require psk authentication")
+	}
+}
+
+func TestIngestReader_ListenerLimit(t *testing.T) {
+	l := newIngestLimits(&config.ServerConfig{})
+	lp := newListenerPolicy(config.ListenerConfig{Name: "wan", IngestLimitRaw: 1024 * 1024})
+
+	r := l.reader(withListener(context.Background(), lp), bytes.NewReader(nil), "default").(*ingestReader)
+	if len(r.limiters) != 3 || r.limiters[2] != lp.ingest {
+		t.Fatalf("expected storage, global and listener limiters, got %d", len(r.limiters))
+	}
+	if r = l.reader(context.Background(), bytes.NewReader(nil), "default").(*ingestReader); len(r.limiters) != 2 {
+		t.Errorf("expected only storage and global limiters without listener, got %d", len(r.limiters))
+	}
+	if newListenerPolicy(config.ListenerConfig{Name: "lan"}).ingest != nil {
+		t.Error("expected no listener limiter without ingest_limit")
+	}
+}
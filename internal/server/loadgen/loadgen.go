@@ -0,0 +1,561 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// Package loadgen gera carga sintética para a WebUI e a API de observabilidade:
+// agents, sessões (single e parallel), stats por stream, histórico e eventos
+// falsos, sem agents reais nem tráfego em disco. Uso exclusivo em
+// desenvolvimento (`nbackup-server loadgen`).
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+const (
+	// maxActiveSnapshots limita os snapshots guardados por sessão ativa.
+	maxActiveSnapshots = 120
+	// chunkSize é o tamanho de chunk simulado nas sessões paralelas.
+	chunkSize = 1 << 20
+)
+
+// Options configura o gerador.
+type Options struct {
+	Agents   int           // agents conectados (default: 12)
+	Sessions int           // sessões simultâneas alvo (default: 4, limitado a Agents)
+	Storages []string      // nomes dos storages (default: default, archive)
+	Seed     int64         // semente do gerador (0 = time.Now)
+	Tick     time.Duration // intervalo entre passos da simulação (default: 1s)
+	Speed    float64       // multiplicador do throughput simulado (default: 1)
+}
+
+// Generator simula um server com agents e sessões. Implementa
+// observability.HandlerMetrics e observability.ConfigProvider, então pode ser
+// passado diretamente para observability.NewRouter.
+type Generator struct {
+	opts    Options
+	cfg     *config.ServerConfig
+	events  *observability.EventStore
+	history *observability.SessionHistoryRing
+	buckets *observability.BucketUploadRing
+
+	mu        sync.Mutex
+	rng       *rand.Rand
+	agents    []*fakeAgent
+	sessions  map[string]*fakeSession
+	snapshots map[string][]observability.ActiveSessionSnapshotEntry
+	trafficIn int64
+	diskWrite int64
+	nextID    int
+}
+
+type fakeAgent struct {
+	name        string
+	addr        string
+	version     string
+	connectedAt time.Time
+	connected   bool
+	stats       observability.AgentStats
+}
+
+type fakeSession struct {
+	id           string
+	agent        *fakeAgent
+	storage      string
+	backup       string
+	mode         string
+	compression  string
+	startedAt    time.Time
+	lastActivity time.Time
+	totalBytes   int64 // tamanho final do backup
+	diskWrite    int64
+	totalObjects uint32
+	walkDone     bool
+	phase        string // receiving | assembling | verifying | done
+	phaseTicks   int
+	maxStreams   int
+	streams      []*fakeStream
+	result       string // definido ao entrar em assembling
+}
+
+type fakeStream struct {
+	offset      int64
+	mbps        float64
+	active      bool
+	slowTicks   int
+	connectedAt time.Time
+	reconnects  int32
+	rotations   int32
+	received    uint32
+	lost        uint32
+	retrans     uint32
+	retransB    int64
+}
+
+// New cria um gerador com agents conectados e o estado inicial das sessões.
+func New(opts Options) *Generator {
+	if opts.Agents <= 0 {
+		opts.Agents = 12
+	}
+	if opts.Sessions <= 0 {
+		opts.Sessions = 4
+	}
+	if opts.Sessions > opts.Agents {
+		opts.Sessions = opts.Agents
+	}
+	if len(opts.Storages) == 0 {
+		opts.Storages = []string{"default", "archive"}
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	if opts.Tick <= 0 {
+		opts.Tick = time.Second
+	}
+	if opts.Speed <= 0 {
+		opts.Speed = 1
+	}
+
+	events, _ := observability.NewEventStore("", 1000, 0)
+	g := &Generator{
+		opts:      opts,
+		cfg:       syntheticConfig(opts.Storages),
+		events:    events,
+		history:   observability.NewSessionHistoryRing(200),
+		buckets:   observability.NewBucketUploadRing(200),
+		rng:       rand.New(rand.NewSource(opts.Seed)),
+		sessions:  make(map[string]*fakeSession),
+		snapshots: make(map[string][]observability.ActiveSessionSnapshotEntry),
+	}
+
+	now := time.Now()
+	for i := 0; i < opts.Agents; i++ {
+		g.agents = append(g.agents, &fakeAgent{
+			name:        fmt.Sprintf("%s-%02d", agentPrefixes[i%len(agentPrefixes)], i/len(agentPrefixes)+1),
+			addr:        fmt.Sprintf("10.0.%d.%d:%d", i/250, i%250+10, 40000+g.rng.Intn(20000)),
+			version:     clientVersions[g.rng.Intn(len(clientVersions))],
+			connectedAt: now.Add(-time.Duration(g.rng.Intn(72*3600)) * time.Second),
+			connected:   true,
+		})
+	}
+	g.seedHistory(now)
+	return g
+}
+
+var (
+	agentPrefixes  = []string{"web", "db", "app", "nas", "mail", "cache"}
+	backupNames    = []string{"app", "home", "etc", "pg", "logs"}
+	clientVersions = []string{"v3.4.0", "v3.5.1", "v3.5.2"}
+)
+
+// syntheticConfig monta a config exibida em /api/v1/config/effective.
+func syntheticConfig(storages []string) *config.ServerConfig {
+	cfg := &config.ServerConfig{
+		Server:   config.ServerListen{Listen: "loadgen (synthetic)"},
+		Storages: make(map[string]config.StorageInfo, len(storages)),
+	}
+	for i, name := range storages {
+		mode := "gzip"
+		if i%2 == 1 {
+			mode = "zst"
+		}
+		cfg.Storages[name] = config.StorageInfo{
+			BaseDir:         "/var/backups/" + name,
+			MaxBackups:      5 + 2*i,
+			CompressionMode: mode,
+			AssemblerMode:   "eager",
+		}
+	}
+	cfg.Logging.Level = "info"
+	return cfg
+}
+
+// SetListen registra o endereço da WebUI exibido na config efetiva.
+func (g *Generator) SetListen(addr string) {
+	g.mu.Lock()
+	g.cfg.WebUI.Listen = addr
+	g.mu.Unlock()
+}
+
+// Events retorna o EventStore (in-memory) alimentado pela simulação.
+func (g *Generator) Events() *observability.EventStore {
+	return g.events
+}
+
+// Run avança a simulação a cada opts.Tick até o context ser cancelado.
+func (g *Generator) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.opts.Tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			g.Step(now)
+		}
+	}
+}
+
+// Step avança a simulação em um tick: progresso dos streams, fases,
+// finalização de sessões, início de novas sessões e eventos aleatórios.
+func (g *Generator) Step(now time.Time) {
+	g.mu.Lock()
+	var events []observability.EventEntry
+	secs := g.opts.Tick.Seconds()
+
+	for _, a := range g.agents {
+		a.stats = observability.AgentStats{
+			CPUPercent:       float32(5 + g.rng.Float64()*60),
+			MemoryPercent:    float32(20 + g.rng.Float64()*50),
+			DiskUsagePercent: float32(30 + g.rng.Float64()*55),
+			LoadAverage:      float32(g.rng.Float64() * 4),
+		}
+		// Quedas e reconexões ocasionais do control channel (agents sem sessão)
+		if a.connected && !g.hasSession(a) && g.rng.Float64() < 0.002 {
+			a.connected = false
+			events = append(events, observability.EventEntry{Level: "warn", Type: "agent_disconnected", Agent: a.name, Message: "control channel closed: EOF"})
+		} else if !a.connected && g.rng.Float64() < 0.2 {
+			a.connected = true
+			a.connectedAt = now
+			events = append(events, observability.EventEntry{Level: "info", Type: "agent_connected", Agent: a.name, Message: "control channel established"})
+		}
+	}
+
+	ids := make([]string, 0, len(g.sessions))
+	for id := range g.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		s := g.sessions[id]
+		events = append(events, g.advance(s, now, secs)...)
+		if s.phase == "done" {
+			events = append(events, g.finish(s, now)...)
+			delete(g.sessions, id)
+			delete(g.snapshots, id)
+			continue
+		}
+		g.snapshot(s, now)
+	}
+
+	for len(g.sessions) < g.opts.Sessions {
+		s := g.start(now)
+		if s == nil {
+			break
+		}
+		events = append(events, observability.EventEntry{Level: "info", Type: "session_start", Agent: s.agent.name, Storage: s.storage, Backup: s.backup,
+			Message: fmt.Sprintf("%s/%s %s session started", s.storage, s.backup, s.mode)})
+	}
+	g.mu.Unlock()
+
+	// Fora do lock: subscribers do EventStore podem consultar o gerador
+	for _, e := range events {
+		e.Timestamp = now.Format(time.RFC3339)
+		g.events.Push(e)
+	}
+}
+
+// hasSession indica se o agent tem sessão ativa. Chamado com g.mu.
+func (g *Generator) hasSession(a *fakeAgent) bool {
+	for _, s := range g.sessions {
+		if s.agent == a {
+			return true
+		}
+	}
+	return false
+}
+
+// start inicia uma sessão para um agent conectado e ocioso. Chamado com g.mu.
+func (g *Generator) start(now time.Time) *fakeSession {
+	var idle []*fakeAgent
+	for _, a := range g.agents {
+		if a.connected && !g.hasSession(a) {
+			idle = append(idle, a)
+		}
+	}
+	if len(idle) == 0 {
+		return nil
+	}
+	a := idle[g.rng.Intn(len(idle))]
+	storage := g.opts.Storages[g.rng.Intn(len(g.opts.Storages))]
+	g.nextID++
+	s := &fakeSession{
+		id:           fmt.Sprintf("loadgen-%06d", g.nextID),
+		agent:        a,
+		storage:      storage,
+		backup:       backupNames[g.rng.Intn(len(backupNames))],
+		mode:         "single",
+		compression:  g.cfg.Storages[storage].CompressionMode,
+		startedAt:    now,
+		lastActivity: now,
+		totalBytes:   int64(256+g.rng.Intn(8*1024)) << 20, // 256 MB a 8 GB
+		phase:        "receiving",
+		maxStreams:   1,
+	}
+	s.totalObjects = uint32(s.totalBytes/(512<<10)) + uint32(g.rng.Intn(1000))
+	if g.rng.Float64() < 0.6 {
+		s.mode = "parallel"
+		s.maxStreams = 2 + g.rng.Intn(7)
+	}
+	active := s.maxStreams
+	if s.mode == "parallel" {
+		active = 1 + g.rng.Intn(s.maxStreams)
+	}
+	for i := 0; i < s.maxStreams; i++ {
+		s.streams = append(s.streams, &fakeStream{
+			mbps:        g.streamMBps(),
+			active:      i < active,
+			connectedAt: now,
+		})
+	}
+	g.sessions[s.id] = s
+	return s
+}
+
+// streamMBps sorteia o throughput base de um stream.
+func (g *Generator) streamMBps() float64 {
+	return (5 + g.rng.Float64()*45) * g.opts.Speed
+}
+
+// advance progride uma sessão em um tick. Chamado com g.mu.
+func (g *Generator) advance(s *fakeSession, now time.Time, secs float64) []observability.EventEntry {
+	var events []observability.EventEntry
+	switch s.phase {
+	case "receiving":
+		var received int64
+		for i, st := range s.streams {
+			if !st.active {
+				// Auto-scaler simulado: ativa streams ociosos de vez em quando
+				if g.rng.Float64() < 0.02 {
+					st.active, st.connectedAt = true, now
+				}
+				received += st.offset
+				continue
+			}
+			rate := st.mbps
+			if st.slowTicks > 0 {
+				st.slowTicks--
+				rate *= 0.1
+			} else if g.rng.Float64() < 0.01 {
+				st.slowTicks = 5 + g.rng.Intn(20)
+			}
+			n := int64(rate * secs * (0.7 + 0.6*g.rng.Float64()) * (1 << 20))
+			st.offset += n
+			g.trafficIn += n
+			if s.mode == "parallel" {
+				chunks := uint32(n / chunkSize)
+				st.received += chunks
+				if g.rng.Float64() < 0.02 {
+					st.lost++
+					st.retrans++
+					st.retransB += chunkSize
+					g.trafficIn += chunkSize
+				}
+				switch r := g.rng.Float64(); {
+				case r < 0.002:
+					st.reconnects++
+					st.connectedAt = now
+					events = append(events, observability.EventEntry{Level: "warn", Type: "reconnect", Agent: s.agent.name, Storage: s.storage, Backup: s.backup, Stream: i,
+						Message: fmt.Sprintf("stream %d reconnected (connection reset by peer)", i)})
+				case r < 0.004:
+					st.rotations++
+					st.connectedAt = now
+					events = append(events, observability.EventEntry{Level: "info", Type: "rotate", Agent: s.agent.name, Storage: s.storage, Backup: s.backup, Stream: i,
+						Message: fmt.Sprintf("stream %d rotated (below min_mbps)", i)})
+				}
+			}
+			received += st.offset
+		}
+		s.lastActivity = now
+		g.diskWrite += received - s.diskWrite
+		s.diskWrite = received
+		if !s.walkDone && received > s.totalBytes/3 {
+			s.walkDone = true
+		}
+		if received >= s.totalBytes {
+			s.phase, s.phaseTicks = "assembling", 2+g.rng.Intn(4)
+			s.result = g.sessionResult()
+		}
+	case "assembling", "verifying":
+		s.phaseTicks--
+		if s.phaseTicks > 0 {
+			break
+		}
+		if s.phase == "assembling" {
+			s.phase, s.phaseTicks = "verifying", 1+g.rng.Intn(3)
+		} else {
+			s.phase = "done"
+		}
+	}
+	return events
+}
+
+// sessionResult sorteia o resultado de uma sessão (a maioria conclui).
+func (g *Generator) sessionResult() string {
+	switch r := g.rng.Float64(); {
+	case r < 0.03:
+		return "checksum_mismatch"
+	case r < 0.05:
+		return "write_error"
+	default:
+		return "ok"
+	}
+}
+
+// received retorna os bytes recebidos da sessão.
+func (s *fakeSession) received() int64 {
+	var total int64
+	for _, st := range s.streams {
+		total += st.offset
+	}
+	return total
+}
+
+// finish registra a sessão no histórico e emite os eventos de fim. Chamado com g.mu.
+func (g *Generator) finish(s *fakeSession, now time.Time) []observability.EventEntry {
+	entry := g.historyEntry(s, now)
+	g.history.Push(entry)
+
+	level := "info"
+	if s.result != "ok" {
+		level = "error"
+	}
+	events := []observability.EventEntry{{Level: level, Type: "session_end", Agent: s.agent.name, Storage: s.storage, Backup: s.backup,
+		Result: s.result, Bytes: entry.BytesTotal, Message: fmt.Sprintf("%s/%s %s (%s)", s.storage, s.backup, s.result, s.mode)}}
+	if s.result == "checksum_mismatch" {
+		events = append(events, observability.EventEntry{Level: "error", Type: "checksum_mismatch", Agent: s.agent.name, Storage: s.storage, Backup: s.backup,
+			Message: "trailer checksum does not match received data"})
+	}
+
+	if s.result == "ok" && g.rng.Float64() < 0.5 {
+		success := g.rng.Float64() > 0.05
+		upload := observability.BucketUploadEntry{
+			Timestamp:     now.Format(time.RFC3339),
+			Agent:         s.agent.name,
+			Storage:       s.storage,
+			Backup:        s.backup,
+			SessionID:     s.id,
+			BucketName:    s.storage + "-offsite",
+			Mode:          []string{"sync", "offload", "archive"}[g.rng.Intn(3)],
+			Success:       success,
+			Duration:      (time.Duration(5+g.rng.Intn(120)) * time.Second).String(),
+			BytesUploaded: entry.BytesTotal,
+		}
+		if !success {
+			upload.Error = "RequestTimeout: upload part timed out"
+			upload.BytesUploaded = 0
+		}
+		g.buckets.Push(upload)
+	}
+	return events
+}
+
+// historyEntry monta a entrada de histórico de uma sessão finalizada.
+func (g *Generator) historyEntry(s *fakeSession, now time.Time) observability.SessionHistoryEntry {
+	si := g.cfg.Storages[s.storage]
+	entry := observability.SessionHistoryEntry{
+		SessionID:   s.id,
+		Agent:       s.agent.name,
+		Storage:     s.storage,
+		Backup:      s.backup,
+		Mode:        s.mode,
+		Compression: s.compression,
+		StartedAt:   s.startedAt.Format(time.RFC3339),
+		FinishedAt:  now.Format(time.RFC3339),
+		Duration:    now.Sub(s.startedAt).Truncate(time.Second).String(),
+		BytesTotal:  s.received(),
+		Result:      s.result,
+		ConfigHash:  fmt.Sprintf("%016x", uint64(len(s.storage))*0x9e3779b97f4a7c15),
+		Config: &observability.SessionConfigSnapshot{
+			CompressionMode:     si.CompressionMode,
+			AssemblerMode:       si.AssemblerMode,
+			AssemblerPendingMem: "8mb",
+			ChunkShardLevels:    1,
+			VerifyIntegrity:     true,
+			MaxBackups:          si.MaxBackups,
+		},
+	}
+	if s.mode == "parallel" {
+		entry.Config.MaxStreams = s.maxStreams
+		entry.Config.ChunkSize = chunkSize
+		var sent int64
+		for i, st := range s.streams {
+			entry.Streams = append(entry.Streams, observability.StreamTransfer{
+				Stream:          uint8(i),
+				BytesSent:       st.offset + st.retransB,
+				GoodputBytes:    st.offset,
+				RetransmitBytes: st.retransB,
+			})
+			entry.RetransmitBytes += st.retransB
+			sent += st.offset + st.retransB
+		}
+		if sent > 0 {
+			entry.RetransmitOverheadPct = float64(entry.RetransmitBytes) / float64(sent) * 100
+		}
+	}
+	return entry
+}
+
+// seedHistory preenche o histórico com sessões das últimas 24h, para a
+// WebUI não começar vazia. Chamado antes de Run.
+func (g *Generator) seedHistory(now time.Time) {
+	for i := 0; i < 40; i++ {
+		a := g.agents[g.rng.Intn(len(g.agents))]
+		finished := now.Add(-time.Duration(40-i) * 30 * time.Minute)
+		duration := time.Duration(60+g.rng.Intn(3600)) * time.Second
+		storage := g.opts.Storages[g.rng.Intn(len(g.opts.Storages))]
+		g.nextID++
+		s := &fakeSession{
+			id:          fmt.Sprintf("loadgen-%06d", g.nextID),
+			agent:       a,
+			storage:     storage,
+			backup:      backupNames[g.rng.Intn(len(backupNames))],
+			mode:        "single",
+			compression: g.cfg.Storages[storage].CompressionMode,
+			startedAt:   finished.Add(-duration),
+			maxStreams:  1,
+			streams:     []*fakeStream{{offset: int64(64+g.rng.Intn(4096)) << 20}},
+			result:      g.sessionResult(),
+		}
+		entry := g.historyEntry(s, finished)
+		g.history.Push(entry)
+		level := "info"
+		if s.result != "ok" {
+			level = "error"
+		}
+		g.events.Push(observability.EventEntry{Timestamp: finished.Format(time.RFC3339), Level: level, Type: "session_end", Agent: a.name,
+			Storage: storage, Backup: s.backup, Result: s.result, Bytes: entry.BytesTotal,
+			Message: fmt.Sprintf("%s/%s %s (%s)", storage, s.backup, s.result, s.mode)})
+	}
+}
+
+// snapshot registra o snapshot periódico de uma sessão ativa. Chamado com g.mu.
+func (g *Generator) snapshot(s *fakeSession, now time.Time) {
+	sum := g.summary(s, now)
+	snaps := append(g.snapshots[s.id], observability.ActiveSessionSnapshotEntry{
+		Timestamp:      now.Format(time.RFC3339),
+		SessionID:      s.id,
+		Agent:          sum.Agent,
+		Storage:        sum.Storage,
+		Backup:         sum.Backup,
+		Mode:           sum.Mode,
+		Compression:    sum.Compression,
+		BytesReceived:  sum.BytesReceived,
+		DiskWriteBytes: sum.DiskWriteBytes,
+		ActiveStreams:  sum.ActiveStreams,
+		MaxStreams:     sum.MaxStreams,
+		Status:         sum.Status,
+	})
+	if len(snaps) > maxActiveSnapshots {
+		snaps = snaps[len(snaps)-maxActiveSnapshots:]
+	}
+	g.snapshots[s.id] = snaps
+}
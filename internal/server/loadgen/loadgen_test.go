@@ -0,0 +1,87 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package loadgen
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+func TestGenerator_SessionsLifecycle(t *testing.T) {
+	g := New(Options{Agents: 6, Sessions: 3, Seed: 42, Tick: time.Second, Speed: 200})
+	seeded := len(g.SessionHistorySnapshot())
+
+	now := time.Now()
+	g.Step(now)
+	sessions := g.SessionsSnapshot()
+	if len(sessions) != 3 {
+		t.Fatalf("expected 3 concurrent sessions, got %d", len(sessions))
+	}
+	if len(g.ConnectedAgents()) == 0 {
+		t.Fatal("expected connected agents")
+	}
+
+	var sawParallel bool
+	for i := 1; i <= 300; i++ {
+		g.Step(now.Add(time.Duration(i) * time.Second))
+		for _, s := range g.SessionsSnapshot() {
+			if s.Mode != "parallel" {
+				continue
+			}
+			detail, ok := g.SessionDetail(s.SessionID)
+			if !ok || len(detail.Streams) != s.MaxStreams || detail.Assembler == nil {
+				t.Fatalf("unexpected parallel session detail: %+v", detail)
+			}
+			sawParallel = true
+		}
+	}
+	if !sawParallel {
+		t.Error("expected at least one parallel session")
+	}
+
+	history := g.SessionHistorySnapshot()
+	if len(history) <= seeded {
+		t.Fatal("expected finished sessions in history")
+	}
+	var sessionEnds int
+	for _, e := range g.Events().Recent(1000) {
+		if e.Type == "session_end" {
+			sessionEnds++
+		}
+	}
+	if sessionEnds != len(history) {
+		t.Errorf("expected one session_end event per history entry, got %d events for %d sessions", sessionEnds, len(history))
+	}
+	if m := g.MetricsSnapshot(); m.TrafficIn == 0 || m.Sessions != 3 {
+		t.Errorf("unexpected metrics: %+v", m)
+	}
+}
+
+func TestGenerator_ServesRouter(t *testing.T) {
+	g := New(Options{Seed: 1})
+	g.Step(time.Now())
+	_, loopback, _ := net.ParseCIDR("127.0.0.1/32")
+	srv := httptest.NewServer(observability.NewRouter(g, g.CurrentConfig(), observability.NewACL([]*net.IPNet{loopback}), g.Events()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var sessions []observability.SessionSummary
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		t.Fatalf("decoding sessions: %v", err)
+	}
+	if len(sessions) != 4 {
+		t.Errorf("expected 4 synthetic sessions over HTTP, got %d", len(sessions))
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package loadgen
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// Implementação de observability.HandlerMetrics sobre o estado simulado.
+
+// MetricsSnapshot implementa observability.HandlerMetrics.
+func (g *Generator) MetricsSnapshot() observability.MetricsData {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var conns int32
+	for _, a := range g.agents {
+		if a.connected {
+			conns++
+		}
+	}
+	for _, s := range g.sessions {
+		conns += int32(s.activeStreams())
+	}
+	return observability.MetricsData{
+		TrafficIn:   g.trafficIn,
+		DiskWrite:   g.diskWrite,
+		ActiveConns: conns,
+		Sessions:    len(g.sessions),
+	}
+}
+
+// SessionsSnapshot implementa observability.HandlerMetrics.
+func (g *Generator) SessionsSnapshot() []observability.SessionSummary {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	sessions := make([]observability.SessionSummary, 0, len(g.sessions))
+	for _, s := range g.sortedSessions() {
+		sessions = append(sessions, g.summary(s, now))
+	}
+	return sessions
+}
+
+// SessionDetail implementa observability.HandlerMetrics.
+func (g *Generator) SessionDetail(id string) (*observability.SessionDetail, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	now := time.Now()
+	detail := &observability.SessionDetail{SessionSummary: g.summary(s, now)}
+	if s.mode == "parallel" {
+		for i, st := range s.streams {
+			status, idle := "running", int64(0)
+			switch {
+			case !st.active:
+				status = "disabled"
+			case st.slowTicks > 0:
+				status = "slow"
+			}
+			sd := observability.StreamDetail{
+				Index:               uint8(i),
+				OffsetBytes:         st.offset,
+				Active:              st.active,
+				IdleSecs:            idle,
+				Status:              status,
+				Reconnects:          st.reconnects,
+				Rotations:           st.rotations,
+				ChunksReceived:      st.received,
+				ChunksLost:          st.lost,
+				ChunksRetransmitted: st.retrans,
+				LastChunkSeq:        st.received * uint32(len(s.streams)),
+			}
+			if st.active {
+				sd.MBps = st.mbps
+				if st.slowTicks > 0 {
+					sd.MBps *= 0.1
+					sd.SlowSince = now.Add(-time.Duration(st.slowTicks) * time.Second).Format(time.RFC3339)
+				}
+				sd.ConnectedFor = now.Sub(st.connectedAt).Truncate(time.Second).String()
+			}
+			detail.Streams = append(detail.Streams, sd)
+		}
+	}
+	if s.phase == "verifying" {
+		read := s.totalBytes / int64(s.phaseTicks+1)
+		detail.IntegrityProgress = &observability.IntegrityProgressDTO{
+			BytesRead:   read,
+			TotalBytes:  s.totalBytes,
+			Entries:     int64(s.totalObjects) * read / s.totalBytes,
+			ProgressPct: float64(read) / float64(s.totalBytes) * 100,
+			ETA:         (time.Duration(s.phaseTicks) * time.Second).String(),
+		}
+	}
+	return detail, true
+}
+
+// ConnectedAgents implementa observability.HandlerMetrics.
+func (g *Generator) ConnectedAgents() []observability.AgentInfo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	agents := make([]observability.AgentInfo, 0, len(g.agents))
+	for _, a := range g.agents {
+		if !a.connected {
+			continue
+		}
+		stats := a.stats
+		agents = append(agents, observability.AgentInfo{
+			Name:          a.name,
+			RemoteAddr:    a.addr,
+			ConnectedAt:   a.connectedAt.Format(time.RFC3339),
+			ConnectedFor:  now.Sub(a.connectedAt).Truncate(time.Second).String(),
+			KeepaliveS:    30,
+			HasSession:    g.hasSession(a),
+			ClientVersion: a.version,
+			Stats:         &stats,
+		})
+	}
+	return agents
+}
+
+// StorageUsageSnapshot implementa observability.HandlerMetrics.
+func (g *Generator) StorageUsageSnapshot() []observability.StorageUsage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	names := make([]string, 0, len(g.cfg.Storages))
+	for name := range g.cfg.Storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const total = 8 << 40 // 8 TB por storage
+	usage := make([]observability.StorageUsage, 0, len(names))
+	for i, name := range names {
+		si := g.cfg.Storages[name]
+		used := uint64(total/10*(3+i%6)) + uint64(g.diskWrite)/uint64(len(names))
+		if used > total {
+			used = total
+		}
+		usage = append(usage, observability.StorageUsage{
+			Name:            name,
+			BaseDir:         si.BaseDir,
+			MaxBackups:      si.MaxBackups,
+			CompressionMode: si.CompressionMode,
+			AssemblerMode:   si.AssemblerMode,
+			TotalBytes:      total,
+			UsedBytes:       used,
+			FreeBytes:       total - used,
+			UsagePercent:    float64(used) / float64(total) * 100,
+			TotalInodes:     total / (64 << 10),
+			FreeInodes:      (total - used) / (64 << 10),
+			InodeUsagePct:   float64(used) / float64(total) * 100,
+			MinFreeInodes:   config.DefaultMinFreeInodes,
+			BackupsCount:    len(g.agents) * si.MaxBackups / len(names),
+			WindowOpen:      true,
+		})
+	}
+	return usage
+}
+
+// SessionHistorySnapshot implementa observability.HandlerMetrics.
+func (g *Generator) SessionHistorySnapshot() []observability.SessionHistoryEntry {
+	return g.history.Recent(0)
+}
+
+// ActiveSessionHistorySnapshot implementa observability.HandlerMetrics.
+func (g *Generator) ActiveSessionHistorySnapshot(sessionID string, limit int) []observability.ActiveSessionSnapshotEntry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var entries []observability.ActiveSessionSnapshotEntry
+	if sessionID != "" {
+		entries = g.snapshots[sessionID]
+	} else {
+		for _, s := range g.sortedSessions() {
+			entries = append(entries, g.snapshots[s.id]...)
+		}
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp < entries[j].Timestamp })
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return append([]observability.ActiveSessionSnapshotEntry{}, entries...)
+}
+
+// ChunkBufferStats implementa observability.HandlerMetrics. A simulação não
+// tem chunk buffer.
+func (g *Generator) ChunkBufferStats() *observability.ChunkBufferDTO {
+	return nil
+}
+
+// SyncStatusSnapshot implementa observability.HandlerMetrics. O sync
+// retroativo nunca roda na simulação.
+func (g *Generator) SyncStatusSnapshot() observability.SyncStatusDTO {
+	return observability.SyncStatusDTO{}
+}
+
+// BucketUploadHistorySnapshot implementa observability.HandlerMetrics.
+func (g *Generator) BucketUploadHistorySnapshot() []observability.BucketUploadEntry {
+	return g.buckets.Recent(0)
+}
+
+// CurrentConfig implementa observability.ConfigProvider.
+func (g *Generator) CurrentConfig() *config.ServerConfig {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.cfg
+}
+
+// sortedSessions retorna as sessões ativas ordenadas por ID. Chamado com g.mu.
+func (g *Generator) sortedSessions() []*fakeSession {
+	sessions := make([]*fakeSession, 0, len(g.sessions))
+	for _, s := range g.sessions {
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].id < sessions[j].id })
+	return sessions
+}
+
+// activeStreams conta os streams ativos (recebendo) da sessão.
+func (s *fakeSession) activeStreams() int {
+	if s.phase != "receiving" {
+		return 0
+	}
+	n := 0
+	for _, st := range s.streams {
+		if st.active {
+			n++
+		}
+	}
+	return n
+}
+
+// summary monta o SessionSummary de uma sessão. Chamado com g.mu.
+func (g *Generator) summary(s *fakeSession, now time.Time) observability.SessionSummary {
+	received := s.received()
+	sum := observability.SessionSummary{
+		SessionID:      s.id,
+		Agent:          s.agent.name,
+		Storage:        s.storage,
+		Backup:         s.backup,
+		ClientVersion:  s.agent.version,
+		Mode:           s.mode,
+		Compression:    s.compression,
+		StartedAt:      s.startedAt.Format(time.RFC3339),
+		LastActivity:   s.lastActivity.Format(time.RFC3339),
+		BytesReceived:  received,
+		DiskWriteBytes: s.diskWrite,
+		ActiveStreams:  s.activeStreams(),
+		Status:         "running",
+		Phase:          s.phase,
+		TotalObjects:   s.totalObjects,
+		ObjectsSent:    uint32(int64(s.totalObjects) * min(received, s.totalBytes) / s.totalBytes),
+		WalkComplete:   s.walkDone,
+		ETA:            "∞",
+	}
+	if s.phase != "receiving" {
+		sum.Status = "finalizing"
+		sum.ETA = "0s"
+	} else if s.walkDone && received > 0 {
+		rate := float64(received) / max(now.Sub(s.startedAt).Seconds(), 1)
+		sum.ETA = (time.Duration(float64(s.totalBytes-received)/rate) * time.Second).Truncate(time.Second).String()
+	}
+	for _, st := range s.streams {
+		if st.slowTicks > 0 && st.active {
+			sum.Status = "degraded"
+			break
+		}
+	}
+	if s.mode == "parallel" {
+		sum.MaxStreams = s.maxStreams
+		totalChunks := uint32(s.totalBytes / chunkSize)
+		asm := &observability.AssemblerStats{
+			NextExpectedSeq: uint32(received / chunkSize),
+			TotalBytes:      received,
+			TotalChunks:     totalChunks,
+			AssembledChunks: uint32(received / chunkSize),
+			Phase:           "receiving",
+		}
+		if s.phase == "assembling" {
+			asm.Phase = "assembling"
+			sum.AssemblyETA = (time.Duration(s.phaseTicks) * time.Second).String()
+		} else if s.phase != "receiving" {
+			asm.Phase, asm.Finalized = "done", true
+		}
+		sum.Assembler = asm
+
+		var producer, drain float32
+		for _, st := range s.streams {
+			if st.active {
+				drain += float32(st.mbps)
+			}
+		}
+		producer = drain * 1.15
+		sum.AutoScale = &observability.AutoScaleInfo{
+			Efficiency:    drain / producer,
+			ProducerMBs:   producer,
+			DrainMBs:      drain,
+			ActiveStreams: uint8(s.activeStreams()),
+			MaxStreams:    uint8(s.maxStreams),
+			State:         "stable",
+		}
+		if s.activeStreams() < s.maxStreams {
+			sum.AutoScale.State = "scaling_up"
+		}
+	}
+	return sum
+}
@@ -0,0 +1,418 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/notify"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// mailSendTimeout limita cada envio SMTP do notificador.
+const mailSendTimeout = 2 * time.Minute
+
+// maxPendingFailures limita as falhas guardadas para o próximo resumo; as
+// excedentes são apenas contadas (Dropped).
+const maxPendingFailures = 200
+
+// defaultFailuresTemplate é o template embutido do resumo de falhas.
+const defaultFailuresTemplate = `{{define "subject"}}[nbackup] {{.Server}}: {{len .Failures}} backup failure(s){{end}}
+{{- define "body"}}Backup failures on {{.Server}}
+Window: {{.Since.Format "2006-01-02T15:04:05Z07:00"}} -> {{.Until.Format "2006-01-02T15:04:05Z07:00"}}
+{{range .Failures}}
+{{.Timestamp}}  {{.Type}}{{if .Result}} ({{.Result}}){{end}}  {{.Agent}}{{if .Storage}}  {{.Storage}}/{{.Backup}}{{end}}
+  {{.Message}}
+{{end}}{{if .Dropped}}
+... and {{.Dropped}} more failure(s) not listed
+{{end}}{{end}}`
+
+// defaultDigestTemplate é o template embutido do digest por storage.
+const defaultDigestTemplate = `{{define "subject"}}[nbackup] {{.Server}} digest: {{.Completed}} completed, {{.Failed}} failed{{end}}
+{{- define "body"}}Backup digest for {{.Server}}
+Window: {{.Since.Format "2006-01-02T15:04:05Z07:00"}} -> {{.Until.Format "2006-01-02T15:04:05Z07:00"}}
+{{range .Storages}}
+Storage {{.Name}}: {{.Completed}} completed, {{.Failed}} failed, {{bytes .Bytes}}
+{{range .Backups}}  {{.Agent}}/{{.Backup}}  completed={{.Completed}} failed={{.Failed}}  {{bytes .Bytes}}  last={{.LastResult}} at {{.LastAt.Format "2006-01-02T15:04:05Z07:00"}}
+{{end}}{{else}}
+No backup sessions in this window.
+{{end}}{{end}}`
+
+// FailureSummary é o dado do template de resumo de falhas.
+type FailureSummary struct {
+	Server   string
+	Since    time.Time
+	Until    time.Time
+	Failures []observability.EventEntry
+	Dropped  int // falhas além de maxPendingFailures, não listadas
+}
+
+// StorageDigest é o dado do template de digest: backups da janela por storage.
+type StorageDigest struct {
+	Server    string
+	Since     time.Time
+	Until     time.Time
+	Storages  []DigestStorage // ordenados por nome
+	Completed int
+	Failed    int
+	Bytes     int64
+}
+
+// DigestStorage agrega as sessões de um storage na janela do digest.
+type DigestStorage struct {
+	Name      string
+	Backups   []DigestBackup // ordenados por agent/backup
+	Completed int
+	Failed    int
+	Bytes     int64
+}
+
+// DigestBackup agrega as sessões de um agent/backup na janela do digest.
+type DigestBackup struct {
+	Agent      string
+	Backup     string
+	Completed  int
+	Failed     int
+	Bytes      int64 // bytes das sessões concluídas
+	LastResult string
+	LastAt     time.Time
+}
+
+// mailNotifier envia o resumo de falhas e o digest por storage por SMTP e
+// pelas rotas de chat (Slack/Telegram) que assinam os eventos "failures" e
+// "digest". Assina o mesmo EventStore dos webhooks: falhas são agrupadas por
+// notifications.failures.interval e sessões finalizadas alimentam o digest.
+// O acumulado do digest fica em memória (um restart inicia uma nova janela).
+type mailNotifier struct {
+	config         func() *config.ServerConfig
+	logger         *slog.Logger
+	server         string
+	failuresTmpl   *template.Template
+	digestTmpl     *template.Template
+	failuresOn     bool
+	digestOn       bool
+	send           func(ctx context.Context, event string, msg notify.Message) error
+	mu             sync.Mutex
+	failures       []observability.EventEntry
+	dropped        int
+	failuresSince  time.Time
+	digestSince    time.Time
+	digestSessions map[digestKey]*DigestBackup
+}
+
+// digestKey identifica um backup no acumulado do digest.
+type digestKey struct {
+	storage, agent, backup string
+}
+
+// startMailNotifier inicia o resumo de falhas e o digest quando habilitados.
+// Templates e schedule do digest são carregados no start; os canais (SMTP e
+// rotas de chat) são relidos a cada envio.
+func startMailNotifier(ctx context.Context, cfg *config.ServerConfig, handler *Handler, logger *slog.Logger) error {
+	n, err := newMailNotifier(cfg, handler.config, logger.With("component", "mail"))
+	if err != nil || n == nil {
+		return err
+	}
+	handler.ensureEventStore()
+	handler.Events.Subscribe(n.handle)
+
+	if n.failuresOn {
+		go n.runFailures(ctx, cfg.Notifications.Failures.Interval)
+	}
+	if n.digestOn {
+		c := cron.New()
+		if _, err := c.AddFunc(cfg.Notifications.Digest.Schedule, func() { n.flushDigest(ctx) }); err != nil {
+			return fmt.Errorf("notifications.digest.schedule %q: %w", cfg.Notifications.Digest.Schedule, err)
+		}
+		c.Start()
+		go func() {
+			<-ctx.Done()
+			c.Stop()
+		}()
+	}
+
+	logger.Info("mail notifications enabled",
+		"failures", n.failuresOn,
+		"failures_interval", cfg.Notifications.Failures.Interval,
+		"digest", n.digestOn,
+		"digest_schedule", cfg.Notifications.Digest.Schedule,
+	)
+	return nil
+}
+
+// newMailNotifier carrega os templates e cria o notificador. Retorna nil
+// quando nem o resumo de falhas nem o digest estão habilitados.
+func newMailNotifier(cfg *config.ServerConfig, cfgFn func() *config.ServerConfig, logger *slog.Logger) (*mailNotifier, error) {
+	nc := cfg.Notifications
+	if !nc.Failures.Enabled && !nc.Digest.Enabled {
+		return nil, nil
+	}
+	server, _ := os.Hostname()
+	now := time.Now()
+	n := &mailNotifier{
+		config:         cfgFn,
+		logger:         logger,
+		server:         server,
+		failuresOn:     nc.Failures.Enabled,
+		digestOn:       nc.Digest.Enabled,
+		failuresSince:  now,
+		digestSince:    now,
+		digestSessions: make(map[digestKey]*DigestBackup),
+	}
+	n.send = n.sendToChannels
+
+	var err error
+	if n.failuresOn {
+		if n.failuresTmpl, err = loadMailTemplate(nc.Failures.Template, defaultFailuresTemplate); err != nil {
+			return nil, fmt.Errorf("notifications.failures.template: %w", err)
+		}
+	}
+	if n.digestOn {
+		if n.digestTmpl, err = loadMailTemplate(nc.Digest.Template, defaultDigestTemplate); err != nil {
+			return nil, fmt.Errorf("notifications.digest.template: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// sendToChannels entrega msg em todos os canais que assinam event. Falhas
+// parciais são apenas logadas: o erro só é retornado (e o conteúdo volta para
+// o próximo envio) se nenhum canal entregou, evitando duplicatas nos canais
+// que já receberam.
+func (n *mailNotifier) sendToChannels(ctx context.Context, event string, msg notify.Message) error {
+	senders := notify.ServerSendersFor(n.config().Notifications, event)
+	if len(senders) == 0 {
+		return nil
+	}
+	var errs []error
+	for _, s := range senders {
+		if err := s.Send(ctx, msg); err != nil {
+			n.logger.Warn("notification delivery failed", "event", event, "channel", s.Name(), "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	if len(errs) == len(senders) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// loadMailTemplate carrega o template de path (ou o embutido, se vazio) e
+// exige as definições "subject" e "body".
+func loadMailTemplate(path, builtin string) (*template.Template, error) {
+	text := builtin
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("mail").Funcs(template.FuncMap{"bytes": formatBytesGo}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"subject", "body"} {
+		if tmpl.Lookup(name) == nil {
+			return nil, fmt.Errorf("template must define %q", name)
+		}
+	}
+	return tmpl, nil
+}
+
+// renderMail executa os templates "subject" (uma linha) e "body".
+func renderMail(tmpl *template.Template, data any) (notify.Message, error) {
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return notify.Message{}, err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return notify.Message{}, err
+	}
+	return notify.Message{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Body:    body.String(),
+	}, nil
+}
+
+// isFailureEvent indica se o evento entra no resumo de falhas. Sessões
+// expiradas chegam como session_end com result "expired".
+func isFailureEvent(e observability.EventEntry) bool {
+	switch e.Type {
+	case "session_end":
+		return e.Result != "ok"
+	case "agent_disconnected", "integrity_failed":
+		return true
+	}
+	return false
+}
+
+// handle é o subscriber do EventStore. Apenas acumula; o envio acontece no
+// flush (janela de falhas ou schedule do digest).
+func (n *mailNotifier) handle(e observability.EventEntry) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.failuresOn && isFailureEvent(e) {
+		if len(n.failures) < maxPendingFailures {
+			n.failures = append(n.failures, e)
+		} else {
+			n.dropped++
+		}
+	}
+	if n.digestOn && e.Type == "session_end" {
+		key := digestKey{storage: e.Storage, agent: e.Agent, backup: e.Backup}
+		b := n.digestSessions[key]
+		if b == nil {
+			b = &DigestBackup{Agent: e.Agent, Backup: e.Backup}
+			n.digestSessions[key] = b
+		}
+		if e.Result == "ok" {
+			b.Completed++
+			b.Bytes += e.Bytes
+		} else {
+			b.Failed++
+		}
+		b.LastResult = e.Result
+		b.LastAt, _ = time.Parse(time.RFC3339, e.Timestamp)
+	}
+}
+
+// runFailures envia o resumo de falhas a cada interval, se houver falhas.
+func (n *mailNotifier) runFailures(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.flushFailures(ctx)
+		}
+	}
+}
+
+// flushFailures envia as falhas acumuladas. Se o envio falhar em todos os
+// canais, elas voltam para o próximo resumo.
+func (n *mailNotifier) flushFailures(ctx context.Context) {
+	n.mu.Lock()
+	summary := FailureSummary{
+		Server:   n.server,
+		Since:    n.failuresSince,
+		Until:    time.Now(),
+		Failures: n.failures,
+		Dropped:  n.dropped,
+	}
+	if len(summary.Failures) == 0 {
+		n.failuresSince = summary.Until
+		n.mu.Unlock()
+		return
+	}
+	n.failures, n.dropped, n.failuresSince = nil, 0, summary.Until
+	n.mu.Unlock()
+
+	if err := n.deliver(ctx, config.ChatEventFailures, n.failuresTmpl, summary); err != nil {
+		n.logger.Error("failure summary delivery failed", "failures", len(summary.Failures), "error", err)
+		n.mu.Lock()
+		n.failures = append(summary.Failures, n.failures...)
+		if len(n.failures) > maxPendingFailures {
+			n.dropped += len(n.failures) - maxPendingFailures
+			n.failures = n.failures[:maxPendingFailures]
+		}
+		n.dropped += summary.Dropped
+		n.failuresSince = summary.Since
+		n.mu.Unlock()
+		return
+	}
+	n.logger.Info("failure summary sent", "failures", len(summary.Failures))
+}
+
+// flushDigest envia o digest da janela, mesmo sem sessões (confirma que o
+// server está vivo). Se o envio falhar em todos os canais, o acumulado volta
+// para o próximo digest.
+func (n *mailNotifier) flushDigest(ctx context.Context) {
+	n.mu.Lock()
+	since, until := n.digestSince, time.Now()
+	sessions := n.digestSessions
+	n.digestSessions = make(map[digestKey]*DigestBackup)
+	n.digestSince = until
+	n.mu.Unlock()
+
+	digest := buildStorageDigest(n.server, since, until, sessions)
+	if err := n.deliver(ctx, config.ChatEventDigest, n.digestTmpl, digest); err != nil {
+		n.logger.Error("digest delivery failed", "error", err)
+		n.mu.Lock()
+		for key, b := range n.digestSessions {
+			if prev := sessions[key]; prev != nil {
+				prev.Completed += b.Completed
+				prev.Failed += b.Failed
+				prev.Bytes += b.Bytes
+				prev.LastResult, prev.LastAt = b.LastResult, b.LastAt
+				continue
+			}
+			sessions[key] = b
+		}
+		n.digestSessions = sessions
+		n.digestSince = since
+		n.mu.Unlock()
+		return
+	}
+	n.logger.Info("digest sent", "completed", digest.Completed, "failed", digest.Failed)
+}
+
+// deliver renderiza e envia a mensagem aos canais de event.
+func (n *mailNotifier) deliver(ctx context.Context, event string, tmpl *template.Template, data any) error {
+	msg, err := renderMail(tmpl, data)
+	if err != nil {
+		return fmt.Errorf("rendering template: %w", err)
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, mailSendTimeout)
+	defer cancel()
+	return n.send(sendCtx, event, msg)
+}
+
+// buildStorageDigest agrupa o acumulado por storage, em ordem alfabética.
+func buildStorageDigest(server string, since, until time.Time, sessions map[digestKey]*DigestBackup) StorageDigest {
+	d := StorageDigest{Server: server, Since: since, Until: until}
+	byStorage := make(map[string]*DigestStorage)
+	for key, b := range sessions {
+		s := byStorage[key.storage]
+		if s == nil {
+			s = &DigestStorage{Name: key.storage}
+			byStorage[key.storage] = s
+		}
+		s.Backups = append(s.Backups, *b)
+		s.Completed += b.Completed
+		s.Failed += b.Failed
+		s.Bytes += b.Bytes
+	}
+	for _, s := range byStorage {
+		sort.Slice(s.Backups, func(i, j int) bool {
+			if s.Backups[i].Agent != s.Backups[j].Agent {
+				return s.Backups[i].Agent < s.Backups[j].Agent
+			}
+			return s.Backups[i].Backup < s.Backups[j].Backup
+		})
+		d.Storages = append(d.Storages, *s)
+		d.Completed += s.Completed
+		d.Failed += s.Failed
+		d.Bytes += s.Bytes
+	}
+	sort.Slice(d.Storages, func(i, j int) bool { return d.Storages[i].Name < d.Storages[j].Name })
+	return d
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/notify"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+func newTestMailNotifier(t *testing.T, cfg *config.ServerConfig) (*mailNotifier, *Handler, *[]notify.Message) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := &Handler{cfg: cfg, logger: logger}
+	n, err := newMailNotifier(cfg, h.config, logger)
+	if err != nil {
+		t.Fatalf("newMailNotifier: %v", err)
+	}
+	var sent []notify.Message
+	n.send = func(_ context.Context, _ string, msg notify.Message) error {
+		sent = append(sent, msg)
+		return nil
+	}
+	h.ensureEventStore()
+	h.Events.Subscribe(n.handle)
+	return n, h, &sent
+}
+
+func TestMailNotifier_FailureSummary(t *testing.T) {
+	cfg := &config.ServerConfig{}
+	cfg.Notifications.Failures = config.FailureSummaryConfig{Enabled: true, Interval: time.Minute}
+	n, h, sent := newTestMailNotifier(t, cfg)
+
+	n.flushFailures(context.Background())
+	if len(*sent) != 0 {
+		t.Fatal("expected no mail without failures")
+	}
+
+	h.recordSessionEnd("s1", "web-01", "default", "app", "single", "gzip", "ok", time.Now(), 1024, nil, nil)
+	h.recordSessionEnd("s2", "web-01", "default", "app", "single", "gzip", "checksum_mismatch", time.Now(), 0, nil, nil)
+	h.Events.PushEvent("warn", "agent_disconnected", "db-01", "control channel closed: EOF", 0)
+
+	// Envio falho: as falhas voltam para o próximo resumo
+	n.send = func(context.Context, string, notify.Message) error { return errors.New("smtp down") }
+	n.flushFailures(context.Background())
+	var msgs []notify.Message
+	n.send = func(_ context.Context, _ string, msg notify.Message) error {
+		msgs = append(msgs, msg)
+		return nil
+	}
+	n.flushFailures(context.Background())
+
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 summary, got %d", len(msgs))
+	}
+	if !strings.Contains(msgs[0].Subject, "2 backup failure(s)") {
+		t.Errorf("unexpected subject %q", msgs[0].Subject)
+	}
+	for _, want := range []string{"checksum_mismatch", "web-01", "default/app", "agent_disconnected", "db-01"} {
+		if !strings.Contains(msgs[0].Body, want) {
+			t.Errorf("body missing %q:\n%s", want, msgs[0].Body)
+		}
+	}
+}
+
+func TestMailNotifier_DigestPerStorage(t *testing.T) {
+	cfg := &config.ServerConfig{}
+	cfg.Notifications.Digest = config.ServerDigestConfig{Enabled: true, Schedule: "0 7 * * *"}
+	n, h, sent := newTestMailNotifier(t, cfg)
+
+	h.recordSessionEnd("s1", "web-01", "default", "app", "single", "gzip", "ok", time.Now(), 2048, nil, nil)
+	h.recordSessionEnd("s2", "web-01", "default", "app", "single", "gzip", "ok", time.Now(), 1024, nil, nil)
+	h.recordSessionEnd("s3", "db-01", "archive", "pg", "parallel", "zst", "expired", time.Now(), 0, nil, nil)
+
+	n.mu.Lock()
+	digest := buildStorageDigest(n.server, n.digestSince, time.Now(), n.digestSessions)
+	n.mu.Unlock()
+	if digest.Completed != 2 || digest.Failed != 1 || digest.Bytes != 3072 {
+		t.Fatalf("unexpected totals: %+v", digest)
+	}
+	if len(digest.Storages) != 2 || digest.Storages[0].Name != "archive" || digest.Storages[1].Name != "default" {
+		t.Fatalf("expected storages sorted by name, got %+v", digest.Storages)
+	}
+	app := digest.Storages[1].Backups[0]
+	if app.Agent != "web-01" || app.Completed != 2 || app.Bytes != 3072 || app.LastResult != "ok" {
+		t.Errorf("unexpected backup aggregate: %+v", app)
+	}
+
+	n.flushDigest(context.Background())
+	if len(*sent) != 1 || !strings.Contains((*sent)[0].Subject, "2 completed, 1 failed") {
+		t.Fatalf("unexpected digest mail: %+v", *sent)
+	}
+	if !strings.Contains((*sent)[0].Body, "Storage archive") || !strings.Contains((*sent)[0].Body, "3.0 KB") {
+		t.Errorf("unexpected digest body:\n%s", (*sent)[0].Body)
+	}
+
+	// Nova janela começa vazia, mas o digest ainda é enviado
+	n.flushDigest(context.Background())
+	if len(*sent) != 2 || !strings.Contains((*sent)[1].Body, "No backup sessions") {
+		t.Errorf("expected empty digest, got %+v", (*sent)[1])
+	}
+}
+
+func TestMailNotifier_CustomTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failures.tmpl")
+	tmpl := `{{define "subject"}}ALERT
+{{len .Failures}}{{end}}{{define "body"}}{{range .Failures}}{{.Agent}};{{end}}{{end}}`
+	if err := os.WriteFile(path, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.ServerConfig{}
+	cfg.Notifications.Failures = config.FailureSummaryConfig{Enabled: true, Interval: time.Minute, Template: path}
+	n, h, sent := newTestMailNotifier(t, cfg)
+
+	h.Events.Push(observability.EventEntry{Level: "error", Type: "integrity_failed", Agent: "nas-01", Message: "bad archive"})
+	n.flushFailures(context.Background())
+	if len(*sent) != 1 || (*sent)[0].Subject != "ALERT 1" || (*sent)[0].Body != "nas-01;" {
+		t.Fatalf("unexpected mail: %+v", *sent)
+	}
+
+	os.WriteFile(path, []byte(`{{define "subject"}}x{{end}}`), 0644)
+	if _, err := newMailNotifier(cfg, h.config, h.logger); err == nil {
+		t.Error("expected template without body to be rejected")
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package observability
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// ErrAccountingDisabled indica que a contabilidade de ingestão não está habilitada.
+var ErrAccountingDisabled = errors.New("ingest accounting is disabled")
+
+// accountingDayLayout é o formato do dia (UTC) de um AccountingDay.
+const accountingDayLayout = "2006-01-02"
+
+// AccountingDay acumula a ingestão de um agent em um storage em um dia (UTC).
+// No arquivo, cada sessão finalizada é um registro com os seus totais; a
+// compactação os agrega em um registro por dia/agent/storage.
+type AccountingDay struct {
+	Day      string `json:"day"` // YYYY-MM-DD (UTC)
+	Agent    string `json:"agent"`
+	Storage  string `json:"storage"`
+	Bytes    int64  `json:"bytes"` // bytes recebidos, de todas as sessões
+	Sessions int    `json:"sessions"`
+	OK       int    `json:"ok"`
+	Failed   int    `json:"failed"` // sessões com resultado diferente de ok e cancelled
+}
+
+func (d AccountingDay) key() string {
+	return d.Day + "\x00" + d.Agent + "\x00" + d.Storage
+}
+
+func (d *AccountingDay) add(o AccountingDay) {
+	d.Bytes += o.Bytes
+	d.Sessions += o.Sessions
+	d.OK += o.OK
+	d.Failed += o.Failed
+}
+
+// AccountingStore persiste a contabilidade de ingestão (accounting.file).
+type AccountingStore struct {
+	mu        sync.Mutex
+	path      string
+	retention int // dias
+	file      *os.File
+	days      map[string]*AccountingDay
+	lines     int
+}
+
+// NewAccountingStore abre o arquivo de contabilidade, descartando os dias
+// além de retentionDays e compactando os registros por sessão.
+func NewAccountingStore(path string, retentionDays int) (*AccountingStore, error) {
+	entries, f, _, err := statefile.OpenLog[AccountingDay](path, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening accounting file: %w", err)
+	}
+	s := &AccountingStore{path: path, retention: retentionDays, file: f, lines: len(entries)}
+	s.days = aggregateAccounting(entries)
+	if err := s.compact(time.Now()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// aggregateAccounting agrega os registros por dia/agent/storage.
+func aggregateAccounting(entries []AccountingDay) map[string]*AccountingDay {
+	days := make(map[string]*AccountingDay, len(entries))
+	for _, e := range entries {
+		if d, ok := days[e.key()]; ok {
+			d.add(e)
+		} else {
+			e := e
+			days[e.key()] = &e
+		}
+	}
+	return days
+}
+
+// Add contabiliza uma sessão finalizada em at.
+func (s *AccountingStore) Add(agent, storage, result string, bytes int64, at time.Time) {
+	e := AccountingDay{Day: at.UTC().Format(accountingDayLayout), Agent: agent, Storage: storage, Bytes: bytes, Sessions: 1}
+	switch result {
+	case "ok":
+		e.OK = 1
+	case "cancelled":
+	default:
+		e.Failed = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := s.days[e.key()]; ok {
+		d.add(e)
+	} else {
+		s.days[e.key()] = &e
+	}
+	if err := statefile.Append(s.file, e); err != nil {
+		return
+	}
+	s.lines++
+	// Um registro por sessão: compacta quando o arquivo passa do dobro do agregado
+	if s.lines > 2*len(s.days)+1000 {
+		s.compact(at)
+	}
+}
+
+// compact reescreve o arquivo com um registro por dia/agent/storage, sem os
+// dias além da retenção. Chamado com mu (ou antes do store ser publicado).
+func (s *AccountingStore) compact(now time.Time) error {
+	cutoff := now.UTC().AddDate(0, 0, -s.retention).Format(accountingDayLayout)
+	for k, d := range s.days {
+		if d.Day < cutoff {
+			delete(s.days, k)
+		}
+	}
+	if s.lines == len(s.days) {
+		return nil
+	}
+	entries := s.snapshot()
+	// Reescrita atômica: um crash durante a compactação preserva o arquivo anterior
+	if err := statefile.WriteLog(s.path, entries, 0644); err != nil {
+		return fmt.Errorf("compacting accounting file: %w", err)
+	}
+	s.file.Close()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("reopening accounting file: %w", err)
+	}
+	s.file, s.lines = f, len(entries)
+	return nil
+}
+
+// snapshot retorna os dias ordenados por dia, agent e storage. Chamado com mu.
+func (s *AccountingStore) snapshot() []AccountingDay {
+	entries := make([]AccountingDay, 0, len(s.days))
+	for _, d := range s.days {
+		entries = append(entries, *d)
+	}
+	sortAccounting(entries)
+	return entries
+}
+
+func sortAccounting(entries []AccountingDay) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Day != entries[j].Day {
+			return entries[i].Day < entries[j].Day
+		}
+		if entries[i].Agent != entries[j].Agent {
+			return entries[i].Agent < entries[j].Agent
+		}
+		return entries[i].Storage < entries[j].Storage
+	})
+}
+
+// Days retorna os dias contabilizados, ordenados.
+func (s *AccountingStore) Days() []AccountingDay {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+// Close fecha o arquivo.
+func (s *AccountingStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// ReadAccounting lê e agrega o arquivo de contabilidade sem abri-lo para
+// escrita (usado pelo `nbackup-server report` com o daemon rodando).
+func ReadAccounting(path string) ([]AccountingDay, error) {
+	entries, _, err := statefile.ReadLog[AccountingDay](path)
+	if err != nil {
+		return nil, fmt.Errorf("reading accounting file: %w", err)
+	}
+	days := aggregateAccounting(entries)
+	result := make([]AccountingDay, 0, len(days))
+	for _, d := range days {
+		result = append(result, *d)
+	}
+	sortAccounting(result)
+	return result, nil
+}
+
+// AccountingFilter seleciona o período e, opcionalmente, um agent ou storage
+// de um AccountingReport.
+type AccountingFilter struct {
+	Days    int       // período em dias, terminando em Until (default: 30)
+	Until   time.Time // último dia do período (default: hoje, UTC)
+	Agent   string
+	Storage string
+	Top     int // limite de agents/storages listados (0 = todos)
+}
+
+// AccountingTotals são os totais de um grupo (período, dia, agent ou storage).
+type AccountingTotals struct {
+	Bytes       int64   `json:"bytes"`
+	Sessions    int     `json:"sessions"`
+	OK          int     `json:"ok"`
+	Failed      int     `json:"failed"`
+	SuccessRate float64 `json:"success_rate"` // ok / (ok + failed), em %; 0 sem sessões
+}
+
+func (t *AccountingTotals) add(d AccountingDay) {
+	t.Bytes += d.Bytes
+	t.Sessions += d.Sessions
+	t.OK += d.OK
+	t.Failed += d.Failed
+	if n := t.OK + t.Failed; n > 0 {
+		t.SuccessRate = float64(t.OK) * 100 / float64(n)
+	}
+}
+
+// AccountingDailyTotal são os totais de um dia do período.
+type AccountingDailyTotal struct {
+	Day string `json:"day"`
+	AccountingTotals
+}
+
+// AccountingGroup são os totais de um agent ou storage no período. Growth é
+// a variação percentual da ingestão diária média entre a segunda e a
+// primeira metade do período (nil sem ingestão na primeira metade).
+type AccountingGroup struct {
+	Name string `json:"name"`
+	AccountingTotals
+	Share  float64  `json:"share"` // % dos bytes do período
+	Growth *float64 `json:"growth,omitempty"`
+
+	firstHalf, secondHalf int64
+}
+
+// AccountingReport é o relatório de ingestão de um período.
+type AccountingReport struct {
+	Since    string                 `json:"since"`
+	Until    string                 `json:"until"`
+	Days     int                    `json:"days"`
+	Agent    string                 `json:"agent,omitempty"`
+	Storage  string                 `json:"storage,omitempty"`
+	Totals   AccountingTotals       `json:"totals"`
+	Daily    []AccountingDailyTotal `json:"daily"`    // um item por dia do período, inclusive sem ingestão
+	Agents   []AccountingGroup      `json:"agents"`   // por bytes, decrescente
+	Storages []AccountingGroup      `json:"storages"` // por bytes, decrescente
+}
+
+// BuildAccountingReport monta o relatório de f a partir dos dias contabilizados.
+func BuildAccountingReport(days []AccountingDay, f AccountingFilter) AccountingReport {
+	if f.Days <= 0 {
+		f.Days = 30
+	}
+	until := f.Until
+	if until.IsZero() {
+		until = time.Now()
+	}
+	until = until.UTC().Truncate(24 * time.Hour)
+	since := until.AddDate(0, 0, -(f.Days - 1))
+	sinceDay, untilDay := since.Format(accountingDayLayout), until.Format(accountingDayLayout)
+	// Dias da primeira metade do período, para o Growth
+	mid := since.AddDate(0, 0, f.Days/2).Format(accountingDayLayout)
+
+	rep := AccountingReport{Since: sinceDay, Until: untilDay, Days: f.Days, Agent: f.Agent, Storage: f.Storage}
+	daily := make(map[string]*AccountingDailyTotal, f.Days)
+	for i := 0; i < f.Days; i++ {
+		day := since.AddDate(0, 0, i).Format(accountingDayLayout)
+		rep.Daily = append(rep.Daily, AccountingDailyTotal{Day: day})
+	}
+	for i := range rep.Daily {
+		daily[rep.Daily[i].Day] = &rep.Daily[i]
+	}
+
+	agents := make(map[string]*AccountingGroup)
+	storages := make(map[string]*AccountingGroup)
+	group := func(m map[string]*AccountingGroup, name string, d AccountingDay) {
+		g, ok := m[name]
+		if !ok {
+			g = &AccountingGroup{Name: name}
+			m[name] = g
+		}
+		g.add(d)
+		if d.Day < mid {
+			g.firstHalf += d.Bytes
+		} else {
+			g.secondHalf += d.Bytes
+		}
+	}
+	for _, d := range days {
+		if d.Day < sinceDay || d.Day > untilDay || (f.Agent != "" && d.Agent != f.Agent) || (f.Storage != "" && d.Storage != f.Storage) {
+			continue
+		}
+		rep.Totals.add(d)
+		daily[d.Day].add(d)
+		group(agents, d.Agent, d)
+		group(storages, d.Storage, d)
+	}
+
+	firstDays, secondDays := float64(f.Days/2), float64(f.Days-f.Days/2)
+	finish := func(m map[string]*AccountingGroup) []AccountingGroup {
+		list := make([]AccountingGroup, 0, len(m))
+		for _, g := range m {
+			if rep.Totals.Bytes > 0 {
+				g.Share = float64(g.Bytes) * 100 / float64(rep.Totals.Bytes)
+			}
+			if g.firstHalf > 0 && firstDays > 0 {
+				growth := (float64(g.secondHalf)/secondDays/(float64(g.firstHalf)/firstDays) - 1) * 100
+				g.Growth = &growth
+			}
+			list = append(list, *g)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Bytes != list[j].Bytes {
+				return list[i].Bytes > list[j].Bytes
+			}
+			return list[i].Name < list[j].Name
+		})
+		if f.Top > 0 && len(list) > f.Top {
+			list = list[:f.Top]
+		}
+		return list
+	}
+	rep.Agents = finish(agents)
+	rep.Storages = finish(storages)
+	return rep
+}
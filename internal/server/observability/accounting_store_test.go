@@ -0,0 +1,91 @@
+package observability
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+func TestAccountingStore_CompactsAndAppliesRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounting.jsonl")
+	s, err := NewAccountingStore(path, 30)
+	if err != nil {
+		t.Fatalf("NewAccountingStore: %v", err)
+	}
+	now := time.Now()
+	s.Add("web-01", "default", "ok", 100, now)
+	s.Add("web-01", "default", "write_error", 10, now)
+	s.Add("web-01", "default", "cancelled", 1, now)
+	s.Add("db-01", "default", "ok", 500, now)
+	s.Add("db-01", "default", "ok", 7, now.AddDate(0, 0, -60)) // além da retenção
+	s.Close()
+
+	s, err = NewAccountingStore(path, 30)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer s.Close()
+	days := s.Days()
+	if len(days) != 2 {
+		t.Fatalf("expected 2 days after retention, got %+v", days)
+	}
+	if d := days[1]; d.Agent != "web-01" || d.Bytes != 111 || d.Sessions != 3 || d.OK != 1 || d.Failed != 1 {
+		t.Errorf("unexpected aggregate: %+v", d)
+	}
+
+	// Compactado: um registro por dia/agent/storage
+	entries, _, err := statefile.ReadLog[AccountingDay](path)
+	if err != nil {
+		t.Fatalf("ReadLog: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected compacted file with 2 records, got %d", len(entries))
+	}
+
+	s.Add("web-01", "default", "ok", 9, now)
+	read, err := ReadAccounting(path)
+	if err != nil {
+		t.Fatalf("ReadAccounting: %v", err)
+	}
+	if len(read) != 2 || read[1].Bytes != 120 {
+		t.Errorf("unexpected ReadAccounting result: %+v", read)
+	}
+}
+
+func TestBuildAccountingReport(t *testing.T) {
+	until := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	days := []AccountingDay{
+		{Day: "2026-03-01", Agent: "web-01", Storage: "default", Bytes: 100, Sessions: 1, OK: 1},
+		{Day: "2026-03-09", Agent: "web-01", Storage: "default", Bytes: 300, Sessions: 2, OK: 1, Failed: 1},
+		{Day: "2026-03-10", Agent: "db-01", Storage: "pg", Bytes: 600, Sessions: 1, OK: 1},
+		{Day: "2026-02-28", Agent: "db-01", Storage: "pg", Bytes: 999, Sessions: 1, OK: 1}, // fora do período
+	}
+	rep := BuildAccountingReport(days, AccountingFilter{Days: 10, Until: until})
+
+	if rep.Since != "2026-03-01" || rep.Until != "2026-03-10" || len(rep.Daily) != 10 {
+		t.Fatalf("unexpected period: %s..%s, %d days", rep.Since, rep.Until, len(rep.Daily))
+	}
+	if rep.Totals.Bytes != 1000 || rep.Totals.Sessions != 4 || rep.Totals.SuccessRate != 75 {
+		t.Errorf("unexpected totals: %+v", rep.Totals)
+	}
+	if rep.Daily[8].Bytes != 300 || rep.Daily[4].Sessions != 0 {
+		t.Errorf("unexpected daily series: %+v", rep.Daily)
+	}
+	if len(rep.Agents) != 2 || rep.Agents[0].Name != "db-01" || rep.Agents[0].Share != 60 {
+		t.Fatalf("unexpected agents: %+v", rep.Agents)
+	}
+	// db-01 não ingeriu na primeira metade; web-01 triplicou
+	if rep.Agents[0].Growth != nil {
+		t.Errorf("expected no growth without first-half ingest, got %v", *rep.Agents[0].Growth)
+	}
+	if g := rep.Agents[1].Growth; g == nil || *g != 200 {
+		t.Errorf("unexpected web-01 growth: %v", g)
+	}
+
+	rep = BuildAccountingReport(days, AccountingFilter{Days: 10, Until: until, Storage: "default", Top: 1})
+	if rep.Totals.Bytes != 400 || len(rep.Agents) != 1 || len(rep.Storages) != 1 {
+		t.Errorf("unexpected filtered report: %+v", rep)
+	}
+}
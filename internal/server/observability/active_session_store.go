@@ -5,12 +5,12 @@
 package observability
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
 	"os"
 	"sync"
 	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/statefile"
 )
 
 // ActiveSessionSnapshotEntry representa um snapshot periódico de uma sessão ativa.
@@ -94,9 +94,9 @@ func NewActiveSessionStore(path string, ringCap, maxLines int) (*ActiveSessionSt
 	}
 
 	ring := newActiveSessionRing(ringCap)
-	entries, lineCount, err := loadActiveSessionJSONL(path)
+	entries, f, rep, err := statefile.OpenLog[ActiveSessionSnapshotEntry](path, 0644)
 	if err != nil {
-		return nil, fmt.Errorf("loading active sessions file: %w", err)
+		return nil, fmt.Errorf("opening active sessions file: %w", err)
 	}
 
 	start := 0
@@ -107,43 +107,7 @@ func NewActiveSessionStore(path string, ringCap, maxLines int) (*ActiveSessionSt
 		ring.Push(e)
 	}
 
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("opening active sessions file for append: %w", err)
-	}
-
-	return &ActiveSessionStore{ring: ring, file: f, maxLines: maxLines, lineCount: lineCount, path: path}, nil
-}
-
-func loadActiveSessionJSONL(path string) ([]ActiveSessionSnapshotEntry, int, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, 0, nil
-		}
-		return nil, 0, err
-	}
-	defer f.Close()
-
-	var entries []ActiveSessionSnapshotEntry
-	lineCount := 0
-	scanner := bufio.NewScanner(f)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-
-	for scanner.Scan() {
-		lineCount++
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-		var e ActiveSessionSnapshotEntry
-		if err := json.Unmarshal(line, &e); err != nil {
-			continue
-		}
-		entries = append(entries, e)
-	}
-
-	return entries, lineCount, scanner.Err()
+	return &ActiveSessionStore{ring: ring, file: f, maxLines: maxLines, lineCount: rep.Records + rep.Corrupt, path: path}, nil
 }
 
 // PushSnapshot converte SessionSummary em snapshot e persiste.
@@ -176,11 +140,7 @@ func (s *ActiveSessionStore) push(e ActiveSessionSnapshotEntry) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := json.Marshal(filled)
-	if err != nil {
-		return
-	}
-	if _, err := s.file.Write(append(data, '\n')); err != nil {
+	if err := statefile.Append(s.file, filled); err != nil {
 		return
 	}
 
@@ -224,33 +184,21 @@ func (s *ActiveSessionStore) Close() error {
 
 func (s *ActiveSessionStore) rotate() {
 	keep := s.maxLines / 2
-	entries, _, err := loadActiveSessionJSONL(s.path)
+	entries, _, err := statefile.ReadLog[ActiveSessionSnapshotEntry](s.path)
 	if err != nil || len(entries) <= keep {
 		return
 	}
 	entries = entries[len(entries)-keep:]
 
-	s.file.Close()
-	f, err := os.Create(s.path)
-	if err != nil {
-		s.file, _ = os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	// Reescrita atômica: um crash durante a rotação preserva o arquivo anterior
+	if err := statefile.WriteLog(s.path, entries, 0644); err != nil {
 		return
 	}
-	w := bufio.NewWriter(f)
-	for _, e := range entries {
-		data, err := json.Marshal(e)
-		if err != nil {
-			continue
-		}
-		w.Write(data)
-		w.WriteByte('\n')
-	}
-	w.Flush()
-	f.Close()
-
-	s.file, err = os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	s.file.Close()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return
 	}
+	s.file = f
 	s.lineCount = len(entries)
 }
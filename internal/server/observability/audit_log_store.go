@@ -0,0 +1,451 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package observability
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// Eventos de um AuditRecord, na ordem do ciclo de vida de uma sessão.
+const (
+	AuditHandshake    = "handshake"     // sessão aceita (ACK GO)
+	AuditResume       = "resume"        // resume de uma sessão (single-stream ou paralela)
+	AuditStreamJoin   = "stream_join"   // stream paralelo conectado (Reason: join, reconnect ou rotation)
+	AuditStreamRotate = "stream_rotate" // flow rotation pedida pelo server
+	AuditCommit       = "commit"        // archive commitado (CommitPath)
+	AuditEnd          = "end"           // sessão finalizada (Result)
+)
+
+// Nomes dos arquivos do audit log: audit-<instante UTC>.jsonl, ordenáveis pelo nome.
+const (
+	auditFilePrefix = "audit-"
+	auditFileSuffix = ".jsonl"
+	auditTimeLayout = "20060102T150405.000000000Z"
+
+	// AuditIndexFile é o índice de sessões finalizadas no dir do audit log.
+	AuditIndexFile = "index.jsonl"
+)
+
+// ErrAuditDisabled indica que o audit log de sessões não está habilitado.
+var ErrAuditDisabled = errors.New("session audit log is disabled")
+
+// AuditRecord é um registro do audit log de sessões. Campos vazios não se
+// aplicam ao evento.
+type AuditRecord struct {
+	Time            time.Time        `json:"time"`
+	SessionID       string           `json:"session_id"`
+	Event           string           `json:"event"`
+	Agent           string           `json:"agent,omitempty"`
+	Storage         string           `json:"storage,omitempty"`
+	Backup          string           `json:"backup,omitempty"`
+	Placement       string           `json:"placement,omitempty"`
+	ClientVersion   string           `json:"client_version,omitempty"`
+	Protocol        uint8            `json:"protocol,omitempty"`
+	RemoteAddr      string           `json:"remote_addr,omitempty"`
+	Mode            string           `json:"mode,omitempty"` // single ou parallel
+	Compression     string           `json:"compression,omitempty"`
+	MaxStreams      uint8            `json:"max_streams,omitempty"`
+	ChunkSize       uint32           `json:"chunk_size,omitempty"`
+	Stream          *uint8           `json:"stream,omitempty"`
+	Reason          string           `json:"reason,omitempty"`
+	Offset          int64            `json:"offset,omitempty"` // resume/re-join: bytes já recebidos
+	Result          string           `json:"result,omitempty"`
+	Bytes           int64            `json:"bytes,omitempty"`
+	DurationSeconds float64          `json:"duration_seconds,omitempty"`
+	Streams         []StreamTransfer `json:"streams,omitempty"`
+	RetransmitBytes int64            `json:"retransmit_bytes,omitempty"`
+	CommitPath      string           `json:"commit_path,omitempty"`
+	Message         string           `json:"message,omitempty"`
+}
+
+// AuditIndexEntry é a entrada do índice de uma sessão finalizada: resumo e
+// posição do primeiro registro da sessão (arquivo e offset), a partir da
+// qual AuditLog.Session lê o ciclo de vida completo.
+type AuditIndexEntry struct {
+	SessionID  string `json:"session_id"`
+	Agent      string `json:"agent"`
+	Storage    string `json:"storage"`
+	Backup     string `json:"backup"`
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at"`
+	Result     string `json:"result"`
+	Bytes      int64  `json:"bytes"`
+	CommitPath string `json:"commit_path,omitempty"`
+	File       string `json:"file"`
+	Offset     int64  `json:"offset"`
+}
+
+// auditPosition é a posição de um registro no audit log.
+type auditPosition struct {
+	file   string
+	offset int64
+}
+
+// auditSession é o estado de uma sessão em andamento no audit log.
+type auditSession struct {
+	first      auditPosition // primeiro registro
+	commitPath string        // último AuditCommit
+}
+
+// AuditLog é o audit log de sessões: registros append-only em arquivos JSONL
+// (formato do statefile) que rotacionam por tamanho, mais um índice das
+// sessões finalizadas. Os arquivos nunca são reescritos — a rotação abre um
+// arquivo novo e apaga os mais antigos além de maxFiles — e o índice é
+// reescrito só para descartar as sessões cujos registros foram apagados.
+type AuditLog struct {
+	mu       sync.Mutex
+	dir      string
+	maxSize  int64
+	maxFiles int
+
+	file *os.File
+	name string // arquivo corrente (base name)
+	size int64
+
+	index *os.File
+
+	// Sessões em andamento: chave do chamador (agent:storage:backup) →
+	// sessionID, e sessionID → estado.
+	open     map[string]string
+	sessions map[string]*auditSession
+}
+
+// OpenAuditLog abre (criando, se preciso) o audit log em dir. O arquivo mais
+// recente continua recebendo registros até atingir maxSize.
+func OpenAuditLog(dir string, maxSize int64, maxFiles int) (*AuditLog, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("creating audit log dir: %w", err)
+	}
+	_, index, _, err := statefile.OpenLog[AuditIndexEntry](filepath.Join(dir, AuditIndexFile), 0640)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit index: %w", err)
+	}
+	a := &AuditLog{
+		dir:      dir,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		index:    index,
+		open:     make(map[string]string),
+		sessions: make(map[string]*auditSession),
+	}
+
+	files, err := a.files()
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	if len(files) == 0 {
+		err = a.openFile(a.nextName())
+	} else {
+		err = a.openFile(files[len(files)-1])
+	}
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// Dir retorna o diretório do audit log.
+func (a *AuditLog) Dir() string {
+	return a.dir
+}
+
+// files lista os arquivos do audit log, do mais antigo ao mais recente.
+func (a *AuditLog) files() ([]string, error) {
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return nil, fmt.Errorf("listing audit log dir: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), auditFilePrefix) && strings.HasSuffix(e.Name(), auditFileSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// nextName retorna o nome de um arquivo novo, posterior (na ordem dos nomes)
+// ao corrente mesmo se o relógio voltar.
+func (a *AuditLog) nextName() string {
+	t := time.Now().UTC()
+	if cur, err := time.Parse(auditTimeLayout, strings.TrimSuffix(strings.TrimPrefix(a.name, auditFilePrefix), auditFileSuffix)); err == nil && !t.After(cur) {
+		t = cur.Add(time.Nanosecond)
+	}
+	return auditFilePrefix + t.Format(auditTimeLayout) + auditFileSuffix
+}
+
+// openFile abre name para append, truncando uma cauda incompleta.
+func (a *AuditLog) openFile(name string) error {
+	_, f, rep, err := statefile.OpenLog[json.RawMessage](filepath.Join(a.dir, name), 0640)
+	if err != nil {
+		return fmt.Errorf("opening audit log file: %w", err)
+	}
+	if a.file != nil {
+		a.file.Close()
+	}
+	a.file, a.name, a.size = f, name, rep.ValidSize
+	return nil
+}
+
+// Begin registra o início de uma sessão (handshake ou resume) e associa key
+// a rec.SessionID para os registros feitos por RecordKey.
+func (a *AuditLog) Begin(key string, rec AuditRecord) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// Sessão anterior da mesma chave que terminou sem End (ex: erro antes de
+	// receber dados): o estado dela não é mais necessário
+	if prev, ok := a.open[key]; ok && prev != rec.SessionID {
+		delete(a.sessions, prev)
+	}
+	a.open[key] = rec.SessionID
+	pos, ok := a.write(rec)
+	if _, seen := a.sessions[rec.SessionID]; ok && !seen {
+		a.sessions[rec.SessionID] = &auditSession{first: pos}
+	}
+}
+
+// Record grava um registro de uma sessão já iniciada.
+func (a *AuditLog) Record(rec AuditRecord) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.write(rec)
+}
+
+// RecordKey grava rec na sessão em andamento associada a key por Begin.
+// Sem sessão associada, o registro é descartado. O CommitPath de um
+// AuditCommit vai também para o índice.
+func (a *AuditLog) RecordKey(key string, rec AuditRecord) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	id, ok := a.open[key]
+	if !ok {
+		return
+	}
+	rec.SessionID = id
+	a.write(rec)
+	if s, ok := a.sessions[id]; ok && rec.Event == AuditCommit {
+		s.commitPath = rec.CommitPath
+	}
+}
+
+// End grava o registro final da sessão (rec.Event = AuditEnd) e sua entrada
+// no índice.
+func (a *AuditLog) End(key string, rec AuditRecord, startedAt time.Time) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.open[key] == rec.SessionID {
+		delete(a.open, key)
+	}
+	rec.Event = AuditEnd
+	pos, ok := a.write(rec)
+	var commitPath string
+	if s, seen := a.sessions[rec.SessionID]; seen {
+		pos, ok, commitPath = s.first, true, s.commitPath
+		delete(a.sessions, rec.SessionID)
+	}
+	if !ok {
+		return
+	}
+	statefile.Append(a.index, AuditIndexEntry{
+		SessionID:  rec.SessionID,
+		Agent:      rec.Agent,
+		Storage:    rec.Storage,
+		Backup:     rec.Backup,
+		StartedAt:  startedAt.UTC().Format(time.RFC3339),
+		FinishedAt: rec.Time.UTC().Format(time.RFC3339),
+		Result:     rec.Result,
+		Bytes:      rec.Bytes,
+		CommitPath: commitPath,
+		File:       pos.file,
+		Offset:     pos.offset,
+	})
+}
+
+// write grava rec no arquivo corrente, rotacionando antes se ele não couber.
+// Retorna a posição do registro. Chamado com mu.
+func (a *AuditLog) write(rec AuditRecord) (auditPosition, bool) {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	rec.Time = rec.Time.UTC()
+	line, err := statefile.Marshal(rec)
+	if err != nil {
+		return auditPosition{}, false
+	}
+	if a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		a.rotate()
+	}
+	pos := auditPosition{file: a.name, offset: a.size}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	return pos, err == nil
+}
+
+// rotate abre um arquivo novo, apaga os excedentes de maxFiles e descarta do
+// índice as sessões que apontam para arquivos apagados. Chamado com mu.
+func (a *AuditLog) rotate() {
+	if err := a.openFile(a.nextName()); err != nil {
+		return
+	}
+	files, err := a.files()
+	if err != nil || len(files) <= a.maxFiles {
+		return
+	}
+	removed := make(map[string]bool)
+	for _, name := range files[:len(files)-a.maxFiles] {
+		if os.Remove(filepath.Join(a.dir, name)) == nil {
+			removed[name] = true
+		}
+	}
+
+	path := filepath.Join(a.dir, AuditIndexFile)
+	entries, _, err := statefile.ReadLog[AuditIndexEntry](path)
+	if err != nil {
+		return
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if !removed[e.File] {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == len(entries) {
+		return
+	}
+	// Reescrita atômica: um crash durante a rotação preserva o índice anterior
+	if err := statefile.WriteLog(path, kept, 0640); err != nil {
+		return
+	}
+	a.index.Close()
+	if f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640); err == nil {
+		a.index = f
+	}
+	for _, s := range a.sessions {
+		if removed[s.first.file] {
+			// Início da sessão apagado: o índice aponta para o que restou
+			s.first = auditPosition{file: a.name}
+		}
+	}
+}
+
+// Sessions retorna as entradas do índice que passam pelo filtro, em ordem
+// cronológica.
+func (a *AuditLog) Sessions(f SessionHistoryFilter) ([]AuditIndexEntry, error) {
+	a.mu.Lock()
+	entries, _, err := statefile.ReadLog[AuditIndexEntry](filepath.Join(a.dir, AuditIndexFile))
+	a.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("reading audit index: %w", err)
+	}
+
+	result := make([]AuditIndexEntry, 0, len(entries))
+	for _, e := range entries {
+		if f.match(SessionHistoryEntry{Agent: e.Agent, Storage: e.Storage, Backup: e.Backup, Result: e.Result, FinishedAt: e.FinishedAt}) {
+			result = append(result, e)
+		}
+	}
+	if f.Limit > 0 && f.Limit < len(result) {
+		result = result[len(result)-f.Limit:]
+	}
+	return result, nil
+}
+
+// Session retorna os registros de uma sessão finalizada, localizada pelo
+// índice: lê a partir do primeiro registro até o AuditEnd, seguindo pelos
+// arquivos seguintes se a sessão atravessou uma rotação. Retorna
+// os.ErrNotExist se a sessão não está no índice.
+func (a *AuditLog) Session(sessionID string) ([]AuditRecord, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries, _, err := statefile.ReadLog[AuditIndexEntry](filepath.Join(a.dir, AuditIndexFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading audit index: %w", err)
+	}
+	var entry *AuditIndexEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].SessionID == sessionID {
+			entry = &entries[i]
+			break
+		}
+	}
+	if entry == nil {
+		return nil, os.ErrNotExist
+	}
+
+	files, err := a.files()
+	if err != nil {
+		return nil, err
+	}
+	start := sort.SearchStrings(files, entry.File)
+	if start == len(files) || files[start] != entry.File {
+		return nil, os.ErrNotExist
+	}
+
+	var records []AuditRecord
+	offset := entry.Offset
+	for _, name := range files[start:] {
+		data, err := os.ReadFile(filepath.Join(a.dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("reading audit log: %w", err)
+		}
+		if offset > int64(len(data)) {
+			return nil, fmt.Errorf("audit index offset %d past the end of %s", offset, name)
+		}
+		done := false
+		statefile.Parse(data[offset:], func(payload []byte) error {
+			var r AuditRecord
+			if err := json.Unmarshal(payload, &r); err != nil {
+				return err
+			}
+			if !done && r.SessionID == sessionID {
+				records = append(records, r)
+				done = r.Event == AuditEnd
+			}
+			return nil
+		})
+		if done {
+			break
+		}
+		offset = 0
+	}
+	return records, nil
+}
+
+// Close fecha os arquivos do audit log.
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.index.Close()
+	return a.file.Close()
+}
@@ -0,0 +1,96 @@
+package observability
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLog_SessionLifecycleAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	a, err := OpenAuditLog(dir, 1<<20, 5)
+	if err != nil {
+		t.Fatalf("OpenAuditLog: %v", err)
+	}
+	start := time.Now()
+	idx := uint8(1)
+	a.Begin("web-01:default:app", AuditRecord{SessionID: "s1", Event: AuditHandshake, Agent: "web-01", Storage: "default", Backup: "app", ClientVersion: "v1.2.3"})
+	a.Begin("db-01:default:pg", AuditRecord{SessionID: "s2", Event: AuditHandshake, Agent: "db-01", Storage: "default", Backup: "pg"})
+	a.Record(AuditRecord{SessionID: "s1", Event: AuditStreamJoin, Stream: &idx, Reason: "join"})
+	a.RecordKey("web-01:default:app", AuditRecord{Event: AuditCommit, CommitPath: "/data/web-01/app/x.tar.gz"})
+	a.RecordKey("unknown:default:app", AuditRecord{Event: AuditCommit, CommitPath: "/dropped"})
+	a.End("web-01:default:app", AuditRecord{SessionID: "s1", Agent: "web-01", Storage: "default", Backup: "app", Result: "ok", Bytes: 42}, start)
+	a.Close()
+
+	a, err = OpenAuditLog(dir, 1<<20, 5)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer a.Close()
+	a.End("db-01:default:pg", AuditRecord{SessionID: "s2", Agent: "db-01", Storage: "default", Backup: "pg", Result: "write_error"}, start)
+
+	sessions, err := a.Sessions(SessionHistoryFilter{Result: "ok"})
+	if err != nil {
+		t.Fatalf("Sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != "s1" || sessions[0].CommitPath != "/data/web-01/app/x.tar.gz" || sessions[0].Offset != 0 {
+		t.Fatalf("unexpected index: %+v", sessions)
+	}
+
+	records, err := a.Session("s1")
+	if err != nil {
+		t.Fatalf("Session: %v", err)
+	}
+	var events []string
+	for _, r := range records {
+		events = append(events, r.Event)
+	}
+	if got := strings.Join(events, ","); got != "handshake,stream_join,commit,end" {
+		t.Errorf("unexpected events: %s", got)
+	}
+	if records[0].ClientVersion != "v1.2.3" || records[3].Bytes != 42 {
+		t.Errorf("unexpected records: %+v", records)
+	}
+	if _, err := a.Session("missing"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist for unknown session, got %v", err)
+	}
+}
+
+func TestAuditLog_RotationPrunesFilesAndIndex(t *testing.T) {
+	dir := t.TempDir()
+	a, err := OpenAuditLog(dir, 1<<20, 2)
+	if err != nil {
+		t.Fatalf("OpenAuditLog: %v", err)
+	}
+	defer a.Close()
+	a.maxSize = 600 // força rotação a cada poucos registros
+
+	pad := strings.Repeat("x", 200)
+	for _, id := range []string{"s1", "s2", "s3", "s4", "s5", "s6"} {
+		key := "web-01:default:" + id
+		a.Begin(key, AuditRecord{SessionID: id, Event: AuditHandshake, Agent: "web-01", Message: pad})
+		a.End(key, AuditRecord{SessionID: id, Agent: "web-01", Result: "ok", Message: pad}, time.Now())
+	}
+
+	files, _ := a.files()
+	if len(files) != 2 {
+		t.Fatalf("expected 2 audit files after rotation, got %v", files)
+	}
+	sessions, _ := a.Sessions(SessionHistoryFilter{})
+	if len(sessions) == 0 || sessions[len(sessions)-1].SessionID != "s6" {
+		t.Fatalf("unexpected index after rotation: %+v", sessions)
+	}
+	for _, s := range sessions {
+		if s.File != files[0] && s.File != files[1] {
+			t.Errorf("index entry %s points to pruned file %s", s.SessionID, s.File)
+		}
+		records, err := a.Session(s.SessionID)
+		if err != nil || len(records) != 2 || records[1].Event != AuditEnd {
+			t.Errorf("session %s: unexpected records %+v (%v)", s.SessionID, records, err)
+		}
+	}
+	if _, err := a.Session("s1"); !os.IsNotExist(err) {
+		t.Errorf("expected pruned session s1 to be gone, got %v", err)
+	}
+}
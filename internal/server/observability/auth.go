@@ -0,0 +1,180 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package observability
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/nishisan-dev/n-backup/internal/auth"
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// apiToken é um token da API com o valor guardado apenas como digest.
+type apiToken struct {
+	name   string
+	role   string
+	digest [sha256.Size]byte
+}
+
+// webUser é um usuário da WebUI (web_ui.users) com o hash já decomposto.
+type webUser struct {
+	role string
+	hash passwordHash
+}
+
+// canManage indica se o role da identidade pode executar ações de
+// gerenciamento: admin (tokens) e operator (usuários).
+func canManage(p *auth.Identity) bool {
+	return p.Role == config.APIRoleAdmin || p.Role == config.WebUIRoleOperator
+}
+
+// Auth autentica a API REST por token Bearer (web_ui.api_tokens) e a WebUI
+// por login (web_ui.users, sessão em cookie). Roda depois da ACL: o IP precisa
+// estar em allow_origins E, quando exigido, o request precisa estar autenticado.
+type Auth struct {
+	tokens         []apiToken
+	users          map[string]webUser
+	requireForRead bool
+	logins         *loginSessions
+	store          *EventStore
+}
+
+// NewAuth cria o autenticador a partir dos tokens e usuários já validados pela
+// config. As rotas de leitura exigem autenticação com api_require_token ou
+// quando há usuários da WebUI configurados.
+func NewAuth(cfg config.WebUIConfig, store *EventStore) *Auth {
+	a := &Auth{
+		requireForRead: cfg.APIRequireToken || len(cfg.Users) > 0,
+		users:          make(map[string]webUser, len(cfg.Users)),
+		logins:         newLoginSessions(cfg.SessionTTL),
+		store:          store,
+	}
+	for _, t := range cfg.APITokens {
+		a.tokens = append(a.tokens, apiToken{
+			name:   t.Name,
+			role:   t.Role,
+			digest: sha256.Sum256([]byte(t.Token)),
+		})
+	}
+	for _, u := range cfg.Users {
+		hash, err := parsePasswordHash(u.PasswordHash)
+		if err != nil {
+			continue // rejeitado pela validação da config
+		}
+		a.users[u.Name] = webUser{role: u.Role, hash: hash}
+	}
+	return a
+}
+
+// Enabled indica se há tokens ou usuários configurados (ações de gerenciamento habilitadas).
+func (a *Auth) Enabled() bool {
+	return a != nil && (len(a.tokens) > 0 || len(a.users) > 0)
+}
+
+// lookup retorna o token correspondente ao valor apresentado. Compara os
+// digests em tempo constante e percorre todos os tokens.
+func (a *Auth) lookup(value string) *apiToken {
+	digest := sha256.Sum256([]byte(value))
+	var found *apiToken
+	for i := range a.tokens {
+		if subtle.ConstantTimeCompare(digest[:], a.tokens[i].digest[:]) == 1 {
+			found = &a.tokens[i]
+		}
+	}
+	return found
+}
+
+// protectedPath indica se o path passa pela autenticação: a API (exceto o
+// health, usado por probes) e o endpoint Prometheus. Os assets da SPA não.
+func protectedPath(path string) bool {
+	if path == "/api/v1/health" {
+		return false
+	}
+	return path == "/metrics" || strings.HasPrefix(path, "/api/")
+}
+
+// loginPath indica as rotas de login, acessíveis sem autenticação.
+func loginPath(path string) bool {
+	return strings.HasPrefix(path, "/api/v1/auth/")
+}
+
+type principalKey struct{}
+
+// principalFrom retorna a identidade autenticada do request: um token da API
+// ou um usuário logado na WebUI (nil = anônimo).
+func principalFrom(ctx context.Context) *auth.Identity {
+	p, _ := ctx.Value(principalKey{}).(*auth.Identity)
+	return p
+}
+
+// Middleware autentica o request por token Bearer ou cookie de sessão. Um
+// header Authorization presente precisa ser válido (401 caso contrário);
+// requests autenticados por cookie que alteram estado precisam do header
+// X-Requested-With (proteção CSRF). Sem credenciais, as rotas protegidas seguem
+// anônimas, a menos que a autenticação seja exigida na leitura.
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !protectedPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var p *auth.Identity
+		if value, present := auth.BearerToken(r); present {
+			tok := a.lookup(value)
+			if value == "" || tok == nil {
+				writeUnauthorized(w, "invalid bearer token")
+				return
+			}
+			p = &auth.Identity{Method: auth.MethodToken, Name: tok.name, Credential: "bearer", Role: tok.role}
+		} else if p = a.logins.fromRequest(r); p != nil {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Header.Get("X-Requested-With") == "" {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "missing X-Requested-With header"})
+				return
+			}
+		}
+
+		if p == nil {
+			if a.requireForRead && !loginPath(r.URL.Path) {
+				writeUnauthorized(w, "authentication required")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+// requireManage protege uma ação de gerenciamento: exige token com role admin
+// ou usuário com role operator. O handler recebe o autor para auditoria.
+func (a *Auth) requireManage(next func(w http.ResponseWriter, r *http.Request, actor string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "management API disabled: configure web_ui.api_tokens or web_ui.users"})
+			return
+		}
+		p := principalFrom(r.Context())
+		if p == nil {
+			writeUnauthorized(w, "authentication required")
+			return
+		}
+		if !canManage(p) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": string(p.Method) + " role " + p.Role + " cannot perform this action"})
+			return
+		}
+		next(w, r, p.String())
+	}
+}
+
+// writeUnauthorized responde 401 com o desafio Bearer.
+func writeUnauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="nbackup"`)
+	writeJSON(w, http.StatusUnauthorized, map[string]string{"error": msg})
+}
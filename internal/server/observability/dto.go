@@ -22,6 +22,11 @@ type MetricsResponse struct {
 	TrafficInMBps  float64         `json:"traffic_in_mbps,omitempty"` // preenchido se intervalo disponível
 	DiskWriteMBps  float64         `json:"disk_write_mbps,omitempty"`
 	ChunkBuffer    *ChunkBufferDTO `json:"chunk_buffer,omitempty"`
+	Handshakes     *HandshakeDTO   `json:"handshakes,omitempty"`
+
+	IngestThrottle []IngestThrottleDTO `json:"ingest_throttle,omitempty"`
+	DiskQueues     []DiskQueueDTO      `json:"disk_queues,omitempty"`
+	OrphanSweep    *OrphanSweepDTO     `json:"orphan_sweep,omitempty"`
 }
 
 // SessionSummary é usado na lista de GET /api/v1/sessions.
@@ -40,7 +45,7 @@ type SessionSummary struct {
 	ActiveStreams  int    `json:"active_streams"`
 	MaxStreams     int    `json:"max_streams,omitempty"`
 	Status         string `json:"status"` // running | idle | degraded
-	Phase          string `json:"phase,omitempty"` // receiving | assembling | verifying | uploading | done | failed
+	Phase          string `json:"phase,omitempty"` // receiving | assembling | verifying | deduplicating | uploading | done | failed
 
 	// Campos de progresso vindos do agent (via ControlProgress).
 	// Zero values quando o agent não reporta progresso.
@@ -122,6 +127,10 @@ type EventEntry struct {
 	Level     string `json:"level"` // info | warn | error
 	Type      string `json:"type"`  // reconnect | rotate | stream_dead | checksum_mismatch
 	Agent     string `json:"agent,omitempty"`
+	Storage   string `json:"storage,omitempty"`
+	Backup    string `json:"backup,omitempty"`
+	Result    string `json:"result,omitempty"` // resultado da sessão (apenas session_end)
+	Bytes     int64  `json:"bytes,omitempty"`  // bytes gravados na sessão (apenas session_end)
 	Stream    int    `json:"stream,omitempty"`
 	Message   string `json:"message"`
 }
@@ -130,9 +139,11 @@ type EventEntry struct {
 type ConfigEffective struct {
 	ServerListen string                 `json:"server_listen"`
 	WebUIListen  string                 `json:"web_ui_listen"`
+	Downloads    bool                   `json:"downloads"` // web_ui.allow_downloads
 	Storages     map[string]StorageSafe `json:"storages"`
 	FlowRotation FlowRotationSafe       `json:"flow_rotation"`
 	LogLevel     string                 `json:"log_level"`
+	IngestLimit  string                 `json:"ingest_limit,omitempty"`
 }
 
 // StorageSafe é uma visão segura (sem paths absolutos internos) de um storage.
@@ -141,6 +152,7 @@ type StorageSafe struct {
 	MaxBackups      int    `json:"max_backups"`
 	AssemblerMode   string `json:"assembler_mode"`
 	CompressionMode string `json:"compression_mode"`
+	IngestLimit     string `json:"ingest_limit,omitempty"`
 }
 
 // FlowRotationSafe é uma visão segura da config de flow rotation.
@@ -184,16 +196,45 @@ type AgentInfo struct {
 
 // StorageUsage representa o uso de disco real de um storage.
 type StorageUsage struct {
-	Name            string  `json:"name"`
-	BaseDir         string  `json:"base_dir"`
-	MaxBackups      int     `json:"max_backups"`
-	CompressionMode string  `json:"compression_mode"`
-	AssemblerMode   string  `json:"assembler_mode"`
-	TotalBytes      uint64  `json:"total_bytes"`
-	UsedBytes       uint64  `json:"used_bytes"`
-	FreeBytes       uint64  `json:"free_bytes"`
-	UsagePercent    float64 `json:"usage_percent"`
-	BackupsCount    int     `json:"backups_count"`
+	Name            string         `json:"name"`
+	BaseDir         string         `json:"base_dir"`
+	MaxBackups      int            `json:"max_backups"`
+	CompressionMode string         `json:"compression_mode"`
+	AssemblerMode   string         `json:"assembler_mode"`
+	TotalBytes      uint64         `json:"total_bytes"`
+	UsedBytes       uint64         `json:"used_bytes"`
+	FreeBytes       uint64         `json:"free_bytes"`
+	UsagePercent    float64        `json:"usage_percent"`
+	TotalInodes     uint64         `json:"total_inodes,omitempty"` // 0 = filesystem sem limite fixo de inodes (btrfs, ZFS)
+	FreeInodes      uint64         `json:"free_inodes,omitempty"`
+	InodeUsagePct   float64        `json:"inode_usage_percent,omitempty"`
+	MinFreeInodes   uint64         `json:"min_free_inodes,omitempty"` // storages.*.min_free_inodes (0 = desabilitado)
+	BackupsCount    int            `json:"backups_count"`
+	BackupWindow    string         `json:"backup_window,omitempty"` // "HH:MM-HH:MM" ou vazio (sem restrição)
+	WindowOpen      bool           `json:"window_open"`             // true se handshakes são aceitos agora
+	DiskHealth      *DiskHealthDTO `json:"disk_health,omitempty"`   // nil = storage sem disk_health
+}
+
+// DiskHealthDTO é a saúde do disco de um storage (storages.*.disk_health).
+type DiskHealthDTO struct {
+	State       string    `json:"state"` // ok | degraded | failing | unknown
+	Detail      string    `json:"detail,omitempty"`
+	CheckedAt   string    `json:"checked_at,omitempty"`
+	Since       string    `json:"since,omitempty"` // início do estado atual
+	OnDegraded  string    `json:"on_degraded"`
+	ReadOnly    bool      `json:"read_only"`    // novos backups são recusados
+	ForceVerify bool      `json:"force_verify"` // verify_integrity forçado nos novos backups
+	Scrub       *ScrubDTO `json:"scrub,omitempty"`
+}
+
+// ScrubDTO é o progresso da verificação dos backups existentes de um storage
+// disparada por um disco degradado.
+type ScrubDTO struct {
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	Running    bool   `json:"running"`
+	Checked    int64  `json:"checked"`
+	Corrupt    int64  `json:"corrupt"`
 }
 
 // ServerStats contém métricas de runtime do processo do server.
@@ -219,6 +260,43 @@ type SessionHistoryEntry struct {
 	Duration    string `json:"duration"`
 	BytesTotal  int64  `json:"bytes_total"`
 	Result      string `json:"result"` // ok | checksum_mismatch | write_error | timeout | error
+	Empty       bool   `json:"empty,omitempty"` // backup vazio (sources sem entradas): archive sem conteúdo
+
+	// Overhead de retransmissão (apenas sessões parallel cujo agent enviou ControlSessionSummary).
+	RetransmitBytes       int64            `json:"retransmit_bytes,omitempty"`
+	RetransmitOverheadPct float64          `json:"retransmit_overhead_pct,omitempty"` // retransmit_bytes / bytes enviados × 100
+	Streams               []StreamTransfer `json:"streams,omitempty"`
+
+	// Snapshot da configuração efetiva usada pela sessão (storage + parâmetros negociados).
+	ConfigHash    string                 `json:"config_hash,omitempty"`
+	Config        *SessionConfigSnapshot `json:"config,omitempty"`
+	ConfigChanges []string               `json:"config_changes,omitempty"` // diff contra a sessão anterior do mesmo agent/storage/backup
+}
+
+// StreamTransfer contém os totais de transferência de um stream paralelo.
+type StreamTransfer struct {
+	Stream          uint8 `json:"stream"`
+	BytesSent       int64 `json:"bytes_sent"`       // bytes escritos pelo agent, incluindo retransmissões
+	GoodputBytes    int64 `json:"goodput_bytes"`    // bytes_sent - retransmit_bytes
+	RetransmitBytes int64 `json:"retransmit_bytes"` // reenvios via NACK ou após reconexão
+}
+
+// SessionConfigSnapshot registra as configurações efetivas com que uma sessão rodou.
+// Não inclui credenciais nem endpoints de buckets.
+type SessionConfigSnapshot struct {
+	CompressionMode     string   `json:"compression_mode"`
+	AssemblerMode       string   `json:"assembler_mode"`
+	AssemblerPendingMem string   `json:"assembler_pending_mem_limit"`
+	ChunkShardLevels    int      `json:"chunk_shard_levels"`
+	ChunkFsync          bool     `json:"chunk_fsync"`
+	VerifyIntegrity     bool     `json:"verify_integrity"`
+	MaxBackups          int      `json:"max_backups"`
+	BackupWindow        string   `json:"backup_window,omitempty"`
+	Buckets             []string `json:"buckets,omitempty"`       // "nome:modo"
+	MaxStreams          int      `json:"max_streams,omitempty"`   // sessões paralelas
+	ChunkSize           int      `json:"chunk_size,omitempty"`    // sessões paralelas
+	SACKInterval        int64    `json:"sack_interval,omitempty"` // sessões single: intervalo de SACK negociado (handshake v7)
+	MaxInFlight         int64    `json:"max_inflight,omitempty"`  // sessões single: bytes não confirmados que o agent mantém (0 = ring buffer)
 }
 
 // ChunkBufferDTO representa o estado global do buffer de chunks em memória.
@@ -236,6 +314,48 @@ type ChunkBufferDTO struct {
 	DrainRateMBs       float64 `json:"drain_rate_mbs"` // MB/s taxa atual de drenagem (janela ~5s)
 }
 
+// HandshakeDTO expõe as métricas do limitador de handshakes TLS.
+type HandshakeDTO struct {
+	MaxConcurrent  int     `json:"max_concurrent"`
+	InFlight       int32   `json:"in_flight"`
+	Queued         int32   `json:"queued"`
+	Completed      int64   `json:"completed_total"`
+	Rejected       int64   `json:"rejected_total"` // descartados por timeout de fila
+	Failed         int64   `json:"failed_total"`
+	AvgQueueWaitMs float64 `json:"avg_queue_wait_ms"`
+}
+
+// IngestThrottleDTO expõe quanto tempo as conexões de dados aguardaram um
+// teto de ingestão (ingest_limit).
+type IngestThrottleDTO struct {
+	Storage          string  `json:"storage,omitempty"` // vazio = teto global
+	LimitBytes       int64   `json:"limit_bytes"`       // bytes/seg, 0 = sem limite
+	ThrottledSeconds float64 `json:"throttled_seconds_total"`
+}
+
+// DiskQueueDTO expõe a fila de escrita em disco de um storage
+// (write_workers): writes aguardando, em execução e fsyncs agrupados.
+type DiskQueueDTO struct {
+	Storage     string  `json:"storage"`
+	Workers     int     `json:"workers"` // 0 = fila desabilitada por reload
+	InFlight    int     `json:"in_flight"`
+	Queued      int32   `json:"queued"`
+	Writes      int64   `json:"writes_total"`
+	Bytes       int64   `json:"bytes_total"`
+	WaitSeconds float64 `json:"wait_seconds_total"`
+	Syncs       int64   `json:"sync_requests_total"` // fsyncs pedidos pelas sessões
+	SyncCalls   int64   `json:"syncfs_total"`        // syncfs executados (cada um atende vários pedidos)
+}
+
+// OrphanSweepDTO expõe os totais do sweep de artefatos temporários órfãos
+// (.tmp e chunks_* sem sessão em memória).
+type OrphanSweepDTO struct {
+	Runs           int64  `json:"runs_total"`
+	Removed        int64  `json:"removed_total"`
+	ReclaimedBytes int64  `json:"reclaimed_bytes_total"`
+	LastRunAt      string `json:"last_run_at"`
+}
+
 // ---------------------------------------------------------------------------
 // Sync Storage DTOs — retornados por GET /api/v1/sync/status
 // ---------------------------------------------------------------------------
@@ -285,3 +405,72 @@ type SyncBucketDTO struct {
 	Duration    string `json:"duration"`
 	Error       string `json:"error,omitempty"`
 }
+
+// CatalogEntry é um arquivo de backup armazenado, usado em GET /api/v1/catalog.
+type CatalogEntry struct {
+	Storage     string `json:"storage"`
+	Agent       string `json:"agent"`
+	Backup      string `json:"backup"`
+	File        string `json:"file"`
+	SizeBytes   int64  `json:"size_bytes"`
+	ModifiedAt  string `json:"modified_at"`
+	Quarantined bool   `json:"quarantined,omitempty"`
+	Dedup       bool   `json:"dedup,omitempty"` // manifest de storage dedup (SizeBytes = tamanho do archive original)
+
+	LastDrill *RestoreDrillEntry `json:"last_drill,omitempty"` // último restore drill do archive
+	Lifecycle *LifecycleEntry    `json:"lifecycle,omitempty"`  // recompressão pelo lifecycle do storage
+}
+
+// RestoreDrillEntry é o resultado de um restore drill: a restauração de uma
+// amostra aleatória de arquivos de um archive na área de quarentena,
+// comparada com o manifest (SHA-256 e tamanho) lido do archive.
+type RestoreDrillEntry struct {
+	Storage       string   `json:"storage"`
+	Agent         string   `json:"agent"`
+	Backup        string   `json:"backup"`
+	File          string   `json:"file"`
+	StartedAt     string   `json:"started_at"`
+	Duration      string   `json:"duration"`
+	Result        string   `json:"result"`      // ok | mismatch | error
+	FilesTotal    int64    `json:"files_total"` // arquivos regulares no archive
+	FilesSampled  int      `json:"files_sampled"`
+	BytesRestored int64    `json:"bytes_restored"`
+	Mismatches    []string `json:"mismatches,omitempty"` // arquivos restaurados com hash ou tamanho divergente
+	Error         string   `json:"error,omitempty"`
+}
+
+// LifecycleEntry é o resultado da recompressão de um backup pelo lifecycle
+// do storage (storages.*.lifecycle).
+type LifecycleEntry struct {
+	Storage        string `json:"storage"`
+	Agent          string `json:"agent"`
+	Backup         string `json:"backup"`
+	File           string `json:"file"`   // nome atual do backup
+	Source         string `json:"source"` // nome antes da recompressão
+	RecompressedAt string `json:"recompressed_at"`
+	Duration       string `json:"duration"`
+	Result         string `json:"result"` // recompressed | kept (sem ganho) | error
+	OldSizeBytes   int64  `json:"old_size_bytes"`
+	NewSizeBytes   int64  `json:"new_size_bytes"`
+	SHA256         string `json:"sha256,omitempty"` // do archive recompactado (ou do original, se kept)
+	Error          string `json:"error,omitempty"`
+}
+
+// ActionResponse é retornado pelas ações de gerenciamento (POST) da API REST.
+type ActionResponse struct {
+	Action  string   `json:"action"` // cancel | expire | rotate | quarantine
+	Target  string   `json:"target"`
+	Removed []string `json:"removed,omitempty"` // rotate: backups removidos
+	Path    string   `json:"path,omitempty"`    // quarantine: novo caminho do arquivo
+}
+
+// AuthInfo descreve a autenticação do request (GET /api/v1/auth/me e login).
+type AuthInfo struct {
+	LoginEnabled  bool   `json:"login_enabled"` // web_ui.users configurado
+	AuthRequired  bool   `json:"auth_required"` // leitura exige login ou token
+	Authenticated bool   `json:"authenticated"`
+	Kind          string `json:"kind,omitempty"` // user | token
+	Name          string `json:"name,omitempty"`
+	Role          string `json:"role,omitempty"`
+	CanManage     bool   `json:"can_manage"` // pode cancelar/expirar sessões, rotacionar e colocar em quarentena
+}
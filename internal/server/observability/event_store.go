@@ -5,19 +5,24 @@
 package observability
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
 	"os"
 	"sync"
+
+	"github.com/nishisan-dev/n-backup/internal/statefile"
 )
 
 // EventStore combina um EventRing (in-memory) com persistência em arquivo JSONL.
-// Cada Push() faz append de uma linha JSON ao arquivo. No startup, as últimas
-// entradas são carregadas para popular o ring buffer.
+// Cada Push() faz append de um registro (formato statefile: tamanho, checksum e
+// JSON) ao arquivo. No startup, as últimas entradas são carregadas para popular
+// o ring buffer; registros corrompidos são descartados e uma cauda incompleta
+// (crash no meio de uma escrita) é truncada.
+//
+// Rotação: quando o arquivo excede maxLines, reescreve (de forma atômica)
+// mantendo as últimas maxLines/2 linhas. Isso evita crescimento indefinido sem perder histórico recente.
 //
-// Rotação: quando o arquivo excede maxLines, reescreve mantendo as últimas
-// maxLines/2 linhas. Isso evita crescimento indefinido sem perder histórico recente.
+// Com path vazio o store é apenas in-memory (usado pelos webhooks quando a
+// WebUI está desabilitada).
 type EventStore struct {
 	ring      *EventRing
 	file      *os.File
@@ -36,11 +41,14 @@ func NewEventStore(path string, ringCap, maxLines int) (*EventStore, error) {
 	}
 
 	ring := NewEventRing(ringCap)
+	if path == "" {
+		return &EventStore{ring: ring, maxLines: maxLines}, nil
+	}
 
 	// Carrega eventos existentes do arquivo
-	entries, lineCount, err := loadJSONL(path)
+	entries, f, rep, err := statefile.OpenLog[EventEntry](path, 0644)
 	if err != nil {
-		return nil, fmt.Errorf("loading events file: %w", err)
+		return nil, fmt.Errorf("opening events file: %w", err)
 	}
 
 	// Popula o ring com as últimas entradas (limitado por ringCap)
@@ -52,58 +60,21 @@ func NewEventStore(path string, ringCap, maxLines int) (*EventStore, error) {
 		ring.Push(e)
 	}
 
-	// Abre o arquivo para append
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("opening events file for append: %w", err)
-	}
-
 	return &EventStore{
 		ring:      ring,
 		file:      f,
 		maxLines:  maxLines,
-		lineCount: lineCount,
+		lineCount: rep.Records + rep.Corrupt,
 		path:      path,
 	}, nil
 }
 
-// loadJSONL lê o arquivo JSONL e retorna todos os EventEntry válidos.
-// Linhas malformadas são ignoradas silenciosamente.
-func loadJSONL(path string) ([]EventEntry, int, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, 0, nil
-		}
-		return nil, 0, err
-	}
-	defer f.Close()
-
-	var entries []EventEntry
-	lineCount := 0
-	scanner := bufio.NewScanner(f)
-	// Aumenta o buffer do scanner para linhas longas (1MB)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-
-	for scanner.Scan() {
-		lineCount++
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-		var e EventEntry
-		if err := json.Unmarshal(line, &e); err != nil {
-			continue // ignora linhas corrompidas
-		}
-		entries = append(entries, e)
-	}
-
-	return entries, lineCount, scanner.Err()
-}
-
 // Push adiciona um evento ao ring buffer e persiste no arquivo JSONL.
 func (s *EventStore) Push(e EventEntry) {
 	s.ring.Push(e) // ring preenche timestamp se vazio
+	if s.path == "" {
+		return
+	}
 
 	// Re-lê do ring para pegar o timestamp preenchido
 	recent := s.ring.Recent(1)
@@ -115,12 +86,7 @@ func (s *EventStore) Push(e EventEntry) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := json.Marshal(filled)
-	if err != nil {
-		return
-	}
-
-	if _, err := s.file.Write(append(data, '\n')); err != nil {
+	if err := statefile.Append(s.file, filled); err != nil {
 		return
 	}
 
@@ -141,6 +107,11 @@ func (s *EventStore) PushEvent(level, eventType, agent, message string, stream i
 	})
 }
 
+// Subscribe registra fn para receber cada evento inserido (ver EventRing.Subscribe).
+func (s *EventStore) Subscribe(fn func(EventEntry)) {
+	s.ring.Subscribe(fn)
+}
+
 // Recent retorna os últimos N eventos em ordem cronológica (mais antigo primeiro).
 func (s *EventStore) Recent(limit int) []EventEntry {
 	return s.ring.Recent(limit)
@@ -167,7 +138,7 @@ func (s *EventStore) rotate() {
 	keep := s.maxLines / 2
 
 	// Lê todas as linhas do arquivo
-	entries, _, err := loadJSONL(s.path)
+	entries, _, err := statefile.ReadLog[EventEntry](s.path)
 	if err != nil || len(entries) <= keep {
 		return
 	}
@@ -175,33 +146,15 @@ func (s *EventStore) rotate() {
 	// Mantém as últimas 'keep' entradas
 	entries = entries[len(entries)-keep:]
 
-	// Fecha o arquivo atual
-	s.file.Close()
-
-	// Reescreve o arquivo com as entradas mantidas
-	f, err := os.Create(s.path)
-	if err != nil {
-		// Tenta reabrir em modo append para não perder o handle
-		s.file, _ = os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	// Reescrita atômica: um crash durante a rotação preserva o arquivo anterior
+	if err := statefile.WriteLog(s.path, entries, 0644); err != nil {
 		return
 	}
-
-	w := bufio.NewWriter(f)
-	for _, e := range entries {
-		data, err := json.Marshal(e)
-		if err != nil {
-			continue
-		}
-		w.Write(data)
-		w.WriteByte('\n')
-	}
-	w.Flush()
-	f.Close()
-
-	// Reabre em modo append
-	s.file, err = os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	s.file.Close()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return
 	}
+	s.file = f
 	s.lineCount = len(entries)
 }
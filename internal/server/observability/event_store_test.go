@@ -211,3 +211,15 @@ func TestEventStore_RingCapLimitOnLoad(t *testing.T) {
 		t.Fatalf("expected 10 events in ring (capped), got %d", len(events))
 	}
 }
+
+func TestEventStore_MemoryOnly(t *testing.T) {
+	s, err := NewEventStore("", 10, 0)
+	if err != nil {
+		t.Fatalf("NewEventStore without path: %v", err)
+	}
+	defer s.Close()
+	s.PushEvent("info", "session_end", "web-01", "ok", 0)
+	if s.Len() != 1 {
+		t.Errorf("expected 1 event in memory-only store, got %d", s.Len())
+	}
+}
@@ -7,6 +7,8 @@ package observability
 import (
 	"sync"
 	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/logging"
 )
 
 // EventRing é um ring buffer thread-safe para eventos operacionais.
@@ -17,6 +19,8 @@ type EventRing struct {
 	pos int // próxima posição de escrita
 	cap int
 	len int // quantos slots estão ocupados (max = cap)
+
+	subscribers []func(EventEntry)
 }
 
 // NewEventRing cria um ring buffer com capacidade fixa.
@@ -30,17 +34,36 @@ func NewEventRing(capacity int) *EventRing {
 	}
 }
 
-// Push adiciona um evento ao buffer, num esquema circular.
+// Push adiciona um evento ao buffer, num esquema circular. A mensagem passa
+// pela redação do processo (logging.redact) antes de chegar à WebUI, ao
+// arquivo de eventos e aos subscribers (webhooks e notificações).
 func (r *EventRing) Push(e EventEntry) {
 	if e.Timestamp == "" {
 		e.Timestamp = time.Now().Format(time.RFC3339)
 	}
+	e.Message = logging.Redact(e.Message)
 	r.mu.Lock()
 	r.buf[r.pos] = e
 	r.pos = (r.pos + 1) % r.cap
 	if r.len < r.cap {
 		r.len++
 	}
+	subscribers := r.subscribers
+	r.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(e)
+	}
+}
+
+// Subscribe registra fn para receber cada evento inserido (com timestamp
+// preenchido). fn é chamada de forma síncrona no Push e não deve bloquear.
+func (r *EventRing) Subscribe(fn func(EventEntry)) {
+	r.mu.Lock()
+	// Copy-on-write: Push itera sobre a fatia anterior sem o lock
+	subscribers := make([]func(EventEntry), len(r.subscribers), len(r.subscribers)+1)
+	copy(subscribers, r.subscribers)
+	r.subscribers = append(subscribers, fn)
 	r.mu.Unlock()
 }
 
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/logging"
 )
 
 func TestEventRing_BasicPushRecent(t *testing.T) {
@@ -130,3 +132,37 @@ func TestEventRing_TimestampAutoFilled(t *testing.T) {
 		t.Error("expected auto-filled timestamp")
 	}
 }
+
+func TestEventRing_Subscribe(t *testing.T) {
+	r := NewEventRing(5)
+	var got []EventEntry
+	r.Subscribe(func(e EventEntry) { got = append(got, e) })
+	r.PushEvent("warn", "agent_disconnected", "web-01", "control channel closed", 0)
+
+	if len(got) != 1 || got[0].Type != "agent_disconnected" || got[0].Agent != "web-01" {
+		t.Fatalf("expected subscriber to receive the event, got %+v", got)
+	}
+	if got[0].Timestamp == "" {
+		t.Error("expected subscriber to receive the filled timestamp")
+	}
+}
+
+func TestEventRing_RedactsMessage(t *testing.T) {
+	if err := logging.SetRedaction([]string{`/home/[^/]+`}, ""); err != nil {
+		t.Fatalf("SetRedaction: %v", err)
+	}
+	t.Cleanup(func() { logging.SetRedaction(nil, "") })
+
+	r := NewEventRing(5)
+	var got []EventEntry
+	r.Subscribe(func(e EventEntry) { got = append(got, e) })
+	r.PushEvent("warn", "missing_source", "web-01", "source /home/alice/secret not found", 0)
+
+	want := "source [REDACTED]/secret not found"
+	if len(got) != 1 || got[0].Message != want {
+		t.Fatalf("expected redacted message for subscriber, got %+v", got)
+	}
+	if recent := r.Recent(1); recent[0].Message != want {
+		t.Errorf("expected redacted message in ring, got %q", recent[0].Message)
+	}
+}
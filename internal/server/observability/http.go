@@ -6,8 +6,10 @@ package observability
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"runtime"
 	"strconv"
 	"time"
@@ -43,12 +45,19 @@ type MetricsData struct {
 	ActiveConns int32
 	Sessions    int
 	ChunkBuffer *ChunkBufferDTO
+	Handshakes  *HandshakeDTO
+
+	IngestThrottle []IngestThrottleDTO
+	DiskQueues     []DiskQueueDTO
+	OrphanSweep    *OrphanSweepDTO
 }
 
 // NewRouter cria o http.Handler para a API de observabilidade e SPA.
-// Aplica middleware ACL em todas as rotas.
+// Aplica middleware ACL em todas as rotas e, depois dele, a autenticação por
+// token da API (web_ui.api_tokens) ou login da WebUI (web_ui.users).
 func NewRouter(metrics HandlerMetrics, cfg *config.ServerConfig, acl *ACL, store *EventStore) http.Handler {
 	mux := http.NewServeMux()
+	auth := NewAuth(cfg.WebUI, store)
 
 	// API v1
 	mux.HandleFunc("GET /api/v1/health", handleHealth)
@@ -60,15 +69,37 @@ func NewRouter(metrics HandlerMetrics, cfg *config.ServerConfig, acl *ACL, store
 	mux.HandleFunc("GET /api/v1/storages", makeStoragesHandler(metrics))
 	mux.HandleFunc("GET /api/v1/sessions/history", makeSessionHistoryHandler(metrics))
 	mux.HandleFunc("GET /api/v1/sessions/active-history", makeActiveSessionHistoryHandler(metrics))
-	mux.HandleFunc("GET /api/v1/config/effective", makeConfigHandler(cfg))
+	mux.HandleFunc("GET /api/v1/config/effective", makeConfigHandler(cfg, metrics))
 	mux.HandleFunc("GET /api/v1/sync/status", makeSyncStatusHandler(metrics))
 	mux.HandleFunc("GET /api/v1/buckets/history", makeBucketUploadHistoryHandler(metrics))
+	registerAuthRoutes(mux, auth)
 
 	// Events endpoint (se store fornecido)
 	if store != nil {
 		mux.HandleFunc("GET /api/v1/events", makeEventsHandler(store))
 	}
 
+	// Catálogo e ações de gerenciamento (se o Handler as implementa)
+	if mgr, ok := metrics.(BackupManager); ok {
+		registerManagementRoutes(mux, mgr, auth, store, cfg.WebUI.AllowDownloads)
+	}
+
+	// Histórico persistido com filtros (se o Handler o expõe)
+	if q, ok := metrics.(SessionHistoryQuerier); ok {
+		mux.HandleFunc("GET /api/v1/history", makeHistoryQueryHandler(q))
+	}
+
+	// Relatório de ingestão (se o Handler o expõe)
+	if rp, ok := metrics.(AccountingReporter); ok {
+		mux.HandleFunc("GET /api/v1/reports/ingest", makeIngestReportHandler(rp))
+	}
+
+	// Audit log de sessões (se o Handler o expõe)
+	if q, ok := metrics.(AuditQuerier); ok {
+		mux.HandleFunc("GET /api/v1/audit/sessions", makeAuditSessionsHandler(q))
+		mux.HandleFunc("GET /api/v1/audit/sessions/{id}", makeAuditSessionHandler(q))
+	}
+
 	// SPA — serve assets embarcados via go:embed
 	spa := http.FileServer(WebFS())
 	mux.Handle("GET /", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -76,7 +107,7 @@ func NewRouter(metrics HandlerMetrics, cfg *config.ServerConfig, acl *ACL, store
 		spa.ServeHTTP(w, r)
 	}))
 
-	return acl.Middleware(mux)
+	return acl.Middleware(auth.Middleware(mux))
 }
 
 // handleHealth retorna status do processo, uptime, versão e métricas de runtime.
@@ -119,6 +150,10 @@ func makeMetricsHandler(metrics HandlerMetrics) http.HandlerFunc {
 			ActiveConns:    data.ActiveConns,
 			Sessions:       data.Sessions,
 			ChunkBuffer:    data.ChunkBuffer,
+			Handshakes:     data.Handshakes,
+			IngestThrottle: data.IngestThrottle,
+			DiskQueues:     data.DiskQueues,
+			OrphanSweep:    data.OrphanSweep,
 		}
 		writeJSON(w, http.StatusOK, resp)
 	}
@@ -243,6 +278,106 @@ func makePrometheusHandler(metrics HandlerMetrics) http.HandlerFunc {
 			fmt.Fprintf(w, "nbackup_server_chunk_buffer_drain_mbps %g\n", cb.DrainRateMBs)
 		}
 
+		if data.Handshakes != nil {
+			hs := data.Handshakes
+
+			fmt.Fprintf(w, "# HELP nbackup_server_tls_handshakes_max_concurrent Configured limit of concurrent TLS handshakes.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_tls_handshakes_max_concurrent gauge\n")
+			fmt.Fprintf(w, "nbackup_server_tls_handshakes_max_concurrent %d\n", hs.MaxConcurrent)
+
+			fmt.Fprintf(w, "# HELP nbackup_server_tls_handshakes_in_flight TLS handshakes currently running.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_tls_handshakes_in_flight gauge\n")
+			fmt.Fprintf(w, "nbackup_server_tls_handshakes_in_flight %d\n", hs.InFlight)
+
+			fmt.Fprintf(w, "# HELP nbackup_server_tls_handshakes_queued Connections waiting for a TLS handshake slot.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_tls_handshakes_queued gauge\n")
+			fmt.Fprintf(w, "nbackup_server_tls_handshakes_queued %d\n", hs.Queued)
+
+			fmt.Fprintf(w, "# HELP nbackup_server_tls_handshakes_total TLS handshakes by outcome.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_tls_handshakes_total counter\n")
+			fmt.Fprintf(w, "nbackup_server_tls_handshakes_total{result=\"ok\"} %d\n", hs.Completed)
+			fmt.Fprintf(w, "nbackup_server_tls_handshakes_total{result=\"failed\"} %d\n", hs.Failed)
+			fmt.Fprintf(w, "nbackup_server_tls_handshakes_total{result=\"queue_timeout\"} %d\n", hs.Rejected)
+
+			fmt.Fprintf(w, "# HELP nbackup_server_tls_handshake_queue_wait_avg_ms Average time spent waiting for a handshake slot.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_tls_handshake_queue_wait_avg_ms gauge\n")
+			fmt.Fprintf(w, "nbackup_server_tls_handshake_queue_wait_avg_ms %g\n", hs.AvgQueueWaitMs)
+		}
+
+		if len(data.IngestThrottle) > 0 {
+			fmt.Fprintf(w, "# HELP nbackup_server_ingest_limit_bytes Configured ingest cap in bytes per second (0 = unlimited).\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_ingest_limit_bytes gauge\n")
+			for _, t := range data.IngestThrottle {
+				fmt.Fprintf(w, "nbackup_server_ingest_limit_bytes{%s} %d\n", ingestScopeLabels(t), t.LimitBytes)
+			}
+
+			fmt.Fprintf(w, "# HELP nbackup_server_ingest_throttled_seconds_total Time data connections spent waiting for an ingest cap.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_ingest_throttled_seconds_total counter\n")
+			for _, t := range data.IngestThrottle {
+				fmt.Fprintf(w, "nbackup_server_ingest_throttled_seconds_total{%s} %g\n", ingestScopeLabels(t), t.ThrottledSeconds)
+			}
+		}
+
+		if len(data.DiskQueues) > 0 {
+			fmt.Fprintf(w, "# HELP nbackup_server_disk_queue_workers Configured concurrent disk writes per storage (write_workers).\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_disk_queue_workers gauge\n")
+			for _, q := range data.DiskQueues {
+				fmt.Fprintf(w, "nbackup_server_disk_queue_workers{storage=%q} %d\n", q.Storage, q.Workers)
+			}
+
+			fmt.Fprintf(w, "# HELP nbackup_server_disk_queue_in_flight Disk writes currently running per storage.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_disk_queue_in_flight gauge\n")
+			for _, q := range data.DiskQueues {
+				fmt.Fprintf(w, "nbackup_server_disk_queue_in_flight{storage=%q} %d\n", q.Storage, q.InFlight)
+			}
+
+			fmt.Fprintf(w, "# HELP nbackup_server_disk_queue_depth Disk writes waiting for a worker per storage.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_disk_queue_depth gauge\n")
+			for _, q := range data.DiskQueues {
+				fmt.Fprintf(w, "nbackup_server_disk_queue_depth{storage=%q} %d\n", q.Storage, q.Queued)
+			}
+
+			fmt.Fprintf(w, "# HELP nbackup_server_disk_queue_writes_total Disk writes completed through the storage queue.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_disk_queue_writes_total counter\n")
+			for _, q := range data.DiskQueues {
+				fmt.Fprintf(w, "nbackup_server_disk_queue_writes_total{storage=%q} %d\n", q.Storage, q.Writes)
+			}
+
+			fmt.Fprintf(w, "# HELP nbackup_server_disk_queue_bytes_total Bytes written through the storage queue.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_disk_queue_bytes_total counter\n")
+			for _, q := range data.DiskQueues {
+				fmt.Fprintf(w, "nbackup_server_disk_queue_bytes_total{storage=%q} %d\n", q.Storage, q.Bytes)
+			}
+
+			fmt.Fprintf(w, "# HELP nbackup_server_disk_queue_wait_seconds_total Time disk writes spent waiting for a worker.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_disk_queue_wait_seconds_total counter\n")
+			for _, q := range data.DiskQueues {
+				fmt.Fprintf(w, "nbackup_server_disk_queue_wait_seconds_total{storage=%q} %g\n", q.Storage, q.WaitSeconds)
+			}
+
+			fmt.Fprintf(w, "# HELP nbackup_server_disk_queue_sync_requests_total Fsyncs requested by sessions of the storage.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_disk_queue_sync_requests_total counter\n")
+			for _, q := range data.DiskQueues {
+				fmt.Fprintf(w, "nbackup_server_disk_queue_sync_requests_total{storage=%q} %d\n", q.Storage, q.Syncs)
+			}
+
+			fmt.Fprintf(w, "# HELP nbackup_server_disk_queue_syncfs_total Batched syncfs calls that served the fsync requests.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_disk_queue_syncfs_total counter\n")
+			for _, q := range data.DiskQueues {
+				fmt.Fprintf(w, "nbackup_server_disk_queue_syncfs_total{storage=%q} %d\n", q.Storage, q.SyncCalls)
+			}
+		}
+
+		if sweep := data.OrphanSweep; sweep != nil {
+			fmt.Fprintf(w, "# HELP nbackup_server_orphan_sweep_removed_total Orphan temporary files and chunk directories removed.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_orphan_sweep_removed_total counter\n")
+			fmt.Fprintf(w, "nbackup_server_orphan_sweep_removed_total %d\n", sweep.Removed)
+
+			fmt.Fprintf(w, "# HELP nbackup_server_orphan_sweep_reclaimed_bytes_total Disk space reclaimed by the orphan sweep.\n")
+			fmt.Fprintf(w, "# TYPE nbackup_server_orphan_sweep_reclaimed_bytes_total counter\n")
+			fmt.Fprintf(w, "nbackup_server_orphan_sweep_reclaimed_bytes_total %d\n", sweep.ReclaimedBytes)
+		}
+
 		// Sync storage metrics
 		syncStatus := metrics.SyncStatusSnapshot()
 		syncRunning := 0
@@ -274,14 +409,18 @@ func makePrometheusHandler(metrics HandlerMetrics) http.HandlerFunc {
 	}
 }
 
+// ingestScopeLabels monta os labels Prometheus de um teto de ingestão.
+func ingestScopeLabels(t IngestThrottleDTO) string {
+	if t.Storage == "" {
+		return `scope="global"`
+	}
+	return fmt.Sprintf(`scope="storage",storage=%q`, t.Storage)
+}
+
 // makeSessionsHandler retorna um handler que lista sessões ativas.
 func makeSessionsHandler(metrics HandlerMetrics) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		sessions := metrics.SessionsSnapshot()
-		if sessions == nil {
-			sessions = []SessionSummary{}
-		}
-		writeJSON(w, http.StatusOK, sessions)
+		writeJSONList(w, r, metrics.SessionsSnapshot())
 	}
 }
 
@@ -302,9 +441,20 @@ func makeSessionDetailHandler(metrics HandlerMetrics) http.HandlerFunc {
 	}
 }
 
+// ConfigProvider é implementado opcionalmente pelo HandlerMetrics para expor
+// a config corrente após reloads via SIGHUP.
+type ConfigProvider interface {
+	CurrentConfig() *config.ServerConfig
+}
+
 // makeConfigHandler retorna um handler com a config efetiva (sem segredos).
-func makeConfigHandler(cfg *config.ServerConfig) http.HandlerFunc {
+// Se metrics implementa ConfigProvider, a config corrente (pós-reload) é usada.
+func makeConfigHandler(initial *config.ServerConfig, metrics HandlerMetrics) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := initial
+		if cp, ok := metrics.(ConfigProvider); ok {
+			cfg = cp.CurrentConfig()
+		}
 		storages := make(map[string]StorageSafe, len(cfg.Storages))
 		for name, s := range cfg.Storages {
 			storages[name] = StorageSafe{
@@ -312,12 +462,14 @@ func makeConfigHandler(cfg *config.ServerConfig) http.HandlerFunc {
 				MaxBackups:      s.MaxBackups,
 				AssemblerMode:   s.AssemblerMode,
 				CompressionMode: s.CompressionMode,
+				IngestLimit:     s.IngestLimit,
 			}
 		}
 
 		resp := ConfigEffective{
 			ServerListen: cfg.Server.Listen,
 			WebUIListen:  cfg.WebUI.Listen,
+			Downloads:    cfg.WebUI.AllowDownloads,
 			Storages:     storages,
 			FlowRotation: FlowRotationSafe{
 				Enabled:    cfg.FlowRotation.Enabled,
@@ -325,7 +477,8 @@ func makeConfigHandler(cfg *config.ServerConfig) http.HandlerFunc {
 				EvalWindow: cfg.FlowRotation.EvalWindow.String(),
 				Cooldown:   cfg.FlowRotation.Cooldown.String(),
 			},
-			LogLevel: cfg.Logging.Level,
+			LogLevel:    cfg.Logging.Level,
+			IngestLimit: cfg.IngestLimit,
 		}
 		writeJSON(w, http.StatusOK, resp)
 	}
@@ -335,41 +488,156 @@ func makeConfigHandler(cfg *config.ServerConfig) http.HandlerFunc {
 func makeEventsHandler(store *EventStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		limit := parseInt(r.URL.Query().Get("limit"), 50)
-		events := store.Recent(limit)
-		writeJSON(w, http.StatusOK, events)
+		writeJSONList(w, r, store.Recent(limit))
 	}
 }
 
 // makeAgentsHandler retorna um handler que lista agentes conectados via control channel.
 func makeAgentsHandler(metrics HandlerMetrics) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		agents := metrics.ConnectedAgents()
-		if agents == nil {
-			agents = []AgentInfo{}
-		}
-		writeJSON(w, http.StatusOK, agents)
+		writeJSONList(w, r, metrics.ConnectedAgents())
 	}
 }
 
 // makeStoragesHandler retorna um handler que lista storages com uso de disco.
 func makeStoragesHandler(metrics HandlerMetrics) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		storages := metrics.StorageUsageSnapshot()
-		if storages == nil {
-			storages = []StorageUsage{}
-		}
-		writeJSON(w, http.StatusOK, storages)
+		writeJSONList(w, r, metrics.StorageUsageSnapshot())
 	}
 }
 
 // makeSessionHistoryHandler retorna um handler que lista sessões finalizadas.
+// ?limit=N retorna apenas as N mais recentes (default: todas as do ring).
 func makeSessionHistoryHandler(metrics HandlerMetrics) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		history := metrics.SessionHistorySnapshot()
-		if history == nil {
-			history = []SessionHistoryEntry{}
+		if limit := parseInt(r.URL.Query().Get("limit"), 0); limit > 0 && limit < len(history) {
+			history = history[len(history)-limit:]
+		}
+		writeJSONList(w, r, history)
+	}
+}
+
+// SessionHistoryQuerier é implementado opcionalmente pelo HandlerMetrics para
+// consultar o histórico persistido (session_history_file), além do ring em memória.
+type SessionHistoryQuerier interface {
+	QuerySessionHistory(f SessionHistoryFilter) ([]SessionHistoryEntry, error)
+}
+
+// makeHistoryQueryHandler consulta o histórico persistido, com filtros
+// ?agent=, ?storage=, ?backup=, ?result=, ?since= (RFC3339 ou duração, ex:
+// 168h) e ?limit= (as N sessões mais recentes).
+func makeHistoryQueryHandler(q SessionHistoryQuerier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, ok := parseHistoryFilter(w, r)
+		if !ok {
+			return
+		}
+
+		entries, err := q.QuerySessionHistory(f)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSONList(w, r, entries)
+	}
+}
+
+// parseHistoryFilter lê os filtros de histórico da query string. Em caso de
+// erro, responde 400 e retorna false.
+func parseHistoryFilter(w http.ResponseWriter, r *http.Request) (SessionHistoryFilter, bool) {
+	query := r.URL.Query()
+	f := SessionHistoryFilter{
+		Agent:   query.Get("agent"),
+		Storage: query.Get("storage"),
+		Backup:  query.Get("backup"),
+		Result:  query.Get("result"),
+		Limit:   parseInt(query.Get("limit"), 0),
+	}
+	if since := query.Get("since"); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			f.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			f.Since = t
+		} else {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid since: use RFC3339 or a duration"})
+			return f, false
+		}
+	}
+	return f, true
+}
+
+// AccountingReporter é implementado opcionalmente pelo HandlerMetrics para
+// o relatório de ingestão por agent/storage (accounting).
+type AccountingReporter interface {
+	AccountingReport(f AccountingFilter) (*AccountingReport, error)
+}
+
+// makeIngestReportHandler monta o relatório de ingestão, com ?days= (default
+// 30, máximo 3660), ?agent=, ?storage= e ?top=.
+func makeIngestReportHandler(rp AccountingReporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		f := AccountingFilter{
+			Days:    parseInt(query.Get("days"), 30),
+			Agent:   query.Get("agent"),
+			Storage: query.Get("storage"),
+			Top:     parseInt(query.Get("top"), 0),
+		}
+		if f.Days < 1 || f.Days > 3660 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid days: use 1 to 3660"})
+			return
+		}
+		rep, err := rp.AccountingReport(f)
+		switch {
+		case errors.Is(err, ErrAccountingDisabled):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		default:
+			writeJSON(w, http.StatusOK, rep)
+		}
+	}
+}
+
+// AuditQuerier é implementado opcionalmente pelo HandlerMetrics para
+// consultar o audit log de sessões (audit_log).
+type AuditQuerier interface {
+	QueryAuditSessions(f SessionHistoryFilter) ([]AuditIndexEntry, error)
+	AuditSession(sessionID string) ([]AuditRecord, error)
+}
+
+// makeAuditSessionsHandler consulta o índice do audit log, com os mesmos
+// filtros de /api/v1/history. Sem audit_log habilitado, retorna lista vazia.
+func makeAuditSessionsHandler(q AuditQuerier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, ok := parseHistoryFilter(w, r)
+		if !ok {
+			return
+		}
+		entries, err := q.QueryAuditSessions(f)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSONList(w, r, entries)
+	}
+}
+
+// makeAuditSessionHandler retorna o ciclo de vida de uma sessão no audit log.
+func makeAuditSessionHandler(q AuditQuerier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		records, err := q.AuditSession(r.PathValue("id"))
+		switch {
+		case errors.Is(err, ErrAuditDisabled):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		case errors.Is(err, os.ErrNotExist):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "session not found in audit log"})
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		default:
+			writeJSON(w, http.StatusOK, records)
 		}
-		writeJSON(w, http.StatusOK, history)
 	}
 }
 
@@ -378,11 +646,7 @@ func makeActiveSessionHistoryHandler(metrics HandlerMetrics) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		limit := parseInt(r.URL.Query().Get("limit"), 120)
 		sessionID := r.URL.Query().Get("session_id")
-		history := metrics.ActiveSessionHistorySnapshot(sessionID, limit)
-		if history == nil {
-			history = []ActiveSessionSnapshotEntry{}
-		}
-		writeJSON(w, http.StatusOK, history)
+		writeJSONList(w, r, metrics.ActiveSessionHistorySnapshot(sessionID, limit))
 	}
 }
 
@@ -424,6 +688,6 @@ func makeBucketUploadHistoryHandler(metrics HandlerMetrics) http.HandlerFunc {
 		if limit > 0 && limit < len(entries) {
 			entries = entries[len(entries)-limit:]
 		}
-		writeJSON(w, http.StatusOK, entries)
+		writeJSONList(w, r, entries)
 	}
 }
@@ -6,6 +6,7 @@ package observability
 
 import (
 	"encoding/json"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -23,6 +24,7 @@ type mockMetrics struct {
 	details     map[string]*SessionDetail
 	agents      []AgentInfo
 	storages    []StorageUsage
+	history     []SessionHistoryEntry
 	bufferStats *ChunkBufferDTO
 	syncStatus  SyncStatusDTO
 }
@@ -38,7 +40,7 @@ func (m *mockMetrics) SessionDetail(id string) (*SessionDetail, bool) {
 }
 func (m *mockMetrics) ConnectedAgents() []AgentInfo                  { return m.agents }
 func (m *mockMetrics) StorageUsageSnapshot() []StorageUsage          { return m.storages }
-func (m *mockMetrics) SessionHistorySnapshot() []SessionHistoryEntry { return nil }
+func (m *mockMetrics) SessionHistorySnapshot() []SessionHistoryEntry { return m.history }
 func (m *mockMetrics) ActiveSessionHistorySnapshot(sessionID string, limit int) []ActiveSessionSnapshotEntry {
 	return nil
 }
@@ -666,3 +668,85 @@ func TestSyncStatus_WithLastResult(t *testing.T) {
 		t.Errorf("expected bucket 'my-bucket', got %q", resp.LastResult.Buckets[0].BucketName)
 	}
 }
+
+func historyMock(n int) *mockMetrics {
+	mock := newMockMetrics()
+	for i := 0; i < n; i++ {
+		mock.history = append(mock.history, SessionHistoryEntry{SessionID: fmt.Sprintf("s%04d", i), Agent: "web-01", Result: "ok"})
+	}
+	return mock
+}
+
+func TestSessionHistory_StreamsArray(t *testing.T) {
+	router := NewRouter(historyMock(1000), testCfg(), localhostACL(t), nil)
+
+	req := httptest.NewRequest("GET", "/api/v1/sessions/history", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || !rec.Flushed {
+		t.Fatalf("expected flushed 200, got %d (flushed=%v)", rec.Code, rec.Flushed)
+	}
+	var resp []SessionHistoryEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp) != 1000 || resp[999].SessionID != "s0999" {
+		t.Fatalf("expected 1000 entries in order, got %d", len(resp))
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/sessions/history?limit=10", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	resp = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp) != 10 || resp[0].SessionID != "s0990" {
+		t.Errorf("expected the 10 most recent entries, got %d starting at %q", len(resp), resp[0].SessionID)
+	}
+}
+
+func TestSessionHistory_EmptyIsArray(t *testing.T) {
+	router := NewRouter(newMockMetrics(), testCfg(), localhostACL(t), nil)
+
+	req := httptest.NewRequest("GET", "/api/v1/sessions/history", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if got := strings.TrimSpace(rec.Body.String()); got != "[]" {
+		t.Errorf("expected empty array, got %q", got)
+	}
+}
+
+func TestSessionHistory_NDJSON(t *testing.T) {
+	router := NewRouter(historyMock(150), testCfg(), localhostACL(t), nil)
+
+	for name, setup := range map[string]func(*http.Request){
+		"query":  func(r *http.Request) { r.URL.RawQuery = "format=ndjson" },
+		"accept": func(r *http.Request) { r.Header.Set("Accept", "application/x-ndjson") },
+	} {
+		req := httptest.NewRequest("GET", "/api/v1/sessions/history", nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		setup(req)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/x-ndjson") {
+			t.Errorf("%s: unexpected Content-Type %q", name, ct)
+		}
+		lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+		if len(lines) != 150 {
+			t.Fatalf("%s: expected 150 lines, got %d", name, len(lines))
+		}
+		for i, line := range lines {
+			var e SessionHistoryEntry
+			if err := json.Unmarshal([]byte(line), &e); err != nil || e.SessionID != fmt.Sprintf("s%04d", i) {
+				t.Fatalf("%s: line %d: %q (%v)", name, i, line, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// login.go implementa o login da WebUI (web_ui.users): sessões em memória
+// identificadas por cookie, o limite de tentativas por IP e as rotas
+// /api/v1/auth/*. As sessões não sobrevivem a um restart do server.
+
+package observability
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/auth"
+)
+
+// sessionCookieName é o cookie que carrega a sessão da WebUI.
+const sessionCookieName = "nbackup_session"
+
+// Tentativas de login falhas aceitas por IP dentro da janela; além disso o
+// login responde 429 até a janela expirar.
+const (
+	loginMaxFailures   = 5
+	loginFailureWindow = 5 * time.Minute
+)
+
+// dummyPasswordHash é verificado quando o usuário não existe, para que o tempo
+// de resposta não revele quais usuários estão configurados.
+var dummyPasswordHash = passwordHash{iterations: passwordHashIterations, salt: make([]byte, 16), key: make([]byte, sha256.Size)}
+
+// loginSession é uma sessão de um usuário logado.
+type loginSession struct {
+	user    string
+	role    string
+	expires time.Time
+}
+
+// loginSessions guarda as sessões ativas (pelo digest do cookie) e as
+// tentativas de login falhas por IP.
+type loginSessions struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sessions map[[sha256.Size]byte]loginSession
+	failures map[string][]time.Time
+}
+
+func newLoginSessions(ttl time.Duration) *loginSessions {
+	if ttl <= 0 {
+		ttl = 12 * time.Hour
+	}
+	return &loginSessions{
+		ttl:      ttl,
+		sessions: make(map[[sha256.Size]byte]loginSession),
+		failures: make(map[string][]time.Time),
+	}
+}
+
+// create abre uma sessão e retorna o valor do cookie.
+func (s *loginSessions) create(user, role string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("generating session id: %w", err)
+	}
+	value := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, sess := range s.sessions {
+		if now.After(sess.expires) {
+			delete(s.sessions, k)
+		}
+	}
+	s.sessions[sha256.Sum256([]byte(value))] = loginSession{user: user, role: role, expires: now.Add(s.ttl)}
+	return value, nil
+}
+
+// fromRequest retorna o usuário da sessão do cookie (nil sem sessão válida).
+func (s *loginSessions) fromRequest(r *http.Request) *auth.Identity {
+	c, err := r.Cookie(sessionCookieName)
+	if err != nil || c.Value == "" {
+		return nil
+	}
+	key := sha256.Sum256([]byte(c.Value))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(sess.expires) {
+		delete(s.sessions, key)
+		return nil
+	}
+	return userIdentity(sess.user, sess.role)
+}
+
+// remove encerra a sessão do cookie do request, se houver.
+func (s *loginSessions) remove(r *http.Request) {
+	if c, err := r.Cookie(sessionCookieName); err == nil {
+		s.mu.Lock()
+		delete(s.sessions, sha256.Sum256([]byte(c.Value)))
+		s.mu.Unlock()
+	}
+}
+
+// blocked indica se o IP excedeu as tentativas falhas na janela.
+func (s *loginSessions) blocked(ip string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.recentFailuresLocked(ip)) >= loginMaxFailures
+}
+
+// fail registra uma tentativa falha do IP.
+func (s *loginSessions) fail(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[ip] = append(s.recentFailuresLocked(ip), time.Now())
+}
+
+// reset limpa as tentativas falhas do IP após um login bem-sucedido.
+func (s *loginSessions) reset(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, ip)
+}
+
+// recentFailuresLocked descarta as falhas fora da janela e retorna as restantes.
+func (s *loginSessions) recentFailuresLocked(ip string) []time.Time {
+	cutoff := time.Now().Add(-loginFailureWindow)
+	recent := s.failures[ip][:0]
+	for _, t := range s.failures[ip] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) == 0 {
+		delete(s.failures, ip)
+		return nil
+	}
+	s.failures[ip] = recent
+	return recent
+}
+
+// loginRequest é o corpo de POST /api/v1/auth/login.
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// registerAuthRoutes registra as rotas de login da WebUI.
+func registerAuthRoutes(mux *http.ServeMux, a *Auth) {
+	mux.HandleFunc("GET /api/v1/auth/me", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, a.info(principalFrom(r.Context())))
+	})
+	mux.HandleFunc("POST /api/v1/auth/login", a.handleLogin)
+	mux.HandleFunc("POST /api/v1/auth/logout", func(w http.ResponseWriter, r *http.Request) {
+		a.logins.remove(r)
+		http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+		writeJSON(w, http.StatusOK, a.info(nil))
+	})
+}
+
+// handleLogin valida usuário e senha e abre a sessão. Logins e falhas geram
+// eventos (webui_login, webui_login_failed) com o IP de origem.
+func (a *Auth) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if len(a.users) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "login disabled: configure web_ui.users"})
+		return
+	}
+	var req loginRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil || req.Username == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected JSON body with username and password"})
+		return
+	}
+
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if a.logins.blocked(ip) {
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many failed login attempts, try again later"})
+		return
+	}
+
+	user, ok := a.users[req.Username]
+	hash := user.hash
+	if !ok {
+		hash = dummyPasswordHash
+	}
+	if !hash.verify(req.Password) || !ok {
+		a.logins.fail(ip)
+		a.audit("warn", "webui_login_failed", fmt.Sprintf("failed login for user %s from %s", req.Username, ip))
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid username or password"})
+		return
+	}
+
+	value, err := a.logins.create(req.Username, user.role)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	a.logins.reset(ip)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(a.logins.ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	a.audit("info", "webui_login", fmt.Sprintf("user %s (%s) logged in from %s", req.Username, user.role, ip))
+	writeJSON(w, http.StatusOK, a.info(userIdentity(req.Username, user.role)))
+}
+
+// userIdentity é a identidade de um usuário logado na WebUI.
+func userIdentity(name, role string) *auth.Identity {
+	return &auth.Identity{Method: auth.MethodUser, Name: name, Credential: "session", Role: role}
+}
+
+// info descreve a autenticação do request para a SPA.
+func (a *Auth) info(p *auth.Identity) AuthInfo {
+	info := AuthInfo{LoginEnabled: len(a.users) > 0, AuthRequired: a.requireForRead}
+	if p != nil {
+		info.Authenticated = true
+		info.Kind, info.Name, info.Role = string(p.Method), p.Name, p.Role
+		info.CanManage = canManage(p)
+	}
+	return info
+}
+
+// audit registra um evento de autenticação, se houver EventStore.
+func (a *Auth) audit(level, typ, msg string) {
+	if a.store != nil {
+		a.store.PushEvent(level, typ, "", msg, 0)
+	}
+}
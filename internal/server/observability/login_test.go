@@ -0,0 +1,174 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package observability
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// loginRouter cria um router com um usuário viewer e um operator (senha "secret-pass").
+func loginRouter(t *testing.T) (http.Handler, *mockManager, *EventStore) {
+	t.Helper()
+	hash, err := HashPassword("secret-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testCfg()
+	cfg.WebUI.Users = []config.WebUIUserConfig{
+		{Name: "bob", PasswordHash: hash, Role: config.WebUIRoleViewer},
+		{Name: "alice", PasswordHash: hash, Role: config.WebUIRoleOperator},
+	}
+	mgr := &mockManager{mockMetrics: newMockMetrics()}
+	store, err := NewEventStore(filepath.Join(t.TempDir(), "events.jsonl"), 100, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRouter(mgr, cfg, localhostACL(t), store), mgr, store
+}
+
+// login autentica e retorna o cookie de sessão (nil se o login falhar).
+func login(t *testing.T, router http.Handler, user, password string) (*http.Cookie, int) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/v1/auth/login", strings.NewReader(`{"username":"`+user+`","password":"`+password+`"}`))
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			return c, rec.Code
+		}
+	}
+	return nil, rec.Code
+}
+
+// doCookieRequest envia um request autenticado pela sessão; csrf inclui o
+// header X-Requested-With.
+func doCookieRequest(router http.Handler, method, path string, cookie *http.Cookie, csrf bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	req.AddCookie(cookie)
+	if csrf {
+		req.Header.Set("X-Requested-With", "nbackup-webui")
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLogin_RequiredWithUsers(t *testing.T) {
+	router, _, _ := loginRouter(t)
+
+	if rec := doRequest(router, "GET", "/api/v1/sessions", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without login, got %d", rec.Code)
+	}
+	if rec := doRequest(router, "GET", "/", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected SPA assets to stay public, got %d", rec.Code)
+	}
+
+	rec := doRequest(router, "GET", "/api/v1/auth/me", "")
+	var info AuthInfo
+	json.Unmarshal(rec.Body.Bytes(), &info)
+	if rec.Code != http.StatusOK || !info.LoginEnabled || !info.AuthRequired || info.Authenticated {
+		t.Errorf("unexpected anonymous auth info (%d): %+v", rec.Code, info)
+	}
+
+	cookie, code := login(t, router, "bob", "secret-pass")
+	if cookie == nil || code != http.StatusOK {
+		t.Fatalf("login failed with %d", code)
+	}
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+		t.Errorf("expected HttpOnly SameSite=Strict cookie, got %+v", cookie)
+	}
+	if rec := doCookieRequest(router, "GET", "/api/v1/sessions", cookie, false); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 after login, got %d", rec.Code)
+	}
+
+	if rec := doCookieRequest(router, "POST", "/api/v1/auth/logout", cookie, true); rec.Code != http.StatusOK {
+		t.Fatalf("logout: %d", rec.Code)
+	}
+	if rec := doCookieRequest(router, "GET", "/api/v1/sessions", cookie, false); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 after logout, got %d", rec.Code)
+	}
+}
+
+func TestLogin_Roles(t *testing.T) {
+	router, mgr, store := loginRouter(t)
+	viewer, _ := login(t, router, "bob", "secret-pass")
+	operator, _ := login(t, router, "alice", "secret-pass")
+
+	if rec := doCookieRequest(router, "POST", "/api/v1/sessions/s1/cancel", viewer, true); rec.Code != http.StatusForbidden {
+		t.Errorf("viewer cancel: expected 403, got %d", rec.Code)
+	}
+	if rec := doCookieRequest(router, "POST", "/api/v1/sessions/s1/cancel", operator, false); rec.Code != http.StatusForbidden {
+		t.Errorf("cancel without X-Requested-With: expected 403, got %d", rec.Code)
+	}
+	if rec := doCookieRequest(router, "POST", "/api/v1/sessions/s1/cancel", operator, true); rec.Code != http.StatusOK {
+		t.Errorf("operator cancel: expected 200, got %d (%s)", rec.Code, rec.Body.String())
+	}
+	if len(mgr.cancelled) != 1 {
+		t.Errorf("expected one cancel to reach the manager, got %v", mgr.cancelled)
+	}
+
+	var audited bool
+	for _, e := range store.Recent(10) {
+		audited = audited || (e.Type == "api_action" && strings.Contains(e.Message, "by user alice"))
+	}
+	if !audited {
+		t.Error("expected api_action event naming the operator")
+	}
+
+	rec := doCookieRequest(router, "GET", "/api/v1/auth/me", operator, false)
+	var info AuthInfo
+	json.Unmarshal(rec.Body.Bytes(), &info)
+	if !info.Authenticated || info.Name != "alice" || !info.CanManage {
+		t.Errorf("unexpected operator auth info: %+v", info)
+	}
+}
+
+func TestLogin_FailuresThrottled(t *testing.T) {
+	router, _, store := loginRouter(t)
+
+	if _, code := login(t, router, "nobody", "secret-pass"); code != http.StatusUnauthorized {
+		t.Errorf("unknown user: expected 401, got %d", code)
+	}
+	for i := 1; i < loginMaxFailures; i++ {
+		if _, code := login(t, router, "bob", "wrong"); code != http.StatusUnauthorized {
+			t.Errorf("attempt %d: expected 401, got %d", i, code)
+		}
+	}
+	if _, code := login(t, router, "bob", "secret-pass"); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 after %d failures, got %d", loginMaxFailures, code)
+	}
+
+	var failed int
+	for _, e := range store.Recent(20) {
+		if e.Type == "webui_login_failed" {
+			failed++
+		}
+	}
+	if failed != loginMaxFailures {
+		t.Errorf("expected %d webui_login_failed events, got %d", loginMaxFailures, failed)
+	}
+}
+
+func TestLogin_DisabledWithoutUsers(t *testing.T) {
+	router, _ := managedRouter(t, false)
+	if _, code := login(t, router, "bob", "secret-pass"); code != http.StatusNotFound {
+		t.Errorf("expected 404 without web_ui.users, got %d", code)
+	}
+	// Token admin segue funcionando ao lado do login
+	var info AuthInfo
+	json.Unmarshal(doRequest(router, "GET", "/api/v1/auth/me", testAdminToken).Body.Bytes(), &info)
+	if info.Kind != "token" || !info.CanManage {
+		t.Errorf("expected admin token to be reported as manager: %+v", info)
+	}
+}
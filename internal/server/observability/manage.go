@@ -0,0 +1,190 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package observability
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Erros das ações de gerenciamento, mapeados para o status HTTP da resposta.
+var (
+	ErrNotFound = errors.New("not found")       // 404
+	ErrConflict = errors.New("conflict")        // 409: estado não permite a ação
+	ErrInvalid  = errors.New("invalid request") // 400
+)
+
+// BackupManager é implementado opcionalmente pelo HandlerMetrics para expor o
+// catálogo de backups e as ações de gerenciamento da API REST.
+type BackupManager interface {
+	// BackupCatalog lista os backups armazenados em todos os storages.
+	BackupCatalog() []CatalogEntry
+
+	// CancelSession interrompe uma sessão em recepção, descarta os dados
+	// parciais e avisa o agent com reason (vazio = cancelled).
+	CancelSession(id, reason string) error
+
+	// ExpireSession aplica imediatamente a expiração por TTL à sessão.
+	ExpireSession(id string) error
+
+	// RotateBackups aplica max_backups ao backup e retorna os arquivos removidos.
+	RotateBackups(storage, agent, backup string) ([]string, error)
+
+	// QuarantineBackup tira o arquivo da rotação e do sync, retornando o novo caminho.
+	QuarantineBackup(storage, agent, backup, file string) (string, error)
+
+	// OpenBackup abre um backup armazenado (ou em quarentena) para download.
+	OpenBackup(storage, agent, backup, file string, quarantined bool) (*os.File, error)
+}
+
+// registerManagementRoutes registra o catálogo (leitura), o download de
+// backups (web_ui.allow_downloads) e as ações de gerenciamento (token admin
+// ou usuário operator).
+// Cada ação executada e cada download geram um evento, para auditoria.
+func registerManagementRoutes(mux *http.ServeMux, mgr BackupManager, auth *Auth, store *EventStore, downloads bool) {
+	mux.HandleFunc("GET /api/v1/catalog", makeCatalogHandler(mgr))
+	mux.HandleFunc("GET /api/v1/catalog/{storage}/{agent}/{backup}/{file}/download", makeDownloadHandler(mgr, store, downloads))
+
+	audit := func(agent, actor, msg string) {
+		if store != nil {
+			store.PushEvent("info", "api_action", agent, fmt.Sprintf("%s (by %s)", msg, actor), 0)
+		}
+	}
+
+	mux.HandleFunc("POST /api/v1/sessions/{id}/cancel", auth.requireManage(func(w http.ResponseWriter, r *http.Request, actor string) {
+		id := r.PathValue("id")
+		if err := mgr.CancelSession(id, r.URL.Query().Get("reason")); err != nil {
+			writeActionError(w, err)
+			return
+		}
+		audit("", actor, "session "+id+" cancelled")
+		writeJSON(w, http.StatusOK, ActionResponse{Action: "cancel", Target: id})
+	}))
+
+	mux.HandleFunc("POST /api/v1/sessions/{id}/expire", auth.requireManage(func(w http.ResponseWriter, r *http.Request, actor string) {
+		id := r.PathValue("id")
+		if err := mgr.ExpireSession(id); err != nil {
+			writeActionError(w, err)
+			return
+		}
+		audit("", actor, "session "+id+" expired")
+		writeJSON(w, http.StatusOK, ActionResponse{Action: "expire", Target: id})
+	}))
+
+	mux.HandleFunc("POST /api/v1/catalog/{storage}/{agent}/{backup}/rotate", auth.requireManage(func(w http.ResponseWriter, r *http.Request, actor string) {
+		storage, agent, backup := r.PathValue("storage"), r.PathValue("agent"), r.PathValue("backup")
+		removed, err := mgr.RotateBackups(storage, agent, backup)
+		if err != nil {
+			writeActionError(w, err)
+			return
+		}
+		target := storage + "/" + agent + "/" + backup
+		audit(agent, actor, fmt.Sprintf("rotation triggered for %s (%d removed)", target, len(removed)))
+		writeJSON(w, http.StatusOK, ActionResponse{Action: "rotate", Target: target, Removed: removed})
+	}))
+
+	mux.HandleFunc("POST /api/v1/catalog/{storage}/{agent}/{backup}/{file}/quarantine", auth.requireManage(func(w http.ResponseWriter, r *http.Request, actor string) {
+		storage, agent, backup, file := r.PathValue("storage"), r.PathValue("agent"), r.PathValue("backup"), r.PathValue("file")
+		path, err := mgr.QuarantineBackup(storage, agent, backup, file)
+		if err != nil {
+			writeActionError(w, err)
+			return
+		}
+		target := storage + "/" + agent + "/" + backup + "/" + file
+		audit(agent, actor, "backup "+target+" quarantined")
+		writeJSON(w, http.StatusOK, ActionResponse{Action: "quarantine", Target: target, Path: path})
+	}))
+}
+
+// makeCatalogHandler lista o catálogo, com filtros opcionais ?storage=,
+// ?agent= e ?backup=.
+func makeCatalogHandler(mgr BackupManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		storage, agent, backup := q.Get("storage"), q.Get("agent"), q.Get("backup")
+
+		var filtered []CatalogEntry
+		for _, e := range mgr.BackupCatalog() {
+			if (storage == "" || e.Storage == storage) &&
+				(agent == "" || e.Agent == agent) &&
+				(backup == "" || e.Backup == backup) {
+				filtered = append(filtered, e)
+			}
+		}
+		writeJSONList(w, r, filtered)
+	}
+}
+
+// makeDownloadHandler serve um backup do catálogo (?quarantined=true para os
+// que estão em quarentena), com suporte a Range para retomar downloads. Cada
+// request gera um evento backup_downloaded com o autor (ou "anonymous") e o IP.
+func makeDownloadHandler(mgr BackupManager, store *EventStore, enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !enabled {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "downloads disabled: set web_ui.allow_downloads"})
+			return
+		}
+		storage, agent, backup, file := r.PathValue("storage"), r.PathValue("agent"), r.PathValue("backup"), r.PathValue("file")
+		quarantined, _ := strconv.ParseBool(r.URL.Query().Get("quarantined"))
+
+		f, err := mgr.OpenBackup(storage, agent, backup, file, quarantined)
+		if err != nil {
+			writeActionError(w, err)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			writeActionError(w, err)
+			return
+		}
+
+		if store != nil {
+			actor := "anonymous"
+			if p := principalFrom(r.Context()); p != nil {
+				actor = p.String()
+			}
+			ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+			msg := fmt.Sprintf("%s/%s/%s downloaded by %s from %s", storage, backup, file, actor, ip)
+			if rng := r.Header.Get("Range"); rng != "" {
+				msg += " (" + rng + ")"
+			}
+			store.Push(EventEntry{
+				Level:   "info",
+				Type:    "backup_downloaded",
+				Agent:   agent,
+				Storage: storage,
+				Backup:  backup,
+				Message: msg,
+			})
+		}
+
+		// O nome servido é o do arquivo aberto: manifests dedup são entregues
+		// como o archive reconstruído (sem o sufixo .dedup).
+		name := filepath.Base(f.Name())
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, name, info.ModTime(), f)
+	}
+}
+
+// writeActionError traduz o erro de uma ação para o status HTTP.
+func writeActionError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, ErrInvalid):
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
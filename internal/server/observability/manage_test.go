@@ -0,0 +1,275 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package observability
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+const (
+	testViewerToken = "viewer-token-0123456789"
+	testAdminToken  = "admin-token-0123456789"
+)
+
+// mockManager adiciona BackupManager ao mockMetrics.
+type mockManager struct {
+	*mockMetrics
+	catalog   []CatalogEntry
+	cancelled []string
+	reasons   []string
+	cancelErr error
+
+	backupPath string // arquivo servido por OpenBackup
+	history    SessionHistoryFilter
+}
+
+func (m *mockManager) BackupCatalog() []CatalogEntry { return m.catalog }
+func (m *mockManager) CancelSession(id, reason string) error {
+	if m.cancelErr != nil {
+		return m.cancelErr
+	}
+	m.cancelled = append(m.cancelled, id)
+	m.reasons = append(m.reasons, reason)
+	return nil
+}
+func (m *mockManager) ExpireSession(id string) error { return nil }
+func (m *mockManager) RotateBackups(storage, agent, backup string) ([]string, error) {
+	return []string{"old.tar.gz"}, nil
+}
+func (m *mockManager) QuarantineBackup(storage, agent, backup, file string) (string, error) {
+	return filepath.Join("/tmp", agent, backup, ".quarantine", file), nil
+}
+
+func (m *mockManager) OpenBackup(storage, agent, backup, file string, quarantined bool) (*os.File, error) {
+	if m.backupPath == "" {
+		return nil, fmt.Errorf("backup %s: %w", file, ErrNotFound)
+	}
+	return os.Open(m.backupPath)
+}
+func (m *mockManager) QuerySessionHistory(f SessionHistoryFilter) ([]SessionHistoryEntry, error) {
+	m.history = f
+	return []SessionHistoryEntry{{SessionID: "s1", Agent: f.Agent, Result: "ok"}}, nil
+}
+
+func managedRouter(t *testing.T, requireForRead bool) (http.Handler, *mockManager) {
+	t.Helper()
+	cfg := testCfg()
+	cfg.WebUI.APITokens = []config.APITokenConfig{
+		{Name: "grafana", Token: testViewerToken, Role: config.APIRoleViewer},
+		{Name: "ops", Token: testAdminToken, Role: config.APIRoleAdmin},
+	}
+	cfg.WebUI.APIRequireToken = requireForRead
+	mgr := &mockManager{mockMetrics: newMockMetrics()}
+	return NewRouter(mgr, cfg, localhostACL(t), nil), mgr
+}
+
+func doRequest(router http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTokenAuth_Roles(t *testing.T) {
+	router, mgr := managedRouter(t, false)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"anonymous read", "GET", "/api/v1/sessions", "", http.StatusOK},
+		{"viewer read", "GET", "/api/v1/catalog", testViewerToken, http.StatusOK},
+		{"invalid token", "GET", "/api/v1/sessions", "wrong-token-0123456789", http.StatusUnauthorized},
+		{"anonymous action", "POST", "/api/v1/sessions/s1/cancel", "", http.StatusUnauthorized},
+		{"viewer action", "POST", "/api/v1/sessions/s1/cancel", testViewerToken, http.StatusForbidden},
+		{"admin action", "POST", "/api/v1/sessions/s1/cancel", testAdminToken, http.StatusOK},
+	}
+	for _, tc := range cases {
+		if rec := doRequest(router, tc.method, tc.path, tc.token); rec.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d (%s)", tc.name, tc.want, rec.Code, rec.Body.String())
+		}
+	}
+	if len(mgr.cancelled) != 1 || mgr.cancelled[0] != "s1" {
+		t.Errorf("expected only the admin cancel to reach the manager, got %v", mgr.cancelled)
+	}
+}
+
+func TestTokenAuth_RequireForRead(t *testing.T) {
+	router, _ := managedRouter(t, true)
+
+	rec := doRequest(router, "GET", "/api/v1/sessions", "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+	if rec.Header().Get("WWW-Authenticate") == "" {
+		t.Error("expected WWW-Authenticate challenge")
+	}
+	if rec := doRequest(router, "GET", "/metrics", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected /metrics to require token, got %d", rec.Code)
+	}
+	if rec := doRequest(router, "GET", "/api/v1/health", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected health to stay open, got %d", rec.Code)
+	}
+	if rec := doRequest(router, "GET", "/api/v1/sessions", testViewerToken); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 with viewer token, got %d", rec.Code)
+	}
+}
+
+func TestManagement_DisabledWithoutTokens(t *testing.T) {
+	mgr := &mockManager{mockMetrics: newMockMetrics()}
+	router := NewRouter(mgr, testCfg(), localhostACL(t), nil)
+
+	rec := doRequest(router, "POST", "/api/v1/sessions/s1/expire", "")
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without api_tokens, got %d", rec.Code)
+	}
+}
+
+func TestManagement_ActionErrors(t *testing.T) {
+	router, mgr := managedRouter(t, false)
+
+	for err, want := range map[error]int{
+		fmt.Errorf("session s1: %w", ErrNotFound):              http.StatusNotFound,
+		fmt.Errorf("session s1 is verifying: %w", ErrConflict): http.StatusConflict,
+		fmt.Errorf("bad: %w", ErrInvalid):                      http.StatusBadRequest,
+		fmt.Errorf("disk on fire"):                             http.StatusInternalServerError,
+	} {
+		mgr.cancelErr = err
+		if rec := doRequest(router, "POST", "/api/v1/sessions/s1/cancel", testAdminToken); rec.Code != want {
+			t.Errorf("%v: expected %d, got %d", err, want, rec.Code)
+		}
+	}
+}
+
+func TestManagement_CancelReason(t *testing.T) {
+	router, mgr := managedRouter(t, false)
+
+	if rec := doRequest(router, "POST", "/api/v1/sessions/s1/cancel?reason=maintenance", testAdminToken); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if len(mgr.reasons) != 1 || mgr.reasons[0] != "maintenance" {
+		t.Errorf("expected reason forwarded to the manager, got %v", mgr.reasons)
+	}
+}
+
+func TestManagement_RotateAndQuarantine(t *testing.T) {
+	router, _ := managedRouter(t, false)
+
+	rec := doRequest(router, "POST", "/api/v1/catalog/default/web-01/daily/rotate", testAdminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rotate: expected 200, got %d", rec.Code)
+	}
+	var resp ActionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if resp.Target != "default/web-01/daily" || len(resp.Removed) != 1 {
+		t.Errorf("unexpected rotate response: %+v", resp)
+	}
+
+	rec = doRequest(router, "POST", "/api/v1/catalog/default/web-01/daily/2025-01-01T00-00-00-000.tar.gz/quarantine", testAdminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("quarantine: expected 200, got %d", rec.Code)
+	}
+	resp = ActionResponse{}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Action != "quarantine" || resp.Path == "" {
+		t.Errorf("unexpected quarantine response: %+v", resp)
+	}
+}
+
+func TestCatalog_Filters(t *testing.T) {
+	router, mgr := managedRouter(t, false)
+	mgr.catalog = []CatalogEntry{
+		{Storage: "default", Agent: "web-01", Backup: "daily", File: "a.tar.gz"},
+		{Storage: "default", Agent: "db-01", Backup: "daily", File: "b.tar.gz"},
+		{Storage: "archive", Agent: "web-01", Backup: "weekly", File: "c.tar.zst", Quarantined: true},
+	}
+
+	rec := doRequest(router, "GET", "/api/v1/catalog?agent=web-01&storage=default", testViewerToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var entries []CatalogEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(entries) != 1 || entries[0].File != "a.tar.gz" {
+		t.Errorf("unexpected filtered catalog: %+v", entries)
+	}
+}
+
+func TestDownload_DisabledByDefault(t *testing.T) {
+	router, mgr := managedRouter(t, false)
+	mgr.backupPath = filepath.Join(t.TempDir(), "a.tar.gz")
+	os.WriteFile(mgr.backupPath, []byte("archive"), 0644)
+
+	rec := doRequest(router, "GET", "/api/v1/catalog/default/web-01/daily/a.tar.gz/download", testViewerToken)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without allow_downloads, got %d", rec.Code)
+	}
+}
+
+func TestDownload_ServesAndAudits(t *testing.T) {
+	cfg := testCfg()
+	cfg.WebUI.AllowDownloads = true
+	cfg.WebUI.APITokens = []config.APITokenConfig{{Name: "grafana", Token: testViewerToken, Role: config.APIRoleViewer}}
+	mgr := &mockManager{mockMetrics: newMockMetrics(), backupPath: filepath.Join(t.TempDir(), "a.tar.gz")}
+	os.WriteFile(mgr.backupPath, []byte("archive-bytes"), 0644)
+	store, err := NewEventStore(filepath.Join(t.TempDir(), "events.jsonl"), 10, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	router := NewRouter(mgr, cfg, localhostACL(t), store)
+
+	rec := doRequest(router, "GET", "/api/v1/catalog/default/web-01/daily/a.tar.gz/download", testViewerToken)
+	if rec.Code != http.StatusOK || rec.Body.String() != "archive-bytes" {
+		t.Fatalf("unexpected download: %d %q", rec.Code, rec.Body.String())
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "a.tar.gz") {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+	events := store.Recent(10)
+	if len(events) != 1 || events[0].Type != "backup_downloaded" || !strings.Contains(events[0].Message, "token grafana") {
+		t.Errorf("expected backup_downloaded audit event, got %+v", events)
+	}
+
+	mgr.backupPath = ""
+	if rec := doRequest(router, "GET", "/api/v1/catalog/default/web-01/daily/b.tar.gz/download", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for missing backup, got %d", rec.Code)
+	}
+}
+
+func TestHistoryQuery_Filters(t *testing.T) {
+	router, mgr := managedRouter(t, false)
+
+	rec := doRequest(router, "GET", "/api/v1/history?agent=web-01&result=ok&since=24h&limit=10", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if mgr.history.Agent != "web-01" || mgr.history.Result != "ok" || mgr.history.Limit != 10 || mgr.history.Since.IsZero() {
+		t.Errorf("unexpected filter: %+v", mgr.history)
+	}
+	if rec := doRequest(router, "GET", "/api/v1/history?since=yesterday", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid since, got %d", rec.Code)
+	}
+}
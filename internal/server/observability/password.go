@@ -0,0 +1,52 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package observability
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// passwordHashIterations é o número de iterações PBKDF2 de HashPassword.
+const passwordHashIterations = 600000
+
+// HashPassword gera o password_hash de um usuário da WebUI
+// (config.PasswordHashScheme, salt aleatório de 16 bytes).
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generating salt: %w", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordHashIterations, sha256.Size)
+	if err != nil {
+		return "", fmt.Errorf("deriving key: %w", err)
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", config.PasswordHashScheme, passwordHashIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// passwordHash é um password_hash já decomposto.
+type passwordHash struct {
+	iterations int
+	salt, key  []byte
+}
+
+// parsePasswordHash decompõe um password_hash validado pela config.
+func parsePasswordHash(s string) (passwordHash, error) {
+	iterations, salt, key, err := config.ParsePasswordHash(s)
+	return passwordHash{iterations: iterations, salt: salt, key: key}, err
+}
+
+// verify compara a senha com o hash em tempo constante.
+func (h passwordHash) verify(password string) bool {
+	key, err := pbkdf2.Key(sha256.New, password, h.salt, h.iterations, len(h.key))
+	return err == nil && subtle.ConstantTimeCompare(key, h.key) == 1
+}
@@ -5,11 +5,12 @@
 package observability
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
 	"os"
 	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/statefile"
 )
 
 // SessionHistoryStore combina ring in-memory com persistência JSONL para sessões finalizadas.
@@ -29,9 +30,9 @@ func NewSessionHistoryStore(path string, ringCap, maxLines int) (*SessionHistory
 	}
 
 	ring := NewSessionHistoryRing(ringCap)
-	entries, lineCount, err := loadSessionHistoryJSONL(path)
+	entries, f, rep, err := statefile.OpenLog[SessionHistoryEntry](path, 0644)
 	if err != nil {
-		return nil, fmt.Errorf("loading session history file: %w", err)
+		return nil, fmt.Errorf("opening session history file: %w", err)
 	}
 
 	start := 0
@@ -42,43 +43,7 @@ func NewSessionHistoryStore(path string, ringCap, maxLines int) (*SessionHistory
 		ring.Push(e)
 	}
 
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("opening session history file for append: %w", err)
-	}
-
-	return &SessionHistoryStore{ring: ring, file: f, maxLines: maxLines, lineCount: lineCount, path: path}, nil
-}
-
-func loadSessionHistoryJSONL(path string) ([]SessionHistoryEntry, int, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, 0, nil
-		}
-		return nil, 0, err
-	}
-	defer f.Close()
-
-	var entries []SessionHistoryEntry
-	lineCount := 0
-	scanner := bufio.NewScanner(f)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-
-	for scanner.Scan() {
-		lineCount++
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-		var e SessionHistoryEntry
-		if err := json.Unmarshal(line, &e); err != nil {
-			continue
-		}
-		entries = append(entries, e)
-	}
-
-	return entries, lineCount, scanner.Err()
+	return &SessionHistoryStore{ring: ring, file: f, maxLines: maxLines, lineCount: rep.Records + rep.Corrupt, path: path}, nil
 }
 
 // Push persiste e guarda em memória uma sessão finalizada.
@@ -93,11 +58,7 @@ func (s *SessionHistoryStore) Push(e SessionHistoryEntry) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := json.Marshal(filled)
-	if err != nil {
-		return
-	}
-	if _, err := s.file.Write(append(data, '\n')); err != nil {
+	if err := statefile.Append(s.file, filled); err != nil {
 		return
 	}
 
@@ -112,6 +73,57 @@ func (s *SessionHistoryStore) Recent(limit int) []SessionHistoryEntry {
 	return s.ring.Recent(limit)
 }
 
+// SessionHistoryFilter seleciona sessões do histórico persistido. Campos
+// vazios não filtram.
+type SessionHistoryFilter struct {
+	Agent   string
+	Storage string
+	Backup  string
+	Result  string
+	Since   time.Time // finished_at >= Since
+	Limit   int       // apenas as N mais recentes (0 = todas)
+}
+
+// match indica se a entrada passa pelo filtro.
+func (f SessionHistoryFilter) match(e SessionHistoryEntry) bool {
+	if (f.Agent != "" && e.Agent != f.Agent) ||
+		(f.Storage != "" && e.Storage != f.Storage) ||
+		(f.Backup != "" && e.Backup != f.Backup) ||
+		(f.Result != "" && e.Result != f.Result) {
+		return false
+	}
+	if !f.Since.IsZero() {
+		finished, err := time.Parse(time.RFC3339, e.FinishedAt)
+		if err != nil || finished.Before(f.Since) {
+			return false
+		}
+	}
+	return true
+}
+
+// Query lê o arquivo JSONL (até session_history_max_lines sessões, além das
+// que cabem no ring) e retorna as entradas que passam pelo filtro, em ordem
+// cronológica.
+func (s *SessionHistoryStore) Query(f SessionHistoryFilter) ([]SessionHistoryEntry, error) {
+	s.mu.Lock()
+	entries, _, err := statefile.ReadLog[SessionHistoryEntry](s.path)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("reading session history file: %w", err)
+	}
+
+	result := make([]SessionHistoryEntry, 0, len(entries))
+	for _, e := range entries {
+		if f.match(e) {
+			result = append(result, e)
+		}
+	}
+	if f.Limit > 0 && f.Limit < len(result) {
+		result = result[len(result)-f.Limit:]
+	}
+	return result, nil
+}
+
 // Close fecha handle de arquivo.
 func (s *SessionHistoryStore) Close() error {
 	s.mu.Lock()
@@ -124,34 +136,21 @@ func (s *SessionHistoryStore) Close() error {
 
 func (s *SessionHistoryStore) rotate() {
 	keep := s.maxLines / 2
-	entries, _, err := loadSessionHistoryJSONL(s.path)
+	entries, _, err := statefile.ReadLog[SessionHistoryEntry](s.path)
 	if err != nil || len(entries) <= keep {
 		return
 	}
 	entries = entries[len(entries)-keep:]
 
-	s.file.Close()
-	f, err := os.Create(s.path)
-	if err != nil {
-		s.file, _ = os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	// Reescrita atômica: um crash durante a rotação preserva o arquivo anterior
+	if err := statefile.WriteLog(s.path, entries, 0644); err != nil {
 		return
 	}
-
-	w := bufio.NewWriter(f)
-	for _, e := range entries {
-		data, err := json.Marshal(e)
-		if err != nil {
-			continue
-		}
-		w.Write(data)
-		w.WriteByte('\n')
-	}
-	w.Flush()
-	f.Close()
-
-	s.file, err = os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	s.file.Close()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return
 	}
+	s.file = f
 	s.lineCount = len(entries)
 }
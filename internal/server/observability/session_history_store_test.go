@@ -3,6 +3,7 @@ package observability
 import (
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestSessionHistoryStore_PersistenceAcrossRestart(t *testing.T) {
@@ -33,3 +34,36 @@ func TestSessionHistoryStore_PersistenceAcrossRestart(t *testing.T) {
 		t.Fatalf("unexpected order: %+v", recent)
 	}
 }
+
+func TestSessionHistoryStore_QueryReadsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session-history.jsonl")
+
+	// Ring com capacidade 2: a consulta precisa vir do arquivo
+	store, err := NewSessionHistoryStore(path, 2, 100)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	defer store.Close()
+	store.Push(SessionHistoryEntry{SessionID: "s1", Agent: "web-01", Result: "ok", FinishedAt: "2025-01-01T00:00:00Z"})
+	store.Push(SessionHistoryEntry{SessionID: "s2", Agent: "db-01", Result: "ok", FinishedAt: "2025-01-02T00:00:00Z"})
+	store.Push(SessionHistoryEntry{SessionID: "s3", Agent: "web-01", Result: "timeout", FinishedAt: "2025-01-03T00:00:00Z"})
+	store.Push(SessionHistoryEntry{SessionID: "s4", Agent: "web-01", Result: "ok", FinishedAt: "2025-01-04T00:00:00Z"})
+
+	all, err := store.Query(SessionHistoryFilter{Agent: "web-01"})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(all) != 3 || all[0].SessionID != "s1" || all[2].SessionID != "s4" {
+		t.Fatalf("unexpected entries: %+v", all)
+	}
+
+	since, _ := time.Parse(time.RFC3339, "2025-01-02T00:00:00Z")
+	got, _ := store.Query(SessionHistoryFilter{Agent: "web-01", Result: "ok", Since: since})
+	if len(got) != 1 || got[0].SessionID != "s4" {
+		t.Errorf("unexpected filtered entries: %+v", got)
+	}
+	got, _ = store.Query(SessionHistoryFilter{Limit: 2})
+	if len(got) != 2 || got[0].SessionID != "s3" {
+		t.Errorf("expected the 2 most recent, got %+v", got)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package observability
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// streamFlushEvery define a cada quantos itens uma lista em streaming é
+// enviada ao client (flush do buffer e do http.Flusher).
+const streamFlushEvery = 64
+
+// streamBufferSize é o buffer de escrita de uma lista em streaming: a memória
+// por request fica limitada a ele mais um item serializado, qualquer que seja
+// o tamanho da lista.
+const streamBufferSize = 32 * 1024
+
+// wantsNDJSON indica se o client pediu NDJSON (um objeto JSON por linha), via
+// ?format=ndjson ou Accept: application/x-ndjson.
+func wantsNDJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "ndjson" {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+}
+
+// writeJSONList serializa items item a item, sem montar o JSON inteiro em
+// memória: um array JSON (default) ou NDJSON. A resposta sai em chunked
+// transfer encoding, com flush a cada streamFlushEvery itens. Para no
+// primeiro erro de escrita (client desconectado).
+func writeJSONList[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	ndjson := wantsNDJSON(r)
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	bw := bufio.NewWriterSize(w, streamBufferSize)
+	flusher, _ := w.(http.Flusher)
+	flush := func() bool {
+		if bw.Flush() != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return r.Context().Err() == nil
+	}
+
+	if !ndjson {
+		bw.WriteByte('[')
+	}
+	written := 0
+	for i := range items {
+		data, err := json.Marshal(&items[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case ndjson:
+		case written == 0:
+			bw.WriteByte('\n')
+		default:
+			bw.WriteString(",\n")
+		}
+		bw.Write(data)
+		if ndjson {
+			bw.WriteByte('\n')
+		}
+		written++
+		if written%streamFlushEvery == 0 && !flush() {
+			return
+		}
+	}
+	if !ndjson {
+		if written > 0 {
+			bw.WriteByte('\n')
+		}
+		bw.WriteString("]\n")
+	}
+	flush()
+}
@@ -6,14 +6,53 @@ const API = {
     async get(path, init = {}) {
         const res = await fetch(`${this.base}${path}`, init);
         if (!res.ok) {
-            const err = new Error(`API ${res.status}: ${res.statusText}`);
-            err.status = res.status;
-            err.path = path;
-            throw err;
+            throw await this.error(res, path);
         }
         return res.json();
     },
 
+    // POST com corpo JSON; o header X-Requested-With é exigido pelo server
+    // em requests autenticados por cookie (proteção CSRF)
+    async post(path, body) {
+        const res = await fetch(`${this.base}${path}`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', 'X-Requested-With': 'nbackup-webui' },
+            body: body ? JSON.stringify(body) : undefined,
+        });
+        if (!res.ok) {
+            throw await this.error(res, path);
+        }
+        return res.json();
+    },
+
+    // Erro com status e mensagem da API; um 401 avisa o app para exibir o login
+    async error(res, path) {
+        let msg = res.statusText;
+        try { msg = (await res.json()).error || msg; } catch (_) { /* corpo não-JSON */ }
+        const err = new Error(`API ${res.status}: ${msg}`);
+        err.status = res.status;
+        err.path = path;
+        err.apiMessage = msg;
+        if (res.status === 401 && !path.startsWith('/api/v1/auth/')) {
+            window.dispatchEvent(new Event('nbackup-unauthorized'));
+        }
+        return err;
+    },
+
+    me() { return this.get('/api/v1/auth/me'); },
+    login(username, password) { return this.post('/api/v1/auth/login', { username, password }); },
+    logout() { return this.post('/api/v1/auth/logout'); },
+    cancelSession(id) { return this.post(`/api/v1/sessions/${encodeURIComponent(id)}/cancel`); },
+    expireSession(id) { return this.post(`/api/v1/sessions/${encodeURIComponent(id)}/expire`); },
+    rotate(e) {
+        const path = [e.storage, e.agent, e.backup].map(encodeURIComponent).join('/');
+        return this.post(`/api/v1/catalog/${path}/rotate`);
+    },
+    quarantine(e) {
+        const path = [e.storage, e.agent, e.backup, e.file].map(encodeURIComponent).join('/');
+        return this.post(`/api/v1/catalog/${path}/quarantine`);
+    },
+
     health(init) { return this.get('/api/v1/health', init); },
     metrics(init) { return this.get('/api/v1/metrics', init); },
     sessions(init) { return this.get('/api/v1/sessions', init); },
@@ -27,6 +66,17 @@ const API = {
         const sid = sessionId ? `&session_id=${encodeURIComponent(sessionId)}` : "";
         return this.get(`/api/v1/sessions/active-history?limit=${limit}${sid}`, init);
     },
+    history(filter = {}, init) {
+        const qs = new URLSearchParams(Object.entries(filter).filter(([, v]) => v)).toString();
+        return this.get(`/api/v1/history${qs ? '?' + qs : ''}`, init);
+    },
+    ingestReport(days = 30, init) { return this.get(`/api/v1/reports/ingest?days=${days}`, init); },
+    auditSession(id, init) { return this.get(`/api/v1/audit/sessions/${encodeURIComponent(id)}`, init); },
+    catalog(init) { return this.get('/api/v1/catalog', init); },
+    downloadURL(e) {
+        const path = [e.storage, e.agent, e.backup, e.file].map(encodeURIComponent).join('/');
+        return `${this.base}/api/v1/catalog/${path}/download${e.quarantined ? '?quarantined=true' : ''}`;
+    },
     syncStatus(init) { return this.get('/api/v1/sync/status', init); },
     bucketHistory(limit = 50, init) { return this.get(`/api/v1/buckets/history?limit=${limit}`, init); },
 };
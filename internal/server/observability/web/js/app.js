@@ -13,6 +13,9 @@
     let currentRequestId = 0;
     let currentAbortController = null;
     let configLoaded = false;
+    let downloadsEnabled = null; // web_ui.allow_downloads (lido da config efetiva)
+    let auth = null; // GET /api/v1/auth/me — usuário logado e permissões
+    let catalogEntries = []; // linhas exibidas no catálogo (para as ações)
 
     // Ring buffer de dados de throughput por sessão
     // Chave: session_id → { net: number[], disk: number[], lastBytes: number, lastDisk: number }
@@ -64,7 +67,10 @@
 
     // ============ Hash Routing ============
 
-    const VALID_VIEWS = ['overview', 'sessions', 'uploads', 'events', 'config'];
+    const VALID_VIEWS = ['overview', 'sessions', 'history', 'reports', 'catalog', 'uploads', 'events', 'config'];
+
+    // Views sem polling: atualizadas ao entrar, ao mudar filtros ou pelo botão ↻
+    const STATIC_VIEWS = ['history', 'reports', 'catalog', 'config'];
 
     function pushRoute(hash) {
         if (window.location.hash === '#' + hash) return;
@@ -231,6 +237,7 @@
             updateConnectionStatus('connected');
             updateSparkHistory(detail);
             Components.renderSessionDetail(detail);
+            document.getElementById('detail-actions').style.display = canManage() ? '' : 'none';
 
             // Desenha sparklines após render
             drawSessionSparklines(id);
@@ -280,6 +287,74 @@
         }
     }
 
+    async function fetchHistory() {
+        const { requestId, signal } = beginViewRequest();
+        try {
+            const filter = {
+                agent: document.getElementById('history-agent').value,
+                result: document.getElementById('history-result').value,
+                since: document.getElementById('history-since').value,
+            };
+            const [entries, all] = await Promise.all([
+                API.history(filter, { signal }),
+                API.history({ since: filter.since }, { signal }),
+            ]);
+            if (!isLatestRequest(requestId)) return;
+            updateConnectionStatus('connected');
+            Components.fillFilterOptions(document.getElementById('history-agent'), all.map(e => e.agent));
+            Components.renderHistoryView(entries);
+        } catch (err) {
+            if (isAbortError(err) || !isLatestRequest(requestId)) return;
+            updateConnectionStatus('error');
+            console.error('fetchHistory error:', err);
+        }
+    }
+
+    async function fetchReports() {
+        const { requestId, signal } = beginViewRequest();
+        try {
+            const report = await API.ingestReport(document.getElementById('reports-days').value, { signal });
+            if (!isLatestRequest(requestId)) return;
+            updateConnectionStatus('connected');
+            Components.renderReportsView(report);
+        } catch (err) {
+            if (isAbortError(err) || !isLatestRequest(requestId)) return;
+            if (err.status === 404) {
+                // accounting desabilitado no server
+                Components.renderReportsView(null, err.apiMessage);
+                return;
+            }
+            updateConnectionStatus('error');
+            console.error('fetchReports error:', err);
+        }
+    }
+
+    async function fetchCatalog() {
+        const { requestId, signal } = beginViewRequest();
+        try {
+            const [entries, cfg] = await Promise.all([
+                API.catalog({ signal }),
+                downloadsEnabled === null ? API.config({ signal }) : null,
+            ]);
+            if (!isLatestRequest(requestId)) return;
+            updateConnectionStatus('connected');
+            if (cfg) downloadsEnabled = !!cfg.downloads;
+
+            const storageSel = document.getElementById('catalog-storage');
+            const agentSel = document.getElementById('catalog-agent');
+            Components.fillFilterOptions(storageSel, entries.map(e => e.storage));
+            Components.fillFilterOptions(agentSel, entries.map(e => e.agent));
+            catalogEntries = entries.filter(e =>
+                (!storageSel.value || e.storage === storageSel.value) &&
+                (!agentSel.value || e.agent === agentSel.value));
+            Components.renderCatalogView(catalogEntries, downloadsEnabled, canManage());
+        } catch (err) {
+            if (isAbortError(err) || !isLatestRequest(requestId)) return;
+            updateConnectionStatus('error');
+            console.error('fetchCatalog error:', err);
+        }
+    }
+
     async function fetchConfig() {
         if (configLoaded) {
             cancelInFlightRequest();
@@ -309,6 +384,9 @@
                     fetchSessions();
                 }
                 break;
+            case 'history': fetchHistory(); break;
+            case 'reports': fetchReports(); break;
+            case 'catalog': fetchCatalog(); break;
             case 'events': fetchEvents(); break;
             case 'uploads': fetchUploads(); break;
             case 'config': fetchConfig(); break;
@@ -342,7 +420,7 @@
         stopPolling();
         fetchCurrentView();
         pollTimer = setInterval(() => {
-            if (isVisible && currentView !== 'config') {
+            if (isVisible && !STATIC_VIEWS.includes(currentView)) {
                 fetchCurrentView();
             }
         }, POLL_INTERVAL);
@@ -395,13 +473,70 @@
     // Events limit change
     document.getElementById('events-limit').addEventListener('change', fetchEvents);
 
+    // Filtros do histórico e do catálogo
+    ['history-agent', 'history-result', 'history-since'].forEach(id =>
+        document.getElementById(id).addEventListener('change', fetchHistory));
+    document.getElementById('btn-refresh-history').addEventListener('click', fetchHistory);
+
+    // Audit log da sessão clicada no histórico (audit_log)
+    document.getElementById('history-sessions-body').addEventListener('click', async (e) => {
+        const row = e.target.closest('tr[data-session]');
+        if (!row) return;
+        const id = row.dataset.session;
+        try {
+            Components.renderAuditTrail(id, await API.auditSession(id));
+        } catch (err) {
+            Components.renderAuditTrail(id, null, err.status === 404 ? err.apiMessage : `Falha: ${err.message}`);
+        }
+        document.getElementById('history-audit').scrollIntoView({ behavior: 'smooth' });
+    });
+    document.getElementById('reports-days').addEventListener('change', fetchReports);
+    document.getElementById('btn-refresh-reports').addEventListener('click', fetchReports);
+    ['catalog-storage', 'catalog-agent'].forEach(id =>
+        document.getElementById(id).addEventListener('change', fetchCatalog));
+    document.getElementById('btn-refresh-catalog').addEventListener('click', fetchCatalog);
+
     // Uploads limit change
     document.getElementById('uploads-limit').addEventListener('change', fetchUploads);
 
+    // Ações de gerenciamento (role operator): sessão e catálogo
+    document.getElementById('detail-actions').addEventListener('click', async (e) => {
+        const btn = e.target.closest('.btn-action');
+        if (!btn || !selectedSessionId) return;
+        const id = selectedSessionId;
+        const cancel = btn.dataset.action === 'cancel';
+        if (!confirm(`${cancel ? 'Cancelar' : 'Expirar'} a sessão ${id}? Os dados parciais serão descartados.`)) return;
+        try {
+            await (cancel ? API.cancelSession(id) : API.expireSession(id));
+            fetchSessionDetail(id); // 404 → volta para a lista
+        } catch (err) {
+            alert(`Falha: ${err.apiMessage || err.message}`);
+        }
+    });
+
+    document.getElementById('catalog-body').addEventListener('click', async (e) => {
+        const btn = e.target.closest('.btn-action');
+        const entry = btn && catalogEntries[parseInt(btn.dataset.index)];
+        if (!entry) return;
+        try {
+            if (btn.dataset.action === 'rotate') {
+                if (!confirm(`Aplicar max_backups a ${entry.storage}/${entry.agent}/${entry.backup}? Backups excedentes serão removidos.`)) return;
+                const res = await API.rotate(entry);
+                alert(res.removed && res.removed.length ? `Removidos: ${res.removed.join(', ')}` : 'Nenhum backup removido.');
+            } else {
+                if (!confirm(`Colocar ${entry.file} em quarentena?`)) return;
+                await API.quarantine(entry);
+            }
+            fetchCatalog();
+        } catch (err) {
+            alert(`Falha: ${err.apiMessage || err.message}`);
+        }
+    });
+
     // Visibility change — pause polling when tab hidden
     document.addEventListener('visibilitychange', () => {
         isVisible = !document.hidden;
-        if (isVisible && currentView !== 'config') {
+        if (isVisible && !STATIC_VIEWS.includes(currentView)) {
             fetchCurrentView(); // Fetch imediato ao voltar
         }
     });
@@ -500,17 +635,86 @@
         Components.exportEvents(cachedEvents, 'json');
     });
 
-    // ============ Init ============
+    // ============ Autenticação ============
 
-    initTheme();
+    function canManage() {
+        return !!(auth && auth.can_manage);
+    }
+
+    function renderAuth() {
+        const loggedIn = !!(auth && auth.authenticated && auth.kind === 'user');
+        const badge = document.getElementById('user-badge');
+        badge.style.display = loggedIn ? '' : 'none';
+        badge.textContent = loggedIn ? `${auth.name} · ${auth.role}` : '';
+        document.getElementById('btn-logout').style.display = loggedIn ? '' : 'none';
+    }
+
+    function showLogin(message) {
+        stopPolling();
+        cancelInFlightRequest();
+        renderAuth();
+        document.getElementById('login-error').textContent = message || '';
+        document.getElementById('login-overlay').style.display = '';
+        document.getElementById('login-user').focus();
+    }
+
+    function startApp() {
+        document.getElementById('login-overlay').style.display = 'none';
+        renderAuth();
 
-    // Restaura rota da hash (ou fallback para overview)
-    const initHash = window.location.hash.replace(/^#\/?/, '');
-    if (initHash) {
-        handleHashChange();
-    } else {
-        switchView('overview');
+        // Restaura rota da hash (ou fallback para overview)
+        const initHash = window.location.hash.replace(/^#\/?/, '');
+        if (initHash) {
+            handleHashChange();
+        } else {
+            switchView('overview');
+        }
+        startPolling();
     }
 
-    startPolling();
+    document.getElementById('login-form').addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const password = document.getElementById('login-password');
+        try {
+            auth = await API.login(document.getElementById('login-user').value, password.value);
+            password.value = '';
+            configLoaded = false;
+            downloadsEnabled = null;
+            startApp();
+        } catch (err) {
+            document.getElementById('login-error').textContent = err.status === 429
+                ? 'Muitas tentativas falhas — aguarde alguns minutos.'
+                : 'Usuário ou senha inválidos.';
+        }
+    });
+
+    document.getElementById('btn-logout').addEventListener('click', async () => {
+        try {
+            auth = await API.logout();
+        } catch (_) { /* sessão já encerrada */ }
+        showLogin();
+    });
+
+    // Sessão expirada (ou server reiniciado): qualquer 401 da API volta ao login
+    window.addEventListener('nbackup-unauthorized', () => {
+        if (auth && auth.login_enabled) {
+            auth = { ...auth, authenticated: false, can_manage: false };
+            showLogin('Sessão expirada — entre novamente.');
+        }
+    });
+
+    // ============ Init ============
+
+    initTheme();
+
+    API.me()
+        .then(info => {
+            auth = info;
+            if (auth.auth_required && !auth.authenticated && auth.login_enabled) {
+                showLogin();
+            } else {
+                startApp();
+            }
+        })
+        .catch(() => startApp());
 })();
@@ -93,6 +93,7 @@ const Components = {
             receiving:  { cls: 'badge-info',       icon: '📥', label: 'receiving' },
             assembling: { cls: 'badge-assembling', icon: '⚙️',  label: 'assembling' },
             verifying:  { cls: 'badge-warn',       icon: '🔍', label: 'verifying' },
+            deduplicating: { cls: 'badge-assembling', icon: '🧩', label: 'deduplicating' },
             uploading:  { cls: 'badge-uploading',  icon: '☁️',  label: 'uploading' },
             done:       { cls: 'badge-success',    icon: '✓',  label: 'done' },
             failed:     { cls: 'badge-error',      icon: '✗',  label: 'failed' },
@@ -251,6 +252,12 @@ const Components = {
                 criticalClass = ' gauge-critical';
                 alertIcon = '<span class="alert-icon" title="Disco crítico!">⚠️</span>';
             } else if (pct >= 70) colorClass = 'med';
+            // Inodes abaixo de min_free_inodes: o server recusa novos backups
+            const lowInodes = s.total_inodes > 0 && s.min_free_inodes > 0 && s.free_inodes < s.min_free_inodes;
+            if (lowInodes) {
+                criticalClass = ' gauge-critical';
+                alertIcon = '<span class="alert-icon" title="Inodes esgotando — novos backups são recusados">⚠️</span>';
+            }
 
             return `
             <div class="storage-card${criticalClass}">
@@ -259,6 +266,8 @@ const Components = {
                     <div class="storage-badges">
                         ${this.compressionBadge(s.compression_mode === 'zst' ? 'zst' : 'gzip')}
                         <span class="badge badge-neutral">${this.escapeHtml(s.assembler_mode)}</span>
+                        ${s.backup_window ? `<span class="badge ${s.window_open ? 'badge-connected' : 'badge-inactive'}" title="Backup window (${s.window_open ? 'aberta' : 'fechada'})">🕒 ${this.escapeHtml(s.backup_window)}</span>` : ''}
+                        ${this.diskHealthBadge(s.disk_health)}
                     </div>
                 </div>
                 <div class="storage-usage">
@@ -270,6 +279,7 @@ const Components = {
                 <div class="storage-details">
                     <span title="Espaço usado">${this.formatBytes(s.used_bytes)} / ${this.formatBytes(s.total_bytes)}</span>
                     <span title="Espaço livre">Livre: ${this.formatBytes(s.free_bytes)}</span>
+                    ${s.total_inodes > 0 ? `<span title="Inodes livres (mínimo: ${s.min_free_inodes || 'desabilitado'})"${lowInodes ? ' class="inodes-low"' : ''}>Inodes: ${(s.inode_usage_percent || 0).toFixed(1)}% (${s.free_inodes.toLocaleString()} livres)</span>` : ''}
                 </div>
                 <div class="storage-meta">
                     <span title="Diretório base">${this.escapeHtml(s.base_dir)}</span>
@@ -279,6 +289,19 @@ const Components = {
         }).join('');
     },
 
+    // Saúde do disco (storages.*.disk_health): estado, ação e scrub em andamento
+    diskHealthBadge(dh) {
+        if (!dh) return '';
+        const cls = { ok: 'badge-connected', degraded: 'badge-warn', failing: 'badge-error' }[dh.state] || 'badge-inactive';
+        let title = `Disco: ${dh.state}`;
+        if (dh.detail) title += ` — ${dh.detail}`;
+        if (dh.read_only) title += ' (somente leitura: novos backups recusados)';
+        else if (dh.force_verify) title += ' (verify_integrity forçado)';
+        if (dh.scrub) title += ` | Scrub: ${dh.scrub.checked} verificados, ${dh.scrub.corrupt} corrompidos${dh.scrub.running ? ' (em andamento)' : ''}`;
+        const label = dh.read_only ? `${dh.state} · RO` : dh.state;
+        return `<span class="badge ${cls}" title="${this.escapeHtml(title)}">💽 ${this.escapeHtml(label)}</span>`;
+    },
+
     renderOverviewSessions(sessions) {
         const card = document.getElementById('overview-sessions-card');
         const body = document.getElementById('overview-sessions-body');
@@ -759,6 +782,7 @@ const Components = {
             write_error: { cls: 'badge-warn', label: '⚠ write error' },
             timeout: { cls: 'badge-idle', label: '⏱ timeout' },
             error: { cls: 'badge-error', label: '✗ error' },
+            cancelled: { cls: 'badge-neutral', label: '⊘ cancelled' },
         };
         const m = map[result] || { cls: 'badge-neutral', label: result || '—' };
         return `<span class="badge ${m.cls}">${m.label}</span>`;
@@ -781,13 +805,239 @@ const Components = {
                 <td>${this.escapeHtml(e.storage)}</td>
                 <td>${this.modeBadge(e.mode)}</td>
                 <td>${this.compressionBadge(e.compression)}</td>
+                <td>${this.resultBadge(e.result)}${e.empty ? ' <span class="badge badge-neutral" title="Sources sem nenhuma entrada: archive vazio">empty</span>' : ''}</td>
+                <td>${this.escapeHtml(e.duration)}</td>
+                <td>${this.formatBytes(e.bytes_total)}${this.retransmitBadge(e)}</td>
+                <td>${this.configHashBadge(e)}</td>
+                <td>${this.formatDateTime(e.finished_at)}</td>
+            </tr>
+        `).join('');
+    },
+
+    // Preenche um <select> de filtro com os valores conhecidos, preservando a seleção
+    fillFilterOptions(select, values) {
+        const current = select.value;
+        const first = select.options[0].outerHTML;
+        const sorted = [...new Set(values.filter(Boolean))].sort();
+        if (current && !sorted.includes(current)) sorted.push(current);
+        select.innerHTML = first + sorted.map(v => `<option value="${this.escapeHtml(v)}">${this.escapeHtml(v)}</option>`).join('');
+        select.value = current;
+    },
+
+    // Renderiza o histórico persistido: resumo por agent (com timeline) e lista de sessões
+    renderHistoryView(entries) {
+        const agentsBody = document.getElementById('history-agents-body');
+        const sessionsBody = document.getElementById('history-sessions-body');
+        if (!entries || entries.length === 0) {
+            agentsBody.innerHTML = `<tr><td colspan="8" class="empty-state">Nenhuma sessão no período.</td></tr>`;
+            sessionsBody.innerHTML = '';
+            return;
+        }
+
+        const byAgent = {};
+        for (const e of entries) {
+            const a = byAgent[e.agent] || (byAgent[e.agent] = { total: 0, ok: 0, bytes: 0, durationMs: 0, lastOk: null, lastFail: null, sessions: [] });
+            a.total++;
+            a.bytes += e.bytes_total || 0;
+            a.durationMs += this.parseDurationMs(e.duration);
+            a.sessions.push(e);
+            if (e.result === 'ok') {
+                a.ok++;
+                a.lastOk = e.finished_at;
+            } else if (e.result !== 'cancelled') {
+                a.lastFail = e.finished_at;
+            }
+        }
+
+        agentsBody.innerHTML = Object.keys(byAgent).sort().map(name => {
+            const a = byAgent[name];
+            const pct = Math.round(a.ok / a.total * 100);
+            const cells = a.sessions.slice(-60).map(e => {
+                const cls = e.result === 'ok' ? 'ok' : (e.result === 'cancelled' ? 'cancelled' : '');
+                const title = `${this.formatDateTime(e.finished_at)} — ${e.storage}/${e.backup || ''}\n${e.result} · ${e.duration} · ${this.formatBytes(e.bytes_total)}`;
+                return `<span class="timeline-cell ${cls}" title="${this.escapeHtml(title)}"></span>`;
+            }).join('');
+            return `<tr>
+                <td><strong>${this.escapeHtml(name)}</strong></td>
+                <td>${a.total}</td>
+                <td><span class="${pct === 100 ? 'status-ok' : 'status-error'}">${pct}%</span> (${a.ok}/${a.total})</td>
+                <td>${a.lastOk ? this.formatDateTime(a.lastOk) : '—'}</td>
+                <td>${a.lastFail ? this.formatDateTime(a.lastFail) : '—'}</td>
+                <td>${this.formatDurationMs(a.durationMs / a.total)}</td>
+                <td>${this.formatBytes(a.bytes)}</td>
+                <td><div class="timeline">${cells}</div></td>
+            </tr>`;
+        }).join('');
+
+        // Mais recentes primeiro
+        sessionsBody.innerHTML = [...entries].reverse().map(e => `
+            <tr class="clickable ${e.result === 'ok' || e.result === 'cancelled' ? '' : 'row-error'}" data-session="${this.escapeHtml(e.session_id)}" title="Ver audit log da sessão">
+                <td>${this.formatDateTime(e.finished_at)}</td>
+                <td><strong>${this.escapeHtml(e.agent)}</strong></td>
+                <td>${this.escapeHtml([e.storage, e.backup].filter(Boolean).join('/'))}</td>
+                <td>${this.modeBadge(e.mode)}</td>
                 <td>${this.resultBadge(e.result)}</td>
                 <td>${this.escapeHtml(e.duration)}</td>
                 <td>${this.formatBytes(e.bytes_total)}</td>
-                <td>${this.formatDateTime(e.finished_at)}</td>
             </tr>
         `).join('');
     },
+
+    // Renderiza o audit log de uma sessão do histórico (audit_log); records
+    // null indica audit log indisponível (desabilitado ou sessão fora do índice)
+    renderAuditTrail(sessionId, records, message) {
+        document.getElementById('history-audit').style.display = '';
+        document.getElementById('history-audit-title').textContent = `Audit log da sessão ${sessionId}`;
+        const body = document.getElementById('history-audit-body');
+        if (!records || records.length === 0) {
+            body.innerHTML = `<tr><td colspan="4" class="empty-state">${this.escapeHtml(message || 'Nenhum registro.')}</td></tr>`;
+            return;
+        }
+        body.innerHTML = records.map(r => {
+            const details = [];
+            switch (r.event) {
+                case 'handshake':
+                    details.push(`${r.mode} · ${r.compression || ''}`, `agent ${r.client_version || '?'} (protocolo v${r.protocol || '?'})`);
+                    if (r.max_streams) details.push(`${r.max_streams} streams · chunk ${this.formatBytes(r.chunk_size)}`);
+                    if (r.placement) details.push(`placement ${r.placement}`);
+                    break;
+                case 'resume':
+                case 'stream_join':
+                    if (r.reason) details.push(r.reason);
+                    details.push(`offset ${this.formatBytes(r.offset || 0)}`);
+                    break;
+                case 'commit':
+                    details.push(r.commit_path);
+                    break;
+                case 'end':
+                    details.push(`${r.result} · ${this.formatBytes(r.bytes || 0)} · ${(r.duration_seconds || 0).toFixed(1)}s`);
+                    if (r.retransmit_bytes) details.push(`retransmitido ${this.formatBytes(r.retransmit_bytes)}`);
+                    break;
+                default:
+                    if (r.reason) details.push(r.reason);
+            }
+            if (r.remote_addr) details.push(r.remote_addr);
+            if (r.message) details.push(r.message);
+            return `<tr class="${r.event === 'end' && r.result !== 'ok' && r.result !== 'cancelled' ? 'row-error' : ''}">
+                <td>${this.formatDateTime(r.time)}</td>
+                <td>${this.escapeHtml(r.event)}</td>
+                <td>${r.stream !== undefined ? '#' + r.stream : '—'}</td>
+                <td>${this.escapeHtml(details.filter(Boolean).join(' · '))}</td>
+            </tr>`;
+        }).join('');
+    },
+
+    // Renderiza o relatório de ingestão (accounting); report null indica
+    // contabilidade desabilitada no server
+    renderReportsView(report, message) {
+        const summary = document.getElementById('reports-summary');
+        const daily = document.getElementById('reports-daily');
+        const agentsBody = document.getElementById('reports-agents-body');
+        const storagesBody = document.getElementById('reports-storages-body');
+        if (!report) {
+            summary.textContent = 'Ingestão diária';
+            daily.innerHTML = `<div class="empty-state">${this.escapeHtml(message || 'Contabilidade de ingestão desabilitada.')} Habilite <code>accounting</code> no server.yaml.</div>`;
+            agentsBody.innerHTML = '';
+            storagesBody.innerHTML = '';
+            return;
+        }
+
+        const t = report.totals;
+        const rate = t.ok + t.failed > 0 ? ` · ${t.success_rate.toFixed(1)}% sucesso` : '';
+        summary.textContent = `Ingestão diária — ${this.formatBytes(t.bytes)} em ${t.sessions} sessões${rate} (${report.since} a ${report.until})`;
+        const peak = Math.max(...report.daily.map(d => d.bytes), 0);
+        daily.innerHTML = report.daily.map(d => {
+            const height = peak > 0 ? Math.max(d.bytes / peak * 100, d.bytes > 0 ? 2 : 0) : 0;
+            const title = `${d.day}\n${this.formatBytes(d.bytes)} · ${d.sessions} sessões${d.failed ? ` · ${d.failed} falha(s)` : ''}`;
+            return `<div class="report-bar ${d.failed ? 'failed' : ''}" style="height: ${height}%" title="${this.escapeHtml(title)}"></div>`;
+        }).join('');
+
+        const rows = (groups, empty) => {
+            if (!groups || groups.length === 0) {
+                return `<tr><td colspan="6" class="empty-state">${empty}</td></tr>`;
+            }
+            return groups.map(g => {
+                const pct = g.ok + g.failed > 0 ? g.success_rate : null;
+                const growth = g.growth === undefined ? '—' : `${g.growth >= 0 ? '+' : ''}${g.growth.toFixed(0)}%`;
+                return `<tr>
+                    <td><strong>${this.escapeHtml(g.name)}</strong></td>
+                    <td>${this.formatBytes(g.bytes)}</td>
+                    <td>${g.share.toFixed(1)}%</td>
+                    <td>${g.sessions}</td>
+                    <td>${pct === null ? '—' : `<span class="${pct === 100 ? 'status-ok' : 'status-error'}">${pct.toFixed(1)}%</span>`}</td>
+                    <td>${growth}</td>
+                </tr>`;
+            }).join('');
+        };
+        agentsBody.innerHTML = rows(report.agents, 'Nenhuma ingestão no período.');
+        storagesBody.innerHTML = rows(report.storages, 'Nenhuma ingestão no período.');
+    },
+
+    // Renderiza o catálogo de backups armazenados, com link de download quando habilitado
+    renderCatalogView(entries, downloads, canManage) {
+        const body = document.getElementById('catalog-body');
+        document.getElementById('catalog-note').style.display = downloads ? 'none' : '';
+        if (!entries || entries.length === 0) {
+            body.innerHTML = `<tr><td colspan="7" class="empty-state">Nenhum backup armazenado.</td></tr>`;
+            return;
+        }
+
+        body.innerHTML = entries.map((e, i) => `
+            <tr>
+                <td>${this.escapeHtml(e.storage)}</td>
+                <td><strong>${this.escapeHtml(e.agent)}</strong></td>
+                <td>${this.escapeHtml(e.backup)}</td>
+                <td><code>${this.escapeHtml(e.file)}</code>${e.quarantined ? ' <span class="badge badge-warn">quarentena</span>' : ''}</td>
+                <td>${this.formatBytes(e.size_bytes)}</td>
+                <td>${this.formatDateTime(e.modified_at)}</td>
+                <td>
+                    ${downloads ? `<a class="btn-download" href="${this.escapeHtml(API.downloadURL(e))}" download>⬇ Download</a>` : ''}
+                    ${canManage ? `<button class="btn-action btn-action-mini" data-action="rotate" data-index="${i}" title="Aplica max_backups a ${this.escapeHtml(e.agent)}/${this.escapeHtml(e.backup)}">↻ Rotacionar</button>` : ''}
+                    ${canManage && !e.quarantined ? `<button class="btn-action btn-action-mini" data-action="quarantine" data-index="${i}" title="Tira o backup da rotação e do sync">⚑ Quarentena</button>` : ''}
+                </td>
+            </tr>
+        `).join('');
+    },
+
+    // Converte a duração do Go (ex: "1h2m3.5s", "850ms") em milissegundos
+    parseDurationMs(str) {
+        if (!str) return 0;
+        const units = { h: 3600000, m: 60000, s: 1000, ms: 1, 'µs': 0.001, us: 0.001, ns: 0.000001 };
+        let total = 0;
+        for (const [, value, unit] of str.matchAll(/([\d.]+)(ms|µs|us|ns|h|m|s)/g)) {
+            total += parseFloat(value) * (units[unit] || 0);
+        }
+        return total;
+    },
+
+    formatDurationMs(ms) {
+        if (!ms) return '—';
+        const s = Math.round(ms / 1000);
+        if (s < 60) return `${s}s`;
+        if (s < 3600) return `${Math.floor(s / 60)}m ${s % 60}s`;
+        return `${Math.floor(s / 3600)}h ${Math.floor((s % 3600) / 60)}m`;
+    },
+
+    // Badge de overhead de retransmissão (bytes reenviados / bytes enviados pelo agent)
+    retransmitBadge(e) {
+        if (!e.retransmit_bytes) return '';
+        const streams = (e.streams || [])
+            .filter(s => s.retransmit_bytes > 0)
+            .map(s => `#${s.stream}: ${this.formatBytes(s.retransmit_bytes)} de ${this.formatBytes(s.bytes_sent)}`)
+            .join('\n');
+        const title = `Retransmitido: ${this.formatBytes(e.retransmit_bytes)}\n${streams}`;
+        return ` <span class="badge badge-warn" title="${this.escapeHtml(title)}">↻ ${e.retransmit_overhead_pct.toFixed(1)}%</span>`;
+    },
+
+    // Badge com o hash da config efetiva da sessão; destaca quando mudou em relação à anterior
+    configHashBadge(e) {
+        if (!e.config_hash) return '—';
+        const changes = e.config_changes || [];
+        if (changes.length === 0) {
+            return `<code title="${this.escapeHtml(JSON.stringify(e.config || {}, null, 2))}">${this.escapeHtml(e.config_hash)}</code>`;
+        }
+        return `<span class="badge badge-warn" title="${this.escapeHtml(changes.join('\n'))}">⚙ ${this.escapeHtml(e.config_hash)}</span>`;
+    },
     // Exporta eventos carregados como JSON ou CSV
     exportEvents(events, format = 'json') {
         if (!events || events.length === 0) return;
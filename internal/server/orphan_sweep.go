@@ -0,0 +1,219 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// orphan_sweep.go remove os artefatos temporários de sessões que não existem
+// mais em memória — backup-*.tmp (single), assembled_*.tmp e chunks_*
+// (parallel) — deixados por crash do server, restart sem sessions_file ou
+// sessões encerradas sem limpeza. O sweep roda no start e a cada
+// orphanSweepInterval; um artefato só é removido após ficar session_ttl sem
+// modificação, o que cobre sessões sendo criadas durante o sweep.
+
+package server
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/dedup"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// orphanSweepInterval é o intervalo entre sweeps de artefatos órfãos.
+const orphanSweepInterval = 1 * time.Hour
+
+// orphanSweepStats acumula os resultados dos sweeps para /metrics.
+type orphanSweepStats struct {
+	runs    atomic.Int64
+	removed atomic.Int64
+	bytes   atomic.Int64
+	lastRun atomic.Int64 // unix nano
+}
+
+// StartOrphanSweeper executa um sweep imediato e repete a cada
+// orphanSweepInterval até ctx ser cancelado. Deve ser chamado após
+// OpenSessionStore, para que as sessões restauradas não pareçam órfãs.
+func (h *Handler) StartOrphanSweeper(ctx context.Context) {
+	h.SweepOrphans(h.logger)
+
+	ticker := time.NewTicker(orphanSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.SweepOrphans(h.logger)
+		}
+	}
+}
+
+// SweepOrphans remove de todos os storages os artefatos temporários sem
+// sessão correspondente e retorna o total de bytes liberados.
+func (h *Handler) SweepOrphans(logger *slog.Logger) int64 {
+	tmpPaths, parallelIDs := h.activeSessionArtifacts()
+
+	storages := h.config().Storages
+	names := make([]string, 0, len(storages))
+	for name := range storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var total int64
+	for _, name := range names {
+		si := storages[name]
+		ttl := si.SessionTTL
+		if ttl <= 0 {
+			ttl = sessionTTL
+		}
+		removed, reclaimed := sweepStorageOrphans(si.BaseDir, time.Now().Add(-ttl), tmpPaths, parallelIDs, logger.With("storage", name))
+		if removed > 0 {
+			logger.Info("orphan temporary files removed",
+				"storage", name,
+				"removed", removed,
+				"reclaimed", formatBytesGo(reclaimed),
+				"reclaimed_bytes", reclaimed,
+			)
+		}
+		h.orphans.removed.Add(int64(removed))
+		h.orphans.bytes.Add(reclaimed)
+		total += reclaimed
+	}
+	h.orphans.runs.Add(1)
+	h.orphans.lastRun.Store(time.Now().UnixNano())
+	return total
+}
+
+// activeSessionArtifacts coleta os .tmp das sessões single e os IDs das
+// sessões paralelas em memória.
+func (h *Handler) activeSessionArtifacts() (map[string]bool, map[string]bool) {
+	tmpPaths := make(map[string]bool)
+	parallelIDs := make(map[string]bool)
+	h.sessions.Range(func(key, value any) bool {
+		switch s := value.(type) {
+		case *PartialSession:
+			tmpPaths[filepath.Clean(s.TmpPath)] = true
+		case *ParallelSession:
+			parallelIDs[key.(string)] = true
+		}
+		return true
+	})
+	return tmpPaths, parallelIDs
+}
+
+// sweepStorageOrphans percorre baseDir e remove os artefatos órfãos não
+// modificados desde cutoff. Retorna a quantidade removida e os bytes liberados.
+func sweepStorageOrphans(baseDir string, cutoff time.Time, tmpPaths, parallelIDs map[string]bool, logger *slog.Logger) (int, int64) {
+	var removed int
+	var reclaimed int64
+
+	remove := func(path, kind string, size int64, all bool) {
+		var err error
+		if all {
+			err = os.RemoveAll(path)
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			logger.Warn("failed to remove orphan temporary file", "path", path, "error", err)
+			return
+		}
+		logger.Info("orphan temporary file removed", "path", path, "kind", kind, "bytes", size)
+		removed++
+		reclaimed += size
+	}
+
+	_ = filepath.WalkDir(baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // ignora erros de permissão e continua
+		}
+		name := d.Name()
+		if d.IsDir() {
+			switch {
+			case name == quarantineDirName || name == dedup.PoolDirName:
+				return filepath.SkipDir
+			case strings.HasPrefix(name, "chunks_"):
+				if !parallelIDs[strings.TrimPrefix(name, "chunks_")] {
+					if size, newest := dirUsage(path); newest.Before(cutoff) {
+						remove(path, "chunks", size, true)
+					}
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case strings.HasPrefix(name, "assembled_") && strings.HasSuffix(name, ".tmp"):
+			if parallelIDs[strings.TrimSuffix(strings.TrimPrefix(name, "assembled_"), ".tmp")] {
+				return nil
+			}
+		case strings.HasPrefix(name, "backup-") && strings.HasSuffix(name, ".tmp"):
+			if tmpPaths[filepath.Clean(path)] {
+				return nil
+			}
+		case strings.HasPrefix(name, "backup-") && strings.HasSuffix(name, ".tmp"+manifest.Suffix):
+			// Manifest recebido com o backup, ao lado do .tmp da sessão
+			if tmpPaths[filepath.Clean(strings.TrimSuffix(path, manifest.Suffix))] {
+				return nil
+			}
+		default:
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			return nil
+		}
+		remove(path, "tmp", info.Size(), false)
+		return nil
+	})
+	return removed, reclaimed
+}
+
+// dirUsage soma o tamanho dos arquivos de dir e retorna a modificação mais
+// recente (do próprio dir ou de qualquer entrada dentro dele).
+func dirUsage(dir string) (int64, time.Time) {
+	var size int64
+	var newest time.Time
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		if !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, newest
+}
+
+// OrphanSweepStats retorna os totais dos sweeps de artefatos órfãos em
+// formato DTO, ou nil antes do primeiro sweep.
+func (h *Handler) OrphanSweepStats() *observability.OrphanSweepDTO {
+	runs := h.orphans.runs.Load()
+	if runs == 0 {
+		return nil
+	}
+	return &observability.OrphanSweepDTO{
+		Runs:           runs,
+		Removed:        h.orphans.removed.Load(),
+		ReclaimedBytes: h.orphans.bytes.Load(),
+		LastRunAt:      time.Unix(0, h.orphans.lastRun.Load()).UTC().Format(time.RFC3339),
+	}
+}
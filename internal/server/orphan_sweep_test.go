@@ -0,0 +1,120 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func writeAged(t *testing.T, path string, data string, age time.Duration) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSweepOrphans(t *testing.T) {
+	base := t.TempDir()
+	agentDir := filepath.Join(base, "agent-a", "home")
+	old := 3 * time.Hour
+
+	// Órfãos antigos
+	writeAged(t, filepath.Join(agentDir, "backup-dead.tmp"), "12345", old)
+	writeAged(t, filepath.Join(agentDir, "backup-dead.tmp.files.jsonl.gz"), "12", old)
+	writeAged(t, filepath.Join(agentDir, "assembled_dead.tmp"), "1234", old)
+	deadChunks := filepath.Join(agentDir, "chunks_dead")
+	writeAged(t, filepath.Join(deadChunks, "chunk_000000.tmp"), "123", old)
+	os.Chtimes(deadChunks, time.Now().Add(-old), time.Now().Add(-old))
+
+	// Devem ser mantidos: sessões ativas, órfão recente, backup commitado e quarentena
+	activeTmp := filepath.Join(agentDir, "backup-live.tmp")
+	writeAged(t, activeTmp, "live", old)
+	writeAged(t, filepath.Join(agentDir, "assembled_live.tmp"), "live", old)
+	writeAged(t, filepath.Join(agentDir, "chunks_live", "chunk_000000.tmp"), "live", old)
+	writeAged(t, filepath.Join(agentDir, "backup-recent.tmp"), "recent", time.Minute)
+	writeAged(t, filepath.Join(agentDir, "backup-2025-01-01T00-00-00.tar.gz"), "done", old)
+	writeAged(t, filepath.Join(agentDir, quarantineDirName, "backup-q.tmp"), "q", old)
+
+	sessions := &sync.Map{}
+	sessions.Store("single-live", &PartialSession{TmpPath: activeTmp})
+	sessions.Store("live", &ParallelSession{SessionID: "live"})
+
+	h := &Handler{
+		sessions: sessions,
+		cfg: &config.ServerConfig{Storages: map[string]config.StorageInfo{
+			"default": {BaseDir: base, SessionTTL: time.Hour},
+		}},
+	}
+
+	if h.OrphanSweepStats() != nil {
+		t.Fatal("expected nil stats before the first sweep")
+	}
+
+	reclaimed := h.SweepOrphans(slog.Default())
+	if reclaimed != 5+2+4+3 {
+		t.Errorf("expected 14 bytes reclaimed, got %d", reclaimed)
+	}
+
+	for _, gone := range []string{"backup-dead.tmp", "backup-dead.tmp.files.jsonl.gz", "assembled_dead.tmp", "chunks_dead"} {
+		if _, err := os.Stat(filepath.Join(agentDir, gone)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been removed", gone)
+		}
+	}
+	for _, kept := range []string{"backup-live.tmp", "assembled_live.tmp", "chunks_live", "backup-recent.tmp", "backup-2025-01-01T00-00-00.tar.gz", filepath.Join(quarantineDirName, "backup-q.tmp")} {
+		if _, err := os.Stat(filepath.Join(agentDir, kept)); err != nil {
+			t.Errorf("%s should have been kept: %v", kept, err)
+		}
+	}
+
+	stats := h.OrphanSweepStats()
+	if stats == nil || stats.Runs != 1 || stats.Removed != 4 || stats.ReclaimedBytes != 14 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCleanupExpiredSessions_StorageSessionTTL(t *testing.T) {
+	dir := t.TempDir()
+	sessions := &sync.Map{}
+
+	for _, name := range []string{"short", "long"} {
+		s := &PartialSession{
+			TmpPath:     filepath.Join(dir, name+".tmp"),
+			StorageName: name,
+			CreatedAt:   time.Now().Add(-2 * time.Hour),
+		}
+		s.LastActivity.Store(time.Now().Add(-2 * time.Hour).UnixNano())
+		sessions.Store(name, s)
+	}
+
+	h := &Handler{
+		sessions: sessions,
+		cfg: &config.ServerConfig{Storages: map[string]config.StorageInfo{
+			"short": {BaseDir: dir, SessionTTL: time.Hour},
+			"long":  {BaseDir: dir, SessionTTL: 6 * time.Hour},
+		}},
+	}
+	h.CleanupExpiredSessions(24*time.Hour, slog.Default())
+
+	if _, ok := sessions.Load("short"); ok {
+		t.Error("session on storage with 1h session_ttl should have expired")
+	}
+	if _, ok := sessions.Load("long"); !ok {
+		t.Error("session on storage with 6h session_ttl should still exist")
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// preallocateHint retorna quantos bytes reservar para o arquivo montado de
+// um backup paralelo em agentDir (0 = sem reserva).
+func preallocateHint(si config.StorageInfo, agentDir string) int64 {
+	if !si.Preallocate {
+		return 0
+	}
+	return lastBackupSize(agentDir)
+}
+
+// lastBackupSize retorna o tamanho do backup mais recente em agentDir, usado
+// como estimativa do próximo para storages.*.preallocate (0 = sem histórico).
+// Só archives contam: os manifests de storages dedup não estimam o tar.
+func lastBackupSize(agentDir string) int64 {
+	backups, err := listBackups(agentDir)
+	if err != nil {
+		return 0
+	}
+	latest := ""
+	for _, b := range backups {
+		if strings.HasSuffix(b.Name, ".tar.gz") || strings.HasSuffix(b.Name, ".tar.zst") {
+			latest = b.Rel
+		}
+	}
+	if latest == "" {
+		return 0
+	}
+	fi, err := os.Stat(filepath.Join(agentDir, latest))
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// releasePreallocation devolve os blocos reservados além do fim de f
+// (truncar para o próprio tamanho libera os extents após o EOF).
+func releasePreallocation(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return f.Truncate(fi.Size())
+}
+
+// pageCacheDropWindow é a granularidade do descarte de page cache: cada
+// janela escrita tem o writeback iniciado e, na janela seguinte, é esperada
+// e removida do cache.
+const pageCacheDropWindow = 64 * 1024 * 1024
+
+// pageCacheDropWriter escreve em f e remove do page cache o que já foi
+// gravado em disco (storages.*.drop_page_cache), para que ingests de vários
+// TB não expulsem do cache o resto do servidor. As chamadas são advisory:
+// falhas não interrompem a escrita.
+type pageCacheDropWriter struct {
+	f       *os.File
+	off     int64 // bytes escritos
+	started int64 // início da janela corrente (writeback não iniciado)
+	dropped int64 // bytes já removidos do cache
+}
+
+func (w *pageCacheDropWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.off += int64(n)
+	if w.off-w.started >= pageCacheDropWindow {
+		startWriteback(w.f, w.started, w.off-w.started)
+		if w.started > w.dropped {
+			dropPageCache(w.f, w.dropped, w.started-w.dropped)
+			w.dropped = w.started
+		}
+		w.started = w.off
+	}
+	return n, err
+}
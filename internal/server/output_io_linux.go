@@ -0,0 +1,31 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocateFile reserva size bytes para f sem alterar o tamanho aparente
+// (FALLOC_FL_KEEP_SIZE): o arquivo cresce nos writes normalmente, mas em
+// extents contíguos. O excedente é liberado por releasePreallocation.
+func preallocateFile(f *os.File, size int64) error {
+	return unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_KEEP_SIZE, 0, size)
+}
+
+// startWriteback inicia o writeback de [off, off+n) de f sem esperar.
+func startWriteback(f *os.File, off, n int64) {
+	unix.SyncFileRange(int(f.Fd()), off, n, unix.SYNC_FILE_RANGE_WRITE)
+}
+
+// dropPageCache espera o writeback de [off, off+n) de f e o remove do page cache.
+func dropPageCache(f *os.File, off, n int64) {
+	fd := int(f.Fd())
+	unix.SyncFileRange(fd, off, n,
+		unix.SYNC_FILE_RANGE_WAIT_BEFORE|unix.SYNC_FILE_RANGE_WRITE|unix.SYNC_FILE_RANGE_WAIT_AFTER)
+	unix.Fadvise(fd, off, n, unix.FADV_DONTNEED)
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// Fora do Linux, preallocate e drop_page_cache não têm efeito (o preallocate
+// é logado como falha e ignorado).
+
+func preallocateFile(f *os.File, size int64) error {
+	return errors.ErrUnsupported
+}
+
+func startWriteback(f *os.File, off, n int64) {}
+
+func dropPageCache(f *os.File, off, n int64) {}
@@ -0,0 +1,83 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestPreallocateHint_UsesLatestArchive(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "2025-01-01T00-00-00-000.tar.gz"), make([]byte, 300), 0644)
+	os.WriteFile(filepath.Join(dir, "2025-01-02T00-00-00-000.tar.zst"), make([]byte, 200), 0644)
+	os.WriteFile(filepath.Join(dir, "2025-01-02T00-00-00-000.tar.zst.manifest"), make([]byte, 900), 0644)
+
+	if got := preallocateHint(config.StorageInfo{}, dir); got != 0 {
+		t.Errorf("expected no hint with preallocate disabled, got %d", got)
+	}
+	if got := preallocateHint(config.StorageInfo{Preallocate: true}, dir); got != 200 {
+		t.Errorf("expected the latest backup size 200, got %d", got)
+	}
+	if got := preallocateHint(config.StorageInfo{Preallocate: true}, t.TempDir()); got != 0 {
+		t.Errorf("expected no hint without previous backups, got %d", got)
+	}
+}
+
+func TestChunkAssembler_PreallocateAndDropPageCache(t *testing.T) {
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	const reserve = 8 * 1024 * 1024
+
+	ca, err := NewChunkAssemblerWithOptions("test-prealloc", dir, logger, ChunkAssemblerOptions{
+		Preallocate:   reserve,
+		DropPageCache: true,
+	})
+	if err != nil {
+		t.Fatalf("NewChunkAssemblerWithOptions: %v", err)
+	}
+	defer ca.Cleanup()
+	if !ca.preallocated {
+		t.Skip("fallocate not supported by the test filesystem")
+	}
+	if blocks := allocatedBytes(t, ca.outPath); blocks < reserve {
+		t.Fatalf("expected %d bytes reserved, got %d", reserve, blocks)
+	}
+
+	data := bytes.Repeat([]byte("assembled "), 10000)
+	if err := ca.WriteChunk(0, bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("WriteChunk: %v", err)
+	}
+	path, total, err := ca.Finalize()
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	if total != int64(len(data)) {
+		t.Errorf("expected totalBytes=%d, got %d", len(data), total)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, data) {
+		t.Error("assembled content mismatch")
+	}
+	if blocks := allocatedBytes(t, path); blocks >= reserve {
+		t.Errorf("expected the reservation beyond EOF to be released, %d bytes still allocated", blocks)
+	}
+}
+
+// allocatedBytes retorna os bytes alocados em disco para path.
+func allocatedBytes(t *testing.T, path string) int64 {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Sys().(*syscall.Stat_t).Blocks * 512
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// parallel_resume.go retoma sessões paralelas interrompidas por um restart do
+// server ou do agent.
+//
+// Os ChunkSACKs confirmam chunks que podem estar só em memória (ChunkBuffer,
+// pendentes fora de ordem), então os offsets dos streams não sobrevivem a um
+// restart. O ponto de retomada é o checkpoint do ChunkAssembler: o prefixo
+// contíguo do arquivo montado, com fsync, persistido periodicamente em
+// server.sessions_file. No RESUME, o server responde com o checkpoint
+// (ResumeACK + ParallelResume), o agent regenera o stream descartando os bytes
+// já montados e numera os chunks a partir dele, e os streams entram de novo
+// via ParallelJoin a partir do offset 0. A conexão do RESUME passa a ser a
+// primária da sessão: é por ela que chegam o Trailer e sai o FinalACK.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// parallelCheckpointInterval é o intervalo entre checkpoints do arquivo
+// montado persistidos em server.sessions_file.
+const parallelCheckpointInterval = 30 * time.Second
+
+// parallelHandoverTimeout limita a espera pelo lock agent:storage:backup da
+// goroutine primária que liberou a sessão assumida por um RESUME.
+const parallelHandoverTimeout = 10 * time.Second
+
+// startCheckpoints persiste o checkpoint do arquivo montado no início e a cada
+// parallelCheckpointInterval, para que a sessão seja retomável após um
+// restart do server. Sem server.sessions_file não há o que persistir. A
+// função retornada interrompe os checkpoints e espera o último terminar.
+func (h *Handler) startCheckpoints(ps *ParallelSession, logger *slog.Logger) func() {
+	if h.sessionStore == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(parallelCheckpointInterval)
+		defer ticker.Stop()
+		for {
+			h.checkpointParallelSession(ps, logger)
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			wg.Wait()
+		})
+	}
+}
+
+// checkpointParallelSession grava o checkpoint do assembler e atualiza o
+// registro persistido da sessão.
+func (h *Handler) checkpointParallelSession(ps *ParallelSession, logger *slog.Logger) {
+	cp, ok, err := ps.Assembler.Checkpoint()
+	if err != nil {
+		logger.Warn("checkpointing assembled file", "error", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	ps.Checkpoint.Store(&cp)
+	h.refreshSession(ps.SessionID, ps)
+}
+
+// releaseParallelSession entrega a sessão ao RESUME que a assumiu (ver
+// takeOverParallelSession), mantendo o staging a partir do checkpoint. Se o
+// checkpoint falhar, a sessão é abortada.
+func (h *Handler) releaseParallelSession(ps *ParallelSession, logger *slog.Logger) {
+	logger.Info("parallel session taken over by resume, releasing it")
+	if err := h.detachParallelSession(ps); err != nil {
+		logger.Error("releasing parallel session for resume failed, aborting it", "error", err)
+		ps.abort(fmt.Errorf("releasing for resume: %w", err))
+		h.recordSessionEnd(ps.SessionID, ps.AgentName, ps.StorageName, ps.BackupName, "parallel",
+			ps.StorageInfo.CompressionMode, "aborted", ps.CreatedAt, ps.DiskWriteBytes.Load(), ps.Config, ps.streamTransfers())
+		h.deleteSession(ps.SessionID)
+		return
+	}
+	ps.handedOver.Store(true)
+}
+
+// suspendParallelSession encerra a sessão no shutdown do server mantendo o
+// registro em server.sessions_file com o checkpoint final, para o RESUME após
+// o restart. Sem checkpoint (assembler_mode lazy), a sessão é removida.
+func (h *Handler) suspendParallelSession(conn net.Conn, ps *ParallelSession, logger *slog.Logger) {
+	if h.sessionStore != nil {
+		err := h.detachParallelSession(ps)
+		if err == nil {
+			h.refreshSession(ps.SessionID, ps)
+			cp := ps.Checkpoint.Load()
+			logger.Info("server shutting down, parallel session kept for resume", "next_seq", cp.NextSeq, "bytes", cp.Bytes)
+			return
+		}
+		logger.Warn("parallel session cannot be kept for resume", "error", err)
+	}
+	h.deleteSession(ps.SessionID)
+	protocol.WriteFinalACK(conn, protocol.FinalStatusWriteError)
+}
+
+// detachParallelSession encerra os streams, descarrega os chunks em trânsito
+// e grava o checkpoint de onde a sessão continua, fechando o arquivo montado
+// sem removê-lo.
+func (h *Handler) detachParallelSession(ps *ParallelSession) error {
+	ps.Closing.Store(true)
+	ps.closeSlots()
+	ps.StreamWg.Wait()
+
+	if h.chunkBuffer != nil {
+		if err := h.chunkBuffer.Flush(ps.Assembler); err != nil {
+			return fmt.Errorf("flushing chunk buffer: %w", err)
+		}
+	}
+	cp, ok, err := ps.Assembler.Checkpoint()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("assembler mode %q cannot be resumed", ps.StorageInfo.AssemblerMode)
+	}
+	ps.Assembler.Release()
+	ps.Checkpoint.Store(&cp)
+	return nil
+}
+
+// handleParallelResume retoma uma sessão paralela pelo RESUME do agent, após
+// um restart do server (sessão restaurada de server.sessions_file) ou do
+// agent (sessão ainda ativa, liberada pela goroutine primária).
+func (h *Handler) handleParallelResume(ctx context.Context, conn net.Conn, resume *protocol.Resume, pSession *ParallelSession, logger *slog.Logger) {
+	// O agent repete no resume o storage do handshake, que pode ser um placement
+	if pSession.AgentName != resume.AgentName || (pSession.StorageName != resume.StorageName && (pSession.Placement == "" || pSession.Placement != resume.StorageName)) {
+		logger.Warn("resume session mismatch",
+			"expected_agent", pSession.AgentName, "got_agent", resume.AgentName,
+			"expected_storage", pSession.StorageName, "got_storage", resume.StorageName)
+		protocol.WriteResumeACK(conn, protocol.ResumeStatusNotFound, 0)
+		return
+	}
+
+	session, err := h.takeOverParallelSession(pSession, logger)
+	if err != nil {
+		logger.Warn("parallel session cannot be resumed", "error", err)
+		protocol.WriteResumeACK(conn, protocol.ResumeStatusNotFound, 0)
+		return
+	}
+
+	lockKey := session.AgentName + ":" + session.StorageName + ":" + session.BackupName
+	if !h.waitLock(lockKey, parallelHandoverTimeout) {
+		logger.Warn("backup already in progress for agent during resume")
+		session.claimed.Store(false)
+		session.Detached.Store(true)
+		protocol.WriteResumeACK(conn, protocol.ResumeStatusNotFound, 0)
+		return
+	}
+	defer h.locks.Delete(lockKey)
+
+	logger, sessionLogPath, closeSessionLog := h.openSessionLog(logger.With("mode", "parallel", "maxStreams", session.MaxStreams), session.AgentName, session.SessionID)
+	defer closeSessionLog()
+	session.Logger = logger
+
+	cp := session.Checkpoint.Load()
+	h.Audit.Begin(lockKey, observability.AuditRecord{
+		SessionID: session.SessionID, Event: observability.AuditResume,
+		Agent: session.AgentName, Storage: session.StorageName, Backup: session.BackupName, Placement: session.Placement,
+		ClientVersion: session.ClientVersion, RemoteAddr: conn.RemoteAddr().String(),
+		Mode: "parallel", MaxStreams: session.MaxStreams, ChunkSize: session.ChunkSize, Offset: cp.Bytes,
+	})
+
+	// Anexada antes do ACK: o agent manda os ParallelJoin assim que o recebe
+	session.Detached.Store(false)
+	session.LastActivity.Store(time.Now().UnixNano())
+	if err := protocol.WriteResumeACK(conn, protocol.ResumeStatusOK, uint64(cp.Bytes)); err == nil {
+		err = protocol.WriteParallelResume(conn, cp.NextSeq)
+	}
+	if err != nil {
+		logger.Error("writing resume ack", "error", err)
+		session.Detached.Store(true)
+		session.claimed.Store(false)
+		return
+	}
+	logger.Info("parallel resume accepted", "next_seq", cp.NextSeq, "last_offset", cp.Bytes)
+
+	h.serveParallelSession(ctx, conn, conn, session, lockKey, sessionLogPath, logger)
+}
+
+// takeOverParallelSession assume a sessão para um RESUME e retorna a sessão a
+// retomar. Uma sessão restaurada (Detached) é usada como está; uma ativa é
+// liberada pela goroutine primária e remontada a partir do checkpoint. Falha
+// se outro RESUME já a assumiu ou se ela não é retomável (ingestão concluída,
+// assembler_mode lazy).
+func (h *Handler) takeOverParallelSession(ps *ParallelSession, logger *slog.Logger) (*ParallelSession, error) {
+	if !ps.claimed.CompareAndSwap(false, true) {
+		return nil, errors.New("session is already being resumed")
+	}
+	if ps.Detached.Load() {
+		return ps, nil
+	}
+	if phase := ps.Phase.Get(); phase != PhaseReceiving {
+		ps.claimed.Store(false)
+		return nil, fmt.Errorf("session is %s", phase)
+	}
+
+	ps.handoverOnce.Do(func() { close(ps.handover) })
+	<-ps.released
+	if !ps.handedOver.Load() {
+		return nil, errors.New("session ended before the handover")
+	}
+
+	r, _ := newSessionRecord(ps.SessionID, ps)
+	session, err := h.newResumedParallelSession(r, logger)
+	if err != nil {
+		removeParallelStaging(r.AgentDir, r.SessionID)
+		h.deleteSession(ps.SessionID)
+		return nil, err
+	}
+	session.claimed.Store(true)
+	h.storeSession(session.SessionID, session)
+	return session, nil
+}
+
+// newResumedParallelSession remonta uma sessão paralela a partir do registro
+// persistido, reabrindo o staging no checkpoint.
+func (h *Handler) newResumedParallelSession(r sessionRecord, logger *slog.Logger) (*ParallelSession, error) {
+	if r.Checkpoint == nil {
+		return nil, errors.New("session has no checkpoint (assembler_mode lazy)")
+	}
+	storageInfo, ok := h.config().GetStorage(r.StorageName)
+	if !ok {
+		return nil, fmt.Errorf("storage %q not found", r.StorageName)
+	}
+	writer, err := NewStorageWriter(storageInfo, r.AgentName, r.BackupName)
+	if err != nil {
+		return nil, err
+	}
+	// O staging foi montado em modo eager (só ele tem checkpoint), mesmo que
+	// o storage tenha mudado de assembler_mode desde então
+	opts := h.assemblerOptions(r.StorageName, storageInfo, writer.AgentDir())
+	opts.Mode = AssemblerModeEager
+	assembler, err := ResumeChunkAssembler(r.SessionID, writer.AgentDir(), logger, opts, *r.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := newParallelSession(r.SessionID, r.MaxStreams, r.CreatedAt)
+	ps.Assembler = assembler
+	ps.Writer = writer
+	ps.StorageInfo = storageInfo
+	ps.AgentName = r.AgentName
+	ps.StorageName = r.StorageName
+	ps.Placement = r.Placement
+	ps.BackupName = r.BackupName
+	ps.ClientVersion = r.ClientVersion
+	ps.ChunkSize = r.ChunkSize
+	ps.ChunkSizeMax = r.ChunkSizeMax
+	ps.Config = r.Config
+	ps.Logger = logger
+	ps.Checkpoint.Store(r.Checkpoint)
+	ps.DiskWriteBytes.Store(r.Checkpoint.Bytes)
+	return ps, nil
+}
+
+// waitLock adquire o lock agent:storage:backup, esperando até timeout que o
+// dono anterior (a goroutine primária de uma sessão assumida) o libere.
+func (h *Handler) waitLock(lockKey string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, loaded := h.locks.LoadOrStore(lockKey, true); !loaded {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/agent"
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+)
+
+// restartableServer atende um listener com um Handler que pode ser trocado,
+// simulando o restart do server no mesmo endereço.
+type restartableServer struct {
+	cfg    *config.ServerConfig
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	h      *Handler
+	ctx    context.Context
+	cancel context.CancelFunc
+	conns  []net.Conn
+}
+
+func (s *restartableServer) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		h, ctx := s.h, s.ctx
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		go h.HandleConnection(ctx, conn)
+	}
+}
+
+// restart encerra o handler atual — as sessões paralelas gravam o checkpoint
+// final — e sobe outro com o mesmo server.sessions_file.
+func (s *restartableServer) restart(t *testing.T) *Handler {
+	t.Helper()
+	s.mu.Lock()
+	old, cancel, conns := s.h, s.cancel, s.conns
+	s.mu.Unlock()
+	if old != nil {
+		var sessions []*ParallelSession
+		old.sessions.Range(func(_, value any) bool {
+			if ps, ok := value.(*ParallelSession); ok {
+				sessions = append(sessions, ps)
+			}
+			return true
+		})
+		cancel()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		for _, ps := range sessions {
+			<-ps.released
+		}
+	}
+
+	h := NewHandler(s.cfg, s.logger, &sync.Map{}, &sync.Map{})
+	if err := h.OpenSessionStore(s.cfg.Server.SessionsFile, s.logger); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancelNew := context.WithCancel(context.Background())
+	t.Cleanup(cancelNew)
+	s.mu.Lock()
+	s.h, s.ctx, s.cancel, s.conns = h, ctx, cancelNew, nil
+	s.mu.Unlock()
+	return h
+}
+
+func (s *restartableServer) handler() *Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.h
+}
+
+// TestParallelResume_AfterAgentRestart interrompe um backup paralelo no meio
+// (shutdown do agent) e o retoma numa nova execução, que continua a sessão
+// original a partir do checkpoint do server e termina com o checksum do
+// archive inteiro.
+func TestParallelResume_AfterAgentRestart(t *testing.T) {
+	testParallelResume(t, false)
+}
+
+// TestParallelResume_AfterServerAndAgentRestart repete a retomada com o
+// server reiniciado entre as execuções (server.sessions_file).
+func TestParallelResume_AfterServerAndAgentRestart(t *testing.T) {
+	testParallelResume(t, true)
+}
+
+func testParallelResume(t *testing.T, restartServer bool) {
+	cfg, _ := setupEnrollPKI(t)
+	storageDir := t.TempDir()
+	cfg.Storages = map[string]config.StorageInfo{"default": {BaseDir: storageDir, MaxBackups: 3}}
+	cfg.Server.SessionsFile = filepath.Join(t.TempDir(), "sessions.jsonl")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ca, err := pki.LoadCA(cfg.TLS.CACert, cfg.Enrollment.CAKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader, err := pki.NewCertReloader(cfg.TLS.CACert, cfg.TLS.ServerCert, cfg.TLS.ServerKey, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", reloader.ServerTLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	srv := &restartableServer{cfg: cfg, logger: logger}
+	srv.restart(t)
+	go srv.serve(ln)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	// Fonte incompressível com bandwidth_limit: o backup dura alguns segundos
+	dir := t.TempDir()
+	keyPEM, csrPEM, err := pki.NewClientCSR("pipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := ca.SignClientCSR(csrPEM, "pipe", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "agent.pem"), certPEM, 0644)
+	os.WriteFile(filepath.Join(dir, "agent-key.pem"), keyPEM, 0600)
+	data := make([]byte, 768*1024)
+	rand.Read(data)
+	os.MkdirAll(filepath.Join(dir, "home"), 0755)
+	os.WriteFile(filepath.Join(dir, "home", "data.bin"), data, 0644)
+
+	cfgPath := filepath.Join(dir, "agent.yaml")
+	os.WriteFile(cfgPath, []byte(fmt.Sprintf(`
+agent:
+  name: pipe
+server:
+  address: %q
+tls:
+  ca_cert: %q
+  client_cert: %q
+  client_key: %q
+daemon:
+  state_dir: %q
+  control_channel:
+    keepalive_interval: 1s
+resume:
+  chunk_size: 64kb
+backups:
+  - name: home
+    storage: default
+    schedule: "0 2 * * *"
+    parallels: 2
+    bandwidth_limit: 192kb
+    sources:
+      - path: %q
+`, ln.Addr().String(), cfg.TLS.CACert, filepath.Join(dir, "agent.pem"), filepath.Join(dir, "agent-key.pem"),
+		filepath.Join(dir, "state"), filepath.Join(dir, "home"))), 0600)
+	agentCfg, err := config.LoadAgentConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("loading agent config: %v", err)
+	}
+	entry := agentCfg.Backups[0]
+
+	controlCh := agent.NewControlChannel(agentCfg, logger)
+	controlCh.Start()
+	defer controlCh.Stop()
+	waitConnected := func() {
+		for !controlCh.IsConnected() {
+			if ctx.Err() != nil {
+				t.Fatal("control channel did not connect")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitConnected()
+
+	// 1ª execução: interrompida depois que o server recebeu parte do stream
+	firstCtx, stopFirst := context.WithCancel(ctx)
+	firstDone := make(chan error, 1)
+	go func() { firstDone <- agent.RunBackup(firstCtx, agentCfg, entry, logger, nil, nil, controlCh) }()
+	var sessionID string
+	for sessionID == "" {
+		if ctx.Err() != nil {
+			t.Fatal("parallel session did not receive data")
+		}
+		srv.handler().sessions.Range(func(key, value any) bool {
+			if ps, ok := value.(*ParallelSession); ok && ps.DiskWriteBytes.Load() >= 192*1024 {
+				sessionID = key.(string)
+			}
+			return true
+		})
+		time.Sleep(10 * time.Millisecond)
+	}
+	stopFirst()
+	if err := <-firstDone; err == nil {
+		t.Fatal("expected the interrupted run to fail")
+	}
+
+	if restartServer {
+		srv.restart(t)
+		raw, ok := srv.handler().sessions.Load(sessionID)
+		if !ok {
+			t.Fatal("expected the parallel session restored after server restart")
+		}
+		if cp := raw.(*ParallelSession).Checkpoint.Load(); cp == nil || cp.Bytes == 0 {
+			t.Fatalf("expected a non-empty checkpoint, got %+v", cp)
+		}
+		// O control channel reconecta no novo server
+		for {
+			if _, ok := srv.handler().controlConns.Load("pipe"); ok {
+				break
+			}
+			if ctx.Err() != nil {
+				t.Fatal("control channel did not reconnect")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// 2ª execução: retoma a mesma sessão em vez de abrir outra
+	seen := make(map[string]bool)
+	var seenMu sync.Mutex
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		for watchCtx.Err() == nil {
+			srv.handler().sessions.Range(func(key, value any) bool {
+				if _, ok := value.(*ParallelSession); ok {
+					seenMu.Lock()
+					seen[key.(string)] = true
+					seenMu.Unlock()
+				}
+				return true
+			})
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	err = agent.RunBackup(ctx, agentCfg, entry, logger, nil, nil, controlCh)
+	stopWatch()
+	<-watchDone
+	if err != nil {
+		t.Fatalf("resumed backup: %v", err)
+	}
+	if len(seen) != 1 || !seen[sessionID] {
+		t.Errorf("expected only the original session %s, saw %v", sessionID, seen)
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(storageDir, "pipe", "home", "*.tar.gz"))
+	if len(backups) != 1 {
+		t.Errorf("expected one committed backup, got %v", backups)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// peercred.go atende listeners em socket unix (listen: unix:<caminho>) para
+// agents do mesmo host ou sidecars com o socket montado.
+//
+// Não há TLS nem desafio PSK: o kernel informa o uid do processo conectado
+// (SO_PEERCRED) e listeners[].peer_agents o mapeia para o nome do agent. A
+// conexão segue como auth.Identified, então authorizeAgent, allow-lists e
+// sessões tratam o agent como qualquer outro.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+
+	"github.com/nishisan-dev/n-backup/internal/auth"
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// errPeerNotMapped recusa processos cujo uid não está em peer_agents.
+var errPeerNotMapped = errors.New("uid not in listeners.peer_agents")
+
+// peerCredConn é uma conexão unix cujo agent foi identificado pelo uid do
+// processo conectado.
+type peerCredConn struct {
+	net.Conn
+	agent string
+	uid   uint32
+	pid   int32
+}
+
+// Identity implementa auth.Identified. Sem SO_PEERCRED lido (pid 0) a
+// credencial é "unknown peer".
+func (c *peerCredConn) Identity() auth.Identity {
+	id := auth.Identity{Method: auth.MethodPeerCred, Name: c.agent, Credential: "unknown peer"}
+	if c.pid != 0 {
+		id.Credential = fmt.Sprintf("uid %d pid %d", c.uid, c.pid)
+	}
+	return id
+}
+
+// peerCredListener aceita conexões de um socket unix e só entrega ao
+// acceptLoop as de processos mapeados em peer_agents; as demais são
+// recusadas (log + evento agent_rejected) e fechadas.
+type peerCredListener struct {
+	net.Listener
+	agents map[uint32]string // uid → agent
+	h      *Handler
+	logger *slog.Logger
+}
+
+// listenUnix abre o socket unix do listener com a permissão de socket_mode.
+// Um socket órfão de uma execução anterior é removido; qualquer outro tipo de
+// arquivo no caminho é erro.
+func listenUnix(lc config.ListenerConfig, h *Handler, logger *slog.Logger) (net.Listener, error) {
+	path, _ := lc.UnixPath()
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket %s: %w", path, err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, lc.SocketModeRaw); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("setting socket_mode on %s: %w", path, err)
+	}
+	return &peerCredListener{Listener: ln, agents: lc.PeerAgentsRaw, h: h, logger: logger}, nil
+}
+
+// Accept retorna a próxima conexão de um processo mapeado em peer_agents.
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		pc, err := l.identify(conn)
+		if err != nil {
+			l.h.rejectAgent(pc.Identity(), err, "peercred", l.logger)
+			conn.Close()
+			continue
+		}
+		return pc, nil
+	}
+}
+
+// identify lê o SO_PEERCRED da conexão e resolve o agent pelo uid. Em erro,
+// a conexão retornada ainda carrega uid e pid (quando lidos) para o log.
+func (l *peerCredListener) identify(conn net.Conn) (*peerCredConn, error) {
+	pc := &peerCredConn{Conn: conn}
+	uid, pid, err := peerCred(conn)
+	if err != nil {
+		return pc, fmt.Errorf("reading SO_PEERCRED: %w", err)
+	}
+	pc.uid, pc.pid = uid, pid
+	agent, ok := l.agents[uid]
+	if !ok {
+		return pc, errPeerNotMapped
+	}
+	pc.agent = agent
+	return pc, nil
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCred: SO_PEERCRED só existe no Linux; fora dele toda conexão do
+// listener unix é recusada como não identificada.
+func peerCred(conn net.Conn) (uid uint32, pid int32, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/auth"
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestListenUnix_PeerCred(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := &Handler{cfg: &config.ServerConfig{}, logger: logger}
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	uid := uint32(os.Getuid())
+
+	// Socket órfão de uma execução anterior é substituído
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	lc := config.ListenerConfig{
+		Name:          "local",
+		Listen:        "unix:" + path,
+		Auth:          config.AuthModePeerCred,
+		PeerAgentsRaw: map[uint32]string{uid: "host-01"},
+		SocketModeRaw: 0o600,
+	}
+	ln, err := listenUnix(lc, h, logger)
+	if err != nil {
+		t.Fatalf("listenUnix: %v", err)
+	}
+	defer ln.Close()
+
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("expected socket with mode 0600, got %v (err=%v)", fi.Mode().Perm(), err)
+	}
+
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	defer conn.Close()
+	id, ok := auth.FromConn(conn)
+	if !ok || id.Method != auth.MethodPeerCred || id.Name != "host-01" {
+		t.Fatalf("unexpected identity: %+v (ok=%v)", id, ok)
+	}
+	if got := h.extractAgentName(conn, logger); got != "host-01" {
+		t.Errorf("expected agent name host-01, got %q", got)
+	}
+}
+
+func TestListenUnix_RejectsUnmappedPeer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := &Handler{cfg: &config.ServerConfig{}, logger: logger}
+	path := filepath.Join(t.TempDir(), "agent.sock")
+
+	lc := config.ListenerConfig{
+		Name:          "local",
+		Listen:        "unix:" + path,
+		PeerAgentsRaw: map[uint32]string{uint32(os.Getuid()) + 1: "other"},
+		SocketModeRaw: 0o660,
+	}
+	ln, err := listenUnix(lc, h, logger)
+	if err != nil {
+		t.Fatalf("listenUnix: %v", err)
+	}
+
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		accepted <- err
+	}()
+
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	// O server fecha a conexão sem entregá-la ao acceptLoop
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected connection closed by server, got %v", err)
+	}
+	ln.Close()
+	if err := <-accepted; err == nil {
+		t.Fatal("expected unmapped peer not to be accepted")
+	}
+}
+
+func TestListenUnix_RefusesNonSocketPath(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lc := config.ListenerConfig{Name: "local", Listen: "unix:" + path, SocketModeRaw: 0o660}
+	if _, err := listenUnix(lc, &Handler{logger: logger}, logger); err == nil {
+		t.Fatal("expected error for a regular file at the socket path")
+	}
+}
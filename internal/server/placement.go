@@ -0,0 +1,138 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// placement.go resolve os placements (config placements): o agent pede um
+// placement no campo storage do handshake e o server escolhe o storage real
+// conforme a policy — spread alterna os failure domains entre as execuções
+// sucessivas do mesmo agent/backup, pin fixa cada agent/backup em um storage.
+
+package server
+
+import (
+	"hash/fnv"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// placementCandidate é um storage de um placement avaliado para um backup.
+type placementCandidate struct {
+	name      string
+	info      config.StorageInfo
+	latest    string // nome do backup mais recente do agent/backup no storage ("" = nenhum)
+	available bool   // aceitaria o handshake agora (janela, saúde do disco, capacidade)
+}
+
+// resolvePlacement traduz o storage pedido no handshake. Se name é um
+// placement, retorna o storage escolhido para agent/backup e true em
+// placed; senão devolve name inalterado.
+func (h *Handler) resolvePlacement(name, agent, backup string) (storage string, policy string, placed bool) {
+	cfg := h.config()
+	p, ok := cfg.GetPlacement(name)
+	if !ok {
+		return name, "", false
+	}
+
+	policy = p.PolicyFor(backup)
+	if policy == config.PlacementPin {
+		return pinStorage(p.Storages, agent, backup), policy, true
+	}
+
+	candidates := make([]placementCandidate, 0, len(p.Storages))
+	for _, s := range p.Storages {
+		si, _ := cfg.GetStorage(s)
+		candidates = append(candidates, placementCandidate{
+			name:      s,
+			info:      si,
+			latest:    latestBackup(filepath.Join(si.BaseDir, agent, backup)),
+			available: h.storageAvailable(s, si),
+		})
+	}
+	return spreadStorage(candidates), policy, true
+}
+
+// pinStorage escolhe de forma estável (hash de agent/backup) um dos storages.
+func pinStorage(storages []string, agent, backup string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(agent + "/" + backup))
+	return storages[hash.Sum32()%uint32(len(storages))]
+}
+
+// spreadStorage escolhe o storage do failure domain que recebeu o backup
+// mais recente há mais tempo (ou nunca recebeu), preferindo os disponíveis.
+// Dentro do domain, vale o mesmo critério entre os storages; empates seguem
+// a ordem da config.
+func spreadStorage(candidates []placementCandidate) string {
+	domainLatest := make(map[string]string)
+	for _, c := range candidates {
+		if d := c.info.FailureDomain; c.latest > domainLatest[d] {
+			domainLatest[d] = c.latest
+		}
+	}
+
+	ordered := append([]placementCandidate(nil), candidates...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.available != b.available {
+			return a.available
+		}
+		if da, db := domainLatest[a.info.FailureDomain], domainLatest[b.info.FailureDomain]; da != db {
+			return da < db
+		}
+		return a.latest < b.latest
+	})
+	return ordered[0].name
+}
+
+// storageAvailable indica se o storage aceitaria um handshake agora. Um
+// storage indisponível só é escolhido se nenhum outro do placement estiver
+// disponível — o handshake é então recusado com o status do storage.
+func (h *Handler) storageAvailable(name string, si config.StorageInfo) bool {
+	if w := si.BackupWindowRaw; w != nil && !w.Contains(time.Now()) {
+		return false
+	}
+	if readOnly, _ := h.storageReadOnly(name, si); readOnly {
+		return false
+	}
+	return checkStorageCapacity(si) == nil
+}
+
+// latestBackup retorna o nome do backup mais recente em agentDir (os nomes
+// começam com o timestamp do commit e ordenam cronologicamente), ou "" se
+// não há nenhum.
+func latestBackup(agentDir string) string {
+	backups, err := listBackups(agentDir)
+	if err != nil || len(backups) == 0 {
+		return ""
+	}
+	return backups[len(backups)-1].Name
+}
+
+// placementHealth responde o PSTG de um placement: Ready com o maior espaço
+// livre entre os storages disponíveis, ou LowDisk (com o maior espaço livre
+// entre todos) se nenhum estiver disponível.
+func (h *Handler) placementHealth(p config.PlacementConfig) (byte, uint64) {
+	cfg := h.config()
+	var free, freeAvailable uint64
+	anyAvailable := false
+	for _, s := range p.Storages {
+		si, _ := cfg.GetStorage(s)
+		c, err := statCapacity(si.BaseDir)
+		if err != nil {
+			continue
+		}
+		free = max(free, c.FreeBytes)
+		if checkStorageCapacity(si) == nil {
+			anyAvailable = true
+			freeAvailable = max(freeAvailable, c.FreeBytes)
+		}
+	}
+	if anyAvailable {
+		return protocol.HealthStatusReady, freeAvailable
+	}
+	return protocol.HealthStatusLowDisk, free
+}
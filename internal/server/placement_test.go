@@ -0,0 +1,103 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// newPlacementHandler cria um Handler com os storages a, b (failure domain
+// array-1) e c (array-2) e o placement "spread" sobre eles.
+func newPlacementHandler(t *testing.T) *Handler {
+	t.Helper()
+	storages := map[string]config.StorageInfo{
+		"a": {BaseDir: t.TempDir(), FailureDomain: "array-1"},
+		"b": {BaseDir: t.TempDir(), FailureDomain: "array-1"},
+		"c": {BaseDir: t.TempDir(), FailureDomain: "array-2"},
+	}
+	h := newTestHandler(t, storages)
+	h.cfg.Placements = []config.PlacementConfig{{
+		Name:     "spread",
+		Storages: []string{"a", "b", "c"},
+		Policy:   config.PlacementSpread,
+		Backups:  map[string]string{"logs": config.PlacementPin},
+	}}
+	return h
+}
+
+// commitBackup simula um backup commitado de agent/backup no storage.
+func commitBackup(t *testing.T, h *Handler, storage, agent, backup, name string) {
+	t.Helper()
+	si, _ := h.config().GetStorage(storage)
+	dir := filepath.Join(si.BaseDir, agent, backup)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolvePlacement_SpreadAlternatesFailureDomains(t *testing.T) {
+	h := newPlacementHandler(t)
+
+	var got []string
+	for i, ts := range []string{"2026-01-01", "2026-01-02", "2026-01-03", "2026-01-04"} {
+		storage, policy, placed := h.resolvePlacement("spread", "web-01", "daily")
+		if !placed || policy != config.PlacementSpread {
+			t.Fatalf("run %d: placed=%v policy=%q", i, placed, policy)
+		}
+		got = append(got, storage)
+		commitBackup(t, h, storage, "web-01", "daily", ts+"T02-00-00-000.tar.gz")
+	}
+
+	// a (array-1) → c (array-2) → b (array-1, nunca usado) → c
+	want := []string{"a", "c", "b", "c"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("placements = %v, want %v", got, want)
+		}
+	}
+
+	// Outro agent começa do zero, independente do histórico de web-01
+	if storage, _, _ := h.resolvePlacement("spread", "web-02", "daily"); storage != "a" {
+		t.Errorf("web-02 placed on %s, want a", storage)
+	}
+}
+
+func TestResolvePlacement_SkipsUnavailableStorage(t *testing.T) {
+	h := newPlacementHandler(t)
+	h.recordDiskHealth(t.Context(), "a", config.StorageInfo{}, DiskHealthFailing, "")
+	si := h.cfg.Storages["a"]
+	si.DiskHealth = config.DiskHealthConfig{Command: "true"}
+	h.cfg.Storages["a"] = si
+
+	if storage, _, _ := h.resolvePlacement("spread", "web-01", "daily"); storage == "a" {
+		t.Error("placement chose a read-only storage while others were available")
+	}
+}
+
+func TestResolvePlacement_PinAndPassthrough(t *testing.T) {
+	h := newPlacementHandler(t)
+
+	first, policy, placed := h.resolvePlacement("spread", "web-01", "logs")
+	if !placed || policy != config.PlacementPin {
+		t.Fatalf("placed=%v policy=%q, want pin", placed, policy)
+	}
+	commitBackup(t, h, first, "web-01", "logs", "2026-01-01T02-00-00-000.tar.gz")
+	for i := 0; i < 3; i++ {
+		if storage, _, _ := h.resolvePlacement("spread", "web-01", "logs"); storage != first {
+			t.Fatalf("pinned backup moved from %s to %s", first, storage)
+		}
+	}
+
+	if storage, _, placed := h.resolvePlacement("a", "web-01", "daily"); placed || storage != "a" {
+		t.Errorf("plain storage resolved to %q (placed=%v)", storage, placed)
+	}
+}
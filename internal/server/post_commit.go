@@ -74,7 +74,8 @@ func NewPostCommitOrchestrator(
 
 // Execute processa os buckets pós-commit.
 // finalPath: caminho do backup commitado.
-// rotatedFiles: nomes dos arquivos removidos pelo Rotate (sem path completo).
+// rotatedFiles: arquivos removidos pelo Rotate, relativos a agentDir (incluem
+// os diretórios de data de storages.*.layout; no bucket vale só o nome).
 // agentDir: diretório do agent onde reside o backup.
 //
 // Modos bloqueantes (offload) são aguardados antes do retorno.
@@ -169,7 +170,7 @@ func (o *PostCommitOrchestrator) executeSync(ctx context.Context, bt bucketTarge
 	if bt.cfg.SyncStrategy == config.SyncStrategySpaceEfficient {
 		// Delete primeiro para liberar espaço no bucket
 		for _, name := range rotatedFiles {
-			remoteKey := bt.cfg.Prefix + name
+			remoteKey := bt.cfg.Prefix + filepath.Base(name)
 			if err := bt.backend.Delete(ctx, remoteKey); err != nil {
 				logger.Warn("sync space_efficient: mirror delete failed (non-fatal)", "key", remoteKey, "error", err)
 			} else {
@@ -190,7 +191,7 @@ func (o *PostCommitOrchestrator) executeSync(ctx context.Context, bt bucketTarge
 
 	// Espelhar deletes do Rotate local
 	for _, name := range rotatedFiles {
-		remoteKey := bt.cfg.Prefix + name
+		remoteKey := bt.cfg.Prefix + filepath.Base(name)
 		if err := bt.backend.Delete(ctx, remoteKey); err != nil {
 			logger.Warn("sync mirror delete failed (non-fatal)", "key", remoteKey, "error", err)
 		} else {
@@ -218,6 +219,7 @@ func (o *PostCommitOrchestrator) executeOffload(ctx context.Context, bt bucketTa
 	} else {
 		logger.Info("offload: local file removed", "path", finalPath)
 	}
+	removeSidecars(finalPath) // manifest de arquivos e índice não vão para o bucket
 
 	// Rotate no bucket
 	if err := o.rotateBucket(ctx, bt, logger); err != nil {
@@ -236,7 +238,7 @@ func (o *PostCommitOrchestrator) executeArchive(ctx context.Context, bt bucketTa
 
 	for _, name := range rotatedFiles {
 		localPath := filepath.Join(agentDir, name)
-		remotePath := bt.cfg.Prefix + name
+		remotePath := bt.cfg.Prefix + filepath.Base(name)
 
 		// O arquivo pode já ter sido deletado pelo Rotate — tenta enviar se existir
 		if _, err := os.Stat(localPath); os.IsNotExist(err) {
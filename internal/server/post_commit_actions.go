@@ -0,0 +1,143 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// maxActionOutput limita a saída da ação incluída no erro e no evento.
+const maxActionOutput = 512
+
+// postCommitWaitDelay é a espera pela saída da ação após o timeout matar o
+// processo.
+const postCommitWaitDelay = time.Second
+
+// postCommitRetryDelay é a espera entre as tentativas de uma ação post_commit.
+var postCommitRetryDelay = 10 * time.Second
+
+// runPostCommitActions executa as ações storages.*.post_commit do backup em
+// finalPath, na ordem configurada. Roda em background após o commit (o agent
+// já recebeu o FinalACK): cada ação gera log e evento post_commit_action_ok
+// ou post_commit_action_failed, e on_failure: stop interrompe as seguintes.
+func (h *Handler) runPostCommitActions(storageInfo config.StorageInfo, finalPath string, bctx BucketUploadContext, logger *slog.Logger) {
+	for i, a := range storageInfo.PostCommit {
+		alogger := logger.With("action", a.Name, "type", a.Type)
+		start := time.Now()
+		err := runPostCommitAction(a, finalPath, bctx, alogger)
+		duration := time.Since(start).Round(time.Millisecond)
+
+		event := observability.EventEntry{
+			Agent:   bctx.Agent,
+			Storage: bctx.Storage,
+			Backup:  bctx.Backup,
+		}
+		if err == nil {
+			alogger.Info("post-commit action completed", "path", finalPath, "duration", duration)
+			event.Level, event.Type = "info", "post_commit_action_ok"
+			event.Message = fmt.Sprintf("post-commit action %s (%s) completed in %s", a.Name, a.Type, duration)
+			if h.Events != nil {
+				h.Events.Push(event)
+			}
+			continue
+		}
+
+		alogger.Error("post-commit action failed", "path", finalPath, "duration", duration, "error", err)
+		event.Level, event.Type = "error", "post_commit_action_failed"
+		event.Message = fmt.Sprintf("post-commit action %s (%s) failed: %v", a.Name, a.Type, err)
+		if h.Events != nil {
+			h.Events.Push(event)
+		}
+		if a.OnFailure == config.PostCommitOnFailureStop {
+			if skipped := len(storageInfo.PostCommit) - i - 1; skipped > 0 {
+				alogger.Warn("post-commit actions stopped (on_failure: stop)", "skipped", skipped)
+			}
+			return
+		}
+	}
+}
+
+// runPostCommitAction executa uma ação, com até a.Retries novas tentativas.
+func runPostCommitAction(a config.PostCommitAction, finalPath string, bctx BucketUploadContext, logger *slog.Logger) error {
+	var err error
+	for attempt := 0; attempt <= a.Retries; attempt++ {
+		if attempt > 0 {
+			logger.Warn("post-commit action failed, retrying", "attempt", attempt, "error", err)
+			time.Sleep(postCommitRetryDelay)
+		}
+		if err = runPostCommitAttempt(a, finalPath, bctx); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// runPostCommitAttempt executa uma tentativa da ação, limitada a a.Timeout.
+func runPostCommitAttempt(a config.PostCommitAction, finalPath string, bctx BucketUploadContext) error {
+	ctx, cancel := context.WithTimeout(context.Background(), a.Timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	switch a.Type {
+	case config.PostCommitRclone:
+		args := append([]string{"copyto", finalPath, rcloneDestination(a.Remote, finalPath, bctx)}, a.Args...)
+		cmd = exec.CommandContext(ctx, a.Rclone, args...)
+	default:
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", a.Command)
+	}
+	cmd.Env = append(os.Environ(),
+		"NBACKUP_ARTIFACT="+finalPath,
+		"NBACKUP_AGENT="+bctx.Agent,
+		"NBACKUP_STORAGE="+bctx.Storage,
+		"NBACKUP_BACKUP="+bctx.Backup,
+		"NBACKUP_SESSION_ID="+bctx.SessionID,
+		"NBACKUP_ACTION="+a.Name,
+	)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	// Filhos do sh que herdam a saída não prendem a ação além do timeout
+	cmd.WaitDelay = postCommitWaitDelay
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", a.Timeout)
+		}
+		output := strings.TrimSpace(out.String())
+		if len(output) > maxActionOutput {
+			output = output[:maxActionOutput] + "..."
+		}
+		if output != "" {
+			return fmt.Errorf("%w: %s", err, output)
+		}
+		return err
+	}
+	return nil
+}
+
+// rcloneDestination monta o destino do rclone copyto: o diretório remote
+// (com {agent}, {backup} e {storage} expandidos) mais o nome do backup.
+func rcloneDestination(remote, finalPath string, bctx BucketUploadContext) string {
+	dst := strings.NewReplacer(
+		"{agent}", bctx.Agent,
+		"{backup}", bctx.Backup,
+		"{storage}", bctx.Storage,
+	).Replace(remote)
+	if !strings.HasSuffix(dst, ":") && !strings.HasSuffix(dst, "/") {
+		dst += "/"
+	}
+	return dst + filepath.Base(finalPath)
+}
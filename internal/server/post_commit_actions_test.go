@@ -0,0 +1,100 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+func TestRunPostCommitActions(t *testing.T) {
+	dir := t.TempDir()
+	artifact := filepath.Join(dir, "2026-03-07T02-00-00-000.tar.gz")
+	os.WriteFile(artifact, []byte("data"), 0644)
+	out := filepath.Join(dir, "out")
+
+	// rclone falso: registra os argumentos recebidos
+	rclone := filepath.Join(dir, "rclone")
+	os.WriteFile(rclone, []byte("#!/bin/sh\necho \"$@\" >> "+out+"\n"), 0755)
+
+	events, err := observability.NewEventStore(filepath.Join(dir, "events.jsonl"), 10, 100)
+	if err != nil {
+		t.Fatalf("NewEventStore: %v", err)
+	}
+	defer events.Close()
+	h := &Handler{Events: events}
+	si := config.StorageInfo{PostCommit: []config.PostCommitAction{
+		{Name: "ship", Type: config.PostCommitCommand, Command: `echo "$NBACKUP_AGENT $NBACKUP_ARTIFACT" >> ` + out, Timeout: time.Minute},
+		{Name: "offsite", Type: config.PostCommitRclone, Rclone: rclone, Remote: "b2:bkp/{agent}/{backup}", Args: []string{"--bwlimit", "50M"}, Timeout: time.Minute},
+		{Name: "broken", Type: config.PostCommitCommand, Command: "echo boom; exit 3", Timeout: time.Minute, OnFailure: config.PostCommitOnFailureStop},
+		{Name: "skipped", Type: config.PostCommitCommand, Command: "echo skipped >> " + out, Timeout: time.Minute},
+	}}
+	bctx := BucketUploadContext{Agent: "web-01", Storage: "default", Backup: "app"}
+	h.runPostCommitActions(si, artifact, bctx, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	data, _ := os.ReadFile(out)
+	want := "web-01 " + artifact + "\n" +
+		"copyto " + artifact + " b2:bkp/web-01/app/2026-03-07T02-00-00-000.tar.gz --bwlimit 50M\n"
+	if string(data) != want {
+		t.Fatalf("unexpected action output:\n%s\nwant:\n%s", data, want)
+	}
+
+	recent := events.Recent(10)
+	if len(recent) != 3 {
+		t.Fatalf("expected 3 events (skipped action has none), got %d", len(recent))
+	}
+	var failed observability.EventEntry
+	for _, e := range recent {
+		if e.Type == "post_commit_action_failed" {
+			failed = e
+		}
+	}
+	if failed.Agent != "web-01" || failed.Storage != "default" || !strings.Contains(failed.Message, "broken") || !strings.Contains(failed.Message, "boom") {
+		t.Errorf("unexpected failure event: %+v", failed)
+	}
+}
+
+func TestRunPostCommitAction_RetriesAndTimeout(t *testing.T) {
+	postCommitRetryDelay = 0
+	defer func() { postCommitRetryDelay = 10 * time.Second }()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	counter := filepath.Join(t.TempDir(), "attempts")
+
+	// Falha na primeira tentativa e passa na segunda
+	a := config.PostCommitAction{Name: "flaky", Type: config.PostCommitCommand, Timeout: time.Minute, Retries: 2,
+		Command: `echo x >> ` + counter + `; [ $(wc -l < ` + counter + `) -ge 2 ]`}
+	if err := runPostCommitAction(a, "/tmp/x.tar.gz", BucketUploadContext{}, logger); err != nil {
+		t.Fatalf("expected success on retry, got %v", err)
+	}
+	if data, _ := os.ReadFile(counter); strings.Count(string(data), "x") != 2 {
+		t.Errorf("expected 2 attempts, got %q", data)
+	}
+
+	slow := config.PostCommitAction{Name: "slow", Type: config.PostCommitCommand, Command: "sleep 5", Timeout: 100 * time.Millisecond}
+	if err := runPostCommitAction(slow, "/tmp/x.tar.gz", BucketUploadContext{}, logger); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
+
+func TestRcloneDestination(t *testing.T) {
+	bctx := BucketUploadContext{Agent: "web-01", Storage: "default", Backup: "app"}
+	for remote, want := range map[string]string{
+		"b2:":                      "b2:x.tar.gz",
+		"b2:bkp/":                  "b2:bkp/x.tar.gz",
+		"s3:bkp/{storage}/{agent}": "s3:bkp/default/web-01/x.tar.gz",
+	} {
+		if got := rcloneDestination(remote, "/var/backups/web-01/app/x.tar.gz", bctx); got != want {
+			t.Errorf("%s: got %q, want %q", remote, got, want)
+		}
+	}
+}
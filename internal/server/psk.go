@@ -0,0 +1,120 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/auth"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// Erros de autenticação por pre-shared key (server.auth: psk).
+var (
+	errPSKUnknownAgent = errors.New("agent not in server.psk_file")
+	errPSKInvalidMAC   = errors.New("invalid psk hmac")
+)
+
+// pskConn é uma conexão autenticada por PSK. Carrega o nome do agent
+// verificado, que substitui o CN do certificado como identidade da conexão.
+type pskConn struct {
+	net.Conn
+	agent string
+}
+
+// Identity implementa auth.Identified.
+func (c *pskConn) Identity() auth.Identity {
+	return auth.Identity{Method: auth.MethodPSK, Name: c.agent, Credential: "psk"}
+}
+
+// pskServerTLSConfig retorna a configuração TLS do listener com auth psk:
+// TLS 1.3 sem certificado de client, com o certificado do server resolvido a
+// cada handshake (rotações continuam valendo sem restart).
+func pskServerTLSConfig(certReloader *pki.CertReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certReloader.Certificate(), nil
+		},
+	}
+}
+
+// loadPSKKeyring carrega o keyring de server.psk_file e habilita a
+// autenticação PSK em HandleConnection.
+func (h *Handler) loadPSKKeyring(path string) error {
+	keyring, err := pki.NewPSKKeyring(path, h.logger.With("component", "psk"))
+	if err != nil {
+		return fmt.Errorf("loading server.psk_file: %w", err)
+	}
+	h.psk.Store(keyring)
+	h.logger.Info("psk keyring loaded", "path", path, "agents", keyring.Count())
+	return nil
+}
+
+// authenticatePSK executa o desafio PSK logo após o handshake TLS:
+// server envia PSKChallenge (nonce aleatório), agent responde com nome e
+// HMAC-SHA256 sobre nonce, nome e o channel binding da sessão TLS, e o server
+// responde com PSKResult. Retorna a conexão com a identidade verificada.
+func (h *Handler) authenticatePSK(conn net.Conn, keyring *pki.PSKKeyring, logger *slog.Logger) (net.Conn, error) {
+	tlsConn, ok := conn.(auth.TLSConn)
+	if !ok {
+		return nil, fmt.Errorf("psk auth requires a tls connection")
+	}
+	// Normalmente já concluído pelo handshakeLimiter; no-op nesse caso.
+	// Streams QUIC só chegam aqui com o handshake completo (ver serveQUICStream).
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			return nil, err
+		}
+	}
+	binding, err := pki.PSKChannelBinding(tlsConn.ConnectionState())
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout := h.config().TLS.HandshakeTimeout; timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	var nonce [protocol.PSKNonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, fmt.Errorf("generating psk nonce: %w", err)
+	}
+	if err := protocol.WritePSKChallenge(conn, nonce); err != nil {
+		return nil, fmt.Errorf("writing psk challenge: %w", err)
+	}
+	agent, mac, err := protocol.ReadPSKResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	key, known := keyring.Key(agent)
+	switch {
+	case !known:
+		err = errPSKUnknownAgent
+	case !hmac.Equal(mac, pki.PSKMAC(key, nonce[:], agent, binding)):
+		err = errPSKInvalidMAC
+	}
+	pc := &pskConn{Conn: conn, agent: agent}
+	if err != nil {
+		h.rejectAgent(pc.Identity(), err, "psk", logger)
+		protocol.WritePSKResult(conn, protocol.PSKStatusUnauthorized)
+		return nil, err
+	}
+
+	if err := protocol.WritePSKResult(conn, protocol.PSKStatusOK); err != nil {
+		return nil, fmt.Errorf("writing psk result: %w", err)
+	}
+	return pc, nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/auth"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+const (
+	testPSKWeb = "0123456789abcdef0123456789abcdef-web"
+	testPSKDB  = "0123456789abcdef0123456789abcdef-db"
+)
+
+// pskClientAuth executa o lado do agent do desafio PSK e retorna o status.
+func pskClientAuth(conn auth.TLSConn, agent, key string) (byte, error) {
+	binding, err := pki.PSKChannelBinding(conn.ConnectionState())
+	if err != nil {
+		return 0, err
+	}
+	nonce, err := protocol.ReadPSKChallenge(conn)
+	if err != nil {
+		return 0, err
+	}
+	if err := protocol.WritePSKResponse(conn, agent, pki.PSKMAC([]byte(key), nonce[:], agent, binding)); err != nil {
+		return 0, err
+	}
+	return protocol.ReadPSKResult(conn)
+}
+
+func TestAuthenticatePSK(t *testing.T) {
+	cfg, _ := setupEnrollPKI(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	cfg.Server.PSKFile = filepath.Join(t.TempDir(), "psk")
+	os.WriteFile(cfg.Server.PSKFile, []byte("# agents\nweb-01:"+testPSKWeb+"\ndb-01: "+testPSKDB+"\n"), 0600)
+	cfg.TLS.AllowedAgents = []string{"web-01"}
+
+	h := &Handler{cfg: cfg, logger: logger}
+	if err := h.loadPSKKeyring(cfg.Server.PSKFile); err != nil {
+		t.Fatalf("loadPSKKeyring: %v", err)
+	}
+	reloader, err := pki.NewCertReloader(cfg.TLS.CACert, cfg.TLS.ServerCert, cfg.TLS.ServerKey, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", pskServerTLSConfig(reloader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	type result struct {
+		agent string
+		authz error
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if err := conn.(*tls.Conn).Handshake(); err != nil {
+				results <- result{err: err}
+				conn.Close()
+				continue
+			}
+			authConn, err := h.authenticatePSK(conn, h.psk.Load(), logger)
+			if err != nil {
+				results <- result{err: err}
+			} else {
+				results <- result{
+					agent: h.extractAgentName(authConn, logger),
+					authz: h.authorizeAgent(context.Background(), authConn, logger),
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	clientCfg, err := pki.NewPSKClientTLSConfig(cfg.TLS.CACert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCfg.ServerName = "127.0.0.1"
+	auth := func(agent, key string) (byte, result) {
+		t.Helper()
+		conn, err := tls.Dial("tcp", ln.Addr().String(), clientCfg)
+		if err != nil {
+			t.Fatalf("dial without client certificate: %v", err)
+		}
+		defer conn.Close()
+		status, err := pskClientAuth(conn, agent, key)
+		if err != nil {
+			t.Fatalf("psk client auth: %v", err)
+		}
+		return status, <-results
+	}
+
+	status, res := auth("web-01", testPSKWeb)
+	if status != protocol.PSKStatusOK || res.err != nil {
+		t.Fatalf("expected web-01 authenticated, got status=%d err=%v", status, res.err)
+	}
+	if res.agent != "web-01" {
+		t.Errorf("expected agent identity web-01, got %q", res.agent)
+	}
+	if res.authz != nil {
+		t.Errorf("expected web-01 authorized, got %v", res.authz)
+	}
+
+	// Chave errada e agent desconhecido: recusados no desafio
+	status, res = auth("web-01", testPSKDB)
+	if status != protocol.PSKStatusUnauthorized || !errors.Is(res.err, errPSKInvalidMAC) {
+		t.Fatalf("expected invalid mac rejection, got status=%d err=%v", status, res.err)
+	}
+	status, res = auth("ghost-01", testPSKWeb)
+	if status != protocol.PSKStatusUnauthorized || !errors.Is(res.err, errPSKUnknownAgent) {
+		t.Fatalf("expected unknown agent rejection, got status=%d err=%v", status, res.err)
+	}
+
+	// PSK válido mas fora de tls.allowed_agents: recusado pela allow-list
+	status, res = auth("db-01", testPSKDB)
+	if status != protocol.PSKStatusOK || res.err != nil {
+		t.Fatalf("expected db-01 psk accepted, got status=%d err=%v", status, res.err)
+	}
+	if !errors.Is(res.authz, errAgentNotAllowed) {
+		t.Fatalf("expected errAgentNotAllowed for db-01, got %v", res.authz)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// listenQUIC abre o listener QUIC experimental (server.quic) no endereço UDP
+// addr, com a mesma configuração TLS do listener TCP. 0-RTT fica habilitado
+// para que agents reabram o control channel sem esperar o handshake.
+func listenQUIC(addr string, tlsCfg *tls.Config) (*quic.EarlyListener, error) {
+	ln, err := quic.ListenAddrEarly(addr, quicServerTLSConfig(tlsCfg), protocol.NewQUICConfig())
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s (quic): %w", addr, err)
+	}
+	return ln, nil
+}
+
+// quicServerTLSConfig adiciona o ALPN do QUIC à configuração TLS do
+// listener, inclusive à resolvida por GetConfigForClient (reload de cert).
+func quicServerTLSConfig(base *tls.Config) *tls.Config {
+	cfg := base.Clone()
+	cfg.NextProtos = []string{protocol.QUICALPN}
+	if get := cfg.GetConfigForClient; get != nil {
+		cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := get(hello)
+			if err != nil || c == nil {
+				return c, err
+			}
+			c = c.Clone()
+			c.NextProtos = []string{protocol.QUICALPN}
+			return c, nil
+		}
+	}
+	return cfg
+}
+
+// ServeQUIC aceita conexões QUIC até o listener ser fechado. Cada stream
+// QUIC é uma sessão independente, tratada por HandleConnection como uma
+// conexão TLS. O handshakeLimiter não se aplica: o handshake QUIC é
+// conduzido pelo listener.
+func (h *Handler) ServeQUIC(ctx context.Context, ln *quic.EarlyListener) {
+	for {
+		qc, err := ln.Accept(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				h.logger.Info("quic listener closed", "error", err)
+			}
+			return
+		}
+		go h.serveQUICConn(ctx, qc)
+	}
+}
+
+// serveQUICConn aceita os streams de uma conexão QUIC até ela encerrar.
+func (h *Handler) serveQUICConn(ctx context.Context, qc *quic.Conn) {
+	for {
+		st, err := qc.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+		go h.serveQUICStream(ctx, qc, st)
+	}
+}
+
+// serveQUICStream despacha um stream para HandleConnection. Dados 0-RTT
+// podem ser reenviados por um atacante (replay), então antes do handshake
+// completo só o control channel é lido — e ele só é registrado após o
+// handshake (ver awaitHandshake). Com auth psk o channel binding já exige o
+// handshake completo.
+func (h *Handler) serveQUICStream(ctx context.Context, qc *quic.Conn, st *quic.Stream) {
+	if !quicHandshakeComplete(qc) && (h.psk.Load() != nil || !peekControlStream(st)) {
+		if err := waitQUICHandshake(ctx, qc); err != nil {
+			st.CancelRead(0)
+			st.CancelWrite(0)
+			return
+		}
+	}
+
+	conn := protocol.NewQUICConn(qc, st)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	version, err := protocol.ReadQUICStreamHeader(conn)
+	conn.SetReadDeadline(time.Time{})
+	if err == nil && version != protocol.QUICStreamVersion {
+		err = fmt.Errorf("unsupported quic stream version %d", version)
+	}
+	if err != nil {
+		h.logger.Warn("rejecting quic stream", "remote", qc.RemoteAddr().String(), "error", err)
+		conn.Close()
+		return
+	}
+	h.HandleConnection(ctx, conn)
+}
+
+// awaitHandshake aguarda o handshake de um stream QUIC aceito via 0-RTT
+// antes de efeitos colaterais da sessão. No-op para conexões TCP.
+func awaitHandshake(ctx context.Context, conn net.Conn) error {
+	qconn, ok := untraced(conn).(*protocol.QUICConn)
+	if !ok {
+		return nil
+	}
+	return waitQUICHandshake(ctx, qconn.Conn())
+}
+
+func quicHandshakeComplete(qc *quic.Conn) bool {
+	select {
+	case <-qc.HandshakeComplete():
+		return true
+	default:
+		return false
+	}
+}
+
+func waitQUICHandshake(ctx context.Context, qc *quic.Conn) error {
+	select {
+	case <-qc.HandshakeComplete():
+		return nil
+	case <-qc.Context().Done():
+		return fmt.Errorf("quic handshake not completed: %w", context.Cause(qc.Context()))
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// peekControlStream indica se o stream abre um control channel (versão +
+// magic CTRL), sem consumir os bytes.
+func peekControlStream(st *quic.Stream) bool {
+	var buf [5]byte
+	st.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer st.SetReadDeadline(time.Time{})
+	if _, err := st.Peek(buf[:]); err != nil {
+		return false
+	}
+	return buf[0] == protocol.QUICStreamVersion && [4]byte(buf[1:]) == protocol.MagicControl
+}
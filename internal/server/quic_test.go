@@ -0,0 +1,148 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func TestQUIC_SessionsAsStreamsWith0RTTResumption(t *testing.T) {
+	cfg, _ := setupEnrollPKI(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ca, err := pki.LoadCA(cfg.TLS.CACert, cfg.Enrollment.CAKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCfg, _ := issueAgentTLS(t, cfg, ca, "web-01")
+	clientCfg.NextProtos = []string{protocol.QUICALPN}
+	clientCfg.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+
+	cfg.Storages = map[string]config.StorageInfo{"main": {BaseDir: t.TempDir()}}
+	h := NewHandler(cfg, logger, &sync.Map{}, &sync.Map{})
+	reloader, err := pki.NewCertReloader(cfg.TLS.CACert, cfg.TLS.ServerCert, cfg.TLS.ServerKey, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listenQUIC("127.0.0.1:0", reloader.ServerTLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.ServeQUIC(ctx, ln)
+
+	ping := func(qc *quic.Conn) {
+		t.Helper()
+		st, err := qc.OpenStreamSync(ctx)
+		if err != nil {
+			t.Fatalf("OpenStream: %v", err)
+		}
+		conn := protocol.NewQUICConn(qc, st)
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		protocol.WriteQUICStreamHeader(conn)
+		if err := protocol.WritePing(conn); err != nil {
+			t.Fatalf("WritePing: %v", err)
+		}
+		resp, err := protocol.ReadHealthResponse(conn)
+		if err != nil {
+			t.Fatalf("ReadHealthResponse: %v", err)
+		}
+		if resp.Status != protocol.HealthStatusReady {
+			t.Errorf("expected status ready, got %d", resp.Status)
+		}
+	}
+
+	// Várias sessões como streams de uma única conexão
+	dialCtx, dialCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer dialCancel()
+	qc, err := quic.DialAddr(dialCtx, ln.Addr().String(), clientCfg, protocol.NewQUICConfig())
+	if err != nil {
+		t.Fatalf("quic dial: %v", err)
+	}
+	ping(qc)
+	ping(qc)
+	qc.CloseWithError(0, "")
+
+	// Reconexão com o session ticket: 0-RTT aceito pelo server. O ping não é
+	// control channel, então só é atendido após o handshake completo.
+	qc, err = quic.DialAddrEarly(dialCtx, ln.Addr().String(), clientCfg, protocol.NewQUICConfig())
+	if err != nil {
+		t.Fatalf("quic 0-RTT dial: %v", err)
+	}
+	defer qc.CloseWithError(0, "")
+	ping(qc)
+	<-qc.HandshakeComplete()
+	if !qc.ConnectionState().Used0RTT {
+		t.Error("expected the reconnection to use 0-RTT")
+	}
+}
+
+func TestQUIC_PSKAuthWaitsForHandshake(t *testing.T) {
+	cfg, _ := setupEnrollPKI(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg.Server.PSKFile = filepath.Join(t.TempDir(), "psk")
+	os.WriteFile(cfg.Server.PSKFile, []byte("web-01:"+testPSKWeb+"\n"), 0600)
+	h := NewHandler(cfg, logger, &sync.Map{}, &sync.Map{})
+	if err := h.loadPSKKeyring(cfg.Server.PSKFile); err != nil {
+		t.Fatal(err)
+	}
+	reloader, err := pki.NewCertReloader(cfg.TLS.CACert, cfg.TLS.ServerCert, cfg.TLS.ServerKey, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listenQUIC("127.0.0.1:0", pskServerTLSConfig(reloader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go h.ServeQUIC(ctx, ln)
+
+	clientCfg, err := pki.NewPSKClientTLSConfig(cfg.TLS.CACert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCfg.ServerName = "127.0.0.1"
+	clientCfg.NextProtos = []string{protocol.QUICALPN}
+	qc, err := quic.DialAddr(ctx, ln.Addr().String(), clientCfg, protocol.NewQUICConfig())
+	if err != nil {
+		t.Fatalf("quic dial: %v", err)
+	}
+	defer qc.CloseWithError(0, "")
+	st, err := qc.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// O server fala primeiro (PSKChallenge): o byte de versão anuncia o stream
+	conn := protocol.NewQUICConn(qc, st)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	protocol.WriteQUICStreamHeader(conn)
+	status, err := pskClientAuth(conn, "web-01", testPSKWeb)
+	if err != nil || status != protocol.PSKStatusOK {
+		t.Fatalf("psk over quic: status=%d err=%v", status, err)
+	}
+	protocol.WritePing(conn)
+	if _, err := protocol.ReadHealthResponse(conn); err != nil {
+		t.Fatalf("ping after psk auth: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/sha256"
+	"hash"
+)
+
+// receiveHashLookback é quanto do fim do stream fica fora do hash até o
+// trailer chegar. Os últimos bytes são o trailer (e, com manifest, o frame
+// Manifest), que não entram no checksum; o tamanho dos dados só é conhecido
+// no fim, então o hash anda atrasado esta distância.
+const receiveHashLookback = 1024 * 1024
+
+// receiveHash calcula o SHA-256 do single-stream à medida que os dados
+// chegam, evitando reler o arquivo inteiro na validação.
+type receiveHash struct {
+	h      hash.Hash
+	hashed int64  // bytes já no hash
+	tail   []byte // bytes recebidos ainda fora do hash (até 2x receiveHashLookback)
+}
+
+func newReceiveHash() *receiveHash {
+	return &receiveHash{h: sha256.New()}
+}
+
+// Write acumula p; o que sair da janela de lookback entra no hash.
+func (r *receiveHash) Write(p []byte) {
+	r.tail = append(r.tail, p...)
+	if len(r.tail) < 2*receiveHashLookback {
+		return
+	}
+	n := len(r.tail) - receiveHashLookback
+	r.h.Write(r.tail[:n])
+	r.hashed += int64(n)
+	r.tail = r.tail[:copy(r.tail, r.tail[n:])]
+}
+
+// size retorna o total de bytes recebidos.
+func (r *receiveHash) size() int64 {
+	return r.hashed + int64(len(r.tail))
+}
+
+// sum retorna o SHA-256 dos primeiros dataSize bytes. ok é false se o hash
+// já passou de dataSize (fim do stream maior que o lookback, como um
+// manifest grande) ou se dataSize excede o recebido: o chamador recalcula
+// a partir do arquivo. Encerra o hash: é chamado uma vez, na validação.
+func (r *receiveHash) sum(dataSize int64) (checksum [32]byte, ok bool) {
+	if dataSize < r.hashed || dataSize > r.size() {
+		return checksum, false
+	}
+	r.h.Write(r.tail[:dataSize-r.hashed])
+	r.hashed = dataSize
+	r.tail = r.tail[:0]
+	copy(checksum[:], r.h.Sum(nil))
+	return checksum, true
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/sha256"
+	"math/rand"
+	"testing"
+)
+
+func TestReceiveHash_MatchesDataBeforeTrailer(t *testing.T) {
+	stream := make([]byte, 5*receiveHashLookback+12345)
+	rand.New(rand.NewSource(1)).Read(stream)
+	const trailerSize = 4 + 32 + 8
+
+	for _, tailSize := range []int{trailerSize, receiveHashLookback} {
+		r := newReceiveHash()
+		for p := stream; len(p) > 0; {
+			n := min(len(p), 256*1024+7)
+			r.Write(p[:n])
+			p = p[n:]
+		}
+		if r.size() != int64(len(stream)) {
+			t.Fatalf("size = %d, want %d", r.size(), len(stream))
+		}
+		dataSize := int64(len(stream) - tailSize)
+		got, ok := r.sum(dataSize)
+		if !ok {
+			t.Fatalf("tail %d: expected incremental sum within the lookback", tailSize)
+		}
+		if got != sha256.Sum256(stream[:dataSize]) {
+			t.Errorf("tail %d: checksum mismatch", tailSize)
+		}
+	}
+
+	// Fim do stream maior que o lookback (manifest grande): recalcula do arquivo
+	r := newReceiveHash()
+	r.Write(stream)
+	if _, ok := r.sum(int64(len(stream) - 3*receiveHashLookback)); ok {
+		t.Error("expected sum to fail when the data ends before the hashed prefix")
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// Reload aplica uma nova configuração ao server sem interromper sessões ativas.
+//
+// São aplicados: storages (adição, remoção e alteração), placements,
+// restore_drills, flow_rotation,
+// logging (stream_stats, session_log_dir — o nível, a redação, a amostragem e
+// a rotação são ajustados pelo chamador)
+// control_lost_grace_period, ingest_limit, stream_budget e write_workers (valem
+// também para as sessões em andamento) e o controle de acesso de agents (tls.crl_file,
+// tls.allowed_agents e as chaves de server.psk_file). Sessões em andamento mantêm o StorageInfo
+// copiado no handshake; a nova config vale a partir do próximo handshake.
+//
+// O bloco immutable de um storage já imutável só muda com restart.
+//
+// Seções que dependem de listeners ou recursos já alocados (server, tls,
+// listeners, web_ui, chunk_buffer, gap_detection, chaos, snapshot_groups, audit_log, accounting) são ignoradas com warning e
+// exigem restart. Retorna a lista de mudanças aplicadas.
+func (h *Handler) Reload(newCfg *config.ServerConfig) []string {
+	h.cfgMu.Lock()
+	old := h.cfg
+	merged := *old
+	merged.Storages = newCfg.Storages
+	merged.Placements = newCfg.Placements
+	merged.RestoreDrills = newCfg.RestoreDrills
+	merged.FlowRotation = newCfg.FlowRotation
+	merged.Logging = newCfg.Logging
+	merged.ControlLostGracePeriod = newCfg.ControlLostGracePeriod
+	merged.IngestLimit, merged.IngestLimitRaw = newCfg.IngestLimit, newCfg.IngestLimitRaw
+	merged.StreamBudget = newCfg.StreamBudget
+	merged.TLS.CRLFile = newCfg.TLS.CRLFile
+	merged.TLS.AllowedAgents = newCfg.TLS.AllowedAgents
+	pinned := pinImmutable(old, &merged)
+	h.cfg = &merged
+	h.cfgMu.Unlock()
+	h.ingest.apply(&merged)
+	h.disk.apply(&merged)
+
+	changes := reloadChanges(old, &merged)
+
+	if merged.TLS.CRLFile != old.TLS.CRLFile {
+		if err := h.loadCRL(merged.TLS.CRLFile, merged.TLS.CACert); err != nil {
+			h.logger.Error("config reload: keeping previous crl", "error", err)
+		}
+	} else if crl := h.crl.Load(); crl != nil {
+		crl.Check()
+	}
+	if keyring := h.psk.Load(); keyring != nil {
+		keyring.Check()
+	}
+
+	for _, name := range pinned {
+		h.logger.Warn("config reload: storages.*.immutable of an immutable storage requires restart, keeping current value", "storage", name)
+	}
+	for _, section := range restartRequiredSections(old, newCfg) {
+		h.logger.Warn("config reload: section changed but requires restart, keeping current value", "section", section)
+	}
+
+	if len(changes) == 0 {
+		h.logger.Info("config reloaded, no applicable changes")
+		return nil
+	}
+	h.logger.Info("config reloaded", "changes", changes)
+	if h.Events != nil {
+		h.Events.PushEvent("info", "config_reloaded", "",
+			fmt.Sprintf("config reloaded: %s", strings.Join(changes, "; ")), 0)
+	}
+	return changes
+}
+
+// pinImmutable mantém em cur o bloco immutable dos storages que já eram
+// imutáveis em old: desligar o WORM, trocar o modo ou a chave do ledger ou
+// encurtar unlock_grace via SIGHUP abriria caminho para apagar o histórico
+// sem acesso ao processo. Retorna os storages mantidos.
+func pinImmutable(old, cur *config.ServerConfig) []string {
+	var pinned []string
+	storages := make(map[string]config.StorageInfo, len(cur.Storages))
+	for name, si := range cur.Storages {
+		if prev, ok := old.Storages[name]; ok && prev.Immutable.Enabled && si.Immutable != prev.Immutable {
+			si.Immutable = prev.Immutable
+			pinned = append(pinned, name)
+		}
+		storages[name] = si
+	}
+	cur.Storages = storages
+	sort.Strings(pinned)
+	return pinned
+}
+
+// reloadChanges descreve as diferenças aplicadas entre duas configs.
+func reloadChanges(old, cur *config.ServerConfig) []string {
+	var changes []string
+
+	for name, si := range cur.Storages {
+		prev, ok := old.Storages[name]
+		switch {
+		case !ok:
+			changes = append(changes, "storage "+name+" added")
+		case !reflect.DeepEqual(prev, si):
+			changes = append(changes, "storage "+name+" changed")
+		}
+	}
+	for name := range old.Storages {
+		if _, ok := cur.Storages[name]; !ok {
+			changes = append(changes, "storage "+name+" removed")
+		}
+	}
+	sort.Strings(changes)
+
+	if !reflect.DeepEqual(old.Placements, cur.Placements) {
+		changes = append(changes, "placements changed")
+	}
+	if old.RestoreDrills != cur.RestoreDrills {
+		changes = append(changes, "restore_drills changed")
+	}
+	if !reflect.DeepEqual(old.FlowRotation, cur.FlowRotation) {
+		changes = append(changes, "flow_rotation changed")
+	}
+	if old.Logging.Level != cur.Logging.Level {
+		changes = append(changes, fmt.Sprintf("logging.level: %s -> %s", old.Logging.Level, cur.Logging.Level))
+	}
+	if old.Logging.StreamStats != cur.Logging.StreamStats || old.Logging.SessionLogDir != cur.Logging.SessionLogDir ||
+		old.Logging.ProtocolTraceDir != cur.Logging.ProtocolTraceDir || !slices.Equal(old.Logging.ProtocolTraceOnly, cur.Logging.ProtocolTraceOnly) ||
+		!reflect.DeepEqual(old.Logging.Redact, cur.Logging.Redact) || !reflect.DeepEqual(old.Logging.Sampling, cur.Logging.Sampling) ||
+		!reflect.DeepEqual(old.Logging.Rotation, cur.Logging.Rotation) {
+		changes = append(changes, "logging changed")
+	}
+	if old.TLS.CRLFile != cur.TLS.CRLFile {
+		changes = append(changes, fmt.Sprintf("tls.crl_file: %q -> %q", old.TLS.CRLFile, cur.TLS.CRLFile))
+	}
+	if !slices.Equal(old.TLS.AllowedAgents, cur.TLS.AllowedAgents) {
+		changes = append(changes, fmt.Sprintf("tls.allowed_agents: %d -> %d entries", len(old.TLS.AllowedAgents), len(cur.TLS.AllowedAgents)))
+	}
+	if old.IngestLimit != cur.IngestLimit {
+		changes = append(changes, fmt.Sprintf("ingest_limit: %q -> %q", old.IngestLimit, cur.IngestLimit))
+	}
+	if old.StreamBudget != cur.StreamBudget {
+		changes = append(changes, fmt.Sprintf("stream_budget: %d -> %d", old.StreamBudget, cur.StreamBudget))
+	}
+	if old.ControlLostGracePeriod != cur.ControlLostGracePeriod {
+		changes = append(changes, fmt.Sprintf("control_lost_grace_period: %s -> %s", old.ControlLostGracePeriod, cur.ControlLostGracePeriod))
+	}
+	return changes
+}
+
+// restartRequiredSections lista as seções alteradas que não são aplicadas por Reload.
+func restartRequiredSections(old, cur *config.ServerConfig) []string {
+	var sections []string
+	if !reflect.DeepEqual(old.Server, cur.Server) {
+		sections = append(sections, "server")
+	}
+	oldTLS, curTLS := old.TLS, cur.TLS
+	oldTLS.CRLFile, oldTLS.AllowedAgents = "", nil // aplicados por Reload
+	curTLS.CRLFile, curTLS.AllowedAgents = "", nil
+	if !reflect.DeepEqual(oldTLS, curTLS) {
+		sections = append(sections, "tls")
+	}
+	if !reflect.DeepEqual(old.Listeners, cur.Listeners) {
+		sections = append(sections, "listeners")
+	}
+	if !reflect.DeepEqual(old.WebUI, cur.WebUI) {
+		sections = append(sections, "web_ui")
+	}
+	if !reflect.DeepEqual(old.ChunkBuffer, cur.ChunkBuffer) {
+		sections = append(sections, "chunk_buffer")
+	}
+	if !reflect.DeepEqual(old.GapDetection, cur.GapDetection) {
+		sections = append(sections, "gap_detection")
+	}
+	if !reflect.DeepEqual(old.Chaos, cur.Chaos) {
+		sections = append(sections, "chaos")
+	}
+	if !reflect.DeepEqual(old.Enrollment, cur.Enrollment) {
+		sections = append(sections, "enrollment")
+	}
+	if !reflect.DeepEqual(old.SnapshotGroups, cur.SnapshotGroups) {
+		sections = append(sections, "snapshot_groups")
+	}
+	if old.AuditLog != cur.AuditLog {
+		sections = append(sections, "audit_log")
+	}
+	if old.Accounting != cur.Accounting {
+		sections = append(sections, "accounting")
+	}
+	if old.Logging.Format != cur.Logging.Format || old.Logging.File != cur.Logging.File ||
+		old.Logging.Target != cur.Logging.Target || old.Logging.Syslog != cur.Logging.Syslog {
+		sections = append(sections, "logging.format/file/target")
+	}
+	return sections
+}
+
+// CurrentConfig retorna a configuração corrente (reflete reloads). Usado pela WebUI.
+func (h *Handler) CurrentConfig() *config.ServerConfig {
+	return h.config()
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestHandlerReload_AppliesStoragesAndKeepsListeners(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	old := &config.ServerConfig{
+		Server:   config.ServerListen{Listen: ":9847"},
+		Storages: map[string]config.StorageInfo{"a": {BaseDir: "/data/a", MaxBackups: 3}, "gone": {BaseDir: "/data/gone"}},
+		Logging:  config.LoggingInfo{Level: "info"},
+	}
+	h := &Handler{cfg: old, logger: logger}
+
+	// Sessão ativa: StorageInfo copiado no handshake
+	active, _ := h.config().GetStorage("a")
+
+	newCfg := &config.ServerConfig{
+		Server:                 config.ServerListen{Listen: ":9999"},
+		Storages:               map[string]config.StorageInfo{"a": {BaseDir: "/data/a", MaxBackups: 7}, "b": {BaseDir: "/data/b"}},
+		Logging:                config.LoggingInfo{Level: "debug"},
+		FlowRotation:           config.FlowRotationConfig{Enabled: true, EvalWindow: time.Minute},
+		ControlLostGracePeriod: time.Minute,
+	}
+	changes := h.Reload(newCfg)
+
+	want := []string{
+		"storage a changed", "storage b added", "storage gone removed",
+		"flow_rotation changed", "logging.level: info -> debug", "control_lost_grace_period: 0s -> 1m0s",
+	}
+	if strings.Join(changes, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected changes:\n got: %v\nwant: %v", changes, want)
+	}
+
+	cur := h.config()
+	if si, ok := cur.GetStorage("a"); !ok || si.MaxBackups != 7 {
+		t.Errorf("expected storage a reloaded with max_backups 7, got %+v", si)
+	}
+	if _, ok := cur.GetStorage("gone"); ok {
+		t.Error("expected removed storage to be gone for new handshakes")
+	}
+	if !cur.FlowRotation.Enabled {
+		t.Error("expected flow_rotation applied")
+	}
+	if cur.Server.Listen != ":9847" {
+		t.Errorf("server.listen requires restart, expected :9847, got %s", cur.Server.Listen)
+	}
+	if active.MaxBackups != 3 {
+		t.Error("active session storage copy must not change on reload")
+	}
+	if old.Storages["a"].MaxBackups != 3 {
+		t.Error("reload must not mutate the previous config")
+	}
+
+	if changes := h.Reload(newCfg); len(changes) != 0 {
+		t.Errorf("expected no changes on identical reload, got %v", changes)
+	}
+}
@@ -0,0 +1,406 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// restore_drill.go implementa os restore drills automáticos (config
+// restore_drills): a cada interval o server sorteia archives dos storages,
+// restaura uma amostra aleatória de arquivos no scratch_dir e compara o
+// SHA-256 e o tamanho de cada arquivo restaurado com o manifest do archive.
+//
+// O manifest da amostra é montado em uma primeira leitura do archive
+// (reservoir sampling dos arquivos regulares, com hash do conteúdo); a
+// segunda leitura extrai apenas os arquivos sorteados para a quarentena, que
+// são relidos do disco e comparados. Só a amostra toca o disco: o custo é o
+// de duas descompressões do archive, sem restaurá-lo por inteiro.
+
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// Resultados de um restore drill.
+const (
+	DrillResultOK       = "ok"
+	DrillResultMismatch = "mismatch" // algum arquivo restaurado diverge do manifest
+	DrillResultError    = "error"    // o archive não pôde ser lido ou restaurado
+)
+
+// restoreDrillTick é a granularidade do agendador dos drills; cada rodada
+// acontece após restore_drills.interval desde a anterior.
+const restoreDrillTick = time.Minute
+
+// drillSample é um arquivo sorteado de um archive, com o hash lido do archive.
+type drillSample struct {
+	name string
+	size int64
+	hash [32]byte
+}
+
+// StartRestoreDrills inicia o agendador dos restore drills. A config é
+// relida a cada tick, então restore_drills pode ser habilitado ou alterado
+// por reload. O histórico (results_file) é carregado para que o catálogo
+// mostre o último drill de cada archive e um restart não antecipe a rodada.
+func (h *Handler) StartRestoreDrills(ctx context.Context) {
+	go func() {
+		var lastRound time.Time
+		var log *os.File
+		logPath := ""
+		defer func() {
+			if log != nil {
+				log.Close()
+			}
+		}()
+
+		ticker := time.NewTicker(restoreDrillTick)
+		defer ticker.Stop()
+		for {
+			cfg := h.config().RestoreDrills
+			if cfg.Enabled {
+				if cfg.ResultsFile != logPath {
+					if log != nil {
+						log.Close()
+						log = nil
+					}
+					logPath = cfg.ResultsFile
+					var last time.Time
+					log, last = h.openDrillLog(logPath)
+					if last.After(lastRound) {
+						lastRound = last
+					}
+				}
+				if time.Since(lastRound) >= cfg.Interval {
+					lastRound = time.Now()
+					h.runDrillRound(ctx, log)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// openDrillLog abre o histórico dos drills para append, carrega o último
+// resultado de cada archive e retorna o início do drill mais recente. Falhas
+// são logadas e os drills seguem sem histórico persistido.
+func (h *Handler) openDrillLog(path string) (*os.File, time.Time) {
+	var last time.Time
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		h.logger.Warn("restore drills: creating results directory", "path", path, "error", err)
+		return nil, last
+	}
+	entries, f, rep, err := statefile.OpenLog[observability.RestoreDrillEntry](path, 0644)
+	if err != nil {
+		h.logger.Warn("restore drills: opening results file", "path", path, "error", err)
+		return nil, last
+	}
+	if !rep.Clean() {
+		h.logger.Warn("restore drills: results file had damaged records", "path", path, "report", rep.String())
+	}
+	for _, e := range entries {
+		h.restoreDrills.Store(drillKey(e.Storage, e.Agent, e.Backup, e.File), e)
+		if t, err := time.Parse(time.RFC3339, e.StartedAt); err == nil && t.After(last) {
+			last = t
+		}
+	}
+	return f, last
+}
+
+// runDrillRound sorteia os archives da rodada entre os backups do catálogo
+// (fora da quarentena) e executa um drill em cada um.
+func (h *Handler) runDrillRound(ctx context.Context, log *os.File) {
+	cfg := h.config().RestoreDrills
+	var candidates []observability.CatalogEntry
+	for _, e := range h.BackupCatalog() {
+		if !e.Quarantined {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+
+	for _, c := range candidates[:min(cfg.Archives, len(candidates))] {
+		if ctx.Err() != nil {
+			return
+		}
+		res := h.runRestoreDrill(c.Storage, c.Agent, c.Backup, c.File, cfg.SampleFiles, cfg.ScratchDir)
+		h.recordDrill(res, log)
+	}
+}
+
+// recordDrill guarda o resultado no catálogo e no histórico e emite o evento.
+func (h *Handler) recordDrill(res observability.RestoreDrillEntry, log *os.File) {
+	h.restoreDrills.Store(drillKey(res.Storage, res.Agent, res.Backup, res.File), res)
+	if log != nil {
+		if err := statefile.Append(log, res); err != nil {
+			h.logger.Warn("restore drills: appending result", "error", err)
+		}
+	}
+
+	logger := h.logger.With("storage", res.Storage, "agent", res.Agent, "backup", res.Backup, "file", res.File)
+	target := fmt.Sprintf("%s/%s/%s/%s", res.Storage, res.Agent, res.Backup, res.File)
+	level, msg := "info", fmt.Sprintf("%s: restore drill ok (%d/%d files, %d bytes)", target, res.FilesSampled, res.FilesTotal, res.BytesRestored)
+	switch res.Result {
+	case DrillResultOK:
+		logger.Info("restore drill passed", "files_sampled", res.FilesSampled, "files_total", res.FilesTotal, "bytes", res.BytesRestored, "duration", res.Duration)
+	case DrillResultMismatch:
+		level, msg = "error", fmt.Sprintf("%s: restore drill mismatch in %d of %d files: %s", target, len(res.Mismatches), res.FilesSampled, strings.Join(res.Mismatches, ", "))
+		logger.Error("restore drill found mismatching files", "mismatches", res.Mismatches)
+	default:
+		level, msg = "error", fmt.Sprintf("%s: restore drill failed: %s", target, res.Error)
+		logger.Error("restore drill failed", "error", res.Error)
+	}
+	if h.Events != nil {
+		h.Events.Push(observability.EventEntry{
+			Level:   level,
+			Type:    "restore_drill",
+			Agent:   res.Agent,
+			Storage: res.Storage,
+			Backup:  res.Backup,
+			Message: msg,
+		})
+	}
+}
+
+// lastDrill retorna o último drill do archive, ou nil se nunca houve um.
+func (h *Handler) lastDrill(storage, agent, backup, file string) *observability.RestoreDrillEntry {
+	raw, ok := h.restoreDrills.Load(drillKey(storage, agent, backup, file))
+	if !ok {
+		return nil
+	}
+	e := raw.(observability.RestoreDrillEntry)
+	return &e
+}
+
+func drillKey(storage, agent, backup, file string) string {
+	return storage + "/" + agent + "/" + backup + "/" + file
+}
+
+// runRestoreDrill executa o drill de um archive: sorteia até sampleFiles
+// arquivos regulares, restaura-os em um diretório próprio em scratchDir
+// (removido ao fim) e compara com o manifest.
+func (h *Handler) runRestoreDrill(storage, agent, backup, file string, sampleFiles int, scratchDir string) observability.RestoreDrillEntry {
+	start := time.Now()
+	res := observability.RestoreDrillEntry{
+		Storage:   storage,
+		Agent:     agent,
+		Backup:    backup,
+		File:      file,
+		StartedAt: start.UTC().Format(time.RFC3339),
+	}
+	err := func() error {
+		f, err := h.OpenBackup(storage, agent, backup, file, false)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		samples, total, err := sampleArchive(f, sampleFiles)
+		if err != nil {
+			return err
+		}
+		res.FilesTotal = total
+		res.FilesSampled = len(samples)
+		if len(samples) == 0 {
+			return nil
+		}
+
+		if err := os.MkdirAll(scratchDir, 0700); err != nil {
+			return fmt.Errorf("creating scratch directory: %w", err)
+		}
+		dir, err := os.MkdirTemp(scratchDir, "drill-*")
+		if err != nil {
+			return fmt.Errorf("creating drill directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		mismatches, restored, err := restoreSamples(f, samples, dir)
+		res.Mismatches, res.BytesRestored = mismatches, restored
+		return err
+	}()
+
+	res.Duration = time.Since(start).Round(time.Millisecond).String()
+	switch {
+	case err != nil:
+		res.Result, res.Error = DrillResultError, err.Error()
+	case len(res.Mismatches) > 0:
+		res.Result = DrillResultMismatch
+	default:
+		res.Result = DrillResultOK
+	}
+	return res
+}
+
+// archiveTarReader abre o tar de um archive .tar.gz/.tar.zst (pelo nome de f).
+func archiveTarReader(f *os.File) (*tar.Reader, func(), error) {
+	r, closeFn, err := archiveDecompressor(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tar.NewReader(r), closeFn, nil
+}
+
+// archiveDecompressor descomprime um archive .tar.gz/.tar.zst (pelo nome de
+// f) a partir da posição corrente de f.
+func archiveDecompressor(f *os.File) (io.Reader, func(), error) {
+	switch {
+	case strings.HasSuffix(f.Name(), ".tar.zst"):
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, nil, fmt.Errorf("initializing zstd reader: %w", err)
+		}
+		return zr, zr.Close, nil
+	case strings.HasSuffix(f.Name(), ".tar.gz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, nil, fmt.Errorf("initializing gzip reader: %w", err)
+		}
+		return gz, func() { gz.Close() }, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported archive extension: %s", f.Name())
+}
+
+// sampleArchive percorre o archive e sorteia (reservoir sampling) até k
+// arquivos regulares, guardando nome, tamanho e SHA-256 de cada um — o
+// manifest da amostra. Retorna também o total de arquivos regulares.
+func sampleArchive(f *os.File, k int) ([]drillSample, int64, error) {
+	tr, closeFn, err := archiveTarReader(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer closeFn()
+
+	var samples []drillSample
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, total, fmt.Errorf("reading tar entry #%d: %w", total+1, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		total++
+
+		slot := len(samples)
+		if slot >= k {
+			if slot = int(rand.Int64N(total)); slot >= k {
+				continue
+			}
+		}
+		hasher := sha256.New()
+		n, err := io.Copy(hasher, tr)
+		if err != nil {
+			return nil, total, fmt.Errorf("reading %s from archive: %w", hdr.Name, err)
+		}
+		s := drillSample{name: hdr.Name, size: n}
+		copy(s.hash[:], hasher.Sum(nil))
+		if slot == len(samples) {
+			samples = append(samples, s)
+		} else {
+			samples[slot] = s
+		}
+	}
+	return samples, total, nil
+}
+
+// restoreSamples extrai os arquivos da amostra para dir (com nomes
+// sequenciais — os caminhos do archive nunca são usados no disco), relê cada
+// um do disco e compara com o manifest. Retorna os arquivos divergentes ou
+// ausentes do archive e o total de bytes restaurados.
+func restoreSamples(f *os.File, samples []drillSample, dir string) (mismatches []string, restored int64, err error) {
+	tr, closeFn, err := archiveTarReader(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer closeFn()
+
+	pending := make(map[string]int, len(samples))
+	for i, s := range samples {
+		pending[s.name] = i
+	}
+	for len(pending) > 0 {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return mismatches, restored, fmt.Errorf("reading tar entry: %w", err)
+		}
+		i, ok := pending[hdr.Name]
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		delete(pending, hdr.Name)
+
+		path := filepath.Join(dir, fmt.Sprintf("%06d", i))
+		if err := restoreFile(tr, path); err != nil {
+			return mismatches, restored, err
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return mismatches, restored, err
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return mismatches, restored, err
+		}
+		size := fi.Size()
+		restored += size
+		if size != samples[i].size || hash != samples[i].hash {
+			mismatches = append(mismatches, "/"+hdr.Name)
+		}
+	}
+	for _, s := range samples {
+		if _, ok := pending[s.name]; ok {
+			mismatches = append(mismatches, "/"+s.name)
+		}
+	}
+	return mismatches, restored, nil
+}
+
+// restoreFile grava o conteúdo de r em path, com fsync.
+func restoreFile(r io.Reader, path string) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("creating restored file: %w", err)
+	}
+	_, err = io.Copy(out, r)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("restoring file: %w", err)
+	}
+	return nil
+}
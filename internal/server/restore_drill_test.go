@@ -0,0 +1,91 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestRestoreDrill_RestoresSampleAndRecordsResult(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "agent1", "daily")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	good := createTestTarGz(t, dir, "2026-01-01T00-00-00-000.tar.gz")
+	data, _ := os.ReadFile(good)
+	if err := os.WriteFile(filepath.Join(dir, "2026-01-02T00-00-00-000.tar.gz"), data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestHandler(t, map[string]config.StorageInfo{"s": {BaseDir: base}})
+	scratch := t.TempDir()
+
+	res := h.runRestoreDrill("s", "agent1", "daily", "2026-01-01T00-00-00-000.tar.gz", 1, scratch)
+	if res.Result != DrillResultOK || res.FilesTotal != 2 || res.FilesSampled != 1 || res.BytesRestored == 0 {
+		t.Errorf("unexpected drill result: %+v", res)
+	}
+	res = h.runRestoreDrill("s", "agent1", "daily", "2026-01-01T00-00-00-000.tar.gz", 10, scratch)
+	if res.Result != DrillResultOK || res.FilesSampled != 2 {
+		t.Errorf("sample larger than archive: %+v", res)
+	}
+	bad := h.runRestoreDrill("s", "agent1", "daily", "2026-01-02T00-00-00-000.tar.gz", 10, scratch)
+	if bad.Result != DrillResultError || bad.Error == "" {
+		t.Errorf("truncated archive should fail the drill: %+v", bad)
+	}
+	if left, _ := os.ReadDir(scratch); len(left) != 0 {
+		t.Errorf("scratch dir not cleaned up: %v", left)
+	}
+
+	// Resultado persistido e exposto no catálogo, inclusive após recarregar o histórico
+	logPath := filepath.Join(scratch, "restore-drills.jsonl")
+	log, _ := h.openDrillLog(logPath)
+	h.recordDrill(res, log)
+	log.Close()
+
+	reloaded := newTestHandler(t, map[string]config.StorageInfo{"s": {BaseDir: base}})
+	log, last := reloaded.openDrillLog(logPath)
+	log.Close()
+	if last.IsZero() {
+		t.Error("last drill time not restored from results file")
+	}
+	for _, e := range reloaded.BackupCatalog() {
+		if e.File == res.File && (e.LastDrill == nil || e.LastDrill.Result != DrillResultOK) {
+			t.Errorf("catalog entry without last drill: %+v", e)
+		}
+		if e.File != res.File && e.LastDrill != nil {
+			t.Errorf("unexpected last drill for %s", e.File)
+		}
+	}
+}
+
+func TestRestoreSamples_DetectsMismatch(t *testing.T) {
+	path := createTestTarGz(t, t.TempDir(), "backup.tar.gz")
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	samples, total, err := sampleArchive(f, 10)
+	if err != nil || total != 2 || len(samples) != 2 {
+		t.Fatalf("sampleArchive: samples=%d total=%d err=%v", len(samples), total, err)
+	}
+	samples[0].hash[0] ^= 0xff                                  // manifest divergente do conteúdo
+	samples = append(samples, drillSample{name: "missing.txt"}) // ausente do archive
+
+	f.Seek(0, 0)
+	mismatches, _, err := restoreSamples(f, samples, t.TempDir())
+	if err != nil {
+		t.Fatalf("restoreSamples: %v", err)
+	}
+	if len(mismatches) != 2 || mismatches[0] != "/"+samples[0].name || mismatches[1] != "/missing.txt" {
+		t.Errorf("unexpected mismatches: %v", mismatches)
+	}
+}
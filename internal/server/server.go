@@ -19,39 +19,107 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/quic-go/quic-go"
+
 	"github.com/nishisan-dev/n-backup/internal/config"
 	"github.com/nishisan-dev/n-backup/internal/pki"
 	"github.com/nishisan-dev/n-backup/internal/server/observability"
+	"github.com/nishisan-dev/n-backup/internal/sockopt"
 )
 
-// sessionTTL é o tempo máximo que uma sessão parcial pode ficar ativa sem resume (1h).
-const sessionTTL = 1 * time.Hour
+// sessionTTL é o tempo máximo que uma sessão parcial pode ficar ativa sem
+// resume quando o storage não define session_ttl.
+const sessionTTL = config.DefaultSessionTTL
 
 // sessionCleanupInterval é o intervalo entre limpezas de sessões expiradas.
 const sessionCleanupInterval = 5 * time.Minute
 
 // Run inicia o servidor de backup e bloqueia até o context ser cancelado.
 func Run(ctx context.Context, cfg *config.ServerConfig, logger *slog.Logger) error {
-	// Configura TLS
-	tlsCfg, err := pki.NewServerTLSConfig(cfg.TLS.CACert, cfg.TLS.ServerCert, cfg.TLS.ServerKey)
+	return RunWithReload(ctx, cfg, logger, nil)
+}
+
+// RunWithReload é como Run, mas aplica cada config recebida em reloadCh
+// (SIGHUP) sem interromper sessões ativas. reloadCh nil desabilita o reload.
+func RunWithReload(ctx context.Context, cfg *config.ServerConfig, logger *slog.Logger, reloadCh <-chan *config.ServerConfig) error {
+	// Configura TLS — cert, key e CA são recarregados do disco quando mudam,
+	// sem reiniciar o listener nem afetar sessões em andamento.
+	certReloader, err := pki.NewCertReloader(cfg.TLS.CACert, cfg.TLS.ServerCert, cfg.TLS.ServerKey, logger.With("component", "tls"))
 	if err != nil {
 		return fmt.Errorf("configuring TLS: %w", err)
 	}
 
-	// Listener TLS
-	ln, err := tls.Listen("tcp", cfg.Server.Listen, tlsCfg)
+	// Listener TLS — mTLS ou, com server.auth psk, sem certificado de client
+	tlsCfg := certReloader.ServerTLSConfig()
+	if cfg.Server.Auth == config.AuthModePSK {
+		tlsCfg = pskServerTLSConfig(certReloader)
+	}
+	tcpLn, err := sockopt.ListenConfig(cfg.Server.Socket).Listen(ctx, "tcp", cfg.Server.Listen)
 	if err != nil {
 		return fmt.Errorf("listening on %s: %w", cfg.Server.Listen, err)
 	}
+	ln := tls.NewListener(tcpLn, tlsCfg)
 	defer ln.Close()
 
-	logger.Info("server listening", "address", cfg.Server.Listen)
+	logger.Info("server listening", "address", cfg.Server.Listen, "auth", cfg.Server.Auth)
+
+	// Listener QUIC experimental (server.quic) no mesmo endereço, em UDP
+	var quicLn *quic.EarlyListener
+	if cfg.Server.QUIC {
+		quicLn, err = listenQUIC(cfg.Server.Listen, tlsCfg)
+		if err != nil {
+			return err
+		}
+		defer quicLn.Close()
+		logger.Info("server listening (quic, experimental)", "address", cfg.Server.Listen)
+	}
 
 	// Locks por agent (para prevenir backups simultâneos do mesmo agent)
 	locks := &sync.Map{}
 	sessions := &sync.Map{}
 	handler := NewHandler(cfg, logger, locks, sessions)
 
+	// Sessões parciais persistidas antes do restart (server.sessions_file)
+	if err := handler.OpenSessionStore(cfg.Server.SessionsFile, logger); err != nil {
+		return err
+	}
+
+	// Revogação (tls.crl_file) recusa o handshake TLS de certificados revogados
+	if err := handler.loadCRL(cfg.TLS.CRLFile, cfg.TLS.CACert); err != nil {
+		return err
+	}
+	certReloader.SetVerifyPeerCertificate(handler.verifyPeerCertificate)
+	if cfg.PSKEnabled() {
+		if err := handler.loadPSKKeyring(cfg.Server.PSKFile); err != nil {
+			return err
+		}
+	}
+
+	// Ledgers dos storages imutáveis (storages.*.immutable)
+	if err := handler.OpenLedgers(); err != nil {
+		return err
+	}
+
+	// Audit log de sessões (audit_log)
+	if err := handler.OpenAuditLog(cfg.AuditLog, logger); err != nil {
+		return err
+	}
+	defer handler.Audit.Close()
+
+	// Contabilidade de ingestão por agent/storage/dia (accounting)
+	if err := handler.OpenAccounting(cfg.Accounting, logger); err != nil {
+		return err
+	}
+	if handler.Accounting != nil {
+		defer handler.Accounting.Close()
+	}
+
+	// Listeners adicionais (listeners) — mesmo Handler, política própria
+	listenerReloaders, err := startListeners(ctx, cfg, handler, certReloader, logger)
+	if err != nil {
+		return err
+	}
+
 	// Goroutine para cleanup de sessões expiradas
 	go func() {
 		ticker := time.NewTicker(sessionCleanupInterval)
@@ -66,14 +134,59 @@ func Run(ctx context.Context, cfg *config.ServerConfig, logger *slog.Logger) err
 		}
 	}()
 
+	// Sweep de .tmp e chunks_* órfãos: no start (após o restore das sessões) e periódico
+	go handler.StartOrphanSweeper(ctx)
+
 	// Web UI HTTP server (observabilidade)
 	if cfg.WebUI.Enabled {
 		startWebUI(ctx, cfg, handler, logger)
 	}
 
+	// Webhooks e rotas de chat (notifications.webhook/slack/telegram) — assinam o EventStore
+	startWebhooks(ctx, cfg, handler, logger)
+	startChatNotifier(ctx, cfg, handler, logger)
+
+	// Resumo de falhas e digest (notifications.failures / notifications.digest,
+	// via SMTP e chat) — assina o EventStore
+	if err := startMailNotifier(ctx, cfg, handler, logger); err != nil {
+		return err
+	}
+
+	// Enrollment de agents (PKI embutida) — listener TLS dedicado, sem mTLS
+	if cfg.Enrollment.Enabled {
+		if err := startEnrollment(ctx, cfg, handler, certReloader, logger); err != nil {
+			return err
+		}
+	}
+
+	// Snapshot groups com schedule — execução coordenada entre agents
+	if err := startSnapshotGroups(ctx, cfg, handler, logger); err != nil {
+		return err
+	}
+
+	// Admin socket local (`nbackup-server sessions|agents|storage`). Uma falha
+	// não impede o start — o data plane não depende dele.
+	if sock := cfg.Server.AdminSocket; sock.Enabled != nil && *sock.Enabled {
+		admin := NewAdminServer(sock.Path, handlerAdmin{handler}, logger)
+		if err := admin.Start(); err != nil {
+			logger.Error("admin socket unavailable", "error", err)
+		} else {
+			defer admin.Stop()
+		}
+	}
+
 	// Stats reporter — imprime métricas a cada 15s
 	go handler.StartStatsReporter(ctx)
 
+	// Saúde do disco dos storages com disk_health (smartctl ou probe)
+	handler.StartDiskHealth(ctx)
+
+	// Restore drills periódicos (restore_drills)
+	handler.StartRestoreDrills(ctx)
+
+	// Recompressão de backups antigos (storages.*.lifecycle)
+	handler.StartLifecycle(ctx)
+
 	// Chunk buffer drainer — desabilitado quando chunk_buffer.size é 0
 	handler.StartChunkBuffer(ctx)
 
@@ -92,39 +205,43 @@ func Run(ctx context.Context, cfg *config.ServerConfig, logger *slog.Logger) err
 		}
 	}()
 
-	// Goroutine para fechar o listener quando o context for cancelado
+	// Reload de config (SIGHUP, lido e validado pelo chamador)
+	if reloadCh != nil {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case newCfg := <-reloadCh:
+					handler.Reload(newCfg)
+					certReloader.Check()
+					for _, r := range listenerReloaders {
+						r.Check()
+					}
+				}
+			}
+		}()
+	}
+
+	// Conexões do listener principal (TCP e QUIC) seguem server.auth
+	mainCtx := withListener(ctx, &listenerPolicy{name: mainListenerName, auth: cfg.Server.Auth})
+	if quicLn != nil {
+		go handler.ServeQUIC(mainCtx, quicLn)
+	}
+
+	// Goroutine para fechar os listeners quando o context for cancelado
 	go func() {
 		<-ctx.Done()
 		logger.Info("shutting down server")
 		ln.Close()
-	}()
-
-	// Accept loop com backoff para prevenir hot loop em erros consecutivos
-	consecutiveErrors := 0
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			select {
-			case <-ctx.Done():
-				logger.Info("server shutdown complete")
-				return nil
-			default:
-				consecutiveErrors++
-				logger.Error("accepting connection", "error", err, "consecutive_errors", consecutiveErrors)
-				if consecutiveErrors > 5 {
-					delay := time.Duration(consecutiveErrors) * 100 * time.Millisecond
-					if delay > 5*time.Second {
-						delay = 5 * time.Second
-					}
-					time.Sleep(delay)
-				}
-				continue
-			}
+		if quicLn != nil {
+			quicLn.Close()
 		}
+	}()
 
-		consecutiveErrors = 0
-		go handler.HandleConnection(ctx, conn)
-	}
+	handler.acceptLoop(mainCtx, ln, logger)
+	logger.Info("server shutdown complete")
+	return nil
 }
 
 // RunWithListener inicia o servidor com um listener já existente (para testes).
@@ -133,6 +250,37 @@ func RunWithListener(ctx context.Context, ln net.Listener, cfg *config.ServerCon
 	sessions := &sync.Map{}
 	handler := NewHandler(cfg, logger, locks, sessions)
 
+	// Sessões parciais persistidas antes do restart (server.sessions_file)
+	if err := handler.OpenSessionStore(cfg.Server.SessionsFile, logger); err != nil {
+		return err
+	}
+
+	// Listener com auth psk: o chamador fornece ln com pskServerTLSConfig equivalente
+	if cfg.Server.Auth == config.AuthModePSK {
+		if err := handler.loadPSKKeyring(cfg.Server.PSKFile); err != nil {
+			return err
+		}
+	}
+
+	// Ledgers dos storages imutáveis (storages.*.immutable)
+	if err := handler.OpenLedgers(); err != nil {
+		return err
+	}
+
+	// Audit log de sessões (audit_log)
+	if err := handler.OpenAuditLog(cfg.AuditLog, logger); err != nil {
+		return err
+	}
+	defer handler.Audit.Close()
+
+	// Contabilidade de ingestão por agent/storage/dia (accounting)
+	if err := handler.OpenAccounting(cfg.Accounting, logger); err != nil {
+		return err
+	}
+	if handler.Accounting != nil {
+		defer handler.Accounting.Close()
+	}
+
 	// Cleanup goroutine
 	go func() {
 		ticker := time.NewTicker(sessionCleanupInterval)
@@ -147,14 +295,36 @@ func RunWithListener(ctx context.Context, ln net.Listener, cfg *config.ServerCon
 		}
 	}()
 
+	// Sweep de .tmp e chunks_* órfãos: no start (após o restore das sessões) e periódico
+	go handler.StartOrphanSweeper(ctx)
+
 	// Web UI HTTP server (observabilidade)
 	if cfg.WebUI.Enabled {
 		startWebUI(ctx, cfg, handler, logger)
 	}
 
+	// Webhooks e rotas de chat (notifications.webhook/slack/telegram) — assinam o EventStore
+	startWebhooks(ctx, cfg, handler, logger)
+	startChatNotifier(ctx, cfg, handler, logger)
+
+	// Resumo de falhas e digest (notifications.failures / notifications.digest,
+	// via SMTP e chat) — assina o EventStore
+	if err := startMailNotifier(ctx, cfg, handler, logger); err != nil {
+		return err
+	}
+
 	// Stats reporter
 	go handler.StartStatsReporter(ctx)
 
+	// Saúde do disco dos storages com disk_health
+	handler.StartDiskHealth(ctx)
+
+	// Restore drills periódicos (restore_drills)
+	handler.StartRestoreDrills(ctx)
+
+	// Recompressão de backups antigos (storages.*.lifecycle)
+	handler.StartLifecycle(ctx)
+
 	// Chunk buffer drainer — desabilitado quando chunk_buffer.size é 0
 	handler.StartChunkBuffer(ctx)
 
@@ -163,30 +333,8 @@ func RunWithListener(ctx context.Context, ln net.Listener, cfg *config.ServerCon
 		ln.Close()
 	}()
 
-	consecutiveErrors := 0
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			select {
-			case <-ctx.Done():
-				return nil
-			default:
-				consecutiveErrors++
-				logger.Error("accepting connection", "error", err, "consecutive_errors", consecutiveErrors)
-				if consecutiveErrors > 5 {
-					delay := time.Duration(consecutiveErrors) * 100 * time.Millisecond
-					if delay > 5*time.Second {
-						delay = 5 * time.Second
-					}
-					time.Sleep(delay)
-				}
-				continue
-			}
-		}
-
-		consecutiveErrors = 0
-		go handler.HandleConnection(ctx, conn)
-	}
+	handler.acceptLoop(ctx, ln, logger)
+	return nil
 }
 
 // startWebUI inicia o listener HTTP da SPA de observabilidade em background.
@@ -5,12 +5,14 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"log/slog"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -204,6 +206,69 @@ func TestRotate_IgnoresNonTarGz(t *testing.T) {
 	}
 }
 
+func TestAtomicWriter_CommitWithLayout(t *testing.T) {
+	dir := t.TempDir()
+	layout, err := config.ParseStorageLayout("{agent}/{backup}/{year}/m{month}/{timestamp}.tar.{ext}")
+	if err != nil {
+		t.Fatalf("ParseStorageLayout: %v", err)
+	}
+	w, err := NewStorageWriter(config.StorageInfo{BaseDir: dir, CompressionMode: "zst", LayoutRaw: layout}, "web-01", "app")
+	if err != nil {
+		t.Fatalf("NewStorageWriter: %v", err)
+	}
+
+	_, tmpPath, err := w.TempFile()
+	if err != nil {
+		t.Fatalf("TempFile: %v", err)
+	}
+	finalPath, err := w.Commit(tmpPath)
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	rel, _ := filepath.Rel(w.AgentDir(), finalPath)
+	now := time.Now().UTC()
+	if want := filepath.Join(now.Format("2006"), "m"+now.Format("01")); filepath.Dir(rel) != want || !strings.HasSuffix(rel, ".tar.zst") {
+		t.Fatalf("expected backup under %s, got %s", want, rel)
+	}
+	if p, ok := findBackup(w.AgentDir(), filepath.Base(finalPath)); !ok || p != finalPath {
+		t.Errorf("findBackup: got %q (ok=%v), want %q", p, ok, finalPath)
+	}
+}
+
+func TestRotate_LayoutDirectories(t *testing.T) {
+	dir := t.TempDir()
+
+	// Backups de um layout por mês, um anterior ao layout e um em quarentena
+	for _, rel := range []string{
+		"2026-01-10T02-00-00.tar.gz",
+		"2026/01/2026-01-31T02-00-00.tar.gz",
+		"2026/02/2026-02-01T02-00-00.tar.gz",
+		"2026/02/2026-02-02T02-00-00.tar.gz",
+		".quarantine/2025-12-01T02-00-00.tar.gz",
+	} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, rel)), 0755)
+		os.WriteFile(filepath.Join(dir, rel), []byte("data"), 0644)
+	}
+
+	removed, err := Rotate(dir, 2)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	want := []string{"2026-01-10T02-00-00.tar.gz", filepath.Join("2026", "01", "2026-01-31T02-00-00.tar.gz")}
+	if len(removed) != 2 || removed[0] != want[0] || removed[1] != want[1] {
+		t.Fatalf("expected %v removed, got %v", want, removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2026", "01")); !os.IsNotExist(err) {
+		t.Error("expected empty month directory to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".quarantine", "2025-12-01T02-00-00.tar.gz")); err != nil {
+		t.Error("expected quarantined backup to be kept")
+	}
+	if latest := latestBackup(dir); latest != "2026-02-02T02-00-00.tar.gz" {
+		t.Errorf("expected latest 2026-02-02T02-00-00.tar.gz, got %q", latest)
+	}
+}
+
 func TestCleanupExpiredSessions_MixedTypes(t *testing.T) {
 	dir := t.TempDir()
 	logger := slog.Default()
@@ -740,3 +805,204 @@ func TestHandleParallelJoin_RejectsClosingSessionBeforeAckOK(t *testing.T) {
 	serverConn.Close()
 	<-done
 }
+
+// TestRecordSessionEnd_ConfigSnapshotDiff verifica que o session history registra
+// o snapshot da config efetiva e o diff contra a sessão anterior do mesmo backup.
+func TestRecordSessionEnd_ConfigSnapshotDiff(t *testing.T) {
+	dir := t.TempDir()
+	sessionHistory, err := observability.NewSessionHistoryStore(filepath.Join(dir, "session-history.jsonl"), 100, 1000)
+	if err != nil {
+		t.Fatalf("NewSessionHistoryStore: %v", err)
+	}
+	defer sessionHistory.Close()
+
+	h := &Handler{cfg: &config.ServerConfig{}, SessionHistory: sessionHistory}
+
+	si := config.StorageInfo{CompressionMode: "gzip", AssemblerMode: "eager", MaxBackups: 5}
+	first := newSessionConfigSnapshot(si, 4, 1024*1024)
+	h.recordSessionEnd("s1", "agent-a", "scripts", "app", "parallel", "gzip", "ok", time.Now(), 100, first, nil)
+
+	si.CompressionMode = "zst"
+	second := newSessionConfigSnapshot(si, 4, 1024*1024)
+	h.recordSessionEnd("s2", "agent-a", "scripts", "app", "parallel", "zst", "ok", time.Now(), 100, second, nil)
+
+	// Backup diferente não deve ser comparado com o anterior
+	h.recordSessionEnd("s3", "agent-a", "scripts", "other", "parallel", "zst", "ok", time.Now(), 100, second, nil)
+
+	history := sessionHistory.Recent(0)
+	if len(history) != 3 {
+		t.Fatalf("expected 3 history entries, got %d", len(history))
+	}
+	if history[0].ConfigHash == "" || history[0].Config == nil {
+		t.Fatal("expected config snapshot on first session")
+	}
+	if len(history[0].ConfigChanges) != 0 {
+		t.Errorf("expected no changes on first session, got %v", history[0].ConfigChanges)
+	}
+	if history[1].ConfigHash == history[0].ConfigHash {
+		t.Error("expected different hash after compression change")
+	}
+	if len(history[1].ConfigChanges) != 1 || history[1].ConfigChanges[0] != `compression_mode: "gzip" -> "zst"` {
+		t.Errorf("unexpected config changes: %v", history[1].ConfigChanges)
+	}
+	if len(history[2].ConfigChanges) != 0 {
+		t.Errorf("expected no changes for a different backup, got %v", history[2].ConfigChanges)
+	}
+}
+
+// TestRecordSessionEnd_AuditLog verifica que o fim da sessão fecha o ciclo de
+// vida no audit log, com o path do commit e as retransmissões no índice.
+func TestRecordSessionEnd_AuditLog(t *testing.T) {
+	audit, err := observability.OpenAuditLog(t.TempDir(), 1<<20, 5)
+	if err != nil {
+		t.Fatalf("OpenAuditLog: %v", err)
+	}
+	defer audit.Close()
+	h := &Handler{cfg: &config.ServerConfig{}, Audit: audit}
+
+	key := auditKey("agent-a", "scripts", "app")
+	audit.Begin(key, observability.AuditRecord{SessionID: "s1", Event: observability.AuditHandshake, Agent: "agent-a", Mode: "parallel"})
+	h.auditCommit(key, "/data/agent-a/app/x.tar.gz", "")
+	streams := []observability.StreamTransfer{{Stream: 0, BytesSent: 100, RetransmitBytes: 10}, {Stream: 1, BytesSent: 50, RetransmitBytes: 5}}
+	h.recordSessionEnd("s1", "agent-a", "scripts", "app", "parallel", "gzip", "ok", time.Now().Add(-time.Minute), 150, nil, streams)
+
+	index, err := h.QueryAuditSessions(observability.SessionHistoryFilter{})
+	if err != nil || len(index) != 1 || index[0].CommitPath != "/data/agent-a/app/x.tar.gz" {
+		t.Fatalf("unexpected audit index: %+v (%v)", index, err)
+	}
+	records, err := h.AuditSession("s1")
+	if err != nil || len(records) != 3 {
+		t.Fatalf("unexpected audit records: %+v (%v)", records, err)
+	}
+	if end := records[2]; end.Event != observability.AuditEnd || end.RetransmitBytes != 15 || end.DurationSeconds < 60 {
+		t.Errorf("unexpected end record: %+v", end)
+	}
+}
+
+// TestRecordSessionEnd_RetransmitOverhead verifica que os totais por stream do
+// ControlSessionSummary viram overhead de retransmissão no session history.
+func TestRecordSessionEnd_RetransmitOverhead(t *testing.T) {
+	dir := t.TempDir()
+	sessionHistory, err := observability.NewSessionHistoryStore(filepath.Join(dir, "session-history.jsonl"), 100, 1000)
+	if err != nil {
+		t.Fatalf("NewSessionHistoryStore: %v", err)
+	}
+	defer sessionHistory.Close()
+
+	h := &Handler{cfg: &config.ServerConfig{}, SessionHistory: sessionHistory}
+
+	ps := &ParallelSession{}
+	if ps.streamTransfers() != nil {
+		t.Fatal("expected nil stream transfers without summary")
+	}
+	ps.TransferSummary.Store(&protocol.ControlSessionSummary{
+		SessionID: "s1",
+		Streams: []protocol.StreamTransferStats{
+			{StreamIndex: 0, BytesSent: 600, RetransmitBytes: 100},
+			{StreamIndex: 1, BytesSent: 400, RetransmitBytes: 0},
+		},
+	})
+	h.recordSessionEnd("s1", "agent-a", "scripts", "app", "parallel", "gzip", "ok", time.Now(), 900, nil, ps.streamTransfers())
+
+	history := sessionHistory.Recent(0)
+	if len(history) != 1 {
+		t.Fatalf("expected 1 history entry, got %d", len(history))
+	}
+	entry := history[0]
+	if entry.RetransmitBytes != 100 {
+		t.Errorf("expected retransmit_bytes 100, got %d", entry.RetransmitBytes)
+	}
+	if entry.RetransmitOverheadPct != 10 {
+		t.Errorf("expected overhead 10%%, got %f", entry.RetransmitOverheadPct)
+	}
+	if len(entry.Streams) != 2 || entry.Streams[0].GoodputBytes != 500 || entry.Streams[1].GoodputBytes != 400 {
+		t.Errorf("unexpected per-stream transfers: %+v", entry.Streams)
+	}
+}
+
+func TestNegotiateSACKWindow(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		name string
+		req  protocol.SACKWindow
+		want protocol.SACKWindow
+	}{
+		{"default", protocol.SACKWindow{}, protocol.SACKWindow{Interval: sackInterval}},
+		{"granted as requested", protocol.SACKWindow{Interval: 8 * mb, MaxInFlight: 64 * mb}, protocol.SACKWindow{Interval: 8 * mb, MaxInFlight: 64 * mb}},
+		{"interval clamped to minimum", protocol.SACKWindow{Interval: 1024}, protocol.SACKWindow{Interval: protocol.MinSACKInterval}},
+		{"interval clamped to maximum", protocol.SACKWindow{Interval: 512 * mb}, protocol.SACKWindow{Interval: protocol.MaxSACKInterval}},
+		{"interval at most half the window", protocol.SACKWindow{MaxInFlight: 2 * mb}, protocol.SACKWindow{Interval: mb, MaxInFlight: 2 * mb}},
+		{"window grows to two intervals", protocol.SACKWindow{MaxInFlight: 64 * 1024}, protocol.SACKWindow{Interval: protocol.MinSACKInterval, MaxInFlight: 2 * protocol.MinSACKInterval}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateSACKWindow(tt.req); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteServerLoad(t *testing.T) {
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: t.TempDir()}})
+
+	ca, err := NewChunkAssemblerWithMemLimit("s-load", t.TempDir(), slog.Default(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Cleanup()
+	// Chunk 1 fora de ordem fica pendente em memória
+	if err := ca.WriteChunk(1, strings.NewReader("pending"), 7); err != nil {
+		t.Fatal(err)
+	}
+
+	announced := &ParallelSession{SessionID: "s-load", AgentName: "web-01", StorageName: "default", Assembler: ca}
+	announced.ServerLoad.Store(true)
+	h.sessions.Store("s-load", announced)
+	h.sessions.Store("s-legacy", &ParallelSession{SessionID: "s-legacy", AgentName: "web-01", StorageName: "default"})
+	other := &ParallelSession{SessionID: "s-other", AgentName: "db-01", StorageName: "default"}
+	other.ServerLoad.Store(true)
+	h.sessions.Store("s-other", other)
+
+	var buf bytes.Buffer
+	if err := h.writeServerLoad(&buf, "web-01"); err != nil {
+		t.Fatalf("writeServerLoad: %v", err)
+	}
+	magic, err := protocol.ReadControlMagic(&buf)
+	if err != nil || magic != protocol.MagicControlServerLoad {
+		t.Fatalf("expected CSVL frame, got %q (%v)", magic, err)
+	}
+	load, err := protocol.ReadControlServerLoadPayload(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if load.SessionID != "s-load" || load.PendingBytes != 7 || load.WriteLatency == 0 || load.QueueDepth != 0 {
+		t.Errorf("unexpected server load %+v", load)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected a single frame (legacy and other agents' sessions skipped), %d bytes left", buf.Len())
+	}
+}
+
+func TestReadParallelChunkPayload_RejectsAboveChunkSizeMax(t *testing.T) {
+	h := &Handler{}
+	session := &ParallelSession{SessionID: "s-max", ChunkSize: 64 * 1024, ChunkSizeMax: 128 * 1024}
+	serverConn, agentConn := net.Pipe()
+	defer serverConn.Close()
+	defer agentConn.Close()
+
+	// Recusado sem ler (nem alocar) o payload: o agent não chega a escrever
+	if _, err := h.readParallelChunkPayload(serverConn, serverConn, 4<<30-1, 1, session); err == nil || !strings.Contains(err.Error(), "exceeds negotiated chunk size max") {
+		t.Fatalf("expected chunk above ChunkSizeMax to be rejected, got %v", err)
+	}
+
+	payload := bytes.Repeat([]byte{0xAB}, int(session.ChunkSizeMax))
+	go agentConn.Write(payload)
+	got, err := h.readParallelChunkPayload(serverConn, serverConn, session.ChunkSizeMax, 2, session)
+	if err != nil {
+		t.Fatalf("expected chunk of ChunkSizeMax to be accepted, got %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Error("payload mismatch")
+	}
+}
@@ -17,18 +17,19 @@ import (
 
 // SessionPhase constantes para as fases do ciclo de vida da sessão.
 const (
-	PhaseReceiving  = "receiving"
-	PhaseAssembling = "assembling"
-	PhaseVerifying  = "verifying"
-	PhaseUploading  = "uploading"
-	PhaseDone       = "done"
-	PhaseFailed     = "failed"
+	PhaseReceiving     = "receiving"
+	PhaseAssembling    = "assembling"
+	PhaseVerifying     = "verifying"
+	PhaseDeduplicating = "deduplicating"
+	PhaseUploading     = "uploading"
+	PhaseDone          = "done"
+	PhaseFailed        = "failed"
 )
 
 // SessionPhaseTracker rastreia a fase atual de uma sessão de backup.
 // Leitura lock-free via atomic.Value para uso pelo HTTP handler.
 type SessionPhaseTracker struct {
-	phase atomic.Value // string: receiving | assembling | verifying | uploading | done | failed
+	phase atomic.Value // string: receiving | assembling | verifying | deduplicating | uploading | done | failed
 }
 
 // NewSessionPhaseTracker cria um tracker com a fase inicial "receiving".
@@ -0,0 +1,313 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// session_store.go persiste as sessões parciais em server.sessions_file para
+// que sobrevivam a um restart do server.
+//
+// As sessões vivem em h.sessions (sync.Map); cada Store/Delete feito via
+// storeSession/deleteSession reescreve o arquivo (formato statefile). No start,
+// as sessões single-stream cujo .tmp ainda existe voltam ao mapa e o agent
+// retoma com o resume normal, a partir do tamanho do .tmp.
+//
+// As paralelas persistem também MaxStreams, os tamanhos de chunk e o
+// checkpoint do ChunkAssembler, atualizado periodicamente: o watermark de
+// chunks montados (NextSeq), os bytes com fsync e o estado do SHA-256. No
+// start, voltam ao mapa a partir do checkpoint e esperam o RESUME do agent,
+// que assume a conexão primária (ver parallel_resume.go). Os offsets por
+// stream não são persistidos: os ChunkSACKs cobrem dados ainda em memória, e
+// os streams recomeçam do offset 0 a partir do checkpoint. Sessões sem
+// checkpoint (assembler_mode lazy, que só monta no finalize) não são
+// retomáveis e têm o staging removido, com aviso no log.
+
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// sessionRecord é o estado persistido de uma sessão parcial.
+type sessionRecord struct {
+	SessionID       string                               `json:"session_id"`
+	Mode            string                               `json:"mode"` // single | parallel
+	AgentName       string                               `json:"agent"`
+	StorageName     string                               `json:"storage"`
+	Placement       string                               `json:"placement,omitempty"`
+	BackupName      string                               `json:"backup"`
+	BaseDir         string                               `json:"base_dir"`
+	TmpPath         string                               `json:"tmp_path,omitempty"`  // single: arquivo .tmp recebido
+	AgentDir        string                               `json:"agent_dir,omitempty"` // parallel: diretório do staging
+	CreatedAt       time.Time                            `json:"created_at"`
+	ClientVersion   string                               `json:"client_version,omitempty"`
+	CompressionMode string                               `json:"compression_mode,omitempty"`
+	Config          *observability.SessionConfigSnapshot `json:"config,omitempty"`
+
+	// parallel: parâmetros do ParallelInit e prefixo durável do arquivo montado
+	MaxStreams   uint8                `json:"max_streams,omitempty"`
+	ChunkSize    uint32               `json:"chunk_size,omitempty"`
+	ChunkSizeMax uint32               `json:"chunk_size_max,omitempty"`
+	Checkpoint   *AssemblerCheckpoint `json:"checkpoint,omitempty"` // nil = não retomável
+}
+
+// newSessionRecord monta o registro persistido de uma sessão do mapa.
+func newSessionRecord(id string, value any) (sessionRecord, bool) {
+	switch s := value.(type) {
+	case *PartialSession:
+		return sessionRecord{
+			SessionID:       id,
+			Mode:            "single",
+			AgentName:       s.AgentName,
+			StorageName:     s.StorageName,
+			Placement:       s.Placement,
+			BackupName:      s.BackupName,
+			BaseDir:         s.BaseDir,
+			TmpPath:         s.TmpPath,
+			CreatedAt:       s.CreatedAt,
+			ClientVersion:   s.ClientVersion,
+			CompressionMode: s.CompressionMode,
+			Config:          s.Config,
+		}, true
+	case *ParallelSession:
+		return sessionRecord{
+			SessionID:       id,
+			Mode:            "parallel",
+			AgentName:       s.AgentName,
+			StorageName:     s.StorageName,
+			Placement:       s.Placement,
+			BackupName:      s.BackupName,
+			BaseDir:         s.StorageInfo.BaseDir,
+			AgentDir:        s.Writer.AgentDir(),
+			CreatedAt:       s.CreatedAt,
+			ClientVersion:   s.ClientVersion,
+			CompressionMode: s.StorageInfo.CompressionMode,
+			Config:          s.Config,
+			MaxStreams:      s.MaxStreams,
+			ChunkSize:       s.ChunkSize,
+			ChunkSizeMax:    s.ChunkSizeMax,
+			Checkpoint:      s.Checkpoint.Load(),
+		}, true
+	}
+	return sessionRecord{}, false
+}
+
+// sessionStore mantém server.sessions_file. Um store nil (sessions_file não
+// configurado) ignora todas as operações.
+type sessionStore struct {
+	path    string
+	mu      sync.Mutex
+	records map[string]sessionRecord
+}
+
+// openSessionStore lê os registros de path (arquivo inexistente = nenhum).
+func openSessionStore(path string) (*sessionStore, []sessionRecord, statefile.Report, error) {
+	records, rep, err := statefile.ReadLog[sessionRecord](path)
+	if err != nil {
+		return nil, nil, rep, fmt.Errorf("reading sessions file %s: %w", path, err)
+	}
+	s := &sessionStore{path: path, records: make(map[string]sessionRecord, len(records))}
+	for _, r := range records {
+		s.records[r.SessionID] = r
+	}
+	return s, records, rep, nil
+}
+
+// put grava (ou substitui) o registro da sessão.
+func (s *sessionStore) put(r sessionRecord) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[r.SessionID] = r
+	return s.writeLocked()
+}
+
+// remove apaga o registro da sessão, se existir.
+func (s *sessionStore) remove(id string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[id]; !ok {
+		return nil
+	}
+	delete(s.records, id)
+	return s.writeLocked()
+}
+
+// refresh substitui o registro da sessão apenas se ele ainda existir: um
+// checkpoint que termina depois do deleteSession não recria a sessão.
+func (s *sessionStore) refresh(r sessionRecord) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[r.SessionID]; !ok {
+		return nil
+	}
+	s.records[r.SessionID] = r
+	return s.writeLocked()
+}
+
+// retain mantém apenas os registros de keep (usado no restore).
+func (s *sessionStore) retain(keep map[string]bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.records {
+		if !keep[id] {
+			delete(s.records, id)
+		}
+	}
+	return s.writeLocked()
+}
+
+// writeLocked reescreve o arquivo de forma atômica. Deve ser chamado com s.mu held.
+func (s *sessionStore) writeLocked() error {
+	records := make([]sessionRecord, 0, len(s.records))
+	for _, r := range s.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+	return statefile.WriteLog(s.path, records, 0600)
+}
+
+// storeSession registra a sessão no mapa e em server.sessions_file.
+func (h *Handler) storeSession(id string, value any) {
+	h.sessions.Store(id, value)
+	if r, ok := newSessionRecord(id, value); ok {
+		if err := h.sessionStore.put(r); err != nil {
+			h.logger.Warn("persisting session", "session", id, "error", err)
+		}
+	}
+}
+
+// refreshSession regrava em server.sessions_file o estado de uma sessão que
+// continua no mapa (ex: novo checkpoint de uma sessão paralela).
+func (h *Handler) refreshSession(id string, value any) {
+	if r, ok := newSessionRecord(id, value); ok {
+		if err := h.sessionStore.refresh(r); err != nil {
+			h.logger.Warn("persisting session", "session", id, "error", err)
+		}
+	}
+}
+
+// deleteSession remove a sessão do mapa e de server.sessions_file.
+func (h *Handler) deleteSession(id string) {
+	h.sessions.Delete(id)
+	if err := h.sessionStore.remove(id); err != nil {
+		h.logger.Warn("removing persisted session", "session", id, "error", err)
+	}
+}
+
+// OpenSessionStore habilita a persistência de sessões em path e restaura as
+// sessões gravadas antes do restart. Deve ser chamado antes de aceitar
+// conexões. path vazio desabilita a persistência.
+func (h *Handler) OpenSessionStore(path string, logger *slog.Logger) error {
+	if path == "" {
+		return nil
+	}
+	store, records, rep, err := openSessionStore(path)
+	if err != nil {
+		return err
+	}
+	if !rep.Clean() {
+		logger.Warn("sessions file has invalid records, ignoring them", "path", path, "report", rep.String())
+	}
+
+	keep := make(map[string]bool, len(records))
+	for _, r := range records {
+		if h.restoreSession(r, logger) {
+			keep[r.SessionID] = true
+		}
+	}
+	if err := store.retain(keep); err != nil {
+		return fmt.Errorf("writing sessions file %s: %w", path, err)
+	}
+	h.sessionStore = store
+	if len(records) > 0 {
+		logger.Info("persisted sessions loaded", "path", path, "restored", len(keep), "discarded", len(records)-len(keep))
+	}
+	return nil
+}
+
+// restoreSession recoloca no mapa uma sessão persistida e informa se ela
+// continua retomável.
+func (h *Handler) restoreSession(r sessionRecord, logger *slog.Logger) bool {
+	logger = logger.With("session", r.SessionID, "agent", r.AgentName, "storage", r.StorageName, "backup", r.BackupName)
+
+	if r.Mode == "parallel" {
+		return h.restoreParallelSession(r, logger)
+	}
+
+	if _, ok := h.config().GetStorage(r.StorageName); !ok {
+		logger.Warn("persisted session refers to unknown storage, discarding", "tmp_path", r.TmpPath)
+		return false
+	}
+	fi, err := os.Stat(r.TmpPath)
+	if err != nil {
+		logger.Warn("tmp file of persisted session gone, discarding", "path", r.TmpPath, "error", err)
+		return false
+	}
+
+	session := &PartialSession{
+		TmpPath:         r.TmpPath,
+		AgentName:       r.AgentName,
+		StorageName:     r.StorageName,
+		Placement:       r.Placement,
+		BackupName:      r.BackupName,
+		BaseDir:         r.BaseDir,
+		CreatedAt:       r.CreatedAt,
+		ClientVersion:   r.ClientVersion,
+		CompressionMode: r.CompressionMode,
+		Config:          r.Config,
+		Phase:           NewSessionPhaseTracker(),
+	}
+	session.BytesWritten.Store(fi.Size())
+	// O TTL (CleanupExpiredSessions) conta a partir do restore: o agent não
+	// podia retomar enquanto o server estava parado.
+	session.LastActivity.Store(time.Now().UnixNano())
+	h.sessions.Store(r.SessionID, session)
+	logger.Info("persisted session restored, waiting for resume", "bytes", fi.Size())
+	return true
+}
+
+// restoreParallelSession recoloca no mapa uma sessão paralela a partir do
+// checkpoint persistido. Ela fica Detached — sem conexão primária, recusando
+// ParallelJoin — até o RESUME do agent (handleParallelResume).
+func (h *Handler) restoreParallelSession(r sessionRecord, logger *slog.Logger) bool {
+	if _, ok := h.config().GetStorage(r.StorageName); !ok {
+		logger.Warn("persisted session refers to unknown storage, discarding", "agent_dir", r.AgentDir)
+		return false
+	}
+	session, err := h.newResumedParallelSession(r, logger)
+	if err != nil {
+		removeParallelStaging(r.AgentDir, r.SessionID)
+		logger.Warn("parallel session cannot be resumed after restart, staging removed", "error", err)
+		return false
+	}
+	session.Detached.Store(true)
+	// O TTL conta a partir do restore, como nas sessões single-stream
+	session.LastActivity.Store(time.Now().UnixNano())
+	h.sessions.Store(r.SessionID, session)
+	logger.Info("persisted parallel session restored, waiting for resume",
+		"next_seq", r.Checkpoint.NextSeq, "bytes", r.Checkpoint.Bytes)
+	return true
+}
+
+// removeParallelStaging remove o arquivo montado e os chunks de uma sessão
+// paralela que não será retomada.
+func removeParallelStaging(agentDir, sessionID string) {
+	os.Remove(filepath.Join(agentDir, fmt.Sprintf("assembled_%s.tmp", sessionID)))
+	removeChunkTree(filepath.Join(agentDir, fmt.Sprintf("chunks_%s", sessionID)))
+}
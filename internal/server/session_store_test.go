@@ -0,0 +1,250 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+func TestSessionStore_RestoresSingleSessionAfterRestart(t *testing.T) {
+	baseDir := t.TempDir()
+	storages := map[string]config.StorageInfo{"default": {BaseDir: baseDir}}
+	storePath := filepath.Join(t.TempDir(), "sessions.jsonl")
+
+	// Server "antes do restart": uma sessão single com 4KB recebidos e uma
+	// paralela sem checkpoint (assembler_mode lazy)
+	h := newTestHandler(t, storages)
+	if err := h.OpenSessionStore(storePath, slog.Default()); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := NewAtomicWriter(baseDir, "agent-1", "home", ".tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile, tmpPath, err := writer.TempFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Write(make([]byte, 4096))
+	tmpFile.Close()
+	h.storeSession("single-1", &PartialSession{
+		TmpPath:     tmpPath,
+		AgentName:   "agent-1",
+		StorageName: "default",
+		BackupName:  "home",
+		BaseDir:     baseDir,
+		CreatedAt:   time.Now(),
+		Phase:       NewSessionPhaseTracker(),
+	})
+
+	chunkDir := filepath.Join(writer.AgentDir(), "chunks_parallel-1")
+	assembled := filepath.Join(writer.AgentDir(), "assembled_parallel-1.tmp")
+	os.MkdirAll(chunkDir, 0755)
+	os.WriteFile(assembled, []byte("partial"), 0644)
+	h.sessionStore.put(sessionRecord{SessionID: "parallel-1", Mode: "parallel", AgentName: "agent-1",
+		StorageName: "default", BackupName: "home", AgentDir: writer.AgentDir(), CreatedAt: time.Now()})
+
+	// Restart: novo handler, mesmo sessions_file
+	h2 := newTestHandler(t, storages)
+	if err := h2.OpenSessionStore(storePath, slog.Default()); err != nil {
+		t.Fatal(err)
+	}
+	raw, ok := h2.sessions.Load("single-1")
+	if !ok {
+		t.Fatal("expected single session restored after restart")
+	}
+	if s := raw.(*PartialSession); s.TmpPath != tmpPath || s.BytesWritten.Load() != 4096 {
+		t.Errorf("unexpected restored session: tmp=%s bytes=%d", s.TmpPath, s.BytesWritten.Load())
+	}
+	if _, ok := h2.sessions.Load("parallel-1"); ok {
+		t.Error("expected parallel session without checkpoint not to be restored")
+	}
+	if _, err := os.Stat(chunkDir); !os.IsNotExist(err) {
+		t.Error("expected staging of the parallel session to be removed")
+	}
+	if _, err := os.Stat(assembled); !os.IsNotExist(err) {
+		t.Error("expected assembled output of the parallel session to be removed")
+	}
+	records, _, _ := statefile.ReadLog[sessionRecord](storePath)
+	if len(records) != 1 || records[0].SessionID != "single-1" {
+		t.Errorf("expected only the single session persisted, got %+v", records)
+	}
+
+	// O agent retoma a partir do tamanho do .tmp
+	var frame bytes.Buffer
+	protocol.WriteResume(&frame, "single-1", "agent-1", "default")
+	serverConn, clientConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		h2.handleResume(context.Background(), serverConn, slog.Default())
+		close(done)
+	}()
+	go clientConn.Write(frame.Bytes()[4:]) // magic já consumido pelo dispatcher
+	ack, err := protocol.ReadResumeACK(clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.Status != protocol.ResumeStatusOK || ack.LastOffset != 4096 {
+		t.Errorf("expected resume ok at offset 4096, got status %d offset %d", ack.Status, ack.LastOffset)
+	}
+	clientConn.Close()
+	<-done
+
+	h2.deleteSession("single-1")
+	if records, _, _ := statefile.ReadLog[sessionRecord](storePath); len(records) != 0 {
+		t.Errorf("expected sessions file empty after delete, got %d records", len(records))
+	}
+}
+
+func TestSessionStore_ResumesParallelSessionFromCheckpoint(t *testing.T) {
+	baseDir := t.TempDir()
+	storages := map[string]config.StorageInfo{"default": {BaseDir: baseDir, AssemblerMode: AssemblerModeEager}}
+	storePath := filepath.Join(t.TempDir(), "sessions.jsonl")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Server "antes do restart": sessão paralela com 3 chunks montados
+	h := newTestHandler(t, storages)
+	if err := h.OpenSessionStore(storePath, logger); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := NewStorageWriter(storages["default"], "agent-1", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assembler, err := NewChunkAssemblerWithOptions("parallel-1", writer.AgentDir(), logger, ChunkAssemblerOptions{Mode: AssemblerModeEager})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := assembler.WriteChunk(uint32(i), bytes.NewReader([]byte("AAAA")), 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ps := newParallelSession("parallel-1", 4, time.Now())
+	ps.Assembler = assembler
+	ps.Writer = writer
+	ps.StorageInfo = storages["default"]
+	ps.AgentName, ps.StorageName, ps.BackupName = "agent-1", "default", "home"
+	ps.ChunkSize = 1024
+	h.storeSession("parallel-1", ps)
+	h.checkpointParallelSession(ps, logger)
+	assembler.Release()
+
+	records, _, _ := statefile.ReadLog[sessionRecord](storePath)
+	if len(records) != 1 || records[0].Checkpoint == nil || records[0].Checkpoint.NextSeq != 3 || records[0].MaxStreams != 4 {
+		t.Fatalf("expected checkpointed parallel record, got %+v", records)
+	}
+
+	// Restart: a sessão volta desanexada, à espera do RESUME
+	h2 := newTestHandler(t, storages)
+	if err := h2.OpenSessionStore(storePath, logger); err != nil {
+		t.Fatal(err)
+	}
+	raw, ok := h2.sessions.Load("parallel-1")
+	if !ok {
+		t.Fatal("expected parallel session restored after restart")
+	}
+	restored := raw.(*ParallelSession)
+	if !restored.Detached.Load() || restored.ChunkSize != 1024 || restored.DiskWriteBytes.Load() != 12 {
+		t.Errorf("unexpected restored session: detached=%v chunk=%d bytes=%d",
+			restored.Detached.Load(), restored.ChunkSize, restored.DiskWriteBytes.Load())
+	}
+
+	// O RESUME responde com o offset e o próximo globalSeq do checkpoint
+	var frame bytes.Buffer
+	protocol.WriteResume(&frame, "parallel-1", "agent-1", "default")
+	serverConn, clientConn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h2.handleResume(ctx, serverConn, logger)
+		close(done)
+	}()
+	go clientConn.Write(frame.Bytes()[4:]) // magic já consumido pelo dispatcher
+	ack, err := protocol.ReadResumeACK(clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.Status != protocol.ResumeStatusOK || ack.LastOffset != 12 {
+		t.Fatalf("expected resume ok at offset 12, got status %d offset %d", ack.Status, ack.LastOffset)
+	}
+	pr, err := protocol.ReadParallelResume(clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.NextSeq != 3 {
+		t.Errorf("expected next seq 3, got %d", pr.NextSeq)
+	}
+
+	// Shutdown do server antes dos streams: a sessão continua persistida
+	clientConn.Close()
+	cancel()
+	<-done
+	records, _, _ = statefile.ReadLog[sessionRecord](storePath)
+	if len(records) != 1 || records[0].Checkpoint == nil || records[0].Checkpoint.Bytes != 12 {
+		t.Errorf("expected session kept for resume after shutdown, got %+v", records)
+	}
+}
+
+func TestTakeOverParallelSession_ReleasesLivePrimary(t *testing.T) {
+	baseDir := t.TempDir()
+	storages := map[string]config.StorageInfo{"default": {BaseDir: baseDir, AssemblerMode: AssemblerModeEager}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := newTestHandler(t, storages)
+
+	writer, err := NewStorageWriter(storages["default"], "agent-1", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assembler, err := NewChunkAssemblerWithOptions("parallel-1", writer.AgentDir(), logger, ChunkAssemblerOptions{Mode: AssemblerModeEager})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := assembler.WriteChunk(0, bytes.NewReader([]byte("AAAA")), 4); err != nil {
+		t.Fatal(err)
+	}
+	ps := newParallelSession("parallel-1", 2, time.Now())
+	ps.Assembler = assembler
+	ps.Writer = writer
+	ps.StorageInfo = storages["default"]
+	ps.AgentName, ps.StorageName, ps.BackupName = "agent-1", "default", "home"
+	ps.Logger = logger
+	h.storeSession("parallel-1", ps)
+
+	// Goroutine primária da sessão original, à espera dos streams
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go h.serveParallelSession(context.Background(), serverConn, serverConn, ps, "agent-1:default:home", "", logger)
+
+	session, err := h.takeOverParallelSession(ps, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Assembler.Cleanup()
+	if session == ps {
+		t.Fatal("expected a new session rebuilt from the checkpoint")
+	}
+	if cp := session.Checkpoint.Load(); cp == nil || cp.NextSeq != 1 || cp.Bytes != 4 {
+		t.Errorf("unexpected checkpoint after handover: %+v", cp)
+	}
+	if raw, _ := h.sessions.Load("parallel-1"); raw != session {
+		t.Error("expected the resumed session to replace the original one")
+	}
+	if _, err := h.takeOverParallelSession(session, logger); err == nil {
+		t.Error("expected a second resume of the same session to be rejected")
+	}
+}
@@ -89,6 +89,8 @@ type Slot struct {
 	ChunksLost          atomic.Uint32 // chunks reportados como perdidos
 	ChunksRetransmitted atomic.Uint32 // chunks retransmitidos para este slot
 	LastChunkSeq        atomic.Uint32 // GlobalSeq do último chunk recebido
+	ChunkNACK           atomic.Bool   // agent anunciou JoinFlagChunkNACK: trata ChunkNACK
+	StreamTrailer       atomic.Bool   // agent anunciou JoinFlagStreamTrailer: envia StreamTrailer
 }
 
 // NewSlot cria um Slot pré-alocado com estado inicial Idle.
@@ -0,0 +1,244 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+	"github.com/robfig/cron/v3"
+)
+
+// snapshotGroupRun é uma execução em andamento de um snapshot_group,
+// registrada em Handler.snapshotRuns pelo snapshotID.
+type snapshotGroupRun struct {
+	agents  map[string]bool
+	replies chan snapshotReply
+}
+
+// snapshotReply é o ControlSnapshotReady de um agent do grupo.
+type snapshotReply struct {
+	agent string
+	ready *protocol.ControlSnapshotReady
+}
+
+// SnapshotGroupResult é o resultado da fase de snapshot de um snapshot_group.
+type SnapshotGroupResult struct {
+	SnapshotID string
+	Released   bool
+	// Agents mapeia cada agent ao resultado do snapshot: "ready", "failed: ...",
+	// "busy: ...", "not connected" ou "timeout".
+	Agents map[string]string
+}
+
+// startSnapshotGroups registra o cron dos snapshot_groups com schedule.
+// Grupos sem schedule são disparados apenas via `nbackup-server snapshot`.
+func startSnapshotGroups(ctx context.Context, cfg *config.ServerConfig, handler *Handler, logger *slog.Logger) error {
+	var scheduled int
+	c := cron.New()
+	for _, g := range cfg.SnapshotGroups {
+		if g.Schedule == "" {
+			continue
+		}
+		name := g.Name
+		if _, err := c.AddFunc(g.Schedule, func() {
+			if _, err := handler.RunSnapshotGroup(ctx, name); err != nil {
+				logger.Warn("snapshot group run failed", "group", name, "error", err)
+			}
+		}); err != nil {
+			return fmt.Errorf("snapshot_groups %q schedule %q: %w", g.Name, g.Schedule, err)
+		}
+		scheduled++
+		logger.Info("registered snapshot group", "group", g.Name, "backup", g.Backup, "agents", g.Agents, "schedule", g.Schedule)
+	}
+	if scheduled == 0 {
+		return nil
+	}
+	c.Start()
+	go func() {
+		<-ctx.Done()
+		c.Stop()
+	}()
+	return nil
+}
+
+// snapshotGroup retorna o snapshot_group name da config corrente.
+func (h *Handler) snapshotGroup(name string) (config.SnapshotGroupConfig, bool) {
+	for _, g := range h.config().SnapshotGroups {
+		if g.Name == name {
+			return g, true
+		}
+	}
+	return config.SnapshotGroupConfig{}, false
+}
+
+// RunSnapshotGroup executa a fase de snapshot coordenada do grupo name:
+// envia ControlSnapshotPrepare a todos os agents ao mesmo tempo, aguarda as
+// confirmações (ControlSnapshotReady) até prepare_timeout e então libera a
+// transferência em todos (ControlSnapshotRelease com proceed) — ou a cancela
+// se algum agent falhou, está ocupado, desconectado ou não respondeu.
+// Retorna erro se o grupo não existe ou já está em execução.
+func (h *Handler) RunSnapshotGroup(ctx context.Context, name string) (*SnapshotGroupResult, error) {
+	g, ok := h.snapshotGroup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown snapshot group %q", name)
+	}
+	if _, running := h.snapshotGroupsActive.LoadOrStore(name, true); running {
+		return nil, fmt.Errorf("snapshot group %q is already running", name)
+	}
+	defer h.snapshotGroupsActive.Delete(name)
+
+	logger := h.logger.With("group", g.Name, "backup", g.Backup)
+	res := &SnapshotGroupResult{
+		SnapshotID: fmt.Sprintf("%s-%d", g.Name, time.Now().Unix()),
+		Agents:     make(map[string]string, len(g.Agents)),
+	}
+	run := &snapshotGroupRun{
+		agents:  make(map[string]bool, len(g.Agents)),
+		replies: make(chan snapshotReply, len(g.Agents)),
+	}
+	for _, a := range g.Agents {
+		run.agents[a] = true
+	}
+	h.snapshotRuns.Store(res.SnapshotID, run)
+	defer h.snapshotRuns.Delete(res.SnapshotID)
+
+	// Todos os agents precisam estar com o control channel ativo: um snapshot
+	// parcial do grupo não é consistente.
+	for _, a := range g.Agents {
+		if _, connected := h.controlConns.Load(a); !connected {
+			res.Agents[a] = "not connected"
+		}
+	}
+	if len(res.Agents) > 0 {
+		h.finishSnapshotGroup(g, res, nil, logger)
+		return res, nil
+	}
+
+	logger.Info("snapshot group: preparing", "snapshot", res.SnapshotID, "agents", g.Agents)
+	var wg sync.WaitGroup
+	var sendMu sync.Mutex
+	for _, a := range g.Agents {
+		wg.Add(1)
+		go func(agent string) {
+			defer wg.Done()
+			if err := h.sendControlFrame(agent, func(conn net.Conn) error {
+				return protocol.WriteControlSnapshotPrepare(conn, res.SnapshotID, g.Backup)
+			}); err != nil {
+				sendMu.Lock()
+				res.Agents[agent] = "not connected"
+				sendMu.Unlock()
+			}
+		}(a)
+	}
+	wg.Wait()
+
+	timer := time.NewTimer(g.PrepareTimeout)
+	defer timer.Stop()
+	for len(res.Agents) < len(g.Agents) {
+		select {
+		case r := <-run.replies:
+			if _, dup := res.Agents[r.agent]; dup {
+				continue
+			}
+			res.Agents[r.agent] = snapshotStatusString(r.ready)
+			logger.Info("snapshot group: agent replied", "snapshot", res.SnapshotID, "agent", r.agent, "status", res.Agents[r.agent])
+		case <-timer.C:
+			for _, a := range g.Agents {
+				if _, replied := res.Agents[a]; !replied {
+					res.Agents[a] = "timeout"
+				}
+			}
+		case <-ctx.Done():
+			for _, a := range g.Agents {
+				if _, replied := res.Agents[a]; !replied {
+					res.Agents[a] = "server shutting down"
+				}
+			}
+		}
+	}
+
+	h.finishSnapshotGroup(g, res, g.Agents, logger)
+	return res, nil
+}
+
+// finishSnapshotGroup decide o release do grupo, envia ControlSnapshotRelease
+// aos agents notify (os que não recusaram o snapshot) e emite o evento.
+func (h *Handler) finishSnapshotGroup(g config.SnapshotGroupConfig, res *SnapshotGroupResult, notify []string, logger *slog.Logger) {
+	var failed []string
+	for _, a := range g.Agents {
+		if res.Agents[a] != "ready" {
+			failed = append(failed, a+" ("+res.Agents[a]+")")
+		}
+	}
+	sort.Strings(failed)
+	res.Released = len(failed) == 0
+
+	for _, a := range notify {
+		status := res.Agents[a]
+		if strings.HasPrefix(status, "failed") || strings.HasPrefix(status, "busy") || status == "not connected" {
+			continue // sem snapshot pendente neste agent
+		}
+		if err := h.sendControlFrame(a, func(conn net.Conn) error {
+			return protocol.WriteControlSnapshotRelease(conn, res.SnapshotID, res.Released)
+		}); err != nil {
+			logger.Warn("snapshot group: failed to send release", "snapshot", res.SnapshotID, "agent", a, "error", err)
+		}
+	}
+
+	if res.Released {
+		logger.Info("snapshot group released", "snapshot", res.SnapshotID)
+		if h.Events != nil {
+			h.Events.PushEvent("info", "snapshot_group_released", "",
+				fmt.Sprintf("snapshot group %s (%s): %d agents ready, transfer released", g.Name, res.SnapshotID, len(g.Agents)), 0)
+		}
+		return
+	}
+	logger.Warn("snapshot group cancelled", "snapshot", res.SnapshotID, "failed", failed)
+	if h.Events != nil {
+		h.Events.PushEvent("error", "snapshot_group_failed", "",
+			fmt.Sprintf("snapshot group %s (%s) cancelled: %s", g.Name, res.SnapshotID, strings.Join(failed, ", ")), 0)
+	}
+}
+
+// handleSnapshotReady entrega o ControlSnapshotReady de agent à execução do
+// grupo. Respostas de snapshots desconhecidos (ex: após o timeout) ou de
+// agents fora do grupo são ignoradas.
+func (h *Handler) handleSnapshotReady(agent string, ready *protocol.ControlSnapshotReady, logger *slog.Logger) {
+	raw, ok := h.snapshotRuns.Load(ready.SnapshotID)
+	if !ok {
+		logger.Warn("control channel: snapshot confirmation for unknown snapshot", "agent", agent, "snapshot", ready.SnapshotID)
+		return
+	}
+	run := raw.(*snapshotGroupRun)
+	if !run.agents[agent] {
+		logger.Warn("control channel: snapshot confirmation from agent outside the group", "agent", agent, "snapshot", ready.SnapshotID)
+		return
+	}
+	select {
+	case run.replies <- snapshotReply{agent: agent, ready: ready}:
+	default:
+	}
+}
+
+// snapshotStatusString descreve o ControlSnapshotReady de um agent.
+func snapshotStatusString(r *protocol.ControlSnapshotReady) string {
+	switch r.Status {
+	case protocol.SnapshotStatusReady:
+		return "ready"
+	case protocol.SnapshotStatusBusy:
+		return "busy: " + r.Message
+	default:
+		return "failed: " + r.Message
+	}
+}
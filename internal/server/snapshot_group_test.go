@@ -0,0 +1,141 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// fakeSnapshotAgent conecta um control channel falso ao handler: responde ao
+// ControlSnapshotPrepare com status e entrega o ControlSnapshotRelease recebido.
+func fakeSnapshotAgent(t *testing.T, h *Handler, name string, status byte) <-chan *protocol.ControlSnapshotRelease {
+	t.Helper()
+	serverConn, agentConn := net.Pipe()
+	t.Cleanup(func() { agentConn.Close() })
+	h.controlConns.Store(name, &ControlConnInfo{Conn: serverConn})
+	h.controlConnsMu.Store(name, &sync.Mutex{})
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	released := make(chan *protocol.ControlSnapshotRelease, 1)
+	go func() {
+		defer close(released)
+		if magic, err := protocol.ReadControlMagic(agentConn); err != nil || magic != protocol.MagicControlSnapshotPrepare {
+			return
+		}
+		prep, err := protocol.ReadControlSnapshotPreparePayload(agentConn)
+		if err != nil || prep.Backup != "pgdata" {
+			return
+		}
+		h.handleSnapshotReady(name, &protocol.ControlSnapshotReady{SnapshotID: prep.SnapshotID, Status: status, Message: "snapshot failed"}, logger)
+		if status != protocol.SnapshotStatusReady {
+			return
+		}
+		if magic, err := protocol.ReadControlMagic(agentConn); err != nil || magic != protocol.MagicControlSnapshotRelease {
+			return
+		}
+		rel, err := protocol.ReadControlSnapshotReleasePayload(agentConn)
+		if err == nil {
+			released <- rel
+		}
+	}()
+	return released
+}
+
+func newSnapshotGroupHandler(t *testing.T) *Handler {
+	t.Helper()
+	h := newTestHandler(t, map[string]config.StorageInfo{"default": {BaseDir: t.TempDir()}})
+	h.cfg.SnapshotGroups = []config.SnapshotGroupConfig{{
+		Name:           "pg-cluster",
+		Backup:         "pgdata",
+		Agents:         []string{"db-01", "db-02"},
+		PrepareTimeout: 2 * time.Second,
+	}}
+	h.ensureEventStore()
+	return h
+}
+
+func TestRunSnapshotGroup_ReleasesWhenAllReady(t *testing.T) {
+	h := newSnapshotGroupHandler(t)
+	rel1 := fakeSnapshotAgent(t, h, "db-01", protocol.SnapshotStatusReady)
+	rel2 := fakeSnapshotAgent(t, h, "db-02", protocol.SnapshotStatusReady)
+
+	res, err := h.RunSnapshotGroup(context.Background(), "pg-cluster")
+	if err != nil {
+		t.Fatalf("RunSnapshotGroup: %v", err)
+	}
+	if !res.Released || res.Agents["db-01"] != "ready" || res.Agents["db-02"] != "ready" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	for _, ch := range []<-chan *protocol.ControlSnapshotRelease{rel1, rel2} {
+		select {
+		case rel := <-ch:
+			if rel == nil || !rel.Proceed || rel.SnapshotID != res.SnapshotID {
+				t.Errorf("unexpected release %+v", rel)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("release not sent")
+		}
+	}
+	if _, ok := h.snapshotRuns.Load(res.SnapshotID); ok {
+		t.Error("expected snapshot run unregistered")
+	}
+}
+
+func TestRunSnapshotGroup_CancelsOnAgentFailure(t *testing.T) {
+	h := newSnapshotGroupHandler(t)
+	rel1 := fakeSnapshotAgent(t, h, "db-01", protocol.SnapshotStatusReady)
+	fakeSnapshotAgent(t, h, "db-02", protocol.SnapshotStatusFailed)
+
+	res, err := h.RunSnapshotGroup(context.Background(), "pg-cluster")
+	if err != nil {
+		t.Fatalf("RunSnapshotGroup: %v", err)
+	}
+	if res.Released || res.Agents["db-02"] != "failed: snapshot failed" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	select {
+	case rel := <-rel1:
+		if rel == nil || rel.Proceed {
+			t.Errorf("expected cancelling release for db-01, got %+v", rel)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("release not sent")
+	}
+
+	var found bool
+	for _, ev := range h.Events.Recent(10) {
+		if ev.Type == "snapshot_group_failed" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected snapshot_group_failed event")
+	}
+}
+
+func TestRunSnapshotGroup_RequiresAllAgentsConnected(t *testing.T) {
+	h := newSnapshotGroupHandler(t)
+	fakeSnapshotAgent(t, h, "db-01", protocol.SnapshotStatusReady)
+
+	res, err := h.RunSnapshotGroup(context.Background(), "pg-cluster")
+	if err != nil {
+		t.Fatalf("RunSnapshotGroup: %v", err)
+	}
+	if res.Released || res.Agents["db-02"] != "not connected" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if _, err := h.RunSnapshotGroup(context.Background(), "unknown"); err == nil {
+		t.Error("expected error for unknown group")
+	}
+}
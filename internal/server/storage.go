@@ -6,11 +6,16 @@ package server
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/dedup"
+	"github.com/nishisan-dev/n-backup/internal/manifest"
 )
 
 // AtomicWriter gerencia a escrita atômica de backups:
@@ -20,7 +25,8 @@ type AtomicWriter struct {
 	agentName     string
 	backupName    string
 	agentDir      string
-	fileExtension string // ".tar.gz" ou ".tar.zst"
+	fileExtension string                // ".tar.gz" ou ".tar.zst"
+	layout        *config.StorageLayout // diretórios de data do commit (storages.*.layout), nil = direto em agentDir
 }
 
 // NewAtomicWriter cria um AtomicWriter para o agent e backup especificados.
@@ -46,6 +52,17 @@ func NewAtomicWriter(baseDir, agentName, backupName, fileExtension string) (*Ato
 	}, nil
 }
 
+// NewStorageWriter cria o AtomicWriter de agent/backup no storage si, com a
+// extensão e o layout do storage.
+func NewStorageWriter(si config.StorageInfo, agentName, backupName string) (*AtomicWriter, error) {
+	w, err := NewAtomicWriter(si.BaseDir, agentName, backupName, si.FileExtension())
+	if err != nil {
+		return nil, err
+	}
+	w.layout = si.LayoutRaw
+	return w, nil
+}
+
 // TempFile cria um arquivo temporário no diretório do agent.
 func (w *AtomicWriter) TempFile() (*os.File, string, error) {
 	f, err := os.CreateTemp(w.agentDir, "backup-*.tmp")
@@ -55,23 +72,33 @@ func (w *AtomicWriter) TempFile() (*os.File, string, error) {
 	return f, f.Name(), nil
 }
 
-// Commit renomeia o arquivo temporário para o nome final com timestamp.
+// Commit renomeia o arquivo temporário para o nome final com timestamp. Com
+// storages.*.layout, o arquivo vai para os diretórios de data do commit
+// (ex: {agent}/{backup}/2026/03/), criados se preciso.
 func (w *AtomicWriter) Commit(tmpPath string) (string, error) {
-	timestamp := time.Now().UTC().Format("2006-01-02T15-04-05.000")
+	now := time.Now().UTC()
+	timestamp := now.Format("2006-01-02T15-04-05.000")
 	// Substitui ponto decimal por traço para portabilidade em FS
 	timestamp = strings.ReplaceAll(timestamp, ".", "-")
 	finalName := fmt.Sprintf("%s%s", timestamp, w.fileExtension)
-	finalPath := filepath.Join(w.agentDir, finalName)
+	finalDir := filepath.Join(w.agentDir, filepath.FromSlash(w.layout.Dir(now)))
+	if err := os.MkdirAll(finalDir, 0755); err != nil {
+		return "", fmt.Errorf("creating layout directory: %w", err)
+	}
+	finalPath := filepath.Join(finalDir, finalName)
 
 	if err := os.Rename(tmpPath, finalPath); err != nil {
 		return "", fmt.Errorf("renaming temp to final: %w", err)
 	}
+	// Manifest de arquivos recebido com o backup (opcional): acompanha o archive
+	os.Rename(tmpPath+manifest.Suffix, fileManifestPath(finalPath))
 
 	return finalPath, nil
 }
 
 // Abort remove o arquivo temporário em caso de erro.
 func (w *AtomicWriter) Abort(tmpPath string) error {
+	os.Remove(tmpPath + manifest.Suffix)
 	return os.Remove(tmpPath)
 }
 
@@ -85,8 +112,14 @@ func (w *AtomicWriter) AgentName() string {
 	return w.agentName
 }
 
+// quarantineDirName é o subdiretório de {agent}/{backup} que recebe backups em
+// quarentena (ação da API). Começa com ponto — nenhum nome de backup válido
+// colide com ele — e fica fora da rotação, da contagem e do sync.
+const quarantineDirName = ".quarantine"
+
 // Rotate remove backups excedentes, mantendo os maxBackups mais recentes.
-// Retorna a lista de nomes de arquivos removidos para auditoria/eventos.
+// Retorna os caminhos (relativos a agentDir) dos backups removidos para
+// auditoria/eventos. Diretórios de data que ficam vazios são removidos.
 func Rotate(agentDir string, maxBackups int) ([]string, error) {
 	candidates, err := ListRotationCandidates(agentDir, maxBackups)
 	if err != nil {
@@ -94,47 +127,134 @@ func Rotate(agentDir string, maxBackups int) ([]string, error) {
 	}
 
 	var removed []string
-	for _, name := range candidates {
-		path := filepath.Join(agentDir, name)
+	for _, rel := range candidates {
+		path := filepath.Join(agentDir, rel)
 		if err := os.Remove(path); err != nil {
-			return removed, fmt.Errorf("removing old backup %s: %w", name, err)
+			return removed, fmt.Errorf("removing old backup %s: %w", rel, err)
 		}
-		removed = append(removed, name)
+		removeSidecars(path)
+		removeEmptyDirs(agentDir, filepath.Dir(path))
+		removed = append(removed, rel)
 	}
 
 	return removed, nil
 }
 
-// ListRotationCandidates retorna os nomes dos backups que SERIAM removidos
-// pelo Rotate, sem efetivamente deletá-los. Usado pelo archive mode para
-// enviar backups ao bucket ANTES da deleção local.
+// ListRotationCandidates retorna os caminhos (relativos a agentDir) dos
+// backups que SERIAM removidos pelo Rotate, sem efetivamente deletá-los. Usado
+// pelo archive mode para enviar backups ao bucket ANTES da deleção local.
 func ListRotationCandidates(agentDir string, maxBackups int) ([]string, error) {
 	if maxBackups <= 0 {
 		return nil, nil
 	}
 
-	entries, err := os.ReadDir(agentDir)
+	backups, err := listBackups(agentDir)
 	if err != nil {
 		return nil, fmt.Errorf("reading agent directory: %w", err)
 	}
 
-	var backups []string
-	for _, e := range entries {
-		if !e.IsDir() && isBackupFile(e.Name()) {
-			backups = append(backups, e.Name())
+	if len(backups) > maxBackups {
+		var candidates []string
+		for _, b := range backups[:len(backups)-maxBackups] {
+			candidates = append(candidates, b.Rel)
 		}
+		return candidates, nil
 	}
 
-	sort.Strings(backups)
+	return nil, nil
+}
 
-	if len(backups) > maxBackups {
-		return backups[:len(backups)-maxBackups], nil
+// backupFile é um backup em {agent}/{backup}. Name é o nome do arquivo
+// (timestamp do commit + extensão), que identifica o backup no catálogo e no
+// restore; Rel inclui os diretórios de data de storages.*.layout.
+type backupFile struct {
+	Name string
+	Rel  string // caminho relativo a agentDir
+}
+
+// listBackups retorna os backups de agentDir em ordem cronológica (nomes
+// começam com o timestamp do commit), inclusive os dos diretórios de data de
+// qualquer layout já usado pelo storage. Quarentena, chunks e demais
+// diretórios ocultos ficam de fora.
+func listBackups(agentDir string) ([]backupFile, error) {
+	var backups []backupFile
+	err := filepath.WalkDir(agentDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == agentDir {
+				return err
+			}
+			return nil // ignora subdiretórios ilegíveis
+		}
+		if d.IsDir() {
+			if path != agentDir && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "chunks_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isBackupFile(d.Name()) {
+			rel, _ := filepath.Rel(agentDir, path)
+			backups = append(backups, backupFile{Name: d.Name(), Rel: rel})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name < backups[j].Name })
+	return backups, nil
+}
 
-	return nil, nil
+// findBackup retorna o caminho do backup name em agentDir, em qualquer
+// diretório de data.
+func findBackup(agentDir, name string) (string, bool) {
+	if p := filepath.Join(agentDir, name); fileExists(p) {
+		return p, true
+	}
+	backups, err := listBackups(agentDir)
+	if err != nil {
+		return "", false
+	}
+	for _, b := range backups {
+		if b.Name == name {
+			return filepath.Join(agentDir, b.Rel), true
+		}
+	}
+	return "", false
+}
+
+// fileExists indica se path existe e é um arquivo regular.
+func fileExists(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// removeEmptyDirs remove dir e os pais vazios até agentDir (exclusive):
+// diretórios de data que ficaram sem backups após a rotação.
+func removeEmptyDirs(agentDir, dir string) {
+	for dir != agentDir && strings.HasPrefix(dir, agentDir+string(filepath.Separator)) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
 }
 
-// isBackupFile verifica se o nome do arquivo é um backup válido (.tar.gz ou .tar.zst).
+// isBackupFile verifica se o nome do arquivo é um backup válido (.tar.gz ou
+// .tar.zst, ou o manifest .dedup de um deles nos storages dedup).
 func isBackupFile(name string) bool {
-	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tar.zst")
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tar.zst") || dedup.IsManifest(name)
+}
+
+// fileManifestPath retorna o caminho do manifest de arquivos gravado ao lado
+// do backup em path. Para o manifest .dedup de um storage dedup, é o do
+// archive original.
+func fileManifestPath(path string) string {
+	return strings.TrimSuffix(path, dedup.ManifestSuffix) + manifest.Suffix
+}
+
+// removeSidecars remove os arquivos gravados ao lado do backup em path:
+// manifest de arquivos e índice de membros.
+func removeSidecars(path string) {
+	os.Remove(fileManifestPath(path))
+	os.Remove(archiveIndexPath(path))
 }
@@ -0,0 +1,103 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// stream_budget.go reparte o stream_budget (teto de streams paralelos somados
+// entre as sessões) e recomenda a cada sessão paralela o seu teto via
+// ControlStreamLimit.
+//
+// A repartição é max-min fair: sessões que pedem menos streams que a fatia
+// igual ficam com o que pediram e a sobra vai para as demais; toda sessão
+// mantém ao menos um stream. Sessões de agents que não anunciaram
+// JoinFlagStreamLimit não podem ser reduzidas e consomem o orçamento com o
+// MaxStreams inteiro.
+
+package server
+
+import (
+	"io"
+	"log/slog"
+	"sort"
+
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// streamBudgetLimits calcula o teto de streams de cada sessão paralela em
+// andamento (sessionID → teto). Com budget <= 0 o teto é o MaxStreams de
+// cada sessão.
+func (h *Handler) streamBudgetLimits(budget int) map[string]uint8 {
+	var sessions []*ParallelSession
+	h.sessions.Range(func(_, value any) bool {
+		if ps, ok := value.(*ParallelSession); ok {
+			sessions = append(sessions, ps)
+		}
+		return true
+	})
+
+	limits := make(map[string]uint8, len(sessions))
+	if budget <= 0 {
+		for _, ps := range sessions {
+			limits[ps.SessionID] = ps.MaxStreams
+		}
+		return limits
+	}
+
+	var adjustable []*ParallelSession
+	remaining := budget
+	for _, ps := range sessions {
+		if !ps.StreamLimit.Load() {
+			limits[ps.SessionID] = ps.MaxStreams
+			remaining -= int(ps.MaxStreams)
+			continue
+		}
+		adjustable = append(adjustable, ps)
+	}
+
+	sort.Slice(adjustable, func(i, j int) bool { return adjustable[i].MaxStreams < adjustable[j].MaxStreams })
+	for i, ps := range adjustable {
+		share := max(remaining/(len(adjustable)-i), 1)
+		limit := min(int(ps.MaxStreams), share)
+		limits[ps.SessionID] = uint8(limit)
+		remaining -= limit
+	}
+	return limits
+}
+
+// writeStreamLimits envia, logo após o ControlPong e com o writeMu do control
+// channel held, um ControlStreamLimit para cada sessão paralela do agent que
+// anunciou JoinFlagStreamLimit e cujo teto mudou desde o último envio.
+func (h *Handler) writeStreamLimits(w io.Writer, agentName string, logger *slog.Logger) error {
+	var limits map[string]uint8
+	var err error
+	h.sessions.Range(func(_, value any) bool {
+		ps, ok := value.(*ParallelSession)
+		if !ok || ps.AgentName != agentName || !ps.StreamLimit.Load() {
+			return true
+		}
+		if limits == nil {
+			limits = h.streamBudgetLimits(h.config().StreamBudget)
+		}
+		limit, ok := limits[ps.SessionID]
+		if !ok {
+			return true
+		}
+		last := ps.StreamLimitSent.Load()
+		if last == 0 {
+			last = uint32(ps.MaxStreams)
+		}
+		if uint32(limit) == last {
+			return true
+		}
+		if err = protocol.WriteControlStreamLimit(w, &protocol.ControlStreamLimit{SessionID: ps.SessionID, MaxStreams: limit}); err != nil {
+			return false
+		}
+		ps.StreamLimitSent.Store(uint32(limit))
+		logger.Info("parallel stream limit recommended",
+			"session", ps.SessionID,
+			"maxStreams", ps.MaxStreams,
+			"streamLimit", limit,
+		)
+		return true
+	})
+	return err
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func newBudgetSession(id, agent string, maxStreams uint8, streamLimit bool) *ParallelSession {
+	ps := &ParallelSession{SessionID: id, AgentName: agent, MaxStreams: maxStreams}
+	ps.StreamLimit.Store(streamLimit)
+	return ps
+}
+
+func TestStreamBudgetLimits(t *testing.T) {
+	sessions := &sync.Map{}
+	for _, ps := range []*ParallelSession{
+		newBudgetSession("small", "a", 2, true),
+		newBudgetSession("big-1", "a", 12, true),
+		newBudgetSession("big-2", "b", 12, true),
+		newBudgetSession("legacy", "c", 4, false),
+	} {
+		sessions.Store(ps.SessionID, ps)
+	}
+	sessions.Store("single", &PartialSession{})
+	h := &Handler{sessions: sessions}
+
+	// 20 - 4 (legacy, não reduzível) = 16: small fica com 2, sobram 14 para as grandes
+	limits := h.streamBudgetLimits(20)
+	want := map[string]uint8{"small": 2, "big-1": 7, "big-2": 7, "legacy": 4}
+	for id, w := range want {
+		if limits[id] != w {
+			t.Errorf("session %s: expected limit %d, got %d", id, w, limits[id])
+		}
+	}
+
+	// Orçamento menor que o número de sessões: cada uma mantém um stream
+	limits = h.streamBudgetLimits(2)
+	for _, id := range []string{"small", "big-1", "big-2"} {
+		if limits[id] != 1 {
+			t.Errorf("session %s: expected limit 1, got %d", id, limits[id])
+		}
+	}
+
+	// Sem orçamento: o teto é o MaxStreams
+	if limits = h.streamBudgetLimits(0); limits["big-1"] != 12 || limits["small"] != 2 {
+		t.Errorf("expected MaxStreams without budget, got %v", limits)
+	}
+}
+
+func TestWriteStreamLimits(t *testing.T) {
+	sessions := &sync.Map{}
+	for _, ps := range []*ParallelSession{
+		newBudgetSession("a-1", "agent-a", 8, true),
+		newBudgetSession("a-legacy", "agent-a", 2, false),
+		newBudgetSession("b-1", "agent-b", 8, true),
+	} {
+		sessions.Store(ps.SessionID, ps)
+	}
+	h := &Handler{sessions: sessions, cfg: &config.ServerConfig{StreamBudget: 10}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var buf bytes.Buffer
+	if err := h.writeStreamLimits(&buf, "agent-a", logger); err != nil {
+		t.Fatalf("writeStreamLimits: %v", err)
+	}
+	magic, _ := protocol.ReadControlMagic(&buf)
+	if magic != protocol.MagicControlStreamLimit {
+		t.Fatalf("expected CSLM magic, got %q", magic)
+	}
+	limit, err := protocol.ReadControlStreamLimitPayload(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit.SessionID != "a-1" || limit.MaxStreams != 4 {
+		t.Errorf("expected a-1 capped at 4, got %+v", limit)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected a single frame for agent-a, %d bytes left", buf.Len())
+	}
+
+	// Teto inalterado: nada é reenviado
+	if err := h.writeStreamLimits(&buf, "agent-a", logger); err != nil || buf.Len() != 0 {
+		t.Errorf("expected no frame for unchanged limit, got %d bytes (err=%v)", buf.Len(), err)
+	}
+
+	// Orçamento removido: o teto volta ao MaxStreams
+	h.cfg = &config.ServerConfig{}
+	if err := h.writeStreamLimits(&buf, "agent-a", logger); err != nil {
+		t.Fatal(err)
+	}
+	protocol.ReadControlMagic(&buf)
+	if limit, _ = protocol.ReadControlStreamLimitPayload(&buf); limit == nil || limit.MaxStreams != 8 {
+		t.Errorf("expected limit lifted to MaxStreams, got %+v", limit)
+	}
+}
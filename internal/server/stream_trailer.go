@@ -0,0 +1,80 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+// errStreamTruncated encerra o stream cujo StreamTrailer declara mais bytes do
+// que o server recebeu: o agent refaz o join e reenvia a partir do offset
+// confirmado, em vez de o erro aparecer só no checksum do commit.
+var errStreamTruncated = errors.New("stream truncated")
+
+// handleStreamTrailer lê o payload do StreamTrailer cujo header já foi lido,
+// compara os bytes declarados pelo agent com received (offset de wire do
+// stream) e responde com StreamTrailerACK. Retorna errStreamTruncated se
+// faltam bytes.
+func (h *Handler) handleStreamTrailer(conn net.Conn, reader io.Reader, sackWriter io.Writer, hdr *protocol.ChunkHeader, streamIndex uint8, received int64, session *ParallelSession, logger *slog.Logger) error {
+	if hdr.Length != protocol.StreamTrailerPayloadSize {
+		return fmt.Errorf("stream %d: invalid stream trailer length %d", streamIndex, hdr.Length)
+	}
+	payload, err := h.readParallelChunkPayload(conn, reader, hdr.Length, hdr.GlobalSeq, session)
+	if err != nil {
+		return err
+	}
+	st, err := protocol.ParseStreamTrailer(hdr, payload)
+	if err != nil {
+		return fmt.Errorf("stream %d: %w", streamIndex, err)
+	}
+
+	slot := session.Slots[streamIndex]
+	sent := int64(st.Bytes)
+	status := protocol.StreamTrailerStatusOK
+	switch {
+	case received < sent:
+		status = protocol.StreamTrailerStatusTruncated
+		logger.Error("stream_truncated",
+			"stream", streamIndex,
+			"received", received,
+			"sent", sent,
+			"chunks_received", slot.ChunksReceived.Load(),
+			"chunks_sent", st.Chunks,
+		)
+		if h.Events != nil {
+			h.Events.PushEvent("warn", "stream_truncated", session.AgentName,
+				fmt.Sprintf("stream %d truncated: received %s of %s, requesting resend", streamIndex, formatBytesGo(received), formatBytesGo(sent)), int(streamIndex))
+		}
+	case received > sent:
+		// Não há o que reenviar; o checksum do commit decide
+		logger.Error("stream trailer declares fewer bytes than received",
+			"stream", streamIndex, "received", received, "sent", sent)
+	default:
+		logger.Info("stream trailer verified",
+			"stream", streamIndex,
+			"bytes", received,
+			"chunks_sent", st.Chunks,
+		)
+	}
+
+	ackOffset := session.NACKs.ackOffset(streamIndex, received)
+	if netConn, ok := sackWriter.(net.Conn); ok {
+		netConn.SetWriteDeadline(time.Now().Add(sackWriteTimeout))
+	}
+	if err := protocol.WriteStreamTrailerACK(sackWriter, streamIndex, status, uint64(ackOffset)); err != nil {
+		return fmt.Errorf("sending StreamTrailerACK for stream %d: %w", streamIndex, err)
+	}
+	if status == protocol.StreamTrailerStatusTruncated {
+		return fmt.Errorf("%w: stream %d received %d of %d bytes", errStreamTruncated, streamIndex, received, sent)
+	}
+	return nil
+}
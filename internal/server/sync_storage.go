@@ -130,15 +130,16 @@ func (h *Handler) SyncExistingStorage(ctx context.Context) *SyncStorageResult {
 	}
 
 	// Itera storages de forma determinística (ordenado por nome)
-	storageNames := make([]string, 0, len(h.cfg.Storages))
-	for name := range h.cfg.Storages {
+	storages := h.config().Storages
+	storageNames := make([]string, 0, len(storages))
+	for name := range storages {
 		storageNames = append(storageNames, name)
 	}
 	sort.Strings(storageNames)
 
 	// Pré-scan: conta o total de arquivos locais a processar para progresso global
 	for _, storageName := range storageNames {
-		si := h.cfg.Storages[storageName]
+		si := storages[storageName]
 		syncBuckets := filterBucketsByMode(si.Buckets, config.BucketModeSync)
 		if len(syncBuckets) == 0 {
 			continue
@@ -150,7 +151,7 @@ func (h *Handler) SyncExistingStorage(ctx context.Context) *SyncStorageResult {
 	}
 
 	for _, storageName := range storageNames {
-		si := h.cfg.Storages[storageName]
+		si := storages[storageName]
 
 		// Filtra apenas buckets sync
 		syncBuckets := filterBucketsByMode(si.Buckets, config.BucketModeSync)
@@ -322,7 +323,8 @@ type localBackupFile struct {
 }
 
 // listLocalBackups percorre recursivamente baseDir e retorna todos os
-// arquivos de backup (.tar.gz, .tar.zst), excluindo diretórios de chunks.
+// arquivos de backup (.tar.gz, .tar.zst), excluindo diretórios de chunks e
+// backups em quarentena.
 func listLocalBackups(baseDir string) ([]localBackupFile, error) {
 	var files []localBackupFile
 
@@ -330,7 +332,7 @@ func listLocalBackups(baseDir string) ([]localBackupFile, error) {
 		if err != nil {
 			return nil // ignora erros de permissão e continua
 		}
-		if d.IsDir() && strings.HasPrefix(d.Name(), "chunks_") {
+		if d.IsDir() && (strings.HasPrefix(d.Name(), "chunks_") || d.Name() == quarantineDirName) {
 			return filepath.SkipDir
 		}
 		if !d.IsDir() && isBackupFile(d.Name()) {
@@ -0,0 +1,70 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net"
+	"slices"
+
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// traceConn envolve a conexão em um protocol.TraceConn quando
+// logging.protocol_trace_dir está configurado. Sem trace, retorna conn.
+func (h *Handler) traceConn(conn net.Conn) net.Conn {
+	dir := h.config().Logging.ProtocolTraceDir
+	if dir == "" {
+		return conn
+	}
+	return protocol.NewTraceConn(conn, dir, protocol.TraceInfo{Side: "server", Version: observability.Version})
+}
+
+// traceAnnotate acrescenta informações ao trace da conexão (sem criar o
+// arquivo). Agents fora de logging.protocol_trace_only desabilitam o trace.
+func (h *Handler) traceAnnotate(conn net.Conn, info protocol.TraceInfo) {
+	if tc := h.traceFor(conn, info.Agent); tc != nil {
+		tc.Annotate(info)
+	}
+}
+
+// traceIdentify completa a identificação e começa a gravar o trace em disco.
+func (h *Handler) traceIdentify(conn net.Conn, info protocol.TraceInfo) {
+	tc := h.traceFor(conn, info.Agent)
+	if tc == nil {
+		return
+	}
+	if err := tc.Identify(info); err != nil {
+		h.logger.Warn("protocol trace disabled for connection", "error", err)
+	}
+}
+
+// traceFor retorna o TraceConn de conn, aplicando o filtro por agent.
+func (h *Handler) traceFor(conn net.Conn, agent string) *protocol.TraceConn {
+	tc, ok := conn.(*protocol.TraceConn)
+	if !ok {
+		return nil
+	}
+	if only := h.config().Logging.ProtocolTraceOnly; agent != "" && len(only) > 0 && !slices.Contains(only, agent) {
+		tc.Disable()
+		return nil
+	}
+	return tc
+}
+
+// traceDisable descarta o trace da conexão, se houver.
+func traceDisable(conn net.Conn) {
+	if tc, ok := conn.(*protocol.TraceConn); ok {
+		tc.Disable()
+	}
+}
+
+// untraced remove o wrapper de trace, para inspeção do TLS/PSK da conexão.
+func untraced(conn net.Conn) net.Conn {
+	if tc, ok := conn.(*protocol.TraceConn); ok {
+		return tc.NetConn()
+	}
+	return conn
+}
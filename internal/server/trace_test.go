@@ -0,0 +1,54 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"log/slog"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/protocol"
+)
+
+func TestProtocolTrace_AgentFilter(t *testing.T) {
+	dir := t.TempDir()
+	h := newTestHandler(t, nil)
+	h.config().Logging.ProtocolTraceDir = dir
+	h.config().Logging.ProtocolTraceOnly = []string{"web-01"}
+
+	for _, agent := range []string{"db-01", "web-01"} {
+		client, server := net.Pipe()
+		conn := h.traceConn(&pskConn{Conn: server, agent: agent})
+		if _, ok := conn.(*protocol.TraceConn); !ok {
+			t.Fatalf("expected traced connection, got %T", conn)
+		}
+		// O wrapper de trace não esconde a identidade PSK da conexão
+		if got := h.extractAgentName(conn, slog.Default()); got != agent {
+			t.Errorf("extractAgentName: expected %s, got %s", agent, got)
+		}
+		h.traceIdentify(conn, protocol.TraceInfo{Conn: "primary", Agent: agent, Session: "s-" + agent})
+		conn.Close()
+		client.Close()
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.trace.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("expected only web-01 traced, got %v", files)
+	}
+	if matched, _ := filepath.Match("*-server-web-01-s-web-01-primary.trace.jsonl", filepath.Base(files[0])); !matched {
+		t.Errorf("unexpected trace file %s", files[0])
+	}
+}
+
+func TestProtocolTrace_DisabledByDefault(t *testing.T) {
+	h := newTestHandler(t, nil)
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	if conn := h.traceConn(server); conn != server {
+		t.Errorf("expected untraced connection without protocol_trace_dir, got %T", conn)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/notify"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+// webhookQueueSize limita os eventos pendentes de entrega. Com a fila cheia
+// (endpoint lento ou fora do ar) os eventos novos são descartados.
+const webhookQueueSize = 256
+
+// webhookDispatcher entrega os eventos do EventStore aos webhooks de
+// notifications.webhook, em background e fora do caminho dos handlers.
+// A config é lida a cada evento, então URLs, secret e filtro de eventos
+// alterados via SIGHUP valem sem restart.
+type webhookDispatcher struct {
+	config func() *config.ServerConfig
+	logger *slog.Logger
+	queue  chan notify.WebhookEvent
+}
+
+// ensureEventStore cria um EventStore apenas in-memory quando a WebUI está
+// desabilitada (handler.Events nil), para os notificadores que o assinam.
+func (h *Handler) ensureEventStore() {
+	if h.Events == nil {
+		h.Events, _ = observability.NewEventStore("", 1000, 0)
+	}
+}
+
+// startWebhooks assina o EventStore do handler e inicia a entrega.
+func startWebhooks(ctx context.Context, cfg *config.ServerConfig, handler *Handler, logger *slog.Logger) {
+	if !cfg.Notifications.Webhook.Enabled() {
+		return
+	}
+	handler.ensureEventStore()
+
+	d := &webhookDispatcher{
+		config: handler.config,
+		logger: logger.With("component", "webhook"),
+		queue:  make(chan notify.WebhookEvent, webhookQueueSize),
+	}
+	handler.Events.Subscribe(d.handle)
+	go d.run(ctx)
+
+	logger.Info("webhook notifications enabled",
+		"urls", len(cfg.Notifications.Webhook.URLs),
+		"events", cfg.Notifications.Webhook.Events,
+	)
+}
+
+// handle é o subscriber do EventStore: filtra, converte e enfileira o evento
+// sem bloquear quem o emitiu.
+func (d *webhookDispatcher) handle(e observability.EventEntry) {
+	event, ok := webhookEventFor(e)
+	if !ok || !d.config().Notifications.Webhook.Wants(event) {
+		return
+	}
+	ev := notify.WebhookEvent{
+		Event:     event,
+		Timestamp: e.Timestamp,
+		Source:    "server",
+		Level:     e.Level,
+		Agent:     e.Agent,
+		Storage:   e.Storage,
+		Backup:    e.Backup,
+		Message:   e.Message,
+	}
+	select {
+	case d.queue <- ev:
+	default:
+		d.logger.Warn("webhook queue full, dropping event", "event", event, "agent", e.Agent)
+	}
+}
+
+// run entrega os eventos da fila, um por vez, até o context ser cancelado.
+func (d *webhookDispatcher) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-d.queue:
+			cfg := d.config().Notifications.Webhook
+			if !cfg.Enabled() {
+				continue
+			}
+			if err := notify.NewWebhookSender(cfg).Post(ctx, ev); err != nil {
+				d.logger.Warn("webhook delivery failed", "event", ev.Event, "agent", ev.Agent, "error", err)
+				continue
+			}
+			d.logger.Debug("webhook delivered", "event", ev.Event, "agent", ev.Agent)
+		}
+	}
+}
+
+// webhookEventFor mapeia um evento do EventStore para o evento de webhook
+// correspondente. Retorna false para eventos sem webhook.
+func webhookEventFor(e observability.EventEntry) (string, bool) {
+	switch e.Type {
+	case "session_end":
+		switch e.Result {
+		case "ok":
+			return config.WebhookEventBackupCommitted, true
+		case "checksum_mismatch":
+			return config.WebhookEventChecksumMismatch, true
+		}
+	case "session_expired":
+		return config.WebhookEventSessionExpired, true
+	case "agent_disconnected":
+		return config.WebhookEventAgentOffline, true
+	}
+	return "", false
+}
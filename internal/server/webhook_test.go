@@ -0,0 +1,93 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/notify"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+)
+
+func TestStartWebhooks_DeliversLifecycleEvents(t *testing.T) {
+	received := make(chan notify.WebhookEvent, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev notify.WebhookEvent
+		json.NewDecoder(r.Body).Decode(&ev)
+		received <- ev
+	}))
+	defer srv.Close()
+
+	cfg := &config.ServerConfig{}
+	cfg.Notifications.Webhook = config.WebhookConfig{
+		URLs:       []string{srv.URL},
+		Events:     []string{config.WebhookEventBackupCommitted, config.WebhookEventAgentOffline},
+		Timeout:    5 * time.Second,
+		MaxRetries: 1,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := &Handler{cfg: cfg, logger: logger}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startWebhooks(ctx, cfg, h, logger)
+	if h.Events == nil {
+		t.Fatal("expected in-memory event store without web ui")
+	}
+
+	// session_end com falha de escrita e session_expired não estão em events
+	h.recordSessionEnd("s1", "web-01", "default", "app", "single", "gzip", "write_error", time.Now(), 0, nil, nil)
+	h.Events.PushEvent("error", "session_expired", "web-01", "expired", 0)
+	h.recordSessionEnd("s2", "web-01", "default", "app", "single", "gzip", "ok", time.Now(), 1024, nil, nil)
+	h.Events.PushEvent("warn", "agent_disconnected", "db-01", "control channel closed: EOF", 0)
+
+	want := []notify.WebhookEvent{
+		{Event: config.WebhookEventBackupCommitted, Agent: "web-01", Storage: "default", Backup: "app"},
+		{Event: config.WebhookEventAgentOffline, Agent: "db-01"},
+	}
+	for _, w := range want {
+		select {
+		case ev := <-received:
+			if ev.Event != w.Event || ev.Agent != w.Agent || ev.Storage != w.Storage || ev.Backup != w.Backup || ev.Source != "server" {
+				t.Errorf("got %+v, want %+v", ev, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", w.Event)
+		}
+	}
+	select {
+	case ev := <-received:
+		t.Errorf("unexpected extra webhook %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookEventFor(t *testing.T) {
+	tests := []struct {
+		entry observability.EventEntry
+		want  string
+	}{
+		{observability.EventEntry{Type: "session_end", Result: "ok"}, config.WebhookEventBackupCommitted},
+		{observability.EventEntry{Type: "session_end", Result: "checksum_mismatch"}, config.WebhookEventChecksumMismatch},
+		{observability.EventEntry{Type: "session_end", Result: "expired"}, ""},
+		{observability.EventEntry{Type: "session_expired"}, config.WebhookEventSessionExpired},
+		{observability.EventEntry{Type: "agent_disconnected"}, config.WebhookEventAgentOffline},
+		{observability.EventEntry{Type: "flow_rotation"}, ""},
+	}
+	for _, tt := range tests {
+		got, _ := webhookEventFor(tt.entry)
+		if got != tt.want {
+			t.Errorf("webhookEventFor(%s/%s) = %q, want %q", tt.entry.Type, tt.entry.Result, got, tt.want)
+		}
+	}
+}
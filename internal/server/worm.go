@@ -0,0 +1,491 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+	"github.com/nishisan-dev/n-backup/internal/server/observability"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// ledgerFileName é o ledger WORM de um storage imutável, na raiz do base_dir.
+// Começa com ponto: fica fora do catálogo, da rotação e do sync.
+const ledgerFileName = ".ledger.jsonl"
+
+// Flags de inode do ext4/xfs (FS_IOC_GETFLAGS/FS_IOC_SETFLAGS).
+const (
+	fsImmutableFL = 0x00000010 // chattr +i
+	fsAppendFL    = 0x00000020 // chattr +a
+)
+
+// Operações registradas no ledger.
+const (
+	ledgerOpCommit = "commit" // backup commitado e travado
+	ledgerOpUnlock = "unlock" // backup liberado pela rotação, removido após unlock_grace
+	ledgerOpDelete = "delete" // backup removido pela rotação
+)
+
+// errImmutable é retornado por ações da API que moveriam ou alterariam um
+// backup de storage imutável.
+var errImmutable = fmt.Errorf("storage is immutable: %w", observability.ErrConflict)
+
+// LedgerEntry é um registro do ledger de um storage imutável. Cada registro
+// carrega a assinatura do anterior (Prev) e é assinado com HMAC-SHA256 sobre
+// todos os campos: alterar, remover ou reordenar registros quebra a cadeia,
+// e forjar um registro exige a chave do ledger.
+type LedgerEntry struct {
+	Seq    uint64 `json:"seq"`
+	Time   string `json:"time"` // RFC3339Nano, UTC
+	Op     string `json:"op"`
+	File   string `json:"file"` // caminho do backup relativo a base_dir
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"` // só em commit
+	Prev   string `json:"prev"`             // Sig do registro anterior ("" no primeiro)
+	Sig    string `json:"sig"`
+}
+
+// sign calcula a assinatura do registro com key.
+func (e LedgerEntry) sign(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%d\n%s\n%s\n%s\n%d\n%s\n%s", e.Seq, e.Time, e.Op, e.File, e.Size, e.SHA256, e.Prev)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// wormLedger é o ledger aberto de um base_dir imutável.
+type wormLedger struct {
+	mu       sync.Mutex
+	path     string
+	key      []byte
+	mode     string
+	seq      uint64
+	last     string               // Sig do último registro
+	unlocked map[string]time.Time // arquivo (relativo a base_dir) → liberação pela rotação
+}
+
+// openLedger carrega a chave e o estado do ledger de si. Com mode chattr o
+// ledger recebe chattr +a (só aceita append). A assinatura dos registros não
+// é conferida aqui — isso é papel de VerifyLedger.
+func openLedger(si config.StorageInfo) (*wormLedger, error) {
+	key, err := pki.LoadPSK(si.Immutable.LedgerKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading ledger key: %w", err)
+	}
+	l := &wormLedger{
+		path:     filepath.Join(si.BaseDir, ledgerFileName),
+		key:      key,
+		mode:     si.Immutable.Mode,
+		unlocked: make(map[string]time.Time),
+	}
+	entries, rep, err := statefile.ReadLog[LedgerEntry](l.path)
+	if err != nil {
+		return nil, fmt.Errorf("reading ledger: %w", err)
+	}
+	if rep.Corrupt > 0 {
+		return nil, fmt.Errorf("ledger %s has %d corrupt records: run nbackup-server ledger verify", l.path, rep.Corrupt)
+	}
+	if rep.TornTail {
+		// Registro incompleto de um crash durante o append
+		if l.mode == config.ImmutableModeChattr {
+			if err := setInodeFlag(l.path, fsAppendFL, false); err != nil {
+				return nil, fmt.Errorf("clearing append-only flag on ledger: %w", err)
+			}
+		}
+		if err := os.Truncate(l.path, rep.ValidSize); err != nil {
+			return nil, fmt.Errorf("truncating torn ledger tail: %w", err)
+		}
+	}
+	for _, e := range entries {
+		l.apply(e)
+	}
+	if l.mode == config.ImmutableModeChattr && fileExists(l.path) {
+		if err := setInodeFlag(l.path, fsAppendFL, true); err != nil {
+			return nil, fmt.Errorf("setting append-only flag on ledger: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// apply atualiza o estado do ledger com o registro e.
+func (l *wormLedger) apply(e LedgerEntry) {
+	l.seq, l.last = e.Seq, e.Sig
+	switch e.Op {
+	case ledgerOpUnlock:
+		if t, err := time.Parse(time.RFC3339Nano, e.Time); err == nil {
+			l.unlocked[e.File] = t
+		}
+	default:
+		delete(l.unlocked, e.File)
+	}
+}
+
+// append assina e grava um registro no fim do ledger (com fsync).
+func (l *wormLedger) append(op, file string, size int64, sum string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := LedgerEntry{
+		Seq:    l.seq + 1,
+		Time:   time.Now().UTC().Format(time.RFC3339Nano),
+		Op:     op,
+		File:   filepath.ToSlash(file),
+		Size:   size,
+		SHA256: sum,
+		Prev:   l.last,
+	}
+	e.Sig = e.sign(l.key)
+
+	created := !fileExists(l.path)
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("opening ledger: %w", err)
+	}
+	if err := statefile.Append(f, e); err != nil {
+		f.Close()
+		return fmt.Errorf("writing ledger: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("syncing ledger: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if created && l.mode == config.ImmutableModeChattr {
+		if err := setInodeFlag(l.path, fsAppendFL, true); err != nil {
+			return fmt.Errorf("setting append-only flag on ledger: %w", err)
+		}
+	}
+	l.apply(e)
+	return nil
+}
+
+// unlockedAt retorna quando a rotação liberou file, se liberou.
+func (l *wormLedger) unlockedAt(file string) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t, ok := l.unlocked[filepath.ToSlash(file)]
+	return t, ok
+}
+
+// ledger retorna o ledger do storage imutável si, aberto no primeiro uso.
+func (h *Handler) ledger(si config.StorageInfo) (*wormLedger, error) {
+	if raw, ok := h.ledgers.Load(si.BaseDir); ok {
+		return raw.(*wormLedger), nil
+	}
+	l, err := openLedger(si)
+	if err != nil {
+		return nil, err
+	}
+	raw, _ := h.ledgers.LoadOrStore(si.BaseDir, l)
+	return raw.(*wormLedger), nil
+}
+
+// OpenLedgers abre os ledgers dos storages imutáveis no start: uma chave
+// ausente ou curta, ou um ledger corrompido, impede o server de subir.
+func (h *Handler) OpenLedgers() error {
+	for name, si := range h.config().Storages {
+		if !si.Immutable.Enabled {
+			continue
+		}
+		if _, err := h.ledger(si); err != nil {
+			return fmt.Errorf("storages.%s.immutable: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// sealBackup registra o commit de finalPath no ledger do storage imutável e
+// trava o backup e seus sidecars (chattr +i ou 0444). Falhas não desfazem o
+// commit: geram log e evento immutable_seal_failed, e o backup aparece como
+// não selado no ledger verify.
+func (h *Handler) sealBackup(si config.StorageInfo, agent, finalPath string, checksum [32]byte, logger *slog.Logger) {
+	if !si.Immutable.Enabled {
+		return
+	}
+	err := h.seal(si, finalPath, checksum)
+	if err == nil {
+		logger.Info("backup sealed (immutable)", "path", finalPath, "mode", si.Immutable.Mode)
+		return
+	}
+	logger.Error("sealing immutable backup failed", "path", finalPath, "error", err)
+	if h.Events != nil {
+		h.Events.PushEvent("error", "immutable_seal_failed", agent,
+			fmt.Sprintf("sealing %s failed: %v", filepath.Base(finalPath), err), 0)
+	}
+}
+
+func (h *Handler) seal(si config.StorageInfo, finalPath string, checksum [32]byte) error {
+	l, err := h.ledger(si)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(finalPath)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(si.BaseDir, finalPath)
+	if err != nil {
+		return err
+	}
+	if err := l.append(ledgerOpCommit, rel, fi.Size(), hex.EncodeToString(checksum[:])); err != nil {
+		return err
+	}
+	for _, p := range backupFiles(finalPath) {
+		if err := lockFile(p, si.Immutable.Mode); err != nil {
+			return fmt.Errorf("locking %s: %w", filepath.Base(p), err)
+		}
+	}
+	return nil
+}
+
+// rotateBackups aplica max_backups a agentDir. Em storages imutáveis a
+// remoção tem duas fases: a primeira rotação libera o backup excedente
+// (registro unlock no ledger e evento immutable_unlocked) e só uma rotação
+// após unlock_grace o destrava e remove — um max_backups reduzido por engano
+// ou por um invasor não apaga o histórico na hora. Retorna os caminhos
+// (relativos a agentDir) dos backups removidos.
+func (h *Handler) rotateBackups(si config.StorageInfo, agent, agentDir string, logger *slog.Logger) ([]string, error) {
+	if !si.Immutable.Enabled {
+		return Rotate(agentDir, si.MaxBackups)
+	}
+	candidates, err := ListRotationCandidates(agentDir, si.MaxBackups)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+	l, err := h.ledger(si)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, rel := range candidates {
+		path := filepath.Join(agentDir, rel)
+		file, _ := filepath.Rel(si.BaseDir, path)
+
+		at, ok := l.unlockedAt(file)
+		if !ok {
+			if err := l.append(ledgerOpUnlock, file, 0, ""); err != nil {
+				return removed, err
+			}
+			logger.Warn("immutable backup unlocked for rotation", "file", rel, "delete_after", si.Immutable.UnlockGrace)
+			if h.Events != nil {
+				h.Events.PushEvent("warn", "immutable_unlocked", agent,
+					fmt.Sprintf("%s released by rotation, deleted after %s", rel, si.Immutable.UnlockGrace), 0)
+			}
+			continue
+		}
+		if time.Since(at) < si.Immutable.UnlockGrace {
+			continue
+		}
+
+		for _, p := range backupFiles(path) {
+			if err := unlockFile(p, si.Immutable.Mode); err != nil {
+				return removed, fmt.Errorf("unlocking %s: %w", rel, err)
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return removed, fmt.Errorf("removing old backup %s: %w", rel, err)
+		}
+		removeSidecars(path)
+		removeEmptyDirs(agentDir, filepath.Dir(path))
+		if err := l.append(ledgerOpDelete, file, 0, ""); err != nil {
+			return append(removed, rel), err
+		}
+		removed = append(removed, rel)
+	}
+	return removed, nil
+}
+
+// backupFiles retorna o backup em path e os sidecars que existem.
+func backupFiles(path string) []string {
+	files := []string{path}
+	for _, p := range []string{fileManifestPath(path), archiveIndexPath(path)} {
+		if fileExists(p) {
+			files = append(files, p)
+		}
+	}
+	return files
+}
+
+// lockFile trava path conforme o modo de storages.*.immutable.
+func lockFile(path, mode string) error {
+	if mode == config.ImmutableModeChattr {
+		return setInodeFlag(path, fsImmutableFL, true)
+	}
+	return os.Chmod(path, 0444)
+}
+
+// unlockFile desfaz lockFile.
+func unlockFile(path, mode string) error {
+	if mode == config.ImmutableModeChattr {
+		return setInodeFlag(path, fsImmutableFL, false)
+	}
+	return os.Chmod(path, 0644)
+}
+
+// isLocked indica se path está travado conforme mode.
+func isLocked(path, mode string) (bool, error) {
+	if mode == config.ImmutableModeChattr {
+		flags, err := inodeFlags(path)
+		return flags&fsImmutableFL != 0, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return fi.Mode().Perm()&0222 == 0, nil
+}
+
+// LedgerReport é o resultado de VerifyLedger.
+type LedgerReport struct {
+	Path     string   `json:"path"`
+	Entries  int      `json:"entries"`  // registros válidos lidos
+	Live     int      `json:"live"`     // backups commitados e ainda não removidos
+	Problems []string `json:"problems"` // divergências encontradas
+}
+
+// OK indica que o ledger e o storage estão íntegros.
+func (r *LedgerReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *LedgerReport) addf(format string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// VerifyLedger confere o ledger do storage imutável si: assinatura e
+// encadeamento de cada registro, e os backups no disco contra os registros —
+// backups registrados ausentes, com tamanho (ou, com hashes, SHA-256)
+// diferente ou destravados, e backups no disco sem registro de commit.
+func VerifyLedger(si config.StorageInfo, hashes bool) (*LedgerReport, error) {
+	if !si.Immutable.Enabled {
+		return nil, errors.New("storage is not immutable")
+	}
+	key, err := pki.LoadPSK(si.Immutable.LedgerKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading ledger key: %w", err)
+	}
+
+	rep := &LedgerReport{Path: filepath.Join(si.BaseDir, ledgerFileName)}
+	entries, frep, err := statefile.ReadLog[LedgerEntry](rep.Path)
+	if err != nil {
+		return nil, fmt.Errorf("reading ledger: %w", err)
+	}
+	if frep.Corrupt > 0 {
+		rep.addf("ledger has %d corrupt records", frep.Corrupt)
+	}
+	if frep.TornTail {
+		rep.addf("ledger has a torn tail")
+	}
+	rep.Entries = len(entries)
+
+	live := make(map[string]LedgerEntry)
+	unlocked := make(map[string]bool)
+	var seq uint64
+	var prev string
+	for _, e := range entries {
+		if e.Seq != seq+1 {
+			rep.addf("record %d: sequence gap (expected %d)", e.Seq, seq+1)
+		}
+		if e.Prev != prev {
+			rep.addf("record %d: chain broken (prev does not match previous record)", e.Seq)
+		}
+		if !hmac.Equal([]byte(e.Sig), []byte(e.sign(key))) {
+			rep.addf("record %d: invalid signature", e.Seq)
+		}
+		seq, prev = e.Seq, e.Sig
+
+		switch e.Op {
+		case ledgerOpCommit:
+			live[e.File] = e
+			delete(unlocked, e.File)
+		case ledgerOpUnlock:
+			unlocked[e.File] = true
+		case ledgerOpDelete:
+			delete(live, e.File)
+			delete(unlocked, e.File)
+		default:
+			rep.addf("record %d: unknown op %q", e.Seq, e.Op)
+		}
+	}
+	rep.Live = len(live)
+
+	files := make([]string, 0, len(live))
+	for f := range live {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		e := live[file]
+		path := filepath.Join(si.BaseDir, filepath.FromSlash(file))
+		fi, err := os.Stat(path)
+		if err != nil {
+			rep.addf("%s: missing (%v)", file, err)
+			continue
+		}
+		if fi.Size() != e.Size {
+			rep.addf("%s: size %d, ledger records %d", file, fi.Size(), e.Size)
+		} else if hashes {
+			sum, err := hashFile(path)
+			if err != nil {
+				rep.addf("%s: hashing: %v", file, err)
+			} else if hex.EncodeToString(sum[:]) != e.SHA256 {
+				rep.addf("%s: sha256 %x, ledger records %s", file, sum, e.SHA256)
+			}
+		}
+		if unlocked[file] {
+			continue
+		}
+		if ok, err := isLocked(path, si.Immutable.Mode); err != nil {
+			rep.addf("%s: checking lock: %v", file, err)
+		} else if !ok {
+			rep.addf("%s: not locked (%s)", file, si.Immutable.Mode)
+		}
+	}
+
+	// Backups no disco sem commit no ledger (gravados fora do server ou antes
+	// de immutable ser habilitado)
+	err = filepath.WalkDir(si.BaseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == si.BaseDir {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != si.BaseDir && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "chunks_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isBackupFile(d.Name()) {
+			return nil
+		}
+		rel, _ := filepath.Rel(si.BaseDir, path)
+		if _, ok := live[filepath.ToSlash(rel)]; !ok {
+			rep.addf("%s: not recorded in the ledger", filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking base_dir: %w", err)
+	}
+	return rep, nil
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// inodeFlags lê as flags de inode de path (lsattr).
+func inodeFlags(path string) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return unix.IoctlGetUint32(int(f.Fd()), unix.FS_IOC_GETFLAGS)
+}
+
+// setInodeFlag liga ou desliga flag nas flags de inode de path (chattr).
+// Requer CAP_LINUX_IMMUTABLE e um filesystem com suporte (ext4, xfs, btrfs).
+func setInodeFlag(path string, flag uint32, on bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	flags, err := unix.IoctlGetUint32(int(f.Fd()), unix.FS_IOC_GETFLAGS)
+	if err != nil {
+		return fmt.Errorf("reading inode flags: %w", err)
+	}
+	if on {
+		flags |= flag
+	} else {
+		flags &^= flag
+	}
+	if err := unix.IoctlSetPointerInt(int(f.Fd()), unix.FS_IOC_SETFLAGS, int(flags)); err != nil {
+		return fmt.Errorf("setting inode flags: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+//go:build !linux
+
+package server
+
+import "errors"
+
+// Flags de inode (chattr) só existem no Linux: fora dele, immutable: chattr
+// falha ao travar e o modo chmod é o disponível.
+
+func inodeFlags(path string) (uint32, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func setInodeFlag(path string, flag uint32, on bool) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/sha256"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/statefile"
+)
+
+// immutableStorage cria um storage imutável (read_only) em um diretório
+// temporário, com a chave do ledger.
+func immutableStorage(t *testing.T) config.StorageInfo {
+	t.Helper()
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "ledger.key")
+	os.WriteFile(keyFile, []byte(strings.Repeat("k", 32)+"\n"), 0600)
+	return config.StorageInfo{
+		BaseDir:    filepath.Join(dir, "data"),
+		MaxBackups: 1,
+		Immutable: config.ImmutableConfig{
+			Enabled:       true,
+			Mode:          config.ImmutableModeReadOnly,
+			LedgerKeyFile: keyFile,
+			UnlockGrace:   time.Hour,
+		},
+	}
+}
+
+// commitImmutable grava e sela um backup com data em agentDir.
+func commitImmutable(t *testing.T, h *Handler, si config.StorageInfo, name, data string) string {
+	t.Helper()
+	agentDir := filepath.Join(si.BaseDir, "web-01", "app")
+	os.MkdirAll(agentDir, 0755)
+	path := filepath.Join(agentDir, name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h.sealBackup(si, "web-01", path, sha256.Sum256([]byte(data)), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return path
+}
+
+func TestImmutable_SealAndRotateWithGrace(t *testing.T) {
+	si := immutableStorage(t)
+	h := &Handler{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	old := commitImmutable(t, h, si, "2026-03-01T02-00-00-000.tar.gz", "old")
+	commitImmutable(t, h, si, "2026-03-02T02-00-00-000.tar.gz", "new")
+	if fi, _ := os.Stat(old); fi.Mode().Perm() != 0444 {
+		t.Fatalf("expected sealed backup with mode 0444, got %v", fi.Mode().Perm())
+	}
+
+	agentDir := filepath.Dir(old)
+	// Primeira rotação só libera o backup excedente
+	removed, err := h.rotateBackups(si, "web-01", agentDir, logger)
+	if err != nil || len(removed) != 0 {
+		t.Fatalf("first rotation: removed=%v err=%v", removed, err)
+	}
+	if !fileExists(old) {
+		t.Fatal("immutable backup deleted before unlock_grace")
+	}
+
+	// Após unlock_grace, a rotação seguinte remove
+	l, _ := h.ledger(si)
+	l.mu.Lock()
+	for f := range l.unlocked {
+		l.unlocked[f] = time.Now().Add(-2 * time.Hour)
+	}
+	l.mu.Unlock()
+	removed, err = h.rotateBackups(si, "web-01", agentDir, logger)
+	if err != nil || len(removed) != 1 || removed[0] != filepath.Base(old) {
+		t.Fatalf("second rotation: removed=%v err=%v", removed, err)
+	}
+	if fileExists(old) {
+		t.Fatal("expected backup removed after unlock_grace")
+	}
+
+	entries, rep, err := statefile.ReadLog[LedgerEntry](filepath.Join(si.BaseDir, ledgerFileName))
+	if err != nil || !rep.Clean() {
+		t.Fatalf("reading ledger: %v %v", err, rep)
+	}
+	var ops []string
+	for _, e := range entries {
+		ops = append(ops, e.Op)
+	}
+	if got := strings.Join(ops, ","); got != "commit,commit,unlock,delete" {
+		t.Errorf("unexpected ledger ops: %s", got)
+	}
+
+	rep2, err := VerifyLedger(si, true)
+	if err != nil || !rep2.OK() || rep2.Live != 1 {
+		t.Fatalf("expected clean ledger with 1 live backup: %+v err=%v", rep2, err)
+	}
+}
+
+func TestImmutable_UnlockSurvivesReopen(t *testing.T) {
+	si := immutableStorage(t)
+	h := &Handler{}
+	commitImmutable(t, h, si, "2026-03-01T02-00-00-000.tar.gz", "old")
+	commitImmutable(t, h, si, "2026-03-02T02-00-00-000.tar.gz", "new")
+	h.rotateBackups(si, "web-01", filepath.Join(si.BaseDir, "web-01", "app"), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	l, err := openLedger(si)
+	if err != nil {
+		t.Fatalf("openLedger: %v", err)
+	}
+	if l.seq != 3 {
+		t.Errorf("expected seq 3, got %d", l.seq)
+	}
+	if _, ok := l.unlockedAt("web-01/app/2026-03-01T02-00-00-000.tar.gz"); !ok {
+		t.Error("expected unlock to be restored from the ledger")
+	}
+}
+
+func TestVerifyLedger_DetectsTampering(t *testing.T) {
+	si := immutableStorage(t)
+	h := &Handler{}
+	modified := commitImmutable(t, h, si, "2026-03-01T02-00-00-000.tar.gz", "aaaa")
+	missing := commitImmutable(t, h, si, "2026-03-02T02-00-00-000.tar.gz", "bbbb")
+	unlocked := commitImmutable(t, h, si, "2026-03-03T02-00-00-000.tar.gz", "cccc")
+
+	os.Chmod(modified, 0644)
+	os.WriteFile(modified, []byte("AAAA"), 0644)
+	os.Chmod(modified, 0444)
+	os.Remove(missing)
+	os.Chmod(unlocked, 0644)
+	os.WriteFile(filepath.Join(si.BaseDir, "web-01", "app", "2026-03-04T02-00-00-000.tar.gz"), []byte("x"), 0444)
+
+	rep, err := VerifyLedger(si, false)
+	if err != nil {
+		t.Fatalf("VerifyLedger: %v", err)
+	}
+	// Sem --hashes, a troca de conteúdo com o mesmo tamanho passa
+	if len(rep.Problems) != 3 {
+		t.Fatalf("expected 3 problems without hashes, got %v", rep.Problems)
+	}
+	rep, _ = VerifyLedger(si, true)
+	if len(rep.Problems) != 4 {
+		t.Fatalf("expected 4 problems with hashes, got %v", rep.Problems)
+	}
+	for _, want := range []string{"sha256", "missing", "not locked", "not recorded"} {
+		if !strings.Contains(strings.Join(rep.Problems, "\n"), want) {
+			t.Errorf("expected a %q problem in %v", want, rep.Problems)
+		}
+	}
+
+	// Registro reescrito com a assinatura original: cadeia quebrada
+	path := filepath.Join(si.BaseDir, ledgerFileName)
+	entries, _, _ := statefile.ReadLog[LedgerEntry](path)
+	entries[1].SHA256 = entries[0].SHA256
+	if err := statefile.WriteLog(path, entries, 0600); err != nil {
+		t.Fatal(err)
+	}
+	rep, _ = VerifyLedger(si, false)
+	if !strings.Contains(strings.Join(rep.Problems, "\n"), "record 2: invalid signature") {
+		t.Errorf("expected invalid signature on record 2, got %v", rep.Problems)
+	}
+}
+
+func TestImmutable_ChattrMode(t *testing.T) {
+	probe := filepath.Join(t.TempDir(), "probe")
+	os.WriteFile(probe, nil, 0644)
+	if err := setInodeFlag(probe, fsImmutableFL, true); err != nil {
+		t.Skipf("chattr +i unavailable here: %v", err)
+	}
+	setInodeFlag(probe, fsImmutableFL, false)
+
+	si := immutableStorage(t)
+	si.Immutable.Mode = config.ImmutableModeChattr
+	h := &Handler{}
+	path := commitImmutable(t, h, si, "2026-03-01T02-00-00-000.tar.gz", "data")
+	defer unlockFile(path, config.ImmutableModeChattr)
+	defer setInodeFlag(filepath.Join(si.BaseDir, ledgerFileName), fsAppendFL, false)
+
+	if err := os.Remove(path); err == nil {
+		t.Fatal("expected removal of an immutable backup to fail")
+	}
+	if ok, err := isLocked(path, config.ImmutableModeChattr); err != nil || !ok {
+		t.Fatalf("expected backup locked: ok=%v err=%v", ok, err)
+	}
+	if rep, err := VerifyLedger(si, true); err != nil || !rep.OK() {
+		t.Fatalf("expected clean ledger: %+v err=%v", rep, err)
+	}
+}
+
+func TestQuarantineBackup_RefusesImmutable(t *testing.T) {
+	si := immutableStorage(t)
+	h := NewHandler(&config.ServerConfig{Storages: map[string]config.StorageInfo{"default": si}}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil)
+	commitImmutable(t, h, si, "2026-03-01T02-00-00-000.tar.gz", "data")
+	if _, err := h.QuarantineBackup("default", "web-01", "app", "2026-03-01T02-00-00-000.tar.gz"); err != errImmutable {
+		t.Fatalf("expected errImmutable, got %v", err)
+	}
+}
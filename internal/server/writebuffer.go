@@ -0,0 +1,90 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// Tamanhos de buffer de escrita em disco usados com write_buffer_size: auto.
+//
+// Em HDD, buffers maiores agrupam os writes de várias sessões simultâneas em
+// blocos sequenciais longos, reduzindo seeks. Em SSD/NVMe o ganho satura por
+// volta de 1MB e buffers maiores só aumentam o uso de memória por sessão.
+// Para medir no hardware alvo, ver BenchmarkDiskWriteBuffer (writebuffer_bench_test.go).
+const (
+	defaultWriteBufferSize = 1 * 1024 * 1024 // SSD/NVMe ou mídia desconhecida
+	hddWriteBufferSize     = 4 * 1024 * 1024 // disco rotacional
+)
+
+// Tipos de mídia detectados para o base_dir de um storage.
+const (
+	storageMediaHDD     = "hdd"
+	storageMediaSSD     = "ssd"
+	storageMediaUnknown = "unknown"
+)
+
+// storageMediaCache evita reler o sysfs a cada sessão (base_dir → mídia).
+var storageMediaCache sync.Map
+
+// writeBufferSize retorna o buffer de escrita em disco do storage: o valor
+// configurado em write_buffer_size ou, em auto, o default para a mídia do base_dir.
+func writeBufferSize(si config.StorageInfo) int {
+	if si.WriteBufferSizeRaw > 0 {
+		return int(si.WriteBufferSizeRaw)
+	}
+	if detectStorageMedia(si.BaseDir) == storageMediaHDD {
+		return hddWriteBufferSize
+	}
+	return defaultWriteBufferSize
+}
+
+// detectStorageMedia identifica se o base_dir está em disco rotacional (HDD)
+// via /sys/dev/block/<major>:<minor>/queue/rotational. Para partições, o
+// atributo é lido do dispositivo pai. Retorna "unknown" quando não é possível
+// determinar (ex: tmpfs, NFS, device-mapper sem queue, não-Linux).
+func detectStorageMedia(baseDir string) string {
+	if v, ok := storageMediaCache.Load(baseDir); ok {
+		return v.(string)
+	}
+	media := readStorageMedia(baseDir)
+	storageMediaCache.Store(baseDir, media)
+	return media
+}
+
+func readStorageMedia(baseDir string) string {
+	var st syscall.Stat_t
+	if err := syscall.Stat(baseDir, &st); err != nil {
+		return storageMediaUnknown
+	}
+	dev := uint64(st.Dev)
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+
+	sysDev := fmt.Sprintf("/sys/dev/block/%d:%d", major, minor)
+	for _, p := range []string{
+		filepath.Join(sysDev, "queue", "rotational"),
+		filepath.Join(sysDev, "..", "queue", "rotational"), // partição → disco pai
+	} {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(string(data)) {
+		case "1":
+			return storageMediaHDD
+		case "0":
+			return storageMediaSSD
+		}
+	}
+	return storageMediaUnknown
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+// Micro-benchmarks do buffer de escrita em disco (storages.*.write_buffer_size).
+//
+// Para comparar mídias, aponte NBACKUP_BENCH_DIR para um diretório no disco
+// desejado e compare os resultados com benchstat:
+//
+//	NBACKUP_BENCH_DIR=/mnt/hdd  go test ./internal/server -run '^$' -bench DiskWriteBuffer -count 5 > hdd.txt
+//	NBACKUP_BENCH_DIR=/mnt/nvme go test ./internal/server -run '^$' -bench DiskWriteBuffer -count 5 > nvme.txt
+//
+// Sem a variável, usa o diretório temporário do teste.
+
+// benchWriteSizes são os tamanhos de buffer comparados.
+var benchWriteSizes = []int{64 * 1024, 256 * 1024, 1024 * 1024, 4 * 1024 * 1024, 8 * 1024 * 1024}
+
+// benchSessionBytes é o volume escrito por sessão em cada iteração.
+const benchSessionBytes = 64 * 1024 * 1024
+
+// benchReadSize simula o tamanho típico de um read da rede entregue ao writer.
+const benchReadSize = 32 * 1024
+
+func benchDir(b *testing.B) string {
+	if dir := os.Getenv("NBACKUP_BENCH_DIR"); dir != "" {
+		d, err := os.MkdirTemp(dir, "nbackup-bench-")
+		if err != nil {
+			b.Fatalf("creating bench dir: %v", err)
+		}
+		b.Cleanup(func() { os.RemoveAll(d) })
+		return d
+	}
+	return b.TempDir()
+}
+
+// writeSession escreve benchSessionBytes em path via bufio com o buffer informado
+// e faz fsync ao final (como no commit de um backup).
+func writeSession(path string, bufSize int, payload []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriterSize(f, bufSize)
+	for written := 0; written < benchSessionBytes; written += len(payload) {
+		if _, err := w.Write(payload); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// BenchmarkDiskWriteBuffer mede o throughput de escrita de 1 e 4 sessões
+// simultâneas (arquivos distintos no mesmo disco) para cada tamanho de buffer.
+// Sessões simultâneas são o caso em que o coalescing faz diferença em HDD.
+func BenchmarkDiskWriteBuffer(b *testing.B) {
+	payload := make([]byte, benchReadSize)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	for _, sessions := range []int{1, 4} {
+		for _, size := range benchWriteSizes {
+			b.Run(fmt.Sprintf("sessions=%d/buffer=%dKB", sessions, size/1024), func(b *testing.B) {
+				dir := benchDir(b)
+				b.SetBytes(int64(sessions) * benchSessionBytes)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					var wg sync.WaitGroup
+					errs := make(chan error, sessions)
+					for s := 0; s < sessions; s++ {
+						wg.Add(1)
+						go func(s int) {
+							defer wg.Done()
+							path := fmt.Sprintf("%s/session-%d-%d.tmp", dir, i, s)
+							if err := writeSession(path, size, payload); err != nil {
+								errs <- err
+							}
+							os.Remove(path)
+						}(s)
+					}
+					wg.Wait()
+					close(errs)
+					if err := <-errs; err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func TestWriteBufferSize_ExplicitAndAuto(t *testing.T) {
+	explicit := config.StorageInfo{BaseDir: t.TempDir(), WriteBufferSize: "256kb", WriteBufferSizeRaw: 256 * 1024}
+	if got := writeBufferSize(explicit); got != 256*1024 {
+		t.Errorf("expected configured 256KB, got %d", got)
+	}
+
+	// Path inexistente: mídia desconhecida → default SSD/NVMe
+	missing := config.StorageInfo{BaseDir: filepath.Join(t.TempDir(), "missing"), WriteBufferSize: "auto"}
+	if media := detectStorageMedia(missing.BaseDir); media != storageMediaUnknown {
+		t.Errorf("expected unknown media for missing dir, got %s", media)
+	}
+	if got := writeBufferSize(missing); got != defaultWriteBufferSize {
+		t.Errorf("expected default buffer for unknown media, got %d", got)
+	}
+
+	// Auto em um diretório real: sempre um dos dois defaults
+	auto := config.StorageInfo{BaseDir: t.TempDir(), WriteBufferSize: "auto"}
+	if got := writeBufferSize(auto); got != defaultWriteBufferSize && got != hddWriteBufferSize {
+		t.Errorf("unexpected auto buffer size %d", got)
+	}
+}
+
+func TestChunkAssembler_CustomWriteBufferSize(t *testing.T) {
+	ca, err := NewChunkAssemblerWithOptions("wbuf", t.TempDir(), slog.New(slog.NewTextHandler(io.Discard, nil)), ChunkAssemblerOptions{WriteBufferSize: 64 * 1024})
+	if err != nil {
+		t.Fatalf("NewChunkAssemblerWithOptions: %v", err)
+	}
+	defer ca.Cleanup()
+	if ca.outBuf.Size() != 64*1024 {
+		t.Errorf("expected 64KB output buffer, got %d", ca.outBuf.Size())
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package soak
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// WriteCycle escreve uma linha por ciclo (saída de texto do nbackup-soak).
+func WriteCycle(w io.Writer, c Cycle) {
+	status := "ok"
+	if c.Error != "" {
+		status = "FAIL: " + c.Error
+	}
+	fmt.Fprintf(w, "%s #%-4d %3d streams  %5d KB chunks  %9s  %6.1fs  retransmit %-9s %s\n",
+		c.Agent, c.Cycle, c.Streams, c.ChunkSize/1024, formatBytes(c.Bytes), c.DurationSeconds,
+		formatBytes(int64(c.RetransmitBytes)), status)
+}
+
+// WriteSummary escreve o resumo do soak test em texto ou, com json, como
+// um objeto JSON.
+func WriteSummary(w io.Writer, s *Summary, jsonOutput bool) error {
+	if jsonOutput {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	result := "PASS"
+	if !s.OK {
+		result = "FAIL"
+	}
+	fmt.Fprintf(w, "\nsoak %s: %d cycles in %.0fs (seed %d, assembler %s)\n",
+		result, s.Cycles, s.DurationSeconds, s.Seed, s.AssemblerMode)
+	fmt.Fprintf(w, "  data:       %s verified, %.1f MB/s, %s retransmitted\n",
+		formatBytes(s.Bytes), s.MBs, formatBytes(int64(s.RetransmitBytes)))
+	fmt.Fprintf(w, "  failures:   %d (%d checksum mismatches)\n", s.Failures, s.ChecksumMismatches)
+
+	names := make([]string, 0, len(s.Agents))
+	for name := range s.Agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		a := s.Agents[name]
+		fmt.Fprintf(w, "    %s  %d cycles, %d failed, %s\n", name, a.Cycles, a.Failures, formatBytes(a.Bytes))
+	}
+	if len(s.LeftoverFiles) > 0 {
+		fmt.Fprintf(w, "  leftover staging files (%d):\n", len(s.LeftoverFiles))
+		for _, f := range s.LeftoverFiles {
+			fmt.Fprintf(w, "    %s\n", f)
+		}
+	}
+	for _, e := range s.Errors {
+		fmt.Fprintf(w, "  error: %s\n", e)
+	}
+	return nil
+}
+
+func formatBytes(b int64) string {
+	switch {
+	case b >= 1024*1024*1024:
+		return fmt.Sprintf("%.1f GB", float64(b)/(1024*1024*1024))
+	case b >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(b)/(1024*1024))
+	case b >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(b)/1024)
+	default:
+		return fmt.Sprintf("%d B", b)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package soak
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+)
+
+// certValidity é a validade dos certificados gerados para o soak test.
+const certValidity = 7 * 24 * time.Hour
+
+// soakCerts são os caminhos da PKI gerada para o server e os agents.
+type soakCerts struct {
+	ca, serverCert, serverKey string
+	agents                    map[string][2]string // agent → {cert, key}
+}
+
+// generatePKI gera em dir uma CA, o certificado do server (127.0.0.1) e um
+// certificado de client por agent.
+func generatePKI(dir string, agents []string) (*soakCerts, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	certs := &soakCerts{
+		ca:         filepath.Join(dir, "ca.pem"),
+		serverCert: filepath.Join(dir, "server.pem"),
+		serverKey:  filepath.Join(dir, "server-key.pem"),
+		agents:     make(map[string][2]string),
+	}
+	caKey := filepath.Join(dir, "ca-key.pem")
+
+	certPEM, keyPEM, err := pki.GenerateCA("nbackup soak CA", certValidity)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFiles(certs.ca, certPEM, caKey, keyPEM); err != nil {
+		return nil, err
+	}
+	ca, err := pki.LoadCA(certs.ca, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM, keyPEM, err = ca.IssueServerCert([]string{"127.0.0.1", "localhost"}, certValidity)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFiles(certs.serverCert, certPEM, certs.serverKey, keyPEM); err != nil {
+		return nil, err
+	}
+
+	for _, name := range agents {
+		keyPEM, csrPEM, err := pki.NewClientCSR(name)
+		if err != nil {
+			return nil, err
+		}
+		certPEM, err := ca.SignClientCSR(csrPEM, name, certValidity)
+		if err != nil {
+			return nil, err
+		}
+		paths := [2]string{filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")}
+		if err := writeFiles(paths[0], certPEM, paths[1], keyPEM); err != nil {
+			return nil, err
+		}
+		certs.agents[name] = paths
+	}
+	return certs, nil
+}
+
+func writeFiles(certPath string, certPEM []byte, keyPath string, keyPEM []byte) error {
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(keyPath, keyPEM, 0600)
+}
+
+// loadServerConfig grava e carrega o server.yaml do soak test, com o storage
+// soak (file, com o assembler_mode escolhido): a carga aplica os mesmos
+// defaults e validações de um server real. O chaos mode usa as
+// probabilidades de opts.
+func loadServerConfig(dir, storageDir string, certs *soakCerts, opts Options) (*config.ServerConfig, error) {
+	path := filepath.Join(dir, "server.yaml")
+	err := os.WriteFile(path, []byte(fmt.Sprintf(`server:
+  listen: 127.0.0.1:0
+tls:
+  ca_cert: %q
+  server_cert: %q
+  server_key: %q
+storages:
+  %s:
+    base_dir: %q
+    max_backups: 2
+    assembler_mode: %s
+logging:
+  level: info
+`, certs.ca, certs.serverCert, certs.serverKey, storageName, storageDir, opts.AssemblerMode)), 0600)
+	if err != nil {
+		return nil, fmt.Errorf("writing server config: %w", err)
+	}
+	cfg, err := config.LoadServerConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	// As probabilidades valem exatamente como informadas (0 = falha desligada),
+	// sem os defaults do chaos.enabled
+	cfg.Chaos = config.ChaosConfig{
+		Enabled:                 opts.DropProbability > 0 || opts.SACKDelayProbability > 0 || opts.RotateProbability > 0,
+		DropProbabilityRaw:      opts.DropProbability,
+		SACKDelayProbabilityRaw: opts.SACKDelayProbability,
+		SACKDelayMax:            2 * time.Second,
+		RotateProbabilityRaw:    opts.RotateProbability,
+	}
+	return cfg, nil
+}
+
+// loadAgentConfig grava e carrega o agent.yaml de um agent simulado.
+func loadAgentConfig(dir, name, address string, certs *soakCerts) (*config.AgentConfig, error) {
+	path := filepath.Join(dir, name+".yaml")
+	err := os.WriteFile(path, []byte(fmt.Sprintf(`agent:
+  name: %q
+server:
+  address: %q
+tls:
+  ca_cert: %q
+  client_cert: %q
+  client_key: %q
+backups:
+  - name: %q
+    storage: %q
+    schedule: "0 2 * * *"
+    sources:
+      - path: /
+`, name, address, certs.ca, certs.agents[name][0], certs.agents[name][1], backupName, storageName)), 0600)
+	if err != nil {
+		return nil, fmt.Errorf("writing agent config: %w", err)
+	}
+	return config.LoadAgentConfig(path)
+}
@@ -0,0 +1,380 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// Package soak executa sessões paralelas de longa duração contra um server
+// em processo (nbackup-soak): N agents simulados enviam dados sintéticos em
+// ciclos, com streams, chunk e tamanho sorteados e quedas de conexão
+// injetadas pelo chaos mode. Cada backup commitado é relido do storage e
+// conferido pelo SHA-256, e no fim o staging do assembler precisa estar
+// vazio. Pega regressões que só aparecem após horas de sessões seguidas
+// (ex: o assembler lazy).
+package soak
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/agent"
+	"github.com/nishisan-dev/n-backup/internal/config"
+	"github.com/nishisan-dev/n-backup/internal/pki"
+	"github.com/nishisan-dev/n-backup/internal/server"
+)
+
+const (
+	storageName = "soak"
+	backupName  = "soak"
+	// maxErrors limita os erros guardados no Summary.
+	maxErrors = 20
+)
+
+// Options configura um soak test.
+type Options struct {
+	Agents     int           // agents simulados, cada um com seu certificado (default: 4)
+	MinStreams int           // streams por sessão, sorteados em [MinStreams, MaxStreams] (default: 1)
+	MaxStreams int           // default: 8
+	ChunkSizes []int64       // chunk de cada sessão, sorteado (default: 256kb, 1mb, 4mb)
+	MinSize    int64         // bytes por sessão, sorteados em [MinSize, MaxSize] (default: 8mb)
+	MaxSize    int64         // default: 128mb
+	Duration   time.Duration // tempo total; nenhum ciclo começa depois dele (default: 1h)
+	Cycles     int           // limite de ciclos por agent (0 = só Duration)
+	// AssemblerMode é o assembler_mode do storage (default: lazy).
+	AssemblerMode string
+	// Probabilidades do chaos mode do server (0 desabilita a falha).
+	DropProbability      float64 // queda de stream por chunk
+	SACKDelayProbability float64 // ChunkSACK atrasado (até 2s)
+	RotateProbability    float64 // flow rotation por stream a cada 15s
+	Dir                  string  // diretório de trabalho (default: temporário, removido no fim)
+	Seed                 int64   // semente dos sorteios (0 = time.Now)
+	OnCycle              func(Cycle)
+}
+
+func (o *Options) defaults() error {
+	if o.Agents <= 0 {
+		o.Agents = 4
+	}
+	if o.MinStreams <= 0 {
+		o.MinStreams = 1
+	}
+	if o.MaxStreams <= 0 {
+		o.MaxStreams = 8
+	}
+	if o.MinStreams > o.MaxStreams || o.MaxStreams > 255 {
+		return fmt.Errorf("streams must satisfy 1 <= min <= max <= 255, got %d-%d", o.MinStreams, o.MaxStreams)
+	}
+	if len(o.ChunkSizes) == 0 {
+		o.ChunkSizes = []int64{256 * 1024, 1024 * 1024, 4 * 1024 * 1024}
+	}
+	for _, c := range o.ChunkSizes {
+		if c < 64*1024 || c > 16*1024*1024 {
+			return fmt.Errorf("chunk sizes must be between 64kb and 16mb, got %d", c)
+		}
+	}
+	if o.MinSize <= 0 {
+		o.MinSize = 8 * 1024 * 1024
+	}
+	if o.MaxSize <= 0 {
+		o.MaxSize = 128 * 1024 * 1024
+	}
+	if o.MinSize > o.MaxSize {
+		return fmt.Errorf("session size must satisfy min <= max, got %d-%d", o.MinSize, o.MaxSize)
+	}
+	if o.Duration <= 0 {
+		o.Duration = time.Hour
+	}
+	if o.AssemblerMode == "" {
+		o.AssemblerMode = server.AssemblerModeLazy
+	}
+	for name, p := range map[string]float64{
+		"drop":       o.DropProbability,
+		"sack delay": o.SACKDelayProbability,
+		"rotate":     o.RotateProbability,
+	} {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("%s probability must be between 0.0 and 1.0, got %.4f", name, p)
+		}
+	}
+	if o.Seed == 0 {
+		o.Seed = time.Now().UnixNano()
+	}
+	return nil
+}
+
+// Cycle é o resultado de uma sessão de um agent simulado.
+type Cycle struct {
+	Agent           string  `json:"agent"`
+	Cycle           int     `json:"cycle"`
+	Streams         int     `json:"streams"`
+	ChunkSize       int64   `json:"chunk_size"`
+	Bytes           int64   `json:"bytes"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	RetransmitBytes uint64  `json:"retransmit_bytes"`
+	Verified        bool    `json:"verified"` // backup relido e com o SHA-256 esperado
+	Error           string  `json:"error,omitempty"`
+}
+
+// AgentSummary são os totais de um agent simulado.
+type AgentSummary struct {
+	Cycles   int   `json:"cycles"`
+	Failures int   `json:"failures"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// Summary é o resultado do soak test. OK exige nenhuma falha de sessão,
+// nenhum backup divergente e o staging vazio no fim.
+type Summary struct {
+	Seed               int64                   `json:"seed"`
+	AssemblerMode      string                  `json:"assembler_mode"`
+	DurationSeconds    float64                 `json:"duration_seconds"`
+	Cycles             int                     `json:"cycles"`
+	Failures           int                     `json:"failures"`
+	ChecksumMismatches int                     `json:"checksum_mismatches"`
+	Bytes              int64                   `json:"bytes"`
+	RetransmitBytes    uint64                  `json:"retransmit_bytes"`
+	MBs                float64                 `json:"mb_s"`
+	LeftoverFiles      []string                `json:"leftover_files,omitempty"` // staging não removido
+	Agents             map[string]AgentSummary `json:"agents"`
+	Errors             []string                `json:"errors,omitempty"` // primeiros erros
+	OK                 bool                    `json:"ok"`
+}
+
+// Run sobe o server em processo e os agents simulados e executa ciclos até
+// opts.Duration (ou opts.Cycles por agent, ou o cancelamento de ctx). O log
+// do server vai para {Dir}/server.log; o dos agents, para logger.
+func Run(ctx context.Context, opts Options, logger *slog.Logger) (*Summary, error) {
+	if err := opts.defaults(); err != nil {
+		return nil, err
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "nbackup-soak-*")
+		if err != nil {
+			return nil, fmt.Errorf("creating work dir: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+	storageDir := filepath.Join(dir, "storage")
+	if err := os.MkdirAll(storageDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating storage dir: %w", err)
+	}
+
+	names := make([]string, opts.Agents)
+	for i := range names {
+		names[i] = fmt.Sprintf("soak-agent-%02d", i+1)
+	}
+	certs, err := generatePKI(filepath.Join(dir, "pki"), names)
+	if err != nil {
+		return nil, fmt.Errorf("generating PKI: %w", err)
+	}
+
+	serverCfg, err := loadServerConfig(dir, storageDir, certs, opts)
+	if err != nil {
+		return nil, err
+	}
+	serverTLS, err := pki.NewServerTLSConfig(certs.ca, certs.serverCert, certs.serverKey)
+	if err != nil {
+		return nil, fmt.Errorf("server TLS: %w", err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverTLS)
+	if err != nil {
+		return nil, fmt.Errorf("listening: %w", err)
+	}
+	logFile, err := os.Create(filepath.Join(dir, "server.log"))
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("creating server log: %w", err)
+	}
+	defer logFile.Close()
+
+	serverCtx, stopServer := context.WithCancel(context.Background())
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		serverLogger := slog.New(slog.NewTextHandler(logFile, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		if err := server.RunWithListener(serverCtx, ln, serverCfg, serverLogger); err != nil {
+			logger.Error("soak server stopped", "error", err)
+		}
+	}()
+	defer func() {
+		stopServer()
+		ln.Close()
+		<-serverDone
+	}()
+
+	logger.Info("soak test started",
+		"agents", opts.Agents, "duration", opts.Duration, "seed", opts.Seed,
+		"assembler_mode", opts.AssemblerMode, "dir", dir)
+
+	start := time.Now()
+	deadline := start.Add(opts.Duration)
+	sum := &Summary{Seed: opts.Seed, AssemblerMode: opts.AssemblerMode, Agents: make(map[string]AgentSummary)}
+	var mu sync.Mutex
+	record := func(c Cycle) {
+		mu.Lock()
+		sum.add(c)
+		mu.Unlock()
+		if opts.OnCycle != nil {
+			opts.OnCycle(c)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		agentCfg, err := loadAgentConfig(dir, name, ln.Addr().String(), certs)
+		if err != nil {
+			return nil, err
+		}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(opts.Seed + int64(i)))
+			for n := 1; opts.Cycles == 0 || n <= opts.Cycles; n++ {
+				if ctx.Err() != nil || time.Now().After(deadline) {
+					return
+				}
+				record(runCycle(ctx, agentCfg, name, n, rng, storageDir, opts, logger))
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	sum.DurationSeconds = time.Since(start).Seconds()
+	if sum.DurationSeconds > 0 {
+		sum.MBs = float64(sum.Bytes) / (1024 * 1024) / sum.DurationSeconds
+	}
+	sum.LeftoverFiles = leftoverFiles(storageDir)
+	sum.OK = sum.Failures == 0 && sum.ChecksumMismatches == 0 && len(sum.LeftoverFiles) == 0 && sum.Cycles > 0
+	return sum, nil
+}
+
+// runCycle executa uma sessão com parâmetros sorteados e confere o backup
+// commitado.
+func runCycle(ctx context.Context, cfg *config.AgentConfig, name string, n int, rng *rand.Rand, storageDir string, opts Options, logger *slog.Logger) Cycle {
+	c := Cycle{
+		Agent:     name,
+		Cycle:     n,
+		Streams:   opts.MinStreams + rng.Intn(opts.MaxStreams-opts.MinStreams+1),
+		ChunkSize: opts.ChunkSizes[rng.Intn(len(opts.ChunkSizes))],
+		Bytes:     opts.MinSize + rng.Int63n(opts.MaxSize-opts.MinSize+1),
+	}
+	start := time.Now()
+	res, err := agent.RunBench(ctx, cfg, agent.BenchOptions{
+		Storage:    storageName,
+		BackupName: backupName,
+		Streams:    c.Streams,
+		Size:       c.Bytes,
+		ChunkSize:  c.ChunkSize,
+		Interval:   time.Minute,
+		Seed:       rng.Int63() | 1,
+	}, logger.With("agent", name, "cycle", n))
+	c.DurationSeconds = time.Since(start).Seconds()
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	for _, s := range res.PerStream {
+		c.RetransmitBytes += s.RetransmitBytes
+	}
+	if err := verifyLatest(filepath.Join(storageDir, name, backupName), c.Bytes, res.Checksum); err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	c.Verified = true
+	return c
+}
+
+func (s *Summary) add(c Cycle) {
+	s.Cycles++
+	a := s.Agents[c.Agent]
+	a.Cycles++
+	if c.Error != "" {
+		s.Failures++
+		a.Failures++
+		if strings.HasPrefix(c.Error, "checksum mismatch") {
+			s.ChecksumMismatches++
+		}
+		if len(s.Errors) < maxErrors {
+			s.Errors = append(s.Errors, fmt.Sprintf("%s cycle %d: %s", c.Agent, c.Cycle, c.Error))
+		}
+	} else {
+		s.Bytes += c.Bytes
+		a.Bytes += c.Bytes
+		s.RetransmitBytes += c.RetransmitBytes
+	}
+	s.Agents[c.Agent] = a
+}
+
+// verifyLatest relê o backup mais recente de agentDir (o commit do ciclo:
+// cada agent roda uma sessão por vez) e confere tamanho e SHA-256.
+func verifyLatest(agentDir string, size int64, checksum string) error {
+	entries, err := os.ReadDir(agentDir)
+	if err != nil {
+		return fmt.Errorf("reading backups: %w", err)
+	}
+	var backups []string
+	for _, e := range entries {
+		if !e.IsDir() && !strings.HasSuffix(e.Name(), ".tmp") {
+			backups = append(backups, e.Name())
+		}
+	}
+	if len(backups) == 0 {
+		return fmt.Errorf("no committed backup in %s", agentDir)
+	}
+	// O timestamp no nome ordena cronologicamente
+	sort.Strings(backups)
+	path := filepath.Join(agentDir, backups[len(backups)-1])
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening backup: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("reading backup: %w", err)
+	}
+	if n != size {
+		return fmt.Errorf("size mismatch in %s: expected %d bytes, got %d", path, size, n)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != checksum {
+		return fmt.Errorf("checksum mismatch in %s: expected %s, got %s", path, checksum, got)
+	}
+	return nil
+}
+
+// leftoverFiles lista o que sobrou no storage além dos backups commitados:
+// diretórios de chunks, arquivos montados e temporários de sessões já
+// encerradas.
+func leftoverFiles(storageDir string) []string {
+	var out []string
+	filepath.WalkDir(storageDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		staging := d.IsDir() && strings.HasPrefix(d.Name(), "chunks_")
+		if staging || (!d.IsDir() && strings.HasSuffix(d.Name(), ".tmp")) {
+			rel, _ := filepath.Rel(storageDir, path)
+			out = append(out, rel)
+		}
+		if staging {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return out
+}
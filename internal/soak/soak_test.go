@@ -0,0 +1,72 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package soak
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRun_ShortSoak(t *testing.T) {
+	var cycles int
+	sum, err := Run(context.Background(), Options{
+		Agents:          2,
+		MaxStreams:      3,
+		ChunkSizes:      []int64{64 * 1024, 256 * 1024},
+		MinSize:         1024 * 1024,
+		MaxSize:         3 * 1024 * 1024,
+		Duration:        time.Minute,
+		Cycles:          2,
+		DropProbability: 0.02,
+		Dir:             t.TempDir(),
+		Seed:            7,
+		OnCycle:         func(Cycle) { cycles++ },
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !sum.OK || sum.Cycles != 4 || cycles != 4 {
+		t.Fatalf("unexpected summary: %+v", sum)
+	}
+	for name, a := range sum.Agents {
+		if a.Cycles != 2 || a.Bytes < 2*1024*1024 {
+			t.Errorf("unexpected totals for %s: %+v", name, a)
+		}
+	}
+}
+
+func TestVerifyLatest_DetectsMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "2026-01-01T00-00-00-000.tar.gz", "old")
+	writeFile(t, dir, "2026-01-02T00-00-00-000.tar.gz", "new")
+	writeFile(t, dir, "assembled_x.tmp", "partial")
+
+	// sha256("new")
+	const sumNew = "11507a0e2f5e69d5dfa40a62a1bd7b6ee57e6bcd85c67c9b8431b36fff21c437"
+	if err := verifyLatest(dir, 3, sumNew); err != nil {
+		t.Fatalf("expected newest backup verified: %v", err)
+	}
+	if err := verifyLatest(dir, 3, "00"); err == nil {
+		t.Error("expected checksum mismatch")
+	}
+	if err := verifyLatest(dir, 4, sumNew); err == nil {
+		t.Error("expected size mismatch")
+	}
+	if got := leftoverFiles(dir); len(got) != 1 || got[0] != "assembled_x.tmp" {
+		t.Errorf("expected the assembled temp as leftover, got %v", got)
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// Package sockopt aplica o ajuste de sockets TCP (server.socket) no dial do
+// agent e no listener do server.
+package sockopt
+
+import (
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// Dialer retorna um net.Dialer que aplica cfg em cada socket antes do connect:
+// buffers definidos antes do SYN entram no window scaling negociado.
+func Dialer(cfg config.SocketConfig) *net.Dialer {
+	return &net.Dialer{
+		KeepAlive:       keepAlivePeriod(cfg),
+		KeepAliveConfig: keepAliveConfig(cfg),
+		Control:         control(cfg),
+	}
+}
+
+// ListenConfig retorna um net.ListenConfig que aplica cfg ao socket de listen;
+// o kernel copia buffers, TCP_USER_TIMEOUT e congestion control para as
+// conexões aceitas, e o keepalive é aplicado pelo Accept.
+func ListenConfig(cfg config.SocketConfig) *net.ListenConfig {
+	return &net.ListenConfig{
+		KeepAlive:       keepAlivePeriod(cfg),
+		KeepAliveConfig: keepAliveConfig(cfg),
+		Control:         control(cfg),
+	}
+}
+
+// keepAlivePeriod mantém o default do Go (15s) com keepalive 0 e desabilita
+// os probes com keepalive negativo.
+func keepAlivePeriod(cfg config.SocketConfig) time.Duration {
+	if cfg.KeepAlive < 0 {
+		return -1
+	}
+	return 0
+}
+
+func keepAliveConfig(cfg config.SocketConfig) net.KeepAliveConfig {
+	if cfg.KeepAlive <= 0 {
+		return net.KeepAliveConfig{}
+	}
+	return net.KeepAliveConfig{Enable: true, Idle: cfg.KeepAlive, Interval: cfg.KeepAlive, Count: -1}
+}
+
+// control retorna a função que aplica as opções com setsockopt (nil se não
+// há nada a aplicar).
+func control(cfg config.SocketConfig) func(network, address string, c syscall.RawConn) error {
+	if cfg.UserTimeout == 0 && cfg.SendBufferRaw == 0 && cfg.ReceiveBufferRaw == 0 && cfg.Congestion == "" {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var sysErr error
+		err := c.Control(func(fd uintptr) {
+			sysErr = apply(int(fd), cfg)
+		})
+		if err != nil {
+			return err
+		}
+		return sysErr
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package sockopt
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+func apply(fd int, cfg config.SocketConfig) error {
+	if cfg.SendBufferRaw > 0 {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF, int(cfg.SendBufferRaw)); err != nil {
+			return fmt.Errorf("setsockopt SO_SNDBUF=%d: %w", cfg.SendBufferRaw, err)
+		}
+	}
+	if cfg.ReceiveBufferRaw > 0 {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, int(cfg.ReceiveBufferRaw)); err != nil {
+			return fmt.Errorf("setsockopt SO_RCVBUF=%d: %w", cfg.ReceiveBufferRaw, err)
+		}
+	}
+	if cfg.UserTimeout > 0 {
+		ms := int(cfg.UserTimeout.Milliseconds())
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT, ms); err != nil {
+			return fmt.Errorf("setsockopt TCP_USER_TIMEOUT=%dms: %w", ms, err)
+		}
+	}
+	if cfg.Congestion != "" {
+		if err := unix.SetsockoptString(fd, unix.IPPROTO_TCP, unix.TCP_CONGESTION, cfg.Congestion); err != nil {
+			return fmt.Errorf("setsockopt TCP_CONGESTION=%s (see /proc/sys/net/ipv4/tcp_allowed_congestion_control): %w", cfg.Congestion, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package sockopt
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// sockOpts lê as opções aplicadas em conn.
+func sockOpts(t *testing.T, conn net.Conn) (rcvbuf, userTimeout, keepIdle int, congestion string) {
+	t.Helper()
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw.Control(func(fd uintptr) {
+		rcvbuf, _ = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+		userTimeout, _ = unix.GetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT)
+		keepIdle, _ = unix.GetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_KEEPIDLE)
+		congestion, _ = unix.GetsockoptString(int(fd), unix.IPPROTO_TCP, unix.TCP_CONGESTION)
+	})
+	return rcvbuf, userTimeout, keepIdle, strings.TrimRight(congestion, "\x00")
+}
+
+func TestDialerAndListener_ApplySocketOptions(t *testing.T) {
+	cfg := config.SocketConfig{
+		KeepAlive:        45 * time.Second,
+		UserTimeout:      20 * time.Second,
+		ReceiveBufferRaw: 256 * 1024,
+		SendBufferRaw:    256 * 1024,
+		Congestion:       "reno", // sempre embutido no kernel
+	}
+	ctx := context.Background()
+	ln, err := ListenConfig(cfg).Listen(ctx, "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := ln.Accept()
+		accepted <- c
+	}()
+
+	conn, err := Dialer(cfg).DialContext(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	srv := <-accepted
+	if srv == nil {
+		t.Fatal("accept failed")
+	}
+	defer srv.Close()
+
+	for side, c := range map[string]net.Conn{"dialer": conn, "listener": srv} {
+		rcvbuf, userTimeout, keepIdle, congestion := sockOpts(t, c)
+		// O kernel dobra SO_RCVBUF (metade vai para o overhead de metadados)
+		if rcvbuf < 256*1024 {
+			t.Errorf("%s: SO_RCVBUF = %d, want >= 256kb", side, rcvbuf)
+		}
+		if userTimeout != 20000 {
+			t.Errorf("%s: TCP_USER_TIMEOUT = %d, want 20000", side, userTimeout)
+		}
+		if keepIdle != 45 {
+			t.Errorf("%s: TCP_KEEPIDLE = %d, want 45", side, keepIdle)
+		}
+		if congestion != "reno" {
+			t.Errorf("%s: TCP_CONGESTION = %q, want reno", side, congestion)
+		}
+	}
+}
+
+func TestDialer_UnknownCongestionControlFails(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	_, err = Dialer(config.SocketConfig{Congestion: "nbackup_nope"}).Dial("tcp", ln.Addr().String())
+	if err == nil || !strings.Contains(err.Error(), "TCP_CONGESTION") {
+		t.Errorf("expected TCP_CONGESTION error, got %v", err)
+	}
+}
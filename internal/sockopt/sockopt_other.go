@@ -0,0 +1,20 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+//go:build !linux
+
+package sockopt
+
+import (
+	"fmt"
+
+	"github.com/nishisan-dev/n-backup/internal/config"
+)
+
+// apply falha fora do Linux: buffers, TCP_USER_TIMEOUT e congestion control
+// são aplicados com setsockopt específicos do kernel Linux. O keepalive não
+// passa por aqui e funciona em qualquer plataforma.
+func apply(fd int, cfg config.SocketConfig) error {
+	return fmt.Errorf("socket options (send_buffer, receive_buffer, user_timeout, congestion) are only supported on Linux")
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package statefile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// Result é o resultado do fsck de um arquivo de estado.
+type Result struct {
+	Kind     string // ex: "events", "schedule-state"
+	Path     string
+	Report   Report
+	Missing  bool // arquivo ainda não criado (não é um problema)
+	Repaired bool
+	Err      error
+}
+
+// Status resume o resultado: ok, legacy, missing, repaired, corrupt ou error.
+func (r Result) Status() string {
+	switch {
+	case r.Err != nil:
+		return "error"
+	case r.Missing:
+		return "missing"
+	case r.Repaired:
+		return "repaired"
+	case !r.Report.Clean():
+		return "corrupt"
+	case r.Report.Legacy > 0:
+		return "legacy"
+	}
+	return "ok"
+}
+
+// Unresolved indica um problema que continua no arquivo (corrompido e não
+// reparado, ou erro de leitura/escrita).
+func (r Result) Unresolved() bool {
+	s := r.Status()
+	return s == "error" || s == "corrupt"
+}
+
+// Fsck verifica o arquivo de estado path. Com repair, reescreve o arquivo
+// apenas com os registros válidos (ver Repair); arquivos no formato antigo
+// são convertidos.
+func Fsck(kind, path string, repair bool) Result {
+	res := Result{Kind: kind, Path: path}
+	if repair {
+		res.Report, res.Repaired, res.Err = Repair(path)
+	} else {
+		res.Report, res.Err = Check(path)
+	}
+	if errors.Is(res.Err, os.ErrNotExist) {
+		res.Missing, res.Err = true, nil
+	}
+	return res
+}
+
+// WriteResults imprime os resultados como tabela e retorna quantos arquivos
+// continuam com problemas.
+func WriteResults(w io.Writer, results []Result) (int, error) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tPATH\tSTATUS\tDETAILS")
+	unresolved := 0
+	for _, r := range results {
+		details := "-"
+		switch {
+		case r.Err != nil:
+			details = r.Err.Error()
+		case !r.Missing:
+			details = r.Report.String()
+		}
+		if r.Unresolved() {
+			unresolved++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Kind, r.Path, r.Status(), details)
+	}
+	return unresolved, tw.Flush()
+}
+
+// FsckReport é a saída do fsck com --output json.
+type FsckReport struct {
+	Unresolved int          `json:"unresolved"` // arquivos que continuam com problemas
+	Files      []FileReport `json:"files"`
+}
+
+// FileReport é o resultado de um arquivo em FsckReport.
+type FileReport struct {
+	Kind          string `json:"kind"`
+	Path          string `json:"path"`
+	Status        string `json:"status"` // ok, legacy, missing, repaired, corrupt ou error
+	Records       int    `json:"records"`
+	Legacy        int    `json:"legacy,omitempty"`
+	Corrupt       int    `json:"corrupt,omitempty"`
+	TornTailBytes int64  `json:"torn_tail_bytes,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// WriteResultsJSON imprime os resultados em JSON indentado e retorna quantos
+// arquivos continuam com problemas.
+func WriteResultsJSON(w io.Writer, results []Result) (int, error) {
+	rep := FsckReport{Files: []FileReport{}}
+	for _, r := range results {
+		f := FileReport{Kind: r.Kind, Path: r.Path, Status: r.Status()}
+		if r.Err != nil {
+			f.Error = r.Err.Error()
+		} else if !r.Missing {
+			f.Records, f.Legacy, f.Corrupt = r.Report.Records, r.Report.Legacy, r.Report.Corrupt
+			if r.Report.TornTail {
+				f.TornTailBytes = r.Report.Size - r.Report.ValidSize
+			}
+		}
+		if r.Unresolved() {
+			rep.Unresolved++
+		}
+		rep.Files = append(rep.Files, f)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return rep.Unresolved, enc.Encode(rep)
+}
@@ -0,0 +1,359 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+// Package statefile implementa o formato dos arquivos de estado persistentes
+// (históricos JSONL do server, estado do scheduler e do digest do agent,
+// tokens de enrollment): registros com tamanho e checksum, recuperáveis após
+// um crash no meio de uma escrita.
+//
+// Cada registro ocupa uma linha:
+//
+//	<tamanho> <crc32c> <payload JSON>\n
+//
+// onde tamanho é o número de bytes do payload (decimal) e crc32c o checksum
+// Castagnoli do payload (8 dígitos hexadecimais). O payload é JSON compacto,
+// sem quebras de linha, e o arquivo continua legível com ferramentas de linha
+// (`cut -d' ' -f3- | jq`).
+//
+// Na leitura, registros com tamanho ou checksum inválidos são descartados e
+// uma cauda incompleta (escrita interrompida por crash ou falta de espaço) é
+// ignorada — OpenLog a trunca antes de voltar a fazer append. Linhas no formato
+// antigo (JSON puro, um objeto por linha, ou um documento JSON indentado) são
+// aceitas e convertidas na próxima reescrita.
+package statefile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ErrNoRecord indica que o arquivo não contém nenhum registro válido.
+var ErrNoRecord = errors.New("no valid record")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// maxPayload limita o tamanho declarado de um registro (proteção contra
+// cabeçalhos corrompidos).
+const maxPayload = 64 << 20
+
+// Report resume a leitura de um arquivo de estado.
+type Report struct {
+	Records   int   // registros válidos (incluindo os do formato antigo)
+	Legacy    int   // registros válidos no formato antigo (JSON sem tamanho/checksum)
+	Corrupt   int   // registros descartados (tamanho, checksum ou JSON inválido)
+	TornTail  bool  // o último registro está incompleto (sem quebra de linha final)
+	Size      int64 // tamanho do arquivo
+	ValidSize int64 // bytes até o fim do último registro completo
+}
+
+// Clean indica que o arquivo não tem registros descartados nem cauda incompleta.
+func (r Report) Clean() bool {
+	return r.Corrupt == 0 && !r.TornTail
+}
+
+// String resume o report para logs e para o fsck.
+func (r Report) String() string {
+	s := fmt.Sprintf("%d records", r.Records)
+	if r.Legacy > 0 {
+		s += fmt.Sprintf(", %d legacy", r.Legacy)
+	}
+	if r.Corrupt > 0 {
+		s += fmt.Sprintf(", %d corrupt", r.Corrupt)
+	}
+	if r.TornTail {
+		s += fmt.Sprintf(", torn tail (%d bytes)", r.Size-r.ValidSize)
+	}
+	return s
+}
+
+// Marshal serializa v como um registro completo (com a quebra de linha).
+func Marshal(v any) ([]byte, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Frame(payload), nil
+}
+
+// Frame envolve um payload JSON compacto (sem quebras de linha) em um registro.
+func Frame(payload []byte) []byte {
+	line := make([]byte, 0, len(payload)+20)
+	line = strconv.AppendInt(line, int64(len(payload)), 10)
+	line = append(line, ' ')
+	line = fmt.Appendf(line, "%08x", crc32.Checksum(payload, castagnoli))
+	line = append(line, ' ')
+	line = append(line, payload...)
+	return append(line, '\n')
+}
+
+// Parse percorre os registros de data, chamando fn com o payload de cada
+// registro válido. Se fn retornar erro, o registro é contado como corrompido.
+func Parse(data []byte, fn func(payload []byte) error) Report {
+	rep := Report{Size: int64(len(data))}
+	if fn == nil {
+		fn = func([]byte) error { return nil }
+	}
+	accept := func(payload []byte, legacy bool) {
+		if fn(payload) != nil {
+			rep.Corrupt++
+			return
+		}
+		rep.Records++
+		if legacy {
+			rep.Legacy++
+		}
+	}
+
+	// Documento no formato antigo: um único valor JSON, possivelmente indentado
+	if trimmed := bytes.TrimSpace(data); isJSONStart(trimmed) && bytes.IndexByte(trimmed, '\n') >= 0 && json.Valid(trimmed) {
+		accept(trimmed, true)
+		rep.ValidSize = rep.Size
+		return rep
+	}
+
+	off := 0
+	for off < len(data) {
+		nl := bytes.IndexByte(data[off:], '\n')
+		if nl < 0 {
+			rep.TornTail = true
+			break
+		}
+		line := data[off : off+nl]
+		off += nl + 1
+		rep.ValidSize = int64(off)
+
+		switch {
+		case len(bytes.TrimSpace(line)) == 0:
+		case isJSONStart(line):
+			if json.Valid(line) {
+				accept(line, true)
+			} else {
+				rep.Corrupt++
+			}
+		default:
+			if payload, ok := unframe(line); ok {
+				accept(payload, false)
+			} else {
+				rep.Corrupt++
+			}
+		}
+	}
+	return rep
+}
+
+// unframe valida o cabeçalho e o checksum de uma linha e retorna o payload.
+func unframe(line []byte) ([]byte, bool) {
+	sp := bytes.IndexByte(line, ' ')
+	if sp <= 0 || sp > 10 {
+		return nil, false
+	}
+	size, err := strconv.Atoi(string(line[:sp]))
+	if err != nil || size < 0 || size > maxPayload {
+		return nil, false
+	}
+	rest := line[sp+1:]
+	if len(rest) < 9 || rest[8] != ' ' {
+		return nil, false
+	}
+	sum, err := strconv.ParseUint(string(rest[:8]), 16, 32)
+	if err != nil {
+		return nil, false
+	}
+	payload := rest[9:]
+	if len(payload) != size || crc32.Checksum(payload, castagnoli) != uint32(sum) {
+		return nil, false
+	}
+	return payload, true
+}
+
+func isJSONStart(b []byte) bool {
+	return len(b) > 0 && (b[0] == '{' || b[0] == '[')
+}
+
+// Check lê o arquivo e retorna o report sem modificá-lo. Um arquivo
+// inexistente retorna um erro os.ErrNotExist.
+func Check(path string) (Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Report{}, err
+	}
+	return Parse(data, nil), nil
+}
+
+// ReadLog lê todos os registros válidos do arquivo como T. Um arquivo
+// inexistente resulta em lista vazia.
+func ReadLog[T any](path string) ([]T, Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, Report{}, nil
+		}
+		return nil, Report{}, err
+	}
+	var entries []T
+	rep := Parse(data, func(payload []byte) error {
+		var e T
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, rep, nil
+}
+
+// OpenLog lê os registros válidos do arquivo, trunca uma cauda incompleta e
+// abre o arquivo para append (criando-o, se preciso).
+func OpenLog[T any](path string, perm os.FileMode) ([]T, *os.File, Report, error) {
+	entries, rep, err := ReadLog[T](path)
+	if err != nil {
+		return nil, nil, rep, err
+	}
+	if rep.TornTail {
+		if err := os.Truncate(path, rep.ValidSize); err != nil {
+			return nil, nil, rep, fmt.Errorf("truncating torn tail: %w", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, perm)
+	if err != nil {
+		return nil, nil, rep, err
+	}
+	return entries, f, rep, nil
+}
+
+// Append grava v como um registro no fim de f (aberto por OpenLog).
+func Append(f *os.File, v any) error {
+	line, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(line)
+	return err
+}
+
+// WriteLog reescreve o arquivo com entries de forma atômica (usado na rotação
+// e no reparo): grava em um temporário, faz fsync e renomeia.
+func WriteLog[T any](path string, entries []T, perm os.FileMode) error {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		line, err := Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+	}
+	return writeAtomic(path, buf.Bytes(), perm)
+}
+
+// WriteDocument grava v como o único registro do arquivo, de forma atômica.
+func WriteDocument(path string, v any, perm os.FileMode) error {
+	line, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, line, perm)
+}
+
+// ReadDocument lê o último registro válido do arquivo em v. Aceita documentos
+// no formato antigo (JSON puro). Retorna ErrNoRecord se nenhum registro for
+// válido e um erro os.ErrNotExist se o arquivo não existir.
+func ReadDocument(path string, v any) (Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Report{}, err
+	}
+	var last []byte
+	rep := Parse(data, func(payload []byte) error {
+		if !json.Valid(payload) {
+			return ErrNoRecord
+		}
+		last = payload
+		return nil
+	})
+	if last == nil {
+		return rep, fmt.Errorf("%s: %w", path, ErrNoRecord)
+	}
+	return rep, json.Unmarshal(last, v)
+}
+
+// Repair reescreve o arquivo apenas com os registros válidos (convertendo os
+// do formato antigo). O original é preservado em {path}.corrupt quando havia
+// registros descartados ou cauda incompleta. Não faz nada se o arquivo já está
+// íntegro e no formato atual. Retorna o report da leitura e se o arquivo foi
+// reescrito.
+func Repair(path string) (Report, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Report{}, false, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return Report{}, false, err
+	}
+
+	var buf bytes.Buffer
+	rep := Parse(data, func(payload []byte) error {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, payload); err != nil {
+			return err
+		}
+		buf.Write(Frame(compact.Bytes()))
+		return nil
+	})
+	if rep.Clean() && rep.Legacy == 0 {
+		return rep, false, nil
+	}
+
+	if !rep.Clean() {
+		if err := writeAtomic(path+".corrupt", data, fi.Mode().Perm()); err != nil {
+			return rep, false, fmt.Errorf("saving original copy: %w", err)
+		}
+	}
+	if err := writeAtomic(path, buf.Bytes(), fi.Mode().Perm()); err != nil {
+		return rep, false, err
+	}
+	return rep, true, nil
+}
+
+// writeAtomic grava data em path via arquivo temporário + fsync + rename,
+// e faz fsync do diretório para persistir o rename.
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2025 Nishisan. All rights reserved.
+// Use of this source code is governed by the N-Backup License (Non-Commercial Evaluation)
+// that can be found in the LICENSE file.
+
+package statefile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type rec struct {
+	N int    `json:"n"`
+	S string `json:"s,omitempty"`
+}
+
+func TestOpenLog_TruncatesTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.jsonl")
+	var data []byte
+	for i := 1; i <= 3; i++ {
+		line, _ := Marshal(rec{N: i})
+		data = append(data, line...)
+	}
+	torn, _ := Marshal(rec{N: 4, S: "interrupted"})
+	data = append(data, torn[:len(torn)/2]...)
+	os.WriteFile(path, data, 0644)
+
+	entries, f, rep, err := OpenLog[rec](path, 0644)
+	if err != nil {
+		t.Fatalf("OpenLog: %v", err)
+	}
+	if len(entries) != 3 || rep.Records != 3 || !rep.TornTail || rep.Corrupt != 0 {
+		t.Fatalf("unexpected load: entries=%v report=%+v", entries, rep)
+	}
+	if err := Append(f, rec{N: 5}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	f.Close()
+
+	entries, rep, _ = ReadLog[rec](path)
+	if len(entries) != 4 || entries[3].N != 5 || !rep.Clean() {
+		t.Errorf("expected append after the last complete record, got %v (%s)", entries, rep)
+	}
+}
+
+func TestParse_DropsCorruptRecords(t *testing.T) {
+	good1, _ := Marshal(rec{N: 1})
+	good2, _ := Marshal(rec{N: 2})
+	flipped := bytes.Replace(good2, []byte(`"n":2`), []byte(`"n":3`), 1) // checksum não bate
+	short := append([]byte("99 "), good1[bytes.IndexByte(good1, ' ')+1:]...)
+
+	data := bytes.Join([][]byte{good1, flipped, short, []byte("garbage\n"), []byte(`{"n":7}` + "\n"), []byte("{\"n\":\n"), good2}, nil)
+	var got []int
+	rep := Parse(data, func(p []byte) error {
+		got = append(got, len(p))
+		return nil
+	})
+	if rep.Records != 3 || rep.Legacy != 1 || rep.Corrupt != 4 || rep.TornTail {
+		t.Errorf("unexpected report %+v", rep)
+	}
+}
+
+func TestDocument_RoundTripAndLegacy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	if err := WriteDocument(path, rec{N: 1, S: "a"}, 0644); err != nil {
+		t.Fatalf("WriteDocument: %v", err)
+	}
+	var got rec
+	if _, err := ReadDocument(path, &got); err != nil || got.N != 1 || got.S != "a" {
+		t.Fatalf("ReadDocument: %+v %v", got, err)
+	}
+
+	legacy := filepath.Join(dir, "legacy.json")
+	os.WriteFile(legacy, []byte("{\n  \"n\": 2,\n  \"s\": \"b\"\n}\n"), 0644)
+	rep, err := ReadDocument(legacy, &got)
+	if err != nil || got.N != 2 || rep.Legacy != 1 {
+		t.Fatalf("legacy ReadDocument: %+v %+v %v", got, rep, err)
+	}
+
+	broken := filepath.Join(dir, "broken.json")
+	os.WriteFile(broken, []byte("{\n  \"n\": 2,\n"), 0644)
+	if _, err := ReadDocument(broken, &got); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("expected ErrNoRecord, got %v", err)
+	}
+	if _, err := ReadDocument(filepath.Join(dir, "missing.json"), &got); !os.IsNotExist(err) {
+		t.Errorf("expected not exist, got %v", err)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.jsonl")
+	good, _ := Marshal(rec{N: 1})
+	original := append(append([]byte(`{"n":0}`+"\n"), good...), []byte("12 deadbeef {\"n\"")...)
+	os.WriteFile(path, original, 0640)
+
+	rep, repaired, err := Repair(path)
+	if err != nil || !repaired || rep.Records != 2 || !rep.TornTail {
+		t.Fatalf("Repair: report=%+v repaired=%v err=%v", rep, repaired, err)
+	}
+	if saved, _ := os.ReadFile(path + ".corrupt"); !bytes.Equal(saved, original) {
+		t.Error("expected original preserved in .corrupt")
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0640 {
+		t.Errorf("expected permissions preserved, got %v", fi.Mode().Perm())
+	}
+
+	rep, err = Check(path)
+	if err != nil || !rep.Clean() || rep.Legacy != 0 || rep.Records != 2 {
+		t.Errorf("expected clean file after repair, got %+v %v", rep, err)
+	}
+	if _, repaired, _ := Repair(path); repaired {
+		t.Error("expected no rewrite for a clean file")
+	}
+}
+
+func TestFsck(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.jsonl")
+	WriteLog(good, []rec{{N: 1}, {N: 2}}, 0644)
+	bad := filepath.Join(dir, "bad.jsonl")
+	os.WriteFile(bad, []byte(`{"n":1}`+"\ngarbage\n"), 0644)
+
+	results := []Result{
+		Fsck("good", good, false),
+		Fsck("bad", bad, false),
+		Fsck("missing", filepath.Join(dir, "missing.jsonl"), false),
+	}
+	for i, want := range []string{"ok", "corrupt", "missing"} {
+		if got := results[i].Status(); got != want {
+			t.Errorf("%s: expected %s, got %s", results[i].Kind, want, got)
+		}
+	}
+	var out bytes.Buffer
+	if n, _ := WriteResults(&out, results); n != 1 {
+		t.Errorf("expected 1 unresolved file, got %d\n%s", n, out.String())
+	}
+
+	out.Reset()
+	if n, err := WriteResultsJSON(&out, results); n != 1 || err != nil {
+		t.Errorf("expected 1 unresolved file in JSON, got %d (%v)", n, err)
+	}
+	var rep FsckReport
+	if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if rep.Unresolved != 1 || len(rep.Files) != 3 || rep.Files[1].Status != "corrupt" || rep.Files[1].Corrupt != 1 || rep.Files[1].Records != 1 {
+		t.Errorf("unexpected report: %+v", rep)
+	}
+
+	if res := Fsck("bad", bad, true); res.Status() != "repaired" || res.Unresolved() {
+		t.Errorf("expected repaired, got %s (%v)", res.Status(), res.Err)
+	}
+	if res := Fsck("bad", bad, false); res.Status() != "ok" {
+		t.Errorf("expected ok after repair, got %s", res.Status())
+	}
+}